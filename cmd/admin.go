@@ -0,0 +1,423 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+// Handles the admin subcommands, which manage the users and log level of a
+// running server from its Admin service
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+
+	"gitlab.com/elixxir/remoteSyncServer/rpc"
+)
+
+const adminIPFilterRemoveFlag = "remove"
+
+func init() {
+	addAdminFlags(adminCmd.PersistentFlags())
+	for _, cmd := range []*cobra.Command{adminUserAddCmd, adminUserPasswdCmd} {
+		cmd.Flags().StringP(userPasswordFlag, "p", "",
+			"Password for the user. If not set, it is read from stdin.")
+	}
+	for _, cmd := range []*cobra.Command{adminAllowCmd, adminDenyCmd} {
+		cmd.Flags().Bool(adminIPFilterRemoveFlag, false,
+			"Remove the network from the list instead of adding it.")
+	}
+
+	// Errors are caused by the arguments or the server, so printing the usage
+	// does not help
+	for _, cmd := range []*cobra.Command{adminUsersCmd, adminUserAddCmd,
+		adminUserRmCmd, adminUserPasswdCmd, adminQuotaCmd, adminBanCmd,
+		adminUnbanCmd, adminLogLevelCmd, adminAllowCmd, adminDenyCmd,
+		adminIPBansCmd, adminClearIPBansCmd} {
+		cmd.SilenceUsage = true
+		adminCmd.AddCommand(cmd)
+	}
+	rootCmd.AddCommand(adminCmd)
+}
+
+var adminCmd = &cobra.Command{
+	Use:   "admin",
+	Short: "Manages the users and log level of a running server",
+	Long: "Manages the users, quotas, bans, log level, IP filter, and IP " +
+		"bans of a running server using its admin API. If an admin " +
+		"listener is configured, it is used with its key; otherwise, the " +
+		"server's certificate and admin key are read from the config file.",
+}
+
+var adminUsersCmd = &cobra.Command{
+	Use:   "users",
+	Short: "Lists the users with their storage, quota, and ban",
+	Long: "Lists the registered users with the size of their files, their " +
+		"quota, and whether they are banned. Measuring the storage reads the " +
+		"size of every user's files, so it can take a while on large stores.",
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		initConfig(configFilePath)
+
+		client, ctx, cancel, err := dialAdmin(cmd)
+		if err != nil {
+			return err
+		}
+		defer cancel()
+
+		resp, err := client.ListUsers(ctx, &rpc.RsListUsersRequest{})
+		if err != nil {
+			return errors.Wrap(err, "failed to list users")
+		}
+		printUsers(resp.GetUsers())
+		return nil
+	},
+}
+
+var adminUserAddCmd = &cobra.Command{
+	Use:   "add <username>",
+	Short: "Adds a new user",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		initConfig(configFilePath)
+		username := args[0]
+		password, err := flagPassword(cmd)
+		if err != nil {
+			return err
+		}
+
+		client, ctx, cancel, err := dialAdmin(cmd)
+		if err != nil {
+			return err
+		}
+		defer cancel()
+
+		_, err = client.AddUser(ctx,
+			&rpc.RsAddUserRequest{Username: username, Password: password})
+		if err != nil {
+			return errors.Wrapf(err, "failed to add user %q", username)
+		}
+		fmt.Printf("Added user %s\n", username)
+		return nil
+	},
+}
+
+var adminUserRmCmd = &cobra.Command{
+	Use:   "rm <username>",
+	Short: "Removes a user and ends their sessions",
+	Long: "Removes the credentials, quota, and ban of a user and ends their " +
+		"sessions. Their files are kept.",
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		initConfig(configFilePath)
+		username := args[0]
+
+		client, ctx, cancel, err := dialAdmin(cmd)
+		if err != nil {
+			return err
+		}
+		defer cancel()
+
+		resp, err := client.DeleteUser(
+			ctx, &rpc.RsDeleteUserRequest{Username: username})
+		if err != nil {
+			return errors.Wrapf(err, "failed to remove user %q", username)
+		}
+		fmt.Printf("Removed user %s (active session ended: %t)\n",
+			username, resp.GetSessionEnded())
+		return nil
+	},
+}
+
+var adminUserPasswdCmd = &cobra.Command{
+	Use:   "passwd <username>",
+	Short: "Changes the password of a user",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		initConfig(configFilePath)
+		username := args[0]
+		password, err := flagPassword(cmd)
+		if err != nil {
+			return err
+		}
+
+		client, ctx, cancel, err := dialAdmin(cmd)
+		if err != nil {
+			return err
+		}
+		defer cancel()
+
+		_, err = client.SetPassword(ctx,
+			&rpc.RsSetPasswordRequest{Username: username, Password: password})
+		if err != nil {
+			return errors.Wrapf(err, "failed to set password of %q", username)
+		}
+		fmt.Printf("Changed password of %s\n", username)
+		return nil
+	},
+}
+
+var adminQuotaCmd = &cobra.Command{
+	Use:   "quota <username> <bytes>",
+	Short: "Limits the total size of the files of a user",
+	Long: "Limits the total size of the files of a user in bytes. Writes " +
+		"that would exceed it fail with RESOURCE_EXHAUSTED. A quota of 0 " +
+		"removes it.",
+	Args: cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		initConfig(configFilePath)
+		username := args[0]
+		quota, err := strconv.ParseInt(args[1], 10, 64)
+		if err != nil || quota < 0 {
+			return errors.Errorf("invalid quota %q", args[1])
+		}
+
+		client, ctx, cancel, err := dialAdmin(cmd)
+		if err != nil {
+			return err
+		}
+		defer cancel()
+
+		resp, err := client.SetQuota(ctx,
+			&rpc.RsSetQuotaRequest{Username: username, Quota: quota})
+		if err != nil {
+			return errors.Wrapf(err, "failed to set quota of %q", username)
+		}
+		fmt.Printf("Quota of %s set to %s (was %s)\n", username,
+			formatLimit(quota), formatLimit(resp.GetPreviousQuota()))
+		return nil
+	},
+}
+
+var adminBanCmd = &cobra.Command{
+	Use:   "ban <username> [reason]",
+	Short: "Bans a user and ends their sessions",
+	Long: "Bans a user and ends their sessions. Their logins fail with " +
+		"PERMISSION_DENIED, showing the reason, until they are unbanned.",
+	Args: cobra.RangeArgs(1, 2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		initConfig(configFilePath)
+		var reason string
+		if len(args) > 1 {
+			reason = args[1]
+		}
+		return setBanned(cmd, args[0], true, reason)
+	},
+}
+
+var adminUnbanCmd = &cobra.Command{
+	Use:   "unban <username>",
+	Short: "Unbans a user",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		initConfig(configFilePath)
+		return setBanned(cmd, args[0], false, "")
+	},
+}
+
+var adminLogLevelCmd = &cobra.Command{
+	Use:   "log-level <level>",
+	Short: "Changes the log level of a running server",
+	Long: "Changes the log level of a running server: 0 for INFO, 1 for " +
+		"DEBUG, and 2 or more for TRACE. The level lasts until it is changed " +
+		"again or the config is reloaded.",
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		initConfig(configFilePath)
+		level, err := strconv.ParseUint(args[0], 10, 32)
+		if err != nil {
+			return errors.Errorf("invalid log level %q", args[0])
+		}
+
+		client, ctx, cancel, err := dialAdmin(cmd)
+		if err != nil {
+			return err
+		}
+		defer cancel()
+
+		_, err = client.SetLogLevel(
+			ctx, &rpc.RsSetLogLevelRequest{Level: uint32(level)})
+		if err != nil {
+			return errors.Wrap(err, "failed to set log level")
+		}
+		fmt.Printf("Log level set to %d\n", level)
+		return nil
+	},
+}
+
+var adminAllowCmd = &cobra.Command{
+	Use:   "allow <network>",
+	Short: "Adds an IP address or CIDR network to the IP filter allow list",
+	Long: "Adds an IP address or CIDR network to the allow list of the IP " +
+		"filter, or removes it with --remove. Once any network is allowed, " +
+		"connections are only accepted from allowed networks. The change " +
+		"lasts until the server is restarted.",
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		initConfig(configFilePath)
+		return updateIPFilter(cmd, args[0], false)
+	},
+}
+
+var adminDenyCmd = &cobra.Command{
+	Use:   "deny <network>",
+	Short: "Adds an IP address or CIDR network to the IP filter deny list",
+	Long: "Adds an IP address or CIDR network to the deny list of the IP " +
+		"filter, or removes it with --remove. New connections from denied " +
+		"networks are closed, even if they are allowed. The change lasts " +
+		"until the server is restarted.",
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		initConfig(configFilePath)
+		return updateIPFilter(cmd, args[0], true)
+	},
+}
+
+var adminIPBansCmd = &cobra.Command{
+	Use:   "ip-bans",
+	Short: "Lists the IP addresses banned for too many failed requests",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		initConfig(configFilePath)
+		client, ctx, cancel, err := dialAdmin(cmd)
+		if err != nil {
+			return err
+		}
+		defer cancel()
+
+		resp, err := client.ListIPBans(ctx, &rpc.RsListIPBansRequest{})
+		if err != nil {
+			return errors.Wrap(err, "failed to list IP bans")
+		}
+		printIPBans(resp.GetBans())
+		return nil
+	},
+}
+
+var adminClearIPBansCmd = &cobra.Command{
+	Use:   "clear-ip-bans [ip]",
+	Short: "Lifts the ban of an IP address or of all addresses",
+	Long: "Lifts the ban of an IP address and resets its failure counts, or " +
+		"of all addresses if none is given.",
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		initConfig(configFilePath)
+		var ip string
+		if len(args) > 0 {
+			ip = args[0]
+		}
+
+		client, ctx, cancel, err := dialAdmin(cmd)
+		if err != nil {
+			return err
+		}
+		defer cancel()
+
+		resp, err := client.ClearIPBans(ctx, &rpc.RsClearIPBansRequest{IP: ip})
+		if err != nil {
+			return errors.Wrap(err, "failed to clear IP bans")
+		}
+		fmt.Printf("Cleared %d IP bans\n", resp.GetCleared())
+		return nil
+	},
+}
+
+// updateIPFilter adds or removes the network in the allow or deny list of the
+// IP filter of the server and prints the resulting lists.
+func updateIPFilter(cmd *cobra.Command, network string, deny bool) error {
+	remove, _ := cmd.Flags().GetBool(adminIPFilterRemoveFlag)
+	client, ctx, cancel, err := dialAdmin(cmd)
+	if err != nil {
+		return err
+	}
+	defer cancel()
+
+	resp, err := client.UpdateIPFilter(ctx, &rpc.RsUpdateIPFilterRequest{
+		Network: network, Deny: deny, Remove: remove})
+	if err != nil {
+		return errors.Wrap(err, "failed to update IP filter")
+	}
+	if !resp.GetChanged() {
+		fmt.Println("IP filter unchanged")
+	}
+	fmt.Printf("Allowed: %s\nDenied:  %s\n",
+		formatNetworks(resp.GetAllow(), "all"),
+		formatNetworks(resp.GetDeny(), "none"))
+	return nil
+}
+
+// formatNetworks returns the networks separated by commas, or empty if there
+// are none.
+func formatNetworks(networks []string, empty string) string {
+	if len(networks) == 0 {
+		return empty
+	}
+	return strings.Join(networks, ", ")
+}
+
+// setBanned bans or unbans the user on the server.
+func setBanned(
+	cmd *cobra.Command, username string, banned bool, reason string) error {
+	client, ctx, cancel, err := dialAdmin(cmd)
+	if err != nil {
+		return err
+	}
+	defer cancel()
+
+	resp, err := client.SetBanned(ctx, &rpc.RsSetBannedRequest{
+		Username: username, Banned: banned, Reason: reason})
+	if err != nil {
+		return errors.Wrapf(err, "failed to set ban of %q", username)
+	}
+	if banned {
+		fmt.Printf("Banned %s (was banned: %t, active session ended: %t)\n",
+			username, resp.GetWasBanned(), resp.GetSessionEnded())
+	} else {
+		fmt.Printf("Unbanned %s (was banned: %t)\n",
+			username, resp.GetWasBanned())
+	}
+	return nil
+}
+
+// printIPBans prints a table of the banned IP addresses.
+func printIPBans(bans []*rpc.RsIPBan) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(w, "IP\tUNTIL\tREASON")
+	for _, ban := range bans {
+		_, _ = fmt.Fprintf(w, "%s\t%s\t%s\n", ban.GetIP(),
+			time.Unix(0, ban.GetUntil()).Format(time.RFC3339),
+			ban.GetReason())
+	}
+	_ = w.Flush()
+}
+
+// printUsers prints a table of the users.
+func printUsers(users []*rpc.RsUserStatus) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(w, "USERNAME\tSTORAGE\tQUOTA\tBANNED")
+	for _, user := range users {
+		storage := "unknown"
+		if user.GetStorageBytes() >= 0 {
+			storage = formatBytes(user.GetStorageBytes())
+		}
+		banned := "no"
+		if user.GetBanned() {
+			banned = "yes"
+			if user.GetBanReason() != "" {
+				banned += " (" + user.GetBanReason() + ")"
+			}
+		}
+		_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", user.GetUsername(),
+			storage, formatLimit(user.GetQuota()), banned)
+	}
+	_ = w.Flush()
+}
@@ -0,0 +1,138 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+// Handles the API key administration subcommands
+
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"gitlab.com/elixxir/remoteSyncServer/server"
+)
+
+const apiKeyScopesFlag = "scopes"
+
+func init() {
+	apiKeyCreateCmd.Flags().StringP(apiKeyScopesFlag, "s",
+		string(server.ScopeRead), "Comma-separated list of scopes to grant "+
+			"(read, write, admin).")
+
+	// Errors are caused by the arguments or the credential store, so printing
+	// the usage does not help
+	for _, cmd := range []*cobra.Command{
+		apiKeyCreateCmd, apiKeyListCmd, apiKeyRevokeCmd} {
+		cmd.SilenceUsage = true
+		apiKeyCmd.AddCommand(cmd)
+	}
+	rootCmd.AddCommand(apiKeyCmd)
+}
+
+var apiKeyCmd = &cobra.Command{
+	Use:   "apikey",
+	Short: "Manages scoped API keys for automation",
+}
+
+var apiKeyCreateCmd = &cobra.Command{
+	Use:   "create [username]",
+	Short: "Creates a new API key and prints it",
+	Long: "Creates a new API key with the given scopes and prints it. The " +
+		"key cannot be shown again. A username is required unless the only " +
+		"scope is admin.",
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		initConfig(configFilePath)
+		var username string
+		if len(args) > 0 {
+			username = args[0]
+		}
+
+		scopesFlag, err := cmd.Flags().GetString(apiKeyScopesFlag)
+		if err != nil {
+			return err
+		}
+		scopes, err := server.ParseScopes(scopesFlag)
+		if err != nil {
+			return err
+		}
+
+		apiKeys, err := newAPIKeys()
+		if err != nil {
+			return err
+		}
+		key, err := apiKeys.Create(username, scopes)
+		if err != nil {
+			return err
+		}
+		fmt.Println(key)
+		return nil
+	},
+}
+
+var apiKeyListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "Lists the ID, user, and scopes of all API keys",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		initConfig(configFilePath)
+		apiKeys, err := newAPIKeys()
+		if err != nil {
+			return err
+		}
+
+		keys, err := apiKeys.List()
+		if err != nil {
+			return err
+		}
+		for _, key := range keys {
+			fmt.Printf("%s\t%s\t%s\n", key.ID, key.Username, key.Scopes)
+		}
+		return nil
+	},
+}
+
+var apiKeyRevokeCmd = &cobra.Command{
+	Use:   "revoke <id>...",
+	Short: "Revokes API keys so that they can no longer be used to log in",
+	Args:  cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		initConfig(configFilePath)
+		apiKeys, err := newAPIKeys()
+		if err != nil {
+			return err
+		}
+
+		for _, id := range args {
+			if err = apiKeys.Revoke(id); err != nil {
+				return errors.Wrapf(err, "failed to revoke API key %s", id)
+			}
+			fmt.Printf("Revoked %s\n", id)
+		}
+		return nil
+	},
+}
+
+// newAPIKeys opens the API key store of the configured credentials backend.
+func newAPIKeys() (*server.APIKeys, error) {
+	backend := viper.GetString(credentialsBackendTag)
+	db, err := openCredentialDB(backend)
+	if err != nil {
+		return nil, err
+	}
+
+	keys, err := newCredentialStore(
+		backend, db, viper.GetString(apiKeysCsvPathTag), apiKeysTable)
+	if err != nil {
+		return nil, err
+	}
+
+	return server.NewAPIKeys(keys), nil
+}
@@ -0,0 +1,77 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+// Handles the audit subcommands, which inspect the audit log
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"gitlab.com/elixxir/remoteSyncServer/server"
+	"gitlab.com/xx_network/primitives/utils"
+)
+
+func init() {
+	// Errors are caused by the audit log, so printing the usage does not help
+	auditVerifyCmd.SilenceUsage = true
+	auditCmd.AddCommand(auditVerifyCmd)
+	rootCmd.AddCommand(auditCmd)
+}
+
+var auditCmd = &cobra.Command{
+	Use:   "audit",
+	Short: "Inspects the audit log of sync operations",
+}
+
+var auditVerifyCmd = &cobra.Command{
+	Use:   "verify [path]",
+	Short: "Verifies the hash chain of an audit log",
+	Long: "Verifies that no entry of an audit log written with hashChain " +
+		"enabled was modified, inserted, or removed, by checking the hash of " +
+		"each entry and that it links to the previous entry. Defaults to the " +
+		"audit log in the config file. Entries removed from the end of the " +
+		"log cannot be detected, so compare the number of entries with an " +
+		"earlier verification.",
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		var path string
+		if len(args) > 0 {
+			path = args[0]
+		} else {
+			initConfig(configFilePath)
+			path = viper.GetString(auditParamsTag + ".path")
+			if path == "" {
+				return errors.Errorf("no path given and %s.path is not set",
+					auditParamsTag)
+			}
+		}
+		path, err := utils.ExpandPath(path)
+		if err != nil {
+			return errors.Wrapf(err, "unable to expand path %s", path)
+		}
+
+		f, err := os.Open(path)
+		if err != nil {
+			return errors.Wrapf(err, "unable to open audit log %s", path)
+		}
+		defer f.Close()
+
+		n, err := server.VerifyAuditLog(f)
+		if err != nil {
+			return errors.Wrapf(err, "audit log %s failed verification after "+
+				"%d valid entries", path, n)
+		}
+		fmt.Printf("Verified %d entries of %s\n", n, path)
+		return nil
+	},
+}
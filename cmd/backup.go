@@ -0,0 +1,269 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+// Handles the backup subcommand, which writes a backup of a running server
+// from its Admin service, and decrypts encrypted backups
+
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"google.golang.org/grpc/metadata"
+
+	"gitlab.com/elixxir/remoteSyncServer/rpc"
+	"gitlab.com/elixxir/remoteSyncServer/server"
+	"gitlab.com/xx_network/primitives/utils"
+)
+
+const (
+	backupOutputFlag         = "output"
+	backupSinceFlag          = "since"
+	backupPassphraseFileFlag = "passphraseFile"
+
+	// backupFilePerm is the permissions of backup files.
+	backupFilePerm = os.FileMode(0600)
+)
+
+func init() {
+	addAdminFlags(backupCmd.Flags())
+	backupCmd.Flags().StringP(backupOutputFlag, "o", "",
+		"File to write the backup to.")
+	backupCmd.Flags().String(backupSinceFlag, "",
+		"Only include files modified after this RFC 3339 time, such as the "+
+			"time printed by the previous backup, for an incremental backup.")
+	backupCmd.Flags().String(backupPassphraseFileFlag, "",
+		"File containing the passphrase to encrypt the backup with. The "+
+			"backup is not encrypted if it is not set.")
+	if err := backupCmd.MarkFlagRequired(backupOutputFlag); err != nil {
+		panic(err)
+	}
+
+	backupDecryptCmd.Flags().String(backupPassphraseFileFlag, "",
+		"File containing the passphrase the backup was encrypted with.")
+	if err := backupDecryptCmd.MarkFlagRequired(
+		backupPassphraseFileFlag); err != nil {
+		panic(err)
+	}
+
+	// Errors are caused by the server or the files, so printing the usage does
+	// not help
+	backupCmd.SilenceUsage = true
+	backupDecryptCmd.SilenceUsage = true
+	backupCmd.AddCommand(backupDecryptCmd)
+	rootCmd.AddCommand(backupCmd)
+}
+
+var backupCmd = &cobra.Command{
+	Use:   "backup",
+	Short: "Writes a backup of a running server",
+	Long: "Writes a tar archive of the credential store and the files of all " +
+		"users of a running server, using its admin API, to the output " +
+		"file. The writes of each user are paused while their files are " +
+		"archived, so that each user's files are consistent. With --since, " +
+		"only the files modified after the time are included, along with a " +
+		"manifest of all files. With --passphraseFile, the backup is " +
+		"encrypted; decrypt it with \"backup decrypt\". " +
+		"The server's certificate and admin key are read from the config file.",
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		initConfig(configFilePath)
+		req := &rpc.RsBackupRequest{}
+		if since, _ := cmd.Flags().GetString(backupSinceFlag); since != "" {
+			t, err := time.Parse(time.RFC3339Nano, since)
+			if err != nil {
+				return errors.Wrapf(err, "invalid --%s", backupSinceFlag)
+			}
+			req.Since = t.UnixNano()
+		}
+		var passphrase []byte
+		if path, _ := cmd.Flags().GetString(
+			backupPassphraseFileFlag); path != "" {
+			var err error
+			if passphrase, err = readPassphrase(path); err != nil {
+				return err
+			}
+		}
+		output, _ := cmd.Flags().GetString(backupOutputFlag)
+
+		client, ctx, cancel, err := dialAdmin(cmd)
+		if err != nil {
+			return err
+		}
+		defer cancel()
+
+		// The backup can take longer than adminRequestTimeout, so only the
+		// metadata of the context is used
+		md, _ := metadata.FromOutgoingContext(ctx)
+		ctx = metadata.NewOutgoingContext(context.Background(), md)
+		m, err := saveBackup(ctx, client, req, output, passphrase)
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("Wrote backup of %d files (%d bytes) of %d users to %s\n",
+			m.Files, m.Bytes, len(m.Users), output)
+		fmt.Printf("For the next incremental backup, use --%s %s\n",
+			backupSinceFlag, m.Time.UTC().Format(time.RFC3339Nano))
+		return nil
+	},
+}
+
+var backupDecryptCmd = &cobra.Command{
+	Use:   "decrypt <input> <output>",
+	Short: "Decrypts an encrypted backup",
+	Long: "Decrypts a backup that was encrypted with --passphraseFile and " +
+		"writes its tar archive to the output file. Fails if the passphrase " +
+		"is wrong or the backup was modified or truncated.",
+	Args: cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		path, _ := cmd.Flags().GetString(backupPassphraseFileFlag)
+		passphrase, err := readPassphrase(path)
+		if err != nil {
+			return err
+		}
+
+		in, err := os.Open(args[0])
+		if err != nil {
+			return errors.Wrapf(err, "failed to open %s", args[0])
+		}
+		defer func() { _ = in.Close() }()
+		r, err := server.DecryptBackup(in, passphrase)
+		if err != nil {
+			return err
+		}
+
+		err = writeFileAtomically(args[1], func(w io.Writer) error {
+			_, err := io.Copy(w, r)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Decrypted backup to %s\n", args[1])
+		return nil
+	},
+}
+
+// saveBackup receives the backup from the server and writes it to the output
+// file, encrypted if the passphrase is not empty. Returns its manifest.
+func saveBackup(ctx context.Context, client rpc.AdminClient,
+	req *rpc.RsBackupRequest, output string,
+	passphrase []byte) (*server.BackupManifest, error) {
+	stream, err := client.Backup(ctx, req)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to start backup")
+	}
+
+	type manifestResult struct {
+		m   *server.BackupManifest
+		err error
+	}
+	var m *server.BackupManifest
+	err = writeFileAtomically(output, func(w io.Writer) error {
+		var encrypter io.WriteCloser
+		if len(passphrase) > 0 {
+			var err error
+			encrypter, err = server.EncryptBackup(w, passphrase)
+			if err != nil {
+				return err
+			}
+			w = encrypter
+		}
+
+		// Read the manifest from a copy of the archive as it is received
+		pr, pw := io.Pipe()
+		results := make(chan manifestResult, 1)
+		go func() {
+			m, err := server.ReadBackupManifest(pr)
+			_ = pr.CloseWithError(err)
+			results <- manifestResult{m, err}
+		}()
+		err := receiveBackup(stream, io.MultiWriter(w, pw))
+		_ = pw.CloseWithError(err)
+		result := <-results
+		if err != nil {
+			return err
+		} else if result.err != nil {
+			return result.err
+		}
+		m = result.m
+
+		if encrypter != nil {
+			if err = encrypter.Close(); err != nil {
+				return errors.Wrap(err, "failed to write backup")
+			}
+		}
+		return nil
+	})
+	return m, err
+}
+
+// receiveBackup writes the chunks of the backup stream to w until it ends.
+func receiveBackup(stream rpc.Admin_BackupClient, w io.Writer) error {
+	for {
+		chunk, err := stream.Recv()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return errors.Wrap(err, "failed to receive backup")
+		}
+		if _, err = w.Write(chunk.GetData()); err != nil {
+			return errors.Wrap(err, "failed to write backup")
+		}
+	}
+}
+
+// writeFileAtomically writes the file with write to a temporary file, which
+// replaces the file at the path once write succeeds, so that a failed write
+// does not leave a partial file.
+func writeFileAtomically(path string, write func(w io.Writer) error) error {
+	path, err := utils.ExpandPath(path)
+	if err != nil {
+		return errors.Wrapf(err, "unable to expand path %s", path)
+	}
+	tmpPath := path + ".tmp"
+	f, err := os.OpenFile(
+		tmpPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, backupFilePerm)
+	if err != nil {
+		return errors.Wrapf(err, "failed to create %s", tmpPath)
+	}
+	if err = write(f); err != nil {
+		_ = f.Close()
+		_ = os.Remove(tmpPath)
+		return err
+	}
+	if err = f.Close(); err != nil {
+		_ = os.Remove(tmpPath)
+		return errors.Wrapf(err, "failed to write %s", tmpPath)
+	}
+	if err = os.Rename(tmpPath, path); err != nil {
+		return errors.Wrapf(err, "failed to replace %s", path)
+	}
+	return nil
+}
+
+// readPassphrase returns the passphrase in the file, without a trailing
+// newline.
+func readPassphrase(path string) ([]byte, error) {
+	data, err := utils.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read passphrase file %s", path)
+	}
+	passphrase := bytes.TrimRight(data, "\r\n")
+	if len(passphrase) == 0 {
+		return nil, errors.Errorf("passphrase file %s is empty", path)
+	}
+	return passphrase, nil
+}
@@ -0,0 +1,571 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+// Handles the check-config subcommand, which validates the config file without
+// starting the server
+
+package cmd
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"gitlab.com/elixxir/remoteSyncServer/logging"
+	"gitlab.com/elixxir/remoteSyncServer/server"
+	"gitlab.com/elixxir/remoteSyncServer/storage"
+	"gitlab.com/elixxir/remoteSyncServer/store"
+	"gitlab.com/xx_network/primitives/utils"
+)
+
+func init() {
+	rootCmd.AddCommand(checkConfigCmd)
+}
+
+var checkConfigCmd = &cobra.Command{
+	Use:   "check-config",
+	Short: "Validates the config file without starting the server",
+	Long: "Loads the config file and validates every option as the server " +
+		"would on startup: files are read and parsed, the ports are bound " +
+		"and released, and the storage backend, credential store, Redis, " +
+		"and OIDC provider are connected to. Database backends apply any " +
+		"outstanding schema migrations, as on startup. Prints every problem " +
+		"found and exits with status 1 if there are any. Warnings, such as " +
+		"for a port that is in use by the running server, do not fail the " +
+		"check.",
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		c := checkConfig(configFilePath)
+		for _, warning := range c.warnings {
+			fmt.Printf("WARNING: %s\n", warning)
+		}
+		name := configFilePath
+		if name == "" {
+			name = "from the environment"
+		}
+		if len(c.problems) == 0 {
+			fmt.Printf("Config %s is valid.\n", name)
+			return
+		}
+
+		_, _ = fmt.Fprintf(os.Stderr, "Config %s is invalid:\n", name)
+		for _, problem := range c.problems {
+			_, _ = fmt.Fprintf(os.Stderr, "  - %s\n", problem)
+		}
+		os.Exit(1)
+	},
+}
+
+// configChecker collects the problems found in the config and warnings about
+// options that are valid but may not work as intended.
+type configChecker struct {
+	problems []string
+	warnings []string
+}
+
+// check records the error, if any, as a problem with the config key on a
+// single line. Returns true if there is no error.
+func (c *configChecker) check(key string, err error) bool {
+	if err == nil {
+		return true
+	}
+	c.problems = append(c.problems,
+		key+": "+strings.Join(strings.Fields(err.Error()), " "))
+	return false
+}
+
+// warn records a warning about the config key.
+func (c *configChecker) warn(key, format string, a ...interface{}) {
+	c.warnings = append(c.warnings, key+": "+fmt.Sprintf(format, a...))
+}
+
+// checkConfig reads the config file, if any, and the environment and validates
+// each option in the order the server uses them on startup.
+func checkConfig(filePath string) *configChecker {
+	c := &configChecker{}
+	if !c.check("config", readConfig(filePath)) {
+		return c
+	}
+	if unknown, _ := unknownConfigKeys(); len(unknown) > 0 {
+		c.warn("config", "ignoring unknown keys: %s",
+			strings.Join(unknown, ", "))
+	}
+
+	if logPath := viper.GetString(logPathFlag); logPath != "-" &&
+		logPath != "" {
+		c.checkDir(logPathFlag, filepath.Dir(logPath), false)
+	}
+	_, err := logging.ParseFormat(viper.GetString(logFormatFlag))
+	c.check(logFormatFlag, err)
+	if pidFile := viper.GetString(pidFileFlag); pidFile != "" {
+		c.checkDir(pidFileFlag, filepath.Dir(pidFile), false)
+	}
+	_, err = lookupAccount(
+		viper.GetString(userFlag), viper.GetString(groupFlag))
+	c.check(userFlag, err)
+	c.check(daemonFlag, checkDaemon(
+		viper.GetBool(daemonFlag), viper.GetString(logPathFlag)))
+	listeners, err := configListeners(nil)
+	if viper.IsSet(listenersTag) {
+		if c.check(listenersTag, err) {
+			for _, l := range listeners {
+				c.checkAddress(listenersTag, l.Address)
+			}
+		}
+	} else {
+		hosts, hostsErr := bindHosts()
+		c.check(bindAddressTag, hostsErr)
+		c.checkPort(portTag, hosts, viper.GetInt(portTag))
+	}
+	if tokenTTL := viper.GetDuration(tokenTtlTag); tokenTTL < time.Second {
+		c.check(tokenTtlTag, errors.Errorf(
+			"token TTL %s must be at least one second", tokenTTL))
+	}
+
+	// Certificates and TLS
+	insecureHTTP := viper.GetBool(insecureHTTPTag)
+	var acme *server.ACMEManager
+	if viper.IsSet(acmeParamsTag) {
+		acme, err = server.NewACMEManager(viper.GetStringMap(acmeParamsTag))
+		c.check(acmeParamsTag, err)
+	} else if !insecureHTTP {
+		c.check(signedCertPathTag,
+			checkKeyPair(viper.GetString(signedCertPathTag)))
+	}
+
+	var additionalCerts []tls.Certificate
+	if viper.IsSet(additionalCertificatesTag) {
+		additionalCerts, err = server.LoadCertificates(
+			viper.Get(additionalCertificatesTag))
+		if c.check(additionalCertificatesTag, err) {
+			for _, cert := range additionalCerts {
+				c.check(additionalCertificatesTag, checkValidity(cert.Leaf))
+			}
+		}
+	}
+
+	var tlsSettings *server.TLSSettings
+	if viper.IsSet(tlsMinVersionTag) || viper.IsSet(tlsCipherSuitesTag) {
+		tlsSettings, err = server.NewTLSSettings(
+			viper.GetString(tlsMinVersionTag),
+			viper.GetStringSlice(tlsCipherSuitesTag))
+		c.check(tlsMinVersionTag, err)
+	}
+
+	var ocspStapler *server.OCSPStapler
+	if viper.IsSet(ocspParamsTag) {
+		ocspStapler, err = server.NewOCSPStapler(
+			viper.GetStringMap(ocspParamsTag))
+		c.check(ocspParamsTag, err)
+	}
+
+	if !insecureHTTP {
+		_, err = server.NewCertExpiryMonitor(
+			viper.GetStringMap(certExpiryParamsTag))
+		c.check(certExpiryParamsTag, err)
+	}
+
+	if viper.IsSet(httpsParamsTag) && !viper.IsSet(listenersTag) {
+		hosts, _ := bindHosts()
+		webPort := viper.GetInt(httpsParamsTag + "." + portTag)
+		if webPort == viper.GetInt(portTag) {
+			c.check(httpsParamsTag, errors.Errorf("HTTPS port must differ "+
+				"from the gRPC port %d", webPort))
+		} else {
+			c.checkPort(httpsParamsTag+"."+portTag, hosts, webPort)
+		}
+
+		minVersionTag := httpsParamsTag + "." + tlsMinVersionTag
+		cipherSuitesTag := httpsParamsTag + "." + tlsCipherSuitesTag
+		if viper.IsSet(minVersionTag) || viper.IsSet(cipherSuitesTag) {
+			_, err = server.NewTLSSettings(
+				viper.GetString(minVersionTag),
+				viper.GetStringSlice(cipherSuitesTag))
+			c.check(minVersionTag, err)
+		}
+	}
+
+	if viper.IsSet(trustedProxiesTag) {
+		_, err = server.NewTrustedProxies(
+			viper.GetStringSlice(trustedProxiesTag))
+		c.check(trustedProxiesTag, err)
+	}
+
+	if viper.IsSet(metricsParamsTag) {
+		_, err = server.NewMetrics(viper.GetStringMap(metricsParamsTag))
+		if c.check(metricsParamsTag, err) {
+			c.checkAddress(metricsParamsTag,
+				viper.GetString(metricsParamsTag+".address"))
+		}
+	}
+
+	if viper.IsSet(tracingParamsTag) {
+		_, err = server.NewTracing(viper.GetStringMap(tracingParamsTag), SEMVER)
+		c.check(tracingParamsTag, err)
+	}
+
+	if viper.IsSet(accessLogParamsTag) {
+		_, err = server.NewAccessLog(viper.GetStringMap(accessLogParamsTag))
+		c.check(accessLogParamsTag, err)
+	}
+
+	if viper.IsSet(errorReportParamsTag) {
+		_, err = newErrorReporter()
+		c.check(errorReportParamsTag, err)
+	}
+
+	// Opening the audit log checks that it can be written and, with hash
+	// chaining, that it ends with a hashed entry
+	if viper.IsSet(auditParamsTag) {
+		audit, err := server.NewAuditLog(viper.GetStringMap(auditParamsTag))
+		if c.check(auditParamsTag, err) {
+			_ = audit.Close()
+		}
+	}
+
+	if viper.IsSet(healthParamsTag) {
+		_, err = server.NewHealth(viper.GetStringMap(healthParamsTag))
+		address := viper.GetString(healthParamsTag + ".address")
+		if c.check(healthParamsTag, err) {
+			if viper.IsSet(metricsParamsTag) &&
+				address == viper.GetString(metricsParamsTag+".address") {
+				c.check(healthParamsTag, errors.Errorf("address %s must "+
+					"differ from the metrics address", address))
+			} else {
+				c.checkAddress(healthParamsTag, address)
+			}
+		}
+	}
+
+	if viper.IsSet(startupParamsTag) {
+		_, err = server.NewStartup(viper.GetStringMap(startupParamsTag))
+		c.check(startupParamsTag, err)
+	}
+
+	// Users and authentication
+	hasher, err := newPasswordHasher()
+	if c.check(passwordHashingTag, err) {
+		_, _, err = newRegistrar(hasher)
+		c.check(credentialsBackendTag+", "+registrationModeTag, err)
+	}
+	if viper.GetString(credentialsBackendTag) == csvCredentialsBackend {
+		c.checkFileExists(credentialsPathTag,
+			viper.GetString(credentialsPathTag), "no users are registered")
+	}
+
+	if viper.IsSet(oidcParamsTag) {
+		_, err = server.NewOIDCAuthenticator(
+			context.Background(), viper.GetStringMap(oidcParamsTag))
+		c.check(oidcParamsTag, err)
+	}
+
+	var mtls *server.MTLSAuthenticator
+	if viper.IsSet(mtlsParamsTag) {
+		mtls, err = server.NewMTLSAuthenticator(
+			viper.GetStringMap(mtlsParamsTag))
+		c.check(mtlsParamsTag, err)
+	}
+
+	if viper.IsSet(rateLimitParamsTag) {
+		_, err = server.NewRateLimiter(viper.GetStringMap(rateLimitParamsTag))
+		c.check(rateLimitParamsTag, err)
+	}
+	if viper.IsSet(concurrencyParamsTag) {
+		_, err = server.NewConcurrencyLimiter(
+			viper.GetStringMap(concurrencyParamsTag))
+		c.check(concurrencyParamsTag, err)
+	}
+	if viper.IsSet(ipFilterParamsTag) {
+		_, err = server.NewIPFilter(viper.GetStringMap(ipFilterParamsTag))
+		c.check(ipFilterParamsTag, err)
+	}
+	if viper.IsSet(autoBanParamsTag) {
+		_, err = server.NewAutoBan(viper.GetStringMap(autoBanParamsTag))
+		c.check(autoBanParamsTag, err)
+	}
+	if viper.IsSet(loginThrottleParamsTag) {
+		_, err = server.NewLoginThrottle(
+			viper.GetStringMap(loginThrottleParamsTag))
+		c.check(loginThrottleParamsTag, err)
+	}
+	if viper.IsSet(maxObjectBytesTag) {
+		_, err = server.NewLimits(viper.GetInt64(maxObjectBytesTag), 0)
+		c.check(maxObjectBytesTag, err)
+	}
+	if viper.IsSet(maxRequestBytesTag) {
+		_, err = server.NewLimits(0, viper.GetInt64(maxRequestBytesTag))
+		c.check(maxRequestBytesTag, err)
+	}
+	if viper.IsSet(grpcParamsTag) {
+		_, err = server.NewGRPCSettings(viper.GetStringMap(grpcParamsTag))
+		c.check(grpcParamsTag, err)
+	}
+	if viper.IsSet(httpLimitsParamsTag) {
+		_, err = server.NewHTTPLimits(viper.GetStringMap(httpLimitsParamsTag))
+		c.check(httpLimitsParamsTag, err)
+	}
+	if viper.IsSet(webSecurityParamsTag) {
+		_, err = server.NewWebSecurity(
+			viper.GetStringMap(webSecurityParamsTag))
+		c.check(webSecurityParamsTag, err)
+	}
+
+	_, err = server.NewRevocationList(viper.GetString(revocationListPathTag))
+	c.check(revocationListPathTag, err)
+	_, err = server.NewUserPolicies(viper.GetString(userPoliciesPathTag))
+	c.check(userPoliciesPathTag, err)
+	if viper.IsSet(adminListenerParamsTag) {
+		adminListener, err := server.NewAdminListener(
+			viper.GetStringMap(adminListenerParamsTag))
+		if c.check(adminListenerParamsTag, err) {
+			if address := adminListener.Params().Address; address != "" {
+				c.checkAddress(adminListenerParamsTag, address)
+			}
+			if listeners != nil {
+				c.check(adminListenerParamsTag,
+					server.CheckAdminListener(adminListener, listeners))
+			}
+		}
+	}
+
+	if viper.GetBool(apiKeysEnabledTag) {
+		_, err = newAPIKeys()
+		c.check(apiKeysCsvPathTag, err)
+	}
+	_, err = newKnownUsers()
+	c.check(knownUsersCsvPathTag, err)
+
+	// The options are only checked together if each is valid, since invalid
+	// options are nil
+	if len(c.problems) == 0 {
+		c.check("tls", server.CheckOptions(mtls, acme, tlsSettings,
+			ocspStapler, insecureHTTP, additionalCerts, listeners))
+	}
+
+	// Storage
+	storageBackend := viper.GetString(storageBackendTag)
+	backend, err := storage.GetBackend(storageBackend)
+	if err != nil {
+		c.check(storageBackendTag, errors.Errorf("%v (available: %s)", err,
+			strings.Join(storage.Backends(), ", ")))
+	} else {
+		newStore, err := backend(viper.GetStringMap(storageBackend))
+		c.check(storageBackend, err)
+
+		if viper.IsSet(storagePoolTag) && err == nil {
+			_, err = store.NewPooledStore(
+				viper.GetStringMap(storagePoolTag), newStore)
+			c.check(storagePoolTag, err)
+		}
+
+		if redisAddr := viper.GetString(redisAddrTag); redisAddr != "" &&
+			err == nil {
+			_, err = store.NewRedisCache(
+				redisAddr, viper.GetStringMap(redisParamsTag), newStore)
+			c.check(redisAddrTag, err)
+		}
+		if viper.IsSet(memoryCacheTag) && err == nil {
+			_, err = store.NewMemoryCache(
+				viper.GetStringMap(memoryCacheTag), newStore)
+			c.check(memoryCacheTag, err)
+		}
+		if viper.IsSet(versioningTag) && err == nil {
+			_, err = store.NewVersionedStore(
+				viper.GetStringMap(versioningTag), newStore)
+			c.check(versioningTag, err)
+		}
+		if viper.IsSet(indexTag) && err == nil {
+			_, err = store.NewIndex(viper.GetStringMap(indexTag), newStore)
+			c.check(indexTag, err)
+		}
+	}
+	if viper.IsSet(encryptionTag) {
+		_, err = store.NewEncryptedStore(
+			viper.GetStringMap(encryptionTag), nil)
+		c.check(encryptionTag, err)
+	}
+	if viper.IsSet(compressionTag) {
+		_, err = store.NewCompressedStore(
+			viper.GetStringMap(compressionTag), nil)
+		c.check(compressionTag, err)
+	}
+	if viper.IsSet(dedupTag) {
+		_, err = store.NewDedupStore(viper.GetStringMap(dedupTag), nil)
+		c.check(dedupTag, err)
+	}
+	if viper.IsSet(gcParamsTag) {
+		_, err = server.NewGarbageCollector(viper.GetStringMap(gcParamsTag))
+		c.check(gcParamsTag, err)
+	}
+	if viper.IsSet(uploadsParamsTag) {
+		_, err = server.NewUploads(viper.GetStringMap(uploadsParamsTag))
+		c.check(uploadsParamsTag, err)
+	}
+	if viper.IsSet(deltaParamsTag) {
+		_, err = server.NewDelta(viper.GetStringMap(deltaParamsTag))
+		c.check(deltaParamsTag, err)
+	}
+	if viper.IsSet(changesParamsTag) {
+		_, err = server.NewChangeFeed(viper.GetStringMap(changesParamsTag))
+		c.check(changesParamsTag, err)
+	}
+	var webdav *server.WebDAV
+	if viper.IsSet(webdavParamsTag) {
+		webdav, err = server.NewWebDAV(viper.GetStringMap(webdavParamsTag))
+		c.check(webdavParamsTag, err)
+	}
+	if listeners != nil && (webdav != nil || !viper.IsSet(webdavParamsTag)) {
+		c.check(webdavParamsTag, server.CheckWebDAV(webdav, listeners))
+	}
+	if viper.IsSet(linksParamsTag) {
+		links, err := server.NewLinks(viper.GetStringMap(linksParamsTag))
+		if c.check(linksParamsTag, err) && listeners != nil {
+			c.check(linksParamsTag, server.CheckLinks(links, listeners))
+		}
+	}
+	if viper.IsSet(journalParamsTag) {
+		_, err = server.NewJournal(viper.GetStringMap(journalParamsTag))
+		c.check(journalParamsTag, err)
+		if err == nil && viper.GetBool(listenerHandoffTag) {
+			c.check(journalParamsTag, errors.New(
+				"the journal and listener handoff cannot be combined"))
+		}
+	}
+	if viper.IsSet(scrubParamsTag) {
+		_, err = server.NewScrubber(viper.GetStringMap(scrubParamsTag))
+		c.check(scrubParamsTag, err)
+	}
+	if viper.IsSet(clusterParamsTag) {
+		_, err = server.NewCluster(viper.GetStringMap(clusterParamsTag))
+		c.check(clusterParamsTag, err)
+	}
+	if viper.IsSet(replicationParamsTag) {
+		_, err = server.NewReplication(
+			viper.GetStringMap(replicationParamsTag))
+		c.check(replicationParamsTag, err)
+		if err == nil && viper.IsSet(clusterParamsTag) {
+			c.check(replicationParamsTag, errors.New(
+				"clustering and replication cannot be combined"))
+		}
+	}
+	if viper.IsSet(migrationParamsTag) {
+		_, err = server.NewMigration(viper.GetStringMap(migrationParamsTag))
+		c.check(migrationParamsTag, err)
+	}
+	if storageBackend == store.FileBackend {
+		c.checkDir(storageDirTag, viper.GetString(storageDirTag), true)
+	}
+
+	return c
+}
+
+// checkPort records a problem if the port is invalid or cannot be listened on
+// on each of the hosts. A port that is in use is only a warning, since the
+// server may be running.
+func (c *configChecker) checkPort(key string, hosts []string, port int) {
+	if port < 1 || port > 65535 {
+		c.check(key, errors.Errorf("port %d must be between 1 and 65535", port))
+		return
+	}
+
+	for _, address := range joinHostsPort(hosts, port) {
+		c.checkAddress(key, address)
+	}
+}
+
+// checkAddress records a problem if the address cannot be listened on. An
+// address that is in use is only a warning, since the server may be running.
+func (c *configChecker) checkAddress(key, address string) {
+	l, err := net.Listen("tcp", address)
+	if errors.Is(err, syscall.EADDRINUSE) {
+		c.warn(key, "%s is in use, which is expected if the server is "+
+			"running", address)
+		return
+	} else if !c.check(key, err) {
+		return
+	}
+	_ = l.Close()
+}
+
+// checkDir records a problem if the path is not a directory. If it does not
+// exist, it is only a warning if the server creates it on startup.
+func (c *configChecker) checkDir(key, path string, created bool) {
+	path, err := utils.ExpandPath(path)
+	if !c.check(key, err) {
+		return
+	}
+
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) && created {
+		c.warn(key, "directory %s does not exist and will be created", path)
+	} else if c.check(key, err) && !info.IsDir() {
+		c.check(key, errors.Errorf("%s is not a directory", path))
+	}
+}
+
+// checkFileExists records a warning with the consequence if the file does not
+// exist. Empty paths are not checked.
+func (c *configChecker) checkFileExists(key, path, consequence string) {
+	if path == "" {
+		return
+	}
+	path, err := utils.ExpandPath(path)
+	if !c.check(key, err) {
+		return
+	}
+	if _, err = os.Stat(path); os.IsNotExist(err) {
+		c.warn(key, "%s does not exist; %s", path, consequence)
+	}
+}
+
+// checkKeyPair returns an error if the certificate at the path and the
+// configured key cannot be read or do not match, or if the certificate is not
+// currently valid.
+func checkKeyPair(certPath string) error {
+	certPem, err := utils.ReadFile(certPath)
+	if err != nil {
+		return errors.Wrapf(err, "failed to read certificate from %s", certPath)
+	}
+	keyPem, err := readSignedKey()
+	if err != nil {
+		return err
+	}
+	keyPair, err := tls.X509KeyPair(certPem, keyPem)
+	if err != nil {
+		return errors.Wrap(err, "invalid certificate or key")
+	}
+	leaf, err := x509.ParseCertificate(keyPair.Certificate[0])
+	if err != nil {
+		return errors.Wrap(err, "invalid certificate")
+	}
+	return checkValidity(leaf)
+}
+
+// checkValidity returns an error if the certificate has expired or is not yet
+// valid.
+func checkValidity(leaf *x509.Certificate) error {
+	now := time.Now()
+	if now.After(leaf.NotAfter) {
+		return errors.Errorf("certificate for %s expired at %s",
+			leaf.Subject, leaf.NotAfter)
+	} else if now.Before(leaf.NotBefore) {
+		return errors.Errorf("certificate for %s is not valid until %s",
+			leaf.Subject, leaf.NotBefore)
+	}
+	return nil
+}
@@ -0,0 +1,185 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+// Validates the keys of the config so that misspelled options are reported
+// instead of silently using their defaults
+
+package cmd
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mitchellh/mapstructure"
+	"github.com/pkg/errors"
+	jww "github.com/spf13/jwalterweatherman"
+	"github.com/spf13/viper"
+)
+
+// allowUnknownKeysFlag is the flag that turns unknown config keys into
+// warnings instead of errors.
+const allowUnknownKeysFlag = "allow-unknown"
+
+// allowUnknownKeys is set by allowUnknownKeysFlag.
+var allowUnknownKeys bool
+
+// config contains every option of the config file. The options are read with
+// viper; the config is only decoded into it to find unknown keys and values of
+// the wrong type. Sections decoded by the features they configure, which reject
+// unknown keys themselves when enabled, are kept as maps.
+type config struct {
+	LogPath   string `mapstructure:"logPath"`
+	LogLevel  uint   `mapstructure:"logLevel"`
+	LogFormat string `mapstructure:"logFormat"`
+	PIDFile   string `mapstructure:"pidFile"`
+	User      string `mapstructure:"user"`
+	Group     string `mapstructure:"group"`
+	Daemon    bool   `mapstructure:"daemon"`
+
+	SignedCertPath string      `mapstructure:"signedCertPath"`
+	SignedKeyPath  string      `mapstructure:"signedKeyPath"`
+	SignedKey      string      `mapstructure:"signedKey"`
+	Port           int         `mapstructure:"port"`
+	BindAddress    []string    `mapstructure:"bindAddress"`
+	Listeners      interface{} `mapstructure:"listeners"`
+
+	AdditionalCertificates interface{}            `mapstructure:"additionalCertificates"`
+	TLSMinVersion          string                 `mapstructure:"tlsMinVersion"`
+	TLSCipherSuites        []string               `mapstructure:"tlsCipherSuites"`
+	HTTPS                  httpsConfig            `mapstructure:"https"`
+	OCSP                   map[string]interface{} `mapstructure:"ocsp"`
+	CertExpiry             map[string]interface{} `mapstructure:"certExpiry"`
+	InsecureHTTP           bool                   `mapstructure:"insecureHttp"`
+	TrustedProxies         []string               `mapstructure:"trustedProxies"`
+	ListenerHandoff        bool                   `mapstructure:"listenerHandoff"`
+	GRPCReflection         bool                   `mapstructure:"grpcReflection"`
+	ACME                   map[string]interface{} `mapstructure:"acme"`
+
+	TokenTTL                   time.Duration          `mapstructure:"tokenTTL"`
+	CredentialsBackend         string                 `mapstructure:"credentialsBackend"`
+	CredentialsCsvPath         string                 `mapstructure:"credentialsCsvPath"`
+	PasswordHashing            string                 `mapstructure:"passwordHashing"`
+	Argon2id                   map[string]interface{} `mapstructure:"argon2id"`
+	RegistrationMode           string                 `mapstructure:"registrationMode"`
+	RegistrationsOpen          bool                   `mapstructure:"registrationsOpen"`
+	RegistrationPendingCsvPath string                 `mapstructure:"registrationPendingCsvPath"`
+	RegistrationInvitesCsvPath string                 `mapstructure:"registrationInvitesCsvPath"`
+	OIDC                       map[string]interface{} `mapstructure:"oidc"`
+	MTLS                       map[string]interface{} `mapstructure:"mtls"`
+	RateLimit                  map[string]interface{} `mapstructure:"rateLimit"`
+	Concurrency                map[string]interface{} `mapstructure:"concurrency"`
+	IPFilter                   map[string]interface{} `mapstructure:"ipFilter"`
+	AutoBan                    map[string]interface{} `mapstructure:"autoBan"`
+	LoginThrottle              map[string]interface{} `mapstructure:"loginThrottle"`
+	MaxObjectBytes             int64                  `mapstructure:"maxObjectBytes"`
+	MaxRequestBytes            int64                  `mapstructure:"maxRequestBytes"`
+	GRPC                       map[string]interface{} `mapstructure:"grpc"`
+	HTTPLimits                 map[string]interface{} `mapstructure:"httpLimits"`
+	WebSecurity                map[string]interface{} `mapstructure:"webSecurity"`
+	Secrets                    map[string]interface{} `mapstructure:"secrets"`
+	ConfigKey                  string                 `mapstructure:"configKey"`
+	ConfigKeyPath              string                 `mapstructure:"configKeyPath"`
+	Maintenance                bool                   `mapstructure:"maintenance"`
+	Metrics                    map[string]interface{} `mapstructure:"metrics"`
+	Health                     map[string]interface{} `mapstructure:"health"`
+	Startup                    map[string]interface{} `mapstructure:"startup"`
+	Tracing                    map[string]interface{} `mapstructure:"tracing"`
+	Audit                      map[string]interface{} `mapstructure:"audit"`
+	AccessLog                  map[string]interface{} `mapstructure:"accessLog"`
+	ErrorReporting             map[string]interface{} `mapstructure:"errorReporting"`
+	RevocationListPath         string                 `mapstructure:"revocationListPath"`
+	AdminKey                   string                 `mapstructure:"adminKey"`
+	AdminListener              map[string]interface{} `mapstructure:"adminListener"`
+	UserPoliciesPath           string                 `mapstructure:"userPoliciesPath"`
+	APIKeysEnabled             bool                   `mapstructure:"apiKeysEnabled"`
+	APIKeysCsvPath             string                 `mapstructure:"apiKeysCsvPath"`
+	KnownUsersCsvPath          string                 `mapstructure:"knownUsersCsvPath"`
+
+	StorageDir     string                 `mapstructure:"storageDir"`
+	StorageBackend string                 `mapstructure:"storageBackend"`
+	StoragePool    map[string]interface{} `mapstructure:"storagePool"`
+	RedisAddr      string                 `mapstructure:"redisAddr"`
+	Redis          map[string]interface{} `mapstructure:"redis"`
+	MemoryCache    map[string]interface{} `mapstructure:"memoryCache"`
+	Versioning     map[string]interface{} `mapstructure:"versioning"`
+	Index          map[string]interface{} `mapstructure:"index"`
+	Encryption     map[string]interface{} `mapstructure:"encryption"`
+	Compression    map[string]interface{} `mapstructure:"compression"`
+	Dedup          map[string]interface{} `mapstructure:"dedup"`
+	TrackMetadata  bool                   `mapstructure:"trackMetadata"`
+	GC             map[string]interface{} `mapstructure:"gc"`
+	Uploads        map[string]interface{} `mapstructure:"uploads"`
+	Delta          map[string]interface{} `mapstructure:"delta"`
+	Changes        map[string]interface{} `mapstructure:"changes"`
+	WebDAV         map[string]interface{} `mapstructure:"webdav"`
+	Links          map[string]interface{} `mapstructure:"links"`
+	Journal        map[string]interface{} `mapstructure:"journal"`
+	Scrub          map[string]interface{} `mapstructure:"scrub"`
+	Cluster        map[string]interface{} `mapstructure:"cluster"`
+	Replication    map[string]interface{} `mapstructure:"replication"`
+	Migration      map[string]interface{} `mapstructure:"migration"`
+	File           map[string]interface{} `mapstructure:"file"`
+	Memory         map[string]interface{} `mapstructure:"memory"`
+	S3             map[string]interface{} `mapstructure:"s3"`
+	SFTP           map[string]interface{} `mapstructure:"sftp"`
+	Postgres       map[string]interface{} `mapstructure:"postgres"`
+	SQLite         map[string]interface{} `mapstructure:"sqlite"`
+	Sharded        map[string]interface{} `mapstructure:"sharded"`
+}
+
+// httpsConfig contains the options of the https section.
+type httpsConfig struct {
+	Port            int      `mapstructure:"port"`
+	TLSMinVersion   string   `mapstructure:"tlsMinVersion"`
+	TLSCipherSuites []string `mapstructure:"tlsCipherSuites"`
+}
+
+// checkConfigKeys decodes the config read by viper into a config. Returns an
+// error if a value has the wrong type or, unless allowUnknownKeys is set, if
+// there are unknown keys.
+func checkConfigKeys() error {
+	unknown, err := unknownConfigKeys()
+	if err != nil {
+		return err
+	} else if len(unknown) > 0 && !allowUnknownKeys {
+		return errors.Errorf("unknown config keys: %s (use --%s to ignore "+
+			"them)", strings.Join(unknown, ", "), allowUnknownKeysFlag)
+	}
+	return nil
+}
+
+// warnUnknownConfigKeys logs a warning if the config read by viper has unknown
+// keys, which are only accepted if allowUnknownKeys is set.
+func warnUnknownConfigKeys() {
+	if unknown, _ := unknownConfigKeys(); len(unknown) > 0 {
+		jww.WARN.Printf("Ignoring unknown config keys: %s",
+			strings.Join(unknown, ", "))
+	}
+}
+
+// unknownConfigKeys returns the sorted keys in the config read by viper that
+// are not options, with sections separated by dots. Keys are lower case, since
+// viper is not case-sensitive. Returns an error if a value has the wrong type.
+func unknownConfigKeys() ([]string, error) {
+	var md mapstructure.Metadata
+	decoder, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{
+		DecodeHook:       mapstructure.StringToTimeDurationHookFunc(),
+		Metadata:         &md,
+		WeaklyTypedInput: true,
+		Result:           &config{},
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create config decoder")
+	}
+	if err = decoder.Decode(viper.AllSettings()); err != nil {
+		return nil, errors.Wrap(err, "invalid config")
+	}
+
+	sort.Strings(md.Unused)
+	return md.Unused, nil
+}
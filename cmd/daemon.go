@@ -0,0 +1,134 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+//go:build !windows
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"syscall"
+
+	"github.com/pkg/errors"
+)
+
+// daemonEnv is the environment variable that marks the processes in the
+// background: daemonStarting for the process started by --daemon, which tells
+// the process that started it once it is serving, and daemonRunning for later
+// processes, such as those started by an upgrade, which are already in the
+// background. It does not have the prefix of the config environment variables
+// so that it is not read as an option.
+const daemonEnv = "SYNC_SERVER_DAEMON"
+
+// Values of daemonEnv.
+const (
+	daemonStarting = "starting"
+	daemonRunning  = "running"
+)
+
+// daemonReadyFD is the descriptor of the pipe to the process that started the
+// background process, which the background process writes daemonReady to once
+// it is serving.
+const daemonReadyFD = 3
+
+// daemonReady is written to the pipe by the background process once it is
+// serving.
+const daemonReady = 'R'
+
+// daemon is the background process started by --daemon.
+type daemon struct {
+	// ready is the pipe to the process that started it.
+	ready *os.File
+}
+
+// checkDaemon returns an error if the server is to run in the background
+// without a log file for its output.
+func checkDaemon(enabled bool, logPath string) error {
+	if enabled && (logPath == "-" || logPath == "") {
+		return errors.New("running in the background requires a log file " +
+			"set with --logPath")
+	}
+	return nil
+}
+
+// daemonize starts the server again, with the same arguments, in a background
+// process in a new session, detached from the terminal, with its input from
+// /dev/null and its output appended to the log file. This process then exits
+// once the background process is serving, so it only returns if enabled is
+// false, if it is the background process, or on error, such as when the
+// background process exits before serving. Returns the daemon in the
+// background process started by it and nil otherwise.
+func daemonize(enabled bool, logPath string) (*daemon, error) {
+	switch os.Getenv(daemonEnv) {
+	case daemonStarting:
+		_ = os.Setenv(daemonEnv, daemonRunning)
+		return &daemon{ready: os.NewFile(daemonReadyFD, "daemon ready")}, nil
+	case daemonRunning:
+		return nil, nil
+	}
+	if !enabled {
+		return nil, nil
+	} else if err := checkDaemon(enabled, logPath); err != nil {
+		return nil, err
+	}
+
+	executable, err := os.Executable()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to find the server binary")
+	}
+	logFile, err := os.OpenFile(
+		logPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to open log file")
+	}
+	defer func() { _ = logFile.Close() }()
+	devNull, err := os.Open(os.DevNull)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = devNull.Close() }()
+	ready, readyWriter, err := os.Pipe()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create pipe to background "+
+			"process")
+	}
+	defer func() { _ = ready.Close() }()
+
+	cmd := exec.Command(executable, os.Args[1:]...)
+	cmd.Env = append(os.Environ(), daemonEnv+"="+daemonStarting)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = devNull, logFile, logFile
+	cmd.ExtraFiles = []*os.File{readyWriter}
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+	err = cmd.Start()
+
+	// Close the write end so that reading fails if the process exits
+	_ = readyWriter.Close()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to start background process")
+	}
+
+	buf := make([]byte, 1)
+	if _, err = ready.Read(buf); err != nil || buf[0] != daemonReady {
+		_ = cmd.Wait()
+		return nil, errors.Errorf("background process %d exited before "+
+			"serving; see the log in %s", cmd.Process.Pid, logPath)
+	}
+	fmt.Printf("Server running in the background as process %d; logging to "+
+		"%s\n", cmd.Process.Pid, logPath)
+	_ = cmd.Process.Release()
+	os.Exit(0)
+	return nil, nil
+}
+
+// serving tells the process that started the background process that the
+// server is serving so that it exits.
+func (d *daemon) serving() {
+	_, _ = d.ready.Write([]byte{daemonReady})
+	_ = d.ready.Close()
+}
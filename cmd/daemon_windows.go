@@ -0,0 +1,31 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package cmd
+
+import "github.com/pkg/errors"
+
+// daemon is never started on Windows, where the server runs in the background
+// as a service instead.
+type daemon struct{}
+
+// checkDaemon returns an error if the server is to run in the background,
+// which is not supported on Windows.
+func checkDaemon(enabled bool, _ string) error {
+	if enabled {
+		return errors.New("running in the background is not supported on " +
+			"Windows; install the server as a service instead")
+	}
+	return nil
+}
+
+// daemonize returns an error if enabled is true and nil otherwise.
+func daemonize(enabled bool, logPath string) (*daemon, error) {
+	return nil, checkDaemon(enabled, logPath)
+}
+
+func (d *daemon) serving() {}
@@ -0,0 +1,104 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+// Handles the dedup subcommand, which reports the space saved by deduplication
+
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	jww "github.com/spf13/jwalterweatherman"
+	"github.com/spf13/viper"
+
+	"gitlab.com/elixxir/remoteSyncServer/store"
+)
+
+func init() {
+	dedupStatsCmd.Flags().StringSlice(migrateUsersFlag, nil,
+		"Users whose files are counted. Defaults to all users in the "+
+			"credential store.")
+
+	// Errors are caused by the backends, so printing the usage does not help
+	dedupStatsCmd.SilenceUsage = true
+	dedupCmd.AddCommand(dedupStatsCmd)
+	rootCmd.AddCommand(dedupCmd)
+}
+
+var dedupCmd = &cobra.Command{
+	Use:   "dedup",
+	Short: "Manages the deduplication of stored files",
+}
+
+var dedupStatsCmd = &cobra.Command{
+	Use:   "stats",
+	Short: "Shows the space saved by deduplication",
+	Long: "Prints, for each user, the number of files, including previous " +
+		"versions, the number of distinct deduplicated files stored, and the " +
+		"size in bytes of the files before and after deduplication, " +
+		"separated by tabs, followed by the total saved. Sizes are before " +
+		"compression. Exits with status 1 if the files of any user could " +
+		"not be counted.",
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		initConfig(configFilePath)
+		if !viper.IsSet(dedupTag) {
+			return errors.Errorf("deduplication is not configured; set the "+
+				"%s section of the config", dedupTag)
+		}
+		storageDir, newStore, err := openStorage(dedupTag)
+		if err != nil {
+			return err
+		}
+		users, err := migrationUsers(cmd)
+		if err != nil {
+			return err
+		}
+
+		var total store.DedupStats
+		var failed []string
+		for _, username := range users {
+			stats, err := dedupStats(username, newStore, storageDir)
+			if err != nil {
+				jww.ERROR.Printf("Failed to count the files of %q: %+v",
+					username, err)
+				failed = append(failed, username)
+				continue
+			}
+			fmt.Printf("%s\t%d\t%d\t%d\t%d\n", username, stats.Files,
+				stats.Blobs, stats.LogicalSize, stats.StoredSize)
+			total.Add(stats)
+		}
+
+		saved := total.LogicalSize - total.StoredSize
+		var percent float64
+		if total.LogicalSize > 0 {
+			percent = 100 * float64(saved) / float64(total.LogicalSize)
+		}
+		fmt.Printf("Saved %s of %s (%.1f%%) in %d files of %d users\n",
+			formatBytes(saved), formatBytes(total.LogicalSize),
+			percent, total.Files, len(users)-len(failed))
+
+		if len(failed) > 0 {
+			return errors.Errorf("failed to count the files of %d users: %v",
+				len(failed), failed)
+		}
+		return nil
+	},
+}
+
+// dedupStats returns the deduplication stats of the user's files.
+func dedupStats(username string, newStore store.NewStore,
+	storageDir string) (store.DedupStats, error) {
+	s, err := newStore(storageDir, username)
+	if err != nil {
+		return store.DedupStats{}, err
+	}
+	return s.(*store.DedupStore).Stats()
+}
@@ -0,0 +1,91 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+// Handles the encrypt-value subcommand, which encrypts values for the config
+// with the config key
+
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"golang.org/x/term"
+)
+
+func init() {
+	// Errors are caused by the config key or the input, so printing the usage
+	// does not help
+	encryptValueCmd.SilenceUsage = true
+	rootCmd.AddCommand(encryptValueCmd)
+}
+
+var encryptValueCmd = &cobra.Command{
+	Use:   "encrypt-value [value]",
+	Short: "Encrypts a value for the config with the config key",
+	Long: "Encrypts the value with the config key, from configKey or " +
+		"configKeyPath, and prints it as ENC[...] to be pasted into the " +
+		"config in place of the value, such as a database DSN or API key. " +
+		"Without an argument, the value is read from stdin, without echo " +
+		"if it is a terminal, so that it is not saved in the shell history.",
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		initConfig(configFilePath)
+		if !viper.IsSet(configKeyTag) && !viper.IsSet(configKeyPathTag) {
+			return errors.Errorf("no config key; set %s or %s",
+				configKeyTag, configKeyPathTag)
+		}
+		configCipher, err := newConfigCipher()
+		if err != nil {
+			return err
+		}
+
+		var value string
+		if len(args) > 0 {
+			value = args[0]
+		} else if value, err = readValue(); err != nil {
+			return err
+		}
+		if value == "" {
+			return errors.New("value cannot be empty")
+		}
+
+		encrypted, err := configCipher.Encrypt(value)
+		if err != nil {
+			return err
+		}
+		fmt.Println(encrypted)
+		return nil
+	},
+}
+
+// readValue reads the value to encrypt from stdin. If stdin is a terminal, the
+// user is prompted and the input is not echoed; otherwise, all of stdin is
+// read, without a trailing newline.
+func readValue() (string, error) {
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		value, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return "", errors.Wrap(err, "failed to read value from stdin")
+		}
+		return strings.TrimRight(string(value), "\r\n"), nil
+	}
+
+	fmt.Fprint(os.Stderr, "Value: ")
+	value, err := term.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to read value")
+	}
+	return string(value), nil
+}
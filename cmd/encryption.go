@@ -0,0 +1,111 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+// Handles the encryption subcommand, which re-encrypts stored files after the
+// active key changes
+
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	jww "github.com/spf13/jwalterweatherman"
+	"github.com/spf13/viper"
+
+	"gitlab.com/elixxir/remoteSyncServer/store"
+)
+
+func init() {
+	encryptionRotateCmd.Flags().StringSlice(migrateUsersFlag, nil,
+		"Users whose files are re-encrypted. Defaults to all users in the "+
+			"credential store.")
+
+	// Errors are caused by the backends, so printing the usage does not help
+	encryptionRotateCmd.SilenceUsage = true
+	encryptionCmd.AddCommand(encryptionRotateCmd)
+	rootCmd.AddCommand(encryptionCmd)
+}
+
+var encryptionCmd = &cobra.Command{
+	Use:   "encryption",
+	Short: "Manages the encryption of stored files",
+}
+
+var encryptionRotateCmd = &cobra.Command{
+	Use:   "rotate",
+	Short: "Re-encrypts all stored files with the active key",
+	Long: "Re-encrypts every file of every user, including previous " +
+		"versions, that is not encrypted or is encrypted with a key other " +
+		"than activeKey, so that the old keys can be removed from the " +
+		"config. Stop the server or block writes while rotating. Exits with " +
+		"status 1 if the files of any user could not be re-encrypted.",
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		initConfig(configFilePath)
+		if !viper.IsSet(encryptionTag) {
+			return errors.Errorf("encryption is not configured; set the keys "+
+				"in the %s section of the config", encryptionTag)
+		}
+		storageDir, newStore, err := openStorage(encryptionTag)
+		if err != nil {
+			return err
+		}
+		users, err := migrationUsers(cmd)
+		if err != nil {
+			return err
+		}
+
+		var files, rotated int
+		var failed []string
+		for _, username := range users {
+			n, total, err := rotateUser(username, newStore, storageDir)
+			files += total
+			rotated += n
+			if err != nil {
+				jww.ERROR.Printf("Failed to re-encrypt the files of %q: %+v",
+					username, err)
+				failed = append(failed, username)
+			}
+		}
+
+		fmt.Printf("Re-encrypted %d of %d files of %d users\n",
+			rotated, files, len(users))
+		if len(failed) > 0 {
+			return errors.Errorf("failed to re-encrypt the files of %d "+
+				"users: %v", len(failed), failed)
+		}
+		return nil
+	},
+}
+
+// rotateUser re-encrypts the files of the user with the active key. Returns
+// the number of files re-encrypted and the number of files checked.
+func rotateUser(username string, newStore store.NewStore,
+	storageDir string) (int, int, error) {
+	s, err := newStore(storageDir, username)
+	if err != nil {
+		return 0, 0, err
+	}
+	files, err := s.(store.Lister).ListFiles()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	var rotated int
+	for i, file := range files {
+		ok, err := s.(*store.EncryptedStore).Reencrypt(file)
+		if err != nil {
+			return rotated, i,
+				errors.Wrapf(err, "failed to re-encrypt %s", file)
+		} else if ok {
+			rotated++
+		}
+	}
+	return rotated, len(files), nil
+}
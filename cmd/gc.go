@@ -0,0 +1,165 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+// Handles the gc subcommand, which runs the garbage collection policies on
+// demand
+
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"gitlab.com/elixxir/remoteSyncServer/server"
+	"gitlab.com/elixxir/remoteSyncServer/store"
+	"gitlab.com/xx_network/primitives/utils"
+)
+
+const (
+	gcDryRunFlag = "dry-run"
+	gcUsersFlag  = "users"
+)
+
+func init() {
+	gcRunCmd.Flags().Bool(gcDryRunFlag, false,
+		"Report the files the policies would remove without removing them.")
+	gcRunCmd.Flags().StringSlice(gcUsersFlag, nil,
+		"Users whose files are collected. Defaults to all users in the "+
+			"credential store.")
+
+	// Errors are caused by the backends, so printing the usage does not help
+	gcRunCmd.SilenceUsage = true
+	gcCmd.AddCommand(gcRunCmd)
+	rootCmd.AddCommand(gcCmd)
+}
+
+var gcCmd = &cobra.Command{
+	Use:   "gc",
+	Short: "Manages the garbage collection of stored files",
+}
+
+var gcRunCmd = &cobra.Command{
+	Use:   "run [policy...]",
+	Short: "Runs the garbage collection policies now",
+	Long: "Runs the garbage collection policies in the gc section of the " +
+		"config on the files of every user, or only the given policies " +
+		"(inactiveUsers, logs, or tombstones), and prints each file removed. " +
+		"With --dry-run, the files that would be removed are reported and " +
+		"nothing is removed. The storage backend, Redis cache, encryption, " +
+		"compression, deduplication, and versioning are used as configured, " +
+		"so the command can be run while the server is running. Exits with " +
+		"status 1 if the files of any user could not be collected.",
+	Args: cobra.ArbitraryArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		initConfig(configFilePath)
+		if !viper.IsSet(gcParamsTag) {
+			return errors.Errorf("no gc policies are configured; set them in "+
+				"the %s section of the config", gcParamsTag)
+		}
+		gc, err := server.NewGarbageCollector(viper.GetStringMap(gcParamsTag))
+		if err != nil {
+			return err
+		}
+		storageDir, newStore, err := openStorage(versioningTag)
+		if err != nil {
+			return err
+		}
+		users, _ := cmd.Flags().GetStringSlice(gcUsersFlag)
+		if len(users) == 0 {
+			credentialStore, _, err := openUserStore()
+			if err != nil {
+				return err
+			}
+			if users, err = credentialStore.List(); err != nil {
+				return err
+			}
+		}
+
+		dryRun, _ := cmd.Flags().GetBool(gcDryRunFlag)
+		report, err := gc.Run(storageDir, newStore, users, args, dryRun)
+		if err != nil {
+			return err
+		}
+
+		verb := "Removed"
+		if dryRun {
+			verb = "Would remove"
+		}
+		for _, a := range report.Actions {
+			fmt.Printf("%s\t%s\t%s\n", a.Policy, a.User, a.Path)
+		}
+		fmt.Printf("%s %d files of inactive users, %d log entries, and the "+
+			"versions of %d deleted files of %d users\n", verb,
+			report.Count(server.GCInactiveUsers), report.Count(server.GCLogs),
+			report.Count(server.GCTombstones), report.Users)
+		if len(report.Failed) > 0 {
+			return errors.Errorf("failed to collect the files of %d users: %v",
+				len(report.Failed), report.Failed)
+		}
+		return nil
+	},
+}
+
+// storageLayers are the optional wrappers of the storage backend, innermost
+// first, by the tag of their config section.
+var storageLayers = []struct {
+	tag  string
+	name string
+	wrap func(map[string]interface{}, store.NewStore) (store.NewStore, error)
+}{
+	{encryptionTag, "encryption", store.NewEncryptedStore},
+	{compressionTag, "compression", store.NewCompressedStore},
+	{dedupTag, "deduplication", store.NewDedupStore},
+	{versioningTag, "versioning", store.NewVersionedStore},
+}
+
+// openStorage initialises the configured storage backend, wrapped in the Redis
+// cache and the configured storageLayers as by the server, so that files
+// changed by a command are changed in the cache and are encrypted. The layers
+// after the one with the tag top are left out, so that, if it is configured,
+// the stores are of that layer. The memory backend is rejected, since its files
+// are only in the server process.
+func openStorage(top string) (string, store.NewStore, error) {
+	storageDir, err := utils.ExpandPath(viper.GetString(storageDirTag))
+	if err != nil {
+		return "", nil, errors.Wrapf(err, "invalid %s", storageDirTag)
+	}
+	storageBackend := viper.GetString(storageBackendTag)
+	if storageBackend == store.MemoryBackend {
+		return "", nil, errors.Errorf("the files of the %q backend are only "+
+			"in the server", storageBackend)
+	}
+	newStore, err := openMigrationBackend(storageBackend)
+	if err != nil {
+		return "", nil, err
+	}
+
+	if redisAddr := viper.GetString(redisAddrTag); redisAddr != "" {
+		newStore, err = store.NewRedisCache(
+			redisAddr, viper.GetStringMap(redisParamsTag), newStore)
+		if err != nil {
+			return "", nil, errors.Wrap(err, "failed to initialise Redis cache")
+		}
+	}
+	for _, layer := range storageLayers {
+		if viper.IsSet(layer.tag) {
+			newStore, err = layer.wrap(viper.GetStringMap(layer.tag), newStore)
+			if err != nil {
+				return "", nil, errors.Wrapf(
+					err, "failed to initialise %s", layer.name)
+			}
+		}
+		if layer.tag == top {
+			break
+		}
+	}
+
+	return storageDir, newStore, nil
+}
@@ -0,0 +1,235 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+// Handles the gen-cert subcommand, which generates a self-signed certificate
+// for test deployments
+
+package cmd
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"gitlab.com/xx_network/primitives/utils"
+)
+
+const (
+	genCertHostsFlag    = "hosts"
+	genCertValidityFlag = "validity"
+	genCertKeyTypeFlag  = "keyType"
+	genCertForceFlag    = "force"
+
+	defaultGenCertValidity = 365 * 24 * time.Hour
+	defaultGenCertKeyType  = "rsa-4096"
+
+	// Permissions of the generated files. The key is only readable by its
+	// owner.
+	genCertFilePerm = 0644
+	genCertKeyPerm  = 0600
+	genCertDirPerm  = 0700
+)
+
+// genCertKeyTypes maps the supported key types to functions that generate a
+// key of that type.
+var genCertKeyTypes = map[string]func() (crypto.Signer, error){
+	"rsa-2048": func() (crypto.Signer, error) {
+		return rsa.GenerateKey(rand.Reader, 2048)
+	},
+	"rsa-4096": func() (crypto.Signer, error) {
+		return rsa.GenerateKey(rand.Reader, 4096)
+	},
+	"ecdsa-p256": func() (crypto.Signer, error) {
+		return ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	},
+	"ecdsa-p384": func() (crypto.Signer, error) {
+		return ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	},
+	"ed25519": func() (crypto.Signer, error) {
+		_, key, err := ed25519.GenerateKey(rand.Reader)
+		return key, err
+	},
+}
+
+func init() {
+	genCertCmd.Flags().StringSlice(genCertHostsFlag, []string{"localhost"},
+		"Comma-separated list of DNS names and IP addresses the certificate "+
+			"is valid for. The first is used as the common name.")
+	genCertCmd.Flags().Duration(genCertValidityFlag, defaultGenCertValidity,
+		"How long the certificate is valid for.")
+	genCertCmd.Flags().String(genCertKeyTypeFlag, defaultGenCertKeyType,
+		"Type of the key ("+strings.Join(genCertKeyTypeNames(), ", ")+"). "+
+			"Without mTLS, ACME, TLS settings, OCSP stapling, or additional "+
+			"certificates, xx comms serves the certificate and requires RSA.")
+	genCertCmd.Flags().Bool(genCertForceFlag, false,
+		"Overwrite existing certificate and key files.")
+
+	// Errors are caused by the arguments or the file system, so printing the
+	// usage does not help
+	genCertCmd.SilenceUsage = true
+	rootCmd.AddCommand(genCertCmd)
+}
+
+var genCertCmd = &cobra.Command{
+	Use:   "gen-cert",
+	Short: "Generates a self-signed certificate and key",
+	Long: "Generates a self-signed certificate and key for local and " +
+		"air-gapped test deployments and writes them to signedCertPath and " +
+		"signedKeyPath from the config file. Clients must be configured to " +
+		"trust the certificate.",
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		initConfig(configFilePath)
+		if viper.GetString(signedCertPathTag) == "" ||
+			viper.GetString(signedKeyPathTag) == "" {
+			return errors.Errorf("%s and %s must be set in the config file",
+				signedCertPathTag, signedKeyPathTag)
+		}
+		certPath, err := utils.ExpandPath(viper.GetString(signedCertPathTag))
+		if err != nil {
+			return errors.Wrap(err, "invalid certificate path")
+		}
+		keyPath, err := utils.ExpandPath(viper.GetString(signedKeyPathTag))
+		if err != nil {
+			return errors.Wrap(err, "invalid key path")
+		}
+
+		hosts, err := cmd.Flags().GetStringSlice(genCertHostsFlag)
+		if err != nil {
+			return err
+		}
+		validity, err := cmd.Flags().GetDuration(genCertValidityFlag)
+		if err != nil {
+			return err
+		}
+		keyType, err := cmd.Flags().GetString(genCertKeyTypeFlag)
+		if err != nil {
+			return err
+		}
+		force, err := cmd.Flags().GetBool(genCertForceFlag)
+		if err != nil {
+			return err
+		}
+
+		if !force {
+			for _, path := range []string{certPath, keyPath} {
+				if _, err = os.Stat(path); err == nil {
+					return errors.Errorf("%s already exists; use --%s to "+
+						"overwrite it", path, genCertForceFlag)
+				}
+			}
+		}
+
+		certPem, keyPem, err := generateCertificate(hosts, validity, keyType)
+		if err != nil {
+			return err
+		}
+		err = utils.WriteFile(keyPath, keyPem, genCertKeyPerm, genCertDirPerm)
+		if err != nil {
+			return errors.Wrapf(err, "failed to write key to %s", keyPath)
+		}
+		err = utils.WriteFile(
+			certPath, certPem, genCertFilePerm, genCertDirPerm)
+		if err != nil {
+			return errors.Wrapf(err, "failed to write certificate to %s",
+				certPath)
+		}
+
+		fmt.Printf("Wrote self-signed certificate for %s to %s and its key "+
+			"to %s\n", strings.Join(hosts, ", "), certPath, keyPath)
+		return nil
+	},
+}
+
+// generateCertificate returns a new PEM-encoded self-signed server certificate
+// for the hosts, which may be DNS names or IP addresses, and its PKCS #8
+// private key of the key type.
+func generateCertificate(hosts []string, validity time.Duration,
+	keyType string) (certPem, keyPem []byte, err error) {
+	if len(hosts) == 0 {
+		return nil, nil, errors.New("at least one host is required")
+	}
+	if validity <= 0 {
+		return nil, nil, errors.Errorf("validity %s must be positive", validity)
+	}
+	generateKey, exists := genCertKeyTypes[keyType]
+	if !exists {
+		return nil, nil, errors.Errorf("unknown key type %q (available: %s)",
+			keyType, strings.Join(genCertKeyTypeNames(), ", "))
+	}
+
+	key, err := generateKey()
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "failed to generate key")
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "failed to generate serial number")
+	}
+
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: hosts[0]},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(validity),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+	}
+	if _, isRSA := key.(*rsa.PrivateKey); isRSA {
+		template.KeyUsage |= x509.KeyUsageKeyEncipherment
+	}
+	for _, host := range hosts {
+		if ip := net.ParseIP(host); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else {
+			template.DNSNames = append(template.DNSNames, host)
+		}
+	}
+
+	der, err := x509.CreateCertificate(
+		rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "failed to create certificate")
+	}
+	keyDer, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "failed to encode key")
+	}
+
+	certPem = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPem = pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDer})
+	return certPem, keyPem, nil
+}
+
+// genCertKeyTypeNames returns the sorted names of the supported key types.
+func genCertKeyTypeNames() []string {
+	names := make([]string, 0, len(genCertKeyTypes))
+	for name := range genCertKeyTypes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
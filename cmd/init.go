@@ -0,0 +1,95 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+// Handles the init subcommand, which writes a commented default config file
+
+package cmd
+
+import (
+	_ "embed"
+	"fmt"
+	"os"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+
+	"gitlab.com/xx_network/primitives/utils"
+)
+
+const (
+	initForceFlag = "force"
+
+	defaultInitConfigPath = "remoteSyncServer.yaml"
+
+	// Permissions of the config file, which may contain secrets such as the
+	// admin key, and its directory.
+	initConfigPerm    = 0600
+	initConfigDirPerm = 0700
+)
+
+// defaultConfig is the config file written by the init subcommand. It contains
+// every supported key with its default value, with optional features commented
+// out.
+//
+//go:embed defaultConfig.yaml
+var defaultConfig []byte
+
+func init() {
+	initCmd.Flags().Bool(initForceFlag, false,
+		"Overwrite an existing config file.")
+
+	// Errors are caused by the arguments or the file system, so printing the
+	// usage does not help
+	initCmd.SilenceUsage = true
+	rootCmd.AddCommand(initCmd)
+}
+
+var initCmd = &cobra.Command{
+	Use:   "init [path]",
+	Short: "Writes a commented default config file",
+	Long: "Writes a config file containing every supported option, with " +
+		"comments and default values, to the path or, if none is given, to " +
+		"the --config path or " + defaultInitConfigPath + " in the current " +
+		"directory. Optional features are commented out. Use \"-\" to print " +
+		"the config to stdout.",
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		path := configFilePath
+		if len(args) > 0 {
+			path = args[0]
+		}
+		if path == "" {
+			path = defaultInitConfigPath
+		}
+		if path == "-" {
+			_, err := os.Stdout.Write(defaultConfig)
+			return err
+		}
+
+		path, err := utils.ExpandPath(path)
+		if err != nil {
+			return errors.Wrap(err, "invalid config file path")
+		}
+		force, err := cmd.Flags().GetBool(initForceFlag)
+		if err != nil {
+			return err
+		}
+		if _, err = os.Stat(path); err == nil && !force {
+			return errors.Errorf("%s already exists; use --%s to overwrite it",
+				path, initForceFlag)
+		}
+
+		err = utils.WriteFile(
+			path, defaultConfig, initConfigPerm, initConfigDirPerm)
+		if err != nil {
+			return errors.Wrapf(err, "failed to write config to %s", path)
+		}
+
+		fmt.Printf("Wrote default config to %s\n", path)
+		return nil
+	},
+}
@@ -0,0 +1,543 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+// Handles the loadtest subcommand, which simulates many clients syncing with a
+// running server and reports the latencies and errors of their requests
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"math/rand"
+	"os"
+	"os/signal"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/status"
+
+	pb "gitlab.com/elixxir/comms/mixmessages"
+	"gitlab.com/elixxir/remoteSyncServer/rpc"
+	"gitlab.com/elixxir/remoteSyncServer/server"
+)
+
+const (
+	loadtestClientsFlag  = "clients"
+	loadtestDurationFlag = "duration"
+	loadtestUsernameFlag = "username"
+	loadtestFilesFlag    = "files"
+	loadtestFileSizeFlag = "fileSize"
+	loadtestThinkFlag    = "think"
+	loadtestMixFlag      = "mix"
+	loadtestCertFlag     = "cert"
+
+	// loadtestRequestTimeout is the maximum time to wait for a single request.
+	loadtestRequestTimeout = 30 * time.Second
+
+	// loadtestClientNumber is replaced with the number of each client in the
+	// username, so that clients can log in as different users.
+	loadtestClientNumber = "{n}"
+)
+
+// Operations performed by the simulated clients.
+const (
+	loadtestLogin     = "login"
+	loadtestRead      = "read"
+	loadtestWrite     = "write"
+	loadtestList      = "list"
+	loadtestModified  = "modified"
+	loadtestLastWrite = "lastWrite"
+)
+
+// loadtestOperations lists the operations that can be weighted in the mix, in
+// the order they are reported.
+var loadtestOperations = []string{loadtestRead, loadtestWrite, loadtestList,
+	loadtestModified, loadtestLastWrite}
+
+func init() {
+	flags := loadtestCmd.Flags()
+	flags.String(adminAddressFlag, "",
+		"Address of the server to test. Defaults to the first configured "+
+			"bind address, or localhost if it is unspecified, on the "+
+			"configured port.")
+	flags.String(loadtestCertFlag, "",
+		"Path to the certificate of the server to trust. Defaults to the "+
+			"certificate in the config file.")
+	flags.String(adminClientCertFlag, "",
+		"Path to the client certificate to present when the server requires "+
+			"mTLS.")
+	flags.String(adminClientKeyFlag, "",
+		"Path to the key of the client certificate.")
+	flags.StringP(loadtestUsernameFlag, "u", "",
+		"Username the clients log in as. "+loadtestClientNumber+" is "+
+			"replaced with the number of each client, starting at 0.")
+	flags.StringP(userPasswordFlag, "p", "",
+		"Password of the users. If not set, it is read from stdin.")
+	flags.IntP(loadtestClientsFlag, "n", 10,
+		"Number of clients to simulate concurrently.")
+	flags.DurationP(loadtestDurationFlag, "d", time.Minute,
+		"How long to run the test for.")
+	flags.Int(loadtestFilesFlag, 20,
+		"Number of files each client writes before the test and then reads "+
+			"and writes during it.")
+	flags.Int(loadtestFileSizeFlag, 1024,
+		"Size, in bytes, of the files written.")
+	flags.Duration(loadtestThinkFlag, 100*time.Millisecond,
+		"Average pause of each client between operations. The pauses are "+
+			"random, up to twice the average.")
+	flags.StringToInt(loadtestMixFlag, map[string]int{
+		loadtestRead: 50, loadtestWrite: 10, loadtestList: 5,
+		loadtestModified: 20, loadtestLastWrite: 15},
+		"Relative weights of the operations performed by the clients. "+
+			"Operations that are left out are not performed.")
+	_ = loadtestCmd.MarkFlagRequired(loadtestUsernameFlag)
+
+	// Errors are caused by the arguments or the server, so printing the usage
+	// does not help
+	loadtestCmd.SilenceUsage = true
+	rootCmd.AddCommand(loadtestCmd)
+}
+
+var loadtestCmd = &cobra.Command{
+	Use:   "loadtest",
+	Short: "Simulates many clients syncing with a running server",
+	Long: "Simulates clients that concurrently log in and then read, write, " +
+		"and list files and get their modification times on a running " +
+		"server, and reports the latency percentiles and error rates of " +
+		"each operation. Each client works in its own directory, " +
+		"loadtest/<n>, of its user's storage, which is not removed " +
+		"afterwards. Interrupting the test reports the results so far.",
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		initConfig(configFilePath)
+
+		lt, err := newLoadtest(cmd)
+		if err != nil {
+			return err
+		}
+
+		address, _ := cmd.Flags().GetString(adminAddressFlag)
+		if address == "" {
+			address = adminAddress()
+		}
+		creds, err := loadtestTransportCredentials(cmd)
+		if err != nil {
+			return err
+		}
+		conn, err := grpc.Dial(address, grpc.WithTransportCredentials(creds))
+		if err != nil {
+			return errors.Wrapf(err, "failed to dial %s", address)
+		}
+		defer func() { _ = conn.Close() }()
+		lt.session = rpc.NewSessionClient(conn)
+		lt.remoteSync = pb.NewRemoteSyncClient(conn)
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer stop()
+		ctx, cancel := context.WithTimeout(ctx, lt.duration)
+		defer cancel()
+
+		fmt.Printf("Running %d clients against %s for %s\n",
+			lt.clients, address, lt.duration)
+		started := time.Now()
+		results := lt.run(ctx)
+		results.print(time.Since(started))
+		return nil
+	},
+}
+
+// loadtestTransportCredentials returns the credentials used to connect to the
+// tested server. They trust the certificate in the cert flag, if it is set,
+// and are otherwise the same as those of the admin commands.
+func loadtestTransportCredentials(
+	cmd *cobra.Command) (credentials.TransportCredentials, error) {
+	certPath, _ := cmd.Flags().GetString(loadtestCertFlag)
+	if certPath == "" {
+		return adminTransportCredentials(cmd)
+	}
+
+	tlsConf, err := serverTLSConfig(certPath)
+	if err != nil {
+		return nil, err
+	}
+	if err = addClientCertificate(cmd, tlsConf); err != nil {
+		return nil, err
+	}
+	return credentials.NewTLS(tlsConf), nil
+}
+
+// loadtest simulates clients that log in to a server and sync files with it.
+type loadtest struct {
+	session    rpc.SessionClient
+	remoteSync pb.RemoteSyncClient
+
+	username string
+	password string
+	clients  int
+	duration time.Duration
+	files    int
+	fileSize int
+	think    time.Duration
+
+	// mix contains the weight of each operation in loadtestOperations, and
+	// totalWeight is their sum.
+	mix         []int
+	totalWeight int
+}
+
+// newLoadtest returns a loadtest with the parameters in the flags of the
+// command. Returns an error if any are invalid.
+func newLoadtest(cmd *cobra.Command) (*loadtest, error) {
+	flags := cmd.Flags()
+	lt := &loadtest{}
+	lt.username, _ = flags.GetString(loadtestUsernameFlag)
+	lt.clients, _ = flags.GetInt(loadtestClientsFlag)
+	lt.duration, _ = flags.GetDuration(loadtestDurationFlag)
+	lt.files, _ = flags.GetInt(loadtestFilesFlag)
+	lt.fileSize, _ = flags.GetInt(loadtestFileSizeFlag)
+	lt.think, _ = flags.GetDuration(loadtestThinkFlag)
+	weights, _ := flags.GetStringToInt(loadtestMixFlag)
+
+	if lt.username == "" {
+		return nil, errors.New("username cannot be empty")
+	} else if lt.clients <= 0 {
+		return nil, errors.Errorf(
+			"number of clients %d must be positive", lt.clients)
+	} else if lt.duration <= 0 {
+		return nil, errors.Errorf("duration %s must be positive", lt.duration)
+	} else if lt.files <= 0 {
+		return nil, errors.Errorf(
+			"number of files %d must be positive", lt.files)
+	} else if lt.fileSize < 0 {
+		return nil, errors.Errorf(
+			"file size %d cannot be negative", lt.fileSize)
+	} else if lt.think < 0 {
+		return nil, errors.Errorf("think time %s cannot be negative", lt.think)
+	}
+
+	lt.mix = make([]int, len(loadtestOperations))
+	for operation, weight := range weights {
+		i := 0
+		for i < len(loadtestOperations) && loadtestOperations[i] != operation {
+			i++
+		}
+		if i == len(loadtestOperations) {
+			return nil, errors.Errorf("unknown operation %q in mix "+
+				"(available: %s)", operation,
+				strings.Join(loadtestOperations, ", "))
+		} else if weight < 0 {
+			return nil, errors.Errorf(
+				"weight %d of %s cannot be negative", weight, operation)
+		}
+		lt.mix[i] = weight
+		lt.totalWeight += weight
+	}
+	if lt.totalWeight == 0 {
+		return nil, errors.New("mix must have an operation with a weight")
+	}
+
+	var err error
+	if lt.password, err = flagPassword(cmd); err != nil {
+		return nil, err
+	}
+	return lt, nil
+}
+
+// run runs the clients until the context is done and returns their results.
+func (lt *loadtest) run(ctx context.Context) loadtestResults {
+	var wg sync.WaitGroup
+	clientResults := make([]loadtestResults, lt.clients)
+	for n := 0; n < lt.clients; n++ {
+		wg.Add(1)
+		go func(n int) {
+			defer wg.Done()
+			clientResults[n] = lt.newClient(n).run(ctx)
+		}(n)
+	}
+	wg.Wait()
+
+	results := make(loadtestResults)
+	for _, r := range clientResults {
+		results.merge(r)
+	}
+	return results
+}
+
+// loadtestClient is a single simulated client.
+type loadtestClient struct {
+	*loadtest
+	username string
+	dir      string
+	token    []byte
+	rng      *rand.Rand
+	results  loadtestResults
+}
+
+// newClient returns the client with the number.
+func (lt *loadtest) newClient(n int) *loadtestClient {
+	return &loadtestClient{
+		loadtest: lt,
+		username: strings.ReplaceAll(
+			lt.username, loadtestClientNumber, strconv.Itoa(n)),
+		dir:     "loadtest/" + strconv.Itoa(n),
+		rng:     rand.New(rand.NewSource(time.Now().UnixNano() + int64(n))),
+		results: make(loadtestResults),
+	}
+}
+
+// run writes the files of the client, like a client setting up its storage,
+// and then performs random operations of the mix until the context is done.
+func (c *loadtestClient) run(ctx context.Context) loadtestResults {
+	for i := 0; i < c.files && ctx.Err() == nil; i++ {
+		c.do(ctx, loadtestWrite, c.path(i))
+	}
+	for ctx.Err() == nil {
+		c.pause(ctx)
+		c.do(ctx, c.pick(), c.path(c.rng.Intn(c.files)))
+	}
+	return c.results
+}
+
+// do performs the operation on the file at the path, logging in first if the
+// client has no valid token, and records its latency and result. Operations
+// cut short because the context is done are not recorded.
+func (c *loadtestClient) do(ctx context.Context, operation, path string) {
+	if c.token == nil {
+		c.call(ctx, loadtestLogin, func(ctx context.Context) error {
+			resp, err := c.session.PasswordLogin(ctx,
+				&rpc.RsPasswordLoginRequest{
+					Username: c.username, Password: c.password})
+			c.token = resp.GetToken()
+			return err
+		})
+		if c.token == nil {
+			return
+		}
+	}
+
+	c.call(ctx, operation, func(ctx context.Context) (err error) {
+		switch operation {
+		case loadtestRead:
+			_, err = c.remoteSync.Read(
+				ctx, &pb.RsReadRequest{Path: path, Token: c.token})
+		case loadtestWrite:
+			data := make([]byte, c.fileSize)
+			_, _ = c.rng.Read(data)
+			_, err = c.remoteSync.Write(ctx,
+				&pb.RsWriteRequest{Path: path, Data: data, Token: c.token})
+		case loadtestList:
+			_, err = c.remoteSync.ReadDir(
+				ctx, &pb.RsReadRequest{Path: c.dir, Token: c.token})
+		case loadtestModified:
+			_, err = c.remoteSync.GetLastModified(
+				ctx, &pb.RsReadRequest{Path: path, Token: c.token})
+		case loadtestLastWrite:
+			_, err = c.remoteSync.GetLastWrite(
+				ctx, &pb.RsLastWriteRequest{Token: c.token})
+		}
+		return err
+	})
+}
+
+// call calls the function with a request timeout and records its latency and
+// error under the operation. The token is dropped if it was rejected, so that
+// the client logs in again.
+func (c *loadtestClient) call(ctx context.Context, operation string,
+	f func(ctx context.Context) error) {
+	requestCtx, cancel := context.WithTimeout(ctx, loadtestRequestTimeout)
+	started := time.Now()
+	err := f(requestCtx)
+	latency := time.Since(started)
+	cancel()
+
+	if ctx.Err() != nil {
+		return
+	}
+	c.results.add(operation, latency, err)
+	if status.Code(err) == codes.Unauthenticated || status.Convert(
+		err).Message() == server.InvalidTokenErr.Error() {
+		c.token = nil
+	}
+}
+
+// pick returns a random operation, weighted by the mix.
+func (c *loadtestClient) pick() string {
+	r := c.rng.Intn(c.totalWeight)
+	for i, weight := range c.mix {
+		if r < weight {
+			return loadtestOperations[i]
+		}
+		r -= weight
+	}
+	return loadtestOperations[len(loadtestOperations)-1]
+}
+
+// pause waits for a random time of up to twice the think time or until the
+// context is done.
+func (c *loadtestClient) pause(ctx context.Context) {
+	if c.think <= 0 {
+		return
+	}
+	timer := time.NewTimer(time.Duration(c.rng.Int63n(int64(2 * c.think))))
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+	case <-timer.C:
+	}
+}
+
+// path returns the path of the file with the index in the client's directory.
+func (c *loadtestClient) path(i int) string {
+	return c.dir + "/file" + strconv.Itoa(i)
+}
+
+// loadtestResults contains the results of each operation.
+type loadtestResults map[string]*operationResults
+
+// operationResults contains the latencies of all requests of an operation, the
+// number of requests that failed with each status code, and the message of the
+// first error with each code.
+type operationResults struct {
+	latencies []time.Duration
+	errors    map[codes.Code]int
+	messages  map[codes.Code]string
+}
+
+// add records a request of the operation.
+func (lr loadtestResults) add(
+	operation string, latency time.Duration, err error) {
+	or := lr.get(operation)
+	or.latencies = append(or.latencies, latency)
+	if err != nil {
+		code := status.Code(err)
+		if or.errors[code] == 0 {
+			or.messages[code] = status.Convert(err).Message()
+		}
+		or.errors[code]++
+	}
+}
+
+// merge adds the requests of the other results.
+func (lr loadtestResults) merge(other loadtestResults) {
+	for operation, o := range other {
+		or := lr.get(operation)
+		or.latencies = append(or.latencies, o.latencies...)
+		for code, count := range o.errors {
+			if or.errors[code] == 0 {
+				or.messages[code] = o.messages[code]
+			}
+			or.errors[code] += count
+		}
+	}
+}
+
+// get returns the results of the operation, adding them if they do not exist.
+func (lr loadtestResults) get(operation string) *operationResults {
+	or, exists := lr[operation]
+	if !exists {
+		or = &operationResults{errors: make(map[codes.Code]int),
+			messages: make(map[codes.Code]string)}
+		lr[operation] = or
+	}
+	return or
+}
+
+// print prints a table of the number of requests, rate, error rate, and
+// latency percentiles of each operation over the elapsed time, followed by the
+// status codes and a message of the errors.
+func (lr loadtestResults) print(elapsed time.Duration) {
+	fmt.Printf("Completed in %s\n\n", elapsed.Truncate(time.Millisecond))
+
+	total := &operationResults{errors: make(map[codes.Code]int)}
+	var rows []string
+	for _, operation := range append(
+		[]string{loadtestLogin}, loadtestOperations...) {
+		if or, exists := lr[operation]; exists {
+			rows = append(rows, operation)
+			total.latencies = append(total.latencies, or.latencies...)
+			for code, count := range or.errors {
+				total.errors[code] += count
+			}
+		}
+	}
+	if len(rows) == 0 {
+		fmt.Println("No requests were completed.")
+		return
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(w,
+		"OPERATION\tREQUESTS\tRATE\tERRORS\tP50\tP90\tP99\tMAX")
+	for _, operation := range rows {
+		lr[operation].printRow(w, operation, elapsed)
+	}
+	total.printRow(w, "total", elapsed)
+	_ = w.Flush()
+
+	if len(total.errors) == 0 {
+		return
+	}
+	fmt.Println("\nErrors:")
+	for _, operation := range rows {
+		or := lr[operation]
+		codeList := make([]codes.Code, 0, len(or.errors))
+		for code := range or.errors {
+			codeList = append(codeList, code)
+		}
+		sort.Slice(codeList, func(i, j int) bool {
+			return codeList[i] < codeList[j]
+		})
+		for _, code := range codeList {
+			fmt.Printf("  %s: %s (%d): %s\n", operation, code,
+				or.errors[code], or.messages[code])
+		}
+	}
+}
+
+// printRow prints the results as a row of the table.
+func (or *operationResults) printRow(
+	w *tabwriter.Writer, name string, elapsed time.Duration) {
+	latencies := append([]time.Duration(nil), or.latencies...)
+	sort.Slice(latencies, func(i, j int) bool {
+		return latencies[i] < latencies[j]
+	})
+
+	var errorCount int
+	for _, count := range or.errors {
+		errorCount += count
+	}
+	requests := len(latencies)
+	_, _ = fmt.Fprintf(w, "%s\t%d\t%.2f/s\t%d (%.1f%%)\t%s\t%s\t%s\t%s\n",
+		name, requests, float64(requests)/elapsed.Seconds(), errorCount,
+		100*float64(errorCount)/float64(requests),
+		percentile(latencies, 0.5), percentile(latencies, 0.9),
+		percentile(latencies, 0.99), percentile(latencies, 1))
+}
+
+// percentile returns the latency below which the fraction p of the sorted
+// latencies fall, rounded to the microsecond.
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	i := int(math.Ceil(p*float64(len(sorted)))) - 1
+	if i < 0 {
+		i = 0
+	}
+	return sorted[i].Round(time.Microsecond)
+}
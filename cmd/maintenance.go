@@ -0,0 +1,74 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+// Handles the maintenance subcommand, which enables or disables read-only
+// maintenance mode on a running server from its Admin service
+
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+
+	"gitlab.com/elixxir/remoteSyncServer/rpc"
+)
+
+// Arguments of the maintenance subcommand.
+const (
+	maintenanceOn  = "on"
+	maintenanceOff = "off"
+)
+
+func init() {
+	addAdminFlags(maintenanceCmd.Flags())
+
+	// Errors are caused by the server, so printing the usage does not help
+	maintenanceCmd.SilenceUsage = true
+	rootCmd.AddCommand(maintenanceCmd)
+}
+
+var maintenanceCmd = &cobra.Command{
+	Use:   "maintenance on|off",
+	Short: "Enables or disables maintenance mode on a running server",
+	Long: "Enables or disables read-only maintenance mode on a running server " +
+		"using its admin API. In maintenance mode, writes and registrations " +
+		"fail with UNAVAILABLE while reads continue, such as to snapshot " +
+		"storage or migrate backends. The mode lasts until it is changed " +
+		"again or the config is reloaded. The server's certificate and admin " +
+		"key are read from the config file.",
+	Args:      cobra.MatchAll(cobra.ExactArgs(1), cobra.OnlyValidArgs),
+	ValidArgs: []string{maintenanceOn, maintenanceOff},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		initConfig(configFilePath)
+		enabled := args[0] == maintenanceOn
+
+		client, ctx, cancel, err := dialAdmin(cmd)
+		if err != nil {
+			return err
+		}
+		defer cancel()
+
+		resp, err := client.SetMaintenance(
+			ctx, &rpc.RsSetMaintenanceRequest{Enabled: enabled})
+		if err != nil {
+			return errors.Wrap(err, "failed to set maintenance mode")
+		}
+		fmt.Printf("Maintenance mode %s (was %s)\n",
+			onOff(enabled), onOff(resp.GetWasEnabled()))
+		return nil
+	},
+}
+
+// onOff returns the argument of the maintenance subcommand for the state.
+func onOff(enabled bool) string {
+	if enabled {
+		return maintenanceOn
+	}
+	return maintenanceOff
+}
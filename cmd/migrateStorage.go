@@ -0,0 +1,192 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+// Handles the migrate-storage subcommand, which copies all users' files from
+// one storage backend to another
+
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"gitlab.com/elixxir/remoteSyncServer/storage"
+	"gitlab.com/elixxir/remoteSyncServer/store"
+	"gitlab.com/xx_network/primitives/utils"
+)
+
+const (
+	migrateFromFlag         = "from"
+	migrateToFlag           = "to"
+	migrateToStorageDirFlag = "toStorageDir"
+	migrateProgressFlag     = "progress"
+	migrateUsersFlag        = "users"
+
+	defaultMigrateProgressPath = "~/migrateStorage.csv"
+)
+
+func init() {
+	migrateStorageCmd.Flags().String(migrateFromFlag, "",
+		"Storage backend to copy the files from. Defaults to the configured "+
+			"storageBackend.")
+	migrateStorageCmd.Flags().String(migrateToFlag, "",
+		"Storage backend to copy the files to.")
+	migrateStorageCmd.Flags().String(migrateToStorageDirFlag, "",
+		"Storage directory of the destination file backend. Defaults to the "+
+			"configured storageDir.")
+	migrateStorageCmd.Flags().String(migrateProgressFlag,
+		defaultMigrateProgressPath, "CSV file recording the migrated files. "+
+			"Rerunning the command with the same file resumes the migration.")
+	migrateStorageCmd.Flags().StringSlice(migrateUsersFlag, nil,
+		"Users to migrate. Defaults to all users in the credential store.")
+	if err := migrateStorageCmd.MarkFlagRequired(migrateToFlag); err != nil {
+		panic(err)
+	}
+
+	// Errors are caused by the backends, so printing the usage does not help
+	migrateStorageCmd.SilenceUsage = true
+	rootCmd.AddCommand(migrateStorageCmd)
+}
+
+var migrateStorageCmd = &cobra.Command{
+	Use:   "migrate-storage",
+	Short: "Copies all users' files from one storage backend to another",
+	Long: "Copies every file of each user from one storage backend to " +
+		"another, such as from \"file\" to \"s3\", using the parameters of " +
+		"both backends in the config. Each copy is read back and its SHA-256 " +
+		"checksum compared to the source. Migrated files are recorded in the " +
+		"progress file, so that an interrupted migration is resumed by " +
+		"rerunning the command. Modification times are not preserved. Stop " +
+		"the server or block writes while migrating, since files changed " +
+		"after they were copied are not copied again.",
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		initConfig(configFilePath)
+		from, _ := cmd.Flags().GetString(migrateFromFlag)
+		if from == "" {
+			from = viper.GetString(storageBackendTag)
+		}
+		to, _ := cmd.Flags().GetString(migrateToFlag)
+		storageDir, err := utils.ExpandPath(viper.GetString(storageDirTag))
+		if err != nil {
+			return errors.Wrapf(err, "invalid %s", storageDirTag)
+		}
+		toStorageDir, _ := cmd.Flags().GetString(migrateToStorageDirFlag)
+		if toStorageDir == "" {
+			toStorageDir = storageDir
+		}
+		toStorageDir, err = utils.ExpandPath(toStorageDir)
+		if err != nil {
+			return errors.Wrapf(err, "invalid --%s", migrateToStorageDirFlag)
+		}
+		if from == to &&
+			(from != store.FileBackend || storageDir == toStorageDir) {
+			return errors.Errorf("the source and destination are both the %q "+
+				"backend with the same parameters", from)
+		}
+
+		newSrc, err := openMigrationBackend(from)
+		if err != nil {
+			return err
+		}
+		newDst, err := openMigrationBackend(to)
+		if err != nil {
+			return err
+		}
+		users, err := migrationUsers(cmd)
+		if err != nil {
+			return err
+		}
+
+		progressPath, _ := cmd.Flags().GetString(migrateProgressFlag)
+		progress, err := store.OpenMigrationProgress(progressPath)
+		if err != nil {
+			return err
+		}
+		defer func() { _ = progress.Close() }()
+		if progress.Len() > 0 {
+			fmt.Printf("Resuming migration; %d files already migrated\n",
+				progress.Len())
+		}
+
+		var total store.MigrationStats
+		for _, username := range users {
+			stats, err := migrateUser(
+				username, newSrc, storageDir, newDst, toStorageDir, progress)
+			total.Copied += stats.Copied
+			total.Skipped += stats.Skipped
+			total.Bytes += stats.Bytes
+			if err != nil {
+				return errors.Wrapf(err, "failed to migrate %s; rerun the "+
+					"command to resume", username)
+			}
+			fmt.Printf("%s: copied %d files (%d bytes), skipped %d already "+
+				"migrated\n",
+				username, stats.Copied, stats.Bytes, stats.Skipped)
+		}
+
+		fmt.Printf("Migrated %d users from %q to %q: copied %d files (%d "+
+			"bytes), skipped %d already migrated\n", len(users), from, to,
+			total.Copied, total.Bytes, total.Skipped)
+		return nil
+	},
+}
+
+// openMigrationBackend initialises the named storage backend with the
+// parameters in its config section. The memory backend is rejected, since its
+// files do not outlive the command.
+func openMigrationBackend(name string) (store.NewStore, error) {
+	if name == store.MemoryBackend {
+		return nil, errors.Errorf("the %q backend cannot be migrated", name)
+	}
+	backend, err := storage.GetBackend(name)
+	if err != nil {
+		return nil, errors.Errorf("%v (available: %s)", err,
+			strings.Join(storage.Backends(), ", "))
+	}
+	newStore, err := backend(viper.GetStringMap(name))
+	if err != nil {
+		return nil, errors.Wrapf(
+			err, "failed to initialise storage backend %q", name)
+	}
+	return newStore, nil
+}
+
+// migrationUsers returns the users given with the users flag or, if there are
+// none, all users in the credential store.
+func migrationUsers(cmd *cobra.Command) ([]string, error) {
+	users, _ := cmd.Flags().GetStringSlice(migrateUsersFlag)
+	if len(users) > 0 {
+		return users, nil
+	}
+
+	credentialStore, _, err := openUserStore()
+	if err != nil {
+		return nil, err
+	}
+	return credentialStore.List()
+}
+
+// migrateUser copies the files of the user from the source to the destination
+// backend.
+func migrateUser(username string, newSrc store.NewStore, srcStorageDir string,
+	newDst store.NewStore, dstStorageDir string,
+	progress *store.MigrationProgress) (store.MigrationStats, error) {
+	src, err := newSrc(srcStorageDir, username)
+	if err != nil {
+		return store.MigrationStats{}, err
+	}
+	dst, err := newDst(dstStorageDir, username)
+	if err != nil {
+		return store.MigrationStats{}, err
+	}
+	return store.MigrateFiles(username, src, dst, progress)
+}
@@ -0,0 +1,106 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+//go:build !windows
+
+package cmd
+
+import (
+	"os"
+	"os/user"
+	"strconv"
+	"syscall"
+
+	"github.com/pkg/errors"
+)
+
+// account is the user and group the server runs as after binding its sockets.
+type account struct {
+	user, group string
+	uid, gid    int
+	groups      []int
+}
+
+// lookupAccount returns the account of the user and group, or nil if neither
+// is set. The group defaults to the primary group of the user. Returns an
+// error if either does not exist or a group is set without a user.
+func lookupAccount(userName, groupName string) (*account, error) {
+	if userName == "" {
+		if groupName != "" {
+			return nil, errors.Errorf("group %q requires a user", groupName)
+		}
+		return nil, nil
+	}
+
+	u, err := user.Lookup(userName)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to find user %q", userName)
+	}
+	gid := u.Gid
+	if groupName != "" {
+		g, err := user.LookupGroup(groupName)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to find group %q", groupName)
+		}
+		gid = g.Gid
+	}
+	a := &account{user: userName, group: groupName}
+	if a.uid, err = strconv.Atoi(u.Uid); err != nil {
+		return nil, errors.Wrapf(err, "invalid UID of user %q", userName)
+	}
+	if a.gid, err = strconv.Atoi(gid); err != nil {
+		return nil, errors.Wrapf(err, "invalid GID of user %q", userName)
+	}
+
+	// The supplementary groups are those of the user, as on login
+	groupIDs, err := u.GroupIds()
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to find groups of user %q",
+			userName)
+	}
+	a.groups = []int{a.gid}
+	for _, groupID := range groupIDs {
+		if id, err := strconv.Atoi(groupID); err == nil && id != a.gid {
+			a.groups = append(a.groups, id)
+		}
+	}
+	return a, nil
+}
+
+// String returns the user and the group, if set, as user:group.
+func (a *account) String() string {
+	if a.group == "" {
+		return a.user
+	}
+	return a.user + ":" + a.group
+}
+
+// drop sets the user, group, and supplementary groups of the process to those
+// of the account. The group is set first, since it cannot be set once the
+// user is unprivileged. Does nothing if the process already runs as the
+// account, such as when started by an upgrade.
+func (a *account) drop() error {
+	if os.Getuid() == a.uid && os.Getgid() == a.gid {
+		return nil
+	}
+	if err := syscall.Setgroups(a.groups); err != nil {
+		return errors.Wrap(err, "failed to set supplementary groups")
+	}
+	if err := syscall.Setgid(a.gid); err != nil {
+		return errors.Wrapf(err, "failed to set group to %d", a.gid)
+	}
+	if err := syscall.Setuid(a.uid); err != nil {
+		return errors.Wrapf(err, "failed to set user to %d", a.uid)
+	}
+	return nil
+}
+
+// chown makes the account the owner of the file or directory, so that the
+// server can use it after dropping privileges.
+func (a *account) chown(path string) error {
+	return os.Chown(path, a.uid, a.gid)
+}
@@ -0,0 +1,28 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package cmd
+
+import "github.com/pkg/errors"
+
+// account is never returned on Windows, where the user of a process cannot be
+// changed.
+type account struct{}
+
+// lookupAccount returns nil if neither the user nor the group is set. Returns
+// an error otherwise, since the user of a process cannot be changed on
+// Windows.
+func lookupAccount(userName, groupName string) (*account, error) {
+	if userName == "" && groupName == "" {
+		return nil, nil
+	}
+	return nil, errors.New("the user and group cannot be changed on Windows")
+}
+
+func (a *account) String() string       { return "" }
+func (a *account) drop() error          { return nil }
+func (a *account) chown(_ string) error { return nil }
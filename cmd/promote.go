@@ -0,0 +1,61 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+// Handles the promote subcommand, which makes a running standby server accept
+// writes from its Admin service
+
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+
+	"gitlab.com/elixxir/remoteSyncServer/rpc"
+)
+
+func init() {
+	addAdminFlags(promoteCmd.Flags())
+
+	// Errors are caused by the server, so printing the usage does not help
+	promoteCmd.SilenceUsage = true
+	rootCmd.AddCommand(promoteCmd)
+}
+
+var promoteCmd = &cobra.Command{
+	Use:   "promote",
+	Short: "Promotes a running standby server to accept writes",
+	Long: "Promotes a running standby server using its admin API, such as " +
+		"when its primary fails. The standby then accepts writes and " +
+		"rejects the writes replicated from the former primary. The " +
+		"promotion lasts until the server restarts, so set its replication " +
+		"role to primary, or remove the replication section, to keep it. " +
+		"The server's certificate and admin key are read from the config " +
+		"file.",
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		initConfig(configFilePath)
+
+		client, ctx, cancel, err := dialAdmin(cmd)
+		if err != nil {
+			return err
+		}
+		defer cancel()
+
+		resp, err := client.Promote(ctx, &rpc.RsPromoteRequest{})
+		if err != nil {
+			return errors.Wrap(err, "failed to promote server")
+		}
+		if resp.GetWasStandby() {
+			fmt.Println("Promoted standby; the server now accepts writes")
+		} else {
+			fmt.Println("Server was already accepting writes")
+		}
+		return nil
+	},
+}
@@ -0,0 +1,117 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+// Handles the rebalance-storage subcommand, which moves users' files to the
+// shard of the sharded backend they are placed on
+
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"gitlab.com/elixxir/remoteSyncServer/store"
+	"gitlab.com/xx_network/primitives/utils"
+)
+
+const rebalanceDryRunFlag = "dryRun"
+
+func init() {
+	rebalanceStorageCmd.Flags().StringSlice(migrateUsersFlag, nil,
+		"Users to rebalance. Defaults to all users in the credential store.")
+	rebalanceStorageCmd.Flags().Bool(rebalanceDryRunFlag, false,
+		"Only print the users whose files are on other shards.")
+
+	// Errors are caused by the backends, so printing the usage does not help
+	rebalanceStorageCmd.SilenceUsage = true
+	rootCmd.AddCommand(rebalanceStorageCmd)
+}
+
+var rebalanceStorageCmd = &cobra.Command{
+	Use:   "rebalance-storage",
+	Short: "Moves users' files to their shard after shards are changed",
+	Long: "Moves the files of each user stored on other shards of the " +
+		"\"sharded\" backend to the shard they are placed on, such as after " +
+		"a shard was added or its weight changed. Each copy is read back and " +
+		"its SHA-256 checksum compared to the original before the original " +
+		"is deleted. Files already on the user's shard are kept, so an " +
+		"interrupted rebalance is resumed by rerunning the command. Stop the " +
+		"server or block writes while rebalancing, since files on other " +
+		"shards cannot be read by the server until they are moved.",
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		initConfig(configFilePath)
+		if backend := viper.GetString(storageBackendTag); backend !=
+			store.ShardedBackend {
+			return errors.Errorf("the storage backend is %q, not %q",
+				backend, store.ShardedBackend)
+		}
+		storageDir, err := utils.ExpandPath(viper.GetString(storageDirTag))
+		if err != nil {
+			return errors.Wrapf(err, "invalid %s", storageDirTag)
+		}
+		shards, err := store.OpenShards(
+			viper.GetStringMap(store.ShardedBackend))
+		if err != nil {
+			return errors.WithMessage(err, "failed to open shards")
+		}
+		users, err := migrationUsers(cmd)
+		if err != nil {
+			return err
+		}
+		dryRun, _ := cmd.Flags().GetBool(rebalanceDryRunFlag)
+
+		var total store.MigrationStats
+		var rebalanced int
+		for _, username := range users {
+			misplaced, err := shards.Misplaced(storageDir, username)
+			if err != nil {
+				return errors.WithMessagef(
+					err, "failed to check shards of %s", username)
+			} else if len(misplaced) == 0 {
+				continue
+			}
+			names := make([]string, len(misplaced))
+			for i, shard := range misplaced {
+				names[i] = shard.Name()
+			}
+			target := shards.Locate(username).Name()
+			rebalanced++
+			if dryRun {
+				fmt.Printf("%s: would move files from %s to %s\n",
+					username, strings.Join(names, ", "), target)
+				continue
+			}
+
+			stats, err := shards.Rebalance(storageDir, username)
+			total.Copied += stats.Copied
+			total.Skipped += stats.Skipped
+			total.Bytes += stats.Bytes
+			if err != nil {
+				return errors.Wrapf(err, "failed to rebalance %s; rerun the "+
+					"command to resume", username)
+			}
+			fmt.Printf("%s: moved %d files (%d bytes) from %s to %s, removed "+
+				"%d already moved\n", username, stats.Copied, stats.Bytes,
+				strings.Join(names, ", "), target, stats.Skipped)
+		}
+
+		if dryRun {
+			fmt.Printf("%d of %d users have files on other shards\n",
+				rebalanced, len(users))
+			return nil
+		}
+		fmt.Printf("Rebalanced %d of %d users: moved %d files (%d bytes), "+
+			"removed %d already moved\n", rebalanced, len(users),
+			total.Copied, total.Bytes, total.Skipped)
+		return nil
+	},
+}
@@ -0,0 +1,177 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+// Handles the registration administration subcommands
+
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+
+	"gitlab.com/elixxir/remoteSyncServer/rpc"
+)
+
+func init() {
+	addAdminFlags(registrationOpenCmd.Flags())
+	addAdminFlags(registrationCloseCmd.Flags())
+
+	for _, cmd := range []*cobra.Command{registrationPendingCmd,
+		registrationApproveCmd, registrationRejectCmd, registrationInviteCmd,
+		registrationOpenCmd, registrationCloseCmd} {
+		cmd.SilenceUsage = true
+		registrationCmd.AddCommand(cmd)
+	}
+	rootCmd.AddCommand(registrationCmd)
+}
+
+var registrationCmd = &cobra.Command{
+	Use:   "registration",
+	Short: "Manages the registration of new accounts",
+}
+
+var registrationPendingCmd = &cobra.Command{
+	Use:   "pending",
+	Short: "Lists all accounts awaiting approval",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		initConfig(configFilePath)
+		_, registrar, err := newRegistrar(nil)
+		if err != nil {
+			return err
+		}
+
+		usernames, err := registrar.ListPending()
+		if err != nil {
+			return err
+		}
+		for _, username := range usernames {
+			fmt.Println(username)
+		}
+		return nil
+	},
+}
+
+var registrationApproveCmd = &cobra.Command{
+	Use:   "approve <username>...",
+	Short: "Approves pending accounts so that they can log in",
+	Args:  cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		initConfig(configFilePath)
+		_, registrar, err := newRegistrar(nil)
+		if err != nil {
+			return err
+		}
+
+		for _, username := range args {
+			if err = registrar.Approve(username); err != nil {
+				return errors.Wrapf(err, "failed to approve %q", username)
+			}
+			fmt.Printf("Approved %s\n", username)
+		}
+		return nil
+	},
+}
+
+var registrationRejectCmd = &cobra.Command{
+	Use:   "reject <username>...",
+	Short: "Rejects and removes pending accounts",
+	Args:  cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		initConfig(configFilePath)
+		_, registrar, err := newRegistrar(nil)
+		if err != nil {
+			return err
+		}
+
+		for _, username := range args {
+			if err = registrar.Reject(username); err != nil {
+				return errors.Wrapf(err, "failed to reject %q", username)
+			}
+			fmt.Printf("Rejected %s\n", username)
+		}
+		return nil
+	},
+}
+
+var registrationInviteCmd = &cobra.Command{
+	Use:   "invite",
+	Short: "Creates a new single-use invite code",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		initConfig(configFilePath)
+		_, registrar, err := newRegistrar(nil)
+		if err != nil {
+			return err
+		}
+
+		code, err := registrar.CreateInvite()
+		if err != nil {
+			return err
+		}
+		fmt.Println(code)
+		return nil
+	},
+}
+
+var registrationOpenCmd = &cobra.Command{
+	Use:   "open",
+	Short: "Opens registrations to new accounts on a running server",
+	Long: "Opens registrations to new accounts on a running server using " +
+		"its admin API, as allowed by the registration mode. Registrations " +
+		"stay open until they are closed or the config is reloaded. The " +
+		"server's certificate and admin key are read from the config file.",
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return setRegistrationsOpen(cmd, true)
+	},
+}
+
+var registrationCloseCmd = &cobra.Command{
+	Use:   "close",
+	Short: "Closes registrations to new accounts on a running server",
+	Long: "Closes registrations to new accounts on a running server using " +
+		"its admin API, such as when it is at capacity. Register fails with " +
+		"RESOURCE_EXHAUSTED while existing users keep syncing. Registrations " +
+		"stay closed until they are opened or the config is reloaded. The " +
+		"server's certificate and admin key are read from the config file.",
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return setRegistrationsOpen(cmd, false)
+	},
+}
+
+// setRegistrationsOpen opens or closes registrations on the running server
+// with the SetRegistrationsOpen RPC and prints the change.
+func setRegistrationsOpen(cmd *cobra.Command, open bool) error {
+	initConfig(configFilePath)
+
+	client, ctx, cancel, err := dialAdmin(cmd)
+	if err != nil {
+		return err
+	}
+	defer cancel()
+
+	resp, err := client.SetRegistrationsOpen(
+		ctx, &rpc.RsSetRegistrationsOpenRequest{Open: open})
+	if err != nil {
+		return errors.Wrap(err, "failed to set registrations")
+	}
+	fmt.Printf("Registrations %s (were %s)\n",
+		openClosed(open), openClosed(resp.GetWasOpen()))
+	return nil
+}
+
+// openClosed returns "open" or "closed" for whether registrations are open.
+func openClosed(open bool) string {
+	if open {
+		return "open"
+	}
+	return "closed"
+}
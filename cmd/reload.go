@@ -0,0 +1,117 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+// Handles reloading the config of a running server, either in the server on
+// SIGHUP or the ReloadConfig RPC, or from the reload subcommand
+
+package cmd
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	jww "github.com/spf13/jwalterweatherman"
+	"github.com/spf13/viper"
+
+	"gitlab.com/elixxir/remoteSyncServer/rpc"
+	"gitlab.com/elixxir/remoteSyncServer/server"
+)
+
+func init() {
+	addAdminFlags(reloadCmd.Flags())
+
+	// Errors are caused by the server, so printing the usage does not help
+	reloadCmd.SilenceUsage = true
+	rootCmd.AddCommand(reloadCmd)
+}
+
+var reloadCmd = &cobra.Command{
+	Use:   "reload",
+	Short: "Reloads the config of a running server",
+	Long: "Tells a running server to reread its config file and apply the " +
+		"options that can change without a restart (logLevel, rateLimit, " +
+		"ipFilter, maintenance, and registrationsOpen) using its admin " +
+		"API, like sending it SIGHUP. Active connections are not " +
+		"interrupted. The server's certificate and admin key are read " +
+		"from the config file.",
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		initConfig(configFilePath)
+
+		client, ctx, cancel, err := dialAdmin(cmd)
+		if err != nil {
+			return err
+		}
+		defer cancel()
+
+		_, err = client.ReloadConfig(ctx, &rpc.RsReloadConfigRequest{})
+		if err != nil {
+			return errors.Wrap(err, "failed to reload config")
+		}
+		fmt.Println("Reloaded config")
+		return nil
+	},
+}
+
+// configReloader rereads the config file of the running server and applies
+// the options that can change without a restart: the log level, the rate
+// limits, the IP filter lists if the filter is enabled, maintenance mode, and
+// whether registrations are open.
+type configReloader struct {
+	filePath    string
+	limiter     *server.RateLimiter
+	ipFilter    *server.IPFilter
+	maintenance *server.Maintenance
+	registrar   *server.Registrar
+	mux         sync.Mutex
+}
+
+// reload rereads the config file and applies the reloadable options. If any
+// of them is invalid, none are applied. Other options are ignored until the
+// server is restarted.
+func (cr *configReloader) reload() error {
+	cr.mux.Lock()
+	defer cr.mux.Unlock()
+
+	if cr.filePath == "" {
+		return errors.New("the server was started without a config file")
+	}
+	if err := readConfig(cr.filePath); err != nil {
+		return errors.Wrapf(err, "failed to read config file %s", cr.filePath)
+	}
+
+	// The IP filter lists are checked before anything is changed, the rate
+	// limits are only updated if they are valid, and the log level cannot be
+	// invalid, so nothing is changed on error
+	ipFilterParams := viper.GetStringMap(ipFilterParamsTag)
+	if cr.ipFilter != nil {
+		if _, err := server.NewIPFilter(ipFilterParams); err != nil {
+			return errors.Wrap(err, "invalid IP filter")
+		}
+	} else if viper.IsSet(ipFilterParamsTag) {
+		jww.WARN.Printf("The IP filter was not enabled when the server " +
+			"started; restart the server to enable it.")
+	}
+	err := cr.limiter.Update(viper.GetStringMap(rateLimitParamsTag))
+	if err != nil {
+		return errors.Wrap(err, "invalid rate limit")
+	}
+	if cr.ipFilter != nil {
+		if err = cr.ipFilter.Update(ipFilterParams); err != nil {
+			return errors.Wrap(err, "invalid IP filter")
+		}
+	}
+	setLogThreshold(viper.GetUint(logLevelFlag))
+	cr.maintenance.Set(viper.GetBool(maintenanceTag))
+	cr.registrar.SetOpen(viper.GetBool(registrationsOpenTag))
+	warnUnknownConfigKeys()
+
+	jww.INFO.Printf("Reloaded config from %s.", cr.filePath)
+	return nil
+}
@@ -0,0 +1,154 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+// Handles the restore subcommand, which restores a backup to a running server
+// from its Admin service
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"google.golang.org/grpc/metadata"
+
+	"gitlab.com/elixxir/remoteSyncServer/rpc"
+	"gitlab.com/elixxir/remoteSyncServer/server"
+	"gitlab.com/xx_network/primitives/utils"
+)
+
+const (
+	restoreConflictFlag = "conflict"
+
+	// restoreChunkSize is the size of the parts of the backup sent in each
+	// request.
+	restoreChunkSize = 1 << 20
+)
+
+func init() {
+	addAdminFlags(restoreCmd.Flags())
+	restoreCmd.Flags().StringSlice(migrateUsersFlag, nil,
+		"Users whose accounts and files are restored. Defaults to all users "+
+			"in the backup.")
+	restoreCmd.Flags().String(restoreConflictFlag, server.RestoreOverwrite,
+		"How files and accounts that already exist are handled: \""+
+			server.RestoreOverwrite+"\", \""+server.RestoreSkip+"\", or \""+
+			server.RestoreKeepNewer+"\".")
+	restoreCmd.Flags().String(backupPassphraseFileFlag, "",
+		"File containing the passphrase the backup was encrypted with, if it "+
+			"is encrypted.")
+
+	// Errors are caused by the server or the files, so printing the usage does
+	// not help
+	restoreCmd.SilenceUsage = true
+	rootCmd.AddCommand(restoreCmd)
+}
+
+var restoreCmd = &cobra.Command{
+	Use:   "restore <backup>",
+	Short: "Restores a backup to a running server",
+	Long: "Restores the accounts and files of all users in a backup written " +
+		"by the backup command, or only of the users in --users, to a " +
+		"running server, using its admin API. With --conflict, files and " +
+		"accounts that already exist are overwritten, skipped, or only " +
+		"overwritten by files modified later (keep-newer). To restore an " +
+		"incremental backup, restore the full backup first and then each " +
+		"incremental backup in order. " +
+		"The server's certificate and admin key are read from the config file.",
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		initConfig(configFilePath)
+		users, _ := cmd.Flags().GetStringSlice(migrateUsersFlag)
+		conflict, _ := cmd.Flags().GetString(restoreConflictFlag)
+
+		path, err := utils.ExpandPath(args[0])
+		if err != nil {
+			return errors.Wrapf(err, "unable to expand path %s", args[0])
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			return errors.Wrapf(err, "failed to open %s", path)
+		}
+		defer func() { _ = f.Close() }()
+		var r io.Reader = f
+		if passphrasePath, _ := cmd.Flags().GetString(
+			backupPassphraseFileFlag); passphrasePath != "" {
+			passphrase, err := readPassphrase(passphrasePath)
+			if err != nil {
+				return err
+			}
+			if r, err = server.DecryptBackup(f, passphrase); err != nil {
+				return err
+			}
+		}
+
+		client, ctx, cancel, err := dialAdmin(cmd)
+		if err != nil {
+			return err
+		}
+		defer cancel()
+
+		// The restore can take longer than adminRequestTimeout, so only the
+		// metadata of the context is used
+		md, _ := metadata.FromOutgoingContext(ctx)
+		ctx = metadata.NewOutgoingContext(context.Background(), md)
+		resp, err := sendRestore(ctx, client, &rpc.RsRestoreRequest{
+			Users: users, Conflict: conflict}, r)
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("Restored %d files (%d bytes) and %d accounts; skipped %d "+
+			"existing\n", resp.GetFiles(), resp.GetBytes(), resp.GetUsers(),
+			resp.GetSkipped())
+		return nil
+	},
+}
+
+// sendRestore sends the backup read from r to the server in parts, the first
+// of which also contains the options of the request, and returns the response.
+// If reading the backup fails, the stream is canceled so that the server stops
+// restoring it.
+func sendRestore(ctx context.Context, client rpc.AdminClient,
+	req *rpc.RsRestoreRequest, r io.Reader) (*rpc.RsRestoreResponse, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	stream, err := client.Restore(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to start restore")
+	}
+
+	for {
+		// Each request gets its own buffer, since gRPC may use a message after
+		// sending it
+		buf := make([]byte, restoreChunkSize)
+		n, err := io.ReadFull(r, buf)
+		if err == io.EOF {
+			break
+		} else if err != nil && err != io.ErrUnexpectedEOF {
+			return nil, errors.Wrap(err, "failed to read backup")
+		}
+		req.Data = buf[:n]
+		if err = stream.Send(req); err == io.EOF {
+			// The server ended the stream; its error is returned below
+			break
+		} else if err != nil {
+			return nil, errors.Wrap(err, "failed to send backup")
+		}
+		req = &rpc.RsRestoreRequest{}
+	}
+
+	resp, err := stream.CloseAndRecv()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to restore backup")
+	}
+	return resp, nil
+}
@@ -0,0 +1,300 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+// Handles the revoke subcommands, which call the Admin service of a running
+// server
+
+package cmd
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+
+	"gitlab.com/elixxir/remoteSyncServer/rpc"
+	"gitlab.com/elixxir/remoteSyncServer/server"
+	"gitlab.com/xx_network/primitives/utils"
+)
+
+const (
+	adminAddressFlag    = "address"
+	adminClientCertFlag = "clientCert"
+	adminClientKeyFlag  = "clientKey"
+	adminAPIKeyFlag     = "apiKey"
+
+	// adminRequestTimeout is the maximum time to wait for an admin request.
+	adminRequestTimeout = 30 * time.Second
+)
+
+func init() {
+	addAdminFlags(revokeCmd.PersistentFlags())
+
+	// Errors are caused by the arguments or the server, so printing the usage
+	// does not help
+	for _, cmd := range []*cobra.Command{revokeTokenCmd, revokeUserCmd} {
+		cmd.SilenceUsage = true
+		revokeCmd.AddCommand(cmd)
+	}
+	rootCmd.AddCommand(revokeCmd)
+}
+
+var revokeCmd = &cobra.Command{
+	Use:   "revoke",
+	Short: "Revokes tokens on a running server",
+	Long: "Revokes tokens on a running server using its admin API. The " +
+		"server's certificate and admin key are read from the config file. " +
+		"An API key with the admin scope can be used instead of the admin key.",
+}
+
+var revokeTokenCmd = &cobra.Command{
+	Use:   "token <token>",
+	Short: "Revokes a single base64-encoded token",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		initConfig(configFilePath)
+		token, err := base64.StdEncoding.DecodeString(args[0])
+		if err != nil {
+			return errors.Wrap(err, "token must be base64 encoded")
+		}
+
+		client, ctx, cancel, err := dialAdmin(cmd)
+		if err != nil {
+			return err
+		}
+		defer cancel()
+
+		resp, err := client.RevokeToken(
+			ctx, &rpc.RsRevokeTokenRequest{Token: token})
+		if err != nil {
+			return errors.Wrap(err, "failed to revoke token")
+		}
+		fmt.Printf("Revoked token (active session ended: %t)\n",
+			resp.GetSessionEnded())
+		return nil
+	},
+}
+
+var revokeUserCmd = &cobra.Command{
+	Use:   "user <username>",
+	Short: "Revokes all tokens issued to a user",
+	Long: "Revokes all tokens issued to a user. The user can log in again " +
+		"unless they are also removed.",
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		initConfig(configFilePath)
+		username := args[0]
+
+		client, ctx, cancel, err := dialAdmin(cmd)
+		if err != nil {
+			return err
+		}
+		defer cancel()
+
+		resp, err := client.RevokeUser(
+			ctx, &rpc.RsRevokeUserRequest{Username: username})
+		if err != nil {
+			return errors.Wrapf(err, "failed to revoke tokens for %q", username)
+		}
+		fmt.Printf("Revoked all tokens for %s (active session ended: %t)\n",
+			username, resp.GetSessionEnded())
+		return nil
+	},
+}
+
+// addAdminFlags adds the flags used by dialAdmin to connect to the server.
+func addAdminFlags(flags *pflag.FlagSet) {
+	flags.String(adminAddressFlag, "",
+		"Address of the running server. Defaults to the admin listener, if "+
+			"configured, or else the first configured bind address, or "+
+			"localhost if it is unspecified, on the configured port.")
+	flags.String(adminClientCertFlag, "",
+		"Path to the client certificate to present when the server requires "+
+			"mTLS.")
+	flags.String(adminClientKeyFlag, "",
+		"Path to the key of the client certificate.")
+	flags.String(adminAPIKeyFlag, "",
+		"API key with the admin scope to use instead of the admin key.")
+}
+
+// dialAdmin connects to the Admin service of the server and returns a client
+// and a context containing the admin key or API key. If an admin listener is
+// configured, it connects to the listener without TLS and uses its key. The
+// connection is closed when the returned cancel function is called. The
+// command must have the flags added by addAdminFlags.
+func dialAdmin(cmd *cobra.Command) (
+	rpc.AdminClient, context.Context, context.CancelFunc, error) {
+	var listener *server.AdminListener
+	if viper.IsSet(adminListenerParamsTag) {
+		var err error
+		listener, err = server.NewAdminListener(
+			viper.GetStringMap(adminListenerParamsTag))
+		if err != nil {
+			return nil, nil, nil, errors.Wrap(err, "invalid admin listener")
+		}
+	}
+
+	adminKey, err := cmd.Flags().GetString(adminAPIKeyFlag)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if adminKey == "" && listener != nil {
+		adminKey = listener.Params().Key
+	} else if adminKey == "" {
+		adminKey = viper.GetString(adminKeyTag)
+	}
+	if adminKey == "" {
+		return nil, nil, nil, errors.Errorf(
+			"%s is not set and no API key was given", adminKeyTag)
+	}
+
+	address, err := cmd.Flags().GetString(adminAddressFlag)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if address == "" && listener != nil {
+		address = listener.Target()
+	} else if address == "" {
+		address = adminAddress()
+	}
+
+	creds := insecure.NewCredentials()
+	if listener == nil {
+		if creds, err = adminTransportCredentials(cmd); err != nil {
+			return nil, nil, nil, err
+		}
+	}
+	conn, err := grpc.Dial(address, grpc.WithTransportCredentials(creds))
+	if err != nil {
+		return nil, nil, nil, errors.Wrapf(err, "failed to dial %s", address)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), adminRequestTimeout)
+	ctx = metadata.AppendToOutgoingContext(
+		ctx, "authorization", "Bearer "+adminKey)
+
+	return rpc.NewAdminClient(conn), ctx, func() {
+		cancel()
+		_ = conn.Close()
+	}, nil
+}
+
+// adminAddress returns the address to reach the running server on: the first
+// listener that serves native gRPC, with localhost in place of the host if it
+// listens on all interfaces.
+func adminAddress() string {
+	fallback := net.JoinHostPort(
+		"localhost", strconv.Itoa(viper.GetInt(portTag)))
+	listeners, err := configListeners(nil)
+	if err != nil {
+		return fallback
+	}
+	for _, l := range listeners {
+		if !l.Serves(server.ProtocolGRPC) {
+			continue
+		}
+		host, port, err := net.SplitHostPort(l.Address)
+		if err != nil {
+			break
+		}
+		if ip := net.ParseIP(host); ip != nil && ip.IsUnspecified() {
+			host = "localhost"
+		}
+		return net.JoinHostPort(host, port)
+	}
+	return fallback
+}
+
+// adminTransportCredentials returns the credentials used to connect to the
+// server. They trust the server's certificate and present the client
+// certificate, if one is given, or use no TLS if the server does not.
+func adminTransportCredentials(
+	cmd *cobra.Command) (credentials.TransportCredentials, error) {
+	if viper.GetBool(insecureHTTPTag) {
+		return insecure.NewCredentials(), nil
+	}
+
+	var tlsConf *tls.Config
+	if viper.IsSet(acmeParamsTag) {
+		// ACME certificates are trusted by the system roots but are only
+		// valid for the configured domains
+		domains := viper.GetStringSlice(acmeParamsTag + ".domains")
+		if len(domains) == 0 {
+			return nil, errors.New("no ACME domains configured")
+		}
+		tlsConf = &tls.Config{ServerName: domains[0]}
+	} else {
+		var err error
+		tlsConf, err = serverTLSConfig(viper.GetString(signedCertPathTag))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if err := addClientCertificate(cmd, tlsConf); err != nil {
+		return nil, err
+	}
+
+	return credentials.NewTLS(tlsConf), nil
+}
+
+// addClientCertificate adds the client certificate in the flags of the
+// command, if one is given, to the TLS config.
+func addClientCertificate(cmd *cobra.Command, tlsConf *tls.Config) error {
+	clientCert, _ := cmd.Flags().GetString(adminClientCertFlag)
+	clientKey, _ := cmd.Flags().GetString(adminClientKeyFlag)
+	if clientCert != "" || clientKey != "" {
+		keyPair, err := tls.LoadX509KeyPair(clientCert, clientKey)
+		if err != nil {
+			return errors.Wrap(err, "failed to load client certificate")
+		}
+		tlsConf.Certificates = []tls.Certificate{keyPair}
+	}
+	return nil
+}
+
+// serverTLSConfig returns a TLS config that trusts the server's certificate at
+// the path. The server name is taken from the certificate so that connecting
+// by IP address or localhost works.
+func serverTLSConfig(certPath string) (*tls.Config, error) {
+	certPem, err := utils.ReadFile(certPath)
+	if err != nil {
+		return nil, errors.Wrapf(err,
+			"failed to read certificate from path %s", certPath)
+	}
+	block, _ := pem.Decode(certPem)
+	if block == nil {
+		return nil, errors.Errorf("no PEM data in certificate %s", certPath)
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to parse certificate %s", certPath)
+	}
+
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	serverName := cert.Subject.CommonName
+	if len(cert.DNSNames) > 0 {
+		serverName = cert.DNSNames[0]
+	}
+
+	return &tls.Config{RootCAs: pool, ServerName: serverName}, nil
+}
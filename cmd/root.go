@@ -8,37 +8,142 @@
 package cmd
 
 import (
-	"encoding/csv"
+	"context"
+	"crypto/tls"
+	"database/sql"
 	"fmt"
 	"io"
 	"log"
 	"net"
 	"os"
+	"os/signal"
 	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
 
+	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
 	jww "github.com/spf13/jwalterweatherman"
 	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
 
+	"gitlab.com/elixxir/remoteSyncServer/credentials"
+	"gitlab.com/elixxir/remoteSyncServer/logging"
 	"gitlab.com/elixxir/remoteSyncServer/server"
+	"gitlab.com/elixxir/remoteSyncServer/storage"
+	"gitlab.com/elixxir/remoteSyncServer/store"
 	"gitlab.com/xx_network/primitives/id"
 	"gitlab.com/xx_network/primitives/utils"
 )
 
 var configFilePath string
 
+// envPrefix is the prefix of environment variables that set config options.
+const envPrefix = "REMOTE_SYNC_"
+
 const (
-	logPathFlag  = "logPath"
-	logLevelFlag = "logLevel"
+	logPathFlag   = "logPath"
+	logLevelFlag  = "logLevel"
+	logFormatFlag = "logFormat"
+	pidFileFlag   = "pidFile"
+	userFlag      = "user"
+	groupFlag     = "group"
+	daemonFlag    = "daemon"
 
 	signedCertPathTag = "signedCertPath"
 	signedKeyPathTag  = "signedKeyPath"
+	signedKeyTag      = "signedKey"
 	portTag           = "port"
+	bindAddressTag    = "bindAddress"
+	listenersTag      = "listeners"
+
+	additionalCertificatesTag = "additionalCertificates"
+
+	tokenTtlTag           = "tokenTTL"
+	credentialsPathTag    = "credentialsCsvPath"
+	credentialsBackendTag = "credentialsBackend"
+	storageDirTag         = "storageDir"
+	storageBackendTag     = "storageBackend"
+	storagePoolTag        = "storagePool"
+	redisAddrTag          = "redisAddr"
+	redisParamsTag        = "redis"
+	memoryCacheTag        = "memoryCache"
+	indexTag              = "index"
+	scrubParamsTag        = "scrub"
+	versioningTag         = "versioning"
+	encryptionTag         = "encryption"
+	compressionTag        = "compression"
+	dedupTag              = "dedup"
+	trackMetadataTag      = "trackMetadata"
+	gcParamsTag           = "gc"
+	uploadsParamsTag      = "uploads"
+	deltaParamsTag        = "delta"
+	changesParamsTag      = "changes"
+	webdavParamsTag       = "webdav"
+	linksParamsTag        = "links"
+	journalParamsTag      = "journal"
+	clusterParamsTag      = "cluster"
+	replicationParamsTag  = "replication"
+	migrationParamsTag    = "migration"
 
-	tokenTtlTag        = "tokenTTL"
-	credentialsPathTag = "credentialsCsvPath"
-	storageDirTag      = "storageDir"
+	passwordHashingTag     = "passwordHashing"
+	argon2ParamsTag        = "argon2id"
+	oidcParamsTag          = "oidc"
+	mtlsParamsTag          = "mtls"
+	acmeParamsTag          = "acme"
+	tlsMinVersionTag       = "tlsMinVersion"
+	tlsCipherSuitesTag     = "tlsCipherSuites"
+	insecureHTTPTag        = "insecureHttp"
+	trustedProxiesTag      = "trustedProxies"
+	listenerHandoffTag     = "listenerHandoff"
+	grpcReflectionTag      = "grpcReflection"
+	ocspParamsTag          = "ocsp"
+	certExpiryParamsTag    = "certExpiry"
+	httpsParamsTag         = "https"
+	rateLimitParamsTag     = "rateLimit"
+	concurrencyParamsTag   = "concurrency"
+	ipFilterParamsTag      = "ipFilter"
+	autoBanParamsTag       = "autoBan"
+	loginThrottleParamsTag = "loginThrottle"
+	maxObjectBytesTag      = "maxObjectBytes"
+	maxRequestBytesTag     = "maxRequestBytes"
+	grpcParamsTag          = "grpc"
+	httpLimitsParamsTag    = "httpLimits"
+	webSecurityParamsTag   = "webSecurity"
+	secretsParamsTag       = "secrets"
+	configKeyTag           = "configKey"
+	configKeyPathTag       = "configKeyPath"
+	maintenanceTag         = "maintenance"
+	metricsParamsTag       = "metrics"
+	healthParamsTag        = "health"
+	startupParamsTag       = "startup"
+	tracingParamsTag       = "tracing"
+	auditParamsTag         = "audit"
+	accessLogParamsTag     = "accessLog"
+	errorReportParamsTag   = "errorReporting"
+	registrationModeTag    = "registrationMode"
+	registrationsOpenTag   = "registrationsOpen"
+	pendingUsersCsvPathTag = "registrationPendingCsvPath"
+	invitesCsvPathTag      = "registrationInvitesCsvPath"
+	revocationListPathTag  = "revocationListPath"
+	adminKeyTag            = "adminKey"
+	adminListenerParamsTag = "adminListener"
+	userPoliciesPathTag    = "userPoliciesPath"
+	apiKeysEnabledTag      = "apiKeysEnabled"
+	apiKeysCsvPathTag      = "apiKeysCsvPath"
+	knownUsersCsvPathTag   = "knownUsersCsvPath"
+
+	defaultTokenTTL            = 24 * time.Hour
+	defaultStorageDir          = "~/syncServer"
+	defaultBindAddress         = "0.0.0.0"
+	defaultPendingUsersCsvPath = "~/pendingUsers.csv"
+	defaultInvitesCsvPath      = "~/invites.csv"
+	defaultRevocationListPath  = "~/revoked.json"
+	defaultUserPoliciesPath    = "~/userPolicies.json"
+	defaultAPIKeysCsvPath      = "~/apiKeys.csv"
+	defaultKnownUsersCsvPath   = "~/knownUsers.csv"
 )
 
 // Execute initialises all config files, flags, and logging and then starts the
@@ -55,92 +160,1187 @@ var rootCmd = &cobra.Command{
 	Short: "remoteSyncServer starts a secure remote sync server for Haven",
 	Run: func(cmd *cobra.Command, args []string) {
 		initConfig(configFilePath)
-		initLog(viper.GetString(logPathFlag), viper.GetUint(logLevelFlag))
+
+		// Optionally continue in a background process detached from the
+		// terminal. This process exits once the background one is serving.
+		daemon, err := daemonize(
+			viper.GetBool(daemonFlag), viper.GetString(logPathFlag))
+		if err != nil {
+			jww.FATAL.Panicf("Failed to run in the background: %+v", err)
+		}
+
+		initLog(viper.GetString(logPathFlag), viper.GetString(logFormatFlag),
+			viper.GetUint(logLevelFlag))
+
+		// When started by the Windows service control manager, report the
+		// status of the server to it and write the log to the event log. It
+		// stops the server with an interrupt.
+		signals := make(chan os.Signal, 1)
+		service, err := startService(signals)
+		if err != nil {
+			jww.FATAL.Panicf("Failed to start Windows service: %+v", err)
+		}
+		var logListeners []jww.LogListener
+		if service != nil {
+			logListeners = append(logListeners, service.LogListener)
+			jww.SetLogListeners(logListeners...)
+		}
+
 		jww.INFO.Printf(Version())
+		warnUnknownConfigKeys()
+
+		// Optionally report errors and crashes to a Sentry-compatible service.
+		// Set up first so that failures to start are reported.
+		var reporter *server.ErrorReporter
+		if viper.IsSet(errorReportParamsTag) {
+			reporter, err = newErrorReporter()
+			if err != nil {
+				jww.FATAL.Panicf("Invalid error reporting: %+v", err)
+			}
+			logListeners = append(logListeners, reporter.LogListener)
+			jww.SetLogListeners(logListeners...)
+			defer reporter.Recover()
+			jww.INFO.Printf("Error reporting enabled.")
+		}
 
 		// Obtain parameters
 		signedCertPath := viper.GetString(signedCertPathTag)
-		signedKeyPath := viper.GetString(signedKeyPathTag)
-		storageDir := viper.GetString(storageDirTag)
+		storageDir, err := utils.ExpandPath(viper.GetString(storageDirTag))
+		if err != nil {
+			jww.FATAL.Panicf("Invalid storage directory %q: %+v",
+				viper.GetString(storageDirTag), err)
+		}
+		storageBackend := viper.GetString(storageBackendTag)
 		tokenTTL := viper.GetDuration(tokenTtlTag)
-		credentialsCsvPath := viper.GetString(credentialsPathTag)
-		localAddress :=
-			net.JoinHostPort("0.0.0.0", strconv.Itoa(viper.GetInt(portTag)))
+		account, err := lookupAccount(
+			viper.GetString(userFlag), viper.GetString(groupFlag))
+		if err != nil {
+			jww.FATAL.Panicf("Invalid user or group: %+v", err)
+		}
+
+		// Obtain certs, either from an ACME CA or from the configured files.
+		// No certs are needed when a reverse proxy terminates TLS.
+		insecureHTTP := viper.GetBool(insecureHTTPTag)
+		var acme *server.ACMEManager
+		var signedCert, signedKey []byte
+		if viper.IsSet(acmeParamsTag) {
+			acme, err = server.NewACMEManager(viper.GetStringMap(acmeParamsTag))
+			if err != nil {
+				jww.FATAL.Panicf("Failed to initialise ACME: %+v", err)
+			}
+			jww.INFO.Printf("ACME certificate management enabled.")
+		} else if !insecureHTTP {
+			signedCert, err = utils.ReadFile(signedCertPath)
+			if err != nil {
+				jww.FATAL.Panicf("Failed to read certificate from path %s: %+v",
+					signedCertPath, err)
+			}
+			if signedKey, err = readSignedKey(); err != nil {
+				jww.FATAL.Panicf("Failed to read key: %+v", err)
+			}
+		}
+
+		// Optionally serve other certificates to clients that request their
+		// names with SNI
+		var additionalCerts []tls.Certificate
+		if viper.IsSet(additionalCertificatesTag) {
+			additionalCerts, err = server.LoadCertificates(
+				viper.Get(additionalCertificatesTag))
+			if err != nil {
+				jww.FATAL.Panicf("Failed to load additional certificates: %+v",
+					err)
+			}
+			jww.INFO.Printf("Serving %d additional certificates by SNI.",
+				len(additionalCerts))
+		}
+
+		// Optionally restrict the TLS versions and cipher suites
+		var tlsSettings *server.TLSSettings
+		if viper.IsSet(tlsMinVersionTag) || viper.IsSet(tlsCipherSuitesTag) {
+			tlsSettings, err = server.NewTLSSettings(
+				viper.GetString(tlsMinVersionTag),
+				viper.GetStringSlice(tlsCipherSuitesTag))
+			if err != nil {
+				jww.FATAL.Panicf("Invalid TLS settings: %+v", err)
+			}
+		}
+
+		// Optionally staple OCSP responses to the certificate
+		var ocspStapler *server.OCSPStapler
+		if viper.IsSet(ocspParamsTag) {
+			ocspStapler, err = server.NewOCSPStapler(
+				viper.GetStringMap(ocspParamsTag))
+			if err != nil {
+				jww.FATAL.Panicf("Failed to initialise OCSP stapling: %+v", err)
+			}
+			jww.INFO.Printf("OCSP stapling enabled.")
+		}
+
+		// Warn as the certificates approach expiry. There are none to monitor
+		// when a reverse proxy terminates TLS.
+		var certExpiry *server.CertExpiryMonitor
+		if !insecureHTTP {
+			certExpiry, err = server.NewCertExpiryMonitor(
+				viper.GetStringMap(certExpiryParamsTag))
+			if err != nil {
+				jww.FATAL.Panicf("Invalid certificate expiry monitoring: %+v",
+					err)
+			}
+		}
+
+		// Optionally use the client addresses forwarded by reverse proxies
+		var proxies *server.TrustedProxies
+		if viper.IsSet(trustedProxiesTag) {
+			proxies, err = server.NewTrustedProxies(
+				viper.GetStringSlice(trustedProxiesTag))
+			if err != nil {
+				jww.FATAL.Panicf("Invalid trusted proxies: %+v", err)
+			}
+		}
+
+		// Optionally record metrics and serve them for Prometheus
+		var metrics *server.Metrics
+		if viper.IsSet(metricsParamsTag) {
+			metrics, err = server.NewMetrics(
+				viper.GetStringMap(metricsParamsTag))
+			if err != nil {
+				jww.FATAL.Panicf("Invalid metrics: %+v", err)
+			}
+			jww.INFO.Printf("Metrics enabled.")
+		}
+
+		// Optionally serve liveness and readiness checks
+		var health *server.Health
+		if viper.IsSet(healthParamsTag) {
+			health, err = server.NewHealth(viper.GetStringMap(healthParamsTag))
+			if err != nil {
+				jww.FATAL.Panicf("Invalid health checks: %+v", err)
+			}
+			jww.INFO.Printf("Health checks enabled.")
+		}
+
+		// Optionally serve on the sockets passed by the previous process on
+		// an upgrade and pass them to the next one
+		var handoff *server.Handoff
+		if viper.GetBool(listenerHandoffTag) {
+			handoff, err = server.NewHandoff()
+			if err != nil {
+				jww.FATAL.Panicf("Failed to use sockets from the previous "+
+					"process: %+v", err)
+			}
+			if handoff.Inherited() {
+				jww.INFO.Printf("Using sockets from the previous process.")
+			}
+		}
+
+		// Optionally retry the credential stores and storage backend with
+		// backoff while they start, such as in a Kubernetes pod, instead of
+		// exiting. Health checks are served meanwhile so that the server is
+		// live but not ready.
+		var startup *server.Startup
+		if viper.IsSet(startupParamsTag) {
+			startup, err = server.NewStartup(
+				viper.GetStringMap(startupParamsTag))
+			if err != nil {
+				jww.FATAL.Panicf("Invalid startup: %+v", err)
+			}
+			if health != nil {
+				if err = health.ServeStartup(startup, handoff); err != nil {
+					jww.FATAL.Panicf("Failed to serve health checks: %+v", err)
+				}
+			}
+		}
 
-		// Obtain certs
-		signedCert, err := utils.ReadFile(signedCertPath)
+		// Optionally trace RPCs and storage operations with OpenTelemetry
+		var tracing *server.Tracing
+		if viper.IsSet(tracingParamsTag) {
+			tracing, err = server.NewTracing(
+				viper.GetStringMap(tracingParamsTag), SEMVER)
+			if err != nil {
+				jww.FATAL.Panicf("Invalid tracing: %+v", err)
+			}
+			jww.INFO.Printf("Tracing enabled; exporting spans to %s.",
+				viper.GetString(tracingParamsTag+".endpoint"))
+		}
+
+		// Optionally log a line for each request
+		var accessLog *server.AccessLog
+		if viper.IsSet(accessLogParamsTag) {
+			accessLog, err = server.NewAccessLog(
+				viper.GetStringMap(accessLogParamsTag))
+			if err != nil {
+				jww.FATAL.Panicf("Invalid access log: %+v", err)
+			}
+			jww.INFO.Printf("Access log enabled.")
+		}
+
+		// Optionally record every sync operation in the audit log
+		var audit *server.AuditLog
+		if viper.IsSet(auditParamsTag) {
+			audit, err = server.NewAuditLog(viper.GetStringMap(auditParamsTag))
+			if err != nil {
+				jww.FATAL.Panicf("Invalid audit log: %+v", err)
+			}
+			jww.INFO.Printf("Recording sync operations in audit log %s.",
+				viper.GetString(auditParamsTag+".path"))
+		}
+
+		// Open the credential stores
+		hasher, err := newPasswordHasher()
+		if err != nil {
+			jww.FATAL.Panicf("Invalid password hashing: %+v", err)
+		}
+		var users credentials.Store
+		var registrar *server.Registrar
+		err = startup.Wait("credentials", func() (err error) {
+			users, registrar, err = newRegistrar(hasher)
+			return err
+		})
 		if err != nil {
-			jww.FATAL.Panicf("Failed to read certificate from path %s: %+v",
-				signedCertPath, err)
+			jww.FATAL.Panicf("Failed to open credential store: %+v", err)
 		}
-		signedKey, err := utils.ReadFile(signedKeyPath)
+		var knownUsers *server.KnownUsers
+		err = startup.Wait("known users", func() (err error) {
+			knownUsers, err = newKnownUsers()
+			return err
+		})
 		if err != nil {
-			jww.FATAL.Panicf("Failed to read key from path %s: %+v",
-				signedKeyPath, err)
+			jww.FATAL.Panicf("Failed to open known user store: %+v", err)
 		}
+		jww.INFO.Printf("Registration mode is %q.",
+			viper.GetString(registrationModeTag))
 
-		// Obtain credentials from CSV
-		csvPath, err := utils.ExpandPath(credentialsCsvPath)
+		// Registrations can be closed to new accounts by reloading the config
+		// or with the SetRegistrationsOpen RPC
+		registrar.SetOpen(viper.GetBool(registrationsOpenTag))
+
+		// Optionally authenticate users with an OpenID Connect provider
+		var oidcAuth *server.OIDCAuthenticator
+		if viper.IsSet(oidcParamsTag) {
+			oidcAuth, err = server.NewOIDCAuthenticator(
+				context.Background(), viper.GetStringMap(oidcParamsTag))
+			if err != nil {
+				jww.FATAL.Panicf("Failed to initialise OIDC: %+v", err)
+			}
+			jww.INFO.Printf("OIDC login enabled.")
+		}
+
+		// Optionally require clients to present a certificate
+		var mtls *server.MTLSAuthenticator
+		if viper.IsSet(mtlsParamsTag) {
+			mtls, err = server.NewMTLSAuthenticator(
+				viper.GetStringMap(mtlsParamsTag))
+			if err != nil {
+				jww.FATAL.Panicf("Failed to initialise mTLS: %+v", err)
+			}
+			jww.INFO.Printf("mTLS client authentication enabled.")
+		}
+
+		// Optionally limit the rate of requests from each client. The limiter
+		// is used even without limits so that they can be added by reloading
+		// the config.
+		limiter, err := server.NewRateLimiter(
+			viper.GetStringMap(rateLimitParamsTag))
 		if err != nil {
-			jww.FATAL.Panicf("Unable to expand path %s: %+v",
-				credentialsCsvPath, err)
+			jww.FATAL.Panicf("Invalid rate limit: %+v", err)
+		}
+		if viper.IsSet(rateLimitParamsTag) {
+			jww.INFO.Printf("Rate limiting enabled.")
+		}
+
+		// Optionally limit the number of connections and requests in progress
+		var concurrency *server.ConcurrencyLimiter
+		if viper.IsSet(concurrencyParamsTag) {
+			concurrency, err = server.NewConcurrencyLimiter(
+				viper.GetStringMap(concurrencyParamsTag))
+			if err != nil {
+				jww.FATAL.Panicf("Invalid concurrency limits: %+v", err)
+			}
+			p := concurrency.Params()
+			jww.INFO.Printf("Maximum %s connections, %s requests per user, "+
+				"%s storage operations.", formatCount(p.MaxConnections),
+				formatCount(p.MaxUserRequests), formatCount(p.MaxStorageOps))
+		}
+
+		// Optionally only accept connections from allowed addresses
+		var ipFilter *server.IPFilter
+		if viper.IsSet(ipFilterParamsTag) {
+			ipFilter, err = server.NewIPFilter(
+				viper.GetStringMap(ipFilterParamsTag))
+			if err != nil {
+				jww.FATAL.Panicf("Invalid IP filter: %+v", err)
+			}
+			allow, deny := ipFilter.Lists()
+			jww.INFO.Printf("IP filtering enabled with %d allowed and %d "+
+				"denied networks.", len(allow), len(deny))
+		}
+
+		// Optionally ban the addresses of clients with too many failures
+		var autoBan *server.AutoBan
+		if viper.IsSet(autoBanParamsTag) {
+			autoBan, err = server.NewAutoBan(
+				viper.GetStringMap(autoBanParamsTag))
+			if err != nil {
+				jww.FATAL.Panicf("Invalid automatic banning: %+v", err)
+			}
+			p := autoBan.Params()
+			jww.INFO.Printf("Automatic banning enabled for %s after %d "+
+				"authentication failures or %d malformed requests in %s "+
+				"(0 is no limit).", p.BanDuration, p.MaxAuthFailures,
+				p.MaxMalformedRequests, p.Window)
+		}
+
+		// Optionally slow down and lock out guessing of account passwords
+		var loginThrottle *server.LoginThrottle
+		if viper.IsSet(loginThrottleParamsTag) {
+			loginThrottle, err = server.NewLoginThrottle(
+				viper.GetStringMap(loginThrottleParamsTag))
+			if err != nil {
+				jww.FATAL.Panicf("Invalid login throttling: %+v", err)
+			}
+			jww.INFO.Printf("Login throttling: %+v", loginThrottle.Params())
+		}
+
+		// Optionally limit the size of files and requests
+		var limits *server.Limits
+		if viper.IsSet(maxObjectBytesTag) || viper.IsSet(maxRequestBytesTag) {
+			limits, err = server.NewLimits(viper.GetInt64(maxObjectBytesTag),
+				viper.GetInt64(maxRequestBytesTag))
+			if err != nil {
+				jww.FATAL.Panicf("Invalid size limits: %+v", err)
+			}
+			jww.INFO.Printf("Maximum file size %s, maximum request size %s.",
+				formatLimit(limits.MaxObjectBytes),
+				formatLimit(limits.MaxRequestBytes))
 		}
-		f, err := os.Open(csvPath)
+
+		// Optionally tune the keepalives, streams, windows, and message sizes
+		// of gRPC connections
+		var grpcSettings *server.GRPCSettings
+		if viper.IsSet(grpcParamsTag) {
+			grpcSettings, err = server.NewGRPCSettings(
+				viper.GetStringMap(grpcParamsTag))
+			if err != nil {
+				jww.FATAL.Panicf("Invalid gRPC settings: %+v", err)
+			}
+			jww.INFO.Printf("gRPC settings: %+v", grpcSettings.Params())
+		}
+
+		// Optionally limit the headers, bodies, and duration of HTTP requests
+		var httpLimits *server.HTTPLimits
+		if viper.IsSet(httpLimitsParamsTag) {
+			httpLimits, err = server.NewHTTPLimits(
+				viper.GetStringMap(httpLimitsParamsTag))
+			if err != nil {
+				jww.FATAL.Panicf("Invalid HTTP limits: %+v", err)
+			}
+			jww.INFO.Printf("HTTP limits: %+v", httpLimits.Params())
+		}
+
+		// Optionally restrict the origins of browser clients and set security
+		// headers on the responses
+		var webSecurity *server.WebSecurity
+		if viper.IsSet(webSecurityParamsTag) {
+			webSecurity, err = server.NewWebSecurity(
+				viper.GetStringMap(webSecurityParamsTag))
+			if err != nil {
+				jww.FATAL.Panicf("Invalid web security: %+v", err)
+			}
+			jww.INFO.Printf("Web security: %+v", webSecurity.Params())
+		}
+
+		// Maintenance mode can be changed by reloading the config or with the
+		// SetMaintenance RPC
+		maintenance := server.NewMaintenance(viper.GetBool(maintenanceTag))
+		if maintenance.Enabled() {
+			jww.INFO.Printf("Maintenance mode enabled; rejecting writes.")
+		}
+		reloader := &configReloader{filePath: configFilePath, limiter: limiter,
+			ipFilter: ipFilter, maintenance: maintenance, registrar: registrar}
+
+		// Load revoked tokens so that they stay revoked across restarts
+		revoked, err := server.NewRevocationList(
+			viper.GetString(revocationListPathTag))
 		if err != nil {
-			jww.FATAL.Panicf("Unable to read input file %s: %+v",
-				csvPath, err)
+			jww.FATAL.Panicf("Failed to load revocation list: %+v", err)
 		}
-		records, err := csv.NewReader(f).ReadAll()
+		adminKey := viper.GetString(adminKeyTag)
+
+		// Optionally serve the Admin service only on its own listener
+		var adminListener *server.AdminListener
+		if viper.IsSet(adminListenerParamsTag) {
+			adminListener, err = server.NewAdminListener(
+				viper.GetStringMap(adminListenerParamsTag))
+			if err != nil {
+				jww.FATAL.Panicf("Invalid admin listener: %+v", err)
+			}
+			jww.INFO.Printf("Admin service only served on %s.",
+				adminListener.Target())
+		}
+
+		// Load the quotas and bans of users so that they survive restarts
+		policies, err := server.NewUserPolicies(
+			viper.GetString(userPoliciesPathTag))
 		if err != nil {
-			jww.FATAL.Panicf("Unable to parse file as CSV for %s: %+v",
-				credentialsCsvPath, err)
+			jww.FATAL.Panicf("Failed to load user policies: %+v", err)
+		}
+
+		// Optionally allow clients to log in with scoped API keys
+		var apiKeys *server.APIKeys
+		if viper.GetBool(apiKeysEnabledTag) {
+			err = startup.Wait("API keys", func() (err error) {
+				apiKeys, err = newAPIKeys()
+				return err
+			})
+			if err != nil {
+				jww.FATAL.Panicf("Failed to open API key store: %+v", err)
+			}
+			jww.INFO.Printf("API keys enabled.")
+		}
+		if adminKey == "" && apiKeys == nil && adminListener == nil {
+			jww.INFO.Printf("Admin API disabled; no admin key set.")
+		}
+
+		// Initialise the storage backend using its backend-specific parameters
+		backend, err := storage.GetBackend(storageBackend)
+		if err != nil {
+			jww.FATAL.Panicf("Invalid storage backend (available: %s): %+v",
+				strings.Join(storage.Backends(), ", "), err)
+		}
+		var newStore store.NewStore
+		err = startup.Wait("storage", func() (err error) {
+			newStore, err = backend(viper.GetStringMap(storageBackend))
+			return err
+		})
+		if err != nil {
+			jww.FATAL.Panicf("Failed to initialise storage backend %q: %+v",
+				storageBackend, err)
+		}
+		jww.INFO.Printf("Using storage backend %q.", storageBackend)
+
+		// Optionally run the operations of the backend on a bounded worker
+		// pool, directly over the backend so that all layers above it wait
+		// for a worker before reaching it
+		if viper.IsSet(storagePoolTag) {
+			newStore, err = store.NewPooledStore(
+				viper.GetStringMap(storagePoolTag), newStore)
+			if err != nil {
+				jww.FATAL.Panicf("Invalid storage worker pool: %+v", err)
+			}
+			jww.INFO.Printf("Storage operations run on a worker pool.")
+		}
+
+		// Optionally store a checksum with each file, directly over the
+		// backend, and verify all stored files in the background
+		var scrubber *server.Scrubber
+		if viper.IsSet(scrubParamsTag) {
+			scrubber, err = server.NewScrubber(
+				viper.GetStringMap(scrubParamsTag))
+			if err != nil {
+				jww.FATAL.Panicf("Invalid scrubbing: %+v", err)
+			}
+			newStore = scrubber.Checksum(newStore)
+			jww.INFO.Printf("Scrubbing stored files every %s.",
+				scrubber.Params().Interval)
+		}
+
+		// Optionally cache metadata in Redis
+		if redisAddr := viper.GetString(redisAddrTag); redisAddr != "" {
+			newStore, err = store.NewRedisCache(
+				redisAddr, viper.GetStringMap(redisParamsTag), newStore)
+			if err != nil {
+				jww.FATAL.Panicf("Failed to initialise Redis cache: %+v", err)
+			}
+		}
+
+		// Optionally cache hot files and modification times in memory, in
+		// front of Redis
+		if viper.IsSet(memoryCacheTag) {
+			newStore, err = store.NewMemoryCache(
+				viper.GetStringMap(memoryCacheTag), newStore)
+			if err != nil {
+				jww.FATAL.Panicf("Invalid memory cache: %+v", err)
+			}
+		}
+
+		// Optionally encrypt files at rest. Versions are encrypted with the
+		// files, and the cache only holds encrypted data.
+		if viper.IsSet(encryptionTag) {
+			newStore, err = store.NewEncryptedStore(
+				viper.GetStringMap(encryptionTag), newStore)
+			if err != nil {
+				jww.FATAL.Panicf("Failed to initialise encryption: %+v", err)
+			}
+		}
+
+		// Optionally compress files, before they are encrypted
+		if viper.IsSet(compressionTag) {
+			newStore, err = store.NewCompressedStore(
+				viper.GetStringMap(compressionTag), newStore)
+			if err != nil {
+				jww.FATAL.Panicf("Failed to initialise compression: %+v", err)
+			}
+		}
+
+		// Optionally store identical files only once
+		if viper.IsSet(dedupTag) {
+			newStore, err = store.NewDedupStore(
+				viper.GetStringMap(dedupTag), newStore)
+			if err != nil {
+				jww.FATAL.Panicf("Failed to initialise deduplication: %+v",
+					err)
+			}
+		}
+
+		// Optionally record the metadata of files. Previous versions are
+		// stored without metadata.
+		if viper.GetBool(trackMetadataTag) {
+			newStore = store.NewMetadataStore(newStore)
+		}
+
+		// Optionally keep previous versions of files
+		if viper.IsSet(versioningTag) {
+			newStore, err = store.NewVersionedStore(
+				viper.GetStringMap(versioningTag), newStore)
+			if err != nil {
+				jww.FATAL.Panicf("Failed to initialise versioning: %+v", err)
+			}
+		}
+
+		// Optionally index the files of each user in memory, over all other
+		// layers so that it only holds the files clients see
+		var index *store.Index
+		if viper.IsSet(indexTag) {
+			index, err = store.NewIndex(viper.GetStringMap(indexTag), newStore)
+			if err != nil {
+				jww.FATAL.Panicf("Invalid index: %+v", err)
+			}
+			newStore = index.NewStore
+		}
+
+		// Optionally remove files in the background according to the
+		// retention policies
+		var gc *server.GarbageCollector
+		if viper.IsSet(gcParamsTag) {
+			gc, err = server.NewGarbageCollector(
+				viper.GetStringMap(gcParamsTag))
+			if err != nil {
+				jww.FATAL.Panicf("Invalid garbage collection: %+v", err)
+			}
+			jww.INFO.Printf("Garbage collection enabled with policies %s.",
+				strings.Join(gc.Policies(), ", "))
+		}
+
+		// Optionally accept large files in resumable chunks
+		var uploads *server.Uploads
+		if viper.IsSet(uploadsParamsTag) {
+			uploads, err = server.NewUploads(
+				viper.GetStringMap(uploadsParamsTag))
+			if err != nil {
+				jww.FATAL.Panicf("Invalid resumable uploads: %+v", err)
+			}
+			jww.INFO.Printf("Resumable uploads enabled for files up to %s.",
+				formatBytes(uploads.Params().MaxSize))
+		}
+
+		// Optionally update files from deltas of their stored data
+		var delta *server.Delta
+		if viper.IsSet(deltaParamsTag) {
+			delta, err = server.NewDelta(viper.GetStringMap(deltaParamsTag))
+			if err != nil {
+				jww.FATAL.Panicf("Invalid delta sync: %+v", err)
+			}
+			jww.INFO.Printf("Delta sync enabled for files up to %s.",
+				formatBytes(delta.Params().MaxSize))
+		}
+
+		// Optionally push the changes to the files of each user to their
+		// clients
+		var changes *server.ChangeFeed
+		if viper.IsSet(changesParamsTag) {
+			changes, err = server.NewChangeFeed(
+				viper.GetStringMap(changesParamsTag))
+			if err != nil {
+				jww.FATAL.Panicf("Invalid change notifications: %+v", err)
+			}
+			jww.INFO.Printf("Change notifications enabled for up to %d "+
+				"streams per user.", changes.Params().MaxWatchersPerUser)
+		}
+
+		// Optionally serve the files of each user over WebDAV
+		var webdav *server.WebDAV
+		if viper.IsSet(webdavParamsTag) {
+			webdav, err = server.NewWebDAV(viper.GetStringMap(webdavParamsTag))
+			if err != nil {
+				jww.FATAL.Panicf("Invalid WebDAV: %+v", err)
+			}
+			access := "read-only"
+			if webdav.Params().ReadWrite {
+				access = "read-write"
+			}
+			jww.INFO.Printf("WebDAV enabled with %s access.", access)
+		}
+
+		// Optionally let users create signed download links to their files
+		var links *server.Links
+		if viper.IsSet(linksParamsTag) {
+			links, err = server.NewLinks(viper.GetStringMap(linksParamsTag))
+			if err != nil {
+				jww.FATAL.Panicf("Invalid download links: %+v", err)
+			}
+			jww.INFO.Printf("Download links enabled at %s for up to %s.",
+				links.Params().BaseURL, links.Params().MaxTTL)
+		}
+
+		// Optionally record writes in a write-ahead journal before applying
+		// them, and replay the ones interrupted by a crash on start
+		var journal *server.Journal
+		if viper.IsSet(journalParamsTag) {
+			journal, err = server.NewJournal(
+				viper.GetStringMap(journalParamsTag))
+			if err != nil {
+				jww.FATAL.Panicf("Invalid journal: %+v", err)
+			}
+			jww.INFO.Printf("Journaling writes to %s.", journal.Params().Path)
+		}
+
+		// Optionally replicate writes to the other nodes of a cluster
+		var cluster *server.Cluster
+		if viper.IsSet(clusterParamsTag) {
+			cluster, err = server.NewCluster(
+				viper.GetStringMap(clusterParamsTag))
+			if err != nil {
+				jww.FATAL.Panicf("Invalid cluster: %+v", err)
+			}
+			jww.INFO.Printf("Clustering enabled as node %s of %d.",
+				cluster.Params().NodeID, len(cluster.Params().Peers))
+		}
+
+		// Optionally replicate writes to a standby, read replicas, and other
+		// regions, or act as the standby or a read replica
+		var replication *server.Replication
+		if viper.IsSet(replicationParamsTag) {
+			replication, err = server.NewReplication(
+				viper.GetStringMap(replicationParamsTag))
+			if err != nil {
+				jww.FATAL.Panicf("Invalid replication: %+v", err)
+			}
+			if replication.Standby() {
+				jww.INFO.Printf("Running as standby; rejecting writes until " +
+					"promoted.")
+			} else if replication.Replica() {
+				jww.INFO.Printf("Running as read replica of primary %s.",
+					replication.Params().Peer)
+			} else if replication.Region() {
+				jww.INFO.Printf("Running as region %s with %d other regions.",
+					replication.Params().Region,
+					len(replication.Params().Regions))
+			} else {
+				jww.INFO.Printf("Running as primary with %d read replicas.",
+					len(replication.Params().Replicas))
+			}
+		}
+
+		// Optionally let users import their accounts from other servers and
+		// export them
+		var migration *server.Migration
+		if viper.IsSet(migrationParamsTag) {
+			migration, err = server.NewMigration(
+				viper.GetStringMap(migrationParamsTag))
+			if err != nil {
+				jww.FATAL.Panicf("Invalid account migration: %+v", err)
+			}
+			jww.INFO.Printf("Account migration enabled with %d sources.",
+				len(migration.Params().Sources))
+		}
+
+		// Files are stored in a subdirectory per user in the storage directory
+		if storageBackend == store.FileBackend {
+			_, statErr := os.Stat(storageDir)
+			if err = os.MkdirAll(storageDir, store.FilePerm); err != nil {
+				jww.FATAL.Panicf("Failed to create storage directory %s: %+v",
+					storageDir, err)
+			}
+
+			// A new storage directory must be usable after dropping privileges
+			if os.IsNotExist(statErr) && account != nil {
+				if err = account.chown(storageDir); err != nil {
+					jww.FATAL.Panicf("Failed to give storage directory to "+
+						"%s: %+v", account, err)
+				}
+			}
+			jww.INFO.Printf("Storing files in %s.", storageDir)
+		}
+
+		// Serve on the socket passed by systemd socket activation, if any,
+		// instead of listening on the port
+		listener, err := server.SystemdListener()
+		if err != nil {
+			jww.FATAL.Panicf("Failed to use socket from systemd: %+v", err)
+		}
+		if listener != nil {
+			jww.INFO.Printf("Using socket %s from systemd.", listener.Addr())
+		}
+		listeners, err := configListeners(listener)
+		if err != nil {
+			jww.FATAL.Panicf("Invalid listeners: %+v", err)
+		}
+
+		// Notify systemd of the status of the server and ping its watchdog
+		// if the service is configured for them
+		notifier, err := server.NewSystemdNotifier()
+		if err != nil {
+			jww.FATAL.Panicf("Failed to use systemd notification: %+v", err)
+		}
+		if notifier != nil && notifier.Watchdog() > 0 {
+			jww.INFO.Printf("Pinging systemd watchdog with timeout %s.",
+				notifier.Watchdog())
+		}
+
+		// Refuse to start if another server holds the PID file or the storage
+		// directory. After an upgrade, the previous process holds them until
+		// it exits, so they are taken once it does.
+		pidFile, err := utils.ExpandPath(viper.GetString(pidFileFlag))
+		if err != nil {
+			jww.FATAL.Panicf("Invalid PID file %q: %+v",
+				viper.GetString(pidFileFlag), err)
+		}
+		locks, err := lockInstance(pidFile, storageDir,
+			storageBackend == store.FileBackend,
+			handoff != nil && handoff.Inherited())
+		if err != nil {
+			jww.FATAL.Panicf("Failed to lock PID file or storage directory; "+
+				"is another server running? %+v", err)
+		}
+
+		if viper.GetBool(grpcReflectionTag) {
+			jww.INFO.Printf("gRPC server reflection enabled.")
 		}
-		_ = f.Close()
 
 		// Start comms
-		s, err := server.NewServer(storageDir, tokenTTL, records,
-			&id.DummyUser, localAddress, signedCert, signedKey)
+		s, err := server.NewServer(storageDir, newStore, tokenTTL, users,
+			registrar, listeners, &id.DummyUser, signedCert, signedKey,
+			server.ServerOptions{
+				Hasher:          hasher,
+				KnownUsers:      knownUsers,
+				OIDC:            oidcAuth,
+				Revoked:         revoked,
+				AdminKey:        adminKey,
+				AdminListener:   adminListener,
+				Policies:        policies,
+				APIKeys:         apiKeys,
+				MTLS:            mtls,
+				Limiter:         limiter,
+				Concurrency:     concurrency,
+				IPFilter:        ipFilter,
+				AutoBan:         autoBan,
+				LoginThrottle:   loginThrottle,
+				Limits:          limits,
+				GRPCSettings:    grpcSettings,
+				HTTPLimits:      httpLimits,
+				WebSecurity:     webSecurity,
+				Maintenance:     maintenance,
+				ACME:            acme,
+				TLSSettings:     tlsSettings,
+				OCSPStapler:     ocspStapler,
+				InsecureHTTP:    insecureHTTP,
+				Proxies:         proxies,
+				AdditionalCerts: additionalCerts,
+				CertExpiry:      certExpiry,
+				GC:              gc,
+				Uploads:         uploads,
+				Delta:           delta,
+				Changes:         changes,
+				WebDAV:          webdav,
+				Links:           links,
+				Journal:         journal,
+				Scrubber:        scrubber,
+				Cluster:         cluster,
+				Replication:     replication,
+				Migration:       migration,
+				Metrics:         metrics,
+				Health:          health,
+				Tracing:         tracing,
+				Audit:           audit,
+				AccessLog:       accessLog,
+				ErrorReporter:   reporter,
+				Handoff:         handoff,
+				Notifier:        notifier,
+				Reload:          reloader.reload,
+				SetLogLevel:     setLogThreshold,
+				Reflection:      viper.GetBool(grpcReflectionTag),
+				BuildInfo:       buildInfo(),
+			})
 		if err != nil {
 			jww.FATAL.Panicf("Failed to create new server: %+v", err)
 		}
+
+		// Optionally bind the sockets as root and serve as an unprivileged user
+		if account != nil {
+			if err = s.Bind(); err != nil {
+				jww.FATAL.Panicf("Failed to bind sockets: %+v", err)
+			}
+			if err = account.drop(); err != nil {
+				jww.FATAL.Panicf("Failed to drop privileges to %s: %+v",
+					account, err)
+			}
+			jww.INFO.Printf("Running as %s.", account)
+		}
+
 		err = s.Start()
 		if err != nil {
 			jww.FATAL.Panicf("Failed to start server: %+v", err)
 		}
+		if service != nil {
+			service.started()
+		}
+		if daemon != nil {
+			daemon.serving()
+		}
+		if index != nil {
+			go buildIndex(index, storageDir, users)
+		}
+
+		// Run until the process is told to stop, reloading the config on
+		// SIGHUP and handing off to a new process on upgradeSignal
+		var handedOff bool
+		signal.Notify(signals, os.Interrupt, syscall.SIGTERM, syscall.SIGHUP)
+		if upgradeSignal != nil {
+			signal.Notify(signals, upgradeSignal)
+		}
+		for sig := range signals {
+			if sig == syscall.SIGHUP {
+				if err = reloader.reload(); err != nil {
+					jww.ERROR.Printf("Failed to reload config: %+v", err)
+				}
+				continue
+			} else if sig == upgradeSignal {
+				if err = s.Upgrade(); err != nil {
+					jww.ERROR.Printf("Failed to upgrade: %+v", err)
+					continue
+				}
+				jww.INFO.Printf("Handed off to the new process; shutting down.")
+				handedOff = true
+				break
+			}
+			jww.INFO.Printf("Received %s; shutting down.", sig)
+			break
+		}
+		s.Stop()
+		locks.release(handedOff)
+		if service != nil {
+			service.stopped()
+		}
 	},
 }
 
+// Names of the supported credential store backends.
+const (
+	csvCredentialsBackend      = "csv"
+	postgresCredentialsBackend = store.PostgresBackend
+	sqliteCredentialsBackend   = store.SQLiteBackend
+)
+
+// Names of the tables used by database credential backends for users
+// awaiting approval, unused invite codes, API keys, and known users.
+const (
+	pendingUsersTable = "pending_users"
+	invitesTable      = "invites"
+	apiKeysTable      = "api_keys"
+	knownUsersTable   = "known_users"
+)
+
+// Names of the supported password hashing schemes.
+const (
+	noPasswordHashing       = "none"
+	argon2idPasswordHashing = "argon2id"
+)
+
+// newPasswordHasher returns the hasher for the configured password hashing
+// scheme or nil if passwords are stored in cleartext.
+func newPasswordHasher() (*credentials.Argon2Hasher, error) {
+	switch scheme := viper.GetString(passwordHashingTag); scheme {
+	case noPasswordHashing:
+		return nil, nil
+	case argon2idPasswordHashing:
+		return credentials.NewArgon2Hasher(viper.GetStringMap(argon2ParamsTag))
+	default:
+		return nil, errors.Errorf("unknown password hashing %q", scheme)
+	}
+}
+
+// buildIndex indexes the files of all users and logs the result. Users are
+// served from storage until their files are indexed.
+func buildIndex(
+	index *store.Index, storageDir string, users credentials.Store) {
+	usernames, err := users.List()
+	if err != nil {
+		jww.ERROR.Printf("Failed to list users to index: %+v", err)
+		return
+	}
+	jww.INFO.Printf("Indexing the files of %d users.", len(usernames))
+	start := time.Now()
+	report := index.Build(storageDir, usernames)
+	for _, err := range report.Failed {
+		jww.WARN.Printf("%+v", err)
+	}
+	jww.INFO.Printf("Indexed %d files of %d users in %s; %d users failed.",
+		report.Files, report.Users, time.Since(start).Round(time.Millisecond),
+		len(report.Failed))
+}
+
+// newRegistrar opens the user credential store and creates a Registrar for the
+// configured registration mode that hashes new passwords with the hasher. The
+// pending user and invite stores are only opened if they are used by the mode.
+func newRegistrar(hasher *credentials.Argon2Hasher) (
+	credentials.Store, *server.Registrar, error) {
+	backend := viper.GetString(credentialsBackendTag)
+	mode := server.RegistrationMode(viper.GetString(registrationModeTag))
+
+	db, err := openCredentialDB(backend)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	users, err := newCredentialStore(
+		backend, db, viper.GetString(credentialsPathTag), credentials.UsersTable)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var pending, invites credentials.Store
+	switch mode {
+	case server.RegistrationApproval:
+		pending, err = newCredentialStore(backend, db,
+			viper.GetString(pendingUsersCsvPathTag), pendingUsersTable)
+	case server.RegistrationInvite:
+		invites, err = newCredentialStore(backend, db,
+			viper.GetString(invitesCsvPathTag), invitesTable)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	registrar, err := server.NewRegistrar(mode, users, pending, invites, hasher)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return users, registrar, nil
+}
+
+// newKnownUsers opens the store of the users whose storage was opened.
+func newKnownUsers() (*server.KnownUsers, error) {
+	backend := viper.GetString(credentialsBackendTag)
+	db, err := openCredentialDB(backend)
+	if err != nil {
+		return nil, err
+	}
+
+	seen, err := newCredentialStore(backend, db,
+		viper.GetString(knownUsersCsvPathTag), knownUsersTable)
+	if err != nil {
+		return nil, err
+	}
+
+	return server.NewKnownUsers(seen), nil
+}
+
+// openCredentialDB opens the database for the named credential backend using
+// the connection parameters in the config section of the same name. Returns
+// nil for the CSV backend.
+func openCredentialDB(backend string) (*sql.DB, error) {
+	switch backend {
+	case csvCredentialsBackend:
+		return nil, nil
+	case postgresCredentialsBackend:
+		return store.OpenPostgres(viper.GetStringMap(backend))
+	case sqliteCredentialsBackend:
+		return store.OpenSQLite(viper.GetStringMap(backend))
+	default:
+		return nil, errors.Errorf("unknown credentials backend %q", backend)
+	}
+}
+
+// newCredentialStore opens a credential store for the named backend. The CSV
+// backend reads the credentials from the file at csvPath; database backends
+// use the named table of the database.
+func newCredentialStore(
+	backend string, db *sql.DB, csvPath, table string) (credentials.Store, error) {
+	if backend == csvCredentialsBackend {
+		return credentials.NewCsvStore(csvPath)
+	}
+	return credentials.NewSQLStore(db, table)
+}
+
 // initConfig reads in config file from the file path.
 func initConfig(filePath string) {
-	// Use default config location if none is passed
-	if filePath == "" {
-		return
+	if err := readConfig(filePath); err != nil {
+		jww.FATAL.Panicf("Invalid config: %+v", err)
+	}
+}
+
+// readConfig reads in config file from the file path, if it is not empty, and
+// the options set by environment variables, which override those in the file,
+// decrypts their encrypted values, and fetches the secrets they reference.
+// Returns an error if the config has unknown keys or values of the wrong type
+// or a value cannot be decrypted or a secret fetched.
+func readConfig(filePath string) error {
+	if filePath != "" {
+		filePath, err := utils.ExpandPath(filePath)
+		if err != nil {
+			return err
+		}
+
+		viper.SetConfigFile(filePath)
+		if err = viper.ReadInConfig(); err != nil {
+			return err
+		}
+	}
+
+	// Merging the environment into the config keeps flags above it and lets
+	// it set options in sections, which viper only reads from the environment
+	// for options it already knows
+	if err := viper.MergeConfigMap(envConfig(os.Environ())); err != nil {
+		return err
 	}
 
-	filePath, err := utils.ExpandPath(filePath)
+	// Encrypted values are decrypted before secrets are fetched so that the
+	// secrets section can hold them
+	if err := decryptConfig(); err != nil {
+		return err
+	}
+
+	// Secrets are fetched last so that the environment can also configure
+	// the provider and reference them
+	if viper.IsSet(secretsParamsTag) {
+		if err := resolveSecrets(); err != nil {
+			return err
+		}
+	}
+	return checkConfigKeys()
+}
+
+// decryptConfig replaces the encrypted values of the config, of the form
+// ENC[...], with their values decrypted with the config key. Returns an error
+// if the config key is invalid or a value cannot be decrypted, including when
+// no config key is set.
+func decryptConfig() error {
+	var configCipher *store.ConfigCipher
+	if viper.IsSet(configKeyTag) || viper.IsSet(configKeyPathTag) {
+		var err error
+		if configCipher, err = newConfigCipher(); err != nil {
+			return err
+		}
+	}
+	decrypted, err := configCipher.Resolve(viper.AllSettings())
 	if err != nil {
-		jww.FATAL.Panicf("Invalid config file path %q: %+v", filePath, err)
+		return errors.WithMessage(err, "failed to decrypt config")
 	}
+	return viper.MergeConfigMap(decrypted)
+}
 
-	viper.SetConfigFile(filePath)
+// newConfigCipher returns the ConfigCipher of the config key, which is set in
+// configKey, such as from the environment, or read from configKeyPath.
+func newConfigCipher() (*store.ConfigCipher, error) {
+	var key []byte
+	if viper.IsSet(configKeyTag) && viper.IsSet(configKeyPathTag) {
+		return nil, errors.Errorf("only one of %s and %s can be set",
+			configKeyTag, configKeyPathTag)
+	} else if viper.IsSet(configKeyTag) {
+		key = []byte(viper.GetString(configKeyTag))
+	} else {
+		keyPath := viper.GetString(configKeyPathTag)
+		var err error
+		if key, err = utils.ReadFile(keyPath); err != nil {
+			return nil, errors.Wrapf(err,
+				"failed to read config key from %s", keyPath)
+		}
+	}
+	configCipher, err := store.NewConfigCipher(key)
+	return configCipher, errors.WithMessage(err, "invalid config key")
+}
 
-	viper.AutomaticEnv() // Read in environment variables that match
+// resolveSecrets replaces the config options that reference secrets with the
+// secrets fetched from the provider in the secrets section. Returns an error
+// if the section is invalid or any secret cannot be fetched.
+func resolveSecrets() error {
+	secrets, err := store.NewSecrets(viper.GetStringMap(secretsParamsTag))
+	if err != nil {
+		return errors.WithMessage(err, "invalid secrets")
+	}
+	config := viper.AllSettings()
+	delete(config, secretsParamsTag)
+	resolved, err := secrets.Resolve(config)
+	if err != nil {
+		return errors.WithMessage(err, "failed to fetch secrets")
+	}
+	return viper.MergeConfigMap(resolved)
+}
 
-	// If a config file is found, read it in.
-	if err = viper.ReadInConfig(); err != nil {
-		jww.FATAL.Panicf("Invalid config file path %q: %+v", filePath, err)
+// readSignedKey returns the key of the certificate, which is set in signedKey,
+// such as from a secret, or read from signedKeyPath.
+func readSignedKey() ([]byte, error) {
+	if viper.IsSet(signedKeyTag) {
+		return []byte(viper.GetString(signedKeyTag)), nil
 	}
+	keyPath := viper.GetString(signedKeyPathTag)
+	key, err := utils.ReadFile(keyPath)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read key from %s", keyPath)
+	}
+	return key, nil
+}
+
+// envConfig returns the config options set by the environment variables with
+// envPrefix. Variable names are the upper case option names, with sections
+// separated by underscores, such as REMOTE_SYNC_PORT for port and
+// REMOTE_SYNC_RATELIMIT_IPRPS for ipRPS in the rateLimit section. Options are
+// not case-sensitive, so the names match the options in the config file.
+func envConfig(environ []string) map[string]interface{} {
+	config := make(map[string]interface{})
+	for _, env := range environ {
+		name, value, _ := strings.Cut(env, "=")
+		if !strings.HasPrefix(name, envPrefix) {
+			continue
+		}
+		path := strings.FieldsFunc(
+			strings.ToLower(strings.TrimPrefix(name, envPrefix)),
+			func(r rune) bool { return r == '_' })
+		if len(path) == 0 {
+			continue
+		}
+
+		section := config
+		for _, key := range path[:len(path)-1] {
+			sub, ok := section[key].(map[string]interface{})
+			if !ok {
+				sub = make(map[string]interface{})
+				section[key] = sub
+			}
+			section = sub
+		}
+		section[path[len(path)-1]] = value
+	}
+	return config
 }
 
-// initLog initialises the log to the specified log path filtered to the
-// threshold. If the log path is "-" or "", it is printed to stdout.
-func initLog(logPath string, threshold uint) {
+// initLog initialises the log to the specified log path in the format filtered
+// to the threshold.
+func initLog(logPath, format string, threshold uint) {
+	format, err := logging.ParseFormat(format)
+	if err != nil {
+		jww.FATAL.Panicf("Invalid log format: %+v", err)
+	}
+	logging.SetFormat(format)
+
+	var logOutput io.Writer = os.Stdout
 	if logPath != "-" && logPath != "" {
 		// Disable stdout output
 		jww.SetStdoutOutput(io.Discard)
 
 		// Use log file
-		logOutput, err :=
+		logOutput, err =
 			os.OpenFile(logPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
 		if err != nil {
 			panic(err)
@@ -148,16 +1348,112 @@ func initLog(logPath string, threshold uint) {
 		jww.SetLogOutput(logOutput)
 	}
 
+	// In JSON format, the writer adds the timestamp to each entry
+	if logging.JSON() {
+		jww.SetFlags(0)
+		if logOutput == os.Stdout {
+			jww.SetStdoutOutput(logging.NewJSONWriter(logOutput))
+		} else {
+			jww.SetLogOutput(logging.NewJSONWriter(logOutput))
+		}
+	}
+
+	setLogThreshold(threshold)
+}
+
+// instanceLocks are the locks that keep other servers from using the PID file
+// and storage directory of this one.
+type instanceLocks struct {
+	pidFile *server.PIDFile
+	storage *server.Lock
+	mux     sync.Mutex
+}
+
+// lockInstance locks the PID file, if set, and the storage directory, if
+// lockStorage is true. If upgraded is true, the previous process holds the
+// locks until it exits, so they are taken in the background once it does.
+func lockInstance(pidFile, storageDir string, lockStorage, upgraded bool) (
+	*instanceLocks, error) {
+	il := &instanceLocks{}
+	lock := func(wait bool) error {
+		var pf *server.PIDFile
+		var storage *server.Lock
+		var err error
+		if pidFile != "" {
+			if pf, err = server.LockPIDFile(pidFile, wait); err != nil {
+				return err
+			}
+		}
+		if lockStorage {
+			if storage, err = server.LockDir(storageDir, wait); err != nil {
+				if pf != nil {
+					_ = pf.Remove()
+				}
+				return err
+			}
+		}
+
+		il.mux.Lock()
+		defer il.mux.Unlock()
+		il.pidFile, il.storage = pf, storage
+		return nil
+	}
+
+	if !upgraded {
+		return il, lock(false)
+	}
+	go func() {
+		if err := lock(true); err != nil {
+			jww.ERROR.Printf("Failed to take over the locks of the previous "+
+				"process: %+v", err)
+		}
+	}()
+	return il, nil
+}
+
+// release releases the locks. The PID file is removed unless the server handed
+// off to a new process, which takes over the locks once this process exits.
+func (il *instanceLocks) release(handedOff bool) {
+	il.mux.Lock()
+	defer il.mux.Unlock()
+	if il.storage != nil {
+		if err := il.storage.Release(); err != nil {
+			jww.WARN.Printf("Failed to unlock storage directory: %+v", err)
+		}
+	}
+	if il.pidFile != nil {
+		release := il.pidFile.Remove
+		if handedOff {
+			release = il.pidFile.Release
+		}
+		if err := release(); err != nil {
+			jww.WARN.Printf("Failed to release PID file: %+v", err)
+		}
+	}
+}
+
+// newErrorReporter returns the error reporter configured in the config file.
+// Events are tagged with the storage and credentials backends.
+func newErrorReporter() (*server.ErrorReporter, error) {
+	return server.NewErrorReporter(viper.GetStringMap(errorReportParamsTag),
+		buildInfo(), map[string]string{
+			storageBackendTag:     viper.GetString(storageBackendTag),
+			credentialsBackendTag: viper.GetString(credentialsBackendTag),
+		})
+}
+
+// setLogThreshold filters the log to the threshold.
+func setLogThreshold(threshold uint) {
 	if threshold > 1 {
 		jww.INFO.Printf("log level set to: TRACE")
 		jww.SetStdoutThreshold(jww.LevelTrace)
 		jww.SetLogThreshold(jww.LevelTrace)
-		jww.SetFlags(log.LstdFlags | log.Lmicroseconds)
+		setLogFlags(log.LstdFlags | log.Lmicroseconds)
 	} else if threshold == 1 {
 		jww.INFO.Printf("log level set to: DEBUG")
 		jww.SetStdoutThreshold(jww.LevelDebug)
 		jww.SetLogThreshold(jww.LevelDebug)
-		jww.SetFlags(log.LstdFlags | log.Lmicroseconds)
+		setLogFlags(log.LstdFlags | log.Lmicroseconds)
 	} else {
 		jww.INFO.Printf("log level set to: INFO")
 		jww.SetStdoutThreshold(jww.LevelInfo)
@@ -165,10 +1461,26 @@ func initLog(logPath string, threshold uint) {
 	}
 }
 
+// setLogFlags sets the flags of the log, unless it is in JSON format, where the
+// timestamp is written by the JSON writer instead.
+func setLogFlags(flags int) {
+	if !logging.JSON() {
+		jww.SetFlags(flags)
+	}
+}
+
 // init initializes all the flags for Cobra, which defines commands and flags.
 func init() {
 	rootCmd.PersistentFlags().StringVarP(&configFilePath, "config", "c", "",
 		"File path to Custom configuration.")
+	rootCmd.PersistentFlags().BoolVar(&allowUnknownKeys, allowUnknownKeysFlag,
+		false, "Only warn about unknown keys in the config instead of "+
+			"failing.")
+
+	rootCmd.PersistentFlags().String(configKeyPathTag, "",
+		"File path to the key that encrypted values in the config are "+
+			"decrypted with.")
+	bindPFlag(rootCmd.PersistentFlags(), configKeyPathTag, rootCmd.Use)
 
 	rootCmd.PersistentFlags().StringP(logPathFlag, "l", "",
 		"File path to save log file to.")
@@ -177,6 +1489,58 @@ func init() {
 	rootCmd.PersistentFlags().IntP(logLevelFlag, "v", 0,
 		"Verbosity level for log printing (2+ = Trace, 1 = Debug, 0 = Info).")
 	bindPFlag(rootCmd.PersistentFlags(), logLevelFlag, rootCmd.Use)
+
+	rootCmd.PersistentFlags().String(logFormatFlag, logging.TextFormat,
+		"Format of the log: \"text\" or \"json\" for structured logs.")
+	bindPFlag(rootCmd.PersistentFlags(), logFormatFlag, rootCmd.Use)
+
+	rootCmd.PersistentFlags().Bool(insecureHTTPTag, false,
+		"Serve without TLS. Only use behind a reverse proxy that terminates "+
+			"TLS.")
+	bindPFlag(rootCmd.PersistentFlags(), insecureHTTPTag, rootCmd.Use)
+
+	rootCmd.Flags().StringP(storageDirTag, "s", defaultStorageDir,
+		"Root directory for synced files. Each user's files are stored in a "+
+			"subdirectory named after the user.")
+	bindPFlag(rootCmd.Flags(), storageDirTag, rootCmd.Use)
+
+	rootCmd.Flags().StringSlice(bindAddressTag, []string{defaultBindAddress},
+		"Comma-separated IP addresses or hostnames of the interfaces to "+
+			"listen on. IPv6 addresses may be enclosed in brackets.")
+	bindPFlag(rootCmd.Flags(), bindAddressTag, rootCmd.Use)
+
+	rootCmd.Flags().String(pidFileFlag, "",
+		"File path to write the PID of the server to. The file is locked so "+
+			"that a second server using it refuses to start.")
+	bindPFlag(rootCmd.Flags(), pidFileFlag, rootCmd.Use)
+
+	rootCmd.Flags().String(userFlag, "",
+		"User to run as after binding the sockets, such as to serve port 443 "+
+			"without staying root.")
+	bindPFlag(rootCmd.Flags(), userFlag, rootCmd.Use)
+
+	rootCmd.Flags().String(groupFlag, "",
+		"Group to run as after binding the sockets. Defaults to the primary "+
+			"group of the user.")
+	bindPFlag(rootCmd.Flags(), groupFlag, rootCmd.Use)
+
+	rootCmd.Flags().Bool(daemonFlag, false,
+		"Run in the background, detached from the terminal, with output "+
+			"appended to the log file.")
+	bindPFlag(rootCmd.Flags(), daemonFlag, rootCmd.Use)
+
+	viper.SetDefault(tokenTtlTag, defaultTokenTTL)
+	viper.SetDefault(storageBackendTag, store.FileBackend)
+	viper.SetDefault(credentialsBackendTag, csvCredentialsBackend)
+	viper.SetDefault(passwordHashingTag, noPasswordHashing)
+	viper.SetDefault(registrationModeTag, string(server.RegistrationDisabled))
+	viper.SetDefault(registrationsOpenTag, true)
+	viper.SetDefault(pendingUsersCsvPathTag, defaultPendingUsersCsvPath)
+	viper.SetDefault(invitesCsvPathTag, defaultInvitesCsvPath)
+	viper.SetDefault(revocationListPathTag, defaultRevocationListPath)
+	viper.SetDefault(userPoliciesPathTag, defaultUserPoliciesPath)
+	viper.SetDefault(apiKeysCsvPathTag, defaultAPIKeysCsvPath)
+	viper.SetDefault(knownUsersCsvPathTag, defaultKnownUsersCsvPath)
 }
 
 // bindPFlag binds the key to a pflag.Flag. Panics on error.
@@ -187,3 +1551,110 @@ func bindPFlag(flagSet *pflag.FlagSet, key, use string) {
 			"Failed to bind key %q to a pflag on %s: %+v", key, use, err)
 	}
 }
+
+// bindHosts returns the hosts to listen on from the bindAddress option. Each
+// entry may contain several comma-separated hosts, and IPv6 addresses may be
+// enclosed in brackets.
+func bindHosts() ([]string, error) {
+	var hosts []string
+	for _, entry := range viper.GetStringSlice(bindAddressTag) {
+		for _, host := range strings.Split(entry, ",") {
+			host = strings.TrimSpace(host)
+			if strings.HasPrefix(host, "[") && strings.HasSuffix(host, "]") {
+				host = host[1 : len(host)-1]
+			}
+			if host != "" {
+				hosts = append(hosts, host)
+			}
+		}
+	}
+	if len(hosts) == 0 {
+		return nil, errors.New("at least one address is required")
+	}
+	return hosts, nil
+}
+
+// joinHostsPort returns the address of the port on each of the hosts.
+func joinHostsPort(hosts []string, port int) []string {
+	addresses := make([]string, len(hosts))
+	for i, host := range hosts {
+		addresses[i] = net.JoinHostPort(host, strconv.Itoa(port))
+	}
+	return addresses
+}
+
+// configListeners returns the listeners in the listeners section of the config
+// or, if it is not set, a listener on the port of each bind address. With the
+// https section, those only serve native gRPC, and gRPC-web is served on the
+// HTTPS port of each bind address with the section's TLS settings. If
+// systemdListener is not nil, it replaces the first listener of the section or
+// the listeners on the port.
+func configListeners(
+	systemdListener net.Listener) ([]server.Listener, error) {
+	if viper.IsSet(listenersTag) {
+		if viper.IsSet(httpsParamsTag) {
+			return nil, errors.Errorf("%s cannot be combined with %s; add a "+
+				"%s listener instead", listenersTag, httpsParamsTag,
+				server.ProtocolGRPCWeb)
+		}
+		listeners, err := server.NewListeners(viper.Get(listenersTag))
+		if err != nil {
+			return nil, err
+		}
+		if systemdListener != nil {
+			listeners[0].Listener = systemdListener
+		}
+		return listeners, nil
+	}
+
+	hosts, err := bindHosts()
+	if err != nil {
+		return nil, errors.WithMessage(err, bindAddressTag)
+	}
+	port := viper.GetInt(portTag)
+	protocols := server.DefaultProtocols
+	var webAddresses []string
+	var webTLSSettings *server.TLSSettings
+	if viper.IsSet(httpsParamsTag) {
+		webPort := viper.GetInt(httpsParamsTag + "." + portTag)
+		if webPort == 0 || webPort == port {
+			return nil, errors.Errorf("the HTTPS port must be set and differ "+
+				"from the gRPC port %d", port)
+		}
+		protocols = []string{server.ProtocolGRPC}
+		webAddresses = joinHostsPort(hosts, webPort)
+
+		minVersionTag := httpsParamsTag + "." + tlsMinVersionTag
+		cipherSuitesTag := httpsParamsTag + "." + tlsCipherSuitesTag
+		if viper.IsSet(minVersionTag) || viper.IsSet(cipherSuitesTag) {
+			webTLSSettings, err = server.NewTLSSettings(
+				viper.GetString(minVersionTag),
+				viper.GetStringSlice(cipherSuitesTag))
+			if err != nil {
+				return nil, errors.WithMessage(err, "invalid HTTPS TLS settings")
+			}
+		}
+	}
+
+	var listeners []server.Listener
+	if systemdListener != nil {
+		listeners = append(listeners, server.Listener{
+			Address:   systemdListener.Addr().String(),
+			Protocols: protocols,
+			Listener:  systemdListener,
+		})
+	} else {
+		for _, address := range joinHostsPort(hosts, port) {
+			listeners = append(listeners,
+				server.Listener{Address: address, Protocols: protocols})
+		}
+	}
+	for _, address := range webAddresses {
+		listeners = append(listeners, server.Listener{
+			Address:     address,
+			Protocols:   []string{server.ProtocolGRPCWeb},
+			TLSSettings: webTLSSettings,
+		})
+	}
+	return listeners, nil
+}
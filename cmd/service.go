@@ -0,0 +1,29 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+//go:build !windows
+
+package cmd
+
+import (
+	"io"
+	"os"
+
+	jww "github.com/spf13/jwalterweatherman"
+)
+
+// windowsService is never started on other platforms.
+type windowsService struct{}
+
+// startService returns nil since there is no service control manager.
+func startService(chan<- os.Signal) (*windowsService, error) {
+	return nil, nil
+}
+
+func (ws *windowsService) LogListener(jww.Threshold) io.Writer { return nil }
+func (ws *windowsService) started()                            {}
+func (ws *windowsService) stopped()                            {}
@@ -0,0 +1,354 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+// Handles running the server as a Windows service and the service subcommands,
+// which install, uninstall, start, and stop it
+
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	jww "github.com/spf13/jwalterweatherman"
+	"github.com/spf13/viper"
+	"golang.org/x/sys/windows/svc"
+	"golang.org/x/sys/windows/svc/eventlog"
+	"golang.org/x/sys/windows/svc/mgr"
+
+	"gitlab.com/elixxir/remoteSyncServer/logging"
+	"gitlab.com/xx_network/primitives/utils"
+)
+
+// Name and description of the Windows service. The name is also the source of
+// its entries in the event log.
+const (
+	serviceName        = "remoteSyncServer"
+	serviceDisplayName = "Remote Sync Server"
+	serviceDescription = "Secure remote sync server for Haven."
+)
+
+// serviceStopTimeout is the maximum time the service stop subcommand waits
+// for the service to stop.
+const serviceStopTimeout = time.Minute
+
+// serviceResetPeriod is the time without crashes after which the service is
+// restarted after the first recovery delay again.
+const serviceResetPeriod = 24 * time.Hour
+
+// serviceRecoveryDelays are the delays before the service is restarted after
+// its first, second, and later crashes.
+var serviceRecoveryDelays = []time.Duration{
+	5 * time.Second, 30 * time.Second, time.Minute}
+
+// eventID is the ID of every entry written to the event log. EventCreate.exe,
+// the message file of the source, supports IDs from 1 to 1000.
+const eventID = 1
+
+// windowsService reports the status of the server to the Windows service
+// control manager and writes its log to the event log.
+type windowsService struct {
+	// signals receives os.Interrupt when the service is told to stop
+	signals chan<- os.Signal
+
+	elog         *eventlog.Log
+	logThreshold jww.Threshold
+
+	// running and stop are closed when the server starts and stops; done is
+	// closed when the service control manager has been told it stopped
+	running, stop, done chan struct{}
+}
+
+// startService starts reporting the status of the server to the service
+// control manager if the process was started by it. Returns nil if it was not.
+// Requests to stop the service are sent to signals as os.Interrupt.
+func startService(signals chan<- os.Signal) (*windowsService, error) {
+	isService, err := svc.IsWindowsService()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to determine if the process "+
+			"was started as a service")
+	} else if !isService {
+		return nil, nil
+	}
+
+	elog, err := eventlog.Open(serviceName)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to open the event log")
+	}
+
+	// Every entry goes to the event log if there is no log file; otherwise
+	// only warnings and errors do
+	logThreshold := jww.LevelInfo
+	logPath := viper.GetString(logPathFlag)
+	if logPath != "-" && logPath != "" {
+		logThreshold = jww.LevelWarn
+	}
+
+	ws := &windowsService{
+		signals:      signals,
+		elog:         elog,
+		logThreshold: logThreshold,
+		running:      make(chan struct{}),
+		stop:         make(chan struct{}),
+		done:         make(chan struct{}),
+	}
+	go func() {
+		defer close(ws.done)
+		if err := svc.Run(serviceName, ws); err != nil {
+			jww.ERROR.Printf("Failed to run as a service: %+v", err)
+		}
+	}()
+	return ws, nil
+}
+
+// Execute reports the status of the server to the service control manager
+// until it stops. Implements svc.Handler.
+func (ws *windowsService) Execute(_ []string, requests <-chan svc.ChangeRequest,
+	status chan<- svc.Status) (bool, uint32) {
+	status <- svc.Status{State: svc.StartPending}
+	running := ws.running
+	for {
+		select {
+		case <-running:
+			running = nil
+			status <- svc.Status{State: svc.Running,
+				Accepts: svc.AcceptStop | svc.AcceptShutdown}
+		case <-ws.stop:
+			return false, 0
+		case r := <-requests:
+			switch r.Cmd {
+			case svc.Interrogate:
+				status <- r.CurrentStatus
+			case svc.Stop, svc.Shutdown:
+				status <- svc.Status{State: svc.StopPending}
+				select {
+				case ws.signals <- os.Interrupt:
+				default:
+				}
+			}
+		}
+	}
+}
+
+// LogListener returns a writer that writes each entry at or above the
+// threshold of the service to the event log. It is registered with
+// jww.SetLogListeners.
+func (ws *windowsService) LogListener(t jww.Threshold) io.Writer {
+	if t < ws.logThreshold {
+		return nil
+	}
+	return &eventLogWriter{elog: ws.elog, level: t}
+}
+
+// started tells the service control manager that the server is running and
+// can be stopped.
+func (ws *windowsService) started() {
+	close(ws.running)
+}
+
+// stopped tells the service control manager that the server has stopped and
+// closes the event log once it has been told.
+func (ws *windowsService) stopped() {
+	close(ws.stop)
+	<-ws.done
+	_ = ws.elog.Close()
+}
+
+// eventLogWriter writes each log entry written to it to the event log.
+type eventLogWriter struct {
+	elog  *eventlog.Log
+	level jww.Threshold
+}
+
+// Write writes the log entry as an error, warning, or information event
+// depending on its level. It never fails so that the entry is still written to
+// the other outputs of the logger.
+func (w *eventLogWriter) Write(p []byte) (int, error) {
+	msg := logging.Message(string(p))
+	switch {
+	case w.level >= jww.LevelError:
+		_ = w.elog.Error(eventID, msg)
+	case w.level == jww.LevelWarn:
+		_ = w.elog.Warning(eventID, msg)
+	default:
+		_ = w.elog.Info(eventID, msg)
+	}
+	return len(p), nil
+}
+
+func init() {
+	// Errors are caused by the service control manager, so printing the usage
+	// does not help
+	for _, cmd := range []*cobra.Command{serviceInstallCmd,
+		serviceUninstallCmd, serviceStartCmd, serviceStopCmd} {
+		cmd.SilenceUsage = true
+		serviceCmd.AddCommand(cmd)
+	}
+	rootCmd.AddCommand(serviceCmd)
+}
+
+var serviceCmd = &cobra.Command{
+	Use:   "service",
+	Short: "Manages the Windows service of the server",
+}
+
+var serviceInstallCmd = &cobra.Command{
+	Use:   "install [-- server flags]",
+	Short: "Installs the server as a Windows service",
+	Long: "Installs this server binary as a Windows service that starts " +
+		"automatically, is restarted if it crashes, and logs to the event " +
+		"log. The service is started with the config file given by --config " +
+		"and any server flags after --. Since services start in the system " +
+		"directory, paths in the config file and flags must be absolute.",
+	Args: cobra.ArbitraryArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		executable, err := os.Executable()
+		if err != nil {
+			return errors.Wrap(err, "failed to find the server binary")
+		}
+
+		var serviceArgs []string
+		if configFilePath != "" {
+			path, err := utils.ExpandPath(configFilePath)
+			if err != nil {
+				return err
+			}
+			if path, err = filepath.Abs(path); err != nil {
+				return err
+			}
+			serviceArgs = append(serviceArgs, "--config", path)
+		}
+		serviceArgs = append(serviceArgs, args...)
+
+		m, err := mgr.Connect()
+		if err != nil {
+			return errors.Wrap(err, "failed to connect to the service manager")
+		}
+		defer func() { _ = m.Disconnect() }()
+
+		if s, err := m.OpenService(serviceName); err == nil {
+			_ = s.Close()
+			return errors.Errorf("service %s is already installed", serviceName)
+		}
+		s, err := m.CreateService(serviceName, executable, mgr.Config{
+			DisplayName: serviceDisplayName,
+			Description: serviceDescription,
+			StartType:   mgr.StartAutomatic,
+		}, serviceArgs...)
+		if err != nil {
+			return errors.Wrap(err, "failed to create service")
+		}
+		defer func() { _ = s.Close() }()
+
+		actions := make([]mgr.RecoveryAction, len(serviceRecoveryDelays))
+		for i, delay := range serviceRecoveryDelays {
+			actions[i] = mgr.RecoveryAction{
+				Type: mgr.ServiceRestart, Delay: delay}
+		}
+		err = s.SetRecoveryActions(
+			actions, uint32(serviceResetPeriod.Seconds()))
+		if err != nil {
+			_ = s.Delete()
+			return errors.Wrap(err, "failed to set restart on crash")
+		}
+
+		err = eventlog.InstallAsEventCreate(
+			serviceName, eventlog.Error|eventlog.Warning|eventlog.Info)
+		if err != nil {
+			_ = s.Delete()
+			return errors.Wrap(err, "failed to register event log source")
+		}
+		fmt.Printf("Installed service %s\n", serviceName)
+		return nil
+	},
+}
+
+var serviceUninstallCmd = &cobra.Command{
+	Use:   "uninstall",
+	Short: "Uninstalls the Windows service of the server",
+	Long: "Uninstalls the Windows service of the server and removes its " +
+		"event log source. A running service is removed once it stops.",
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return withService(func(s *mgr.Service) error {
+			if err := s.Delete(); err != nil {
+				return errors.Wrap(err, "failed to delete service")
+			}
+			if err := eventlog.Remove(serviceName); err != nil {
+				return errors.Wrap(err, "failed to remove event log source")
+			}
+			fmt.Printf("Uninstalled service %s\n", serviceName)
+			return nil
+		})
+	},
+}
+
+var serviceStartCmd = &cobra.Command{
+	Use:   "start",
+	Short: "Starts the Windows service of the server",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return withService(func(s *mgr.Service) error {
+			if err := s.Start(); err != nil {
+				return errors.Wrap(err, "failed to start service")
+			}
+			fmt.Printf("Started service %s\n", serviceName)
+			return nil
+		})
+	},
+}
+
+var serviceStopCmd = &cobra.Command{
+	Use:   "stop",
+	Short: "Stops the Windows service of the server",
+	Long: "Stops the Windows service of the server and waits for the " +
+		"requests in progress to complete.",
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return withService(func(s *mgr.Service) error {
+			status, err := s.Control(svc.Stop)
+			if err != nil {
+				return errors.Wrap(err, "failed to stop service")
+			}
+
+			deadline := time.Now().Add(serviceStopTimeout)
+			for status.State != svc.Stopped {
+				if time.Now().After(deadline) {
+					return errors.Errorf("service did not stop within %s",
+						serviceStopTimeout)
+				}
+				time.Sleep(300 * time.Millisecond)
+				if status, err = s.Query(); err != nil {
+					return errors.Wrap(err, "failed to query service")
+				}
+			}
+			fmt.Printf("Stopped service %s\n", serviceName)
+			return nil
+		})
+	},
+}
+
+// withService calls the function with the installed service of the server.
+func withService(f func(s *mgr.Service) error) error {
+	m, err := mgr.Connect()
+	if err != nil {
+		return errors.Wrap(err, "failed to connect to the service manager")
+	}
+	defer func() { _ = m.Disconnect() }()
+
+	s, err := m.OpenService(serviceName)
+	if err != nil {
+		return errors.Wrapf(err, "failed to open service %s", serviceName)
+	}
+	defer func() { _ = s.Close() }()
+	return f(s)
+}
@@ -0,0 +1,115 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+// Handles the status subcommand, which prints the stats of a running server
+// from its Admin service
+
+package cmd
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+
+	"gitlab.com/elixxir/remoteSyncServer/rpc"
+)
+
+func init() {
+	addAdminFlags(statusCmd.Flags())
+
+	// Errors are caused by the server, so printing the usage does not help
+	statusCmd.SilenceUsage = true
+	rootCmd.AddCommand(statusCmd)
+}
+
+var statusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Prints the stats of a running server",
+	Long: "Prints the uptime, active sessions, number of users, storage " +
+		"used, rates of RPCs and errors over the last minute, " +
+		"maintenance mode, and whether registrations are open of a running " +
+		"server using its admin API. " +
+		"Measuring the storage reads the size of every user's files, so it " +
+		"can take a while on large stores. " +
+		"The server's certificate and admin key are read from the config file.",
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		initConfig(configFilePath)
+
+		client, ctx, cancel, err := dialAdmin(cmd)
+		if err != nil {
+			return err
+		}
+		defer cancel()
+
+		stats, err := client.GetStats(ctx, &rpc.RsGetStatsRequest{})
+		if err != nil {
+			return errors.Wrap(err, "failed to get stats")
+		}
+		printStats(stats, time.Now())
+		return nil
+	},
+}
+
+// printStats prints the stats of the server, with the uptime as of the time.
+func printStats(stats *rpc.RsGetStatsResponse, now time.Time) {
+	started := time.Unix(0, stats.GetStartedAt())
+	uptime := now.Sub(started).Truncate(time.Second)
+
+	var errorShare float64
+	if stats.GetRPCRate() > 0 {
+		errorShare = 100 * stats.GetErrorRate() / stats.GetRPCRate()
+	}
+
+	fmt.Printf("Uptime:          %s (since %s)\n",
+		uptime, started.UTC().Format(time.RFC3339))
+	fmt.Printf("Active sessions: %d\n", stats.GetActiveSessions())
+	fmt.Printf("Users:           %d\n", stats.GetUsers())
+	fmt.Printf("Storage used:    %s\n", formatBytes(stats.GetStorageBytes()))
+	fmt.Printf("RPCs:            %.2f/s over the last minute, %d total\n",
+		stats.GetRPCRate(), stats.GetRPCs())
+	fmt.Printf("Errors:          %.2f/s over the last minute (%.1f%%), "+
+		"%d total\n", stats.GetErrorRate(), errorShare, stats.GetErrors())
+	fmt.Printf("Maintenance:     %s\n", onOff(stats.GetMaintenance()))
+	fmt.Printf("Registrations:   %s\n",
+		openClosed(stats.GetRegistrationsOpen()))
+}
+
+// formatBytes returns the size in the largest binary unit in which it is at
+// least one, such as "1.5 MiB".
+func formatBytes(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+	value, prefix := float64(size)/unit, 0
+	for value >= unit && prefix < len("KMGTPE")-1 {
+		value /= unit
+		prefix++
+	}
+	return fmt.Sprintf("%.1f %ciB", value, "KMGTPE"[prefix])
+}
+
+// formatLimit returns the size limit in a human-readable form, where zero is
+// no limit.
+func formatLimit(size int64) string {
+	if size == 0 {
+		return "no limit"
+	}
+	return formatBytes(size)
+}
+
+// formatCount returns the count limit as a string, where zero is no limit.
+func formatCount(limit int) string {
+	if limit == 0 {
+		return "unlimited"
+	}
+	return strconv.Itoa(limit)
+}
@@ -0,0 +1,13 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package cmd
+
+import "os"
+
+// upgradeSignal is nil since sockets cannot be handed off on Windows.
+var upgradeSignal os.Signal
@@ -0,0 +1,236 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+// Handles the user administration subcommands
+
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"golang.org/x/term"
+
+	"gitlab.com/elixxir/remoteSyncServer/credentials"
+	"gitlab.com/elixxir/remoteSyncServer/store"
+)
+
+const userPasswordFlag = "password"
+
+func init() {
+	for _, cmd := range []*cobra.Command{userAddCmd, userPasswdCmd} {
+		cmd.Flags().StringP(userPasswordFlag, "p", "",
+			"Password for the user. If not set, it is read from stdin.")
+	}
+
+	// Errors are caused by the arguments or the credential store, so printing
+	// the usage does not help
+	for _, cmd := range []*cobra.Command{
+		userAddCmd, userRmCmd, userListCmd, userPasswdCmd} {
+		cmd.SilenceUsage = true
+		userCmd.AddCommand(cmd)
+	}
+	rootCmd.AddCommand(userCmd)
+}
+
+var userCmd = &cobra.Command{
+	Use:   "user",
+	Short: "Manages the users in the credential store",
+}
+
+var userAddCmd = &cobra.Command{
+	Use:   "add <username>",
+	Short: "Adds a new user",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		initConfig(configFilePath)
+		username := args[0]
+		if err := store.CheckUsername(username); err != nil {
+			return errors.Errorf("invalid username %q", username)
+		}
+
+		users, hasher, err := openUserStore()
+		if err != nil {
+			return err
+		}
+		if _, err = users.Get(username); err == nil {
+			return errors.Errorf("user %q already exists", username)
+		} else if !errors.Is(err, credentials.UserNotFoundErr) {
+			return err
+		}
+
+		if err = setPassword(cmd, users, hasher, username); err != nil {
+			return err
+		}
+		fmt.Printf("Added %s\n", username)
+		return nil
+	},
+}
+
+var userRmCmd = &cobra.Command{
+	Use:   "rm <username>...",
+	Short: "Removes users so that they can no longer log in",
+	Long: "Removes users so that they can no longer log in. Their synced " +
+		"files are not deleted.",
+	Args: cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		initConfig(configFilePath)
+		users, _, err := openUserStore()
+		if err != nil {
+			return err
+		}
+
+		for _, username := range args {
+			if err = users.Delete(username); err != nil {
+				return errors.Wrapf(err, "failed to remove %q", username)
+			}
+			fmt.Printf("Removed %s\n", username)
+		}
+		return nil
+	},
+}
+
+var userListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "Lists all users",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		initConfig(configFilePath)
+		users, _, err := openUserStore()
+		if err != nil {
+			return err
+		}
+
+		usernames, err := users.List()
+		if err != nil {
+			return err
+		}
+		for _, username := range usernames {
+			fmt.Println(username)
+		}
+		return nil
+	},
+}
+
+var userPasswdCmd = &cobra.Command{
+	Use:   "passwd <username>",
+	Short: "Resets the password of an existing user",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		initConfig(configFilePath)
+		username := args[0]
+
+		users, hasher, err := openUserStore()
+		if err != nil {
+			return err
+		}
+		if _, err = users.Get(username); err != nil {
+			return errors.Wrapf(err, "failed to get %q", username)
+		}
+
+		if err = setPassword(cmd, users, hasher, username); err != nil {
+			return err
+		}
+		fmt.Printf("Changed password for %s\n", username)
+		return nil
+	},
+}
+
+// openUserStore opens the configured user credential store and password
+// hasher.
+func openUserStore() (credentials.Store, *credentials.Argon2Hasher, error) {
+	hasher, err := newPasswordHasher()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	backend := viper.GetString(credentialsBackendTag)
+	db, err := openCredentialDB(backend)
+	if err != nil {
+		return nil, nil, err
+	}
+	users, err := newCredentialStore(
+		backend, db, viper.GetString(credentialsPathTag), credentials.UsersTable)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return users, hasher, nil
+}
+
+// setPassword reads the password from the password flag or stdin, hashes it
+// if the hasher is not nil, and saves it for the user.
+func setPassword(cmd *cobra.Command, users credentials.Store,
+	hasher *credentials.Argon2Hasher, username string) error {
+	password, err := flagPassword(cmd)
+	if err != nil {
+		return err
+	}
+
+	if hasher != nil {
+		if password, err = hasher.Hash(password); err != nil {
+			return err
+		}
+	}
+
+	return users.Set(username, password)
+}
+
+// flagPassword returns the password in the password flag of the command or,
+// if it is not set, reads it from stdin. Returns an error if it is empty.
+func flagPassword(cmd *cobra.Command) (string, error) {
+	password, err := cmd.Flags().GetString(userPasswordFlag)
+	if err != nil {
+		return "", err
+	}
+	if password == "" {
+		if password, err = readPassword(); err != nil {
+			return "", err
+		}
+	}
+	if password == "" {
+		return "", errors.New("password cannot be empty")
+	}
+	return password, nil
+}
+
+// readPassword reads a password from stdin. If stdin is a terminal, the user
+// is prompted and the input is not echoed; otherwise, the first line is read.
+func readPassword() (string, error) {
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && line == "" {
+			return "", errors.Wrap(err, "failed to read password from stdin")
+		}
+		return strings.TrimRight(line, "\r\n"), nil
+	}
+
+	fmt.Fprint(os.Stderr, "Password: ")
+	password, err := term.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to read password")
+	}
+
+	fmt.Fprint(os.Stderr, "Confirm password: ")
+	confirm, err := term.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to read password")
+	}
+	if string(password) != string(confirm) {
+		return "", errors.New("passwords do not match")
+	}
+
+	return string(password), nil
+}
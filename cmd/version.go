@@ -11,20 +11,103 @@ package cmd
 
 import (
 	"fmt"
+	"runtime"
+	"runtime/debug"
+	"strings"
 
 	"github.com/spf13/cobra"
 
+	"gitlab.com/elixxir/remoteSyncServer/server"
 	"gitlab.com/xx_network/primitives/utils"
 )
 
 // Change this value to set the version for this build.
 const currentVersion = "0.0.1"
 
-// Version returns the current version and dependencies for this binary.
+// Build metadata set when linking with -ldflags "-X", as done by the binary
+// target of the Makefile. If they are not set, the commit and its time are taken from the version
+// control information embedded by the go command.
+var (
+	gitCommit string
+	buildDate string
+)
+
+// Version returns the current version, build metadata, and dependencies for
+// this binary.
 func Version() string {
-	return fmt.Sprintf(
-		"Haven Remote Sync Server v%s -- %s\n\nDependencies:\n\n%s\n",
-		SEMVER, GITVERSION, DEPENDENCIES)
+	info := buildInfo()
+	return fmt.Sprintf("Haven Remote Sync Server v%s\nGit commit: %s\n"+
+		"Build date: %s\nGo version: %s\n\nDependencies:\n\n%s\n",
+		info.Version, orUnknown(info.GitCommit), orUnknown(info.BuildDate),
+		info.GoVersion, dependencies())
+}
+
+// buildInfo returns the version and build metadata of this binary.
+func buildInfo() server.BuildInfo {
+	info := server.BuildInfo{
+		Version:   SEMVER,
+		GitCommit: gitCommit,
+		BuildDate: buildDate,
+		GoVersion: runtime.Version(),
+	}
+
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		var revision, modified string
+		for _, setting := range bi.Settings {
+			switch setting.Key {
+			case "vcs.revision":
+				revision = setting.Value
+			case "vcs.modified":
+				modified = setting.Value
+			case "vcs.time":
+				if info.BuildDate == "" {
+					info.BuildDate = setting.Value
+				}
+			}
+		}
+		if info.GitCommit == "" && revision != "" {
+			info.GitCommit = revision
+			if modified == "true" {
+				info.GitCommit += "-dirty"
+			}
+		}
+	}
+
+	// Fall back to the commit recorded by the generate command
+	if fields := strings.Fields(GITVERSION); info.GitCommit == "" &&
+		len(fields) > 0 {
+		info.GitCommit = fields[0]
+	}
+
+	return info
+}
+
+// dependencies returns the module path and version of each dependency compiled
+// into this binary, one per line. If the binary has no build info, the go.mod
+// recorded by the generate command is returned.
+func dependencies() string {
+	bi, ok := debug.ReadBuildInfo()
+	if !ok {
+		return DEPENDENCIES
+	}
+
+	lines := make([]string, 0, len(bi.Deps))
+	for _, dep := range bi.Deps {
+		line := dep.Path + " " + dep.Version
+		if dep.Replace != nil {
+			line += " => " + dep.Replace.Path + " " + dep.Replace.Version
+		}
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// orUnknown returns the value or "unknown" if it is empty.
+func orUnknown(value string) string {
+	if value == "" {
+		return "unknown"
+	}
+	return value
 }
 
 func init() {
@@ -34,7 +117,7 @@ func init() {
 
 var versionCmd = &cobra.Command{
 	Use:   "version",
-	Short: "Prints the version and dependency information for the binary",
+	Short: "Prints the version, build, and dependency information for the binary",
 	Run: func(cmd *cobra.Command, args []string) {
 		fmt.Printf(Version())
 	},
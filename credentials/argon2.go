@@ -0,0 +1,177 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package credentials
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"github.com/mitchellh/mapstructure"
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/argon2"
+)
+
+// argon2idPrefix is the prefix of all passwords hashed with Argon2id. Stored
+// passwords without this prefix are cleartext.
+const argon2idPrefix = "$argon2id$"
+
+// Argon2Params are the parameters used to hash passwords with Argon2id. The
+// defaults follow the second recommended option of RFC 9106.
+type Argon2Params struct {
+	// Time is the number of passes over the memory.
+	Time uint32 `mapstructure:"time"`
+
+	// Memory is the amount of memory used, in KiB.
+	Memory uint32 `mapstructure:"memory"`
+
+	// Threads is the degree of parallelism.
+	Threads uint8 `mapstructure:"threads"`
+
+	// SaltLen and KeyLen are the lengths, in bytes, of the random salt and of
+	// the resulting hash.
+	SaltLen uint32 `mapstructure:"saltLen"`
+	KeyLen  uint32 `mapstructure:"keyLen"`
+}
+
+// DefaultArgon2Params returns the default Argon2Params.
+func DefaultArgon2Params() Argon2Params {
+	return Argon2Params{
+		Time:    3,
+		Memory:  64 * 1024,
+		Threads: 4,
+		SaltLen: 16,
+		KeyLen:  32,
+	}
+}
+
+// Argon2Hasher hashes passwords with Argon2id and stores them in the PHC
+// string format "$argon2id$v=19$m=<memory>,t=<time>,p=<threads>$<salt>$<hash>"
+// so that hashes made with different parameters can still be verified.
+type Argon2Hasher struct {
+	params Argon2Params
+}
+
+// NewArgon2Hasher creates a new Argon2Hasher. Parameters missing from the
+// params map use the values from DefaultArgon2Params.
+func NewArgon2Hasher(params map[string]interface{}) (*Argon2Hasher, error) {
+	p := DefaultArgon2Params()
+	decoder, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{
+		ErrorUnused:      true,
+		WeaklyTypedInput: true,
+		Result:           &p,
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create parameter decoder")
+	}
+	if err = decoder.Decode(params); err != nil {
+		return nil, errors.Wrap(err, "failed to decode Argon2 parameters")
+	}
+
+	if p.Time == 0 || p.Memory == 0 || p.Threads == 0 || p.SaltLen == 0 ||
+		p.KeyLen == 0 {
+		return nil, errors.Errorf("Argon2 parameters must be nonzero: %+v", p)
+	}
+
+	return &Argon2Hasher{params: p}, nil
+}
+
+// Hash hashes the password with a new random salt.
+func (ah *Argon2Hasher) Hash(password string) (string, error) {
+	salt := make([]byte, ah.params.SaltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return "", errors.Wrap(err, "failed to generate salt")
+	}
+
+	key := argon2.IDKey([]byte(password), salt, ah.params.Time,
+		ah.params.Memory, ah.params.Threads, ah.params.KeyLen)
+
+	return encodeArgon2id(ah.params, salt, key), nil
+}
+
+// NeedsRehash returns true if the stored password is cleartext or was hashed
+// with different parameters than the hasher's.
+func (ah *Argon2Hasher) NeedsRehash(stored string) bool {
+	p, _, _, err := decodeArgon2id(stored)
+	return err != nil || p != ah.params
+}
+
+// IsHashed returns true if the stored password is an Argon2id hash rather than
+// a cleartext password.
+func IsHashed(stored string) bool {
+	return strings.HasPrefix(stored, argon2idPrefix)
+}
+
+// VerifyPassword returns true if the password matches the stored password,
+// which is either an Argon2id hash or a cleartext password. An error is
+// returned if the stored hash is malformed.
+func VerifyPassword(stored, password string) (bool, error) {
+	if !IsHashed(stored) {
+		return subtle.ConstantTimeCompare(
+			[]byte(stored), []byte(password)) == 1, nil
+	}
+
+	p, salt, key, err := decodeArgon2id(stored)
+	if err != nil {
+		return false, err
+	}
+
+	computed := argon2.IDKey([]byte(password), salt, p.Time, p.Memory,
+		p.Threads, uint32(len(key)))
+
+	return subtle.ConstantTimeCompare(key, computed) == 1, nil
+}
+
+// encodeArgon2id encodes the parameters, salt, and key in the PHC string
+// format.
+func encodeArgon2id(p Argon2Params, salt, key []byte) string {
+	return fmt.Sprintf("%sv=%d$m=%d,t=%d,p=%d$%s$%s", argon2idPrefix,
+		argon2.Version, p.Memory, p.Time, p.Threads,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key))
+}
+
+// decodeArgon2id decodes the parameters, salt, and key from a hash in the PHC
+// string format.
+func decodeArgon2id(
+	stored string) (p Argon2Params, salt, key []byte, err error) {
+	parts := strings.Split(stored, "$")
+	if len(parts) != 6 || !IsHashed(stored) {
+		return p, nil, nil, errors.New("malformed Argon2id hash")
+	}
+
+	var version int
+	if _, err = fmt.Sscanf(parts[2], "v=%d", &version); err != nil {
+		return p, nil, nil, errors.Wrap(err, "malformed Argon2id version")
+	} else if version != argon2.Version {
+		return p, nil, nil, errors.Errorf(
+			"unsupported Argon2id version %d", version)
+	}
+
+	_, err = fmt.Sscanf(
+		parts[3], "m=%d,t=%d,p=%d", &p.Memory, &p.Time, &p.Threads)
+	if err != nil {
+		return p, nil, nil, errors.Wrap(err, "malformed Argon2id parameters")
+	} else if p.Memory == 0 || p.Time == 0 || p.Threads == 0 {
+		return p, nil, nil, errors.New("Argon2id parameters must be nonzero")
+	}
+
+	if salt, err = base64.RawStdEncoding.DecodeString(parts[4]); err != nil {
+		return p, nil, nil, errors.Wrap(err, "malformed Argon2id salt")
+	}
+	if key, err = base64.RawStdEncoding.DecodeString(parts[5]); err != nil {
+		return p, nil, nil, errors.Wrap(err, "malformed Argon2id hash")
+	} else if len(key) == 0 {
+		return p, nil, nil, errors.New("empty Argon2id hash")
+	}
+	p.SaltLen, p.KeyLen = uint32(len(salt)), uint32(len(key))
+
+	return p, salt, key, nil
+}
@@ -0,0 +1,118 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package credentials
+
+import (
+	"strings"
+	"testing"
+)
+
+// Tests that a password hashed with Argon2Hasher.Hash is verified by
+// VerifyPassword and that a different password is not.
+func TestArgon2Hasher_Hash_VerifyPassword(t *testing.T) {
+	ah := newTestArgon2Hasher(nil, t)
+
+	stored, err := ah.Hash("hunter2")
+	if err != nil {
+		t.Fatalf("Failed to hash password: %+v", err)
+	}
+	if !IsHashed(stored) || strings.Contains(stored, "hunter2") {
+		t.Errorf("Password not hashed: %q", stored)
+	}
+
+	if match, err := VerifyPassword(stored, "hunter2"); err != nil {
+		t.Errorf("Failed to verify password: %+v", err)
+	} else if !match {
+		t.Errorf("Password does not match its hash.")
+	}
+	if match, _ := VerifyPassword(stored, "hunter3"); match {
+		t.Errorf("Wrong password matches the hash.")
+	}
+
+	// Hashing the same password again uses a new salt
+	if stored2, _ := ah.Hash("hunter2"); stored2 == stored {
+		t.Errorf("Same hash for two calls: %q", stored)
+	}
+}
+
+// Tests that VerifyPassword compares cleartext passwords.
+func TestVerifyPassword_Cleartext(t *testing.T) {
+	if match, err := VerifyPassword("hunter2", "hunter2"); err != nil || !match {
+		t.Errorf("Cleartext password does not match (%t): %+v", match, err)
+	}
+	if match, _ := VerifyPassword("hunter2", "hunter3"); match {
+		t.Errorf("Wrong cleartext password matches.")
+	}
+}
+
+// Error path: Tests that VerifyPassword returns an error for malformed hashes.
+func TestVerifyPassword_MalformedHashError(t *testing.T) {
+	for _, stored := range []string{
+		"$argon2id$",
+		"$argon2id$v=19$m=64,t=1,p=1$c2FsdA",
+		"$argon2id$v=18$m=64,t=1,p=1$c2FsdA$a2V5",
+		"$argon2id$v=19$m=64,t=1,p=0$c2FsdA$a2V5",
+		"$argon2id$v=19$m=64,t=1,p=1$!!$a2V5",
+		"$argon2id$v=19$m=64,t=1,p=1$c2FsdA$",
+	} {
+		if _, err := VerifyPassword(stored, "hunter2"); err == nil {
+			t.Errorf("Failed to get error for malformed hash %q.", stored)
+		}
+	}
+}
+
+// Tests that Argon2Hasher.NeedsRehash returns true for cleartext passwords and
+// hashes made with different parameters and false for hashes made with the
+// same parameters.
+func TestArgon2Hasher_NeedsRehash(t *testing.T) {
+	ah := newTestArgon2Hasher(nil, t)
+	stored, err := ah.Hash("hunter2")
+	if err != nil {
+		t.Fatalf("Failed to hash password: %+v", err)
+	}
+
+	if ah.NeedsRehash(stored) {
+		t.Errorf("Hash with same parameters needs rehash.")
+	}
+	if !ah.NeedsRehash("hunter2") {
+		t.Errorf("Cleartext password does not need rehash.")
+	}
+
+	ah2 := newTestArgon2Hasher(map[string]interface{}{"time": 2}, t)
+	if !ah2.NeedsRehash(stored) {
+		t.Errorf("Hash with different parameters does not need rehash.")
+	}
+}
+
+// Error path: Tests that NewArgon2Hasher returns an error for unknown and zero
+// parameters.
+func TestNewArgon2Hasher_InvalidParamsError(t *testing.T) {
+	for _, params := range []map[string]interface{}{
+		{"iterations": 3},
+		{"threads": 0},
+	} {
+		if _, err := NewArgon2Hasher(params); err == nil {
+			t.Errorf("Failed to get error for params %v.", params)
+		}
+	}
+}
+
+// newTestArgon2Hasher creates an Argon2Hasher with small parameters so that
+// tests run quickly. The params override the test parameters.
+func newTestArgon2Hasher(
+	params map[string]interface{}, t testing.TB) *Argon2Hasher {
+	p := map[string]interface{}{"time": 1, "memory": 64, "threads": 1}
+	for key, value := range params {
+		p[key] = value
+	}
+	ah, err := NewArgon2Hasher(p)
+	if err != nil {
+		t.Fatalf("Failed to create Argon2Hasher: %+v", err)
+	}
+	return ah
+}
@@ -0,0 +1,234 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package credentials
+
+import (
+	"bytes"
+	"encoding/csv"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+	jww "github.com/spf13/jwalterweatherman"
+
+	"gitlab.com/xx_network/primitives/utils"
+)
+
+// csvFilePerm is the permissions used when writing the CSV file. 600 means
+// only the owner can read and modify the credentials.
+const csvFilePerm = os.FileMode(0600)
+
+// CsvStore stores user credentials in a CSV file in "<username>,<password>"
+// format. The file is loaded into memory on creation and rewritten on every
+// change. If the file is modified by another process, such as an admin
+// subcommand, it is reloaded on the next access. Adheres to the Store
+// interface.
+type CsvStore struct {
+	path string
+
+	// modTime and size are the modification time and size of the file when it
+	// was last loaded or saved. They are used to detect outside changes.
+	modTime time.Time
+	size    int64
+
+	*MemStore
+}
+
+// NewCsvStore loads the credentials from the CSV file at the given path. If the
+// file does not exist, an empty store is created and the file is written on
+// the first change.
+func NewCsvStore(path string) (*CsvStore, error) {
+	path, err := utils.ExpandPath(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to expand path %s", path)
+	}
+
+	cs := &CsvStore{path: path, MemStore: NewMemStore(nil)}
+	if err = cs.load(); err != nil {
+		return nil, err
+	}
+	if cs.modTime.IsZero() {
+		jww.WARN.Printf("Credentials file %s does not exist; no users are "+
+			"registered.", path)
+	}
+
+	return cs, nil
+}
+
+// Get returns the password for the user.
+//
+// Returns [UserNotFoundErr] if the user is not registered.
+func (cs *CsvStore) Get(username string) (string, error) {
+	if err := cs.reload(); err != nil {
+		return "", err
+	}
+	return cs.MemStore.Get(username)
+}
+
+// Set registers the user with the given password and saves the change to the
+// CSV file. If the user is already registered, their password is replaced.
+func (cs *CsvStore) Set(username, password string) error {
+	cs.mux.Lock()
+	defer cs.mux.Unlock()
+	if err := cs.loadIfChanged(); err != nil {
+		return err
+	}
+	oldPassword, exists := cs.passwords[username]
+	cs.passwords[username] = password
+	if err := cs.save(); err != nil {
+		if exists {
+			cs.passwords[username] = oldPassword
+		} else {
+			delete(cs.passwords, username)
+		}
+		return err
+	}
+	return nil
+}
+
+// Delete removes the user and saves the change to the CSV file.
+//
+// Returns [UserNotFoundErr] if the user is not registered.
+func (cs *CsvStore) Delete(username string) error {
+	cs.mux.Lock()
+	defer cs.mux.Unlock()
+	if err := cs.loadIfChanged(); err != nil {
+		return err
+	}
+	password, exists := cs.passwords[username]
+	if !exists {
+		return UserNotFoundErr
+	}
+	delete(cs.passwords, username)
+	if err := cs.save(); err != nil {
+		cs.passwords[username] = password
+		return err
+	}
+	return nil
+}
+
+// List returns the usernames of all registered users sorted alphabetically.
+func (cs *CsvStore) List() ([]string, error) {
+	if err := cs.reload(); err != nil {
+		return nil, err
+	}
+	return cs.MemStore.List()
+}
+
+// reload reloads the CSV file if it was changed since it was last loaded.
+func (cs *CsvStore) reload() error {
+	cs.mux.Lock()
+	defer cs.mux.Unlock()
+	return cs.loadIfChanged()
+}
+
+// loadIfChanged loads the CSV file if its modification time or size differs
+// from when it was last loaded or saved. Must be called while the lock is
+// held.
+func (cs *CsvStore) loadIfChanged() error {
+	fi, err := os.Stat(cs.path)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return errors.Wrapf(err, "unable to stat file %s", cs.path)
+	}
+	if fi.ModTime().Equal(cs.modTime) && fi.Size() == cs.size {
+		return nil
+	}
+
+	jww.DEBUG.Printf("Credentials file %s changed; reloading.", cs.path)
+	return cs.load()
+}
+
+// load reads all credentials from the CSV file into memory, replacing the
+// existing credentials. Does nothing if the file does not exist. Must be
+// called while the lock is held or before the store is shared.
+func (cs *CsvStore) load() error {
+	fi, err := os.Stat(cs.path)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return errors.Wrapf(err, "unable to stat file %s", cs.path)
+	}
+
+	data, err := os.ReadFile(cs.path)
+	if err != nil {
+		return errors.Wrapf(err, "unable to read file %s", cs.path)
+	}
+
+	records, err := csv.NewReader(bytes.NewReader(data)).ReadAll()
+	if err != nil {
+		return errors.Wrapf(
+			err, "unable to parse file as CSV for %s", cs.path)
+	}
+
+	passwords, err := recordsToMap(records)
+	if err != nil {
+		return err
+	}
+
+	cs.passwords, cs.modTime, cs.size = passwords, fi.ModTime(), fi.Size()
+	return nil
+}
+
+// save writes all credentials to the CSV file. The file is written to a
+// temporary file first and then renamed so that the file is never left
+// partially written. Must be called while the lock is held.
+func (cs *CsvStore) save() error {
+	usernames := make([]string, 0, len(cs.passwords))
+	for username := range cs.passwords {
+		usernames = append(usernames, username)
+	}
+	sort.Strings(usernames)
+
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	for _, username := range usernames {
+		if err := w.Write([]string{username, cs.passwords[username]}); err != nil {
+			return errors.Wrap(err, "failed to encode credentials")
+		}
+	}
+	w.Flush()
+
+	if err := os.MkdirAll(filepath.Dir(cs.path), 0700); err != nil {
+		return errors.Wrapf(err, "failed to make directory for %s", cs.path)
+	}
+	tmpPath := cs.path + ".tmp"
+	if err := os.WriteFile(tmpPath, buf.Bytes(), csvFilePerm); err != nil {
+		return errors.Wrapf(err, "failed to write %s", tmpPath)
+	}
+	if err := os.Rename(tmpPath, cs.path); err != nil {
+		return errors.Wrapf(err, "failed to replace %s", cs.path)
+	}
+
+	if fi, err := os.Stat(cs.path); err == nil {
+		cs.modTime, cs.size = fi.ModTime(), fi.Size()
+	}
+
+	return nil
+}
+
+// recordsToMap converts the username/password records from a CSV to a map of
+// passwords keyed on each username. Note that this will overwrite any
+// passwords with duplicate usernames.
+func recordsToMap(records [][]string) (map[string]string, error) {
+	users := make(map[string]string, len(records))
+	for i, line := range records {
+		if len(line) < 2 {
+			return nil, errors.Errorf("could not process record %d of %d",
+				i, len(records))
+		}
+		users[line[0]] = line[1]
+	}
+	jww.DEBUG.Printf(
+		"Imported %d users from %d records.", len(users), len(records))
+
+	return users, nil
+}
@@ -0,0 +1,197 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package credentials
+
+import (
+	"encoding/base64"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// Tests that CsvStore adheres to the Store interface.
+var _ Store = (*CsvStore)(nil)
+
+// Tests that NewCsvStore loads all the users from the CSV file.
+func TestNewCsvStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "credentials.csv")
+	err := os.WriteFile(path, []byte("waldo,hunter2\ncarmen,sandiego\n"), 0600)
+	if err != nil {
+		t.Fatalf("Failed to write CSV file: %+v", err)
+	}
+
+	cs, err := NewCsvStore(path)
+	if err != nil {
+		t.Fatalf("Failed to create new CsvStore: %+v", err)
+	}
+
+	expected := map[string]string{"waldo": "hunter2", "carmen": "sandiego"}
+	if !reflect.DeepEqual(expected, cs.passwords) {
+		t.Errorf("Unexpected passwords.\nexpected: %s\nreceived: %s",
+			expected, cs.passwords)
+	}
+}
+
+// Tests that NewCsvStore creates an empty store when the file does not exist.
+func TestNewCsvStore_NoFile(t *testing.T) {
+	cs, err := NewCsvStore(filepath.Join(t.TempDir(), "credentials.csv"))
+	if err != nil {
+		t.Fatalf("Failed to create new CsvStore: %+v", err)
+	}
+
+	if len(cs.passwords) != 0 {
+		t.Errorf("Store not empty: %s", cs.passwords)
+	}
+}
+
+// Error path: Tests that NewCsvStore returns an error for an invalid record.
+func TestNewCsvStore_InvalidRecordError(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "credentials.csv")
+	if err := os.WriteFile(path, []byte("waldo\ncarmen\n"), 0600); err != nil {
+		t.Fatalf("Failed to write CSV file: %+v", err)
+	}
+
+	if _, err := NewCsvStore(path); err == nil {
+		t.Errorf("Failed to error for invalid records.")
+	}
+}
+
+// Tests that users set with CsvStore.Set can be retrieved with CsvStore.Get,
+// listed with CsvStore.List, and removed with CsvStore.Delete.
+func TestCsvStore_Set_Get_List_Delete(t *testing.T) {
+	cs, err := NewCsvStore(filepath.Join(t.TempDir(), "credentials.csv"))
+	if err != nil {
+		t.Fatalf("Failed to create new CsvStore: %+v", err)
+	}
+	testStore(cs, t)
+}
+
+// Tests that changes made with CsvStore.Set and CsvStore.Delete are saved to
+// the CSV file and loaded by a new CsvStore.
+func TestCsvStore_Set_Delete_Persistence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dir", "credentials.csv")
+	cs, err := NewCsvStore(path)
+	if err != nil {
+		t.Fatalf("Failed to create new CsvStore: %+v", err)
+	}
+
+	for _, user := range [][2]string{
+		{"waldo", "hunter2"}, {"carmen", "sandiego"}, {"alice", "pass,word"}} {
+		if err = cs.Set(user[0], user[1]); err != nil {
+			t.Fatalf("Failed to set user %q: %+v", user[0], err)
+		}
+	}
+	if err = cs.Delete("carmen"); err != nil {
+		t.Fatalf("Failed to delete user: %+v", err)
+	}
+
+	loaded, err := NewCsvStore(path)
+	if err != nil {
+		t.Fatalf("Failed to load CsvStore: %+v", err)
+	}
+
+	expected := map[string]string{"waldo": "hunter2", "alice": "pass,word"}
+	if !reflect.DeepEqual(expected, loaded.passwords) {
+		t.Errorf("Unexpected passwords.\nexpected: %s\nreceived: %s",
+			expected, loaded.passwords)
+	}
+}
+
+// Tests that changes made to the CSV file by another CsvStore are loaded by
+// CsvStore.Get and CsvStore.List.
+func TestCsvStore_Reload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "credentials.csv")
+	cs1, err := NewCsvStore(path)
+	if err != nil {
+		t.Fatalf("Failed to create new CsvStore: %+v", err)
+	}
+	cs2, err := NewCsvStore(path)
+	if err != nil {
+		t.Fatalf("Failed to create new CsvStore: %+v", err)
+	}
+
+	if err = cs1.Set("waldo", "hunter2"); err != nil {
+		t.Fatalf("Failed to set user: %+v", err)
+	}
+	if password, err := cs2.Get("waldo"); err != nil || password != "hunter2" {
+		t.Errorf("Failed to get user set by other store (%q): %+v",
+			password, err)
+	}
+
+	if err = cs2.Set("carmen", "sandiego"); err != nil {
+		t.Fatalf("Failed to set user: %+v", err)
+	}
+	usernames, err := cs1.List()
+	if err != nil {
+		t.Fatalf("Failed to list users: %+v", err)
+	}
+	if expected := []string{"carmen", "waldo"}; !reflect.DeepEqual(
+		expected, usernames) {
+		t.Errorf("Unexpected usernames.\nexpected: %s\nreceived: %s",
+			expected, usernames)
+	}
+}
+
+// Error path: Tests that CsvStore.Get and CsvStore.Delete return
+// UserNotFoundErr for a user that is not registered.
+func TestCsvStore_UserNotFoundError(t *testing.T) {
+	cs, err := NewCsvStore(filepath.Join(t.TempDir(), "credentials.csv"))
+	if err != nil {
+		t.Fatalf("Failed to create new CsvStore: %+v", err)
+	}
+	testStoreUserNotFound(cs, t)
+}
+
+// Tests that recordsToMap returns the expected map.
+func Test_recordsToMap(t *testing.T) {
+	prng := rand.New(rand.NewSource(3459806))
+	const numTests = 100
+	records := make([][]string, numTests)
+	expected := make(map[string]string, numTests)
+	for i := range records {
+		usernameBytes := make([]byte, 3+prng.Intn(7))
+		passwordBytes := make([]byte, 3+prng.Intn(32))
+		prng.Read(usernameBytes)
+		prng.Read(passwordBytes)
+		username := base64.StdEncoding.EncodeToString(usernameBytes)
+		password := base64.StdEncoding.EncodeToString(passwordBytes)
+		records[i] = []string{username, password}
+
+		// Half of the time, add extra records
+		if prng.Intn(2) == 0 {
+			extraRecords := 1 + prng.Intn(15)
+			for j := 0; j < extraRecords; j++ {
+				extraRecord := make([]byte, 3+prng.Intn(26))
+				prng.Read(extraRecord)
+				records[i] = append(records[i],
+					base64.StdEncoding.EncodeToString(extraRecord))
+			}
+		}
+
+		expected[username] = password
+	}
+
+	recordsMap, err := recordsToMap(records)
+	if err != nil {
+		t.Errorf("Failed to convert records: %+v", err)
+	}
+	if !reflect.DeepEqual(expected, recordsMap) {
+		t.Errorf("Unexpected records map.\nexpected: %s\nreceived: %s",
+			expected, recordsMap)
+	}
+}
+
+// Error path: Tests that recordsToMap returns an error for an invalid record.
+func Test_recordsToMap_InvalidRecordError(t *testing.T) {
+	_, err := recordsToMap([][]string{{"user", "pass"}, {"user2"}})
+	if err == nil {
+		t.Errorf("Failed to error for invalid records.")
+	}
+}
@@ -0,0 +1,41 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+// Package credentials stores the passwords of the users registered with the
+// remote sync server.
+package credentials
+
+import (
+	"github.com/pkg/errors"
+)
+
+var (
+	// UserNotFoundErr is returned when the requested user is not registered.
+	UserNotFoundErr = errors.New("user not found")
+)
+
+// Store stores the password for each registered user. All implementations are
+// safe for concurrent use.
+type Store interface {
+	// Get returns the password for the user.
+	//
+	// Returns [UserNotFoundErr] if the user is not registered.
+	Get(username string) (string, error)
+
+	// Set registers the user with the given password. If the user is already
+	// registered, their password is replaced.
+	Set(username, password string) error
+
+	// Delete removes the user.
+	//
+	// Returns [UserNotFoundErr] if the user is not registered.
+	Delete(username string) error
+
+	// List returns the usernames of all registered users sorted
+	// alphabetically.
+	List() ([]string, error)
+}
@@ -0,0 +1,76 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package credentials
+
+import (
+	"sort"
+	"sync"
+)
+
+// MemStore stores user credentials in memory. Adheres to the Store interface.
+type MemStore struct {
+	passwords map[string]string // Map of username to password
+	mux       sync.RWMutex
+}
+
+// NewMemStore creates a new MemStore containing the given map of passwords
+// keyed on username. The map is copied.
+func NewMemStore(passwords map[string]string) *MemStore {
+	ms := &MemStore{passwords: make(map[string]string, len(passwords))}
+	for username, password := range passwords {
+		ms.passwords[username] = password
+	}
+	return ms
+}
+
+// Get returns the password for the user.
+//
+// Returns [UserNotFoundErr] if the user is not registered.
+func (ms *MemStore) Get(username string) (string, error) {
+	ms.mux.RLock()
+	defer ms.mux.RUnlock()
+	password, exists := ms.passwords[username]
+	if !exists {
+		return "", UserNotFoundErr
+	}
+	return password, nil
+}
+
+// Set registers the user with the given password. If the user is already
+// registered, their password is replaced.
+func (ms *MemStore) Set(username, password string) error {
+	ms.mux.Lock()
+	defer ms.mux.Unlock()
+	ms.passwords[username] = password
+	return nil
+}
+
+// Delete removes the user.
+//
+// Returns [UserNotFoundErr] if the user is not registered.
+func (ms *MemStore) Delete(username string) error {
+	ms.mux.Lock()
+	defer ms.mux.Unlock()
+	if _, exists := ms.passwords[username]; !exists {
+		return UserNotFoundErr
+	}
+	delete(ms.passwords, username)
+	return nil
+}
+
+// List returns the usernames of all registered users sorted alphabetically.
+func (ms *MemStore) List() ([]string, error) {
+	ms.mux.RLock()
+	defer ms.mux.RUnlock()
+	usernames := make([]string, 0, len(ms.passwords))
+	for username := range ms.passwords {
+		usernames = append(usernames, username)
+	}
+	sort.Strings(usernames)
+	return usernames, nil
+}
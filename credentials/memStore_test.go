@@ -0,0 +1,97 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package credentials
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+// Tests that MemStore adheres to the Store interface.
+var _ Store = (*MemStore)(nil)
+
+// Tests that NewMemStore copies the passwords map.
+func TestNewMemStore(t *testing.T) {
+	passwords := map[string]string{"waldo": "hunter2"}
+	ms := NewMemStore(passwords)
+	passwords["waldo"] = "changed"
+
+	if password, _ := ms.Get("waldo"); password != "hunter2" {
+		t.Errorf("Password changed with original map: %q", password)
+	}
+}
+
+// Tests that users set with MemStore.Set can be retrieved with MemStore.Get,
+// listed with MemStore.List, and removed with MemStore.Delete.
+func TestMemStore_Set_Get_List_Delete(t *testing.T) {
+	testStore(NewMemStore(nil), t)
+}
+
+// Error path: Tests that MemStore.Get and MemStore.Delete return
+// UserNotFoundErr for a user that is not registered.
+func TestMemStore_UserNotFoundError(t *testing.T) {
+	testStoreUserNotFound(NewMemStore(nil), t)
+}
+
+// testStore tests that users set with Store.Set can be retrieved with
+// Store.Get, listed with Store.List, and removed with Store.Delete.
+func testStore(s Store, t testing.TB) {
+	users := map[string]string{
+		"waldo": "hunter2", "carmen": "sandiego", "alice": "password"}
+	for username, password := range users {
+		if err := s.Set(username, password); err != nil {
+			t.Fatalf("Failed to set user %q: %+v", username, err)
+		}
+	}
+
+	// Replace a password
+	users["waldo"] = "hunter3"
+	if err := s.Set("waldo", users["waldo"]); err != nil {
+		t.Fatalf("Failed to replace password: %+v", err)
+	}
+
+	for username, expected := range users {
+		if password, err := s.Get(username); err != nil {
+			t.Errorf("Failed to get user %q: %+v", username, err)
+		} else if password != expected {
+			t.Errorf("Unexpected password for user %q."+
+				"\nexpected: %q\nreceived: %q", username, expected, password)
+		}
+	}
+
+	expected := []string{"alice", "carmen", "waldo"}
+	if list, err := s.List(); err != nil {
+		t.Errorf("Failed to list users: %+v", err)
+	} else if !reflect.DeepEqual(expected, list) {
+		t.Errorf("Unexpected user list.\nexpected: %s\nreceived: %s",
+			expected, list)
+	}
+
+	if err := s.Delete("carmen"); err != nil {
+		t.Errorf("Failed to delete user: %+v", err)
+	}
+	if _, err := s.Get("carmen"); !errors.Is(err, UserNotFoundErr) {
+		t.Errorf("Unexpected error getting deleted user."+
+			"\nexpected: %v\nreceived: %+v", UserNotFoundErr, err)
+	}
+}
+
+// testStoreUserNotFound tests that Store.Get and Store.Delete return
+// UserNotFoundErr for a user that is not registered.
+func testStoreUserNotFound(s Store, t testing.TB) {
+	if _, err := s.Get("waldo"); !errors.Is(err, UserNotFoundErr) {
+		t.Errorf("Unexpected error for Get.\nexpected: %v\nreceived: %+v",
+			UserNotFoundErr, err)
+	}
+	if err := s.Delete("waldo"); !errors.Is(err, UserNotFoundErr) {
+		t.Errorf("Unexpected error for Delete.\nexpected: %v\nreceived: %+v",
+			UserNotFoundErr, err)
+	}
+}
@@ -0,0 +1,110 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package credentials
+
+import (
+	"database/sql"
+
+	"github.com/pkg/errors"
+)
+
+// UsersTable is the name of the table containing the registered users.
+const UsersTable = "users"
+
+// SQLStore stores user credentials in a table of a SQL database. The queries
+// are compatible with both PostgreSQL and SQLite. Adheres to the Store
+// interface.
+type SQLStore struct {
+	db    *sql.DB
+	table string
+}
+
+// NewSQLStore creates a new SQLStore using the named table of the database.
+// The table is created if it does not already exist. The table name is not
+// escaped and must not come from user input.
+func NewSQLStore(db *sql.DB, table string) (*SQLStore, error) {
+	_, err := db.Exec(`CREATE TABLE IF NOT EXISTS ` + table + ` (
+		username TEXT PRIMARY KEY,
+		password TEXT NOT NULL
+	)`)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to create %s table", table)
+	}
+
+	return &SQLStore{db: db, table: table}, nil
+}
+
+// Get returns the password for the user.
+//
+// Returns [UserNotFoundErr] if the user is not registered.
+func (ss *SQLStore) Get(username string) (string, error) {
+	var password string
+	err := ss.db.QueryRow(
+		`SELECT password FROM `+ss.table+` WHERE username = $1`, username).
+		Scan(&password)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", UserNotFoundErr
+	} else if err != nil {
+		return "", errors.Wrapf(err, "failed to get user %q", username)
+	}
+
+	return password, nil
+}
+
+// Set registers the user with the given password. If the user is already
+// registered, their password is replaced.
+func (ss *SQLStore) Set(username, password string) error {
+	_, err := ss.db.Exec(`INSERT INTO `+ss.table+` (username, password)
+		VALUES ($1, $2)
+		ON CONFLICT (username) DO UPDATE SET password = excluded.password`,
+		username, password)
+	if err != nil {
+		return errors.Wrapf(err, "failed to set user %q", username)
+	}
+	return nil
+}
+
+// Delete removes the user.
+//
+// Returns [UserNotFoundErr] if the user is not registered.
+func (ss *SQLStore) Delete(username string) error {
+	result, err := ss.db.Exec(
+		`DELETE FROM `+ss.table+` WHERE username = $1`, username)
+	if err != nil {
+		return errors.Wrapf(err, "failed to delete user %q", username)
+	}
+
+	if n, err := result.RowsAffected(); err != nil {
+		return errors.Wrapf(err, "failed to delete user %q", username)
+	} else if n == 0 {
+		return UserNotFoundErr
+	}
+
+	return nil
+}
+
+// List returns the usernames of all registered users sorted alphabetically.
+func (ss *SQLStore) List() ([]string, error) {
+	rows, err := ss.db.Query(
+		`SELECT username FROM ` + ss.table + ` ORDER BY username`)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list users")
+	}
+	defer func() { _ = rows.Close() }()
+
+	usernames := make([]string, 0)
+	for rows.Next() {
+		var username string
+		if err = rows.Scan(&username); err != nil {
+			return nil, errors.Wrap(err, "failed to list users")
+		}
+		usernames = append(usernames, username)
+	}
+
+	return usernames, errors.Wrap(rows.Err(), "failed to list users")
+}
@@ -0,0 +1,81 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package credentials
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+
+	_ "modernc.org/sqlite"
+)
+
+// Tests that SQLStore adheres to the Store interface.
+var _ Store = (*SQLStore)(nil)
+
+// Tests that users set with SQLStore.Set can be retrieved with SQLStore.Get,
+// listed with SQLStore.List, and removed with SQLStore.Delete.
+func TestSQLStore_Set_Get_List_Delete(t *testing.T) {
+	testStore(newTestSQLStore(t), t)
+}
+
+// Error path: Tests that SQLStore.Get and SQLStore.Delete return
+// UserNotFoundErr for a user that is not registered.
+func TestSQLStore_UserNotFoundError(t *testing.T) {
+	testStoreUserNotFound(newTestSQLStore(t), t)
+}
+
+// Tests that NewSQLStore does not modify an existing users table.
+func TestNewSQLStore_ExistingTable(t *testing.T) {
+	ss := newTestSQLStore(t)
+	if err := ss.Set("waldo", "hunter2"); err != nil {
+		t.Fatalf("Failed to set user: %+v", err)
+	}
+
+	ss, err := NewSQLStore(ss.db, UsersTable)
+	if err != nil {
+		t.Fatalf("Failed to create SQLStore on existing table: %+v", err)
+	}
+	if password, err := ss.Get("waldo"); err != nil || password != "hunter2" {
+		t.Errorf("Failed to get existing user (%q): %+v", password, err)
+	}
+}
+
+// Tests that SQLStores using different tables of the same database are
+// independent.
+func TestNewSQLStore_SeparateTables(t *testing.T) {
+	users := newTestSQLStore(t)
+	pending, err := NewSQLStore(users.db, "pending_users")
+	if err != nil {
+		t.Fatalf("Failed to create SQLStore: %+v", err)
+	}
+
+	if err = pending.Set("waldo", "hunter2"); err != nil {
+		t.Fatalf("Failed to set user: %+v", err)
+	}
+	if _, err = users.Get("waldo"); err != UserNotFoundErr {
+		t.Errorf("User set in other table.\nexpected: %v\nreceived: %+v",
+			UserNotFoundErr, err)
+	}
+}
+
+// newTestSQLStore creates a new SQLStore backed by a SQLite database in a
+// temporary directory.
+func newTestSQLStore(t testing.TB) *SQLStore {
+	db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to open database: %+v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	ss, err := NewSQLStore(db, UsersTable)
+	if err != nil {
+		t.Fatalf("Failed to create SQLStore: %+v", err)
+	}
+	return ss
+}
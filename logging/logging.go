@@ -0,0 +1,271 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+// Package logging formats the jwalterweatherman logs of the server as text or
+// as JSON with structured fields.
+package logging
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Log formats.
+const (
+	// TextFormat is the default jwalterweatherman output, with the fields of
+	// an entry appended to its message as key=value pairs.
+	TextFormat = "text"
+
+	// JSONFormat writes each entry as a single-line JSON object.
+	JSONFormat = "json"
+)
+
+// fieldsMarker surrounds the JSON-encoded fields at the start of a message
+// logged with Fields in JSON format so that the JSON writer can separate them
+// from the message.
+const fieldsMarker = "\x1e"
+
+var (
+	// UnknownFormatErr is returned when the log format is not one of the
+	// supported formats.
+	UnknownFormatErr = errors.New("unknown log format")
+)
+
+// jsonFormat is true if the logs are written in JSON format.
+var jsonFormat atomic.Bool
+
+// ParseFormat returns the log format with the name, ignoring case. An empty
+// name is TextFormat.
+//
+// Returns [UnknownFormatErr] if the name is not a supported format.
+func ParseFormat(name string) (string, error) {
+	switch format := strings.ToLower(strings.TrimSpace(name)); format {
+	case "", TextFormat:
+		return TextFormat, nil
+	case JSONFormat:
+		return JSONFormat, nil
+	default:
+		return "", errors.Wrapf(UnknownFormatErr, "%q (available: %s, %s)",
+			name, TextFormat, JSONFormat)
+	}
+}
+
+// SetFormat sets the format of messages logged with Fields. In JSON format,
+// the outputs of the jwalterweatherman loggers must be wrapped with
+// NewJSONWriter and their flags set to zero so that the writer adds the
+// timestamp.
+func SetFormat(format string) {
+	jsonFormat.Store(format == JSONFormat)
+}
+
+// JSON returns true if the logs are written in JSON format.
+func JSON() bool {
+	return jsonFormat.Load()
+}
+
+// Fields are the structured fields of a log entry. Empty fields are omitted.
+type Fields struct {
+	// Component is the part of the server that logged the entry, such as
+	// "rpc".
+	Component string
+
+	// RequestID is the ID of the request being handled.
+	RequestID string
+
+	// UserID is the username of the user making the request.
+	UserID string
+
+	// Method is the full gRPC method of the request.
+	Method string
+
+	// Client is the IP address of the client that sent the request.
+	Client string
+
+	// RequestBytes and ResponseBytes are the sizes of the request and response
+	// messages.
+	RequestBytes  int
+	ResponseBytes int
+
+	// Code is the gRPC status code of the response.
+	Code string
+
+	// Latency is the time taken to handle the request.
+	Latency time.Duration
+}
+
+// jsonFields are the Fields as encoded in JSON. The latency is in seconds.
+type jsonFields struct {
+	Component     string  `json:"component,omitempty"`
+	RequestID     string  `json:"requestID,omitempty"`
+	UserID        string  `json:"userID,omitempty"`
+	Method        string  `json:"method,omitempty"`
+	Client        string  `json:"client,omitempty"`
+	RequestBytes  int     `json:"requestBytes,omitempty"`
+	ResponseBytes int     `json:"responseBytes,omitempty"`
+	Code          string  `json:"code,omitempty"`
+	Latency       float64 `json:"latency,omitempty"`
+}
+
+// Printf logs the message to the logger, such as jww.INFO, with the fields. In
+// text format, they are appended to the message as key=value pairs.
+func (f Fields) Printf(logger *log.Logger, format string, v ...interface{}) {
+	msg := fmt.Sprintf(format, v...)
+	if !JSON() {
+		if pairs := f.String(); pairs != "" {
+			msg += " " + pairs
+		}
+		logger.Print(msg)
+		return
+	}
+
+	data, err := json.Marshal(jsonFields{
+		Component:     f.Component,
+		RequestID:     f.RequestID,
+		UserID:        f.UserID,
+		Method:        f.Method,
+		Client:        f.Client,
+		RequestBytes:  f.RequestBytes,
+		ResponseBytes: f.ResponseBytes,
+		Code:          f.Code,
+		Latency:       f.Latency.Seconds(),
+	})
+	if err != nil {
+		logger.Print(msg)
+		return
+	}
+	logger.Print(fieldsMarker + string(data) + fieldsMarker + msg)
+}
+
+// String returns the non-empty fields as space-separated key=value pairs.
+// Values containing spaces or quotes are quoted.
+func (f Fields) String() string {
+	var pairs []string
+	add := func(key, value string) {
+		if value == "" {
+			return
+		} else if strings.ContainsAny(value, " \"=") {
+			value = fmt.Sprintf("%q", value)
+		}
+		pairs = append(pairs, key+"="+value)
+	}
+	add("component", f.Component)
+	add("requestID", f.RequestID)
+	add("userID", f.UserID)
+	add("method", f.Method)
+	add("client", f.Client)
+	if f.RequestBytes != 0 {
+		add("requestBytes", strconv.Itoa(f.RequestBytes))
+	}
+	if f.ResponseBytes != 0 {
+		add("responseBytes", strconv.Itoa(f.ResponseBytes))
+	}
+	add("code", f.Code)
+	if f.Latency != 0 {
+		add("latency", f.Latency.String())
+	}
+	return strings.Join(pairs, " ")
+}
+
+// jsonEntry is a log entry written by the JSON writer.
+type jsonEntry struct {
+	Time    string `json:"time"`
+	Level   string `json:"level"`
+	Message string `json:"msg"`
+	jsonFields
+}
+
+// jsonWriter converts each line written by a jwalterweatherman logger without
+// flags, which has the form "<LEVEL> <message>", into a JSON object.
+type jsonWriter struct {
+	w   io.Writer
+	now func() time.Time
+	mux sync.Mutex
+}
+
+// NewJSONWriter returns a writer that writes each jwalterweatherman log entry
+// written to it to w as a JSON object on its own line, with the time, level,
+// message, and any fields logged with Fields.
+func NewJSONWriter(w io.Writer) io.Writer {
+	return &jsonWriter{w: w, now: time.Now}
+}
+
+// Write converts the log entry to JSON and writes it. Each call to Write is a
+// single entry, as written by log.Logger.
+func (jw *jsonWriter) Write(p []byte) (int, error) {
+	level, msg, _ := strings.Cut(strings.TrimSuffix(string(p), "\n"), " ")
+	entry := jsonEntry{
+		Time:  jw.now().UTC().Format(time.RFC3339Nano),
+		Level: strings.ToLower(level),
+	}
+	if strings.HasPrefix(msg, fieldsMarker) {
+		fields, rest, found := strings.Cut(msg[len(fieldsMarker):], fieldsMarker)
+		if found && json.Unmarshal([]byte(fields), &entry.jsonFields) == nil {
+			msg = rest
+		}
+	}
+	entry.Message = msg
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to encode log entry")
+	}
+
+	jw.mux.Lock()
+	defer jw.mux.Unlock()
+	if _, err = jw.w.Write(append(data, '\n')); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// timestampPattern matches the date and time that the standard log flags add
+// to the start of each entry.
+var timestampPattern = regexp.MustCompile(
+	`^(\d{4}/\d{2}/\d{2} )?(\d{2}:\d{2}:\d{2}(\.\d+)? )?`)
+
+// Message returns the message of a log entry, as written by a
+// jwalterweatherman logger, without its level and timestamp. Fields logged in
+// JSON format are appended to the message as key=value pairs, as in text
+// format, so that the message is the same in both formats.
+func Message(entry string) string {
+	_, msg, _ := strings.Cut(strings.TrimSuffix(entry, "\n"), " ")
+	msg = msg[len(timestampPattern.FindString(msg)):]
+	if !strings.HasPrefix(msg, fieldsMarker) {
+		return msg
+	}
+
+	data, rest, found := strings.Cut(msg[len(fieldsMarker):], fieldsMarker)
+	var jf jsonFields
+	if !found || json.Unmarshal([]byte(data), &jf) != nil {
+		return msg
+	}
+	f := Fields{
+		Component:     jf.Component,
+		RequestID:     jf.RequestID,
+		UserID:        jf.UserID,
+		Method:        jf.Method,
+		Client:        jf.Client,
+		RequestBytes:  jf.RequestBytes,
+		ResponseBytes: jf.ResponseBytes,
+		Code:          jf.Code,
+		Latency:       time.Duration(jf.Latency * float64(time.Second)),
+	}
+	if pairs := f.String(); pairs != "" {
+		rest += " " + pairs
+	}
+	return rest
+}
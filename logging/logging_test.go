@@ -0,0 +1,166 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Tests that ParseFormat returns the format for each supported name.
+func TestParseFormat(t *testing.T) {
+	tests := map[string]string{
+		"":       TextFormat,
+		"text":   TextFormat,
+		" JSON ": JSONFormat,
+		"json":   JSONFormat,
+	}
+	for name, expected := range tests {
+		format, err := ParseFormat(name)
+		if err != nil {
+			t.Errorf("Failed to parse %q: %+v", name, err)
+		} else if format != expected {
+			t.Errorf("Unexpected format for %q.\nexpected: %s\nreceived: %s",
+				name, expected, format)
+		}
+	}
+}
+
+// Error path: Tests that ParseFormat returns UnknownFormatErr for an
+// unsupported format.
+func TestParseFormat_UnknownFormatError(t *testing.T) {
+	_, err := ParseFormat("logfmt")
+	if !errors.Is(err, UnknownFormatErr) {
+		t.Errorf("Unexpected error.\nexpected: %v\nreceived: %+v",
+			UnknownFormatErr, err)
+	}
+}
+
+// Tests that Fields.Printf appends the fields to the message as key=value
+// pairs in text format.
+func TestFields_Printf_Text(t *testing.T) {
+	SetFormat(TextFormat)
+	var buf bytes.Buffer
+	logger := log.New(&buf, "INFO ", 0)
+
+	Fields{Component: "rpc", UserID: "waldo smith", Client: "10.0.0.7",
+		RequestBytes: 12, Code: "OK", Latency: 1500 * time.Microsecond}.Printf(
+		logger, "RPC %s", "completed")
+	expected := `INFO RPC completed component=rpc userID="waldo smith" ` +
+		"client=10.0.0.7 requestBytes=12 code=OK latency=1.5ms\n"
+	if buf.String() != expected {
+		t.Errorf("Unexpected log.\nexpected: %q\nreceived: %q",
+			expected, buf.String())
+	}
+
+	buf.Reset()
+	Fields{}.Printf(logger, "no fields")
+	if buf.String() != "INFO no fields\n" {
+		t.Errorf("Unexpected log.\nexpected: %q\nreceived: %q",
+			"INFO no fields\n", buf.String())
+	}
+}
+
+// Tests that entries written through the JSON writer, with and without
+// fields, are encoded as JSON objects with the level, message, and fields.
+func TestNewJSONWriter(t *testing.T) {
+	SetFormat(JSONFormat)
+	defer SetFormat(TextFormat)
+	var buf bytes.Buffer
+	w := NewJSONWriter(&buf)
+	now := time.Date(2023, 7, 20, 14, 3, 11, 0, time.UTC)
+	w.(*jsonWriter).now = func() time.Time { return now }
+	logger := log.New(w, "DEBUG ", 0)
+
+	logger.Printf("plain message with \"quotes\"\nand lines")
+	Fields{
+		Component:     "rpc",
+		RequestID:     "abc",
+		UserID:        "waldo",
+		Method:        "/remoteSync.Info/GetVersion",
+		Client:        "::1",
+		RequestBytes:  3,
+		ResponseBytes: 40,
+		Code:          "OK",
+		Latency:       250 * time.Millisecond,
+	}.Printf(logger, "RPC completed: %s", "OK")
+
+	expected := []jsonEntry{
+		{
+			Time:    "2023-07-20T14:03:11Z",
+			Level:   "debug",
+			Message: "plain message with \"quotes\"\nand lines",
+		},
+		{
+			Time:    "2023-07-20T14:03:11Z",
+			Level:   "debug",
+			Message: "RPC completed: OK",
+			jsonFields: jsonFields{
+				Component:     "rpc",
+				RequestID:     "abc",
+				UserID:        "waldo",
+				Method:        "/remoteSync.Info/GetVersion",
+				Client:        "::1",
+				RequestBytes:  3,
+				ResponseBytes: 40,
+				Code:          "OK",
+				Latency:       0.25,
+			},
+		},
+	}
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	if len(lines) != len(expected) {
+		t.Fatalf("Unexpected number of lines.\nexpected: %d\nreceived: %d",
+			len(expected), len(lines))
+	}
+	for i, line := range lines {
+		var entry jsonEntry
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Errorf("Failed to decode line %d %q: %+v", i, line, err)
+		} else if !reflect.DeepEqual(expected[i], entry) {
+			t.Errorf("Unexpected entry %d.\nexpected: %+v\nreceived: %+v",
+				i, expected[i], entry)
+		}
+	}
+}
+
+// Tests that Message strips the level and timestamp from entries in text
+// format and appends the fields of entries in JSON format as key=value pairs.
+func TestMessage(t *testing.T) {
+	tests := map[string]string{
+		"ERROR 2023/07/20 14:03:11 failed\n":                "failed",
+		"ERROR 2023/07/20 14:03:11.123456 failed: 12:00:00": "failed: 12:00:00",
+		"WARN plain message\n":                              "plain message",
+		"ERROR \x1ebad json\x1emessage":                     "\x1ebad json\x1emessage",
+		"ERROR":                                             "",
+	}
+	for entry, expected := range tests {
+		if msg := Message(entry); msg != expected {
+			t.Errorf("Unexpected message of %q.\nexpected: %q\nreceived: %q",
+				entry, expected, msg)
+		}
+	}
+
+	SetFormat(JSONFormat)
+	defer SetFormat(TextFormat)
+	var buf bytes.Buffer
+	Fields{Component: "rpc", UserID: "waldo smith", Latency: time.Second}.Printf(
+		log.New(&buf, "ERROR ", 0), "RPC %s", "failed")
+	expected := `RPC failed component=rpc userID="waldo smith" latency=1s`
+	if msg := Message(buf.String()); msg != expected {
+		t.Errorf("Unexpected message of JSON entry.\nexpected: %q\nreceived: %q",
+			expected, msg)
+	}
+}
@@ -0,0 +1,13 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+// Package rpc contains the gRPC services provided by the remote sync server in
+// addition to the RemoteSync service defined in the comms library. They are
+// served on the same port.
+package rpc
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative admin.proto batch.proto changes.proto conditional.proto delta.proto directory.proto download.proto history.proto info.proto links.proto metadata.proto migration.proto registration.proto replication.proto session.proto transaction.proto upload.proto
@@ -0,0 +1,101 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package server
+
+import (
+	"context"
+	"math/rand"
+	"time"
+
+	"github.com/pkg/errors"
+	jww "github.com/spf13/jwalterweatherman"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+
+	"gitlab.com/elixxir/remoteSyncServer/logging"
+)
+
+// defaultAccessLogSampleRate is the fraction of successful requests logged if
+// the sample rate is not set.
+const defaultAccessLogSampleRate = 1.0
+
+// AccessLogParams are the parameters of the access log.
+type AccessLogParams struct {
+	// SampleRate is the fraction of successful requests logged, from 0 to 1.
+	// Failed requests are always logged. Defaults to 1.
+	SampleRate float64 `mapstructure:"sampleRate"`
+}
+
+// AccessLog logs a single line for each request, over gRPC, gRPC-web, or REST,
+// with its method, user, client address, request and response sizes, status,
+// and duration. Successful requests can be sampled to reduce the volume of
+// logs on busy servers.
+type AccessLog struct {
+	params AccessLogParams
+
+	// sample returns true if a successful request is logged. Replaced in
+	// tests.
+	sample func() bool
+}
+
+// NewAccessLog creates a new AccessLog from the parameters.
+func NewAccessLog(params map[string]interface{}) (*AccessLog, error) {
+	p := AccessLogParams{SampleRate: defaultAccessLogSampleRate}
+	if err := decodeParams(params, &p, "access log"); err != nil {
+		return nil, err
+	}
+	if p.SampleRate < 0 || p.SampleRate > 1 {
+		return nil, errors.Errorf(
+			"sample rate %g must be between 0 and 1", p.SampleRate)
+	}
+
+	al := &AccessLog{params: p}
+	al.sample = func() bool { return rand.Float64() < al.params.SampleRate }
+	return al, nil
+}
+
+// interceptor returns an interceptor that logs each request that is sampled or
+// fails. The request ID is taken from the context set by logInterceptor.
+func (al *AccessLog) interceptor(h *handler) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{},
+		info *grpc.UnaryServerInfo, next grpc.UnaryHandler) (interface{}, error) {
+		start := time.Now()
+		username := requestUsername(h, req)
+
+		resp, err := next(ctx, req)
+
+		code := status.Code(err)
+		if code == codes.OK && !al.sample() {
+			return resp, err
+		}
+		fields := logging.Fields{
+			Component:     "access",
+			RequestID:     requestID(ctx),
+			UserID:        username,
+			Method:        info.FullMethod,
+			Client:        peerIP(ctx),
+			RequestBytes:  messageSize(req),
+			ResponseBytes: messageSize(resp),
+			Code:          code.String(),
+			Latency:       time.Since(start),
+		}
+		fields.Printf(jww.INFO, "%s %s", info.FullMethod, code)
+		return resp, err
+	}
+}
+
+// messageSize returns the encoded size of the protobuf message or zero if it
+// is not a message.
+func messageSize(m interface{}) int {
+	if msg, ok := m.(proto.Message); ok {
+		return proto.Size(msg)
+	}
+	return 0
+}
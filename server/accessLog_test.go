@@ -0,0 +1,156 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package server
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	jww "github.com/spf13/jwalterweatherman"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/peer"
+
+	pb "gitlab.com/elixxir/comms/mixmessages"
+	"gitlab.com/elixxir/remoteSyncServer/credentials"
+	"gitlab.com/elixxir/remoteSyncServer/logging"
+	"gitlab.com/elixxir/remoteSyncServer/store"
+)
+
+// Tests that NewAccessLog uses the sample rate from the parameters or the
+// default.
+func TestNewAccessLog(t *testing.T) {
+	tests := []struct {
+		params   map[string]interface{}
+		expected float64
+	}{
+		{map[string]interface{}{}, defaultAccessLogSampleRate},
+		{map[string]interface{}{"sampleRate": "0.05"}, 0.05},
+		{map[string]interface{}{"sampleRate": 0}, 0},
+	}
+	for i, tt := range tests {
+		al, err := NewAccessLog(tt.params)
+		if err != nil {
+			t.Errorf("Failed to create access log %d: %+v", i, err)
+		} else if al.params.SampleRate != tt.expected {
+			t.Errorf("Unexpected sample rate %d.\nexpected: %g\nreceived: %g",
+				i, tt.expected, al.params.SampleRate)
+		}
+	}
+}
+
+// Error path: Tests that NewAccessLog returns an error for a sample rate out of
+// range or unknown parameters.
+func TestNewAccessLog_Error(t *testing.T) {
+	tests := []map[string]interface{}{
+		{"sampleRate": -0.1},
+		{"sampleRate": 1.5},
+		{"sampleRate": "all"},
+		{"enabled": true},
+	}
+	for i, params := range tests {
+		if _, err := NewAccessLog(params); err == nil {
+			t.Errorf("Failed to get error for parameters %d: %v", i, params)
+		}
+	}
+}
+
+// Tests that the interceptor of the AccessLog logs the fields of requests that
+// are sampled and of all failed requests.
+func TestAccessLog_interceptor(t *testing.T) {
+	logging.SetFormat(logging.TextFormat)
+	var buf bytes.Buffer
+	jww.SetLogOutput(&buf)
+	jww.SetLogThreshold(jww.LevelInfo)
+	defer func() {
+		jww.SetLogOutput(io.Discard)
+		jww.SetLogThreshold(jww.LevelWarn)
+	}()
+
+	al, err := NewAccessLog(map[string]interface{}{"sampleRate": 0})
+	if err != nil {
+		t.Fatalf("Failed to create access log: %+v", err)
+	}
+	h := newHandler("", time.Hour, credentials.NewMemStore(
+		map[string]string{"waldo": "hunter2"}), nil, store.NewMemStore)
+	session, err := h.addSession("waldo")
+	if err != nil {
+		t.Fatalf("Failed to add session: %+v", err)
+	}
+	token := Token(session.Value)
+	ctx := peer.NewContext(context.Background(),
+		&peer.Peer{Addr: &net.TCPAddr{IP: net.ParseIP("10.0.0.7"), Port: 5}})
+	ctx = context.WithValue(ctx, requestIDKey{}, "req-1")
+	interceptor := al.interceptor(h)
+
+	write := &pb.RsWriteRequest{
+		Path: "file", Data: []byte("data"), Token: token.Marshal()}
+	read := &pb.RsReadRequest{Path: "file", Token: token.Marshal()}
+	call := func(method string, req interface{}) {
+		_, _ = interceptor(ctx, req, &grpc.UnaryServerInfo{FullMethod: method},
+			func(ctx context.Context, req interface{}) (interface{}, error) {
+				if msg, ok := req.(*pb.RsWriteRequest); ok {
+					return h.Write(ctx, msg)
+				}
+				return h.Read(ctx, req.(*pb.RsReadRequest))
+			})
+	}
+
+	// Successful requests are not sampled, but the failed read is logged
+	call("/mixmessages.RemoteSync/Write", write)
+	call("/mixmessages.RemoteSync/Read",
+		&pb.RsReadRequest{Path: "missing", Token: token.Marshal()})
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 1 {
+		t.Fatalf("Unexpected number of log lines.\nexpected: %d\nreceived: %d"+
+			"\n%s", 1, len(lines), buf.String())
+	}
+	for _, pair := range []string{"component=access", "requestID=req-1",
+		"userID=waldo", "method=/mixmessages.RemoteSync/Read",
+		"client=10.0.0.7", "code=Unknown", "latency="} {
+		if !strings.Contains(lines[0], pair) {
+			t.Errorf("Log line does not contain %q: %s", pair, lines[0])
+		}
+	}
+	if strings.Contains(lines[0], "responseBytes=") {
+		t.Errorf("Log line of failed request has a response size: %s",
+			lines[0])
+	}
+
+	// Sampled successful requests are logged with their sizes
+	buf.Reset()
+	al.sample = func() bool { return true }
+	call("/mixmessages.RemoteSync/Read", read)
+	resp, _ := h.Read(ctx, read)
+	for _, pair := range []string{"code=OK",
+		"requestBytes=" + strconv.Itoa(messageSize(read)),
+		"responseBytes=" + strconv.Itoa(messageSize(resp))} {
+		if !strings.Contains(buf.String(), pair) {
+			t.Errorf("Log line does not contain %q: %s", pair, buf.String())
+		}
+	}
+}
+
+// Tests that messageSize returns the size of protobuf messages and zero for
+// nil and other values.
+func Test_messageSize(t *testing.T) {
+	msg := &pb.RsReadRequest{Path: "dir/file"}
+	if size := messageSize(msg); size != 10 {
+		t.Errorf("Unexpected size.\nexpected: %d\nreceived: %d", 10, size)
+	}
+	for _, m := range []interface{}{nil, (*pb.RsReadResponse)(nil), "text"} {
+		if size := messageSize(m); size != 0 {
+			t.Errorf("Unexpected size of %#v: %d", m, size)
+		}
+	}
+}
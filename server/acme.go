@@ -0,0 +1,579 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package server
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	jww "github.com/spf13/jwalterweatherman"
+	"golang.org/x/crypto/acme"
+
+	"gitlab.com/xx_network/primitives/utils"
+)
+
+// Supported ACME challenge types.
+const (
+	// ChallengeHTTP01 proves control of a domain by serving a token over plain
+	// HTTP on port 80 of the domain.
+	ChallengeHTTP01 = "http-01"
+
+	// ChallengeDNS01 proves control of a domain with a TXT record created by
+	// the DNS hook.
+	ChallengeDNS01 = "dns-01"
+)
+
+// Actions passed to the DNS hook as its first argument.
+const (
+	dnsHookPresent = "present"
+	dnsHookCleanup = "cleanup"
+)
+
+// Names of the files saved in the ACME cache directory.
+const (
+	acmeAccountKeyFile = "account.key"
+	acmeCertFile       = "cert.pem"
+	acmeKeyFile        = "key.pem"
+)
+
+const (
+	defaultACMECacheDir    = "~/acme"
+	defaultACMEHTTPAddress = ":80"
+	defaultACMERenewBefore = 30 * 24 * time.Hour
+
+	// acmeCheckInterval is how often the certificate is checked for renewal.
+	// Failed renewals are retried at the same interval.
+	acmeCheckInterval = 12 * time.Hour
+
+	// acmeObtainTimeout is the maximum time to obtain a certificate.
+	acmeObtainTimeout = 5 * time.Minute
+
+	// acmeCacheDirPerm and acmeCacheFilePerm are the permissions of the cache
+	// directory and its files, which contain private keys.
+	acmeCacheDirPerm  = os.FileMode(0700)
+	acmeCacheFilePerm = os.FileMode(0600)
+)
+
+// ACMEParams are the parameters for obtaining the server certificate from an
+// ACME certificate authority, such as Let's Encrypt.
+type ACMEParams struct {
+	// Domains are the DNS names on the certificate. The first is its subject.
+	Domains []string `mapstructure:"domains"`
+
+	// Email is the optional contact address of the ACME account, used by the
+	// CA for expiry notices.
+	Email string `mapstructure:"email"`
+
+	// CacheDir is the directory where the account key and certificate are
+	// saved. Defaults to "~/acme".
+	CacheDir string `mapstructure:"cacheDir"`
+
+	// DirectoryURL is the directory of the ACME CA. Defaults to the Let's
+	// Encrypt production directory.
+	DirectoryURL string `mapstructure:"directoryURL"`
+
+	// Challenge is the challenge type used to prove control of the domains
+	// ("http-01" or "dns-01"). Defaults to "http-01".
+	Challenge string `mapstructure:"challenge"`
+
+	// HTTPAddress is the address the HTTP-01 challenge server listens on. The
+	// CA always connects to port 80. Defaults to ":80".
+	HTTPAddress string `mapstructure:"httpAddress"`
+
+	// DNSHook is the command run to create and delete the TXT records of
+	// DNS-01 challenges. Required for "dns-01".
+	DNSHook string `mapstructure:"dnsHook"`
+
+	// DNSWait is the time to wait after creating the TXT records for them to
+	// propagate before asking the CA to check them.
+	DNSWait time.Duration `mapstructure:"dnsWait"`
+
+	// RenewBefore is how long before expiry the certificate is renewed.
+	// Defaults to 30 days.
+	RenewBefore time.Duration `mapstructure:"renewBefore"`
+}
+
+// ACMEManager obtains the server certificate from an ACME CA and renews it
+// before it expires. The current certificate is served through
+// GetCertificate, so renewals take effect without a restart.
+type ACMEManager struct {
+	params ACMEParams
+	client *acme.Client
+
+	cert    *tls.Certificate
+	certMux sync.RWMutex
+
+	// httpTokens maps the URL paths of pending HTTP-01 challenges to their
+	// responses.
+	httpTokens map[string]string
+	httpMux    sync.Mutex
+	httpServer *http.Server
+}
+
+// NewACMEManager creates a new ACMEManager from the parameters. The account
+// key is loaded from the cache directory or generated, and a cached
+// certificate is loaded if one exists. No certificate is requested until the
+// manager is started.
+func NewACMEManager(params map[string]interface{}) (*ACMEManager, error) {
+	p := ACMEParams{
+		CacheDir:     defaultACMECacheDir,
+		DirectoryURL: acme.LetsEncryptURL,
+		Challenge:    ChallengeHTTP01,
+		HTTPAddress:  defaultACMEHTTPAddress,
+		RenewBefore:  defaultACMERenewBefore,
+	}
+	err := decodeParams(params, &p, "ACME")
+	if err != nil {
+		return nil, err
+	}
+
+	if len(p.Domains) == 0 {
+		return nil, errors.New("at least one ACME domain is required")
+	}
+	switch p.Challenge {
+	case ChallengeHTTP01:
+	case ChallengeDNS01:
+		if p.DNSHook == "" {
+			return nil, errors.Errorf(
+				"a DNS hook is required for %s challenges", ChallengeDNS01)
+		}
+	default:
+		return nil, errors.Errorf("unknown ACME challenge %q (available: "+
+			"%s, %s)", p.Challenge, ChallengeHTTP01, ChallengeDNS01)
+	}
+
+	p.CacheDir, err = utils.ExpandPath(p.CacheDir)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid ACME cache directory %q",
+			p.CacheDir)
+	}
+	if err = os.MkdirAll(p.CacheDir, acmeCacheDirPerm); err != nil {
+		return nil, errors.Wrapf(err,
+			"failed to create ACME cache directory %s", p.CacheDir)
+	}
+
+	accountKey, err := loadOrCreateKey(
+		filepath.Join(p.CacheDir, acmeAccountKeyFile))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to load ACME account key")
+	}
+
+	am := &ACMEManager{
+		params:     p,
+		client:     &acme.Client{Key: accountKey, DirectoryURL: p.DirectoryURL},
+		httpTokens: make(map[string]string),
+	}
+
+	cert, err := tls.LoadX509KeyPair(
+		filepath.Join(p.CacheDir, acmeCertFile),
+		filepath.Join(p.CacheDir, acmeKeyFile))
+	if err == nil {
+		if err = am.setCertificate(&cert); err != nil {
+			return nil, errors.Wrap(err, "invalid cached certificate")
+		}
+		jww.INFO.Printf("Loaded ACME certificate for %s expiring %s.",
+			strings.Join(cert.Leaf.DNSNames, ", "), cert.Leaf.NotAfter)
+	} else if !os.IsNotExist(errors.Cause(err)) {
+		jww.WARN.Printf("Ignoring unreadable cached ACME certificate: %+v",
+			err)
+	}
+
+	return am, nil
+}
+
+// GetCertificate returns the current certificate. It is used as
+// tls.Config.GetCertificate.
+func (am *ACMEManager) GetCertificate(
+	*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	am.certMux.RLock()
+	defer am.certMux.RUnlock()
+	if am.cert == nil {
+		return nil, errors.New("no certificate has been obtained yet")
+	}
+	return am.cert, nil
+}
+
+// start starts the HTTP-01 challenge server, listened on with the function,
+// obtains a certificate if there is no valid cached one, and renews it in the
+// background until the stop channel is closed.
+func (am *ACMEManager) start(listen listenFunc, stop <-chan struct{}) error {
+	if am.params.Challenge == ChallengeHTTP01 {
+		if err := am.serveHTTP(listen); err != nil {
+			return err
+		}
+		go func() {
+			<-stop
+			_ = am.httpServer.Close()
+		}()
+	}
+
+	if am.needsRenewal(time.Now()) {
+		ctx, cancel := context.WithTimeout(
+			context.Background(), acmeObtainTimeout)
+		defer cancel()
+		if err := am.obtain(ctx); err != nil {
+			if _, cacheErr := am.GetCertificate(nil); cacheErr != nil {
+				return errors.Wrap(err, "failed to obtain ACME certificate")
+			}
+			jww.ERROR.Printf("Failed to renew ACME certificate; using the "+
+				"cached certificate until the next attempt: %+v", err)
+		}
+	}
+
+	go am.renew(acmeCheckInterval, stop)
+	return nil
+}
+
+// renew obtains a new certificate every interval if the current one is due
+// for renewal until the stop channel is closed.
+func (am *ACMEManager) renew(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case now := <-ticker.C:
+			if !am.needsRenewal(now) {
+				continue
+			}
+			ctx, cancel := context.WithTimeout(
+				context.Background(), acmeObtainTimeout)
+			if err := am.obtain(ctx); err != nil {
+				jww.ERROR.Printf("Failed to renew ACME certificate; "+
+					"retrying in %s: %+v", interval, err)
+			}
+			cancel()
+		}
+	}
+}
+
+// needsRenewal returns true if there is no certificate, it does not cover all
+// the domains, or it expires within the renewal period at the given time.
+func (am *ACMEManager) needsRenewal(now time.Time) bool {
+	am.certMux.RLock()
+	defer am.certMux.RUnlock()
+	if am.cert == nil {
+		return true
+	}
+
+	for _, domain := range am.params.Domains {
+		if am.cert.Leaf.VerifyHostname(domain) != nil {
+			return true
+		}
+	}
+
+	return now.Add(am.params.RenewBefore).After(am.cert.Leaf.NotAfter)
+}
+
+// obtain requests a new certificate for the domains from the CA, saves it to
+// the cache directory, and starts serving it.
+func (am *ACMEManager) obtain(ctx context.Context) error {
+	jww.INFO.Printf("Requesting ACME certificate for %s from %s.",
+		strings.Join(am.params.Domains, ", "), am.params.DirectoryURL)
+
+	var contact []string
+	if am.params.Email != "" {
+		contact = []string{"mailto:" + am.params.Email}
+	}
+	_, err := am.client.Register(
+		ctx, &acme.Account{Contact: contact}, acme.AcceptTOS)
+	if err != nil && err != acme.ErrAccountAlreadyExists {
+		return errors.Wrap(err, "failed to register ACME account")
+	}
+
+	order, err := am.client.AuthorizeOrder(
+		ctx, acme.DomainIDs(am.params.Domains...))
+	if err != nil {
+		return errors.Wrap(err, "failed to create order")
+	}
+	for _, authzURL := range order.AuthzURLs {
+		if err = am.authorize(ctx, authzURL); err != nil {
+			return err
+		}
+	}
+	order, err = am.client.WaitOrder(ctx, order.URI)
+	if err != nil {
+		return errors.Wrap(err, "order failed")
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return errors.Wrap(err, "failed to generate certificate key")
+	}
+	csr, err := x509.CreateCertificateRequest(rand.Reader,
+		&x509.CertificateRequest{DNSNames: am.params.Domains}, key)
+	if err != nil {
+		return errors.Wrap(err, "failed to create certificate request")
+	}
+	der, _, err := am.client.CreateOrderCert(ctx, order.FinalizeURL, csr, true)
+	if err != nil {
+		return errors.Wrap(err, "failed to finalize order")
+	}
+
+	cert := &tls.Certificate{Certificate: der, PrivateKey: key}
+	if err = am.setCertificate(cert); err != nil {
+		return errors.Wrap(err, "CA returned an invalid certificate")
+	}
+	if err = am.saveCertificate(cert); err != nil {
+		jww.ERROR.Printf("Failed to cache ACME certificate; a new one will "+
+			"be requested on restart: %+v", err)
+	}
+
+	jww.INFO.Printf("Obtained ACME certificate expiring %s.",
+		cert.Leaf.NotAfter)
+	return nil
+}
+
+// authorize completes the challenge of the authorization at the URL if it is
+// not already valid.
+func (am *ACMEManager) authorize(ctx context.Context, authzURL string) error {
+	authz, err := am.client.GetAuthorization(ctx, authzURL)
+	if err != nil {
+		return errors.Wrap(err, "failed to get authorization")
+	}
+	if authz.Status == acme.StatusValid {
+		return nil
+	}
+	domain := authz.Identifier.Value
+
+	var chal *acme.Challenge
+	for _, c := range authz.Challenges {
+		if c.Type == am.params.Challenge {
+			chal = c
+			break
+		}
+	}
+	if chal == nil {
+		return errors.Errorf("CA does not offer a %s challenge for %s",
+			am.params.Challenge, domain)
+	}
+
+	switch chal.Type {
+	case ChallengeHTTP01:
+		response, err := am.client.HTTP01ChallengeResponse(chal.Token)
+		if err != nil {
+			return errors.Wrap(err, "failed to create HTTP-01 response")
+		}
+		path := am.client.HTTP01ChallengePath(chal.Token)
+		am.setHTTPToken(path, response)
+		defer am.setHTTPToken(path, "")
+	case ChallengeDNS01:
+		record, err := am.client.DNS01ChallengeRecord(chal.Token)
+		if err != nil {
+			return errors.Wrap(err, "failed to create DNS-01 record")
+		}
+		name := dns01RecordName(domain)
+		if err = am.runDNSHook(ctx, dnsHookPresent, name, record); err != nil {
+			return err
+		}
+		defer func() {
+			err := am.runDNSHook(context.Background(), dnsHookCleanup, name,
+				record)
+			if err != nil {
+				jww.WARN.Printf("Failed to remove DNS record %s: %+v", name,
+					err)
+			}
+		}()
+		if am.params.DNSWait > 0 {
+			jww.INFO.Printf("Waiting %s for DNS record %s to propagate.",
+				am.params.DNSWait, name)
+			select {
+			case <-time.After(am.params.DNSWait):
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+	}
+
+	if _, err = am.client.Accept(ctx, chal); err != nil {
+		return errors.Wrapf(err, "failed to accept challenge for %s", domain)
+	}
+	if _, err = am.client.WaitAuthorization(ctx, authz.URI); err != nil {
+		return errors.Wrapf(err, "failed to authorize %s", domain)
+	}
+
+	jww.INFO.Printf("Authorized %s with %s challenge.", domain, chal.Type)
+	return nil
+}
+
+// serveHTTP listens on the HTTP address with the function and serves HTTP-01
+// challenge responses in the background.
+func (am *ACMEManager) serveHTTP(listen listenFunc) error {
+	listener, err := listen(am.params.HTTPAddress)
+	if err != nil {
+		return errors.Wrapf(err, "failed to listen for HTTP-01 challenges "+
+			"on %s", am.params.HTTPAddress)
+	}
+	am.httpServer = &http.Server{
+		Handler:           am,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	go func() {
+		jww.INFO.Printf("Serving ACME HTTP-01 challenges on %s.",
+			listener.Addr())
+		err := am.httpServer.Serve(listener)
+		if err != nil && err != http.ErrServerClosed {
+			jww.ERROR.Printf("Failed to serve HTTP-01 challenges: %+v", err)
+		}
+	}()
+
+	return nil
+}
+
+// ServeHTTP responds to HTTP-01 challenge requests. All other requests are
+// not found, since the sync server is only served over HTTPS.
+func (am *ACMEManager) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	am.httpMux.Lock()
+	response, exists := am.httpTokens[r.URL.Path]
+	am.httpMux.Unlock()
+
+	if !exists {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain")
+	_, _ = w.Write([]byte(response))
+}
+
+// setHTTPToken sets the HTTP-01 challenge response served at the path. An
+// empty response removes it.
+func (am *ACMEManager) setHTTPToken(path, response string) {
+	am.httpMux.Lock()
+	defer am.httpMux.Unlock()
+	if response == "" {
+		delete(am.httpTokens, path)
+	} else {
+		am.httpTokens[path] = response
+	}
+}
+
+// runDNSHook runs the DNS hook with the action ("present" or "cleanup"), the
+// name of the TXT record, and its value as arguments.
+func (am *ACMEManager) runDNSHook(
+	ctx context.Context, action, name, value string) error {
+	cmd := exec.CommandContext(ctx, am.params.DNSHook, action, name, value)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return errors.Wrapf(err, "DNS hook %s %s failed: %s", action, name,
+			strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// setCertificate parses the leaf of the certificate and starts serving it.
+func (am *ACMEManager) setCertificate(cert *tls.Certificate) error {
+	if len(cert.Certificate) == 0 {
+		return errors.New("certificate chain is empty")
+	}
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		return err
+	}
+	cert.Leaf = leaf
+
+	am.certMux.Lock()
+	defer am.certMux.Unlock()
+	am.cert = cert
+	return nil
+}
+
+// saveCertificate saves the certificate chain and its key to the cache
+// directory.
+func (am *ACMEManager) saveCertificate(cert *tls.Certificate) error {
+	var chain []byte
+	for _, der := range cert.Certificate {
+		chain = append(chain,
+			pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})...)
+	}
+	keyPem, err := encodeKey(cert.PrivateKey.(*ecdsa.PrivateKey))
+	if err != nil {
+		return err
+	}
+
+	// The key is written first so that the pair on disk never has a new
+	// certificate with an old key
+	err = writeCacheFile(filepath.Join(am.params.CacheDir, acmeKeyFile), keyPem)
+	if err != nil {
+		return err
+	}
+	return writeCacheFile(filepath.Join(am.params.CacheDir, acmeCertFile), chain)
+}
+
+// dns01RecordName returns the name of the TXT record for the DNS-01 challenge
+// of the domain. Wildcard domains use the record of their base domain.
+func dns01RecordName(domain string) string {
+	return "_acme-challenge." + strings.TrimPrefix(domain, "*.")
+}
+
+// loadOrCreateKey loads the PEM-encoded ECDSA key at the path or, if it does
+// not exist, generates a new key and saves it there.
+func loadOrCreateKey(path string) (crypto.Signer, error) {
+	data, err := os.ReadFile(path)
+	if err == nil {
+		block, _ := pem.Decode(data)
+		if block == nil {
+			return nil, errors.Errorf("no PEM data in %s", path)
+		}
+		return x509.ParseECPrivateKey(block.Bytes)
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	keyPem, err := encodeKey(key)
+	if err != nil {
+		return nil, err
+	}
+	if err = writeCacheFile(path, keyPem); err != nil {
+		return nil, err
+	}
+
+	return key, nil
+}
+
+// writeCacheFile writes the data to a temporary file and then renames it to
+// the path so that the file is never left partially written.
+func writeCacheFile(path string, data []byte) error {
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, acmeCacheFilePerm); err != nil {
+		return errors.Wrapf(err, "failed to write %s", tmpPath)
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		return errors.Wrapf(err, "failed to replace %s", path)
+	}
+	return nil
+}
+
+// encodeKey returns the PEM encoding of the ECDSA key.
+func encodeKey(key *ecdsa.PrivateKey) ([]byte, error) {
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}), nil
+}
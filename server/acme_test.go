@@ -0,0 +1,233 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package server
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/acme"
+)
+
+// Tests that NewACMEManager sets the defaults and creates an account key that
+// is reused by later managers with the same cache directory.
+func TestNewACMEManager(t *testing.T) {
+	cacheDir := filepath.Join(t.TempDir(), "acme")
+	params := map[string]interface{}{
+		"domains":  []string{"sync.example.com"},
+		"cacheDir": cacheDir,
+	}
+	am, err := NewACMEManager(params)
+	if err != nil {
+		t.Fatalf("Failed to create ACMEManager: %+v", err)
+	}
+
+	expected := ACMEParams{
+		Domains:      []string{"sync.example.com"},
+		CacheDir:     cacheDir,
+		DirectoryURL: acme.LetsEncryptURL,
+		Challenge:    ChallengeHTTP01,
+		HTTPAddress:  defaultACMEHTTPAddress,
+		RenewBefore:  defaultACMERenewBefore,
+	}
+	if !reflect.DeepEqual(expected, am.params) {
+		t.Errorf("Unexpected params.\nexpected: %+v\nreceived: %+v",
+			expected, am.params)
+	}
+	if _, err = am.GetCertificate(nil); err == nil {
+		t.Errorf("Got certificate before one was obtained.")
+	}
+
+	am2, err := NewACMEManager(params)
+	if err != nil {
+		t.Fatalf("Failed to create second ACMEManager: %+v", err)
+	}
+	key := am.client.Key.Public().(*ecdsa.PublicKey)
+	if !key.Equal(am2.client.Key.Public()) {
+		t.Errorf("Account key was not reused.")
+	}
+}
+
+// Error path: Tests that NewACMEManager returns an error for missing, unknown,
+// and invalid parameters.
+func TestNewACMEManager_Error(t *testing.T) {
+	cacheDir := t.TempDir()
+	domains := []string{"sync.example.com"}
+	for _, params := range []map[string]interface{}{
+		{"cacheDir": cacheDir},
+		{"cacheDir": cacheDir, "domains": domains, "challenge": "tls-alpn-01"},
+		{"cacheDir": cacheDir, "domains": domains, "challenge": ChallengeDNS01},
+		{"cacheDir": cacheDir, "domains": domains, "renewBefore": "soon"},
+		{"cacheDir": cacheDir, "domains": domains, "certPath": "cert.pem"},
+	} {
+		if _, err := NewACMEManager(params); err == nil {
+			t.Errorf("Failed to get error for params %v.", params)
+		}
+	}
+}
+
+// Tests that a certificate saved by ACMEManager.saveCertificate is loaded by
+// the next manager and returned by GetCertificate.
+func TestACMEManager_saveCertificate(t *testing.T) {
+	params := map[string]interface{}{
+		"domains":  []string{"sync.example.com"},
+		"cacheDir": t.TempDir(),
+	}
+	am, err := NewACMEManager(params)
+	if err != nil {
+		t.Fatalf("Failed to create ACMEManager: %+v", err)
+	}
+
+	cert := newTestCertificate(t, []string{"sync.example.com"},
+		time.Now().Add(90*24*time.Hour))
+	if err = am.saveCertificate(cert); err != nil {
+		t.Fatalf("Failed to save certificate: %+v", err)
+	}
+
+	am, err = NewACMEManager(params)
+	if err != nil {
+		t.Fatalf("Failed to create ACMEManager: %+v", err)
+	}
+	loaded, err := am.GetCertificate(nil)
+	if err != nil {
+		t.Fatalf("Failed to get certificate: %+v", err)
+	}
+	if !reflect.DeepEqual(cert.Certificate, loaded.Certificate) {
+		t.Errorf("Loaded certificate does not match saved certificate.")
+	}
+	if am.needsRenewal(time.Now()) {
+		t.Errorf("Loaded certificate needs renewal.")
+	}
+}
+
+// Tests that ACMEManager.needsRenewal returns true when there is no
+// certificate, it does not cover the domains, or it expires soon.
+func TestACMEManager_needsRenewal(t *testing.T) {
+	now := time.Now()
+	domains := []string{"sync.example.com", "www.example.com"}
+	tests := []struct {
+		cert     *tls.Certificate
+		expected bool
+	}{
+		{nil, true},
+		{newTestCertificate(t, domains, now.Add(60*24*time.Hour)), false},
+		{newTestCertificate(t, domains, now.Add(10*24*time.Hour)), true},
+		{newTestCertificate(t, domains[:1], now.Add(60*24*time.Hour)), true},
+		{newTestCertificate(t, []string{"*.example.com"},
+			now.Add(60*24*time.Hour)), false},
+	}
+
+	for i, tt := range tests {
+		am := &ACMEManager{params: ACMEParams{
+			Domains: domains, RenewBefore: defaultACMERenewBefore}}
+		if tt.cert != nil {
+			if err := am.setCertificate(tt.cert); err != nil {
+				t.Fatalf("Failed to set certificate (%d): %+v", i, err)
+			}
+		}
+		if renew := am.needsRenewal(now); renew != tt.expected {
+			t.Errorf("Unexpected renewal (%d).\nexpected: %t\nreceived: %t",
+				i, tt.expected, renew)
+		}
+	}
+}
+
+// Tests that ACMEManager.ServeHTTP responds to pending HTTP-01 challenges and
+// returns 404 for all other requests.
+func TestACMEManager_ServeHTTP(t *testing.T) {
+	am := &ACMEManager{httpTokens: make(map[string]string)}
+	path := "/.well-known/acme-challenge/token"
+	am.setHTTPToken(path, "response")
+
+	w := httptest.NewRecorder()
+	am.ServeHTTP(w, httptest.NewRequest(
+		http.MethodGet, "http://sync.example.com"+path, nil))
+	if w.Code != http.StatusOK || w.Body.String() != "response" {
+		t.Errorf("Unexpected challenge response %d %q.", w.Code, w.Body)
+	}
+
+	am.setHTTPToken(path, "")
+	for _, target := range []string{path, "/file"} {
+		w = httptest.NewRecorder()
+		am.ServeHTTP(w, httptest.NewRequest(
+			http.MethodGet, "http://sync.example.com"+target, nil))
+		if w.Code != http.StatusNotFound {
+			t.Errorf("Unexpected code for %s.\nexpected: %d\nreceived: %d",
+				target, http.StatusNotFound, w.Code)
+		}
+	}
+}
+
+// Tests that ACMEManager.runDNSHook passes the action, record name, and value
+// to the hook and returns an error when the hook fails.
+func TestACMEManager_runDNSHook(t *testing.T) {
+	dir := t.TempDir()
+	outPath := filepath.Join(dir, "out")
+	hookPath := filepath.Join(dir, "hook.sh")
+	script := "#!/bin/sh\necho \"$@\" > " + outPath + "\n[ \"$1\" = present ]\n"
+	if err := os.WriteFile(hookPath, []byte(script), 0700); err != nil {
+		t.Fatalf("Failed to write hook: %+v", err)
+	}
+
+	am := &ACMEManager{params: ACMEParams{DNSHook: hookPath}}
+	name := dns01RecordName("*.example.com")
+	err := am.runDNSHook(context.Background(), dnsHookPresent, name, "value")
+	if err != nil {
+		t.Fatalf("Failed to run DNS hook: %+v", err)
+	}
+	out, err := os.ReadFile(outPath)
+	if err != nil {
+		t.Fatalf("Failed to read hook output: %+v", err)
+	}
+	expected := "present _acme-challenge.example.com value\n"
+	if string(out) != expected {
+		t.Errorf("Unexpected hook arguments.\nexpected: %q\nreceived: %q",
+			expected, out)
+	}
+
+	err = am.runDNSHook(context.Background(), dnsHookCleanup, name, "value")
+	if err == nil {
+		t.Errorf("Failed to get error for failed hook.")
+	}
+}
+
+// newTestCertificate returns a self-signed certificate for the domains that
+// expires at the given time.
+func newTestCertificate(
+	t testing.TB, domains []string, notAfter time.Time) *tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %+v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: domains[0]},
+		DNSNames:     domains,
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     notAfter,
+	}
+	der, err := x509.CreateCertificate(
+		rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("Failed to create certificate: %+v", err)
+	}
+	return &tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
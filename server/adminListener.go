@@ -0,0 +1,181 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package server
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+	jww "github.com/spf13/jwalterweatherman"
+	"google.golang.org/grpc"
+
+	"gitlab.com/xx_network/primitives/utils"
+)
+
+// adminSocketPerm is the permissions of the Unix socket of the admin listener,
+// so that only the user running the server can connect to it.
+const adminSocketPerm = os.FileMode(0600)
+
+// AdminListenerParams are the parameters of the admin listener.
+type AdminListenerParams struct {
+	// Address is the loopback host and port that the Admin service is served
+	// on, such as "127.0.0.1:22850". Exactly one of Address and Socket is
+	// required.
+	Address string `mapstructure:"address"`
+
+	// Socket is the path of the Unix socket that the Admin service is served
+	// on.
+	Socket string `mapstructure:"socket"`
+
+	// Key is the admin key that calls on the listener must include, in place
+	// of the admin key of the public listeners. Required.
+	Key string `mapstructure:"key"`
+}
+
+// AdminListener serves the Admin service over plaintext gRPC on a loopback
+// address or a Unix socket, separate from the listeners of the public
+// services, which then do not serve it.
+type AdminListener struct {
+	params AdminListenerParams
+}
+
+// NewAdminListener creates a new AdminListener from the parameters. Returns an
+// error if the address is not a loopback address, since the Admin service is
+// served without TLS.
+func NewAdminListener(params map[string]interface{}) (*AdminListener, error) {
+	var p AdminListenerParams
+	err := decodeParams(params, &p, "admin listener")
+	if err != nil {
+		return nil, err
+	}
+
+	if (p.Address == "") == (p.Socket == "") {
+		return nil, errors.New(
+			"exactly one of admin listener address and socket is required")
+	} else if p.Key == "" {
+		return nil, errors.New("admin listener key is required")
+	}
+	if p.Socket != "" {
+		if p.Socket, err = utils.ExpandPath(p.Socket); err != nil {
+			return nil, errors.Wrapf(
+				err, "unable to expand path %s", p.Socket)
+		}
+	} else if err = checkLoopback(p.Address); err != nil {
+		return nil, err
+	}
+
+	return &AdminListener{params: p}, nil
+}
+
+// CheckAdminListener returns an error if the address of the admin listener is
+// also listened on by one of the listeners, which would serve the Admin
+// service publicly or fail to bind.
+func CheckAdminListener(al *AdminListener, listeners []Listener) error {
+	if al == nil || al.params.Address == "" {
+		return nil
+	}
+	host, port, _ := net.SplitHostPort(al.params.Address)
+	for _, l := range listeners {
+		lHost, lPort, err := net.SplitHostPort(l.Address)
+		if err != nil || lPort != port {
+			continue
+		}
+		if ip := net.ParseIP(lHost); lHost == "" || lHost == host ||
+			(ip != nil && ip.IsUnspecified()) {
+			return errors.Errorf("admin listener address %s is also listened "+
+				"on by the listener on %s", al.params.Address, l.Address)
+		}
+	}
+	return nil
+}
+
+// Params returns the parameters of the admin listener.
+func (al *AdminListener) Params() AdminListenerParams {
+	return al.params
+}
+
+// Target returns the gRPC target that clients dial to reach the admin
+// listener: its address or "unix:" followed by its socket.
+func (al *AdminListener) Target() string {
+	if al.params.Socket != "" {
+		return "unix:" + al.params.Socket
+	}
+	return al.params.Address
+}
+
+// start serves the gRPC server on the address, listened on with the function,
+// or on the socket in the background until the stop channel is closed.
+func (al *AdminListener) start(grpcServer *grpc.Server, listen listenFunc,
+	stop <-chan struct{}) error {
+	listener, err := al.listen(listen)
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		jww.INFO.Printf("Serving the Admin service on %s.", al.Target())
+		if err := grpcServer.Serve(listener); err != nil {
+			jww.ERROR.Printf("Failed to serve the Admin service: %+v", err)
+		}
+	}()
+	go func() {
+		<-stop
+		grpcServer.Stop()
+	}()
+	return nil
+}
+
+// listen listens on the address with the function or on the socket. A socket
+// left by a previous process is replaced, and the new socket is only
+// accessible to the user running the server. The socket is not removed when it
+// is closed, so that a process that took over with listener handoff keeps it.
+func (al *AdminListener) listen(listen listenFunc) (net.Listener, error) {
+	if al.params.Socket == "" {
+		listener, err := listen(al.params.Address)
+		return listener, errors.Wrapf(err,
+			"failed to listen for the Admin service on %s", al.params.Address)
+	}
+
+	path := al.params.Socket
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, errors.Wrapf(err, "failed to make directory for %s", path)
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return nil, errors.Wrapf(err, "failed to remove old socket %s", path)
+	}
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, errors.Wrapf(
+			err, "failed to listen for the Admin service on %s", path)
+	}
+	listener.(*net.UnixListener).SetUnlinkOnClose(false)
+	if err = os.Chmod(path, adminSocketPerm); err != nil {
+		_ = listener.Close()
+		return nil, errors.Wrapf(err, "failed to restrict socket %s", path)
+	}
+	return listener, nil
+}
+
+// checkLoopback returns an error if the host of the address is not a loopback
+// IP address or localhost.
+func checkLoopback(address string) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return errors.Wrapf(err, "invalid admin listener address %q", address)
+	}
+	if host == "localhost" {
+		return nil
+	}
+	if ip := net.ParseIP(host); ip == nil || !ip.IsLoopback() {
+		return errors.Errorf("admin listener address %q must be a loopback "+
+			"address, since the Admin service is served without TLS", address)
+	}
+	return nil
+}
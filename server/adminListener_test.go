@@ -0,0 +1,122 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package server
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Tests that NewAdminListener decodes the parameters and expands the socket
+// path.
+func TestNewAdminListener(t *testing.T) {
+	al, err := NewAdminListener(map[string]interface{}{
+		"address": "127.0.0.1:22850", "key": "secret"})
+	if err != nil {
+		t.Fatalf("Failed to create AdminListener: %+v", err)
+	}
+	expected := AdminListenerParams{Address: "127.0.0.1:22850", Key: "secret"}
+	if al.Params() != expected {
+		t.Errorf("Unexpected parameters.\nexpected: %+v\nreceived: %+v",
+			expected, al.Params())
+	}
+	if al.Target() != expected.Address {
+		t.Errorf("Unexpected target: %s", al.Target())
+	}
+
+	al, err = NewAdminListener(map[string]interface{}{
+		"socket": "~/admin.sock", "key": "secret"})
+	if err != nil {
+		t.Fatalf("Failed to create AdminListener: %+v", err)
+	}
+	if strings.HasPrefix(al.Params().Socket, "~") ||
+		!strings.HasPrefix(al.Target(), "unix:") {
+		t.Errorf("Unexpected socket target: %s", al.Target())
+	}
+}
+
+// Error path: Tests that NewAdminListener returns an error for missing or
+// conflicting parameters and for addresses that are not loopback addresses.
+func TestNewAdminListener_Error(t *testing.T) {
+	tests := map[string]map[string]interface{}{
+		"no key":      {"address": "127.0.0.1:22850"},
+		"no address":  {"key": "secret"},
+		"both":        {"address": "[::1]:1", "socket": "a", "key": "secret"},
+		"public":      {"address": "0.0.0.0:22850", "key": "secret"},
+		"remote":      {"address": "example.com:22850", "key": "secret"},
+		"no port":     {"address": "127.0.0.1", "key": "secret"},
+		"unknown key": {"socket": "a", "key": "secret", "tls": true},
+	}
+	for name, params := range tests {
+		if _, err := NewAdminListener(params); err == nil {
+			t.Errorf("Failed to get error for %s.", name)
+		}
+	}
+}
+
+// Error path: Tests that CheckAdminListener returns an error when a listener
+// listens on the address of the admin listener.
+func TestCheckAdminListener_Error(t *testing.T) {
+	al, _ := NewAdminListener(map[string]interface{}{
+		"address": "127.0.0.1:22850", "key": "secret"})
+	tests := []struct {
+		address  string
+		conflict bool
+	}{
+		{"127.0.0.1:22840", false},
+		{"10.0.0.5:22850", false},
+		{"127.0.0.1:22850", true},
+		{"0.0.0.0:22850", true},
+		{"[::]:22850", true},
+	}
+	for _, tt := range tests {
+		err := CheckAdminListener(al, []Listener{{Address: tt.address}})
+		if (err != nil) != tt.conflict {
+			t.Errorf("Unexpected result for listener on %s: %+v",
+				tt.address, err)
+		}
+	}
+
+	if err := CheckAdminListener(nil, []Listener{{Address: ":1"}}); err != nil {
+		t.Errorf("Unexpected error without admin listener: %+v", err)
+	}
+}
+
+// Tests that AdminListener.listen replaces an old socket and restricts the new
+// socket to the user running the server.
+func TestAdminListener_listen_Socket(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "admin.sock")
+	if err := os.WriteFile(path, nil, 0644); err != nil {
+		t.Fatalf("Failed to write old socket: %+v", err)
+	}
+	al, _ := NewAdminListener(map[string]interface{}{
+		"socket": path, "key": "secret"})
+
+	l, err := al.listen(nil)
+	if err != nil {
+		t.Fatalf("Failed to listen: %+v", err)
+	}
+	defer func() { _ = l.Close() }()
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("Failed to stat socket: %+v", err)
+	}
+	if info.Mode()&os.ModeSocket == 0 || info.Mode().Perm() != adminSocketPerm {
+		t.Errorf("Unexpected socket mode: %s", info.Mode())
+	}
+
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		t.Fatalf("Failed to connect to socket: %+v", err)
+	}
+	_ = conn.Close()
+}
@@ -0,0 +1,264 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package server
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"strings"
+
+	"github.com/pkg/errors"
+	jww "github.com/spf13/jwalterweatherman"
+
+	"gitlab.com/elixxir/remoteSyncServer/credentials"
+	"gitlab.com/elixxir/remoteSyncServer/store"
+)
+
+// Scope is a permission granted to an API key.
+type Scope string
+
+// Supported API key scopes.
+const (
+	// ScopeRead allows reading the user's files and their modification times.
+	ScopeRead Scope = "read"
+
+	// ScopeWrite allows writing the user's files. It includes ScopeRead.
+	ScopeWrite Scope = "write"
+
+	// ScopeAdmin allows calling the Admin RPCs.
+	ScopeAdmin Scope = "admin"
+)
+
+// Lengths of the random parts of an API key, in bytes.
+const (
+	apiKeyIDLen     = 8
+	apiKeySecretLen = 32
+)
+
+var (
+	// APIKeysDisabledErr is returned when logging in with an API key while API
+	// keys are not enabled.
+	APIKeysDisabledErr = errors.New("API keys are not enabled")
+
+	// InvalidAPIKeyErr is returned when an API key is malformed, unknown, or
+	// revoked.
+	InvalidAPIKeyErr = errors.New("invalid API key")
+
+	// InsufficientScopeErr is returned when a token or API key is used for a
+	// request its scopes do not allow.
+	InsufficientScopeErr = errors.New("request not allowed by API key scopes")
+)
+
+// APIKey describes an API key without its secret.
+type APIKey struct {
+	// ID identifies the key. It is the part of the key before the ".".
+	ID string
+
+	// Username is the user whose files the key can access. It is empty for
+	// keys that only have ScopeAdmin.
+	Username string
+
+	Scopes Scopes
+}
+
+// Scopes is a list of scopes.
+type Scopes []Scope
+
+// ParseScopes parses a comma-separated list of scopes.
+func ParseScopes(s string) (Scopes, error) {
+	var scopes Scopes
+	for _, field := range strings.Split(s, ",") {
+		scope := Scope(strings.TrimSpace(field))
+		switch scope {
+		case ScopeRead, ScopeWrite, ScopeAdmin:
+		default:
+			return nil, errors.Errorf("unknown scope %q (available: %s, %s, %s)",
+				scope, ScopeRead, ScopeWrite, ScopeAdmin)
+		}
+		if !scopes.has(scope) {
+			scopes = append(scopes, scope)
+		}
+	}
+	return scopes, nil
+}
+
+// String returns the scopes as a comma-separated list.
+func (s Scopes) String() string {
+	strs := make([]string, len(s))
+	for i, scope := range s {
+		strs[i] = string(scope)
+	}
+	return strings.Join(strs, ",")
+}
+
+// Allows returns true if the scopes allow a request that requires the scope.
+// ScopeWrite also allows requests that require ScopeRead.
+func (s Scopes) Allows(required Scope) bool {
+	return s.has(required) || (required == ScopeRead && s.has(ScopeWrite))
+}
+
+// has returns true if the scope is in the list.
+func (s Scopes) has(scope Scope) bool {
+	for _, existing := range s {
+		if existing == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// APIKeys manages API keys. Keys are saved in a credential store that maps
+// each key ID to its scopes, the hash of its secret, and its user.
+type APIKeys struct {
+	keys credentials.Store
+}
+
+// NewAPIKeys creates a new APIKeys that saves the keys in the store.
+func NewAPIKeys(keys credentials.Store) *APIKeys {
+	return &APIKeys{keys: keys}
+}
+
+// Create generates a new API key with the scopes for the user. The returned
+// key cannot be recovered later. The username is required unless the only
+// scope is ScopeAdmin.
+func (ak *APIKeys) Create(username string, scopes Scopes) (string, error) {
+	if len(scopes) == 0 {
+		return "", errors.New("API key must have at least one scope")
+	}
+	if scopes.Allows(ScopeRead) || username != "" {
+		if err := store.CheckUsername(username); err != nil {
+			return "", errors.Wrapf(err, "invalid username %q", username)
+		}
+	}
+
+	idBytes := make([]byte, apiKeyIDLen)
+	secret := make([]byte, apiKeySecretLen)
+	if _, err := rand.Read(idBytes); err != nil {
+		return "", errors.Wrap(err, "failed to generate API key ID")
+	}
+	if _, err := rand.Read(secret); err != nil {
+		return "", errors.Wrap(err, "failed to generate API key secret")
+	}
+	id := hex.EncodeToString(idBytes)
+	secretStr := base64.RawURLEncoding.EncodeToString(secret)
+
+	value := encodeAPIKey(scopes, hashAPIKeySecret(secretStr), username)
+	if err := ak.keys.Set(id, value); err != nil {
+		return "", err
+	}
+
+	jww.INFO.Printf("Created API key %s for user %q with scopes %s.",
+		id, username, scopes)
+
+	return id + "." + secretStr, nil
+}
+
+// Verify returns the description of the API key.
+//
+// Returns [InvalidAPIKeyErr] if the key is malformed or not found.
+func (ak *APIKeys) Verify(key string) (APIKey, error) {
+	id, secret, found := strings.Cut(key, ".")
+	if !found || id == "" || secret == "" {
+		return APIKey{}, InvalidAPIKeyErr
+	}
+
+	k, hash, err := ak.get(id)
+	if errors.Is(err, credentials.UserNotFoundErr) {
+		return APIKey{}, InvalidAPIKeyErr
+	} else if err != nil {
+		return APIKey{}, err
+	}
+
+	if subtle.ConstantTimeCompare(
+		[]byte(hashAPIKeySecret(secret)), []byte(hash)) != 1 {
+		return APIKey{}, InvalidAPIKeyErr
+	}
+
+	return k, nil
+}
+
+// List returns all API keys sorted by ID.
+func (ak *APIKeys) List() ([]APIKey, error) {
+	ids, err := ak.keys.List()
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make([]APIKey, 0, len(ids))
+	for _, id := range ids {
+		k, _, err := ak.get(id)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, k)
+	}
+
+	return keys, nil
+}
+
+// Revoke deletes the API key with the ID so that it can no longer be used to
+// log in. Tokens already issued for the key stay valid until they expire or
+// are revoked.
+//
+// Returns [credentials.UserNotFoundErr] if no key has the ID.
+func (ak *APIKeys) Revoke(id string) error {
+	if err := ak.keys.Delete(id); err != nil {
+		return err
+	}
+
+	jww.INFO.Printf("Revoked API key %s.", id)
+
+	return nil
+}
+
+// get returns the API key with the ID and the hash of its secret.
+func (ak *APIKeys) get(id string) (APIKey, string, error) {
+	value, err := ak.keys.Get(id)
+	if err != nil {
+		return APIKey{}, "", err
+	}
+
+	scopes, hash, username, err := decodeAPIKey(value)
+	if err != nil {
+		return APIKey{}, "", errors.Wrapf(err, "invalid API key %s", id)
+	}
+
+	return APIKey{ID: id, Username: username, Scopes: scopes}, hash, nil
+}
+
+// encodeAPIKey encodes the API key into the value saved in the store. The
+// username is last because it may contain the separator.
+func encodeAPIKey(scopes Scopes, hash, username string) string {
+	return scopes.String() + ":" + hash + ":" + username
+}
+
+// decodeAPIKey decodes the value saved by encodeAPIKey.
+func decodeAPIKey(value string) (Scopes, string, string, error) {
+	fields := strings.SplitN(value, ":", 3)
+	if len(fields) != 3 {
+		return nil, "", "", errors.New("malformed entry")
+	}
+
+	scopes, err := ParseScopes(fields[0])
+	if err != nil {
+		return nil, "", "", err
+	}
+
+	return scopes, fields[1], fields[2], nil
+}
+
+// hashAPIKeySecret returns the hash of the API key secret that is saved so
+// that the store does not contain usable keys. The secret is random, so a
+// fast hash is sufficient.
+func hashAPIKeySecret(secret string) string {
+	h := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(h[:])
+}
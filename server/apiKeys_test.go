@@ -0,0 +1,175 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package server
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"gitlab.com/elixxir/remoteSyncServer/credentials"
+)
+
+// Tests that ParseScopes parses a list of scopes and removes duplicates.
+func TestParseScopes(t *testing.T) {
+	scopes, err := ParseScopes("read, admin,read")
+	if err != nil {
+		t.Fatalf("Failed to parse scopes: %+v", err)
+	}
+	if expected := (Scopes{ScopeRead, ScopeAdmin}); !reflect.DeepEqual(
+		expected, scopes) {
+		t.Errorf("Unexpected scopes.\nexpected: %s\nreceived: %s",
+			expected, scopes)
+	}
+}
+
+// Error path: Tests that ParseScopes returns an error for unknown and empty
+// scopes.
+func TestParseScopes_Error(t *testing.T) {
+	for _, s := range []string{"", "read,delete", "read,"} {
+		if _, err := ParseScopes(s); err == nil {
+			t.Errorf("Failed to get error for %q.", s)
+		}
+	}
+}
+
+// Tests that Scopes.Allows allows the scopes in the list and that ScopeWrite
+// also allows ScopeRead.
+func TestScopes_Allows(t *testing.T) {
+	tests := []struct {
+		scopes   Scopes
+		required Scope
+		expected bool
+	}{
+		{Scopes{ScopeRead}, ScopeRead, true},
+		{Scopes{ScopeRead}, ScopeWrite, false},
+		{Scopes{ScopeWrite}, ScopeRead, true},
+		{Scopes{ScopeWrite}, ScopeAdmin, false},
+		{Scopes{ScopeAdmin}, ScopeRead, false},
+		{Scopes{ScopeAdmin}, ScopeAdmin, true},
+	}
+
+	for i, tt := range tests {
+		if allows := tt.scopes.Allows(tt.required); allows != tt.expected {
+			t.Errorf("Unexpected result for %s allowing %s (%d)."+
+				"\nexpected: %t\nreceived: %t",
+				tt.scopes, tt.required, i, tt.expected, allows)
+		}
+	}
+}
+
+// Tests that an API key created by APIKeys.Create can be verified with
+// APIKeys.Verify and listed with APIKeys.List, and that the store does not
+// contain the key's secret.
+func TestAPIKeys_Create_Verify(t *testing.T) {
+	keys := credentials.NewMemStore(nil)
+	ak := NewAPIKeys(keys)
+
+	key, err := ak.Create("waldo", Scopes{ScopeRead})
+	if err != nil {
+		t.Fatalf("Failed to create API key: %+v", err)
+	}
+
+	k, err := ak.Verify(key)
+	if err != nil {
+		t.Fatalf("Failed to verify API key: %+v", err)
+	}
+	expected := APIKey{ID: strings.Split(key, ".")[0], Username: "waldo",
+		Scopes: Scopes{ScopeRead}}
+	if !reflect.DeepEqual(expected, k) {
+		t.Errorf("Unexpected API key.\nexpected: %+v\nreceived: %+v",
+			expected, k)
+	}
+
+	list, err := ak.List()
+	if err != nil {
+		t.Fatalf("Failed to list API keys: %+v", err)
+	}
+	if !reflect.DeepEqual([]APIKey{expected}, list) {
+		t.Errorf("Unexpected API keys.\nexpected: %+v\nreceived: %+v",
+			[]APIKey{expected}, list)
+	}
+
+	stored, _ := keys.Get(k.ID)
+	if strings.Contains(stored, strings.Split(key, ".")[1]) {
+		t.Errorf("Store contains API key secret: %q", stored)
+	}
+}
+
+// Tests that an API key with only the admin scope can be created without a
+// username.
+func TestAPIKeys_Create_Admin(t *testing.T) {
+	ak := NewAPIKeys(credentials.NewMemStore(nil))
+
+	key, err := ak.Create("", Scopes{ScopeAdmin})
+	if err != nil {
+		t.Fatalf("Failed to create API key: %+v", err)
+	}
+	if k, err := ak.Verify(key); err != nil {
+		t.Errorf("Failed to verify API key: %+v", err)
+	} else if k.Username != "" || !k.Scopes.Allows(ScopeAdmin) {
+		t.Errorf("Unexpected API key: %+v", k)
+	}
+}
+
+// Error path: Tests that APIKeys.Create returns an error for missing scopes
+// and for missing or invalid usernames of keys that can access files.
+func TestAPIKeys_Create_Error(t *testing.T) {
+	ak := NewAPIKeys(credentials.NewMemStore(nil))
+	tests := []struct {
+		username string
+		scopes   Scopes
+	}{
+		{"waldo", nil},
+		{"", Scopes{ScopeRead}},
+		{"", Scopes{ScopeAdmin, ScopeWrite}},
+		{"..", Scopes{ScopeAdmin}},
+	}
+
+	for i, tt := range tests {
+		if _, err := ak.Create(tt.username, tt.scopes); err == nil {
+			t.Errorf("Failed to get error for %q with scopes %s (%d).",
+				tt.username, tt.scopes, i)
+		}
+	}
+}
+
+// Error path: Tests that APIKeys.Verify returns InvalidAPIKeyErr for
+// malformed, unknown, wrong, and revoked keys.
+func TestAPIKeys_Verify_InvalidAPIKeyError(t *testing.T) {
+	ak := NewAPIKeys(credentials.NewMemStore(nil))
+	key, err := ak.Create("waldo", Scopes{ScopeWrite})
+	if err != nil {
+		t.Fatalf("Failed to create API key: %+v", err)
+	}
+	id := strings.Split(key, ".")[0]
+
+	revoked, _ := ak.Create("waldo", Scopes{ScopeRead})
+	if err = ak.Revoke(strings.Split(revoked, ".")[0]); err != nil {
+		t.Fatalf("Failed to revoke API key: %+v", err)
+	}
+
+	for _, k := range []string{
+		"", id, id + ".", "." + id, "unknown.secret", id + ".secret", revoked} {
+		if _, err = ak.Verify(k); !errors.Is(err, InvalidAPIKeyErr) {
+			t.Errorf("Unexpected error for %q.\nexpected: %v\nreceived: %+v",
+				k, InvalidAPIKeyErr, err)
+		}
+	}
+}
+
+// Error path: Tests that APIKeys.Revoke returns credentials.UserNotFoundErr for
+// an unknown key.
+func TestAPIKeys_Revoke_UserNotFoundError(t *testing.T) {
+	ak := NewAPIKeys(credentials.NewMemStore(nil))
+	if err := ak.Revoke("unknown"); !errors.Is(err, credentials.UserNotFoundErr) {
+		t.Errorf("Unexpected error.\nexpected: %v\nreceived: %+v",
+			credentials.UserNotFoundErr, err)
+	}
+}
@@ -0,0 +1,348 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package server
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	jww "github.com/spf13/jwalterweatherman"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+
+	"gitlab.com/elixxir/remoteSyncServer/rpc"
+	"gitlab.com/xx_network/primitives/utils"
+)
+
+// auditFilePerm is the permissions used when creating the audit log file.
+const auditFilePerm = os.FileMode(0600)
+
+// maxAuditEntryLen is the maximum length of an entry read from the audit log.
+const maxAuditEntryLen = 1 << 20
+
+// Operations recorded in the audit log.
+const (
+	AuditRead  = "read"
+	AuditWrite = "write"
+	AuditList  = "list"
+	AuditStat  = "stat"
+	AuditLink  = "link"
+
+	// AuditLogin is a password login. AuditLoginFailure is a failed login
+	// counted against its account, AuditLoginThrottled a login rejected
+	// because its account must wait or is locked, and AuditLockout the lockout
+	// of an account for too many failed logins, all by login throttling.
+	AuditLogin          = "login"
+	AuditLoginFailure   = "loginFailure"
+	AuditLoginThrottled = "loginThrottled"
+	AuditLockout        = "lockout"
+)
+
+// auditOperations maps the full method name of each audited RPC to its
+// operation.
+var auditOperations = map[string]string{
+	"/mixmessages.RemoteSync/Read":             AuditRead,
+	"/mixmessages.RemoteSync/Write":            AuditWrite,
+	"/mixmessages.RemoteSync/ReadDir":          AuditList,
+	"/mixmessages.RemoteSync/GetLastModified":  AuditStat,
+	"/remoteSync.Directory/ListDir":            AuditList,
+	"/remoteSync.History/ListVersions":         AuditList,
+	"/remoteSync.History/ReadVersion":          AuditRead,
+	"/remoteSync.Delta/GetSignature":           AuditRead,
+	"/remoteSync.Delta/ApplyDelta":             AuditWrite,
+	"/remoteSync.Upload/FinishUpload":          AuditWrite,
+	"/remoteSync.Transaction/Commit":           AuditWrite,
+	"/remoteSync.Batch/BatchRead":              AuditRead,
+	"/remoteSync.Batch/BatchWrite":             AuditWrite,
+	"/remoteSync.Conditional/ConditionalWrite": AuditWrite,
+	"/remoteSync.Metadata/Stat":                AuditStat,
+	"/remoteSync.Download/Download":            AuditRead,
+	"/remoteSync.Links/CreateLink":             AuditLink,
+	"/mixmessages.RemoteSync/Login":            AuditLogin,
+	"/remoteSync.Session/PasswordLogin":        AuditLogin,
+}
+
+var (
+	// AuditChainErr is returned by VerifyAuditLog when an entry does not
+	// follow the previous entry in the hash chain.
+	AuditChainErr = errors.New("audit log hash chain is broken")
+
+	// AuditHashErr is returned by VerifyAuditLog when the hash of an entry
+	// does not match its contents.
+	AuditHashErr = errors.New("audit log entry hash does not match")
+)
+
+// AuditParams are the parameters of the audit log.
+type AuditParams struct {
+	// Path is the file that entries are appended to. Required.
+	Path string `mapstructure:"path"`
+
+	// HashChain adds to each entry the hash of the previous entry and its own
+	// hash, so that changes to the file can be detected with VerifyAuditLog.
+	HashChain bool `mapstructure:"hashChain"`
+}
+
+// AuditEntry is a single entry of the audit log, written as a line of JSON.
+// All fields are strings so that an entry read back encodes to the same bytes
+// it was hashed as.
+type AuditEntry struct {
+	Time      string `json:"time"`
+	User      string `json:"user"`
+	Operation string `json:"operation"`
+	Path      string `json:"path"`
+	Client    string `json:"client,omitempty"`
+	RequestID string `json:"requestId,omitempty"`
+	Result    string `json:"result"`
+
+	// PrevHash and Hash are the hex-encoded SHA-256 hashes of the previous
+	// entry and of this entry without Hash. Only set with hash chaining.
+	PrevHash string `json:"prevHash,omitempty"`
+	Hash     string `json:"hash,omitempty"`
+}
+
+// AuditLog appends an entry to a file for each sync operation, recording who
+// read, wrote, or listed which path, from which address, when, and whether it
+// succeeded. The file is only appended to. With hash chaining, each entry
+// includes the hash of the previous one, so that a modified, inserted, or
+// deleted entry breaks the chain.
+type AuditLog struct {
+	params   AuditParams
+	file     *os.File
+	prevHash string
+	mux      sync.Mutex
+}
+
+// NewAuditLog opens the audit log file for appending, creating it if it does
+// not exist. With hash chaining, the chain continues from the last entry in
+// the file.
+func NewAuditLog(params map[string]interface{}) (*AuditLog, error) {
+	var p AuditParams
+	err := decodeParams(params, &p, "audit")
+	if err != nil {
+		return nil, err
+	}
+	if p.Path == "" {
+		return nil, errors.New("audit log path is required")
+	}
+	if p.Path, err = utils.ExpandPath(p.Path); err != nil {
+		return nil, errors.Wrapf(err, "unable to expand path %s", p.Path)
+	}
+
+	al := &AuditLog{params: p}
+	if p.HashChain {
+		if al.prevHash, err = lastAuditHash(p.Path); err != nil {
+			return nil, err
+		}
+	}
+
+	al.file, err = os.OpenFile(
+		p.Path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, auditFilePerm)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to open audit log %s", p.Path)
+	}
+	return al, nil
+}
+
+// lastAuditHash returns the hash of the last entry of the audit log at the
+// path, or an empty string if the file does not exist or is empty.
+func lastAuditHash(path string) (string, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return "", nil
+	} else if err != nil {
+		return "", errors.Wrapf(err, "unable to open audit log %s", path)
+	}
+	defer f.Close()
+
+	var last *AuditEntry
+	err = readAuditLog(f, func(_ int, entry AuditEntry) error {
+		last = &entry
+		return nil
+	})
+	if err != nil {
+		return "", errors.Wrapf(err, "unable to read audit log %s", path)
+	} else if last == nil {
+		return "", nil
+	} else if last.Hash == "" {
+		return "", errors.Errorf("last entry of audit log %s has no hash; "+
+			"start a new file to enable hash chaining", path)
+	}
+	return last.Hash, nil
+}
+
+// Record appends the entry to the audit log, setting its hashes with hash
+// chaining.
+func (al *AuditLog) Record(entry AuditEntry) error {
+	al.mux.Lock()
+	defer al.mux.Unlock()
+
+	// Invalid UTF-8 is replaced when encoding, so it is replaced first for the
+	// entry to encode the same when read back
+	entry.User = strings.ToValidUTF8(entry.User, "\uFFFD")
+	entry.Path = strings.ToValidUTF8(entry.Path, "\uFFFD")
+
+	if al.params.HashChain {
+		entry.PrevHash = al.prevHash
+		entry.Hash = ""
+		hash, err := auditEntryHash(entry)
+		if err != nil {
+			return err
+		}
+		entry.Hash = hash
+	}
+
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return errors.Wrap(err, "failed to encode audit entry")
+	}
+	if _, err = al.file.Write(append(line, '\n')); err != nil {
+		return errors.Wrapf(
+			err, "failed to write to audit log %s", al.params.Path)
+	}
+	al.prevHash = entry.Hash
+	return nil
+}
+
+// Close closes the audit log file.
+func (al *AuditLog) Close() error {
+	al.mux.Lock()
+	defer al.mux.Unlock()
+	return al.file.Close()
+}
+
+// interceptor returns an interceptor that records each audited RPC in the
+// audit log after it is handled, including requests that are rejected.
+func (al *AuditLog) interceptor(h *handler) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{},
+		info *grpc.UnaryServerInfo, next grpc.UnaryHandler) (interface{}, error) {
+		operation, audited := auditOperations[info.FullMethod]
+		if !audited {
+			return next(ctx, req)
+		}
+
+		// The user is resolved before the request is handled, since the
+		// session of an expired or revoked token is removed when it is used
+		username := requestUsername(h, req)
+		resp, err := next(ctx, req)
+
+		// Requests that do not name the path, such as finishing an upload,
+		// return it in the response. Transactions and batches are recorded
+		// with an entry for the path of each operation or file.
+		paths := []string{""}
+		if msg, ok := req.(interface{ GetPath() string }); ok {
+			paths[0] = msg.GetPath()
+		} else if msg, ok := resp.(interface{ GetPath() string }); ok {
+			paths[0] = msg.GetPath()
+		} else if msg, ok := req.(*rpc.RsCommitRequest); ok &&
+			len(msg.GetOps()) > 0 {
+			paths = make([]string, len(msg.GetOps()))
+			for i, op := range msg.GetOps() {
+				paths[i] = op.GetPath()
+			}
+		} else if msg, ok := req.(*rpc.RsBatchReadRequest); ok &&
+			len(msg.GetPaths()) > 0 {
+			paths = msg.GetPaths()
+		} else if msg, ok := req.(*rpc.RsBatchWriteRequest); ok &&
+			len(msg.GetWrites()) > 0 {
+			paths = make([]string, len(msg.GetWrites()))
+			for i, write := range msg.GetWrites() {
+				paths[i] = write.GetPath()
+			}
+		}
+		for _, path := range paths {
+			al.record(ctx, username, operation, path, err)
+		}
+		return resp, err
+	}
+}
+
+// record records the operation on the path by the user in the request with the
+// context, with the result of its error. Used directly by requests that are not
+// RPCs, which the interceptor does not see.
+func (al *AuditLog) record(ctx context.Context,
+	username, operation, path string, err error) {
+	entry := AuditEntry{
+		Time:      time.Now().UTC().Format(time.RFC3339Nano),
+		User:      username,
+		Operation: operation,
+		Path:      path,
+		Client:    peerIP(ctx),
+		RequestID: requestID(ctx),
+		Result:    status.Code(err).String(),
+	}
+	if auditErr := al.Record(entry); auditErr != nil {
+		jww.ERROR.Printf("Failed to record %s of %q by %q in audit log: %+v",
+			operation, path, username, auditErr)
+	}
+}
+
+// VerifyAuditLog checks the hash chain of the audit log read from r. Returns
+// the number of entries verified, and [AuditHashErr] or [AuditChainErr] with
+// the line of the first entry that was modified or does not follow the
+// previous entry. The first entry must start the chain, so a log whose first
+// entries were removed fails to verify.
+func VerifyAuditLog(r io.Reader) (int, error) {
+	var prevHash string
+	var n int
+	err := readAuditLog(r, func(line int, entry AuditEntry) error {
+		if entry.Hash == "" {
+			return errors.Errorf("entry on line %d has no hash", line)
+		}
+		hash := entry.Hash
+		entry.Hash = ""
+		expected, err := auditEntryHash(entry)
+		if err != nil {
+			return err
+		} else if hash != expected {
+			return errors.Wrapf(AuditHashErr, "line %d", line)
+		} else if entry.PrevHash != prevHash {
+			return errors.Wrapf(AuditChainErr, "line %d", line)
+		}
+		prevHash = hash
+		n++
+		return nil
+	})
+	return n, err
+}
+
+// readAuditLog parses each line of the audit log read from r and calls fn with
+// its line number and entry. Stops at the first error returned by fn.
+func readAuditLog(r io.Reader, fn func(line int, entry AuditEntry) error) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, maxAuditEntryLen)
+	for line := 1; scanner.Scan(); line++ {
+		var entry AuditEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return errors.Wrapf(err, "invalid entry on line %d", line)
+		}
+		if err := fn(line, entry); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+// auditEntryHash returns the hex-encoded SHA-256 hash of the JSON encoding of
+// the entry.
+func auditEntryHash(entry AuditEntry) (string, error) {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to encode audit entry")
+	}
+	hash := sha256.Sum256(data)
+	return hex.EncodeToString(hash[:]), nil
+}
@@ -0,0 +1,269 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/peer"
+
+	pb "gitlab.com/elixxir/comms/mixmessages"
+	"gitlab.com/elixxir/remoteSyncServer/credentials"
+	"gitlab.com/elixxir/remoteSyncServer/rpc"
+	"gitlab.com/elixxir/remoteSyncServer/store"
+)
+
+// Tests that entries recorded with hash chaining, including after the audit
+// log is reopened, pass VerifyAuditLog.
+func TestAuditLog_Record(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	params := map[string]interface{}{"path": path, "hashChain": "true"}
+	al, err := NewAuditLog(params)
+	if err != nil {
+		t.Fatalf("Failed to create audit log: %+v", err)
+	}
+	for _, p := range []string{"a", "b", "invalid\xff"} {
+		err = al.Record(AuditEntry{User: "waldo", Operation: AuditWrite,
+			Path: p, Result: "OK"})
+		if err != nil {
+			t.Fatalf("Failed to record entry: %+v", err)
+		}
+	}
+	if err = al.Close(); err != nil {
+		t.Fatalf("Failed to close audit log: %+v", err)
+	}
+
+	al, err = NewAuditLog(params)
+	if err != nil {
+		t.Fatalf("Failed to reopen audit log: %+v", err)
+	}
+	err = al.Record(
+		AuditEntry{User: "fred", Operation: AuditRead, Path: "a", Result: "OK"})
+	if err != nil {
+		t.Fatalf("Failed to record entry: %+v", err)
+	}
+	_ = al.Close()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read audit log: %+v", err)
+	}
+	n, err := VerifyAuditLog(bytes.NewReader(data))
+	if err != nil {
+		t.Errorf("Failed to verify audit log: %+v", err)
+	} else if n != 4 {
+		t.Errorf("Unexpected number of entries.\nexpected: %d\nreceived: %d",
+			4, n)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("Failed to stat audit log: %+v", err)
+	} else if info.Mode().Perm() != auditFilePerm {
+		t.Errorf("Unexpected permissions.\nexpected: %s\nreceived: %s",
+			auditFilePerm, info.Mode().Perm())
+	}
+}
+
+// Error path: Tests that VerifyAuditLog detects modified, removed, and
+// reordered entries.
+func TestVerifyAuditLog_Error(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	al, err := NewAuditLog(map[string]interface{}{
+		"path": path, "hashChain": true})
+	if err != nil {
+		t.Fatalf("Failed to create audit log: %+v", err)
+	}
+	for _, p := range []string{"a", "b", "c"} {
+		err = al.Record(AuditEntry{User: "waldo", Operation: AuditRead,
+			Path: p, Result: "OK"})
+		if err != nil {
+			t.Fatalf("Failed to record entry: %+v", err)
+		}
+	}
+	_ = al.Close()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read audit log: %+v", err)
+	}
+	lines := strings.SplitAfter(strings.TrimSuffix(string(data), "\n"), "\n")
+
+	tests := map[string]struct {
+		log      string
+		expected error
+	}{
+		"modified": {lines[0] + strings.Replace(
+			lines[1], `"path":"b"`, `"path":"x"`, 1) + lines[2], AuditHashErr},
+		"removed":       {lines[0] + lines[2], AuditChainErr},
+		"reordered":     {lines[1] + lines[0] + lines[2], AuditChainErr},
+		"first removed": {lines[1] + lines[2], AuditChainErr},
+	}
+	for name, tt := range tests {
+		_, err = VerifyAuditLog(strings.NewReader(tt.log))
+		if !errors.Is(err, tt.expected) {
+			t.Errorf("Unexpected error for %s log.\nexpected: %v\nreceived: %+v",
+				name, tt.expected, err)
+		}
+	}
+
+	// Entries without a hash cannot be verified
+	_, err = VerifyAuditLog(strings.NewReader(
+		`{"time":"now","user":"waldo","operation":"read","path":"a"}`))
+	if err == nil {
+		t.Errorf("Failed to get error for entry without hash.")
+	}
+}
+
+// Error path: Tests that NewAuditLog returns an error for invalid parameters
+// and for continuing the hash chain of a log without hashes.
+func TestNewAuditLog_Error(t *testing.T) {
+	dir := t.TempDir()
+	unhashed := filepath.Join(dir, "unhashed.log")
+	al, err := NewAuditLog(map[string]interface{}{"path": unhashed})
+	if err != nil {
+		t.Fatalf("Failed to create audit log: %+v", err)
+	}
+	_ = al.Record(AuditEntry{User: "waldo", Operation: AuditRead, Path: "a"})
+	_ = al.Close()
+
+	tests := map[string]map[string]interface{}{
+		"no path":        {"hashChain": true},
+		"unknown key":    {"path": filepath.Join(dir, "a.log"), "sign": true},
+		"directory":      {"path": dir},
+		"unhashed chain": {"path": unhashed, "hashChain": true},
+	}
+	for name, params := range tests {
+		if _, err = NewAuditLog(params); err == nil {
+			t.Errorf("Failed to get error for %s.", name)
+		}
+	}
+}
+
+// Tests that the interceptor of the AuditLog records the user, operation,
+// path, client, request ID, and result of sync RPCs, including rejected ones,
+// and ignores other RPCs.
+func TestAuditLog_interceptor(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	al, err := NewAuditLog(map[string]interface{}{"path": path})
+	if err != nil {
+		t.Fatalf("Failed to create audit log: %+v", err)
+	}
+	h := newHandler("", time.Hour, credentials.NewMemStore(
+		map[string]string{"waldo": "hunter2"}), nil, store.NewMemStore)
+	session, err := h.addSession("waldo")
+	if err != nil {
+		t.Fatalf("Failed to add session: %+v", err)
+	}
+	token := Token(session.Value)
+
+	ctx := peer.NewContext(context.Background(),
+		&peer.Peer{Addr: &net.TCPAddr{IP: net.ParseIP("10.0.0.7"), Port: 5}})
+	ctx = context.WithValue(ctx, requestIDKey{}, "req-1")
+	interceptor := al.interceptor(h)
+	requests := []struct {
+		method string
+		req    interface{}
+		next   grpc.UnaryHandler
+	}{
+		{"/mixmessages.RemoteSync/Write",
+			&pb.RsWriteRequest{Path: "dir/file", Data: []byte("data"),
+				Token: token.Marshal()},
+			func(ctx context.Context, req interface{}) (interface{}, error) {
+				return h.Write(ctx, req.(*pb.RsWriteRequest))
+			}},
+		{"/mixmessages.RemoteSync/Read",
+			&pb.RsReadRequest{Path: "secret", Token: []byte("invalid")},
+			func(ctx context.Context, req interface{}) (interface{}, error) {
+				return h.Read(ctx, req.(*pb.RsReadRequest))
+			}},
+		{"/remoteSync.Upload/FinishUpload",
+			&rpc.RsFinishUploadRequest{UploadID: "id", Token: token.Marshal()},
+			func(context.Context, interface{}) (interface{}, error) {
+				return &rpc.RsFinishUploadResponse{Path: "upload"}, nil
+			}},
+		{"/remoteSync.Transaction/Commit",
+			&rpc.RsCommitRequest{Token: token.Marshal(),
+				Ops: []*rpc.RsTransactionOp{{Path: "a", Data: []byte("a")},
+					{Path: "b", Delete: true}}},
+			func(context.Context, interface{}) (interface{}, error) {
+				return &rpc.RsCommitResponse{}, nil
+			}},
+		{"/remoteSync.Batch/BatchRead",
+			&rpc.RsBatchReadRequest{Token: token.Marshal(),
+				Paths: []string{"c", "d"}},
+			func(context.Context, interface{}) (interface{}, error) {
+				return &rpc.RsBatchReadResponse{}, nil
+			}},
+		{"/remoteSync.Session/PasswordLogin",
+			&rpc.RsPasswordLoginRequest{Username: "waldo", Password: "wrong"},
+			func(context.Context, interface{}) (interface{}, error) {
+				return nil, InvalidCredentialsErr
+			}},
+		{"/remoteSync.Info/GetVersion", &rpc.RsGetVersionRequest{},
+			func(context.Context, interface{}) (interface{}, error) {
+				return &rpc.RsGetVersionResponse{}, nil
+			}},
+	}
+	for _, r := range requests {
+		_, _ = interceptor(ctx, r.req,
+			&grpc.UnaryServerInfo{FullMethod: r.method}, r.next)
+	}
+	_ = al.Close()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read audit log: %+v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	expected := []AuditEntry{
+		{User: "waldo", Operation: AuditWrite, Path: "dir/file",
+			Client: "10.0.0.7", RequestID: "req-1", Result: "OK"},
+		{User: "", Operation: AuditRead, Path: "secret",
+			Client: "10.0.0.7", RequestID: "req-1", Result: "Unknown"},
+		{User: "waldo", Operation: AuditWrite, Path: "upload",
+			Client: "10.0.0.7", RequestID: "req-1", Result: "OK"},
+		{User: "waldo", Operation: AuditWrite, Path: "a",
+			Client: "10.0.0.7", RequestID: "req-1", Result: "OK"},
+		{User: "waldo", Operation: AuditWrite, Path: "b",
+			Client: "10.0.0.7", RequestID: "req-1", Result: "OK"},
+		{User: "waldo", Operation: AuditRead, Path: "c",
+			Client: "10.0.0.7", RequestID: "req-1", Result: "OK"},
+		{User: "waldo", Operation: AuditRead, Path: "d",
+			Client: "10.0.0.7", RequestID: "req-1", Result: "OK"},
+		{User: "waldo", Operation: AuditLogin, Path: "",
+			Client: "10.0.0.7", RequestID: "req-1", Result: "Unknown"},
+	}
+	if len(lines) != len(expected) {
+		t.Fatalf("Unexpected number of entries.\nexpected: %d\nreceived: %d",
+			len(expected), len(lines))
+	}
+	for i, line := range lines {
+		var entry AuditEntry
+		if err = json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatalf("Failed to parse entry %d: %+v", i, err)
+		}
+		if _, err = time.Parse(time.RFC3339Nano, entry.Time); err != nil {
+			t.Errorf("Invalid time of entry %d: %+v", i, err)
+		}
+		entry.Time = ""
+		if entry != expected[i] {
+			t.Errorf("Unexpected entry %d.\nexpected: %+v\nreceived: %+v",
+				i, expected[i], entry)
+		}
+	}
+}
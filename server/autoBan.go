@@ -0,0 +1,360 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package server
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	jww "github.com/spf13/jwalterweatherman"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// IPBannedErr is returned, with the PERMISSION_DENIED code, for requests from
+// an IP address that is banned for too many failed requests.
+var IPBannedErr = errors.New("address is banned for too many failed requests")
+
+// Default automatic banning parameters.
+const (
+	defaultMaxAuthFailures      = 10
+	defaultMaxMalformedRequests = 50
+	defaultAutoBanWindow        = 10 * time.Minute
+	defaultBanDuration          = time.Hour
+)
+
+// Reasons that an IP address is banned.
+const (
+	authFailuresBanReason = "authentication failures"
+	malformedBanReason    = "malformed requests"
+)
+
+// AutoBanParams are the parameters of automatic banning. They are set in the
+// "autoBan" section of the config.
+type AutoBanParams struct {
+	// MaxAuthFailures is the number of requests rejected for invalid
+	// credentials, tokens, or API keys or missing permissions after which an
+	// IP address is banned. Zero disables the limit. Defaults to 10.
+	MaxAuthFailures int `mapstructure:"maxAuthFailures"`
+
+	// MaxMalformedRequests is the number of requests rejected as invalid
+	// after which an IP address is banned. Zero disables the limit. Defaults
+	// to 50.
+	MaxMalformedRequests int `mapstructure:"maxMalformedRequests"`
+
+	// Window is the period over which failures are counted. The counts of an
+	// address are reset once it has passed since its first failure. Defaults
+	// to 10 minutes.
+	Window time.Duration `mapstructure:"window"`
+
+	// BanDuration is how long an IP address is banned for. Defaults to one
+	// hour.
+	BanDuration time.Duration `mapstructure:"banDuration"`
+
+	// Exempt is the list of IP addresses and CIDR networks that are never
+	// banned, such as those of reverse proxies and monitoring.
+	Exempt []string `mapstructure:"exempt"`
+}
+
+// IPBan is an IP address banned by AutoBan.
+type IPBan struct {
+	// IP is the banned address.
+	IP string
+
+	// Until is when the ban ends.
+	Until time.Time
+
+	// Reason is the kind of failed requests that caused the ban.
+	Reason string
+}
+
+// AutoBanStats are the statistics of automatic banning.
+type AutoBanStats struct {
+	// Banned is the number of IP addresses currently banned.
+	Banned int
+
+	// Bans is the number of times any IP address was banned since the server
+	// started.
+	Bans uint64
+}
+
+// AutoBan counts the failed requests of each IP address and bans addresses
+// with too many failures for a while, closing their connections when they are
+// accepted and rejecting their requests.
+type AutoBan struct {
+	params AutoBanParams
+	exempt []*net.IPNet
+
+	// proxies resolve the client addresses of HTTP requests that are not
+	// served as RPCs. They are set by NewServer and may be nil.
+	proxies *TrustedProxies
+
+	// clients are the failure counts and bans of the addresses with any.
+	clients map[string]*banState
+	bans    uint64
+	mux     sync.Mutex
+}
+
+// banState is the failures counted for an IP address in the current window and
+// its ban, if any.
+type banState struct {
+	windowStart  time.Time
+	authFailures int
+	malformed    int
+	until        time.Time
+	reason       string
+}
+
+// NewAutoBan creates a new AutoBan from the parameters. Returns an error for
+// unknown parameters, invalid exempt networks, negative limits, if both limits
+// are zero, or if the window or ban duration is not positive.
+func NewAutoBan(params map[string]interface{}) (*AutoBan, error) {
+	p := AutoBanParams{
+		MaxAuthFailures:      defaultMaxAuthFailures,
+		MaxMalformedRequests: defaultMaxMalformedRequests,
+		Window:               defaultAutoBanWindow,
+		BanDuration:          defaultBanDuration,
+	}
+	if err := decodeParams(params, &p, "auto ban"); err != nil {
+		return nil, err
+	}
+	if p.MaxAuthFailures < 0 || p.MaxMalformedRequests < 0 {
+		return nil, errors.Errorf("maximum authentication failures %d and "+
+			"malformed requests %d cannot be negative", p.MaxAuthFailures,
+			p.MaxMalformedRequests)
+	} else if p.MaxAuthFailures == 0 && p.MaxMalformedRequests == 0 {
+		return nil, errors.New("maximum authentication failures or " +
+			"malformed requests is required")
+	} else if p.Window <= 0 {
+		return nil, errors.Errorf("window %s must be positive", p.Window)
+	} else if p.BanDuration <= 0 {
+		return nil, errors.Errorf(
+			"ban duration %s must be positive", p.BanDuration)
+	}
+
+	ab := &AutoBan{params: p, clients: make(map[string]*banState)}
+	for _, network := range p.Exempt {
+		ipNet, err := parseNetwork(network)
+		if err != nil {
+			return nil, errors.WithMessage(err, "invalid exempt network")
+		}
+		ab.exempt = append(ab.exempt, ipNet)
+	}
+
+	return ab, nil
+}
+
+// Params returns the parameters of the automatic banning.
+func (ab *AutoBan) Params() AutoBanParams {
+	return ab.params
+}
+
+// Bans returns the IP addresses banned at the given time, sorted by address.
+func (ab *AutoBan) Bans(now time.Time) []IPBan {
+	ab.mux.Lock()
+	defer ab.mux.Unlock()
+	var bans []IPBan
+	for ip, state := range ab.clients {
+		if now.Before(state.until) {
+			bans = append(bans,
+				IPBan{IP: ip, Until: state.until, Reason: state.reason})
+		}
+	}
+	sort.Slice(bans, func(i, j int) bool { return bans[i].IP < bans[j].IP })
+	return bans
+}
+
+// Clear lifts the ban of the IP address and resets its failure counts, or of
+// all addresses if ip is empty. Returns the number of bans lifted.
+func (ab *AutoBan) Clear(ip string, now time.Time) int {
+	ab.mux.Lock()
+	defer ab.mux.Unlock()
+	var cleared int
+	for key, state := range ab.clients {
+		if ip == "" || key == banKey(ip) {
+			if now.Before(state.until) {
+				cleared++
+			}
+			delete(ab.clients, key)
+		}
+	}
+	return cleared
+}
+
+// Stats returns the statistics of the automatic banning at the given time.
+func (ab *AutoBan) Stats(now time.Time) AutoBanStats {
+	ab.mux.Lock()
+	defer ab.mux.Unlock()
+	stats := AutoBanStats{Bans: ab.bans}
+	for _, state := range ab.clients {
+		if now.Before(state.until) {
+			stats.Banned++
+		}
+	}
+	return stats
+}
+
+// banned returns the end of the ban of the IP address and true if it is banned
+// at the given time.
+func (ab *AutoBan) banned(ip string, now time.Time) (time.Time, bool) {
+	ab.mux.Lock()
+	defer ab.mux.Unlock()
+	state, exists := ab.clients[banKey(ip)]
+	if !exists || !now.Before(state.until) {
+		return time.Time{}, false
+	}
+	return state.until, true
+}
+
+// record counts the error of a request from the IP address if it is an
+// authentication failure or an invalid request, and bans the address if it
+// has now failed too many times within the window. Other errors are ignored.
+func (ab *AutoBan) record(ip string, err error, now time.Time) {
+	auth := isAuthFailure(err)
+	if ip == "" || !auth && status.Code(err) != codes.InvalidArgument {
+		return
+	} else if parsed := net.ParseIP(ip); parsed != nil &&
+		containsIP(ab.exempt, parsed) {
+		return
+	}
+
+	ab.mux.Lock()
+	defer ab.mux.Unlock()
+	key := banKey(ip)
+	state, exists := ab.clients[key]
+	if !exists {
+		state = &banState{windowStart: now}
+		ab.clients[key] = state
+	} else if now.Before(state.until) {
+		return
+	} else if now.Sub(state.windowStart) >= ab.params.Window {
+		*state = banState{windowStart: now}
+	}
+
+	if auth {
+		state.authFailures++
+		if state.authFailures == ab.params.MaxAuthFailures {
+			ab.ban(key, state, authFailuresBanReason, now)
+		}
+	} else {
+		state.malformed++
+		if state.malformed == ab.params.MaxMalformedRequests {
+			ab.ban(key, state, malformedBanReason, now)
+		}
+	}
+}
+
+// ban bans the IP address for the ban duration and resets its counts. Must be
+// called while the lock is held.
+func (ab *AutoBan) ban(
+	ip string, state *banState, reason string, now time.Time) {
+	*state = banState{until: now.Add(ab.params.BanDuration), reason: reason}
+	ab.bans++
+	jww.INFO.Printf("Banned %s until %s for too many %s.",
+		ip, state.until.Format(time.RFC3339), reason)
+}
+
+// interceptor returns a gRPC interceptor that rejects requests from banned IP
+// addresses with PERMISSION_DENIED and records the failed requests of others.
+func (ab *AutoBan) interceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{},
+		info *grpc.UnaryServerInfo, next grpc.UnaryHandler) (interface{}, error) {
+		ip := peerIP(ctx)
+		if err := ab.check(ip); err != nil {
+			jww.DEBUG.Printf("Rejected %s from banned %s.", info.FullMethod, ip)
+			return nil, status.Error(codes.PermissionDenied, err.Error())
+		}
+
+		resp, err := next(ctx, req)
+		if err != nil {
+			ab.record(ip, err, time.Now())
+		}
+		return resp, err
+	}
+}
+
+// check returns IPBannedErr, with the end of the ban, if the IP address is
+// banned.
+func (ab *AutoBan) check(ip string) error {
+	if ip == "" {
+		return nil
+	}
+	if until, banned := ab.banned(ip, time.Now()); banned {
+		return errors.Wrapf(
+			IPBannedErr, "retry after %s", until.Format(time.RFC3339))
+	}
+	return nil
+}
+
+// checkHTTP returns IPBannedErr if the client of an HTTP request that is not
+// served as an RPC is banned. It does nothing if the AutoBan is nil.
+func (ab *AutoBan) checkHTTP(r *http.Request) error {
+	if ab == nil {
+		return nil
+	}
+	return ab.check(ab.proxies.requestIP(r))
+}
+
+// recordHTTP records the error of an HTTP request that is not served as an
+// RPC. It does nothing if the AutoBan is nil.
+func (ab *AutoBan) recordHTTP(r *http.Request, err error) {
+	if ab != nil {
+		ab.record(ab.proxies.requestIP(r), err, time.Now())
+	}
+}
+
+// cleanup removes the addresses whose ban has ended and whose window has
+// passed every interval until the stop channel is closed.
+func (ab *AutoBan) cleanup(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case now := <-ticker.C:
+			ab.mux.Lock()
+			for ip, state := range ab.clients {
+				if !now.Before(state.until) &&
+					now.Sub(state.windowStart) >= ab.params.Window {
+					delete(ab.clients, ip)
+				}
+			}
+			ab.mux.Unlock()
+		}
+	}
+}
+
+// listener returns the listener with the connections from banned addresses
+// closed, or the listener unchanged if the AutoBan is nil.
+func (ab *AutoBan) listener(l net.Listener) net.Listener {
+	if ab == nil {
+		return l
+	}
+	return &filteredListener{Listener: l, reason: "banned",
+		allowed: func(ip net.IP) bool {
+			_, banned := ab.banned(ip.String(), time.Now())
+			return !banned
+		}}
+}
+
+// banKey returns the IP address in canonical form, so that each address has
+// one state however it is written, or the address unchanged if it is invalid.
+func banKey(ip string) string {
+	if parsed := net.ParseIP(ip); parsed != nil {
+		return parsed.String()
+	}
+	return ip
+}
@@ -0,0 +1,216 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package server
+
+import (
+	"context"
+	"io"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// Tests that NewAutoBan decodes the parameters and defaults the others.
+func TestNewAutoBan(t *testing.T) {
+	ab := newTestFromParams(NewAutoBan, map[string]interface{}{
+		"maxAuthFailures": "5", "banDuration": "30m",
+		"exempt": []string{"10.0.0.0/8"}}, t)
+	expected := AutoBanParams{
+		MaxAuthFailures:      5,
+		MaxMalformedRequests: defaultMaxMalformedRequests,
+		Window:               defaultAutoBanWindow,
+		BanDuration:          30 * time.Minute,
+		Exempt:               []string{"10.0.0.0/8"},
+	}
+	if !reflect.DeepEqual(ab.Params(), expected) {
+		t.Errorf("Unexpected parameters.\nexpected: %+v\nreceived: %+v",
+			expected, ab.Params())
+	}
+}
+
+// Tests that AutoBan.record bans an address once it reaches either limit
+// within the window, until the ban duration has passed, and ignores other
+// errors and exempt addresses.
+func TestAutoBan_record(t *testing.T) {
+	ab := newTestFromParams(NewAutoBan, map[string]interface{}{
+		"maxAuthFailures": 3, "maxMalformedRequests": 2, "window": "1m",
+		"banDuration": "1h", "exempt": []string{"192.0.2.0/24"}}, t)
+	now := time.Now()
+	authErr := status.Error(codes.Unauthenticated, "invalid token")
+	malformedErr := status.Error(codes.InvalidArgument, "invalid path")
+
+	// Failures spread over more than the window are not enough
+	ab.record("198.51.100.1", authErr, now)
+	ab.record("198.51.100.1", authErr, now.Add(30*time.Second))
+	ab.record("198.51.100.1", authErr, now.Add(61*time.Second))
+	ab.record("198.51.100.1", InvalidCredentialsErr, now.Add(62*time.Second))
+	if _, banned := ab.banned("198.51.100.1", now.Add(62*time.Second)); banned {
+		t.Errorf("Address banned for failures outside of the window.")
+	}
+	ab.record("198.51.100.1", authErr, now.Add(63*time.Second))
+	until, banned := ab.banned("198.51.100.1", now.Add(63*time.Second))
+	if !banned || !until.Equal(now.Add(time.Hour+63*time.Second)) {
+		t.Errorf("Address not banned until the end of the ban duration: %s",
+			until)
+	}
+
+	ab.record("2001:db8::1", malformedErr, now)
+	ab.record("2001:0db8::0001", malformedErr, now)
+	for _, err := range []error{status.Error(codes.NotFound, "not found"),
+		status.Error(codes.ResourceExhausted, "rate limit exceeded"),
+		errors.New("internal")} {
+		for i := 0; i < 10; i++ {
+			ab.record("203.0.113.1", err, now)
+		}
+	}
+	for i := 0; i < 10; i++ {
+		ab.record("192.0.2.1", authErr, now)
+	}
+
+	expected := []IPBan{
+		{"198.51.100.1", now.Add(time.Hour + 63*time.Second),
+			authFailuresBanReason},
+		{"2001:db8::1", now.Add(time.Hour), malformedBanReason},
+	}
+	if bans := ab.Bans(now.Add(2 * time.Minute)); !reflect.DeepEqual(
+		bans, expected) {
+		t.Errorf("Unexpected bans.\nexpected: %+v\nreceived: %+v",
+			expected, bans)
+	}
+	stats := ab.Stats(now.Add(2 * time.Minute))
+	if stats != (AutoBanStats{Banned: 2, Bans: 2}) {
+		t.Errorf("Unexpected stats: %+v", stats)
+	}
+
+	if _, banned = ab.banned("2001:db8::1", now.Add(time.Hour)); banned {
+		t.Errorf("Address still banned after the ban duration.")
+	}
+	if bans := ab.Bans(now.Add(2 * time.Hour)); len(bans) != 0 {
+		t.Errorf("Bans listed after the ban duration: %+v", bans)
+	}
+}
+
+// Tests that AutoBan.Clear lifts the ban of one address or of all addresses.
+func TestAutoBan_Clear(t *testing.T) {
+	ab := newTestFromParams(NewAutoBan,
+		map[string]interface{}{"maxAuthFailures": 1}, t)
+	now := time.Now()
+	for _, ip := range []string{"198.51.100.1", "198.51.100.2", "2001:db8::1"} {
+		ab.record(ip, InvalidTokenErr, now)
+	}
+
+	if cleared := ab.Clear("2001:0db8::1", now); cleared != 1 {
+		t.Errorf("Unexpected number of bans cleared: %d", cleared)
+	}
+	if _, banned := ab.banned("2001:db8::1", now); banned {
+		t.Errorf("Address still banned after its ban was cleared.")
+	}
+	if cleared := ab.Clear("203.0.113.1", now); cleared != 0 {
+		t.Errorf("Unexpected number of bans cleared: %d", cleared)
+	}
+	if cleared := ab.Clear("", now); cleared != 2 {
+		t.Errorf("Unexpected number of bans cleared: %d", cleared)
+	}
+	if bans := ab.Bans(now); len(bans) != 0 {
+		t.Errorf("Bans listed after all were cleared: %+v", bans)
+	}
+}
+
+// Tests that the interceptor of AutoBan records failed requests and rejects
+// the requests of banned addresses with PERMISSION_DENIED without serving
+// them.
+func TestAutoBan_interceptor(t *testing.T) {
+	ab := newTestFromParams(NewAutoBan,
+		map[string]interface{}{"maxAuthFailures": 2}, t)
+	interceptor := ab.interceptor()
+	ctx := peer.NewContext(context.Background(), &peer.Peer{
+		Addr: &net.TCPAddr{IP: net.ParseIP("198.51.100.1"), Port: 5000}})
+	var served int
+	next := func(context.Context, interface{}) (interface{}, error) {
+		served++
+		return nil, status.Error(codes.Unauthenticated, "invalid token")
+	}
+
+	for i := 0; i < 2; i++ {
+		_, err := interceptor(ctx, nil, &grpc.UnaryServerInfo{}, next)
+		if status.Code(err) != codes.Unauthenticated {
+			t.Errorf("Unexpected error (%d): %+v", i, err)
+		}
+	}
+	_, err := interceptor(ctx, nil, &grpc.UnaryServerInfo{}, next)
+	if status.Code(err) != codes.PermissionDenied ||
+		!strings.Contains(err.Error(), IPBannedErr.Error()) {
+		t.Errorf("Unexpected error for a banned address: %+v", err)
+	}
+	if served != 2 {
+		t.Errorf("Request of a banned address was served.")
+	}
+}
+
+// Tests that the listener of AutoBan closes connections from banned addresses
+// and accepts them again once the ban is cleared.
+func TestAutoBan_listener(t *testing.T) {
+	ab := newTestFromParams(NewAutoBan,
+		map[string]interface{}{"maxAuthFailures": 1}, t)
+	ab.record("127.0.0.1", InvalidCredentialsErr, time.Now())
+	nl, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %+v", err)
+	}
+	l := ab.listener(nl)
+	defer func() { _ = l.Close() }()
+
+	accepted := make(chan net.Conn)
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				close(accepted)
+				return
+			}
+			accepted <- conn
+		}
+	}()
+	dial := func() net.Conn {
+		conn, err := net.Dial("tcp", nl.Addr().String())
+		if err != nil {
+			t.Fatalf("Failed to dial: %+v", err)
+		}
+		return conn
+	}
+
+	banned := dial()
+	defer func() { _ = banned.Close() }()
+	_ = banned.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, err = banned.Read(make([]byte, 1)); err != io.EOF {
+		t.Errorf("Connection from a banned address was not closed: %v", err)
+	}
+
+	ab.Clear("127.0.0.1", time.Now())
+	allowed := dial()
+	defer func() { _ = allowed.Close() }()
+	select {
+	case conn := <-accepted:
+		_ = conn.Close()
+	case <-time.After(5 * time.Second):
+		t.Errorf("Connection from an unbanned address was not accepted.")
+	}
+
+	var nilBan *AutoBan
+	if nilBan.listener(nl) != nl {
+		t.Errorf("Listener was wrapped without automatic banning.")
+	}
+}
@@ -0,0 +1,433 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package server
+
+import (
+	"archive/tar"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"path"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/argon2"
+
+	"gitlab.com/elixxir/remoteSyncServer/rpc"
+	"gitlab.com/elixxir/remoteSyncServer/store"
+)
+
+// Paths in the tar archive of a backup.
+const (
+	// BackupCredentialsPath is the credential store, in the format of the CSV
+	// credential store.
+	BackupCredentialsPath = "credentials.csv"
+
+	// BackupStorageDir is the directory that contains a directory for each
+	// user with their files, in the layout of the file storage backend.
+	BackupStorageDir = "storage"
+
+	// BackupManifestPath is the manifest of the backup, which is written last.
+	BackupManifestPath = "manifest.json"
+)
+
+const (
+	// backupChunkSize is the size of the chunks of the archive sent by the
+	// Backup RPC.
+	backupChunkSize = 1 << 20
+
+	// backupSegmentSize is the largest amount of the archive encrypted in one
+	// segment of an encrypted backup.
+	backupSegmentSize = 64 << 10
+
+	// backupSaltLen is the length, in bytes, of the salt that the key of an
+	// encrypted backup is derived from its passphrase with.
+	backupSaltLen = 16
+)
+
+// Argon2id parameters used to derive the key of an encrypted backup from its
+// passphrase. They are the same as for encryption at rest and must never
+// change, since existing backups could no longer be decrypted.
+const (
+	backupPassphraseTime    = 3
+	backupPassphraseMemory  = 64 * 1024
+	backupPassphraseThreads = 4
+)
+
+// encryptedBackupMagic is the prefix of an encrypted backup. It is followed by
+// the salt and the segments, each of which is the length of its ciphertext as
+// a big-endian uint32 and the AES-GCM ciphertext.
+var encryptedBackupMagic = []byte("RSSB\x01")
+
+var (
+	// InvalidBackupErr is returned when decrypting data that is not an
+	// encrypted backup, was encrypted with another passphrase, was modified,
+	// or is truncated.
+	InvalidBackupErr = errors.New(
+		"invalid backup: wrong passphrase, corrupted, or truncated")
+)
+
+// BackupManifest describes a backup. Files modified before Since are not in
+// the archive of an incremental backup but are listed in Users, so that files
+// that are not listed were deleted since the previous backup.
+type BackupManifest struct {
+	// Time is when the backup started. Use it as the Since of the next
+	// incremental backup.
+	Time time.Time `json:"time"`
+
+	// Since is the time after which the files in the archive were modified.
+	// It is zero for a full backup.
+	Since time.Time `json:"since,omitempty"`
+
+	// Users maps each user to the paths of all of their files.
+	Users map[string][]string `json:"users"`
+
+	// Files and Bytes are the number of files in the archive and the total
+	// size of their data.
+	Files int   `json:"files"`
+	Bytes int64 `json:"bytes"`
+}
+
+// writeBackup writes a tar archive of the credential store and of the files of
+// all registered and known users modified after since to w, followed by its
+// manifest. The writes of
+// each user are paused while their files are archived. Returns
+// [store.NotListableErr] if the storage backend cannot list files.
+func writeBackup(
+	h *handler, w io.Writer, since time.Time) (*BackupManifest, error) {
+	m := &BackupManifest{Time: time.Now(), Since: since,
+		Users: make(map[string][]string)}
+	tw := tar.NewWriter(w)
+
+	registered, err := h.users.List()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list users")
+	}
+	var credentials bytes.Buffer
+	cw := csv.NewWriter(&credentials)
+	for _, username := range registered {
+		password, err := h.users.Get(username)
+		if err != nil {
+			return nil, errors.Wrapf(
+				err, "failed to get credentials of %q", username)
+		}
+		if err = cw.Write([]string{username, password}); err != nil {
+			return nil, errors.Wrap(err, "failed to encode credentials")
+		}
+	}
+	cw.Flush()
+	err = writeBackupFile(
+		tw, BackupCredentialsPath, credentials.Bytes(), m.Time)
+	if err != nil {
+		return nil, err
+	}
+
+	usernames, err := h.allUsers().List()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list users")
+	}
+	for _, username := range usernames {
+		if err = backupUser(h, tw, username, m); err != nil {
+			return nil, errors.WithMessagef(err, "user %q", username)
+		}
+	}
+
+	data, err := json.MarshalIndent(m, "", "\t")
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to encode manifest")
+	}
+	if err = writeBackupFile(tw, BackupManifestPath, data, m.Time); err != nil {
+		return nil, err
+	}
+	if err = tw.Close(); err != nil {
+		return nil, errors.Wrap(err, "failed to finish archive")
+	}
+	return m, nil
+}
+
+// ReadBackupManifest reads the tar archive of a backup to its end and returns
+// its manifest.
+func ReadBackupManifest(r io.Reader) (*BackupManifest, error) {
+	var m *BackupManifest
+	tr := tar.NewReader(r)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, errors.Wrap(err, "failed to read archive")
+		} else if header.Name != BackupManifestPath {
+			continue
+		}
+		m = &BackupManifest{}
+		if err = json.NewDecoder(tr).Decode(m); err != nil {
+			return nil, errors.Wrap(err, "failed to decode manifest")
+		}
+	}
+	if _, err := io.Copy(io.Discard, r); err != nil {
+		return nil, errors.Wrap(err, "failed to read archive")
+	} else if m == nil {
+		return nil, errors.Errorf("archive has no %s", BackupManifestPath)
+	}
+	return m, nil
+}
+
+// backupUser writes the files of the user modified after the Since of the
+// manifest to the archive, and lists all of their files in the manifest, while
+// no write of the user is applied.
+func backupUser(
+	h *handler, tw *tar.Writer, username string, m *BackupManifest) error {
+	s, err := h.newStore(h.storageDir, username)
+	if err != nil {
+		return err
+	}
+	lister, ok := s.(store.Lister)
+	if !ok {
+		return store.NotListableErr
+	}
+
+	l := h.locks.get(username)
+	l.Lock()
+	defer l.Unlock()
+	files, err := lister.ListFiles()
+	if err != nil {
+		return errors.Wrap(err, "failed to list files")
+	}
+	m.Users[username] = files
+	for _, file := range files {
+		modified, err := s.GetLastModified(file)
+		if err != nil {
+			return errors.Wrapf(
+				err, "failed to get modification time of %s", file)
+		} else if !modified.After(m.Since) {
+			continue
+		}
+		data, err := s.Read(file)
+		if err != nil {
+			return errors.Wrapf(err, "failed to read %s", file)
+		}
+		err = writeBackupFile(
+			tw, path.Join(BackupStorageDir, username, file), data, modified)
+		if err != nil {
+			return err
+		}
+		m.Files++
+		m.Bytes += int64(len(data))
+	}
+	return nil
+}
+
+// writeBackupFile writes a file with the data and modification time to the
+// archive. The PAX format is used so that the modification time keeps its
+// sub-second precision, which restores compare against existing files.
+func writeBackupFile(
+	tw *tar.Writer, name string, data []byte, modified time.Time) error {
+	err := tw.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     name,
+		Size:     int64(len(data)),
+		Mode:     0600,
+		ModTime:  modified,
+		Format:   tar.FormatPAX,
+	})
+	if err != nil {
+		return errors.Wrapf(err, "failed to write header of %s", name)
+	}
+	if _, err = tw.Write(data); err != nil {
+		return errors.Wrapf(err, "failed to write %s", name)
+	}
+	return nil
+}
+
+// backupSender is an io.Writer that sends everything written to it as chunks
+// of the Backup RPC.
+type backupSender struct {
+	stream rpc.Admin_BackupServer
+}
+
+// Write sends the data as one chunk.
+func (bs *backupSender) Write(data []byte) (int, error) {
+	chunk := &rpc.RsBackupChunk{Data: append([]byte(nil), data...)}
+	if err := bs.stream.Send(chunk); err != nil {
+		return 0, err
+	}
+	return len(data), nil
+}
+
+// EncryptBackup returns a writer that encrypts everything written to it with
+// AES-256-GCM, with a key derived from the passphrase with Argon2id, and
+// writes it to w. It must be closed to write the final segment, without which
+// the backup cannot be decrypted.
+func EncryptBackup(w io.Writer, passphrase []byte) (io.WriteCloser, error) {
+	salt := make([]byte, backupSaltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, errors.Wrap(err, "failed to generate salt")
+	}
+	aead, err := newBackupCipher(passphrase, salt)
+	if err != nil {
+		return nil, err
+	}
+	header := append(append([]byte(nil), encryptedBackupMagic...), salt...)
+	if _, err = w.Write(header); err != nil {
+		return nil, errors.Wrap(err, "failed to write header")
+	}
+	return &backupEncrypter{w: w, aead: aead}, nil
+}
+
+// DecryptBackup returns a reader of the backup that r encrypted with
+// EncryptBackup and the passphrase. Its reads return [InvalidBackupErr] if the
+// backup was encrypted with another passphrase, was modified, or is truncated.
+func DecryptBackup(r io.Reader, passphrase []byte) (io.Reader, error) {
+	header := make([]byte, len(encryptedBackupMagic)+backupSaltLen)
+	if _, err := io.ReadFull(r, header); err != nil ||
+		!bytes.HasPrefix(header, encryptedBackupMagic) {
+		return nil, errors.Wrap(InvalidBackupErr, "not an encrypted backup")
+	}
+	aead, err := newBackupCipher(
+		passphrase, header[len(encryptedBackupMagic):])
+	if err != nil {
+		return nil, err
+	}
+	return &backupDecrypter{r: r, aead: aead}, nil
+}
+
+// newBackupCipher returns the AES-256-GCM cipher with the key derived from the
+// passphrase and salt.
+func newBackupCipher(passphrase, salt []byte) (cipher.AEAD, error) {
+	key := argon2.IDKey(passphrase, salt, backupPassphraseTime,
+		backupPassphraseMemory, backupPassphraseThreads, 32)
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// backupSegmentNonce returns the nonce of the segment with the index. The
+// final segment is authenticated as such, so that a backup truncated after
+// any segment is detected.
+func backupSegmentNonce(aead cipher.AEAD, index uint64) []byte {
+	nonce := make([]byte, aead.NonceSize())
+	binary.BigEndian.PutUint64(nonce[len(nonce)-8:], index)
+	return nonce
+}
+
+// backupEncrypter encrypts the data written to it in segments of
+// backupSegmentSize.
+type backupEncrypter struct {
+	w     io.Writer
+	aead  cipher.AEAD
+	buf   []byte
+	index uint64
+}
+
+// Write encrypts and writes each full segment of the data.
+func (be *backupEncrypter) Write(data []byte) (int, error) {
+	n := len(data)
+	for len(data) > 0 {
+		m := backupSegmentSize - len(be.buf)
+		if m > len(data) {
+			m = len(data)
+		}
+		be.buf, data = append(be.buf, data[:m]...), data[m:]
+		if len(be.buf) == backupSegmentSize {
+			if err := be.writeSegment(false); err != nil {
+				return 0, err
+			}
+		}
+	}
+	return n, nil
+}
+
+// Close encrypts and writes the final segment. It does not close the
+// underlying writer.
+func (be *backupEncrypter) Close() error {
+	return be.writeSegment(true)
+}
+
+// writeSegment encrypts and writes the buffered data as the next segment.
+func (be *backupEncrypter) writeSegment(final bool) error {
+	ciphertext := be.aead.Seal(nil, backupSegmentNonce(be.aead, be.index),
+		be.buf, backupSegmentData(final))
+	be.index++
+	be.buf = be.buf[:0]
+
+	var length [4]byte
+	binary.BigEndian.PutUint32(length[:], uint32(len(ciphertext)))
+	if _, err := be.w.Write(length[:]); err != nil {
+		return err
+	}
+	_, err := be.w.Write(ciphertext)
+	return err
+}
+
+// backupDecrypter decrypts the segments read from r.
+type backupDecrypter struct {
+	r     io.Reader
+	aead  cipher.AEAD
+	buf   []byte
+	index uint64
+	final bool
+}
+
+// Read returns the decrypted data of the segments, and io.EOF after the final
+// segment.
+func (bd *backupDecrypter) Read(p []byte) (int, error) {
+	for len(bd.buf) == 0 {
+		if bd.final {
+			return 0, io.EOF
+		} else if err := bd.readSegment(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, bd.buf)
+	bd.buf = bd.buf[n:]
+	return n, nil
+}
+
+// readSegment reads and decrypts the next segment.
+func (bd *backupDecrypter) readSegment() error {
+	var length [4]byte
+	if _, err := io.ReadFull(bd.r, length[:]); err != nil {
+		return errors.Wrap(InvalidBackupErr, "missing final segment")
+	}
+	n := binary.BigEndian.Uint32(length[:])
+	if n > backupSegmentSize+uint32(bd.aead.Overhead()) {
+		return errors.Wrapf(InvalidBackupErr, "segment of %d bytes", n)
+	}
+	ciphertext := make([]byte, n)
+	if _, err := io.ReadFull(bd.r, ciphertext); err != nil {
+		return errors.Wrap(InvalidBackupErr, "truncated segment")
+	}
+
+	nonce := backupSegmentNonce(bd.aead, bd.index)
+	for _, final := range []bool{false, true} {
+		data, err := bd.aead.Open(
+			nil, nonce, ciphertext, backupSegmentData(final))
+		if err == nil {
+			bd.buf, bd.final = data, final
+			bd.index++
+			return nil
+		}
+	}
+	return errors.Wrapf(InvalidBackupErr, "segment %d", bd.index)
+}
+
+// backupSegmentData returns the additional data of a segment, which marks the
+// final one.
+func backupSegmentData(final bool) []byte {
+	if final {
+		return []byte{1}
+	}
+	return []byte{0}
+}
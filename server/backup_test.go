@@ -0,0 +1,223 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package server
+
+import (
+	"archive/tar"
+	"bytes"
+	"io"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"gitlab.com/elixxir/remoteSyncServer/credentials"
+	"gitlab.com/elixxir/remoteSyncServer/store"
+)
+
+// Tests that writeBackup archives the credentials and the files of all users
+// and that ReadBackupManifest returns its manifest.
+func Test_writeBackup(t *testing.T) {
+	h := newTestBackupHandler(t)
+	var buf bytes.Buffer
+	m, err := writeBackup(h, &buf, time.Time{})
+	if err != nil {
+		t.Fatalf("Failed to back up: %+v", err)
+	}
+
+	expected := map[string]string{
+		BackupCredentialsPath: "carmen,hash2\nwaldo,hash1\n",
+		"storage/carmen/c":    "c",
+		"storage/waldo/a":     "a",
+		"storage/waldo/dir/b": "dir/b",
+	}
+	received := readTestArchive(buf.Bytes(), t)
+	delete(received, BackupManifestPath)
+	if !reflect.DeepEqual(expected, received) {
+		t.Errorf("Unexpected archive.\nexpected: %v\nreceived: %v",
+			expected, received)
+	}
+
+	users := map[string][]string{"carmen": {"c"}, "waldo": {"a", "dir/b"}}
+	if !reflect.DeepEqual(users, m.Users) || m.Files != 3 || m.Bytes != 7 {
+		t.Errorf("Unexpected manifest: %+v", m)
+	}
+	read, err := ReadBackupManifest(&buf)
+	if err != nil {
+		t.Fatalf("Failed to read manifest: %+v", err)
+	}
+	if !reflect.DeepEqual(users, read.Users) || !read.Time.Equal(m.Time) {
+		t.Errorf("Unexpected read manifest.\nexpected: %+v\nreceived: %+v",
+			m, read)
+	}
+}
+
+// Tests that writeBackup archives the files of users that are known but not
+// registered, such as OIDC users, without credentials for them.
+func Test_writeBackup_KnownUsers(t *testing.T) {
+	h := newTestBackupHandler(t)
+	h.known = NewKnownUsers(credentials.NewMemStore(nil))
+	h.newStore = h.known.wrap(h.newStore)
+	writeTestFiles(h.newStore, "alice", t, "d")
+
+	var buf bytes.Buffer
+	m, err := writeBackup(h, &buf, time.Time{})
+	if err != nil {
+		t.Fatalf("Failed to back up: %+v", err)
+	}
+	received := readTestArchive(buf.Bytes(), t)
+	if received["storage/alice/d"] != "d" ||
+		received[BackupCredentialsPath] != "carmen,hash2\nwaldo,hash1\n" {
+		t.Errorf("Unexpected archive: %v", received)
+	}
+	if len(m.Users) != 3 || m.Files != 4 {
+		t.Errorf("Unexpected manifest: %+v", m)
+	}
+}
+
+// Tests that an incremental backup only archives the files modified after the
+// time but lists all files in the manifest.
+func Test_writeBackup_Since(t *testing.T) {
+	h := newTestBackupHandler(t)
+	since := time.Now()
+	s, err := h.newStore(h.storageDir, "waldo")
+	if err != nil {
+		t.Fatalf("Failed to create store: %+v", err)
+	}
+	if err = s.Write("a", []byte("new")); err != nil {
+		t.Fatalf("Failed to write: %+v", err)
+	}
+
+	var buf bytes.Buffer
+	m, err := writeBackup(h, &buf, since)
+	if err != nil {
+		t.Fatalf("Failed to back up: %+v", err)
+	}
+	received := readTestArchive(buf.Bytes(), t)
+	if len(received) != 3 || received["storage/waldo/a"] != "new" {
+		t.Errorf("Unexpected archive: %v", received)
+	}
+	if len(m.Users["waldo"]) != 2 || m.Files != 1 || !m.Since.Equal(since) {
+		t.Errorf("Unexpected manifest: %+v", m)
+	}
+}
+
+// Error path: Tests that writeBackup returns store.NotListableErr when the
+// storage backend cannot list files.
+func Test_writeBackup_NotListable(t *testing.T) {
+	h := newTestBackupHandler(t)
+	newStore := h.newStore
+	h.newStore = func(storageDir, baseDir string) (store.Store, error) {
+		s, err := newStore(storageDir, baseDir)
+		return struct{ store.Store }{s}, err
+	}
+	_, err := writeBackup(h, io.Discard, time.Time{})
+	if !errors.Is(err, store.NotListableErr) {
+		t.Errorf("Unexpected error: %+v", err)
+	}
+}
+
+// Tests that data encrypted with EncryptBackup is decrypted by DecryptBackup
+// for sizes around the segment size.
+func TestEncryptBackup_DecryptBackup(t *testing.T) {
+	sizes := []int{0, 1, backupSegmentSize, 3*backupSegmentSize + 5}
+	for _, size := range sizes {
+		data := bytes.Repeat([]byte{'a'}, size)
+		encrypted := encryptTestBackup(data, t)
+
+		r, err := DecryptBackup(bytes.NewReader(encrypted), []byte("pass"))
+		if err != nil {
+			t.Fatalf("Failed to start decrypting (%d): %+v", size, err)
+		}
+		decrypted, err := io.ReadAll(r)
+		if err != nil {
+			t.Fatalf("Failed to decrypt (%d): %+v", size, err)
+		}
+		if !bytes.Equal(data, decrypted) {
+			t.Errorf("Decrypted %d bytes; expected %d.",
+				len(decrypted), len(data))
+		}
+	}
+}
+
+// Error path: Tests that DecryptBackup fails with InvalidBackupErr for the
+// wrong passphrase, modified or truncated backups, and data that is not an
+// encrypted backup.
+func TestDecryptBackup_Error(t *testing.T) {
+	encrypted := encryptTestBackup(
+		bytes.Repeat([]byte{'a'}, 2*backupSegmentSize), t)
+	modified := append([]byte(nil), encrypted...)
+	modified[len(modified)/2] ^= 1
+	tests := map[string]struct {
+		data       []byte
+		passphrase string
+	}{
+		"wrong passphrase": {encrypted, "wrong"},
+		"modified":         {modified, "pass"},
+		"truncated":        {encrypted[:len(encrypted)-30], "pass"},
+		"last segment":     {encrypted[:len(encrypted)-20], "pass"},
+		"not encrypted":    {[]byte("plain tar archive"), "pass"},
+	}
+	for name, tt := range tests {
+		r, err := DecryptBackup(
+			bytes.NewReader(tt.data), []byte(tt.passphrase))
+		if err == nil {
+			_, err = io.ReadAll(r)
+		}
+		if !errors.Is(err, InvalidBackupErr) {
+			t.Errorf("Unexpected error for %s: %+v", name, err)
+		}
+	}
+}
+
+// newTestBackupHandler returns a handler with the users waldo and carmen and
+// some files of each.
+func newTestBackupHandler(t *testing.T) *handler {
+	users := credentials.NewMemStore(
+		map[string]string{"waldo": "hash1", "carmen": "hash2"})
+	h := newHandler("", time.Hour, users, nil, newTestGCStore(false, t))
+	writeTestFiles(h.newStore, "waldo", t, "a", "dir/b")
+	writeTestFiles(h.newStore, "carmen", t, "c")
+	return h
+}
+
+// readTestArchive returns the data of each file in the tar archive.
+func readTestArchive(data []byte, t *testing.T) map[string]string {
+	files := make(map[string]string)
+	tr := tar.NewReader(bytes.NewReader(data))
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return files
+		} else if err != nil {
+			t.Fatalf("Failed to read archive: %+v", err)
+		}
+		fileData, err := io.ReadAll(tr)
+		if err != nil {
+			t.Fatalf("Failed to read %s: %+v", header.Name, err)
+		}
+		files[header.Name] = string(fileData)
+	}
+}
+
+// encryptTestBackup returns the data encrypted with the passphrase "pass".
+func encryptTestBackup(data []byte, t *testing.T) []byte {
+	var buf bytes.Buffer
+	w, err := EncryptBackup(&buf, []byte("pass"))
+	if err != nil {
+		t.Fatalf("Failed to start encrypting: %+v", err)
+	}
+	if _, err = w.Write(data); err != nil {
+		t.Fatalf("Failed to encrypt: %+v", err)
+	}
+	if err = w.Close(); err != nil {
+		t.Fatalf("Failed to finish encrypting: %+v", err)
+	}
+	return buf.Bytes()
+}
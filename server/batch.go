@@ -0,0 +1,30 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package server
+
+import (
+	"github.com/pkg/errors"
+)
+
+// maxBatchSize is the largest number of files read or written by a batch, so
+// that a batch does not hold up the other requests of its user for long.
+const maxBatchSize = 1000
+
+// InvalidBatchErr is returned for a batch without files or with more than the
+// maximum number of files.
+var InvalidBatchErr = errors.New("invalid batch")
+
+// checkBatch returns [InvalidBatchErr] if the number of files of a batch is
+// not 1 to maxBatchSize.
+func checkBatch(n int) error {
+	if n == 0 || n > maxBatchSize {
+		return errors.Wrapf(InvalidBatchErr,
+			"%d files must be 1 to %d", n, maxBatchSize)
+	}
+	return nil
+}
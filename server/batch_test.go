@@ -0,0 +1,130 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package server
+
+import (
+	"bytes"
+	"context"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"gitlab.com/elixxir/remoteSyncServer/rpc"
+)
+
+// Tests that handler.BatchWrite writes all files and that handler.BatchRead
+// returns them in the order of the paths, marking missing files as not found.
+func Test_handler_BatchWrite_BatchRead(t *testing.T) {
+	h, token := newHandlerLogin(
+		time.Hour, "waldo", "hunter2", rand.New(rand.NewSource(86)), t)
+
+	writes := []*rpc.RsBatchWrite{
+		{Path: "keys/a", Data: []byte("apple")},
+		{Path: "keys/b", Data: []byte("banana")},
+		{Path: "keys/a", Data: []byte("apricot")},
+	}
+	_, err := h.BatchWrite(context.Background(),
+		&rpc.RsBatchWriteRequest{Token: token.Marshal(), Writes: writes})
+	if err != nil {
+		t.Fatalf("Failed to write batch: %+v", err)
+	}
+
+	resp, err := h.BatchRead(context.Background(), &rpc.RsBatchReadRequest{
+		Token: token.Marshal(), Paths: []string{"keys/b", "keys/c", "keys/a"}})
+	if err != nil {
+		t.Fatalf("Failed to read batch: %+v", err)
+	}
+	expected := []*rpc.RsBatchReadResult{
+		{Path: "keys/b", Data: []byte("banana")},
+		{Path: "keys/c", NotFound: true},
+		{Path: "keys/a", Data: []byte("apricot")},
+	}
+	if len(resp.GetResults()) != len(expected) {
+		t.Fatalf("Unexpected number of results.\nexpected: %d\nreceived: %d",
+			len(expected), len(resp.GetResults()))
+	}
+	for i, result := range resp.GetResults() {
+		if result.GetPath() != expected[i].Path ||
+			result.GetNotFound() != expected[i].NotFound ||
+			!bytes.Equal(result.GetData(), expected[i].Data) {
+			t.Errorf("Unexpected result %d.\nexpected: %v\nreceived: %v",
+				i, expected[i], result)
+		}
+	}
+}
+
+// Error path: Tests that handler.BatchWrite writes no file when the data of
+// one exceeds the maximum object size.
+func Test_handler_BatchWrite_ObjectTooLargeError(t *testing.T) {
+	h, token := newHandlerLogin(
+		time.Hour, "waldo", "hunter2", rand.New(rand.NewSource(86)), t)
+	h.limits, _ = NewLimits(5, 0)
+
+	_, err := h.BatchWrite(context.Background(), &rpc.RsBatchWriteRequest{
+		Token: token.Marshal(), Writes: []*rpc.RsBatchWrite{
+			{Path: "a", Data: []byte("12345")},
+			{Path: "b", Data: []byte("123456")}}})
+	if !errors.Is(err, ObjectTooLargeErr) {
+		t.Errorf("Unexpected error for large write.\nexpected: %v"+
+			"\nreceived: %+v", ObjectTooLargeErr, err)
+	}
+
+	resp, _ := h.BatchRead(context.Background(), &rpc.RsBatchReadRequest{
+		Token: token.Marshal(), Paths: []string{"a"}})
+	if !resp.GetResults()[0].GetNotFound() {
+		t.Errorf("File written before the write that was too large.")
+	}
+}
+
+// Error path: Tests that handler.BatchRead and handler.BatchWrite return
+// InvalidBatchErr for an empty batch and a batch with too many files.
+func Test_handler_Batch_InvalidBatchError(t *testing.T) {
+	h, token := newHandlerLogin(
+		time.Hour, "waldo", "hunter2", rand.New(rand.NewSource(86)), t)
+
+	for _, n := range []int{0, maxBatchSize + 1} {
+		_, err := h.BatchRead(context.Background(), &rpc.RsBatchReadRequest{
+			Token: token.Marshal(), Paths: make([]string, n)})
+		if !errors.Is(err, InvalidBatchErr) {
+			t.Errorf("Unexpected error for read of %d files."+
+				"\nexpected: %v\nreceived: %+v", n, InvalidBatchErr, err)
+		}
+
+		writes := make([]*rpc.RsBatchWrite, n)
+		for i := range writes {
+			writes[i] = &rpc.RsBatchWrite{Path: "a"}
+		}
+		_, err = h.BatchWrite(context.Background(),
+			&rpc.RsBatchWriteRequest{Token: token.Marshal(), Writes: writes})
+		if !errors.Is(err, InvalidBatchErr) {
+			t.Errorf("Unexpected error for write of %d files."+
+				"\nexpected: %v\nreceived: %+v", n, InvalidBatchErr, err)
+		}
+	}
+}
+
+// Error path: Tests that handler.BatchWrite returns InsufficientScopeErr for a
+// token that does not allow writing.
+func Test_handler_BatchWrite_InsufficientScopeError(t *testing.T) {
+	h, _ := newHandlerLogin(
+		time.Hour, "waldo", "hunter2", rand.New(rand.NewSource(86)), t)
+	s, err := h.addAPIKeySession("waldo", Scopes{ScopeRead})
+	if err != nil {
+		t.Fatalf("Failed to add API key session: %+v", err)
+	}
+
+	_, err = h.BatchWrite(context.Background(), &rpc.RsBatchWriteRequest{
+		Token:  Token(s.Value).Marshal(),
+		Writes: []*rpc.RsBatchWrite{{Path: "a", Data: []byte("a")}}})
+	if !errors.Is(err, InsufficientScopeErr) {
+		t.Errorf("Unexpected error for read-only token."+
+			"\nexpected: %v\nreceived: %+v", InsufficientScopeErr, err)
+	}
+}
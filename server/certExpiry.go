@@ -0,0 +1,277 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	jww "github.com/spf13/jwalterweatherman"
+)
+
+const (
+	defaultCertExpiryRepeatInterval = 24 * time.Hour
+	defaultCertExpiryWebhookTimeout = 10 * time.Second
+
+	// certExpiryCheckInterval is how often the expiry of the certificates is
+	// checked.
+	certExpiryCheckInterval = time.Hour
+)
+
+// defaultCertExpiryWarnBefore are the times before expiry at which warnings
+// start and escalate.
+var defaultCertExpiryWarnBefore = []time.Duration{
+	30 * 24 * time.Hour, 7 * 24 * time.Hour, 24 * time.Hour}
+
+// CertExpiryParams are the parameters for monitoring the expiry of the server
+// certificates.
+type CertExpiryParams struct {
+	// WarnBefore are the times before expiry at which an alert is raised.
+	// Each one that passes raises a new alert, and alerts after the last one
+	// and after expiry are logged as errors. Defaults to 720h, 168h, and 24h.
+	WarnBefore []time.Duration `mapstructure:"warnBefore"`
+
+	// RepeatInterval is how often an alert is repeated until the certificate
+	// is replaced. Defaults to 24h.
+	RepeatInterval time.Duration `mapstructure:"repeatInterval"`
+
+	// WebhookURL is an optional URL that each alert is posted to as JSON.
+	WebhookURL string `mapstructure:"webhookURL"`
+
+	// WebhookTimeout is the maximum duration of a webhook request. Defaults to
+	// 10s.
+	WebhookTimeout time.Duration `mapstructure:"webhookTimeout"`
+}
+
+// CertExpiryMonitor periodically checks when the server certificates expire
+// and raises alerts that escalate as expiry approaches.
+type CertExpiryMonitor struct {
+	params CertExpiryParams
+	client *http.Client
+
+	// alerts maps certificate fingerprints to the last alert raised for them.
+	alerts map[string]certExpiryAlert
+	mux    sync.Mutex
+}
+
+// certExpiryAlert is the last alert raised for a certificate.
+type certExpiryAlert struct {
+	// stage is the number of WarnBefore thresholds that had passed, plus one
+	// if the certificate had expired.
+	stage int
+	sent  time.Time
+}
+
+// certExpiryWebhook is the JSON body posted to the webhook. Text contains the
+// alert message so that chat webhooks, such as Slack and Mattermost, can
+// display it.
+type certExpiryWebhook struct {
+	Text     string    `json:"text"`
+	Subject  string    `json:"subject"`
+	DNSNames []string  `json:"dnsNames"`
+	NotAfter time.Time `json:"notAfter"`
+	Expired  bool      `json:"expired"`
+}
+
+// NewCertExpiryMonitor creates a new CertExpiryMonitor from the parameters.
+func NewCertExpiryMonitor(
+	params map[string]interface{}) (*CertExpiryMonitor, error) {
+	p := CertExpiryParams{
+		WarnBefore:     defaultCertExpiryWarnBefore,
+		RepeatInterval: defaultCertExpiryRepeatInterval,
+		WebhookTimeout: defaultCertExpiryWebhookTimeout,
+	}
+	// Configured warning times replace the defaults instead of overwriting
+	// the elements of the shared default list
+	if _, exists := params["warnBefore"]; exists {
+		p.WarnBefore = nil
+	}
+	if err := decodeParams(params, &p, "certificate expiry"); err != nil {
+		return nil, err
+	}
+
+	if len(p.WarnBefore) == 0 {
+		return nil, errors.New("at least one warning time is required")
+	}
+	for _, d := range p.WarnBefore {
+		if d <= 0 {
+			return nil, errors.Errorf("warning time %s must be positive", d)
+		}
+	}
+	if p.RepeatInterval <= 0 {
+		return nil, errors.Errorf(
+			"repeat interval %s must be positive", p.RepeatInterval)
+	}
+
+	// Sort from the earliest warning to the latest so that each threshold
+	// that passes is a later stage
+	warnBefore := make([]time.Duration, len(p.WarnBefore))
+	copy(warnBefore, p.WarnBefore)
+	sort.Slice(warnBefore, func(i, j int) bool {
+		return warnBefore[i] > warnBefore[j]
+	})
+	p.WarnBefore = warnBefore
+
+	return &CertExpiryMonitor{
+		params: p,
+		client: &http.Client{Timeout: p.WebhookTimeout},
+		alerts: make(map[string]certExpiryAlert),
+	}, nil
+}
+
+// run checks the certificates returned by certs every interval until the stop
+// channel is closed. They are checked immediately on start.
+func (cm *CertExpiryMonitor) run(certs func() []*x509.Certificate,
+	interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	cm.check(certs(), time.Now())
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			cm.check(certs(), time.Now())
+		}
+	}
+}
+
+// check raises an alert for each certificate that has passed a new warning
+// threshold or whose last alert is older than the repeat interval. Alerts of
+// certificates that are no longer served are forgotten.
+func (cm *CertExpiryMonitor) check(certs []*x509.Certificate, now time.Time) {
+	cm.mux.Lock()
+	defer cm.mux.Unlock()
+
+	current := make(map[string]bool, len(certs))
+	for _, leaf := range certs {
+		fp := fingerprint(leaf.Raw)
+		current[fp] = true
+		last, seen := cm.alerts[fp]
+		if !seen {
+			jww.INFO.Printf("Certificate for %s expires at %s.",
+				certNames(leaf), leaf.NotAfter)
+		}
+
+		stage := cm.stage(leaf, now)
+		if stage == 0 || (stage <= last.stage &&
+			now.Sub(last.sent) < cm.params.RepeatInterval) {
+			cm.alerts[fp] = last
+			continue
+		}
+
+		cm.alert(leaf, stage, now)
+		cm.alerts[fp] = certExpiryAlert{stage: stage, sent: now}
+	}
+
+	for fp := range cm.alerts {
+		if !current[fp] {
+			delete(cm.alerts, fp)
+		}
+	}
+}
+
+// stage returns the number of warning thresholds the certificate has passed,
+// plus one if it has expired.
+func (cm *CertExpiryMonitor) stage(leaf *x509.Certificate, now time.Time) int {
+	if !now.Before(leaf.NotAfter) {
+		return len(cm.params.WarnBefore) + 1
+	}
+	stage := 0
+	for _, d := range cm.params.WarnBefore {
+		if now.Add(d).After(leaf.NotAfter) {
+			stage++
+		}
+	}
+	return stage
+}
+
+// alert logs that the certificate is about to expire or has expired and posts
+// the alert to the webhook, if configured. Alerts in the last stages are
+// logged as errors.
+func (cm *CertExpiryMonitor) alert(
+	leaf *x509.Certificate, stage int, now time.Time) {
+	expired := stage > len(cm.params.WarnBefore)
+	var msg string
+	if expired {
+		msg = fmt.Sprintf("Certificate for %s EXPIRED at %s; clients can no "+
+			"longer connect until it is replaced.", certNames(leaf),
+			leaf.NotAfter)
+	} else {
+		msg = fmt.Sprintf("Certificate for %s expires in %s at %s; replace it "+
+			"before then.", certNames(leaf),
+			leaf.NotAfter.Sub(now).Round(time.Minute), leaf.NotAfter)
+	}
+	if stage >= len(cm.params.WarnBefore) {
+		jww.ERROR.Print(msg)
+	} else {
+		jww.WARN.Print(msg)
+	}
+
+	if cm.params.WebhookURL == "" {
+		return
+	}
+	err := cm.postWebhook(certExpiryWebhook{
+		Text:     msg,
+		Subject:  leaf.Subject.String(),
+		DNSNames: leaf.DNSNames,
+		NotAfter: leaf.NotAfter,
+		Expired:  expired,
+	})
+	if err != nil {
+		jww.ERROR.Printf("Failed to send certificate expiry alert to "+
+			"webhook: %+v", err)
+	}
+}
+
+// postWebhook posts the alert to the webhook.
+func (cm *CertExpiryMonitor) postWebhook(alert certExpiryWebhook) error {
+	body, err := json.Marshal(alert)
+	if err != nil {
+		return errors.Wrap(err, "failed to encode alert")
+	}
+
+	ctx, cancel := context.WithTimeout(
+		context.Background(), cm.params.WebhookTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(
+		ctx, http.MethodPost, cm.params.WebhookURL, bytes.NewReader(body))
+	if err != nil {
+		return errors.Wrap(err, "failed to create request")
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := cm.client.Do(req)
+	if err != nil {
+		return errors.Wrap(err, "failed to send request")
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return errors.Errorf("webhook returned %s", resp.Status)
+	}
+	return nil
+}
+
+// certNames returns the DNS names of the certificate or, if it has none, its
+// subject.
+func certNames(leaf *x509.Certificate) string {
+	if len(leaf.DNSNames) > 0 {
+		return strings.Join(leaf.DNSNames, ", ")
+	}
+	return leaf.Subject.String()
+}
@@ -0,0 +1,148 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package server
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Tests that NewCertExpiryMonitor uses the defaults and replaces, rather than
+// merges, the default warning times with the configured ones, sorted from the
+// earliest warning to the latest.
+func TestNewCertExpiryMonitor(t *testing.T) {
+	cm, err := NewCertExpiryMonitor(map[string]interface{}{})
+	if err != nil {
+		t.Fatalf("Failed to create CertExpiryMonitor: %+v", err)
+	}
+	if !reflect.DeepEqual(defaultCertExpiryWarnBefore, cm.params.WarnBefore) {
+		t.Errorf("Unexpected default warning times.\nexpected: %v\nreceived: %v",
+			defaultCertExpiryWarnBefore, cm.params.WarnBefore)
+	}
+
+	cm, err = NewCertExpiryMonitor(map[string]interface{}{
+		"warnBefore": []interface{}{"24h", "336h"}})
+	if err != nil {
+		t.Fatalf("Failed to create CertExpiryMonitor: %+v", err)
+	}
+	expected := []time.Duration{336 * time.Hour, 24 * time.Hour}
+	if !reflect.DeepEqual(expected, cm.params.WarnBefore) {
+		t.Errorf("Unexpected warning times.\nexpected: %v\nreceived: %v",
+			expected, cm.params.WarnBefore)
+	}
+	if defaults := []time.Duration{720 * time.Hour, 168 * time.Hour,
+		24 * time.Hour}; !reflect.DeepEqual(
+		defaults, defaultCertExpiryWarnBefore) {
+		t.Errorf("Default warning times modified: %v",
+			defaultCertExpiryWarnBefore)
+	}
+}
+
+// Error path: Tests that NewCertExpiryMonitor returns an error for unknown and
+// invalid parameters.
+func TestNewCertExpiryMonitor_Error(t *testing.T) {
+	for _, params := range []map[string]interface{}{
+		{"warnBefore": []interface{}{}},
+		{"warnBefore": []interface{}{"24h", "-1h"}},
+		{"repeatInterval": "0s"},
+		{"webhookTimeout": "soon"},
+		{"webhook": "https://example.com"},
+	} {
+		if _, err := NewCertExpiryMonitor(params); err == nil {
+			t.Errorf("Failed to get error for params %v.", params)
+		}
+	}
+}
+
+// Tests that CertExpiryMonitor.check raises an alert for each warning time
+// that passes and on expiry, repeats alerts after the repeat interval, and
+// posts each alert to the webhook.
+func TestCertExpiryMonitor_check(t *testing.T) {
+	var alerts []certExpiryWebhook
+	var mux sync.Mutex
+	webhook := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			var alert certExpiryWebhook
+			if err := json.NewDecoder(r.Body).Decode(&alert); err != nil {
+				t.Errorf("Failed to decode alert: %+v", err)
+			}
+			mux.Lock()
+			alerts = append(alerts, alert)
+			mux.Unlock()
+		}))
+	defer webhook.Close()
+
+	cm, err := NewCertExpiryMonitor(map[string]interface{}{
+		"warnBefore": []interface{}{"24h", "168h"},
+		"webhookURL": webhook.URL,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create CertExpiryMonitor: %+v", err)
+	}
+
+	notAfter := time.Now().Add(10 * 24 * time.Hour).Truncate(time.Second)
+	leaf := newTestLeaf(t, []string{"sync.example.com"}, notAfter)
+	certs := []*x509.Certificate{leaf}
+
+	tests := []struct {
+		now      time.Time
+		expected int
+	}{
+		{notAfter.Add(-9 * 24 * time.Hour), 0},
+		{notAfter.Add(-6 * 24 * time.Hour), 1},
+		{notAfter.Add(-6*24*time.Hour + time.Hour), 1},
+		{notAfter.Add(-5 * 24 * time.Hour), 2},
+		{notAfter.Add(-4*24*time.Hour + time.Hour), 3},
+		{notAfter.Add(-12 * time.Hour), 4},
+		{notAfter.Add(time.Minute), 5},
+	}
+
+	for i, tt := range tests {
+		cm.check(certs, tt.now)
+		mux.Lock()
+		n := len(alerts)
+		mux.Unlock()
+		if n != tt.expected {
+			t.Errorf("Unexpected number of alerts (%d).\nexpected: %d"+
+				"\nreceived: %d", i, tt.expected, n)
+		}
+	}
+
+	if len(alerts) != tests[len(tests)-1].expected {
+		t.FailNow()
+	}
+	if alerts[0].Expired || !alerts[4].Expired {
+		t.Errorf("Alerts have wrong expiry: %+v", alerts)
+	}
+	if !alerts[0].NotAfter.Equal(notAfter) ||
+		!reflect.DeepEqual(leaf.DNSNames, alerts[0].DNSNames) {
+		t.Errorf("Unexpected alert: %+v", alerts[0])
+	}
+
+	cm.check(nil, notAfter.Add(time.Hour))
+	if len(cm.alerts) != 0 {
+		t.Errorf("Alerts of certificates no longer served were kept.")
+	}
+}
+
+// newTestLeaf returns a new self-signed certificate for the domains.
+func newTestLeaf(
+	t testing.TB, domains []string, notAfter time.Time) *x509.Certificate {
+	cert := newTestCertificate(t, domains, notAfter)
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		t.Fatalf("Failed to parse certificate: %+v", err)
+	}
+	return leaf
+}
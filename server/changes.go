@@ -0,0 +1,279 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package server
+
+import (
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"gitlab.com/elixxir/remoteSyncServer/store"
+	"gitlab.com/xx_network/primitives/netTime"
+)
+
+// Default values of ChangeFeedParams.
+const (
+	defaultChangeBufferSize   = 256
+	defaultMaxWatchersPerUser = 16
+	defaultChangeKeepalive    = 30 * time.Second
+)
+
+var (
+	// ChangesDisabledErr is returned by the Changes service while change
+	// notifications are not enabled.
+	ChangesDisabledErr = errors.New("change notifications are not enabled")
+
+	// TooManyWatchersErr is returned when a user already has the maximum
+	// number of watch streams.
+	TooManyWatchersErr = errors.New("too many watch streams")
+
+	// WatcherLaggedErr is returned when the changes of a watch stream are
+	// dropped because the client did not receive them fast enough.
+	WatcherLaggedErr = errors.New("too many changes queued for the client")
+)
+
+// ChangeFeedParams are the parameters of change notifications.
+type ChangeFeedParams struct {
+	// BufferSize is the number of changes queued for each watch stream. A
+	// stream whose queue is full is ended, so that a slow client does not
+	// hold up writes. Defaults to 256.
+	BufferSize int `mapstructure:"bufferSize"`
+
+	// MaxWatchersPerUser is the maximum number of watch streams of each user,
+	// such as one for each of their devices. Defaults to 16.
+	MaxWatchersPerUser int `mapstructure:"maxWatchersPerUser"`
+
+	// KeepaliveInterval is how long a stream is idle before an empty event is
+	// sent, so that proxies do not close it. Defaults to 30s. No empty events
+	// are sent if it is zero.
+	KeepaliveInterval time.Duration `mapstructure:"keepaliveInterval"`
+}
+
+// Change is a write or delete of a file of a user.
+type Change struct {
+	Path    string
+	Time    time.Time
+	Deleted bool
+}
+
+// ChangeFeed publishes the writes and deletes of the files of each user to the
+// clients watching them, so that clients learn of changes made by their other
+// devices without polling.
+type ChangeFeed struct {
+	params   ChangeFeedParams
+	watchers map[string]map[*changeWatcher]struct{}
+	mux      sync.Mutex
+}
+
+// changeWatcher receives the changes to the files of a user under a path.
+type changeWatcher struct {
+	prefix  string
+	changes chan Change
+
+	// lagged is closed when a change is dropped because changes is full, after
+	// which the watcher receives no more changes.
+	lagged chan struct{}
+}
+
+// NewChangeFeed creates a new ChangeFeed from the parameters. Returns an error
+// if the buffer size or maximum number of watchers is not positive.
+func NewChangeFeed(params map[string]interface{}) (*ChangeFeed, error) {
+	p := ChangeFeedParams{
+		BufferSize:         defaultChangeBufferSize,
+		MaxWatchersPerUser: defaultMaxWatchersPerUser,
+		KeepaliveInterval:  defaultChangeKeepalive,
+	}
+	if err := decodeParams(params, &p, "change"); err != nil {
+		return nil, err
+	}
+
+	if p.BufferSize <= 0 {
+		return nil, errors.Errorf(
+			"changes bufferSize %d must be positive", p.BufferSize)
+	} else if p.MaxWatchersPerUser <= 0 {
+		return nil, errors.Errorf("changes maxWatchersPerUser %d must be "+
+			"positive", p.MaxWatchersPerUser)
+	} else if p.KeepaliveInterval < 0 {
+		return nil, errors.Errorf("changes keepaliveInterval %s cannot be "+
+			"negative", p.KeepaliveInterval)
+	}
+	return &ChangeFeed{
+		params:   p,
+		watchers: make(map[string]map[*changeWatcher]struct{}),
+	}, nil
+}
+
+// Params returns the parameters of the change feed.
+func (cf *ChangeFeed) Params() ChangeFeedParams {
+	return cf.params
+}
+
+// watch returns a watcher of the changes to the files of the user under the
+// path until it is passed to unwatch.
+//
+// Returns [TooManyWatchersErr] if the user has the maximum number of watchers.
+func (cf *ChangeFeed) watch(
+	username, path string) (*changeWatcher, error) {
+	cf.mux.Lock()
+	defer cf.mux.Unlock()
+	watchers, exists := cf.watchers[username]
+	if !exists {
+		watchers = make(map[*changeWatcher]struct{})
+		cf.watchers[username] = watchers
+	} else if len(watchers) >= cf.params.MaxWatchersPerUser {
+		return nil, errors.Wrapf(TooManyWatchersErr, "%d streams of %q",
+			len(watchers), username)
+	}
+	w := &changeWatcher{
+		prefix:  path,
+		changes: make(chan Change, cf.params.BufferSize),
+		lagged:  make(chan struct{}),
+	}
+	watchers[w] = struct{}{}
+	return w, nil
+}
+
+// unwatch stops sending changes to the watcher of the user.
+func (cf *ChangeFeed) unwatch(username string, w *changeWatcher) {
+	cf.mux.Lock()
+	defer cf.mux.Unlock()
+	delete(cf.watchers[username], w)
+	if len(cf.watchers[username]) == 0 {
+		delete(cf.watchers, username)
+	}
+}
+
+// publish sends the changes to the watchers of the user whose path they are
+// under. Watchers whose queue is full are told that they lagged and removed.
+func (cf *ChangeFeed) publish(username string, changes []Change) {
+	cf.mux.Lock()
+	defer cf.mux.Unlock()
+	for w := range cf.watchers[username] {
+		for _, c := range changes {
+			if !strings.HasPrefix(c.Path, w.prefix) {
+				continue
+			}
+			select {
+			case w.changes <- c:
+				continue
+			default:
+			}
+			close(w.lagged)
+			delete(cf.watchers[username], w)
+			break
+		}
+	}
+	if len(cf.watchers[username]) == 0 {
+		delete(cf.watchers, username)
+	}
+}
+
+// wrap returns a NewStore whose stores publish their writes, deletes, and
+// transactions once they are applied to the stores created by newStore.
+func (cf *ChangeFeed) wrap(newStore store.NewStore) store.NewStore {
+	return func(storageDir, baseDir string) (store.Store, error) {
+		s, err := newStore(storageDir, baseDir)
+		if err != nil {
+			return nil, err
+		}
+		ps := &publishingStore{Store: s, cf: cf, user: baseDir}
+		if versioner, ok := s.(store.Versioner); ok {
+			return &publishingVersionedStore{ps, versioner}, nil
+		}
+		return ps, nil
+	}
+}
+
+// publishingStore publishes the writes and deletes of the Store of a user to
+// the change feed. Adheres to the Store interface.
+type publishingStore struct {
+	store.Store
+	cf   *ChangeFeed
+	user string
+}
+
+// Write writes the data to the file at the path and publishes the change.
+func (ps *publishingStore) Write(path string, data []byte) error {
+	return ps.commit([]TransactionOp{{Path: path, Data: data}})
+}
+
+// Delete deletes the file at the path and publishes the change.
+func (ps *publishingStore) Delete(path string) error {
+	return ps.commit([]TransactionOp{{Path: path, Delete: true}})
+}
+
+// commit applies the operations of a transaction and publishes a change for
+// each of them once all are applied.
+func (ps *publishingStore) commit(ops []TransactionOp) error {
+	if err := applyOps(ps.Store, ops); err != nil {
+		return err
+	}
+	now := netTime.Now()
+	changes := make([]Change, len(ops))
+	for i, op := range ops {
+		changes[i] = Change{Path: op.Path, Time: now, Deleted: op.Delete}
+	}
+	ps.cf.publish(ps.user, changes)
+	return nil
+}
+
+// ListFiles returns the paths of all files in the underlying store. Returns an
+// error if the underlying store does not implement Lister.
+func (ps *publishingStore) ListFiles() ([]string, error) {
+	lister, ok := ps.Store.(store.Lister)
+	if !ok {
+		return nil, errors.New("underlying store cannot list its files")
+	}
+	return lister.ListFiles()
+}
+
+// Size returns the total size of the files in the underlying store. Returns an
+// error if the underlying store does not implement Sizer.
+func (ps *publishingStore) Size() (int64, error) {
+	sizer, ok := ps.Store.(store.Sizer)
+	if !ok {
+		return 0, errors.New("underlying store cannot report its size")
+	}
+	return sizer.Size()
+}
+
+// Ping returns an error if the underlying store cannot be reached. Stores that
+// do not implement Pinger are assumed to be reachable.
+func (ps *publishingStore) Ping() error {
+	if pinger, ok := ps.Store.(store.Pinger); ok {
+		return pinger.Ping()
+	}
+	return nil
+}
+
+// Open opens the file at the path in the underlying store for reading.
+func (ps *publishingStore) Open(path string) (io.ReadCloser, int64, error) {
+	return store.Open(ps.Store, path)
+}
+
+// Stat returns the metadata of the file at the path in the underlying store.
+func (ps *publishingStore) Stat(path string) (store.Metadata, error) {
+	return store.Stat(ps.Store, path)
+}
+
+// SetDevice records the device as the writer of the file at the path in the
+// underlying store.
+func (ps *publishingStore) SetDevice(
+	path string, sha256 []byte, device string) error {
+	return store.SetDevice(ps.Store, path, sha256, device)
+}
+
+// publishingVersionedStore is a publishingStore of a store that keeps previous
+// versions of files.
+type publishingVersionedStore struct {
+	*publishingStore
+	store.Versioner
+}
@@ -0,0 +1,161 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package server
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"gitlab.com/elixxir/remoteSyncServer/store"
+)
+
+// Tests that publishingStore adheres to the Store interface.
+var _ store.Store = (*publishingStore)(nil)
+
+// Tests that publishingStore adheres to the Opener interface.
+var _ store.Opener = (*publishingStore)(nil)
+
+// Tests that publishingVersionedStore adheres to the Versioner interface.
+var _ store.Versioner = (*publishingVersionedStore)(nil)
+
+// Tests that NewChangeFeed decodes the parameters and sets the defaults.
+func TestNewChangeFeed(t *testing.T) {
+	cf, err := NewChangeFeed(
+		map[string]interface{}{"bufferSize": "8", "keepaliveInterval": "1m"})
+	if err != nil {
+		t.Fatalf("Failed to create change feed: %+v", err)
+	}
+	expected := ChangeFeedParams{BufferSize: 8,
+		MaxWatchersPerUser: defaultMaxWatchersPerUser,
+		KeepaliveInterval:  time.Minute}
+	if cf.Params() != expected {
+		t.Errorf("Unexpected parameters.\nexpected: %+v\nreceived: %+v",
+			expected, cf.Params())
+	}
+}
+
+// Error path: Tests that NewChangeFeed returns an error for unknown and
+// invalid parameters.
+func TestNewChangeFeed_Error(t *testing.T) {
+	for _, params := range []map[string]interface{}{
+		{"unknown": true},
+		{"bufferSize": 0},
+		{"maxWatchersPerUser": -1},
+		{"keepaliveInterval": "-1s"},
+	} {
+		if _, err := NewChangeFeed(params); err == nil {
+			t.Errorf("Failed to get error for params %v.", params)
+		}
+	}
+}
+
+// Tests that ChangeFeed.publish only sends the changes under the path of each
+// watcher of the user.
+func TestChangeFeed_publish(t *testing.T) {
+	cf, _ := NewChangeFeed(nil)
+	docs, _ := cf.watch("waldo", "docs/")
+	all, _ := cf.watch("waldo", "")
+	other, _ := cf.watch("fred", "")
+
+	cf.publish("waldo", []Change{{Path: "docs/a"}, {Path: "photos/b"}})
+	if len(docs.changes) != 1 || (<-docs.changes).Path != "docs/a" {
+		t.Errorf("Unexpected changes under docs/: %d", len(docs.changes))
+	}
+	if len(all.changes) != 2 {
+		t.Errorf("Unexpected number of changes: %d", len(all.changes))
+	}
+	if len(other.changes) != 0 {
+		t.Errorf("Changes of waldo sent to fred: %d", len(other.changes))
+	}
+
+	cf.unwatch("fred", other)
+	if _, exists := cf.watchers["fred"]; exists {
+		t.Errorf("Watchers of fred not removed: %v", cf.watchers["fred"])
+	}
+}
+
+// Tests that ChangeFeed.publish tells a watcher whose queue is full that it
+// lagged and stops sending it changes.
+func TestChangeFeed_publish_Lagged(t *testing.T) {
+	cf, _ := NewChangeFeed(map[string]interface{}{"bufferSize": 1})
+	w, _ := cf.watch("waldo", "")
+
+	cf.publish("waldo", []Change{{Path: "a"}, {Path: "b"}})
+	select {
+	case <-w.lagged:
+	default:
+		t.Errorf("Watcher not told that it lagged.")
+	}
+	if _, exists := cf.watchers["waldo"]; exists {
+		t.Errorf("Lagged watcher not removed.")
+	}
+
+	// Unwatching after lagging does nothing
+	cf.unwatch("waldo", w)
+}
+
+// Error path: Tests that ChangeFeed.watch returns TooManyWatchersErr once the
+// user has the maximum number of watchers.
+func TestChangeFeed_watch_TooManyWatchersError(t *testing.T) {
+	cf, _ := NewChangeFeed(map[string]interface{}{"maxWatchersPerUser": 1})
+	w, err := cf.watch("waldo", "")
+	if err != nil {
+		t.Fatalf("Failed to watch: %+v", err)
+	}
+	if _, err = cf.watch("waldo", ""); !errors.Is(err, TooManyWatchersErr) {
+		t.Errorf("Unexpected error.\nexpected: %v\nreceived: %+v",
+			TooManyWatchersErr, err)
+	}
+	cf.unwatch("waldo", w)
+	if _, err = cf.watch("waldo", ""); err != nil {
+		t.Errorf("Failed to watch after unwatching: %+v", err)
+	}
+}
+
+// Tests that publishingStore publishes its writes, deletes, and transactions
+// once they are applied, and not the ones that fail.
+func Test_publishingStore(t *testing.T) {
+	cf, _ := NewChangeFeed(nil)
+	w, _ := cf.watch("waldo", "")
+	s, err := cf.wrap(store.NewMemStore)("", "waldo")
+	if err != nil {
+		t.Fatalf("Failed to create store: %+v", err)
+	}
+
+	if err = s.Write("a", []byte("data")); err != nil {
+		t.Fatalf("Failed to write: %+v", err)
+	}
+	if err = s.Delete("a"); err != nil {
+		t.Fatalf("Failed to delete: %+v", err)
+	}
+	if err = s.Delete("missing"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Unexpected error deleting missing file: %+v", err)
+	}
+	err = applyOps(s, []TransactionOp{
+		{Path: "b", Data: []byte("b")}, {Path: "c", Data: []byte("c")}})
+	if err != nil {
+		t.Fatalf("Failed to commit: %+v", err)
+	}
+
+	expected := []Change{{Path: "a"}, {Path: "a", Deleted: true},
+		{Path: "b"}, {Path: "c"}}
+	if len(w.changes) != len(expected) {
+		t.Fatalf("Unexpected number of changes.\nexpected: %d\nreceived: %d",
+			len(expected), len(w.changes))
+	}
+	for i, e := range expected {
+		c := <-w.changes
+		if c.Path != e.Path || c.Deleted != e.Deleted || c.Time.IsZero() {
+			t.Errorf("Unexpected change %d.\nexpected: %+v\nreceived: %+v",
+				i, e, c)
+		}
+	}
+}
@@ -0,0 +1,728 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/gob"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/raft"
+	raftboltdb "github.com/hashicorp/raft-boltdb"
+	"github.com/pkg/errors"
+	jww "github.com/spf13/jwalterweatherman"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"gitlab.com/elixxir/remoteSyncServer/store"
+	"gitlab.com/xx_network/primitives/utils"
+)
+
+// Default values of ClusterParams.
+const (
+	defaultClusterApplyTimeout      = 10 * time.Second
+	defaultClusterSnapshotThreshold = 8192
+)
+
+const (
+	// clusterDataDirPerm is the permissions used when creating the data
+	// directory of the cluster.
+	clusterDataDirPerm = os.FileMode(0700)
+
+	// clusterLogFile is the name of the file of the Raft log in the data
+	// directory.
+	clusterLogFile = "raft.db"
+
+	// clusterSnapshotsRetained is the number of snapshots kept in the data
+	// directory.
+	clusterSnapshotsRetained = 2
+
+	// clusterMaxPool is the number of connections kept open to each node.
+	clusterMaxPool = 3
+
+	// clusterTimeout is the timeout of the I/O of connections to other nodes.
+	clusterTimeout = 10 * time.Second
+)
+
+// NotLeaderErr is returned, with the UNAVAILABLE code, when writing to a node
+// of a cluster that is not its leader. The message names the address of the
+// leader, if there is one, so that the client can retry there.
+var NotLeaderErr = errors.New("not the cluster leader")
+
+// ClusterParams are the parameters of a node of a cluster.
+type ClusterParams struct {
+	// NodeID is the unique ID of this node. Required.
+	NodeID string `mapstructure:"nodeID"`
+
+	// BindAddress is the address listened on for the Raft connections of the
+	// other nodes. Required.
+	BindAddress string `mapstructure:"bindAddress"`
+
+	// DataDir is the directory the Raft log and snapshots are stored in.
+	// Required.
+	DataDir string `mapstructure:"dataDir"`
+
+	// CertPath and KeyPath are the certificate and key this node presents to
+	// the other nodes, and CAPath the CA certificates that the certificates
+	// of the other nodes must be signed by. Required.
+	CertPath string `mapstructure:"certPath"`
+	KeyPath  string `mapstructure:"keyPath"`
+	CAPath   string `mapstructure:"caPath"`
+
+	// Peers are all nodes of the cluster, including this one. The cluster is
+	// formed from them the first time the nodes start. Required.
+	Peers []ClusterPeer `mapstructure:"peers"`
+
+	// ApplyTimeout is how long a write waits to be replicated. Defaults to
+	// 10s.
+	ApplyTimeout time.Duration `mapstructure:"applyTimeout"`
+
+	// SnapshotThreshold is the number of writes after which the Raft log is
+	// compacted into a snapshot of the stored files. Defaults to 8192.
+	SnapshotThreshold uint64 `mapstructure:"snapshotThreshold"`
+}
+
+// ClusterPeer is a node of a cluster.
+type ClusterPeer struct {
+	// ID is the unique ID of the node.
+	ID string `mapstructure:"id"`
+
+	// Address is the address of the Raft connections of the node.
+	Address string `mapstructure:"address"`
+
+	// ServerAddress is the address clients connect to the node on, which is
+	// given to clients that write to another node while it is the leader.
+	ServerAddress string `mapstructure:"serverAddress"`
+}
+
+// clusterCommand is an entry of the Raft log: the operations of a write,
+// delete, or transaction of a user.
+type clusterCommand struct {
+	User string
+	Ops  []TransactionOp
+}
+
+// clusterFile is a file of a user in a snapshot of the stored files.
+type clusterFile struct {
+	User string
+	Path string
+	Data []byte
+}
+
+// Cluster replicates the writes of several servers with Raft, so that they
+// store the same files and the others continue if one fails. Writes are
+// accepted by the elected leader, replicated to the other nodes, and applied
+// to the storage of each node once a majority has them. Reads are served by
+// each node from its own storage.
+type Cluster struct {
+	params    ClusterParams
+	tlsConfig *tls.Config
+	raft      *raft.Raft
+	logStore  *raftboltdb.BoltStore
+	transport *raft.NetworkTransport
+
+	// newStore creates the stores that writes are applied to.
+	newStore store.NewStore
+}
+
+// NewCluster creates a new Cluster from the parameters. It is not started
+// until the server is created. Returns an error if a required parameter is
+// missing, this node is not one of the peers, or the certificates cannot be
+// loaded.
+func NewCluster(params map[string]interface{}) (*Cluster, error) {
+	p := ClusterParams{
+		ApplyTimeout:      defaultClusterApplyTimeout,
+		SnapshotThreshold: defaultClusterSnapshotThreshold,
+	}
+	err := decodeParams(params, &p, "cluster")
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case p.NodeID == "":
+		return nil, errors.New("cluster nodeID is required")
+	case p.BindAddress == "":
+		return nil, errors.New("cluster bindAddress is required")
+	case p.DataDir == "":
+		return nil, errors.New("cluster dataDir is required")
+	case p.CertPath == "" || p.KeyPath == "" || p.CAPath == "":
+		return nil, errors.New(
+			"cluster certPath, keyPath, and caPath are required")
+	case p.ApplyTimeout <= 0:
+		return nil, errors.Errorf(
+			"cluster applyTimeout %s must be positive", p.ApplyTimeout)
+	case p.SnapshotThreshold == 0:
+		return nil, errors.New("cluster snapshotThreshold must be positive")
+	}
+	if _, err = p.peer(p.NodeID); err != nil {
+		return nil, err
+	}
+	ids := make(map[string]bool, len(p.Peers))
+	for _, peer := range p.Peers {
+		if peer.ID == "" || peer.Address == "" {
+			return nil, errors.Errorf(
+				"cluster peer %+v requires an id and address", peer)
+		} else if ids[peer.ID] {
+			return nil, errors.Errorf("duplicate cluster peer %q", peer.ID)
+		}
+		ids[peer.ID] = true
+	}
+
+	if p.DataDir, err = utils.ExpandPath(p.DataDir); err != nil {
+		return nil, errors.Wrapf(err, "invalid cluster dataDir %s", p.DataDir)
+	}
+	tlsConfig, err := clusterTLSConfig(p.CertPath, p.KeyPath, p.CAPath)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Cluster{params: p, tlsConfig: tlsConfig}, nil
+}
+
+// Params returns the parameters of the cluster.
+func (c *Cluster) Params() ClusterParams {
+	return c.params
+}
+
+// peer returns the peer with the ID. Returns an error if there is none.
+func (p ClusterParams) peer(id string) (ClusterPeer, error) {
+	for _, peer := range p.Peers {
+		if peer.ID == id {
+			return peer, nil
+		}
+	}
+	return ClusterPeer{}, errors.Errorf("node %q is not a cluster peer", id)
+}
+
+// clusterTLSConfig returns the TLS config of the connections between nodes,
+// which present the certificate and require the certificate of the other node
+// to be signed by one of the CAs. The names in the certificates are not
+// checked, since nodes are dialled by address.
+func clusterTLSConfig(certPath, keyPath, caPath string) (*tls.Config, error) {
+	certPem, err := utils.ReadFile(certPath)
+	if err != nil {
+		return nil, errors.Wrapf(
+			err, "failed to read cluster certificate %s", certPath)
+	}
+	keyPem, err := utils.ReadFile(keyPath)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read cluster key %s", keyPath)
+	}
+	cert, err := tls.X509KeyPair(certPem, keyPem)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid cluster certificate")
+	}
+	caPem, err := utils.ReadFile(caPath)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read cluster CA %s", caPath)
+	}
+	cas := x509.NewCertPool()
+	if !cas.AppendCertsFromPEM(caPem) {
+		return nil, errors.Errorf("no certificates found in %s", caPath)
+	}
+
+	verify := func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+		if len(rawCerts) == 0 {
+			return errors.New("no certificate presented")
+		}
+		certs := make([]*x509.Certificate, len(rawCerts))
+		for i, raw := range rawCerts {
+			cert, err := x509.ParseCertificate(raw)
+			if err != nil {
+				return errors.Wrap(err, "invalid certificate")
+			}
+			certs[i] = cert
+		}
+		intermediates := x509.NewCertPool()
+		for _, intermediate := range certs[1:] {
+			intermediates.AddCert(intermediate)
+		}
+		_, err := certs[0].Verify(x509.VerifyOptions{
+			Roots:         cas,
+			Intermediates: intermediates,
+			KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+		})
+		return err
+	}
+	return &tls.Config{
+		Certificates:          []tls.Certificate{cert},
+		ClientAuth:            tls.RequireAnyClientCert,
+		InsecureSkipVerify:    true,
+		VerifyPeerCertificate: verify,
+		MinVersion:            tls.VersionTLS12,
+	}, nil
+}
+
+// start starts the Raft node, which applies the writes of the cluster to the
+// stores created by the NewStore passed to wrap. The first time the nodes
+// start, the cluster is formed from the peers. Snapshots include the files of
+// the registered and known users.
+func (c *Cluster) start(storageDir string, users userLister) error {
+	if err := os.MkdirAll(c.params.DataDir, clusterDataDirPerm); err != nil {
+		return errors.Wrapf(err,
+			"failed to create cluster data directory %s", c.params.DataDir)
+	}
+	logger := hclog.FromStandardLogger(jww.INFO, &hclog.LoggerOptions{
+		Name:  "raft",
+		Level: hclog.Info,
+	})
+
+	var err error
+	c.logStore, err = raftboltdb.NewBoltStore(
+		filepath.Join(c.params.DataDir, clusterLogFile))
+	if err != nil {
+		return errors.Wrap(err, "failed to open Raft log")
+	}
+	snapshots, err := raft.NewFileSnapshotStoreWithLogger(
+		c.params.DataDir, clusterSnapshotsRetained, logger)
+	if err != nil {
+		_ = c.logStore.Close()
+		return errors.Wrap(err, "failed to open Raft snapshots")
+	}
+
+	listener, err := net.Listen("tcp", c.params.BindAddress)
+	if err != nil {
+		_ = c.logStore.Close()
+		return errors.Wrapf(
+			err, "failed to listen on %s", c.params.BindAddress)
+	}
+	self, _ := c.params.peer(c.params.NodeID)
+	advertise, err := net.ResolveTCPAddr("tcp", self.Address)
+	if err != nil {
+		_ = listener.Close()
+		_ = c.logStore.Close()
+		return errors.Wrapf(err, "invalid cluster address %s", self.Address)
+	}
+	c.transport = raft.NewNetworkTransportWithLogger(&clusterStreamLayer{
+		Listener: tls.NewListener(listener, c.tlsConfig),
+		config:   c.tlsConfig,
+		addr:     advertise,
+	}, clusterMaxPool, clusterTimeout, logger)
+
+	conf := raft.DefaultConfig()
+	conf.LocalID = raft.ServerID(c.params.NodeID)
+	conf.SnapshotThreshold = c.params.SnapshotThreshold
+	conf.Logger = logger
+
+	existing, err := raft.HasExistingState(c.logStore, c.logStore, snapshots)
+	if err != nil {
+		c.close()
+		return errors.Wrap(err, "failed to read Raft state")
+	}
+	if !existing {
+		servers := make([]raft.Server, len(c.params.Peers))
+		for i, peer := range c.params.Peers {
+			servers[i] = raft.Server{
+				ID:      raft.ServerID(peer.ID),
+				Address: raft.ServerAddress(peer.Address),
+			}
+		}
+		err = raft.BootstrapCluster(conf, c.logStore, c.logStore, snapshots,
+			c.transport, raft.Configuration{Servers: servers})
+		if err != nil {
+			c.close()
+			return errors.Wrap(err, "failed to form cluster")
+		}
+		jww.INFO.Printf("Formed cluster of %d nodes.", len(servers))
+	}
+
+	fsm := &clusterFSM{
+		storageDir: storageDir, newStore: c.newStore, users: users}
+	c.raft, err = raft.NewRaft(
+		conf, fsm, c.logStore, c.logStore, snapshots, c.transport)
+	if err != nil {
+		c.close()
+		return errors.Wrap(err, "failed to start Raft")
+	}
+
+	// Changes of leader are logged
+	observations := make(chan raft.Observation, 1)
+	c.raft.RegisterObserver(raft.NewObserver(observations, false,
+		func(o *raft.Observation) bool {
+			_, ok := o.Data.(raft.LeaderObservation)
+			return ok
+		}))
+	go func() {
+		for o := range observations {
+			leader := o.Data.(raft.LeaderObservation)
+			if leader.LeaderID == "" {
+				jww.WARN.Printf("Cluster has no leader.")
+			} else {
+				jww.INFO.Printf("Cluster leader is %s.", leader.LeaderID)
+			}
+		}
+	}()
+
+	return nil
+}
+
+// stop shuts down the Raft node and closes its log.
+func (c *Cluster) stop() {
+	if c.raft == nil {
+		return
+	}
+	if err := c.raft.Shutdown().Error(); err != nil {
+		jww.WARN.Printf("Failed to shut down Raft: %+v", err)
+	}
+	c.close()
+}
+
+// close closes the transport and log of the Raft node.
+func (c *Cluster) close() {
+	if err := c.transport.Close(); err != nil {
+		jww.WARN.Printf("Failed to close Raft transport: %+v", err)
+	}
+	if err := c.logStore.Close(); err != nil {
+		jww.WARN.Printf("Failed to close Raft log: %+v", err)
+	}
+}
+
+// IsLeader returns true if this node is the leader of the cluster.
+func (c *Cluster) IsLeader() bool {
+	return c.raft.State() == raft.Leader
+}
+
+// Leader returns the ID of the leader of the cluster and the address clients
+// connect to it on, which are empty if there is no leader.
+func (c *Cluster) Leader() (id, serverAddress string) {
+	_, leaderID := c.raft.LeaderWithID()
+	peer, _ := c.params.peer(string(leaderID))
+	return string(leaderID), peer.ServerAddress
+}
+
+// apply replicates the command and applies it to the stores of all nodes.
+// Returns the error of applying it on this node, or [NotLeaderErr] if this
+// node is not the leader.
+func (c *Cluster) apply(cmd clusterCommand) error {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(cmd); err != nil {
+		return errors.Wrap(err, "failed to encode cluster command")
+	}
+
+	f := c.raft.Apply(buf.Bytes(), c.params.ApplyTimeout)
+	if err := f.Error(); errors.Is(err, raft.ErrNotLeader) ||
+		errors.Is(err, raft.ErrLeadershipLost) {
+		id, address := c.Leader()
+		switch {
+		case id == "":
+			return errors.Wrap(NotLeaderErr, "no leader is elected")
+		case address == "":
+			return errors.Wrapf(NotLeaderErr, "leader is %s", id)
+		default:
+			return errors.Wrapf(NotLeaderErr, "leader is %s", address)
+		}
+	} else if err != nil {
+		return errors.Wrap(err, "failed to replicate write")
+	}
+
+	if err, ok := f.Response().(error); ok {
+		return err
+	}
+	return nil
+}
+
+// checkLeader returns an error if the cluster has no leader, for readiness
+// checks.
+func (c *Cluster) checkLeader() error {
+	if id, _ := c.Leader(); id == "" {
+		return errors.New("cluster has no leader")
+	}
+	return nil
+}
+
+// interceptor returns an interceptor that rejects writes to nodes that are
+// not the leader with the UNAVAILABLE code.
+func (c *Cluster) interceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{},
+		_ *grpc.UnaryServerInfo, next grpc.UnaryHandler) (interface{}, error) {
+		resp, err := next(ctx, req)
+		if errors.Is(err, NotLeaderErr) {
+			return nil, status.Error(codes.Unavailable, err.Error())
+		}
+		return resp, err
+	}
+}
+
+// wrap returns a NewStore that replicates the writes and deletes of the stores
+// created by newStore through the cluster. The writes of the cluster are
+// applied to the stores created by newStore. Must be called before start.
+func (c *Cluster) wrap(newStore store.NewStore) store.NewStore {
+	c.newStore = newStore
+	return func(storageDir, baseDir string) (store.Store, error) {
+		s, err := newStore(storageDir, baseDir)
+		if err != nil {
+			return nil, err
+		}
+		cs := &clusterStore{Store: s, cluster: c, user: baseDir}
+		if versioner, ok := s.(store.Versioner); ok {
+			return &clusterVersionedStore{cs, versioner}, nil
+		}
+		return cs, nil
+	}
+}
+
+// clusterStore replicates the writes and deletes of the Store of a user
+// through the cluster, which applies them to the store of the user on each
+// node. Reads are from the store of this node. Adheres to the Store
+// interface.
+type clusterStore struct {
+	store.Store
+	cluster *Cluster
+	user    string
+}
+
+// Write replicates the write of the data to the file at the path.
+func (cs *clusterStore) Write(path string, data []byte) error {
+	return cs.cluster.apply(clusterCommand{
+		User: cs.user, Ops: []TransactionOp{{Path: path, Data: data}}})
+}
+
+// Delete replicates the deletion of the file at the path.
+func (cs *clusterStore) Delete(path string) error {
+	return cs.cluster.apply(clusterCommand{
+		User: cs.user, Ops: []TransactionOp{{Path: path, Delete: true}}})
+}
+
+// commit replicates the operations of a transaction as one entry, so that
+// each node applies all of them or none of them.
+func (cs *clusterStore) commit(ops []TransactionOp) error {
+	return cs.cluster.apply(clusterCommand{User: cs.user, Ops: ops})
+}
+
+// ListFiles returns the paths of all files in the underlying store. Returns an
+// error if the underlying store does not implement Lister.
+func (cs *clusterStore) ListFiles() ([]string, error) {
+	lister, ok := cs.Store.(store.Lister)
+	if !ok {
+		return nil, errors.New("underlying store cannot list its files")
+	}
+	return lister.ListFiles()
+}
+
+// Size returns the total size of the files in the underlying store. Returns an
+// error if the underlying store does not implement Sizer.
+func (cs *clusterStore) Size() (int64, error) {
+	sizer, ok := cs.Store.(store.Sizer)
+	if !ok {
+		return 0, errors.New("underlying store cannot report its size")
+	}
+	return sizer.Size()
+}
+
+// Ping returns an error if the underlying store cannot be reached. Stores that
+// do not implement Pinger are assumed to be reachable.
+func (cs *clusterStore) Ping() error {
+	if pinger, ok := cs.Store.(store.Pinger); ok {
+		return pinger.Ping()
+	}
+	return nil
+}
+
+// Open opens the file at the path in the underlying store for reading.
+func (cs *clusterStore) Open(path string) (io.ReadCloser, int64, error) {
+	return store.Open(cs.Store, path)
+}
+
+// Stat returns the metadata of the file at the path in the underlying store.
+func (cs *clusterStore) Stat(path string) (store.Metadata, error) {
+	return store.Stat(cs.Store, path)
+}
+
+// SetDevice records the device as the writer of the file at the path in the
+// underlying store.
+func (cs *clusterStore) SetDevice(
+	path string, sha256 []byte, device string) error {
+	return store.SetDevice(cs.Store, path, sha256, device)
+}
+
+// committer is implemented by stores that apply the operations of a
+// transaction themselves.
+type committer interface {
+	commit(ops []TransactionOp) error
+}
+
+// clusterVersionedStore is a clusterStore of a store that keeps previous
+// versions of files. Each node keeps the versions of the writes it applies.
+type clusterVersionedStore struct {
+	*clusterStore
+	store.Versioner
+}
+
+// clusterFSM applies the commands of the Raft log to the stores of this node
+// and snapshots them.
+type clusterFSM struct {
+	storageDir string
+	newStore   store.NewStore
+	users      userLister
+}
+
+// Apply applies the command of the log entry to the store of its user.
+// Returns the error of applying it, if any.
+func (fsm *clusterFSM) Apply(l *raft.Log) interface{} {
+	var cmd clusterCommand
+	if err := gob.NewDecoder(bytes.NewReader(l.Data)).Decode(&cmd); err != nil {
+		return errors.Wrapf(err, "failed to decode cluster command %d", l.Index)
+	}
+	s, err := fsm.newStore(fsm.storageDir, cmd.User)
+	if err != nil {
+		return err
+	}
+	return applyOps(s, cmd.Ops)
+}
+
+// Snapshot returns a snapshot of the files of the users. The files are read as
+// the snapshot is persisted, so it may include writes applied after it was
+// taken; they are applied again after it is restored, which leaves the same
+// files.
+func (fsm *clusterFSM) Snapshot() (raft.FSMSnapshot, error) {
+	return &clusterSnapshot{fsm: fsm}, nil
+}
+
+// Restore replaces the files of every user with the files in the snapshot.
+// Files that are not in the snapshot are deleted.
+func (fsm *clusterFSM) Restore(snapshot io.ReadCloser) error {
+	defer func() { _ = snapshot.Close() }()
+
+	written := make(map[string]map[string]bool)
+	decoder := gob.NewDecoder(snapshot)
+	for {
+		var f clusterFile
+		if err := decoder.Decode(&f); errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return errors.Wrap(err, "failed to decode snapshot")
+		}
+		s, err := fsm.newStore(fsm.storageDir, f.User)
+		if err != nil {
+			return err
+		} else if err = s.Write(f.Path, f.Data); err != nil {
+			return errors.Wrapf(err, "failed to restore %q of %q",
+				f.Path, f.User)
+		}
+		if written[f.User] == nil {
+			written[f.User] = make(map[string]bool)
+		}
+		written[f.User][f.Path] = true
+	}
+
+	usernames, err := fsm.users.List()
+	if err != nil {
+		return errors.Wrap(err, "failed to list users")
+	}
+	for _, username := range usernames {
+		s, err := fsm.newStore(fsm.storageDir, username)
+		if err != nil {
+			return err
+		}
+		lister, ok := s.(store.Lister)
+		if !ok {
+			continue
+		}
+		files, err := lister.ListFiles()
+		if err != nil {
+			return errors.Wrapf(err, "failed to list files of %q", username)
+		}
+		for _, path := range files {
+			if !written[username][path] {
+				if err = s.Delete(path); err != nil &&
+					!errors.Is(err, os.ErrNotExist) {
+					return errors.Wrapf(err, "failed to delete %q of %q",
+						path, username)
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// clusterSnapshot is a snapshot of the files of the users.
+type clusterSnapshot struct {
+	fsm *clusterFSM
+}
+
+// Persist writes each file of each user to the sink.
+func (cs *clusterSnapshot) Persist(sink raft.SnapshotSink) error {
+	if err := cs.persist(sink); err != nil {
+		_ = sink.Cancel()
+		return err
+	}
+	return sink.Close()
+}
+
+// persist writes each file of each user to w.
+func (cs *clusterSnapshot) persist(w io.Writer) error {
+	usernames, err := cs.fsm.users.List()
+	if err != nil {
+		return errors.Wrap(err, "failed to list users")
+	}
+
+	encoder := gob.NewEncoder(w)
+	for _, username := range usernames {
+		s, err := cs.fsm.newStore(cs.fsm.storageDir, username)
+		if err != nil {
+			return err
+		}
+		lister, ok := s.(store.Lister)
+		if !ok {
+			return errors.New("store cannot list its files")
+		}
+		files, err := lister.ListFiles()
+		if err != nil {
+			return errors.Wrapf(err, "failed to list files of %q", username)
+		}
+		for _, path := range files {
+			data, err := s.Read(path)
+			if errors.Is(err, os.ErrNotExist) {
+				continue
+			} else if err != nil {
+				return errors.Wrapf(err, "failed to read %q of %q",
+					path, username)
+			}
+			err = encoder.Encode(clusterFile{username, path, data})
+			if err != nil {
+				return errors.Wrap(err, "failed to write snapshot")
+			}
+		}
+	}
+
+	return nil
+}
+
+// Release is called when the snapshot is no longer needed.
+func (cs *clusterSnapshot) Release() {}
+
+// clusterStreamLayer is the Raft network layer of the connections between
+// nodes, which are authenticated with TLS in both directions.
+type clusterStreamLayer struct {
+	net.Listener
+	config *tls.Config
+	addr   net.Addr
+}
+
+// Dial connects to the node at the address.
+func (sl *clusterStreamLayer) Dial(
+	address raft.ServerAddress, timeout time.Duration) (net.Conn, error) {
+	dialer := &net.Dialer{Timeout: timeout}
+	return tls.DialWithDialer(dialer, "tcp", string(address), sl.config)
+}
+
+// Addr returns the address of this node that other nodes connect to.
+func (sl *clusterStreamLayer) Addr() net.Addr {
+	return sl.addr
+}
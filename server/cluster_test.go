@@ -0,0 +1,442 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/gob"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/raft"
+	"github.com/pkg/errors"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"gitlab.com/elixxir/remoteSyncServer/credentials"
+	"gitlab.com/elixxir/remoteSyncServer/store"
+)
+
+// Tests that NewCluster decodes the parameters, applies the defaults, and
+// loads the certificates.
+func TestNewCluster(t *testing.T) {
+	params := newTestClusterParams(t, "127.0.0.1:7000")
+	c, err := NewCluster(params)
+	if err != nil {
+		t.Fatalf("Failed to create Cluster: %+v", err)
+	}
+
+	p := c.Params()
+	if p.NodeID != "node1" || len(p.Peers) != 1 ||
+		p.Peers[0].ServerAddress != "sync1.example.com:22841" {
+		t.Errorf("Unexpected parameters: %+v", p)
+	}
+	if p.ApplyTimeout != defaultClusterApplyTimeout {
+		t.Errorf("Unexpected default apply timeout."+
+			"\nexpected: %s\nreceived: %s",
+			defaultClusterApplyTimeout, p.ApplyTimeout)
+	}
+	if p.SnapshotThreshold != defaultClusterSnapshotThreshold {
+		t.Errorf("Unexpected default snapshot threshold."+
+			"\nexpected: %d\nreceived: %d",
+			defaultClusterSnapshotThreshold, p.SnapshotThreshold)
+	}
+	if c.tlsConfig.ClientAuth != tls.RequireAnyClientCert {
+		t.Errorf("Node certificates not required: %s", c.tlsConfig.ClientAuth)
+	}
+}
+
+// Error path: Tests that NewCluster returns an error for missing, unknown, and
+// invalid parameters.
+func TestNewCluster_Error(t *testing.T) {
+	with := func(key string, value interface{}) map[string]interface{} {
+		params := newTestClusterParams(t, "127.0.0.1:7000")
+		if value == nil {
+			delete(params, key)
+		} else {
+			params[key] = value
+		}
+		return params
+	}
+	peers := func(peers ...map[string]interface{}) []interface{} {
+		list := make([]interface{}, len(peers))
+		for i, peer := range peers {
+			list[i] = peer
+		}
+		return list
+	}
+	node1 := map[string]interface{}{"id": "node1", "address": "a:1"}
+	node2 := map[string]interface{}{"id": "node2", "address": "b:1"}
+
+	for i, params := range []map[string]interface{}{
+		{},
+		with("nodeID", nil),
+		with("bindAddress", nil),
+		with("dataDir", nil),
+		with("certPath", nil),
+		with("caPath", filepath.Join(t.TempDir(), "missing.pem")),
+		with("applyTimeout", "-1s"),
+		with("snapshotThreshold", 0),
+		with("unknown", true),
+		with("peers", peers(node2)),
+		with("peers", peers(node1, node1)),
+		with("peers", peers(node1, map[string]interface{}{"id": "node2"})),
+	} {
+		if _, err := NewCluster(params); err == nil {
+			t.Errorf("Failed to get error for params #%d: %v", i, params)
+		}
+	}
+}
+
+// Tests that connections between nodes are accepted when both present
+// certificates signed by the CA and rejected otherwise.
+func Test_clusterTLSConfig(t *testing.T) {
+	certPath, keyPath, caPath := writeTestClusterCert(t)
+	config, err := clusterTLSConfig(certPath, keyPath, caPath)
+	if err != nil {
+		t.Fatalf("Failed to create TLS config: %+v", err)
+	}
+	otherCertPath, otherKeyPath, otherCAPath := writeTestClusterCert(t)
+	other, err := clusterTLSConfig(otherCertPath, otherKeyPath, otherCAPath)
+	if err != nil {
+		t.Fatalf("Failed to create TLS config: %+v", err)
+	}
+
+	if err = handshakeTestCluster(config, config); err != nil {
+		t.Errorf("Failed to connect nodes of the same CA: %+v", err)
+	}
+	if err = handshakeTestCluster(config, other); err == nil {
+		t.Errorf("Connected to a node of another CA.")
+	}
+	if err = handshakeTestCluster(other, config); err == nil {
+		t.Errorf("Accepted a node of another CA.")
+	}
+}
+
+// Tests that clusterFSM.Apply applies writes, deletes, and transactions to the
+// store of the user and returns the error of a failed command.
+func Test_clusterFSM_Apply(t *testing.T) {
+	newStore := newTestGCStore(false, t)
+	fsm := &clusterFSM{newStore: newStore}
+
+	for i, cmd := range []clusterCommand{
+		{"waldo", []TransactionOp{{Path: "a", Data: []byte("a")}}},
+		{"waldo", []TransactionOp{
+			{Path: "b", Data: []byte("b")},
+			{Path: "c", Data: []byte("c")},
+		}},
+		{"waldo", []TransactionOp{{Path: "c", Delete: true}}},
+	} {
+		if resp := fsm.Apply(newTestClusterLog(cmd, t)); resp != nil {
+			t.Errorf("Failed to apply command #%d: %+v", i, resp)
+		}
+	}
+
+	s := writeTestFiles(newStore, "waldo", t)
+	if files := listTestFiles(s, t); !reflect.DeepEqual(
+		files, []string{"a", "b"}) {
+		t.Errorf("Unexpected files: %v", files)
+	}
+
+	cmd := clusterCommand{"waldo", []TransactionOp{{Path: "c", Delete: true}}}
+	resp := fsm.Apply(newTestClusterLog(cmd, t))
+	if err, _ := resp.(error); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Unexpected response to deleting a missing file."+
+			"\nexpected: %v\nreceived: %v", os.ErrNotExist, resp)
+	}
+}
+
+// Tests that a snapshot of the files of the users restores the same files and
+// removes files that are not in it.
+func Test_clusterFSM_Snapshot_Restore(t *testing.T) {
+	users := credentials.NewMemStore(
+		map[string]string{"waldo": "pw", "carmen": "pw"})
+	source := &clusterFSM{newStore: newTestGCStore(false, t), users: users}
+	writeTestFiles(source.newStore, "waldo", t, "a", "dir/b")
+	writeTestFiles(source.newStore, "carmen", t, "c")
+
+	snapshot, err := source.Snapshot()
+	if err != nil {
+		t.Fatalf("Failed to take snapshot: %+v", err)
+	}
+	var buf bytes.Buffer
+	if err = snapshot.(*clusterSnapshot).persist(&buf); err != nil {
+		t.Fatalf("Failed to persist snapshot: %+v", err)
+	}
+
+	target := &clusterFSM{newStore: newTestGCStore(false, t), users: users}
+	writeTestFiles(target.newStore, "waldo", t, "a", "stale")
+	err = target.Restore(io.NopCloser(&buf))
+	if err != nil {
+		t.Fatalf("Failed to restore snapshot: %+v", err)
+	}
+
+	expected := map[string][]string{"waldo": {"a", "dir/b"}, "carmen": {"c"}}
+	for username, files := range expected {
+		s := writeTestFiles(target.newStore, username, t)
+		received := listTestFiles(s, t)
+		sort.Strings(received)
+		if !reflect.DeepEqual(received, files) {
+			t.Errorf("Unexpected files of %q.\nexpected: %v\nreceived: %v",
+				username, files, received)
+		}
+		for _, file := range files {
+			if data, _ := s.Read(file); string(data) != file {
+				t.Errorf("Unexpected data of %q of %q: %q",
+					file, username, data)
+			}
+		}
+	}
+}
+
+// Tests that a single node cluster elects itself leader and applies the
+// writes, deletes, and transactions of the wrapped stores to the underlying
+// stores.
+func TestCluster(t *testing.T) {
+	address := newTestClusterAddress(t)
+	c, err := NewCluster(newTestClusterParams(t, address))
+	if err != nil {
+		t.Fatalf("Failed to create Cluster: %+v", err)
+	}
+	newStore := newTestGCStore(false, t)
+	wrapped := c.wrap(newStore)
+	users := credentials.NewMemStore(map[string]string{"waldo": "pw"})
+	if err = c.start("", users); err != nil {
+		t.Fatalf("Failed to start Cluster: %+v", err)
+	}
+	defer c.stop()
+	waitForTestClusterLeader(c, t)
+
+	if id, serverAddress := c.Leader(); id != "node1" ||
+		serverAddress != "sync1.example.com:22841" {
+		t.Errorf("Unexpected leader %q at %q.", id, serverAddress)
+	}
+	if err = c.checkLeader(); err != nil {
+		t.Errorf("Leader check failed: %+v", err)
+	}
+
+	s, err := wrapped("", "waldo")
+	if err != nil {
+		t.Fatalf("Failed to create store: %+v", err)
+	}
+	if err = s.Write("a", []byte("a")); err != nil {
+		t.Fatalf("Failed to write: %+v", err)
+	}
+	err = s.(committer).commit([]TransactionOp{
+		{Path: "b", Data: []byte("b")},
+		{Path: "a", Delete: true},
+	})
+	if err != nil {
+		t.Fatalf("Failed to commit: %+v", err)
+	}
+	if err = s.Delete("a"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Unexpected error deleting a missing file."+
+			"\nexpected: %v\nreceived: %+v", os.ErrNotExist, err)
+	}
+
+	underlying := writeTestFiles(newStore, "waldo", t)
+	if files := listTestFiles(underlying, t); !reflect.DeepEqual(
+		files, []string{"b"}) {
+		t.Errorf("Unexpected files: %v", files)
+	}
+	if files, err := s.(store.Lister).ListFiles(); err != nil ||
+		!reflect.DeepEqual(files, []string{"b"}) {
+		t.Errorf("Unexpected files listed through the cluster: %v, %+v",
+			files, err)
+	}
+}
+
+// Error path: Tests that a node that cannot be elected leader rejects writes
+// with NotLeaderErr, which the interceptor returns as UNAVAILABLE.
+func TestCluster_NotLeaderError(t *testing.T) {
+	address := newTestClusterAddress(t)
+	params := newTestClusterParams(t, address)
+	params["peers"] = []interface{}{
+		params["peers"].([]interface{})[0],
+		map[string]interface{}{"id": "node2", "address": "127.0.0.1:1"},
+	}
+	c, err := NewCluster(params)
+	if err != nil {
+		t.Fatalf("Failed to create Cluster: %+v", err)
+	}
+	wrapped := c.wrap(newTestGCStore(false, t))
+	users := credentials.NewMemStore(map[string]string{"waldo": "pw"})
+	if err = c.start("", users); err != nil {
+		t.Fatalf("Failed to start Cluster: %+v", err)
+	}
+	defer c.stop()
+
+	if err = c.checkLeader(); err == nil {
+		t.Errorf("Leader check passed without a leader.")
+	}
+	s, err := wrapped("", "waldo")
+	if err != nil {
+		t.Fatalf("Failed to create store: %+v", err)
+	}
+	err = s.Write("a", []byte("a"))
+	if !errors.Is(err, NotLeaderErr) {
+		t.Fatalf("Unexpected error.\nexpected: %v\nreceived: %+v",
+			NotLeaderErr, err)
+	}
+
+	_, err = c.interceptor()(context.Background(), nil, nil,
+		func(context.Context, interface{}) (interface{}, error) {
+			return nil, s.Write("a", []byte("a"))
+		})
+	if status.Code(err) != codes.Unavailable {
+		t.Errorf("Unexpected code.\nexpected: %s\nreceived: %s",
+			codes.Unavailable, status.Code(err))
+	}
+}
+
+// newTestClusterParams returns the parameters of a single node cluster with
+// the Raft address and new certificates.
+func newTestClusterParams(t testing.TB, address string) map[string]interface{} {
+	certPath, keyPath, caPath := writeTestClusterCert(t)
+	return map[string]interface{}{
+		"nodeID":      "node1",
+		"bindAddress": address,
+		"dataDir":     t.TempDir(),
+		"certPath":    certPath,
+		"keyPath":     keyPath,
+		"caPath":      caPath,
+		"peers": []interface{}{map[string]interface{}{
+			"id":            "node1",
+			"address":       address,
+			"serverAddress": "sync1.example.com:22841",
+		}},
+	}
+}
+
+// newTestClusterAddress returns a free local address.
+func newTestClusterAddress(t testing.TB) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %+v", err)
+	}
+	defer l.Close()
+	return l.Addr().String()
+}
+
+// waitForTestClusterLeader waits for the node to become the leader.
+func waitForTestClusterLeader(c *Cluster, t testing.TB) {
+	deadline := time.Now().Add(10 * time.Second)
+	for !c.IsLeader() {
+		if time.Now().After(deadline) {
+			t.Fatalf("Node did not become leader.")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// newTestClusterLog returns a Raft log entry of the command.
+func newTestClusterLog(cmd clusterCommand, t testing.TB) *raft.Log {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(cmd); err != nil {
+		t.Fatalf("Failed to encode command: %+v", err)
+	}
+	return &raft.Log{Data: buf.Bytes()}
+}
+
+// handshakeTestCluster performs a TLS handshake between a node dialling with
+// the client config and a node accepting with the server config.
+func handshakeTestCluster(client, server *tls.Config) error {
+	clientConn, serverConn := net.Pipe()
+	defer clientConn.Close()
+	defer serverConn.Close()
+
+	errs := make(chan error, 1)
+	go func() {
+		errs <- tls.Server(serverConn, server).Handshake()
+		serverConn.Close()
+	}()
+	err := tls.Client(clientConn, client).Handshake()
+	clientConn.Close()
+	if serverErr := <-errs; err == nil {
+		err = serverErr
+	}
+	return err
+}
+
+// writeTestClusterCert writes a new CA certificate and a node certificate and
+// key signed by it to temporary files and returns their paths.
+func writeTestClusterCert(t testing.TB) (certPath, keyPath, caPath string) {
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %+v", err)
+	}
+	ca := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test Cluster CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	caDer, err := x509.CreateCertificate(
+		rand.Reader, ca, ca, &caKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatalf("Failed to create certificate: %+v", err)
+	}
+	if ca, err = x509.ParseCertificate(caDer); err != nil {
+		t.Fatalf("Failed to parse certificate: %+v", err)
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %+v", err)
+	}
+	der, err := x509.CreateCertificate(rand.Reader, &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "node1"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage: []x509.ExtKeyUsage{
+			x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}, ca, &key.PublicKey, caKey)
+	if err != nil {
+		t.Fatalf("Failed to create certificate: %+v", err)
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("Failed to marshal key: %+v", err)
+	}
+
+	dir := t.TempDir()
+	certPath = filepath.Join(dir, "node.crt")
+	keyPath = filepath.Join(dir, "node.key")
+	caPath = filepath.Join(dir, "ca.crt")
+	for path, block := range map[string]*pem.Block{
+		certPath: {Type: "CERTIFICATE", Bytes: der},
+		keyPath:  {Type: "EC PRIVATE KEY", Bytes: keyDer},
+		caPath:   {Type: "CERTIFICATE", Bytes: caDer},
+	} {
+		err = os.WriteFile(path, pem.EncodeToMemory(block), 0600)
+		if err != nil {
+			t.Fatalf("Failed to write %s: %+v", path, err)
+		}
+	}
+	return certPath, keyPath, caPath
+}
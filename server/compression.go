@@ -0,0 +1,392 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package server
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/pkg/errors"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/encoding"
+	_ "google.golang.org/grpc/encoding/gzip"
+	"google.golang.org/grpc/metadata"
+)
+
+// Algorithms that responses can be compressed with. They are the names of the
+// algorithms both as HTTP content encodings and as gRPC compressors.
+const (
+	CompressionGzip = "gzip"
+	CompressionZstd = "zstd"
+)
+
+// grpcAcceptEncodingHeader lists the compressors that a gRPC client can
+// decompress.
+const grpcAcceptEncodingHeader = "grpc-accept-encoding"
+
+// The gzip compressor is registered by its gRPC package, so that both
+// algorithms can decompress gRPC requests and compress HTTP responses.
+func init() {
+	encoding.RegisterCompressor(&zstdCompressor{})
+}
+
+// ParseCompression parses a compression algorithm or several separated by
+// commas, in the order they are preferred. An empty string returns nil, for no
+// compression.
+func ParseCompression(algorithms string) ([]string, error) {
+	if strings.TrimSpace(algorithms) == "" {
+		return nil, nil
+	}
+
+	var parsed []string
+	for _, algorithm := range strings.Split(algorithms, ",") {
+		algorithm = strings.ToLower(strings.TrimSpace(algorithm))
+		switch algorithm {
+		case CompressionGzip, CompressionZstd:
+			parsed = append(parsed, algorithm)
+		default:
+			return nil, errors.Errorf("unknown compression algorithm %q "+
+				"(available: %s, %s)", algorithm, CompressionGzip,
+				CompressionZstd)
+		}
+	}
+	return parsed, nil
+}
+
+// compressionKey is the context key of the compression algorithms of the
+// listener that a native gRPC request was received on.
+type compressionKey struct{}
+
+// withCompression returns the native gRPC request with the algorithms that its
+// response can be compressed with, or the request unchanged if there are none.
+func withCompression(r *http.Request, algorithms []string) *http.Request {
+	if len(algorithms) == 0 {
+		return r
+	}
+	return r.WithContext(
+		context.WithValue(r.Context(), compressionKey{}, algorithms))
+}
+
+// setSendCompression compresses the response messages of the gRPC call with
+// the first algorithm of its listener that the client accepts. The response is
+// left as gRPC sends it, uncompressed or in the compression of the request, if
+// the listener has no algorithms or the client accepts none of them.
+func setSendCompression(ctx context.Context) {
+	algorithms, _ := ctx.Value(compressionKey{}).([]string)
+	if len(algorithms) == 0 {
+		return
+	}
+
+	// The gRPC server served over HTTP does not record the compressors the
+	// client accepts, so they are read from the metadata and set on the
+	// stream directly instead of with grpc.SetSendCompressor
+	stream, ok := grpc.ServerTransportStreamFromContext(ctx).(interface {
+		SetSendCompress(name string) error
+	})
+	md, _ := metadata.FromIncomingContext(ctx)
+	if !ok || md == nil {
+		return
+	}
+	accepted := make(map[string]bool)
+	for _, value := range md.Get(grpcAcceptEncodingHeader) {
+		for _, name := range strings.Split(value, ",") {
+			accepted[strings.TrimSpace(name)] = true
+		}
+	}
+	for _, algorithm := range algorithms {
+		if accepted[algorithm] {
+			_ = stream.SetSendCompress(algorithm)
+			return
+		}
+	}
+}
+
+// compressionUnaryInterceptor returns a gRPC interceptor that compresses the
+// responses of unary calls with setSendCompression.
+func compressionUnaryInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{},
+		_ *grpc.UnaryServerInfo, next grpc.UnaryHandler) (interface{}, error) {
+		setSendCompression(ctx)
+		return next(ctx, req)
+	}
+}
+
+// compressionStreamInterceptor returns a gRPC interceptor that compresses the
+// messages of streaming calls with setSendCompression.
+func compressionStreamInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream,
+		_ *grpc.StreamServerInfo, next grpc.StreamHandler) error {
+		setSendCompression(ss.Context())
+		return next(srv, ss)
+	}
+}
+
+// compressionHandler decompresses the bodies of HTTP requests in one of its
+// algorithms and compresses the responses with the first of its algorithms
+// that the client accepts. Requests in other content encodings are rejected
+// with 415 Unsupported Media Type.
+type compressionHandler struct {
+	algorithms []string
+	next       http.Handler
+}
+
+// ServeHTTP serves the request with the next handler, decompressing its body
+// and compressing the response. Upgraded connections, such as WebSockets, are
+// passed on unchanged.
+func (ch *compressionHandler) ServeHTTP(
+	w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Upgrade") != "" {
+		ch.next.ServeHTTP(w, r)
+		return
+	}
+
+	contentEncoding := strings.ToLower(
+		strings.TrimSpace(r.Header.Get("Content-Encoding")))
+	if contentEncoding != "" && contentEncoding != "identity" {
+		if !ch.supports(contentEncoding) {
+			w.Header().Set("Accept-Encoding", strings.Join(ch.algorithms, ", "))
+			http.Error(w, "unsupported content encoding "+
+				strconv.Quote(contentEncoding), http.StatusUnsupportedMediaType)
+			return
+		}
+		body, err := encoding.GetCompressor(contentEncoding).Decompress(r.Body)
+		if err != nil {
+			http.Error(w, "invalid "+contentEncoding+" request body",
+				http.StatusBadRequest)
+			return
+		}
+		r = r.Clone(r.Context())
+		r.Body = struct {
+			io.Reader
+			io.Closer
+		}{body, r.Body}
+		r.Header.Del("Content-Encoding")
+		r.Header.Del("Content-Length")
+		r.ContentLength = -1
+	}
+
+	cw := &compressionWriter{ResponseWriter: w, method: r.Method,
+		algorithm: acceptedEncoding(
+			r.Header.Values("Accept-Encoding"), ch.algorithms)}
+	defer func() { _ = cw.close() }()
+	ch.next.ServeHTTP(cw, r)
+}
+
+// supports returns true if the algorithm is one of the handler's.
+func (ch *compressionHandler) supports(algorithm string) bool {
+	for _, a := range ch.algorithms {
+		if a == algorithm {
+			return true
+		}
+	}
+	return false
+}
+
+// acceptedEncoding returns the first of the algorithms that the Accept-Encoding
+// headers allow with a non-zero quality, or an empty string if there is none.
+func acceptedEncoding(headers []string, algorithms []string) string {
+	qualities := make(map[string]float64)
+	for _, header := range headers {
+		for _, entry := range strings.Split(header, ",") {
+			name, params, _ := strings.Cut(entry, ";")
+			name = strings.ToLower(strings.TrimSpace(name))
+			quality := 1.0
+			if params = strings.TrimSpace(params); strings.HasPrefix(
+				params, "q=") {
+				var err error
+				quality, err = strconv.ParseFloat(params[len("q="):], 64)
+				if err != nil {
+					continue
+				}
+			}
+			qualities[name] = quality
+		}
+	}
+
+	for _, algorithm := range algorithms {
+		quality, exists := qualities[algorithm]
+		if !exists {
+			quality, exists = qualities["*"]
+		}
+		if exists && quality > 0 {
+			return algorithm
+		}
+	}
+	return ""
+}
+
+// compressionWriter compresses the response written to it with its algorithm,
+// if any. Responses that cannot be compressed, such as partial content and
+// responses that are already encoded or have no body, are written unchanged.
+type compressionWriter struct {
+	http.ResponseWriter
+	method    string
+	algorithm string
+
+	// writer compresses the body once the headers are written, or is nil if
+	// the response is not compressed.
+	writer      io.WriteCloser
+	wroteHeader bool
+}
+
+// WriteHeader decides whether the response is compressed and writes the
+// headers with the status code.
+func (cw *compressionWriter) WriteHeader(code int) {
+	if cw.wroteHeader {
+		return
+	}
+	cw.wroteHeader = true
+
+	h := cw.Header()
+	if code >= http.StatusOK && code != http.StatusNoContent &&
+		code != http.StatusNotModified && cw.method != http.MethodHead &&
+		h.Get("Content-Encoding") == "" && h.Get("Content-Range") == "" {
+		h.Add("Vary", "Accept-Encoding")
+		if cw.algorithm != "" {
+			writer, err := encoding.GetCompressor(cw.algorithm).Compress(
+				cw.ResponseWriter)
+			if err == nil {
+				cw.writer = writer
+				h.Set("Content-Encoding", cw.algorithm)
+				h.Del("Content-Length")
+			}
+		}
+	}
+	cw.ResponseWriter.WriteHeader(code)
+}
+
+// Write writes the data to the response, compressed if the response is.
+func (cw *compressionWriter) Write(data []byte) (int, error) {
+	if !cw.wroteHeader {
+		cw.WriteHeader(http.StatusOK)
+	}
+	if cw.writer == nil {
+		return cw.ResponseWriter.Write(data)
+	}
+	return cw.writer.Write(data)
+}
+
+// ReadFrom writes the data read from r to the response. An uncompressed
+// response reads it with the underlying writer, so that a file of the local
+// filesystem can still be sent with sendfile.
+func (cw *compressionWriter) ReadFrom(r io.Reader) (int64, error) {
+	if !cw.wroteHeader {
+		cw.WriteHeader(http.StatusOK)
+	}
+	if cw.writer != nil {
+		return copyFile(cw.writer, r)
+	}
+	if rf, ok := cw.ResponseWriter.(io.ReaderFrom); ok {
+		return rf.ReadFrom(r)
+	}
+	return copyFile(cw.ResponseWriter, r)
+}
+
+// Flush sends the data compressed so far to the client, so that streamed
+// responses, such as gRPC-web, are not held back by the compression.
+func (cw *compressionWriter) Flush() {
+	if !cw.wroteHeader {
+		cw.WriteHeader(http.StatusOK)
+	}
+	if flusher, ok := cw.writer.(interface{ Flush() error }); ok {
+		_ = flusher.Flush()
+	}
+	if flusher, ok := cw.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// close writes the end of the compressed response.
+func (cw *compressionWriter) close() error {
+	if cw.writer == nil {
+		return nil
+	}
+	return cw.writer.Close()
+}
+
+// zstdCompressor is the gRPC compressor of zstd. Encoders and decoders are
+// reused between messages, since they are costly to create.
+type zstdCompressor struct {
+	encoders sync.Pool
+	decoders sync.Pool
+}
+
+// Compress returns a writer that compresses the data written to it into w
+// until it is closed.
+func (zc *zstdCompressor) Compress(w io.Writer) (io.WriteCloser, error) {
+	encoder, ok := zc.encoders.Get().(*zstd.Encoder)
+	if ok {
+		encoder.Reset(w)
+	} else {
+		var err error
+		encoder, err = zstd.NewWriter(w, zstd.WithEncoderConcurrency(1))
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to create zstd encoder")
+		}
+	}
+	return &zstdWriter{Encoder: encoder, pool: &zc.encoders}, nil
+}
+
+// Decompress returns a reader that decompresses the data read from r.
+func (zc *zstdCompressor) Decompress(r io.Reader) (io.Reader, error) {
+	decoder, ok := zc.decoders.Get().(*zstd.Decoder)
+	if ok {
+		if err := decoder.Reset(r); err != nil {
+			zc.decoders.Put(decoder)
+			return nil, errors.Wrap(err, "failed to reset zstd decoder")
+		}
+	} else {
+		var err error
+		decoder, err = zstd.NewReader(r, zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to create zstd decoder")
+		}
+	}
+	return &zstdReader{decoder: decoder, pool: &zc.decoders}, nil
+}
+
+// Name returns the name of the compressor.
+func (zc *zstdCompressor) Name() string {
+	return CompressionZstd
+}
+
+// zstdWriter returns its encoder to the pool once closed.
+type zstdWriter struct {
+	*zstd.Encoder
+	pool *sync.Pool
+}
+
+// Close writes the end of the compressed data.
+func (zw *zstdWriter) Close() error {
+	defer zw.pool.Put(zw.Encoder)
+	return zw.Encoder.Close()
+}
+
+// zstdReader returns its decoder to the pool once all data is read.
+type zstdReader struct {
+	decoder *zstd.Decoder
+	pool    *sync.Pool
+}
+
+// Read reads decompressed data.
+func (zr *zstdReader) Read(p []byte) (int, error) {
+	if zr.decoder == nil {
+		return 0, io.EOF
+	}
+	n, err := zr.decoder.Read(p)
+	if err == io.EOF {
+		zr.pool.Put(zr.decoder)
+		zr.decoder = nil
+	}
+	return n, err
+}
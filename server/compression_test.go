@@ -0,0 +1,296 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package server
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/improbable-eng/grpc-web/go/grpcweb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/encoding"
+	"google.golang.org/grpc/metadata"
+
+	"gitlab.com/elixxir/remoteSyncServer/rpc"
+)
+
+// Tests that ParseCompression returns nil for an empty string and the
+// algorithms in order otherwise.
+func TestParseCompression(t *testing.T) {
+	tests := map[string][]string{
+		"":            nil,
+		" ":           nil,
+		"gzip":        {CompressionGzip},
+		"ZSTD, gzip ": {CompressionZstd, CompressionGzip},
+	}
+	for algorithms, expected := range tests {
+		parsed, err := ParseCompression(algorithms)
+		if err != nil {
+			t.Errorf("Failed to parse %q: %+v", algorithms, err)
+		} else if !reflect.DeepEqual(expected, parsed) {
+			t.Errorf("Unexpected algorithms for %q.\nexpected: %v"+
+				"\nreceived: %v", algorithms, expected, parsed)
+		}
+	}
+
+	if _, err := ParseCompression("zstd,br"); err == nil {
+		t.Errorf("Failed to get error for unknown algorithm.")
+	}
+}
+
+// Tests that acceptedEncoding returns the first algorithm that the headers
+// allow, honouring qualities and wildcards.
+func Test_acceptedEncoding(t *testing.T) {
+	algorithms := []string{CompressionZstd, CompressionGzip}
+	tests := []struct {
+		headers  []string
+		expected string
+	}{
+		{nil, ""},
+		{[]string{"identity"}, ""},
+		{[]string{"gzip, deflate, br"}, CompressionGzip},
+		{[]string{"gzip", "zstd"}, CompressionZstd},
+		{[]string{"zstd;q=0, gzip;q=0.5"}, CompressionGzip},
+		{[]string{"*"}, CompressionZstd},
+		{[]string{"*;q=0.1, zstd;q=0"}, CompressionGzip},
+		{[]string{"gzip;q=0"}, ""},
+	}
+	for i, tt := range tests {
+		if accepted := acceptedEncoding(tt.headers, algorithms); accepted !=
+			tt.expected {
+			t.Errorf("Unexpected algorithm for headers %d %q."+
+				"\nexpected: %q\nreceived: %q",
+				i, tt.headers, tt.expected, accepted)
+		}
+	}
+}
+
+// compress returns the data compressed with the algorithm.
+func compress(t *testing.T, algorithm string, data []byte) []byte {
+	var buf bytes.Buffer
+	w, err := encoding.GetCompressor(algorithm).Compress(&buf)
+	if err != nil {
+		t.Fatalf("Failed to create %s writer: %+v", algorithm, err)
+	}
+	if _, err = w.Write(data); err != nil {
+		t.Fatalf("Failed to compress with %s: %+v", algorithm, err)
+	} else if err = w.Close(); err != nil {
+		t.Fatalf("Failed to close %s writer: %+v", algorithm, err)
+	}
+	return buf.Bytes()
+}
+
+// decompress returns the data decompressed with the algorithm.
+func decompress(t *testing.T, algorithm string, data []byte) []byte {
+	r, err := encoding.GetCompressor(algorithm).Decompress(
+		bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Failed to create %s reader: %+v", algorithm, err)
+	}
+	decompressed, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("Failed to decompress with %s: %+v", algorithm, err)
+	}
+	return decompressed
+}
+
+// Tests that data compressed with the registered zstd compressor decompresses
+// to the original data, with encoders and decoders reused.
+func Test_zstdCompressor(t *testing.T) {
+	for i := 0; i < 3; i++ {
+		data := bytes.Repeat([]byte("transaction log "), 1000*(i+1))
+		compressed := compress(t, CompressionZstd, data)
+		if len(compressed) >= len(data) {
+			t.Errorf("Data was not compressed: %d bytes", len(compressed))
+		}
+		if !bytes.Equal(decompress(t, CompressionZstd, compressed), data) {
+			t.Errorf("Decompressed data %d does not match.", i)
+		}
+	}
+}
+
+// Tests that Listener.handler compresses REST responses with an algorithm the
+// client accepts and decompresses compressed requests.
+func TestListener_handler_Compression(t *testing.T) {
+	grpcServer := grpc.NewServer()
+	rpc.RegisterInfoServer(grpcServer,
+		&infoEndpoints{version: &rpc.RsGetVersionResponse{Version: "1.2.3"}})
+	l := Listener{Protocols: []string{ProtocolREST},
+		Compression: []string{CompressionZstd, CompressionGzip}}
+	handler := l.handler(
+		grpcServer, grpcweb.WrapServer(grpcServer), nil, nil, nil, nil, nil)
+
+	for _, algorithm := range []string{CompressionZstd, CompressionGzip} {
+		r := httptest.NewRequest(http.MethodPost, "/remoteSync.Info/GetVersion",
+			bytes.NewReader(compress(t, algorithm, []byte("{}"))))
+		r.Header.Set("Content-Encoding", algorithm)
+		r.Header.Set("Accept-Encoding", algorithm)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+
+		if w.Code != http.StatusOK {
+			t.Errorf("Unexpected status for %s.\nexpected: %d\nreceived: %d",
+				algorithm, http.StatusOK, w.Code)
+		}
+		if encoded := w.Header().Get("Content-Encoding"); encoded != algorithm {
+			t.Errorf("Unexpected content encoding.\nexpected: %q"+
+				"\nreceived: %q", algorithm, encoded)
+		}
+		body := decompress(t, algorithm, w.Body.Bytes())
+		if !strings.Contains(string(body), "1.2.3") {
+			t.Errorf("Unexpected %s response: %s", algorithm, body)
+		}
+	}
+
+	// Responses to clients that do not accept compression are unchanged
+	r := httptest.NewRequest(http.MethodPost, "/remoteSync.Info/GetVersion",
+		strings.NewReader("{}"))
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	if w.Header().Get("Content-Encoding") != "" ||
+		!strings.Contains(w.Body.String(), "1.2.3") {
+		t.Errorf("Unexpected uncompressed response %q: %s",
+			w.Header().Get("Content-Encoding"), w.Body)
+	}
+}
+
+// Error path: Tests that compressionHandler rejects requests in a content
+// encoding that is not one of its algorithms with 415 Unsupported Media Type.
+func TestCompressionHandler_UnsupportedEncoding(t *testing.T) {
+	ch := &compressionHandler{algorithms: []string{CompressionGzip},
+		next: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			t.Errorf("Request in unsupported encoding was served.")
+		})}
+	for _, contentEncoding := range []string{"br", CompressionZstd} {
+		r := httptest.NewRequest(http.MethodPut, "/", strings.NewReader("x"))
+		r.Header.Set("Content-Encoding", contentEncoding)
+		w := httptest.NewRecorder()
+		ch.ServeHTTP(w, r)
+		if w.Code != http.StatusUnsupportedMediaType {
+			t.Errorf("Unexpected status for %s.\nexpected: %d\nreceived: %d",
+				contentEncoding, http.StatusUnsupportedMediaType, w.Code)
+		}
+	}
+}
+
+// Tests that compressionHandler does not compress partial content, responses
+// to HEAD requests, or responses that are already encoded.
+func TestCompressionHandler_NotCompressed(t *testing.T) {
+	tests := []struct {
+		method string
+		header string
+		value  string
+		code   int
+	}{
+		{http.MethodGet, "Content-Range", "bytes 0-3/8",
+			http.StatusPartialContent},
+		{http.MethodHead, "", "", http.StatusOK},
+		{http.MethodGet, "Content-Encoding", "br", http.StatusOK},
+		{http.MethodGet, "", "", http.StatusNoContent},
+	}
+	for i, tt := range tests {
+		ch := &compressionHandler{algorithms: []string{CompressionGzip},
+			next: http.HandlerFunc(
+				func(w http.ResponseWriter, r *http.Request) {
+					if tt.header != "" {
+						w.Header().Set(tt.header, tt.value)
+					}
+					w.WriteHeader(tt.code)
+					_, _ = w.Write([]byte("data"))
+				})}
+		r := httptest.NewRequest(tt.method, "/", nil)
+		r.Header.Set("Accept-Encoding", "gzip")
+		w := httptest.NewRecorder()
+		ch.ServeHTTP(w, r)
+		if w.Header().Get("Content-Encoding") == CompressionGzip {
+			t.Errorf("Response %d was compressed.", i)
+		}
+	}
+}
+
+// testTransportStream is a grpc.ServerTransportStream that records the
+// compressor set on it.
+type testTransportStream struct {
+	grpc.ServerTransportStream
+	sendCompress string
+}
+
+// SetSendCompress records the compressor.
+func (tts *testTransportStream) SetSendCompress(name string) error {
+	tts.sendCompress = name
+	return nil
+}
+
+// Tests that setSendCompression sets the first algorithm of the listener that
+// the client accepts, and none without algorithms or an accepted one.
+func Test_setSendCompression(t *testing.T) {
+	algorithms := []string{CompressionZstd, CompressionGzip}
+	tests := []struct {
+		algorithms []string
+		accepted   string
+		expected   string
+	}{
+		{algorithms, "gzip,zstd", CompressionZstd},
+		{algorithms, "identity, gzip", CompressionGzip},
+		{algorithms, "deflate", ""},
+		{nil, "gzip,zstd", ""},
+	}
+	for i, tt := range tests {
+		stream := &testTransportStream{}
+		ctx := grpc.NewContextWithServerTransportStream(
+			context.Background(), stream)
+		ctx = metadata.NewIncomingContext(ctx,
+			metadata.Pairs(grpcAcceptEncodingHeader, tt.accepted))
+		if tt.algorithms != nil {
+			ctx = context.WithValue(ctx, compressionKey{}, tt.algorithms)
+		}
+
+		setSendCompression(ctx)
+		if stream.sendCompress != tt.expected {
+			t.Errorf("Unexpected compressor for call %d."+
+				"\nexpected: %q\nreceived: %q",
+				i, tt.expected, stream.sendCompress)
+		}
+	}
+}
+
+// Tests that data copied into the writer of compressionHandler is compressed
+// if the client accepts compression and written unchanged otherwise.
+func TestCompressionHandler_ReadFrom(t *testing.T) {
+	data := bytes.Repeat([]byte("large file "), 10000)
+	ch := &compressionHandler{algorithms: []string{CompressionGzip},
+		next: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if _, err := io.Copy(w, bytes.NewReader(data)); err != nil {
+				t.Errorf("Failed to copy data: %+v", err)
+			}
+		})}
+
+	for _, accepted := range []string{"gzip", ""} {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Set("Accept-Encoding", accepted)
+		w := httptest.NewRecorder()
+		ch.ServeHTTP(w, r)
+
+		body := w.Body.Bytes()
+		if encoded := w.Header().Get("Content-Encoding"); encoded != accepted {
+			t.Errorf("Unexpected content encoding.\nexpected: %q"+
+				"\nreceived: %q", accepted, encoded)
+		} else if accepted != "" {
+			body = decompress(t, accepted, body)
+		}
+		if !bytes.Equal(body, data) {
+			t.Errorf("Unexpected body for %q: %d bytes", accepted, len(body))
+		}
+	}
+}
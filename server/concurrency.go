@@ -0,0 +1,213 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package server
+
+import (
+	"context"
+	"net"
+	"sync"
+
+	"github.com/pkg/errors"
+	jww "github.com/spf13/jwalterweatherman"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"gitlab.com/elixxir/remoteSyncServer/rpc"
+)
+
+var (
+	// UserBusyErr is returned, with the RESOURCE_EXHAUSTED code, for a
+	// request of a user who already has the maximum number of requests in
+	// progress.
+	UserBusyErr = errors.New("too many concurrent requests for the user")
+
+	// ServerBusyErr is returned, with the RESOURCE_EXHAUSTED code, for a
+	// request while the maximum number of requests are operating on storage.
+	ServerBusyErr = errors.New("too many storage operations in progress")
+)
+
+// ConcurrencyParams are the parameters of the concurrency limits. They are set
+// in the "concurrency" section of the config. A limit of zero is no limit.
+type ConcurrencyParams struct {
+	// MaxConnections is the maximum number of open connections across all
+	// listeners. Connections over the limit are closed once accepted.
+	MaxConnections int `mapstructure:"maxConnections"`
+
+	// MaxUserRequests is the maximum number of requests each user can have in
+	// progress at once across all of their tokens.
+	MaxUserRequests int `mapstructure:"maxUserRequests"`
+
+	// MaxStorageOps is the maximum number of requests of all users operating
+	// on storage at once.
+	MaxStorageOps int `mapstructure:"maxStorageOps"`
+}
+
+// ConcurrencyLimiter limits the number of open connections and of requests in
+// progress, so that the server rejects work under load instead of running out
+// of memory. Requests over the limits are rejected with RESOURCE_EXHAUSTED,
+// which clients retry after backing off.
+type ConcurrencyLimiter struct {
+	params ConcurrencyParams
+
+	// connections is the number of open connections, storageOps the number
+	// of requests in progress, and userRequests the number in progress for
+	// each user with any.
+	connections  int
+	storageOps   int
+	userRequests map[string]int
+	mux          sync.Mutex
+}
+
+// NewConcurrencyLimiter creates a new ConcurrencyLimiter from the parameters.
+// Returns an error for unknown parameters or negative limits.
+func NewConcurrencyLimiter(
+	params map[string]interface{}) (*ConcurrencyLimiter, error) {
+	var p ConcurrencyParams
+	if err := decodeParams(params, &p, "concurrency"); err != nil {
+		return nil, err
+	}
+
+	if p.MaxConnections < 0 || p.MaxUserRequests < 0 || p.MaxStorageOps < 0 {
+		return nil, errors.Errorf("limits %+v cannot be negative", p)
+	}
+
+	return &ConcurrencyLimiter{
+		params:       p,
+		userRequests: make(map[string]int),
+	}, nil
+}
+
+// Params returns the parameters of the limiter.
+func (cl *ConcurrencyLimiter) Params() ConcurrencyParams {
+	return cl.params
+}
+
+// limitsConnections returns true if the number of connections is limited,
+// which requires the server to accept the connections itself.
+func (cl *ConcurrencyLimiter) limitsConnections() bool {
+	return cl != nil && cl.params.MaxConnections > 0
+}
+
+// acquire starts a request of the user. Returns [UserBusyErr] if the user has
+// the maximum number of requests in progress and [ServerBusyErr] if the
+// maximum number of requests are operating on storage. Otherwise, the returned
+// function must be called once the request completes.
+func (cl *ConcurrencyLimiter) acquire(username string) (func(), error) {
+	cl.mux.Lock()
+	defer cl.mux.Unlock()
+
+	p := cl.params
+	if p.MaxUserRequests > 0 && cl.userRequests[username] >= p.MaxUserRequests {
+		return nil, errors.Wrapf(UserBusyErr, "%q has %d requests in progress",
+			username, cl.userRequests[username])
+	} else if p.MaxStorageOps > 0 && cl.storageOps >= p.MaxStorageOps {
+		return nil, errors.Wrapf(
+			ServerBusyErr, "%d requests in progress", cl.storageOps)
+	}
+
+	cl.storageOps++
+	cl.userRequests[username]++
+	var once sync.Once
+	return func() { once.Do(func() { cl.release(username) }) }, nil
+}
+
+// release completes a request of the user started by acquire.
+func (cl *ConcurrencyLimiter) release(username string) {
+	cl.mux.Lock()
+	defer cl.mux.Unlock()
+
+	cl.storageOps--
+	if cl.userRequests[username]--; cl.userRequests[username] <= 0 {
+		delete(cl.userRequests, username)
+	}
+}
+
+// interceptor returns a gRPC interceptor that rejects requests with
+// RESOURCE_EXHAUSTED when they would exceed the limits. Only requests of a
+// user, made with the token of a session or to log in or register, are
+// limited. The streams of the Changes service are not limited, since they
+// stay open for as long as the client watches.
+func (cl *ConcurrencyLimiter) interceptor(
+	h *handler) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{},
+		info *grpc.UnaryServerInfo, next grpc.UnaryHandler) (interface{}, error) {
+		username := requestUsername(h, req)
+		if username == "" ||
+			info.FullMethod == rpc.Changes_Watch_FullMethodName {
+			return next(ctx, req)
+		}
+		release, err := cl.acquire(username)
+		if err != nil {
+			jww.DEBUG.Printf("Rejected %s: %v", info.FullMethod, err)
+			return nil, status.Error(codes.ResourceExhausted, err.Error())
+		}
+		defer release()
+		return next(ctx, req)
+	}
+}
+
+// listener returns the listener with its connections counted towards the
+// maximum number of connections, or the listener unchanged if they are not
+// limited.
+func (cl *ConcurrencyLimiter) listener(l net.Listener) net.Listener {
+	if !cl.limitsConnections() {
+		return l
+	}
+	return &limitedListener{Listener: l, cl: cl}
+}
+
+// limitedListener closes the connections it accepts over the maximum number
+// of connections of its limiter.
+type limitedListener struct {
+	net.Listener
+	cl *ConcurrencyLimiter
+}
+
+// Accept waits for and returns the next connection under the limit. The
+// connection is counted until it is closed.
+func (ll *limitedListener) Accept() (net.Conn, error) {
+	for {
+		conn, err := ll.Listener.Accept()
+		if err != nil {
+			return nil, err
+		}
+
+		ll.cl.mux.Lock()
+		allowed := ll.cl.connections < ll.cl.params.MaxConnections
+		if allowed {
+			ll.cl.connections++
+		}
+		ll.cl.mux.Unlock()
+
+		if allowed {
+			return &limitedConn{Conn: conn, cl: ll.cl}, nil
+		}
+		jww.DEBUG.Printf("Closed connection from %s over the limit of %d "+
+			"connections.", conn.RemoteAddr(), ll.cl.params.MaxConnections)
+		_ = conn.Close()
+	}
+}
+
+// limitedConn is a connection counted by a ConcurrencyLimiter until it is
+// closed.
+type limitedConn struct {
+	net.Conn
+	cl   *ConcurrencyLimiter
+	once sync.Once
+}
+
+// Close closes the connection and stops counting it.
+func (lc *limitedConn) Close() error {
+	lc.once.Do(func() {
+		lc.cl.mux.Lock()
+		lc.cl.connections--
+		lc.cl.mux.Unlock()
+	})
+	return lc.Conn.Close()
+}
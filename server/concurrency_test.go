@@ -0,0 +1,256 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package server
+
+import (
+	"context"
+	"io"
+	"math/rand"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	pb "gitlab.com/elixxir/comms/mixmessages"
+	"gitlab.com/elixxir/remoteSyncServer/rpc"
+)
+
+// newTestConcurrencyLimiter returns a ConcurrencyLimiter with the parameters.
+func newTestConcurrencyLimiter(
+	t *testing.T, params map[string]interface{}) *ConcurrencyLimiter {
+	cl, err := NewConcurrencyLimiter(params)
+	if err != nil {
+		t.Fatalf("Failed to create concurrency limiter: %+v", err)
+	}
+	return cl
+}
+
+// Tests that NewConcurrencyLimiter decodes the parameters.
+func TestNewConcurrencyLimiter(t *testing.T) {
+	cl := newTestConcurrencyLimiter(t, map[string]interface{}{
+		"maxConnections": "100", "maxUserRequests": 4, "maxStorageOps": 32})
+	expected := ConcurrencyParams{
+		MaxConnections: 100, MaxUserRequests: 4, MaxStorageOps: 32}
+	if cl.Params() != expected {
+		t.Errorf("Unexpected parameters.\nexpected: %+v\nreceived: %+v",
+			expected, cl.Params())
+	}
+	if !cl.limitsConnections() {
+		t.Errorf("Connections are not limited.")
+	}
+}
+
+// Error path: Tests that NewConcurrencyLimiter returns an error for unknown
+// parameters and negative limits.
+func TestNewConcurrencyLimiter_Error(t *testing.T) {
+	tests := []map[string]interface{}{
+		{"unknown": 1},
+		{"maxConnections": -1},
+		{"maxUserRequests": -1},
+		{"maxStorageOps": -1},
+	}
+	for _, params := range tests {
+		if _, err := NewConcurrencyLimiter(params); err == nil {
+			t.Errorf("No error for parameters %+v.", params)
+		}
+	}
+}
+
+// Tests that ConcurrencyLimiter.acquire rejects requests over the limit of each
+// user with UserBusyErr and over the storage limit with ServerBusyErr, and
+// allows them again once requests are released.
+func TestConcurrencyLimiter_acquire(t *testing.T) {
+	cl := newTestConcurrencyLimiter(t, map[string]interface{}{
+		"maxUserRequests": 2, "maxStorageOps": 3})
+
+	waldo1, err := cl.acquire("waldo")
+	if err != nil {
+		t.Fatalf("Failed to acquire first request: %+v", err)
+	}
+	if _, err = cl.acquire("waldo"); err != nil {
+		t.Fatalf("Failed to acquire second request: %+v", err)
+	}
+	if _, err = cl.acquire("waldo"); !errors.Is(err, UserBusyErr) {
+		t.Errorf("Unexpected error over user limit.\nexpected: %v"+
+			"\nreceived: %+v", UserBusyErr, err)
+	}
+
+	fred, err := cl.acquire("fred")
+	if err != nil {
+		t.Fatalf("Failed to acquire request of other user: %+v", err)
+	}
+	if _, err = cl.acquire("carmen"); !errors.Is(err, ServerBusyErr) {
+		t.Errorf("Unexpected error over storage limit.\nexpected: %v"+
+			"\nreceived: %+v", ServerBusyErr, err)
+	}
+
+	// Releasing twice must only release the request once
+	waldo1()
+	waldo1()
+	if _, err = cl.acquire("waldo"); err != nil {
+		t.Errorf("Failed to acquire request after release: %+v", err)
+	}
+	if _, err = cl.acquire("carmen"); !errors.Is(err, ServerBusyErr) {
+		t.Errorf("Unexpected error over storage limit.\nexpected: %v"+
+			"\nreceived: %+v", ServerBusyErr, err)
+	}
+
+	fred()
+	if _, exists := cl.userRequests["fred"]; exists {
+		t.Errorf("Count of user without requests was not removed.")
+	}
+}
+
+// Tests that ConcurrencyLimiter.interceptor rejects requests of a user over
+// the limit with RESOURCE_EXHAUSTED and does not limit requests without a
+// user.
+func TestConcurrencyLimiter_interceptor(t *testing.T) {
+	h, token := newHandlerLogin(
+		time.Hour, "waldo", "hunter2", rand.New(rand.NewSource(91)), t)
+	cl := newTestConcurrencyLimiter(
+		t, map[string]interface{}{"maxUserRequests": 1})
+	interceptor := cl.interceptor(h)
+	info := &grpc.UnaryServerInfo{FullMethod: "/test/Method"}
+	req := &pb.RsReadRequest{Token: token.Marshal()}
+
+	// Make a request from within a request of the same user
+	var inner error
+	_, err := interceptor(context.Background(), req, info,
+		func(ctx context.Context, req interface{}) (interface{}, error) {
+			_, inner = interceptor(ctx, req, info, func(
+				context.Context, interface{}) (interface{}, error) {
+				return nil, nil
+			})
+			_, err := interceptor(ctx, struct{}{}, info, func(
+				context.Context, interface{}) (interface{}, error) {
+				return nil, nil
+			})
+			return nil, err
+		})
+	if err != nil {
+		t.Errorf("Failed request without a user: %+v", err)
+	}
+	if status.Code(inner) != codes.ResourceExhausted {
+		t.Errorf("Unexpected code for request over the limit."+
+			"\nexpected: %s\nreceived: %s",
+			codes.ResourceExhausted, status.Code(inner))
+	}
+
+	_, err = interceptor(context.Background(), req, info,
+		func(context.Context, interface{}) (interface{}, error) {
+			return nil, nil
+		})
+	if err != nil {
+		t.Errorf("Failed request after previous one completed: %+v", err)
+	}
+}
+
+// Tests that the interceptor of ConcurrencyLimiter does not count the streams
+// of the Changes service toward the limits.
+func TestConcurrencyLimiter_interceptor_Watch(t *testing.T) {
+	h, token := newHandlerLogin(
+		time.Hour, "waldo", "hunter2", rand.New(rand.NewSource(92)), t)
+	cl := newTestConcurrencyLimiter(
+		t, map[string]interface{}{"maxUserRequests": 1})
+	interceptor := cl.interceptor(h)
+	watch := &grpc.UnaryServerInfo{FullMethod: rpc.Changes_Watch_FullMethodName}
+	info := &grpc.UnaryServerInfo{FullMethod: "/test/Method"}
+
+	var inner error
+	_, err := interceptor(context.Background(),
+		&rpc.RsWatchRequest{Token: token.Marshal()}, watch,
+		func(ctx context.Context, _ interface{}) (interface{}, error) {
+			_, inner = interceptor(ctx, &pb.RsReadRequest{
+				Token: token.Marshal()}, info, func(
+				context.Context, interface{}) (interface{}, error) {
+				return nil, nil
+			})
+			return nil, nil
+		})
+	if err != nil {
+		t.Errorf("Failed to watch: %+v", err)
+	}
+	if inner != nil {
+		t.Errorf("Failed request while watching: %+v", inner)
+	}
+}
+
+// Tests that the listener of ConcurrencyLimiter closes connections over the
+// maximum and accepts connections again once others are closed.
+func TestConcurrencyLimiter_listener(t *testing.T) {
+	cl := newTestConcurrencyLimiter(
+		t, map[string]interface{}{"maxConnections": 1})
+	nl, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %+v", err)
+	}
+	l := cl.listener(nl)
+	defer func() { _ = l.Close() }()
+
+	accepted := make(chan net.Conn)
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				close(accepted)
+				return
+			}
+			accepted <- conn
+		}
+	}()
+	dial := func() net.Conn {
+		conn, err := net.Dial("tcp", nl.Addr().String())
+		if err != nil {
+			t.Fatalf("Failed to dial: %+v", err)
+		}
+		return conn
+	}
+
+	first := dial()
+	defer func() { _ = first.Close() }()
+	firstServer := <-accepted
+
+	second := dial()
+	defer func() { _ = second.Close() }()
+	_ = second.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, err = second.Read(make([]byte, 1)); err != io.EOF {
+		t.Errorf("Connection over the limit was not closed: %v", err)
+	}
+
+	_ = firstServer.Close()
+	third := dial()
+	defer func() { _ = third.Close() }()
+	select {
+	case conn := <-accepted:
+		_ = conn.Close()
+	case <-time.After(5 * time.Second):
+		t.Errorf("Connection under the limit was not accepted.")
+	}
+}
+
+// Tests that ConcurrencyLimiter.listener returns the listener unchanged when
+// connections are not limited.
+func TestConcurrencyLimiter_listener_Unlimited(t *testing.T) {
+	nl, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %+v", err)
+	}
+	defer func() { _ = nl.Close() }()
+
+	cl := newTestConcurrencyLimiter(
+		t, map[string]interface{}{"maxUserRequests": 1})
+	for _, limiter := range []*ConcurrencyLimiter{nil, cl} {
+		if l := limiter.listener(nl); l != nl {
+			t.Errorf("Listener was wrapped without a connection limit.")
+		}
+	}
+}
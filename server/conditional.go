@@ -0,0 +1,70 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package server
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"os"
+
+	"github.com/pkg/errors"
+
+	"gitlab.com/elixxir/remoteSyncServer/store"
+)
+
+var (
+	// InvalidConditionErr is returned for a conditional write with neither or
+	// both of IfMatch and IfNoneMatch, or an IfMatch that is not a SHA-256
+	// hash.
+	InvalidConditionErr = errors.New("invalid write condition")
+
+	// WriteConflictErr is returned when the condition of a conditional write
+	// does not hold, because the file was changed, created, or deleted since
+	// the client last saw it.
+	WriteConflictErr = errors.New("write conflict")
+)
+
+// checkWriteCondition returns [InvalidConditionErr] if the condition of a
+// conditional write is not exactly one of a SHA-256 hash or ifNoneMatch.
+func checkWriteCondition(ifMatch []byte, ifNoneMatch bool) error {
+	if len(ifMatch) == 0 && !ifNoneMatch {
+		return errors.Wrap(InvalidConditionErr, "no condition")
+	} else if len(ifMatch) != 0 && ifNoneMatch {
+		return errors.Wrap(
+			InvalidConditionErr, "both IfMatch and IfNoneMatch")
+	} else if len(ifMatch) != 0 && len(ifMatch) != sha256.Size {
+		return errors.Wrapf(InvalidConditionErr,
+			"IfMatch of %d bytes is not a SHA-256 hash", len(ifMatch))
+	}
+	return nil
+}
+
+// matchWriteCondition returns [WriteConflictErr] if the SHA-256 hash of the
+// current data of the file at the path is not ifMatch or, with ifNoneMatch, if
+// the file exists. The caller must hold the write lock of the user, so that
+// the file does not change before it is written.
+func matchWriteCondition(
+	s store.Store, path string, ifMatch []byte, ifNoneMatch bool) error {
+	md, err := store.Stat(s, path)
+	if errors.Is(err, os.ErrNotExist) {
+		if ifNoneMatch {
+			return nil
+		}
+		return errors.Wrapf(WriteConflictErr, "%s does not exist", path)
+	} else if err != nil {
+		return err
+	}
+
+	if ifNoneMatch {
+		return errors.Wrapf(WriteConflictErr, "%s exists", path)
+	} else if !bytes.Equal(md.SHA256, ifMatch) {
+		return errors.Wrapf(WriteConflictErr,
+			"%s has SHA-256 hash %x, expected %x", path, md.SHA256, ifMatch)
+	}
+	return nil
+}
@@ -0,0 +1,109 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+
+	pb "gitlab.com/elixxir/comms/mixmessages"
+	"gitlab.com/elixxir/remoteSyncServer/rpc"
+)
+
+// Tests that handler.ConditionalWrite creates a file with IfNoneMatch and
+// overwrites it with the hash returned by the previous write, and that the
+// file is not changed by writes whose condition does not hold.
+func Test_handler_ConditionalWrite(t *testing.T) {
+	h, token := newHandlerLogin(
+		time.Hour, "waldo", "hunter2", rand.New(rand.NewSource(89)), t)
+	write := func(data string, ifMatch []byte, ifNoneMatch bool) (
+		[]byte, error) {
+		resp, err := h.ConditionalWrite(context.Background(),
+			&rpc.RsConditionalWriteRequest{
+				Token:       token.Marshal(),
+				Path:        "txlog",
+				Data:        []byte(data),
+				IfMatch:     ifMatch,
+				IfNoneMatch: ifNoneMatch,
+			})
+		return resp.GetSHA256(), err
+	}
+
+	first, err := write("first", nil, true)
+	if err != nil {
+		t.Fatalf("Failed to create file: %+v", err)
+	}
+	if sum := sha256.Sum256([]byte("first")); !bytes.Equal(first, sum[:]) {
+		t.Errorf("Unexpected hash.\nexpected: %x\nreceived: %x", sum, first)
+	}
+	if _, err = write("other", nil, true); !errors.Is(err, WriteConflictErr) {
+		t.Errorf("Unexpected error creating existing file: %+v", err)
+	}
+
+	second, err := write("second", first, false)
+	if err != nil {
+		t.Fatalf("Failed to overwrite file: %+v", err)
+	}
+	if _, err = write("other", first, false); !errors.Is(
+		err, WriteConflictErr) {
+		t.Errorf("Unexpected error for stale hash: %+v", err)
+	}
+	if _, err = write("third", second, false); err != nil {
+		t.Errorf("Failed to overwrite file: %+v", err)
+	}
+
+	resp, _ := h.Read(context.Background(),
+		&pb.RsReadRequest{Token: token.Marshal(), Path: "txlog"})
+	if !bytes.Equal(resp.GetData(), []byte("third")) {
+		t.Errorf("Unexpected data.\nexpected: %q\nreceived: %q",
+			"third", resp.GetData())
+	}
+}
+
+// Error path: Tests that handler.ConditionalWrite returns WriteConflictErr
+// with IfMatch for a file that does not exist.
+func Test_handler_ConditionalWrite_NotExist(t *testing.T) {
+	h, token := newHandlerLogin(
+		time.Hour, "waldo", "hunter2", rand.New(rand.NewSource(89)), t)
+	sum := sha256.Sum256([]byte("data"))
+	_, err := h.ConditionalWrite(context.Background(),
+		&rpc.RsConditionalWriteRequest{Token: token.Marshal(),
+			Path: "missing", Data: []byte("data"), IfMatch: sum[:]})
+	if !errors.Is(err, WriteConflictErr) {
+		t.Errorf("Unexpected error.\nexpected: %v\nreceived: %+v",
+			WriteConflictErr, err)
+	}
+}
+
+// Error path: Tests that checkWriteCondition returns InvalidConditionErr for
+// no condition, both conditions, and an IfMatch that is not a SHA-256 hash.
+func Test_checkWriteCondition_Error(t *testing.T) {
+	sum := sha256.Sum256([]byte("data"))
+	tests := []struct {
+		ifMatch     []byte
+		ifNoneMatch bool
+	}{
+		{nil, false},
+		{sum[:], true},
+		{sum[:16], false},
+	}
+	for _, tt := range tests {
+		err := checkWriteCondition(tt.ifMatch, tt.ifNoneMatch)
+		if !errors.Is(err, InvalidConditionErr) {
+			t.Errorf("Unexpected error for %x and %t.\nexpected: %v"+
+				"\nreceived: %+v", tt.ifMatch, tt.ifNoneMatch,
+				InvalidConditionErr, err)
+		}
+	}
+}
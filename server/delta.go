@@ -0,0 +1,323 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package server
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"math"
+
+	"github.com/pkg/errors"
+)
+
+// Limits of the block size of delta signatures.
+const (
+	minDeltaBlockSize = 64
+	maxDeltaBlockSize = 1 << 20
+
+	// The block size chosen for a file when none is set, which is the square
+	// root of its size, is within these limits.
+	minAutoDeltaBlockSize = 1 << 10
+	maxAutoDeltaBlockSize = 1 << 16
+)
+
+// defaultDeltaMaxSize is the default value of DeltaParams.MaxSize.
+const defaultDeltaMaxSize = 64 << 20
+
+// deltaStrongLen is the number of bytes of the SHA-256 hash of each block
+// included in a signature.
+const deltaStrongLen = 16
+
+var (
+	// DeltaDisabledErr is returned by the Delta service while delta sync is
+	// not enabled.
+	DeltaDisabledErr = errors.New("delta sync is not enabled")
+
+	// DeltaBaseErr is returned when applying a delta to a file that changed
+	// since the signature it was computed from.
+	DeltaBaseErr = errors.New("file changed since its signature")
+
+	// InvalidDeltaErr is returned when a delta refers to blocks that do not
+	// exist or reconstructs a file that is too large.
+	InvalidDeltaErr = errors.New("invalid delta")
+
+	// DeltaHashErr is returned when the data reconstructed from a delta does
+	// not match the hash given with it.
+	DeltaHashErr = errors.New("reconstructed data does not match its hash")
+)
+
+// DeltaParams are the parameters of delta sync.
+type DeltaParams struct {
+	// BlockSize is the block size of signatures in bytes when the client does
+	// not choose one. Defaults to the square root of the file size, between
+	// 1 KiB and 64 KiB.
+	BlockSize int `mapstructure:"blockSize"`
+
+	// MaxSize is the maximum size of a file reconstructed from a delta in
+	// bytes. Defaults to 64 MiB.
+	MaxSize int64 `mapstructure:"maxSize"`
+}
+
+// DeltaSignature is the signature of a file, from which a client computes the
+// delta from the file to its new data.
+type DeltaSignature struct {
+	BlockSize int
+	Size      int64
+	SHA256    []byte
+	Blocks    []DeltaBlock
+}
+
+// DeltaBlock contains the checksums of a block of a file: the rsync rolling
+// checksum and the start of its SHA-256 hash.
+type DeltaBlock struct {
+	Weak   uint32
+	Strong []byte
+}
+
+// DeltaOp is an operation of a delta that appends to the new data: Data if it
+// is not empty, or otherwise Count blocks of the file starting at Block.
+type DeltaOp struct {
+	Block int
+	Count int
+	Data  []byte
+}
+
+// Delta computes signatures of stored files and reconstructs files from the
+// deltas that clients compute from them, so that a large file that mostly did
+// not change is updated without uploading all of it.
+type Delta struct {
+	params DeltaParams
+}
+
+// NewDelta creates a new Delta from the parameters. Returns an error if the
+// block size is out of range or the maximum size is not positive.
+func NewDelta(params map[string]interface{}) (*Delta, error) {
+	p := DeltaParams{MaxSize: defaultDeltaMaxSize}
+	if err := decodeParams(params, &p, "delta"); err != nil {
+		return nil, err
+	}
+
+	if p.BlockSize != 0 && (p.BlockSize < minDeltaBlockSize ||
+		p.BlockSize > maxDeltaBlockSize) {
+		return nil, errors.Errorf("delta blockSize %d must be %d to %d",
+			p.BlockSize, minDeltaBlockSize, maxDeltaBlockSize)
+	} else if p.MaxSize <= 0 {
+		return nil, errors.Errorf(
+			"delta maxSize %d must be positive", p.MaxSize)
+	}
+
+	return &Delta{params: p}, nil
+}
+
+// Params returns the parameters of delta sync.
+func (d *Delta) Params() DeltaParams {
+	return d.params
+}
+
+// Signature returns the signature of the data with the block size, or the
+// configured or automatic block size if it is zero. Returns [InvalidDeltaErr]
+// if the block size is out of range.
+func (d *Delta) Signature(data []byte, blockSize int) (DeltaSignature, error) {
+	if blockSize == 0 {
+		blockSize = d.blockSize(len(data))
+	} else if blockSize < minDeltaBlockSize || blockSize > maxDeltaBlockSize {
+		return DeltaSignature{}, errors.Wrapf(InvalidDeltaErr,
+			"block size %d must be %d to %d", blockSize, minDeltaBlockSize,
+			maxDeltaBlockSize)
+	}
+
+	hash := sha256.Sum256(data)
+	sig := DeltaSignature{
+		BlockSize: blockSize,
+		Size:      int64(len(data)),
+		SHA256:    hash[:],
+		Blocks:    make([]DeltaBlock, 0, (len(data)+blockSize-1)/blockSize),
+	}
+	for start := 0; start < len(data); start += blockSize {
+		end := start + blockSize
+		if end > len(data) {
+			end = len(data)
+		}
+		block := data[start:end]
+		sig.Blocks = append(sig.Blocks, DeltaBlock{
+			Weak:   newRollingChecksum(block).sum(),
+			Strong: strongChecksum(block),
+		})
+	}
+
+	return sig, nil
+}
+
+// Apply returns the data reconstructed from the base data the delta was
+// computed from and the operations of the delta. Returns [InvalidDeltaErr] if
+// an operation refers to blocks that do not exist or the data exceeds the
+// maximum size.
+func (d *Delta) Apply(
+	base []byte, blockSize int, ops []DeltaOp) ([]byte, error) {
+	if blockSize < minDeltaBlockSize || blockSize > maxDeltaBlockSize {
+		return nil, errors.Wrapf(InvalidDeltaErr,
+			"block size %d must be %d to %d", blockSize, minDeltaBlockSize,
+			maxDeltaBlockSize)
+	}
+	numBlocks := (len(base) + blockSize - 1) / blockSize
+
+	var data []byte
+	for i, op := range ops {
+		var add []byte
+		if len(op.Data) > 0 {
+			add = op.Data
+		} else if op.Count <= 0 || op.Block < 0 || op.Block >= numBlocks ||
+			op.Count > numBlocks-op.Block {
+			return nil, errors.Wrapf(InvalidDeltaErr, "operation %d copies "+
+				"%d blocks at %d of %d", i, op.Count, op.Block, numBlocks)
+		} else {
+			start, end := op.Block*blockSize, (op.Block+op.Count)*blockSize
+			if end > len(base) {
+				end = len(base)
+			}
+			add = base[start:end]
+		}
+
+		if int64(len(data))+int64(len(add)) > d.params.MaxSize {
+			return nil, errors.Wrapf(InvalidDeltaErr,
+				"data exceeds %d bytes", d.params.MaxSize)
+		}
+		data = append(data, add...)
+	}
+
+	return data, nil
+}
+
+// blockSize returns the configured block size or, if not set, the square root
+// of the size within the automatic range.
+func (d *Delta) blockSize(size int) int {
+	if d.params.BlockSize != 0 {
+		return d.params.BlockSize
+	}
+	blockSize := int(math.Sqrt(float64(size)))
+	if blockSize < minAutoDeltaBlockSize {
+		return minAutoDeltaBlockSize
+	} else if blockSize > maxAutoDeltaBlockSize {
+		return maxAutoDeltaBlockSize
+	}
+	return blockSize
+}
+
+// ComputeDelta returns the operations that reconstruct the data from the file
+// with the signature. Blocks of the file are found anywhere in the data using
+// the rolling checksum, as by rsync. It is what clients of the Delta service
+// do and is used in tests.
+func ComputeDelta(sig DeltaSignature, data []byte) []DeltaOp {
+	bs := sig.BlockSize
+	index := make(map[uint32][]int, len(sig.Blocks))
+	for i, b := range sig.Blocks {
+		index[b.Weak] = append(index[b.Weak], i)
+	}
+
+	var ops []DeltaOp
+	literal := 0
+	addCopy := func(start, block int) {
+		if literal < start {
+			ops = append(ops, DeltaOp{Data: data[literal:start]})
+		}
+		if n := len(ops); n > 0 && len(ops[n-1].Data) == 0 &&
+			ops[n-1].Block+ops[n-1].Count == block {
+			ops[n-1].Count++
+		} else {
+			ops = append(ops, DeltaOp{Block: block, Count: 1})
+		}
+	}
+	match := func(start, end int, weak uint32) (int, bool) {
+		var strong []byte
+		for _, b := range index[weak] {
+			size := int(sig.Size) - b*bs
+			if size > bs {
+				size = bs
+			}
+			if size != end-start {
+				continue
+			}
+			if strong == nil {
+				strong = strongChecksum(data[start:end])
+			}
+			if bytes.Equal(strong, sig.Blocks[b].Strong) {
+				return b, true
+			}
+		}
+		return 0, false
+	}
+
+	// Full blocks are matched at every offset by rolling the checksum
+	i := 0
+	for i+bs <= len(data) {
+		rc := newRollingChecksum(data[i : i+bs])
+		for {
+			if b, ok := match(i, i+bs, rc.sum()); ok {
+				addCopy(i, b)
+				i += bs
+				literal = i
+				break
+			}
+			if i+bs >= len(data) {
+				i++
+				break
+			}
+			rc.roll(data[i], data[i+bs])
+			i++
+		}
+	}
+
+	// A shorter last block can only match the end of the data
+	if last := int(sig.Size) % bs; last != 0 && len(data)-last >= literal {
+		start := len(data) - last
+		weak := newRollingChecksum(data[start:]).sum()
+		if b, ok := match(start, len(data), weak); ok {
+			addCopy(start, b)
+			literal = len(data)
+		}
+	}
+	if literal < len(data) {
+		ops = append(ops, DeltaOp{Data: data[literal:]})
+	}
+
+	return ops
+}
+
+// rollingChecksum is the rsync rolling checksum of a window of data, which can
+// be moved forward by one byte in constant time.
+type rollingChecksum struct {
+	a, b uint32
+	n    uint32
+}
+
+// newRollingChecksum returns the rolling checksum of the window.
+func newRollingChecksum(window []byte) *rollingChecksum {
+	rc := &rollingChecksum{n: uint32(len(window))}
+	for i, x := range window {
+		rc.a += uint32(x)
+		rc.b += uint32(len(window)-i) * uint32(x)
+	}
+	return rc
+}
+
+// roll moves the window forward by one byte, removing out and adding in.
+func (rc *rollingChecksum) roll(out, in byte) {
+	rc.a += uint32(in) - uint32(out)
+	rc.b += rc.a - rc.n*uint32(out)
+}
+
+// sum returns the checksum of the window.
+func (rc *rollingChecksum) sum() uint32 {
+	return rc.a&0xffff | rc.b<<16
+}
+
+// strongChecksum returns the start of the SHA-256 hash of the block.
+func strongChecksum(block []byte) []byte {
+	hash := sha256.Sum256(block)
+	return hash[:deltaStrongLen]
+}
@@ -0,0 +1,138 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package server
+
+import (
+	"bytes"
+	"errors"
+	"math/rand"
+	"testing"
+)
+
+// newTestDelta returns a Delta with the parameters.
+func newTestDelta(params map[string]interface{}, t *testing.T) *Delta {
+	d, err := NewDelta(params)
+	if err != nil {
+		t.Fatalf("Failed to create delta: %+v", err)
+	}
+	return d
+}
+
+// Tests that data is reconstructed by Delta.Apply from the delta computed by
+// ComputeDelta from the signature of the base data, and that only the changed
+// data is sent as literals.
+func TestDelta_Apply_ComputeDelta(t *testing.T) {
+	d := newTestDelta(map[string]interface{}{"blockSize": 64}, t)
+	prng := rand.New(rand.NewSource(4410))
+	base := make([]byte, 64*100+17)
+	prng.Read(base)
+
+	inserted := make([]byte, 300)
+	prng.Read(inserted)
+	insert := append(append([]byte{}, base[:1000]...), inserted...)
+	tests := map[string][]byte{
+		"unchanged": base,
+		"insert":    append(insert, base[1000:]...),
+		"delete":    append(append([]byte{}, base[:2000]...), base[2500:]...),
+		"append":    append(append([]byte{}, base...), inserted...),
+		"truncate":  base[:3000],
+		"replaced":  inserted,
+		"empty":     {},
+	}
+	for name, data := range tests {
+		sig, err := d.Signature(base, 0)
+		if err != nil {
+			t.Fatalf("Failed to get signature: %+v", err)
+		}
+		ops := ComputeDelta(sig, data)
+
+		var literal int
+		for _, op := range ops {
+			literal += len(op.Data)
+		}
+		if name != "replaced" && literal > 2*len(inserted)+2*64 {
+			t.Errorf("Delta for %s sends %d literal bytes.", name, literal)
+		}
+
+		applied, err := d.Apply(base, sig.BlockSize, ops)
+		if err != nil {
+			t.Errorf("Failed to apply delta for %s: %+v", name, err)
+		} else if !bytes.Equal(applied, data) {
+			t.Errorf("Delta for %s did not reconstruct the data.", name)
+		}
+	}
+}
+
+// Tests that Delta.Signature uses the configured block size or one chosen from
+// the size of the data, and that its checksums match the rolling checksum.
+func TestDelta_Signature(t *testing.T) {
+	data := bytes.Repeat([]byte("0123456789"), 1000)
+	sig, err := newTestDelta(nil, t).Signature(data, 0)
+	if err != nil {
+		t.Fatalf("Failed to get signature: %+v", err)
+	} else if sig.BlockSize != minAutoDeltaBlockSize {
+		t.Errorf("Unexpected block size.\nexpected: %d\nreceived: %d",
+			minAutoDeltaBlockSize, sig.BlockSize)
+	} else if len(sig.Blocks) != 10 || sig.Size != int64(len(data)) {
+		t.Errorf("Unexpected signature of %d blocks of %d bytes.",
+			len(sig.Blocks), sig.Size)
+	}
+
+	// Rolling the checksum from the first block to the second matches the
+	// checksum of the second block
+	sig, _ = newTestDelta(nil, t).Signature(data, 100)
+	rc := newRollingChecksum(data[:100])
+	for i := 0; i < 100; i++ {
+		rc.roll(data[i], data[i+100])
+	}
+	if rc.sum() != sig.Blocks[1].Weak {
+		t.Errorf("Unexpected rolling checksum.\nexpected: %08x\nreceived: %08x",
+			sig.Blocks[1].Weak, rc.sum())
+	}
+
+	if _, err = newTestDelta(nil, t).Signature(data, 8); !errors.Is(
+		err, InvalidDeltaErr) {
+		t.Errorf("Unexpected error for small block size."+
+			"\nexpected: %v\nreceived: %+v", InvalidDeltaErr, err)
+	}
+}
+
+// Error path: Tests that Delta.Apply rejects operations that copy blocks that
+// do not exist and data over the maximum size.
+func TestDelta_Apply_InvalidDeltaErr(t *testing.T) {
+	d := newTestDelta(map[string]interface{}{"maxSize": 200}, t)
+	base := make([]byte, 150)
+	tests := map[string][]DeltaOp{
+		"block out of range": {{Block: 3, Count: 1}},
+		"count out of range": {{Block: 1, Count: 3}},
+		"zero count":         {{Block: 0}},
+		"negative block":     {{Block: -1, Count: 1}},
+		"too large":          {{Block: 0, Count: 3}, {Block: 0, Count: 1}},
+	}
+	for name, ops := range tests {
+		if _, err := d.Apply(base, 64, ops); !errors.Is(err, InvalidDeltaErr) {
+			t.Errorf("Unexpected error for %s.\nexpected: %v\nreceived: %+v",
+				name, InvalidDeltaErr, err)
+		}
+	}
+}
+
+// Error path: Tests that NewDelta returns an error for invalid parameters.
+func TestNewDelta_Error(t *testing.T) {
+	tests := map[string]map[string]interface{}{
+		"small blockSize":  {"blockSize": 8},
+		"large blockSize":  {"blockSize": 1 << 21},
+		"negative maxSize": {"maxSize": -1},
+		"unknown key":      {"strongLen": 8},
+	}
+	for name, params := range tests {
+		if _, err := NewDelta(params); err == nil {
+			t.Errorf("Failed to get error for %s.", name)
+		}
+	}
+}
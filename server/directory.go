@@ -0,0 +1,112 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package server
+
+import (
+	"encoding/base64"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"gitlab.com/elixxir/remoteSyncServer/rpc"
+)
+
+// Page sizes of directory listings.
+const (
+	// defaultListPageSize is the number of entries listed when the client
+	// does not choose a page size.
+	defaultListPageSize = 1000
+
+	// maxListPageSize is the largest number of entries listed in one page.
+	// Larger page sizes are lowered to it.
+	maxListPageSize = 10000
+)
+
+// InvalidListRequestErr is returned when listing a directory with a negative
+// page size, an unknown sort order, or a page token that was not returned by
+// the server.
+var InvalidListRequestErr = errors.New("invalid directory listing request")
+
+// listPage returns the page of the sorted entries whose names start with the
+// prefix in the order and the token of the next page, which is empty on the
+// last page. The page token holds the name of the last entry of the previous
+// page, so that the next page starts after it even if entries are added or
+// removed between pages. Returns [InvalidListRequestErr] for an invalid page
+// size, order, or page token.
+func listPage(entries []string, prefix string, pageSize int32,
+	pageToken string, order rpc.RsSortOrder) ([]string, string, error) {
+	if pageSize < 0 {
+		return nil, "", errors.Wrapf(InvalidListRequestErr,
+			"page size %d cannot be negative", pageSize)
+	} else if pageSize == 0 {
+		pageSize = defaultListPageSize
+	} else if pageSize > maxListPageSize {
+		pageSize = maxListPageSize
+	}
+	if order != rpc.RsSortOrder_ASCENDING &&
+		order != rpc.RsSortOrder_DESCENDING {
+		return nil, "", errors.Wrapf(
+			InvalidListRequestErr, "unknown sort order %d", order)
+	}
+
+	// Only entries after the last entry of the previous page are listed
+	var after string
+	if pageToken != "" {
+		b, err := base64.RawURLEncoding.DecodeString(pageToken)
+		if err != nil || len(b) == 0 {
+			return nil, "", errors.Wrapf(
+				InvalidListRequestErr, "invalid page token %q", pageToken)
+		}
+		after = string(b)
+	}
+
+	// The entries with the prefix are a contiguous run of the sorted entries
+	start := sort.SearchStrings(entries, prefix)
+	end := start
+	for end < len(entries) && strings.HasPrefix(entries[end], prefix) {
+		end++
+	}
+	matched := entries[start:end]
+
+	var page []string
+	if order == rpc.RsSortOrder_ASCENDING {
+		i := 0
+		if after != "" {
+			i = sort.Search(len(matched), func(i int) bool {
+				return matched[i] > after
+			})
+		}
+		for ; i < len(matched) && len(page) < int(pageSize); i++ {
+			page = append(page, matched[i])
+		}
+	} else {
+		i := len(matched) - 1
+		if after != "" {
+			i = sort.SearchStrings(matched, after) - 1
+		}
+		for ; i >= 0 && len(page) < int(pageSize); i-- {
+			page = append(page, matched[i])
+		}
+	}
+
+	// There is a next page if this page is full and entries remain after it
+	var next string
+	if len(page) == int(pageSize) {
+		last := matched[len(matched)-1]
+		if order == rpc.RsSortOrder_DESCENDING {
+			last = matched[0]
+		}
+		if page[len(page)-1] != last {
+			next = base64.RawURLEncoding.EncodeToString(
+				[]byte(page[len(page)-1]))
+		}
+	}
+
+	return page, next, nil
+}
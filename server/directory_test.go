@@ -0,0 +1,99 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package server
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"gitlab.com/elixxir/remoteSyncServer/rpc"
+)
+
+// Tests that listPage lists the entries with the prefix in pages, in both
+// orders, and that following the page tokens lists each entry once.
+func Test_listPage(t *testing.T) {
+	entries := []string{"a", "b1", "b2", "b3", "b4", "b5", "c"}
+	tests := []struct {
+		prefix   string
+		pageSize int32
+		order    rpc.RsSortOrder
+		expected [][]string
+	}{
+		{"b", 2, rpc.RsSortOrder_ASCENDING,
+			[][]string{{"b1", "b2"}, {"b3", "b4"}, {"b5"}}},
+		{"b", 2, rpc.RsSortOrder_DESCENDING,
+			[][]string{{"b5", "b4"}, {"b3", "b2"}, {"b1"}}},
+		{"", 7, rpc.RsSortOrder_ASCENDING, [][]string{entries}},
+		{"", 0, rpc.RsSortOrder_DESCENDING, [][]string{
+			{"c", "b5", "b4", "b3", "b2", "b1", "a"}}},
+		{"b", 5, rpc.RsSortOrder_ASCENDING,
+			[][]string{{"b1", "b2", "b3", "b4", "b5"}}},
+		{"d", 2, rpc.RsSortOrder_ASCENDING, [][]string{nil}},
+		{"0", 2, rpc.RsSortOrder_DESCENDING, [][]string{nil}},
+	}
+	for _, tt := range tests {
+		var pages [][]string
+		var token string
+		for {
+			page, next, err := listPage(
+				entries, tt.prefix, tt.pageSize, token, tt.order)
+			if err != nil {
+				t.Fatalf("Failed to list %q: %+v", tt.prefix, err)
+			}
+			pages = append(pages, page)
+			if next == "" || len(pages) > len(entries) {
+				break
+			}
+			token = next
+		}
+		if !reflect.DeepEqual(pages, tt.expected) {
+			t.Errorf("Unexpected pages for %q in %s order of %d."+
+				"\nexpected: %q\nreceived: %q",
+				tt.prefix, tt.order, tt.pageSize, tt.expected, pages)
+		}
+	}
+}
+
+// Tests that listPage continues after the last entry of the previous page when
+// entries are removed or added between pages.
+func Test_listPage_Changed(t *testing.T) {
+	_, next, _ := listPage([]string{"a", "b", "c", "d"}, "", 2, "",
+		rpc.RsSortOrder_ASCENDING)
+
+	page, _, err := listPage([]string{"a", "ab", "c", "d"}, "", 2, next,
+		rpc.RsSortOrder_ASCENDING)
+	if err != nil {
+		t.Fatalf("Failed to list next page: %+v", err)
+	} else if !reflect.DeepEqual(page, []string{"c", "d"}) {
+		t.Errorf("Unexpected next page.\nexpected: %q\nreceived: %q",
+			[]string{"c", "d"}, page)
+	}
+}
+
+// Error path: Tests that listPage returns InvalidListRequestErr for a negative
+// page size, an unknown sort order, and an invalid page token.
+func Test_listPage_InvalidListRequestError(t *testing.T) {
+	tests := map[string]struct {
+		pageSize  int32
+		pageToken string
+		order     rpc.RsSortOrder
+	}{
+		"negative page size": {-1, "", rpc.RsSortOrder_ASCENDING},
+		"unknown order":      {1, "", 2},
+		"invalid page token": {1, "not base64!", rpc.RsSortOrder_ASCENDING},
+	}
+	for name, tt := range tests {
+		_, _, err := listPage(
+			[]string{"a"}, "", tt.pageSize, tt.pageToken, tt.order)
+		if !errors.Is(err, InvalidListRequestErr) {
+			t.Errorf("Unexpected error for %s.\nexpected: %v\nreceived: %+v",
+				name, InvalidListRequestErr, err)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package server
+
+import (
+	"io"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// maxDownloadChunkSize is the default and largest size of the chunks of a
+// download, so that each message is well below the default maximum message
+// size of gRPC clients.
+const maxDownloadChunkSize = 1 << 20
+
+// copyBufferSize is the size of the buffers that files are copied to HTTP
+// responses through when the response cannot read them itself.
+const copyBufferSize = 32 * 1024
+
+var (
+	// InvalidDownloadErr is returned for a download with a negative chunk size
+	// or an offset outside the file.
+	InvalidDownloadErr = errors.New("invalid download")
+
+	// DownloadChangedErr is returned when the file is changed while it is
+	// downloaded, so the chunks sent may be from different versions of it.
+	DownloadChangedErr = errors.New("file changed during download")
+)
+
+// chunkBuffers and copyBuffers pool the buffers that files are downloaded
+// through, so that concurrent downloads of large files do not each allocate
+// them.
+var (
+	chunkBuffers = sync.Pool{New: func() interface{} {
+		buf := make([]byte, maxDownloadChunkSize)
+		return &buf
+	}}
+	copyBuffers = sync.Pool{New: func() interface{} {
+		buf := make([]byte, copyBufferSize)
+		return &buf
+	}}
+)
+
+// downloadChunkSize returns the size of the chunks of a download for the
+// requested size: the maximum if it is zero or larger. Returns
+// [InvalidDownloadErr] if it is negative.
+func downloadChunkSize(requested int64) (int, error) {
+	if requested < 0 {
+		return 0, errors.Wrapf(
+			InvalidDownloadErr, "chunk size %d is negative", requested)
+	} else if requested == 0 || requested > maxDownloadChunkSize {
+		return maxDownloadChunkSize, nil
+	}
+	return int(requested), nil
+}
+
+// skip advances the reader past the offset, by seeking if it can.
+func skip(r io.Reader, offset int64) error {
+	if offset == 0 {
+		return nil
+	} else if seeker, ok := r.(io.Seeker); ok {
+		_, err := seeker.Seek(offset, io.SeekStart)
+		return errors.Wrap(err, "failed to seek to offset")
+	}
+	_, err := io.CopyN(io.Discard, r, offset)
+	return errors.Wrap(err, "failed to skip to offset")
+}
+
+// copyFile copies the file read from r to w. If w reads from r itself, as an
+// HTTP response over plain TCP does with sendfile for a file of the local
+// filesystem, the data is not copied through the server's memory; otherwise,
+// it is copied through a pooled buffer.
+func copyFile(w io.Writer, r io.Reader) (int64, error) {
+	buf := copyBuffers.Get().(*[]byte)
+	defer copyBuffers.Put(buf)
+	return io.CopyBuffer(w, r, *buf)
+}
@@ -0,0 +1,249 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package server
+
+import (
+	"bytes"
+	"context"
+	"math/rand"
+	"net/http"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"google.golang.org/protobuf/proto"
+
+	pb "gitlab.com/elixxir/comms/mixmessages"
+	"gitlab.com/elixxir/remoteSyncServer/rpc"
+	"gitlab.com/elixxir/remoteSyncServer/store"
+)
+
+// download downloads the file with the handler and returns the chunks sent.
+func download(h *handler, msg *rpc.RsDownloadRequest) (
+	[]*rpc.RsDownloadChunk, error) {
+	var chunks []*rpc.RsDownloadChunk
+	err := h.Download(context.Background(), msg,
+		func(chunk *rpc.RsDownloadChunk) error {
+			// The buffer of the data is reused for the next chunk
+			chunks = append(chunks, proto.Clone(chunk).(*rpc.RsDownloadChunk))
+			return nil
+		})
+	return chunks, err
+}
+
+// Tests that handler.Download sends a file in chunks of the requested size,
+// starting at the offset, and an empty file as a single chunk.
+func Test_handler_Download(t *testing.T) {
+	h, token := newHandlerLogin(
+		time.Hour, "waldo", "hunter2", rand.New(rand.NewSource(87)), t)
+	contents := []byte("0123456789")
+	for path, data := range map[string][]byte{"file": contents, "empty": {}} {
+		_, err := h.Write(context.Background(), &pb.RsWriteRequest{
+			Path: path, Data: data, Token: token.Marshal()})
+		if err != nil {
+			t.Fatalf("Failed to write %s: %+v", path, err)
+		}
+	}
+
+	tests := []struct {
+		path              string
+		offset, chunkSize int64
+		offsets           []int64
+	}{
+		{"file", 0, 4, []int64{0, 4, 8}},
+		{"file", 3, 0, []int64{3}},
+		{"file", 2, 4, []int64{2, 6}},
+		{"file", 10, 4, []int64{10}},
+		{"empty", 0, 4, []int64{0}},
+	}
+	for _, tt := range tests {
+		chunks, err := download(h, &rpc.RsDownloadRequest{
+			Token: token.Marshal(), Path: tt.path, Offset: tt.offset,
+			ChunkSize: tt.chunkSize})
+		if err != nil {
+			t.Errorf("Failed to download %s from %d: %+v",
+				tt.path, tt.offset, err)
+			continue
+		}
+
+		var data []byte
+		offsets := make([]int64, len(chunks))
+		for i, chunk := range chunks {
+			offsets[i] = chunk.GetOffset()
+			data = append(data, chunk.GetData()...)
+		}
+		expected := contents[tt.offset:]
+		if tt.path == "empty" {
+			expected = nil
+		}
+		if !bytes.Equal(data, expected) ||
+			!reflect.DeepEqual(offsets, tt.offsets) {
+			t.Errorf("Unexpected download of %s from %d with chunks of %d."+
+				"\nexpected: %q at %v\nreceived: %q at %v", tt.path,
+				tt.offset, tt.chunkSize, expected, tt.offsets, data, offsets)
+		}
+	}
+}
+
+// Error path: Tests that handler.Download returns DownloadChangedErr when the
+// file is written while it is downloaded.
+func Test_handler_Download_DownloadChangedError(t *testing.T) {
+	h, token := newHandlerLogin(
+		time.Hour, "waldo", "hunter2", rand.New(rand.NewSource(87)), t)
+	write := func(data string) {
+		_, err := h.Write(context.Background(), &pb.RsWriteRequest{
+			Path: "file", Data: []byte(data), Token: token.Marshal()})
+		if err != nil {
+			t.Fatalf("Failed to write file: %+v", err)
+		}
+	}
+	write("0123456789")
+
+	err := h.Download(context.Background(), &rpc.RsDownloadRequest{
+		Token: token.Marshal(), Path: "file", ChunkSize: 4},
+		func(*rpc.RsDownloadChunk) error {
+			write("changed")
+			return nil
+		})
+	if !errors.Is(err, DownloadChangedErr) {
+		t.Errorf("Unexpected error for changed file.\nexpected: %v"+
+			"\nreceived: %+v", DownloadChangedErr, err)
+	}
+}
+
+// Error path: Tests that handler.Download returns an error for a file that
+// does not exist, an offset outside the file, and a negative chunk size.
+func Test_handler_Download_Error(t *testing.T) {
+	h, token := newHandlerLogin(
+		time.Hour, "waldo", "hunter2", rand.New(rand.NewSource(87)), t)
+	_, _ = h.Write(context.Background(), &pb.RsWriteRequest{
+		Path: "file", Data: []byte("data"), Token: token.Marshal()})
+
+	tests := []struct {
+		msg      *rpc.RsDownloadRequest
+		expected error
+	}{
+		{&rpc.RsDownloadRequest{Path: "missing"}, os.ErrNotExist},
+		{&rpc.RsDownloadRequest{Path: "file", Offset: 5}, InvalidDownloadErr},
+		{&rpc.RsDownloadRequest{Path: "file", Offset: -1}, InvalidDownloadErr},
+		{&rpc.RsDownloadRequest{Path: "file", ChunkSize: -1},
+			InvalidDownloadErr},
+	}
+	for _, tt := range tests {
+		tt.msg.Token = token.Marshal()
+		if _, err := download(h, tt.msg); !errors.Is(err, tt.expected) {
+			t.Errorf("Unexpected error for %v.\nexpected: %v\nreceived: %+v",
+				tt.msg, tt.expected, err)
+		}
+	}
+}
+
+// benchmarkFileSize is the size of the file served by benchmarks.
+const benchmarkFileSize = 8 << 20
+
+// benchmarkStores are the stores that benchmarks serve files from: the local
+// filesystem, which streams files, and the local filesystem without
+// store.Opener, whose files are read into memory like those of stores that
+// transform their data.
+var benchmarkStores = []struct {
+	name      string
+	streaming bool
+}{{"Open", true}, {"Read", false}}
+
+// newBenchmarkStore returns a NewStore that creates stores of the local
+// filesystem in a temporary directory, in which waldo has a large file at
+// "large". The stores do not implement store.Opener unless streaming is true.
+func newBenchmarkStore(b *testing.B, streaming bool) store.NewStore {
+	dir := b.TempDir()
+	newStore := func(_, baseDir string) (store.Store, error) {
+		s, err := store.NewFileStore(dir, baseDir)
+		if err != nil || streaming {
+			return s, err
+		}
+		return &readingStore{s}, nil
+	}
+
+	s, err := newStore("", "waldo")
+	if err != nil {
+		b.Fatalf("Failed to create store: %+v", err)
+	}
+	if err = s.Write("large", make([]byte, benchmarkFileSize)); err != nil {
+		b.Fatalf("Failed to write file: %+v", err)
+	}
+	return newStore
+}
+
+// readingStore is a store without store.Opener, whose files are read into
+// memory.
+type readingStore struct {
+	store.Store
+}
+
+// ListFiles returns the paths of all files in the underlying store.
+func (rs *readingStore) ListFiles() ([]string, error) {
+	return rs.Store.(store.Lister).ListFiles()
+}
+
+// discardResponseWriter is an http.ResponseWriter that records the status code
+// and discards the body.
+type discardResponseWriter struct {
+	header http.Header
+	code   int
+}
+
+// newDiscardResponseWriter returns an empty discardResponseWriter.
+func newDiscardResponseWriter() *discardResponseWriter {
+	return &discardResponseWriter{header: make(http.Header)}
+}
+
+// Header returns the headers of the response.
+func (w *discardResponseWriter) Header() http.Header {
+	return w.header
+}
+
+// Write discards the data.
+func (w *discardResponseWriter) Write(data []byte) (int, error) {
+	if w.code == 0 {
+		w.code = http.StatusOK
+	}
+	return len(data), nil
+}
+
+// WriteHeader records the status code.
+func (w *discardResponseWriter) WriteHeader(code int) {
+	if w.code == 0 {
+		w.code = code
+	}
+}
+
+// Benchmarks handler.Download of a large file of the local filesystem by
+// streaming it and by reading it into memory.
+func Benchmark_handler_Download(b *testing.B) {
+	for _, bs := range benchmarkStores {
+		b.Run(bs.name, func(b *testing.B) {
+			h, token, _ := newHandlerStoreLogin(time.Hour, "waldo", "hunter2",
+				rand.New(rand.NewSource(96)),
+				newBenchmarkStore(b, bs.streaming), b)
+			msg := &rpc.RsDownloadRequest{
+				Token: token.Marshal(), Path: "large"}
+			send := func(*rpc.RsDownloadChunk) error { return nil }
+
+			b.ReportAllocs()
+			b.SetBytes(benchmarkFileSize)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				err := h.Download(context.Background(), msg, send)
+				if err != nil {
+					b.Fatalf("Failed to download: %+v", err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,1423 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+// Contains the gRPC endpoints served by the remote sync server.
+
+package server
+
+import (
+	"bufio"
+	"context"
+	"crypto/subtle"
+	"crypto/x509"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	jww "github.com/spf13/jwalterweatherman"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	pb "gitlab.com/elixxir/comms/mixmessages"
+	"gitlab.com/elixxir/remoteSyncServer/credentials"
+	"gitlab.com/elixxir/remoteSyncServer/rpc"
+	"gitlab.com/elixxir/remoteSyncServer/store"
+	"gitlab.com/xx_network/comms/messages"
+)
+
+// Metadata used to authorize admin requests.
+const (
+	authorizationMetadataKey = "authorization"
+	bearerPrefix             = "Bearer "
+)
+
+// remoteSyncEndpoints implements the RemoteSync gRPC service defined in the
+// comms library using the handler.
+type remoteSyncEndpoints struct {
+	pb.UnimplementedRemoteSyncServer
+	h *handler
+}
+
+// Login to the server, receiving a token.
+func (e *remoteSyncEndpoints) Login(_ context.Context,
+	msg *pb.RsAuthenticationRequest) (*pb.RsAuthenticationResponse, error) {
+	resp, err := e.h.Login(msg)
+	if err != nil {
+		return nil, loginStatus(err)
+	}
+	return resp, nil
+}
+
+// Read data from the server.
+func (e *remoteSyncEndpoints) Read(
+	ctx context.Context, msg *pb.RsReadRequest) (*pb.RsReadResponse, error) {
+	return e.h.Read(ctx, msg)
+}
+
+// Write data to the server.
+func (e *remoteSyncEndpoints) Write(
+	ctx context.Context, msg *pb.RsWriteRequest) (*messages.Ack, error) {
+	ack, err := e.h.Write(ctx, msg)
+	if errors.Is(err, ObjectTooLargeErr) || errors.Is(err, QuotaExceededErr) {
+		return nil, status.Error(codes.ResourceExhausted, err.Error())
+	}
+	return ack, err
+}
+
+// GetLastModified returns the last time a resource was modified.
+func (e *remoteSyncEndpoints) GetLastModified(ctx context.Context,
+	msg *pb.RsReadRequest) (*pb.RsTimestampResponse, error) {
+	return e.h.GetLastModified(ctx, msg)
+}
+
+// GetLastWrite returns the last time this remote sync server was modified.
+func (e *remoteSyncEndpoints) GetLastWrite(ctx context.Context,
+	msg *pb.RsLastWriteRequest) (*pb.RsTimestampResponse, error) {
+	return e.h.GetLastWrite(ctx, msg)
+}
+
+// ReadDir reads a directory from the server.
+func (e *remoteSyncEndpoints) ReadDir(
+	ctx context.Context, msg *pb.RsReadRequest) (*pb.RsReadDirResponse, error) {
+	return e.h.ReadDir(ctx, msg)
+}
+
+// sessionEndpoints implements the Session gRPC service using the handler.
+type sessionEndpoints struct {
+	rpc.UnimplementedSessionServer
+	h *handler
+}
+
+// PasswordLogin to the server with a cleartext password, receiving a token.
+func (e *sessionEndpoints) PasswordLogin(_ context.Context,
+	msg *rpc.RsPasswordLoginRequest) (*rpc.RsPasswordLoginResponse, error) {
+	resp, err := e.h.PasswordLogin(msg)
+	if err != nil {
+		return nil, loginStatus(err)
+	}
+	return resp, nil
+}
+
+// OIDCLogin to the server with an OpenID Connect ID token or authorization
+// code, receiving a token.
+func (e *sessionEndpoints) OIDCLogin(ctx context.Context,
+	msg *rpc.RsOIDCLoginRequest) (*rpc.RsOIDCLoginResponse, error) {
+	resp, err := e.h.OIDCLogin(ctx, msg)
+	if err != nil {
+		return nil, loginStatus(err)
+	}
+	return resp, nil
+}
+
+// APIKeyLogin to the server with an API key, receiving a scoped token.
+func (e *sessionEndpoints) APIKeyLogin(_ context.Context,
+	msg *rpc.RsAPIKeyLoginRequest) (*rpc.RsAPIKeyLoginResponse, error) {
+	resp, err := e.h.APIKeyLogin(msg)
+	if err != nil {
+		return nil, loginStatus(err)
+	}
+	return resp, nil
+}
+
+// RefreshToken exchanges a valid token for a new token.
+func (e *sessionEndpoints) RefreshToken(_ context.Context,
+	msg *rpc.RsRefreshTokenRequest) (*rpc.RsRefreshTokenResponse, error) {
+	return e.h.RefreshToken(msg)
+}
+
+// loginStatus converts a login error into a gRPC status error with the
+// matching code. Other errors are returned unchanged, as for the RemoteSync
+// service.
+func loginStatus(err error) error {
+	if errors.Is(err, MigratedErr) {
+		return status.Error(codes.FailedPrecondition, err.Error())
+	} else if errors.Is(err, BannedErr) {
+		return status.Error(codes.PermissionDenied, err.Error())
+	}
+	return err
+}
+
+// historyEndpoints implements the History gRPC service using the handler.
+type historyEndpoints struct {
+	rpc.UnimplementedHistoryServer
+	h *handler
+}
+
+// ListVersions lists the previous versions of a file.
+func (e *historyEndpoints) ListVersions(_ context.Context,
+	msg *rpc.RsListVersionsRequest) (*rpc.RsListVersionsResponse, error) {
+	resp, err := e.h.ListVersions(msg)
+	if err != nil {
+		return nil, historyStatus(err)
+	}
+	return resp, nil
+}
+
+// ReadVersion reads a previous version of a file.
+func (e *historyEndpoints) ReadVersion(_ context.Context,
+	msg *rpc.RsReadVersionRequest) (*rpc.RsReadVersionResponse, error) {
+	resp, err := e.h.ReadVersion(msg)
+	if err != nil {
+		return nil, historyStatus(err)
+	}
+	return resp, nil
+}
+
+// historyStatus converts a history error into a gRPC status error with the
+// matching code. Other errors are returned unchanged, as for the RemoteSync
+// service.
+func historyStatus(err error) error {
+	switch {
+	case errors.Is(err, VersioningDisabledErr):
+		return status.Error(codes.Unimplemented, err.Error())
+	case errors.Is(err, os.ErrNotExist):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, store.NonLocalFileErr),
+		errors.Is(err, store.ReservedPathErr):
+		return status.Error(codes.InvalidArgument, err.Error())
+	default:
+		return err
+	}
+}
+
+// directoryEndpoints implements the Directory gRPC service using the handler.
+type directoryEndpoints struct {
+	rpc.UnimplementedDirectoryServer
+	h *handler
+}
+
+// ListDir lists a page of the entries of a directory.
+func (e *directoryEndpoints) ListDir(ctx context.Context,
+	msg *rpc.RsListDirRequest) (*rpc.RsListDirResponse, error) {
+	resp, err := e.h.ListDir(ctx, msg)
+	if err != nil {
+		return nil, directoryStatus(err)
+	}
+	return resp, nil
+}
+
+// directoryStatus converts a directory listing error into a gRPC status error
+// with the matching code. Other errors are returned unchanged, as for the
+// RemoteSync service.
+func directoryStatus(err error) error {
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, InvalidListRequestErr),
+		errors.Is(err, store.NonLocalFileErr),
+		errors.Is(err, store.ReservedPathErr):
+		return status.Error(codes.InvalidArgument, err.Error())
+	default:
+		return err
+	}
+}
+
+// transactionEndpoints implements the Transaction gRPC service using the
+// handler.
+type transactionEndpoints struct {
+	rpc.UnimplementedTransactionServer
+	h *handler
+}
+
+// Commit applies the operations of a transaction.
+func (e *transactionEndpoints) Commit(ctx context.Context,
+	msg *rpc.RsCommitRequest) (*rpc.RsCommitResponse, error) {
+	resp, err := e.h.Commit(ctx, msg)
+	if err != nil {
+		return nil, transactionStatus(err)
+	}
+	return resp, nil
+}
+
+// transactionStatus converts a transaction error into a gRPC status error with
+// the matching code. Other errors are returned unchanged, as for the
+// RemoteSync service.
+func transactionStatus(err error) error {
+	switch {
+	case errors.Is(err, RollbackErr):
+		return status.Error(codes.DataLoss, err.Error())
+	case errors.Is(err, os.ErrNotExist):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, ObjectTooLargeErr),
+		errors.Is(err, QuotaExceededErr):
+		return status.Error(codes.ResourceExhausted, err.Error())
+	case errors.Is(err, InvalidTransactionErr),
+		errors.Is(err, store.NonLocalFileErr),
+		errors.Is(err, store.ReservedPathErr):
+		return status.Error(codes.InvalidArgument, err.Error())
+	default:
+		return err
+	}
+}
+
+// conditionalEndpoints implements the Conditional gRPC service using the
+// handler.
+type conditionalEndpoints struct {
+	rpc.UnimplementedConditionalServer
+	h *handler
+}
+
+// ConditionalWrite writes a file if it has not changed.
+func (e *conditionalEndpoints) ConditionalWrite(ctx context.Context,
+	msg *rpc.RsConditionalWriteRequest) (*rpc.RsConditionalWriteResponse,
+	error) {
+	resp, err := e.h.ConditionalWrite(ctx, msg)
+	if err != nil {
+		return nil, conditionalStatus(err)
+	}
+	return resp, nil
+}
+
+// conditionalStatus converts a conditional write error into a gRPC status
+// error with the matching code. A conflict is ABORTED, as for a failed
+// test-and-set, so that the client retries the read, merge, and write. Other
+// errors are returned unchanged, as for the RemoteSync service.
+func conditionalStatus(err error) error {
+	switch {
+	case errors.Is(err, WriteConflictErr):
+		return status.Error(codes.Aborted, err.Error())
+	case errors.Is(err, ObjectTooLargeErr),
+		errors.Is(err, QuotaExceededErr):
+		return status.Error(codes.ResourceExhausted, err.Error())
+	case errors.Is(err, InvalidConditionErr),
+		errors.Is(err, store.NonLocalFileErr),
+		errors.Is(err, store.ReservedPathErr):
+		return status.Error(codes.InvalidArgument, err.Error())
+	default:
+		return err
+	}
+}
+
+// batchEndpoints implements the Batch gRPC service using the handler.
+type batchEndpoints struct {
+	rpc.UnimplementedBatchServer
+	h *handler
+}
+
+// BatchRead reads several files.
+func (e *batchEndpoints) BatchRead(ctx context.Context,
+	msg *rpc.RsBatchReadRequest) (*rpc.RsBatchReadResponse, error) {
+	resp, err := e.h.BatchRead(ctx, msg)
+	if err != nil {
+		return nil, batchStatus(err)
+	}
+	return resp, nil
+}
+
+// BatchWrite writes several files.
+func (e *batchEndpoints) BatchWrite(ctx context.Context,
+	msg *rpc.RsBatchWriteRequest) (*rpc.RsBatchWriteResponse, error) {
+	resp, err := e.h.BatchWrite(ctx, msg)
+	if err != nil {
+		return nil, batchStatus(err)
+	}
+	return resp, nil
+}
+
+// batchStatus converts a batch error into a gRPC status error with the
+// matching code. Other errors are returned unchanged, as for the RemoteSync
+// service.
+func batchStatus(err error) error {
+	switch {
+	case errors.Is(err, ObjectTooLargeErr),
+		errors.Is(err, QuotaExceededErr):
+		return status.Error(codes.ResourceExhausted, err.Error())
+	case errors.Is(err, InvalidBatchErr),
+		errors.Is(err, store.NonLocalFileErr),
+		errors.Is(err, store.ReservedPathErr):
+		return status.Error(codes.InvalidArgument, err.Error())
+	default:
+		return err
+	}
+}
+
+// replicationEndpoints implements the Replication gRPC service. Calls must be
+// authorized with the replication key.
+type replicationEndpoints struct {
+	rpc.UnimplementedReplicationServer
+	h        *handler
+	r        *Replication
+	scrubber *Scrubber
+}
+
+// Replicate applies the writes replicated from the primary.
+func (e *replicationEndpoints) Replicate(ctx context.Context,
+	msg *rpc.RsReplicateRequest) (*rpc.RsReplicateResponse, error) {
+	if err := e.authorize(ctx); err != nil {
+		return nil, err
+	}
+
+	if err := e.r.apply(e.h, msg.GetEntries()); errors.Is(err, NotStandbyErr) {
+		return nil, status.Error(codes.FailedPrecondition, err.Error())
+	} else if err != nil {
+		jww.ERROR.Printf("Failed to apply replicated writes: %+v", err)
+		return nil, transactionStatus(err)
+	}
+	return &rpc.RsReplicateResponse{}, nil
+}
+
+// Forward applies a write forwarded by a read replica.
+func (e *replicationEndpoints) Forward(ctx context.Context,
+	msg *rpc.RsForwardRequest) (*rpc.RsForwardResponse, error) {
+	if err := e.authorize(ctx); err != nil {
+		return nil, err
+	}
+
+	err := e.r.applyForwarded(e.h, msg.GetEntry())
+	if errors.Is(err, NotPrimaryErr) {
+		return nil, status.Error(codes.FailedPrecondition, err.Error())
+	} else if err != nil {
+		return nil, transactionStatus(err)
+	}
+	return &rpc.RsForwardResponse{}, nil
+}
+
+// Fetch returns the stored data of a file to repair the copy of another
+// server.
+func (e *replicationEndpoints) Fetch(ctx context.Context,
+	msg *rpc.RsFetchRequest) (*rpc.RsFetchResponse, error) {
+	if err := e.authorize(ctx); err != nil {
+		return nil, err
+	} else if e.scrubber == nil {
+		return nil, status.Error(
+			codes.FailedPrecondition, "scrubbing is not enabled")
+	}
+
+	data, err := e.scrubber.read(e.h.storageDir, msg.GetUser(), msg.GetPath())
+	switch {
+	case err == nil:
+		return &rpc.RsFetchResponse{Data: data}, nil
+	case errors.Is(err, os.ErrNotExist):
+		return nil, status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, store.CorruptedErr):
+		return nil, status.Error(codes.DataLoss, err.Error())
+	case errors.Is(err, store.NonLocalFileErr):
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	default:
+		jww.ERROR.Printf("Failed to fetch %s of %q: %+v",
+			msg.GetPath(), msg.GetUser(), err)
+		return nil, status.Error(codes.Internal, "failed to read file")
+	}
+}
+
+// authorize returns a gRPC status error if the request does not contain the
+// replication key in its authorization metadata.
+func (e *replicationEndpoints) authorize(ctx context.Context) error {
+	md, _ := metadata.FromIncomingContext(ctx)
+	for _, auth := range md.Get(authorizationMetadataKey) {
+		key := strings.TrimPrefix(auth, bearerPrefix)
+		if subtle.ConstantTimeCompare(
+			[]byte(key), []byte(e.r.params.Key)) == 1 {
+			return nil
+		}
+	}
+
+	jww.WARN.Printf("Rejected unauthorized replication request.")
+	return status.Error(codes.Unauthenticated, "invalid replication key")
+}
+
+// migrationEndpoints implements the Migration gRPC service using the handler.
+type migrationEndpoints struct {
+	rpc.UnimplementedMigrationServer
+	h *handler
+}
+
+// Export returns a page of the files of the user.
+func (e *migrationEndpoints) Export(ctx context.Context,
+	msg *rpc.RsExportRequest) (*rpc.RsExportResponse, error) {
+	resp, err := e.h.Export(ctx, msg)
+	if err != nil {
+		return nil, migrationStatus(err)
+	}
+	return resp, nil
+}
+
+// Tombstone deletes the files of the user and records where they moved.
+func (e *migrationEndpoints) Tombstone(ctx context.Context,
+	msg *rpc.RsTombstoneRequest) (*rpc.RsTombstoneResponse, error) {
+	resp, err := e.h.Tombstone(ctx, msg)
+	if err != nil {
+		return nil, migrationStatus(err)
+	}
+	return resp, nil
+}
+
+// Import copies the files of the user from another server.
+func (e *migrationEndpoints) Import(ctx context.Context,
+	msg *rpc.RsImportRequest) (*rpc.RsImportResponse, error) {
+	resp, err := e.h.Import(ctx, msg)
+	if err != nil {
+		return nil, migrationStatus(err)
+	}
+	return resp, nil
+}
+
+// migrationStatus converts an account migration error into a gRPC status
+// error with the matching code. Other errors, including the status errors of
+// source servers, are returned unchanged, as for the RemoteSync service.
+func migrationStatus(err error) error {
+	switch {
+	case errors.Is(err, MigrationDisabledErr):
+		return status.Error(codes.Unimplemented, err.Error())
+	case errors.Is(err, UnknownSourceErr):
+		return status.Error(codes.PermissionDenied, err.Error())
+	case errors.Is(err, store.NotListableErr):
+		return status.Error(codes.FailedPrecondition, err.Error())
+	case errors.Is(err, ObjectTooLargeErr),
+		errors.Is(err, QuotaExceededErr):
+		return status.Error(codes.ResourceExhausted, err.Error())
+	case errors.Is(err, InvalidMigrationRequestErr),
+		errors.Is(err, store.InvalidPathErr),
+		errors.Is(err, store.NonLocalFileErr),
+		errors.Is(err, store.ReservedPathErr):
+		return status.Error(codes.InvalidArgument, err.Error())
+	default:
+		return err
+	}
+}
+
+// uploadEndpoints implements the Upload gRPC service using the handler.
+type uploadEndpoints struct {
+	rpc.UnimplementedUploadServer
+	h *handler
+}
+
+// StartUpload starts a resumable upload of a file.
+func (e *uploadEndpoints) StartUpload(_ context.Context,
+	msg *rpc.RsStartUploadRequest) (*rpc.RsStartUploadResponse, error) {
+	resp, err := e.h.StartUpload(msg)
+	if err != nil {
+		return nil, uploadStatus(err)
+	}
+	return resp, nil
+}
+
+// UploadChunk appends a chunk of data to an upload.
+func (e *uploadEndpoints) UploadChunk(_ context.Context,
+	msg *rpc.RsUploadChunkRequest) (*rpc.RsUploadChunkResponse, error) {
+	resp, err := e.h.UploadChunk(msg)
+	if err != nil {
+		return nil, uploadStatus(err)
+	}
+	return resp, nil
+}
+
+// GetUpload returns the progress of an upload.
+func (e *uploadEndpoints) GetUpload(_ context.Context,
+	msg *rpc.RsGetUploadRequest) (*rpc.RsGetUploadResponse, error) {
+	resp, err := e.h.GetUpload(msg)
+	if err != nil {
+		return nil, uploadStatus(err)
+	}
+	return resp, nil
+}
+
+// FinishUpload writes the file of a complete upload.
+func (e *uploadEndpoints) FinishUpload(ctx context.Context,
+	msg *rpc.RsFinishUploadRequest) (*rpc.RsFinishUploadResponse, error) {
+	resp, err := e.h.FinishUpload(ctx, msg)
+	if err != nil {
+		return nil, uploadStatus(err)
+	}
+	return resp, nil
+}
+
+// CancelUpload discards an upload.
+func (e *uploadEndpoints) CancelUpload(_ context.Context,
+	msg *rpc.RsCancelUploadRequest) (*rpc.RsCancelUploadResponse, error) {
+	resp, err := e.h.CancelUpload(msg)
+	if err != nil {
+		return nil, uploadStatus(err)
+	}
+	return resp, nil
+}
+
+// uploadStatus converts an upload error into a gRPC status error with the
+// matching code. Other errors are returned unchanged, as for the RemoteSync
+// service.
+func uploadStatus(err error) error {
+	switch {
+	case errors.Is(err, UploadsDisabledErr):
+		return status.Error(codes.Unimplemented, err.Error())
+	case errors.Is(err, UnknownUploadErr):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, UploadLimitErr),
+		errors.Is(err, ObjectTooLargeErr),
+		errors.Is(err, QuotaExceededErr):
+		return status.Error(codes.ResourceExhausted, err.Error())
+	case errors.Is(err, UploadOffsetErr),
+		errors.Is(err, UploadIncompleteErr):
+		return status.Error(codes.FailedPrecondition, err.Error())
+	case errors.Is(err, UploadHashErr):
+		return status.Error(codes.DataLoss, err.Error())
+	case errors.Is(err, UploadSizeErr),
+		errors.Is(err, store.NonLocalFileErr),
+		errors.Is(err, store.ReservedPathErr):
+		return status.Error(codes.InvalidArgument, err.Error())
+	default:
+		return err
+	}
+}
+
+// deltaEndpoints implements the Delta gRPC service using the handler.
+type deltaEndpoints struct {
+	rpc.UnimplementedDeltaServer
+	h *handler
+}
+
+// GetSignature returns the signature of a file.
+func (e *deltaEndpoints) GetSignature(ctx context.Context,
+	msg *rpc.RsGetSignatureRequest) (*rpc.RsGetSignatureResponse, error) {
+	resp, err := e.h.GetSignature(ctx, msg)
+	if err != nil {
+		return nil, deltaStatus(err)
+	}
+	return resp, nil
+}
+
+// ApplyDelta writes a file reconstructed from its stored data and a delta.
+func (e *deltaEndpoints) ApplyDelta(ctx context.Context,
+	msg *rpc.RsApplyDeltaRequest) (*rpc.RsApplyDeltaResponse, error) {
+	resp, err := e.h.ApplyDelta(ctx, msg)
+	if err != nil {
+		return nil, deltaStatus(err)
+	}
+	return resp, nil
+}
+
+// deltaStatus converts a delta sync error into a gRPC status error with the
+// matching code. Other errors are returned unchanged, as for the RemoteSync
+// service.
+func deltaStatus(err error) error {
+	switch {
+	case errors.Is(err, DeltaDisabledErr):
+		return status.Error(codes.Unimplemented, err.Error())
+	case errors.Is(err, os.ErrNotExist):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, DeltaBaseErr):
+		return status.Error(codes.FailedPrecondition, err.Error())
+	case errors.Is(err, DeltaHashErr):
+		return status.Error(codes.DataLoss, err.Error())
+	case errors.Is(err, ObjectTooLargeErr),
+		errors.Is(err, QuotaExceededErr):
+		return status.Error(codes.ResourceExhausted, err.Error())
+	case errors.Is(err, InvalidDeltaErr),
+		errors.Is(err, store.NonLocalFileErr),
+		errors.Is(err, store.ReservedPathErr):
+		return status.Error(codes.InvalidArgument, err.Error())
+	default:
+		return err
+	}
+}
+
+// downloadEndpoints implements the Download gRPC service using the handler.
+type downloadEndpoints struct {
+	rpc.UnimplementedDownloadServer
+	h *handler
+}
+
+// Download streams a file in chunks.
+func (e *downloadEndpoints) Download(
+	msg *rpc.RsDownloadRequest, stream rpc.Download_DownloadServer) error {
+	return downloadStatus(e.h.Download(stream.Context(), msg, stream.Send))
+}
+
+// downloadStatus converts a download error into a gRPC status error with the
+// matching code. Other errors are returned unchanged, as for the RemoteSync
+// service.
+func downloadStatus(err error) error {
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, InvalidDownloadErr):
+		return status.Error(codes.OutOfRange, err.Error())
+	case errors.Is(err, DownloadChangedErr):
+		return status.Error(codes.Aborted, err.Error())
+	case errors.Is(err, store.NonLocalFileErr),
+		errors.Is(err, store.ReservedPathErr):
+		return status.Error(codes.InvalidArgument, err.Error())
+	default:
+		return err
+	}
+}
+
+// metadataEndpoints implements the Metadata gRPC service using the handler.
+type metadataEndpoints struct {
+	rpc.UnimplementedMetadataServer
+	h *handler
+}
+
+// Stat returns the metadata of a file.
+func (e *metadataEndpoints) Stat(
+	ctx context.Context, msg *rpc.RsStatRequest) (*rpc.RsStatResponse, error) {
+	resp, err := e.h.Stat(ctx, msg)
+	if err != nil {
+		return nil, metadataStatus(err)
+	}
+	return resp, nil
+}
+
+// metadataStatus converts a metadata error into a gRPC status error with the
+// matching code. Other errors are returned unchanged, as for the RemoteSync
+// service.
+func metadataStatus(err error) error {
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, store.NonLocalFileErr),
+		errors.Is(err, store.ReservedPathErr):
+		return status.Error(codes.InvalidArgument, err.Error())
+	default:
+		return err
+	}
+}
+
+// linksEndpoints implements the Links gRPC service using the handler.
+type linksEndpoints struct {
+	rpc.UnimplementedLinksServer
+	h *handler
+}
+
+// CreateLink creates a download link to a file.
+func (e *linksEndpoints) CreateLink(ctx context.Context,
+	msg *rpc.RsCreateLinkRequest) (*rpc.RsCreateLinkResponse, error) {
+	resp, err := e.h.CreateLink(ctx, msg)
+	if err != nil {
+		return nil, linksStatus(err)
+	}
+	return resp, nil
+}
+
+// linksStatus converts a download link error into a gRPC status error with the
+// matching code. Other errors are returned unchanged, as for the RemoteSync
+// service.
+func linksStatus(err error) error {
+	switch {
+	case errors.Is(err, LinksDisabledErr):
+		return status.Error(codes.Unimplemented, err.Error())
+	case errors.Is(err, os.ErrNotExist):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, InvalidLinkTTLErr),
+		errors.Is(err, store.NonLocalFileErr),
+		errors.Is(err, store.ReservedPathErr):
+		return status.Error(codes.InvalidArgument, err.Error())
+	default:
+		return err
+	}
+}
+
+// changesEndpoints implements the Changes gRPC service using the handler.
+type changesEndpoints struct {
+	rpc.UnimplementedChangesServer
+	h *handler
+}
+
+// Watch streams the changes to the files of the user.
+func (e *changesEndpoints) Watch(
+	msg *rpc.RsWatchRequest, stream rpc.Changes_WatchServer) error {
+	return changesStatus(e.h.Watch(stream.Context(), msg, stream.Send))
+}
+
+// changesStatus converts a change notification error into a gRPC status error
+// with the matching code. Other errors are returned unchanged, as for the
+// RemoteSync service.
+func changesStatus(err error) error {
+	switch {
+	case errors.Is(err, ChangesDisabledErr):
+		return status.Error(codes.Unimplemented, err.Error())
+	case errors.Is(err, TooManyWatchersErr),
+		errors.Is(err, WatcherLaggedErr):
+		return status.Error(codes.ResourceExhausted, err.Error())
+	default:
+		return err
+	}
+}
+
+// registrationEndpoints implements the Registration gRPC service using the
+// Registrar.
+type registrationEndpoints struct {
+	rpc.UnimplementedRegistrationServer
+	r *Registrar
+}
+
+// Register creates a new account.
+func (e *registrationEndpoints) Register(_ context.Context,
+	msg *rpc.RsRegisterRequest) (*rpc.RsRegisterResponse, error) {
+	jww.DEBUG.Printf("Received Register message for user %q.",
+		msg.GetUsername())
+
+	pending, err := e.r.Register(
+		msg.GetUsername(), msg.GetPassword(), msg.GetInviteCode())
+	if err != nil {
+		return nil, registrationStatus(err)
+	}
+
+	return &rpc.RsRegisterResponse{PendingApproval: pending}, nil
+}
+
+// registrationStatus converts a registration error into a gRPC status error
+// with the matching code. Unexpected errors are logged and not returned to the
+// client.
+func registrationStatus(err error) error {
+	switch {
+	case errors.Is(err, RegistrationDisabledErr):
+		return status.Error(codes.Unimplemented, err.Error())
+	case errors.Is(err, RegistrationsClosedErr):
+		return status.Error(codes.ResourceExhausted, err.Error())
+	case errors.Is(err, InvalidInviteErr):
+		return status.Error(codes.PermissionDenied, err.Error())
+	case errors.Is(err, UsernameTakenErr):
+		return status.Error(codes.AlreadyExists, err.Error())
+	case errors.Is(err, EmptyPasswordErr),
+		errors.Is(err, store.NonLocalFileErr):
+		return status.Error(codes.InvalidArgument, "invalid username or password")
+	default:
+		jww.ERROR.Printf("Failed to register user: %+v", err)
+		return status.Error(codes.Internal, "failed to register user")
+	}
+}
+
+// infoEndpoints implements the Info gRPC service. It does not require
+// authentication.
+type infoEndpoints struct {
+	rpc.UnimplementedInfoServer
+
+	// version is the response to GetVersion, which does not change while the
+	// server is running.
+	version *rpc.RsGetVersionResponse
+}
+
+// GetVersion returns the version and build metadata of the server and its
+// enabled optional features.
+func (e *infoEndpoints) GetVersion(context.Context,
+	*rpc.RsGetVersionRequest) (*rpc.RsGetVersionResponse, error) {
+	return e.version, nil
+}
+
+// healthEndpoints implements the standard grpc.health.v1 Health service, so
+// that load balancers can check the gRPC port natively. It does not require
+// authentication. Watch is not implemented, which clients treat as healthy.
+type healthEndpoints struct {
+	healthpb.UnimplementedHealthServer
+
+	// status returns the serving status of the server.
+	status func() healthpb.HealthCheckResponse_ServingStatus
+
+	// services returns the services registered on the gRPC server.
+	services func() map[string]grpc.ServiceInfo
+}
+
+// Check returns the serving status of the server, which is the same for all
+// of its services. Returns NOT_FOUND for a service that is not registered.
+func (e *healthEndpoints) Check(_ context.Context,
+	msg *healthpb.HealthCheckRequest) (*healthpb.HealthCheckResponse, error) {
+	if service := msg.GetService(); service != "" {
+		if _, exists := e.services()[service]; !exists {
+			return nil, status.Errorf(
+				codes.NotFound, "unknown service %q", service)
+		}
+	}
+	return &healthpb.HealthCheckResponse{Status: e.status()}, nil
+}
+
+// adminEndpoints implements the Admin gRPC service using the handler. Calls
+// must be authorized with the admin key.
+type adminEndpoints struct {
+	rpc.UnimplementedAdminServer
+	h *handler
+
+	// key is the admin key. If it is empty, only API keys with the admin scope
+	// are accepted, and if API keys are also disabled, the service is
+	// disabled.
+	key string
+
+	// certs returns the certificates currently served by the server.
+	certs func() []*x509.Certificate
+
+	// reload reloads the config. If it is nil, ReloadConfig is not
+	// implemented.
+	reload func() error
+
+	// stats counts the RPCs handled by the server.
+	stats *rpcStats
+
+	// maintenance is the maintenance mode of the server. If it is nil,
+	// SetMaintenance is not implemented.
+	maintenance *Maintenance
+
+	// registrar registers new accounts. If it is nil, SetRegistrationsOpen is
+	// not implemented.
+	registrar *Registrar
+
+	// replication is the replication to or from the server. If it is nil,
+	// Promote is not implemented.
+	replication *Replication
+
+	// apiKeys are the API keys accepted with the admin scope in place of the
+	// admin key. If it is nil, only the admin key is accepted.
+	apiKeys *APIKeys
+
+	// policies are the quotas and bans of users. If it is nil, SetQuota and
+	// SetBanned are not implemented.
+	policies *UserPolicies
+
+	// ipFilter filters the connections by address. If it is nil,
+	// UpdateIPFilter is not implemented.
+	ipFilter *IPFilter
+
+	// autoBan bans the addresses of clients with too many failed requests. If
+	// it is nil, ListIPBans and ClearIPBans are not implemented.
+	autoBan *AutoBan
+
+	// setLogLevel sets the log level. If it is nil, SetLogLevel is not
+	// implemented.
+	setLogLevel func(level uint)
+}
+
+// RevokeToken immediately revokes a single token.
+func (e *adminEndpoints) RevokeToken(ctx context.Context,
+	msg *rpc.RsRevokeTokenRequest) (*rpc.RsRevokeResponse, error) {
+	if err := e.authorize(ctx); err != nil {
+		return nil, err
+	}
+
+	ended, err := e.h.RevokeToken(UnmarshalToken(msg.GetToken()))
+	if err != nil {
+		jww.ERROR.Printf("Failed to revoke token: %+v", err)
+		return nil, status.Error(codes.Internal, "failed to revoke token")
+	}
+
+	return &rpc.RsRevokeResponse{SessionEnded: ended}, nil
+}
+
+// RevokeUser immediately revokes all tokens issued to a user.
+func (e *adminEndpoints) RevokeUser(ctx context.Context,
+	msg *rpc.RsRevokeUserRequest) (*rpc.RsRevokeResponse, error) {
+	if err := e.authorize(ctx); err != nil {
+		return nil, err
+	}
+
+	ended, err := e.h.RevokeUser(msg.GetUsername())
+	if err != nil {
+		jww.ERROR.Printf("Failed to revoke user %q: %+v", msg.GetUsername(), err)
+		return nil, status.Error(codes.Internal, "failed to revoke user")
+	}
+
+	return &rpc.RsRevokeResponse{SessionEnded: ended}, nil
+}
+
+// GetCertificates returns the certificates currently served by the server and
+// when they expire.
+func (e *adminEndpoints) GetCertificates(ctx context.Context,
+	_ *rpc.RsGetCertificatesRequest) (*rpc.RsGetCertificatesResponse, error) {
+	if err := e.authorize(ctx); err != nil {
+		return nil, err
+	}
+
+	resp := &rpc.RsGetCertificatesResponse{}
+	for _, leaf := range e.certs() {
+		resp.Certificates = append(resp.Certificates, &rpc.RsCertificateStatus{
+			Subject:  leaf.Subject.String(),
+			DNSNames: leaf.DNSNames,
+			NotAfter: leaf.NotAfter.UnixNano(),
+		})
+	}
+
+	return resp, nil
+}
+
+// ReloadConfig rereads the config file and applies the options that can change
+// without a restart.
+func (e *adminEndpoints) ReloadConfig(ctx context.Context,
+	_ *rpc.RsReloadConfigRequest) (*rpc.RsReloadConfigResponse, error) {
+	if err := e.authorize(ctx); err != nil {
+		return nil, err
+	}
+	if e.reload == nil {
+		return nil, status.Error(
+			codes.Unimplemented, "config reloading is not supported")
+	}
+
+	if err := e.reload(); err != nil {
+		jww.ERROR.Printf("Failed to reload config: %+v", err)
+		return nil, status.Error(codes.FailedPrecondition, err.Error())
+	}
+
+	return &rpc.RsReloadConfigResponse{}, nil
+}
+
+// GetStats returns the uptime, sessions, users, storage used, and RPC rates of
+// the server.
+func (e *adminEndpoints) GetStats(ctx context.Context,
+	_ *rpc.RsGetStatsRequest) (*rpc.RsGetStatsResponse, error) {
+	if err := e.authorize(ctx); err != nil {
+		return nil, err
+	}
+
+	users, err := e.h.users.List()
+	if err != nil {
+		jww.ERROR.Printf("Failed to list users for stats: %+v", err)
+		return nil, status.Error(codes.Internal, "failed to list users")
+	}
+	var storageBytes int64
+	for _, size := range e.h.storageUsage(users) {
+		storageBytes += size
+	}
+
+	rpcs, errs := e.stats.totals()
+	rpcRate, errorRate := e.stats.rates(time.Now())
+	return &rpc.RsGetStatsResponse{
+		StartedAt:      e.stats.started.UnixNano(),
+		ActiveSessions: int64(e.h.activeSessions()),
+		Users:          int64(len(users)),
+		StorageBytes:   storageBytes,
+		RPCs:           rpcs,
+		Errors:         errs,
+		RPCRate:        rpcRate,
+		ErrorRate:      errorRate,
+		Maintenance:    e.maintenance != nil && e.maintenance.Enabled(),
+		RegistrationsOpen: e.registrar != nil &&
+			e.registrar.Mode() != RegistrationDisabled && e.registrar.Open(),
+	}, nil
+}
+
+// SetMaintenance enables or disables read-only maintenance mode.
+func (e *adminEndpoints) SetMaintenance(ctx context.Context,
+	msg *rpc.RsSetMaintenanceRequest) (*rpc.RsSetMaintenanceResponse, error) {
+	if err := e.authorize(ctx); err != nil {
+		return nil, err
+	}
+	if e.maintenance == nil {
+		return nil, status.Error(
+			codes.Unimplemented, "maintenance mode is not supported")
+	}
+
+	wasEnabled := e.maintenance.Set(msg.GetEnabled())
+	return &rpc.RsSetMaintenanceResponse{WasEnabled: wasEnabled}, nil
+}
+
+// SetRegistrationsOpen opens or closes registrations to new accounts.
+func (e *adminEndpoints) SetRegistrationsOpen(ctx context.Context,
+	msg *rpc.RsSetRegistrationsOpenRequest) (
+	*rpc.RsSetRegistrationsOpenResponse, error) {
+	if err := e.authorize(ctx); err != nil {
+		return nil, err
+	}
+	if e.registrar == nil {
+		return nil, status.Error(
+			codes.Unimplemented, "registration is not supported")
+	}
+
+	wasOpen := e.registrar.SetOpen(msg.GetOpen())
+	return &rpc.RsSetRegistrationsOpenResponse{WasOpen: wasOpen}, nil
+}
+
+// Promote makes a standby server accept writes.
+func (e *adminEndpoints) Promote(ctx context.Context,
+	_ *rpc.RsPromoteRequest) (*rpc.RsPromoteResponse, error) {
+	if err := e.authorize(ctx); err != nil {
+		return nil, err
+	}
+	if e.replication == nil {
+		return nil, status.Error(
+			codes.Unimplemented, "replication is not enabled")
+	} else if e.replication.Replica() {
+		return nil, status.Error(
+			codes.FailedPrecondition, "read replicas cannot be promoted")
+	}
+
+	wasStandby := e.replication.Promote()
+	return &rpc.RsPromoteResponse{WasStandby: wasStandby}, nil
+}
+
+// Backup streams a tar archive of the credentials and files of all users.
+func (e *adminEndpoints) Backup(
+	msg *rpc.RsBackupRequest, stream rpc.Admin_BackupServer) error {
+	if err := e.authorize(stream.Context()); err != nil {
+		return err
+	}
+
+	var since time.Time
+	if msg.GetSince() != 0 {
+		since = time.Unix(0, msg.GetSince())
+	}
+	w := bufio.NewWriterSize(&backupSender{stream}, backupChunkSize)
+	m, err := writeBackup(e.h, w, since)
+	if err == nil {
+		err = w.Flush()
+	}
+	if errors.Is(err, store.NotListableErr) {
+		return status.Error(codes.FailedPrecondition, err.Error())
+	} else if err != nil {
+		jww.ERROR.Printf("Failed to back up: %+v", err)
+		return status.Error(codes.Internal, "failed to back up")
+	}
+
+	jww.INFO.Printf("Backed up %d files (%d bytes) of %d users.",
+		m.Files, m.Bytes, len(m.Users))
+	return nil
+}
+
+// Restore applies the tar archive of a backup streamed by the client.
+func (e *adminEndpoints) Restore(stream rpc.Admin_RestoreServer) error {
+	if err := e.authorize(stream.Context()); err != nil {
+		return err
+	}
+	if e.replication != nil && !e.replication.Primary() {
+		return status.Error(codes.FailedPrecondition,
+			"backups can only be restored on a server that accepts writes")
+	}
+
+	first, err := stream.Recv()
+	if err == io.EOF {
+		return status.Error(codes.InvalidArgument, "no backup was sent")
+	} else if err != nil {
+		return err
+	}
+	resp, err := restoreBackup(e.h,
+		&restoreReceiver{stream: stream, buf: first.GetData()},
+		first.GetUsers(), first.GetConflict())
+	switch {
+	case errors.Is(err, InvalidRestoreErr),
+		errors.Is(err, store.NonLocalFileErr),
+		errors.Is(err, store.ReservedPathErr):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, ObjectTooLargeErr),
+		errors.Is(err, QuotaExceededErr):
+		return status.Error(codes.ResourceExhausted, err.Error())
+	case err != nil:
+		jww.ERROR.Printf("Failed to restore backup: %+v", err)
+		return status.Error(codes.Internal, "failed to restore backup")
+	}
+
+	jww.INFO.Printf("Restored %d files (%d bytes) and %d accounts from "+
+		"backup; skipped %d existing.", resp.GetFiles(), resp.GetBytes(),
+		resp.GetUsers(), resp.GetSkipped())
+	return stream.SendAndClose(resp)
+}
+
+// ListUsers returns every registered user with their storage, quota, and ban.
+func (e *adminEndpoints) ListUsers(ctx context.Context,
+	_ *rpc.RsListUsersRequest) (*rpc.RsListUsersResponse, error) {
+	if err := e.authorize(ctx); err != nil {
+		return nil, err
+	}
+
+	users, err := e.h.users.List()
+	if err != nil {
+		jww.ERROR.Printf("Failed to list users: %+v", err)
+		return nil, status.Error(codes.Internal, "failed to list users")
+	}
+	usage := e.h.storageUsage(users)
+
+	resp := &rpc.RsListUsersResponse{
+		Users: make([]*rpc.RsUserStatus, len(users))}
+	for i, username := range users {
+		user := &rpc.RsUserStatus{Username: username, StorageBytes: -1}
+		if size, ok := usage[username]; ok {
+			user.StorageBytes = size
+		}
+		if e.policies != nil {
+			user.Quota = e.policies.Quota(username)
+			user.BanReason, user.Banned = e.policies.Banned(username)
+		}
+		resp.Users[i] = user
+	}
+
+	return resp, nil
+}
+
+// AddUser registers a new user with a password.
+func (e *adminEndpoints) AddUser(ctx context.Context,
+	msg *rpc.RsAddUserRequest) (*rpc.RsAddUserResponse, error) {
+	if err := e.authorize(ctx); err != nil {
+		return nil, err
+	}
+	username := msg.GetUsername()
+	if err := store.CheckUsername(username); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	} else if msg.GetPassword() == "" {
+		return nil, status.Error(
+			codes.InvalidArgument, EmptyPasswordErr.Error())
+	}
+
+	_, err := e.h.users.Get(username)
+	if err == nil {
+		return nil, status.Errorf(
+			codes.AlreadyExists, "user %q already exists", username)
+	} else if !errors.Is(err, credentials.UserNotFoundErr) {
+		jww.ERROR.Printf("Failed to look up user %q: %+v", username, err)
+		return nil, status.Error(codes.Internal, "failed to add user")
+	}
+	if err = e.setPassword(username, msg.GetPassword()); err != nil {
+		jww.ERROR.Printf("Failed to add user %q: %+v", username, err)
+		return nil, status.Error(codes.Internal, "failed to add user")
+	}
+
+	jww.INFO.Printf("Added user %q.", username)
+	return &rpc.RsAddUserResponse{}, nil
+}
+
+// DeleteUser removes the credentials of a user and ends their sessions.
+func (e *adminEndpoints) DeleteUser(ctx context.Context,
+	msg *rpc.RsDeleteUserRequest) (*rpc.RsDeleteUserResponse, error) {
+	if err := e.authorize(ctx); err != nil {
+		return nil, err
+	}
+	username := msg.GetUsername()
+
+	err := e.h.users.Delete(username)
+	if errors.Is(err, credentials.UserNotFoundErr) {
+		return nil, status.Errorf(
+			codes.NotFound, "user %q does not exist", username)
+	} else if err != nil {
+		jww.ERROR.Printf("Failed to delete user %q: %+v", username, err)
+		return nil, status.Error(codes.Internal, "failed to delete user")
+	}
+	ended, err := e.h.RevokeUser(username)
+	if err != nil {
+		jww.ERROR.Printf("Failed to revoke deleted user %q: %+v", username, err)
+		return nil, status.Error(codes.Internal, "failed to revoke user")
+	}
+	if e.policies != nil {
+		if err = e.policies.Remove(username); err != nil {
+			jww.ERROR.Printf("Failed to remove policies of deleted user %q: "+
+				"%+v", username, err)
+			return nil, status.Error(
+				codes.Internal, "failed to remove user policies")
+		}
+	}
+
+	jww.INFO.Printf("Deleted user %q.", username)
+	return &rpc.RsDeleteUserResponse{SessionEnded: ended}, nil
+}
+
+// SetPassword replaces the password of a user.
+func (e *adminEndpoints) SetPassword(ctx context.Context,
+	msg *rpc.RsSetPasswordRequest) (*rpc.RsSetPasswordResponse, error) {
+	if err := e.authorize(ctx); err != nil {
+		return nil, err
+	}
+	username := msg.GetUsername()
+	if msg.GetPassword() == "" {
+		return nil, status.Error(
+			codes.InvalidArgument, EmptyPasswordErr.Error())
+	}
+
+	_, err := e.h.users.Get(username)
+	if errors.Is(err, credentials.UserNotFoundErr) {
+		return nil, status.Errorf(
+			codes.NotFound, "user %q does not exist", username)
+	} else if err == nil {
+		err = e.setPassword(username, msg.GetPassword())
+	}
+	if err != nil {
+		jww.ERROR.Printf("Failed to set password of %q: %+v", username, err)
+		return nil, status.Error(codes.Internal, "failed to set password")
+	}
+
+	jww.INFO.Printf("Set password of user %q.", username)
+	return &rpc.RsSetPasswordResponse{}, nil
+}
+
+// SetQuota limits the total size of the files of a user.
+func (e *adminEndpoints) SetQuota(ctx context.Context,
+	msg *rpc.RsSetQuotaRequest) (*rpc.RsSetQuotaResponse, error) {
+	if err := e.authorize(ctx); err != nil {
+		return nil, err
+	}
+	if e.policies == nil {
+		return nil, status.Error(
+			codes.Unimplemented, "user policies are not supported")
+	} else if msg.GetQuota() < 0 {
+		return nil, status.Error(
+			codes.InvalidArgument, "quota must not be negative")
+	}
+
+	previous, err := e.policies.SetQuota(msg.GetUsername(), msg.GetQuota())
+	if err != nil {
+		jww.ERROR.Printf("Failed to set quota of %q: %+v",
+			msg.GetUsername(), err)
+		return nil, status.Error(codes.Internal, "failed to set quota")
+	}
+
+	jww.INFO.Printf("Set quota of user %q to %d bytes.",
+		msg.GetUsername(), msg.GetQuota())
+	return &rpc.RsSetQuotaResponse{PreviousQuota: previous}, nil
+}
+
+// SetBanned bans or unbans a user. Banning a user ends their sessions.
+func (e *adminEndpoints) SetBanned(ctx context.Context,
+	msg *rpc.RsSetBannedRequest) (*rpc.RsSetBannedResponse, error) {
+	if err := e.authorize(ctx); err != nil {
+		return nil, err
+	}
+	if e.policies == nil {
+		return nil, status.Error(
+			codes.Unimplemented, "user policies are not supported")
+	}
+	username := msg.GetUsername()
+
+	wasBanned, err := e.policies.SetBanned(
+		username, msg.GetBanned(), msg.GetReason())
+	if err != nil {
+		jww.ERROR.Printf("Failed to set ban of %q: %+v", username, err)
+		return nil, status.Error(codes.Internal, "failed to set ban")
+	}
+	resp := &rpc.RsSetBannedResponse{WasBanned: wasBanned}
+	if !msg.GetBanned() {
+		jww.INFO.Printf("Unbanned user %q.", username)
+		return resp, nil
+	}
+
+	if resp.SessionEnded, err = e.h.RevokeUser(username); err != nil {
+		jww.ERROR.Printf("Failed to revoke banned user %q: %+v", username, err)
+		return nil, status.Error(codes.Internal, "failed to revoke user")
+	}
+	jww.INFO.Printf("Banned user %q: %s", username, msg.GetReason())
+	return resp, nil
+}
+
+// SetLogLevel changes the log level of the server.
+func (e *adminEndpoints) SetLogLevel(ctx context.Context,
+	msg *rpc.RsSetLogLevelRequest) (*rpc.RsSetLogLevelResponse, error) {
+	if err := e.authorize(ctx); err != nil {
+		return nil, err
+	}
+	if e.setLogLevel == nil {
+		return nil, status.Error(
+			codes.Unimplemented, "changing the log level is not supported")
+	}
+
+	e.setLogLevel(uint(msg.GetLevel()))
+	return &rpc.RsSetLogLevelResponse{}, nil
+}
+
+// UpdateIPFilter adds or removes a network in the allow or deny list of the IP
+// filter.
+func (e *adminEndpoints) UpdateIPFilter(ctx context.Context,
+	msg *rpc.RsUpdateIPFilterRequest) (*rpc.RsUpdateIPFilterResponse, error) {
+	if err := e.authorize(ctx); err != nil {
+		return nil, err
+	}
+	if e.ipFilter == nil {
+		return nil, status.Error(
+			codes.Unimplemented, "IP filtering is not enabled")
+	}
+
+	update, action, list := e.ipFilter.Add, "Added %s to", "allow"
+	if msg.GetRemove() {
+		update, action = e.ipFilter.Remove, "Removed %s from"
+	}
+	if msg.GetDeny() {
+		list = "deny"
+	}
+	changed, err := update(msg.GetNetwork(), msg.GetDeny())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if changed {
+		jww.INFO.Printf(action+" the %s list of the IP filter.",
+			msg.GetNetwork(), list)
+	}
+
+	resp := &rpc.RsUpdateIPFilterResponse{Changed: changed}
+	resp.Allow, resp.Deny = e.ipFilter.Lists()
+	return resp, nil
+}
+
+// ListIPBans returns the IP addresses banned for too many failed requests.
+func (e *adminEndpoints) ListIPBans(ctx context.Context,
+	_ *rpc.RsListIPBansRequest) (*rpc.RsListIPBansResponse, error) {
+	if err := e.authorize(ctx); err != nil {
+		return nil, err
+	}
+	if e.autoBan == nil {
+		return nil, status.Error(
+			codes.Unimplemented, "automatic banning is not enabled")
+	}
+
+	bans := e.autoBan.Bans(time.Now())
+	resp := &rpc.RsListIPBansResponse{Bans: make([]*rpc.RsIPBan, len(bans))}
+	for i, ban := range bans {
+		resp.Bans[i] = &rpc.RsIPBan{
+			IP: ban.IP, Until: ban.Until.UnixNano(), Reason: ban.Reason}
+	}
+	return resp, nil
+}
+
+// ClearIPBans lifts the ban of an IP address, or of all addresses.
+func (e *adminEndpoints) ClearIPBans(ctx context.Context,
+	msg *rpc.RsClearIPBansRequest) (*rpc.RsClearIPBansResponse, error) {
+	if err := e.authorize(ctx); err != nil {
+		return nil, err
+	}
+	if e.autoBan == nil {
+		return nil, status.Error(
+			codes.Unimplemented, "automatic banning is not enabled")
+	}
+
+	if msg.GetIP() != "" && net.ParseIP(msg.GetIP()) == nil {
+		return nil, status.Errorf(
+			codes.InvalidArgument, "invalid IP address %q", msg.GetIP())
+	}
+
+	cleared := e.autoBan.Clear(msg.GetIP(), time.Now())
+	if msg.GetIP() == "" {
+		jww.INFO.Printf("Cleared %d IP bans.", cleared)
+	} else if cleared > 0 {
+		jww.INFO.Printf("Cleared the ban of %s.", msg.GetIP())
+	}
+	return &rpc.RsClearIPBansResponse{Cleared: uint32(cleared)}, nil
+}
+
+// setPassword registers the user with the password, hashed if password hashing
+// is enabled.
+func (e *adminEndpoints) setPassword(username, password string) error {
+	if e.h.hasher != nil {
+		var err error
+		if password, err = e.h.hasher.Hash(password); err != nil {
+			return err
+		}
+	}
+	return e.h.users.Set(username, password)
+}
+
+// authorize returns a gRPC status error if the admin service is disabled or
+// the request does not contain the admin key or an API key with the admin
+// scope in its authorization metadata.
+func (e *adminEndpoints) authorize(ctx context.Context) error {
+	if e.key == "" && e.apiKeys == nil {
+		return status.Error(codes.Unimplemented, "admin API is disabled")
+	}
+
+	md, _ := metadata.FromIncomingContext(ctx)
+	for _, auth := range md.Get(authorizationMetadataKey) {
+		key := strings.TrimPrefix(auth, bearerPrefix)
+		if e.key != "" &&
+			subtle.ConstantTimeCompare([]byte(key), []byte(e.key)) == 1 {
+			return nil
+		}
+		if e.apiKeys != nil {
+			apiKey, err := e.apiKeys.Verify(key)
+			if err == nil && apiKey.Scopes.Allows(ScopeAdmin) {
+				return nil
+			} else if err != nil && !errors.Is(err, InvalidAPIKeyErr) {
+				jww.ERROR.Printf("Failed to verify API key: %+v", err)
+			}
+		}
+	}
+
+	jww.WARN.Printf("Rejected unauthorized admin request.")
+	return status.Error(codes.Unauthenticated, "invalid admin key")
+}
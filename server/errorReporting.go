@@ -0,0 +1,240 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package server
+
+import (
+	"context"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+	"github.com/pkg/errors"
+	jww "github.com/spf13/jwalterweatherman"
+	"google.golang.org/grpc"
+
+	"gitlab.com/elixxir/remoteSyncServer/logging"
+)
+
+// defaultErrorReportingSampleRate is the fraction of events reported if the
+// sample rate is not set.
+const defaultErrorReportingSampleRate = 1.0
+
+// errorReportingFlushTimeout is the maximum time taken to send the pending
+// events before the server crashes or stops.
+const errorReportingFlushTimeout = 5 * time.Second
+
+// errorReportingRelease is the name of the server in the release of events.
+// The version is appended to it.
+const errorReportingRelease = "remoteSyncServer@"
+
+// ErrorReportingParams are the parameters of the reporting of errors and
+// crashes to a Sentry-compatible service.
+type ErrorReportingParams struct {
+	// DSN is the Sentry DSN events are sent to, such as
+	// "https://key@sentry.example.com/1". Required.
+	DSN string `mapstructure:"dsn"`
+
+	// Environment is the environment of the server, such as "production".
+	Environment string `mapstructure:"environment"`
+
+	// ServerName identifies the server in events. Defaults to the hostname.
+	ServerName string `mapstructure:"serverName"`
+
+	// SampleRate is the fraction of events reported, greater than 0 and at
+	// most 1. Defaults to 1.
+	SampleRate float64 `mapstructure:"sampleRate"`
+}
+
+// ErrorReporter reports panics and ERROR and CRITICAL log entries, with their
+// stack traces and the version and configuration of the server, to a
+// Sentry-compatible service.
+type ErrorReporter struct {
+	params ErrorReportingParams
+
+	// hub is cloned for each event so that the tags of concurrent events do
+	// not mix.
+	hub *sentry.Hub
+}
+
+// NewErrorReporter creates a new ErrorReporter from the parameters. Events are
+// tagged with the build info and the tags, such as the storage backend.
+func NewErrorReporter(params map[string]interface{}, info BuildInfo,
+	tags map[string]string) (*ErrorReporter, error) {
+	p := ErrorReportingParams{SampleRate: defaultErrorReportingSampleRate}
+	if err := decodeParams(params, &p, "error reporting"); err != nil {
+		return nil, err
+	}
+	return newErrorReporter(p, info, tags, nil)
+}
+
+// newErrorReporter creates a new ErrorReporter that sends events with the
+// transport, or over HTTP if it is nil.
+func newErrorReporter(p ErrorReportingParams, info BuildInfo,
+	tags map[string]string, transport sentry.Transport) (*ErrorReporter, error) {
+	if p.DSN == "" {
+		return nil, errors.New("DSN is required")
+	}
+	// A sample rate of 0 is treated by Sentry as 1
+	if p.SampleRate <= 0 || p.SampleRate > 1 {
+		return nil, errors.Errorf(
+			"sample rate %g must be greater than 0 and at most 1", p.SampleRate)
+	}
+
+	client, err := sentry.NewClient(sentry.ClientOptions{
+		Dsn:              p.DSN,
+		Environment:      p.Environment,
+		ServerName:       p.ServerName,
+		Release:          errorReportingRelease + info.Version,
+		SampleRate:       p.SampleRate,
+		AttachStacktrace: true,
+		Transport:        transport,
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create Sentry client")
+	}
+
+	scope := sentry.NewScope()
+	for key, value := range map[string]string{
+		"gitCommit": info.GitCommit,
+		"buildDate": info.BuildDate,
+		"goVersion": info.GoVersion,
+	} {
+		if value != "" {
+			scope.SetTag(key, value)
+		}
+	}
+	scope.SetTags(tags)
+
+	return &ErrorReporter{params: p, hub: sentry.NewHub(client, scope)}, nil
+}
+
+// LogListener returns a writer that reports each ERROR and CRITICAL entry
+// written to it as an event. It is registered with jww.SetLogListeners.
+// FATAL entries are not reported since they are followed by a panic, which is
+// reported by Recover.
+func (er *ErrorReporter) LogListener(t jww.Threshold) io.Writer {
+	switch t {
+	case jww.LevelError:
+		return &errorLogWriter{er: er, level: sentry.LevelError}
+	case jww.LevelCritical:
+		return &errorLogWriter{er: er, level: sentry.LevelFatal}
+	default:
+		return nil
+	}
+}
+
+// errorLogWriter reports each log entry written to it at its level.
+type errorLogWriter struct {
+	er    *ErrorReporter
+	level sentry.Level
+}
+
+// Write reports the log entry. It never fails so that the entry is still
+// written to the other outputs of the logger.
+func (w *errorLogWriter) Write(p []byte) (int, error) {
+	w.er.captureLog(w.level, logging.Message(string(p)))
+	return len(p), nil
+}
+
+// captureLog reports the message of a log entry with the stack trace of the
+// code that logged it.
+func (er *ErrorReporter) captureLog(level sentry.Level, msg string) {
+	hub := er.hub.Clone()
+	event := hub.Client().EventFromMessage(msg, level)
+	for _, thread := range event.Threads {
+		if thread.Stacktrace != nil {
+			thread.Stacktrace.Frames = trimLogFrames(thread.Stacktrace.Frames)
+		}
+	}
+	hub.ConfigureScope(func(scope *sentry.Scope) {
+		scope.SetTag("source", "log")
+	})
+	hub.CaptureEvent(event)
+}
+
+// loggingModules are the packages that a log entry passes through between the
+// code that logs it and the errorLogWriter.
+var loggingModules = map[string]bool{
+	"io":                                 true,
+	"log":                                true,
+	"github.com/spf13/jwalterweatherman": true,
+	"gitlab.com/elixxir/remoteSyncServer/logging": true,
+}
+
+// trimLogFrames removes the innermost frames of the logger and the
+// ErrorReporter from the frames of a log entry, which are ordered from the
+// outermost call, so that the stack trace ends where the entry was logged.
+func trimLogFrames(frames []sentry.Frame) []sentry.Frame {
+	end := len(frames)
+	for end > 0 {
+		f := frames[end-1]
+		if !loggingModules[f.Module] &&
+			!strings.HasPrefix(f.Function, "(*errorLogWriter).") &&
+			!strings.HasPrefix(f.Function, "(*ErrorReporter).") {
+			break
+		}
+		end--
+	}
+	return frames[:end]
+}
+
+// interceptor returns an interceptor that reports RPCs that panic, with their
+// method and request ID, before continuing to panic. The request ID is taken
+// from the context set by logInterceptor.
+func (er *ErrorReporter) interceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{},
+		info *grpc.UnaryServerInfo, next grpc.UnaryHandler) (interface{}, error) {
+		defer func() {
+			if r := recover(); r != nil {
+				er.capturePanic(ctx, r, map[string]string{
+					"method":    info.FullMethod,
+					"requestID": requestID(ctx),
+				})
+				panic(r)
+			}
+		}()
+		return next(ctx, req)
+	}
+}
+
+// Recover reports a panic of the calling goroutine and waits for it to be sent
+// before continuing to panic. It must be deferred directly, such as
+// "defer er.Recover()".
+func (er *ErrorReporter) Recover() {
+	if r := recover(); r != nil {
+		er.capturePanic(context.Background(), r, nil)
+		panic(r)
+	}
+}
+
+// capturePanic reports the recovered value of a panic with the tags and waits
+// for the event to be sent, since the process is about to crash.
+func (er *ErrorReporter) capturePanic(
+	ctx context.Context, r interface{}, tags map[string]string) {
+	hub := er.hub.Clone()
+	hub.ConfigureScope(func(scope *sentry.Scope) {
+		scope.SetTag("source", "panic")
+		for key, value := range tags {
+			if value != "" {
+				scope.SetTag(key, value)
+			}
+		}
+	})
+	hub.RecoverWithContext(ctx, r)
+	if !hub.Flush(errorReportingFlushTimeout) {
+		jww.WARN.Printf("Timed out sending the report of a panic.")
+	}
+}
+
+// Flush waits for the pending events to be sent. Called when the server stops.
+func (er *ErrorReporter) Flush() {
+	if !er.hub.Flush(errorReportingFlushTimeout) {
+		jww.WARN.Printf("Timed out sending error reports.")
+	}
+}
@@ -0,0 +1,208 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package server
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+	jww "github.com/spf13/jwalterweatherman"
+	"google.golang.org/grpc"
+)
+
+// testDSN is a valid DSN that is never sent to since the tests use
+// testTransport.
+const testDSN = "https://public@sentry.example.com/1"
+
+// testTransport records the events sent to it instead of sending them.
+type testTransport struct {
+	events []*sentry.Event
+	mux    sync.Mutex
+}
+
+func (tt *testTransport) Flush(time.Duration) bool       { return true }
+func (tt *testTransport) Configure(sentry.ClientOptions) {}
+func (tt *testTransport) SendEvent(event *sentry.Event) {
+	tt.mux.Lock()
+	defer tt.mux.Unlock()
+	tt.events = append(tt.events, event)
+}
+
+// newTestErrorReporter returns an ErrorReporter that records its events in
+// the returned transport.
+func newTestErrorReporter(t *testing.T) (*ErrorReporter, *testTransport) {
+	transport := &testTransport{}
+	er, err := newErrorReporter(ErrorReportingParams{
+		DSN: testDSN, Environment: "test", SampleRate: 1},
+		BuildInfo{Version: "1.2.3", GitCommit: "abc123"},
+		map[string]string{"storageBackend": "file"}, transport)
+	if err != nil {
+		t.Fatalf("Failed to create error reporter: %+v", err)
+	}
+	return er, transport
+}
+
+// checkEvent checks that the event has the level and message and all the
+// tags.
+func checkEvent(t *testing.T, event *sentry.Event, level sentry.Level,
+	message string, tags map[string]string) {
+	t.Helper()
+	if event.Level != level {
+		t.Errorf("Unexpected level.\nexpected: %s\nreceived: %s",
+			level, event.Level)
+	}
+	if event.Message != message {
+		t.Errorf("Unexpected message.\nexpected: %q\nreceived: %q",
+			message, event.Message)
+	}
+	if event.Release != "remoteSyncServer@1.2.3" {
+		t.Errorf("Unexpected release.\nexpected: %q\nreceived: %q",
+			"remoteSyncServer@1.2.3", event.Release)
+	}
+	for key, value := range tags {
+		if event.Tags[key] != value {
+			t.Errorf("Unexpected tag %q.\nexpected: %q\nreceived: %q",
+				key, value, event.Tags[key])
+		}
+	}
+}
+
+// Tests that NewErrorReporter uses the parameters and the default sample
+// rate.
+func TestNewErrorReporter(t *testing.T) {
+	tests := []struct {
+		params   map[string]interface{}
+		expected ErrorReportingParams
+	}{
+		{map[string]interface{}{"dsn": testDSN},
+			ErrorReportingParams{DSN: testDSN, SampleRate: 1}},
+		{map[string]interface{}{"dsn": testDSN, "environment": "staging",
+			"serverName": "sync-1", "sampleRate": "0.5"},
+			ErrorReportingParams{DSN: testDSN, Environment: "staging",
+				ServerName: "sync-1", SampleRate: 0.5}},
+	}
+	for i, tt := range tests {
+		er, err := NewErrorReporter(tt.params, BuildInfo{}, nil)
+		if err != nil {
+			t.Errorf("Failed to create error reporter %d: %+v", i, err)
+		} else if er.params != tt.expected {
+			t.Errorf("Unexpected parameters %d.\nexpected: %+v\nreceived: %+v",
+				i, tt.expected, er.params)
+		}
+	}
+}
+
+// Error path: Tests that NewErrorReporter returns an error for a missing or
+// invalid DSN, a sample rate out of range, or unknown parameters.
+func TestNewErrorReporter_Error(t *testing.T) {
+	tests := []map[string]interface{}{
+		{},
+		{"dsn": "not a dsn"},
+		{"dsn": testDSN, "sampleRate": 0},
+		{"dsn": testDSN, "sampleRate": 1.5},
+		{"dsn": testDSN, "release": "1.0.0"},
+	}
+	for i, params := range tests {
+		if _, err := NewErrorReporter(params, BuildInfo{}, nil); err == nil {
+			t.Errorf("Failed to get error for parameters %d: %v", i, params)
+		}
+	}
+}
+
+// Tests that ERROR entries logged with a LogListener registered are reported
+// with the stack trace of the code that logged them and that WARN entries are
+// not.
+func TestErrorReporter_LogListener(t *testing.T) {
+	er, transport := newTestErrorReporter(t)
+	jww.SetLogListeners(er.LogListener)
+	defer jww.SetLogListeners()
+
+	jww.WARN.Printf("not reported")
+	jww.ERROR.Printf("Failed to %s", "sync")
+
+	if len(transport.events) != 1 {
+		t.Fatalf("Unexpected number of events.\nexpected: %d\nreceived: %d",
+			1, len(transport.events))
+	}
+	event := transport.events[0]
+	checkEvent(t, event, sentry.LevelError, "Failed to sync", map[string]string{
+		"source": "log", "gitCommit": "abc123", "storageBackend": "file"})
+
+	if len(event.Threads) != 1 || event.Threads[0].Stacktrace == nil {
+		t.Fatalf("Event has no stack trace: %+v", event.Threads)
+	}
+	frames := event.Threads[0].Stacktrace.Frames
+	if last := frames[len(frames)-1]; last.Function !=
+		"TestErrorReporter_LogListener" {
+		t.Errorf("Stack trace does not end where the entry was logged: %+v",
+			last)
+	}
+}
+
+// Tests that the interceptor of the ErrorReporter reports RPCs that panic,
+// with their method and request ID, and continues to panic.
+func TestErrorReporter_interceptor(t *testing.T) {
+	er, transport := newTestErrorReporter(t)
+	ctx := context.WithValue(context.Background(), requestIDKey{}, "req-1")
+	interceptor := er.interceptor()
+	info := &grpc.UnaryServerInfo{FullMethod: "/mixmessages.RemoteSync/Read"}
+
+	_, err := interceptor(ctx, nil, info,
+		func(context.Context, interface{}) (interface{}, error) {
+			return nil, nil
+		})
+	if err != nil || len(transport.events) != 0 {
+		t.Fatalf("RPC without panic failed or was reported: %+v, %d events",
+			err, len(transport.events))
+	}
+
+	defer func() {
+		if r := recover(); r != "nil map" {
+			t.Errorf("Unexpected panic.\nexpected: %q\nreceived: %v",
+				"nil map", r)
+		}
+		if len(transport.events) != 1 {
+			t.Fatalf("Unexpected number of events."+
+				"\nexpected: %d\nreceived: %d", 1, len(transport.events))
+		}
+		checkEvent(t, transport.events[0], sentry.LevelFatal, "nil map",
+			map[string]string{"source": "panic", "requestID": "req-1",
+				"method": "/mixmessages.RemoteSync/Read"})
+	}()
+	_, _ = interceptor(ctx, nil, info,
+		func(context.Context, interface{}) (interface{}, error) {
+			panic("nil map")
+		})
+	t.Error("Interceptor did not continue to panic.")
+}
+
+// Tests that ErrorReporter.Recover reports the panic of the goroutine and
+// continues to panic.
+func TestErrorReporter_Recover(t *testing.T) {
+	er, transport := newTestErrorReporter(t)
+	func() {
+		defer func() {
+			if r := recover(); r != "failed to start" {
+				t.Errorf("Unexpected panic.\nexpected: %q\nreceived: %v",
+					"failed to start", r)
+			}
+		}()
+		defer er.Recover()
+		panic("failed to start")
+	}()
+
+	if len(transport.events) != 1 {
+		t.Fatalf("Unexpected number of events.\nexpected: %d\nreceived: %d",
+			1, len(transport.events))
+	}
+	checkEvent(t, transport.events[0], sentry.LevelFatal, "failed to start",
+		map[string]string{"source": "panic", "storageBackend": "file"})
+}
@@ -0,0 +1,385 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package server
+
+import (
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	jww "github.com/spf13/jwalterweatherman"
+
+	"gitlab.com/elixxir/remoteSyncServer/store"
+	"gitlab.com/xx_network/primitives/netTime"
+)
+
+// defaultGCInterval is the default value of GCParams.Interval.
+const defaultGCInterval = 24 * time.Hour
+
+// Names of the garbage collection policies.
+const (
+	GCInactiveUsers = "inactiveUsers"
+	GCLogs          = "logs"
+	GCTombstones    = "tombstones"
+)
+
+// GCParams are the parameters of the garbage collection of stored files. Each
+// policy is disabled unless it is set.
+type GCParams struct {
+	// Interval is how often the policies are run while the server is running.
+	// Defaults to 24h.
+	Interval time.Duration `mapstructure:"interval"`
+
+	// DryRun logs the files the policies would remove without removing them.
+	DryRun bool `mapstructure:"dryRun"`
+
+	// InactiveUsers is the time after which all files of a user who has not
+	// written any file are removed.
+	InactiveUsers time.Duration `mapstructure:"inactiveUsers"`
+
+	// Logs are the transaction logs trimmed to their newest entries.
+	Logs []GCLogParams `mapstructure:"logs"`
+
+	// Tombstones is the time after which the previous versions of a deleted
+	// file are removed. Requires file versioning.
+	Tombstones time.Duration `mapstructure:"tombstones"`
+}
+
+// GCLogParams describes transaction logs that are stored as a directory with
+// one file per entry.
+type GCLogParams struct {
+	// Path is the pattern, as used by path.Match, that the directory of each
+	// log matches, such as "*/txlog".
+	Path string `mapstructure:"path"`
+
+	// MaxEntries is the number of newest entries, by modification time, kept
+	// in each log.
+	MaxEntries int `mapstructure:"maxEntries"`
+}
+
+// GCAction is a file removed, or that would be removed in a dry run, by a
+// garbage collection policy. For the tombstones policy, the file was already
+// deleted and its previous versions are removed.
+type GCAction struct {
+	Policy string
+	User   string
+	Path   string
+}
+
+// GCReport is the result of running the garbage collection policies.
+type GCReport struct {
+	// Users is the number of users whose files were checked.
+	Users int
+
+	// Actions are the files removed, or that would be removed in a dry run,
+	// in the order they were removed.
+	Actions []GCAction
+
+	// Failed are the users whose files could not be checked or removed.
+	Failed []string
+}
+
+// Count returns the number of actions of the policy.
+func (r GCReport) Count(policy string) int {
+	var n int
+	for _, a := range r.Actions {
+		if a.Policy == policy {
+			n++
+		}
+	}
+	return n
+}
+
+// GarbageCollector removes stored files according to its policies: all files
+// of inactive users, the oldest entries of transaction logs, and the previous
+// versions of files that were deleted long ago.
+type GarbageCollector struct {
+	params GCParams
+}
+
+// NewGarbageCollector creates a new GarbageCollector from the parameters.
+// Returns an error if no policy is set.
+func NewGarbageCollector(
+	params map[string]interface{}) (*GarbageCollector, error) {
+	p := GCParams{Interval: defaultGCInterval}
+	err := decodeParams(params, &p, "gc")
+	if err != nil {
+		return nil, err
+	}
+
+	if p.Interval <= 0 {
+		return nil, errors.Errorf(
+			"gc interval %s must be positive", p.Interval)
+	} else if p.InactiveUsers < 0 {
+		return nil, errors.Errorf(
+			"inactiveUsers %s cannot be negative", p.InactiveUsers)
+	} else if p.Tombstones < 0 {
+		return nil, errors.Errorf(
+			"tombstones %s cannot be negative", p.Tombstones)
+	}
+	for i, l := range p.Logs {
+		if l.Path == "" {
+			return nil, errors.Errorf("path of log %d is required", i)
+		} else if _, err = path.Match(l.Path, ""); err != nil {
+			return nil, errors.Wrapf(
+				err, "invalid path of log %d %q", i, l.Path)
+		} else if l.MaxEntries < 1 {
+			return nil, errors.Errorf("maxEntries %d of log %q must be "+
+				"positive", l.MaxEntries, l.Path)
+		}
+	}
+
+	gc := &GarbageCollector{params: p}
+	if len(gc.Policies()) == 0 {
+		return nil, errors.Errorf("no gc policy set (available: %s, %s, %s)",
+			GCInactiveUsers, GCLogs, GCTombstones)
+	}
+	return gc, nil
+}
+
+// Policies returns the names of the policies that are set.
+func (gc *GarbageCollector) Policies() []string {
+	var policies []string
+	if gc.params.InactiveUsers > 0 {
+		policies = append(policies, GCInactiveUsers)
+	}
+	if len(gc.params.Logs) > 0 {
+		policies = append(policies, GCLogs)
+	}
+	if gc.params.Tombstones > 0 {
+		policies = append(policies, GCTombstones)
+	}
+	return policies
+}
+
+// Run runs the policies on the files of each of the users, or all policies
+// that are set if none are given, and removes the files they select unless
+// dryRun is true. Users whose files cannot be checked or removed are logged
+// and skipped.
+//
+// Returns an error if a policy is unknown or not set.
+func (gc *GarbageCollector) Run(storageDir string, newStore store.NewStore,
+	usernames []string, policies []string, dryRun bool) (GCReport, error) {
+	set := gc.Policies()
+	if len(policies) == 0 {
+		policies = set
+	}
+	run := make(map[string]bool, len(policies))
+	for _, policy := range policies {
+		var found bool
+		for _, p := range set {
+			found = found || p == policy
+		}
+		if !found {
+			return GCReport{}, errors.Errorf("gc policy %q is not set "+
+				"(set: %s)", policy, strings.Join(set, ", "))
+		}
+		run[policy] = true
+	}
+
+	report := GCReport{Users: len(usernames)}
+	now := netTime.Now()
+	for _, username := range usernames {
+		s, err := newStore(storageDir, username)
+		if err == nil {
+			err = gc.collect(s, username, run, now, dryRun, &report)
+		}
+		if err != nil {
+			jww.WARN.Printf("Failed to collect garbage of %q: %+v",
+				username, err)
+			report.Failed = append(report.Failed, username)
+		}
+	}
+
+	return report, nil
+}
+
+// run runs all policies every interval until stop is closed. In a cluster, they
+// are only run by the leader, and with replication, only by the primary or by
+// each region.
+func (gc *GarbageCollector) run(h *handler, stop <-chan struct{}) {
+	ticker := time.NewTicker(gc.params.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			// In a cluster, the leader collects the garbage of all nodes,
+			// since its deletes are replicated, as does the primary for its
+			// standby and read replicas. Each region collects its own garbage
+			// and replicates its deletes to the others
+			if h.cluster != nil && !h.cluster.IsLeader() ||
+				h.replica != nil && !h.replica.Primary() {
+				continue
+			}
+			usernames, err := h.users.List()
+			if err != nil {
+				jww.ERROR.Printf("Failed to list users to collect garbage: "+
+					"%+v", err)
+				continue
+			}
+			report, _ := gc.Run(
+				h.storageDir, h.newStore, usernames, nil, gc.params.DryRun)
+			verb := "removed"
+			if gc.params.DryRun {
+				verb = "would remove"
+			}
+			jww.INFO.Printf("Garbage collection of %d users %s %d files of "+
+				"inactive users, %d log entries, and the versions of %d "+
+				"deleted files; %d users failed.", report.Users, verb,
+				report.Count(GCInactiveUsers), report.Count(GCLogs),
+				report.Count(GCTombstones), len(report.Failed))
+		}
+	}
+}
+
+// collect runs the policies on the files of the user's store and adds the
+// files it removes to the report. The files of an inactive user are all
+// removed, so the other policies are not run on them.
+func (gc *GarbageCollector) collect(s store.Store, username string,
+	run map[string]bool, now time.Time, dryRun bool, report *GCReport) error {
+	lister, ok := s.(store.Lister)
+	if !ok {
+		return store.NotListableErr
+	}
+	files, err := lister.ListFiles()
+	if err != nil {
+		return err
+	}
+	modified := make(map[string]time.Time, len(files))
+	var lastWrite time.Time
+	for _, file := range files {
+		if modified[file], err = s.GetLastModified(file); err != nil {
+			return errors.Wrapf(err, "failed to get modification time of %s",
+				file)
+		} else if modified[file].After(lastWrite) {
+			lastWrite = modified[file]
+		}
+	}
+	versioner, _ := s.(store.Versioner)
+
+	remove := func(policy, file string) error {
+		report.Actions = append(report.Actions, GCAction{
+			Policy: policy, User: username, Path: file})
+		jww.DEBUG.Printf("Garbage collection (%s, dry run %t): removing %s "+
+			"of %q.", policy, dryRun, file, username)
+		if dryRun {
+			return nil
+		}
+		if policy != GCTombstones {
+			err := s.Delete(file)
+			if err != nil && !errors.Is(err, os.ErrNotExist) {
+				return errors.Wrapf(err, "failed to remove %s", file)
+			}
+		}
+		if versioner != nil {
+			if err := versioner.PurgeVersions(file); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if run[GCInactiveUsers] && len(files) > 0 &&
+		now.Sub(lastWrite) > gc.params.InactiveUsers {
+		// The versions of files that were already deleted are also removed
+		if versioner != nil {
+			versioned, err := versioner.VersionedFiles()
+			if err != nil {
+				return err
+			}
+			for _, file := range versioned {
+				if _, exists := modified[file]; !exists {
+					files = append(files, file)
+				}
+			}
+		}
+		for _, file := range files {
+			if err = remove(GCInactiveUsers, file); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if run[GCLogs] {
+		for _, file := range gc.trimLogs(files, modified) {
+			if err = remove(GCLogs, file); err != nil {
+				return err
+			}
+		}
+	}
+
+	if run[GCTombstones] && versioner != nil {
+		deleted, err := versioner.VersionedFiles()
+		if err != nil {
+			return err
+		}
+		for _, file := range deleted {
+			if _, exists := modified[file]; exists {
+				continue
+			}
+			versions, err := versioner.ListVersions(file)
+			if err != nil {
+				return err
+			}
+			n := len(versions)
+			if n > 0 && versions[n-1].Deleted &&
+				now.Sub(versions[n-1].Replaced) > gc.params.Tombstones {
+				if err = remove(GCTombstones, file); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// trimLogs returns the entries of the transaction logs among the files that
+// exceed the maximum number of entries of their log, oldest first. Each file
+// belongs to the first log whose path matches its directory.
+func (gc *GarbageCollector) trimLogs(
+	files []string, modified map[string]time.Time) []string {
+	logs := make(map[string][]string)
+	maxEntries := make(map[string]int)
+	for _, file := range files {
+		dir := path.Dir(file)
+		for _, l := range gc.params.Logs {
+			if matched, _ := path.Match(l.Path, dir); matched {
+				logs[dir] = append(logs[dir], file)
+				maxEntries[dir] = l.MaxEntries
+				break
+			}
+		}
+	}
+
+	dirs := make([]string, 0, len(logs))
+	for dir := range logs {
+		dirs = append(dirs, dir)
+	}
+	sort.Strings(dirs)
+
+	var trimmed []string
+	for _, dir := range dirs {
+		entries := logs[dir]
+		if len(entries) <= maxEntries[dir] {
+			continue
+		}
+		sort.SliceStable(entries, func(i, j int) bool {
+			return modified[entries[i]].Before(modified[entries[j]])
+		})
+		trimmed = append(trimmed, entries[:len(entries)-maxEntries[dir]]...)
+	}
+
+	return trimmed
+}
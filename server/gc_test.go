@@ -0,0 +1,212 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package server
+
+import (
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+
+	"gitlab.com/elixxir/remoteSyncServer/storage"
+	"gitlab.com/elixxir/remoteSyncServer/store"
+)
+
+// newTestGCStore returns a NewStore of the memory backend, which keeps each
+// user's files between calls, wrapped in versioning if versioned is true.
+func newTestGCStore(versioned bool, t *testing.T) store.NewStore {
+	backend, err := storage.GetBackend(store.MemoryBackend)
+	if err != nil {
+		t.Fatalf("Failed to get memory backend: %+v", err)
+	}
+	newStore, err := backend(nil)
+	if err != nil {
+		t.Fatalf("Failed to create memory backend: %+v", err)
+	}
+	if versioned {
+		newStore, err = store.NewVersionedStore(nil, newStore)
+		if err != nil {
+			t.Fatalf("Failed to create versioned store: %+v", err)
+		}
+	}
+	return newStore
+}
+
+// writeTestFiles writes each of the files to the user's store.
+func writeTestFiles(newStore store.NewStore, username string,
+	t *testing.T, files ...string) store.Store {
+	s, err := newStore("", username)
+	if err != nil {
+		t.Fatalf("Failed to create store of %q: %+v", username, err)
+	}
+	for _, file := range files {
+		if err = s.Write(file, []byte(file)); err != nil {
+			t.Fatalf("Failed to write %s: %+v", file, err)
+		}
+	}
+	return s
+}
+
+// listTestFiles returns the files of the store.
+func listTestFiles(s store.Store, t *testing.T) []string {
+	files, err := s.(store.Lister).ListFiles()
+	if err != nil {
+		t.Fatalf("Failed to list files: %+v", err)
+	}
+	return files
+}
+
+// Tests that the inactiveUsers policy removes all files of users who have not
+// written for longer than the limit and only reports them in a dry run.
+func TestGarbageCollector_Run_InactiveUsers(t *testing.T) {
+	gc, err := NewGarbageCollector(
+		map[string]interface{}{"inactiveUsers": "50ms"})
+	if err != nil {
+		t.Fatalf("Failed to create garbage collector: %+v", err)
+	}
+	newStore := newTestGCStore(true, t)
+	inactive := writeTestFiles(newStore, "inactive", t, "a", "dir/b")
+	_ = inactive.Delete("dir/b")
+	time.Sleep(60 * time.Millisecond)
+	active := writeTestFiles(newStore, "active", t, "a")
+
+	users := []string{"active", "inactive"}
+	report, err := gc.Run("", newStore, users, nil, true)
+	if err != nil {
+		t.Fatalf("Failed to run dry run: %+v", err)
+	}
+	expected := []GCAction{{GCInactiveUsers, "inactive", "a"},
+		{GCInactiveUsers, "inactive", "dir/b"}}
+	if !reflect.DeepEqual(report.Actions, expected) {
+		t.Errorf("Unexpected actions.\nexpected: %+v\nreceived: %+v",
+			expected, report.Actions)
+	}
+	if files := listTestFiles(inactive, t); len(files) != 1 {
+		t.Errorf("Files removed in dry run: %q", files)
+	}
+
+	report, err = gc.Run("", newStore, users, nil, false)
+	if err != nil {
+		t.Fatalf("Failed to run: %+v", err)
+	} else if report.Count(GCInactiveUsers) != 2 || len(report.Failed) != 0 {
+		t.Errorf("Unexpected report: %+v", report)
+	}
+	if files := listTestFiles(inactive, t); len(files) != 0 {
+		t.Errorf("Files of inactive user not removed: %q", files)
+	}
+	paths, _ := inactive.(store.Versioner).VersionedFiles()
+	if len(paths) != 0 {
+		t.Errorf("Versions of inactive user not removed: %q", paths)
+	}
+	if files := listTestFiles(active, t); len(files) != 1 {
+		t.Errorf("Files of active user removed: %q", files)
+	}
+}
+
+// Tests that the logs policy removes the oldest entries of each log beyond the
+// maximum and does not remove files outside the logs.
+func TestGarbageCollector_Run_Logs(t *testing.T) {
+	gc, err := NewGarbageCollector(map[string]interface{}{
+		"logs": []interface{}{
+			map[string]interface{}{"path": "*/txlog", "maxEntries": 2}},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create garbage collector: %+v", err)
+	}
+	newStore := newTestGCStore(false, t)
+	s := writeTestFiles(newStore, "waldo", t, "device1/txlog/1",
+		"device1/txlog/2", "device1/txlog/3", "device2/txlog/1", "other/1",
+		"other/2", "other/3")
+	for i := 4; i <= 5; i++ {
+		time.Sleep(time.Millisecond)
+		writeTestFiles(newStore, "waldo", t, "device1/txlog/"+strconv.Itoa(i))
+	}
+
+	report, err := gc.Run("", newStore, []string{"waldo"}, nil, false)
+	if err != nil {
+		t.Fatalf("Failed to run: %+v", err)
+	}
+	if report.Count(GCLogs) != 3 {
+		t.Errorf("Unexpected report: %+v", report)
+	}
+	expected := []string{"device1/txlog/4", "device1/txlog/5",
+		"device2/txlog/1", "other/1", "other/2", "other/3"}
+	if files := listTestFiles(s, t); !reflect.DeepEqual(files, expected) {
+		t.Errorf("Unexpected files.\nexpected: %q\nreceived: %q",
+			expected, files)
+	}
+}
+
+// Tests that the tombstones policy removes the versions of files deleted
+// longer ago than the limit and keeps the versions of existing files.
+func TestGarbageCollector_Run_Tombstones(t *testing.T) {
+	gc, err := NewGarbageCollector(
+		map[string]interface{}{"tombstones": "50ms"})
+	if err != nil {
+		t.Fatalf("Failed to create garbage collector: %+v", err)
+	}
+	newStore := newTestGCStore(true, t)
+	s := writeTestFiles(newStore, "waldo", t, "old", "kept", "kept", "new")
+	_ = s.Write("kept", []byte("changed"))
+	_ = s.Delete("old")
+	time.Sleep(60 * time.Millisecond)
+	_ = s.Delete("new")
+
+	report, err := gc.Run("", newStore, []string{"waldo"}, nil, false)
+	if err != nil {
+		t.Fatalf("Failed to run: %+v", err)
+	}
+	expected := []GCAction{{GCTombstones, "waldo", "old"}}
+	if !reflect.DeepEqual(report.Actions, expected) {
+		t.Errorf("Unexpected actions.\nexpected: %+v\nreceived: %+v",
+			expected, report.Actions)
+	}
+	paths, _ := s.(store.Versioner).VersionedFiles()
+	if expected := []string{"kept", "new"}; !reflect.DeepEqual(
+		paths, expected) {
+		t.Errorf("Unexpected versioned files.\nexpected: %q\nreceived: %q",
+			expected, paths)
+	}
+}
+
+// Error path: Tests that GarbageCollector.Run returns an error for a policy
+// that is not set.
+func TestGarbageCollector_Run_PolicyError(t *testing.T) {
+	gc, err := NewGarbageCollector(
+		map[string]interface{}{"tombstones": "24h"})
+	if err != nil {
+		t.Fatalf("Failed to create garbage collector: %+v", err)
+	}
+	_, err = gc.Run("", newTestGCStore(false, t), nil,
+		[]string{GCInactiveUsers}, true)
+	if err == nil {
+		t.Error("Failed to get error for a policy that is not set.")
+	}
+}
+
+// Error path: Tests that NewGarbageCollector returns an error for invalid
+// parameters.
+func TestNewGarbageCollector_Error(t *testing.T) {
+	tests := map[string]map[string]interface{}{
+		"no policy":           {"interval": "1h"},
+		"zero interval":       {"interval": "0s", "tombstones": "1h"},
+		"negative inactivity": {"inactiveUsers": "-1h"},
+		"unknown key":         {"tombstones": "1h", "policy": "all"},
+		"log without path": {"logs": []interface{}{
+			map[string]interface{}{"maxEntries": 5}}},
+		"invalid log path": {"logs": []interface{}{
+			map[string]interface{}{"path": "[", "maxEntries": 5}}},
+		"zero maxEntries": {"logs": []interface{}{
+			map[string]interface{}{"path": "txlog"}}},
+	}
+	for name, params := range tests {
+		if _, err := NewGarbageCollector(params); err == nil {
+			t.Errorf("Failed to get error for %s.", name)
+		}
+	}
+}
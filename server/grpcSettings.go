@@ -0,0 +1,179 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package server
+
+import (
+	"math"
+	"net"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/net/http2"
+	"google.golang.org/grpc"
+)
+
+// minWindowSize is the smallest HTTP/2 flow control window, which is also its
+// initial size in the protocol.
+const minWindowSize = 65535
+
+// GRPCParams are the parameters of the gRPC server and of the HTTP/2
+// connections it is served over. They are set in the "grpc" section of the
+// config. A zero value keeps the default.
+type GRPCParams struct {
+	// KeepaliveTime is the interval of the TCP keepalive probes sent on idle
+	// connections, which keep the mappings of clients behind NATs and
+	// firewalls open and detect dead clients. A negative interval disables
+	// them. Defaults to 15s.
+	KeepaliveTime time.Duration `mapstructure:"keepaliveTime"`
+
+	// IdleTimeout is how long a connection without any requests in progress
+	// is kept open. Defaults to no timeout.
+	IdleTimeout time.Duration `mapstructure:"idleTimeout"`
+
+	// MaxConcurrentStreams is the maximum number of RPCs in progress on each
+	// connection. Defaults to 250.
+	MaxConcurrentStreams int `mapstructure:"maxConcurrentStreams"`
+
+	// InitialWindowSize is the flow control window of each RPC, in bytes,
+	// which bounds how much a client can send before the server reads it. It
+	// must be at least 65535. Defaults to 1 MiB.
+	InitialWindowSize int `mapstructure:"initialWindowSize"`
+
+	// InitialConnWindowSize is the flow control window of each connection, in
+	// bytes, shared by its RPCs. It must be at least 65535. Defaults to 1 MiB.
+	InitialConnWindowSize int `mapstructure:"initialConnWindowSize"`
+
+	// MaxRecvMsgSize is the largest message received, in bytes. The smaller
+	// of it and the maximum request size applies. Defaults to no limit.
+	MaxRecvMsgSize int `mapstructure:"maxRecvMsgSize"`
+
+	// MaxSendMsgSize is the largest message sent, in bytes. Defaults to no
+	// limit.
+	MaxSendMsgSize int `mapstructure:"maxSendMsgSize"`
+}
+
+// GRPCSettings are the tuned parameters of the gRPC server. Native gRPC is
+// served over net/http, so the keepalive, stream, and window parameters are
+// applied to the listeners and HTTP/2 servers rather than to gRPC.
+type GRPCSettings struct {
+	params GRPCParams
+}
+
+// NewGRPCSettings creates new GRPCSettings from the parameters. Returns an
+// error for unknown parameters, negative values, and sizes out of range.
+func NewGRPCSettings(params map[string]interface{}) (*GRPCSettings, error) {
+	var p GRPCParams
+	if err := decodeParams(params, &p, "gRPC"); err != nil {
+		return nil, err
+	}
+
+	if p.IdleTimeout < 0 {
+		return nil, errors.Errorf(
+			"idle timeout %s cannot be negative", p.IdleTimeout)
+	} else if p.MaxConcurrentStreams < 0 ||
+		int64(p.MaxConcurrentStreams) > math.MaxUint32 {
+		return nil, errors.Errorf("maximum concurrent streams %d must be 0 "+
+			"to %d", p.MaxConcurrentStreams, uint32(math.MaxUint32))
+	}
+	for name, size := range map[string]int{
+		"initial window size":            p.InitialWindowSize,
+		"initial connection window size": p.InitialConnWindowSize,
+	} {
+		if size != 0 && (size < minWindowSize || size > math.MaxInt32) {
+			return nil, errors.Errorf("%s %d must be %d to %d",
+				name, size, minWindowSize, math.MaxInt32)
+		}
+	}
+	for name, size := range map[string]int{
+		"maximum receive message size": p.MaxRecvMsgSize,
+		"maximum send message size":    p.MaxSendMsgSize,
+	} {
+		if size < 0 || size > math.MaxInt32 {
+			return nil, errors.Errorf(
+				"%s %d must be 0 to %d", name, size, math.MaxInt32)
+		}
+	}
+
+	return &GRPCSettings{params: p}, nil
+}
+
+// Params returns the parameters of the settings.
+func (gs *GRPCSettings) Params() GRPCParams {
+	return gs.params
+}
+
+// serverOptions returns the options of the gRPC server with the message sizes
+// of the settings, if not nil, and the maximum request size of the limits.
+func (gs *GRPCSettings) serverOptions(limits *Limits) []grpc.ServerOption {
+	opts := []grpc.ServerOption{grpc.MaxRecvMsgSize(gs.maxRecvMsgSize(limits))}
+	if gs != nil && gs.params.MaxSendMsgSize > 0 {
+		opts = append(opts, grpc.MaxSendMsgSize(gs.params.MaxSendMsgSize))
+	}
+	return opts
+}
+
+// maxRecvMsgSize returns the largest message the gRPC server receives, which
+// is the smaller of the maximum message size of the settings and the maximum
+// request size of the limits.
+func (gs *GRPCSettings) maxRecvMsgSize(limits *Limits) int {
+	size := limits.maxRecvMsgSize()
+	if gs != nil && gs.params.MaxRecvMsgSize > 0 &&
+		gs.params.MaxRecvMsgSize < size {
+		return gs.params.MaxRecvMsgSize
+	}
+	return size
+}
+
+// http2Server returns the HTTP/2 server configuration with the idle timeout,
+// stream limit, and window sizes of the settings, if not nil.
+func (gs *GRPCSettings) http2Server() *http2.Server {
+	if gs == nil {
+		return &http2.Server{}
+	}
+	return &http2.Server{
+		IdleTimeout:                  gs.params.IdleTimeout,
+		MaxConcurrentStreams:         uint32(gs.params.MaxConcurrentStreams),
+		MaxUploadBufferPerStream:     int32(gs.params.InitialWindowSize),
+		MaxUploadBufferPerConnection: int32(gs.params.InitialConnWindowSize),
+	}
+}
+
+// listener returns the listener with the keepalive interval of the settings
+// set on the TCP connections it accepts. The listener is returned unchanged if
+// the settings are nil or keep the default interval.
+func (gs *GRPCSettings) listener(l net.Listener) net.Listener {
+	if gs == nil || gs.params.KeepaliveTime == 0 {
+		return l
+	}
+	return &keepaliveListener{Listener: l, period: gs.params.KeepaliveTime}
+}
+
+// keepaliveListener sets the TCP keepalive interval of the connections it
+// accepts, or disables keepalives if the interval is negative.
+type keepaliveListener struct {
+	net.Listener
+	period time.Duration
+}
+
+// Accept waits for and returns the next connection with its keepalive
+// interval set. Connections other than TCP are returned unchanged.
+func (kl *keepaliveListener) Accept() (net.Conn, error) {
+	conn, err := kl.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	if tcpConn, ok := conn.(*net.TCPConn); ok {
+		if kl.period < 0 {
+			_ = tcpConn.SetKeepAlive(false)
+		} else {
+			_ = tcpConn.SetKeepAlive(true)
+			_ = tcpConn.SetKeepAlivePeriod(kl.period)
+		}
+	}
+	return conn, nil
+}
@@ -0,0 +1,138 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package server
+
+import (
+	"math"
+	"net"
+	"testing"
+	"time"
+)
+
+// newTestGRPCSettings returns GRPCSettings with the parameters.
+func newTestGRPCSettings(
+	t *testing.T, params map[string]interface{}) *GRPCSettings {
+	gs, err := NewGRPCSettings(params)
+	if err != nil {
+		t.Fatalf("Failed to create gRPC settings: %+v", err)
+	}
+	return gs
+}
+
+// Tests that NewGRPCSettings decodes the parameters and that the HTTP/2 server
+// uses them.
+func TestNewGRPCSettings(t *testing.T) {
+	gs := newTestGRPCSettings(t, map[string]interface{}{
+		"keepaliveTime": "30s", "idleTimeout": "1h",
+		"maxConcurrentStreams": "100", "initialWindowSize": 4 << 20,
+		"initialConnWindowSize": 16 << 20, "maxRecvMsgSize": 1 << 20,
+		"maxSendMsgSize": 2 << 20})
+	expected := GRPCParams{
+		KeepaliveTime:         30 * time.Second,
+		IdleTimeout:           time.Hour,
+		MaxConcurrentStreams:  100,
+		InitialWindowSize:     4 << 20,
+		InitialConnWindowSize: 16 << 20,
+		MaxRecvMsgSize:        1 << 20,
+		MaxSendMsgSize:        2 << 20,
+	}
+	if gs.Params() != expected {
+		t.Errorf("Unexpected parameters.\nexpected: %+v\nreceived: %+v",
+			expected, gs.Params())
+	}
+
+	h2 := gs.http2Server()
+	if h2.IdleTimeout != time.Hour || h2.MaxConcurrentStreams != 100 ||
+		h2.MaxUploadBufferPerStream != 4<<20 ||
+		h2.MaxUploadBufferPerConnection != 16<<20 {
+		t.Errorf("Unexpected HTTP/2 server: %+v", h2)
+	}
+}
+
+// Error path: Tests that NewGRPCSettings returns an error for unknown
+// parameters, negative values, and sizes out of range.
+func TestNewGRPCSettings_Error(t *testing.T) {
+	tests := []map[string]interface{}{
+		{"keepalive": "30s"},
+		{"idleTimeout": "-1s"},
+		{"maxConcurrentStreams": -1},
+		{"maxConcurrentStreams": int64(math.MaxUint32) + 1},
+		{"initialWindowSize": minWindowSize - 1},
+		{"initialConnWindowSize": int64(math.MaxInt32) + 1},
+		{"maxRecvMsgSize": -1},
+		{"maxSendMsgSize": int64(math.MaxInt32) + 1},
+	}
+	for _, params := range tests {
+		if _, err := NewGRPCSettings(params); err == nil {
+			t.Errorf("No error for parameters %+v.", params)
+		}
+	}
+}
+
+// Tests that GRPCSettings.maxRecvMsgSize returns the smaller of the maximum
+// message size and the maximum request size, and no limit without either.
+func TestGRPCSettings_maxRecvMsgSize(t *testing.T) {
+	tests := []struct {
+		gs       *GRPCSettings
+		limits   *Limits
+		expected int
+	}{
+		{nil, nil, math.MaxInt32},
+		{nil, &Limits{MaxRequestBytes: 1024}, 1024},
+		{&GRPCSettings{}, nil, math.MaxInt32},
+		{&GRPCSettings{GRPCParams{MaxRecvMsgSize: 512}}, nil, 512},
+		{&GRPCSettings{GRPCParams{MaxRecvMsgSize: 512}},
+			&Limits{MaxRequestBytes: 1024}, 512},
+		{&GRPCSettings{GRPCParams{MaxRecvMsgSize: 2048}},
+			&Limits{MaxRequestBytes: 1024}, 1024},
+	}
+	for i, tt := range tests {
+		if size := tt.gs.maxRecvMsgSize(tt.limits); size != tt.expected {
+			t.Errorf("Unexpected size for test %d."+
+				"\nexpected: %d\nreceived: %d", i, tt.expected, size)
+		}
+	}
+}
+
+// Tests that GRPCSettings.listener only wraps the listener with a keepalive
+// interval and that the wrapped listener accepts TCP connections.
+func TestGRPCSettings_listener(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %+v", err)
+	}
+	defer l.Close()
+
+	var gs *GRPCSettings
+	if gs.listener(l) != l {
+		t.Errorf("Listener wrapped without settings.")
+	}
+	gs = &GRPCSettings{}
+	if gs.listener(l) != l {
+		t.Errorf("Listener wrapped without a keepalive interval.")
+	}
+
+	gs = &GRPCSettings{GRPCParams{KeepaliveTime: 30 * time.Second}}
+	kl := gs.listener(l)
+	if _, ok := kl.(*keepaliveListener); !ok {
+		t.Fatalf("Listener not wrapped: %T", kl)
+	}
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatalf("Failed to dial: %+v", err)
+	}
+	defer conn.Close()
+	accepted, err := kl.Accept()
+	if err != nil {
+		t.Fatalf("Failed to accept: %+v", err)
+	}
+	defer accepted.Close()
+	if _, ok := accepted.(*net.TCPConn); !ok {
+		t.Errorf("Unexpected connection: %T", accepted)
+	}
+}
@@ -9,6 +9,10 @@ package server
 
 import (
 	"bytes"
+	"context"
+	"crypto/sha256"
+	"io"
+	"os"
 	"sync"
 	"time"
 
@@ -17,6 +21,8 @@ import (
 
 	pb "gitlab.com/elixxir/comms/mixmessages"
 	"gitlab.com/elixxir/crypto/hash"
+	"gitlab.com/elixxir/remoteSyncServer/credentials"
+	"gitlab.com/elixxir/remoteSyncServer/rpc"
 	"gitlab.com/elixxir/remoteSyncServer/store"
 	"gitlab.com/xx_network/comms/messages"
 	"gitlab.com/xx_network/crypto/nonce"
@@ -31,55 +37,55 @@ var (
 	// registered user or the password hashed with a salt does not match the
 	// expected password hash.
 	InvalidCredentialsErr = errors.New("invalid password or password")
+
+	// VersioningDisabledErr is returned when listing or reading the previous
+	// versions of a file while file versioning is not enabled.
+	VersioningDisabledErr = errors.New("file versioning is not enabled")
 )
 
 // handler handles the server stores for each token/user.
 type handler struct {
-	storageDir    string
-	tokenTTL      time.Duration
-	sessions      map[Token]*userSession
-	userTokens    map[string]Token  // Map of username to token
-	userPasswords map[string]string // Map of username to password (from CSV)
-	newStore      store.NewStore
-	mux           sync.Mutex
+	storageDir string
+	tokenTTL   time.Duration
+	sessions   map[Token]*userSession
+	userTokens map[string]Token  // Map of username to token
+	users      credentials.Store // Registered usernames and passwords
+	known      *KnownUsers       // Optional users whose storage was opened
+	hasher     *credentials.Argon2Hasher
+	oidc       *OIDCAuthenticator // Optional external identity provider
+	revoked    *RevocationList    // Optional list of revoked tokens
+	apiKeys    *APIKeys           // Optional API keys for automation
+	tracing    *Tracing           // Optional tracing of storage operations
+	uploads    *Uploads           // Optional resumable uploads
+	delta      *Delta             // Optional delta sync
+	changes    *ChangeFeed        // Optional change notifications
+	limits     *Limits            // Optional maximum sizes
+	cluster    *Cluster           // Optional Raft clustering
+	replica    *Replication       // Optional primary-standby replication
+	migration  *Migration         // Optional account migration
+	links      *Links             // Optional download links
+	policies   *UserPolicies      // Optional user quotas and bans
+	locks      userLocks          // Locks of the writes of each user
+	newStore   store.NewStore
+	mux        sync.Mutex
 }
 
-// newHandler generates a new store handler.
+// newHandler generates a new store handler. If hasher is not nil, passwords
+// are rehashed with it on PasswordLogin.
 //
 // Pass in Store.NewMemStore into newStore for testing.
 func newHandler(storageDir string, tokenTTL time.Duration,
-	userRecords [][]string, newStore store.NewStore) (*handler, error) {
-	userPasswords, err := userRecordsToMap(userRecords)
-	if err != nil {
-		return nil, err
-	}
-
+	users credentials.Store, hasher *credentials.Argon2Hasher,
+	newStore store.NewStore) *handler {
 	return &handler{
-		storageDir:    storageDir,
-		tokenTTL:      tokenTTL,
-		sessions:      make(map[Token]*userSession),
-		userTokens:    make(map[string]Token),
-		userPasswords: userPasswords,
-		newStore:      newStore,
-	}, nil
-}
-
-// userRecordsToMap converts the username/password records from a CSV to a map
-// of passwords keyed on each username. Note that this will overwrite any
-// passwords with duplicate usernames.
-func userRecordsToMap(records [][]string) (map[string]string, error) {
-	users := make(map[string]string, len(records))
-	for i, line := range records {
-		if len(line) < 2 {
-			return nil, errors.Errorf("could not process record %d of %d",
-				i, len(records))
-		}
-		users[line[0]] = line[1]
+		storageDir: storageDir,
+		tokenTTL:   tokenTTL,
+		sessions:   make(map[Token]*userSession),
+		userTokens: make(map[string]Token),
+		users:      users,
+		hasher:     hasher,
+		newStore:   newStore,
 	}
-	jww.DEBUG.Printf(
-		"Imported %d users from %d records.", len(users), len(records))
-
-	return users, nil
 }
 
 // Login is called when a new [mixmessages.RsAuthenticationRequest] is received.
@@ -114,19 +120,156 @@ func (h *handler) Login(
 	}, nil
 }
 
+// PasswordLogin is called when a new [rpc.RsPasswordLoginRequest] is received.
+// It authenticates the username and cleartext password and returns a token in
+// the same way as Login. If password hashing is enabled and the stored
+// password is cleartext or was hashed with outdated parameters, it is
+// rehashed.
+//
+// Returns [InvalidCredentialsErr] for invalid username or password.
+func (h *handler) PasswordLogin(
+	msg *rpc.RsPasswordLoginRequest) (*rpc.RsPasswordLoginResponse, error) {
+	jww.DEBUG.Printf(
+		"Received PasswordLogin message for user %q.", msg.GetUsername())
+
+	err := h.verifyPassword(msg.GetUsername(), msg.GetPassword())
+	if err != nil {
+		return nil, err
+	}
+
+	s, err := h.addSession(msg.GetUsername())
+	if err != nil {
+		return nil, err
+	}
+
+	jww.INFO.Printf("Added store for user %s that expires at %s",
+		msg.GetUsername(), s.ExpiryTime)
+
+	return &rpc.RsPasswordLoginResponse{
+		Token:     s.Value[:],
+		ExpiresAt: s.ExpiryTime.UnixNano(),
+	}, nil
+}
+
+// OIDCLogin is called when a new [rpc.RsOIDCLoginRequest] is received. It
+// authenticates the user with the OpenID Connect provider and returns a token
+// in the same way as Login. The user does not need to be registered in the
+// credential store.
+//
+// Returns [OIDCDisabledErr] if no provider is configured and
+// [InvalidCredentialsErr] if the ID token or authorization code is invalid.
+func (h *handler) OIDCLogin(ctx context.Context,
+	msg *rpc.RsOIDCLoginRequest) (*rpc.RsOIDCLoginResponse, error) {
+	jww.DEBUG.Printf("Received OIDCLogin message.")
+
+	if h.oidc == nil {
+		return nil, OIDCDisabledErr
+	}
+
+	username, err := h.oidc.Authenticate(ctx, msg.GetIDToken(), msg.GetCode(),
+		msg.GetRedirectURL(), msg.GetCodeVerifier())
+	if err != nil {
+		return nil, err
+	}
+
+	s, err := h.addSession(username)
+	if err != nil {
+		return nil, err
+	}
+
+	jww.INFO.Printf("Added store for OIDC user %s that expires at %s",
+		username, s.ExpiryTime)
+
+	return &rpc.RsOIDCLoginResponse{
+		Token:     s.Value[:],
+		ExpiresAt: s.ExpiryTime.UnixNano(),
+		Username:  username,
+	}, nil
+}
+
+// APIKeyLogin is called when a new [rpc.RsAPIKeyLoginRequest] is received. It
+// verifies the API key and returns a token for the user the key belongs to
+// that only allows the requests permitted by the key's scopes. The session is
+// separate from the user's own session, so logging in with a key does not
+// replace the user's token.
+//
+// Returns [APIKeysDisabledErr] if API keys are not enabled,
+// [InvalidAPIKeyErr] for an invalid key, and [InsufficientScopeErr] if the key
+// cannot access files.
+func (h *handler) APIKeyLogin(
+	msg *rpc.RsAPIKeyLoginRequest) (*rpc.RsAPIKeyLoginResponse, error) {
+	jww.DEBUG.Printf("Received APIKeyLogin message.")
+
+	if h.apiKeys == nil {
+		return nil, APIKeysDisabledErr
+	}
+
+	key, err := h.apiKeys.Verify(msg.GetKey())
+	if err != nil {
+		return nil, err
+	}
+	if !key.Scopes.Allows(ScopeRead) {
+		return nil, InsufficientScopeErr
+	}
+
+	s, err := h.addAPIKeySession(key.Username, key.Scopes)
+	if err != nil {
+		return nil, err
+	}
+
+	jww.INFO.Printf("Added store for API key %s of user %s that expires at %s",
+		key.ID, key.Username, s.ExpiryTime)
+
+	scopes := make([]string, len(key.Scopes))
+	for i, scope := range key.Scopes {
+		scopes[i] = string(scope)
+	}
+
+	return &rpc.RsAPIKeyLoginResponse{
+		Token:     s.Value[:],
+		ExpiresAt: s.ExpiryTime.UnixNano(),
+		Username:  key.Username,
+		Scopes:    scopes,
+	}, nil
+}
+
+// RefreshToken is called when a new [rpc.RsRefreshTokenRequest] is received.
+// It replaces the token with a new token that expires after the token TTL so
+// that the user does not need to log in again. The old token can no longer be
+// used.
+//
+// Returns [InvalidTokenErr] for an invalid or expired token.
+func (h *handler) RefreshToken(
+	msg *rpc.RsRefreshTokenRequest) (*rpc.RsRefreshTokenResponse, error) {
+	jww.TRACE.Printf("Received RefreshToken message.")
+
+	n, err := h.refreshSession(UnmarshalToken(msg.GetToken()))
+	if err != nil {
+		return nil, err
+	}
+
+	return &rpc.RsRefreshTokenResponse{
+		Token:     n.Value[:],
+		ExpiresAt: n.ExpiryTime.UnixNano(),
+	}, nil
+}
+
 // Read reads from the provided file path and returns the data in the file
 // at that path.
 //
 // An error is returned if it fails to read the file. Returns
 // [store.NonLocalFileErr] if the file is outside the base path,
-// [InvalidTokenErr] for an invalid token.
-func (h *handler) Read(msg *pb.RsReadRequest) (*pb.RsReadResponse, error) {
+// [InvalidTokenErr] for an invalid token, and [InsufficientScopeErr] if the
+// token does not allow reading.
+func (h *handler) Read(
+	ctx context.Context, msg *pb.RsReadRequest) (*pb.RsReadResponse, error) {
 	jww.TRACE.Printf("Received Read message: %s", msg)
 
-	s, err := h.getSession(UnmarshalToken(msg.GetToken()))
+	s, err := h.getScopedSession(UnmarshalToken(msg.GetToken()), ScopeRead)
 	if err != nil {
 		return nil, err
 	}
+	s = h.traced(ctx, s)
 
 	data, err := s.Read(msg.GetPath())
 	if err != nil {
@@ -138,20 +281,29 @@ func (h *handler) Read(msg *pb.RsReadRequest) (*pb.RsReadResponse, error) {
 
 // Write writes the provided data to the file path.
 //
-// An error is returned if the write fails. Returns [store.NonLocalFileErr] if
-// the file is outside the base path, [InvalidTokenErr] for an invalid token.
-func (h *handler) Write(msg *pb.RsWriteRequest) (*messages.Ack, error) {
+// An error is returned if the write fails. Returns [ObjectTooLargeErr] if the
+// data exceeds the maximum object size, [store.NonLocalFileErr] if the file is
+// outside the base path, [InvalidTokenErr] for an invalid token, and
+// [InsufficientScopeErr] if the token does not allow writing.
+func (h *handler) Write(
+	ctx context.Context, msg *pb.RsWriteRequest) (*messages.Ack, error) {
 	jww.TRACE.Printf("Received Write message: %s", msg)
 
-	s, err := h.getSession(UnmarshalToken(msg.GetToken()))
+	s, err := h.getScopedSession(UnmarshalToken(msg.GetToken()), ScopeWrite)
 	if err != nil {
 		return nil, err
 	}
+	if err = h.checkObject(int64(len(msg.GetData()))); err != nil {
+		return nil, err
+	}
+	unlock := h.lockWrites(s)
+	defer unlock()
 
-	err = s.Write(msg.GetPath(), msg.GetData())
+	err = h.traced(ctx, s).Write(msg.GetPath(), msg.GetData())
 	if err != nil {
 		return nil, err
 	}
+	h.setDevice(ctx, s, msg.GetPath(), msg.GetData())
 
 	return &messages.Ack{}, nil
 }
@@ -161,14 +313,15 @@ func (h *handler) Write(msg *pb.RsWriteRequest) (*messages.Ack, error) {
 //
 // Returns [store.NonLocalFileErr] if the file is outside the base path,
 // [InvalidTokenErr] for an invalid token.
-func (h *handler) GetLastModified(
+func (h *handler) GetLastModified(ctx context.Context,
 	msg *pb.RsReadRequest) (*pb.RsTimestampResponse, error) {
 	jww.TRACE.Printf("Received GetLastModified message: %s", msg)
 
-	s, err := h.getSession(UnmarshalToken(msg.GetToken()))
+	s, err := h.getScopedSession(UnmarshalToken(msg.GetToken()), ScopeRead)
 	if err != nil {
 		return nil, err
 	}
+	s = h.traced(ctx, s)
 
 	lastModified, err := s.GetLastModified(msg.GetPath())
 	if err != nil {
@@ -182,14 +335,15 @@ func (h *handler) GetLastModified(
 // operation that was performed.
 //
 // Returns [InvalidTokenErr] for an invalid token.
-func (h *handler) GetLastWrite(
+func (h *handler) GetLastWrite(ctx context.Context,
 	msg *pb.RsLastWriteRequest) (*pb.RsTimestampResponse, error) {
 	jww.TRACE.Printf("Received GetLastWrite message: %s", msg)
 
-	s, err := h.getSession(UnmarshalToken(msg.GetToken()))
+	s, err := h.getScopedSession(UnmarshalToken(msg.GetToken()), ScopeRead)
 	if err != nil {
 		return nil, err
 	}
+	s = h.traced(ctx, s)
 
 	lastModified, err := s.GetLastWrite()
 	if err != nil {
@@ -204,14 +358,15 @@ func (h *handler) GetLastWrite(
 //
 // Returns [store.NonLocalFileErr] if the file is outside the base path,
 // [InvalidTokenErr] for an invalid token.
-func (h *handler) ReadDir(
+func (h *handler) ReadDir(ctx context.Context,
 	msg *pb.RsReadRequest) (*pb.RsReadDirResponse, error) {
 	jww.TRACE.Printf("Received ReadDir message: %s", msg)
 
-	s, err := h.getSession(UnmarshalToken(msg.GetToken()))
+	s, err := h.getScopedSession(UnmarshalToken(msg.GetToken()), ScopeRead)
 	if err != nil {
 		return nil, err
 	}
+	s = h.traced(ctx, s)
 
 	directories, err := s.ReadDir(msg.GetPath())
 	if err != nil {
@@ -221,92 +376,1364 @@ func (h *handler) ReadDir(
 	return &pb.RsReadDirResponse{Data: directories}, nil
 }
 
-// verifyUser verifies the username and password are correct. Returns
-// InvalidCredentialsErr for incorrect username or password.
-func (h *handler) verifyUser(username string, passwordHash, salt []byte) error {
-	h.mux.Lock()
-	defer h.mux.Unlock()
+// ListDir returns a page of the entries of the named directory whose names
+// start with the prefix, in the sort order, and the token of the next page.
+//
+// Returns [InvalidListRequestErr] for an invalid page size, sort order, or page
+// token, [store.NonLocalFileErr] if the directory is outside the base path,
+// [InvalidTokenErr] for an invalid token, and [InsufficientScopeErr] if the
+// token does not allow reading.
+func (h *handler) ListDir(ctx context.Context,
+	msg *rpc.RsListDirRequest) (*rpc.RsListDirResponse, error) {
+	jww.TRACE.Printf("Received ListDir message: %s", msg)
 
-	clearTextPassword, exists := h.userPasswords[username]
-	if !exists {
-		return InvalidCredentialsErr
+	s, err := h.getScopedSession(UnmarshalToken(msg.GetToken()), ScopeRead)
+	if err != nil {
+		return nil, err
 	}
+	s = h.traced(ctx, s)
 
-	if !bytes.Equal(hashPassword(clearTextPassword, salt), passwordHash) {
-		return InvalidCredentialsErr
+	entries, err := s.ReadDir(msg.GetPath())
+	if err != nil {
+		return nil, err
 	}
 
-	return nil
+	page, next, err := listPage(entries, msg.GetPrefix(), msg.GetPageSize(),
+		msg.GetPageToken(), msg.GetOrder())
+	if err != nil {
+		return nil, err
+	}
+
+	return &rpc.RsListDirResponse{Entries: page, NextPageToken: next}, nil
 }
 
-func hashPassword(clearTextPassword string, salt []byte) []byte {
-	h := hash.CMixHash.New()
-	h.Write([]byte(clearTextPassword))
-	h.Write(salt)
-	return h.Sum(nil)
+// ListVersions returns the previous versions of the file at the path, oldest
+// first.
+//
+// Returns [VersioningDisabledErr] if versioning is not enabled,
+// [store.ReservedPathErr] if the path is in the versions directory,
+// [InvalidTokenErr] for an invalid token, and [InsufficientScopeErr] if the
+// token does not allow reading.
+func (h *handler) ListVersions(
+	msg *rpc.RsListVersionsRequest) (*rpc.RsListVersionsResponse, error) {
+	jww.TRACE.Printf("Received ListVersions message: %s", msg)
+
+	versioner, err := h.getVersioner(UnmarshalToken(msg.GetToken()))
+	if err != nil {
+		return nil, err
+	}
+
+	versions, err := versioner.ListVersions(msg.GetPath())
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &rpc.RsListVersionsResponse{
+		Versions: make([]*rpc.RsVersion, len(versions))}
+	for i, v := range versions {
+		resp.Versions[i] = &rpc.RsVersion{
+			ID:       v.ID,
+			Modified: v.Modified.UnixNano(),
+			Replaced: v.Replaced.UnixNano(),
+			Size:     v.Size,
+			Deleted:  v.Deleted,
+		}
+	}
+
+	return resp, nil
 }
 
-// getSession returns the store for the given token. Returns [InvalidTokenErr]
-// for an invalid token.
-func (h *handler) getSession(token Token) (store.Store, error) {
-	h.mux.Lock()
-	defer h.mux.Unlock()
+// ReadVersion returns the data of the previous version of the file at the path
+// with the ID.
+//
+// Returns [VersioningDisabledErr] if versioning is not enabled,
+// [os.ErrNotExist] if the file has no version with the ID, [InvalidTokenErr]
+// for an invalid token, and [InsufficientScopeErr] if the token does not allow
+// reading.
+func (h *handler) ReadVersion(
+	msg *rpc.RsReadVersionRequest) (*rpc.RsReadVersionResponse, error) {
+	jww.TRACE.Printf("Received ReadVersion message: %s", msg)
 
-	s, exists := h.sessions[token]
-	if !exists {
-		return nil, InvalidTokenErr
+	versioner, err := h.getVersioner(UnmarshalToken(msg.GetToken()))
+	if err != nil {
+		return nil, err
 	}
 
-	// If the store is no longer valid, then delete it and its token from their
-	// respective maps
-	if !s.IsValid() {
-		delete(h.sessions, token)
-		delete(h.userTokens, s.username)
-		return nil, InvalidTokenErr
+	data, err := versioner.ReadVersion(msg.GetPath(), msg.GetID())
+	if err != nil {
+		return nil, err
 	}
 
-	return s, nil
+	return &rpc.RsReadVersionResponse{Data: data}, nil
 }
 
-// addSession generates a new Token and expiration time. On first login, it
-// initializes a new storage directory for user. On subsequent logins, it
-// overwrites the token with the new token gives access to the user's directory.
-func (h *handler) addSession(username string) (*userSession, error) {
-	h.mux.Lock()
-	defer h.mux.Unlock()
+// getVersioner returns the store for the given token if it keeps previous
+// versions and its session allows reading.
+//
+// Returns [VersioningDisabledErr] if the store does not keep versions,
+// [InvalidTokenErr] for an invalid token, and [InsufficientScopeErr] if the
+// scope is not allowed.
+func (h *handler) getVersioner(token Token) (store.Versioner, error) {
+	s, err := h.getScopedSession(token, ScopeRead)
+	if err != nil {
+		return nil, err
+	}
 
-	var token Token
-	var n nonce.Nonce
-	var err error
-	for exists := true; exists; _, exists = h.sessions[token] {
-		// Generate a new nonce and token
-		n, err = nonce.NewNonce(uint(h.tokenTTL.Seconds()))
-		if err != nil {
-			// This error cannot currently happen
-			return nil, err
-		}
-		token = Token(n.Value)
+	versioner, ok := s.(*userSession).Store.(store.Versioner)
+	if !ok {
+		return nil, VersioningDisabledErr
 	}
 
-	if oldToken, exists := h.userTokens[username]; exists {
-		// If an old token is registered, update the token in the sessions map
-		jww.DEBUG.Printf("Updating token for user %s.", username)
-		h.sessions[token] = h.sessions[oldToken]
-		h.sessions[token].Value = nonce.Value(token)
-		delete(h.sessions, oldToken)
-	} else {
-		// If no token exists, create a new store instance and put in the map
-		jww.DEBUG.Printf("Creating new token for user %s.", username)
+	return versioner, nil
+}
 
-		us, err := newUserSession(h.storageDir, username, n, h.newStore)
-		if err != nil {
-			return nil, err
-		}
-		h.sessions[token] = &us
+// StartUpload starts a resumable upload of a file by the logged-in user.
+//
+// Returns [UploadsDisabledErr] if resumable uploads are not enabled,
+// [UploadSizeErr] if the file is too large for an upload, [ObjectTooLargeErr]
+// if it exceeds the maximum object size, [UploadLimitErr] if the user has too
+// many unfinished uploads, [InvalidTokenErr] for an invalid token, and
+// [InsufficientScopeErr] if the token does not allow writing.
+func (h *handler) StartUpload(
+	msg *rpc.RsStartUploadRequest) (*rpc.RsStartUploadResponse, error) {
+	jww.TRACE.Printf("Received StartUpload for %q of %d bytes.",
+		msg.GetPath(), msg.GetSize())
+
+	s, err := h.getUploadSession(UnmarshalToken(msg.GetToken()))
+	if err != nil {
+		return nil, err
+	} else if err = h.checkObject(msg.GetSize()); err != nil {
+		return nil, err
 	}
 
-	// Update to the newest token
-	h.userTokens[username] = token
+	id, err := h.uploads.Start(
+		s.username, msg.GetPath(), msg.GetSize(), msg.GetSHA256())
+	if err != nil {
+		return nil, err
+	}
 
-	return h.sessions[token], nil
+	return &rpc.RsStartUploadResponse{
+		UploadID: id, ChunkSize: h.uploads.Params().ChunkSize}, nil
+}
+
+// UploadChunk appends a chunk of data to an upload of the logged-in user.
+//
+// Returns [UploadsDisabledErr] if resumable uploads are not enabled,
+// [UnknownUploadErr] if the user has no upload with the ID, [UploadOffsetErr]
+// if the offset is not the number of bytes received, [UploadSizeErr] if the
+// chunk is too large, [InvalidTokenErr] for an invalid token, and
+// [InsufficientScopeErr] if the token does not allow writing.
+func (h *handler) UploadChunk(
+	msg *rpc.RsUploadChunkRequest) (*rpc.RsUploadChunkResponse, error) {
+	// The data is not logged, since chunks are large
+	jww.TRACE.Printf("Received UploadChunk for %s of %d bytes at %d.",
+		msg.GetUploadID(), len(msg.GetData()), msg.GetOffset())
+
+	s, err := h.getUploadSession(UnmarshalToken(msg.GetToken()))
+	if err != nil {
+		return nil, err
+	}
+
+	received, err := h.uploads.Append(
+		s.username, msg.GetUploadID(), msg.GetOffset(), msg.GetData())
+	if err != nil {
+		return nil, err
+	}
+
+	return &rpc.RsUploadChunkResponse{Received: received}, nil
+}
+
+// GetUpload returns the progress of an upload of the logged-in user.
+//
+// Returns [UploadsDisabledErr] if resumable uploads are not enabled,
+// [UnknownUploadErr] if the user has no upload with the ID, [InvalidTokenErr]
+// for an invalid token, and [InsufficientScopeErr] if the token does not allow
+// writing.
+func (h *handler) GetUpload(
+	msg *rpc.RsGetUploadRequest) (*rpc.RsGetUploadResponse, error) {
+	jww.TRACE.Printf("Received GetUpload message: %s", msg)
+
+	s, err := h.getUploadSession(UnmarshalToken(msg.GetToken()))
+	if err != nil {
+		return nil, err
+	}
+
+	us, err := h.uploads.Status(s.username, msg.GetUploadID())
+	if err != nil {
+		return nil, err
+	}
+
+	return &rpc.RsGetUploadResponse{
+		Path:     us.Path,
+		Size:     us.Size,
+		Received: us.Received,
+		Expires:  us.Expires.UnixNano(),
+	}, nil
+}
+
+// FinishUpload writes the file of a complete upload of the logged-in user and
+// removes the upload. If the file cannot be written, the upload is kept so
+// that finishing it can be retried, unless its path is invalid.
+//
+// Returns [UploadsDisabledErr] if resumable uploads are not enabled,
+// [UnknownUploadErr] if the user has no upload with the ID,
+// [UploadIncompleteErr] if not all data was received, [UploadHashErr] if the
+// data does not match its hash, [store.NonLocalFileErr] if the file is outside
+// the base path, [InvalidTokenErr] for an invalid token, and
+// [InsufficientScopeErr] if the token does not allow writing.
+func (h *handler) FinishUpload(ctx context.Context,
+	msg *rpc.RsFinishUploadRequest) (*rpc.RsFinishUploadResponse, error) {
+	jww.TRACE.Printf("Received FinishUpload message: %s", msg)
+
+	s, err := h.getUploadSession(UnmarshalToken(msg.GetToken()))
+	if err != nil {
+		return nil, err
+	}
+
+	path, data, err := h.uploads.complete(s.username, msg.GetUploadID())
+	if err != nil {
+		return nil, err
+	}
+
+	unlock := h.lockWrites(s)
+	defer unlock()
+	err = h.traced(ctx, s).Write(path, data)
+	if err != nil && !errors.Is(err, store.NonLocalFileErr) &&
+		!errors.Is(err, store.ReservedPathErr) {
+		return nil, err
+	}
+	h.uploads.remove(msg.GetUploadID())
+	if err != nil {
+		return nil, err
+	}
+	h.setDevice(ctx, s, path, data)
+
+	return &rpc.RsFinishUploadResponse{Path: path}, nil
+}
+
+// CancelUpload discards an upload of the logged-in user.
+//
+// Returns [UploadsDisabledErr] if resumable uploads are not enabled,
+// [UnknownUploadErr] if the user has no upload with the ID, [InvalidTokenErr]
+// for an invalid token, and [InsufficientScopeErr] if the token does not allow
+// writing.
+func (h *handler) CancelUpload(
+	msg *rpc.RsCancelUploadRequest) (*rpc.RsCancelUploadResponse, error) {
+	jww.TRACE.Printf("Received CancelUpload message: %s", msg)
+
+	s, err := h.getUploadSession(UnmarshalToken(msg.GetToken()))
+	if err != nil {
+		return nil, err
+	}
+
+	if err = h.uploads.Cancel(s.username, msg.GetUploadID()); err != nil {
+		return nil, err
+	}
+
+	return &rpc.RsCancelUploadResponse{}, nil
+}
+
+// getUploadSession returns the session for the given token if resumable
+// uploads are enabled and the session allows writing.
+//
+// Returns [UploadsDisabledErr] if resumable uploads are not enabled,
+// [InvalidTokenErr] for an invalid token, and [InsufficientScopeErr] if the
+// token does not allow writing.
+func (h *handler) getUploadSession(token Token) (*userSession, error) {
+	if h.uploads == nil {
+		return nil, UploadsDisabledErr
+	}
+
+	s, err := h.getScopedSession(token, ScopeWrite)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.(*userSession), nil
+}
+
+// GetSignature returns the signature of the file at the path, from which the
+// client computes a delta to its new data.
+//
+// Returns [DeltaDisabledErr] if delta sync is not enabled, [InvalidDeltaErr]
+// if the block size is out of range, [os.ErrNotExist] if the file does not
+// exist, [store.NonLocalFileErr] if the file is outside the base path,
+// [InvalidTokenErr] for an invalid token, and [InsufficientScopeErr] if the
+// token does not allow reading.
+func (h *handler) GetSignature(ctx context.Context,
+	msg *rpc.RsGetSignatureRequest) (*rpc.RsGetSignatureResponse, error) {
+	jww.TRACE.Printf("Received GetSignature message: %s", msg)
+
+	s, err := h.getDeltaSession(UnmarshalToken(msg.GetToken()), ScopeRead)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := h.traced(ctx, s).Read(msg.GetPath())
+	if err != nil {
+		return nil, err
+	}
+
+	sig, err := h.delta.Signature(data, int(msg.GetBlockSize()))
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &rpc.RsGetSignatureResponse{
+		BlockSize: int64(sig.BlockSize),
+		Size:      sig.Size,
+		SHA256:    sig.SHA256,
+		Blocks:    make([]*rpc.RsBlockSignature, len(sig.Blocks)),
+	}
+	for i, b := range sig.Blocks {
+		resp.Blocks[i] = &rpc.RsBlockSignature{Weak: b.Weak, Strong: b.Strong}
+	}
+
+	return resp, nil
+}
+
+// ApplyDelta writes the file at the path reconstructed from its stored data
+// and the delta.
+//
+// Returns [DeltaDisabledErr] if delta sync is not enabled, [DeltaBaseErr] if
+// the stored data does not match the hash of the signature, [InvalidDeltaErr]
+// if the delta is invalid or too large, [ObjectTooLargeErr] if the
+// reconstructed data exceeds the maximum object size, [DeltaHashErr] if it
+// does not match its hash, [os.ErrNotExist] if the file does not exist,
+// [store.NonLocalFileErr] if the file is outside the base path,
+// [InvalidTokenErr] for an invalid token, and [InsufficientScopeErr] if the
+// token does not allow writing.
+func (h *handler) ApplyDelta(ctx context.Context,
+	msg *rpc.RsApplyDeltaRequest) (*rpc.RsApplyDeltaResponse, error) {
+	// The operations are not logged, since their data is large
+	jww.TRACE.Printf("Received ApplyDelta for %q with %d operations.",
+		msg.GetPath(), len(msg.GetOps()))
+
+	s, err := h.getDeltaSession(UnmarshalToken(msg.GetToken()), ScopeWrite)
+	if err != nil {
+		return nil, err
+	}
+	unlock := h.lockWrites(s)
+	defer unlock()
+	session := s
+	s = h.traced(ctx, s)
+
+	base, err := s.Read(msg.GetPath())
+	if err != nil {
+		return nil, err
+	}
+	if sum := sha256.Sum256(base); !bytes.Equal(sum[:], msg.GetBaseSHA256()) {
+		return nil, errors.Wrapf(DeltaBaseErr, "SHA-256 hash %x, expected %x",
+			sum, msg.GetBaseSHA256())
+	}
+
+	ops := make([]DeltaOp, len(msg.GetOps()))
+	for i, op := range msg.GetOps() {
+		ops[i] = DeltaOp{
+			Block: int(op.GetBlock()),
+			Count: int(op.GetCount()),
+			Data:  op.GetData(),
+		}
+	}
+	data, err := h.delta.Apply(base, int(msg.GetBlockSize()), ops)
+	if err != nil {
+		return nil, err
+	} else if err = h.checkObject(int64(len(data))); err != nil {
+		return nil, err
+	}
+	if len(msg.GetSHA256()) != 0 {
+		if sum := sha256.Sum256(data); !bytes.Equal(sum[:], msg.GetSHA256()) {
+			return nil, errors.Wrapf(DeltaHashErr,
+				"SHA-256 hash %x, expected %x", sum, msg.GetSHA256())
+		}
+	}
+
+	if err = s.Write(msg.GetPath(), data); err != nil {
+		return nil, err
+	}
+	h.setDevice(ctx, session, msg.GetPath(), data)
+
+	return &rpc.RsApplyDeltaResponse{Size: int64(len(data))}, nil
+}
+
+// Watch sends each change to the files of the user whose path starts with the
+// path with send as it happens, until the context is done. An empty event is
+// sent when no event has been sent for the keepalive interval. The token is
+// checked again before each event is sent.
+//
+// Returns [ChangesDisabledErr] if change notifications are not enabled,
+// [TooManyWatchersErr] if the user has the maximum number of watch streams,
+// [WatcherLaggedErr] if changes were dropped because they were not sent fast
+// enough, [InvalidTokenErr] for an invalid token or once it expires or is
+// revoked, and [InsufficientScopeErr] if the token does not allow reading.
+func (h *handler) Watch(ctx context.Context, msg *rpc.RsWatchRequest,
+	send func(*rpc.RsChangeEvent) error) error {
+	jww.TRACE.Printf("Received Watch message: %s", msg)
+
+	if h.changes == nil {
+		return ChangesDisabledErr
+	}
+	token := UnmarshalToken(msg.GetToken())
+	s, err := h.getScopedSession(token, ScopeRead)
+	if err != nil {
+		return err
+	}
+	username := s.(*userSession).username
+	w, err := h.changes.watch(username, msg.GetPath())
+	if err != nil {
+		return err
+	}
+	defer h.changes.unwatch(username, w)
+
+	var keepalive *time.Ticker
+	var keepaliveC <-chan time.Time
+	if interval := h.changes.params.KeepaliveInterval; interval > 0 {
+		keepalive = time.NewTicker(interval)
+		defer keepalive.Stop()
+		keepaliveC = keepalive.C
+	}
+	for {
+		event := &rpc.RsChangeEvent{}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-w.lagged:
+			return WatcherLaggedErr
+		case c := <-w.changes:
+			event = &rpc.RsChangeEvent{Path: c.Path,
+				Timestamp: c.Time.UnixNano(), Deleted: c.Deleted}
+		case <-keepaliveC:
+		}
+
+		if _, err = h.getScopedSession(token, ScopeRead); err != nil {
+			return err
+		} else if err = send(event); err != nil {
+			return err
+		}
+		if keepalive != nil {
+			keepalive.Reset(h.changes.params.KeepaliveInterval)
+		}
+	}
+}
+
+// Download sends the file at the path with the function in chunks, starting
+// at the offset. The file is read from the store as it is sent, so that large
+// files are not held in memory, and each chunk is read once the previous one
+// was sent. The chunks are read into a buffer that is reused by other
+// downloads, so the function must not keep their data.
+//
+// Returns [InvalidDownloadErr] for a negative chunk size or an offset outside
+// the file, [DownloadChangedErr] if the file is changed during the download,
+// [store.NonLocalFileErr] if the file is outside the base path,
+// [InvalidTokenErr] for an invalid token, and [InsufficientScopeErr] if the
+// token does not allow reading.
+func (h *handler) Download(ctx context.Context, msg *rpc.RsDownloadRequest,
+	send func(*rpc.RsDownloadChunk) error) error {
+	jww.TRACE.Printf("Received Download message: %s", msg)
+
+	s, err := h.getScopedSession(UnmarshalToken(msg.GetToken()), ScopeRead)
+	if err != nil {
+		return err
+	}
+	chunkSize, err := downloadChunkSize(msg.GetChunkSize())
+	if err != nil {
+		return err
+	}
+	s = h.traced(ctx, s.(*userSession).Store)
+
+	path := msg.GetPath()
+	lastModified, err := s.GetLastModified(path)
+	if err != nil {
+		return err
+	}
+	r, size, err := store.Open(s, path)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = r.Close() }()
+
+	offset := msg.GetOffset()
+	if offset < 0 || offset > size {
+		return errors.Wrapf(InvalidDownloadErr,
+			"offset %d outside file of %d bytes", offset, size)
+	} else if err = skip(r, offset); err != nil {
+		return err
+	}
+
+	pooled := chunkBuffers.Get().(*[]byte)
+	defer chunkBuffers.Put(pooled)
+	buf := (*pooled)[:chunkSize]
+	for {
+		n, err := io.ReadFull(r, buf)
+		if errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, io.EOF) {
+			err = nil
+		} else if err != nil {
+			return errors.Wrapf(err, "failed to read %q", path)
+		}
+
+		// The last chunk is sent once the file is known to be unchanged, so
+		// that a client never completes a download of a torn file
+		last := n < chunkSize || offset+int64(n) == size
+		if last {
+			modified, err := s.GetLastModified(path)
+			if err != nil {
+				return err
+			} else if !modified.Equal(lastModified) ||
+				offset+int64(n) != size {
+				return DownloadChangedErr
+			}
+		}
+
+		err = send(&rpc.RsDownloadChunk{
+			Offset:       offset,
+			Data:         buf[:n],
+			Size:         size,
+			LastModified: lastModified.UnixNano(),
+		})
+		if err != nil || last {
+			return err
+		}
+		offset += int64(n)
+	}
+}
+
+// Stat returns the metadata of the file at the path. Its creation time and the
+// device that wrote it are only known if the server tracks metadata.
+//
+// Returns [os.ErrNotExist] if the file does not exist,
+// [store.NonLocalFileErr] if the file is outside the base path,
+// [InvalidTokenErr] for an invalid token, and [InsufficientScopeErr] if the
+// token does not allow reading.
+func (h *handler) Stat(
+	ctx context.Context, msg *rpc.RsStatRequest) (*rpc.RsStatResponse, error) {
+	jww.TRACE.Printf("Received Stat message: %s", msg)
+
+	s, err := h.getScopedSession(UnmarshalToken(msg.GetToken()), ScopeRead)
+	if err != nil {
+		return nil, err
+	}
+
+	md, err := store.Stat(h.traced(ctx, s.(*userSession).Store), msg.GetPath())
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &rpc.RsStatResponse{
+		Size:     md.Size,
+		SHA256:   md.SHA256,
+		Modified: md.Modified.UnixNano(),
+		Device:   md.Device,
+	}
+	if !md.Created.IsZero() {
+		resp.Created = md.Created.UnixNano()
+	}
+	return resp, nil
+}
+
+// CreateLink returns a signed link to the file at the path that expires after
+// the requested number of seconds, or the default if zero.
+//
+// Returns [LinksDisabledErr] if download links are not enabled,
+// [InvalidLinkTTLErr] if the duration is negative or too long,
+// [os.ErrNotExist] if the file does not exist, [store.NonLocalFileErr] if the
+// file is outside the base path, [InvalidTokenErr] for an invalid token, and
+// [InsufficientScopeErr] if the token does not allow reading.
+func (h *handler) CreateLink(ctx context.Context,
+	msg *rpc.RsCreateLinkRequest) (*rpc.RsCreateLinkResponse, error) {
+	jww.TRACE.Printf("Received CreateLink message: %s", msg)
+
+	if h.links == nil {
+		return nil, LinksDisabledErr
+	}
+	s, err := h.getScopedSession(UnmarshalToken(msg.GetToken()), ScopeRead)
+	if err != nil {
+		return nil, err
+	}
+	ttl, err := h.links.ttl(msg.GetTTL())
+	if err != nil {
+		return nil, err
+	}
+	if _, err = h.traced(ctx, s).GetLastModified(msg.GetPath()); err != nil {
+		return nil, err
+	}
+
+	expires := time.Now().Add(ttl).Truncate(time.Second)
+	return &rpc.RsCreateLinkResponse{
+		URL: h.links.url(
+			s.(*userSession).username, msg.GetPath(), expires),
+		Expires: expires.UnixNano(),
+	}, nil
+}
+
+// checkObject returns [ObjectTooLargeErr] if the size of a file exceeds the
+// maximum object size, if any.
+func (h *handler) checkObject(size int64) error {
+	if h.limits == nil {
+		return nil
+	}
+	return h.limits.checkObject(size)
+}
+
+// Commit applies the operations of a transaction in order, either all of them
+// or none of them, while no other write of the user is applied.
+//
+// Returns [InvalidTransactionErr] if there are no operations or too many,
+// [ObjectTooLargeErr] if the data of an operation exceeds the maximum object
+// size, the error of the first operation that fails, [RollbackErr] if the
+// operations before it cannot be undone, [InvalidTokenErr] for an invalid
+// token, and [InsufficientScopeErr] if the token does not allow writing.
+func (h *handler) Commit(ctx context.Context,
+	msg *rpc.RsCommitRequest) (*rpc.RsCommitResponse, error) {
+	// The operations are not logged, since their data is large
+	jww.TRACE.Printf(
+		"Received Commit with %d operations.", len(msg.GetOps()))
+
+	s, err := h.getScopedSession(UnmarshalToken(msg.GetToken()), ScopeWrite)
+	if err != nil {
+		return nil, err
+	}
+
+	ops := make([]TransactionOp, len(msg.GetOps()))
+	for i, op := range msg.GetOps() {
+		if err = h.checkObject(int64(len(op.GetData()))); err != nil {
+			return nil, errors.WithMessagef(
+				err, "operation %d on %q", i, op.GetPath())
+		}
+		ops[i] = TransactionOp{
+			Path:   op.GetPath(),
+			Data:   op.GetData(),
+			Delete: op.GetDelete(),
+		}
+	}
+
+	l := h.locks.get(s.(*userSession).username)
+	l.Lock()
+	defer l.Unlock()
+
+	// In a cluster, the transaction is replicated as a single entry that each
+	// node applies
+	if c, ok := s.(*userSession).Store.(committer); ok {
+		err = c.commit(ops)
+	} else {
+		err = applyTransaction(h.traced(ctx, s), ops)
+	}
+	if err != nil {
+		return nil, err
+	}
+	for _, op := range ops {
+		if !op.Delete {
+			h.setDevice(ctx, s, op.Path, op.Data)
+		}
+	}
+
+	return &rpc.RsCommitResponse{}, nil
+}
+
+// ConditionalWrite writes the data to the file at the path if the SHA-256 hash
+// of its current data matches IfMatch or, with IfNoneMatch, if it does not
+// exist, and returns the SHA-256 hash of the data. Other writes of the user
+// wait until the file is written, so that it cannot change after it is checked.
+//
+// Returns [InvalidConditionErr] for an invalid condition, [WriteConflictErr]
+// if the condition does not hold, [ObjectTooLargeErr] if the data exceeds the
+// maximum object size, [store.NonLocalFileErr] if the file is outside the base
+// path, [InvalidTokenErr] for an invalid token, and [InsufficientScopeErr] if
+// the token does not allow writing.
+func (h *handler) ConditionalWrite(ctx context.Context,
+	msg *rpc.RsConditionalWriteRequest) (*rpc.RsConditionalWriteResponse,
+	error) {
+	// The data is not logged, since it may be large
+	jww.TRACE.Printf("Received ConditionalWrite for %q if match %x or none "+
+		"match %t.", msg.GetPath(), msg.GetIfMatch(), msg.GetIfNoneMatch())
+
+	s, err := h.getScopedSession(UnmarshalToken(msg.GetToken()), ScopeWrite)
+	if err != nil {
+		return nil, err
+	}
+	err = checkWriteCondition(msg.GetIfMatch(), msg.GetIfNoneMatch())
+	if err != nil {
+		return nil, err
+	} else if err = h.checkObject(int64(len(msg.GetData()))); err != nil {
+		return nil, err
+	}
+
+	l := h.locks.get(s.(*userSession).username)
+	l.Lock()
+	defer l.Unlock()
+	traced := h.traced(ctx, s.(*userSession).Store)
+
+	err = matchWriteCondition(traced, msg.GetPath(), msg.GetIfMatch(),
+		msg.GetIfNoneMatch())
+	if err != nil {
+		return nil, err
+	}
+	if err = traced.Write(msg.GetPath(), msg.GetData()); err != nil {
+		return nil, err
+	}
+	h.setDevice(ctx, s, msg.GetPath(), msg.GetData())
+
+	sum := sha256.Sum256(msg.GetData())
+	return &rpc.RsConditionalWriteResponse{SHA256: sum[:]}, nil
+}
+
+// BatchRead reads the files at the paths in order. Files that do not exist are
+// returned as not found instead of failing the batch.
+//
+// Returns [InvalidBatchErr] if there are no paths or too many, the error of
+// the first read that fails for another reason, [InvalidTokenErr] for an
+// invalid token, and [InsufficientScopeErr] if the token does not allow
+// reading.
+func (h *handler) BatchRead(ctx context.Context,
+	msg *rpc.RsBatchReadRequest) (*rpc.RsBatchReadResponse, error) {
+	jww.TRACE.Printf("Received BatchRead message: %s", msg)
+
+	s, err := h.getScopedSession(UnmarshalToken(msg.GetToken()), ScopeRead)
+	if err != nil {
+		return nil, err
+	}
+	if err = checkBatch(len(msg.GetPaths())); err != nil {
+		return nil, err
+	}
+	s = h.traced(ctx, s)
+
+	results := make([]*rpc.RsBatchReadResult, len(msg.GetPaths()))
+	for i, path := range msg.GetPaths() {
+		data, err := s.Read(path)
+		if errors.Is(err, os.ErrNotExist) {
+			results[i] = &rpc.RsBatchReadResult{Path: path, NotFound: true}
+			continue
+		} else if err != nil {
+			return nil, errors.WithMessagef(err, "read %d of %q", i, path)
+		}
+		results[i] = &rpc.RsBatchReadResult{Path: path, Data: data}
+	}
+
+	return &rpc.RsBatchReadResponse{Results: results}, nil
+}
+
+// BatchWrite writes the files in order. Unlike Commit, the writes are not
+// undone if one fails, and writes of other requests of the user may be applied
+// between them.
+//
+// Returns [InvalidBatchErr] if there are no files or too many,
+// [ObjectTooLargeErr] if the data of a file exceeds the maximum object size,
+// in which case no file is written, the error of the first write that fails,
+// [InvalidTokenErr] for an invalid token, and [InsufficientScopeErr] if the
+// token does not allow writing.
+func (h *handler) BatchWrite(ctx context.Context,
+	msg *rpc.RsBatchWriteRequest) (*rpc.RsBatchWriteResponse, error) {
+	// The writes are not logged, since their data is large
+	jww.TRACE.Printf(
+		"Received BatchWrite with %d files.", len(msg.GetWrites()))
+
+	s, err := h.getScopedSession(UnmarshalToken(msg.GetToken()), ScopeWrite)
+	if err != nil {
+		return nil, err
+	}
+	if err = checkBatch(len(msg.GetWrites())); err != nil {
+		return nil, err
+	}
+	for i, write := range msg.GetWrites() {
+		if err = h.checkObject(int64(len(write.GetData()))); err != nil {
+			return nil, errors.WithMessagef(
+				err, "write %d of %q", i, write.GetPath())
+		}
+	}
+	unlock := h.lockWrites(s)
+	defer unlock()
+	traced := h.traced(ctx, s)
+
+	for i, write := range msg.GetWrites() {
+		if err = traced.Write(write.GetPath(), write.GetData()); err != nil {
+			return nil, errors.WithMessagef(
+				err, "write %d of %q", i, write.GetPath())
+		}
+		h.setDevice(ctx, s, write.GetPath(), write.GetData())
+	}
+
+	return &rpc.RsBatchWriteResponse{}, nil
+}
+
+// Export returns a page of the files of the user with their data, sorted by
+// path, and the token of the next page, which is empty on the last page.
+//
+// Returns [MigrationDisabledErr] if account migration is not enabled,
+// [InvalidMigrationRequestErr] for an invalid page token,
+// [store.NotListableErr] if the store cannot list its files,
+// [InvalidTokenErr] for an invalid token, and [InsufficientScopeErr] if the
+// token does not allow reading.
+func (h *handler) Export(ctx context.Context,
+	msg *rpc.RsExportRequest) (*rpc.RsExportResponse, error) {
+	jww.TRACE.Printf(
+		"Received Export message for page %q.", msg.GetPageToken())
+
+	s, err := h.getMigrationSession(UnmarshalToken(msg.GetToken()), ScopeRead)
+	if err != nil {
+		return nil, err
+	}
+
+	files, err := listFiles(s)
+	if err != nil {
+		return nil, err
+	}
+	page, next, err := exportPage(h.traced(ctx, s), files, msg.GetPageToken())
+	if err != nil {
+		return nil, err
+	}
+
+	return &rpc.RsExportResponse{Files: page, NextPageToken: next}, nil
+}
+
+// Tombstone records that the account of the user moved to the destination,
+// so that their later logins fail with [MigratedErr], ends their sessions, and
+// deletes all of their files.
+//
+// Returns [MigrationDisabledErr] if account migration is not enabled,
+// [InvalidMigrationRequestErr] if the destination is empty,
+// [store.NotListableErr] if the store cannot list its files,
+// [InvalidTokenErr] for an invalid token, and [InsufficientScopeErr] if the
+// token does not allow writing.
+func (h *handler) Tombstone(ctx context.Context,
+	msg *rpc.RsTombstoneRequest) (*rpc.RsTombstoneResponse, error) {
+	jww.TRACE.Printf("Received Tombstone message: %s", msg)
+
+	s, err := h.getMigrationSession(UnmarshalToken(msg.GetToken()), ScopeWrite)
+	if err != nil {
+		return nil, err
+	} else if msg.GetDestination() == "" {
+		return nil, errors.Wrap(
+			InvalidMigrationRequestErr, "destination is required")
+	}
+	username := s.(*userSession).username
+
+	files, err := listFiles(s)
+	if err != nil {
+		return nil, err
+	}
+	err = h.migration.addTombstone(username, msg.GetDestination())
+	if err != nil {
+		return nil, err
+	}
+	if _, err = h.RevokeUser(username); err != nil {
+		return nil, err
+	}
+
+	l := h.locks.get(username)
+	l.Lock()
+	defer l.Unlock()
+	s = h.traced(ctx, s)
+	for _, file := range files {
+		err = s.Delete(file)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, errors.Wrapf(err, "failed to delete %s", file)
+		}
+	}
+
+	jww.INFO.Printf("Tombstoned user %q, who moved to %s, and deleted %d "+
+		"files.", username, msg.GetDestination(), len(files))
+
+	return &rpc.RsTombstoneResponse{DeletedFiles: int32(len(files))}, nil
+}
+
+// Import copies all files of the user from the source server, exported with
+// the source token, to their storage, and then tombstones the user on the
+// source server with the address of this server. Errors of the source server
+// are returned as status errors with their code.
+//
+// Returns [MigrationDisabledErr] if account migration is not enabled,
+// [UnknownSourceErr] if the source is not allowed, [store.InvalidPathErr] if
+// the source exports a file with an invalid path, [ObjectTooLargeErr] if a
+// file exceeds the maximum object size, [InvalidTokenErr] for an invalid
+// token, and [InsufficientScopeErr] if the token does not allow writing.
+func (h *handler) Import(ctx context.Context,
+	msg *rpc.RsImportRequest) (*rpc.RsImportResponse, error) {
+	jww.TRACE.Printf(
+		"Received Import message from source %q.", msg.GetSource())
+
+	s, err := h.getMigrationSession(UnmarshalToken(msg.GetToken()), ScopeWrite)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := h.migration.dial(msg.GetSource())
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := conn.Close(); err != nil {
+			jww.WARN.Printf("Failed to close connection to source %s: %+v",
+				msg.GetSource(), err)
+		}
+	}()
+	client := rpc.NewMigrationClient(conn)
+	ts := h.traced(ctx, s)
+
+	resp := &rpc.RsImportResponse{}
+	var pageToken string
+	for {
+		page, err := client.Export(ctx, &rpc.RsExportRequest{
+			Token: msg.GetSourceToken(), PageToken: pageToken})
+		if err != nil {
+			return nil, sourceStatus(msg.GetSource(), err)
+		}
+		paths, err := sanitizeExportedPaths(page.GetFiles())
+		if err != nil {
+			return nil, errors.WithMessagef(err, "source %s", msg.GetSource())
+		}
+		for i, file := range page.GetFiles() {
+			if err = h.checkObject(int64(len(file.GetData()))); err != nil {
+				return nil, errors.WithMessagef(err, "file %q", paths[i])
+			}
+			unlock := h.lockWrites(s)
+			err = ts.Write(paths[i], file.GetData())
+			unlock()
+			if err != nil {
+				return nil, errors.WithMessagef(
+					err, "failed to import %s", paths[i])
+			}
+			resp.Files++
+			resp.Bytes += int64(len(file.GetData()))
+		}
+		if pageToken = page.GetNextPageToken(); pageToken == "" {
+			break
+		}
+	}
+
+	_, err = client.Tombstone(ctx, &rpc.RsTombstoneRequest{
+		Token:       msg.GetSourceToken(),
+		Destination: h.migration.Params().Address,
+	})
+	if err != nil {
+		return nil, sourceStatus(msg.GetSource(), err)
+	}
+
+	jww.INFO.Printf("Imported %d files (%d bytes) of user %q from %s.",
+		resp.Files, resp.Bytes, s.(*userSession).username, msg.GetSource())
+
+	return resp, nil
+}
+
+// getMigrationSession returns the session for the given token if account
+// migration is enabled and the session allows requests that require the
+// scope.
+//
+// Returns [MigrationDisabledErr] if account migration is not enabled,
+// [InvalidTokenErr] for an invalid token, and [InsufficientScopeErr] if the
+// scope is not allowed.
+func (h *handler) getMigrationSession(
+	token Token, scope Scope) (store.Store, error) {
+	if h.migration == nil {
+		return nil, MigrationDisabledErr
+	}
+	return h.getScopedSession(token, scope)
+}
+
+// lockWrites holds the lock of the user of the session for a write, so that
+// it is not applied during a transaction, and returns the function that
+// releases it.
+func (h *handler) lockWrites(s store.Store) func() {
+	l := h.locks.get(s.(*userSession).username)
+	l.RLock()
+	return l.RUnlock
+}
+
+// setDevice records the device that sent the request with the context as the
+// writer of the file at the path of the session, which it wrote with the data.
+// Does nothing if the client did not give its device ID. The write has
+// succeeded, so a failure is only logged.
+func (h *handler) setDevice(
+	ctx context.Context, s store.Store, path string, data []byte) {
+	device := incomingDeviceID(ctx)
+	if device == "" {
+		return
+	}
+	sum := sha256.Sum256(data)
+	err := store.SetDevice(
+		h.traced(ctx, s.(*userSession).Store), path, sum[:], device)
+	if err != nil {
+		jww.WARN.Printf("Failed to record device %q as the writer of %q: %+v",
+			device, path, err)
+	}
+}
+
+// getDeltaSession returns the session for the given token if delta sync is
+// enabled and the session allows requests that require the scope.
+//
+// Returns [DeltaDisabledErr] if delta sync is not enabled, [InvalidTokenErr]
+// for an invalid token, and [InsufficientScopeErr] if the scope is not
+// allowed.
+func (h *handler) getDeltaSession(
+	token Token, scope Scope) (store.Store, error) {
+	if h.delta == nil {
+		return nil, DeltaDisabledErr
+	}
+	return h.getScopedSession(token, scope)
+}
+
+// verifyUser verifies the username and password are correct. Returns
+// InvalidCredentialsErr for incorrect username or password.
+func (h *handler) verifyUser(username string, passwordHash, salt []byte) error {
+	clearTextPassword, err := h.users.Get(username)
+	if errors.Is(err, credentials.UserNotFoundErr) {
+		return InvalidCredentialsErr
+	} else if err != nil {
+		return errors.Wrap(err, "failed to get user credentials")
+	}
+
+	// The password hash sent by the client can only be checked against a
+	// cleartext password
+	if credentials.IsHashed(clearTextPassword) {
+		jww.DEBUG.Printf("User %q has a hashed password and must log in "+
+			"with PasswordLogin.", username)
+		return InvalidCredentialsErr
+	}
+
+	if !bytes.Equal(hashPassword(clearTextPassword, salt), passwordHash) {
+		return InvalidCredentialsErr
+	}
+
+	return nil
+}
+
+// verifyPassword verifies the username and cleartext password are correct and
+// rehashes the stored password if needed. Returns InvalidCredentialsErr for
+// incorrect username or password.
+func (h *handler) verifyPassword(username, password string) error {
+	stored, err := h.users.Get(username)
+	if errors.Is(err, credentials.UserNotFoundErr) {
+		return InvalidCredentialsErr
+	} else if err != nil {
+		return errors.Wrap(err, "failed to get user credentials")
+	}
+
+	match, err := credentials.VerifyPassword(stored, password)
+	if err != nil {
+		return errors.Wrapf(err, "invalid stored password for %q", username)
+	} else if !match {
+		return InvalidCredentialsErr
+	}
+
+	// Upgrade the stored password; failure does not prevent the login
+	if h.hasher != nil && h.hasher.NeedsRehash(stored) {
+		hashed, err := h.hasher.Hash(password)
+		if err == nil {
+			err = h.users.Set(username, hashed)
+		}
+		if err != nil {
+			jww.WARN.Printf(
+				"Failed to rehash password for %q: %+v", username, err)
+		} else {
+			jww.INFO.Printf("Rehashed password for user %q.", username)
+		}
+	}
+
+	return nil
+}
+
+func hashPassword(clearTextPassword string, salt []byte) []byte {
+	h := hash.CMixHash.New()
+	h.Write([]byte(clearTextPassword))
+	h.Write(salt)
+	return h.Sum(nil)
+}
+
+// getSession returns the store for the given token. Returns [InvalidTokenErr]
+// for an invalid token.
+func (h *handler) getSession(token Token) (store.Store, error) {
+	h.mux.Lock()
+	defer h.mux.Unlock()
+
+	s, exists := h.sessions[token]
+	if !exists {
+		return nil, InvalidTokenErr
+	}
+
+	// If the store is no longer valid or was revoked, then delete it and its
+	// token from their respective maps
+	revoked := h.revoked != nil &&
+		h.revoked.IsRevoked(token, s.username, s.GenTime)
+	if !s.IsValid() || revoked {
+		h.removeSession(token, s)
+		return nil, InvalidTokenErr
+	}
+
+	return s, nil
+}
+
+// getScopedSession returns the store for the given token if its session
+// allows requests that require the scope.
+//
+// Returns [InvalidTokenErr] for an invalid token and [InsufficientScopeErr]
+// if the scope is not allowed.
+func (h *handler) getScopedSession(token Token, scope Scope) (store.Store, error) {
+	s, err := h.getSession(token)
+	if err != nil {
+		return nil, err
+	}
+
+	if scopes := s.(*userSession).scopes; scopes != nil && !scopes.Allows(scope) {
+		return nil, InsufficientScopeErr
+	}
+
+	return s, nil
+}
+
+// traced returns the store traced as part of the request with the context if
+// tracing is enabled.
+func (h *handler) traced(ctx context.Context, s store.Store) store.Store {
+	if h.tracing == nil {
+		return s
+	}
+	return h.tracing.traceStore(ctx, s)
+}
+
+// removeSession deletes the session with the token. The user's token is only
+// deleted if it is the token of this session, since sessions logged in with an
+// API key are not the user's own session. Must be called while the lock is
+// held.
+func (h *handler) removeSession(token Token, s *userSession) {
+	delete(h.sessions, token)
+	if h.userTokens[s.username] == token {
+		delete(h.userTokens, s.username)
+	}
+}
+
+// sessionUsername returns the username of the session for the token and true
+// if the session exists.
+func (h *handler) sessionUsername(token Token) (string, bool) {
+	h.mux.Lock()
+	defer h.mux.Unlock()
+
+	s, exists := h.sessions[token]
+	if !exists {
+		return "", false
+	}
+	return s.username, true
+}
+
+// checkAccount returns [MigratedErr] if the account of the user was migrated
+// and [BannedErr] if the user is banned.
+func (h *handler) checkAccount(username string) error {
+	if h.migration != nil {
+		if err := h.migration.checkLogin(username); err != nil {
+			return err
+		}
+	}
+	if h.policies != nil {
+		return h.policies.checkLogin(username)
+	}
+	return nil
+}
+
+// addSession generates a new Token and expiration time. On first login, it
+// initializes a new storage directory for user. On subsequent logins, it
+// overwrites the token with the new token gives access to the user's directory.
+func (h *handler) addSession(username string) (*userSession, error) {
+	if err := h.checkAccount(username); err != nil {
+		return nil, err
+	}
+
+	h.mux.Lock()
+	defer h.mux.Unlock()
+
+	n, err := h.newNonce()
+	if err != nil {
+		return nil, err
+	}
+	token := Token(n.Value)
+
+	if oldToken, exists := h.userTokens[username]; exists {
+		// If an old token is registered, update the token in the sessions map
+		jww.DEBUG.Printf("Updating token for user %s.", username)
+		h.sessions[token] = h.sessions[oldToken]
+		h.sessions[token].Nonce = n
+		delete(h.sessions, oldToken)
+	} else {
+		// If no token exists, create a new store instance and put in the map
+		jww.DEBUG.Printf("Creating new token for user %s.", username)
+
+		us, err := newUserSession(h.storageDir, username, n, h.newStore)
+		if err != nil {
+			return nil, err
+		}
+		h.sessions[token] = &us
+	}
+
+	// Update to the newest token
+	h.userTokens[username] = token
+
+	return h.sessions[token], nil
+}
+
+// addAPIKeySession generates a new session with a new Token for the user that
+// only allows requests permitted by the scopes. Unlike addSession, it does not
+// replace the user's token. The session shares the store of the user's
+// session if they are logged in.
+func (h *handler) addAPIKeySession(
+	username string, scopes Scopes) (*userSession, error) {
+	if err := h.checkAccount(username); err != nil {
+		return nil, err
+	}
+
+	h.mux.Lock()
+	defer h.mux.Unlock()
+
+	n, err := h.newNonce()
+	if err != nil {
+		return nil, err
+	}
+
+	var us userSession
+	if token, exists := h.userTokens[username]; exists {
+		us = userSession{username: username, Nonce: n,
+			Store: h.sessions[token].Store}
+	} else {
+		us, err = newUserSession(h.storageDir, username, n, h.newStore)
+		if err != nil {
+			return nil, err
+		}
+	}
+	us.scopes = scopes
+	h.sessions[Token(n.Value)] = &us
+
+	return &us, nil
+}
+
+// refreshSession replaces the token of the session with a new token that
+// expires after the token TTL and returns the new nonce.
+//
+// Returns [InvalidTokenErr] for an invalid or expired token.
+func (h *handler) refreshSession(token Token) (nonce.Nonce, error) {
+	h.mux.Lock()
+	defer h.mux.Unlock()
+
+	s, exists := h.sessions[token]
+	if !exists {
+		return nonce.Nonce{}, InvalidTokenErr
+	} else if !s.IsValid() {
+		h.removeSession(token, s)
+		return nonce.Nonce{}, InvalidTokenErr
+	}
+
+	n, err := h.newNonce()
+	if err != nil {
+		return nonce.Nonce{}, err
+	}
+	newToken := Token(n.Value)
+
+	jww.DEBUG.Printf("Refreshing token for user %s.", s.username)
+	s.Nonce = n
+	if h.userTokens[s.username] == token {
+		h.userTokens[s.username] = newToken
+	}
+	delete(h.sessions, token)
+	h.sessions[newToken] = s
+
+	return n, nil
+}
+
+// newNonce generates a new nonce that expires after the token TTL and whose
+// token is not already in use. Must be called while the lock is held.
+func (h *handler) newNonce() (nonce.Nonce, error) {
+	for {
+		n, err := nonce.NewNonce(uint(h.tokenTTL.Seconds()))
+		if err != nil {
+			// This error cannot currently happen
+			return nonce.Nonce{}, err
+		}
+		if _, exists := h.sessions[Token(n.Value)]; !exists {
+			return n, nil
+		}
+	}
+}
+
+// RevokeToken revokes the token and ends its session. Returns true if the
+// token belonged to an active session.
+func (h *handler) RevokeToken(token Token) (bool, error) {
+	h.mux.Lock()
+	defer h.mux.Unlock()
+
+	expires := time.Now().Add(h.tokenTTL)
+	s, exists := h.sessions[token]
+	if exists {
+		expires = s.ExpiryTime
+		h.removeSession(token, s)
+	}
+
+	if h.revoked != nil {
+		if err := h.revoked.RevokeToken(token, expires); err != nil {
+			return exists, err
+		}
+	}
+
+	jww.INFO.Printf("Revoked token (active session: %t).", exists)
+
+	return exists, nil
+}
+
+// RevokeUser revokes all tokens issued to the user and ends their sessions,
+// including those logged in with an API key. Returns true if the user had an
+// active session.
+func (h *handler) RevokeUser(username string) (bool, error) {
+	h.mux.Lock()
+	defer h.mux.Unlock()
+
+	var exists bool
+	for token, s := range h.sessions {
+		if s.username == username {
+			h.removeSession(token, s)
+			exists = true
+		}
+	}
+
+	if h.revoked != nil {
+		if err := h.revoked.RevokeUser(username, time.Now()); err != nil {
+			return exists, err
+		}
+	}
+
+	jww.INFO.Printf("Revoked all tokens for user %q (active session: %t).",
+		username, exists)
+
+	return exists, nil
+}
+
+// removeExpiredSessions deletes all expired sessions and their tokens. Returns
+// the number of sessions removed.
+func (h *handler) removeExpiredSessions() int {
+	h.mux.Lock()
+	defer h.mux.Unlock()
+
+	var removed int
+	for token, s := range h.sessions {
+		if !s.IsValid() {
+			h.removeSession(token, s)
+			removed++
+		}
+	}
+
+	return removed
+}
+
+// cleanupSessions removes expired sessions and unneeded revocations every
+// interval until the stop channel is closed.
+func (h *handler) cleanupSessions(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			if removed := h.removeExpiredSessions(); removed > 0 {
+				jww.DEBUG.Printf("Removed %d expired sessions.", removed)
+			}
+			if h.revoked != nil {
+				if err := h.revoked.Prune(time.Now(), h.tokenTTL); err != nil {
+					jww.WARN.Printf(
+						"Failed to prune revocation list: %+v", err)
+				}
+			}
+		}
+	}
 }
@@ -9,8 +9,10 @@ package server
 
 import (
 	"bytes"
-	"encoding/base64"
+	"context"
+	"crypto/sha256"
 	"errors"
+	"fmt"
 	"math/rand"
 	"os"
 	"reflect"
@@ -18,6 +20,8 @@ import (
 	"time"
 
 	pb "gitlab.com/elixxir/comms/mixmessages"
+	"gitlab.com/elixxir/remoteSyncServer/credentials"
+	"gitlab.com/elixxir/remoteSyncServer/rpc"
 	"gitlab.com/elixxir/remoteSyncServer/store"
 	"gitlab.com/xx_network/crypto/nonce"
 	"gitlab.com/xx_network/primitives/netTime"
@@ -25,19 +29,16 @@ import (
 
 // Unit test of newHandler.
 func Test_newHandler(t *testing.T) {
+	users := credentials.NewMemStore(map[string]string{"user": "pass"})
 	expected := &handler{
-		storageDir:    "storageDir",
-		tokenTTL:      5 * time.Hour,
-		sessions:      make(map[Token]*userSession),
-		userTokens:    make(map[string]Token),
-		userPasswords: map[string]string{"user": "pass"},
+		storageDir: "storageDir",
+		tokenTTL:   5 * time.Hour,
+		sessions:   make(map[Token]*userSession),
+		userTokens: make(map[string]Token),
+		users:      users,
 	}
 
-	h, err := newHandler(expected.storageDir, expected.tokenTTL,
-		[][]string{{"user", "pass"}}, nil)
-	if err != nil {
-		t.Errorf("Failed to make new handler: %+v", err)
-	}
+	h := newHandler(expected.storageDir, expected.tokenTTL, users, nil, nil)
 
 	if !reflect.DeepEqual(expected, h) {
 		t.Errorf("Unexpected new handler.\nexpected: %#v\nreceived: %#v",
@@ -45,62 +46,6 @@ func Test_newHandler(t *testing.T) {
 	}
 }
 
-// Error path: Tests that newHandler returns an error for invalid user records
-func Test_newHandler_UserError(t *testing.T) {
-	_, err := newHandler("", 0, [][]string{{"user", "pass"}, {"user2"}}, nil)
-	if err == nil {
-		t.Errorf("Failed to error for invalid records.")
-	}
-}
-
-// Tests that userRecordsToMap returns the expected map.
-func Test_userRecordsToMap(t *testing.T) {
-	prng := rand.New(rand.NewSource(3459806))
-	const numTests = 100
-	records := make([][]string, numTests)
-	expected := make(map[string]string, numTests)
-	for i := range records {
-		usernameBytes := make([]byte, 3+prng.Intn(7))
-		passwordBytes := make([]byte, 3+prng.Intn(32))
-		prng.Read(usernameBytes)
-		prng.Read(passwordBytes)
-		username := base64.StdEncoding.EncodeToString(usernameBytes)
-		password := base64.StdEncoding.EncodeToString(passwordBytes)
-		records[i] = []string{username, password}
-
-		// Half of the time, add extra records
-		if prng.Intn(2) == 0 {
-			extraRecords := 1 + prng.Intn(15)
-			for j := 0; j < extraRecords; j++ {
-				extraRecord := make([]byte, 3+prng.Intn(26))
-				prng.Read(extraRecord)
-				records[i] = append(records[i],
-					base64.StdEncoding.EncodeToString(extraRecord))
-			}
-		}
-
-		expected[username] = password
-	}
-
-	recordsMap, err := userRecordsToMap(records)
-	if err != nil {
-		t.Errorf("Failed to convert records: %+v", err)
-	}
-	if !reflect.DeepEqual(expected, recordsMap) {
-		t.Errorf("Unexpected records map.\nexpected: %s\nreceived: %s",
-			expected, recordsMap)
-	}
-}
-
-// Error path: Tests that userRecordsToMap returns an error for an invalid
-// record.
-func Test_userRecordsToMap_InvalidRecordError(t *testing.T) {
-	_, err := userRecordsToMap([][]string{{"user", "pass"}, {"user2"}})
-	if err == nil {
-		t.Errorf("Failed to error for invalid records.")
-	}
-}
-
 // Tests that handler.Login properly hashes the password and checks the username
 // and that the message returns makes sense.
 func Test_handler_Login(t *testing.T) {
@@ -110,8 +55,8 @@ func Test_handler_Login(t *testing.T) {
 	salt := make([]byte, 32)
 	prng.Read(salt)
 
-	h, _ := newHandler(
-		"tmp", time.Hour, [][]string{{username, password}}, store.NewMemStore)
+	h := newHandler("tmp", time.Hour, credentials.NewMemStore(
+		map[string]string{username: password}), nil, store.NewMemStore)
 
 	msg, err := h.Login(&pb.RsAuthenticationRequest{
 		Username:     username,
@@ -145,8 +90,8 @@ func Test_handler_Login_InvalidUsernameError(t *testing.T) {
 
 	passwordHash := hashPassword(password, salt)
 
-	h, _ := newHandler(
-		"tmp", time.Hour, [][]string{{username, password}}, store.NewMemStore)
+	h := newHandler("tmp", time.Hour, credentials.NewMemStore(
+		map[string]string{username: password}), nil, store.NewMemStore)
 
 	_, err := h.Login(&pb.RsAuthenticationRequest{
 		Username:     username + "extra junk",
@@ -168,8 +113,8 @@ func Test_handler_Login_NonLocalPathError(t *testing.T) {
 	salt := make([]byte, 32)
 	prng.Read(salt)
 
-	h, _ := newHandler(
-		"tmp", time.Hour, [][]string{{username, password}}, store.NewFileStore)
+	h := newHandler("tmp", time.Hour, credentials.NewMemStore(
+		map[string]string{username: password}), nil, store.NewFileStore)
 
 	_, err := h.Login(&pb.RsAuthenticationRequest{
 		Username:     username,
@@ -182,13 +127,137 @@ func Test_handler_Login_NonLocalPathError(t *testing.T) {
 	}
 }
 
+// Tests that handler.PasswordLogin logs in with a cleartext password, rehashes
+// the stored password, and then logs in with the hashed password, which can no
+// longer be used with handler.Login.
+func Test_handler_PasswordLogin(t *testing.T) {
+	users := credentials.NewMemStore(map[string]string{"waldo": "hunter2"})
+	h := newHandler("", time.Hour, users, newTestHasher(t), store.NewMemStore)
+
+	for i := 0; i < 2; i++ {
+		msg, err := h.PasswordLogin(&rpc.RsPasswordLoginRequest{
+			Username: "waldo", Password: "hunter2"})
+		if err != nil {
+			t.Fatalf("Failed to log in (%d): %+v", i, err)
+		}
+		if _, err = h.getSession(UnmarshalToken(msg.GetToken())); err != nil {
+			t.Errorf("Failed to get session for token (%d): %+v", i, err)
+		}
+
+		if stored, _ := users.Get("waldo"); !credentials.IsHashed(stored) {
+			t.Errorf("Password not rehashed (%d): %q", i, stored)
+		}
+	}
+
+	salt := []byte("salt")
+	_, err := h.Login(&pb.RsAuthenticationRequest{
+		Username:     "waldo",
+		PasswordHash: hashPassword("hunter2", salt),
+		Salt:         salt,
+	})
+	if !errors.Is(err, InvalidCredentialsErr) {
+		t.Errorf("Unexpected error for Login with hashed password."+
+			"\nexpected: %v\nreceived: %+v", InvalidCredentialsErr, err)
+	}
+}
+
+// Tests that handler.PasswordLogin does not rehash the stored password when
+// password hashing is disabled.
+func Test_handler_PasswordLogin_NoHasher(t *testing.T) {
+	users := credentials.NewMemStore(map[string]string{"waldo": "hunter2"})
+	h := newHandler("", time.Hour, users, nil, store.NewMemStore)
+
+	_, err := h.PasswordLogin(&rpc.RsPasswordLoginRequest{
+		Username: "waldo", Password: "hunter2"})
+	if err != nil {
+		t.Fatalf("Failed to log in: %+v", err)
+	}
+	if stored, _ := users.Get("waldo"); stored != "hunter2" {
+		t.Errorf("Password changed: %q", stored)
+	}
+}
+
+// Error path: Tests that handler.PasswordLogin returns InvalidCredentialsErr
+// for an unknown user and an incorrect password.
+func Test_handler_PasswordLogin_InvalidCredentialsError(t *testing.T) {
+	users := credentials.NewMemStore(map[string]string{"waldo": "hunter2"})
+	h := newHandler("", time.Hour, users, newTestHasher(t), store.NewMemStore)
+
+	for _, creds := range [][2]string{{"carmen", "hunter2"}, {"waldo", "pass"}} {
+		_, err := h.PasswordLogin(&rpc.RsPasswordLoginRequest{
+			Username: creds[0], Password: creds[1]})
+		if !errors.Is(err, InvalidCredentialsErr) {
+			t.Errorf("Unexpected error for %q/%q."+
+				"\nexpected: %v\nreceived: %+v",
+				creds[0], creds[1], InvalidCredentialsErr, err)
+		}
+	}
+	if stored, _ := users.Get("waldo"); stored != "hunter2" {
+		t.Errorf("Password changed after failed login: %q", stored)
+	}
+}
+
+// Tests that handler.RefreshToken returns a new token with a later expiration
+// time that can be used in place of the old token.
+func Test_handler_RefreshToken(t *testing.T) {
+	h := newHandler("", time.Hour, nil, nil, store.NewMemStore)
+	si, err := h.addSession("waldo")
+	if err != nil {
+		t.Fatalf("Failed to add session: %+v", err)
+	}
+	oldToken, oldExpiry := Token(si.Value), si.ExpiryTime
+
+	msg, err := h.RefreshToken(
+		&rpc.RsRefreshTokenRequest{Token: oldToken.Marshal()})
+	if err != nil {
+		t.Fatalf("Failed to refresh token: %+v", err)
+	}
+
+	newToken := UnmarshalToken(msg.GetToken())
+	if newToken == oldToken {
+		t.Errorf("Did not get new token.\nold: %X\nnew: %X", oldToken, newToken)
+	}
+	if expiresAt := time.Unix(0, msg.GetExpiresAt()); !expiresAt.After(oldExpiry) {
+		t.Errorf("New token does not expire after old token."+
+			"\nold: %s\nnew: %s", oldExpiry, expiresAt)
+	}
+
+	if _, err = h.getSession(newToken); err != nil {
+		t.Errorf("Failed to get session with new token: %+v", err)
+	}
+	if _, err = h.getSession(oldToken); !errors.Is(err, InvalidTokenErr) {
+		t.Errorf("Unexpected error for old token."+
+			"\nexpected: %v\nreceived: %+v", InvalidTokenErr, err)
+	}
+}
+
+// Error path: Tests that handler.RefreshToken returns InvalidTokenErr for an
+// unknown token and for an expired token.
+func Test_handler_RefreshToken_InvalidTokenError(t *testing.T) {
+	h := newHandler("", time.Hour, nil, nil, store.NewMemStore)
+	si, err := h.addSession("waldo")
+	if err != nil {
+		t.Fatalf("Failed to add session: %+v", err)
+	}
+	si.ExpiryTime = time.Now().Add(-time.Second)
+
+	for _, token := range []Token{{1, 2, 3}, Token(si.Value)} {
+		_, err = h.RefreshToken(
+			&rpc.RsRefreshTokenRequest{Token: token.Marshal()})
+		if !errors.Is(err, InvalidTokenErr) {
+			t.Errorf("Unexpected error for token %X."+
+				"\nexpected: %v\nreceived: %+v", token, InvalidTokenErr, err)
+		}
+	}
+}
+
 func Test_handler_Write_Read(t *testing.T) {
 	h, token := newHandlerLogin(
 		time.Hour, "waldo", "hunter2", rand.New(rand.NewSource(4596)), t)
 
 	filePath := "dir1/dir2/fileA.txt"
 	contents := []byte("Lorem ipsum and such as it goes.")
-	ack, err := h.Write(&pb.RsWriteRequest{
+	ack, err := h.Write(context.Background(), &pb.RsWriteRequest{
 		Path:  filePath,
 		Data:  contents,
 		Token: token.Marshal(),
@@ -199,7 +268,7 @@ func Test_handler_Write_Read(t *testing.T) {
 		t.Errorf("Received no ack: %+v", ack)
 	}
 
-	response, err := h.Read(&pb.RsReadRequest{
+	response, err := h.Read(context.Background(), &pb.RsReadRequest{
 		Path:  filePath,
 		Token: token.Marshal(),
 	})
@@ -219,7 +288,7 @@ func Test_handler_Read(t *testing.T) {
 
 	filePath := "dir1/dir2/fileA.txt"
 	contents := []byte("Lorem ipsum and such as it goes.")
-	ack, err := h.Write(&pb.RsWriteRequest{
+	ack, err := h.Write(context.Background(), &pb.RsWriteRequest{
 		Path:  filePath,
 		Data:  contents,
 		Token: token.Marshal(),
@@ -230,7 +299,7 @@ func Test_handler_Read(t *testing.T) {
 		t.Errorf("Received no ack: %+v", ack)
 	}
 
-	response, err := h.Read(&pb.RsReadRequest{
+	response, err := h.Read(context.Background(), &pb.RsReadRequest{
 		Path:  filePath,
 		Token: token.Marshal(),
 	})
@@ -251,7 +320,7 @@ func Test_handler_read_InvalidTokenError(t *testing.T) {
 	h, token := newHandlerLogin(time.Hour, "waldo", "hunter2", prng, t)
 
 	prng.Read(token[:])
-	_, err := h.Read(&pb.RsReadRequest{Token: token.Marshal()})
+	_, err := h.Read(context.Background(), &pb.RsReadRequest{Token: token.Marshal()})
 	if !errors.Is(err, InvalidTokenErr) {
 		t.Errorf("Unexpected error for invalid token."+
 			"\nexpected: %v\nreceived: %+v", InvalidTokenErr, err)
@@ -264,7 +333,7 @@ func Test_handler_read_InvalidPathError(t *testing.T) {
 	prng := rand.New(rand.NewSource(354))
 	h, token := newHandlerLogin(time.Hour, "waldo", "hunter2", prng, t)
 
-	_, err := h.Read(&pb.RsReadRequest{
+	_, err := h.Read(context.Background(), &pb.RsReadRequest{
 		Path:  "someFile",
 		Token: token.Marshal()},
 	)
@@ -281,7 +350,7 @@ func Test_handler_write_InvalidTokenError(t *testing.T) {
 	h, token := newHandlerLogin(time.Hour, "waldo", "hunter2", prng, t)
 
 	prng.Read(token[:])
-	_, err := h.Write(&pb.RsWriteRequest{Token: token.Marshal()})
+	_, err := h.Write(context.Background(), &pb.RsWriteRequest{Token: token.Marshal()})
 	if !errors.Is(err, InvalidTokenErr) {
 		t.Errorf("Unexpected error for invalid token."+
 			"\nexpected: %v\nreceived: %+v", InvalidTokenErr, err)
@@ -296,7 +365,7 @@ func Test_handler_write_NonLocalFileError(t *testing.T) {
 		time.Hour, "waldo", "hunter2", prng, store.NewFileStore, t)
 	defer closeFn()
 
-	_, err := h.Write(&pb.RsWriteRequest{
+	_, err := h.Write(context.Background(), &pb.RsWriteRequest{
 		Path:  "domeDir/../../../user/file",
 		Data:  []byte("my secret data"),
 		Token: token.Marshal(),
@@ -312,7 +381,7 @@ func Test_handler_GetLastModified(t *testing.T) {
 		time.Hour, "waldo", "hunter2", rand.New(rand.NewSource(4596)), t)
 
 	filePath := "dir1/dir2/fileA.txt"
-	_, err := h.Write(&pb.RsWriteRequest{
+	_, err := h.Write(context.Background(), &pb.RsWriteRequest{
 		Path:  filePath,
 		Data:  []byte("Lorem ipsum and such as it goes."),
 		Token: token.Marshal(),
@@ -321,7 +390,7 @@ func Test_handler_GetLastModified(t *testing.T) {
 		t.Errorf("Failed to write: %+v", err)
 	}
 
-	msg, err := h.GetLastModified(&pb.RsReadRequest{
+	msg, err := h.GetLastModified(context.Background(), &pb.RsReadRequest{
 		Path:  filePath,
 		Token: token.Marshal(),
 	})
@@ -345,7 +414,7 @@ func Test_handler_GetLastModified_InvalidTokenError(t *testing.T) {
 	h, token := newHandlerLogin(time.Hour, "waldo", "hunter2", prng, t)
 
 	prng.Read(token[:])
-	_, err := h.GetLastModified(&pb.RsReadRequest{Token: token.Marshal()})
+	_, err := h.GetLastModified(context.Background(), &pb.RsReadRequest{Token: token.Marshal()})
 	if !errors.Is(err, InvalidTokenErr) {
 		t.Errorf("Unexpected error for invalid token."+
 			"\nexpected: %v\nreceived: %+v", InvalidTokenErr, err)
@@ -358,7 +427,7 @@ func Test_handler_GetLastModified_InvalidPathError(t *testing.T) {
 	prng := rand.New(rand.NewSource(354))
 	h, token := newHandlerLogin(time.Hour, "waldo", "hunter2", prng, t)
 
-	_, err := h.GetLastModified(&pb.RsReadRequest{
+	_, err := h.GetLastModified(context.Background(), &pb.RsReadRequest{
 		Path:  "someFile",
 		Token: token.Marshal()},
 	)
@@ -372,7 +441,7 @@ func Test_handler_GetLastWrite(t *testing.T) {
 	h, token := newHandlerLogin(
 		time.Hour, "waldo", "hunter2", rand.New(rand.NewSource(4596)), t)
 
-	_, err := h.Write(&pb.RsWriteRequest{
+	_, err := h.Write(context.Background(), &pb.RsWriteRequest{
 		Path:  "dir1/dir2/fileA.txt",
 		Data:  []byte("Lorem ipsum and such as it goes."),
 		Token: token.Marshal(),
@@ -381,7 +450,7 @@ func Test_handler_GetLastWrite(t *testing.T) {
 		t.Errorf("Failed to write: %+v", err)
 	}
 
-	msg, err := h.GetLastWrite(&pb.RsLastWriteRequest{Token: token.Marshal()})
+	msg, err := h.GetLastWrite(context.Background(), &pb.RsLastWriteRequest{Token: token.Marshal()})
 	if err != nil {
 		t.Errorf("Failed to get last write: %+v", err)
 	}
@@ -401,7 +470,7 @@ func Test_handler_GetLastWrite_InvalidTokenError(t *testing.T) {
 	h, token := newHandlerLogin(time.Hour, "waldo", "hunter2", prng, t)
 
 	prng.Read(token[:])
-	_, err := h.GetLastWrite(&pb.RsLastWriteRequest{Token: token.Marshal()})
+	_, err := h.GetLastWrite(context.Background(), &pb.RsLastWriteRequest{Token: token.Marshal()})
 	if !errors.Is(err, InvalidTokenErr) {
 		t.Errorf("Unexpected error for invalid token."+
 			"\nexpected: %v\nreceived: %+v", InvalidTokenErr, err)
@@ -414,7 +483,7 @@ func Test_handler_GetLastWrite_NoWriteError(t *testing.T) {
 	prng := rand.New(rand.NewSource(34))
 	h, token := newHandlerLogin(time.Hour, "waldo", "hunter2", prng, t)
 
-	_, err := h.GetLastWrite(&pb.RsLastWriteRequest{Token: token.Marshal()})
+	_, err := h.GetLastWrite(context.Background(), &pb.RsLastWriteRequest{Token: token.Marshal()})
 	if !errors.Is(err, os.ErrNotExist) {
 		t.Errorf("Unexpected error for invalid token."+
 			"\nexpected: %v\nreceived: %+v", os.ErrNotExist, err)
@@ -425,7 +494,7 @@ func Test_handler_ReadDir(t *testing.T) {
 	h, token := newHandlerLogin(
 		time.Hour, "waldo", "hunter2", rand.New(rand.NewSource(4596)), t)
 
-	_, err := h.Write(&pb.RsWriteRequest{
+	_, err := h.Write(context.Background(), &pb.RsWriteRequest{
 		Path:  "dir1/dir2/fileA.txt",
 		Data:  []byte("Lorem ipsum and such as it goes."),
 		Token: token.Marshal(),
@@ -434,7 +503,7 @@ func Test_handler_ReadDir(t *testing.T) {
 		t.Errorf("Failed to write: %+v", err)
 	}
 
-	msg, err := h.ReadDir(&pb.RsReadRequest{
+	msg, err := h.ReadDir(context.Background(), &pb.RsReadRequest{
 		Path:  "dir1/",
 		Token: token.Marshal(),
 	})
@@ -457,7 +526,7 @@ func Test_handler_ReadDir_NonLocalFileError(t *testing.T) {
 		time.Hour, "waldo", "hunter2", prng, store.NewFileStore, t)
 	defer closeFn()
 
-	_, err := h.ReadDir(&pb.RsReadRequest{
+	_, err := h.ReadDir(context.Background(), &pb.RsReadRequest{
 		Path:  "domeDir/../../../user/",
 		Token: token.Marshal(),
 	})
@@ -474,7 +543,485 @@ func Test_handler_ReadDir_InvalidTokenError(t *testing.T) {
 	h, token := newHandlerLogin(time.Hour, "waldo", "hunter2", prng, t)
 
 	prng.Read(token[:])
-	_, err := h.ReadDir(&pb.RsReadRequest{Token: token.Marshal()})
+	_, err := h.ReadDir(context.Background(), &pb.RsReadRequest{Token: token.Marshal()})
+	if !errors.Is(err, InvalidTokenErr) {
+		t.Errorf("Unexpected error for invalid token."+
+			"\nexpected: %v\nreceived: %+v", InvalidTokenErr, err)
+	}
+}
+
+// Tests that handler.ListVersions and handler.ReadVersion return the previous
+// versions of a file written with versioning enabled.
+func Test_handler_ListVersions_ReadVersion(t *testing.T) {
+	newStore, err := store.NewVersionedStore(nil, store.NewMemStore)
+	if err != nil {
+		t.Fatalf("Failed to create versioned store: %+v", err)
+	}
+	h, token, _ := newHandlerStoreLogin(time.Hour, "waldo", "hunter2",
+		rand.New(rand.NewSource(7741)), newStore, t)
+
+	for _, data := range []string{"first", "second"} {
+		_, err = h.Write(context.Background(), &pb.RsWriteRequest{
+			Path:  "dir/file.txt",
+			Data:  []byte(data),
+			Token: token.Marshal(),
+		})
+		if err != nil {
+			t.Fatalf("Failed to write %q: %+v", data, err)
+		}
+	}
+
+	list, err := h.ListVersions(&rpc.RsListVersionsRequest{
+		Token: token.Marshal(), Path: "dir/file.txt"})
+	if err != nil {
+		t.Fatalf("Failed to list versions: %+v", err)
+	} else if len(list.GetVersions()) != 1 {
+		t.Fatalf("Unexpected number of versions.\nexpected: %d\nreceived: %d",
+			1, len(list.GetVersions()))
+	}
+	v := list.GetVersions()[0]
+	if v.GetSize() != int64(len("first")) || v.GetDeleted() {
+		t.Errorf("Unexpected version: %+v", v)
+	}
+
+	msg, err := h.ReadVersion(&rpc.RsReadVersionRequest{
+		Token: token.Marshal(), Path: "dir/file.txt", ID: v.GetID()})
+	if err != nil {
+		t.Fatalf("Failed to read version: %+v", err)
+	} else if string(msg.GetData()) != "first" {
+		t.Errorf("Unexpected data.\nexpected: %q\nreceived: %q",
+			"first", msg.GetData())
+	}
+}
+
+// Error path: Tests that handler.ListVersions returns VersioningDisabledErr
+// when the store does not keep versions.
+func Test_handler_ListVersions_VersioningDisabledError(t *testing.T) {
+	h, token := newHandlerLogin(
+		time.Hour, "waldo", "hunter2", rand.New(rand.NewSource(3321)), t)
+
+	_, err := h.ListVersions(&rpc.RsListVersionsRequest{
+		Token: token.Marshal(), Path: "file.txt"})
+	if !errors.Is(err, VersioningDisabledErr) {
+		t.Errorf("Unexpected error without versioning."+
+			"\nexpected: %v\nreceived: %+v", VersioningDisabledErr, err)
+	}
+}
+
+// Error path: Tests that handler.ReadVersion returns InvalidTokenErr for a
+// token that is not found.
+func Test_handler_ReadVersion_InvalidTokenError(t *testing.T) {
+	prng := rand.New(rand.NewSource(6120))
+	h, token := newHandlerLogin(time.Hour, "waldo", "hunter2", prng, t)
+
+	prng.Read(token[:])
+	_, err := h.ReadVersion(&rpc.RsReadVersionRequest{Token: token.Marshal()})
+	if !errors.Is(err, InvalidTokenErr) {
+		t.Errorf("Unexpected error for invalid token."+
+			"\nexpected: %v\nreceived: %+v", InvalidTokenErr, err)
+	}
+}
+
+// Tests that handler.ListDir lists the entries of a directory in pages.
+func Test_handler_ListDir(t *testing.T) {
+	h, token := newHandlerLogin(
+		time.Hour, "waldo", "hunter2", rand.New(rand.NewSource(6910)), t)
+	for _, name := range []string{"fred", "frank", "alice"} {
+		_, err := h.Write(context.Background(), &pb.RsWriteRequest{
+			Token: token.Marshal(), Path: "contacts/" + name + "/data",
+			Data: []byte(name)})
+		if err != nil {
+			t.Fatalf("Failed to write %s: %+v", name, err)
+		}
+	}
+
+	msg := &rpc.RsListDirRequest{Token: token.Marshal(), Path: "contacts",
+		Prefix: "fr", PageSize: 1}
+	var entries []string
+	for {
+		resp, err := h.ListDir(context.Background(), msg)
+		if err != nil {
+			t.Fatalf("Failed to list directory: %+v", err)
+		}
+		entries = append(entries, resp.GetEntries()...)
+		if resp.GetNextPageToken() == "" {
+			break
+		}
+		msg.PageToken = resp.GetNextPageToken()
+	}
+
+	expected := []string{"frank", "fred"}
+	if !reflect.DeepEqual(entries, expected) {
+		t.Errorf("Unexpected entries.\nexpected: %q\nreceived: %q",
+			expected, entries)
+	}
+}
+
+// Tests that handler.Commit applies all operations of a transaction, and none
+// of them if one fails.
+func Test_handler_Commit(t *testing.T) {
+	h, token := newHandlerLogin(
+		time.Hour, "waldo", "hunter2", rand.New(rand.NewSource(7010)), t)
+	_, err := h.Commit(context.Background(), &rpc.RsCommitRequest{
+		Token: token.Marshal(), Ops: []*rpc.RsTransactionOp{
+			{Path: "keys/a", Data: []byte("a")},
+			{Path: "keys/b", Data: []byte("b")}}})
+	if err != nil {
+		t.Fatalf("Failed to commit transaction: %+v", err)
+	}
+
+	_, err = h.Commit(context.Background(), &rpc.RsCommitRequest{
+		Token: token.Marshal(), Ops: []*rpc.RsTransactionOp{
+			{Path: "keys/a", Data: []byte("new a")},
+			{Path: "keys/b", Delete: true},
+			{Path: "keys/c", Delete: true}}})
+	if !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Unexpected error for failed operation."+
+			"\nexpected: %v\nreceived: %+v", os.ErrNotExist, err)
+	}
+
+	expected := map[string]string{"keys/a": "a", "keys/b": "b"}
+	for path, data := range expected {
+		resp, err := h.Read(context.Background(),
+			&pb.RsReadRequest{Token: token.Marshal(), Path: path})
+		if err != nil {
+			t.Errorf("Failed to read %s: %+v", path, err)
+		} else if string(resp.GetData()) != data {
+			t.Errorf("Unexpected data of %s.\nexpected: %q\nreceived: %q",
+				path, data, resp.GetData())
+		}
+	}
+}
+
+// Tests that a file uploaded in chunks with handler.StartUpload and
+// handler.UploadChunk, resumed from the offset returned by handler.GetUpload,
+// is written by handler.FinishUpload.
+func Test_handler_StartUpload_FinishUpload(t *testing.T) {
+	h, token := newHandlerLogin(
+		time.Hour, "waldo", "hunter2", rand.New(rand.NewSource(5520)), t)
+	var err error
+	h.uploads, err = NewUploads(map[string]interface{}{"chunkSize": 4})
+	if err != nil {
+		t.Fatalf("Failed to create uploads: %+v", err)
+	}
+	data := []byte("large state file")
+	hash := sha256.Sum256(data)
+
+	start, err := h.StartUpload(&rpc.RsStartUploadRequest{
+		Token: token.Marshal(), Path: "dir/state", Size: int64(len(data)),
+		SHA256: hash[:]})
+	if err != nil {
+		t.Fatalf("Failed to start upload: %+v", err)
+	} else if start.GetChunkSize() != 4 {
+		t.Errorf("Unexpected chunk size.\nexpected: %d\nreceived: %d",
+			4, start.GetChunkSize())
+	}
+	id := start.GetUploadID()
+
+	// The response to the second chunk is lost, so the client asks where to
+	// resume
+	for _, offset := range []int64{0, 4} {
+		_, err = h.UploadChunk(&rpc.RsUploadChunkRequest{Token: token.Marshal(),
+			UploadID: id, Offset: offset, Data: data[offset : offset+4]})
+		if err != nil {
+			t.Fatalf("Failed to upload chunk at %d: %+v", offset, err)
+		}
+	}
+	got, err := h.GetUpload(
+		&rpc.RsGetUploadRequest{Token: token.Marshal(), UploadID: id})
+	if err != nil {
+		t.Fatalf("Failed to get upload: %+v", err)
+	} else if got.GetReceived() != 8 || got.GetPath() != "dir/state" {
+		t.Errorf("Unexpected upload: %+v", got)
+	}
+	for offset := got.GetReceived(); offset < int64(len(data)); offset += 4 {
+		_, err = h.UploadChunk(&rpc.RsUploadChunkRequest{Token: token.Marshal(),
+			UploadID: id, Offset: offset, Data: data[offset : offset+4]})
+		if err != nil {
+			t.Fatalf("Failed to upload chunk at %d: %+v", offset, err)
+		}
+	}
+
+	finish, err := h.FinishUpload(context.Background(),
+		&rpc.RsFinishUploadRequest{Token: token.Marshal(), UploadID: id})
+	if err != nil {
+		t.Fatalf("Failed to finish upload: %+v", err)
+	} else if finish.GetPath() != "dir/state" {
+		t.Errorf("Unexpected path.\nexpected: %s\nreceived: %s",
+			"dir/state", finish.GetPath())
+	}
+	read, err := h.Read(context.Background(),
+		&pb.RsReadRequest{Token: token.Marshal(), Path: "dir/state"})
+	if err != nil {
+		t.Fatalf("Failed to read uploaded file: %+v", err)
+	} else if !bytes.Equal(read.GetData(), data) {
+		t.Errorf("Unexpected data.\nexpected: %q\nreceived: %q",
+			data, read.GetData())
+	}
+
+	_, err = h.GetUpload(
+		&rpc.RsGetUploadRequest{Token: token.Marshal(), UploadID: id})
+	if !errors.Is(err, UnknownUploadErr) {
+		t.Errorf("Unexpected error for finished upload."+
+			"\nexpected: %v\nreceived: %+v", UnknownUploadErr, err)
+	}
+}
+
+// Error path: Tests that handler.FinishUpload returns UploadHashErr when the
+// data does not match the hash and does not write the file.
+func Test_handler_FinishUpload_UploadHashError(t *testing.T) {
+	h, token := newHandlerLogin(
+		time.Hour, "waldo", "hunter2", rand.New(rand.NewSource(5521)), t)
+	h.uploads, _ = NewUploads(nil)
+	hash := sha256.Sum256([]byte("expected"))
+
+	start, err := h.StartUpload(&rpc.RsStartUploadRequest{
+		Token: token.Marshal(), Path: "state", Size: 8, SHA256: hash[:]})
+	if err != nil {
+		t.Fatalf("Failed to start upload: %+v", err)
+	}
+	_, err = h.UploadChunk(&rpc.RsUploadChunkRequest{Token: token.Marshal(),
+		UploadID: start.GetUploadID(), Data: []byte("received")})
+	if err != nil {
+		t.Fatalf("Failed to upload chunk: %+v", err)
+	}
+
+	_, err = h.FinishUpload(context.Background(), &rpc.RsFinishUploadRequest{
+		Token: token.Marshal(), UploadID: start.GetUploadID()})
+	if !errors.Is(err, UploadHashErr) {
+		t.Errorf("Unexpected error for wrong hash."+
+			"\nexpected: %v\nreceived: %+v", UploadHashErr, err)
+	}
+	_, err = h.Read(context.Background(),
+		&pb.RsReadRequest{Token: token.Marshal(), Path: "state"})
+	if err == nil {
+		t.Errorf("File written with wrong hash.")
+	}
+}
+
+// Error path: Tests that handler.StartUpload returns UploadsDisabledErr when
+// resumable uploads are not enabled.
+func Test_handler_StartUpload_UploadsDisabledError(t *testing.T) {
+	h, token := newHandlerLogin(
+		time.Hour, "waldo", "hunter2", rand.New(rand.NewSource(5522)), t)
+
+	_, err := h.StartUpload(&rpc.RsStartUploadRequest{
+		Token: token.Marshal(), Path: "state", Size: 8})
+	if !errors.Is(err, UploadsDisabledErr) {
+		t.Errorf("Unexpected error without uploads."+
+			"\nexpected: %v\nreceived: %+v", UploadsDisabledErr, err)
+	}
+}
+
+// Error path: Tests that files over the maximum object size are not written by
+// handler.Write or started by handler.StartUpload.
+func Test_handler_ObjectTooLargeError(t *testing.T) {
+	h, token := newHandlerLogin(
+		time.Hour, "waldo", "hunter2", rand.New(rand.NewSource(6840)), t)
+	h.limits, _ = NewLimits(8, 0)
+	h.uploads, _ = NewUploads(nil)
+
+	_, err := h.Write(context.Background(), &pb.RsWriteRequest{
+		Token: token.Marshal(), Path: "state", Data: []byte("too large")})
+	if !errors.Is(err, ObjectTooLargeErr) {
+		t.Errorf("Unexpected error for large write."+
+			"\nexpected: %v\nreceived: %+v", ObjectTooLargeErr, err)
+	}
+	if _, err = h.Read(context.Background(), &pb.RsReadRequest{
+		Token: token.Marshal(), Path: "state"}); err == nil {
+		t.Errorf("Large file was written.")
+	}
+
+	_, err = h.StartUpload(&rpc.RsStartUploadRequest{
+		Token: token.Marshal(), Path: "state", Size: 9})
+	if !errors.Is(err, ObjectTooLargeErr) {
+		t.Errorf("Unexpected error for large upload."+
+			"\nexpected: %v\nreceived: %+v", ObjectTooLargeErr, err)
+	}
+
+	_, err = h.Write(context.Background(), &pb.RsWriteRequest{
+		Token: token.Marshal(), Path: "state", Data: []byte("fits")})
+	if err != nil {
+		t.Errorf("Failed to write file under the limit: %+v", err)
+	}
+}
+
+// Tests that a file is updated with handler.ApplyDelta from a delta computed
+// from the signature returned by handler.GetSignature.
+func Test_handler_GetSignature_ApplyDelta(t *testing.T) {
+	h, token := newHandlerLogin(
+		time.Hour, "waldo", "hunter2", rand.New(rand.NewSource(6630)), t)
+	h.delta, _ = NewDelta(map[string]interface{}{"blockSize": 64})
+	base := bytes.Repeat([]byte("0123456789abcdef"), 64)
+	_, err := h.Write(context.Background(), &pb.RsWriteRequest{
+		Token: token.Marshal(), Path: "state", Data: base})
+	if err != nil {
+		t.Fatalf("Failed to write base: %+v", err)
+	}
+
+	resp, err := h.GetSignature(context.Background(),
+		&rpc.RsGetSignatureRequest{Token: token.Marshal(), Path: "state"})
+	if err != nil {
+		t.Fatalf("Failed to get signature: %+v", err)
+	}
+	sig := DeltaSignature{BlockSize: int(resp.GetBlockSize()),
+		Size: resp.GetSize(), SHA256: resp.GetSHA256()}
+	for _, b := range resp.GetBlocks() {
+		sig.Blocks = append(sig.Blocks,
+			DeltaBlock{Weak: b.GetWeak(), Strong: b.GetStrong()})
+	}
+
+	data := append(append([]byte{}, base[:500]...), "changed"...)
+	data = append(data, base[500:]...)
+	msg := &rpc.RsApplyDeltaRequest{Token: token.Marshal(), Path: "state",
+		BlockSize: resp.GetBlockSize(), BaseSHA256: resp.GetSHA256()}
+	for _, op := range ComputeDelta(sig, data) {
+		msg.Ops = append(msg.Ops, &rpc.RsDeltaOp{Block: uint64(op.Block),
+			Count: uint64(op.Count), Data: op.Data})
+	}
+	sum := sha256.Sum256(data)
+	msg.SHA256 = sum[:]
+	if _, err = h.ApplyDelta(context.Background(), msg); err != nil {
+		t.Fatalf("Failed to apply delta: %+v", err)
+	}
+
+	read, err := h.Read(context.Background(),
+		&pb.RsReadRequest{Token: token.Marshal(), Path: "state"})
+	if err != nil {
+		t.Fatalf("Failed to read file: %+v", err)
+	} else if !bytes.Equal(read.GetData(), data) {
+		t.Errorf("Unexpected data.\nexpected: %q\nreceived: %q",
+			data, read.GetData())
+	}
+
+	// The delta no longer applies once the file changed
+	_, err = h.ApplyDelta(context.Background(), msg)
+	if !errors.Is(err, DeltaBaseErr) {
+		t.Errorf("Unexpected error for changed file."+
+			"\nexpected: %v\nreceived: %+v", DeltaBaseErr, err)
+	}
+}
+
+// Error path: Tests that handler.ApplyDelta returns DeltaHashErr and does not
+// write the file when the reconstructed data does not match its hash.
+func Test_handler_ApplyDelta_DeltaHashError(t *testing.T) {
+	h, token := newHandlerLogin(
+		time.Hour, "waldo", "hunter2", rand.New(rand.NewSource(6631)), t)
+	h.delta, _ = NewDelta(nil)
+	_, _ = h.Write(context.Background(), &pb.RsWriteRequest{
+		Token: token.Marshal(), Path: "state", Data: []byte("base")})
+	base := sha256.Sum256([]byte("base"))
+	sum := sha256.Sum256([]byte("expected"))
+
+	_, err := h.ApplyDelta(context.Background(), &rpc.RsApplyDeltaRequest{
+		Token: token.Marshal(), Path: "state", BlockSize: 1024,
+		BaseSHA256: base[:], SHA256: sum[:],
+		Ops: []*rpc.RsDeltaOp{{Data: []byte("received")}}})
+	if !errors.Is(err, DeltaHashErr) {
+		t.Errorf("Unexpected error for wrong hash."+
+			"\nexpected: %v\nreceived: %+v", DeltaHashErr, err)
+	}
+	read, _ := h.Read(context.Background(),
+		&pb.RsReadRequest{Token: token.Marshal(), Path: "state"})
+	if string(read.GetData()) != "base" {
+		t.Errorf("File written with wrong hash: %q", read.GetData())
+	}
+}
+
+// Error path: Tests that handler.GetSignature returns DeltaDisabledErr when
+// delta sync is not enabled.
+func Test_handler_GetSignature_DeltaDisabledError(t *testing.T) {
+	h, token := newHandlerLogin(
+		time.Hour, "waldo", "hunter2", rand.New(rand.NewSource(6632)), t)
+
+	_, err := h.GetSignature(context.Background(),
+		&rpc.RsGetSignatureRequest{Token: token.Marshal(), Path: "state"})
+	if !errors.Is(err, DeltaDisabledErr) {
+		t.Errorf("Unexpected error without delta sync."+
+			"\nexpected: %v\nreceived: %+v", DeltaDisabledErr, err)
+	}
+}
+
+// Tests that handler.Watch sends the changes to the files of the user under
+// the path, sends an empty event when idle, and returns once the context is
+// done.
+func Test_handler_Watch(t *testing.T) {
+	cf, _ := NewChangeFeed(
+		map[string]interface{}{"keepaliveInterval": "50ms"})
+	h, token, _ := newHandlerStoreLogin(time.Hour, "waldo", "hunter2",
+		rand.New(rand.NewSource(6633)), cf.wrap(store.NewMemStore), t)
+	h.changes = cf
+	watchers := func() int {
+		cf.mux.Lock()
+		defer cf.mux.Unlock()
+		return len(cf.watchers["waldo"])
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	events := make(chan *rpc.RsChangeEvent, 10)
+	done := make(chan error)
+	go func() {
+		done <- h.Watch(ctx, &rpc.RsWatchRequest{
+			Token: token.Marshal(), Path: "docs/"},
+			func(e *rpc.RsChangeEvent) error { events <- e; return nil })
+	}()
+	for start := time.Now(); watchers() == 0; {
+		if time.Since(start) > time.Second {
+			t.Fatalf("Watcher not added.")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	for _, path := range []string{"photos/a", "docs/b"} {
+		_, err := h.Write(context.Background(), &pb.RsWriteRequest{
+			Token: token.Marshal(), Path: path, Data: []byte(path)})
+		if err != nil {
+			t.Fatalf("Failed to write %s: %+v", path, err)
+		}
+	}
+	select {
+	case e := <-events:
+		if e.GetPath() != "docs/b" || e.GetDeleted() || e.GetTimestamp() == 0 {
+			t.Errorf("Unexpected event: %v", e)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("No event for write.")
+	}
+	select {
+	case e := <-events:
+		if e.GetPath() != "" {
+			t.Errorf("Unexpected keepalive event: %v", e)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("No keepalive event.")
+	}
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Errorf("Unexpected error once cancelled: %+v", err)
+	}
+	if watchers() != 0 {
+		t.Errorf("Watcher not removed once cancelled.")
+	}
+}
+
+// Error path: Tests that handler.Watch returns ChangesDisabledErr when change
+// notifications are not enabled and InvalidTokenErr for an invalid token.
+func Test_handler_Watch_Error(t *testing.T) {
+	h, token := newHandlerLogin(
+		time.Hour, "waldo", "hunter2", rand.New(rand.NewSource(6634)), t)
+	send := func(*rpc.RsChangeEvent) error { return nil }
+
+	err := h.Watch(context.Background(),
+		&rpc.RsWatchRequest{Token: token.Marshal()}, send)
+	if !errors.Is(err, ChangesDisabledErr) {
+		t.Errorf("Unexpected error without change notifications."+
+			"\nexpected: %v\nreceived: %+v", ChangesDisabledErr, err)
+	}
+
+	h.changes, _ = NewChangeFeed(nil)
+	err = h.Watch(context.Background(),
+		&rpc.RsWatchRequest{Token: []byte("invalid")}, send)
 	if !errors.Is(err, InvalidTokenErr) {
 		t.Errorf("Unexpected error for invalid token."+
 			"\nexpected: %v\nreceived: %+v", InvalidTokenErr, err)
@@ -490,9 +1037,7 @@ func Test_handler_verifyUser(t *testing.T) {
 	prng.Read(salt)
 	passwordHash := hashPassword(password, salt)
 	h := &handler{
-		userPasswords: map[string]string{
-			username: password,
-		},
+		users: credentials.NewMemStore(map[string]string{username: password}),
 	}
 
 	err := h.verifyUser(username, passwordHash, salt)
@@ -511,9 +1056,7 @@ func Test_handler_verifyUser_InvalidUsernameError(t *testing.T) {
 	prng.Read(salt)
 	passwordHash := hashPassword(password, salt)
 	h := &handler{
-		userPasswords: map[string]string{
-			username: password,
-		},
+		users: credentials.NewMemStore(map[string]string{username: password}),
 	}
 
 	err := h.verifyUser(username+"junk", passwordHash, salt)
@@ -533,9 +1076,7 @@ func Test_handler_verifyUser_InvalidPasswordError(t *testing.T) {
 	prng.Read(salt)
 	passwordHash := hashPassword(password, salt)
 	h := &handler{
-		userPasswords: map[string]string{
-			username: password,
-		},
+		users: credentials.NewMemStore(map[string]string{username: password}),
 	}
 
 	err := h.verifyUser(username, append(passwordHash, []byte("junk")...), salt)
@@ -637,6 +1178,210 @@ func Test_handler_addSession(t *testing.T) {
 	}
 }
 
+// Tests that logging in again with handler.addSession renews the expiration
+// time of the session.
+func Test_handler_addSession_RenewsExpiry(t *testing.T) {
+	h := newHandler("", time.Hour, nil, nil, store.NewMemStore)
+	si, err := h.addSession("waldo")
+	if err != nil {
+		t.Fatalf("Failed to add session: %+v", err)
+	}
+	si.ExpiryTime = time.Now().Add(time.Second)
+
+	if si, err = h.addSession("waldo"); err != nil {
+		t.Fatalf("Failed to add session: %+v", err)
+	}
+	if time.Until(si.ExpiryTime) < 59*time.Minute {
+		t.Errorf("Expiration time not renewed: %s", si.ExpiryTime)
+	}
+}
+
+// Tests that handler.removeExpiredSessions removes only the expired sessions
+// and their tokens.
+func Test_handler_removeExpiredSessions(t *testing.T) {
+	h := newHandler("", time.Hour, nil, nil, store.NewMemStore)
+	expired, err := h.addSession("waldo")
+	if err != nil {
+		t.Fatalf("Failed to add session: %+v", err)
+	}
+	expired.ExpiryTime = time.Now().Add(-time.Second)
+	valid, err := h.addSession("carmen")
+	if err != nil {
+		t.Fatalf("Failed to add session: %+v", err)
+	}
+
+	if removed := h.removeExpiredSessions(); removed != 1 {
+		t.Errorf("Unexpected number of sessions removed."+
+			"\nexpected: %d\nreceived: %d", 1, removed)
+	}
+
+	if _, exists := h.sessions[Token(expired.Value)]; exists {
+		t.Errorf("Expired session not removed.")
+	}
+	if _, exists := h.userTokens["waldo"]; exists {
+		t.Errorf("Token of expired session not removed.")
+	}
+	if _, err = h.getSession(Token(valid.Value)); err != nil {
+		t.Errorf("Failed to get valid session: %+v", err)
+	}
+}
+
+// Tests that handler.RevokeToken ends the session and that the token stays
+// revoked after the session is gone.
+func Test_handler_RevokeToken(t *testing.T) {
+	h := newHandler("", time.Hour, nil, nil, store.NewMemStore)
+	h.revoked, _ = NewRevocationList("")
+	s, err := h.addSession("waldo")
+	if err != nil {
+		t.Fatalf("Failed to add session: %+v", err)
+	}
+	token := Token(s.Value)
+
+	if ended, err := h.RevokeToken(token); err != nil {
+		t.Fatalf("Failed to revoke token: %+v", err)
+	} else if !ended {
+		t.Errorf("Active session not reported as ended.")
+	}
+
+	if _, err = h.getSession(token); !errors.Is(err, InvalidTokenErr) {
+		t.Errorf("Unexpected error for revoked token."+
+			"\nexpected: %v\nreceived: %+v", InvalidTokenErr, err)
+	}
+	if !h.revoked.IsRevoked(token, "waldo", s.GenTime) {
+		t.Errorf("Token not added to revocation list.")
+	}
+}
+
+// Tests that handler.RevokeUser ends the user's session and that they can log
+// in again afterwards.
+func Test_handler_RevokeUser(t *testing.T) {
+	h := newHandler("", time.Hour, nil, nil, store.NewMemStore)
+	h.revoked, _ = NewRevocationList("")
+	s, err := h.addSession("waldo")
+	if err != nil {
+		t.Fatalf("Failed to add session: %+v", err)
+	}
+	token := Token(s.Value)
+
+	if ended, err := h.RevokeUser("waldo"); err != nil {
+		t.Fatalf("Failed to revoke user: %+v", err)
+	} else if !ended {
+		t.Errorf("Active session not reported as ended.")
+	}
+	if _, err = h.getSession(token); !errors.Is(err, InvalidTokenErr) {
+		t.Errorf("Unexpected error for revoked token."+
+			"\nexpected: %v\nreceived: %+v", InvalidTokenErr, err)
+	}
+
+	// Tokens issued after the revocation are valid
+	time.Sleep(time.Millisecond)
+	s, err = h.addSession("waldo")
+	if err != nil {
+		t.Fatalf("Failed to add session: %+v", err)
+	}
+	if _, err = h.getSession(Token(s.Value)); err != nil {
+		t.Errorf("Failed to get session after revocation: %+v", err)
+	}
+}
+
+// Error path: Tests that handler.getSession returns InvalidTokenErr for a
+// token that was revoked after the session was loaded.
+func Test_handler_getSession_RevokedTokenError(t *testing.T) {
+	h := newHandler("", time.Hour, nil, nil, store.NewMemStore)
+	h.revoked, _ = NewRevocationList("")
+	s, err := h.addSession("waldo")
+	if err != nil {
+		t.Fatalf("Failed to add session: %+v", err)
+	}
+	if err = h.revoked.RevokeUser("waldo", time.Now()); err != nil {
+		t.Fatalf("Failed to revoke user: %+v", err)
+	}
+
+	if _, err = h.getSession(Token(s.Value)); !errors.Is(err, InvalidTokenErr) {
+		t.Errorf("Unexpected error for revoked token."+
+			"\nexpected: %v\nreceived: %+v", InvalidTokenErr, err)
+	}
+	if _, exists := h.userTokens["waldo"]; exists {
+		t.Errorf("Revoked session not removed.")
+	}
+}
+
+// Tests that handler.APIKeyLogin returns a token that is limited to the
+// scopes of the key and that does not replace the user's own token.
+func Test_handler_APIKeyLogin(t *testing.T) {
+	h := newHandler("", time.Hour, nil, nil, store.NewMemStore)
+	h.apiKeys = NewAPIKeys(credentials.NewMemStore(nil))
+	s, err := h.addSession("waldo")
+	if err != nil {
+		t.Fatalf("Failed to add session: %+v", err)
+	}
+	userToken := Token(s.Value)
+
+	key, err := h.apiKeys.Create("waldo", Scopes{ScopeRead})
+	if err != nil {
+		t.Fatalf("Failed to create API key: %+v", err)
+	}
+	msg, err := h.APIKeyLogin(&rpc.RsAPIKeyLoginRequest{Key: key})
+	if err != nil {
+		t.Fatalf("Failed to log in with API key: %+v", err)
+	}
+	if msg.GetUsername() != "waldo" {
+		t.Errorf("Unexpected username.\nexpected: %q\nreceived: %q",
+			"waldo", msg.GetUsername())
+	}
+
+	// The key session shares the user's files but can only read them
+	if _, err = h.Write(context.Background(), &pb.RsWriteRequest{
+		Path: "file", Data: []byte("data"), Token: userToken[:]}); err != nil {
+		t.Fatalf("Failed to write with user token: %+v", err)
+	}
+	data, err := h.Read(context.Background(), &pb.RsReadRequest{Path: "file", Token: msg.GetToken()})
+	if err != nil {
+		t.Errorf("Failed to read with API key token: %+v", err)
+	} else if string(data.GetData()) != "data" {
+		t.Errorf("Unexpected data: %q", data.GetData())
+	}
+	_, err = h.Write(context.Background(), &pb.RsWriteRequest{
+		Path: "file", Data: []byte("data"), Token: msg.GetToken()})
+	if !errors.Is(err, InsufficientScopeErr) {
+		t.Errorf("Unexpected error writing with read-only key."+
+			"\nexpected: %v\nreceived: %+v", InsufficientScopeErr, err)
+	}
+
+	if h.userTokens["waldo"] != userToken {
+		t.Errorf("API key login replaced the user's token.")
+	}
+}
+
+// Error path: Tests that handler.APIKeyLogin returns the expected errors when
+// API keys are disabled, for invalid keys, and for keys that cannot access
+// files.
+func Test_handler_APIKeyLogin_Error(t *testing.T) {
+	h := newHandler("", time.Hour, nil, nil, store.NewMemStore)
+	_, err := h.APIKeyLogin(&rpc.RsAPIKeyLoginRequest{Key: "id.secret"})
+	if !errors.Is(err, APIKeysDisabledErr) {
+		t.Errorf("Unexpected error when disabled."+
+			"\nexpected: %v\nreceived: %+v", APIKeysDisabledErr, err)
+	}
+
+	h.apiKeys = NewAPIKeys(credentials.NewMemStore(nil))
+	_, err = h.APIKeyLogin(&rpc.RsAPIKeyLoginRequest{Key: "id.secret"})
+	if !errors.Is(err, InvalidAPIKeyErr) {
+		t.Errorf("Unexpected error for invalid key."+
+			"\nexpected: %v\nreceived: %+v", InvalidAPIKeyErr, err)
+	}
+
+	key, err := h.apiKeys.Create("", Scopes{ScopeAdmin})
+	if err != nil {
+		t.Fatalf("Failed to create API key: %+v", err)
+	}
+	_, err = h.APIKeyLogin(&rpc.RsAPIKeyLoginRequest{Key: key})
+	if !errors.Is(err, InsufficientScopeErr) {
+		t.Errorf("Unexpected error for admin key."+
+			"\nexpected: %v\nreceived: %+v", InsufficientScopeErr, err)
+	}
+}
+
 func newHandlerLogin(ttl time.Duration, username, password string,
 	prng *rand.Rand, t testing.TB) (*handler, Token) {
 	h, token, _ := newHandlerStoreLogin(
@@ -658,12 +1403,8 @@ func newHandlerStoreLogin(ttl time.Duration, username, password string,
 		}
 	}
 
-	h, err := newHandler(
-		testDir, ttl, [][]string{{username, password}}, newStore)
-	if err != nil {
-		closeFn()
-		t.Fatalf("Failed to make new handler: %+v", err)
-	}
+	h := newHandler(testDir, ttl, credentials.NewMemStore(
+		map[string]string{username: password}), nil, newStore)
 	msg, err := h.Login(&pb.RsAuthenticationRequest{
 		Username:     username,
 		PasswordHash: passwordHash,
@@ -676,3 +1417,117 @@ func newHandlerStoreLogin(ttl time.Duration, username, password string,
 
 	return h, UnmarshalToken(msg.GetToken()), closeFn
 }
+
+// newTestHasher creates an Argon2Hasher with small parameters so that tests
+// run quickly.
+func newTestHasher(t testing.TB) *credentials.Argon2Hasher {
+	hasher, err := credentials.NewArgon2Hasher(
+		map[string]interface{}{"time": 1, "memory": 64, "threads": 1})
+	if err != nil {
+		t.Fatalf("Failed to create Argon2Hasher: %+v", err)
+	}
+	return hasher
+}
+
+// benchmarkPayloadSizes are the sizes, in bytes, of the files written and read
+// by the benchmarks of the handler.
+var benchmarkPayloadSizes = []int{1 << 10, 64 << 10, 1 << 20}
+
+// benchmarkBackends are the storage backends of the benchmarks of the handler.
+var benchmarkBackends = []struct {
+	name     string
+	newStore func(b *testing.B) store.NewStore
+}{
+	{"Memory", func(*testing.B) store.NewStore { return store.NewMemStore }},
+	{"File", func(b *testing.B) store.NewStore {
+		dir := b.TempDir()
+		return func(_, baseDir string) (store.Store, error) {
+			return store.NewFileStore(dir, baseDir)
+		}
+	}},
+}
+
+// Benchmarks handler.Write of files of each size to each backend.
+func Benchmark_handler_Write(b *testing.B) {
+	for _, backend := range benchmarkBackends {
+		for _, size := range benchmarkPayloadSizes {
+			b.Run(fmt.Sprintf("%s/%d", backend.name, size), func(b *testing.B) {
+				h, token, _ := newHandlerStoreLogin(time.Hour, "waldo",
+					"hunter2", rand.New(rand.NewSource(100)),
+					backend.newStore(b), b)
+				msg := &pb.RsWriteRequest{Token: token.Marshal(),
+					Path: "dir/file", Data: make([]byte, size)}
+				ctx := context.Background()
+
+				b.ReportAllocs()
+				b.SetBytes(int64(size))
+				b.ResetTimer()
+				for i := 0; i < b.N; i++ {
+					if _, err := h.Write(ctx, msg); err != nil {
+						b.Fatalf("Failed to write: %+v", err)
+					}
+				}
+			})
+		}
+	}
+}
+
+// Benchmarks handler.Read of files of each size from each backend.
+func Benchmark_handler_Read(b *testing.B) {
+	for _, backend := range benchmarkBackends {
+		for _, size := range benchmarkPayloadSizes {
+			b.Run(fmt.Sprintf("%s/%d", backend.name, size), func(b *testing.B) {
+				h, token, _ := newHandlerStoreLogin(time.Hour, "waldo",
+					"hunter2", rand.New(rand.NewSource(100)),
+					backend.newStore(b), b)
+				ctx := context.Background()
+				_, err := h.Write(ctx, &pb.RsWriteRequest{
+					Token: token.Marshal(), Path: "dir/file",
+					Data: make([]byte, size)})
+				if err != nil {
+					b.Fatalf("Failed to write: %+v", err)
+				}
+				msg := &pb.RsReadRequest{
+					Token: token.Marshal(), Path: "dir/file"}
+
+				b.ReportAllocs()
+				b.SetBytes(int64(size))
+				b.ResetTimer()
+				for i := 0; i < b.N; i++ {
+					if _, err = h.Read(ctx, msg); err != nil {
+						b.Fatalf("Failed to read: %+v", err)
+					}
+				}
+			})
+		}
+	}
+}
+
+// Benchmarks handler.PasswordLogin and handler.Login of a user with a
+// cleartext password, so that the cost of hashing is not measured.
+func Benchmark_handler_Login(b *testing.B) {
+	h, _, _ := newHandlerStoreLogin(time.Hour, "waldo", "hunter2",
+		rand.New(rand.NewSource(100)), store.NewMemStore, b)
+	salt := make([]byte, 32)
+	passwordMsg := &rpc.RsPasswordLoginRequest{
+		Username: "waldo", Password: "hunter2"}
+	hashMsg := &pb.RsAuthenticationRequest{Username: "waldo",
+		PasswordHash: hashPassword("hunter2", salt), Salt: salt}
+
+	b.Run("PasswordLogin", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if _, err := h.PasswordLogin(passwordMsg); err != nil {
+				b.Fatalf("Failed to log in: %+v", err)
+			}
+		}
+	})
+	b.Run("Login", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if _, err := h.Login(hashMsg); err != nil {
+				b.Fatalf("Failed to log in: %+v", err)
+			}
+		}
+	})
+}
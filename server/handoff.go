@@ -0,0 +1,250 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package server
+
+import (
+	"net"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	jww "github.com/spf13/jwalterweatherman"
+)
+
+// handoffAddressesEnv is the environment variable that lists the addresses of
+// the listening sockets passed to a new process by an upgrade, separated by
+// commas, in the order of their file descriptors starting at listenFDsStart.
+// The descriptor after the sockets is the write end of a pipe that the new
+// process writes handoffReady to once it is serving. It does not have the
+// prefix of the config environment variables so that it is not read as an
+// option.
+const handoffAddressesEnv = "LISTEN_HANDOFF_ADDRESSES"
+
+// handoffReady is written to the pipe by the new process once it is serving.
+const handoffReady = 'R'
+
+// handoffReadyTimeout is the maximum time the old process waits for the new
+// one to start serving before abandoning the upgrade.
+const handoffReadyTimeout = time.Minute
+
+// handoffDrainTimeout is the maximum time the old process waits for the
+// requests in progress to complete after the new one starts serving.
+const handoffDrainTimeout = 30 * time.Second
+
+// listenFunc listens on a TCP address.
+type listenFunc func(address string) (net.Listener, error)
+
+// Handoff passes the listening sockets of the server to a new process of the
+// server binary, so that it can be upgraded without refusing connections. The
+// new process is started with the same arguments and serves on the same
+// sockets before the old one stops accepting connections and completes the
+// requests in progress.
+type Handoff struct {
+	// inherited are the sockets passed by the previous process that are not
+	// used yet, by address.
+	inherited map[string]net.Listener
+
+	// listeners are the sockets used by the server, by address, which are
+	// passed to the next process.
+	listeners map[string]net.Listener
+
+	// ready is the pipe to the previous process, or nil if the process was not
+	// started by an upgrade.
+	ready *os.File
+
+	mux sync.Mutex
+}
+
+// NewHandoff returns a Handoff with the sockets passed by the previous process
+// if the process was started by an upgrade. The environment variable listing
+// them is unset so that it is not inherited by other child processes. Returns
+// an error if a passed descriptor is not a listening socket.
+func NewHandoff() (*Handoff, error) {
+	addresses := os.Getenv(handoffAddressesEnv)
+	_ = os.Unsetenv(handoffAddressesEnv)
+
+	ho := &Handoff{
+		inherited: make(map[string]net.Listener),
+		listeners: make(map[string]net.Listener),
+	}
+	if addresses == "" {
+		return ho, nil
+	}
+
+	for i, address := range strings.Split(addresses, ",") {
+		f := os.NewFile(uintptr(listenFDsStart+i), address)
+
+		// FileListener duplicates the descriptor, so the original is closed
+		l, err := net.FileListener(f)
+		_ = f.Close()
+		if err != nil {
+			for _, inherited := range ho.inherited {
+				_ = inherited.Close()
+			}
+			return nil, errors.Wrapf(err, "socket for %s from the previous "+
+				"process is not a listening socket", address)
+		}
+		ho.inherited[address] = l
+	}
+	ho.ready = os.NewFile(
+		uintptr(listenFDsStart+len(ho.inherited)), "handoff ready")
+	return ho, nil
+}
+
+// Inherited returns true if the process was started by an upgrade.
+func (ho *Handoff) Inherited() bool {
+	return ho.ready != nil
+}
+
+// listen returns the socket passed by the previous process for the address or
+// listens on it if there is none. The socket is passed to the next process.
+func (ho *Handoff) listen(address string) (net.Listener, error) {
+	ho.mux.Lock()
+	defer ho.mux.Unlock()
+
+	l, ok := ho.inherited[address]
+	if ok {
+		delete(ho.inherited, address)
+	} else {
+		var err error
+		if l, err = net.Listen("tcp", address); err != nil {
+			return nil, err
+		}
+	}
+	ho.listeners[address] = l
+	return l, nil
+}
+
+// add passes a socket that the server did not open with listen, such as one
+// from systemd socket activation, to the next process.
+func (ho *Handoff) add(address string, l net.Listener) {
+	ho.mux.Lock()
+	defer ho.mux.Unlock()
+	ho.listeners[address] = l
+}
+
+// serving tells the previous process, if any, that the server is serving so
+// that it can stop. Inherited sockets that are no longer configured are
+// closed.
+func (ho *Handoff) serving() {
+	ho.mux.Lock()
+	defer ho.mux.Unlock()
+
+	if ho.ready == nil {
+		return
+	}
+	if _, err := ho.ready.Write([]byte{handoffReady}); err != nil {
+		jww.WARN.Printf("Failed to tell the previous process that the server "+
+			"is serving: %+v", err)
+	}
+	_ = ho.ready.Close()
+	ho.ready = nil
+
+	for address, l := range ho.inherited {
+		jww.INFO.Printf("Closing socket for %s from the previous process, "+
+			"which is no longer configured.", address)
+		_ = l.Close()
+	}
+	ho.inherited = make(map[string]net.Listener)
+}
+
+// upgrade starts a new process of the server binary, with the same arguments,
+// and passes it the sockets of the server. Returns the PID of the new process
+// once it is serving. Returns an error, and stops the new process, if it exits
+// or does not serve within the timeout.
+func (ho *Handoff) upgrade(timeout time.Duration) (int, error) {
+	ho.mux.Lock()
+	defer ho.mux.Unlock()
+
+	executable, err := os.Executable()
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to find the server binary")
+	}
+
+	// Sorted so that the order of the descriptors is stable
+	addresses := make([]string, 0, len(ho.listeners))
+	for address := range ho.listeners {
+		addresses = append(addresses, address)
+	}
+	sort.Strings(addresses)
+
+	files := make([]*os.File, 0, len(addresses)+1)
+	defer func() {
+		for _, f := range files {
+			_ = f.Close()
+		}
+	}()
+	for _, address := range addresses {
+		filer, ok := ho.listeners[address].(interface {
+			File() (*os.File, error)
+		})
+		if !ok {
+			return 0, errors.Errorf("socket for %s cannot be passed", address)
+		}
+		f, err := filer.File()
+		if err != nil {
+			return 0, errors.Wrapf(err, "failed to get socket for %s", address)
+		}
+		files = append(files, f)
+	}
+
+	ready, readyWriter, err := os.Pipe()
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to create pipe to new process")
+	}
+	defer func() { _ = ready.Close() }()
+	files = append(files, readyWriter)
+
+	cmd := exec.Command(executable, os.Args[1:]...)
+	cmd.Env = append(os.Environ(),
+		handoffAddressesEnv+"="+strings.Join(addresses, ","))
+	cmd.Stdout, cmd.Stderr = os.Stdout, os.Stderr
+	cmd.ExtraFiles = files
+	err = cmd.Start()
+
+	// Passing the sockets puts them in blocking mode, which is shared with the
+	// sockets of the server, so that closing them would wait for the next
+	// connection. FileListener puts them back in non-blocking mode.
+	for _, f := range files[:len(addresses)] {
+		if l, err := net.FileListener(f); err == nil {
+			_ = l.Close()
+		}
+	}
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to start new process")
+	}
+	jww.INFO.Printf("Started new process %d; waiting for it to serve.",
+		cmd.Process.Pid)
+
+	// Close the write end so that reading fails if the new process exits
+	_ = readyWriter.Close()
+	files = files[:len(files)-1]
+
+	buf := make([]byte, 1)
+	err = ready.SetReadDeadline(time.Now().Add(timeout))
+	if err == nil {
+		_, err = ready.Read(buf)
+	}
+	if err != nil || buf[0] != handoffReady {
+		_ = cmd.Process.Kill()
+		_ = cmd.Wait()
+		if err == nil {
+			err = errors.Errorf("unexpected message %q", buf[0])
+		}
+		return 0, errors.Wrapf(err, "new process %d did not start serving",
+			cmd.Process.Pid)
+	}
+
+	// The new process continues after this one exits
+	pid := cmd.Process.Pid
+	return pid, cmd.Process.Release()
+}
@@ -0,0 +1,156 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+//go:build !windows
+
+package server
+
+import (
+	"io"
+	"net"
+	"os"
+	"testing"
+	"time"
+)
+
+// handoffTestModeEnv tells TestHandoff_helperProcess, run as the new process
+// by the upgrade tests, what to do: "serve" to serve one connection on the
+// inherited socket or "exit" to exit without serving.
+const handoffTestModeEnv = "LISTEN_HANDOFF_TEST_MODE"
+
+// handoffTestAddress is the address listened on in the upgrade tests. Both
+// processes use it to refer to the same socket.
+const handoffTestAddress = "127.0.0.1:0"
+
+// runHelperOnUpgrade makes upgrades in the test run TestHandoff_helperProcess
+// in the new process in the mode.
+func runHelperOnUpgrade(t *testing.T, mode string) {
+	t.Setenv(handoffTestModeEnv, mode)
+	args := os.Args
+	os.Args = []string{args[0], "-test.run=^TestHandoff_helperProcess$"}
+	t.Cleanup(func() { os.Args = args })
+}
+
+// TestHandoff_helperProcess is run as the new process by the upgrade tests.
+// It is skipped otherwise.
+func TestHandoff_helperProcess(t *testing.T) {
+	switch os.Getenv(handoffTestModeEnv) {
+	case "":
+		t.Skip("Only run as the new process of an upgrade.")
+	case "exit":
+		os.Exit(1)
+	}
+
+	ho, err := NewHandoff()
+	if err != nil || !ho.Inherited() {
+		os.Exit(2)
+	}
+	l, err := ho.listen(handoffTestAddress)
+	if err != nil {
+		os.Exit(3)
+	}
+	ho.serving()
+
+	_ = l.(*net.TCPListener).SetDeadline(time.Now().Add(10 * time.Second))
+	conn, err := l.Accept()
+	if err != nil {
+		os.Exit(4)
+	}
+	_, _ = conn.Write([]byte("new"))
+	_ = conn.Close()
+	os.Exit(0)
+}
+
+// Tests that NewHandoff returns a Handoff without inherited sockets in a
+// process not started by an upgrade and that listen opens new sockets.
+func TestNewHandoff(t *testing.T) {
+	ho, err := NewHandoff()
+	if err != nil {
+		t.Fatalf("Failed to create handoff: %+v", err)
+	}
+	if ho.Inherited() {
+		t.Error("Process not started by an upgrade inherited sockets.")
+	}
+
+	l, err := ho.listen(handoffTestAddress)
+	if err != nil {
+		t.Fatalf("Failed to listen: %+v", err)
+	}
+	defer l.Close()
+	if ho.listeners[handoffTestAddress] != l {
+		t.Errorf("Socket is not passed on upgrade: %v", ho.listeners)
+	}
+
+	// Serving without a previous process does nothing
+	ho.serving()
+}
+
+// Tests that Handoff.upgrade returns once the new process serves on the
+// socket and that connections are accepted by the new process after the old
+// one closes its socket.
+func TestHandoff_upgrade(t *testing.T) {
+	runHelperOnUpgrade(t, "serve")
+	ho, err := NewHandoff()
+	if err != nil {
+		t.Fatalf("Failed to create handoff: %+v", err)
+	}
+	l, err := ho.listen(handoffTestAddress)
+	if err != nil {
+		t.Fatalf("Failed to listen: %+v", err)
+	}
+
+	pid, err := ho.upgrade(30 * time.Second)
+	if err != nil {
+		_ = l.Close()
+		t.Fatalf("Failed to upgrade: %+v", err)
+	}
+	_ = l.Close()
+	if pid <= 0 || pid == os.Getpid() {
+		t.Errorf("Invalid PID for new process: %d", pid)
+	}
+
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatalf("Failed to dial new process: %+v", err)
+	}
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(10 * time.Second))
+	data, err := io.ReadAll(conn)
+	if err != nil || string(data) != "new" {
+		t.Errorf("Unexpected response from new process.\nexpected: %q"+
+			"\nreceived: %q, %+v", "new", data, err)
+	}
+}
+
+// Error path: Tests that Handoff.upgrade returns an error if the new process
+// exits without serving.
+func TestHandoff_upgrade_ExitError(t *testing.T) {
+	runHelperOnUpgrade(t, "exit")
+	ho, err := NewHandoff()
+	if err != nil {
+		t.Fatalf("Failed to create handoff: %+v", err)
+	}
+	l, err := ho.listen(handoffTestAddress)
+	if err != nil {
+		t.Fatalf("Failed to listen: %+v", err)
+	}
+
+	if _, err = ho.upgrade(30 * time.Second); err == nil {
+		t.Error("Failed to get error for new process that exited.")
+	}
+
+	// The socket must still be non-blocking so that closing it stops Accept
+	go func() { _, _ = l.Accept() }()
+	time.Sleep(50 * time.Millisecond)
+	closed := make(chan error)
+	go func() { closed <- l.Close() }()
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		t.Error("Timed out closing the socket.")
+	}
+}
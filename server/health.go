@@ -0,0 +1,311 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package server
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	jww "github.com/spf13/jwalterweatherman"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+
+	"gitlab.com/elixxir/remoteSyncServer/store"
+)
+
+// Paths of the health check endpoints.
+const (
+	// livenessPath responds OK as long as the process is serving.
+	livenessPath = "/healthz"
+
+	// readinessPath responds OK only if all readiness checks pass.
+	readinessPath = "/readyz"
+)
+
+// defaultHealthTimeout is the default maximum duration of the readiness
+// checks.
+const defaultHealthTimeout = 5 * time.Second
+
+// HealthParams are the parameters of the health check endpoints.
+type HealthParams struct {
+	// Address is the host and port that the health checks are served on over
+	// plain HTTP, such as ":8081". Required.
+	Address string `mapstructure:"address"`
+
+	// Timeout is the maximum duration of the readiness checks. Checks that
+	// take longer fail. Defaults to 5 seconds.
+	Timeout time.Duration `mapstructure:"timeout"`
+}
+
+// Health serves liveness and readiness endpoints over HTTP on their own
+// address for Kubernetes probes and load balancer health checks.
+type Health struct {
+	params     HealthParams
+	httpServer *http.Server
+
+	// checks are the readiness checks, which change from those of the Startup
+	// to those of the server when it starts.
+	checks []healthCheck
+	mux    sync.Mutex
+}
+
+// healthCheck is a named readiness check. It returns an error if the server is
+// not ready.
+type healthCheck struct {
+	name  string
+	check func() error
+}
+
+// NewHealth creates a new Health from the parameters.
+func NewHealth(params map[string]interface{}) (*Health, error) {
+	p := HealthParams{Timeout: defaultHealthTimeout}
+	err := decodeParams(params, &p, "health")
+	if err != nil {
+		return nil, err
+	}
+	if p.Address == "" {
+		return nil, errors.New("health address is required")
+	} else if _, _, err = net.SplitHostPort(p.Address); err != nil {
+		return nil, errors.Wrapf(err, "invalid health address %q", p.Address)
+	} else if p.Timeout <= 0 {
+		return nil, errors.Errorf(
+			"health timeout %s must be positive", p.Timeout)
+	}
+
+	return &Health{params: p}, nil
+}
+
+// ServeStartup serves the health checks while the server starts, before it is
+// created, so that the server is live but not ready while the Startup waits
+// for its dependencies. Start then serves the readiness checks of the server
+// on the same socket. With listener handoff, the socket is passed to the next
+// process on upgrade.
+func (hs *Health) ServeStartup(startup *Startup, handoff *Handoff) error {
+	listen := func(address string) (net.Listener, error) {
+		return net.Listen("tcp", address)
+	}
+	if handoff != nil {
+		listen = handoff.listen
+	}
+	hs.setChecks([]healthCheck{{"startup", startup.check}})
+	return hs.serve(listen)
+}
+
+// start serves the health checks on their address, listened on with the
+// function unless they are already served by ServeStartup, in the background
+// until the stop channel is closed. The server is ready while all the checks
+// pass.
+func (hs *Health) start(
+	checks []healthCheck, listen listenFunc, stop <-chan struct{}) error {
+	hs.setChecks(checks)
+	if !hs.serving() {
+		if err := hs.serve(listen); err != nil {
+			return err
+		}
+	}
+	go func() {
+		<-stop
+		_ = hs.httpServer.Close()
+	}()
+	return nil
+}
+
+// serving returns true if the health checks are already served.
+func (hs *Health) serving() bool {
+	return hs.httpServer != nil
+}
+
+// serve serves the health checks on their address, listened on with the
+// function, in the background.
+func (hs *Health) serve(listen listenFunc) error {
+	listener, err := listen(hs.params.Address)
+	if err != nil {
+		return errors.Wrapf(
+			err, "failed to listen for health checks on %s", hs.params.Address)
+	}
+	hs.httpServer = &http.Server{
+		Handler:           hs.handler(),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	go func() {
+		jww.INFO.Printf("Serving health checks on http://%s%s and %s.",
+			listener.Addr(), livenessPath, readinessPath)
+		err := hs.httpServer.Serve(listener)
+		if err != nil && err != http.ErrServerClosed {
+			jww.ERROR.Printf("Failed to serve health checks: %+v", err)
+		}
+	}()
+	return nil
+}
+
+// setChecks replaces the readiness checks.
+func (hs *Health) setChecks(checks []healthCheck) {
+	hs.mux.Lock()
+	defer hs.mux.Unlock()
+	hs.checks = checks
+}
+
+// handler returns the handler of the liveness and readiness endpoints. The
+// readiness endpoint lists the result of each current check, in the format
+// used by Kubernetes, and responds 503 if any fails.
+func (hs *Health) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc(livenessPath, func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		_, _ = fmt.Fprintln(w, "ok")
+	})
+	mux.HandleFunc(readinessPath, func(w http.ResponseWriter, _ *http.Request) {
+		hs.mux.Lock()
+		checks := hs.checks
+		hs.mux.Unlock()
+		errs := runHealthChecks(checks, hs.params.Timeout)
+
+		var b strings.Builder
+		ready := true
+		for i, c := range checks {
+			if errs[i] != nil {
+				ready = false
+				_, _ = fmt.Fprintf(&b, "[-]%s failed: %v\n", c.name, errs[i])
+			} else {
+				_, _ = fmt.Fprintf(&b, "[+]%s ok\n", c.name)
+			}
+		}
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		if ready {
+			b.WriteString("ready\n")
+		} else {
+			jww.WARN.Printf("Readiness check failed:\n%s", b.String())
+			w.WriteHeader(http.StatusServiceUnavailable)
+			b.WriteString("not ready\n")
+		}
+		_, _ = w.Write([]byte(b.String()))
+	})
+	return mux
+}
+
+// runHealthChecks runs the checks concurrently and returns the error of each.
+// Checks that do not finish before the timeout fail.
+func runHealthChecks(checks []healthCheck, timeout time.Duration) []error {
+	type result struct {
+		i   int
+		err error
+	}
+	results := make(chan result, len(checks))
+	for i, c := range checks {
+		go func(i int, check func() error) {
+			results <- result{i, check()}
+		}(i, c.check)
+	}
+
+	errs := make([]error, len(checks))
+	done := make([]bool, len(checks))
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	for range checks {
+		select {
+		case r := <-results:
+			errs[r.i], done[r.i] = r.err, true
+		case <-timer.C:
+			for i := range checks {
+				if !done[i] {
+					errs[i] = errors.Errorf("timed out after %s", timeout)
+				}
+			}
+			return errs
+		}
+	}
+	return errs
+}
+
+// readinessChecks returns the checks that the server is ready: its TLS
+// certificates are loaded, the credential store is open, the storage backend
+// is reachable, and, in a cluster, a leader is elected.
+func (s *Server) readinessChecks() []healthCheck {
+	checks := []healthCheck{
+		{"tls", s.checkTLS},
+		{"credentials", s.h.checkCredentials},
+		{"storage", s.h.checkStorage},
+	}
+	if s.cluster != nil {
+		checks = append(checks, healthCheck{"cluster", s.cluster.checkLeader})
+	}
+	return checks
+}
+
+// servingStatus returns the status reported by the gRPC health service:
+// SERVING while all readiness checks pass within the health timeout, and
+// NOT_SERVING otherwise.
+func (s *Server) servingStatus() healthpb.HealthCheckResponse_ServingStatus {
+	timeout := defaultHealthTimeout
+	if s.health != nil {
+		timeout = s.health.params.Timeout
+	}
+	checks := s.readinessChecks()
+	for i, err := range runHealthChecks(checks, timeout) {
+		if err != nil {
+			jww.DEBUG.Printf("gRPC health check %s failed: %+v",
+				checks[i].name, err)
+			return healthpb.HealthCheckResponse_NOT_SERVING
+		}
+	}
+	return healthpb.HealthCheckResponse_SERVING
+}
+
+// checkTLS returns an error if no certificate is loaded, such as before an
+// ACME certificate is obtained. It always passes in insecure HTTP mode.
+func (s *Server) checkTLS() error {
+	if s.insecureHTTP {
+		return nil
+	}
+	leaves := s.leaves()
+	if len(leaves) == 0 {
+		return errors.New("no certificate loaded")
+	}
+	for _, leaf := range leaves {
+		if leaf == nil {
+			return errors.New("no certificate loaded")
+		}
+	}
+	return nil
+}
+
+// checkCredentials returns an error if the registered users cannot be listed
+// from the credential store.
+func (h *handler) checkCredentials() error {
+	if _, err := h.users.List(); err != nil {
+		return errors.Wrap(err, "failed to list users")
+	}
+	return nil
+}
+
+// checkStorage returns an error if the storage backend cannot be reached. It
+// is checked through the storage of the first registered user, if the store
+// implements store.Pinger; it passes if there are no users, since stores are
+// only created for users, or if the store cannot be pinged.
+func (h *handler) checkStorage() error {
+	usernames, err := h.users.List()
+	if err != nil {
+		return errors.Wrap(err, "failed to list users")
+	} else if len(usernames) == 0 {
+		return nil
+	}
+
+	s, err := h.newStore(h.storageDir, usernames[0])
+	if err != nil {
+		return errors.Wrap(err, "failed to open storage")
+	}
+	if pinger, ok := s.(store.Pinger); ok {
+		return pinger.Ping()
+	}
+	return nil
+}
@@ -0,0 +1,176 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+
+	"gitlab.com/elixxir/remoteSyncServer/credentials"
+	"gitlab.com/elixxir/remoteSyncServer/store"
+)
+
+// Tests that NewHealth applies the default timeout if it is not set.
+func TestNewHealth(t *testing.T) {
+	hs, err := NewHealth(map[string]interface{}{"address": ":8081"})
+	if err != nil {
+		t.Fatalf("Failed to create Health: %+v", err)
+	}
+	expected := HealthParams{Address: ":8081", Timeout: defaultHealthTimeout}
+	if hs.params != expected {
+		t.Errorf("Unexpected parameters.\nexpected: %+v\nreceived: %+v",
+			expected, hs.params)
+	}
+
+	hs, err = NewHealth(
+		map[string]interface{}{"address": "127.0.0.1:8081", "timeout": "1s"})
+	if err != nil {
+		t.Fatalf("Failed to create Health: %+v", err)
+	}
+	expected = HealthParams{Address: "127.0.0.1:8081", Timeout: time.Second}
+	if hs.params != expected {
+		t.Errorf("Unexpected parameters.\nexpected: %+v\nreceived: %+v",
+			expected, hs.params)
+	}
+}
+
+// Error path: Tests that NewHealth returns an error for invalid parameters.
+func TestNewHealth_Error(t *testing.T) {
+	tests := map[string]map[string]interface{}{
+		"no address":      {},
+		"invalid address": {"address": "localhost"},
+		"zero timeout":    {"address": ":8081", "timeout": "0s"},
+		"unknown key":     {"address": ":8081", "path": "/healthz"},
+	}
+	for name, params := range tests {
+		if _, err := NewHealth(params); err == nil {
+			t.Errorf("Failed to get error for %s.", name)
+		}
+	}
+}
+
+// Tests that the liveness endpoint always responds OK and that the readiness
+// endpoint only responds OK if all checks pass, including those that time out.
+func TestHealth_handler(t *testing.T) {
+	hs := &Health{params: HealthParams{Timeout: 50 * time.Millisecond}}
+	block := make(chan struct{})
+	defer close(block)
+	tests := []struct {
+		checks   []healthCheck
+		expected int
+		body     string
+	}{
+		{nil, http.StatusOK, "ready"},
+		{[]healthCheck{{"tls", func() error { return nil }}},
+			http.StatusOK, "[+]tls ok"},
+		{[]healthCheck{
+			{"tls", func() error { return nil }},
+			{"storage", func() error { return errors.New("unreachable") }},
+		}, http.StatusServiceUnavailable, "[-]storage failed: unreachable"},
+		{[]healthCheck{{"credentials", func() error { <-block; return nil }}},
+			http.StatusServiceUnavailable, "[-]credentials failed: timed out"},
+	}
+
+	for i, tt := range tests {
+		hs.setChecks(tt.checks)
+		h := hs.handler()
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, livenessPath, nil))
+		if w.Code != http.StatusOK {
+			t.Errorf("Unexpected liveness status for checks %d."+
+				"\nexpected: %d\nreceived: %d", i, http.StatusOK, w.Code)
+		}
+
+		w = httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, readinessPath, nil))
+		if w.Code != tt.expected {
+			t.Errorf("Unexpected readiness status for checks %d."+
+				"\nexpected: %d\nreceived: %d", i, tt.expected, w.Code)
+		}
+		if !strings.Contains(w.Body.String(), tt.body) {
+			t.Errorf("Readiness response for checks %d does not contain %q: %s",
+				i, tt.body, w.Body.String())
+		}
+	}
+}
+
+// Tests that Server.checkTLS only passes if a certificate is loaded or TLS is
+// disabled.
+func TestServer_checkTLS(t *testing.T) {
+	s := &Server{}
+	if err := s.checkTLS(); err == nil {
+		t.Errorf("Failed to get error without a certificate.")
+	}
+
+	s.insecureHTTP = true
+	if err := s.checkTLS(); err != nil {
+		t.Errorf("Failed to pass in insecure HTTP mode: %+v", err)
+	}
+}
+
+// Tests that Server.servingStatus is SERVING only while all readiness checks
+// pass.
+func TestServer_servingStatus(t *testing.T) {
+	users := credentials.NewMemStore(map[string]string{"waldo": "hunter2"})
+	s := &Server{h: newHandler("", time.Hour, users, nil, store.NewMemStore)}
+	if status := s.servingStatus(); status !=
+		healthpb.HealthCheckResponse_NOT_SERVING {
+		t.Errorf("Unexpected status without a certificate: %s", status)
+	}
+
+	s.insecureHTTP = true
+	if status := s.servingStatus(); status !=
+		healthpb.HealthCheckResponse_SERVING {
+		t.Errorf("Unexpected status with passing checks: %s", status)
+	}
+}
+
+// Tests that handler.checkStorage passes without users and pings the storage
+// of the first user.
+func Test_handler_checkStorage(t *testing.T) {
+	storageDir := "tmpHealth"
+	defer func() {
+		if err := os.RemoveAll(storageDir); err != nil {
+			t.Errorf("Failed to remove %s: %+v", storageDir, err)
+		}
+	}()
+	users := credentials.NewMemStore(map[string]string{})
+	h := newHandler(storageDir, time.Hour, users, nil, store.NewFileStore)
+
+	if err := h.checkStorage(); err != nil {
+		t.Errorf("Failed to pass without users: %+v", err)
+	}
+	if err := h.checkCredentials(); err != nil {
+		t.Errorf("Failed to check credentials: %+v", err)
+	}
+
+	if err := users.Set("waldo", "hunter2"); err != nil {
+		t.Fatalf("Failed to add user: %+v", err)
+	}
+	if err := h.checkStorage(); err != nil {
+		t.Errorf("Failed to pass with accessible storage: %+v", err)
+	}
+
+	// Replace the storage directory with a file so that it is inaccessible
+	if err := os.RemoveAll(storageDir); err != nil {
+		t.Fatalf("Failed to remove %s: %+v", storageDir, err)
+	}
+	if err := os.WriteFile(storageDir, []byte("file"), 0600); err != nil {
+		t.Fatalf("Failed to write %s: %+v", storageDir, err)
+	}
+	if err := h.checkStorage(); err == nil {
+		t.Errorf("Failed to get error for inaccessible storage.")
+	}
+}
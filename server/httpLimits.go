@@ -0,0 +1,154 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	jww "github.com/spf13/jwalterweatherman"
+)
+
+// Default HTTP limits parameters.
+const (
+	defaultMaxHeaderBytes    = 64 << 10
+	defaultReadHeaderTimeout = 10 * time.Second
+	defaultHTTPIdleTimeout   = 2 * time.Minute
+)
+
+// HTTPLimitsParams are the limits of the HTTP servers that serve the
+// listeners. They are set in the "httpLimits" section of the config. A zero
+// timeout means no timeout.
+type HTTPLimitsParams struct {
+	// MaxHeaderBytes is the largest size of the request line and headers of a
+	// request, in bytes. Zero uses the net/http default of 1 MiB. Defaults to
+	// 64 KiB.
+	MaxHeaderBytes int `mapstructure:"maxHeaderBytes"`
+
+	// MaxBodyBytes is the largest body of a REST, WebDAV, download link, or
+	// gRPC-web request, in bytes. Larger requests are rejected with 413
+	// Request Entity Too Large. Native gRPC requests stream their messages,
+	// which are limited individually, so they are not limited. Defaults to no
+	// limit.
+	MaxBodyBytes int64 `mapstructure:"maxBodyBytes"`
+
+	// ReadHeaderTimeout is how long a client has to send the headers of a
+	// request, which stops clients from holding connections open by sending
+	// them slowly. Defaults to 10s.
+	ReadHeaderTimeout time.Duration `mapstructure:"readHeaderTimeout"`
+
+	// ReadTimeout is how long a client has to send a whole request, including
+	// its body. Defaults to no timeout.
+	ReadTimeout time.Duration `mapstructure:"readTimeout"`
+
+	// WriteTimeout is how long the server has to write a response once the
+	// headers of the request are read. It also ends streaming RPCs and large
+	// downloads, so it must be longer than any of them. Defaults to no
+	// timeout.
+	WriteTimeout time.Duration `mapstructure:"writeTimeout"`
+
+	// IdleTimeout is how long a connection is kept open between requests. It
+	// applies to HTTP/2 connections unless the gRPC idle timeout is set.
+	// Defaults to 2m.
+	IdleTimeout time.Duration `mapstructure:"idleTimeout"`
+}
+
+// HTTPLimits are the size limits and timeouts of the HTTP servers that serve
+// the listeners.
+type HTTPLimits struct {
+	params HTTPLimitsParams
+}
+
+// NewHTTPLimits creates new HTTPLimits from the parameters. Returns an error
+// for unknown parameters and negative values.
+func NewHTTPLimits(params map[string]interface{}) (*HTTPLimits, error) {
+	p := HTTPLimitsParams{
+		MaxHeaderBytes:    defaultMaxHeaderBytes,
+		ReadHeaderTimeout: defaultReadHeaderTimeout,
+		IdleTimeout:       defaultHTTPIdleTimeout,
+	}
+	if err := decodeParams(params, &p, "HTTP limits"); err != nil {
+		return nil, err
+	}
+
+	if p.MaxHeaderBytes < 0 || p.MaxBodyBytes < 0 {
+		return nil, errors.Errorf("maximum header size %d and body size %d "+
+			"cannot be negative", p.MaxHeaderBytes, p.MaxBodyBytes)
+	}
+	for name, timeout := range map[string]time.Duration{
+		"read header timeout": p.ReadHeaderTimeout,
+		"read timeout":        p.ReadTimeout,
+		"write timeout":       p.WriteTimeout,
+		"idle timeout":        p.IdleTimeout,
+	} {
+		if timeout < 0 {
+			return nil, errors.Errorf(
+				"%s %s cannot be negative", name, timeout)
+		}
+	}
+
+	return &HTTPLimits{params: p}, nil
+}
+
+// Params returns the parameters of the limits.
+func (hl *HTTPLimits) Params() HTTPLimitsParams {
+	return hl.params
+}
+
+// apply sets the header size limit and timeouts of the HTTP server. It does
+// nothing if the limits are nil.
+func (hl *HTTPLimits) apply(httpServer *http.Server) {
+	if hl == nil {
+		return
+	}
+	httpServer.MaxHeaderBytes = hl.params.MaxHeaderBytes
+	httpServer.ReadHeaderTimeout = hl.params.ReadHeaderTimeout
+	httpServer.ReadTimeout = hl.params.ReadTimeout
+	httpServer.WriteTimeout = hl.params.WriteTimeout
+	httpServer.IdleTimeout = hl.params.IdleTimeout
+}
+
+// handler returns a handler that limits the bodies of requests other than
+// native gRPC to the maximum body size before passing them to the next
+// handler. Requests whose declared length exceeds it are rejected, and the
+// bodies of others fail to read once they do. The next handler is returned
+// unchanged if the limits are nil or the body size is not limited.
+func (hl *HTTPLimits) handler(next http.Handler) http.Handler {
+	if hl == nil || hl.params.MaxBodyBytes == 0 {
+		return next
+	}
+	limit := hl.params.MaxBodyBytes
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if isNativeGRPC(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if r.ContentLength > limit {
+			jww.DEBUG.Printf("Rejected %s %s from %s with a %d byte body.",
+				r.Method, r.URL.Path, r.RemoteAddr, r.ContentLength)
+			http.Error(w, fmt.Sprintf("%v: body exceeds %d bytes",
+				RequestTooLargeErr, limit),
+				http.StatusRequestEntityTooLarge)
+			return
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, limit)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// isNativeGRPC returns true if the request is a native gRPC request rather
+// than gRPC-web, which shares its content type prefix.
+func isNativeGRPC(r *http.Request) bool {
+	contentType := r.Header.Get("Content-Type")
+	return r.ProtoMajor == 2 &&
+		strings.HasPrefix(contentType, grpcContentType) &&
+		!strings.HasPrefix(contentType, grpcContentType+"-web")
+}
@@ -0,0 +1,119 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package server
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Tests that NewHTTPLimits decodes the parameters and defaults the others, and
+// that HTTPLimits.apply sets them on the HTTP server.
+func TestNewHTTPLimits(t *testing.T) {
+	hl := newTestFromParams(NewHTTPLimits, map[string]interface{}{
+		"maxBodyBytes": "1024", "readTimeout": "5m", "idleTimeout": "0s"}, t)
+	expected := HTTPLimitsParams{
+		MaxHeaderBytes:    defaultMaxHeaderBytes,
+		MaxBodyBytes:      1024,
+		ReadHeaderTimeout: defaultReadHeaderTimeout,
+		ReadTimeout:       5 * time.Minute,
+	}
+	if hl.Params() != expected {
+		t.Errorf("Unexpected parameters.\nexpected: %+v\nreceived: %+v",
+			expected, hl.Params())
+	}
+
+	var httpServer http.Server
+	hl.apply(&httpServer)
+	if httpServer.MaxHeaderBytes != defaultMaxHeaderBytes ||
+		httpServer.ReadHeaderTimeout != defaultReadHeaderTimeout ||
+		httpServer.ReadTimeout != 5*time.Minute ||
+		httpServer.WriteTimeout != 0 || httpServer.IdleTimeout != 0 {
+		t.Errorf("Limits not applied to the HTTP server.")
+	}
+}
+
+// Tests that the handler of HTTPLimits rejects requests that declare a body
+// over the limit, fails to read bodies of unknown length once they exceed it,
+// and does not limit native gRPC requests.
+func TestHTTPLimits_handler(t *testing.T) {
+	hl := newTestFromParams(NewHTTPLimits,
+		map[string]interface{}{"maxBodyBytes": 8}, t)
+	var read int
+	var readErr error
+	h := hl.handler(http.HandlerFunc(func(w http.ResponseWriter,
+		r *http.Request) {
+		var body []byte
+		body, readErr = io.ReadAll(r.Body)
+		read = len(body)
+	}))
+
+	tests := []struct {
+		body, contentType string
+		length            int64
+		http2             bool
+		code, read        int
+		failed            bool
+	}{
+		{"12345678", restContentType, 8, false, http.StatusOK, 8, false},
+		{"123456789", restContentType, 9, false,
+			http.StatusRequestEntityTooLarge, 0, false},
+		{"123456789", restContentType, -1, false, http.StatusOK, 8, true},
+		{"123456789", grpcContentType + "-web+proto", 9, true,
+			http.StatusRequestEntityTooLarge, 0, false},
+		{"123456789", grpcContentType + "+proto", 9, true,
+			http.StatusOK, 9, false},
+	}
+	for i, tt := range tests {
+		read, readErr = 0, nil
+		r := httptest.NewRequest(
+			http.MethodPost, "/v1/write", strings.NewReader(tt.body))
+		r.ContentLength = tt.length
+		r.Header.Set("Content-Type", tt.contentType)
+		if tt.http2 {
+			r.ProtoMajor = 2
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if w.Code != tt.code {
+			t.Errorf("Unexpected status code (%d).\nexpected: %d\n"+
+				"received: %d", i, tt.code, w.Code)
+		}
+		if read != tt.read || (readErr != nil) != tt.failed {
+			t.Errorf("Unexpected read (%d): %d bytes, error %v",
+				i, read, readErr)
+		}
+	}
+}
+
+// Tests that nil HTTPLimits leave the HTTP server unchanged and that requests
+// are passed to the handler without a body size limit.
+func TestHTTPLimits_Nil(t *testing.T) {
+	next := http.NotFoundHandler()
+	var hl *HTTPLimits
+	if h := hl.handler(next); h == nil {
+		t.Errorf("No handler returned without limits.")
+	}
+	var httpServer http.Server
+	hl.apply(&httpServer)
+	if httpServer.ReadHeaderTimeout != 0 || httpServer.MaxHeaderBytes != 0 {
+		t.Errorf("HTTP server changed without limits.")
+	}
+
+	hl = newTestFromParams(NewHTTPLimits, map[string]interface{}{}, t)
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	w := httptest.NewRecorder()
+	hl.handler(next).ServeHTTP(w, r)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Request not passed to the handler: %d", w.Code)
+	}
+}
@@ -0,0 +1,107 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package server
+
+import (
+	"gitlab.com/elixxir/remoteSyncServer/rpc"
+)
+
+// Optional features reported to clients by the Info service.
+const (
+	// CapabilityAccountMigration is reported when users can import their
+	// accounts from other servers and export them with the Migration service.
+	CapabilityAccountMigration = "accountMigration"
+
+	// CapabilityAPIKeyLogin is reported when clients can log in with an API
+	// key.
+	CapabilityAPIKeyLogin = "apiKeyLogin"
+
+	// CapabilityChangeNotifications is reported when clients can watch the
+	// changes to their files with the Changes service.
+	CapabilityChangeNotifications = "changeNotifications"
+
+	// CapabilityClientCertificates is reported when clients must present a
+	// certificate in mTLS mode.
+	CapabilityClientCertificates = "clientCertificates"
+
+	// CapabilityDeltaSync is reported when clients can update files with
+	// deltas using the Delta service.
+	CapabilityDeltaSync = "deltaSync"
+
+	// CapabilityDownloadLinks is reported when clients can create download
+	// links to files with the Links service.
+	CapabilityDownloadLinks = "downloadLinks"
+
+	// CapabilityOIDCLogin is reported when clients can log in with an OIDC ID
+	// token.
+	CapabilityOIDCLogin = "oidcLogin"
+
+	// CapabilityResumableUploads is reported when clients can upload files in
+	// resumable chunks with the Upload service.
+	CapabilityResumableUploads = "resumableUploads"
+)
+
+// BuildInfo is the version and build metadata of the server binary. Fields
+// that are unknown are empty.
+type BuildInfo struct {
+	// Version is the semantic version of the server.
+	Version string
+
+	// GitCommit is the git commit the server was built from.
+	GitCommit string
+
+	// BuildDate is when the server was built, in RFC 3339 format.
+	BuildDate string
+
+	// GoVersion is the version of Go the server was built with.
+	GoVersion string
+}
+
+// versionResponse returns the response to GetVersion for the build info and
+// the enabled optional features.
+func versionResponse(info BuildInfo, registrar *Registrar,
+	oidcAuth *OIDCAuthenticator, apiKeys *APIKeys,
+	mtls *MTLSAuthenticator, uploads *Uploads, delta *Delta,
+	changes *ChangeFeed, migration *Migration,
+	links *Links) *rpc.RsGetVersionResponse {
+	// Sorted by name so that the response is stable
+	capabilities := make([]string, 0, 8)
+	if migration != nil {
+		capabilities = append(capabilities, CapabilityAccountMigration)
+	}
+	if apiKeys != nil {
+		capabilities = append(capabilities, CapabilityAPIKeyLogin)
+	}
+	if changes != nil {
+		capabilities = append(capabilities, CapabilityChangeNotifications)
+	}
+	if mtls != nil {
+		capabilities = append(capabilities, CapabilityClientCertificates)
+	}
+	if delta != nil {
+		capabilities = append(capabilities, CapabilityDeltaSync)
+	}
+	if links != nil {
+		capabilities = append(capabilities, CapabilityDownloadLinks)
+	}
+	if oidcAuth != nil {
+		capabilities = append(capabilities, CapabilityOIDCLogin)
+	}
+	if uploads != nil {
+		capabilities = append(capabilities, CapabilityResumableUploads)
+	}
+
+	return &rpc.RsGetVersionResponse{
+		Version:          info.Version,
+		GitCommit:        info.GitCommit,
+		BuildDate:        info.BuildDate,
+		GoVersion:        info.GoVersion,
+		Capabilities:     capabilities,
+		RegistrationMode: string(registrar.Mode()),
+	}
+}
@@ -0,0 +1,59 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package server
+
+import (
+	"reflect"
+	"testing"
+
+	"gitlab.com/elixxir/remoteSyncServer/credentials"
+)
+
+// Tests that versionResponse contains the build info, the registration mode,
+// and only the capabilities of the enabled features in sorted order.
+func Test_versionResponse(t *testing.T) {
+	users := credentials.NewMemStore(nil)
+	r, err := NewRegistrar(RegistrationOpen, users, nil, nil, nil)
+	if err != nil {
+		t.Fatalf("Failed to create Registrar: %+v", err)
+	}
+	info := BuildInfo{
+		Version:   "1.2.3",
+		GitCommit: "e02ec3b",
+		BuildDate: "2023-07-13T18:34:02Z",
+		GoVersion: "go1.19",
+	}
+
+	resp := versionResponse(info, r, nil, nil, nil, nil, nil, nil, nil, nil)
+	if resp.GetVersion() != info.Version ||
+		resp.GetGitCommit() != info.GitCommit ||
+		resp.GetBuildDate() != info.BuildDate ||
+		resp.GetGoVersion() != info.GoVersion {
+		t.Errorf("Unexpected build info.\nexpected: %+v\nreceived: %v",
+			info, resp)
+	}
+	if resp.GetRegistrationMode() != string(RegistrationOpen) {
+		t.Errorf("Unexpected registration mode.\nexpected: %s\nreceived: %s",
+			RegistrationOpen, resp.GetRegistrationMode())
+	}
+	if len(resp.GetCapabilities()) != 0 {
+		t.Errorf("Unexpected capabilities: %v", resp.GetCapabilities())
+	}
+
+	resp = versionResponse(info, r, &OIDCAuthenticator{},
+		NewAPIKeys(credentials.NewMemStore(nil)), &MTLSAuthenticator{},
+		&Uploads{}, &Delta{}, &ChangeFeed{}, &Migration{}, &Links{})
+	expected := []string{CapabilityAccountMigration, CapabilityAPIKeyLogin,
+		CapabilityChangeNotifications, CapabilityClientCertificates,
+		CapabilityDeltaSync, CapabilityDownloadLinks, CapabilityOIDCLogin,
+		CapabilityResumableUploads}
+	if !reflect.DeepEqual(expected, resp.GetCapabilities()) {
+		t.Errorf("Unexpected capabilities.\nexpected: %v\nreceived: %v",
+			expected, resp.GetCapabilities())
+	}
+}
@@ -0,0 +1,252 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package server
+
+import (
+	"context"
+	"reflect"
+
+	"github.com/pkg/errors"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+
+	"gitlab.com/elixxir/remoteSyncServer/store"
+)
+
+// intercept returns a copy of the service description whose unary methods and
+// streams call the interceptors, in order, before the handler. The comms server
+// does not accept gRPC server options, so interceptors are added to each
+// service instead. Interceptors configured on the gRPC server are called after
+// them for unary methods and before them for streams.
+func intercept(desc *grpc.ServiceDesc,
+	interceptors []grpc.UnaryServerInterceptor) *grpc.ServiceDesc {
+	if len(interceptors) == 0 {
+		return desc
+	}
+
+	chain := chainInterceptors(interceptors)
+	intercepted := *desc
+	intercepted.Methods = make([]grpc.MethodDesc, len(desc.Methods))
+	for i, method := range desc.Methods {
+		handler := method.Handler
+		intercepted.Methods[i] = grpc.MethodDesc{
+			MethodName: method.MethodName,
+			Handler: func(srv interface{}, ctx context.Context,
+				dec func(interface{}) error,
+				serverInterceptor grpc.UnaryServerInterceptor) (
+				interface{}, error) {
+				return handler(srv, ctx, dec, func(ctx context.Context,
+					req interface{}, info *grpc.UnaryServerInfo,
+					next grpc.UnaryHandler) (interface{}, error) {
+					if serverInterceptor != nil {
+						inner := next
+						next = func(ctx context.Context,
+							req interface{}) (interface{}, error) {
+							return serverInterceptor(ctx, req, info, inner)
+						}
+					}
+					return chain(ctx, req, info, next)
+				})
+			},
+		}
+	}
+	intercepted.Streams = make([]grpc.StreamDesc, len(desc.Streams))
+	for i, stream := range desc.Streams {
+		intercepted.Streams[i] = stream
+		intercepted.Streams[i].Handler = interceptStream(desc, stream, chain)
+	}
+
+	return &intercepted
+}
+
+// interceptStream returns a handler of the stream that calls the chain of
+// interceptors before the stream's handler. The request of a server streaming
+// RPC is received first, so that the interceptors see it, and then passed to
+// the handler. The interceptors see no request for client streaming RPCs. The
+// handler's error is returned to the interceptors without a response.
+func interceptStream(desc *grpc.ServiceDesc, stream grpc.StreamDesc,
+	chain grpc.UnaryServerInterceptor) grpc.StreamHandler {
+	fullMethod := "/" + desc.ServiceName + "/" + stream.StreamName
+	var reqType reflect.Type
+	if stream.ServerStreams && !stream.ClientStreams {
+		method, ok := reflect.TypeOf(desc.HandlerType).Elem().MethodByName(
+			stream.StreamName)
+		if ok && method.Type.NumIn() > 0 {
+			reqType = method.Type.In(0).Elem()
+		}
+	}
+
+	return func(srv interface{}, ss grpc.ServerStream) error {
+		var req interface{}
+		if reqType != nil {
+			req = reflect.New(reqType).Interface()
+			if err := ss.RecvMsg(req); err != nil {
+				return err
+			}
+		}
+		info := &grpc.UnaryServerInfo{Server: srv, FullMethod: fullMethod}
+		_, err := chain(ss.Context(), req, info,
+			func(ctx context.Context, req interface{}) (interface{}, error) {
+				return nil, stream.Handler(srv,
+					&interceptedStream{ServerStream: ss, ctx: ctx, req: req})
+			})
+		return err
+	}
+}
+
+// interceptedStream is a server stream whose context is that passed down by
+// the interceptors and whose first message is the request they received, if
+// any.
+type interceptedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+	req interface{}
+}
+
+// Context returns the context passed down by the interceptors.
+func (s *interceptedStream) Context() context.Context {
+	return s.ctx
+}
+
+// RecvMsg receives the request seen by the interceptors into m the first time
+// it is called, and the next message of the stream after that.
+func (s *interceptedStream) RecvMsg(m interface{}) error {
+	if s.req == nil {
+		return s.ServerStream.RecvMsg(m)
+	}
+	dst, ok := m.(proto.Message)
+	if !ok {
+		return errors.Errorf("cannot receive request into %T", m)
+	}
+	proto.Merge(dst, s.req.(proto.Message))
+	s.req = nil
+	return nil
+}
+
+// chainInterceptors combines the interceptors into one interceptor that calls
+// them in order.
+func chainInterceptors(
+	interceptors []grpc.UnaryServerInterceptor) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{},
+		info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		next := handler
+		for i := len(interceptors) - 1; i >= 0; i-- {
+			interceptor, inner := interceptors[i], next
+			next = func(ctx context.Context, req interface{}) (interface{}, error) {
+				return interceptor(ctx, req, info, inner)
+			}
+		}
+		return next(ctx, req)
+	}
+}
+
+// storageStatusInterceptor returns a gRPC interceptor that converts the errors
+// of storage operations rejected by the storage worker pool into status
+// errors, so that clients back off and retry them.
+func storageStatusInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{},
+		_ *grpc.UnaryServerInfo, next grpc.UnaryHandler) (interface{}, error) {
+		resp, err := next(ctx, req)
+		return resp, storageStatus(err)
+	}
+}
+
+// storageStatus returns [store.PoolFullErr] with the RESOURCE_EXHAUSTED code
+// and [store.OperationTimeoutErr] with the UNAVAILABLE code. Other errors are
+// returned unchanged.
+func storageStatus(err error) error {
+	switch {
+	case errors.Is(err, store.PoolFullErr):
+		return status.Error(codes.ResourceExhausted, err.Error())
+	case errors.Is(err, store.OperationTimeoutErr):
+		return status.Error(codes.Unavailable, err.Error())
+	default:
+		return err
+	}
+}
+
+// pathFields are the names of the string fields of requests, and of the
+// messages nested in them, that hold paths given by the client.
+var pathFields = map[protoreflect.Name]bool{"Path": true, "Paths": true}
+
+// pathInterceptor returns a gRPC interceptor that sanitizes the paths in each
+// request with [store.SanitizePath] before it is handled, so that no backend
+// receives a path that could escape the user's storage.
+func pathInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{},
+		_ *grpc.UnaryServerInfo, next grpc.UnaryHandler) (interface{}, error) {
+		if err := sanitizeRequest(req); err != nil {
+			return nil, err
+		}
+		return next(ctx, req)
+	}
+}
+
+// sanitizeRequest replaces the paths in the request with their sanitized
+// forms. Returns [store.InvalidPathErr] with the INVALID_ARGUMENT code if any
+// path is invalid. Requests that are not protobuf messages are unchanged.
+func sanitizeRequest(req interface{}) error {
+	msg, ok := req.(proto.Message)
+	if !ok {
+		return nil
+	}
+	if err := sanitizePaths(msg.ProtoReflect()); err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	return nil
+}
+
+// sanitizePaths replaces the values of the path fields of the message and of
+// the messages nested in it with their sanitized forms. Returns the error of
+// the first path that is invalid.
+func sanitizePaths(m protoreflect.Message) error {
+	var err error
+	m.Range(func(fd protoreflect.FieldDescriptor, v protoreflect.Value) bool {
+		switch {
+		case fd.IsMap():
+		case fd.Kind() == protoreflect.StringKind && pathFields[fd.Name()]:
+			if !fd.IsList() {
+				if v, err = sanitizePathValue(v); err == nil {
+					m.Set(fd, v)
+				}
+				break
+			}
+			list := v.List()
+			for i := 0; i < list.Len() && err == nil; i++ {
+				var p protoreflect.Value
+				if p, err = sanitizePathValue(list.Get(i)); err == nil {
+					list.Set(i, p)
+				}
+			}
+		case fd.Message() != nil:
+			if !fd.IsList() {
+				err = sanitizePaths(v.Message())
+				break
+			}
+			list := v.List()
+			for i := 0; i < list.Len() && err == nil; i++ {
+				err = sanitizePaths(list.Get(i).Message())
+			}
+		}
+		if err != nil {
+			err = errors.WithMessagef(err, "invalid %s", fd.Name())
+		}
+		return err == nil
+	})
+	return err
+}
+
+// sanitizePathValue returns the path value sanitized with
+// [store.SanitizePath].
+func sanitizePathValue(v protoreflect.Value) (protoreflect.Value, error) {
+	p, err := store.SanitizePath(v.String())
+	return protoreflect.ValueOfString(p), err
+}
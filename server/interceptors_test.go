@@ -0,0 +1,295 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package server
+
+import (
+	"context"
+	"io"
+	"reflect"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+
+	pb "gitlab.com/elixxir/comms/mixmessages"
+	"gitlab.com/elixxir/remoteSyncServer/rpc"
+)
+
+// Tests that the methods of a service description returned by intercept call
+// the interceptors in order, then the server interceptor, then the handler.
+func Test_intercept(t *testing.T) {
+	var calls []string
+	newInterceptor := func(name string) grpc.UnaryServerInterceptor {
+		return func(ctx context.Context, req interface{},
+			info *grpc.UnaryServerInfo, next grpc.UnaryHandler) (
+			interface{}, error) {
+			calls = append(calls, name)
+			return next(ctx, req)
+		}
+	}
+
+	// Mimics a generated method handler
+	desc := &grpc.ServiceDesc{
+		ServiceName: "test.Service",
+		Methods: []grpc.MethodDesc{{
+			MethodName: "Method",
+			Handler: func(_ interface{}, ctx context.Context,
+				_ func(interface{}) error,
+				interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+				handler := func(context.Context, interface{}) (interface{}, error) {
+					calls = append(calls, "handler")
+					return "response", nil
+				}
+				if interceptor == nil {
+					return handler(ctx, "request")
+				}
+				return interceptor(ctx, "request", &grpc.UnaryServerInfo{
+					FullMethod: "/test.Service/Method"}, handler)
+			},
+		}},
+	}
+
+	intercepted := intercept(desc, []grpc.UnaryServerInterceptor{
+		newInterceptor("first"), newInterceptor("second")})
+	resp, err := intercepted.Methods[0].Handler(nil, context.Background(),
+		nil, newInterceptor("server"))
+	if err != nil || resp != "response" {
+		t.Fatalf("Unexpected response %v: %+v", resp, err)
+	}
+	expected := []string{"first", "second", "server", "handler"}
+	if !reflect.DeepEqual(expected, calls) {
+		t.Errorf("Unexpected call order.\nexpected: %s\nreceived: %s",
+			expected, calls)
+	}
+
+	calls = nil
+	if _, err = intercepted.Methods[0].Handler(
+		nil, context.Background(), nil, nil); err != nil {
+		t.Fatalf("Failed to call handler: %+v", err)
+	}
+	expected = []string{"first", "second", "handler"}
+	if !reflect.DeepEqual(expected, calls) {
+		t.Errorf("Unexpected call order without server interceptor."+
+			"\nexpected: %s\nreceived: %s", expected, calls)
+	}
+}
+
+// testServerStream is a grpc.ServerStream that receives the messages in recv
+// and records the messages sent.
+type testServerStream struct {
+	grpc.ServerStream
+	ctx  context.Context
+	recv []proto.Message
+	sent []interface{}
+}
+
+func (tss *testServerStream) Context() context.Context { return tss.ctx }
+
+func (tss *testServerStream) RecvMsg(m interface{}) error {
+	if len(tss.recv) == 0 {
+		return io.EOF
+	}
+	proto.Merge(m.(proto.Message), tss.recv[0])
+	tss.recv = tss.recv[1:]
+	return nil
+}
+
+func (tss *testServerStream) SendMsg(m interface{}) error {
+	tss.sent = append(tss.sent, m)
+	return nil
+}
+
+// testDownloadServer is a rpc.DownloadServer that records its request and the
+// value of testContextKey in its context.
+type testDownloadServer struct {
+	rpc.UnimplementedDownloadServer
+	msg   *rpc.RsDownloadRequest
+	value interface{}
+}
+
+type testContextKey struct{}
+
+func (tds *testDownloadServer) Download(
+	msg *rpc.RsDownloadRequest, stream rpc.Download_DownloadServer) error {
+	tds.msg, tds.value = msg, stream.Context().Value(testContextKey{})
+	return stream.Send(&rpc.RsDownloadChunk{Data: []byte("data")})
+}
+
+// Tests that the streams of a service description returned by intercept call
+// the interceptors with the request of a server streaming RPC, and that the
+// handler receives the request and context passed down by the interceptors.
+func Test_intercept_Stream(t *testing.T) {
+	var info *grpc.UnaryServerInfo
+	var received interface{}
+	interceptors := []grpc.UnaryServerInterceptor{
+		func(ctx context.Context, req interface{},
+			i *grpc.UnaryServerInfo, next grpc.UnaryHandler) (
+			interface{}, error) {
+			info, received = i, req
+			return next(context.WithValue(ctx, testContextKey{}, "value"), req)
+		},
+		pathInterceptor(),
+	}
+
+	srv := &testDownloadServer{}
+	stream := &testServerStream{ctx: context.Background(),
+		recv: []proto.Message{&rpc.RsDownloadRequest{Path: "dir//file"}}}
+	intercepted := intercept(&rpc.Download_ServiceDesc, interceptors)
+	if err := intercepted.Streams[0].Handler(srv, stream); err != nil {
+		t.Fatalf("Failed to call handler: %+v", err)
+	}
+
+	if info.FullMethod != rpc.Download_Download_FullMethodName ||
+		info.Server != srv {
+		t.Errorf("Unexpected server info: %+v", info)
+	}
+	expected := &rpc.RsDownloadRequest{Path: "dir/file"}
+	if msg, ok := received.(*rpc.RsDownloadRequest); !ok ||
+		!proto.Equal(expected, msg) {
+		t.Errorf("Unexpected request seen by the interceptors."+
+			"\nexpected: %v\nreceived: %v", expected, received)
+	}
+	if !proto.Equal(expected, srv.msg) {
+		t.Errorf("Unexpected request received by the handler."+
+			"\nexpected: %v\nreceived: %v", expected, srv.msg)
+	}
+	if srv.value != "value" {
+		t.Errorf("Handler did not receive the context of the interceptors: "+
+			"%v", srv.value)
+	}
+	if len(stream.sent) != 1 {
+		t.Errorf("Unexpected messages sent: %v", stream.sent)
+	}
+}
+
+// testAdminServer is a rpc.AdminServer whose Restore receives the first
+// message of the stream.
+type testAdminServer struct {
+	rpc.UnimplementedAdminServer
+	msg *rpc.RsRestoreRequest
+}
+
+func (tas *testAdminServer) Restore(stream rpc.Admin_RestoreServer) error {
+	var err error
+	tas.msg, err = stream.Recv()
+	return err
+}
+
+// Tests that the interceptors of a client streaming RPC see no request, and
+// that its handler receives the messages of the stream itself.
+func Test_intercept_ClientStream(t *testing.T) {
+	received := interface{}("unset")
+	interceptors := []grpc.UnaryServerInterceptor{
+		func(ctx context.Context, req interface{},
+			_ *grpc.UnaryServerInfo, next grpc.UnaryHandler) (
+			interface{}, error) {
+			received = req
+			return next(ctx, req)
+		},
+	}
+
+	srv := &testAdminServer{}
+	expected := &rpc.RsRestoreRequest{Users: []string{"user"}}
+	stream := &testServerStream{
+		ctx: context.Background(), recv: []proto.Message{expected}}
+	intercepted := intercept(&rpc.Admin_ServiceDesc, interceptors)
+	for _, sd := range intercepted.Streams {
+		if sd.StreamName != "Restore" {
+			continue
+		}
+		if err := sd.Handler(srv, stream); err != nil {
+			t.Fatalf("Failed to call handler: %+v", err)
+		}
+	}
+
+	if received != nil {
+		t.Errorf("Interceptors received a request: %v", received)
+	}
+	if !proto.Equal(expected, srv.msg) {
+		t.Errorf("Unexpected message received by the handler."+
+			"\nexpected: %v\nreceived: %v", expected, srv.msg)
+	}
+}
+
+// Error path: Tests that a stream rejected by an interceptor returns its error
+// without calling the handler.
+func Test_intercept_StreamError(t *testing.T) {
+	interceptors := []grpc.UnaryServerInterceptor{pathInterceptor()}
+
+	srv := &testDownloadServer{}
+	stream := &testServerStream{ctx: context.Background(),
+		recv: []proto.Message{&rpc.RsDownloadRequest{Path: "../file"}}}
+	intercepted := intercept(&rpc.Download_ServiceDesc, interceptors)
+	err := intercepted.Streams[0].Handler(srv, stream)
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("Unexpected error.\nexpected: %s\nreceived: %+v",
+			codes.InvalidArgument, err)
+	}
+	if srv.msg != nil || len(stream.sent) != 0 {
+		t.Errorf("Handler called for rejected request %v.", srv.msg)
+	}
+}
+
+// Tests that pathInterceptor sanitizes the paths of requests, including those
+// in lists and nested messages, before calling the handler.
+func Test_pathInterceptor(t *testing.T) {
+	interceptor := pathInterceptor()
+	tests := []struct {
+		req, expected proto.Message
+	}{
+		{&pb.RsReadRequest{Path: `dir\sub//file`},
+			&pb.RsReadRequest{Path: "dir/sub/file"}},
+		{&pb.RsReadRequest{Path: "./"}, &pb.RsReadRequest{}},
+		{&rpc.RsBatchReadRequest{Paths: []string{"a/./b", "c/"}},
+			&rpc.RsBatchReadRequest{Paths: []string{"a/b", "c"}}},
+		{&rpc.RsCommitRequest{Ops: []*rpc.RsTransactionOp{
+			{Path: "dir//a", Data: []byte("data")}, {Path: "b/"}}},
+			&rpc.RsCommitRequest{Ops: []*rpc.RsTransactionOp{
+				{Path: "dir/a", Data: []byte("data")}, {Path: "b"}}}},
+	}
+	for i, tt := range tests {
+		var handled interface{}
+		_, err := interceptor(context.Background(), tt.req, nil,
+			func(_ context.Context, req interface{}) (interface{}, error) {
+				handled = req
+				return nil, nil
+			})
+		if err != nil {
+			t.Errorf("Failed to intercept request %d: %+v", i, err)
+		} else if !proto.Equal(tt.expected, handled.(proto.Message)) {
+			t.Errorf("Unexpected request %d.\nexpected: %v\nreceived: %v",
+				i, tt.expected, handled)
+		}
+	}
+}
+
+// Error path: Tests that pathInterceptor rejects requests with invalid paths
+// with the INVALID_ARGUMENT code without calling the handler.
+func Test_pathInterceptor_Error(t *testing.T) {
+	interceptor := pathInterceptor()
+	tests := []proto.Message{
+		&pb.RsReadRequest{Path: "../file"},
+		&pb.RsWriteRequest{Path: "/etc/passwd"},
+		&rpc.RsBatchReadRequest{Paths: []string{"file", "a\x00b"}},
+		&rpc.RsCommitRequest{Ops: []*rpc.RsTransactionOp{
+			{Path: "file"}, {Path: "dir/../../file"}}},
+	}
+	for i, req := range tests {
+		_, err := interceptor(context.Background(), req, nil,
+			func(context.Context, interface{}) (interface{}, error) {
+				t.Errorf("Handler called for request %d.", i)
+				return nil, nil
+			})
+		if status.Code(err) != codes.InvalidArgument {
+			t.Errorf("Unexpected error for request %d.\nexpected: %s"+
+				"\nreceived: %+v", i, codes.InvalidArgument, err)
+		}
+	}
+}
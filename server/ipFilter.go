@@ -0,0 +1,212 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package server
+
+import (
+	"net"
+	"sync"
+
+	"github.com/pkg/errors"
+	jww "github.com/spf13/jwalterweatherman"
+)
+
+// IPFilterParams are the parameters of the IP filter. They are set in the
+// "ipFilter" section of the config.
+type IPFilterParams struct {
+	// Allow is the list of IP addresses and CIDR networks that connections are
+	// accepted from. If it is empty, connections are accepted from any address
+	// that is not denied.
+	Allow []string `mapstructure:"allow"`
+
+	// Deny is the list of IP addresses and CIDR networks that connections are
+	// never accepted from, even if they are allowed.
+	Deny []string `mapstructure:"deny"`
+}
+
+// IPFilter closes the connections accepted from IP addresses that are denied
+// or, if any networks are allowed, not allowed. The lists can be changed while
+// the server is running.
+type IPFilter struct {
+	allow, deny []*net.IPNet
+	mux         sync.RWMutex
+}
+
+// NewIPFilter creates a new IPFilter from the parameters. Returns an error for
+// unknown parameters and invalid addresses or networks.
+func NewIPFilter(params map[string]interface{}) (*IPFilter, error) {
+	var p IPFilterParams
+	err := decodeParams(params, &p, "IP filter")
+	if err != nil {
+		return nil, err
+	}
+
+	f := &IPFilter{}
+	for _, network := range p.Allow {
+		if _, err = f.Add(network, false); err != nil {
+			return nil, errors.WithMessage(err, "invalid allowed network")
+		}
+	}
+	for _, network := range p.Deny {
+		if _, err = f.Add(network, true); err != nil {
+			return nil, errors.WithMessage(err, "invalid denied network")
+		}
+	}
+
+	return f, nil
+}
+
+// Add adds the IP address or CIDR network to the deny list if deny is true or
+// to the allow list otherwise. Returns false if it already is in the list.
+func (f *IPFilter) Add(network string, deny bool) (bool, error) {
+	ipNet, err := parseNetwork(network)
+	if err != nil {
+		return false, err
+	}
+
+	f.mux.Lock()
+	defer f.mux.Unlock()
+	list := f.list(deny)
+	if indexNetwork(*list, ipNet) != -1 {
+		return false, nil
+	}
+	*list = append(*list, ipNet)
+	return true, nil
+}
+
+// Remove removes the IP address or CIDR network from the deny list if deny is
+// true or from the allow list otherwise. Returns false if it is not in the
+// list.
+func (f *IPFilter) Remove(network string, deny bool) (bool, error) {
+	ipNet, err := parseNetwork(network)
+	if err != nil {
+		return false, err
+	}
+
+	f.mux.Lock()
+	defer f.mux.Unlock()
+	list := f.list(deny)
+	i := indexNetwork(*list, ipNet)
+	if i == -1 {
+		return false, nil
+	}
+	*list = append((*list)[:i:i], (*list)[i+1:]...)
+	return true, nil
+}
+
+// Update replaces the allow and deny lists with those in the parameters,
+// discarding the changes made while the server is running. If the parameters
+// are invalid, the lists are not changed.
+func (f *IPFilter) Update(params map[string]interface{}) error {
+	updated, err := NewIPFilter(params)
+	if err != nil {
+		return err
+	}
+
+	f.mux.Lock()
+	defer f.mux.Unlock()
+	f.allow, f.deny = updated.allow, updated.deny
+	return nil
+}
+
+// Lists returns the networks of the allow and deny lists in CIDR notation, in
+// the order they were added.
+func (f *IPFilter) Lists() (allow, deny []string) {
+	f.mux.RLock()
+	defer f.mux.RUnlock()
+	return networkStrings(f.allow), networkStrings(f.deny)
+}
+
+// Allowed returns true if connections are accepted from the IP address.
+func (f *IPFilter) Allowed(ip net.IP) bool {
+	f.mux.RLock()
+	defer f.mux.RUnlock()
+	if containsIP(f.deny, ip) {
+		return false
+	}
+	return len(f.allow) == 0 || containsIP(f.allow, ip)
+}
+
+// list returns the deny list if deny is true or the allow list otherwise. Must
+// be called while the lock is held.
+func (f *IPFilter) list(deny bool) *[]*net.IPNet {
+	if deny {
+		return &f.deny
+	}
+	return &f.allow
+}
+
+// listener returns the listener with the connections from addresses that are
+// not allowed closed, or the listener unchanged if the filter is nil.
+func (f *IPFilter) listener(l net.Listener) net.Listener {
+	if f == nil {
+		return l
+	}
+	return &filteredListener{
+		Listener: l, allowed: f.Allowed, reason: "not allowed by the IP filter"}
+}
+
+// filteredListener closes the connections it accepts from addresses that are
+// not allowed.
+type filteredListener struct {
+	net.Listener
+
+	// allowed returns true if connections are accepted from the address, and
+	// reason describes the addresses that are not, for the log.
+	allowed func(ip net.IP) bool
+	reason  string
+}
+
+// Accept waits for and returns the next connection from an allowed address.
+// Connections without an IP address, such as over Unix sockets, are always
+// accepted.
+func (fl *filteredListener) Accept() (net.Conn, error) {
+	for {
+		conn, err := fl.Listener.Accept()
+		if err != nil {
+			return nil, err
+		}
+
+		addr, ok := conn.RemoteAddr().(*net.TCPAddr)
+		if !ok || fl.allowed(addr.IP) {
+			return conn, nil
+		}
+		jww.DEBUG.Printf("Closed connection from %s, which is %s.",
+			addr, fl.reason)
+		_ = conn.Close()
+	}
+}
+
+// indexNetwork returns the index of the network in the list or -1 if it is not
+// in it.
+func indexNetwork(list []*net.IPNet, ipNet *net.IPNet) int {
+	for i, n := range list {
+		if n.String() == ipNet.String() {
+			return i
+		}
+	}
+	return -1
+}
+
+// containsIP returns true if any network of the list contains the IP address.
+func containsIP(list []*net.IPNet, ip net.IP) bool {
+	for _, ipNet := range list {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// networkStrings returns the networks in CIDR notation.
+func networkStrings(list []*net.IPNet) []string {
+	networks := make([]string, len(list))
+	for i, ipNet := range list {
+		networks[i] = ipNet.String()
+	}
+	return networks
+}
@@ -0,0 +1,209 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package server
+
+import (
+	"io"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// Tests that NewIPFilter parses the addresses and networks of both lists into
+// canonical CIDR notation and skips duplicates.
+func TestNewIPFilter(t *testing.T) {
+	f := newTestFromParams(NewIPFilter, map[string]interface{}{
+		"allow": []string{"10.0.0.0/8", "192.168.1.7", "10.1.2.3/8"},
+		"deny":  []interface{}{"10.0.5.0/24", "2001:db8::1"},
+	}, t)
+	allow, deny := f.Lists()
+	expectedAllow := []string{"10.0.0.0/8", "192.168.1.7/32"}
+	expectedDeny := []string{"10.0.5.0/24", "2001:db8::1/128"}
+	if !reflect.DeepEqual(allow, expectedAllow) {
+		t.Errorf("Unexpected allow list.\nexpected: %q\nreceived: %q",
+			expectedAllow, allow)
+	}
+	if !reflect.DeepEqual(deny, expectedDeny) {
+		t.Errorf("Unexpected deny list.\nexpected: %q\nreceived: %q",
+			expectedDeny, deny)
+	}
+}
+
+// Tests that IPFilter.Allowed denies addresses in the deny list even if they
+// are allowed, and only allows addresses in the allow list when it is not
+// empty.
+func TestIPFilter_Allowed(t *testing.T) {
+	f := newTestFromParams(NewIPFilter, map[string]interface{}{
+		"deny": []string{"203.0.113.0/24"}}, t)
+	tests := []struct {
+		ip      string
+		allowed bool
+	}{
+		{"198.51.100.1", true},
+		{"203.0.113.9", false},
+		{"::1", true},
+	}
+	check := func() {
+		for _, tt := range tests {
+			if f.Allowed(net.ParseIP(tt.ip)) != tt.allowed {
+				t.Errorf("Unexpected result for %s.\nexpected: %t",
+					tt.ip, tt.allowed)
+			}
+		}
+	}
+	check()
+
+	if _, err := f.Add("203.0.0.0/16", false); err != nil {
+		t.Fatalf("Failed to allow network: %+v", err)
+	}
+	tests = []struct {
+		ip      string
+		allowed bool
+	}{
+		{"198.51.100.1", false},
+		{"203.0.1.1", true},
+		{"203.0.113.9", false},
+		{"::ffff:203.0.1.1", true},
+		{"::1", false},
+	}
+	check()
+}
+
+// Tests that IPFilter.Add and IPFilter.Remove report whether the list changed
+// and match networks regardless of how they are written.
+func TestIPFilter_Add_Remove(t *testing.T) {
+	f := newTestFromParams(NewIPFilter, map[string]interface{}{}, t)
+	steps := []struct {
+		remove, deny bool
+		network      string
+		changed      bool
+	}{
+		{false, true, "192.0.2.1", true},
+		{false, true, "192.0.2.1/32", false},
+		{false, false, "192.0.2.1", true},
+		{true, true, "192.0.2.0/24", false},
+		{true, true, "192.0.2.1/32", true},
+		{true, true, "192.0.2.1", false},
+	}
+	for i, s := range steps {
+		op := f.Add
+		if s.remove {
+			op = f.Remove
+		}
+		changed, err := op(s.network, s.deny)
+		if err != nil {
+			t.Errorf("Step %d failed: %+v", i, err)
+		} else if changed != s.changed {
+			t.Errorf("Unexpected change in step %d.\nexpected: %t\n"+
+				"received: %t", i, s.changed, changed)
+		}
+	}
+
+	allow, deny := f.Lists()
+	if !reflect.DeepEqual(allow, []string{"192.0.2.1/32"}) || len(deny) != 0 {
+		t.Errorf("Unexpected lists.\nallow: %q\ndeny:  %q", allow, deny)
+	}
+
+	if _, err := f.Remove("192.0.2.256", false); err == nil {
+		t.Errorf("No error for removing an invalid address.")
+	}
+}
+
+// Tests that IPFilter.Update replaces both lists, including networks added at
+// runtime, and leaves them unchanged for invalid parameters.
+func TestIPFilter_Update(t *testing.T) {
+	f := newTestFromParams(NewIPFilter, map[string]interface{}{
+		"allow": []string{"10.0.0.0/8"}}, t)
+	if _, err := f.Add("203.0.113.0/24", true); err != nil {
+		t.Fatalf("Failed to add denied network: %+v", err)
+	}
+
+	err := f.Update(map[string]interface{}{"deny": []string{"192.0.2.7"}})
+	if err != nil {
+		t.Fatalf("Failed to update lists: %+v", err)
+	}
+	allow, deny := f.Lists()
+	if len(allow) != 0 || !reflect.DeepEqual(deny, []string{"192.0.2.7/32"}) {
+		t.Errorf("Unexpected lists.\nallow: %q\ndeny:  %q", allow, deny)
+	}
+
+	err = f.Update(map[string]interface{}{"allow": []string{"10.0.0.0/33"}})
+	if err == nil {
+		t.Errorf("No error for an invalid network.")
+	}
+	if allow, deny = f.Lists(); len(allow) != 0 || len(deny) != 1 {
+		t.Errorf("Lists changed by invalid parameters.\nallow: %q\n"+
+			"deny:  %q", allow, deny)
+	}
+}
+
+// Tests that the listener of IPFilter closes connections from denied addresses
+// and accepts them again once the address is removed from the deny list.
+func TestIPFilter_listener(t *testing.T) {
+	f := newTestFromParams(NewIPFilter, map[string]interface{}{
+		"deny": []string{"127.0.0.0/8"}}, t)
+	nl, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %+v", err)
+	}
+	l := f.listener(nl)
+	defer func() { _ = l.Close() }()
+
+	accepted := make(chan net.Conn)
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				close(accepted)
+				return
+			}
+			accepted <- conn
+		}
+	}()
+	dial := func() net.Conn {
+		conn, err := net.Dial("tcp", nl.Addr().String())
+		if err != nil {
+			t.Fatalf("Failed to dial: %+v", err)
+		}
+		return conn
+	}
+
+	denied := dial()
+	defer func() { _ = denied.Close() }()
+	_ = denied.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, err = denied.Read(make([]byte, 1)); err != io.EOF {
+		t.Errorf("Connection from a denied address was not closed: %v", err)
+	}
+
+	if _, err = f.Remove("127.0.0.0/8", true); err != nil {
+		t.Fatalf("Failed to remove network: %+v", err)
+	}
+	allowed := dial()
+	defer func() { _ = allowed.Close() }()
+	select {
+	case conn := <-accepted:
+		_ = conn.Close()
+	case <-time.After(5 * time.Second):
+		t.Errorf("Connection from an allowed address was not accepted.")
+	}
+}
+
+// Tests that a nil IPFilter returns the listener unchanged.
+func TestIPFilter_listener_Nil(t *testing.T) {
+	nl, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %+v", err)
+	}
+	defer func() { _ = nl.Close() }()
+
+	var f *IPFilter
+	if l := f.listener(nl); l != nl {
+		t.Errorf("Listener was wrapped without a filter.")
+	}
+}
@@ -0,0 +1,520 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package server
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	jww "github.com/spf13/jwalterweatherman"
+
+	"gitlab.com/elixxir/remoteSyncServer/store"
+	"gitlab.com/xx_network/primitives/utils"
+)
+
+const (
+	// defaultJournalMaxSize is the default size, in bytes, that the journal
+	// file grows to before it is compacted.
+	defaultJournalMaxSize = 64 << 20
+
+	// journalFilePerm is the permissions of the journal file.
+	journalFilePerm = os.FileMode(0600)
+
+	// journalHeaderLen is the length of the header of each record of the
+	// journal file: the length of its JSON payload and the CRC-32C checksum
+	// of the payload, both as big-endian uint32s.
+	journalHeaderLen = 8
+)
+
+// journalTable is the CRC-32C table used to checksum the records of the
+// journal file.
+var journalTable = crc32.MakeTable(crc32.Castagnoli)
+
+var (
+	// JournalNotOpenErr is returned for writes before the journal is opened
+	// when the server starts.
+	JournalNotOpenErr = errors.New("journal is not open")
+)
+
+// JournalParams are the parameters of the write-ahead journal.
+type JournalParams struct {
+	// Path is the journal file. It must be on a disk that survives a crash of
+	// the server and must not be used by another server.
+	Path string `mapstructure:"path"`
+
+	// MaxSize is the size, in bytes, that the journal file grows to before it
+	// is compacted to the writes that are still being applied.
+	MaxSize int64 `mapstructure:"maxSize"`
+}
+
+// JournalStats describes the replay of the journal when the server started.
+type JournalStats struct {
+	// Writes and Operations are the number of writes and transactions that
+	// were interrupted and replayed, and the number of their operations.
+	Writes     int
+	Operations int
+
+	// Failed is the number of interrupted writes and transactions that could
+	// not be replayed, such as a transaction that failed and was being undone
+	// during the crash. They are logged and skipped.
+	Failed int
+
+	// TornBytes is the size of the incomplete or corrupted record at the end
+	// of the journal file, which was discarded, if any.
+	TornBytes int64
+
+	// Duration is how long the replay took.
+	Duration time.Duration
+}
+
+// journalRecord is a record of the journal file. It is either the operations
+// of a write or transaction of the user, recorded before they are applied, or
+// marks the operations with the sequence number as done.
+type journalRecord struct {
+	Seq  uint64          `json:"seq"`
+	User string          `json:"user,omitempty"`
+	Ops  []TransactionOp `json:"ops,omitempty"`
+	Done bool            `json:"done,omitempty"`
+}
+
+// Journal is a write-ahead journal in front of the storage backend. The
+// operations of each write, delete, and transaction are recorded and synced
+// to the journal file before they are applied, and marked as done after. When
+// the server starts, the operations that were not done are applied again, so
+// that a crash while a file is written never leaves a torn file or a
+// transaction partly applied.
+type Journal struct {
+	params   JournalParams
+	newStore store.NewStore
+
+	f       *os.File
+	size    int64
+	seq     uint64
+	pending map[uint64]journalRecord
+	stats   JournalStats
+	mux     sync.Mutex
+}
+
+// NewJournal creates a new Journal from the parameters. The journal file is
+// opened and replayed when the server starts.
+func NewJournal(params map[string]interface{}) (*Journal, error) {
+	p := JournalParams{MaxSize: defaultJournalMaxSize}
+	err := decodeParams(params, &p, "journal")
+	if err != nil {
+		return nil, err
+	}
+
+	if p.Path == "" {
+		return nil, errors.New("journal path is required")
+	} else if p.MaxSize <= 0 {
+		return nil, errors.Errorf(
+			"journal maxSize %d must be positive", p.MaxSize)
+	}
+	if p.Path, err = utils.ExpandPath(p.Path); err != nil {
+		return nil, errors.Wrapf(err, "invalid journal path %q", p.Path)
+	}
+	return &Journal{params: p, pending: make(map[uint64]journalRecord)}, nil
+}
+
+// Params returns the parameters of the journal.
+func (j *Journal) Params() JournalParams {
+	return j.params
+}
+
+// Stats returns the statistics of the replay of the journal when the server
+// started.
+func (j *Journal) Stats() JournalStats {
+	j.mux.Lock()
+	defer j.mux.Unlock()
+	return j.stats
+}
+
+// Pending returns the number of writes and transactions that are being
+// applied.
+func (j *Journal) Pending() int {
+	j.mux.Lock()
+	defer j.mux.Unlock()
+	return len(j.pending)
+}
+
+// wrap returns a NewStore whose stores record their writes, deletes, and
+// transactions in the journal before applying them to the stores created by
+// newStore. The journal is replayed to the stores created by newStore.
+func (j *Journal) wrap(newStore store.NewStore) store.NewStore {
+	j.newStore = newStore
+	return func(storageDir, baseDir string) (store.Store, error) {
+		s, err := newStore(storageDir, baseDir)
+		if err != nil {
+			return nil, err
+		}
+		js := &journaledStore{Store: s, j: j, user: baseDir}
+		if versioner, ok := s.(store.Versioner); ok {
+			return &journaledVersionedStore{js, versioner}, nil
+		}
+		return js, nil
+	}
+}
+
+// open replays the writes in the journal file that were not done to the
+// stores in the storage directory, and then empties the journal file and opens
+// it for the writes of the server. An incomplete or corrupted record at the
+// end of the journal file, such as one that was being written during a crash,
+// is discarded, since its write was not applied. Returns an error if the
+// journal file cannot be read or opened.
+func (j *Journal) open(storageDir string) error {
+	start := time.Now()
+	records, tornBytes, err := readJournal(j.params.Path)
+	if err != nil {
+		return err
+	}
+
+	stats := JournalStats{TornBytes: tornBytes}
+	for _, record := range records {
+		s, err := j.newStore(storageDir, record.User)
+		if err == nil {
+			err = replayOps(s, record.Ops)
+		}
+		if err != nil {
+			jww.ERROR.Printf("Failed to replay journal record %d of %d "+
+				"operations of %q; skipping it: %+v", record.Seq,
+				len(record.Ops), record.User, err)
+			stats.Failed++
+			continue
+		}
+		stats.Writes++
+		stats.Operations += len(record.Ops)
+	}
+	stats.Duration = time.Since(start)
+
+	err = os.MkdirAll(filepath.Dir(j.params.Path), 0700)
+	if err != nil {
+		return errors.Wrap(err, "failed to create journal directory")
+	}
+	f, err := os.OpenFile(j.params.Path,
+		os.O_CREATE|os.O_WRONLY|os.O_TRUNC|os.O_APPEND, journalFilePerm)
+	if err != nil {
+		return errors.Wrap(err, "failed to open journal")
+	}
+
+	j.mux.Lock()
+	j.f, j.size, j.stats = f, 0, stats
+	j.mux.Unlock()
+
+	if stats.TornBytes > 0 {
+		jww.WARN.Printf("Discarded %d bytes of an incomplete or corrupted "+
+			"record at the end of the journal.", stats.TornBytes)
+	}
+	if stats.Writes > 0 || stats.Failed > 0 {
+		jww.INFO.Printf("Replayed %d interrupted writes (%d operations) "+
+			"from the journal in %s; %d failed.", stats.Writes,
+			stats.Operations, stats.Duration, stats.Failed)
+	}
+	return nil
+}
+
+// close closes the journal file. Later writes fail with [JournalNotOpenErr].
+func (j *Journal) close() {
+	j.mux.Lock()
+	defer j.mux.Unlock()
+	if j.f == nil {
+		return
+	}
+	if err := j.f.Close(); err != nil {
+		jww.WARN.Printf("Failed to close journal: %+v", err)
+	}
+	j.f = nil
+}
+
+// readJournal returns the records of the journal file at the path that are
+// not marked as done, in the order they were written, and the size of the
+// incomplete or corrupted record at its end, after which it is not read. A
+// missing journal file has no records.
+func readJournal(path string) ([]journalRecord, int64, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, 0, nil
+	} else if err != nil {
+		return nil, 0, errors.Wrap(err, "failed to read journal")
+	}
+
+	pending := make(map[uint64]journalRecord)
+	for len(data) > 0 {
+		if len(data) < journalHeaderLen {
+			break
+		}
+		n := binary.BigEndian.Uint32(data[:4])
+		if uint64(len(data)-journalHeaderLen) < uint64(n) {
+			break
+		}
+		payload := data[journalHeaderLen : journalHeaderLen+int(n)]
+		var record journalRecord
+		if crc32.Checksum(payload, journalTable) !=
+			binary.BigEndian.Uint32(data[4:8]) ||
+			json.Unmarshal(payload, &record) != nil {
+			break
+		}
+		if record.Done {
+			delete(pending, record.Seq)
+		} else {
+			pending[record.Seq] = record
+		}
+		data = data[journalHeaderLen+int(n):]
+	}
+
+	records := make([]journalRecord, 0, len(pending))
+	for _, record := range pending {
+		records = append(records, record)
+	}
+	sort.Slice(records, func(i, k int) bool {
+		return records[i].Seq < records[k].Seq
+	})
+	return records, int64(len(data)), nil
+}
+
+// replayOps applies the operations to the store again. Unlike
+// applyTransaction, the operations are not undone if one fails, and deleting
+// a file that does not exist succeeds, since the operations may have been
+// applied before the crash.
+func replayOps(s store.Store, ops []TransactionOp) error {
+	for _, op := range ops {
+		var err error
+		if op.Delete {
+			if err = s.Delete(op.Path); errors.Is(err, os.ErrNotExist) {
+				err = nil
+			}
+		} else {
+			err = s.Write(op.Path, op.Data)
+		}
+		if err != nil {
+			return errors.Wrapf(err, "failed to replay operation on %q",
+				op.Path)
+		}
+	}
+	return nil
+}
+
+// apply records the operations of the user in the journal, calls applyOps to
+// apply them, and then marks them as done, even if applying them failed,
+// since a failed write or transaction must not be applied when the journal is
+// replayed. Returns the error of applyOps or [JournalNotOpenErr] if the
+// journal is not open.
+func (j *Journal) apply(
+	user string, ops []TransactionOp, applyOps func() error) error {
+	seq, err := j.begin(user, ops)
+	if err != nil {
+		return err
+	}
+	err = applyOps()
+	j.end(seq)
+	return err
+}
+
+// begin appends the record of the operations of the user to the journal file
+// and syncs it to disk. Returns its sequence number.
+func (j *Journal) begin(user string, ops []TransactionOp) (uint64, error) {
+	j.mux.Lock()
+	defer j.mux.Unlock()
+	if j.f == nil {
+		return 0, JournalNotOpenErr
+	}
+
+	record := journalRecord{Seq: j.seq + 1, User: user, Ops: ops}
+	if err := j.append(record); err != nil {
+		return 0, err
+	} else if err = j.f.Sync(); err != nil {
+		return 0, errors.Wrap(err, "failed to sync journal")
+	}
+	j.seq = record.Seq
+	j.pending[record.Seq] = record
+	return record.Seq, nil
+}
+
+// end marks the record with the sequence number as done and compacts the
+// journal file once it reaches the maximum size. The done record is not
+// synced, since replaying a write that was applied is harmless.
+func (j *Journal) end(seq uint64) {
+	j.mux.Lock()
+	defer j.mux.Unlock()
+	delete(j.pending, seq)
+	if err := j.append(journalRecord{Seq: seq, Done: true}); err != nil {
+		jww.WARN.Printf("Failed to mark journal record %d as done; it will "+
+			"be replayed on restart: %+v", seq, err)
+	}
+	if j.size >= j.params.MaxSize {
+		if err := j.compact(); err != nil {
+			jww.ERROR.Printf("Failed to compact journal: %+v", err)
+		}
+	}
+}
+
+// append writes the record to the end of the journal file. If the write fails,
+// the journal file is truncated to its previous size, so that the records
+// appended later can be read. The caller must hold the lock.
+func (j *Journal) append(record journalRecord) error {
+	payload, err := json.Marshal(record)
+	if err != nil {
+		return errors.Wrap(err, "failed to encode journal record")
+	}
+	data := make([]byte, journalHeaderLen+len(payload))
+	binary.BigEndian.PutUint32(data[:4], uint32(len(payload)))
+	binary.BigEndian.PutUint32(
+		data[4:8], crc32.Checksum(payload, journalTable))
+	copy(data[journalHeaderLen:], payload)
+
+	if _, err = j.f.Write(data); err != nil {
+		_ = j.f.Truncate(j.size)
+		return errors.Wrap(err, "failed to write journal")
+	}
+	j.size += int64(len(data))
+	return nil
+}
+
+// compact replaces the journal file with one that contains only the records
+// that are not done. The caller must hold the lock.
+func (j *Journal) compact() error {
+	seqs := make([]uint64, 0, len(j.pending))
+	for seq := range j.pending {
+		seqs = append(seqs, seq)
+	}
+	sort.Slice(seqs, func(i, k int) bool { return seqs[i] < seqs[k] })
+
+	tmpPath := j.params.Path + ".tmp"
+	f, err := os.OpenFile(tmpPath,
+		os.O_CREATE|os.O_WRONLY|os.O_TRUNC|os.O_APPEND, journalFilePerm)
+	if err != nil {
+		return errors.Wrapf(err, "failed to create %s", tmpPath)
+	}
+	compacted := &Journal{f: f}
+	for _, seq := range seqs {
+		if err = compacted.append(j.pending[seq]); err != nil {
+			break
+		}
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	if err != nil {
+		_ = f.Close()
+		_ = os.Remove(tmpPath)
+		return err
+	}
+
+	// The journal file is closed before it is replaced, since open files
+	// cannot be replaced on Windows
+	_ = j.f.Close()
+	if err = os.Rename(tmpPath, j.params.Path); err != nil {
+		_ = f.Close()
+		_ = os.Remove(tmpPath)
+		j.f, j.size = nil, 0
+		f, openErr := os.OpenFile(
+			j.params.Path, os.O_WRONLY|os.O_APPEND, journalFilePerm)
+		if openErr != nil {
+			return errors.Wrapf(err, "failed to replace journal and to "+
+				"reopen it (%v)", openErr)
+		}
+		info, statErr := f.Stat()
+		if statErr != nil {
+			_ = f.Close()
+			return errors.Wrapf(err, "failed to replace journal and to "+
+				"reopen it (%v)", statErr)
+		}
+		j.f, j.size = f, info.Size()
+		return errors.Wrap(err, "failed to replace journal")
+	}
+	j.f, j.size = f, compacted.size
+	return nil
+}
+
+// journaledStore records the writes and deletes of the Store of a user in the
+// journal before applying them. Adheres to the Store interface.
+type journaledStore struct {
+	store.Store
+	j    *Journal
+	user string
+}
+
+// Write records the write in the journal and writes the data to the file at
+// the path.
+func (js *journaledStore) Write(path string, data []byte) error {
+	return js.commit([]TransactionOp{{Path: path, Data: data}})
+}
+
+// Delete records the delete in the journal and deletes the file at the path.
+func (js *journaledStore) Delete(path string) error {
+	return js.commit([]TransactionOp{{Path: path, Delete: true}})
+}
+
+// commit records the operations of a transaction in the journal as one record
+// and applies them, so that all of them are applied again if the server
+// crashes while they are applied.
+func (js *journaledStore) commit(ops []TransactionOp) error {
+	return js.j.apply(js.user, ops, func() error {
+		return applyOps(js.Store, ops)
+	})
+}
+
+// ListFiles returns the paths of all files in the underlying store. Returns an
+// error if the underlying store does not implement Lister.
+func (js *journaledStore) ListFiles() ([]string, error) {
+	lister, ok := js.Store.(store.Lister)
+	if !ok {
+		return nil, errors.New("underlying store cannot list its files")
+	}
+	return lister.ListFiles()
+}
+
+// Size returns the total size of the files in the underlying store. Returns an
+// error if the underlying store does not implement Sizer.
+func (js *journaledStore) Size() (int64, error) {
+	sizer, ok := js.Store.(store.Sizer)
+	if !ok {
+		return 0, errors.New("underlying store cannot report its size")
+	}
+	return sizer.Size()
+}
+
+// Ping returns an error if the underlying store cannot be reached. Stores that
+// do not implement Pinger are assumed to be reachable.
+func (js *journaledStore) Ping() error {
+	if pinger, ok := js.Store.(store.Pinger); ok {
+		return pinger.Ping()
+	}
+	return nil
+}
+
+// Open opens the file at the path in the underlying store for reading.
+func (js *journaledStore) Open(path string) (io.ReadCloser, int64, error) {
+	return store.Open(js.Store, path)
+}
+
+// Stat returns the metadata of the file at the path in the underlying store.
+func (js *journaledStore) Stat(path string) (store.Metadata, error) {
+	return store.Stat(js.Store, path)
+}
+
+// SetDevice records the device as the writer of the file at the path in the
+// underlying store.
+func (js *journaledStore) SetDevice(
+	path string, sha256 []byte, device string) error {
+	return store.SetDevice(js.Store, path, sha256, device)
+}
+
+// journaledVersionedStore is a journaledStore of a store that keeps previous
+// versions of files.
+type journaledVersionedStore struct {
+	*journaledStore
+	store.Versioner
+}
@@ -0,0 +1,202 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package server
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/pkg/errors"
+
+	"gitlab.com/elixxir/remoteSyncServer/store"
+)
+
+// Tests that NewJournal decodes the parameters and sets the default maximum
+// size.
+func TestNewJournal(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "journal")
+	j, err := NewJournal(map[string]interface{}{"path": path})
+	if err != nil {
+		t.Fatalf("Failed to create journal: %+v", err)
+	}
+	if j.Params().Path != path || j.Params().MaxSize != defaultJournalMaxSize {
+		t.Errorf("Unexpected parameters: %+v", j.Params())
+	}
+}
+
+// Error path: Tests that NewJournal returns an error for unknown and invalid
+// parameters.
+func TestNewJournal_Error(t *testing.T) {
+	for _, params := range []map[string]interface{}{
+		{},
+		{"path": "journal", "unknown": true},
+		{"path": "journal", "maxSize": 0},
+	} {
+		if _, err := NewJournal(params); err == nil {
+			t.Errorf("Failed to get error for params %v.", params)
+		}
+	}
+}
+
+// Tests that writes, deletes, and transactions through a journaled store are
+// applied and marked as done in the journal.
+func Test_journaledStore(t *testing.T) {
+	j, newStore := newTestJournal(0, t)
+	s, err := newStore("", "waldo")
+	if err != nil {
+		t.Fatalf("Failed to create store: %+v", err)
+	}
+	if err = s.Write("a", []byte("a")); err != nil {
+		t.Fatalf("Failed to write: %+v", err)
+	}
+	err = applyOps(s, []TransactionOp{
+		{Path: "b", Data: []byte("b")}, {Path: "a", Delete: true}})
+	if err != nil {
+		t.Fatalf("Failed to commit: %+v", err)
+	}
+	if err = s.Delete("missing"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Unexpected error for missing file: %+v", err)
+	}
+
+	if files := listTestFiles(s, t); !reflect.DeepEqual([]string{"b"}, files) {
+		t.Errorf("Unexpected files: %v", files)
+	}
+	if j.Pending() != 0 {
+		t.Errorf("%d writes pending.", j.Pending())
+	}
+	records, tornBytes, err := readJournal(j.params.Path)
+	if err != nil || len(records) != 0 || tornBytes != 0 {
+		t.Errorf("Unexpected journal: %v, %d bytes torn (%v)",
+			records, tornBytes, err)
+	}
+}
+
+// Tests that open replays the writes that were not done, discards an
+// incomplete record at the end of the journal, and empties the journal.
+func TestJournal_open(t *testing.T) {
+	j, newStore := newTestJournal(0, t)
+	writeTestFiles(newStore, "waldo", t, "old")
+	done, err := j.begin(
+		"waldo", []TransactionOp{{Path: "done", Data: []byte("a")}})
+	if err != nil {
+		t.Fatalf("Failed to begin: %+v", err)
+	}
+	j.end(done)
+	_, err = j.begin("waldo", []TransactionOp{{Path: "a", Data: []byte("a")},
+		{Path: "old", Delete: true}, {Path: "missing", Delete: true}})
+	if err != nil {
+		t.Fatalf("Failed to begin: %+v", err)
+	}
+	j.close()
+	f, err := os.OpenFile(j.params.Path, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatalf("Failed to open journal: %+v", err)
+	}
+	if _, err = f.Write([]byte{0, 0, 1, 0, 1, 2, 3}); err != nil {
+		t.Fatalf("Failed to write torn record: %+v", err)
+	}
+	_ = f.Close()
+
+	restarted, err := NewJournal(map[string]interface{}{"path": j.params.Path})
+	if err != nil {
+		t.Fatalf("Failed to create journal: %+v", err)
+	}
+	restarted.wrap(j.newStore)
+	if err = restarted.open(""); err != nil {
+		t.Fatalf("Failed to open journal: %+v", err)
+	}
+	stats := restarted.Stats()
+	if stats.Writes != 1 || stats.Operations != 3 || stats.Failed != 0 ||
+		stats.TornBytes != 7 {
+		t.Errorf("Unexpected stats: %+v", stats)
+	}
+	s := writeTestFiles(newStore, "waldo", t)
+	if files := listTestFiles(s, t); !reflect.DeepEqual([]string{"a"}, files) {
+		t.Errorf("Unexpected files after replay: %v", files)
+	}
+	if info, err := os.Stat(j.params.Path); err != nil || info.Size() != 0 {
+		t.Errorf("Journal not emptied: %v (%v)", info, err)
+	}
+}
+
+// Tests that the journal is compacted to the writes that are not done once it
+// reaches its maximum size.
+func TestJournal_compact(t *testing.T) {
+	j, newStore := newTestJournal(100, t)
+	pending, err := j.begin("waldo", []TransactionOp{{Path: "a"}})
+	if err != nil {
+		t.Fatalf("Failed to begin: %+v", err)
+	}
+	s := writeTestFiles(newStore, "waldo", t, "b", "c", "d")
+
+	info, err := os.Stat(j.params.Path)
+	if err != nil {
+		t.Fatalf("Failed to stat journal: %+v", err)
+	} else if info.Size() >= 200 {
+		t.Errorf("Journal of %d bytes not compacted.", info.Size())
+	}
+	records, _, err := readJournal(j.params.Path)
+	if err != nil {
+		t.Fatalf("Failed to read journal: %+v", err)
+	} else if len(records) != 1 || records[0].Seq != pending {
+		t.Errorf("Unexpected records: %+v", records)
+	}
+
+	j.end(pending)
+	if err = s.Write("e", nil); err != nil {
+		t.Errorf("Failed to write after compaction: %+v", err)
+	}
+}
+
+// Error path: Tests that writes fail with JournalNotOpenErr before the
+// journal is opened and after it is closed.
+func TestJournal_NotOpen(t *testing.T) {
+	j, err := NewJournal(map[string]interface{}{
+		"path": filepath.Join(t.TempDir(), "journal")})
+	if err != nil {
+		t.Fatalf("Failed to create journal: %+v", err)
+	}
+	s, err := j.wrap(newTestGCStore(false, t))("", "waldo")
+	if err != nil {
+		t.Fatalf("Failed to create store: %+v", err)
+	}
+	if err = s.Write("a", nil); !errors.Is(err, JournalNotOpenErr) {
+		t.Errorf("Unexpected error before open: %+v", err)
+	}
+
+	if err = j.open(""); err != nil {
+		t.Fatalf("Failed to open journal: %+v", err)
+	}
+	j.close()
+	if err = s.Write("a", nil); !errors.Is(err, JournalNotOpenErr) {
+		t.Errorf("Unexpected error after close: %+v", err)
+	}
+}
+
+// newTestJournal returns an open journal in a temporary directory with the
+// maximum size, or the default if it is 0, and the NewStore it wraps around a
+// memory backend.
+func newTestJournal(maxSize int64, t *testing.T) (*Journal, store.NewStore) {
+	params := map[string]interface{}{
+		"path": filepath.Join(t.TempDir(), "journal")}
+	if maxSize > 0 {
+		params["maxSize"] = maxSize
+	}
+	j, err := NewJournal(params)
+	if err != nil {
+		t.Fatalf("Failed to create journal: %+v", err)
+	}
+	newStore := j.wrap(newTestGCStore(false, t))
+	if err = j.open(""); err != nil {
+		t.Fatalf("Failed to open journal: %+v", err)
+	}
+	t.Cleanup(j.close)
+	return j, newStore
+}
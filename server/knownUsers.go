@@ -0,0 +1,114 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package server
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	jww "github.com/spf13/jwalterweatherman"
+
+	"gitlab.com/elixxir/remoteSyncServer/credentials"
+	"gitlab.com/elixxir/remoteSyncServer/store"
+)
+
+// KnownUsers records each user whose storage was opened, so that backups,
+// cluster snapshots, and the scrubber also find the files of users that have
+// no password in the credential store, such as those that log in with OIDC, a
+// client certificate, or an API key.
+type KnownUsers struct {
+	// seen maps each known username to the time its storage was first opened.
+	seen credentials.Store
+
+	// added are the usernames known to be in seen, so that it is only read
+	// the first time each user's storage is opened.
+	added map[string]bool
+	mux   sync.Mutex
+}
+
+// NewKnownUsers creates a new KnownUsers that records the users in the store.
+func NewKnownUsers(seen credentials.Store) *KnownUsers {
+	return &KnownUsers{seen: seen, added: make(map[string]bool)}
+}
+
+// add records the user if they are not yet known.
+func (ku *KnownUsers) add(username string) error {
+	ku.mux.Lock()
+	defer ku.mux.Unlock()
+
+	if ku.added[username] {
+		return nil
+	}
+	_, err := ku.seen.Get(username)
+	if errors.Is(err, credentials.UserNotFoundErr) {
+		err = ku.seen.Set(username, time.Now().UTC().Format(time.RFC3339))
+	}
+	if err != nil {
+		return errors.Wrapf(err, "failed to record user %q", username)
+	}
+	ku.added[username] = true
+
+	return nil
+}
+
+// wrap returns a NewStore that records the user of each store it creates
+// before creating it with newStore. Users that cannot be recorded are logged,
+// without denying them their storage.
+func (ku *KnownUsers) wrap(newStore store.NewStore) store.NewStore {
+	return func(storageDir, baseDir string) (store.Store, error) {
+		if err := ku.add(baseDir); err != nil {
+			jww.ERROR.Printf("%+v", err)
+		}
+		return newStore(storageDir, baseDir)
+	}
+}
+
+// userLister lists the usernames of users, such as a [credentials.Store].
+type userLister interface {
+	List() ([]string, error)
+}
+
+// allUsers lists the registered users together with the known users.
+type allUsers struct {
+	users credentials.Store
+	known *KnownUsers
+}
+
+// List returns the usernames of the registered and known users sorted
+// alphabetically. Only the registered users are listed if known is nil.
+func (au allUsers) List() ([]string, error) {
+	usernames, err := au.users.List()
+	if err != nil || au.known == nil {
+		return usernames, err
+	}
+	known, err := au.known.seen.List()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list known users")
+	}
+
+	unique := make(map[string]bool, len(usernames)+len(known))
+	for _, username := range usernames {
+		unique[username] = true
+	}
+	for _, username := range known {
+		if !unique[username] {
+			unique[username] = true
+			usernames = append(usernames, username)
+		}
+	}
+	sort.Strings(usernames)
+
+	return usernames, nil
+}
+
+// allUsers returns a userLister of the registered and known users.
+func (h *handler) allUsers() allUsers {
+	return allUsers{users: h.users, known: h.known}
+}
@@ -0,0 +1,83 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package server
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"gitlab.com/elixxir/remoteSyncServer/credentials"
+	"gitlab.com/elixxir/remoteSyncServer/store"
+)
+
+// Tests that the NewStore returned by KnownUsers.wrap records the user of each
+// store once, with the time it was first opened.
+func TestKnownUsers_wrap(t *testing.T) {
+	seen := credentials.NewMemStore(nil)
+	ku := NewKnownUsers(seen)
+	newStore := ku.wrap(store.NewMemStore)
+
+	for _, username := range []string{"waldo", "carmen", "waldo"} {
+		if _, err := newStore("", username); err != nil {
+			t.Fatalf("Failed to create store of %q: %+v", username, err)
+		}
+	}
+
+	usernames, err := seen.List()
+	if err != nil {
+		t.Fatalf("Failed to list known users: %+v", err)
+	} else if expected := []string{"carmen", "waldo"}; !reflect.DeepEqual(
+		expected, usernames) {
+		t.Errorf("Unexpected known users.\nexpected: %v\nreceived: %v",
+			expected, usernames)
+	}
+	first, err := seen.Get("waldo")
+	if err != nil {
+		t.Fatalf("Failed to get known user: %+v", err)
+	} else if _, err = time.Parse(time.RFC3339, first); err != nil {
+		t.Errorf("Invalid time user was first seen %q: %+v", first, err)
+	}
+
+	// A user recorded by a previous KnownUsers keeps its time
+	if _, err = NewKnownUsers(seen).wrap(store.NewMemStore)(
+		"", "waldo"); err != nil {
+		t.Fatalf("Failed to create store: %+v", err)
+	}
+	if again, _ := seen.Get("waldo"); again != first {
+		t.Errorf("Time user was first seen changed from %q to %q.",
+			first, again)
+	}
+}
+
+// Tests that allUsers.List returns the registered and known users sorted and
+// without duplicates, and only the registered users without KnownUsers.
+func Test_allUsers_List(t *testing.T) {
+	users := credentials.NewMemStore(
+		map[string]string{"waldo": "hash1", "carmen": "hash2"})
+	known := NewKnownUsers(credentials.NewMemStore(
+		map[string]string{"waldo": "", "alice": ""}))
+
+	usernames, err := allUsers{users: users, known: known}.List()
+	if err != nil {
+		t.Fatalf("Failed to list users: %+v", err)
+	} else if expected := []string{"alice", "carmen", "waldo"}; !reflect.
+		DeepEqual(expected, usernames) {
+		t.Errorf("Unexpected users.\nexpected: %v\nreceived: %v",
+			expected, usernames)
+	}
+
+	usernames, err = allUsers{users: users}.List()
+	if err != nil {
+		t.Fatalf("Failed to list users: %+v", err)
+	} else if expected := []string{"carmen", "waldo"}; !reflect.DeepEqual(
+		expected, usernames) {
+		t.Errorf("Unexpected registered users.\nexpected: %v\nreceived: %v",
+			expected, usernames)
+	}
+}
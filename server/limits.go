@@ -0,0 +1,87 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package server
+
+import (
+	"math"
+
+	"github.com/pkg/errors"
+)
+
+// restBodyFactor is how many times larger than the maximum request size the
+// JSON body of a REST request may be, since binary data is base64 encoded in
+// JSON.
+const restBodyFactor = 2
+
+var (
+	// ObjectTooLargeErr is returned, with the RESOURCE_EXHAUSTED code, when
+	// writing a file larger than the maximum object size, whether it is
+	// written, uploaded, or reconstructed from a delta.
+	ObjectTooLargeErr = errors.New("object exceeds the maximum size")
+
+	// RequestTooLargeErr is returned, with the RESOURCE_EXHAUSTED code, for a
+	// REST request larger than the maximum request size. Native gRPC and
+	// gRPC-web requests over the limit are rejected by gRPC with the same
+	// code.
+	RequestTooLargeErr = errors.New("request exceeds the maximum size")
+)
+
+// Limits are the maximum sizes of the files stored and the requests received,
+// so that a client cannot exhaust the memory of the server with a single large
+// file or request. A limit of zero is no limit.
+type Limits struct {
+	// MaxObjectBytes is the maximum size of a file in bytes.
+	MaxObjectBytes int64
+
+	// MaxRequestBytes is the maximum size of a request message in bytes.
+	MaxRequestBytes int64
+}
+
+// NewLimits returns the Limits with the maximum sizes. Returns an error if
+// either is negative or the request size does not fit in an int32, which is
+// the largest message size of gRPC.
+func NewLimits(maxObjectBytes, maxRequestBytes int64) (*Limits, error) {
+	if maxObjectBytes < 0 {
+		return nil, errors.Errorf(
+			"maximum object size %d cannot be negative", maxObjectBytes)
+	} else if maxRequestBytes < 0 || maxRequestBytes > math.MaxInt32 {
+		return nil, errors.Errorf("maximum request size %d must be 0 to %d",
+			maxRequestBytes, math.MaxInt32)
+	}
+	return &Limits{
+		MaxObjectBytes: maxObjectBytes, MaxRequestBytes: maxRequestBytes,
+	}, nil
+}
+
+// checkObject returns [ObjectTooLargeErr] if the size of a file exceeds the
+// maximum object size.
+func (l *Limits) checkObject(size int64) error {
+	if l.MaxObjectBytes > 0 && size > l.MaxObjectBytes {
+		return errors.Wrapf(ObjectTooLargeErr, "%d bytes exceeds %d bytes",
+			size, l.MaxObjectBytes)
+	}
+	return nil
+}
+
+// checkRequest returns [RequestTooLargeErr] if the size of a request exceeds
+// the maximum request size.
+func (l *Limits) checkRequest(size int64) error {
+	if l.MaxRequestBytes > 0 && size > l.MaxRequestBytes {
+		return errors.Wrapf(RequestTooLargeErr, "%d bytes exceeds %d bytes",
+			size, l.MaxRequestBytes)
+	}
+	return nil
+}
+
+// maxRecvMsgSize returns the largest message the gRPC server receives.
+func (l *Limits) maxRecvMsgSize() int {
+	if l == nil || l.MaxRequestBytes == 0 {
+		return math.MaxInt32
+	}
+	return int(l.MaxRequestBytes)
+}
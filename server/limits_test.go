@@ -0,0 +1,63 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package server
+
+import (
+	"errors"
+	"math"
+	"testing"
+)
+
+// Tests that Limits.checkObject and Limits.checkRequest only reject sizes over
+// their limits and that zero is no limit.
+func TestLimits_check(t *testing.T) {
+	l, err := NewLimits(100, 0)
+	if err != nil {
+		t.Fatalf("Failed to create limits: %+v", err)
+	}
+
+	if err = l.checkObject(100); err != nil {
+		t.Errorf("Failed to allow object at the limit: %+v", err)
+	}
+	if err = l.checkObject(101); !errors.Is(err, ObjectTooLargeErr) {
+		t.Errorf("Unexpected error for large object."+
+			"\nexpected: %v\nreceived: %+v", ObjectTooLargeErr, err)
+	}
+	if err = l.checkRequest(math.MaxInt32); err != nil {
+		t.Errorf("Failed to allow request without a limit: %+v", err)
+	}
+	if size := l.maxRecvMsgSize(); size != math.MaxInt32 {
+		t.Errorf("Unexpected message size.\nexpected: %d\nreceived: %d",
+			math.MaxInt32, size)
+	}
+
+	l, _ = NewLimits(0, 50)
+	if err = l.checkRequest(51); !errors.Is(err, RequestTooLargeErr) {
+		t.Errorf("Unexpected error for large request."+
+			"\nexpected: %v\nreceived: %+v", RequestTooLargeErr, err)
+	}
+	if size := l.maxRecvMsgSize(); size != 50 {
+		t.Errorf("Unexpected message size.\nexpected: %d\nreceived: %d",
+			50, size)
+	}
+}
+
+// Error path: Tests that NewLimits returns an error for negative sizes and a
+// request size that does not fit in an int32.
+func TestNewLimits_Error(t *testing.T) {
+	tests := map[string][2]int64{
+		"negative object":  {-1, 0},
+		"negative request": {0, -1},
+		"large request":    {0, math.MaxInt32 + 1},
+	}
+	for name, sizes := range tests {
+		if _, err := NewLimits(sizes[0], sizes[1]); err == nil {
+			t.Errorf("Failed to get error for %s.", name)
+		}
+	}
+}
@@ -0,0 +1,330 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package server
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	jww "github.com/spf13/jwalterweatherman"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"gitlab.com/elixxir/remoteSyncServer/store"
+)
+
+const (
+	// linkPathPrefix is the path prefix of the files served by download
+	// links. The path of the file follows it.
+	linkPathPrefix = "/links"
+
+	// minLinkKeyLen is the shortest key that links can be signed with.
+	minLinkKeyLen = 32
+
+	// defaultLinkTTL is how long a link is valid for if the client does not
+	// request a duration, unless the maximum is shorter.
+	defaultLinkTTL = time.Hour
+
+	// defaultMaxLinkTTL is the default longest duration a link can be valid
+	// for.
+	defaultMaxLinkTTL = 24 * time.Hour
+)
+
+// Query parameters of download links.
+const (
+	linkUserParam    = "user"
+	linkExpiresParam = "expires"
+	linkSigParam     = "sig"
+)
+
+var (
+	// LinksDisabledErr is returned by the Links service while download links
+	// are not enabled.
+	LinksDisabledErr = errors.New("download links are not enabled")
+
+	// InvalidLinkTTLErr is returned when a link is requested for a negative
+	// duration or one longer than the maximum.
+	InvalidLinkTTLErr = errors.New("invalid link duration")
+
+	// InvalidLinkErr is returned for a download link that is malformed or
+	// whose signature does not match, such as one that was altered or signed
+	// with another key.
+	InvalidLinkErr = errors.New("invalid download link")
+
+	// LinkExpiredErr is returned for a download link that has expired.
+	LinkExpiredErr = errors.New("download link has expired")
+)
+
+// LinksParams are the parameters of download links. They are set in the
+// "links" section of the config.
+type LinksParams struct {
+	// Key signs the links. It must be at least 32 characters long, and
+	// changing it invalidates all links. Required.
+	Key string `mapstructure:"key"`
+
+	// BaseURL is the scheme and host, and optionally a path, that clients
+	// reach a listener serving REST at, such as "https://sync.example.com".
+	// Links are built from it. Required.
+	BaseURL string `mapstructure:"baseURL"`
+
+	// MaxTTL is the longest duration a link can be valid for. Defaults to
+	// 24h.
+	MaxTTL time.Duration `mapstructure:"maxTTL"`
+}
+
+// Links signs expiring links to the files of users, so that a user can hand
+// a one-off download link to another device or person without sharing their
+// credentials. The links are served on the listeners that serve REST.
+type Links struct {
+	params  LinksParams
+	baseURL string
+}
+
+// NewLinks creates new Links from the parameters. Returns an error for unknown
+// or invalid parameters.
+func NewLinks(params map[string]interface{}) (*Links, error) {
+	p := LinksParams{MaxTTL: defaultMaxLinkTTL}
+	if err := decodeParams(params, &p, "link"); err != nil {
+		return nil, err
+	}
+
+	if len(p.Key) < minLinkKeyLen {
+		return nil, errors.Errorf("key must be at least %d characters long",
+			minLinkKeyLen)
+	} else if p.MaxTTL <= 0 {
+		return nil, errors.Errorf("max TTL %s must be positive", p.MaxTTL)
+	}
+	u, err := url.Parse(p.BaseURL)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid base URL %q", p.BaseURL)
+	} else if (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" ||
+		u.RawQuery != "" || u.Fragment != "" {
+		return nil, errors.Errorf("base URL %q must be an HTTP or HTTPS URL "+
+			"without a query", p.BaseURL)
+	}
+
+	return &Links{params: p, baseURL: strings.TrimSuffix(p.BaseURL, "/")}, nil
+}
+
+// CheckLinks returns an error if download links are enabled but no listener
+// serves REST, which they are served with.
+func CheckLinks(links *Links, listeners []Listener) error {
+	if links == nil {
+		return nil
+	}
+	for _, l := range listeners {
+		if l.Serves(ProtocolREST) {
+			return nil
+		}
+	}
+	return errors.Errorf("download links are enabled, but no listener "+
+		"serves the %s protocol", ProtocolREST)
+}
+
+// Params returns the parameters of the links.
+func (l *Links) Params() LinksParams {
+	return l.params
+}
+
+// ttl returns how long a link requested for the number of seconds is valid
+// for: the default if it is zero. Returns [InvalidLinkTTLErr] if it is negative
+// or longer than the maximum.
+func (l *Links) ttl(seconds int64) (time.Duration, error) {
+	if seconds < 0 || seconds > int64(l.params.MaxTTL/time.Second) {
+		return 0, errors.Wrapf(InvalidLinkTTLErr,
+			"%ds must be between 0s and %s", seconds, l.params.MaxTTL)
+	} else if seconds == 0 {
+		if l.params.MaxTTL < defaultLinkTTL {
+			return l.params.MaxTTL, nil
+		}
+		return defaultLinkTTL, nil
+	}
+	return time.Duration(seconds) * time.Second, nil
+}
+
+// url returns the link to the file of the user at the path that expires at the
+// time. Leading slashes of the path are removed, as the link cannot keep them.
+func (l *Links) url(username, filePath string, expires time.Time) string {
+	filePath = strings.TrimLeft(filePath, "/")
+	query := url.Values{}
+	query.Set(linkUserParam, username)
+	query.Set(linkExpiresParam, strconv.FormatInt(expires.Unix(), 10))
+	query.Set(linkSigParam, l.sign(username, filePath, expires.Unix()))
+	escaped := (&url.URL{Path: filePath}).EscapedPath()
+	return l.baseURL + linkPathPrefix + "/" + escaped + "?" + query.Encode()
+}
+
+// verify returns the user and the path of the file of the link requested at
+// the time. Returns [InvalidLinkErr] if the link is malformed or its signature
+// does not match and [LinkExpiredErr] if it has expired.
+func (l *Links) verify(u *url.URL, now time.Time) (string, string, error) {
+	filePath := strings.TrimPrefix(u.Path, linkPathPrefix+"/")
+	query := u.Query()
+	username := query.Get(linkUserParam)
+	expires, err := strconv.ParseInt(query.Get(linkExpiresParam), 10, 64)
+	if err != nil || filePath == "" || username == "" {
+		return "", "", errors.Wrap(InvalidLinkErr, "malformed link")
+	}
+
+	expected := l.sign(username, filePath, expires)
+	if !hmac.Equal([]byte(query.Get(linkSigParam)), []byte(expected)) {
+		return "", "", errors.Wrap(InvalidLinkErr, "signature does not match")
+	} else if !now.Before(time.Unix(expires, 0)) {
+		return "", "", errors.Wrapf(
+			LinkExpiredErr, "expired at %s", time.Unix(expires, 0))
+	}
+	return username, filePath, nil
+}
+
+// sign returns the signature of the link to the file of the user at the path
+// that expires at the Unix time.
+func (l *Links) sign(username, filePath string, expires int64) string {
+	mac := hmac.New(sha256.New, []byte(l.params.Key))
+	_, _ = fmt.Fprintf(mac, "%q %q %d", username, filePath, expires)
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// linkHandler serves the files of download links under linkPathPrefix. Since
+// the requests are not RPCs, it applies the rate limits and bans and records
+// the downloads in the audit log itself.
+type linkHandler struct {
+	h           *handler
+	links       *Links
+	limiter     *RateLimiter
+	concurrency *ConcurrencyLimiter
+	autoBan     *AutoBan
+	audit       *AuditLog
+}
+
+// ServeHTTP verifies the link and responds with the file. Invalid links are
+// rejected with 403 and expired links with 410.
+func (lh *linkHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", http.MethodGet+", "+http.MethodHead)
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed),
+			http.StatusMethodNotAllowed)
+		return
+	}
+	if err := lh.autoBan.checkHTTP(r); err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	var ipLimiter, userLimiter *keyedLimiter
+	if lh.limiter != nil {
+		ipLimiter, userLimiter = lh.limiter.limiters()
+	}
+	if ipLimiter != nil && !ipLimiter.allow(remoteIP(r), time.Now()) {
+		http.Error(w, "rate limit exceeded", http.StatusTooManyRequests)
+		return
+	}
+
+	username, filePath, err := lh.links.verify(r.URL, time.Now())
+	if errors.Is(err, LinkExpiredErr) {
+		http.Error(w, err.Error(), http.StatusGone)
+		return
+	} else if err != nil {
+		lh.autoBan.recordHTTP(
+			r, status.Error(codes.PermissionDenied, err.Error()))
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	if userLimiter != nil && !userLimiter.allow(username, time.Now()) {
+		http.Error(w, "rate limit exceeded", http.StatusTooManyRequests)
+		return
+	}
+	if err = lh.h.checkAccount(username); errors.Is(err, BannedErr) {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusGone)
+		return
+	}
+	if lh.concurrency != nil {
+		release, err := lh.concurrency.acquire(username)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusTooManyRequests)
+			return
+		}
+		defer release()
+	}
+
+	err = lh.serveFile(w, r, username, filePath)
+	if lh.audit != nil {
+		lh.audit.record(r.Context(), username, AuditRead, filePath, err)
+	}
+}
+
+// serveFile responds with the file of the user at the path, with support for
+// range requests if the store can seek in it.
+func (lh *linkHandler) serveFile(w http.ResponseWriter, r *http.Request,
+	username, filePath string) error {
+	s, err := lh.h.newStore(lh.h.storageDir, username)
+	if err != nil {
+		writeLinkError(w, r, username, filePath, err)
+		return err
+	}
+	modified, err := s.GetLastModified(filePath)
+	if err != nil {
+		writeLinkError(w, r, username, filePath, err)
+		return err
+	}
+	f, size, err := store.Open(s, filePath)
+	if err != nil {
+		writeLinkError(w, r, username, filePath, err)
+		return err
+	}
+	defer func() { _ = f.Close() }()
+
+	name := path.Base(filePath)
+	w.Header().Set("Content-Disposition",
+		`attachment; filename="`+strings.ReplaceAll(name, `"`, "")+`"`)
+	if rs, ok := f.(io.ReadSeeker); ok {
+		http.ServeContent(w, r, name, modified, rs)
+		return nil
+	}
+	w.Header().Set("Content-Type", restDataContentType)
+	w.Header().Set("Content-Length", strconv.FormatInt(size, 10))
+	w.Header().Set("Last-Modified", modified.UTC().Format(http.TimeFormat))
+	if r.Method == http.MethodHead {
+		return nil
+	}
+	_, err = copyFile(w, f)
+	return err
+}
+
+// writeLinkError responds to a download link whose file cannot be read with
+// 404 if it does not exist, 503 if the storage worker pool rejected the read,
+// and 500 otherwise.
+func writeLinkError(w http.ResponseWriter, r *http.Request,
+	username, filePath string, err error) {
+	if errors.Is(err, os.ErrNotExist) ||
+		errors.Is(err, store.NonLocalFileErr) ||
+		errors.Is(err, store.ReservedPathErr) {
+		http.NotFound(w, r)
+		return
+	} else if errors.Is(err, store.PoolFullErr) ||
+		errors.Is(err, store.OperationTimeoutErr) {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	jww.ERROR.Printf(
+		"Failed to serve %q of %q for link: %+v", filePath, username, err)
+	http.Error(w, http.StatusText(http.StatusInternalServerError),
+		http.StatusInternalServerError)
+}
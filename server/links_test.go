@@ -0,0 +1,334 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package server
+
+import (
+	"context"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+
+	pb "gitlab.com/elixxir/comms/mixmessages"
+	"gitlab.com/elixxir/remoteSyncServer/rpc"
+	"gitlab.com/elixxir/remoteSyncServer/store"
+)
+
+// testLinkKey is a key that is long enough to sign links with.
+const testLinkKey = "0123456789abcdef0123456789abcdef"
+
+// newTestLinks returns Links with the base URL and maximum TTL.
+func newTestLinks(t testing.TB, baseURL, maxTTL string) *Links {
+	links, err := NewLinks(map[string]interface{}{
+		"key": testLinkKey, "baseURL": baseURL, "maxTTL": maxTTL})
+	if err != nil {
+		t.Fatalf("Failed to create links: %+v", err)
+	}
+	return links
+}
+
+// newLinkTestHandler returns a linkHandler for a handler logged in as waldo,
+// whose files are kept in memory across requests, and the token of waldo.
+func newLinkTestHandler(t *testing.T) (*linkHandler, Token) {
+	ms, err := store.NewMemStore("", "waldo")
+	if err != nil {
+		t.Fatalf("Failed to create store: %+v", err)
+	}
+	return newLinkTestHandlerStore(t,
+		func(string, string) (store.Store, error) { return ms, nil })
+}
+
+// newLinkTestHandlerStore returns a linkHandler for a handler with stores
+// created by newStore logged in as waldo, and the token of waldo.
+func newLinkTestHandlerStore(
+	t testing.TB, newStore store.NewStore) (*linkHandler, Token) {
+	h, token, _ := newHandlerStoreLogin(time.Hour, "waldo", "hunter2",
+		rand.New(rand.NewSource(90)), newStore, t)
+	h.links = newTestLinks(t, "https://sync.example.com/", "1h")
+	return &linkHandler{h: h, links: h.links}, token
+}
+
+// serveLink serves a request for the link with the handler and returns the
+// response.
+func serveLink(
+	lh *linkHandler, method, link string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	lh.ServeHTTP(w, httptest.NewRequest(method, link, nil))
+	return w
+}
+
+// Tests that NewLinks decodes the parameters, defaults the maximum TTL, and
+// removes the trailing slash of the base URL.
+func TestNewLinks(t *testing.T) {
+	links, err := NewLinks(map[string]interface{}{
+		"key": testLinkKey, "baseURL": "https://sync.example.com/rss/"})
+	if err != nil {
+		t.Fatalf("Failed to create links: %+v", err)
+	}
+	expected := LinksParams{Key: testLinkKey,
+		BaseURL: "https://sync.example.com/rss/", MaxTTL: defaultMaxLinkTTL}
+	if links.Params() != expected {
+		t.Errorf("Unexpected parameters.\nexpected: %+v\nreceived: %+v",
+			expected, links.Params())
+	}
+	if links.baseURL != "https://sync.example.com/rss" {
+		t.Errorf("Unexpected base URL: %q", links.baseURL)
+	}
+}
+
+// Error path: Tests that NewLinks returns an error for unknown parameters, a
+// short key, a maximum TTL that is not positive, and invalid base URLs.
+func TestNewLinks_Error(t *testing.T) {
+	tests := []map[string]interface{}{
+		{"key": testLinkKey, "baseURL": "https://a.com", "unknown": 1},
+		{"key": "short", "baseURL": "https://a.com"},
+		{"key": testLinkKey, "baseURL": "https://a.com", "maxTTL": "0s"},
+		{"key": testLinkKey},
+		{"key": testLinkKey, "baseURL": "ftp://a.com"},
+		{"key": testLinkKey, "baseURL": "https:///path"},
+		{"key": testLinkKey, "baseURL": "https://a.com?x=1"},
+	}
+	for i, params := range tests {
+		if _, err := NewLinks(params); err == nil {
+			t.Errorf("No error for parameters %+v (%d).", params, i)
+		}
+	}
+}
+
+// Tests that CheckLinks only returns an error if links are enabled and no
+// listener serves REST.
+func TestCheckLinks(t *testing.T) {
+	links := newTestLinks(t, "https://sync.example.com", "1h")
+	rest := []Listener{{Protocols: []string{ProtocolREST}}}
+	grpc := []Listener{{Protocols: []string{ProtocolGRPC}}}
+	if err := CheckLinks(nil, grpc); err != nil {
+		t.Errorf("Error without links: %+v", err)
+	}
+	if err := CheckLinks(links, rest); err != nil {
+		t.Errorf("Error with a REST listener: %+v", err)
+	}
+	if err := CheckLinks(links, grpc); err == nil {
+		t.Errorf("No error without a REST listener.")
+	}
+}
+
+// Tests that Links.ttl returns the requested duration, the default for zero,
+// and the maximum for zero if it is shorter than the default.
+func TestLinks_ttl(t *testing.T) {
+	links := newTestLinks(t, "https://sync.example.com", "2h")
+	tests := map[int64]time.Duration{
+		0:    defaultLinkTTL,
+		1:    time.Second,
+		7200: 2 * time.Hour,
+	}
+	for seconds, expected := range tests {
+		if ttl, err := links.ttl(seconds); err != nil {
+			t.Errorf("Failed to get TTL for %ds: %+v", seconds, err)
+		} else if ttl != expected {
+			t.Errorf("Unexpected TTL for %ds.\nexpected: %s\nreceived: %s",
+				seconds, expected, ttl)
+		}
+	}
+
+	short := newTestLinks(t, "https://sync.example.com", "5m")
+	if ttl, _ := short.ttl(0); ttl != 5*time.Minute {
+		t.Errorf("Unexpected default TTL.\nexpected: %s\nreceived: %s",
+			5*time.Minute, ttl)
+	}
+}
+
+// Error path: Tests that Links.ttl returns InvalidLinkTTLErr for negative
+// durations and those longer than the maximum.
+func TestLinks_ttl_Error(t *testing.T) {
+	links := newTestLinks(t, "https://sync.example.com", "2h")
+	for _, seconds := range []int64{-1, 7201} {
+		if _, err := links.ttl(seconds); !errors.Is(err, InvalidLinkTTLErr) {
+			t.Errorf("Unexpected error for %ds.\nexpected: %v\nreceived: %+v",
+				seconds, InvalidLinkTTLErr, err)
+		}
+	}
+}
+
+// Tests that Links.verify returns the user and path of a link made by
+// Links.url, including for paths that must be escaped.
+func TestLinks_url_verify(t *testing.T) {
+	links := newTestLinks(t, "https://sync.example.com/rss", "1h")
+	now := time.Unix(1700000000, 0)
+	link := links.url("waldo", "/photos/my cat?.jpg", now.Add(time.Minute))
+	if !strings.HasPrefix(link, "https://sync.example.com/rss/links/photos/") {
+		t.Errorf("Unexpected link: %s", link)
+	}
+
+	u, err := url.Parse(link)
+	if err != nil {
+		t.Fatalf("Failed to parse link %q: %+v", link, err)
+	}
+	u.Path = strings.TrimPrefix(u.Path, "/rss")
+	username, filePath, err := links.verify(u, now)
+	if err != nil {
+		t.Fatalf("Failed to verify link: %+v", err)
+	}
+	if username != "waldo" || filePath != "photos/my cat?.jpg" {
+		t.Errorf("Unexpected user and path.\nexpected: %q %q"+
+			"\nreceived: %q %q", "waldo", "photos/my cat?.jpg", username,
+			filePath)
+	}
+}
+
+// Error path: Tests that Links.verify returns InvalidLinkErr for links that
+// were altered, are malformed, or were signed with another key, and
+// LinkExpiredErr for expired links.
+func TestLinks_verify_Error(t *testing.T) {
+	links := newTestLinks(t, "https://sync.example.com", "1h")
+	other, _ := NewLinks(map[string]interface{}{
+		"key":     strings.Repeat("x", minLinkKeyLen),
+		"baseURL": "https://sync.example.com"})
+	now := time.Unix(1700000000, 0)
+	expires := now.Add(time.Minute)
+	valid := links.url("waldo", "file", expires)
+
+	tests := map[string]error{
+		strings.Replace(valid, "/file?", "/other?", 1):       InvalidLinkErr,
+		strings.Replace(valid, "user=waldo", "user=fred", 1): InvalidLinkErr,
+		strings.Replace(valid, "expires=", "expires=1", 1):   InvalidLinkErr,
+		strings.Replace(valid, "expires=", "expires=x", 1):   InvalidLinkErr,
+		other.url("waldo", "file", expires):                  InvalidLinkErr,
+		links.url("waldo", "file", now):                      LinkExpiredErr,
+	}
+	for link, expected := range tests {
+		u, _ := url.Parse(link)
+		if _, _, err := links.verify(u, now); !errors.Is(err, expected) {
+			t.Errorf("Unexpected error for %s.\nexpected: %v\nreceived: %+v",
+				link, expected, err)
+		}
+	}
+}
+
+// Tests that a link created with handler.CreateLink is served by linkHandler
+// with the data of the file.
+func Test_handler_CreateLink(t *testing.T) {
+	lh, token := newLinkTestHandler(t)
+	data := []byte("meow")
+	_, err := lh.h.Write(context.Background(), &pb.RsWriteRequest{
+		Path: "photos/cat.jpg", Data: data, Token: token.Marshal()})
+	if err != nil {
+		t.Fatalf("Failed to write file: %+v", err)
+	}
+
+	resp, err := lh.h.CreateLink(context.Background(),
+		&rpc.RsCreateLinkRequest{Token: token.Marshal(),
+			Path: "photos/cat.jpg", TTL: 60})
+	if err != nil {
+		t.Fatalf("Failed to create link: %+v", err)
+	}
+	expires := time.Unix(0, resp.GetExpires())
+	if d := time.Until(expires); d <= 58*time.Second || d > time.Minute {
+		t.Errorf("Unexpected expiry %s.", expires)
+	}
+
+	w := serveLink(lh, http.MethodGet, resp.GetURL())
+	if w.Code != http.StatusOK || w.Body.String() != string(data) {
+		t.Errorf("Unexpected response.\nexpected: %d %q\nreceived: %d %q",
+			http.StatusOK, data, w.Code, w.Body.String())
+	}
+	if cd := w.Header().Get("Content-Disposition"); cd !=
+		`attachment; filename="cat.jpg"` {
+		t.Errorf("Unexpected Content-Disposition: %q", cd)
+	}
+
+	w = serveLink(lh, http.MethodHead, resp.GetURL())
+	if w.Code != http.StatusOK || w.Body.Len() != 0 ||
+		w.Header().Get("Content-Length") != "4" {
+		t.Errorf("Unexpected HEAD response: %d %v", w.Code, w.Header())
+	}
+}
+
+// Error path: Tests that handler.CreateLink returns LinksDisabledErr without
+// links, InvalidLinkTTLErr for a TTL over the maximum, and os.ErrNotExist for
+// a file that does not exist.
+func Test_handler_CreateLink_Error(t *testing.T) {
+	lh, token := newLinkTestHandler(t)
+	_, _ = lh.h.Write(context.Background(), &pb.RsWriteRequest{
+		Path: "file", Data: []byte("data"), Token: token.Marshal()})
+
+	_, err := lh.h.CreateLink(context.Background(), &rpc.RsCreateLinkRequest{
+		Token: token.Marshal(), Path: "file", TTL: 3601})
+	if !errors.Is(err, InvalidLinkTTLErr) {
+		t.Errorf("Unexpected error for long TTL.\nexpected: %v"+
+			"\nreceived: %+v", InvalidLinkTTLErr, err)
+	}
+	_, err = lh.h.CreateLink(context.Background(), &rpc.RsCreateLinkRequest{
+		Token: token.Marshal(), Path: "missing"})
+	if !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Unexpected error for missing file.\nexpected: %v"+
+			"\nreceived: %+v", os.ErrNotExist, err)
+	}
+
+	lh.h.links = nil
+	_, err = lh.h.CreateLink(context.Background(), &rpc.RsCreateLinkRequest{
+		Token: token.Marshal(), Path: "file"})
+	if !errors.Is(err, LinksDisabledErr) {
+		t.Errorf("Unexpected error without links.\nexpected: %v"+
+			"\nreceived: %+v", LinksDisabledErr, err)
+	}
+}
+
+// Error path: Tests that linkHandler rejects methods other than GET and HEAD,
+// invalid and expired links, and links to files that no longer exist.
+func Test_linkHandler_ServeHTTP_Error(t *testing.T) {
+	lh, _ := newLinkTestHandler(t)
+	link := lh.links.url("waldo", "missing", time.Now().Add(time.Minute))
+	tests := []struct {
+		method, link string
+		code         int
+	}{
+		{http.MethodPut, link, http.StatusMethodNotAllowed},
+		{http.MethodGet, link, http.StatusNotFound},
+		{http.MethodGet, strings.Replace(link, "missing", "other", 1),
+			http.StatusForbidden},
+		{http.MethodGet, lh.links.url("waldo", "missing",
+			time.Now().Add(-time.Second)), http.StatusGone},
+	}
+	for i, tt := range tests {
+		if w := serveLink(lh, tt.method, tt.link); w.Code != tt.code {
+			t.Errorf("Unexpected status for %s %s (%d).\nexpected: %d"+
+				"\nreceived: %d", tt.method, tt.link, i, tt.code, w.Code)
+		}
+	}
+}
+
+// Benchmarks linkHandler.ServeHTTP serving a large file of the local
+// filesystem by streaming it and by reading it into memory.
+func Benchmark_linkHandler_ServeHTTP(b *testing.B) {
+	for _, bs := range benchmarkStores {
+		b.Run(bs.name, func(b *testing.B) {
+			lh, _ := newLinkTestHandlerStore(
+				b, newBenchmarkStore(b, bs.streaming))
+			link := lh.links.url("waldo", "large", time.Now().Add(time.Hour))
+			r := httptest.NewRequest(http.MethodGet, link, nil)
+
+			b.ReportAllocs()
+			b.SetBytes(benchmarkFileSize)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				w := newDiscardResponseWriter()
+				lh.ServeHTTP(w, r)
+				if w.code != http.StatusOK {
+					b.Fatalf("Unexpected status.\nexpected: %d\nreceived: %d",
+						http.StatusOK, w.code)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,306 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package server
+
+import (
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/improbable-eng/grpc-web/go/grpcweb"
+	"github.com/pkg/errors"
+	"google.golang.org/grpc"
+)
+
+// Protocols that can be served on a listener.
+const (
+	// ProtocolGRPC is native gRPC over HTTP/2.
+	ProtocolGRPC = "grpc"
+
+	// ProtocolGRPCWeb is gRPC-web, used by browsers.
+	ProtocolGRPCWeb = "grpc-web"
+
+	// ProtocolREST is JSON over HTTP, served by restHandler.
+	ProtocolREST = "rest"
+
+	// ProtocolWebDAV is WebDAV under webdavPathPrefix, served by
+	// webdavHandler.
+	ProtocolWebDAV = "webdav"
+)
+
+// defaultListenerHost is the host listened on when a listener has no address.
+const defaultListenerHost = "0.0.0.0"
+
+// DefaultProtocols are served on a listener that does not specify any.
+var DefaultProtocols = []string{ProtocolGRPC, ProtocolGRPCWeb}
+
+// ListenerParams contains the parameters of an entry in the listeners section
+// of the config.
+type ListenerParams struct {
+	// Address is the IP address or hostname of the interface to listen on.
+	// Defaults to 0.0.0.0.
+	Address string `mapstructure:"address"`
+
+	// Port is the port to listen on.
+	Port int `mapstructure:"port"`
+
+	// Protocol is the protocol to serve, or several separated by commas.
+	// Defaults to DefaultProtocols.
+	Protocol string `mapstructure:"protocol"`
+
+	// TLSMinVersion and TLSCipherSuites override the server's TLS settings on
+	// this listener. See NewTLSSettings.
+	TLSMinVersion   string   `mapstructure:"tlsMinVersion"`
+	TLSCipherSuites []string `mapstructure:"tlsCipherSuites"`
+
+	// Compression is the algorithm that responses are compressed with, or
+	// several separated by commas in the order they are preferred. Defaults to
+	// no compression. See ParseCompression.
+	Compression string `mapstructure:"compression"`
+}
+
+// Listener is an address that the server listens on, with the protocols served
+// there.
+type Listener struct {
+	// Address is the host and port to listen on.
+	Address string
+
+	// Protocols are the protocols served on the listener.
+	Protocols []string
+
+	// TLSSettings override the server's TLS settings on the listener if not
+	// nil.
+	TLSSettings *TLSSettings
+
+	// Compression are the algorithms that responses are compressed with, in
+	// the order they are preferred, and that compressed HTTP requests are
+	// accepted in.
+	Compression []string
+
+	// Listener is served on instead of listening on Address if not nil, such
+	// as a socket passed by systemd socket activation.
+	Listener net.Listener
+}
+
+// NewListeners decodes a list of ListenerParams into Listeners. Returns an
+// error if a port or protocol is invalid or two listeners have the same
+// address.
+func NewListeners(params interface{}) ([]Listener, error) {
+	var ps []ListenerParams
+	if err := decodeParams(params, &ps, "listener"); err != nil {
+		return nil, err
+	}
+	if len(ps) == 0 {
+		return nil, errors.New("at least one listener is required")
+	}
+
+	listeners := make([]Listener, 0, len(ps))
+	addresses := make(map[string]bool, len(ps))
+	for i, p := range ps {
+		l, err := newListener(p)
+		if err != nil {
+			return nil, errors.WithMessagef(err, "listener %d", i)
+		} else if addresses[l.Address] {
+			return nil, errors.Errorf(
+				"listener %d: duplicate address %s", i, l.Address)
+		}
+		addresses[l.Address] = true
+		listeners = append(listeners, l)
+	}
+
+	return listeners, nil
+}
+
+// newListener returns the Listener for the parameters.
+func newListener(p ListenerParams) (Listener, error) {
+	if p.Port < 1 || p.Port > 65535 {
+		return Listener{}, errors.Errorf(
+			"port %d must be between 1 and 65535", p.Port)
+	}
+	host := strings.TrimSuffix(strings.TrimPrefix(p.Address, "["), "]")
+	if host == "" {
+		host = defaultListenerHost
+	}
+
+	protocols, err := ParseProtocols(p.Protocol)
+	if err != nil {
+		return Listener{}, err
+	}
+
+	var tlsSettings *TLSSettings
+	if p.TLSMinVersion != "" || len(p.TLSCipherSuites) > 0 {
+		tlsSettings, err = NewTLSSettings(p.TLSMinVersion, p.TLSCipherSuites)
+		if err != nil {
+			return Listener{}, err
+		}
+	}
+
+	compression, err := ParseCompression(p.Compression)
+	if err != nil {
+		return Listener{}, err
+	}
+
+	return Listener{
+		Address:     net.JoinHostPort(host, strconv.Itoa(p.Port)),
+		Protocols:   protocols,
+		TLSSettings: tlsSettings,
+		Compression: compression,
+	}, nil
+}
+
+// ParseProtocols parses a protocol or several separated by commas. An empty
+// string returns DefaultProtocols.
+func ParseProtocols(protocols string) ([]string, error) {
+	if strings.TrimSpace(protocols) == "" {
+		return DefaultProtocols, nil
+	}
+
+	var parsed []string
+	for _, protocol := range strings.Split(protocols, ",") {
+		protocol = strings.ToLower(strings.TrimSpace(protocol))
+		switch protocol {
+		case ProtocolGRPC, ProtocolGRPCWeb, ProtocolREST, ProtocolWebDAV:
+			parsed = append(parsed, protocol)
+		default:
+			return nil, errors.Errorf("unknown protocol %q (available: %s, "+
+				"%s, %s, %s)", protocol, ProtocolGRPC, ProtocolGRPCWeb,
+				ProtocolREST, ProtocolWebDAV)
+		}
+	}
+	return parsed, nil
+}
+
+// Serves returns true if the protocol is served on the listener.
+func (l Listener) Serves(protocol string) bool {
+	for _, p := range l.Protocols {
+		if p == protocol {
+			return true
+		}
+	}
+	return false
+}
+
+// isDefault returns true if the listener serves DefaultProtocols with the
+// server's TLS settings on its own address without compression, as comms does.
+func (l Listener) isDefault() bool {
+	return l.Listener == nil && l.TLSSettings == nil &&
+		len(l.Compression) == 0 && len(l.Protocols) == len(DefaultProtocols) &&
+		l.Serves(ProtocolGRPC) && l.Serves(ProtocolGRPCWeb)
+}
+
+// description returns the protocols served on the listener for logging.
+func (l Listener) description() string {
+	names := map[string]string{
+		ProtocolGRPC:    "gRPC",
+		ProtocolGRPCWeb: "gRPC-web",
+		ProtocolREST:    "REST",
+		ProtocolWebDAV:  "WebDAV",
+	}
+	described := make([]string, len(l.Protocols))
+	for i, protocol := range l.Protocols {
+		described[i] = names[protocol]
+	}
+	return strings.Join(described, " and ")
+}
+
+// handler returns a handler that passes requests for the protocols served on
+// the listener to the gRPC server, the gRPC-web wrapper, the WebDAV handler,
+// the download link handler, or the REST handler and rejects all others. REST
+// requests are limited by limits if not nil, and their failures before they
+// are served as RPCs are recorded by autoBan if not nil. WebDAV requests are
+// those under webdavPathPrefix, and download links, which are served with REST,
+// are those under linkPathPrefix. If the listener has compression algorithms,
+// native gRPC responses are compressed by the gRPC server and those of the
+// other protocols by a compressionHandler. If webSecurity is not nil, REST and
+// download link requests are only allowed cross-origin from its origins.
+func (l Listener) handler(grpcServer *grpc.Server,
+	webServer *grpcweb.WrappedGrpcServer, dav, links http.Handler,
+	limits *Limits, autoBan *AutoBan, webSecurity *WebSecurity) http.Handler {
+	grpcOn, webOn, restOn := l.Serves(ProtocolGRPC),
+		l.Serves(ProtocolGRPCWeb), l.Serves(ProtocolREST)
+	davOn := l.Serves(ProtocolWebDAV) && dav != nil
+	linksOn := restOn && links != nil
+	web := http.Handler(webServer)
+	rest := http.Handler(&restHandler{
+		grpcServer: grpcServer, limits: limits, autoBan: autoBan})
+	if len(l.Compression) > 0 {
+		web = &compressionHandler{algorithms: l.Compression, next: web}
+		rest = &compressionHandler{algorithms: l.Compression, next: rest}
+		if davOn {
+			dav = &compressionHandler{algorithms: l.Compression, next: dav}
+		}
+		if linksOn {
+			links = &compressionHandler{algorithms: l.Compression, next: links}
+		}
+	}
+	rest = webSecurity.cors(rest)
+	if linksOn {
+		links = webSecurity.cors(links)
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case webServer.IsGrpcWebRequest(r) ||
+			webServer.IsAcceptableGrpcCorsRequest(r) ||
+			webServer.IsGrpcWebSocketRequest(r):
+			if webOn {
+				web.ServeHTTP(w, r)
+				return
+			}
+		case r.ProtoMajor == 2 &&
+			strings.HasPrefix(r.Header.Get("Content-Type"), grpcContentType):
+			if grpcOn {
+				grpcServer.ServeHTTP(w, withCompression(r, l.Compression))
+				return
+			}
+		case r.URL.Path == webdavPathPrefix ||
+			strings.HasPrefix(r.URL.Path, webdavPathPrefix+"/"):
+			if davOn {
+				dav.ServeHTTP(w, r)
+				return
+			}
+		case strings.HasPrefix(r.URL.Path, linkPathPrefix+"/"):
+			if linksOn {
+				links.ServeHTTP(w, r)
+				return
+			}
+		case restOn:
+			rest.ServeHTTP(w, r)
+			return
+		}
+		http.NotFound(w, r)
+	})
+}
+
+// listen listens with the function on the address of each listener that has
+// no listener yet. If any of them fails, the listeners already opened are
+// closed.
+func listen(listeners []Listener, listenTCP listenFunc) ([]net.Listener, error) {
+	opened := make([]net.Listener, 0, len(listeners))
+	for _, l := range listeners {
+		if l.Listener != nil {
+			opened = append(opened, l.Listener)
+			continue
+		}
+		nl, err := listenTCP(l.Address)
+		if err != nil {
+			closeListeners(opened)
+			return nil, errors.Wrapf(err, "failed to listen on %s", l.Address)
+		}
+		opened = append(opened, nl)
+	}
+	return opened, nil
+}
+
+// closeListeners closes all the listeners.
+func closeListeners(listeners []net.Listener) {
+	for _, l := range listeners {
+		_ = l.Close()
+	}
+}
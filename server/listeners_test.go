@@ -0,0 +1,196 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package server
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/improbable-eng/grpc-web/go/grpcweb"
+	"google.golang.org/grpc"
+
+	"gitlab.com/elixxir/remoteSyncServer/rpc"
+)
+
+// Tests that NewListeners decodes each entry with its defaults, protocols, and
+// TLS settings.
+func TestNewListeners(t *testing.T) {
+	params := []interface{}{
+		map[string]interface{}{"port": 22840},
+		map[string]interface{}{
+			"address":       "127.0.0.1",
+			"port":          "8443",
+			"protocol":      "grpc-web, REST",
+			"tlsMinVersion": "1.3",
+			"compression":   "zstd,gzip",
+		},
+		map[string]interface{}{
+			"address":  "[::1]",
+			"port":     22840,
+			"protocol": "grpc",
+		},
+	}
+	listeners, err := NewListeners(params)
+	if err != nil {
+		t.Fatalf("Failed to decode listeners: %+v", err)
+	}
+
+	expected := []Listener{
+		{Address: "0.0.0.0:22840", Protocols: DefaultProtocols},
+		{
+			Address:     "127.0.0.1:8443",
+			Protocols:   []string{ProtocolGRPCWeb, ProtocolREST},
+			TLSSettings: &TLSSettings{MinVersion: tls.VersionTLS13},
+			Compression: []string{CompressionZstd, CompressionGzip},
+		},
+		{Address: "[::1]:22840", Protocols: []string{ProtocolGRPC}},
+	}
+	if !reflect.DeepEqual(expected, listeners) {
+		t.Errorf("Unexpected listeners.\nexpected: %+v\nreceived: %+v",
+			expected, listeners)
+	}
+}
+
+// Error path: Tests that NewListeners returns an error for invalid entries.
+func TestNewListeners_Error(t *testing.T) {
+	entry := func(pairs ...interface{}) map[string]interface{} {
+		m := make(map[string]interface{})
+		for i := 0; i < len(pairs); i += 2 {
+			m[pairs[i].(string)] = pairs[i+1]
+		}
+		return m
+	}
+	tests := map[string]interface{}{
+		"none":          []interface{}{},
+		"not a list":    "22840",
+		"no port":       []interface{}{entry()},
+		"invalid port":  []interface{}{entry("port", 70000)},
+		"unknown key":   []interface{}{entry("prt", 22840)},
+		"bad protocol":  []interface{}{entry("port", 1, "protocol", "http")},
+		"bad TLS":       []interface{}{entry("port", 1, "tlsMinVersion", "0.9")},
+		"bad algorithm": []interface{}{entry("port", 1, "compression", "br")},
+		"duplicate":     []interface{}{entry("port", 1), entry("port", 1)},
+		"wrong element": []interface{}{"22840"},
+	}
+	for name, params := range tests {
+		if _, err := NewListeners(params); err == nil {
+			t.Errorf("Failed to get error for %s.", name)
+		}
+	}
+}
+
+// Tests that ParseProtocols returns DefaultProtocols for an empty string and
+// the protocols in order otherwise.
+func TestParseProtocols(t *testing.T) {
+	tests := map[string][]string{
+		"":               DefaultProtocols,
+		" ":              DefaultProtocols,
+		"rest":           {ProtocolREST},
+		"rest, WebDAV":   {ProtocolREST, ProtocolWebDAV},
+		"GRPC,grpc-web ": {ProtocolGRPC, ProtocolGRPCWeb},
+	}
+	for protocols, expected := range tests {
+		parsed, err := ParseProtocols(protocols)
+		if err != nil {
+			t.Errorf("Failed to parse %q: %+v", protocols, err)
+		} else if !reflect.DeepEqual(expected, parsed) {
+			t.Errorf("Unexpected protocols for %q.\nexpected: %v\nreceived: %v",
+				protocols, expected, parsed)
+		}
+	}
+
+	if _, err := ParseProtocols("grpc,websocket"); err == nil {
+		t.Errorf("Failed to get error for unknown protocol.")
+	}
+}
+
+// Tests that Listener.isDefault is only true for a listener that comms can
+// serve.
+func TestListener_isDefault(t *testing.T) {
+	tests := []struct {
+		l        Listener
+		expected bool
+	}{
+		{Listener{Protocols: DefaultProtocols}, true},
+		{Listener{Protocols: []string{ProtocolGRPCWeb, ProtocolGRPC}}, true},
+		{Listener{Protocols: []string{ProtocolGRPC}}, false},
+		{Listener{Protocols: []string{
+			ProtocolGRPC, ProtocolGRPCWeb, ProtocolREST}}, false},
+		{Listener{
+			Protocols: DefaultProtocols, TLSSettings: &TLSSettings{}}, false},
+		{Listener{Protocols: DefaultProtocols,
+			Compression: []string{CompressionGzip}}, false},
+	}
+	for i, tt := range tests {
+		if tt.l.isDefault() != tt.expected {
+			t.Errorf("Unexpected result for listener %d %+v."+
+				"\nexpected: %t\nreceived: %t",
+				i, tt.l, tt.expected, tt.l.isDefault())
+		}
+	}
+}
+
+// Tests that Listener.handler only serves requests of the protocols of the
+// listener and responds 404 to all others.
+func TestListener_handler(t *testing.T) {
+	grpcServer := grpc.NewServer()
+	rpc.RegisterInfoServer(grpcServer,
+		&infoEndpoints{version: &rpc.RsGetVersionResponse{Version: "1.2.3"}})
+	webServer := grpcweb.WrapServer(grpcServer)
+
+	dav := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusMultiStatus)
+	})
+
+	newRequest := func(contentType string) *http.Request {
+		r := httptest.NewRequest(http.MethodPost,
+			"/remoteSync.Info/GetVersion", strings.NewReader("{}"))
+		r.Header.Set("Content-Type", contentType)
+		return r
+	}
+	davRequest := httptest.NewRequest("PROPFIND", webdavPathPrefix+"/a", nil)
+	links := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+	})
+	linkRequest := httptest.NewRequest(http.MethodGet, linkPathPrefix+"/a", nil)
+	tests := []struct {
+		protocols []string
+		request   *http.Request
+		expected  int
+	}{
+		{[]string{ProtocolREST}, newRequest(restContentType), http.StatusOK},
+		{DefaultProtocols, newRequest(restContentType), http.StatusNotFound},
+		{[]string{ProtocolGRPC},
+			newRequest("application/grpc-web+proto"), http.StatusNotFound},
+		{[]string{ProtocolGRPC, ProtocolREST},
+			newRequest("application/grpc-web+proto"), http.StatusNotFound},
+		{[]string{ProtocolGRPCWeb},
+			newRequest("application/grpc-web+proto"), http.StatusOK},
+		{[]string{ProtocolWebDAV}, davRequest, http.StatusMultiStatus},
+		{[]string{ProtocolREST}, davRequest, http.StatusNotFound},
+		{[]string{ProtocolWebDAV}, newRequest(restContentType),
+			http.StatusNotFound},
+		{[]string{ProtocolREST}, linkRequest, http.StatusAccepted},
+		{[]string{ProtocolWebDAV}, linkRequest, http.StatusNotFound},
+	}
+	for i, tt := range tests {
+		w := httptest.NewRecorder()
+		l := Listener{Protocols: tt.protocols}
+		l.handler(grpcServer, webServer, dav, links, nil, nil, nil).ServeHTTP(
+			w, tt.request)
+		if w.Code != tt.expected {
+			t.Errorf("Unexpected status for request %d to %v."+
+				"\nexpected: %d\nreceived: %d",
+				i, tt.protocols, tt.expected, w.Code)
+		}
+	}
+}
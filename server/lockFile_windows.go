@@ -0,0 +1,41 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package server
+
+import (
+	"math"
+	"os"
+
+	"github.com/pkg/errors"
+	"golang.org/x/sys/windows"
+)
+
+// lockFile takes an exclusive lock on the open file, which is released when it
+// is closed. Returns LockedErr if another process holds the lock and wait is
+// false. Directories cannot be locked, so they are not.
+func lockFile(f *os.File, wait bool) error {
+	if info, err := f.Stat(); err != nil {
+		return err
+	} else if info.IsDir() {
+		return nil
+	}
+
+	flags := uint32(windows.LOCKFILE_EXCLUSIVE_LOCK)
+	if !wait {
+		flags |= windows.LOCKFILE_FAIL_IMMEDIATELY
+	}
+
+	// Locks on Windows prevent other processes from reading the locked bytes,
+	// so a byte far past the end of the file is locked instead of its contents
+	err := windows.LockFileEx(windows.Handle(f.Fd()), flags, 0, 1, 0,
+		&windows.Overlapped{OffsetHigh: math.MaxInt32})
+	if errors.Is(err, windows.ERROR_LOCK_VIOLATION) {
+		return LockedErr
+	}
+	return err
+}
@@ -0,0 +1,121 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"time"
+
+	jww "github.com/spf13/jwalterweatherman"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"gitlab.com/elixxir/remoteSyncServer/logging"
+)
+
+// requestIDHeader is the metadata key of the ID of a request. Clients may set
+// it to correlate their logs with the server's; otherwise, a random ID is
+// generated. It is returned in the response header.
+const requestIDHeader = "x-request-id"
+
+// requestIDKey is the context key of the ID of a request.
+type requestIDKey struct{}
+
+const (
+	// requestIDLen is the length, in bytes, of generated request IDs.
+	requestIDLen = 8
+
+	// maxRequestIDLen is the maximum length of a request ID set by a client.
+	maxRequestIDLen = 64
+)
+
+// logInterceptor returns an interceptor that assigns each RPC a request ID,
+// returns it in the response header and the context of later interceptors, and
+// logs the result of the RPC with the request ID, user, method, and latency.
+func logInterceptor(h *handler) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{},
+		info *grpc.UnaryServerInfo, next grpc.UnaryHandler) (interface{}, error) {
+		start := time.Now()
+		id := incomingRequestID(ctx)
+		_ = grpc.SetHeader(ctx, metadata.Pairs(requestIDHeader, id))
+		ctx = context.WithValue(ctx, requestIDKey{}, id)
+		username := requestUsername(h, req)
+
+		resp, err := next(ctx, req)
+
+		fields := logging.Fields{
+			Component: "rpc",
+			RequestID: id,
+			UserID:    username,
+			Method:    info.FullMethod,
+			Latency:   time.Since(start),
+		}
+		code := status.Code(err)
+		if code == codes.Unknown || code == codes.Internal {
+			fields.Printf(jww.WARN, "RPC failed: %s", code)
+		} else {
+			fields.Printf(jww.DEBUG, "RPC completed: %s", code)
+		}
+		return resp, err
+	}
+}
+
+// incomingRequestID returns the request ID set by the client in the metadata,
+// if it is valid, or a new random ID.
+func incomingRequestID(ctx context.Context) string {
+	md, _ := metadata.FromIncomingContext(ctx)
+	if ids := md.Get(requestIDHeader); len(ids) > 0 && validRequestID(ids[0]) {
+		return ids[0]
+	}
+
+	b := make([]byte, requestIDLen)
+	if _, err := rand.Read(b); err != nil {
+		jww.WARN.Printf("Failed to generate request ID: %+v", err)
+	}
+	return hex.EncodeToString(b)
+}
+
+// requestID returns the ID of the request with the context or an empty string
+// if it has none.
+func requestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// validRequestID returns true if the request ID is not empty or too long and
+// only contains letters, digits, hyphens, underscores, and periods, so that it
+// cannot forge log entries.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLen {
+		return false
+	}
+	for _, c := range id {
+		if !('a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' ||
+			'0' <= c && c <= '9' || c == '-' || c == '_' || c == '.') {
+			return false
+		}
+	}
+	return true
+}
+
+// requestUsername returns the user making the request: the user of the session
+// of the token or the username of a login or registration request. Returns an
+// empty string for other requests.
+func requestUsername(h *handler, req interface{}) string {
+	if msg, ok := req.(interface{ GetToken() []byte }); ok {
+		username, _ := h.sessionUsername(UnmarshalToken(msg.GetToken()))
+		return username
+	} else if msg, ok := req.(interface{ GetUsername() string }); ok {
+		return msg.GetUsername()
+	}
+	return ""
+}
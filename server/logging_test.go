@@ -0,0 +1,76 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package server
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/metadata"
+
+	pb "gitlab.com/elixxir/comms/mixmessages"
+	"gitlab.com/elixxir/remoteSyncServer/credentials"
+	"gitlab.com/elixxir/remoteSyncServer/rpc"
+	"gitlab.com/elixxir/remoteSyncServer/store"
+)
+
+// Tests that incomingRequestID uses a valid request ID from the metadata and
+// generates a new one otherwise.
+func Test_incomingRequestID(t *testing.T) {
+	ctx := metadata.NewIncomingContext(context.Background(),
+		metadata.Pairs(requestIDHeader, "client-42.a_b"))
+	if id := incomingRequestID(ctx); id != "client-42.a_b" {
+		t.Errorf("Unexpected request ID.\nexpected: %s\nreceived: %s",
+			"client-42.a_b", id)
+	}
+
+	for _, invalid := range []string{
+		"", "with space", "line\nbreak", strings.Repeat("a", 65)} {
+		ctx = metadata.NewIncomingContext(context.Background(),
+			metadata.Pairs(requestIDHeader, invalid))
+		id := incomingRequestID(ctx)
+		if id == invalid || len(id) != 2*requestIDLen {
+			t.Errorf("Unexpected request ID for %q: %q", invalid, id)
+		}
+	}
+
+	if incomingRequestID(context.Background()) ==
+		incomingRequestID(context.Background()) {
+		t.Errorf("Generated request IDs are not unique.")
+	}
+}
+
+// Tests that requestUsername returns the user of the session of the token or
+// the username of the request.
+func Test_requestUsername(t *testing.T) {
+	h := newHandler("", time.Hour, credentials.NewMemStore(
+		map[string]string{"waldo": "hunter2"}), nil, store.NewMemStore)
+	session, err := h.addSession("waldo")
+	if err != nil {
+		t.Fatalf("Failed to add session: %+v", err)
+	}
+	token := Token(session.Value)
+
+	tests := []struct {
+		req      interface{}
+		expected string
+	}{
+		{&pb.RsReadRequest{Token: token.Marshal()}, "waldo"},
+		{&pb.RsReadRequest{Token: []byte("unknown")}, ""},
+		{&rpc.RsPasswordLoginRequest{Username: "fred"}, "fred"},
+		{&rpc.RsGetVersionRequest{}, ""},
+	}
+	for i, tt := range tests {
+		if username := requestUsername(h, tt.req); username != tt.expected {
+			t.Errorf("Unexpected username for request %d."+
+				"\nexpected: %q\nreceived: %q", i, tt.expected, username)
+		}
+	}
+}
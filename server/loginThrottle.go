@@ -0,0 +1,507 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package server
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	jww "github.com/spf13/jwalterweatherman"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"gitlab.com/elixxir/remoteSyncServer/rpc"
+)
+
+var (
+	// LoginThrottledErr is returned, with the RESOURCE_EXHAUSTED code, for
+	// logins to an account that must wait after too many failed logins.
+	LoginThrottledErr = errors.New("too many failed logins for the account")
+
+	// AccountLockedErr is returned, with the PERMISSION_DENIED code, for
+	// logins to an account that is locked for too many failed logins.
+	AccountLockedErr = errors.New(
+		"account is locked for too many failed logins")
+)
+
+// loginAbortedErr is recorded for a login whose handler did not return, which
+// ends it without counting a failure.
+var loginAbortedErr = errors.New("login did not complete")
+
+// Default login throttling parameters.
+const (
+	defaultFreeLoginFailures = 3
+	defaultLoginBaseDelay    = time.Second
+	defaultLoginMaxDelay     = 5 * time.Minute
+	defaultLockoutDuration   = 15 * time.Minute
+	defaultLoginResetAfter   = time.Hour
+	defaultLoginMaxAccounts  = 100000
+)
+
+// loginPruneInterval is the shortest time between removing forgotten accounts
+// to make room for new ones, so that a flood of failed logins to new usernames
+// does not scan every account on each failure.
+const loginPruneInterval = time.Second
+
+// loginMethods are the full method names of the RPCs that log in with a
+// password, whose failures are counted for the account.
+var loginMethods = map[string]bool{
+	"/mixmessages.RemoteSync/Login":          true,
+	rpc.Session_PasswordLogin_FullMethodName: true,
+}
+
+// LoginThrottleParams are the parameters of the login throttling of each
+// account. They are set in the "loginThrottle" section of the config.
+type LoginThrottleParams struct {
+	// FreeFailures is the number of failed logins of an account before it
+	// must wait between logins. Defaults to 3.
+	FreeFailures int `mapstructure:"freeFailures"`
+
+	// BaseDelay is how long an account must wait to log in after its first
+	// failure beyond FreeFailures. The delay doubles with each further
+	// failure, up to MaxDelay. Defaults to one second.
+	BaseDelay time.Duration `mapstructure:"baseDelay"`
+
+	// MaxDelay is the longest an account must wait between logins. Defaults
+	// to 5 minutes.
+	MaxDelay time.Duration `mapstructure:"maxDelay"`
+
+	// LockoutFailures is the number of failed logins after which an account
+	// is locked for LockoutDuration. Zero disables lockouts. Defaults to 0.
+	LockoutFailures int `mapstructure:"lockoutFailures"`
+
+	// LockoutDuration is how long an account is locked for. Defaults to 15
+	// minutes.
+	LockoutDuration time.Duration `mapstructure:"lockoutDuration"`
+
+	// ResetAfter is how long after its last failed login the failures of an
+	// account are forgotten. Defaults to one hour.
+	ResetAfter time.Duration `mapstructure:"resetAfter"`
+
+	// MaxAccounts is the most accounts whose failures are counted at once, so
+	// that failed logins to any number of usernames cannot exhaust memory. The
+	// failures of other accounts are not counted until some are forgotten.
+	// Defaults to 100,000.
+	MaxAccounts int `mapstructure:"maxAccounts"`
+}
+
+// LoginThrottleStats are the statistics of login throttling.
+type LoginThrottleStats struct {
+	// Locked is the number of accounts currently locked.
+	Locked int
+
+	// Lockouts is the number of times any account was locked since the server
+	// started.
+	Lockouts uint64
+
+	// Untracked is the number of failed logins that were not counted since
+	// the server started because MaxAccounts accounts were already tracked.
+	Untracked uint64
+}
+
+// LoginThrottle counts the failed password logins of each account, whether or
+// not it exists, and makes accounts with too many failures wait between
+// logins, with a delay that doubles with each failure, and optionally locks
+// them for a while. A successful login resets the failures of its account.
+type LoginThrottle struct {
+	params LoginThrottleParams
+
+	// proxies resolve the client addresses of WebDAV requests, and audit
+	// records failed and rejected logins and lockouts. They are set by
+	// NewServer and may be nil.
+	proxies *TrustedProxies
+	audit   *AuditLog
+
+	// accounts are the failures and delays of the accounts with any, and
+	// lastPrune is when forgotten accounts were last removed to make room.
+	accounts  map[string]*loginState
+	lastPrune time.Time
+	lockouts  uint64
+	untracked uint64
+	mux       sync.Mutex
+}
+
+// loginState is the failed logins of an account, when it can log in next, and
+// the number of its logins in progress.
+type loginState struct {
+	failures    int
+	lastFailure time.Time
+	retryAt     time.Time
+	locked      bool
+	pending     int
+}
+
+// NewLoginThrottle creates a new LoginThrottle from the parameters. Returns an
+// error for unknown parameters, negative failure counts, delays that are not
+// positive or a maximum delay below the base delay, a lockout or reset
+// duration that is not positive, or a maximum number of accounts that is not
+// positive.
+func NewLoginThrottle(params map[string]interface{}) (*LoginThrottle, error) {
+	p := LoginThrottleParams{
+		FreeFailures:    defaultFreeLoginFailures,
+		BaseDelay:       defaultLoginBaseDelay,
+		MaxDelay:        defaultLoginMaxDelay,
+		LockoutDuration: defaultLockoutDuration,
+		ResetAfter:      defaultLoginResetAfter,
+		MaxAccounts:     defaultLoginMaxAccounts,
+	}
+	if err := decodeParams(params, &p, "login throttle"); err != nil {
+		return nil, err
+	}
+	if p.FreeFailures < 0 || p.LockoutFailures < 0 {
+		return nil, errors.Errorf("free failures %d and lockout failures %d "+
+			"cannot be negative", p.FreeFailures, p.LockoutFailures)
+	} else if p.BaseDelay <= 0 {
+		return nil, errors.Errorf("base delay %s must be positive", p.BaseDelay)
+	} else if p.MaxDelay < p.BaseDelay {
+		return nil, errors.Errorf("maximum delay %s cannot be less than the "+
+			"base delay %s", p.MaxDelay, p.BaseDelay)
+	} else if p.LockoutDuration <= 0 {
+		return nil, errors.Errorf(
+			"lockout duration %s must be positive", p.LockoutDuration)
+	} else if p.ResetAfter <= 0 {
+		return nil, errors.Errorf(
+			"reset after %s must be positive", p.ResetAfter)
+	} else if p.MaxAccounts <= 0 {
+		return nil, errors.Errorf(
+			"maximum accounts %d must be positive", p.MaxAccounts)
+	}
+
+	return &LoginThrottle{params: p, accounts: make(map[string]*loginState)},
+		nil
+}
+
+// Params returns the parameters of the login throttling.
+func (lt *LoginThrottle) Params() LoginThrottleParams {
+	return lt.params
+}
+
+// Stats returns the statistics of the login throttling at the given time.
+func (lt *LoginThrottle) Stats(now time.Time) LoginThrottleStats {
+	lt.mux.Lock()
+	defer lt.mux.Unlock()
+	stats := LoginThrottleStats{
+		Lockouts: lt.lockouts, Untracked: lt.untracked}
+	for _, state := range lt.accounts {
+		if state.locked && now.Before(state.retryAt) {
+			stats.Locked++
+		}
+	}
+	return stats
+}
+
+// check returns AccountLockedErr if the account is locked at the given time or
+// LoginThrottledErr if it must still wait to log in, with when it can log in.
+func (lt *LoginThrottle) check(username string, now time.Time) error {
+	lt.mux.Lock()
+	defer lt.mux.Unlock()
+	return lt.checkLocked(username, now)
+}
+
+// checkLocked is check for when the lock is held.
+func (lt *LoginThrottle) checkLocked(username string, now time.Time) error {
+	state, exists := lt.accounts[username]
+	if !exists || !now.Before(state.retryAt) {
+		return nil
+	}
+	err := LoginThrottledErr
+	if state.locked {
+		err = AccountLockedErr
+	}
+	return errors.Wrapf(
+		err, "retry after %s", state.retryAt.Format(time.RFC3339))
+}
+
+// reserve returns the error of check for the account or, if its logins are made
+// one at a time and another one is in progress, LoginThrottledErr. Otherwise,
+// it counts the login as in progress until its result is recorded, so that
+// concurrent logins cannot all pass the check before any of their failures
+// is counted.
+func (lt *LoginThrottle) reserve(username string, now time.Time) error {
+	lt.mux.Lock()
+	defer lt.mux.Unlock()
+	if err := lt.checkLocked(username, now); err != nil {
+		return err
+	}
+
+	state, exists := lt.accounts[username]
+	if !exists {
+		if state = lt.track(username, now); state == nil {
+			return nil
+		}
+	}
+	if state.pending > 0 &&
+		lt.failures(state, now)+state.pending >= lt.serialAfter() {
+		return errors.Wrap(LoginThrottledErr,
+			"another login to the account is in progress")
+	}
+	state.pending++
+	return nil
+}
+
+// serialAfter returns the number of failures, counting logins in progress,
+// after which the logins of an account are made one at a time, so that
+// concurrent logins cannot fail more often than the free failures or, with
+// lockouts, the lockout failures allow.
+func (lt *LoginThrottle) serialAfter() int {
+	n := lt.params.FreeFailures
+	if lt.params.LockoutFailures > 0 && lt.params.LockoutFailures-1 < n {
+		n = lt.params.LockoutFailures - 1
+	}
+	return n
+}
+
+// failures returns the failures of the account that are not forgotten at the
+// given time.
+func (lt *LoginThrottle) failures(state *loginState, now time.Time) int {
+	if lt.forgotten(state, now) {
+		return 0
+	}
+	return state.failures
+}
+
+// forgotten returns true if the account can log in and its failures are
+// forgotten at the given time.
+func (lt *LoginThrottle) forgotten(state *loginState, now time.Time) bool {
+	return !now.Before(state.retryAt) &&
+		now.Sub(state.lastFailure) >= lt.params.ResetAfter
+}
+
+// track returns the new state of an account that is not tracked yet, or nil if
+// MaxAccounts accounts are tracked and none can be forgotten. The mutex must be
+// held.
+func (lt *LoginThrottle) track(username string, now time.Time) *loginState {
+	if len(lt.accounts) >= lt.params.MaxAccounts {
+		// The warning is logged at most once per prune so that a flood of
+		// failed logins does not flood the log too
+		if now.Sub(lt.lastPrune) >= loginPruneInterval {
+			lt.lastPrune = now
+			if lt.prune(now); len(lt.accounts) >= lt.params.MaxAccounts {
+				jww.WARN.Printf("Not counting failed logins of new accounts, "+
+					"such as %q: already tracking the maximum of %d accounts.",
+					username, lt.params.MaxAccounts)
+			}
+		}
+		if len(lt.accounts) >= lt.params.MaxAccounts {
+			return nil
+		}
+	}
+	state := &loginState{}
+	lt.accounts[username] = state
+	return state
+}
+
+// record ends a login in progress of the account, if any, and resets its
+// failures if the login succeeded or counts its failure if the credentials
+// were invalid, delaying its next login or locking it. Other errors are
+// ignored, as are the failures of new accounts while MaxAccounts accounts are
+// tracked and none can be forgotten. Returns true if the account is now
+// locked.
+func (lt *LoginThrottle) record(
+	username string, err error, now time.Time) bool {
+	lt.mux.Lock()
+	defer lt.mux.Unlock()
+	state, exists := lt.accounts[username]
+	if exists && state.pending > 0 {
+		state.pending--
+	}
+	if err == nil {
+		delete(lt.accounts, username)
+		return false
+	} else if !errors.Is(err, InvalidCredentialsErr) {
+		if exists && state.pending == 0 && lt.failures(state, now) == 0 &&
+			!now.Before(state.retryAt) {
+			delete(lt.accounts, username)
+		}
+		return false
+	}
+
+	if !exists {
+		if state = lt.track(username, now); state == nil {
+			lt.untracked++
+			return false
+		}
+	} else if lt.forgotten(state, now) {
+		*state = loginState{pending: state.pending}
+	}
+	state.failures++
+	state.lastFailure = now
+
+	if lt.params.LockoutFailures > 0 &&
+		state.failures >= lt.params.LockoutFailures {
+		*state = loginState{lastFailure: now,
+			retryAt: now.Add(lt.params.LockoutDuration), locked: true,
+			pending: state.pending}
+		lt.lockouts++
+		jww.INFO.Printf("Locked account %q until %s for too many failed "+
+			"logins.", username, state.retryAt.Format(time.RFC3339))
+		return true
+	} else if state.failures > lt.params.FreeFailures {
+		state.retryAt = now.Add(lt.delay(state.failures))
+		state.locked = false
+	}
+	return false
+}
+
+// delay returns how long an account with the number of failed logins must
+// wait to log in, which doubles with each failure beyond the free failures.
+func (lt *LoginThrottle) delay(failures int) time.Duration {
+	delay := lt.params.BaseDelay
+	for i := lt.params.FreeFailures + 1; i < failures; i++ {
+		if delay *= 2; delay >= lt.params.MaxDelay {
+			return lt.params.MaxDelay
+		}
+	}
+	return delay
+}
+
+// checkLogin returns AccountLockedErr or LoginThrottledErr if the user cannot
+// log in yet and records the rejected login from the client IP address in the
+// audit log. Otherwise, the login is in progress until recordLogin records its
+// result.
+func (lt *LoginThrottle) checkLogin(
+	username, ip, reqID string, now time.Time) error {
+	err := lt.reserve(username, now)
+	if err != nil {
+		lt.auditLogin(AuditLoginThrottled, username, ip, reqID,
+			loginThrottleCode(err), now)
+	}
+	return err
+}
+
+// recordLogin records the result of a login of the user from the client IP
+// address and records a failure for invalid credentials and the lockout of
+// the account, if it is now locked, in the audit log.
+func (lt *LoginThrottle) recordLogin(
+	username, ip, reqID string, err error, now time.Time) {
+	locked := lt.record(username, err, now)
+	if errors.Is(err, InvalidCredentialsErr) {
+		lt.auditLogin(AuditLoginFailure, username, ip, reqID,
+			codes.Unauthenticated, now)
+	}
+	if locked {
+		lt.auditLogin(AuditLockout, username, ip, reqID,
+			codes.PermissionDenied, now)
+	}
+}
+
+// auditLogin records the operation of login throttling on the login of the
+// user from the client IP address in the audit log, if there is one.
+func (lt *LoginThrottle) auditLogin(operation, username, ip, reqID string,
+	code codes.Code, now time.Time) {
+	if lt.audit == nil {
+		return
+	}
+	entry := AuditEntry{
+		Time:      now.UTC().Format(time.RFC3339Nano),
+		User:      username,
+		Operation: operation,
+		Client:    ip,
+		RequestID: reqID,
+		Result:    code.String(),
+	}
+	if auditErr := lt.audit.Record(entry); auditErr != nil {
+		jww.ERROR.Printf("Failed to record %s of %q in audit log: %+v",
+			operation, username, auditErr)
+	}
+}
+
+// interceptor returns a gRPC interceptor that rejects password logins to
+// accounts that are locked, with PERMISSION_DENIED, or must wait, with
+// RESOURCE_EXHAUSTED, and records the result of the others.
+func (lt *LoginThrottle) interceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{},
+		info *grpc.UnaryServerInfo, next grpc.UnaryHandler) (interface{}, error) {
+		msg, ok := req.(interface{ GetUsername() string })
+		if !loginMethods[info.FullMethod] || !ok {
+			return next(ctx, req)
+		}
+
+		username := msg.GetUsername()
+		if err := lt.checkLogin(username, peerIP(ctx), requestID(ctx),
+			time.Now()); err != nil {
+			jww.DEBUG.Printf("Rejected %s for %q: %v",
+				info.FullMethod, username, err)
+			return nil, status.Error(loginThrottleCode(err), err.Error())
+		}
+
+		// The login is ended even if the handler panics, so that the account
+		// is not left with a login in progress
+		recorded := false
+		defer func() {
+			if !recorded {
+				lt.record(username, loginAbortedErr, time.Now())
+			}
+		}()
+		resp, err := next(ctx, req)
+		lt.recordLogin(username, peerIP(ctx), requestID(ctx), err, time.Now())
+		recorded = true
+		return resp, err
+	}
+}
+
+// checkHTTP returns AccountLockedErr or LoginThrottledErr if the user of an
+// HTTP request that is not served as an RPC cannot log in yet. Otherwise, the
+// login is in progress until recordHTTP records its result. It does nothing if
+// the LoginThrottle is nil.
+func (lt *LoginThrottle) checkHTTP(r *http.Request, username string) error {
+	if lt == nil {
+		return nil
+	}
+	return lt.checkLogin(username, lt.proxies.requestIP(r), "", time.Now())
+}
+
+// recordHTTP records the result of a login of the user with an HTTP request
+// that is not served as an RPC. It does nothing if the LoginThrottle is nil.
+func (lt *LoginThrottle) recordHTTP(
+	r *http.Request, username string, err error) {
+	if lt != nil {
+		lt.recordLogin(
+			username, lt.proxies.requestIP(r), "", err, time.Now())
+	}
+}
+
+// cleanup removes the accounts that can log in and whose failures are
+// forgotten every interval until the stop channel is closed.
+func (lt *LoginThrottle) cleanup(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case now := <-ticker.C:
+			lt.mux.Lock()
+			lt.prune(now)
+			lt.mux.Unlock()
+		}
+	}
+}
+
+// prune removes the accounts without logins in progress that can log in and
+// whose failures are forgotten at the given time. The mutex must be held.
+func (lt *LoginThrottle) prune(now time.Time) {
+	for username, state := range lt.accounts {
+		if state.pending == 0 && lt.forgotten(state, now) {
+			delete(lt.accounts, username)
+		}
+	}
+}
+
+// loginThrottleCode returns the gRPC code of a login throttling error.
+func loginThrottleCode(err error) codes.Code {
+	if errors.Is(err, AccountLockedErr) {
+		return codes.PermissionDenied
+	}
+	return codes.ResourceExhausted
+}
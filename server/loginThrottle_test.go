@@ -0,0 +1,383 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package server
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+
+	"gitlab.com/elixxir/remoteSyncServer/rpc"
+)
+
+// Tests that NewLoginThrottle decodes the parameters and defaults the others.
+func TestNewLoginThrottle(t *testing.T) {
+	lt := newTestFromParams(NewLoginThrottle, map[string]interface{}{
+		"freeFailures": "5", "lockoutFailures": 20, "lockoutDuration": "1h"}, t)
+	expected := LoginThrottleParams{
+		FreeFailures:    5,
+		BaseDelay:       defaultLoginBaseDelay,
+		MaxDelay:        defaultLoginMaxDelay,
+		LockoutFailures: 20,
+		LockoutDuration: time.Hour,
+		ResetAfter:      defaultLoginResetAfter,
+		MaxAccounts:     defaultLoginMaxAccounts,
+	}
+	if lt.Params() != expected {
+		t.Errorf("Unexpected parameters.\nexpected: %+v\nreceived: %+v",
+			expected, lt.Params())
+	}
+}
+
+// Tests that LoginThrottle.record delays the logins of an account after the
+// free failures, doubling the delay up to the maximum, and that a successful
+// login or the reset time forgets its failures while other errors are ignored.
+func TestLoginThrottle_record(t *testing.T) {
+	lt := newTestFromParams(NewLoginThrottle, map[string]interface{}{
+		"freeFailures": 2, "baseDelay": "1s", "maxDelay": "5s",
+		"resetAfter": "1h"}, t)
+	now := time.Now()
+
+	expected := []time.Duration{0, 0, time.Second, 2 * time.Second,
+		4 * time.Second, 5 * time.Second, 5 * time.Second}
+	for i, delay := range expected {
+		if err := lt.check("waldo", now); err != nil {
+			t.Errorf("Login %d rejected before its delay: %+v", i, err)
+		}
+		lt.record("waldo", InvalidCredentialsErr, now)
+		err := lt.check("waldo", now)
+		if delay == 0 && err != nil {
+			t.Errorf("Login %d delayed within the free failures: %+v", i, err)
+		} else if delay != 0 && !errors.Is(err, LoginThrottledErr) {
+			t.Errorf("Login %d not delayed: %+v", i, err)
+		}
+		if err = lt.check("waldo", now.Add(delay)); err != nil {
+			t.Errorf("Login %d still delayed after %s: %+v", i, delay, err)
+		}
+		now = now.Add(delay)
+	}
+
+	for _, err := range []error{InvalidTokenErr, errors.New("internal"),
+		status.Error(codes.Unavailable, "unavailable")} {
+		lt.record("fred", err, now)
+	}
+	if _, exists := lt.accounts["fred"]; exists {
+		t.Errorf("Failure counted for an error other than invalid credentials.")
+	}
+
+	lt.record("waldo", nil, now)
+	if _, exists := lt.accounts["waldo"]; exists {
+		t.Errorf("Failures not reset by a successful login.")
+	}
+
+	for i := 0; i < 3; i++ {
+		lt.record("waldo", InvalidCredentialsErr, now)
+	}
+	now = now.Add(time.Hour + time.Second)
+	lt.record("waldo", InvalidCredentialsErr, now)
+	if err := lt.check("waldo", now); err != nil {
+		t.Errorf("Failures not forgotten after the reset time: %+v", err)
+	}
+}
+
+// Tests that LoginThrottle.reserve lets concurrent logins to an account start
+// only while their failures would be free and below the lockout failures, and
+// makes the others wait for the logins in progress to be recorded.
+func TestLoginThrottle_reserve(t *testing.T) {
+	tests := []struct {
+		params     map[string]interface{}
+		concurrent int
+	}{
+		{map[string]interface{}{"freeFailures": 2}, 2},
+		{map[string]interface{}{"freeFailures": 0}, 1},
+		{map[string]interface{}{
+			"freeFailures": 10, "lockoutFailures": 3}, 2},
+	}
+
+	for i, tt := range tests {
+		lt := newTestFromParams(NewLoginThrottle, tt.params, t)
+		now := time.Now()
+		var started int
+		for j := 0; j < 10; j++ {
+			if err := lt.reserve("waldo", now); err == nil {
+				started++
+			} else if !errors.Is(err, LoginThrottledErr) {
+				t.Errorf("Unexpected error (%d): %+v", i, err)
+			}
+		}
+		if started != tt.concurrent {
+			t.Errorf("%d concurrent logins started instead of %d (%d).",
+				started, tt.concurrent, i)
+		}
+
+		for j := 0; j < started; j++ {
+			lt.record("waldo", InvalidCredentialsErr, now)
+		}
+		if pending := lt.accounts["waldo"].pending; pending != 0 {
+			t.Errorf("%d logins still in progress (%d).", pending, i)
+		}
+	}
+
+	lt := newTestFromParams(NewLoginThrottle,
+		map[string]interface{}{"freeFailures": 1}, t)
+	now := time.Now()
+	if err := lt.reserve("waldo", now); err != nil {
+		t.Fatalf("Failed to start login: %+v", err)
+	}
+	lt.record("waldo", errors.New("internal"), now)
+	if _, exists := lt.accounts["waldo"]; exists {
+		t.Errorf("Account without failures kept after its login ended.")
+	}
+}
+
+// Tests that LoginThrottle.record stops counting the failures of new accounts
+// once MaxAccounts accounts are tracked, still counting those of tracked
+// accounts, and counts them again once forgotten accounts can be removed.
+func TestLoginThrottle_record_MaxAccounts(t *testing.T) {
+	lt := newTestFromParams(NewLoginThrottle, map[string]interface{}{
+		"freeFailures": 0, "resetAfter": "1h", "maxDelay": "1h",
+		"maxAccounts": 2}, t)
+	now := time.Now()
+
+	for _, username := range []string{"waldo", "fred", "thud", "plugh"} {
+		lt.record(username, InvalidCredentialsErr, now)
+	}
+	if len(lt.accounts) != 2 {
+		t.Errorf("Tracking %d accounts instead of the maximum of 2.",
+			len(lt.accounts))
+	}
+	if err := lt.check("thud", now); err != nil {
+		t.Errorf("Failure counted for an account over the maximum: %+v", err)
+	}
+	if stats := lt.Stats(now); stats.Untracked != 2 {
+		t.Errorf("Unexpected untracked failures: %d", stats.Untracked)
+	}
+
+	lt.record("waldo", InvalidCredentialsErr, now)
+	if lt.accounts["waldo"].failures != 2 {
+		t.Errorf("Failure of a tracked account not counted over the maximum.")
+	}
+
+	now = now.Add(2 * time.Hour)
+	lt.record("thud", InvalidCredentialsErr, now)
+	if err := lt.check("thud", now); !errors.Is(err, LoginThrottledErr) {
+		t.Errorf("Failure not counted after forgotten accounts were "+
+			"removed: %+v", err)
+	}
+}
+
+// newTestLoginAudit sets a new audit log for the LoginThrottle and returns a
+// function that closes it and returns its entries.
+func newTestLoginAudit(lt *LoginThrottle, t *testing.T) func() []AuditEntry {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	al, err := NewAuditLog(map[string]interface{}{"path": path})
+	if err != nil {
+		t.Fatalf("Failed to create audit log: %+v", err)
+	}
+	lt.audit = al
+
+	return func() []AuditEntry {
+		_ = al.Close()
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("Failed to read audit log: %+v", err)
+		}
+		var entries []AuditEntry
+		err = readAuditLog(bytes.NewReader(data),
+			func(_ int, entry AuditEntry) error {
+				entry.Time = ""
+				entries = append(entries, entry)
+				return nil
+			})
+		if err != nil {
+			t.Fatalf("Failed to parse audit log: %+v", err)
+		}
+		return entries
+	}
+}
+
+// Tests that LoginThrottle.recordLogin locks an account after the lockout
+// failures until the lockout duration has passed, counts the lockout in the
+// stats, and records each failure and the lockout in the audit log.
+func TestLoginThrottle_recordLogin_Lockout(t *testing.T) {
+	lt := newTestFromParams(NewLoginThrottle, map[string]interface{}{
+		"freeFailures": 10, "lockoutFailures": 3, "lockoutDuration": "15m"}, t)
+	auditEntries := newTestLoginAudit(lt, t)
+	now := time.Now()
+
+	for i := 0; i < 3; i++ {
+		if err := lt.check("waldo", now); err != nil {
+			t.Errorf("Login %d rejected before the lockout: %+v", i, err)
+		}
+		lt.recordLogin("waldo", "10.0.0.7", "req-1", InvalidCredentialsErr, now)
+	}
+	if err := lt.check("waldo", now.Add(14*time.Minute)); !errors.Is(
+		err, AccountLockedErr) {
+		t.Errorf("Account not locked: %+v", err)
+	}
+	if stats := lt.Stats(now); stats != (LoginThrottleStats{
+		Locked: 1, Lockouts: 1}) {
+		t.Errorf("Unexpected stats: %+v", stats)
+	}
+
+	now = now.Add(15 * time.Minute)
+	if err := lt.check("waldo", now); err != nil {
+		t.Errorf("Account still locked after the lockout duration: %+v", err)
+	}
+	if stats := lt.Stats(now); stats != (LoginThrottleStats{Lockouts: 1}) {
+		t.Errorf("Unexpected stats after the lockout: %+v", stats)
+	}
+
+	failure := AuditEntry{User: "waldo", Operation: AuditLoginFailure,
+		Client: "10.0.0.7", RequestID: "req-1", Result: "Unauthenticated"}
+	lockout := failure
+	lockout.Operation, lockout.Result = AuditLockout, "PermissionDenied"
+	expected := []AuditEntry{failure, failure, failure, lockout}
+	if entries := auditEntries(); !reflect.DeepEqual(expected, entries) {
+		t.Errorf("Unexpected audit entries.\nexpected: %+v\nreceived: %+v",
+			expected, entries)
+	}
+}
+
+// Tests that the interceptor of LoginThrottle rejects the password logins of
+// delayed accounts with RESOURCE_EXHAUSTED and of locked accounts with
+// PERMISSION_DENIED without serving them, passes other RPCs through, and
+// records each failed and rejected login in the audit log.
+func TestLoginThrottle_interceptor(t *testing.T) {
+	lt := newTestFromParams(NewLoginThrottle, map[string]interface{}{
+		"freeFailures": 1, "baseDelay": "1h", "maxDelay": "1h",
+		"lockoutFailures": 3}, t)
+	auditEntries := newTestLoginAudit(lt, t)
+	interceptor := lt.interceptor()
+	ctx := peer.NewContext(context.Background(), &peer.Peer{
+		Addr: &net.TCPAddr{IP: net.ParseIP("198.51.100.1"), Port: 5000}})
+	info := &grpc.UnaryServerInfo{
+		FullMethod: rpc.Session_PasswordLogin_FullMethodName}
+	req := &rpc.RsPasswordLoginRequest{Username: "waldo", Password: "wrong"}
+	var served int
+	next := func(context.Context, interface{}) (interface{}, error) {
+		served++
+		return nil, InvalidCredentialsErr
+	}
+
+	for i := 0; i < 2; i++ {
+		if _, err := interceptor(ctx, req, info, next); !errors.Is(
+			err, InvalidCredentialsErr) {
+			t.Errorf("Unexpected error (%d): %+v", i, err)
+		}
+	}
+	_, err := interceptor(ctx, req, info, next)
+	if status.Code(err) != codes.ResourceExhausted ||
+		!strings.Contains(err.Error(), LoginThrottledErr.Error()) {
+		t.Errorf("Unexpected error for a delayed account: %+v", err)
+	}
+	if served != 2 {
+		t.Errorf("Login of a delayed account was served.")
+	}
+
+	other := &grpc.UnaryServerInfo{FullMethod: "/remoteSync.Sync/Read"}
+	if _, err = interceptor(ctx, req, other, next); !errors.Is(
+		err, InvalidCredentialsErr) {
+		t.Errorf("Unexpected error for another RPC: %+v", err)
+	}
+
+	lt.record("waldo", InvalidCredentialsErr, time.Now())
+	_, err = interceptor(ctx, req, info, next)
+	if status.Code(err) != codes.PermissionDenied ||
+		!strings.Contains(err.Error(), AccountLockedErr.Error()) {
+		t.Errorf("Unexpected error for a locked account: %+v", err)
+	}
+	if served != 3 {
+		t.Errorf("Unexpected number of requests served: %d", served)
+	}
+
+	failure := AuditEntry{User: "waldo", Operation: AuditLoginFailure,
+		Client: "198.51.100.1", Result: "Unauthenticated"}
+	throttled := failure
+	throttled.Operation, throttled.Result =
+		AuditLoginThrottled, "ResourceExhausted"
+	locked := throttled
+	locked.Result = "PermissionDenied"
+	expected := []AuditEntry{failure, failure, throttled, locked}
+	if entries := auditEntries(); !reflect.DeepEqual(expected, entries) {
+		t.Errorf("Unexpected audit entries.\nexpected: %+v\nreceived: %+v",
+			expected, entries)
+	}
+}
+
+// Tests that the interceptor of LoginThrottle ends the login of a handler that
+// panics, so that the account is not left with a login in progress.
+func TestLoginThrottle_interceptor_Panic(t *testing.T) {
+	lt := newTestFromParams(NewLoginThrottle,
+		map[string]interface{}{"freeFailures": 0}, t)
+	info := &grpc.UnaryServerInfo{
+		FullMethod: rpc.Session_PasswordLogin_FullMethodName}
+	req := &rpc.RsPasswordLoginRequest{Username: "waldo", Password: "wrong"}
+
+	func() {
+		defer func() { _ = recover() }()
+		_, _ = lt.interceptor()(context.Background(), req, info,
+			func(context.Context, interface{}) (interface{}, error) {
+				panic("handler")
+			})
+	}()
+
+	if err := lt.reserve("waldo", time.Now()); err != nil {
+		t.Errorf("Login rejected after a handler panicked: %+v", err)
+	}
+}
+
+// Tests that LoginThrottle.checkHTTP and LoginThrottle.recordHTTP throttle the
+// logins of HTTP requests and record each failed and rejected login with the
+// client address in the audit log.
+func TestLoginThrottle_checkHTTP(t *testing.T) {
+	lt := newTestFromParams(NewLoginThrottle, map[string]interface{}{
+		"freeFailures": 0, "baseDelay": "1h", "maxDelay": "1h"}, t)
+	auditEntries := newTestLoginAudit(lt, t)
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.RemoteAddr = "198.51.100.1:5000"
+
+	if err := lt.checkHTTP(r, "waldo"); err != nil {
+		t.Errorf("First login rejected: %+v", err)
+	}
+	lt.recordHTTP(r, "waldo", InvalidCredentialsErr)
+	if err := lt.checkHTTP(r, "waldo"); !errors.Is(err, LoginThrottledErr) {
+		t.Errorf("Login not delayed after a failure: %+v", err)
+	}
+
+	failure := AuditEntry{User: "waldo", Operation: AuditLoginFailure,
+		Client: "198.51.100.1", Result: "Unauthenticated"}
+	throttled := failure
+	throttled.Operation, throttled.Result =
+		AuditLoginThrottled, "ResourceExhausted"
+	expected := []AuditEntry{failure, throttled}
+	if entries := auditEntries(); !reflect.DeepEqual(expected, entries) {
+		t.Errorf("Unexpected audit entries.\nexpected: %+v\nreceived: %+v",
+			expected, entries)
+	}
+
+	var nilThrottle *LoginThrottle
+	if err := nilThrottle.checkHTTP(r, "waldo"); err != nil {
+		t.Errorf("Nil LoginThrottle rejected a login: %+v", err)
+	}
+	nilThrottle.recordHTTP(r, "waldo", InvalidCredentialsErr)
+}
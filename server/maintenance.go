@@ -0,0 +1,89 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package server
+
+import (
+	"context"
+	"sync/atomic"
+
+	"github.com/pkg/errors"
+	jww "github.com/spf13/jwalterweatherman"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"gitlab.com/elixxir/remoteSyncServer/rpc"
+)
+
+// MaintenanceErr is returned, with the UNAVAILABLE code, for RPCs that modify
+// storage or accounts while the server is in maintenance mode.
+var MaintenanceErr = errors.New(
+	"server in maintenance: writes are disabled, reads are available")
+
+// maintenanceMethods are the full method names of the RPCs rejected in
+// maintenance mode.
+var maintenanceMethods = map[string]bool{
+	"/mixmessages.RemoteSync/Write":                 true,
+	rpc.Registration_Register_FullMethodName:        true,
+	rpc.Upload_StartUpload_FullMethodName:           true,
+	rpc.Upload_UploadChunk_FullMethodName:           true,
+	rpc.Upload_FinishUpload_FullMethodName:          true,
+	rpc.Delta_ApplyDelta_FullMethodName:             true,
+	rpc.Transaction_Commit_FullMethodName:           true,
+	rpc.Batch_BatchWrite_FullMethodName:             true,
+	rpc.Conditional_ConditionalWrite_FullMethodName: true,
+	rpc.Migration_Tombstone_FullMethodName:          true,
+	rpc.Migration_Import_FullMethodName:             true,
+}
+
+// Maintenance is the read-only maintenance mode of the server, in which
+// writes and registrations are rejected while reads continue, so that storage
+// can be snapshotted or migrated safely. It can be changed while the server is
+// running.
+type Maintenance struct {
+	enabled atomic.Bool
+}
+
+// NewMaintenance returns a Maintenance that is enabled if enabled is true.
+func NewMaintenance(enabled bool) *Maintenance {
+	m := &Maintenance{}
+	m.enabled.Store(enabled)
+	return m
+}
+
+// Enabled returns true if the server is in maintenance mode.
+func (m *Maintenance) Enabled() bool {
+	return m.enabled.Load()
+}
+
+// Set enables or disables maintenance mode and returns whether it was enabled.
+// Changes are logged.
+func (m *Maintenance) Set(enabled bool) bool {
+	was := m.enabled.Swap(enabled)
+	if was != enabled && enabled {
+		jww.INFO.Printf("Maintenance mode enabled; rejecting writes.")
+	} else if was != enabled {
+		jww.INFO.Printf("Maintenance mode disabled; accepting writes.")
+	}
+	return was
+}
+
+// interceptor returns a gRPC interceptor that rejects the RPCs that modify
+// storage or accounts with MaintenanceErr and the UNAVAILABLE code, which
+// clients retry later, while maintenance mode is enabled.
+func (m *Maintenance) interceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{},
+		info *grpc.UnaryServerInfo, next grpc.UnaryHandler) (interface{}, error) {
+		if m.Enabled() && maintenanceMethods[info.FullMethod] {
+			jww.DEBUG.Printf(
+				"Rejected %s in maintenance mode.", info.FullMethod)
+			return nil, status.Error(codes.Unavailable, MaintenanceErr.Error())
+		}
+		return next(ctx, req)
+	}
+}
@@ -0,0 +1,83 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package server
+
+import (
+	"context"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"gitlab.com/elixxir/remoteSyncServer/rpc"
+)
+
+// Tests that Maintenance.Set changes the mode and returns the previous one.
+func TestMaintenance_Set(t *testing.T) {
+	m := NewMaintenance(true)
+	if !m.Enabled() {
+		t.Error("Maintenance created enabled is disabled.")
+	}
+
+	for i, enabled := range []bool{false, false, true, true} {
+		was := m.Enabled()
+		if received := m.Set(enabled); received != was {
+			t.Errorf("Unexpected previous mode %d.\nexpected: %t\nreceived: %t",
+				i, was, received)
+		}
+		if m.Enabled() != enabled {
+			t.Errorf("Unexpected mode %d.\nexpected: %t\nreceived: %t",
+				i, enabled, m.Enabled())
+		}
+	}
+}
+
+// Tests that the interceptor of Maintenance rejects writes and registrations
+// with UNAVAILABLE only while maintenance mode is enabled and that reads and
+// logins continue.
+func TestMaintenance_interceptor(t *testing.T) {
+	m := NewMaintenance(false)
+	interceptor := m.interceptor()
+	next := func(context.Context, interface{}) (interface{}, error) {
+		return "ok", nil
+	}
+	call := func(method string) error {
+		info := &grpc.UnaryServerInfo{FullMethod: method}
+		_, err := interceptor(context.Background(), nil, info, next)
+		return err
+	}
+	writes := []string{"/mixmessages.RemoteSync/Write",
+		rpc.Registration_Register_FullMethodName}
+	reads := []string{"/mixmessages.RemoteSync/Read",
+		"/mixmessages.RemoteSync/ReadDir",
+		rpc.Session_PasswordLogin_FullMethodName,
+		rpc.Admin_SetMaintenance_FullMethodName}
+
+	for _, method := range append(writes, reads...) {
+		if err := call(method); err != nil {
+			t.Errorf("%s rejected outside maintenance mode: %+v", method, err)
+		}
+	}
+
+	m.Set(true)
+	for _, method := range writes {
+		err := call(method)
+		if st := status.Convert(err); st.Code() != codes.Unavailable ||
+			st.Message() != MaintenanceErr.Error() {
+			t.Errorf("Unexpected error for %s in maintenance mode."+
+				"\nexpected: %s: %v\nreceived: %+v",
+				method, codes.Unavailable, MaintenanceErr, err)
+		}
+	}
+	for _, method := range reads {
+		if err := call(method); err != nil {
+			t.Errorf("%s rejected in maintenance mode: %+v", method, err)
+		}
+	}
+}
@@ -0,0 +1,29 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package server
+
+import (
+	"context"
+
+	"google.golang.org/grpc/metadata"
+)
+
+// deviceIDHeader is the metadata key of the ID of the client device that sent
+// a request. It is recorded as the writer of the files written by the request
+// if the server tracks metadata. It has the same format as request IDs.
+const deviceIDHeader = "x-device-id"
+
+// incomingDeviceID returns the device ID set by the client in the metadata of
+// the context or an empty string if it has none or it is invalid.
+func incomingDeviceID(ctx context.Context) string {
+	md, _ := metadata.FromIncomingContext(ctx)
+	if ids := md.Get(deviceIDHeader); len(ids) > 0 && validRequestID(ids[0]) {
+		return ids[0]
+	}
+	return ""
+}
@@ -0,0 +1,112 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"math/rand"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"google.golang.org/grpc/metadata"
+
+	pb "gitlab.com/elixxir/comms/mixmessages"
+	"gitlab.com/elixxir/remoteSyncServer/rpc"
+	"gitlab.com/elixxir/remoteSyncServer/store"
+)
+
+// Tests that incomingDeviceID returns the device ID set by the client and an
+// empty string when it is missing or invalid.
+func Test_incomingDeviceID(t *testing.T) {
+	tests := map[string]string{
+		"laptop-1":              "laptop-1",
+		"":                      "",
+		"bad id":                "",
+		strings.Repeat("a", 65): "",
+	}
+	for id, expected := range tests {
+		ctx := metadata.NewIncomingContext(
+			context.Background(), metadata.Pairs(deviceIDHeader, id))
+		if received := incomingDeviceID(ctx); received != expected {
+			t.Errorf("Unexpected device ID for %q.\nexpected: %q"+
+				"\nreceived: %q", id, expected, received)
+		}
+	}
+	if id := incomingDeviceID(context.Background()); id != "" {
+		t.Errorf("Unexpected device ID without metadata: %q", id)
+	}
+}
+
+// Tests that handler.Stat returns the metadata recorded by the store,
+// including the device that wrote the file.
+func Test_handler_Stat(t *testing.T) {
+	h, token, _ := newHandlerStoreLogin(time.Hour, "waldo", "hunter2",
+		rand.New(rand.NewSource(88)), store.NewMetadataStore(
+			store.NewMemStore), t)
+	data := []byte("data")
+	ctx := metadata.NewIncomingContext(
+		context.Background(), metadata.Pairs(deviceIDHeader, "laptop"))
+	_, err := h.Write(ctx, &pb.RsWriteRequest{
+		Path: "file", Data: data, Token: token.Marshal()})
+	if err != nil {
+		t.Fatalf("Failed to write file: %+v", err)
+	}
+
+	resp, err := h.Stat(context.Background(),
+		&rpc.RsStatRequest{Token: token.Marshal(), Path: "file"})
+	if err != nil {
+		t.Fatalf("Failed to stat file: %+v", err)
+	}
+	hash := sha256.Sum256(data)
+	if resp.GetSize() != int64(len(data)) ||
+		!bytes.Equal(resp.GetSHA256(), hash[:]) || resp.GetCreated() == 0 ||
+		resp.GetCreated() != resp.GetModified() ||
+		resp.GetDevice() != "laptop" {
+		t.Errorf("Unexpected metadata: %v", resp)
+	}
+}
+
+// Tests that handler.Stat describes a file from its data when the store does
+// not track metadata.
+func Test_handler_Stat_Untracked(t *testing.T) {
+	h, token := newHandlerLogin(
+		time.Hour, "waldo", "hunter2", rand.New(rand.NewSource(88)), t)
+	data := []byte("data")
+	_, _ = h.Write(context.Background(), &pb.RsWriteRequest{
+		Path: "file", Data: data, Token: token.Marshal()})
+
+	resp, err := h.Stat(context.Background(),
+		&rpc.RsStatRequest{Token: token.Marshal(), Path: "file"})
+	if err != nil {
+		t.Fatalf("Failed to stat file: %+v", err)
+	}
+	hash := sha256.Sum256(data)
+	if resp.GetSize() != int64(len(data)) ||
+		!bytes.Equal(resp.GetSHA256(), hash[:]) || resp.GetCreated() != 0 ||
+		resp.GetModified() == 0 || resp.GetDevice() != "" {
+		t.Errorf("Unexpected metadata: %v", resp)
+	}
+}
+
+// Error path: Tests that handler.Stat returns os.ErrNotExist for a file that
+// does not exist.
+func Test_handler_Stat_ErrNotExist(t *testing.T) {
+	h, token := newHandlerLogin(
+		time.Hour, "waldo", "hunter2", rand.New(rand.NewSource(88)), t)
+	_, err := h.Stat(context.Background(),
+		&rpc.RsStatRequest{Token: token.Marshal(), Path: "missing"})
+	if !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Unexpected error.\nexpected: %v\nreceived: %+v",
+			os.ErrNotExist, err)
+	}
+}
@@ -0,0 +1,381 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package server
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	jww "github.com/spf13/jwalterweatherman"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	pb "gitlab.com/elixxir/comms/mixmessages"
+)
+
+// metricsNamespace prefixes the names of all metrics of the server.
+const metricsNamespace = "remote_sync"
+
+// Default metrics parameters.
+const (
+	defaultMetricsPath          = "/metrics"
+	defaultStorageUsageInterval = 10 * time.Minute
+)
+
+// MetricsParams are the parameters of the Prometheus metrics endpoint.
+type MetricsParams struct {
+	// Address is the host and port that the metrics are served on over plain
+	// HTTP, such as "127.0.0.1:9090". Required.
+	Address string `mapstructure:"address"`
+
+	// Path is the HTTP path of the metrics. Defaults to "/metrics".
+	Path string `mapstructure:"path"`
+
+	// StorageUsageInterval is how often the storage used by each user is
+	// measured. Zero disables the measurement. Defaults to 10 minutes.
+	StorageUsageInterval time.Duration `mapstructure:"storageUsageInterval"`
+}
+
+// Metrics records Prometheus metrics of the RPCs, connections, and storage of
+// the server and serves them over HTTP on their own address.
+type Metrics struct {
+	params   MetricsParams
+	registry *prometheus.Registry
+
+	rpcs         *prometheus.CounterVec
+	rpcDuration  *prometheus.HistogramVec
+	bytesRead    prometheus.Counter
+	bytesWritten prometheus.Counter
+	storageUsage *prometheus.GaugeVec
+	connections  prometheus.Gauge
+	authFailures *prometheus.CounterVec
+
+	httpServer *http.Server
+}
+
+// NewMetrics creates a new Metrics from the parameters. Go runtime and process
+// metrics are included.
+func NewMetrics(params map[string]interface{}) (*Metrics, error) {
+	p := MetricsParams{
+		Path:                 defaultMetricsPath,
+		StorageUsageInterval: defaultStorageUsageInterval,
+	}
+	err := decodeParams(params, &p, "metrics")
+	if err != nil {
+		return nil, err
+	}
+	if p.Address == "" {
+		return nil, errors.New("metrics address is required")
+	} else if _, _, err = net.SplitHostPort(p.Address); err != nil {
+		return nil, errors.Wrapf(err, "invalid metrics address %q", p.Address)
+	} else if !strings.HasPrefix(p.Path, "/") {
+		return nil, errors.Errorf("metrics path %q must start with /", p.Path)
+	} else if p.StorageUsageInterval < 0 {
+		return nil, errors.Errorf("storage usage interval %s cannot be "+
+			"negative", p.StorageUsageInterval)
+	}
+
+	m := &Metrics{
+		params:   p,
+		registry: prometheus.NewRegistry(),
+		rpcs: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "rpcs_total",
+			Help:      "Number of completed RPCs by method and status code.",
+		}, []string{"method", "code"}),
+		rpcDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Name:      "rpc_duration_seconds",
+			Help:      "Time taken to handle RPCs by method.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"method"}),
+		bytesRead: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "read_bytes_total",
+			Help:      "Bytes of file data read by clients.",
+		}),
+		bytesWritten: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "written_bytes_total",
+			Help:      "Bytes of file data written by clients.",
+		}),
+		storageUsage: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "storage_usage_bytes",
+			Help:      "Total size of each user's files when last measured.",
+		}, []string{"user"}),
+		connections: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "active_connections",
+			Help:      "Number of open client connections.",
+		}),
+		authFailures: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "auth_failures_total",
+			Help: "Number of RPCs rejected for invalid credentials, " +
+				"tokens, or API keys or missing permissions by method.",
+		}, []string{"method"}),
+	}
+	m.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.rpcs, m.rpcDuration, m.bytesRead, m.bytesWritten, m.storageUsage,
+		m.connections, m.authFailures)
+
+	return m, nil
+}
+
+// addJournal registers metrics of the replay of the journal when the server
+// started and of the writes it is applying.
+func (m *Metrics) addJournal(j *Journal) {
+	m.registry.MustRegister(
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "journal_replayed_writes",
+			Help:      "Interrupted writes replayed from the journal on start.",
+		}, func() float64 { return float64(j.Stats().Writes) }),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "journal_replay_failures",
+			Help:      "Interrupted writes that failed to replay at startup.",
+		}, func() float64 { return float64(j.Stats().Failed) }),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "journal_torn_bytes",
+			Help: "Bytes of the incomplete record discarded from the end of " +
+				"the journal at startup.",
+		}, func() float64 { return float64(j.Stats().TornBytes) }),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "journal_replay_seconds",
+			Help:      "Time taken to replay the journal at startup.",
+		}, func() float64 { return j.Stats().Duration.Seconds() }),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "journal_pending_writes",
+			Help:      "Writes recorded in the journal that are being applied.",
+		}, func() float64 { return float64(j.Pending()) }),
+	)
+}
+
+// addScrubber registers metrics of the files verified by the scrubber and the
+// corrupted files it found.
+func (m *Metrics) addScrubber(sc *Scrubber) {
+	m.registry.MustRegister(
+		prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "scrub_runs_total",
+			Help:      "Scrubs of all stored files that finished.",
+		}, func() float64 { return float64(sc.Stats().Runs) }),
+		prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "scrub_files_total",
+			Help:      "Stored files verified by the scrubs that finished.",
+		}, func() float64 { return float64(sc.Stats().Files) }),
+		prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "scrub_bytes_total",
+			Help:      "Stored bytes verified by the scrubs that finished.",
+		}, func() float64 { return float64(sc.Stats().Bytes) }),
+		prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "scrub_corrupted_total",
+			Help:      "Stored files found not to match their checksum.",
+		}, func() float64 { return float64(sc.Stats().Corrupted) }),
+		prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "scrub_repaired_total",
+			Help:      "Corrupted files replaced by a copy from a replica.",
+		}, func() float64 { return float64(sc.Stats().Repaired) }),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "scrub_unchecked_files",
+			Help:      "Stored files without a checksum found by the last scrub.",
+		}, func() float64 { return float64(sc.Stats().Unchecked) }),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "scrub_last_run_seconds",
+			Help:      "Unix time that the last scrub finished.",
+		}, func() float64 {
+			if lastRun := sc.Stats().LastRun; !lastRun.IsZero() {
+				return float64(lastRun.Unix())
+			}
+			return 0
+		}),
+	)
+}
+
+// addAutoBan registers metrics of the IP addresses banned for too many failed
+// requests.
+func (m *Metrics) addAutoBan(ab *AutoBan) {
+	m.registry.MustRegister(
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "banned_ips",
+			Help:      "IP addresses currently banned for failed requests.",
+		}, func() float64 { return float64(ab.Stats(time.Now()).Banned) }),
+		prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "ip_bans_total",
+			Help:      "Times an IP address was banned for failed requests.",
+		}, func() float64 { return float64(ab.Stats(time.Now()).Bans) }),
+	)
+}
+
+// addLoginThrottle registers metrics of the accounts locked for too many
+// failed logins and of the failed logins that were not counted.
+func (m *Metrics) addLoginThrottle(lt *LoginThrottle) {
+	m.registry.MustRegister(
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "locked_accounts",
+			Help:      "Accounts currently locked for failed logins.",
+		}, func() float64 { return float64(lt.Stats(time.Now()).Locked) }),
+		prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "account_lockouts_total",
+			Help:      "Times an account was locked for failed logins.",
+		}, func() float64 { return float64(lt.Stats(time.Now()).Lockouts) }),
+		prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "untracked_logins_total",
+			Help:      "Failed logins not counted for too many accounts.",
+		}, func() float64 { return float64(lt.Stats(time.Now()).Untracked) }),
+	)
+}
+
+// start serves the metrics on their address, listened on with the function,
+// in the background and measures the storage used by each user of the handler
+// until the stop channel is closed.
+func (m *Metrics) start(
+	h *handler, listen listenFunc, stop <-chan struct{}) error {
+	listener, err := listen(m.params.Address)
+	if err != nil {
+		return errors.Wrapf(
+			err, "failed to listen for metrics on %s", m.params.Address)
+	}
+	mux := http.NewServeMux()
+	mux.Handle(m.params.Path,
+		promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{}))
+	m.httpServer = &http.Server{
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	go func() {
+		jww.INFO.Printf("Serving metrics on http://%s%s.",
+			listener.Addr(), m.params.Path)
+		err := m.httpServer.Serve(listener)
+		if err != nil && err != http.ErrServerClosed {
+			jww.ERROR.Printf("Failed to serve metrics: %+v", err)
+		}
+	}()
+	go func() {
+		<-stop
+		_ = m.httpServer.Close()
+	}()
+
+	if m.params.StorageUsageInterval > 0 {
+		go m.measureStorage(h, m.params.StorageUsageInterval, stop)
+	}
+	return nil
+}
+
+// interceptor returns an interceptor that records the method, status code,
+// and duration of each RPC, the file data read and written, and failed
+// authentication.
+func (m *Metrics) interceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{},
+		info *grpc.UnaryServerInfo, next grpc.UnaryHandler) (interface{}, error) {
+		start := time.Now()
+		resp, err := next(ctx, req)
+		m.rpcDuration.WithLabelValues(info.FullMethod).Observe(
+			time.Since(start).Seconds())
+		m.rpcs.WithLabelValues(info.FullMethod, status.Code(err).String()).Inc()
+
+		if err != nil {
+			if isAuthFailure(err) {
+				m.authFailures.WithLabelValues(info.FullMethod).Inc()
+			}
+			return resp, err
+		}
+		if msg, ok := req.(*pb.RsWriteRequest); ok {
+			m.bytesWritten.Add(float64(len(msg.GetData())))
+		}
+		if msg, ok := resp.(*pb.RsReadResponse); ok {
+			m.bytesRead.Add(float64(len(msg.GetData())))
+		}
+		return resp, nil
+	}
+}
+
+// isAuthFailure returns true if the error rejects the credentials, token, or
+// API key of the request or its permissions.
+func isAuthFailure(err error) bool {
+	if errors.Is(err, InvalidCredentialsErr) ||
+		errors.Is(err, InvalidTokenErr) ||
+		errors.Is(err, InvalidAPIKeyErr) ||
+		errors.Is(err, InsufficientScopeErr) {
+		return true
+	}
+	code := status.Code(err)
+	return code == codes.Unauthenticated || code == codes.PermissionDenied
+}
+
+// connState counts the open connections of an HTTP server. It is used as
+// http.Server.ConnState.
+func (m *Metrics) connState(_ net.Conn, state http.ConnState) {
+	switch state {
+	case http.StateNew:
+		m.connections.Inc()
+	case http.StateHijacked, http.StateClosed:
+		m.connections.Dec()
+	}
+}
+
+// measureStorage measures the storage used by each user of the handler now
+// and then every interval until the stop channel is closed.
+func (m *Metrics) measureStorage(
+	h *handler, interval time.Duration, stop <-chan struct{}) {
+	m.updateStorageUsage(h)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			m.updateStorageUsage(h)
+		}
+	}
+}
+
+// updateStorageUsage sets the storage usage of each registered user whose
+// store implements store.Sizer. Users that no longer exist are removed.
+func (m *Metrics) updateStorageUsage(h *handler) {
+	usernames, err := h.users.List()
+	if err != nil {
+		jww.ERROR.Printf("Failed to list users to measure storage: %+v", err)
+		return
+	}
+	usage := h.storageUsage(usernames)
+
+	m.storageUsage.Reset()
+	for username, size := range usage {
+		m.storageUsage.WithLabelValues(username).Set(float64(size))
+	}
+}
@@ -0,0 +1,194 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package server
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	pb "gitlab.com/elixxir/comms/mixmessages"
+	"gitlab.com/elixxir/remoteSyncServer/credentials"
+	"gitlab.com/elixxir/remoteSyncServer/storage"
+	"gitlab.com/elixxir/remoteSyncServer/store"
+)
+
+// Tests that NewMetrics applies the defaults to unset parameters.
+func TestNewMetrics(t *testing.T) {
+	m, err := NewMetrics(map[string]interface{}{"address": "127.0.0.1:9090"})
+	if err != nil {
+		t.Fatalf("Failed to create Metrics: %+v", err)
+	}
+	expected := MetricsParams{
+		Address:              "127.0.0.1:9090",
+		Path:                 defaultMetricsPath,
+		StorageUsageInterval: defaultStorageUsageInterval,
+	}
+	if m.params != expected {
+		t.Errorf("Unexpected parameters.\nexpected: %+v\nreceived: %+v",
+			expected, m.params)
+	}
+
+	m, err = NewMetrics(map[string]interface{}{
+		"address":              ":9090",
+		"path":                 "/stats",
+		"storageUsageInterval": "0s",
+	})
+	if err != nil {
+		t.Fatalf("Failed to create Metrics: %+v", err)
+	}
+	expected = MetricsParams{Address: ":9090", Path: "/stats"}
+	if m.params != expected {
+		t.Errorf("Unexpected parameters.\nexpected: %+v\nreceived: %+v",
+			expected, m.params)
+	}
+}
+
+// Error path: Tests that NewMetrics returns an error for invalid parameters.
+func TestNewMetrics_Error(t *testing.T) {
+	tests := map[string]map[string]interface{}{
+		"no address":      {},
+		"invalid address": {"address": "localhost"},
+		"invalid path":    {"address": ":9090", "path": "metrics"},
+		"negative interval": {
+			"address": ":9090", "storageUsageInterval": "-1m"},
+		"unknown key": {"address": ":9090", "port": 9090},
+	}
+	for name, params := range tests {
+		if _, err := NewMetrics(params); err == nil {
+			t.Errorf("Failed to get error for %s.", name)
+		}
+	}
+}
+
+// Tests that Metrics.interceptor counts each RPC by method and code, the file
+// data read and written by successful RPCs, and authentication failures.
+func TestMetrics_interceptor(t *testing.T) {
+	m, err := NewMetrics(map[string]interface{}{"address": ":9090"})
+	if err != nil {
+		t.Fatalf("Failed to create Metrics: %+v", err)
+	}
+	interceptor := m.interceptor()
+	call := func(method string, req, resp interface{}, err error) {
+		_, _ = interceptor(context.Background(), req,
+			&grpc.UnaryServerInfo{FullMethod: method},
+			func(context.Context, interface{}) (interface{}, error) {
+				return resp, err
+			})
+	}
+
+	const read, write = "/mixmessages.RemoteSync/Read",
+		"/mixmessages.RemoteSync/Write"
+	call(write, &pb.RsWriteRequest{Data: []byte("hello")}, nil, nil)
+	call(write, &pb.RsWriteRequest{Data: []byte("lost")}, nil,
+		errors.Wrap(InvalidTokenErr, "expired"))
+	call(read, &pb.RsReadRequest{}, &pb.RsReadResponse{Data: []byte("hi")},
+		nil)
+	call(read, &pb.RsReadRequest{}, nil,
+		status.Error(codes.PermissionDenied, "denied"))
+
+	counts := []struct{ method, code string }{
+		{write, "OK"}, {write, "Unknown"}, {read, "OK"},
+		{read, "PermissionDenied"},
+	}
+	for _, c := range counts {
+		n := testutil.ToFloat64(m.rpcs.WithLabelValues(c.method, c.code))
+		if n != 1 {
+			t.Errorf("Unexpected count of %s with code %s."+
+				"\nexpected: %d\nreceived: %f", c.method, c.code, 1, n)
+		}
+	}
+	if n := testutil.CollectAndCount(m.rpcs); n != len(counts) {
+		t.Errorf("Unexpected number of RPC counts."+
+			"\nexpected: %d\nreceived: %d", len(counts), n)
+	}
+	if n := testutil.CollectAndCount(m.rpcDuration); n != 2 {
+		t.Errorf("Unexpected number of durations.\nexpected: %d\nreceived: %d",
+			2, n)
+	}
+	if n := testutil.ToFloat64(m.bytesWritten); n != 5 {
+		t.Errorf("Unexpected bytes written.\nexpected: %d\nreceived: %f", 5, n)
+	}
+	if n := testutil.ToFloat64(m.bytesRead); n != 2 {
+		t.Errorf("Unexpected bytes read.\nexpected: %d\nreceived: %f", 2, n)
+	}
+	for _, method := range []string{read, write} {
+		n := testutil.ToFloat64(m.authFailures.WithLabelValues(method))
+		if n != 1 {
+			t.Errorf("Unexpected auth failures for %s."+
+				"\nexpected: %d\nreceived: %f", method, 1, n)
+		}
+	}
+}
+
+// Tests that Metrics.connState counts new connections until they are closed or
+// hijacked.
+func TestMetrics_connState(t *testing.T) {
+	m, err := NewMetrics(map[string]interface{}{"address": ":9090"})
+	if err != nil {
+		t.Fatalf("Failed to create Metrics: %+v", err)
+	}
+	for _, state := range []http.ConnState{http.StateNew, http.StateNew,
+		http.StateActive, http.StateIdle, http.StateNew, http.StateClosed,
+		http.StateHijacked} {
+		m.connState(nil, state)
+	}
+	if n := testutil.ToFloat64(m.connections); n != 1 {
+		t.Errorf("Unexpected connections.\nexpected: %d\nreceived: %f", 1, n)
+	}
+}
+
+// Tests that Metrics.updateStorageUsage sets the usage of each registered user
+// and removes users that no longer exist.
+func TestMetrics_updateStorageUsage(t *testing.T) {
+	m, err := NewMetrics(map[string]interface{}{"address": ":9090"})
+	if err != nil {
+		t.Fatalf("Failed to create Metrics: %+v", err)
+	}
+	users := credentials.NewMemStore(
+		map[string]string{"waldo": "hunter2", "fred": "pass"})
+	newStore, err := storage.GetBackend(store.MemoryBackend)
+	if err != nil {
+		t.Fatalf("Failed to get memory backend: %+v", err)
+	}
+	newMemStore, err := newStore(nil)
+	if err != nil {
+		t.Fatalf("Failed to create memory backend: %+v", err)
+	}
+	h := newHandler("", time.Hour, users, nil, newMemStore)
+
+	s, _ := newMemStore("", "waldo")
+	if err = s.Write("file", []byte("hello")); err != nil {
+		t.Fatalf("Failed to write file: %+v", err)
+	}
+	m.updateStorageUsage(h)
+	usage := map[string]float64{"waldo": 5, "fred": 0}
+	for username, expected := range usage {
+		n := testutil.ToFloat64(m.storageUsage.WithLabelValues(username))
+		if n != expected {
+			t.Errorf("Unexpected usage for %s.\nexpected: %f\nreceived: %f",
+				username, expected, n)
+		}
+	}
+
+	if err = users.Delete("fred"); err != nil {
+		t.Fatalf("Failed to delete user: %+v", err)
+	}
+	m.updateStorageUsage(h)
+	if n := testutil.CollectAndCount(m.storageUsage); n != 1 {
+		t.Errorf("Unexpected number of users.\nexpected: %d\nreceived: %d",
+			1, n)
+	}
+}
@@ -0,0 +1,322 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/status"
+
+	"gitlab.com/elixxir/remoteSyncServer/rpc"
+	"gitlab.com/elixxir/remoteSyncServer/store"
+	"gitlab.com/xx_network/primitives/utils"
+)
+
+const (
+	// maxExportPageFiles and maxExportPageBytes are the largest number of
+	// files and total size of their data exported in one page. A file larger
+	// than maxExportPageBytes is exported alone.
+	maxExportPageFiles = 1000
+	maxExportPageBytes = 4 << 20
+
+	// tombstoneFilePerm is the permissions used when writing the tombstone
+	// file.
+	tombstoneFilePerm = os.FileMode(0600)
+)
+
+var (
+	// MigrationDisabledErr is returned by the Migration service while account
+	// migration is not enabled.
+	MigrationDisabledErr = errors.New("account migration is not enabled")
+
+	// MigratedErr is returned when logging in as a user whose account was
+	// migrated to another server.
+	MigratedErr = errors.New("account was migrated to another server")
+
+	// UnknownSourceErr is returned when importing from a server that is not
+	// one of the allowed sources.
+	UnknownSourceErr = errors.New("source server is not allowed")
+
+	// InvalidMigrationRequestErr is returned when exporting with a page token
+	// that was not returned by the server or tombstoning without a
+	// destination.
+	InvalidMigrationRequestErr = errors.New("invalid migration request")
+)
+
+// MigrationParams are the parameters of account migration.
+type MigrationParams struct {
+	// Address is the address of this server that the clients of users who
+	// import their accounts connect to. Source servers tell later logins of
+	// the users to use it. Required if Sources is not empty.
+	Address string `mapstructure:"address"`
+
+	// Sources are the addresses of the native gRPC listeners of the servers
+	// that users can import their accounts from. Users can export their
+	// accounts to any server.
+	Sources []string `mapstructure:"sources"`
+
+	// CAPath is the CA certificate that the certificates of the sources must
+	// be signed by. Defaults to the system roots.
+	CAPath string `mapstructure:"caPath"`
+
+	// TombstonePath is the file that the tombstones of the accounts exported
+	// from this server are saved to. If it is empty, they are only kept in
+	// memory and are lost when the server restarts.
+	TombstonePath string `mapstructure:"tombstonePath"`
+}
+
+// accountTombstone records that the account of a user was migrated to another
+// server.
+type accountTombstone struct {
+	Destination string    `json:"destination"`
+	Time        time.Time `json:"time"`
+}
+
+// Migration moves the files of users between servers. A user imports their
+// account from an allowed source server, which exports their files to this
+// server and is then tombstoned, so that later logins to it fail with the
+// address of this server.
+type Migration struct {
+	params  MigrationParams
+	sources map[string]bool
+	creds   credentials.TransportCredentials
+
+	// tombstones maps the username of each exported account to its
+	// tombstone.
+	tombstones map[string]accountTombstone
+	mux        sync.RWMutex
+}
+
+// NewMigration creates a new Migration from the parameters and loads the
+// tombstones from the tombstone file, if it exists. Returns an error if a
+// required parameter is missing or the CA or tombstone file cannot be loaded.
+func NewMigration(params map[string]interface{}) (*Migration, error) {
+	var p MigrationParams
+	err := decodeParams(params, &p, "migration")
+	if err != nil {
+		return nil, err
+	}
+
+	m := &Migration{
+		params:     p,
+		sources:    make(map[string]bool, len(p.Sources)),
+		tombstones: make(map[string]accountTombstone),
+	}
+	for _, source := range p.Sources {
+		if source == "" {
+			return nil, errors.New("migration sources cannot be empty")
+		}
+		m.sources[source] = true
+	}
+	if len(p.Sources) > 0 && p.Address == "" {
+		return nil, errors.New("migration address is required with sources")
+	}
+
+	tlsConfig := &tls.Config{}
+	if p.CAPath != "" {
+		if p.CAPath, err = utils.ExpandPath(p.CAPath); err != nil {
+			return nil, errors.Wrapf(err, "unable to expand path %s", p.CAPath)
+		}
+		caPem, err := utils.ReadFile(p.CAPath)
+		if err != nil {
+			return nil, errors.Wrapf(
+				err, "failed to read migration CA %s", p.CAPath)
+		}
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(caPem) {
+			return nil, errors.Errorf("no certificates found in %s", p.CAPath)
+		}
+	}
+	m.creds = credentials.NewTLS(tlsConfig)
+
+	if p.TombstonePath == "" {
+		return m, nil
+	}
+	path, err := utils.ExpandPath(p.TombstonePath)
+	if err != nil {
+		return nil, errors.Wrapf(
+			err, "unable to expand path %s", p.TombstonePath)
+	}
+	m.params.TombstonePath = path
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return m, nil
+	} else if err != nil {
+		return nil, errors.Wrapf(err, "unable to read file %s", path)
+	}
+	if err = json.Unmarshal(data, &m.tombstones); err != nil {
+		return nil, errors.Wrapf(err, "unable to parse tombstones %s", path)
+	} else if m.tombstones == nil {
+		m.tombstones = make(map[string]accountTombstone)
+	}
+
+	return m, nil
+}
+
+// Params returns the parameters of account migration.
+func (m *Migration) Params() MigrationParams {
+	return m.params
+}
+
+// Destination returns the address of the server that the account of the user
+// was migrated to and true if it was migrated.
+func (m *Migration) Destination(username string) (string, bool) {
+	m.mux.RLock()
+	defer m.mux.RUnlock()
+	tombstone, exists := m.tombstones[username]
+	return tombstone.Destination, exists
+}
+
+// checkLogin returns [MigratedErr] with the destination if the account of the
+// user was migrated.
+func (m *Migration) checkLogin(username string) error {
+	if destination, migrated := m.Destination(username); migrated {
+		return errors.Wrapf(MigratedErr, "moved to %s", destination)
+	}
+	return nil
+}
+
+// addTombstone records that the account of the user was migrated to the
+// destination and saves the tombstones.
+func (m *Migration) addTombstone(username, destination string) error {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	m.tombstones[username] = accountTombstone{destination, time.Now()}
+	return m.save()
+}
+
+// save writes the tombstones to the tombstone file, if there is one, in the
+// same way as the revocation list. Must be called while the lock is held.
+func (m *Migration) save() error {
+	path := m.params.TombstonePath
+	if path == "" {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(m.tombstones, "", "\t")
+	if err != nil {
+		return errors.Wrap(err, "failed to encode tombstones")
+	}
+
+	if err = os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return errors.Wrapf(err, "failed to make directory for %s", path)
+	}
+	tmpPath := path + ".tmp"
+	if err = os.WriteFile(tmpPath, data, tombstoneFilePerm); err != nil {
+		return errors.Wrapf(err, "failed to write %s", tmpPath)
+	}
+	if err = os.Rename(tmpPath, path); err != nil {
+		return errors.Wrapf(err, "failed to replace %s", path)
+	}
+
+	return nil
+}
+
+// dial connects to the source server. Returns [UnknownSourceErr] if it is not
+// one of the allowed sources, so that users cannot make the server connect to
+// arbitrary addresses.
+func (m *Migration) dial(source string) (*grpc.ClientConn, error) {
+	if !m.sources[source] {
+		return nil, errors.Wrapf(UnknownSourceErr, "source %q", source)
+	}
+	conn, err := grpc.Dial(source, grpc.WithTransportCredentials(m.creds))
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to dial source %s", source)
+	}
+	return conn, nil
+}
+
+// sourceStatus returns the status error of a call to the source server with
+// the source in its message and the same code, so that, for example, an
+// invalid source token fails with UNAUTHENTICATED.
+func sourceStatus(source string, err error) error {
+	st := status.Convert(err)
+	return status.Errorf(st.Code(), "source %s: %s", source, st.Message())
+}
+
+// sanitizeExportedPaths returns the paths of the files exported by a source
+// server sanitized with [store.SanitizePath]. They come from the source rather
+// than the client, so pathInterceptor does not check them. Returns
+// [store.InvalidPathErr] if any path is invalid, so that no file of the page
+// is imported.
+func sanitizeExportedPaths(files []*rpc.RsExportedFile) ([]string, error) {
+	paths := make([]string, len(files))
+	for i, file := range files {
+		p, err := store.SanitizePath(file.GetPath())
+		if err != nil {
+			return nil, errors.WithMessage(err, "exported file")
+		} else if p == "" {
+			return nil, errors.Wrap(
+				store.InvalidPathErr, "exported file has an empty path")
+		}
+		paths[i] = p
+	}
+	return paths, nil
+}
+
+// listFiles returns the paths of all files of the session. Returns
+// [store.NotListableErr] if its store cannot list its files.
+func listFiles(s store.Store) ([]string, error) {
+	lister, ok := s.(*userSession).Store.(store.Lister)
+	if !ok {
+		return nil, store.NotListableErr
+	}
+	return lister.ListFiles()
+}
+
+// exportPage returns the page of the sorted files of the store that starts
+// after the file in the page token, with their data, and the token of the
+// next page, which is empty on the last page. The page ends after
+// maxExportPageFiles files or once their data reaches maxExportPageBytes.
+// Returns [InvalidMigrationRequestErr] for an invalid page token.
+func exportPage(s store.Store, files []string,
+	pageToken string) ([]*rpc.RsExportedFile, string, error) {
+	start := 0
+	if pageToken != "" {
+		b, err := base64.RawURLEncoding.DecodeString(pageToken)
+		if err != nil || len(b) == 0 {
+			return nil, "", errors.Wrapf(
+				InvalidMigrationRequestErr, "invalid page token %q", pageToken)
+		}
+		after := string(b)
+		start = sort.SearchStrings(files, after)
+		if start < len(files) && files[start] == after {
+			start++
+		}
+	}
+
+	var page []*rpc.RsExportedFile
+	var size int
+	end := start
+	for ; end < len(files) && len(page) < maxExportPageFiles &&
+		size < maxExportPageBytes; end++ {
+		data, err := s.Read(files[end])
+		if err != nil {
+			return nil, "", errors.Wrapf(err, "failed to read %s", files[end])
+		}
+		page = append(page, &rpc.RsExportedFile{Path: files[end], Data: data})
+		size += len(data)
+	}
+
+	var next string
+	if end < len(files) {
+		next = base64.RawURLEncoding.EncodeToString([]byte(files[end-1]))
+	}
+	return page, next, nil
+}
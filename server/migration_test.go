@@ -0,0 +1,323 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"net"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+
+	rsCredentials "gitlab.com/elixxir/remoteSyncServer/credentials"
+	"gitlab.com/elixxir/remoteSyncServer/rpc"
+	"gitlab.com/elixxir/remoteSyncServer/store"
+)
+
+// Tests that NewMigration decodes the parameters.
+func TestNewMigration(t *testing.T) {
+	m, err := NewMigration(map[string]interface{}{
+		"address": "new:22841", "sources": []interface{}{"old:22841"},
+		"caPath": writeTestCA(t)})
+	if err != nil {
+		t.Fatalf("Failed to create migration: %+v", err)
+	}
+	if m.Params().Address != "new:22841" || !m.sources["old:22841"] {
+		t.Errorf("Unexpected parameters: %+v", m.Params())
+	}
+
+	if _, err = NewMigration(map[string]interface{}{}); err != nil {
+		t.Errorf("Failed to create migration without sources: %+v", err)
+	}
+}
+
+// Error path: Tests that NewMigration returns an error for unknown and
+// invalid parameters.
+func TestNewMigration_Error(t *testing.T) {
+	for _, params := range []map[string]interface{}{
+		{"unknown": true},
+		{"sources": []interface{}{"old:22841"}},
+		{"address": "new:22841", "sources": []interface{}{""}},
+		{"caPath": filepath.Join(t.TempDir(), "missing.pem")},
+	} {
+		if _, err := NewMigration(params); err == nil {
+			t.Errorf("Failed to get error for params %v.", params)
+		}
+	}
+}
+
+// Tests that the tombstones are saved to the tombstone file and loaded from
+// it, and that logins of tombstoned users fail with MigratedErr.
+func TestMigration_addTombstone(t *testing.T) {
+	params := map[string]interface{}{
+		"tombstonePath": filepath.Join(t.TempDir(), "tombstones.json")}
+	m, err := NewMigration(params)
+	if err != nil {
+		t.Fatalf("Failed to create migration: %+v", err)
+	}
+	if err = m.addTombstone("waldo", "new:22841"); err != nil {
+		t.Fatalf("Failed to add tombstone: %+v", err)
+	}
+
+	if m, err = NewMigration(params); err != nil {
+		t.Fatalf("Failed to load migration: %+v", err)
+	}
+	if destination, migrated := m.Destination("waldo"); !migrated ||
+		destination != "new:22841" {
+		t.Errorf("Unexpected destination %q (migrated: %t).",
+			destination, migrated)
+	}
+	if err = m.checkLogin("waldo"); !errors.Is(err, MigratedErr) {
+		t.Errorf("Unexpected error for tombstoned user: %+v", err)
+	}
+	if err = m.checkLogin("carmen"); err != nil {
+		t.Errorf("Unexpected error for user: %+v", err)
+	}
+}
+
+// Tests that exportPage splits the files into pages once their data reaches
+// maxExportPageBytes, and continues after the file in the page token.
+func Test_exportPage(t *testing.T) {
+	data := bytes.Repeat([]byte("a"), maxExportPageBytes/2+1)
+	files := []string{"a", "b", "c"}
+	s := writeTestFiles(newTestGCStore(false, t), "waldo", t)
+	for _, file := range files {
+		if err := s.Write(file, data); err != nil {
+			t.Fatalf("Failed to write %s: %+v", file, err)
+		}
+	}
+
+	var received []string
+	var pageToken string
+	for pages := 0; ; pages++ {
+		if pages == 3 {
+			t.Fatalf("Too many pages.")
+		}
+		page, next, err := exportPage(s, files, pageToken)
+		if err != nil {
+			t.Fatalf("Failed to export page %d: %+v", pages, err)
+		}
+		for _, file := range page {
+			if !bytes.Equal(data, file.GetData()) {
+				t.Errorf("Unexpected data of %s.", file.GetPath())
+			}
+			received = append(received, file.GetPath())
+		}
+		if pageToken = next; pageToken == "" {
+			break
+		}
+	}
+	if !reflect.DeepEqual(files, received) {
+		t.Errorf("Unexpected files.\nexpected: %v\nreceived: %v",
+			files, received)
+	}
+
+	_, _, err := exportPage(s, files, "!")
+	if !errors.Is(err, InvalidMigrationRequestErr) {
+		t.Errorf("Unexpected error for invalid page token: %+v", err)
+	}
+}
+
+// Tests that Import copies the files of the user from the source server and
+// tombstones the user on it, so that their files are deleted there and their
+// sessions and logins fail.
+func Test_handler_Import(t *testing.T) {
+	source, sourceAddress := newTestMigrationSource(t)
+	old, err := source.addSession("waldo")
+	if err != nil {
+		t.Fatalf("Failed to log in to source: %+v", err)
+	}
+	files := []string{"a", "dir/b"}
+	for _, file := range files {
+		if err = old.Write(file, []byte(file)); err != nil {
+			t.Fatalf("Failed to write %s: %+v", file, err)
+		}
+	}
+
+	h := newHandler("", time.Hour, rsCredentials.NewMemStore(nil), nil,
+		newTestGCStore(false, t))
+	h.migration = newTestMigration(sourceAddress, t)
+	s, err := h.addSession("waldo")
+	if err != nil {
+		t.Fatalf("Failed to log in: %+v", err)
+	}
+
+	resp, err := h.Import(context.Background(), &rpc.RsImportRequest{
+		Token: s.Value[:], Source: sourceAddress, SourceToken: old.Value[:]})
+	if err != nil {
+		t.Fatalf("Failed to import: %+v", err)
+	}
+	if resp.GetFiles() != 2 || resp.GetBytes() != 6 {
+		t.Errorf("Unexpected response: %v", resp)
+	}
+	received := listTestMigrationFiles(s, t)
+	if !reflect.DeepEqual(files, received) {
+		t.Errorf("Unexpected imported files.\nexpected: %v\nreceived: %v",
+			files, received)
+	}
+
+	if received = listTestMigrationFiles(old, t); len(received) != 0 {
+		t.Errorf("Files not deleted from source: %v", received)
+	}
+	_, err = source.getSession(Token(old.Value))
+	if !errors.Is(err, InvalidTokenErr) {
+		t.Errorf("Unexpected error for session on source: %+v", err)
+	}
+	if _, err = source.addSession("waldo"); !errors.Is(err, MigratedErr) {
+		t.Errorf("Unexpected error for login to source: %+v", err)
+	}
+}
+
+// Error path: Tests that Import fails without copying files from a source
+// that is not allowed, with an invalid source token, or while migration is
+// disabled.
+func Test_handler_Import_Error(t *testing.T) {
+	_, sourceAddress := newTestMigrationSource(t)
+	h := newHandler("", time.Hour, rsCredentials.NewMemStore(nil), nil,
+		newTestGCStore(false, t))
+	s, err := h.addSession("waldo")
+	if err != nil {
+		t.Fatalf("Failed to log in: %+v", err)
+	}
+	req := &rpc.RsImportRequest{Token: s.Value[:], Source: sourceAddress,
+		SourceToken: []byte("invalid")}
+
+	if _, err = h.Import(context.Background(), req); !errors.Is(
+		err, MigrationDisabledErr) {
+		t.Errorf("Unexpected error while disabled: %+v", err)
+	}
+
+	h.migration = newTestMigration("other:22841", t)
+	if _, err = h.Import(context.Background(), req); !errors.Is(
+		err, UnknownSourceErr) {
+		t.Errorf("Unexpected error for unknown source: %+v", err)
+	}
+
+	h.migration = newTestMigration(sourceAddress, t)
+	if _, err = h.Import(context.Background(), req); err == nil {
+		t.Errorf("Failed to get error for invalid source token.")
+	}
+	if files := listTestMigrationFiles(s, t); len(files) != 0 {
+		t.Errorf("Unexpected imported files: %v", files)
+	}
+}
+
+// Error path: Tests that Import rejects a page from a source that exports a
+// file with a path that is not sanitary, without importing any file of the
+// page or tombstoning the user on the source.
+func Test_handler_Import_InvalidPathError(t *testing.T) {
+	for _, invalid := range []string{"../x", "dir/../../x", "/etc/x", ""} {
+		source := &maliciousMigrationSource{files: []*rpc.RsExportedFile{
+			{Path: "a", Data: []byte("a")},
+			{Path: invalid, Data: []byte("x")},
+		}}
+		sourceAddress := serveTestMigration(source, t)
+		h := newHandler("", time.Hour, rsCredentials.NewMemStore(nil), nil,
+			newTestGCStore(false, t))
+		h.migration = newTestMigration(sourceAddress, t)
+		s, err := h.addSession("waldo")
+		if err != nil {
+			t.Fatalf("Failed to log in: %+v", err)
+		}
+
+		_, err = h.Import(context.Background(), &rpc.RsImportRequest{
+			Token: s.Value[:], Source: sourceAddress, SourceToken: []byte("t")})
+		if !errors.Is(err, store.InvalidPathErr) {
+			t.Errorf("Unexpected error for path %q."+
+				"\nexpected: %v\nreceived: %+v",
+				invalid, store.InvalidPathErr, err)
+		}
+		if files := listTestMigrationFiles(s, t); len(files) != 0 {
+			t.Errorf("Imported files for path %q: %v", invalid, files)
+		}
+		if source.tombstoned {
+			t.Errorf("Source tombstoned for path %q.", invalid)
+		}
+	}
+}
+
+// newTestMigrationSource returns the handler of a source server with
+// migration enabled that serves the Migration service on localhost with TLS,
+// and its address.
+func newTestMigrationSource(t *testing.T) (*handler, string) {
+	h := newHandler("", time.Hour, rsCredentials.NewMemStore(nil), nil,
+		newTestGCStore(false, t))
+	var err error
+	if h.migration, err = NewMigration(nil); err != nil {
+		t.Fatalf("Failed to create migration: %+v", err)
+	}
+	return h, serveTestMigration(&migrationEndpoints{h: h}, t)
+}
+
+// serveTestMigration serves the Migration service on localhost with TLS and
+// returns its address.
+func serveTestMigration(srv rpc.MigrationServer, t *testing.T) string {
+	cert := newTestCertificate(
+		t, []string{"localhost"}, time.Now().Add(time.Hour))
+	grpcServer := grpc.NewServer(grpc.Creds(credentials.NewTLS(
+		&tls.Config{Certificates: []tls.Certificate{*cert}})))
+	rpc.RegisterMigrationServer(grpcServer, srv)
+	l, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %+v", err)
+	}
+	go func() { _ = grpcServer.Serve(l) }()
+	t.Cleanup(grpcServer.Stop)
+
+	_, port, _ := net.SplitHostPort(l.Addr().String())
+	return net.JoinHostPort("localhost", port)
+}
+
+// maliciousMigrationSource is a source server that exports a single page of
+// files with arbitrary paths and records whether it was tombstoned.
+type maliciousMigrationSource struct {
+	rpc.UnimplementedMigrationServer
+	files      []*rpc.RsExportedFile
+	tombstoned bool
+}
+
+// Export returns the files of the source.
+func (m *maliciousMigrationSource) Export(
+	context.Context, *rpc.RsExportRequest) (*rpc.RsExportResponse, error) {
+	return &rpc.RsExportResponse{Files: m.files}, nil
+}
+
+// Tombstone records that the source was tombstoned.
+func (m *maliciousMigrationSource) Tombstone(context.Context,
+	*rpc.RsTombstoneRequest) (*rpc.RsTombstoneResponse, error) {
+	m.tombstoned = true
+	return &rpc.RsTombstoneResponse{}, nil
+}
+
+// newTestMigration returns a Migration that imports from the source without
+// verifying the self-signed certificate of newTestMigrationSource.
+func newTestMigration(source string, t *testing.T) *Migration {
+	m, err := NewMigration(map[string]interface{}{
+		"address": "new:22841", "sources": []interface{}{source}})
+	if err != nil {
+		t.Fatalf("Failed to create migration: %+v", err)
+	}
+	m.creds = credentials.NewTLS(&tls.Config{InsecureSkipVerify: true})
+	return m
+}
+
+// listTestMigrationFiles returns the files of the session.
+func listTestMigrationFiles(s *userSession, t *testing.T) []string {
+	files, err := listFiles(s)
+	if err != nil {
+		t.Fatalf("Failed to list files: %+v", err)
+	}
+	return files
+}
@@ -0,0 +1,184 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"strings"
+
+	"github.com/pkg/errors"
+	jww "github.com/spf13/jwalterweatherman"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+
+	"gitlab.com/elixxir/remoteSyncServer/rpc"
+	"gitlab.com/elixxir/remoteSyncServer/store"
+	"gitlab.com/xx_network/primitives/utils"
+)
+
+// Certificate fields that can be used as the username of a client.
+const (
+	UsernameFromCommonName = "cn"    // Subject common name
+	UsernameFromDNSName    = "dns"   // First DNS subject alternative name
+	UsernameFromEmail      = "email" // First email subject alternative name
+)
+
+// MTLSParams are the parameters for requiring clients to authenticate with a
+// certificate.
+type MTLSParams struct {
+	// CAPath is the path to the PEM-encoded CA certificates that client
+	// certificates must be signed by.
+	CAPath string `mapstructure:"caPath"`
+
+	// UsernameField is the certificate field used as the sync username
+	// ("cn", "dns", or "email"). Defaults to "cn".
+	UsernameField string `mapstructure:"usernameField"`
+}
+
+// MTLSAuthenticator verifies client certificates and maps them to sync
+// usernames. Clients must still log in and use tokens, but only as the user
+// named in their certificate.
+type MTLSAuthenticator struct {
+	clientCAs     *x509.CertPool
+	usernameField string
+}
+
+// NewMTLSAuthenticator creates a new MTLSAuthenticator from the parameters.
+func NewMTLSAuthenticator(
+	params map[string]interface{}) (*MTLSAuthenticator, error) {
+	var p MTLSParams
+	if err := decodeParams(params, &p, "mTLS"); err != nil {
+		return nil, err
+	}
+
+	switch p.UsernameField {
+	case "":
+		p.UsernameField = UsernameFromCommonName
+	case UsernameFromCommonName, UsernameFromDNSName, UsernameFromEmail:
+	default:
+		return nil, errors.Errorf("unknown username field %q (available: "+
+			"%s, %s, %s)", p.UsernameField, UsernameFromCommonName,
+			UsernameFromDNSName, UsernameFromEmail)
+	}
+
+	if p.CAPath == "" {
+		return nil, errors.New("mTLS CA path is required")
+	}
+	caPem, err := utils.ReadFile(p.CAPath)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read CA from %s", p.CAPath)
+	}
+	clientCAs := x509.NewCertPool()
+	if !clientCAs.AppendCertsFromPEM(caPem) {
+		return nil, errors.Errorf("no certificates found in %s", p.CAPath)
+	}
+
+	return &MTLSAuthenticator{
+		clientCAs:     clientCAs,
+		usernameField: p.UsernameField,
+	}, nil
+}
+
+// configureTLS sets the server TLS config to require clients to present a
+// certificate signed by one of the CAs.
+func (ma *MTLSAuthenticator) configureTLS(conf *tls.Config) {
+	conf.ClientCAs = ma.clientCAs
+	conf.ClientAuth = tls.RequireAndVerifyClientCert
+}
+
+// username returns the sync username in the client certificate.
+func (ma *MTLSAuthenticator) username(cert *x509.Certificate) (string, error) {
+	var username string
+	switch ma.usernameField {
+	case UsernameFromCommonName:
+		username = cert.Subject.CommonName
+	case UsernameFromDNSName:
+		if len(cert.DNSNames) > 0 {
+			username = cert.DNSNames[0]
+		}
+	case UsernameFromEmail:
+		if len(cert.EmailAddresses) > 0 {
+			username = cert.EmailAddresses[0]
+		}
+	}
+
+	if username == "" {
+		return "", errors.Errorf(
+			"client certificate has no %s to use as the username",
+			ma.usernameField)
+	}
+	if err := store.CheckUsername(username); err != nil {
+		return "", errors.Wrapf(err,
+			"client certificate %s %q is not a valid username",
+			ma.usernameField, username)
+	}
+
+	return username, nil
+}
+
+// peerUsername returns the sync username in the verified certificate of the
+// client that sent the request.
+func (ma *MTLSAuthenticator) peerUsername(ctx context.Context) (string, error) {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return "", errors.New("request has no peer information")
+	}
+	tlsInfo, ok := p.AuthInfo.(credentials.TLSInfo)
+	if !ok || len(tlsInfo.State.VerifiedChains) == 0 ||
+		len(tlsInfo.State.VerifiedChains[0]) == 0 {
+		return "", errors.New("request has no verified client certificate")
+	}
+
+	return ma.username(tlsInfo.State.VerifiedChains[0][0])
+}
+
+// interceptor returns a gRPC interceptor that rejects requests where the
+// username or the user of the token does not match the client certificate.
+// Admin requests are authorized by the admin key instead.
+func (ma *MTLSAuthenticator) interceptor(h *handler) grpc.UnaryServerInterceptor {
+	adminPrefix := "/" + rpc.Admin_ServiceDesc.ServiceName + "/"
+	return func(ctx context.Context, req interface{},
+		info *grpc.UnaryServerInfo, next grpc.UnaryHandler) (interface{}, error) {
+		if strings.HasPrefix(info.FullMethod, adminPrefix) {
+			return next(ctx, req)
+		}
+
+		username, err := ma.peerUsername(ctx)
+		if err != nil {
+			jww.DEBUG.Printf("Rejected %s: %+v", info.FullMethod, err)
+			return nil, status.Error(
+				codes.Unauthenticated, "invalid client certificate")
+		}
+
+		if msg, ok := req.(interface{ GetUsername() string }); ok &&
+			msg.GetUsername() != username {
+			jww.DEBUG.Printf("Rejected %s for %q from client %q.",
+				info.FullMethod, msg.GetUsername(), username)
+			return nil, status.Error(codes.PermissionDenied,
+				"username does not match client certificate")
+		}
+
+		if msg, ok := req.(interface{ GetToken() []byte }); ok {
+			tokenUser, exists :=
+				h.sessionUsername(UnmarshalToken(msg.GetToken()))
+			if exists && tokenUser != username {
+				jww.DEBUG.Printf("Rejected %s with token for %q from "+
+					"client %q.", info.FullMethod, tokenUser, username)
+				return nil, status.Error(codes.PermissionDenied,
+					"token does not match client certificate")
+			}
+		}
+
+		return next(ctx, req)
+	}
+}
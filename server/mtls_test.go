@@ -0,0 +1,208 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package server
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+
+	pb "gitlab.com/elixxir/comms/mixmessages"
+	"gitlab.com/elixxir/remoteSyncServer/rpc"
+	"gitlab.com/elixxir/remoteSyncServer/store"
+)
+
+// Tests that NewMTLSAuthenticator loads the CA and that it configures TLS to
+// require and verify client certificates signed by the CA.
+func TestNewMTLSAuthenticator(t *testing.T) {
+	caPath := writeTestCA(t)
+	ma, err := NewMTLSAuthenticator(map[string]interface{}{"caPath": caPath})
+	if err != nil {
+		t.Fatalf("Failed to create MTLSAuthenticator: %+v", err)
+	}
+	if ma.usernameField != UsernameFromCommonName {
+		t.Errorf("Unexpected default username field."+
+			"\nexpected: %q\nreceived: %q",
+			UsernameFromCommonName, ma.usernameField)
+	}
+
+	conf := &tls.Config{}
+	ma.configureTLS(conf)
+	if conf.ClientAuth != tls.RequireAndVerifyClientCert {
+		t.Errorf("Client certificates not required: %s", conf.ClientAuth)
+	}
+	if conf.ClientCAs == nil || !conf.ClientCAs.Equal(ma.clientCAs) {
+		t.Errorf("Client CAs not set.")
+	}
+}
+
+// Error path: Tests that NewMTLSAuthenticator returns an error for missing,
+// unknown, and invalid parameters.
+func TestNewMTLSAuthenticator_Error(t *testing.T) {
+	caPath := writeTestCA(t)
+	emptyPath := filepath.Join(t.TempDir(), "empty.pem")
+	if err := os.WriteFile(emptyPath, []byte("no certs"), 0600); err != nil {
+		t.Fatalf("Failed to write file: %+v", err)
+	}
+
+	for _, params := range []map[string]interface{}{
+		{},
+		{"caPath": emptyPath},
+		{"caPath": filepath.Join(t.TempDir(), "missing.pem")},
+		{"caPath": caPath, "usernameField": "serial"},
+		{"caPath": caPath, "clientAuth": "optional"},
+	} {
+		if _, err := NewMTLSAuthenticator(params); err == nil {
+			t.Errorf("Failed to get error for params %v.", params)
+		}
+	}
+}
+
+// Tests that MTLSAuthenticator.username returns the configured field of the
+// certificate and returns an error if it is missing or not a valid username.
+func TestMTLSAuthenticator_username(t *testing.T) {
+	cert := &x509.Certificate{
+		Subject:        pkix.Name{CommonName: "waldo"},
+		DNSNames:       []string{"carmen", "other"},
+		EmailAddresses: []string{"sandiego@example.com"},
+	}
+	tests := map[string]string{
+		UsernameFromCommonName: "waldo",
+		UsernameFromDNSName:    "carmen",
+		UsernameFromEmail:      "sandiego@example.com",
+	}
+
+	for field, expected := range tests {
+		ma := &MTLSAuthenticator{usernameField: field}
+		username, err := ma.username(cert)
+		if err != nil {
+			t.Errorf("Failed to get username from %s: %+v", field, err)
+		} else if username != expected {
+			t.Errorf("Unexpected username from %s."+
+				"\nexpected: %q\nreceived: %q", field, expected, username)
+		}
+
+		if _, err = ma.username(&x509.Certificate{
+			Subject: pkix.Name{CommonName: ".."}}); err == nil {
+			t.Errorf("Failed to get error for invalid %s.", field)
+		}
+	}
+
+	ma := &MTLSAuthenticator{usernameField: UsernameFromDNSName}
+	if _, err := ma.username(&x509.Certificate{}); err == nil {
+		t.Errorf("Failed to get error for missing DNS name.")
+	}
+}
+
+// Tests that the interceptor of MTLSAuthenticator only allows requests where
+// the username and the user of the token match the client certificate.
+func TestMTLSAuthenticator_interceptor(t *testing.T) {
+	h := newHandler("", time.Hour, nil, nil, store.NewMemStore)
+	waldo, err := h.addSession("waldo")
+	if err != nil {
+		t.Fatalf("Failed to add session: %+v", err)
+	}
+	carmen, err := h.addSession("carmen")
+	if err != nil {
+		t.Fatalf("Failed to add session: %+v", err)
+	}
+
+	ma := &MTLSAuthenticator{usernameField: UsernameFromCommonName}
+	interceptor := ma.interceptor(h)
+	next := func(context.Context, interface{}) (interface{}, error) {
+		return "ok", nil
+	}
+
+	ctx := newTestPeerContext("waldo")
+	info := &grpc.UnaryServerInfo{FullMethod: "/remoteSync.Session/Test"}
+	tests := []struct {
+		ctx      context.Context
+		info     *grpc.UnaryServerInfo
+		req      interface{}
+		expected codes.Code
+	}{
+		{ctx, info, &rpc.RsPasswordLoginRequest{Username: "waldo"}, codes.OK},
+		{ctx, info, &rpc.RsPasswordLoginRequest{Username: "carmen"},
+			codes.PermissionDenied},
+		{ctx, info, &pb.RsReadRequest{Token: waldo.Value[:]}, codes.OK},
+		{ctx, info, &pb.RsReadRequest{Token: carmen.Value[:]},
+			codes.PermissionDenied},
+		{ctx, info, &pb.RsReadRequest{Token: []byte{1, 2, 3}}, codes.OK},
+		{context.Background(), info,
+			&rpc.RsPasswordLoginRequest{Username: "waldo"},
+			codes.Unauthenticated},
+		{context.Background(),
+			&grpc.UnaryServerInfo{FullMethod: "/remoteSync.Admin/RevokeUser"},
+			&rpc.RsRevokeUserRequest{Username: "carmen"}, codes.OK},
+	}
+
+	for i, tt := range tests {
+		_, err = interceptor(tt.ctx, tt.req, tt.info, next)
+		if code := status.Code(err); code != tt.expected {
+			t.Errorf("Unexpected code (%d).\nexpected: %s\nreceived: %s",
+				i, tt.expected, code)
+		}
+	}
+}
+
+// newTestPeerContext returns a context containing peer information with a
+// verified client certificate for the common name.
+func newTestPeerContext(commonName string) context.Context {
+	cert := &x509.Certificate{Subject: pkix.Name{CommonName: commonName}}
+	return peer.NewContext(context.Background(), &peer.Peer{
+		AuthInfo: credentials.TLSInfo{State: tls.ConnectionState{
+			VerifiedChains: [][]*x509.Certificate{{cert}},
+		}},
+	})
+}
+
+// writeTestCA writes a self-signed CA certificate to a temporary file and
+// returns its path.
+func writeTestCA(t testing.TB) string {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %+v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(
+		rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("Failed to create certificate: %+v", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "ca.pem")
+	data := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	if err = os.WriteFile(path, data, 0600); err != nil {
+		t.Fatalf("Failed to write CA: %+v", err)
+	}
+	return path
+}
@@ -0,0 +1,421 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	jww "github.com/spf13/jwalterweatherman"
+	"golang.org/x/crypto/ocsp"
+
+	"gitlab.com/xx_network/primitives/utils"
+)
+
+const (
+	defaultOCSPCacheDir = "~/ocsp"
+	defaultOCSPTimeout  = 10 * time.Second
+
+	// ocspCheckInterval is how often the staples are checked for refresh.
+	// Failed refreshes are retried at the same interval.
+	ocspCheckInterval = time.Hour
+
+	// ocspMaxResponseSize is the largest OCSP response that is read.
+	ocspMaxResponseSize = 1 << 20
+
+	// ocspCacheFileExt is the extension of the OCSP responses saved in the
+	// cache directory, which are named after the certificate fingerprint.
+	ocspCacheFileExt = ".ocsp"
+)
+
+// tlsFeatureOID is the OID of the TLS feature extension (RFC 7633), which
+// marks certificates as must-staple when it contains status_request.
+var tlsFeatureOID = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 1, 24}
+
+// tlsFeatureStatusRequest is the TLS feature for OCSP stapling.
+const tlsFeatureStatusRequest = 5
+
+// OCSPParams are the parameters for stapling OCSP responses to the server
+// certificate.
+type OCSPParams struct {
+	// CacheDir is the directory where OCSP responses are saved so that they
+	// can be stapled immediately after a restart. Defaults to "~/ocsp".
+	CacheDir string `mapstructure:"cacheDir"`
+
+	// ResponderURL overrides the OCSP responder in the certificate.
+	ResponderURL string `mapstructure:"responderURL"`
+
+	// Timeout is the maximum duration of a request to the responder. Defaults
+	// to 10s.
+	Timeout time.Duration `mapstructure:"timeout"`
+}
+
+// OCSPStapler fetches OCSP responses for the server certificates from their
+// CA and staples them to the TLS handshake. Responses are cached on disk and
+// refreshed in the background halfway through their validity.
+type OCSPStapler struct {
+	params OCSPParams
+	client *http.Client
+
+	// staples maps certificate fingerprints to their OCSP responses.
+	staples map[string]*ocspStaple
+
+	// pending contains the fingerprints of new certificates whose staples are
+	// being added in the background.
+	pending map[string]bool
+	mux     sync.Mutex
+}
+
+// ocspStaple is the OCSP response for a certificate.
+type ocspStaple struct {
+	leaf, issuer *x509.Certificate
+
+	// raw is the DER-encoded response to staple. It is nil until a valid
+	// response has been fetched.
+	raw        []byte
+	thisUpdate time.Time
+	nextUpdate time.Time
+
+	// fetching is true while a response is being fetched in the background.
+	fetching bool
+}
+
+// NewOCSPStapler creates a new OCSPStapler from the parameters.
+func NewOCSPStapler(params map[string]interface{}) (*OCSPStapler, error) {
+	p := OCSPParams{
+		CacheDir: defaultOCSPCacheDir,
+		Timeout:  defaultOCSPTimeout,
+	}
+	err := decodeParams(params, &p, "OCSP")
+	if err != nil {
+		return nil, err
+	}
+
+	p.CacheDir, err = utils.ExpandPath(p.CacheDir)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid OCSP cache directory %q",
+			p.CacheDir)
+	}
+	if err = os.MkdirAll(p.CacheDir, acmeCacheDirPerm); err != nil {
+		return nil, errors.Wrapf(err,
+			"failed to create OCSP cache directory %s", p.CacheDir)
+	}
+
+	return &OCSPStapler{
+		params:  p,
+		client:  &http.Client{Timeout: p.Timeout},
+		staples: make(map[string]*ocspStaple),
+		pending: make(map[string]bool),
+	}, nil
+}
+
+// add obtains a valid OCSP response for the certificate from the cache or
+// its responder so that it is stapled from the first handshake.
+func (st *OCSPStapler) add(cert *tls.Certificate) error {
+	s, err := newOCSPStaple(cert)
+	if err != nil {
+		return err
+	}
+	key := fingerprint(s.leaf.Raw)
+
+	if err = st.loadCached(key, s); err != nil {
+		jww.WARN.Printf("Ignoring cached OCSP response: %+v", err)
+	}
+	fresh := !s.needsRefresh(time.Now())
+
+	st.mux.Lock()
+	st.staples[key] = s
+	st.mux.Unlock()
+
+	if fresh {
+		return nil
+	}
+	return st.update(key, s)
+}
+
+// staple returns a copy of the certificate with its OCSP response. If the
+// certificate is new, such as after an ACME renewal, its response is fetched
+// in the background and the certificate is returned without a staple.
+func (st *OCSPStapler) staple(cert *tls.Certificate) *tls.Certificate {
+	if len(cert.Certificate) == 0 {
+		return cert
+	}
+	key := fingerprint(cert.Certificate[0])
+
+	st.mux.Lock()
+	s, exists := st.staples[key]
+	var raw []byte
+	if exists && time.Now().Before(s.nextUpdate) {
+		raw = s.raw
+	}
+	if !exists && !st.pending[key] {
+		st.pending[key] = true
+		go func() {
+			if err := st.add(cert); err != nil {
+				jww.ERROR.Printf("Failed to get OCSP response for new "+
+					"certificate: %+v", err)
+			}
+			st.mux.Lock()
+			delete(st.pending, key)
+			st.mux.Unlock()
+		}()
+	}
+	st.mux.Unlock()
+
+	if raw == nil {
+		return cert
+	}
+	stapled := *cert
+	stapled.OCSPStaple = raw
+	return &stapled
+}
+
+// refresh fetches new OCSP responses every interval for staples that are
+// halfway through their validity until the stop channel is closed. Staples of
+// expired certificates are removed.
+func (st *OCSPStapler) refresh(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case now := <-ticker.C:
+			st.mux.Lock()
+			due := make(map[string]*ocspStaple)
+			for key, s := range st.staples {
+				if now.After(s.leaf.NotAfter) {
+					delete(st.staples, key)
+					_ = st.removeCached(key)
+				} else if s.needsRefresh(now) && !s.fetching {
+					due[key] = s
+				}
+			}
+			st.mux.Unlock()
+
+			for key, s := range due {
+				if err := st.update(key, s); err != nil {
+					jww.ERROR.Printf("Failed to refresh OCSP response; "+
+						"retrying in %s: %+v", interval, err)
+				}
+			}
+		}
+	}
+}
+
+// update fetches a new response for the staple from its responder, saves it
+// to the cache, and starts stapling it.
+func (st *OCSPStapler) update(key string, s *ocspStaple) error {
+	st.mux.Lock()
+	s.fetching = true
+	st.mux.Unlock()
+	defer func() {
+		st.mux.Lock()
+		s.fetching = false
+		st.mux.Unlock()
+	}()
+
+	raw, resp, err := st.fetch(s.leaf, s.issuer)
+	if err != nil {
+		return err
+	}
+
+	st.mux.Lock()
+	s.raw, s.thisUpdate, s.nextUpdate = raw, resp.ThisUpdate, resp.NextUpdate
+	st.mux.Unlock()
+
+	if err = writeCacheFile(st.cachePath(key), raw); err != nil {
+		jww.WARN.Printf("Failed to cache OCSP response: %+v", err)
+	}
+
+	jww.INFO.Printf("Stapling OCSP response for certificate %s valid until "+
+		"%s.", s.leaf.SerialNumber, resp.NextUpdate)
+	return nil
+}
+
+// fetch requests the status of the certificate from its OCSP responder.
+// Returns an error unless the certificate is good.
+func (st *OCSPStapler) fetch(
+	leaf, issuer *x509.Certificate) ([]byte, *ocsp.Response, error) {
+	responderURL := st.params.ResponderURL
+	if responderURL == "" {
+		if len(leaf.OCSPServer) == 0 {
+			return nil, nil, errors.New("certificate has no OCSP responder")
+		}
+		responderURL = leaf.OCSPServer[0]
+	}
+
+	req, err := ocsp.CreateRequest(leaf, issuer, nil)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "failed to create OCSP request")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), st.params.Timeout)
+	defer cancel()
+	httpReq, err := http.NewRequestWithContext(
+		ctx, http.MethodPost, responderURL, bytes.NewReader(req))
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "failed to create HTTP request")
+	}
+	httpReq.Header.Set("Content-Type", "application/ocsp-request")
+	httpReq.Header.Set("Accept", "application/ocsp-response")
+
+	httpResp, err := st.client.Do(httpReq)
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "failed to contact OCSP responder %s",
+			responderURL)
+	}
+	defer func() { _ = httpResp.Body.Close() }()
+	if httpResp.StatusCode != http.StatusOK {
+		return nil, nil, errors.Errorf("OCSP responder %s returned %s",
+			responderURL, httpResp.Status)
+	}
+	raw, err := io.ReadAll(io.LimitReader(httpResp.Body, ocspMaxResponseSize))
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "failed to read OCSP response")
+	}
+
+	resp, err := parseOCSPResponse(raw, leaf, issuer, time.Now())
+	if err != nil {
+		return nil, nil, err
+	}
+	return raw, resp, nil
+}
+
+// loadCached sets the response of the staple to the cached response if it is
+// still valid.
+func (st *OCSPStapler) loadCached(key string, s *ocspStaple) error {
+	raw, err := os.ReadFile(st.cachePath(key))
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	resp, err := parseOCSPResponse(raw, s.leaf, s.issuer, time.Now())
+	if err != nil {
+		return err
+	}
+	s.raw, s.thisUpdate, s.nextUpdate = raw, resp.ThisUpdate, resp.NextUpdate
+	return nil
+}
+
+// removeCached deletes the cached response for the certificate with the
+// fingerprint.
+func (st *OCSPStapler) removeCached(key string) error {
+	err := os.Remove(st.cachePath(key))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// cachePath returns the path of the cached response for the certificate with
+// the fingerprint.
+func (st *OCSPStapler) cachePath(key string) string {
+	return filepath.Join(st.params.CacheDir, key+ocspCacheFileExt)
+}
+
+// needsRefresh returns true if the staple has no response or is at least
+// halfway through its validity at the given time.
+func (s *ocspStaple) needsRefresh(now time.Time) bool {
+	if s.raw == nil {
+		return true
+	}
+	refreshAt := s.thisUpdate.Add(s.nextUpdate.Sub(s.thisUpdate) / 2)
+	return !now.Before(refreshAt)
+}
+
+// newOCSPStaple returns an empty staple for the certificate. The chain must
+// include the issuer of the leaf.
+func newOCSPStaple(cert *tls.Certificate) (*ocspStaple, error) {
+	if len(cert.Certificate) < 2 {
+		return nil, errors.New("certificate chain must include the issuer " +
+			"for OCSP stapling")
+	}
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to parse certificate")
+	}
+	issuer, err := x509.ParseCertificate(cert.Certificate[1])
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to parse issuer certificate")
+	}
+
+	return &ocspStaple{leaf: leaf, issuer: issuer}, nil
+}
+
+// parseOCSPResponse parses and verifies the OCSP response for the certificate.
+// Returns an error if the certificate is not good or the response has expired
+// at the given time.
+func parseOCSPResponse(raw []byte, leaf, issuer *x509.Certificate,
+	now time.Time) (*ocsp.Response, error) {
+	resp, err := ocsp.ParseResponseForCert(raw, leaf, issuer)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid OCSP response")
+	}
+
+	switch resp.Status {
+	case ocsp.Good:
+	case ocsp.Revoked:
+		return nil, errors.Errorf("certificate %s was revoked at %s",
+			leaf.SerialNumber, resp.RevokedAt)
+	default:
+		return nil, errors.Errorf("OCSP status of certificate %s is unknown",
+			leaf.SerialNumber)
+	}
+
+	if resp.NextUpdate.IsZero() {
+		return nil, errors.New("OCSP response has no next update time")
+	} else if !now.Before(resp.NextUpdate) {
+		return nil, errors.Errorf("OCSP response expired at %s",
+			resp.NextUpdate)
+	}
+
+	return resp, nil
+}
+
+// mustStaple returns true if the certificate has the TLS feature extension
+// requiring an OCSP staple.
+func mustStaple(leaf *x509.Certificate) bool {
+	for _, ext := range leaf.Extensions {
+		if !ext.Id.Equal(tlsFeatureOID) {
+			continue
+		}
+		var features []int
+		if _, err := asn1.Unmarshal(ext.Value, &features); err != nil {
+			return false
+		}
+		for _, feature := range features {
+			if feature == tlsFeatureStatusRequest {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// fingerprint returns the SHA-256 hash of the DER-encoded certificate, which
+// identifies its staple.
+func fingerprint(der []byte) string {
+	h := sha256.Sum256(der)
+	return hex.EncodeToString(h[:])
+}
@@ -0,0 +1,285 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package server
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ocsp"
+)
+
+// Tests that OCSPStapler.add fetches a response that is stapled to the
+// certificate and cached, and that a new stapler uses the cached response
+// without contacting the responder.
+func TestOCSPStapler_add(t *testing.T) {
+	responder := newTestOCSPResponder(t, ocsp.Good)
+	cert := responder.newCertificate(t, false)
+	cacheDir := t.TempDir()
+
+	st, err := NewOCSPStapler(map[string]interface{}{"cacheDir": cacheDir})
+	if err != nil {
+		t.Fatalf("Failed to create OCSPStapler: %+v", err)
+	}
+	if err = st.add(cert); err != nil {
+		t.Fatalf("Failed to add certificate: %+v", err)
+	}
+	if n := responder.requests.Load(); n != 1 {
+		t.Errorf("Unexpected number of OCSP requests."+
+			"\nexpected: %d\nreceived: %d", 1, n)
+	}
+
+	stapled := st.staple(cert)
+	if len(stapled.OCSPStaple) == 0 {
+		t.Fatalf("Certificate not stapled.")
+	}
+	if cert.OCSPStaple != nil {
+		t.Errorf("Original certificate was modified.")
+	}
+	cached, err := os.ReadFile(st.cachePath(fingerprint(cert.Certificate[0])))
+	if err != nil {
+		t.Fatalf("Failed to read cached response: %+v", err)
+	}
+	if !bytes.Equal(cached, stapled.OCSPStaple) {
+		t.Errorf("Cached response does not match staple.")
+	}
+
+	st, err = NewOCSPStapler(map[string]interface{}{"cacheDir": cacheDir})
+	if err != nil {
+		t.Fatalf("Failed to create OCSPStapler: %+v", err)
+	}
+	if err = st.add(cert); err != nil {
+		t.Fatalf("Failed to add certificate: %+v", err)
+	}
+	if n := responder.requests.Load(); n != 1 {
+		t.Errorf("Cached response not used.")
+	}
+	if !bytes.Equal(cached, st.staple(cert).OCSPStaple) {
+		t.Errorf("Cached response not stapled.")
+	}
+}
+
+// Error path: Tests that OCSPStapler.add returns an error when the
+// certificate is revoked, has no issuer in its chain, or has no responder.
+func TestOCSPStapler_add_Error(t *testing.T) {
+	responder := newTestOCSPResponder(t, ocsp.Revoked)
+	st, err := NewOCSPStapler(map[string]interface{}{"cacheDir": t.TempDir()})
+	if err != nil {
+		t.Fatalf("Failed to create OCSPStapler: %+v", err)
+	}
+
+	cert := responder.newCertificate(t, false)
+	if err = st.add(cert); err == nil {
+		t.Errorf("Failed to get error for revoked certificate.")
+	}
+	if len(st.staple(cert).OCSPStaple) != 0 {
+		t.Errorf("Revoked certificate was stapled.")
+	}
+
+	leafOnly := &tls.Certificate{Certificate: cert.Certificate[:1]}
+	if err = st.add(leafOnly); err == nil {
+		t.Errorf("Failed to get error for missing issuer.")
+	}
+
+	responder.url = ""
+	if err = st.add(responder.newCertificate(t, false)); err == nil {
+		t.Errorf("Failed to get error for missing responder.")
+	}
+}
+
+// Error path: Tests that NewOCSPStapler returns an error for unknown and
+// invalid parameters.
+func TestNewOCSPStapler_Error(t *testing.T) {
+	for _, params := range []map[string]interface{}{
+		{"cacheDir": t.TempDir(), "timeout": "soon"},
+		{"cacheDir": t.TempDir(), "mustStaple": true},
+	} {
+		if _, err := NewOCSPStapler(params); err == nil {
+			t.Errorf("Failed to get error for params %v.", params)
+		}
+	}
+}
+
+// Tests that OCSPStapler.staple fetches the response of a new certificate in
+// the background.
+func TestOCSPStapler_staple_NewCertificate(t *testing.T) {
+	responder := newTestOCSPResponder(t, ocsp.Good)
+	cert := responder.newCertificate(t, false)
+	st, err := NewOCSPStapler(map[string]interface{}{"cacheDir": t.TempDir()})
+	if err != nil {
+		t.Fatalf("Failed to create OCSPStapler: %+v", err)
+	}
+
+	if len(st.staple(cert).OCSPStaple) != 0 {
+		t.Errorf("New certificate stapled before response was fetched.")
+	}
+
+	for i := 0; len(st.staple(cert).OCSPStaple) == 0; i++ {
+		if i == 100 {
+			t.Fatalf("Response for new certificate not fetched.")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n := responder.requests.Load(); n != 1 {
+		t.Errorf("Unexpected number of OCSP requests."+
+			"\nexpected: %d\nreceived: %d", 1, n)
+	}
+}
+
+// Tests that ocspStaple.needsRefresh returns true without a response and once
+// the response is halfway through its validity.
+func Test_ocspStaple_needsRefresh(t *testing.T) {
+	now := time.Now()
+	s := &ocspStaple{}
+	if !s.needsRefresh(now) {
+		t.Errorf("Staple without response does not need refresh.")
+	}
+
+	s.raw = []byte("response")
+	s.thisUpdate, s.nextUpdate = now.Add(-time.Hour), now.Add(3*time.Hour)
+	if s.needsRefresh(now) {
+		t.Errorf("Fresh staple needs refresh.")
+	}
+	if !s.needsRefresh(now.Add(time.Hour)) {
+		t.Errorf("Staple halfway through its validity does not need refresh.")
+	}
+}
+
+// Tests that mustStaple detects the TLS feature extension.
+func Test_mustStaple(t *testing.T) {
+	responder := newTestOCSPResponder(t, ocsp.Good)
+	for _, expected := range []bool{true, false} {
+		cert := responder.newCertificate(t, expected)
+		leaf, err := x509.ParseCertificate(cert.Certificate[0])
+		if err != nil {
+			t.Fatalf("Failed to parse certificate: %+v", err)
+		}
+		if mustStaple(leaf) != expected {
+			t.Errorf("Unexpected must-staple.\nexpected: %t\nreceived: %t",
+				expected, !expected)
+		}
+	}
+}
+
+// testOCSPResponder is a CA with an OCSP responder that returns the same
+// status for every certificate.
+type testOCSPResponder struct {
+	ca       *x509.Certificate
+	key      crypto.Signer
+	url      string
+	requests atomic.Int32
+}
+
+// newTestOCSPResponder starts an OCSP responder for a new test CA.
+func newTestOCSPResponder(t testing.TB, status int) *testOCSPResponder {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %+v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(
+		rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("Failed to create CA: %+v", err)
+	}
+	ca, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("Failed to parse CA: %+v", err)
+	}
+
+	r := &testOCSPResponder{ca: ca, key: key}
+	server := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, req *http.Request) {
+			r.requests.Add(1)
+			body, _ := io.ReadAll(req.Body)
+			ocspReq, err := ocsp.ParseRequest(body)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			resp, err := ocsp.CreateResponse(ca, ca, ocsp.Response{
+				Status:       status,
+				SerialNumber: ocspReq.SerialNumber,
+				ThisUpdate:   time.Now().Add(-time.Minute),
+				NextUpdate:   time.Now().Add(time.Hour),
+				RevokedAt:    time.Now().Add(-time.Minute),
+			}, key)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			_, _ = w.Write(resp)
+		}))
+	t.Cleanup(server.Close)
+	r.url = server.URL
+
+	return r
+}
+
+// newCertificate returns a certificate chain with a new leaf signed by the CA
+// that names the responder.
+func (r *testOCSPResponder) newCertificate(
+	t testing.TB, mustStaple bool) *tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %+v", err)
+	}
+	serial, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	if err != nil {
+		t.Fatalf("Failed to generate serial: %+v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: "localhost"},
+		DNSNames:     []string{"localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(24 * time.Hour),
+	}
+	if r.url != "" {
+		template.OCSPServer = []string{r.url}
+	}
+	if mustStaple {
+		value, err := asn1.Marshal([]int{tlsFeatureStatusRequest})
+		if err != nil {
+			t.Fatalf("Failed to encode TLS feature: %+v", err)
+		}
+		template.ExtraExtensions = []pkix.Extension{
+			{Id: tlsFeatureOID, Value: value}}
+	}
+
+	der, err := x509.CreateCertificate(
+		rand.Reader, template, r.ca, &key.PublicKey, r.key)
+	if err != nil {
+		t.Fatalf("Failed to create certificate: %+v", err)
+	}
+	return &tls.Certificate{
+		Certificate: [][]byte{der, r.ca.Raw}, PrivateKey: key}
+}
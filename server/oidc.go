@@ -0,0 +1,187 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package server
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/pkg/errors"
+	jww "github.com/spf13/jwalterweatherman"
+	"golang.org/x/oauth2"
+
+	"gitlab.com/elixxir/remoteSyncServer/store"
+)
+
+// defaultUsernameClaim is the ID token claim used as the username when none is
+// configured.
+const defaultUsernameClaim = "sub"
+
+// OIDCDisabledErr is returned when logging in with OIDC while no provider is
+// configured.
+var OIDCDisabledErr = errors.New("OIDC authentication is not enabled")
+
+// OIDCParams are the parameters for authenticating users with an OpenID
+// Connect provider.
+type OIDCParams struct {
+	// IssuerURL is the URL of the provider. Its configuration is discovered
+	// from "<IssuerURL>/.well-known/openid-configuration".
+	IssuerURL string `mapstructure:"issuerURL"`
+
+	// ClientID is the client ID registered with the provider. ID tokens must
+	// be issued to this client.
+	ClientID string `mapstructure:"clientID"`
+
+	// ClientSecret is used to exchange authorization codes for ID tokens. It
+	// is only required if clients log in with an authorization code.
+	ClientSecret string `mapstructure:"clientSecret"`
+
+	// UsernameClaim is the ID token claim used as the sync username. Defaults
+	// to "sub".
+	UsernameClaim string `mapstructure:"usernameClaim"`
+
+	// Usernames optionally maps values of the username claim to sync
+	// usernames. If it is set, only the listed users can log in. Claim values
+	// are matched case-insensitively because config keys are not case
+	// sensitive.
+	Usernames map[string]string `mapstructure:"usernames"`
+}
+
+// OIDCAuthenticator verifies ID tokens issued by an OpenID Connect provider
+// and maps them to sync usernames.
+type OIDCAuthenticator struct {
+	verifier      *oidc.IDTokenVerifier
+	oauth2        oauth2.Config
+	usernameClaim string
+	usernames     map[string]string
+}
+
+// NewOIDCAuthenticator creates a new OIDCAuthenticator from the parameters.
+// The provider configuration is fetched from the issuer, so the provider must
+// be reachable.
+func NewOIDCAuthenticator(ctx context.Context,
+	params map[string]interface{}) (*OIDCAuthenticator, error) {
+	var p OIDCParams
+	if err := decodeParams(params, &p, "OIDC"); err != nil {
+		return nil, err
+	}
+
+	if p.IssuerURL == "" || p.ClientID == "" {
+		return nil, errors.New("OIDC issuer URL and client ID are required")
+	}
+	if p.UsernameClaim == "" {
+		p.UsernameClaim = defaultUsernameClaim
+	}
+	var usernames map[string]string
+	if p.Usernames != nil {
+		usernames = make(map[string]string, len(p.Usernames))
+		for claim, username := range p.Usernames {
+			usernames[strings.ToLower(claim)] = username
+		}
+	}
+
+	provider, err := oidc.NewProvider(ctx, p.IssuerURL)
+	if err != nil {
+		return nil, errors.Wrapf(err,
+			"failed to get OIDC provider configuration for %s", p.IssuerURL)
+	}
+
+	return &OIDCAuthenticator{
+		verifier: provider.Verifier(&oidc.Config{ClientID: p.ClientID}),
+		oauth2: oauth2.Config{
+			ClientID:     p.ClientID,
+			ClientSecret: p.ClientSecret,
+			Endpoint:     provider.Endpoint(),
+			Scopes:       []string{oidc.ScopeOpenID},
+		},
+		usernameClaim: p.UsernameClaim,
+		usernames:     usernames,
+	}, nil
+}
+
+// Authenticate verifies the ID token and returns the sync username it maps to.
+// If no ID token is given, the authorization code is first exchanged for one
+// using the redirect URL and optional PKCE code verifier that were used to
+// obtain the code.
+//
+// Returns [InvalidCredentialsErr] if the token or code is invalid or does not
+// map to a valid username.
+func (oa *OIDCAuthenticator) Authenticate(ctx context.Context, idToken, code,
+	redirectURL, codeVerifier string) (string, error) {
+	if idToken == "" && code != "" {
+		var err error
+		idToken, err = oa.exchange(ctx, code, redirectURL, codeVerifier)
+		if err != nil {
+			jww.DEBUG.Printf("Failed to exchange OIDC code: %+v", err)
+			return "", InvalidCredentialsErr
+		}
+	}
+
+	token, err := oa.verifier.Verify(ctx, idToken)
+	if err != nil {
+		jww.DEBUG.Printf("Failed to verify OIDC ID token: %+v", err)
+		return "", InvalidCredentialsErr
+	}
+
+	var claims map[string]interface{}
+	if err = token.Claims(&claims); err != nil {
+		jww.DEBUG.Printf("Failed to parse OIDC ID token claims: %+v", err)
+		return "", InvalidCredentialsErr
+	}
+
+	value, ok := claims[oa.usernameClaim]
+	if !ok {
+		jww.DEBUG.Printf("OIDC ID token for %q has no %q claim.",
+			token.Subject, oa.usernameClaim)
+		return "", InvalidCredentialsErr
+	}
+	username := fmt.Sprint(value)
+
+	if oa.usernames != nil {
+		username, ok = oa.usernames[strings.ToLower(username)]
+		if !ok {
+			jww.DEBUG.Printf("OIDC user %q is not mapped to a username.",
+				fmt.Sprint(value))
+			return "", InvalidCredentialsErr
+		}
+	}
+
+	if err = store.CheckUsername(username); err != nil {
+		jww.DEBUG.Printf("OIDC user %q has an invalid username.", username)
+		return "", InvalidCredentialsErr
+	}
+
+	return username, nil
+}
+
+// exchange exchanges the authorization code for an ID token.
+func (oa *OIDCAuthenticator) exchange(ctx context.Context,
+	code, redirectURL, codeVerifier string) (string, error) {
+	conf := oa.oauth2
+	conf.RedirectURL = redirectURL
+
+	var opts []oauth2.AuthCodeOption
+	if codeVerifier != "" {
+		opts = append(opts,
+			oauth2.SetAuthURLParam("code_verifier", codeVerifier))
+	}
+
+	token, err := conf.Exchange(ctx, code, opts...)
+	if err != nil {
+		return "", err
+	}
+
+	idToken, ok := token.Extra("id_token").(string)
+	if !ok {
+		return "", errors.New("token response has no ID token")
+	}
+
+	return idToken, nil
+}
@@ -0,0 +1,272 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-jose/go-jose/v3"
+
+	"gitlab.com/elixxir/remoteSyncServer/rpc"
+	"gitlab.com/elixxir/remoteSyncServer/store"
+)
+
+const testClientID = "remoteSync"
+
+// Tests that OIDCAuthenticator.Authenticate returns the username in the
+// configured claim of a valid ID token.
+func TestOIDCAuthenticator_Authenticate(t *testing.T) {
+	op := newTestOIDCProvider(t)
+	oa := op.newAuthenticator(
+		map[string]interface{}{"usernameClaim": "preferred_username"}, t)
+
+	username, err := oa.Authenticate(context.Background(),
+		op.sign(map[string]interface{}{"preferred_username": "waldo"}, t),
+		"", "", "")
+	if err != nil {
+		t.Fatalf("Failed to authenticate: %+v", err)
+	}
+	if username != "waldo" {
+		t.Errorf("Unexpected username.\nexpected: %q\nreceived: %q",
+			"waldo", username)
+	}
+}
+
+// Tests that OIDCAuthenticator.Authenticate exchanges an authorization code
+// for an ID token.
+func TestOIDCAuthenticator_Authenticate_Code(t *testing.T) {
+	op := newTestOIDCProvider(t)
+	oa := op.newAuthenticator(nil, t)
+	op.codes["code"] = op.sign(nil, t)
+
+	username, err := oa.Authenticate(
+		context.Background(), "", "code", "https://localhost/cb", "verifier")
+	if err != nil {
+		t.Fatalf("Failed to authenticate: %+v", err)
+	}
+	if username != "subject" {
+		t.Errorf("Unexpected username.\nexpected: %q\nreceived: %q",
+			"subject", username)
+	}
+}
+
+// Tests that OIDCAuthenticator.Authenticate maps the claim to a username when
+// a username map is configured and rejects unmapped users.
+func TestOIDCAuthenticator_Authenticate_Usernames(t *testing.T) {
+	op := newTestOIDCProvider(t)
+	oa := op.newAuthenticator(map[string]interface{}{
+		"usernames": map[string]interface{}{"subject": "waldo"}}, t)
+
+	username, err := oa.Authenticate(
+		context.Background(), op.sign(nil, t), "", "", "")
+	if err != nil {
+		t.Fatalf("Failed to authenticate: %+v", err)
+	}
+	if username != "waldo" {
+		t.Errorf("Unexpected username.\nexpected: %q\nreceived: %q",
+			"waldo", username)
+	}
+
+	_, err = oa.Authenticate(context.Background(),
+		op.sign(map[string]interface{}{"sub": "carmen"}, t), "", "", "")
+	if !errors.Is(err, InvalidCredentialsErr) {
+		t.Errorf("Unexpected error for unmapped user."+
+			"\nexpected: %v\nreceived: %+v", InvalidCredentialsErr, err)
+	}
+}
+
+// Error path: Tests that OIDCAuthenticator.Authenticate returns
+// InvalidCredentialsErr for invalid tokens, codes, and usernames.
+func TestOIDCAuthenticator_Authenticate_InvalidCredentialsError(t *testing.T) {
+	op := newTestOIDCProvider(t)
+	oa := op.newAuthenticator(nil, t)
+
+	type claims = map[string]interface{}
+	expired := time.Now().Add(-time.Minute).Unix()
+	tests := map[string][2]string{
+		"malformed token":  {"token", ""},
+		"wrong audience":   {op.sign(claims{"aud": "other"}, t), ""},
+		"wrong issuer":     {op.sign(claims{"iss": "https://x"}, t), ""},
+		"expired":          {op.sign(claims{"exp": expired}, t), ""},
+		"invalid username": {op.sign(claims{"sub": ".."}, t), ""},
+		"unknown code":     {"", "unknown"},
+	}
+
+	for name, tt := range tests {
+		_, err := oa.Authenticate(context.Background(), tt[0], tt[1], "", "")
+		if !errors.Is(err, InvalidCredentialsErr) {
+			t.Errorf("Unexpected error for %s.\nexpected: %v\nreceived: %+v",
+				name, InvalidCredentialsErr, err)
+		}
+	}
+}
+
+// Error path: Tests that NewOIDCAuthenticator returns an error for missing and
+// unknown parameters.
+func TestNewOIDCAuthenticator_InvalidParamsError(t *testing.T) {
+	op := newTestOIDCProvider(t)
+	for _, params := range []map[string]interface{}{
+		{"issuerURL": op.URL},
+		{"clientID": testClientID},
+		{"issuerURL": op.URL, "clientID": testClientID, "scope": "openid"},
+	} {
+		_, err := NewOIDCAuthenticator(context.Background(), params)
+		if err == nil {
+			t.Errorf("Failed to get error for params %v.", params)
+		}
+	}
+}
+
+// Tests that handler.OIDCLogin returns a token for a valid ID token.
+func Test_handler_OIDCLogin(t *testing.T) {
+	op := newTestOIDCProvider(t)
+	h := newHandler("", time.Hour, nil, nil, store.NewMemStore)
+	h.oidc = op.newAuthenticator(nil, t)
+
+	msg, err := h.OIDCLogin(context.Background(),
+		&rpc.RsOIDCLoginRequest{IDToken: op.sign(nil, t)})
+	if err != nil {
+		t.Fatalf("Failed to log in: %+v", err)
+	}
+	if msg.GetUsername() != "subject" {
+		t.Errorf("Unexpected username.\nexpected: %q\nreceived: %q",
+			"subject", msg.GetUsername())
+	}
+
+	s, err := h.getSession(UnmarshalToken(msg.GetToken()))
+	if err != nil {
+		t.Fatalf("Failed to get session for token: %+v", err)
+	}
+	if s.(*userSession).username != "subject" {
+		t.Errorf("Session for wrong user: %q", s.(*userSession).username)
+	}
+}
+
+// Error path: Tests that handler.OIDCLogin returns OIDCDisabledErr when no
+// provider is configured.
+func Test_handler_OIDCLogin_DisabledError(t *testing.T) {
+	h := newHandler("", time.Hour, nil, nil, store.NewMemStore)
+	_, err := h.OIDCLogin(
+		context.Background(), &rpc.RsOIDCLoginRequest{IDToken: "token"})
+	if !errors.Is(err, OIDCDisabledErr) {
+		t.Errorf("Unexpected error.\nexpected: %v\nreceived: %+v",
+			OIDCDisabledErr, err)
+	}
+}
+
+// testOIDCProvider is a minimal OpenID Connect provider that serves its
+// discovery document, signing keys, and token endpoint.
+type testOIDCProvider struct {
+	*httptest.Server
+	signer jose.Signer
+	codes  map[string]string // Map of authorization code to ID token
+}
+
+// newTestOIDCProvider starts a new testOIDCProvider that is closed when the
+// test ends.
+func newTestOIDCProvider(t testing.TB) *testOIDCProvider {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %+v", err)
+	}
+	jwk := jose.JSONWebKey{Key: key, KeyID: "key", Algorithm: "RS256"}
+	signer, err := jose.NewSigner(
+		jose.SigningKey{Algorithm: jose.RS256, Key: jwk}, nil)
+	if err != nil {
+		t.Fatalf("Failed to create signer: %+v", err)
+	}
+
+	op := &testOIDCProvider{signer: signer, codes: make(map[string]string)}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration",
+		func(w http.ResponseWriter, r *http.Request) {
+			writeJSON(w, map[string]interface{}{
+				"issuer":                                op.URL,
+				"authorization_endpoint":                op.URL + "/auth",
+				"token_endpoint":                        op.URL + "/token",
+				"jwks_uri":                              op.URL + "/keys",
+				"id_token_signing_alg_values_supported": []string{"RS256"},
+			})
+		})
+	mux.HandleFunc("/keys", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, jose.JSONWebKeySet{Keys: []jose.JSONWebKey{jwk.Public()}})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		idToken, exists := op.codes[r.FormValue("code")]
+		if !exists {
+			w.WriteHeader(http.StatusBadRequest)
+			writeJSON(w, map[string]string{"error": "invalid_grant"})
+			return
+		}
+		writeJSON(w, map[string]interface{}{"access_token": "access",
+			"token_type": "Bearer", "id_token": idToken})
+	})
+	op.Server = httptest.NewServer(mux)
+	t.Cleanup(op.Close)
+
+	return op
+}
+
+// newAuthenticator creates an OIDCAuthenticator for the provider. The params
+// are added to the issuer URL and client ID.
+func (op *testOIDCProvider) newAuthenticator(
+	params map[string]interface{}, t testing.TB) *OIDCAuthenticator {
+	p := map[string]interface{}{"issuerURL": op.URL, "clientID": testClientID}
+	for key, value := range params {
+		p[key] = value
+	}
+	oa, err := NewOIDCAuthenticator(context.Background(), p)
+	if err != nil {
+		t.Fatalf("Failed to create OIDCAuthenticator: %+v", err)
+	}
+	return oa
+}
+
+// sign returns a signed ID token for the subject "subject" that is valid for
+// the test client. The claims are added to or replace the default claims.
+func (op *testOIDCProvider) sign(
+	claims map[string]interface{}, t testing.TB) string {
+	c := map[string]interface{}{
+		"iss": op.URL,
+		"sub": "subject",
+		"aud": testClientID,
+		"iat": time.Now().Unix(),
+		"exp": time.Now().Add(time.Hour).Unix(),
+	}
+	for key, value := range claims {
+		c[key] = value
+	}
+
+	payload, err := json.Marshal(c)
+	if err != nil {
+		t.Fatalf("Failed to marshal claims: %+v", err)
+	}
+	jws, err := op.signer.Sign(payload)
+	if err != nil {
+		t.Fatalf("Failed to sign ID token: %+v", err)
+	}
+	token, err := jws.CompactSerialize()
+	if err != nil {
+		t.Fatalf("Failed to serialize ID token: %+v", err)
+	}
+	return token
+}
+
+// writeJSON writes the value as a JSON response.
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,38 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package server
+
+import (
+	"github.com/mitchellh/mapstructure"
+	"github.com/pkg/errors"
+)
+
+// decodeParams decodes the parameters of a config section into the value
+// pointed to by out, whose fields are left unchanged if not set so that they
+// can be preset to their defaults. Values are weakly typed so that parameters
+// set from strings (such as environment variables) are converted to the field
+// type, and durations are parsed from strings such as "1m30s". Returns an
+// error naming the section if the params contain a key with no matching field
+// or a value that cannot be decoded.
+func decodeParams(params, out interface{}, section string) error {
+	decoder, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{
+		DecodeHook:       mapstructure.StringToTimeDurationHookFunc(),
+		ErrorUnused:      true,
+		WeaklyTypedInput: true,
+		Result:           out,
+	})
+	if err != nil {
+		return errors.Wrap(err, "failed to create parameter decoder")
+	}
+
+	if err = decoder.Decode(params); err != nil {
+		return errors.Wrapf(err, "failed to decode %s parameters", section)
+	}
+
+	return nil
+}
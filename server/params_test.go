@@ -0,0 +1,140 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package server
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Tests that decodeParams decodes weakly typed values and durations and leaves
+// the fields that are not set at their preset values.
+func Test_decodeParams(t *testing.T) {
+	type testParams struct {
+		Name    string        `mapstructure:"name"`
+		Size    uint64        `mapstructure:"maxSize"`
+		Enabled bool          `mapstructure:"enabled"`
+		Timeout time.Duration `mapstructure:"timeout"`
+	}
+	expected := testParams{"default", 512, true, 3 * time.Second}
+
+	p := testParams{Name: "default"}
+	err := decodeParams(map[string]interface{}{
+		"maxSize": "512",
+		"enabled": "true",
+		"timeout": "3s",
+	}, &p, "test")
+	if err != nil {
+		t.Fatalf("Failed to decode params: %+v", err)
+	}
+
+	if !reflect.DeepEqual(expected, p) {
+		t.Errorf("Unexpected params.\nexpected: %+v\nreceived: %+v", expected, p)
+	}
+}
+
+// Error path: Tests that decodeParams returns an error naming the section for
+// a key that does not match any field.
+func Test_decodeParams_UnknownKeyError(t *testing.T) {
+	var p struct {
+		Name string `mapstructure:"name"`
+	}
+	err := decodeParams(map[string]interface{}{"nmae": "name"}, &p, "test")
+	if err == nil || !strings.Contains(err.Error(), "test parameters") {
+		t.Errorf("Unexpected error for unknown key: %+v", err)
+	}
+}
+
+// newTestFromParams returns the value created by the constructor from the
+// parameters of its config section.
+func newTestFromParams[T any](newT func(map[string]interface{}) (T, error),
+	params map[string]interface{}, t testing.TB) T {
+	v, err := newT(params)
+	if err != nil {
+		t.Fatalf("Failed to create %T from %v: %+v", v, params, err)
+	}
+	return v
+}
+
+// paramsErr returns a function that returns the error of the constructor for
+// the parameters, so that constructors of different types can be tested
+// together.
+func paramsErr[T any](newT func(map[string]interface{}) (T, error)) func(
+	map[string]interface{}) error {
+	return func(params map[string]interface{}) error {
+		_, err := newT(params)
+		return err
+	}
+}
+
+// Error path: Tests that the constructors of the features configured with a
+// config section return an error for unknown parameters and for values that
+// they cannot decode or that are out of range.
+func TestNewFromParams_Error(t *testing.T) {
+	tests := []struct {
+		name   string
+		newT   func(map[string]interface{}) error
+		params []map[string]interface{}
+	}{{
+		"IPFilter", paramsErr(NewIPFilter), []map[string]interface{}{
+			{"allow": []string{"10.0.0.0/33"}},
+			{"allow": []string{"localhost"}},
+			{"deny": []string{"10.0.0"}},
+		},
+	}, {
+		"AutoBan", paramsErr(NewAutoBan), []map[string]interface{}{
+			{"maxAuthFailures": -1},
+			{"maxMalformedRequests": -1},
+			{"maxAuthFailures": 0, "maxMalformedRequests": 0},
+			{"window": "0s"},
+			{"banDuration": "-1m"},
+			{"window": "soon"},
+			{"exempt": []string{"10.0.0.0/33"}},
+		},
+	}, {
+		"HTTPLimits", paramsErr(NewHTTPLimits), []map[string]interface{}{
+			{"maxHeaderBytes": -1},
+			{"maxBodyBytes": -1},
+			{"readHeaderTimeout": "-1s"},
+			{"writeTimeout": "-1m"},
+			{"idleTimeout": "later"},
+		},
+	}, {
+		"WebSecurity", paramsErr(NewWebSecurity), []map[string]interface{}{
+			{"allowedOrigins": []string{"app.example.com"}},
+			{"allowedOrigins": []string{"ftp://app.example.com"}},
+			{"allowedOrigins": []string{"https://app.example.com/path"}},
+			{"hstsMaxAge": "-1h"},
+			{"hstsIncludeSubdomains": true},
+			{"frameOptions": "ALLOW-FROM https://example.com"},
+		},
+	}, {
+		"LoginThrottle", paramsErr(NewLoginThrottle), []map[string]interface{}{
+			{"freeFailures": -1},
+			{"lockoutFailures": -1},
+			{"baseDelay": "0s"},
+			{"baseDelay": "1m", "maxDelay": "30s"},
+			{"lockoutDuration": "-1m"},
+			{"resetAfter": "0s"},
+			{"maxAccounts": 0},
+			{"baseDelay": "soon"},
+		},
+	}}
+
+	for _, tt := range tests {
+		for _, params := range append(
+			[]map[string]interface{}{{"unknown": 1}}, tt.params...) {
+			if err := tt.newT(params); err == nil {
+				t.Errorf("No error from New%s for parameters %+v.",
+					tt.name, params)
+			}
+		}
+	}
+}
@@ -0,0 +1,94 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package server
+
+import (
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// LockedErr is returned when another process holds a lock.
+var LockedErr = errors.New("locked by another process")
+
+// pidFilePerm is the permissions of the PID file, which init scripts read.
+const pidFilePerm = 0644
+
+// Lock is an exclusive lock on a file or directory, held until it is released
+// or the process exits, so that only one server uses it at a time.
+type Lock struct {
+	f *os.File
+}
+
+// LockDir locks the directory. If wait is false, returns an error wrapping
+// LockedErr if another process holds the lock; otherwise, waits for it to be
+// released. Directories cannot be locked on Windows, so it only opens them.
+func LockDir(dir string, wait bool) (*Lock, error) {
+	f, err := os.Open(dir)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to open %s", dir)
+	}
+	if err = lockFile(f, wait); err != nil {
+		_ = f.Close()
+		return nil, errors.Wrapf(err, "failed to lock %s", dir)
+	}
+	return &Lock{f}, nil
+}
+
+// Release releases the lock.
+func (l *Lock) Release() error {
+	return l.f.Close()
+}
+
+// PIDFile is a locked file containing the PID of the server, which init
+// scripts use to manage it.
+type PIDFile struct {
+	Lock
+	path string
+}
+
+// LockPIDFile locks the PID file, creating it if it does not exist, and
+// writes the PID of the process to it. If wait is false, returns an error
+// wrapping LockedErr, with the PID of the other process, if another process
+// holds the lock; otherwise, waits for it to be released.
+func LockPIDFile(path string, wait bool) (*PIDFile, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, pidFilePerm)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to open PID file %s", path)
+	}
+	if err = lockFile(f, wait); err != nil {
+		pid, _ := io.ReadAll(f)
+		_ = f.Close()
+		if errors.Is(err, LockedErr) {
+			return nil, errors.Wrapf(err, "PID file %s is held by process %s",
+				path, strings.TrimSpace(string(pid)))
+		}
+		return nil, errors.Wrapf(err, "failed to lock PID file %s", path)
+	}
+
+	if err = f.Truncate(0); err == nil {
+		_, err = f.WriteAt([]byte(strconv.Itoa(os.Getpid())+"\n"), 0)
+	}
+	if err != nil {
+		_ = f.Close()
+		return nil, errors.Wrapf(err, "failed to write PID file %s", path)
+	}
+	return &PIDFile{Lock{f}, path}, nil
+}
+
+// Remove removes the PID file and releases its lock.
+func (pf *PIDFile) Remove() error {
+	// Windows cannot remove open files, so it is closed first
+	if err := pf.Release(); err != nil {
+		return err
+	}
+	return os.Remove(pf.path)
+}
@@ -0,0 +1,133 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+//go:build !windows
+
+package server
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Tests that LockPIDFile writes the PID of the process to the file, that the
+// file cannot be locked again until it is removed, and that PIDFile.Remove
+// removes it.
+func TestLockPIDFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "server.pid")
+	if err := os.WriteFile(path, []byte("123456789\n"), 0644); err != nil {
+		t.Fatalf("Failed to write stale PID file: %+v", err)
+	}
+
+	pf, err := LockPIDFile(path, false)
+	if err != nil {
+		t.Fatalf("Failed to lock PID file: %+v", err)
+	}
+	pid := strconv.Itoa(os.Getpid())
+	data, err := os.ReadFile(path)
+	if err != nil || string(data) != pid+"\n" {
+		t.Errorf("Unexpected PID file contents."+
+			"\nexpected: %q\nreceived: %q, %v", pid+"\n", data, err)
+	}
+
+	_, err = LockPIDFile(path, false)
+	if !errors.Is(err, LockedErr) || !strings.Contains(err.Error(), pid) {
+		t.Errorf("Unexpected error for locked PID file.\nexpected: %v with "+
+			"PID %s\nreceived: %+v", LockedErr, pid, err)
+	}
+
+	if err = pf.Remove(); err != nil {
+		t.Fatalf("Failed to remove PID file: %+v", err)
+	}
+	if _, err = os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("PID file was not removed: %+v", err)
+	}
+	pf, err = LockPIDFile(path, false)
+	if err != nil {
+		t.Fatalf("Failed to lock removed PID file: %+v", err)
+	}
+	_ = pf.Release()
+}
+
+// Tests that LockPIDFile waits for the lock to be released when wait is true
+// and that the file is kept when it is released.
+func TestLockPIDFile_Wait(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "server.pid")
+	pf, err := LockPIDFile(path, false)
+	if err != nil {
+		t.Fatalf("Failed to lock PID file: %+v", err)
+	}
+
+	locked := make(chan error)
+	go func() {
+		next, err := LockPIDFile(path, true)
+		if err == nil {
+			_ = next.Release()
+		}
+		locked <- err
+	}()
+	select {
+	case err = <-locked:
+		t.Fatalf("PID file was locked while held: %+v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	if err = pf.Release(); err != nil {
+		t.Fatalf("Failed to release PID file: %+v", err)
+	}
+	select {
+	case err = <-locked:
+		if err != nil {
+			t.Errorf("Failed to lock released PID file: %+v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for released PID file to be locked.")
+	}
+	if _, err = os.Stat(path); err != nil {
+		t.Errorf("Released PID file was removed: %+v", err)
+	}
+}
+
+// Tests that LockDir locks the directory until it is released.
+func TestLockDir(t *testing.T) {
+	dir := t.TempDir()
+	l, err := LockDir(dir, false)
+	if err != nil {
+		t.Fatalf("Failed to lock directory: %+v", err)
+	}
+	if _, err = LockDir(dir, false); !errors.Is(err, LockedErr) {
+		t.Errorf("Unexpected error for locked directory."+
+			"\nexpected: %v\nreceived: %+v", LockedErr, err)
+	}
+
+	if err = l.Release(); err != nil {
+		t.Fatalf("Failed to release directory: %+v", err)
+	}
+	l, err = LockDir(dir, false)
+	if err != nil {
+		t.Fatalf("Failed to lock released directory: %+v", err)
+	}
+	_ = l.Release()
+}
+
+// Error path: Tests that LockDir and LockPIDFile return an error for a
+// directory that does not exist.
+func TestLockDir_NotExistError(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "missing")
+	if _, err := LockDir(dir, false); err == nil {
+		t.Error("Failed to get error for missing directory.")
+	}
+	if _, err := LockPIDFile(filepath.Join(dir, "pid"), false); err == nil {
+		t.Error("Failed to get error for PID file in missing directory.")
+	}
+}
@@ -0,0 +1,198 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package server
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/pkg/errors"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+)
+
+// Metadata keys of the headers set by reverse proxies to identify the client.
+const (
+	forwardedMetadataKey     = "forwarded"
+	xForwardedForMetadataKey = "x-forwarded-for"
+)
+
+// TrustedProxies contains the networks of reverse proxies whose Forwarded and
+// X-Forwarded-For headers are trusted to contain the address of the client.
+type TrustedProxies struct {
+	nets []*net.IPNet
+}
+
+// NewTrustedProxies parses the list of IP addresses and CIDR networks of the
+// trusted proxies.
+func NewTrustedProxies(proxies []string) (*TrustedProxies, error) {
+	tp := &TrustedProxies{nets: make([]*net.IPNet, 0, len(proxies))}
+	for _, proxy := range proxies {
+		ipNet, err := parseNetwork(proxy)
+		if err != nil {
+			return nil, errors.WithMessage(err, "invalid proxy")
+		}
+		tp.nets = append(tp.nets, ipNet)
+	}
+
+	return tp, nil
+}
+
+// parseNetwork parses an IP address or CIDR network. An address is returned
+// as the network of only that address.
+func parseNetwork(network string) (*net.IPNet, error) {
+	if !strings.Contains(network, "/") {
+		ip := net.ParseIP(network)
+		if ip == nil {
+			return nil, errors.Errorf("invalid IP address %q", network)
+		}
+		bits := 8 * net.IPv6len
+		if ip4 := ip.To4(); ip4 != nil {
+			ip, bits = ip4, 8*net.IPv4len
+		}
+		return &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}, nil
+	}
+
+	_, ipNet, err := net.ParseCIDR(network)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid network %q", network)
+	}
+	return ipNet, nil
+}
+
+// interceptor returns a gRPC interceptor that replaces the peer address of
+// requests from trusted proxies with the client address in their forwarding
+// headers, so that later interceptors see the real client.
+func (tp *TrustedProxies) interceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{},
+		_ *grpc.UnaryServerInfo, next grpc.UnaryHandler) (interface{}, error) {
+		p, ok := peer.FromContext(ctx)
+		md, hasMD := metadata.FromIncomingContext(ctx)
+		if !ok || p.Addr == nil || !hasMD {
+			return next(ctx, req)
+		}
+
+		peerIP := net.ParseIP(addrHost(p.Addr.String()))
+		if client := tp.clientIP(peerIP, forwardedFor(md)); client != nil {
+			forwarded := *p
+			forwarded.Addr = &net.TCPAddr{IP: client}
+			ctx = peer.NewContext(ctx, &forwarded)
+		}
+
+		return next(ctx, req)
+	}
+}
+
+// requestIP returns the IP address of the client that sent the HTTP request,
+// taken from its forwarding headers if it is from a trusted proxy. The
+// TrustedProxies may be nil, in which case the peer address is returned.
+func (tp *TrustedProxies) requestIP(r *http.Request) string {
+	ip := remoteIP(r)
+	if tp == nil {
+		return ip
+	}
+
+	md := metadata.MD{}
+	for _, key := range []string{
+		forwardedMetadataKey, xForwardedForMetadataKey} {
+		if values := r.Header.Values(key); len(values) > 0 {
+			md.Set(key, values...)
+		}
+	}
+	if client := tp.clientIP(net.ParseIP(ip), forwardedFor(md)); client != nil {
+		return client.String()
+	}
+	return ip
+}
+
+// clientIP returns the address of the client given the address of the peer
+// and the addresses in the forwarding headers, ordered from the client to the
+// last proxy. Addresses are walked back from the peer while they belong to
+// trusted proxies, so a client cannot spoof its address by sending the headers
+// itself. Returns nil if the peer is not a trusted proxy or the headers contain
+// no usable address.
+func (tp *TrustedProxies) clientIP(peerIP net.IP, chain []string) net.IP {
+	if peerIP == nil || !tp.trusted(peerIP) {
+		return nil
+	}
+
+	var client net.IP
+	for i := len(chain) - 1; i >= 0; i-- {
+		ip := net.ParseIP(chain[i])
+		if ip == nil {
+			// Unknown or obfuscated identifiers cannot be walked past
+			break
+		}
+		client = ip
+		if !tp.trusted(ip) {
+			break
+		}
+	}
+
+	return client
+}
+
+// trusted returns true if the IP address belongs to a trusted proxy.
+func (tp *TrustedProxies) trusted(ip net.IP) bool {
+	for _, ipNet := range tp.nets {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// forwardedFor returns the client addresses in the Forwarded header or, if it
+// is not set, the X-Forwarded-For header, ordered from the client to the last
+// proxy.
+func forwardedFor(md metadata.MD) []string {
+	var chain []string
+	if values := md.Get(forwardedMetadataKey); len(values) > 0 {
+		for _, value := range values {
+			chain = append(chain, parseForwarded(value)...)
+		}
+		return chain
+	}
+
+	for _, value := range md.Get(xForwardedForMetadataKey) {
+		for _, addr := range strings.Split(value, ",") {
+			chain = append(chain, addrHost(strings.TrimSpace(addr)))
+		}
+	}
+	return chain
+}
+
+// parseForwarded returns the "for" parameter of each element of an RFC 7239
+// Forwarded header with any quotes, brackets, and port removed. Elements
+// without the parameter are skipped.
+func parseForwarded(value string) []string {
+	var addrs []string
+	for _, element := range strings.Split(value, ",") {
+		for _, pair := range strings.Split(element, ";") {
+			key, val, found := strings.Cut(strings.TrimSpace(pair), "=")
+			if !found || !strings.EqualFold(key, "for") {
+				continue
+			}
+			addrs = append(addrs, addrHost(strings.Trim(val, `"`)))
+			break
+		}
+	}
+	return addrs
+}
+
+// addrHost returns the host of an address with an optional port. IPv6
+// addresses may be in brackets.
+func addrHost(addr string) string {
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+	return strings.TrimSuffix(strings.TrimPrefix(addr, "["), "]")
+}
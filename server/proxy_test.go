@@ -0,0 +1,168 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package server
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+)
+
+// Error path: Tests that NewTrustedProxies returns an error for invalid
+// addresses and networks.
+func TestNewTrustedProxies_Error(t *testing.T) {
+	for _, proxy := range []string{"localhost", "10.0.0.300", "10.0.0.0/33"} {
+		if _, err := NewTrustedProxies([]string{proxy}); err == nil {
+			t.Errorf("Failed to get error for proxy %q.", proxy)
+		}
+	}
+}
+
+// Tests that TrustedProxies.clientIP walks back through trusted proxies to the
+// client and ignores headers from untrusted peers.
+func TestTrustedProxies_clientIP(t *testing.T) {
+	tp, err := NewTrustedProxies([]string{"10.0.0.0/8", "::1", "192.0.2.1"})
+	if err != nil {
+		t.Fatalf("Failed to create TrustedProxies: %+v", err)
+	}
+
+	tests := []struct {
+		peer     string
+		chain    []string
+		expected string
+	}{
+		{"10.1.2.3", []string{"203.0.113.7"}, "203.0.113.7"},
+		{"::1", []string{"2001:db8::1"}, "2001:db8::1"},
+		{"10.1.2.3", []string{"198.51.100.1", "203.0.113.7", "192.0.2.1"},
+			"203.0.113.7"},
+		{"10.1.2.3", []string{"10.0.0.5", "10.0.0.6"}, "10.0.0.5"},
+		{"10.1.2.3", []string{"203.0.113.7", "unknown"}, ""},
+		{"10.1.2.3", nil, ""},
+		{"203.0.113.9", []string{"198.51.100.1"}, ""},
+		{"192.0.2.2", []string{"198.51.100.1"}, ""},
+	}
+
+	for i, tt := range tests {
+		ip := tp.clientIP(net.ParseIP(tt.peer), tt.chain)
+		var received string
+		if ip != nil {
+			received = ip.String()
+		}
+		if received != tt.expected {
+			t.Errorf("Unexpected client IP (%d).\nexpected: %q\nreceived: %q",
+				i, tt.expected, received)
+		}
+	}
+}
+
+// Tests that forwardedFor reads the Forwarded header, falling back to the
+// X-Forwarded-For header, and strips ports, quotes, and brackets.
+func Test_forwardedFor(t *testing.T) {
+	tests := []struct {
+		md       metadata.MD
+		expected []string
+	}{
+		{metadata.Pairs(xForwardedForMetadataKey, "203.0.113.7, 10.0.0.1:8080"),
+			[]string{"203.0.113.7", "10.0.0.1"}},
+		{metadata.Pairs(forwardedMetadataKey,
+			`for=192.0.2.60;proto=https, For="[2001:db8::1]:4711"`,
+			forwardedMetadataKey, "by=10.0.0.1;for=10.0.0.2",
+			xForwardedForMetadataKey, "198.51.100.1"),
+			[]string{"192.0.2.60", "2001:db8::1", "10.0.0.2"}},
+		{metadata.Pairs(forwardedMetadataKey, "proto=https"), nil},
+		{metadata.MD{}, nil},
+	}
+
+	for i, tt := range tests {
+		chain := forwardedFor(tt.md)
+		if !reflect.DeepEqual(tt.expected, chain) {
+			t.Errorf("Unexpected chain (%d).\nexpected: %q\nreceived: %q",
+				i, tt.expected, chain)
+		}
+	}
+}
+
+// Tests that the interceptor of TrustedProxies replaces the peer address so
+// that peerIP returns the forwarded client address.
+func TestTrustedProxies_interceptor(t *testing.T) {
+	tp, err := NewTrustedProxies([]string{"127.0.0.1"})
+	if err != nil {
+		t.Fatalf("Failed to create TrustedProxies: %+v", err)
+	}
+	interceptor := tp.interceptor()
+	var ip string
+	next := func(ctx context.Context, _ interface{}) (interface{}, error) {
+		ip = peerIP(ctx)
+		return nil, nil
+	}
+
+	tests := []struct {
+		peer     string
+		expected string
+	}{
+		{"127.0.0.1:5000", "203.0.113.7"},
+		{"198.51.100.1:5000", "198.51.100.1"},
+	}
+
+	for i, tt := range tests {
+		addr, err := net.ResolveTCPAddr("tcp", tt.peer)
+		if err != nil {
+			t.Fatalf("Failed to resolve address: %+v", err)
+		}
+		ctx := peer.NewContext(context.Background(), &peer.Peer{Addr: addr})
+		ctx = metadata.NewIncomingContext(ctx,
+			metadata.Pairs(xForwardedForMetadataKey, "203.0.113.7"))
+
+		_, err = interceptor(ctx, nil, &grpc.UnaryServerInfo{}, next)
+		if err != nil {
+			t.Errorf("Interceptor failed (%d): %+v", i, err)
+		}
+		if ip != tt.expected {
+			t.Errorf("Unexpected IP (%d).\nexpected: %s\nreceived: %s",
+				i, tt.expected, ip)
+		}
+	}
+}
+
+// Tests that TrustedProxies.requestIP returns the forwarded client address of
+// HTTP requests from trusted proxies and the peer address of others, and that
+// a nil TrustedProxies returns the peer address.
+func TestTrustedProxies_requestIP(t *testing.T) {
+	tp, err := NewTrustedProxies([]string{"127.0.0.1"})
+	if err != nil {
+		t.Fatalf("Failed to create TrustedProxies: %+v", err)
+	}
+
+	tests := []struct {
+		tp       *TrustedProxies
+		peer     string
+		header   string
+		expected string
+	}{
+		{tp, "127.0.0.1:5000", "X-Forwarded-For", "203.0.113.7"},
+		{tp, "127.0.0.1:5000", "Forwarded", "127.0.0.1"},
+		{tp, "198.51.100.1:5000", "X-Forwarded-For", "198.51.100.1"},
+		{nil, "127.0.0.1:5000", "X-Forwarded-For", "127.0.0.1"},
+	}
+	for i, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.RemoteAddr = tt.peer
+		r.Header.Set(tt.header, "203.0.113.7")
+		if ip := tt.tp.requestIP(r); ip != tt.expected {
+			t.Errorf("Unexpected IP (%d).\nexpected: %s\nreceived: %s",
+				i, tt.expected, ip)
+		}
+	}
+}
@@ -0,0 +1,231 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package server
+
+import (
+	"context"
+	"math"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	jww "github.com/spf13/jwalterweatherman"
+	"golang.org/x/time/rate"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// RateLimitParams are the parameters of the rate limiter. A rate of zero
+// disables that limit.
+type RateLimitParams struct {
+	// IPRate is the number of requests per second allowed from each IP
+	// address.
+	IPRate float64 `mapstructure:"ipRPS"`
+
+	// IPBurst is the number of requests an IP address can make at once.
+	// Defaults to the rate, rounded up.
+	IPBurst int `mapstructure:"ipBurst"`
+
+	// UserRate is the number of requests per second allowed for each logged
+	// in user across all of their tokens.
+	UserRate float64 `mapstructure:"userRPS"`
+
+	// UserBurst is the number of requests a user can make at once. Defaults
+	// to the rate, rounded up.
+	UserBurst int `mapstructure:"userBurst"`
+}
+
+// RateLimiter limits the rate of requests from each IP address and each
+// logged in user using token buckets. The limits can be changed while the
+// server is running.
+type RateLimiter struct {
+	ip   *keyedLimiter
+	user *keyedLimiter
+	mux  sync.RWMutex
+}
+
+// NewRateLimiter creates a new RateLimiter from the parameters.
+func NewRateLimiter(params map[string]interface{}) (*RateLimiter, error) {
+	ip, user, err := newRateLimits(params)
+	if err != nil {
+		return nil, err
+	}
+	return &RateLimiter{ip: ip, user: user}, nil
+}
+
+// Update replaces the limits with those in the parameters. The buckets of all
+// clients are reset. If the parameters are invalid, the limits are not
+// changed.
+func (rl *RateLimiter) Update(params map[string]interface{}) error {
+	ip, user, err := newRateLimits(params)
+	if err != nil {
+		return err
+	}
+
+	rl.mux.Lock()
+	defer rl.mux.Unlock()
+	rl.ip, rl.user = ip, user
+	return nil
+}
+
+// newRateLimits returns the limiters of IP addresses and users for the
+// parameters. Either is nil if its rate is zero.
+func newRateLimits(
+	params map[string]interface{}) (ip, user *keyedLimiter, err error) {
+	var p RateLimitParams
+	if err := decodeParams(params, &p, "rate limit"); err != nil {
+		return nil, nil, err
+	}
+
+	ip, err = newKeyedLimiter(p.IPRate, p.IPBurst)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "invalid IP rate limit")
+	}
+	user, err = newKeyedLimiter(p.UserRate, p.UserBurst)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "invalid user rate limit")
+	}
+
+	return ip, user, nil
+}
+
+// limiters returns the current limiters of IP addresses and users.
+func (rl *RateLimiter) limiters() (ip, user *keyedLimiter) {
+	rl.mux.RLock()
+	defer rl.mux.RUnlock()
+	return rl.ip, rl.user
+}
+
+// interceptor returns a gRPC interceptor that rejects requests with
+// RESOURCE_EXHAUSTED when the IP address or the user of the token has exceeded
+// its rate.
+func (rl *RateLimiter) interceptor(h *handler) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{},
+		info *grpc.UnaryServerInfo, next grpc.UnaryHandler) (interface{}, error) {
+		ipLimiter, userLimiter := rl.limiters()
+		if ipLimiter != nil {
+			if ip := peerIP(ctx); ip != "" && !ipLimiter.allow(ip, time.Now()) {
+				jww.DEBUG.Printf("Rate limited %s from %s.", info.FullMethod, ip)
+				return nil, status.Error(
+					codes.ResourceExhausted, "rate limit exceeded")
+			}
+		}
+
+		if userLimiter != nil {
+			if msg, ok := req.(interface{ GetToken() []byte }); ok {
+				username, exists :=
+					h.sessionUsername(UnmarshalToken(msg.GetToken()))
+				if exists && !userLimiter.allow(username, time.Now()) {
+					jww.DEBUG.Printf("Rate limited %s for user %q.",
+						info.FullMethod, username)
+					return nil, status.Error(
+						codes.ResourceExhausted, "rate limit exceeded")
+				}
+			}
+		}
+
+		return next(ctx, req)
+	}
+}
+
+// cleanup removes the limiters of clients whose buckets have refilled every
+// interval until the stop channel is closed.
+func (rl *RateLimiter) cleanup(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case now := <-ticker.C:
+			ip, user := rl.limiters()
+			for _, kl := range []*keyedLimiter{ip, user} {
+				if kl != nil {
+					kl.removeFull(now)
+				}
+			}
+		}
+	}
+}
+
+// keyedLimiter contains a token bucket for each key.
+type keyedLimiter struct {
+	limit    rate.Limit
+	burst    int
+	limiters map[string]*rate.Limiter
+	mux      sync.Mutex
+}
+
+// newKeyedLimiter creates a new keyedLimiter that allows the number of
+// requests per second with the burst. Returns nil if the rate is zero.
+func newKeyedLimiter(rps float64, burst int) (*keyedLimiter, error) {
+	if rps < 0 || burst < 0 {
+		return nil, errors.Errorf(
+			"rate %g and burst %d cannot be negative", rps, burst)
+	} else if rps == 0 {
+		return nil, nil
+	}
+
+	if burst == 0 {
+		burst = int(math.Ceil(rps))
+	}
+
+	return &keyedLimiter{
+		limit:    rate.Limit(rps),
+		burst:    burst,
+		limiters: make(map[string]*rate.Limiter),
+	}, nil
+}
+
+// allow returns true if a request for the key is allowed at the given time and
+// takes a token from its bucket.
+func (kl *keyedLimiter) allow(key string, now time.Time) bool {
+	kl.mux.Lock()
+	defer kl.mux.Unlock()
+
+	l, exists := kl.limiters[key]
+	if !exists {
+		l = rate.NewLimiter(kl.limit, kl.burst)
+		kl.limiters[key] = l
+	}
+
+	return l.AllowN(now, 1)
+}
+
+// removeFull removes the limiters whose buckets are full at the given time.
+// They are the same as a new limiter, so removing them does not change which
+// requests are allowed.
+func (kl *keyedLimiter) removeFull(now time.Time) {
+	kl.mux.Lock()
+	defer kl.mux.Unlock()
+
+	for key, l := range kl.limiters {
+		if l.TokensAt(now) >= float64(kl.burst) {
+			delete(kl.limiters, key)
+		}
+	}
+}
+
+// peerIP returns the IP address of the client that sent the request or an
+// empty string if it is unknown.
+func peerIP(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return ""
+	}
+
+	host, _, err := net.SplitHostPort(p.Addr.String())
+	if err != nil {
+		return p.Addr.String()
+	}
+	return host
+}
@@ -0,0 +1,176 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package server
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+
+	pb "gitlab.com/elixxir/comms/mixmessages"
+	"gitlab.com/elixxir/remoteSyncServer/store"
+)
+
+// Tests that NewRateLimiter only creates the limiters with a rate and that
+// the burst defaults to the rate rounded up.
+func TestNewRateLimiter(t *testing.T) {
+	rl, err := NewRateLimiter(map[string]interface{}{"ipRPS": 2.5})
+	if err != nil {
+		t.Fatalf("Failed to create RateLimiter: %+v", err)
+	}
+	if rl.user != nil {
+		t.Errorf("User limiter created without a rate.")
+	}
+	if rl.ip == nil {
+		t.Fatalf("IP limiter not created.")
+	}
+	if rl.ip.burst != 3 {
+		t.Errorf("Unexpected default burst.\nexpected: %d\nreceived: %d",
+			3, rl.ip.burst)
+	}
+}
+
+// Error path: Tests that NewRateLimiter returns an error for negative and
+// unknown parameters.
+func TestNewRateLimiter_Error(t *testing.T) {
+	for _, params := range []map[string]interface{}{
+		{"ipRPS": -1},
+		{"userRPS": 1, "userBurst": -1},
+		{"rps": 1},
+	} {
+		if _, err := NewRateLimiter(params); err == nil {
+			t.Errorf("Failed to get error for params %v.", params)
+		}
+	}
+}
+
+// Tests that RateLimiter.Update replaces the limits and keeps them when the
+// parameters are invalid.
+func TestRateLimiter_Update(t *testing.T) {
+	rl, err := NewRateLimiter(map[string]interface{}{"ipRPS": 1})
+	if err != nil {
+		t.Fatalf("Failed to create RateLimiter: %+v", err)
+	}
+
+	err = rl.Update(map[string]interface{}{"userRPS": 5, "userBurst": 10})
+	if err != nil {
+		t.Fatalf("Failed to update RateLimiter: %+v", err)
+	}
+	ip, user := rl.limiters()
+	if ip != nil {
+		t.Errorf("IP limiter kept after its rate was removed.")
+	}
+	if user == nil || user.burst != 10 {
+		t.Fatalf("User limiter not updated: %+v", user)
+	}
+
+	if err = rl.Update(map[string]interface{}{"userRPS": -1}); err == nil {
+		t.Errorf("Failed to get error for invalid parameters.")
+	}
+	if _, u := rl.limiters(); u != user {
+		t.Errorf("Limits changed by invalid parameters.")
+	}
+}
+
+// Tests that keyedLimiter.allow allows the burst for each key and refills the
+// bucket at the rate.
+func Test_keyedLimiter_allow(t *testing.T) {
+	kl, _ := newKeyedLimiter(1, 2)
+	now := time.Now()
+
+	for i, expected := range []bool{true, true, false} {
+		if allowed := kl.allow("a", now); allowed != expected {
+			t.Errorf("Unexpected result for request %d."+
+				"\nexpected: %t\nreceived: %t", i, expected, allowed)
+		}
+	}
+	if !kl.allow("b", now) {
+		t.Errorf("Request for another key not allowed.")
+	}
+	if !kl.allow("a", now.Add(time.Second)) {
+		t.Errorf("Request not allowed after the bucket refilled.")
+	}
+}
+
+// Tests that keyedLimiter.removeFull only removes limiters with full buckets.
+func Test_keyedLimiter_removeFull(t *testing.T) {
+	kl, _ := newKeyedLimiter(1, 2)
+	now := time.Now()
+	kl.allow("a", now)
+	kl.allow("b", now.Add(5*time.Second))
+
+	kl.removeFull(now.Add(5 * time.Second))
+	if _, exists := kl.limiters["a"]; exists {
+		t.Errorf("Full limiter not removed.")
+	}
+	if _, exists := kl.limiters["b"]; !exists {
+		t.Errorf("Limiter that is not full was removed.")
+	}
+}
+
+// Tests that the interceptor of RateLimiter returns RESOURCE_EXHAUSTED once an
+// IP address or a user exceeds their burst.
+func TestRateLimiter_interceptor(t *testing.T) {
+	h := newHandler("", time.Hour, nil, nil, store.NewMemStore)
+	s, err := h.addSession("waldo")
+	if err != nil {
+		t.Fatalf("Failed to add session: %+v", err)
+	}
+	next := func(context.Context, interface{}) (interface{}, error) {
+		return "ok", nil
+	}
+	info := &grpc.UnaryServerInfo{FullMethod: "/mixmessages.RemoteSync/Read"}
+	read := &pb.RsReadRequest{Token: s.Value[:]}
+
+	// The IP limit applies to all requests from the address
+	rl, _ := NewRateLimiter(map[string]interface{}{"ipRPS": 1e-6, "ipBurst": 1})
+	interceptor := rl.interceptor(h)
+	ctx := newTestAddrContext("192.0.2.1:1234")
+	if _, err = interceptor(ctx, read, info, next); err != nil {
+		t.Errorf("First request rejected: %+v", err)
+	}
+	_, err = interceptor(newTestAddrContext("192.0.2.1:5678"), read, info, next)
+	if code := status.Code(err); code != codes.ResourceExhausted {
+		t.Errorf("Unexpected code for IP over limit."+
+			"\nexpected: %s\nreceived: %s", codes.ResourceExhausted, code)
+	}
+	_, err = interceptor(newTestAddrContext("192.0.2.2:1234"), read, info, next)
+	if err != nil {
+		t.Errorf("Request from another IP rejected: %+v", err)
+	}
+
+	// The user limit applies to all requests with the user's tokens
+	rl, _ = NewRateLimiter(
+		map[string]interface{}{"userRPS": 1e-6, "userBurst": 1})
+	interceptor = rl.interceptor(h)
+	if _, err = interceptor(ctx, read, info, next); err != nil {
+		t.Errorf("First request rejected: %+v", err)
+	}
+	_, err = interceptor(newTestAddrContext("192.0.2.2:1234"), read, info, next)
+	if code := status.Code(err); code != codes.ResourceExhausted {
+		t.Errorf("Unexpected code for user over limit."+
+			"\nexpected: %s\nreceived: %s", codes.ResourceExhausted, code)
+	}
+	_, err = interceptor(ctx, &pb.RsReadRequest{Token: []byte{1}}, info, next)
+	if err != nil {
+		t.Errorf("Request with unknown token rejected: %+v", err)
+	}
+}
+
+// newTestAddrContext returns a context containing peer information with the
+// address.
+func newTestAddrContext(addr string) context.Context {
+	tcpAddr, _ := net.ResolveTCPAddr("tcp", addr)
+	return peer.NewContext(context.Background(), &peer.Peer{Addr: tcpAddr})
+}
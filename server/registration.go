@@ -0,0 +1,338 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package server
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"sync"
+	"sync/atomic"
+
+	"github.com/pkg/errors"
+	jww "github.com/spf13/jwalterweatherman"
+
+	"gitlab.com/elixxir/remoteSyncServer/credentials"
+	"gitlab.com/elixxir/remoteSyncServer/store"
+)
+
+// RegistrationMode determines who is allowed to create a new account.
+type RegistrationMode string
+
+// Supported registration modes.
+const (
+	// RegistrationDisabled does not allow new accounts to be registered. Users
+	// can only be added by an administrator.
+	RegistrationDisabled RegistrationMode = "disabled"
+
+	// RegistrationOpen allows anyone to register a new account.
+	RegistrationOpen RegistrationMode = "open"
+
+	// RegistrationInvite allows new accounts to be registered with a
+	// single-use invite code created by an administrator.
+	RegistrationInvite RegistrationMode = "invite"
+
+	// RegistrationApproval allows anyone to register a new account, but the
+	// account cannot be used until it is approved by an administrator.
+	RegistrationApproval RegistrationMode = "approval"
+)
+
+// inviteCodeLen is the number of random bytes in an invite code.
+const inviteCodeLen = 16
+
+var (
+	// RegistrationDisabledErr is returned when attempting to register while
+	// registration is disabled.
+	RegistrationDisabledErr = errors.New("registration is disabled")
+
+	// RegistrationsClosedErr is returned when attempting to register while
+	// registrations are closed to new accounts, such as when the server is at
+	// capacity.
+	RegistrationsClosedErr = errors.New(
+		"registrations are closed to new accounts")
+
+	// InvalidInviteErr is returned when an invite code is required and it is
+	// missing, unknown, or already used.
+	InvalidInviteErr = errors.New("invalid invite code")
+
+	// UsernameTakenErr is returned when registering a username that is already
+	// registered or awaiting approval.
+	UsernameTakenErr = errors.New("username already taken")
+
+	// EmptyPasswordErr is returned when registering without a password.
+	EmptyPasswordErr = errors.New("password cannot be empty")
+)
+
+// Registrar handles the registration of new accounts according to the
+// registration mode.
+type Registrar struct {
+	mode RegistrationMode
+
+	// users contains all registered users that can log in.
+	users credentials.Store
+
+	// pending contains the usernames and passwords of accounts awaiting
+	// approval.
+	pending credentials.Store
+
+	// invites contains the unused invite codes. Each code is saved as the
+	// hex-encoded SHA-256 hash of the code so that the store cannot be used
+	// to register.
+	invites credentials.Store
+
+	// hasher hashes the passwords of new accounts. If it is nil, passwords are
+	// stored in cleartext.
+	hasher *credentials.Argon2Hasher
+
+	// closed is true while registrations are closed to new accounts. It can
+	// be changed while the server is running, unlike the mode.
+	closed atomic.Bool
+
+	mux sync.Mutex
+}
+
+// NewRegistrar creates a new Registrar that adds new users to the user store.
+// The pending store is only used in RegistrationApproval mode and the invite
+// store is only used in RegistrationInvite mode; either can be nil if it is
+// not used by the mode. If hasher is not nil, passwords are stored as Argon2id
+// hashes.
+func NewRegistrar(mode RegistrationMode, users, pending,
+	invites credentials.Store, hasher *credentials.Argon2Hasher) (
+	*Registrar, error) {
+	switch mode {
+	case RegistrationDisabled, RegistrationOpen:
+	case RegistrationInvite:
+		if invites == nil {
+			return nil, errors.New("no invite store for invite registration")
+		}
+	case RegistrationApproval:
+		if pending == nil {
+			return nil, errors.New(
+				"no pending user store for approval registration")
+		}
+	default:
+		return nil, errors.Errorf("unknown registration mode %q", mode)
+	}
+
+	return &Registrar{
+		mode:    mode,
+		users:   users,
+		pending: pending,
+		invites: invites,
+		hasher:  hasher,
+	}, nil
+}
+
+// Mode returns the registration mode.
+func (r *Registrar) Mode() RegistrationMode {
+	return r.mode
+}
+
+// Open returns true unless registrations are closed to new accounts.
+// Registrations are open when the Registrar is created.
+func (r *Registrar) Open() bool {
+	return !r.closed.Load()
+}
+
+// SetOpen opens or closes registrations to new accounts and returns whether
+// they were open. Existing users, pending accounts, and invite codes are not
+// affected. Changes are logged.
+func (r *Registrar) SetOpen(open bool) bool {
+	wasOpen := !r.closed.Swap(!open)
+	if wasOpen != open && open {
+		jww.INFO.Printf("Registrations opened; accepting new accounts.")
+	} else if wasOpen != open {
+		jww.INFO.Printf("Registrations closed; rejecting new accounts.")
+	}
+	return wasOpen
+}
+
+// Register creates a new account with the username and password. In
+// RegistrationApproval mode, the account is added to the pending users and
+// true is returned.
+//
+// Returns [RegistrationDisabledErr] if registration is disabled,
+// [RegistrationsClosedErr] if registrations are closed, [InvalidInviteErr] if
+// the invite code is required and not valid, [UsernameTakenErr] if the
+// username is already registered, and [store.NonLocalFileErr] if the username
+// cannot be used as a directory name.
+func (r *Registrar) Register(
+	username, password, inviteCode string) (pending bool, err error) {
+	if r.mode == RegistrationDisabled {
+		return false, RegistrationDisabledErr
+	} else if !r.Open() {
+		return false, RegistrationsClosedErr
+	} else if err = store.CheckUsername(username); err != nil {
+		return false, err
+	} else if password == "" {
+		return false, EmptyPasswordErr
+	}
+
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	if err = r.checkAvailable(username); err != nil {
+		return false, err
+	}
+
+	if r.hasher != nil {
+		if password, err = r.hasher.Hash(password); err != nil {
+			return false, err
+		}
+	}
+
+	switch r.mode {
+	case RegistrationOpen:
+		err = r.users.Set(username, password)
+	case RegistrationInvite:
+		err = r.useInvite(inviteCode, func() error {
+			return r.users.Set(username, password)
+		})
+	case RegistrationApproval:
+		err = r.pending.Set(username, password)
+		pending = true
+	}
+	if err != nil {
+		return false, err
+	}
+
+	if pending {
+		jww.INFO.Printf("Registered user %q awaiting approval.", username)
+	} else {
+		jww.INFO.Printf("Registered user %q.", username)
+	}
+
+	return pending, nil
+}
+
+// ListPending returns the usernames of all accounts awaiting approval.
+func (r *Registrar) ListPending() ([]string, error) {
+	if r.pending == nil {
+		return []string{}, nil
+	}
+	return r.pending.List()
+}
+
+// Approve moves the pending account to the registered users so that it can be
+// used to log in.
+//
+// Returns [credentials.UserNotFoundErr] if there is no pending account with
+// the username.
+func (r *Registrar) Approve(username string) error {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	if r.pending == nil {
+		return credentials.UserNotFoundErr
+	}
+	password, err := r.pending.Get(username)
+	if err != nil {
+		return err
+	}
+	if err = r.users.Set(username, password); err != nil {
+		return err
+	}
+	if err = r.pending.Delete(username); err != nil {
+		return err
+	}
+
+	jww.INFO.Printf("Approved user %q.", username)
+
+	return nil
+}
+
+// Reject removes the pending account.
+//
+// Returns [credentials.UserNotFoundErr] if there is no pending account with
+// the username.
+func (r *Registrar) Reject(username string) error {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	if r.pending == nil {
+		return credentials.UserNotFoundErr
+	}
+	if err := r.pending.Delete(username); err != nil {
+		return err
+	}
+
+	jww.INFO.Printf("Rejected user %q.", username)
+
+	return nil
+}
+
+// CreateInvite generates a new single-use invite code.
+func (r *Registrar) CreateInvite() (string, error) {
+	if r.invites == nil {
+		return "", errors.New("invites are not used in this registration mode")
+	}
+
+	b := make([]byte, inviteCodeLen)
+	if _, err := rand.Read(b); err != nil {
+		return "", errors.Wrap(err, "failed to generate invite code")
+	}
+	code := base64.RawURLEncoding.EncodeToString(b)
+
+	if err := r.invites.Set(hashInviteCode(code), ""); err != nil {
+		return "", err
+	}
+
+	return code, nil
+}
+
+// checkAvailable returns UsernameTakenErr if the username is registered or
+// awaiting approval.
+func (r *Registrar) checkAvailable(username string) error {
+	stores := []credentials.Store{r.users}
+	if r.pending != nil {
+		stores = append(stores, r.pending)
+	}
+
+	for _, s := range stores {
+		_, err := s.Get(username)
+		if err == nil {
+			return UsernameTakenErr
+		} else if !errors.Is(err, credentials.UserNotFoundErr) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// useInvite consumes the invite code and calls register. If register fails,
+// the invite code is restored.
+func (r *Registrar) useInvite(code string, register func() error) error {
+	if code == "" {
+		return InvalidInviteErr
+	}
+
+	key := hashInviteCode(code)
+	err := r.invites.Delete(key)
+	if errors.Is(err, credentials.UserNotFoundErr) {
+		return InvalidInviteErr
+	} else if err != nil {
+		return err
+	}
+
+	if err = register(); err != nil {
+		if err2 := r.invites.Set(key, ""); err2 != nil {
+			jww.ERROR.Printf("Failed to restore invite code: %+v", err2)
+		}
+		return err
+	}
+
+	return nil
+}
+
+// hashInviteCode returns the key used to save the invite code.
+func hashInviteCode(code string) string {
+	h := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(h[:])
+}
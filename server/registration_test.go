@@ -0,0 +1,288 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package server
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"gitlab.com/elixxir/remoteSyncServer/credentials"
+	"gitlab.com/elixxir/remoteSyncServer/store"
+)
+
+// Error path: Tests that NewRegistrar returns an error for an unknown mode
+// and when the store required by the mode is missing.
+func TestNewRegistrar_Error(t *testing.T) {
+	users := credentials.NewMemStore(nil)
+	tests := map[RegistrationMode][2]credentials.Store{
+		"unknown":            {credentials.NewMemStore(nil), credentials.NewMemStore(nil)},
+		RegistrationInvite:   {credentials.NewMemStore(nil), nil},
+		RegistrationApproval: {nil, credentials.NewMemStore(nil)},
+	}
+
+	for mode, stores := range tests {
+		_, err := NewRegistrar(mode, users, stores[0], stores[1], nil)
+		if err == nil {
+			t.Errorf("Failed to get error for mode %q.", mode)
+		}
+	}
+}
+
+// Tests that Registrar.Register in RegistrationOpen mode immediately registers
+// the user.
+func TestRegistrar_Register_Open(t *testing.T) {
+	users := credentials.NewMemStore(nil)
+	r, err := NewRegistrar(RegistrationOpen, users, nil, nil, nil)
+	if err != nil {
+		t.Fatalf("Failed to create Registrar: %+v", err)
+	}
+
+	pending, err := r.Register("waldo", "hunter2", "")
+	if err != nil {
+		t.Fatalf("Failed to register: %+v", err)
+	} else if pending {
+		t.Errorf("Registration pending in open mode.")
+	}
+
+	if password, err := users.Get("waldo"); err != nil {
+		t.Errorf("User not registered: %+v", err)
+	} else if password != "hunter2" {
+		t.Errorf("Unexpected password.\nexpected: %q\nreceived: %q",
+			"hunter2", password)
+	}
+}
+
+// Tests that Registrar.Register stores the password as a hash when a hasher is
+// set.
+func TestRegistrar_Register_Hashed(t *testing.T) {
+	users := credentials.NewMemStore(nil)
+	r, err := NewRegistrar(RegistrationOpen, users, nil, nil, newTestHasher(t))
+	if err != nil {
+		t.Fatalf("Failed to create Registrar: %+v", err)
+	}
+
+	if _, err = r.Register("waldo", "hunter2", ""); err != nil {
+		t.Fatalf("Failed to register: %+v", err)
+	}
+
+	stored, err := users.Get("waldo")
+	if err != nil {
+		t.Fatalf("User not registered: %+v", err)
+	}
+	if match, err := credentials.VerifyPassword(stored, "hunter2"); err != nil {
+		t.Errorf("Failed to verify password: %+v", err)
+	} else if !credentials.IsHashed(stored) || !match {
+		t.Errorf("Password not stored as matching hash: %q", stored)
+	}
+}
+
+// Tests that Registrar.Register in RegistrationInvite mode registers the user
+// with an invite from Registrar.CreateInvite and that the invite can only be
+// used once.
+func TestRegistrar_Register_Invite(t *testing.T) {
+	users := credentials.NewMemStore(nil)
+	r, err := NewRegistrar(
+		RegistrationInvite, users, nil, credentials.NewMemStore(nil), nil)
+	if err != nil {
+		t.Fatalf("Failed to create Registrar: %+v", err)
+	}
+
+	code, err := r.CreateInvite()
+	if err != nil {
+		t.Fatalf("Failed to create invite: %+v", err)
+	}
+
+	if _, err = r.Register("waldo", "hunter2", "invalid"); !errors.Is(
+		err, InvalidInviteErr) {
+		t.Errorf("Unexpected error for invalid invite."+
+			"\nexpected: %v\nreceived: %+v", InvalidInviteErr, err)
+	}
+	if _, err = r.Register("waldo", "hunter2", ""); !errors.Is(
+		err, InvalidInviteErr) {
+		t.Errorf("Unexpected error for missing invite."+
+			"\nexpected: %v\nreceived: %+v", InvalidInviteErr, err)
+	}
+
+	if pending, err := r.Register("waldo", "hunter2", code); err != nil {
+		t.Fatalf("Failed to register with invite: %+v", err)
+	} else if pending {
+		t.Errorf("Registration pending in invite mode.")
+	}
+	if _, err = users.Get("waldo"); err != nil {
+		t.Errorf("User not registered: %+v", err)
+	}
+
+	if _, err = r.Register("carmen", "sandiego", code); !errors.Is(
+		err, InvalidInviteErr) {
+		t.Errorf("Unexpected error for used invite."+
+			"\nexpected: %v\nreceived: %+v", InvalidInviteErr, err)
+	}
+}
+
+// Tests that an invite is not used up when the registration fails.
+func TestRegistrar_Register_InviteRestored(t *testing.T) {
+	users := credentials.NewMemStore(map[string]string{"waldo": "hunter2"})
+	r, err := NewRegistrar(
+		RegistrationInvite, users, nil, credentials.NewMemStore(nil), nil)
+	if err != nil {
+		t.Fatalf("Failed to create Registrar: %+v", err)
+	}
+	code, err := r.CreateInvite()
+	if err != nil {
+		t.Fatalf("Failed to create invite: %+v", err)
+	}
+
+	if _, err = r.Register("waldo", "pass", code); !errors.Is(
+		err, UsernameTakenErr) {
+		t.Errorf("Unexpected error for taken username."+
+			"\nexpected: %v\nreceived: %+v", UsernameTakenErr, err)
+	}
+	if _, err = r.Register("carmen", "sandiego", code); err != nil {
+		t.Errorf("Failed to register with unused invite: %+v", err)
+	}
+}
+
+// Tests that Registrar.Register in RegistrationApproval mode adds the user to
+// the pending accounts and that they are only registered once approved with
+// Registrar.Approve.
+func TestRegistrar_Register_Approval(t *testing.T) {
+	users := credentials.NewMemStore(nil)
+	r, err := NewRegistrar(
+		RegistrationApproval, users, credentials.NewMemStore(nil), nil, nil)
+	if err != nil {
+		t.Fatalf("Failed to create Registrar: %+v", err)
+	}
+
+	for _, user := range [][2]string{{"waldo", "hunter2"}, {"carmen", "pass"}} {
+		if pending, err := r.Register(user[0], user[1], ""); err != nil {
+			t.Fatalf("Failed to register %q: %+v", user[0], err)
+		} else if !pending {
+			t.Errorf("Registration of %q not pending in approval mode.",
+				user[0])
+		}
+	}
+	if _, err = users.Get("waldo"); !errors.Is(err, credentials.UserNotFoundErr) {
+		t.Errorf("User registered before approval: %+v", err)
+	}
+
+	// A pending username cannot be registered again
+	if _, err = r.Register("waldo", "pass", ""); !errors.Is(
+		err, UsernameTakenErr) {
+		t.Errorf("Unexpected error for pending username."+
+			"\nexpected: %v\nreceived: %+v", UsernameTakenErr, err)
+	}
+
+	pendingUsers, err := r.ListPending()
+	if err != nil {
+		t.Fatalf("Failed to list pending users: %+v", err)
+	}
+	if expected := []string{"carmen", "waldo"}; !reflect.DeepEqual(
+		expected, pendingUsers) {
+		t.Errorf("Unexpected pending users.\nexpected: %s\nreceived: %s",
+			expected, pendingUsers)
+	}
+
+	if err = r.Approve("waldo"); err != nil {
+		t.Fatalf("Failed to approve user: %+v", err)
+	}
+	if err = r.Reject("carmen"); err != nil {
+		t.Fatalf("Failed to reject user: %+v", err)
+	}
+
+	if password, err := users.Get("waldo"); err != nil || password != "hunter2" {
+		t.Errorf("Approved user not registered (%q): %+v", password, err)
+	}
+	if _, err = users.Get("carmen"); !errors.Is(err, credentials.UserNotFoundErr) {
+		t.Errorf("Rejected user registered: %+v", err)
+	}
+	if pendingUsers, _ = r.ListPending(); len(pendingUsers) != 0 {
+		t.Errorf("Users still pending: %s", pendingUsers)
+	}
+}
+
+// Error path: Tests that Registrar.Approve and Registrar.Reject return
+// credentials.UserNotFoundErr for an account that is not pending.
+func TestRegistrar_Approve_Reject_UserNotFoundError(t *testing.T) {
+	r, err := NewRegistrar(RegistrationApproval, credentials.NewMemStore(nil),
+		credentials.NewMemStore(nil), nil, nil)
+	if err != nil {
+		t.Fatalf("Failed to create Registrar: %+v", err)
+	}
+
+	if err = r.Approve("waldo"); !errors.Is(err, credentials.UserNotFoundErr) {
+		t.Errorf("Unexpected error approving unknown user."+
+			"\nexpected: %v\nreceived: %+v", credentials.UserNotFoundErr, err)
+	}
+	if err = r.Reject("waldo"); !errors.Is(err, credentials.UserNotFoundErr) {
+		t.Errorf("Unexpected error rejecting unknown user."+
+			"\nexpected: %v\nreceived: %+v", credentials.UserNotFoundErr, err)
+	}
+}
+
+// Error path: Tests that Registrar.Register returns the expected errors for
+// disabled registration, closed registrations, invalid usernames, empty
+// passwords, and registered usernames.
+func TestRegistrar_Register_Error(t *testing.T) {
+	users := credentials.NewMemStore(map[string]string{"waldo": "hunter2"})
+	disabled, _ := NewRegistrar(RegistrationDisabled, users, nil, nil, nil)
+	open, _ := NewRegistrar(RegistrationOpen, users, nil, nil, nil)
+	closed, _ := NewRegistrar(RegistrationOpen, users, nil, nil, nil)
+	closed.SetOpen(false)
+
+	tests := []struct {
+		r                  *Registrar
+		username, password string
+		expected           error
+	}{
+		{disabled, "carmen", "sandiego", RegistrationDisabledErr},
+		{closed, "carmen", "sandiego", RegistrationsClosedErr},
+		{open, "..", "sandiego", store.NonLocalFileErr},
+		{open, "a/b", "sandiego", store.NonLocalFileErr},
+		{open, "carmen", "", EmptyPasswordErr},
+		{open, "waldo", "pass", UsernameTakenErr},
+	}
+
+	for i, tt := range tests {
+		_, err := tt.r.Register(tt.username, tt.password, "")
+		if !errors.Is(err, tt.expected) {
+			t.Errorf("Unexpected error (%d).\nexpected: %v\nreceived: %+v",
+				i, tt.expected, err)
+		}
+	}
+}
+
+// Tests that Registrar.SetOpen closes and reopens registrations, returning
+// whether they were open, and that accounts can be registered again once they
+// are reopened.
+func TestRegistrar_SetOpen(t *testing.T) {
+	users := credentials.NewMemStore(nil)
+	r, err := NewRegistrar(RegistrationOpen, users, nil, nil, nil)
+	if err != nil {
+		t.Fatalf("Failed to create Registrar: %+v", err)
+	}
+	if !r.Open() {
+		t.Error("Registrations closed when the Registrar is created.")
+	}
+
+	for i, open := range []bool{false, false, true, true} {
+		wasOpen := r.Open()
+		if was := r.SetOpen(open); was != wasOpen {
+			t.Errorf("Unexpected previous state %d.\nexpected: %t\n"+
+				"received: %t", i, wasOpen, was)
+		}
+		if r.Open() != open {
+			t.Errorf("Unexpected state %d.\nexpected: %t\nreceived: %t",
+				i, open, r.Open())
+		}
+	}
+
+	if _, err = r.Register("waldo", "hunter2", ""); err != nil {
+		t.Errorf("Failed to register after reopening: %+v", err)
+	}
+}
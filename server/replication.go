@@ -0,0 +1,910 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"io"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+	jww "github.com/spf13/jwalterweatherman"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"gitlab.com/elixxir/remoteSyncServer/rpc"
+	"gitlab.com/elixxir/remoteSyncServer/store"
+	"gitlab.com/xx_network/primitives/utils"
+)
+
+// Roles of a server in replication.
+const (
+	ReplicationPrimary = "primary"
+	ReplicationStandby = "standby"
+	ReplicationReplica = "replica"
+	ReplicationRegion  = "region"
+)
+
+// defaultReplicationQueueSize is the default number of writes waiting to be
+// sent to each standby, read replica, or region.
+const defaultReplicationQueueSize = 10000
+
+const (
+	// maxReplicationBatch and maxReplicationBatchBytes are the largest number
+	// of entries and total size of their data sent to the standby in one
+	// request. An entry larger than maxReplicationBatchBytes is sent alone.
+	maxReplicationBatch      = 100
+	maxReplicationBatchBytes = 4 << 20
+
+	// replicationTimeout is the timeout of each request to the standby, and of
+	// each write a read replica forwards to the primary.
+	replicationTimeout = 30 * time.Second
+
+	// minReplicationRetry and maxReplicationRetry are the first and longest
+	// delays before retrying a request that the standby failed.
+	minReplicationRetry = time.Second
+	maxReplicationRetry = time.Minute
+)
+
+var (
+	// StandbyErr is returned, with the UNAVAILABLE code, for RPCs that modify
+	// storage or accounts on a standby server that is not promoted.
+	StandbyErr = errors.New(
+		"server is a standby: writes are disabled, reads are available")
+
+	// ReplicaErr is returned, with the UNAVAILABLE code, for registrations on
+	// a read replica, since accounts are not forwarded to the primary.
+	ReplicaErr = errors.New(
+		"server is a read replica: register on the primary")
+
+	// NotStandbyErr is returned, with the FAILED_PRECONDITION code, when
+	// writes are replicated to a server that is not a standby, read replica,
+	// or region, such as a standby that was promoted, or when a server that is
+	// not a region replicates to a region.
+	NotStandbyErr = errors.New("server is not a standby")
+
+	// NotPrimaryErr is returned, with the FAILED_PRECONDITION code, when a
+	// read replica forwards a write to a server that does not accept writes.
+	NotPrimaryErr = errors.New("server is not the primary")
+)
+
+// ReplicationParams are the parameters of the replication of a primary server
+// to a standby server and read replicas, or between regions.
+type ReplicationParams struct {
+	// Role is "primary", "standby", "replica", or "region". Required.
+	Role string `mapstructure:"role"`
+
+	// Key authenticates the servers to each other. It must be the same on all
+	// of them. Required.
+	Key string `mapstructure:"key"`
+
+	// Peer is the address of the standby that the primary replicates to, or
+	// of the primary that a read replica forwards writes to, which must serve
+	// native gRPC. Required for a read replica. A region replicates to its
+	// standby like a primary.
+	Peer string `mapstructure:"peer"`
+
+	// Replicas are the addresses of the read replicas that the primary or
+	// region replicates to. A primary requires a peer, replicas, or both.
+	Replicas []string `mapstructure:"replicas"`
+
+	// Region is the unique name of the region of the server, which breaks ties
+	// between writes made at the same time in different regions. Required for
+	// a region.
+	Region string `mapstructure:"region"`
+
+	// Regions are the addresses of the servers of the other regions, which
+	// must serve native gRPC. Required for a region.
+	Regions []string `mapstructure:"regions"`
+
+	// CAPath is the CA certificate that the certificates of the peer,
+	// replicas, and regions must be signed by. Defaults to the system roots.
+	CAPath string `mapstructure:"caPath"`
+
+	// ServerName is the name the certificates of the peer, replicas, and
+	// regions must be valid for. Defaults to the host of each address.
+	ServerName string `mapstructure:"serverName"`
+
+	// QueueSize is the number of writes that can wait to be sent to each
+	// standby, read replica, or region before further writes to it are
+	// dropped. Defaults to 10000.
+	QueueSize int `mapstructure:"queueSize"`
+}
+
+// replicationEntry is a write, delete, or transaction of a user committed on
+// the primary or a region.
+type replicationEntry struct {
+	user  string
+	ops   []TransactionOp
+	stamp writeStamp // Only set by regions
+}
+
+// writeStamp is the time that a region accepted a write and the name of the
+// region. Of two writes of the same file, the one with the later stamp wins.
+type writeStamp struct {
+	time   time.Time
+	region string
+}
+
+// after returns true if the stamp is later than the other stamp: if its time
+// is later or, for equal times, its region name is greater.
+func (ws writeStamp) after(other writeStamp) bool {
+	if !ws.time.Equal(other.time) {
+		return ws.time.After(other.time)
+	}
+	return ws.region > other.region
+}
+
+// Replication replicates the writes of a primary server to a standby server
+// and read replicas asynchronously, for disaster recovery without a cluster
+// and to scale reads. The primary commits each write locally and queues it for
+// each of them, and sends each queue in the background, in order, retrying
+// until it is applied. The standby serves reads and rejects writes until it is
+// promoted. Read replicas serve reads and forward writes to the primary.
+//
+// Regions all accept writes and replicate them to each other in the same way,
+// with a stamp of when they were accepted. A region applies the operations of
+// another region only to files whose last write has an earlier stamp, so that
+// all regions keep the last write of each file in any order of delivery.
+type Replication struct {
+	params  ReplicationParams
+	standby atomic.Bool
+
+	// targets are the standby, read replicas, and other regions that the
+	// primary or region sends its writes to.
+	targets []*replicationTarget
+
+	// stamps are the stamps of the last writes and deletes of the files of
+	// each user on a region since it started, keyed by user and path. Files
+	// without a stamp use their last modification time in the store, and
+	// deleted files without one lose to any write.
+	stamps    map[string]writeStamp
+	stampsMux sync.Mutex
+
+	// locks serialize the writes of each user on the primary with queueing
+	// them, so that they are queued in the order they are applied.
+	locks userLocks
+
+	// newStore creates the local stores that replicated writes are applied
+	// to. Set by wrap.
+	newStore store.NewStore
+
+	// creds are the TLS credentials the primary connects to the standby and
+	// read replicas with, and a read replica connects to the primary with.
+	creds credentials.TransportCredentials
+
+	// conn and primary are the connection and client that a read replica
+	// forwards writes to the primary with.
+	conn    *grpc.ClientConn
+	primary rpc.ReplicationClient
+}
+
+// replicationTarget is a standby, read replica, or region that the primary or
+// region sends the queued entries to.
+type replicationTarget struct {
+	// role is ReplicationStandby, ReplicationReplica, or ReplicationRegion.
+	role    string
+	address string
+	queue   chan replicationEntry
+
+	// dropped counts the entries dropped because the queue was full.
+	dropped atomic.Uint64
+	conn    *grpc.ClientConn
+}
+
+// NewReplication creates a new Replication from the parameters. Returns an
+// error if the role is invalid, a required parameter is missing, or the CA
+// cannot be loaded.
+func NewReplication(params map[string]interface{}) (*Replication, error) {
+	p := ReplicationParams{QueueSize: defaultReplicationQueueSize}
+	err := decodeParams(params, &p, "replication")
+	if err != nil {
+		return nil, err
+	}
+
+	switch p.Role {
+	case ReplicationPrimary, ReplicationStandby, ReplicationReplica,
+		ReplicationRegion:
+	default:
+		return nil, errors.Errorf(
+			"replication role %q must be %q, %q, %q, or %q", p.Role,
+			ReplicationPrimary, ReplicationStandby, ReplicationReplica,
+			ReplicationRegion)
+	}
+	if p.Key == "" {
+		return nil, errors.New("replication key is required")
+	}
+	r := &Replication{params: p}
+	r.standby.Store(p.Role == ReplicationStandby)
+	if r.Standby() {
+		return r, nil
+	}
+
+	if p.Role == ReplicationReplica && p.Peer == "" {
+		return nil, errors.New("replication peer is required for a replica")
+	} else if p.Role != ReplicationReplica {
+		if p.Role == ReplicationPrimary && p.Peer == "" &&
+			len(p.Replicas) == 0 {
+			return nil, errors.New(
+				"replication peer or replicas are required for a primary")
+		} else if p.Role == ReplicationRegion &&
+			(p.Region == "" || len(p.Regions) == 0) {
+			return nil, errors.New(
+				"replication region and regions are required for a region")
+		} else if p.QueueSize <= 0 {
+			return nil, errors.Errorf(
+				"replication queueSize %d must be positive", p.QueueSize)
+		}
+	}
+	tlsConfig := &tls.Config{ServerName: p.ServerName}
+	if p.CAPath != "" {
+		if p.CAPath, err = utils.ExpandPath(p.CAPath); err != nil {
+			return nil, errors.Wrapf(err, "unable to expand path %s", p.CAPath)
+		}
+		caPem, err := utils.ReadFile(p.CAPath)
+		if err != nil {
+			return nil, errors.Wrapf(
+				err, "failed to read replication CA %s", p.CAPath)
+		}
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(caPem) {
+			return nil, errors.Errorf("no certificates found in %s", p.CAPath)
+		}
+	}
+	r.creds = credentials.NewTLS(tlsConfig)
+	if p.Role == ReplicationReplica {
+		return r, nil
+	}
+
+	if p.Peer != "" {
+		r.addTarget(ReplicationStandby, p.Peer)
+	}
+	for _, address := range p.Replicas {
+		if address == "" {
+			return nil, errors.New("replication replicas cannot be empty")
+		}
+		r.addTarget(ReplicationReplica, address)
+	}
+	if p.Role == ReplicationRegion {
+		r.stamps = make(map[string]writeStamp)
+		for _, address := range p.Regions {
+			if address == "" {
+				return nil, errors.New("replication regions cannot be empty")
+			}
+			r.addTarget(ReplicationRegion, address)
+		}
+	}
+	return r, nil
+}
+
+// addTarget adds a standby, read replica, or region at the address that the
+// primary or region sends its writes to.
+func (r *Replication) addTarget(role, address string) {
+	r.targets = append(r.targets, &replicationTarget{
+		role:    role,
+		address: address,
+		queue:   make(chan replicationEntry, r.params.QueueSize),
+	})
+}
+
+// Params returns the parameters of the replication.
+func (r *Replication) Params() ReplicationParams {
+	return r.params
+}
+
+// Standby returns true if the server is a standby that is not promoted.
+func (r *Replication) Standby() bool {
+	return r.standby.Load()
+}
+
+// Replica returns true if the server is a read replica.
+func (r *Replication) Replica() bool {
+	return r.params.Role == ReplicationReplica
+}
+
+// Region returns true if the server is one of several regions that all accept
+// writes.
+func (r *Replication) Region() bool {
+	return r.params.Role == ReplicationRegion
+}
+
+// Primary returns true if the server applies writes itself, either as the
+// primary, as a standby that was promoted, or as a region.
+func (r *Replication) Primary() bool {
+	return !r.Standby() && !r.Replica()
+}
+
+// Promote makes a standby accept writes and stop applying replicated writes,
+// and returns whether it was a standby. The promotion lasts until the server
+// restarts.
+func (r *Replication) Promote() bool {
+	was := r.standby.Swap(false)
+	if was {
+		jww.INFO.Printf("Promoted from standby; accepting writes.")
+	}
+	return was
+}
+
+// Dropped returns the number of writes that were not replicated to a standby,
+// read replica, or region because its queue was full.
+func (r *Replication) Dropped() uint64 {
+	var dropped uint64
+	for _, t := range r.targets {
+		dropped += t.dropped.Load()
+	}
+	return dropped
+}
+
+// interceptor returns a gRPC interceptor that rejects the RPCs that modify
+// storage or accounts with StandbyErr and the UNAVAILABLE code while the
+// server is a standby, and registrations with ReplicaErr on a read replica.
+func (r *Replication) interceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{},
+		info *grpc.UnaryServerInfo, next grpc.UnaryHandler) (interface{}, error) {
+		if r.Standby() && maintenanceMethods[info.FullMethod] {
+			jww.DEBUG.Printf("Rejected %s on standby.", info.FullMethod)
+			return nil, status.Error(codes.Unavailable, StandbyErr.Error())
+		} else if r.Replica() &&
+			info.FullMethod == rpc.Registration_Register_FullMethodName {
+			jww.DEBUG.Printf("Rejected %s on replica.", info.FullMethod)
+			return nil, status.Error(codes.Unavailable, ReplicaErr.Error())
+		}
+		return next(ctx, req)
+	}
+}
+
+// wrap returns a NewStore for the role of the server. On the primary, the
+// stores created by newStore queue their writes and deletes for the standby
+// and read replicas once they are applied. On a read replica, they forward
+// them to the primary instead. On a standby, newStore is returned unchanged.
+// Replicated writes are applied to the stores created by newStore.
+func (r *Replication) wrap(newStore store.NewStore) store.NewStore {
+	r.newStore = newStore
+	if r.Standby() {
+		return newStore
+	}
+	return func(storageDir, baseDir string) (store.Store, error) {
+		s, err := newStore(storageDir, baseDir)
+		if err != nil {
+			return nil, err
+		}
+		rs := &replicatedStore{Store: s, r: r, user: baseDir}
+		if versioner, ok := s.(store.Versioner); ok {
+			return &replicatedVersionedStore{rs, versioner}, nil
+		}
+		return rs, nil
+	}
+}
+
+// enqueue queues the entry to be sent to each standby and read replica, and to
+// each other region if the entry was accepted by this region. If the queue of
+// one is full, the entry is dropped for it and it no longer matches the
+// primary.
+func (r *Replication) enqueue(entry replicationEntry) {
+	for _, t := range r.targets {
+		if t.role == ReplicationRegion &&
+			entry.stamp.region != r.params.Region {
+			continue
+		}
+		select {
+		case t.queue <- entry:
+		default:
+			if t.dropped.Add(1) == 1 {
+				jww.ERROR.Printf("Replication queue of %s %s is full; "+
+					"dropping writes. It must be resynchronized from this "+
+					"server, starting with the write of %d operations of %q.",
+					t.role, t.address, len(entry.ops), entry.user)
+			}
+		}
+	}
+}
+
+// start connects the primary or region to the standby, read replicas, and
+// other regions and sends them the queued entries in the background until stop
+// is closed, or connects a read replica to the primary.
+func (r *Replication) start(stop <-chan struct{}) error {
+	var err error
+	if r.Replica() {
+		r.conn, err = grpc.Dial(
+			r.params.Peer, grpc.WithTransportCredentials(r.creds))
+		if err != nil {
+			return errors.Wrapf(err, "failed to dial primary %s", r.params.Peer)
+		}
+		r.primary = rpc.NewReplicationClient(r.conn)
+		jww.INFO.Printf("Forwarding writes to primary %s.", r.params.Peer)
+		return nil
+	}
+
+	for _, t := range r.targets {
+		t.conn, err = grpc.Dial(
+			t.address, grpc.WithTransportCredentials(r.creds))
+		if err != nil {
+			return errors.Wrapf(err, "failed to dial %s %s", t.role, t.address)
+		}
+		jww.INFO.Printf("Replicating writes to %s %s.", t.role, t.address)
+
+		go r.run(t, rpc.NewReplicationClient(t.conn), stop)
+	}
+	return nil
+}
+
+// stop closes the connections to the standby, read replicas, and other
+// regions, or to the primary. Queued entries are not sent.
+func (r *Replication) stop() {
+	if r.conn != nil {
+		if err := r.conn.Close(); err != nil {
+			jww.WARN.Printf("Failed to close connection to primary: %+v", err)
+		}
+	}
+	for _, t := range r.targets {
+		if t.conn == nil {
+			continue
+		}
+		if n := len(t.queue); n > 0 {
+			jww.WARN.Printf("Stopped with %d writes not replicated to %s %s.",
+				n, t.role, t.address)
+		}
+		if err := t.conn.Close(); err != nil {
+			jww.WARN.Printf("Failed to close connection to %s %s: %+v",
+				t.role, t.address, err)
+		}
+	}
+}
+
+// run sends the queued entries of the standby, read replica, or region to it
+// in batches until stop is closed. A batch that fails is retried, with a delay
+// that doubles up to maxReplicationRetry, until it succeeds. Replication stops
+// if the standby was promoted.
+func (r *Replication) run(t *replicationTarget,
+	client rpc.ReplicationClient, stop <-chan struct{}) {
+	for {
+		var batch []replicationEntry
+		select {
+		case <-stop:
+			return
+		case entry := <-t.queue:
+			batch = append(batch, entry)
+		}
+		size := entrySize(batch[0])
+	fill:
+		for len(batch) < maxReplicationBatch {
+			select {
+			case entry := <-t.queue:
+				batch = append(batch, entry)
+				if size += entrySize(entry); size >= maxReplicationBatchBytes {
+					break fill
+				}
+			default:
+				break fill
+			}
+		}
+
+		req := replicateRequest(batch)
+		delay := minReplicationRetry
+		for {
+			err := r.send(client, req)
+			if err == nil {
+				break
+			} else if status.Code(err) == codes.FailedPrecondition {
+				jww.ERROR.Printf("The %s %s no longer accepts replicated "+
+					"writes; stopped replicating: %+v", t.role, t.address, err)
+				return
+			}
+			jww.WARN.Printf("Failed to replicate %d writes to %s %s; "+
+				"retrying in %s: %+v",
+				len(batch), t.role, t.address, delay, err)
+			select {
+			case <-stop:
+				return
+			case <-time.After(delay):
+			}
+			if delay *= 2; delay > maxReplicationRetry {
+				delay = maxReplicationRetry
+			}
+		}
+	}
+}
+
+// send sends the request to the standby, read replica, or region with the
+// replication key.
+func (r *Replication) send(
+	client rpc.ReplicationClient, req *rpc.RsReplicateRequest) error {
+	ctx, cancel := r.outgoingContext()
+	defer cancel()
+	_, err := client.Replicate(ctx, req)
+	return err
+}
+
+// forward sends a write of the user on a read replica to the primary with the
+// replication key. The status error of the primary is returned unchanged.
+func (r *Replication) forward(user string, ops []TransactionOp) error {
+	ctx, cancel := r.outgoingContext()
+	defer cancel()
+	_, err := r.primary.Forward(ctx, &rpc.RsForwardRequest{
+		Entry: &rpc.RsReplicationEntry{User: user, Ops: rpcTransactionOps(ops)},
+	})
+	return err
+}
+
+// fetch returns the stored data of the file of the user from the first of the
+// primary, standby, read replicas, and other regions that has a healthy copy,
+// to repair a corrupted copy of this server. The error of the last server is
+// returned if none has one.
+//
+// Returns [NoReplicasErr] if the server has no connections to other servers.
+func (r *Replication) fetch(user, path string) ([]byte, error) {
+	var clients []rpc.ReplicationClient
+	var addresses []string
+	if r.primary != nil {
+		clients = append(clients, r.primary)
+		addresses = append(addresses, r.params.Peer)
+	}
+	for _, t := range r.targets {
+		if t.conn != nil {
+			clients = append(clients, rpc.NewReplicationClient(t.conn))
+			addresses = append(addresses, t.address)
+		}
+	}
+	if len(clients) == 0 {
+		return nil, NoReplicasErr
+	}
+
+	var err error
+	for i, client := range clients {
+		var resp *rpc.RsFetchResponse
+		ctx, cancel := r.outgoingContext()
+		resp, err = client.Fetch(
+			ctx, &rpc.RsFetchRequest{User: user, Path: path})
+		cancel()
+		if err == nil {
+			return resp.GetData(), nil
+		}
+		jww.DEBUG.Printf("Failed to fetch %s of %q from %s: %+v",
+			path, user, addresses[i], err)
+	}
+	return nil, errors.Wrapf(err, "no healthy copy on %d servers",
+		len(clients))
+}
+
+// outgoingContext returns a context for a request to another server, with
+// the replication key and a timeout of replicationTimeout.
+func (r *Replication) outgoingContext() (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithTimeout(
+		context.Background(), replicationTimeout)
+	ctx = metadata.AppendToOutgoingContext(
+		ctx, authorizationMetadataKey, bearerPrefix+r.params.Key)
+	return ctx, cancel
+}
+
+// entrySize returns the total size of the data of the entry.
+func entrySize(entry replicationEntry) int {
+	var size int
+	for _, op := range entry.ops {
+		size += len(op.Path) + len(op.Data)
+	}
+	return size
+}
+
+// replicateRequest returns the request that replicates the entries.
+func replicateRequest(entries []replicationEntry) *rpc.RsReplicateRequest {
+	req := &rpc.RsReplicateRequest{
+		Entries: make([]*rpc.RsReplicationEntry, len(entries)),
+	}
+	for i, entry := range entries {
+		req.Entries[i] = &rpc.RsReplicationEntry{
+			User: entry.user, Ops: rpcTransactionOps(entry.ops)}
+		if entry.stamp.region != "" {
+			req.Entries[i].Time = entry.stamp.time.UnixNano()
+			req.Entries[i].Region = entry.stamp.region
+		}
+	}
+	return req
+}
+
+// rpcTransactionOps converts the operations into their messages.
+func rpcTransactionOps(ops []TransactionOp) []*rpc.RsTransactionOp {
+	msgs := make([]*rpc.RsTransactionOp, len(ops))
+	for i, op := range ops {
+		msgs[i] = &rpc.RsTransactionOp{
+			Path: op.Path, Data: op.Data, Delete: op.Delete}
+	}
+	return msgs
+}
+
+// transactionOps converts the messages into operations.
+func transactionOps(msgs []*rpc.RsTransactionOp) []TransactionOp {
+	ops := make([]TransactionOp, len(msgs))
+	for i, op := range msgs {
+		ops[i] = TransactionOp{
+			Path: op.GetPath(), Data: op.GetData(), Delete: op.GetDelete()}
+	}
+	return ops
+}
+
+// apply applies the replicated entries in order to the local stores of their
+// users, while no other write of the user is applied. Deleting a file that
+// does not exist is ignored, since the primary resends entries that were
+// applied if their response is lost.
+//
+// Returns [NotStandbyErr] if the server is not a standby or read replica.
+func (r *Replication) apply(
+	h *handler, entries []*rpc.RsReplicationEntry) error {
+	if r.Region() {
+		return r.applyRegion(h, entries)
+	} else if r.Primary() {
+		return NotStandbyErr
+	}
+
+	for i, entry := range entries {
+		s, err := r.newStore(h.storageDir, entry.GetUser())
+		if err != nil {
+			return errors.WithMessagef(err, "entry %d", i)
+		}
+
+		l := h.locks.get(entry.GetUser())
+		l.Lock()
+		err = applyOps(s, transactionOps(entry.GetOps()))
+		l.Unlock()
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return errors.WithMessagef(
+				err, "entry %d of %q", i, entry.GetUser())
+		}
+	}
+	return nil
+}
+
+// applyRegion applies the entries of another region in order to the local
+// stores of their users, while no other write of the user is applied. Only the
+// operations on files whose last write has an earlier stamp than the entry are
+// applied, and they are queued for the standby and read replicas of the
+// region.
+//
+// Returns [NotStandbyErr] if an entry has no region, since it was sent by a
+// server that is not a region.
+func (r *Replication) applyRegion(
+	h *handler, entries []*rpc.RsReplicationEntry) error {
+	for i, entry := range entries {
+		if entry.GetRegion() == "" {
+			return errors.Wrapf(NotStandbyErr, "entry %d has no region", i)
+		}
+		stamp := writeStamp{time.Unix(0, entry.GetTime()), entry.GetRegion()}
+		s, err := r.newStore(h.storageDir, entry.GetUser())
+		if err != nil {
+			return errors.WithMessagef(err, "entry %d", i)
+		}
+
+		l := h.locks.get(entry.GetUser())
+		l.Lock()
+		err = r.applyNewer(s, entry.GetUser(), transactionOps(entry.GetOps()),
+			stamp)
+		l.Unlock()
+		if err != nil {
+			return errors.WithMessagef(
+				err, "entry %d of %q", i, entry.GetUser())
+		}
+	}
+	return nil
+}
+
+// applyNewer applies the operations that are newer than the last writes of
+// their files to the store of the user, records their stamps, and queues them.
+// Deleting a file that does not exist only records the stamp. Must be called
+// while no other write of the user is applied.
+func (r *Replication) applyNewer(s store.Store, user string,
+	ops []TransactionOp, stamp writeStamp) error {
+	r.stampsMux.Lock()
+	defer r.stampsMux.Unlock()
+
+	var newer, apply []TransactionOp
+	for _, op := range ops {
+		last, exists := r.stamps[stampKey(user, op.Path)]
+		modified, err := s.GetLastModified(op.Path)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return errors.Wrapf(err, "failed to get modification time of %s",
+				op.Path)
+		} else if !exists && err == nil {
+			last = writeStamp{time: modified}
+		}
+		if !stamp.after(last) {
+			jww.DEBUG.Printf("Ignored replicated operation on %s of %q from "+
+				"region %s, which is older than its last write.",
+				op.Path, user, stamp.region)
+			continue
+		}
+		newer = append(newer, op)
+		if !op.Delete || err == nil {
+			apply = append(apply, op)
+		}
+	}
+
+	if len(apply) > 0 {
+		if err := applyOps(s, apply); err != nil {
+			return err
+		}
+	}
+	for _, op := range newer {
+		r.stamps[stampKey(user, op.Path)] = stamp
+	}
+	if len(newer) > 0 {
+		r.enqueue(replicationEntry{user: user, ops: newer, stamp: stamp})
+	}
+	return nil
+}
+
+// nextStamp returns the stamp of a write of the operations that this region
+// accepts now, which is later than the stamps of the last writes of their
+// files even if the clock of another region is ahead. Must be called while no
+// other write of the user is applied.
+func (r *Replication) nextStamp(user string, ops []TransactionOp) writeStamp {
+	r.stampsMux.Lock()
+	defer r.stampsMux.Unlock()
+	now := time.Now().Round(0)
+	for _, op := range ops {
+		if last, exists := r.stamps[stampKey(user, op.Path)]; exists &&
+			!now.After(last.time) {
+			now = last.time.Add(time.Nanosecond)
+		}
+	}
+	return writeStamp{now, r.params.Region}
+}
+
+// setStamps records the stamp as the last write of the files of the
+// operations.
+func (r *Replication) setStamps(
+	user string, ops []TransactionOp, stamp writeStamp) {
+	r.stampsMux.Lock()
+	defer r.stampsMux.Unlock()
+	for _, op := range ops {
+		r.stamps[stampKey(user, op.Path)] = stamp
+	}
+}
+
+// stampKey returns the key of the stamp of the file of the user.
+func stampKey(user, path string) string {
+	return user + "/" + path
+}
+
+// applyForwarded applies a write that a read replica forwarded to the store
+// of its user created by the handler, which replicates it, while no other
+// write of the user is applied.
+//
+// Returns [NotPrimaryErr] if the server does not accept writes.
+func (r *Replication) applyForwarded(
+	h *handler, entry *rpc.RsReplicationEntry) error {
+	if !r.Primary() {
+		return NotPrimaryErr
+	}
+
+	s, err := h.newStore(h.storageDir, entry.GetUser())
+	if err != nil {
+		return err
+	}
+	ops := transactionOps(entry.GetOps())
+
+	l := h.locks.get(entry.GetUser())
+	l.Lock()
+	defer l.Unlock()
+	if c, ok := s.(committer); ok {
+		return c.commit(ops)
+	}
+	return applyOps(s, ops)
+}
+
+// replicatedStore queues the writes and deletes of the Store of a user on the
+// primary or a region for the standby, read replicas, and other regions once
+// they are applied, or forwards them to the primary on a read replica. Adheres
+// to the Store interface.
+type replicatedStore struct {
+	store.Store
+	r    *Replication
+	user string
+}
+
+// Write writes the data to the file at the path and queues the write.
+func (rs *replicatedStore) Write(path string, data []byte) error {
+	return rs.apply([]TransactionOp{{Path: path, Data: data}})
+}
+
+// Delete deletes the file at the path and queues the delete.
+func (rs *replicatedStore) Delete(path string) error {
+	return rs.apply([]TransactionOp{{Path: path, Delete: true}})
+}
+
+// commit applies the operations of a transaction and queues them as one
+// entry, so that the standby applies all of them or none of them.
+func (rs *replicatedStore) commit(ops []TransactionOp) error {
+	return rs.apply(ops)
+}
+
+// apply applies the operations to the underlying store and queues them if
+// they succeed, with a new stamp on a region. On a read replica, they are
+// forwarded to the primary instead, and reach the underlying store once the
+// primary replicates them.
+func (rs *replicatedStore) apply(ops []TransactionOp) error {
+	if rs.r.Replica() {
+		return rs.r.forward(rs.user, ops)
+	}
+
+	l := rs.r.locks.get(rs.user)
+	l.Lock()
+	defer l.Unlock()
+	var stamp writeStamp
+	if rs.r.Region() {
+		stamp = rs.r.nextStamp(rs.user, ops)
+	}
+	if err := applyOps(rs.Store, ops); err != nil {
+		return err
+	}
+	if rs.r.Region() {
+		rs.r.setStamps(rs.user, ops, stamp)
+	}
+	rs.r.enqueue(replicationEntry{user: rs.user, ops: ops, stamp: stamp})
+	return nil
+}
+
+// ListFiles returns the paths of all files in the underlying store. Returns an
+// error if the underlying store does not implement Lister.
+func (rs *replicatedStore) ListFiles() ([]string, error) {
+	lister, ok := rs.Store.(store.Lister)
+	if !ok {
+		return nil, errors.New("underlying store cannot list its files")
+	}
+	return lister.ListFiles()
+}
+
+// Size returns the total size of the files in the underlying store. Returns an
+// error if the underlying store does not implement Sizer.
+func (rs *replicatedStore) Size() (int64, error) {
+	sizer, ok := rs.Store.(store.Sizer)
+	if !ok {
+		return 0, errors.New("underlying store cannot report its size")
+	}
+	return sizer.Size()
+}
+
+// Ping returns an error if the underlying store cannot be reached. Stores that
+// do not implement Pinger are assumed to be reachable.
+func (rs *replicatedStore) Ping() error {
+	if pinger, ok := rs.Store.(store.Pinger); ok {
+		return pinger.Ping()
+	}
+	return nil
+}
+
+// Open opens the file at the path in the underlying store for reading.
+func (rs *replicatedStore) Open(path string) (io.ReadCloser, int64, error) {
+	return store.Open(rs.Store, path)
+}
+
+// Stat returns the metadata of the file at the path in the underlying store.
+func (rs *replicatedStore) Stat(path string) (store.Metadata, error) {
+	return store.Stat(rs.Store, path)
+}
+
+// SetDevice records the device as the writer of the file at the path in the
+// underlying store.
+func (rs *replicatedStore) SetDevice(
+	path string, sha256 []byte, device string) error {
+	return store.SetDevice(rs.Store, path, sha256, device)
+}
+
+// replicatedVersionedStore is a replicatedStore of a store that keeps previous
+// versions of files. The standby and read replicas keep the versions of the
+// writes they apply.
+type replicatedVersionedStore struct {
+	*replicatedStore
+	store.Versioner
+}
@@ -0,0 +1,676 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package server
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"gitlab.com/elixxir/remoteSyncServer/credentials"
+	"gitlab.com/elixxir/remoteSyncServer/rpc"
+)
+
+// Tests that NewReplication decodes the parameters of a primary, a standby, and
+// a read replica and applies the defaults.
+func TestNewReplication(t *testing.T) {
+	primary, err := NewReplication(map[string]interface{}{
+		"role": "primary", "key": "secret", "peer": "standby:22841",
+		"caPath": writeTestCA(t),
+	})
+	if err != nil {
+		t.Fatalf("Failed to create primary: %+v", err)
+	}
+	if primary.Standby() {
+		t.Errorf("Primary is a standby.")
+	}
+	if primary.Params().QueueSize != defaultReplicationQueueSize ||
+		cap(primary.targets[0].queue) != defaultReplicationQueueSize {
+		t.Errorf("Unexpected default queue size.\nexpected: %d\nreceived: %d",
+			defaultReplicationQueueSize, cap(primary.targets[0].queue))
+	}
+
+	standby, err := NewReplication(
+		map[string]interface{}{"role": "standby", "key": "secret"})
+	if err != nil {
+		t.Fatalf("Failed to create standby: %+v", err)
+	}
+	if !standby.Standby() {
+		t.Errorf("Standby is not a standby.")
+	}
+
+	replica, err := NewReplication(map[string]interface{}{
+		"role": "replica", "key": "secret", "peer": "primary:22841"})
+	if err != nil {
+		t.Fatalf("Failed to create replica: %+v", err)
+	}
+	if !replica.Replica() || replica.Primary() || len(replica.targets) != 0 {
+		t.Errorf("Unexpected replica: %+v", replica)
+	}
+}
+
+// Tests that NewReplication adds a target for the standby and each read
+// replica of a primary, and that a primary does not require a standby.
+func TestNewReplication_Replicas(t *testing.T) {
+	primary, err := NewReplication(map[string]interface{}{"role": "primary",
+		"key": "secret", "peer": "standby:22841",
+		"replicas": []interface{}{"replica1:22841", "replica2:22841"}})
+	if err != nil {
+		t.Fatalf("Failed to create primary: %+v", err)
+	}
+	expected := []string{"standby standby:22841", "replica replica1:22841",
+		"replica replica2:22841"}
+	var received []string
+	for _, target := range primary.targets {
+		received = append(received, target.role+" "+target.address)
+	}
+	if !reflect.DeepEqual(expected, received) {
+		t.Errorf("Unexpected targets.\nexpected: %v\nreceived: %v",
+			expected, received)
+	}
+
+	_, err = NewReplication(map[string]interface{}{"role": "primary",
+		"key": "secret", "replicas": []interface{}{"replica1:22841"}})
+	if err != nil {
+		t.Errorf("Failed to create primary without standby: %+v", err)
+	}
+}
+
+// Tests that NewReplication adds a target for each other region and the
+// standby of a region, and that a region accepts writes.
+func TestNewReplication_Region(t *testing.T) {
+	r, err := NewReplication(map[string]interface{}{"role": "region",
+		"key": "secret", "region": "eu", "peer": "standby:22841",
+		"regions": []interface{}{"us:22841", "asia:22841"}})
+	if err != nil {
+		t.Fatalf("Failed to create region: %+v", err)
+	}
+	if !r.Region() || !r.Primary() || r.Replica() {
+		t.Errorf("Unexpected region: %+v", r)
+	}
+	expected := []string{"standby standby:22841", "region us:22841",
+		"region asia:22841"}
+	var received []string
+	for _, target := range r.targets {
+		received = append(received, target.role+" "+target.address)
+	}
+	if !reflect.DeepEqual(expected, received) {
+		t.Errorf("Unexpected targets.\nexpected: %v\nreceived: %v",
+			expected, received)
+	}
+}
+
+// Error path: Tests that NewReplication returns an error for missing,
+// unknown, and invalid parameters.
+func TestNewReplication_Error(t *testing.T) {
+	for _, params := range []map[string]interface{}{
+		{},
+		{"role": "secondary", "key": "secret"},
+		{"role": "standby"},
+		{"role": "standby", "key": "secret", "unknown": true},
+		{"role": "primary", "key": "secret"},
+		{"role": "primary", "key": "secret", "peer": "a:1", "queueSize": 0},
+		{"role": "primary", "key": "secret", "peer": "a:1",
+			"caPath": filepath.Join(t.TempDir(), "missing.pem")},
+		{"role": "primary", "key": "secret", "replicas": []interface{}{""}},
+		{"role": "replica", "key": "secret"},
+		{"role": "region", "key": "secret", "regions": []interface{}{"a:1"}},
+		{"role": "region", "key": "secret", "region": "eu"},
+		{"role": "region", "key": "secret", "region": "eu",
+			"regions": []interface{}{""}},
+	} {
+		if _, err := NewReplication(params); err == nil {
+			t.Errorf("Failed to get error for params %v.", params)
+		}
+	}
+}
+
+// Tests that Replication.Promote makes a standby accept writes and returns
+// whether it was a standby, and that the interceptor only rejects writes and
+// registrations before the promotion.
+func TestReplication_Promote_interceptor(t *testing.T) {
+	r := newTestStandby(t)
+	interceptor := r.interceptor()
+	next := func(context.Context, interface{}) (interface{}, error) {
+		return "ok", nil
+	}
+	call := func(method string) error {
+		info := &grpc.UnaryServerInfo{FullMethod: method}
+		_, err := interceptor(context.Background(), nil, info, next)
+		return err
+	}
+
+	for _, method := range []string{"/mixmessages.RemoteSync/Write",
+		rpc.Registration_Register_FullMethodName} {
+		if err := call(method); status.Code(err) != codes.Unavailable {
+			t.Errorf("Unexpected code for %s on standby."+
+				"\nexpected: %s\nreceived: %s",
+				method, codes.Unavailable, status.Code(err))
+		}
+	}
+	if err := call("/mixmessages.RemoteSync/Read"); err != nil {
+		t.Errorf("Read rejected on standby: %+v", err)
+	}
+
+	if !r.Promote() {
+		t.Errorf("Promote did not report a standby.")
+	}
+	if r.Promote() {
+		t.Errorf("Promote reported a standby after promotion.")
+	}
+	if err := call("/mixmessages.RemoteSync/Write"); err != nil {
+		t.Errorf("Write rejected after promotion: %+v", err)
+	}
+}
+
+// Tests that the interceptor of a read replica only rejects registrations,
+// and that a read replica cannot be promoted.
+func TestReplication_interceptor_Replica(t *testing.T) {
+	r := newTestReplica(t)
+	interceptor := r.interceptor()
+	next := func(context.Context, interface{}) (interface{}, error) {
+		return "ok", nil
+	}
+	call := func(method string) error {
+		info := &grpc.UnaryServerInfo{FullMethod: method}
+		_, err := interceptor(context.Background(), nil, info, next)
+		return err
+	}
+
+	err := call(rpc.Registration_Register_FullMethodName)
+	if status.Code(err) != codes.Unavailable {
+		t.Errorf("Unexpected code for registration on replica."+
+			"\nexpected: %s\nreceived: %s", codes.Unavailable, status.Code(err))
+	}
+	for _, method := range []string{"/mixmessages.RemoteSync/Write",
+		rpc.Transaction_Commit_FullMethodName, "/mixmessages.RemoteSync/Read"} {
+		if err = call(method); err != nil {
+			t.Errorf("%s rejected on replica: %+v", method, err)
+		}
+	}
+
+	if r.Promote() || !r.Replica() {
+		t.Errorf("Read replica was promoted.")
+	}
+}
+
+// Tests that the stores wrapped by a primary apply writes, deletes, and
+// transactions and queue them in order, and do not queue failed writes.
+func TestReplication_wrap(t *testing.T) {
+	r := newTestPrimary(10, t)
+	s, err := r.wrap(newTestGCStore(false, t))("", "waldo")
+	if err != nil {
+		t.Fatalf("Failed to create store: %+v", err)
+	}
+
+	if err = s.Write("a", []byte("a")); err != nil {
+		t.Fatalf("Failed to write: %+v", err)
+	}
+	ops := []TransactionOp{{Path: "b", Data: []byte("b")}, {Path: "a",
+		Delete: true}}
+	if err = s.(committer).commit(ops); err != nil {
+		t.Fatalf("Failed to commit: %+v", err)
+	}
+	if err = s.Delete("a"); err == nil {
+		t.Errorf("Deleted a missing file.")
+	}
+
+	expected := []replicationEntry{
+		{user: "waldo", ops: []TransactionOp{{Path: "a", Data: []byte("a")}}},
+		{user: "waldo", ops: ops},
+	}
+	received := drainTestQueue(r.targets[0])
+	if !reflect.DeepEqual(expected, received) {
+		t.Errorf("Unexpected queued entries.\nexpected: %v\nreceived: %v",
+			expected, received)
+	}
+	if data, err := s.Read("b"); err != nil || string(data) != "b" {
+		t.Errorf("Unexpected data of b: %q, %+v", data, err)
+	}
+}
+
+// Tests that writeStamp.after orders stamps by time, then by region.
+func Test_writeStamp_after(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		a, b     writeStamp
+		expected bool
+	}{
+		{writeStamp{now.Add(1), "a"}, writeStamp{now, "b"}, true},
+		{writeStamp{now, "b"}, writeStamp{now.Add(1), "a"}, false},
+		{writeStamp{now, "b"}, writeStamp{now, "a"}, true},
+		{writeStamp{now, "a"}, writeStamp{now, "b"}, false},
+		{writeStamp{now, "a"}, writeStamp{now, "a"}, false},
+		{writeStamp{now, "a"}, writeStamp{now, ""}, true},
+	}
+	for i, tt := range tests {
+		if received := tt.a.after(tt.b); received != tt.expected {
+			t.Errorf("Unexpected result (%d).\nexpected: %t\nreceived: %t",
+				i, tt.expected, received)
+		}
+	}
+}
+
+// Tests that the writes of a region are queued for the other regions and its
+// standby with stamps of the region, and that a write of a file after a later
+// stamp from another region gets a later stamp.
+func TestReplication_wrap_Region(t *testing.T) {
+	r := newTestRegion("eu", t)
+	s, err := r.wrap(newTestGCStore(false, t))("", "waldo")
+	if err != nil {
+		t.Fatalf("Failed to create store: %+v", err)
+	}
+	future := writeStamp{time.Now().Add(time.Hour), "us"}
+	r.setStamps("waldo", []TransactionOp{{Path: "b"}}, future)
+
+	before := time.Now()
+	for _, path := range []string{"a", "b"} {
+		if err = s.Write(path, []byte(path)); err != nil {
+			t.Fatalf("Failed to write %s: %+v", path, err)
+		}
+	}
+
+	for _, target := range r.targets {
+		entries := drainTestQueue(target)
+		if len(entries) != 2 {
+			t.Fatalf("Unexpected entries of %s: %v", target.address, entries)
+		}
+		if stamp := entries[0].stamp; stamp.region != "eu" ||
+			stamp.time.Before(before) {
+			t.Errorf("Unexpected stamp of a: %+v", stamp)
+		}
+		if stamp := entries[1].stamp; !stamp.after(future) {
+			t.Errorf("Stamp %+v of b not after %+v.", stamp, future)
+		}
+	}
+}
+
+// Tests that a region only applies the operations of other regions that are
+// newer than the last writes of their files, and queues them for its standby
+// but not for the other regions.
+func TestReplication_applyRegion(t *testing.T) {
+	h := newHandler("", time.Hour, credentials.NewMemStore(nil), nil,
+		newTestGCStore(false, t))
+	r := newTestRegion("eu", t)
+	h.newStore = r.wrap(h.newStore)
+	s, err := h.newStore("", "waldo")
+	if err != nil {
+		t.Fatalf("Failed to create store: %+v", err)
+	}
+	if err = s.Write("a", []byte("eu")); err != nil {
+		t.Fatalf("Failed to write: %+v", err)
+	}
+	drainTestQueue(r.targets[0])
+	drainTestQueue(r.targets[1])
+
+	now := time.Unix(0, time.Now().UnixNano())
+	entry := func(path, data, region string, time time.Time) replicationEntry {
+		return replicationEntry{user: "waldo", ops: []TransactionOp{{
+			Path: path, Data: []byte(data), Delete: data == ""}},
+			stamp: writeStamp{time, region}}
+	}
+	entries := []replicationEntry{
+		entry("a", "old", "us", now.Add(-time.Hour)),
+		entry("b", "", "us", now),
+		entry("b", "old", "us", now.Add(-time.Minute)),
+		entry("c", "us", "us", now),
+		entry("c", "asia", "asia", now),
+		entry("a", "us", "us", now.Add(time.Hour)),
+	}
+	err = r.apply(h, replicateRequest(entries).GetEntries())
+	if err != nil {
+		t.Fatalf("Failed to apply: %+v", err)
+	}
+
+	for path, expected := range map[string]string{"a": "us", "c": "us"} {
+		if data, err := s.Read(path); err != nil || string(data) != expected {
+			t.Errorf("Unexpected data of %s: %q, %+v", path, data, err)
+		}
+	}
+	if _, err = s.Read("b"); err == nil {
+		t.Errorf("Older write of deleted file b was applied.")
+	}
+	expected := []replicationEntry{entries[1], entries[3], entries[5]}
+	received := drainTestQueue(r.targets[0])
+	if !reflect.DeepEqual(expected, received) {
+		t.Errorf("Unexpected queued entries.\nexpected: %v\nreceived: %v",
+			expected, received)
+	}
+	if received = drainTestQueue(r.targets[1]); len(received) != 0 {
+		t.Errorf("Entries of other regions queued for a region: %v",
+			received)
+	}
+}
+
+// Error path: Tests that a region rejects entries without a region with
+// NotStandbyErr.
+func TestReplication_applyRegion_NoRegion(t *testing.T) {
+	h := newHandler("", time.Hour, credentials.NewMemStore(nil), nil,
+		newTestGCStore(false, t))
+	r := newTestRegion("eu", t)
+	h.newStore = r.wrap(h.newStore)
+	entries := replicateRequest([]replicationEntry{{user: "waldo",
+		ops: []TransactionOp{{Path: "a", Data: []byte("a")}}}}).GetEntries()
+	if err := r.apply(h, entries); !errors.Is(err, NotStandbyErr) {
+		t.Errorf("Unexpected error for entry without region: %+v", err)
+	}
+}
+
+// Tests that Replication.enqueue queues each entry for every standby and read
+// replica.
+func TestReplication_enqueue(t *testing.T) {
+	r, err := NewReplication(map[string]interface{}{"role": "primary",
+		"key": "secret", "peer": "standby:22841",
+		"replicas": []interface{}{"replica1:22841", "replica2:22841"}})
+	if err != nil {
+		t.Fatalf("Failed to create primary: %+v", err)
+	}
+	entry := replicationEntry{user: "waldo", ops: []TransactionOp{{Path: "a"}}}
+	r.enqueue(entry)
+
+	for _, target := range r.targets {
+		received := drainTestQueue(target)
+		if !reflect.DeepEqual([]replicationEntry{entry}, received) {
+			t.Errorf("Unexpected entries of %s.\nexpected: %v\nreceived: %v",
+				target.address, []replicationEntry{entry}, received)
+		}
+	}
+}
+
+// Error path: Tests that writes are dropped and counted once the queue is
+// full.
+func TestReplication_enqueue_Dropped(t *testing.T) {
+	r := newTestPrimary(1, t)
+	for i := 0; i < 3; i++ {
+		r.enqueue(replicationEntry{user: "waldo"})
+	}
+	if r.Dropped() != 2 {
+		t.Errorf("Unexpected dropped writes.\nexpected: %d\nreceived: %d",
+			2, r.Dropped())
+	}
+}
+
+// Tests that Replication.run sends the queued entries with the key and
+// retries a batch the standby fails.
+func TestReplication_run(t *testing.T) {
+	r := newTestPrimary(10, t)
+	client := &testReplicationClient{
+		fail: 1, requests: make(chan *rpc.RsReplicateRequest, 10)}
+	stop := make(chan struct{})
+	defer close(stop)
+	r.enqueue(replicationEntry{
+		user: "waldo", ops: []TransactionOp{{Path: "a"}}})
+	r.enqueue(replicationEntry{
+		user: "carmen", ops: []TransactionOp{{Path: "b"}}})
+	go r.run(r.targets[0], client, stop)
+
+	var req *rpc.RsReplicateRequest
+	for i := 0; i < 2; i++ {
+		select {
+		case req = <-client.requests:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Timed out waiting for request %d.", i)
+		}
+	}
+	entries := req.GetEntries()
+	if len(entries) != 2 || entries[0].GetUser() != "waldo" ||
+		entries[1].GetOps()[0].GetPath() != "b" {
+		t.Errorf("Unexpected entries: %v", entries)
+	}
+	if client.key != bearerPrefix+"secret" {
+		t.Errorf("Unexpected authorization %q.", client.key)
+	}
+}
+
+// Tests that Replication.run stops once the standby rejects writes because it
+// was promoted.
+func TestReplication_run_Promoted(t *testing.T) {
+	r := newTestPrimary(10, t)
+	client := &testReplicationClient{
+		err:      status.Error(codes.FailedPrecondition, "promoted"),
+		fail:     2,
+		requests: make(chan *rpc.RsReplicateRequest, 10),
+	}
+	r.enqueue(replicationEntry{
+		user: "waldo", ops: []TransactionOp{{Path: "a"}}})
+
+	done := make(chan struct{})
+	go func() {
+		r.run(r.targets[0], client, make(chan struct{}))
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Replication did not stop.")
+	}
+	if len(client.requests) != 1 {
+		t.Errorf("Unexpected requests.\nexpected: %d\nreceived: %d",
+			1, len(client.requests))
+	}
+}
+
+// Tests that the Replication service applies the entries to the stores of the
+// standby, ignores deleting files that do not exist, and rejects requests
+// without the key or after promotion.
+func Test_replicationEndpoints_Replicate(t *testing.T) {
+	h := newHandler("", time.Hour, credentials.NewMemStore(nil), nil,
+		newTestGCStore(false, t))
+	e := &replicationEndpoints{h: h, r: newTestStandby(t)}
+	h.newStore = e.r.wrap(h.newStore)
+	ctx := metadata.NewIncomingContext(context.Background(),
+		metadata.Pairs(authorizationMetadataKey, bearerPrefix+"secret"))
+	req := replicateRequest([]replicationEntry{
+		{user: "waldo", ops: []TransactionOp{{Path: "a", Data: []byte("a")}}},
+		{user: "waldo", ops: []TransactionOp{{Path: "b", Delete: true}}},
+		{user: "carmen", ops: []TransactionOp{{Path: "c", Data: []byte("c")},
+			{Path: "d", Data: []byte("d")}}},
+	})
+
+	if _, err := e.Replicate(ctx, req); err != nil {
+		t.Fatalf("Failed to replicate: %+v", err)
+	}
+	for user, files := range map[string][]string{
+		"waldo": {"a"}, "carmen": {"c", "d"}} {
+		s := writeTestFiles(h.newStore, user, t)
+		if received := listTestFiles(s, t); !reflect.DeepEqual(
+			files, received) {
+			t.Errorf("Unexpected files of %q.\nexpected: %v\nreceived: %v",
+				user, files, received)
+		}
+	}
+
+	_, err := e.Replicate(context.Background(), req)
+	if status.Code(err) != codes.Unauthenticated {
+		t.Errorf("Unexpected code without key.\nexpected: %s\nreceived: %s",
+			codes.Unauthenticated, status.Code(err))
+	}
+	e.r.Promote()
+	_, err = e.Replicate(ctx, req)
+	if status.Code(err) != codes.FailedPrecondition {
+		t.Errorf("Unexpected code after promotion."+
+			"\nexpected: %s\nreceived: %s",
+			codes.FailedPrecondition, status.Code(err))
+	}
+}
+
+// Tests that the writes and transactions of a read replica are forwarded to
+// the Forward RPC of the primary, which applies and queues them, and that they
+// are not applied to the storage of the replica.
+func Test_replicationEndpoints_Forward(t *testing.T) {
+	primaryStore := newTestGCStore(false, t)
+	h := newHandler("", time.Hour, credentials.NewMemStore(nil), nil, nil)
+	e := &replicationEndpoints{h: h, r: newTestPrimary(10, t)}
+	h.newStore = e.r.wrap(primaryStore)
+
+	replica := newTestReplica(t)
+	replica.primary = &testForwardClient{e: e}
+	s, err := replica.wrap(newTestGCStore(false, t))("", "waldo")
+	if err != nil {
+		t.Fatalf("Failed to create store: %+v", err)
+	}
+
+	if err = s.Write("a", []byte("a")); err != nil {
+		t.Fatalf("Failed to write: %+v", err)
+	}
+	ops := []TransactionOp{{Path: "b", Data: []byte("b")}, {Path: "a",
+		Delete: true}}
+	if err = s.(committer).commit(ops); err != nil {
+		t.Fatalf("Failed to commit: %+v", err)
+	}
+	err = s.Delete("a")
+	if status.Code(err) != codes.NotFound {
+		t.Errorf("Unexpected code for deleting a missing file."+
+			"\nexpected: %s\nreceived: %s", codes.NotFound, status.Code(err))
+	}
+
+	files := listTestFiles(writeTestFiles(primaryStore, "waldo", t), t)
+	if !reflect.DeepEqual([]string{"b"}, files) {
+		t.Errorf("Unexpected files on primary.\nexpected: %v\nreceived: %v",
+			[]string{"b"}, files)
+	}
+	if _, err = s.Read("b"); err == nil {
+		t.Errorf("Forwarded write was applied to the replica.")
+	}
+	expected := []replicationEntry{
+		{user: "waldo", ops: []TransactionOp{{Path: "a", Data: []byte("a")}}},
+		{user: "waldo", ops: ops},
+	}
+	received := drainTestQueue(e.r.targets[0])
+	if !reflect.DeepEqual(expected, received) {
+		t.Errorf("Unexpected queued entries.\nexpected: %v\nreceived: %v",
+			expected, received)
+	}
+}
+
+// Error path: Tests that the Forward RPC rejects requests without the key and
+// on servers that do not accept writes.
+func Test_replicationEndpoints_Forward_Error(t *testing.T) {
+	h := newHandler("", time.Hour, credentials.NewMemStore(nil), nil,
+		newTestGCStore(false, t))
+	ctx := metadata.NewIncomingContext(context.Background(),
+		metadata.Pairs(authorizationMetadataKey, bearerPrefix+"secret"))
+	req := &rpc.RsForwardRequest{Entry: &rpc.RsReplicationEntry{User: "waldo",
+		Ops: []*rpc.RsTransactionOp{{Path: "a", Data: []byte("a")}}}}
+
+	e := &replicationEndpoints{h: h, r: newTestPrimary(10, t)}
+	_, err := e.Forward(context.Background(), req)
+	if status.Code(err) != codes.Unauthenticated {
+		t.Errorf("Unexpected code without key.\nexpected: %s\nreceived: %s",
+			codes.Unauthenticated, status.Code(err))
+	}
+	for _, r := range []*Replication{newTestStandby(t), newTestReplica(t)} {
+		e = &replicationEndpoints{h: h, r: r}
+		_, err = e.Forward(ctx, req)
+		if status.Code(err) != codes.FailedPrecondition {
+			t.Errorf("Unexpected code on %s.\nexpected: %s\nreceived: %s",
+				r.params.Role, codes.FailedPrecondition, status.Code(err))
+		}
+	}
+}
+
+// newTestPrimary returns a primary Replication with the queue size.
+func newTestPrimary(queueSize int, t testing.TB) *Replication {
+	r, err := NewReplication(map[string]interface{}{"role": "primary",
+		"key": "secret", "peer": "standby:22841", "queueSize": queueSize})
+	if err != nil {
+		t.Fatalf("Failed to create primary: %+v", err)
+	}
+	return r
+}
+
+// newTestStandby returns a standby Replication.
+func newTestStandby(t testing.TB) *Replication {
+	r, err := NewReplication(
+		map[string]interface{}{"role": "standby", "key": "secret"})
+	if err != nil {
+		t.Fatalf("Failed to create standby: %+v", err)
+	}
+	return r
+}
+
+// newTestReplica returns a read replica Replication.
+func newTestReplica(t testing.TB) *Replication {
+	r, err := NewReplication(map[string]interface{}{
+		"role": "replica", "key": "secret", "peer": "primary:22841"})
+	if err != nil {
+		t.Fatalf("Failed to create replica: %+v", err)
+	}
+	return r
+}
+
+// newTestRegion returns a region Replication with the name, a standby, and one
+// other region.
+func newTestRegion(region string, t testing.TB) *Replication {
+	r, err := NewReplication(map[string]interface{}{"role": "region",
+		"key": "secret", "region": region, "peer": "standby:22841",
+		"regions": []interface{}{"other:22841"}})
+	if err != nil {
+		t.Fatalf("Failed to create region: %+v", err)
+	}
+	return r
+}
+
+// drainTestQueue returns the queued entries of the standby or read replica.
+func drainTestQueue(target *replicationTarget) []replicationEntry {
+	var entries []replicationEntry
+	for len(target.queue) > 0 {
+		entries = append(entries, <-target.queue)
+	}
+	return entries
+}
+
+// testReplicationClient is a Replication client that fails the first fail
+// requests, with err if it is set, and sends each request to requests.
+type testReplicationClient struct {
+	rpc.ReplicationClient
+	err      error
+	fail     int
+	key      string
+	requests chan *rpc.RsReplicateRequest
+}
+
+// Replicate records the request and the authorization metadata.
+func (c *testReplicationClient) Replicate(ctx context.Context,
+	in *rpc.RsReplicateRequest, _ ...grpc.CallOption) (
+	*rpc.RsReplicateResponse, error) {
+	md, _ := metadata.FromOutgoingContext(ctx)
+	c.key = md.Get(authorizationMetadataKey)[0]
+	c.requests <- in
+	if c.fail > 0 && c.err != nil {
+		c.fail--
+		return nil, c.err
+	} else if c.fail > 0 {
+		c.fail--
+		return nil, errors.New("standby unavailable")
+	}
+	return &rpc.RsReplicateResponse{}, nil
+}
+
+// testForwardClient is a Replication client that calls the Forward RPC of the
+// endpoints directly, with the outgoing metadata as incoming metadata.
+type testForwardClient struct {
+	rpc.ReplicationClient
+	e *replicationEndpoints
+}
+
+// Forward calls the Forward RPC of the endpoints.
+func (c *testForwardClient) Forward(ctx context.Context,
+	in *rpc.RsForwardRequest, _ ...grpc.CallOption) (
+	*rpc.RsForwardResponse, error) {
+	md, _ := metadata.FromOutgoingContext(ctx)
+	return c.e.Forward(metadata.NewIncomingContext(ctx, md), in)
+}
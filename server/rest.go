@@ -0,0 +1,412 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package server
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+)
+
+const (
+	// grpcContentType is the content type of native gRPC requests.
+	grpcContentType = "application/grpc"
+
+	// restContentType is the content type of REST requests and responses.
+	restContentType = "application/json"
+
+	// grpcFrameHeaderLen is the length of the header of each message sent over
+	// gRPC: a compression flag and the big-endian message length.
+	grpcFrameHeaderLen = 5
+
+	// maxPooledRESTBuffer is the capacity, in bytes, above which a buffer is
+	// not returned to restBuffers, so that a few large requests do not keep
+	// their memory in the pool.
+	maxPooledRESTBuffer = 4 << 20
+)
+
+// restBuffers pools the buffers that the bodies of REST requests and the gRPC
+// frames of the transcoded requests and responses are read and encoded into,
+// so that each request does not allocate and grow buffers for its payload.
+var restBuffers = sync.Pool{New: func() interface{} {
+	return new([]byte)
+}}
+
+// getRESTBuffer returns an empty buffer from restBuffers.
+func getRESTBuffer() *[]byte {
+	buf := restBuffers.Get().(*[]byte)
+	*buf = (*buf)[:0]
+	return buf
+}
+
+// putRESTBuffer returns the buffer to restBuffers unless it is too large. It
+// must not be used after.
+func putRESTBuffer(buf *[]byte) {
+	if cap(*buf) <= maxPooledRESTBuffer {
+		restBuffers.Put(buf)
+	}
+}
+
+// restHandler serves the unary RPCs of the gRPC server as JSON over HTTP. Each
+// RPC is called with a POST to its gRPC path, such as
+// /remoteSync.Session/PasswordLogin, with the request message as JSON in the
+// body, and responds with the response message as JSON. The request is passed
+// to the gRPC server as a native gRPC request, so that it goes through the
+// same interceptors, and the headers, such as authorization, are its metadata.
+// Errors are responded to with the HTTP status matching the gRPC code and the
+// gRPC status as JSON. If limits is not nil, requests over the maximum request
+// size are rejected.
+type restHandler struct {
+	grpcServer *grpc.Server
+	limits     *Limits
+	autoBan    *AutoBan
+}
+
+// ServeHTTP transcodes the REST request into a gRPC request, serves it with the
+// gRPC server, and transcodes the response. Requests under restRoutePrefix are
+// served by the routes of the resource API.
+func (rh *restHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if strings.HasPrefix(r.URL.Path, restRoutePrefix) {
+		rh.serveRoute(w, r)
+		return
+	} else if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeRESTError(w, status.Newf(codes.Unimplemented,
+			"method %s not allowed; RPCs are called with POST", r.Method))
+		return
+	}
+	method, err := rh.method(r.URL.Path)
+	if err != nil {
+		writeRESTError(w, status.Convert(err))
+		return
+	}
+	buf := getRESTBuffer()
+	defer putRESTBuffer(buf)
+	body, err := rh.readBody(r, buf)
+	if err != nil {
+		rh.writeError(w, r, status.Convert(err))
+		return
+	}
+	in, err := newMessage(method.Input())
+	if err != nil {
+		writeRESTError(w, status.Convert(err))
+		return
+	}
+	if len(bytes.TrimSpace(body)) > 0 {
+		if err = protojson.Unmarshal(body, in); err != nil {
+			rh.writeError(w, r, status.Newf(
+				codes.InvalidArgument, "invalid request: %v", err))
+			return
+		}
+	}
+
+	out, err := rh.call(r, method, in)
+	if err != nil {
+		writeRESTError(w, status.Convert(err))
+		return
+	}
+	writeRESTResponse(w, out)
+}
+
+// readBody reads the body of the request into the buffer and returns it. If the
+// maximum request size is set, bodies over a multiple of it are rejected.
+func (rh *restHandler) readBody(
+	r *http.Request, buf *[]byte) ([]byte, error) {
+	// The JSON body is larger than the request message, so it is only
+	// limited loosely and the message is checked once decoded
+	bodyLimit := int64(math.MaxInt32)
+	if rh.limits != nil && rh.limits.MaxRequestBytes > 0 {
+		bodyLimit = restBodyFactor * rh.limits.MaxRequestBytes
+	}
+	body, err := readAll(io.LimitReader(r.Body, bodyLimit+1), buf,
+		r.ContentLength)
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		return nil, status.Errorf(codes.ResourceExhausted,
+			"%v: body exceeds %d bytes", RequestTooLargeErr, maxBytesErr.Limit)
+	} else if err != nil {
+		return nil, status.Errorf(
+			codes.InvalidArgument, "failed to read request: %v", err)
+	} else if int64(len(body)) > bodyLimit {
+		return nil, status.Errorf(codes.ResourceExhausted,
+			"%v: body exceeds %d bytes", RequestTooLargeErr, bodyLimit)
+	}
+	return body, nil
+}
+
+// readAll reads from r until EOF into the buffer and returns the data read. The
+// buffer is first grown to the expected size, if known, so that it is not
+// grown repeatedly while reading. Since the size is given by the client, it is
+// only trusted up to maxPooledRESTBuffer. The buffer may be grown and reused
+// after.
+func readAll(r io.Reader, buf *[]byte, size int64) ([]byte, error) {
+	b := bytes.NewBuffer((*buf)[:0])
+	if size > maxPooledRESTBuffer {
+		size = maxPooledRESTBuffer
+	}
+	if size > 0 {
+		// The extra space lets the buffer read EOF without growing
+		b.Grow(int(size) + bytes.MinRead)
+	}
+	_, err := b.ReadFrom(r)
+	*buf = b.Bytes()
+	return *buf, err
+}
+
+// call serves the RPC with the request message as a native gRPC request with
+// the headers of the HTTP request as its metadata and returns the response
+// message. Errors are returned as gRPC status errors.
+func (rh *restHandler) call(r *http.Request,
+	method protoreflect.MethodDescriptor, in proto.Message) (
+	proto.Message, error) {
+	if rh.limits != nil {
+		err := rh.limits.checkRequest(int64(proto.Size(in)))
+		if err != nil {
+			return nil, status.Error(codes.ResourceExhausted, err.Error())
+		}
+	}
+	frame := getRESTBuffer()
+	defer putRESTBuffer(frame)
+	var err error
+	if *frame, err = grpcFrame(*frame, in); err != nil {
+		return nil, err
+	}
+
+	req := r.Clone(r.Context())
+	req.Method = http.MethodPost
+	req.URL.Path = "/" + string(method.Parent().FullName()) + "/" +
+		string(method.Name())
+	req.ProtoMajor, req.ProtoMinor, req.Proto = 2, 0, "HTTP/2.0"
+	req.Header.Set("Content-Type", grpcContentType+"+proto")
+	req.Header.Del("Content-Length")
+	req.ContentLength = int64(len(*frame))
+	req.Body = io.NopCloser(bytes.NewReader(*frame))
+	respBuf := getRESTBuffer()
+	rec := &restRecorder{
+		header: make(http.Header), body: bytes.NewBuffer(*respBuf)}
+	defer func() {
+		// The recorder may have grown the buffer while recording
+		*respBuf = rec.body.Bytes()
+		putRESTBuffer(respBuf)
+	}()
+	rh.grpcServer.ServeHTTP(rec, req)
+
+	if st := rec.status(); st.Code() != codes.OK {
+		return nil, st.Err()
+	}
+	out, err := newMessage(method.Output())
+	if err != nil {
+		return nil, err
+	}
+	if err = readGRPCFrame(rec.body.Bytes(), out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// method returns the descriptor of the unary RPC registered on the gRPC server
+// at the path, which has the form /<service>/<method>.
+func (rh *restHandler) method(
+	path string) (protoreflect.MethodDescriptor, error) {
+	serviceName, methodName, _ := strings.Cut(
+		strings.TrimPrefix(path, "/"), "/")
+	info, exists := rh.grpcServer.GetServiceInfo()[serviceName]
+	if !exists {
+		return nil, status.Errorf(codes.NotFound, "unknown service %q",
+			serviceName)
+	}
+	for _, m := range info.Methods {
+		if m.Name == methodName && (m.IsClientStream || m.IsServerStream) {
+			return nil, status.Errorf(codes.Unimplemented,
+				"streaming RPC %s is not available over REST", path)
+		}
+	}
+
+	desc, err := protoregistry.GlobalFiles.FindDescriptorByName(
+		protoreflect.FullName(serviceName))
+	if err != nil {
+		return nil, status.Errorf(
+			codes.Unimplemented, "service %q has no descriptor", serviceName)
+	}
+	service, ok := desc.(protoreflect.ServiceDescriptor)
+	if !ok {
+		return nil, status.Errorf(
+			codes.NotFound, "unknown service %q", serviceName)
+	}
+	method := service.Methods().ByName(protoreflect.Name(methodName))
+	if method == nil {
+		return nil, status.Errorf(codes.NotFound, "unknown method %q in "+
+			"service %q", methodName, serviceName)
+	}
+	return method, nil
+}
+
+// newMessage returns a new message of the described type.
+func newMessage(desc protoreflect.MessageDescriptor) (proto.Message, error) {
+	mt, err := protoregistry.GlobalTypes.FindMessageByName(desc.FullName())
+	if err != nil {
+		return nil, status.Errorf(codes.Internal,
+			"unknown message type %s: %v", desc.FullName(), err)
+	}
+	return mt.New().Interface(), nil
+}
+
+// grpcFrame appends the message encoded as an uncompressed gRPC message to
+// dst and returns the result. The message is encoded directly after the
+// header, so that it is not copied again.
+func grpcFrame(dst []byte, m proto.Message) ([]byte, error) {
+	var header [grpcFrameHeaderLen]byte
+	frame, err := proto.MarshalOptions{}.MarshalAppend(
+		append(dst, header[:]...), m)
+	if err != nil {
+		return nil, status.Errorf(
+			codes.Internal, "failed to encode request: %v", err)
+	}
+	binary.BigEndian.PutUint32(frame[len(dst)+1:],
+		uint32(len(frame)-len(dst)-grpcFrameHeaderLen))
+	return frame, nil
+}
+
+// readGRPCFrame decodes the uncompressed gRPC message at the start of the data
+// into the message.
+func readGRPCFrame(data []byte, m proto.Message) error {
+	if len(data) < grpcFrameHeaderLen || data[0] != 0 {
+		return status.Error(codes.Internal, "invalid gRPC response")
+	}
+	n := binary.BigEndian.Uint32(data[1:grpcFrameHeaderLen])
+	if uint64(len(data)-grpcFrameHeaderLen) < uint64(n) {
+		return status.Error(codes.Internal, "truncated gRPC response")
+	}
+	data = data[grpcFrameHeaderLen : grpcFrameHeaderLen+int(n)]
+	if err := proto.Unmarshal(data, m); err != nil {
+		return status.Errorf(
+			codes.Internal, "failed to decode response: %v", err)
+	}
+	return nil
+}
+
+// writeRESTResponse responds with the message as JSON.
+func writeRESTResponse(w http.ResponseWriter, m proto.Message) {
+	data, err := protojson.Marshal(m)
+	if err != nil {
+		writeRESTError(w, status.Newf(
+			codes.Internal, "failed to encode response: %v", err))
+		return
+	}
+	w.Header().Set("Content-Type", restContentType)
+	_, _ = w.Write(data)
+}
+
+// writeError responds with the error status of a request that failed before it
+// was served as an RPC and records it for automatic banning, if enabled. Errors
+// of RPCs are recorded by the interceptor.
+func (rh *restHandler) writeError(
+	w http.ResponseWriter, r *http.Request, st *status.Status) {
+	rh.autoBan.recordHTTP(r, st.Err())
+	writeRESTError(w, st)
+}
+
+// writeRESTError responds with the HTTP status matching the gRPC status code
+// and the status as JSON.
+func writeRESTError(w http.ResponseWriter, st *status.Status) {
+	data, err := protojson.Marshal(st.Proto())
+	if err != nil {
+		http.Error(w, st.Message(), httpStatus(st.Code()))
+		return
+	}
+	w.Header().Set("Content-Type", restContentType)
+	w.WriteHeader(httpStatus(st.Code()))
+	_, _ = w.Write(data)
+}
+
+// httpStatus returns the HTTP status code matching the gRPC status code.
+func httpStatus(code codes.Code) int {
+	switch code {
+	case codes.OK:
+		return http.StatusOK
+	case codes.Canceled:
+		return 499
+	case codes.InvalidArgument, codes.FailedPrecondition, codes.OutOfRange:
+		return http.StatusBadRequest
+	case codes.DeadlineExceeded:
+		return http.StatusGatewayTimeout
+	case codes.NotFound:
+		return http.StatusNotFound
+	case codes.AlreadyExists, codes.Aborted:
+		return http.StatusConflict
+	case codes.PermissionDenied:
+		return http.StatusForbidden
+	case codes.Unauthenticated:
+		return http.StatusUnauthorized
+	case codes.ResourceExhausted:
+		return http.StatusTooManyRequests
+	case codes.Unimplemented:
+		return http.StatusNotImplemented
+	case codes.Unavailable:
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// restRecorder records the response of the gRPC server to a transcoded REST
+// request. It implements http.Flusher, which the gRPC server requires.
+type restRecorder struct {
+	header http.Header
+	body   *bytes.Buffer
+	code   int
+}
+
+// Header returns the response headers, which include the gRPC trailers once
+// the RPC completes.
+func (rr *restRecorder) Header() http.Header {
+	return rr.header
+}
+
+// Write records the response body.
+func (rr *restRecorder) Write(data []byte) (int, error) {
+	return rr.body.Write(data)
+}
+
+// WriteHeader records the HTTP status code.
+func (rr *restRecorder) WriteHeader(code int) {
+	rr.code = code
+}
+
+// Flush does nothing, since the response is only read once it is complete.
+func (rr *restRecorder) Flush() {}
+
+// status returns the gRPC status of the response. Responses without one, such
+// as HTTP errors written by the gRPC server, are internal errors.
+func (rr *restRecorder) status() *status.Status {
+	code, err := strconv.Atoi(rr.header.Get("Grpc-Status"))
+	if err != nil {
+		return status.Newf(codes.Internal, "invalid gRPC response (HTTP %d): "+
+			"%s", rr.code, strings.TrimSpace(rr.body.String()))
+	}
+	message, err := url.PathUnescape(rr.header.Get("Grpc-Message"))
+	if err != nil {
+		message = rr.header.Get("Grpc-Message")
+	}
+	return status.New(codes.Code(code), message)
+}
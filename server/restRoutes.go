@@ -0,0 +1,181 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package server
+
+import (
+	"encoding/base64"
+	"net/http"
+	"sort"
+	"strings"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+
+	pb "gitlab.com/elixxir/comms/mixmessages"
+	"gitlab.com/elixxir/remoteSyncServer/rpc"
+)
+
+const (
+	// restRoutePrefix is the path prefix of the routes of the resource API.
+	restRoutePrefix = "/v1/"
+
+	// restDataContentType is the content type of file data read with the
+	// resource API.
+	restDataContentType = "application/octet-stream"
+)
+
+// restRoute is a route of the resource API. It calls the RPC with the request
+// built from the file path, token, and body of the HTTP request, and responds
+// with the response of the RPC.
+type restRoute struct {
+	rpc     string
+	request func(path string, token, body []byte) (proto.Message, error)
+	respond func(w http.ResponseWriter, out proto.Message)
+}
+
+// restRoutes are the routes of the resource API by the resource following
+// restRoutePrefix and the HTTP method. The file path follows the resource.
+var restRoutes = map[string]map[string]restRoute{
+	"login": {
+		http.MethodPost: {
+			rpc:     rpc.Session_PasswordLogin_FullMethodName,
+			request: restLoginRequest,
+			respond: writeRESTResponse,
+		},
+	},
+	"files": {
+		http.MethodGet: {
+			rpc:     "/mixmessages.RemoteSync/Read",
+			request: restReadRequest,
+			respond: writeRESTData,
+		},
+		http.MethodPut: {
+			rpc:     "/mixmessages.RemoteSync/Write",
+			request: restWriteRequest,
+			respond: writeRESTNoContent,
+		},
+	},
+	"dirs": {
+		http.MethodGet: {
+			rpc:     "/mixmessages.RemoteSync/ReadDir",
+			request: restReadRequest,
+			respond: writeRESTResponse,
+		},
+	},
+	"lastModified": {
+		http.MethodGet: {
+			rpc:     "/mixmessages.RemoteSync/GetLastModified",
+			request: restReadRequest,
+			respond: writeRESTResponse,
+		},
+	},
+}
+
+// serveRoute serves the request with the route of the resource API matching
+// its path and method. The token is taken from the authorization header.
+func (rh *restHandler) serveRoute(w http.ResponseWriter, r *http.Request) {
+	resource, path, _ := strings.Cut(
+		strings.TrimPrefix(r.URL.Path, restRoutePrefix), "/")
+	methods, exists := restRoutes[resource]
+	if !exists {
+		writeRESTError(w, status.Newf(
+			codes.NotFound, "unknown resource %q", resource))
+		return
+	}
+	route, exists := methods[r.Method]
+	if !exists {
+		allowed := make([]string, 0, len(methods))
+		for method := range methods {
+			allowed = append(allowed, method)
+		}
+		sort.Strings(allowed)
+		w.Header().Set("Allow", strings.Join(allowed, ", "))
+		writeRESTError(w, status.Newf(codes.Unimplemented,
+			"method %s not allowed for %s", r.Method, resource))
+		return
+	}
+
+	token, err := restToken(r)
+	if err != nil {
+		rh.writeError(w, r, status.Convert(err))
+		return
+	}
+	buf := getRESTBuffer()
+	defer putRESTBuffer(buf)
+	body, err := rh.readBody(r, buf)
+	if err != nil {
+		rh.writeError(w, r, status.Convert(err))
+		return
+	}
+	in, err := route.request(path, token, body)
+	if err != nil {
+		rh.writeError(w, r, status.Convert(err))
+		return
+	}
+	method, err := rh.method(route.rpc)
+	if err != nil {
+		writeRESTError(w, status.Convert(err))
+		return
+	}
+	out, err := rh.call(r, method, in)
+	if err != nil {
+		writeRESTError(w, status.Convert(err))
+		return
+	}
+	route.respond(w, out)
+}
+
+// restToken returns the token in the authorization header as sent with the
+// "Bearer " prefix in base64, as it is returned by login. Returns nil if there
+// is no authorization header.
+func restToken(r *http.Request) ([]byte, error) {
+	auth := r.Header.Get(authorizationMetadataKey)
+	if auth == "" {
+		return nil, nil
+	}
+	token, err := base64.StdEncoding.DecodeString(
+		strings.TrimPrefix(auth, bearerPrefix))
+	if err != nil {
+		return nil, status.Errorf(
+			codes.Unauthenticated, "invalid token encoding: %v", err)
+	}
+	return token, nil
+}
+
+// restLoginRequest returns the password login request in the JSON body.
+func restLoginRequest(_ string, _, body []byte) (proto.Message, error) {
+	var msg rpc.RsPasswordLoginRequest
+	if err := protojson.Unmarshal(body, &msg); err != nil {
+		return nil, status.Errorf(
+			codes.InvalidArgument, "invalid request: %v", err)
+	}
+	return &msg, nil
+}
+
+// restReadRequest returns the read request for the file path.
+func restReadRequest(path string, token, _ []byte) (proto.Message, error) {
+	return &pb.RsReadRequest{Path: path, Token: token}, nil
+}
+
+// restWriteRequest returns the request to write the body to the file path.
+func restWriteRequest(path string, token, body []byte) (proto.Message, error) {
+	return &pb.RsWriteRequest{Path: path, Data: body, Token: token}, nil
+}
+
+// writeRESTData responds with the data of the read response as is.
+func writeRESTData(w http.ResponseWriter, out proto.Message) {
+	w.Header().Set("Content-Type", restDataContentType)
+	_, _ = w.Write(out.(*pb.RsReadResponse).GetData())
+}
+
+// writeRESTNoContent responds with no content.
+func writeRESTNoContent(w http.ResponseWriter, _ proto.Message) {
+	w.WriteHeader(http.StatusNoContent)
+}
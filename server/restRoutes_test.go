@@ -0,0 +1,171 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package server
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/encoding/protojson"
+
+	pb "gitlab.com/elixxir/comms/mixmessages"
+	"gitlab.com/elixxir/remoteSyncServer/credentials"
+	"gitlab.com/elixxir/remoteSyncServer/rpc"
+	"gitlab.com/elixxir/remoteSyncServer/store"
+)
+
+// newRESTRoutesTestHandler returns a restHandler for a gRPC server with the
+// RemoteSync and Session services of a handler with the user waldo.
+func newRESTRoutesTestHandler() *restHandler {
+	users := credentials.NewMemStore(map[string]string{"waldo": "hunter2"})
+	h := newHandler("", time.Hour, users, nil, store.NewMemStore)
+	grpcServer := grpc.NewServer()
+	pb.RegisterRemoteSyncServer(grpcServer, &remoteSyncEndpoints{h: h})
+	rpc.RegisterSessionServer(grpcServer, &sessionEndpoints{h: h})
+	return &restHandler{grpcServer: grpcServer}
+}
+
+// serveTestRoute serves the request with the handler and returns the
+// response.
+func serveTestRoute(rh *restHandler, method, path, token string,
+	body io.Reader) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, path, body)
+	if token != "" {
+		r.Header.Set("Authorization", bearerPrefix+token)
+	}
+	w := httptest.NewRecorder()
+	rh.ServeHTTP(w, r)
+	return w
+}
+
+// Tests that the routes of the resource API log in, write and read a file,
+// list its directory, and return its last modification time.
+func Test_restHandler_serveRoute(t *testing.T) {
+	rh := newRESTRoutesTestHandler()
+	w := serveTestRoute(rh, http.MethodPost, "/v1/login", "",
+		strings.NewReader(`{"Username": "waldo", "Password": "hunter2"}`))
+	var login rpc.RsPasswordLoginResponse
+	if err := protojson.Unmarshal(w.Body.Bytes(), &login); err != nil {
+		t.Fatalf("Failed to decode login response %d %q: %+v",
+			w.Code, w.Body, err)
+	}
+	token := base64.StdEncoding.EncodeToString(login.GetToken())
+
+	w = serveTestRoute(rh, http.MethodPut, "/v1/files/docs/notes/a.txt",
+		token, strings.NewReader("file data"))
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("Failed to write file: %d %s", w.Code, w.Body)
+	}
+
+	w = serveTestRoute(rh, http.MethodGet, "/v1/files/docs/notes/a.txt",
+		token, nil)
+	if w.Code != http.StatusOK || w.Body.String() != "file data" {
+		t.Errorf("Unexpected file read: %d %q", w.Code, w.Body)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != restDataContentType {
+		t.Errorf("Unexpected content type.\nexpected: %s\nreceived: %s",
+			restDataContentType, ct)
+	}
+
+	w = serveTestRoute(rh, http.MethodGet, "/v1/dirs/docs", token, nil)
+	var dir pb.RsReadDirResponse
+	if err := protojson.Unmarshal(w.Body.Bytes(), &dir); err != nil {
+		t.Fatalf("Failed to decode directory %d %q: %+v", w.Code, w.Body, err)
+	} else if !reflect.DeepEqual([]string{"notes"}, dir.GetData()) {
+		t.Errorf("Unexpected directory: %v", dir.GetData())
+	}
+
+	w = serveTestRoute(rh, http.MethodGet, "/v1/lastModified/docs/notes/a.txt",
+		token, nil)
+	var modified pb.RsTimestampResponse
+	if err := protojson.Unmarshal(w.Body.Bytes(), &modified); err != nil {
+		t.Fatalf("Failed to decode timestamp %d %q: %+v",
+			w.Code, w.Body, err)
+	} else if time.Since(time.Unix(0, modified.GetTimestamp())) > time.Minute {
+		t.Errorf("Unexpected last modified time: %d", modified.GetTimestamp())
+	}
+}
+
+// Error path: Tests that the resource API responds with the HTTP status
+// matching the error for unknown resources, methods not allowed, and invalid
+// tokens.
+func Test_restHandler_serveRoute_Error(t *testing.T) {
+	rh := newRESTRoutesTestHandler()
+	tests := []struct {
+		method, path, token string
+		code                int
+	}{
+		{http.MethodGet, "/v1/unknown/a.txt", "", http.StatusNotFound},
+		{http.MethodDelete, "/v1/files/a.txt", "", http.StatusNotImplemented},
+		{http.MethodGet, "/v1/files/a.txt", "!", http.StatusUnauthorized},
+		{http.MethodPost, "/v1/login", "", http.StatusBadRequest},
+	}
+	for i, tt := range tests {
+		w := serveTestRoute(rh, tt.method, tt.path, tt.token,
+			strings.NewReader("not JSON"))
+		if w.Code != tt.code {
+			t.Errorf("Unexpected status for %s %s (%d).\nexpected: %d"+
+				"\nreceived: %d %s", tt.method, tt.path, i, tt.code, w.Code,
+				w.Body)
+		}
+	}
+
+	w := serveTestRoute(rh, http.MethodDelete, "/v1/files/a.txt", "", nil)
+	if allow := w.Header().Get("Allow"); allow != "GET, PUT" {
+		t.Errorf("Unexpected allowed methods: %q", allow)
+	}
+}
+
+// Benchmarks writing and reading files of each size through the routes of the
+// resource API, which transcode them to and from native gRPC requests.
+func Benchmark_restHandler_serveRoute(b *testing.B) {
+	rh := newRESTRoutesTestHandler()
+	w := serveTestRoute(rh, http.MethodPost, "/v1/login", "",
+		strings.NewReader(`{"Username": "waldo", "Password": "hunter2"}`))
+	var login rpc.RsPasswordLoginResponse
+	if err := protojson.Unmarshal(w.Body.Bytes(), &login); err != nil {
+		b.Fatalf("Failed to decode login response %d %q: %+v",
+			w.Code, w.Body, err)
+	}
+	token := base64.StdEncoding.EncodeToString(login.GetToken())
+
+	for _, size := range benchmarkPayloadSizes {
+		data := make([]byte, size)
+		b.Run(fmt.Sprintf("Write/%d", size), func(b *testing.B) {
+			b.ReportAllocs()
+			b.SetBytes(int64(size))
+			for i := 0; i < b.N; i++ {
+				w = serveTestRoute(rh, http.MethodPut, "/v1/files/file",
+					token, bytes.NewReader(data))
+				if w.Code != http.StatusNoContent {
+					b.Fatalf("Failed to write file: %d %s", w.Code, w.Body)
+				}
+			}
+		})
+		b.Run(fmt.Sprintf("Read/%d", size), func(b *testing.B) {
+			b.ReportAllocs()
+			b.SetBytes(int64(size))
+			for i := 0; i < b.N; i++ {
+				w = serveTestRoute(rh, http.MethodGet, "/v1/files/file",
+					token, nil)
+				if w.Code != http.StatusOK {
+					b.Fatalf("Failed to read file: %d %s", w.Code, w.Body)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,197 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package server
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	spb "google.golang.org/genproto/googleapis/rpc/status"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/types/known/emptypb"
+
+	"gitlab.com/elixxir/remoteSyncServer/credentials"
+	"gitlab.com/elixxir/remoteSyncServer/rpc"
+)
+
+// newRESTTestHandler returns a restHandler for a gRPC server with the Info and
+// Registration services. Registration is disabled.
+func newRESTTestHandler(t *testing.T) *restHandler {
+	r, err := NewRegistrar(
+		RegistrationDisabled, credentials.NewMemStore(nil), nil, nil, nil)
+	if err != nil {
+		t.Fatalf("Failed to create Registrar: %+v", err)
+	}
+	grpcServer := grpc.NewServer()
+	rpc.RegisterInfoServer(grpcServer,
+		&infoEndpoints{version: &rpc.RsGetVersionResponse{Version: "1.2.3"}})
+	rpc.RegisterRegistrationServer(grpcServer, &registrationEndpoints{r: r})
+	return &restHandler{grpcServer: grpcServer}
+}
+
+// Tests that restHandler responds to a JSON request with the JSON response of
+// the RPC.
+func Test_restHandler(t *testing.T) {
+	rh := newRESTTestHandler(t)
+	w := httptest.NewRecorder()
+	rh.ServeHTTP(w, httptest.NewRequest(http.MethodPost,
+		"/remoteSync.Info/GetVersion", strings.NewReader("{}")))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Unexpected status.\nexpected: %d\nreceived: %d %s",
+			http.StatusOK, w.Code, w.Body)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != restContentType {
+		t.Errorf("Unexpected content type.\nexpected: %s\nreceived: %s",
+			restContentType, ct)
+	}
+	var resp rpc.RsGetVersionResponse
+	if err := protojson.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Failed to decode response %q: %+v", w.Body, err)
+	}
+	if resp.GetVersion() != "1.2.3" {
+		t.Errorf("Unexpected version.\nexpected: %s\nreceived: %s",
+			"1.2.3", resp.GetVersion())
+	}
+
+	// An empty body is an empty request
+	w = httptest.NewRecorder()
+	rh.ServeHTTP(w, httptest.NewRequest(
+		http.MethodPost, "/remoteSync.Info/GetVersion", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("Unexpected status for empty body."+
+			"\nexpected: %d\nreceived: %d %s", http.StatusOK, w.Code, w.Body)
+	}
+}
+
+// Error path: Tests that restHandler responds with the HTTP status matching
+// the gRPC code and the status as JSON for invalid requests and RPC errors.
+func Test_restHandler_Error(t *testing.T) {
+	rh := newRESTTestHandler(t)
+	tests := []struct {
+		method, path, body string
+		status             int
+		code               codes.Code
+	}{
+		{http.MethodGet, "/remoteSync.Info/GetVersion", "",
+			http.StatusNotImplemented, codes.Unimplemented},
+		{http.MethodPost, "/remoteSync.Info/Unknown", "{}",
+			http.StatusNotFound, codes.NotFound},
+		{http.MethodPost, "/remoteSync.Unknown/GetVersion", "{}",
+			http.StatusNotFound, codes.NotFound},
+		{http.MethodPost, "/remoteSync.Registration/Register", "{\"Foo\": 1}",
+			http.StatusBadRequest, codes.InvalidArgument},
+		{http.MethodPost, "/remoteSync.Registration/Register",
+			"{\"Username\": \"waldo\", \"Password\": \"hunter2\"}",
+			http.StatusNotImplemented, codes.Unimplemented},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		rh.ServeHTTP(w, httptest.NewRequest(
+			tt.method, tt.path, strings.NewReader(tt.body)))
+
+		if w.Code != tt.status {
+			t.Errorf("Unexpected status for %s %s."+
+				"\nexpected: %d\nreceived: %d %s",
+				tt.method, tt.path, tt.status, w.Code, w.Body)
+		}
+		var st spb.Status
+		if err := protojson.Unmarshal(w.Body.Bytes(), &st); err != nil {
+			t.Errorf("Failed to decode status %q for %s %s: %+v",
+				w.Body, tt.method, tt.path, err)
+		} else if codes.Code(st.GetCode()) != tt.code {
+			t.Errorf("Unexpected code for %s %s.\nexpected: %s\nreceived: %s",
+				tt.method, tt.path, tt.code, codes.Code(st.GetCode()))
+		}
+	}
+}
+
+// Error path: Tests that restHandler responds with RESOURCE_EXHAUSTED for
+// requests over the maximum request size, whether their body or message is too
+// large.
+func Test_restHandler_RequestTooLarge(t *testing.T) {
+	rh := newRESTTestHandler(t)
+	rh.limits, _ = NewLimits(0, 16)
+	bodies := map[string]string{
+		"message": `{"Username":"` + strings.Repeat("a", 16) + `"}`,
+		"body":    `{"Username":"` + strings.Repeat("a", 40) + `"}`,
+	}
+	for name, body := range bodies {
+		w := httptest.NewRecorder()
+		rh.ServeHTTP(w, httptest.NewRequest(http.MethodPost,
+			"/remoteSync.Registration/Register", strings.NewReader(body)))
+
+		if w.Code != http.StatusTooManyRequests {
+			t.Errorf("Unexpected status for large %s."+
+				"\nexpected: %d\nreceived: %d %s",
+				name, http.StatusTooManyRequests, w.Code, w.Body)
+		} else if !strings.Contains(w.Body.String(),
+			RequestTooLargeErr.Error()) {
+			t.Errorf("Unexpected response for large %s: %s", name, w.Body)
+		}
+	}
+}
+
+// Tests that grpcFrame and readGRPCFrame round trip a message and that
+// readGRPCFrame rejects truncated and compressed frames.
+func Test_grpcFrame(t *testing.T) {
+	in := &rpc.RsGetVersionResponse{Version: "1.2.3"}
+	frame, err := grpcFrame(nil, in)
+	if err != nil {
+		t.Fatalf("Failed to frame message: %+v", err)
+	}
+	var out rpc.RsGetVersionResponse
+	if err = readGRPCFrame(frame, &out); err != nil {
+		t.Fatalf("Failed to read frame: %+v", err)
+	}
+	if out.GetVersion() != in.GetVersion() {
+		t.Errorf("Unexpected version.\nexpected: %s\nreceived: %s",
+			in.GetVersion(), out.GetVersion())
+	}
+
+	// The frame is appended to the buffer
+	appended, err := grpcFrame([]byte("prefix"), in)
+	if err != nil {
+		t.Fatalf("Failed to frame message: %+v", err)
+	}
+	expected := append([]byte("prefix"), frame...)
+	if !bytes.Equal(expected, appended) {
+		t.Errorf("Unexpected frame.\nexpected: %v\nreceived: %v",
+			expected, appended)
+	}
+
+	if err = readGRPCFrame(frame[:len(frame)-1], &out); err == nil {
+		t.Errorf("Failed to get error for truncated frame.")
+	}
+	frame[0] = 1
+	if err = readGRPCFrame(frame, &emptypb.Empty{}); err == nil {
+		t.Errorf("Failed to get error for compressed frame.")
+	}
+}
+
+// Tests that readAll reads all the data into the buffer whether the expected
+// size is unknown, too small, too large, or larger than is trusted.
+func Test_readAll(t *testing.T) {
+	data := bytes.Repeat([]byte("data"), 1000)
+	for _, size := range []int64{-1, 0, 10, int64(len(data)), 1 << 40} {
+		buf := new([]byte)
+		read, err := readAll(bytes.NewReader(data), buf, size)
+		if err != nil {
+			t.Errorf("Failed to read with size %d: %+v", size, err)
+		} else if !bytes.Equal(data, read) || !bytes.Equal(data, *buf) {
+			t.Errorf("Unexpected data read with size %d.", size)
+		} else if cap(*buf) > 2*maxPooledRESTBuffer {
+			t.Errorf("Buffer grown to %d for size %d.", cap(*buf), size)
+		}
+	}
+}
@@ -0,0 +1,212 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package server
+
+import (
+	"archive/tar"
+	"encoding/csv"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"gitlab.com/elixxir/remoteSyncServer/credentials"
+	"gitlab.com/elixxir/remoteSyncServer/rpc"
+	"gitlab.com/elixxir/remoteSyncServer/store"
+)
+
+// Conflict modes of a restore, which set how files and accounts that already
+// exist are handled.
+const (
+	// RestoreOverwrite replaces existing files and accounts with the ones in
+	// the backup.
+	RestoreOverwrite = "overwrite"
+
+	// RestoreSkip keeps existing files and accounts.
+	RestoreSkip = "skip"
+
+	// RestoreKeepNewer replaces existing files only if the file in the backup
+	// was modified after them, and keeps existing accounts, since accounts
+	// have no modification time.
+	RestoreKeepNewer = "keep-newer"
+)
+
+var (
+	// InvalidRestoreErr is returned, with the INVALID_ARGUMENT code, for an
+	// unknown conflict mode or an archive that is not a backup.
+	InvalidRestoreErr = errors.New("invalid restore")
+)
+
+// restoreBackup applies the tar archive of a backup read from r to the
+// credential store and storage of the handler. Only the users in users are
+// restored, or all users if it is empty. Each file is written while no other
+// write of its user is applied.
+//
+// Returns [InvalidRestoreErr] if the conflict mode is unknown or the archive
+// contains files that are not part of a backup, [store.NonLocalFileErr] for
+// invalid usernames or paths, and [ObjectTooLargeErr] if a file exceeds the
+// maximum object size. The files and accounts restored before the error are
+// kept.
+func restoreBackup(h *handler, r io.Reader, users []string,
+	conflict string) (*rpc.RsRestoreResponse, error) {
+	switch conflict {
+	case "":
+		conflict = RestoreOverwrite
+	case RestoreOverwrite, RestoreSkip, RestoreKeepNewer:
+	default:
+		return nil, errors.Wrapf(
+			InvalidRestoreErr, "unknown conflict mode %q", conflict)
+	}
+	var wanted map[string]bool
+	if len(users) > 0 {
+		wanted = make(map[string]bool, len(users))
+		for _, username := range users {
+			wanted[username] = true
+		}
+	}
+
+	resp := &rpc.RsRestoreResponse{}
+	tr := tar.NewReader(r)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return resp, nil
+		} else if err != nil {
+			return nil, errors.Wrap(err, "failed to read archive")
+		} else if header.Typeflag == tar.TypeDir {
+			continue
+		}
+
+		switch name := header.Name; {
+		case name == BackupManifestPath:
+		case name == BackupCredentialsPath:
+			err = restoreCredentials(h, tr, wanted, conflict, resp)
+		case strings.HasPrefix(name, BackupStorageDir+"/"):
+			username, file, _ := strings.Cut(
+				strings.TrimPrefix(name, BackupStorageDir+"/"), "/")
+			if wanted != nil && !wanted[username] {
+				continue
+			}
+			err = restoreFile(h, tr, username, file, header.Size,
+				header.ModTime, conflict, resp)
+		default:
+			err = errors.Wrapf(InvalidRestoreErr, "unexpected file %s", name)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// restoreCredentials sets the passwords of the wanted users in the credential
+// store to the ones in the CSV credential store read from r. Users that are
+// already registered are kept unless the conflict mode is RestoreOverwrite.
+func restoreCredentials(h *handler, r io.Reader, wanted map[string]bool,
+	conflict string, resp *rpc.RsRestoreResponse) error {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = 2
+	records, err := cr.ReadAll()
+	if err != nil {
+		return errors.Wrapf(
+			InvalidRestoreErr, "invalid %s: %v", BackupCredentialsPath, err)
+	}
+
+	for _, record := range records {
+		username, password := record[0], record[1]
+		if wanted != nil && !wanted[username] {
+			continue
+		} else if err = store.CheckUsername(username); err != nil {
+			return err
+		}
+
+		if conflict != RestoreOverwrite {
+			_, err = h.users.Get(username)
+			if err == nil {
+				resp.Skipped++
+				continue
+			} else if !errors.Is(err, credentials.UserNotFoundErr) {
+				return errors.Wrapf(
+					err, "failed to get credentials of %q", username)
+			}
+		}
+		if err = h.users.Set(username, password); err != nil {
+			return errors.Wrapf(
+				err, "failed to set credentials of %q", username)
+		}
+		resp.Users++
+	}
+	return nil
+}
+
+// restoreFile writes the file of the user with the data read from r, while no
+// other write of the user is applied. An existing file is kept if the conflict
+// mode is RestoreSkip, or if it is RestoreKeepNewer and the existing file was
+// not modified before the backed up file.
+func restoreFile(h *handler, r io.Reader, username, file string, size int64,
+	modified time.Time, conflict string, resp *rpc.RsRestoreResponse) error {
+	if err := store.CheckUsername(username); err != nil {
+		return err
+	} else if file == "" {
+		return errors.Wrapf(InvalidRestoreErr, "no file for user %q", username)
+	} else if err = h.checkObject(size); err != nil {
+		return errors.WithMessagef(err, "user %q file %s", username, file)
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return errors.Wrapf(err, "failed to read %s of %q", file, username)
+	}
+	s, err := h.newStore(h.storageDir, username)
+	if err != nil {
+		return err
+	}
+
+	l := h.locks.get(username)
+	l.Lock()
+	defer l.Unlock()
+	if conflict != RestoreOverwrite {
+		existing, err := s.GetLastModified(file)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return errors.Wrapf(err,
+				"failed to get modification time of %s of %q", file, username)
+		} else if err == nil &&
+			(conflict == RestoreSkip || !modified.After(existing)) {
+			resp.Skipped++
+			return nil
+		}
+	}
+	if err = s.Write(file, data); err != nil {
+		return errors.Wrapf(err, "failed to write %s of %q", file, username)
+	}
+	resp.Files++
+	resp.Bytes += int64(len(data))
+	return nil
+}
+
+// restoreReceiver is an io.Reader of the archive in the requests of the
+// Restore RPC.
+type restoreReceiver struct {
+	stream rpc.Admin_RestoreServer
+	buf    []byte
+}
+
+// Read returns the data of the buffered request and then of the next
+// requests, and io.EOF once the client has sent all requests.
+func (rr *restoreReceiver) Read(p []byte) (int, error) {
+	for len(rr.buf) == 0 {
+		req, err := rr.stream.Recv()
+		if err != nil {
+			return 0, err
+		}
+		rr.buf = req.GetData()
+	}
+	n := copy(p, rr.buf)
+	rr.buf = rr.buf[n:]
+	return n, nil
+}
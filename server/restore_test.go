@@ -0,0 +1,226 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package server
+
+import (
+	"archive/tar"
+	"bytes"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"gitlab.com/elixxir/remoteSyncServer/credentials"
+	"gitlab.com/elixxir/remoteSyncServer/store"
+)
+
+// Tests that restoreBackup restores the credentials and files of all users in
+// a backup to an empty server.
+func Test_restoreBackup(t *testing.T) {
+	backup := writeTestBackup(newTestBackupHandler(t), t)
+	h := newHandler("", time.Hour, credentials.NewMemStore(nil), nil,
+		newTestGCStore(false, t))
+
+	resp, err := restoreBackup(h, bytes.NewReader(backup), nil, "")
+	if err != nil {
+		t.Fatalf("Failed to restore: %+v", err)
+	}
+	if resp.GetUsers() != 2 || resp.GetFiles() != 3 ||
+		resp.GetBytes() != 7 || resp.GetSkipped() != 0 {
+		t.Errorf("Unexpected response: %v", resp)
+	}
+
+	expected := map[string]string{"carmen": "hash2", "waldo": "hash1"}
+	for username, password := range expected {
+		if received, err := h.users.Get(username); err != nil ||
+			received != password {
+			t.Errorf("Unexpected password of %q: %q (%v)",
+				username, received, err)
+		}
+	}
+	for username, files := range map[string][]string{
+		"carmen": {"c"}, "waldo": {"a", "dir/b"}} {
+		for _, file := range files {
+			if data := readTestRestoredFile(h, username, file, t); data !=
+				file {
+				t.Errorf("Unexpected data of %s of %q: %q",
+					file, username, data)
+			}
+		}
+	}
+}
+
+// Tests that restoreBackup only restores the selected users.
+func Test_restoreBackup_Users(t *testing.T) {
+	backup := writeTestBackup(newTestBackupHandler(t), t)
+	h := newHandler("", time.Hour, credentials.NewMemStore(nil), nil,
+		newTestGCStore(false, t))
+
+	resp, err := restoreBackup(
+		h, bytes.NewReader(backup), []string{"carmen"}, RestoreOverwrite)
+	if err != nil {
+		t.Fatalf("Failed to restore: %+v", err)
+	}
+	if resp.GetUsers() != 1 || resp.GetFiles() != 1 {
+		t.Errorf("Unexpected response: %v", resp)
+	}
+	if users, _ := h.users.List(); !reflect.DeepEqual(
+		[]string{"carmen"}, users) {
+		t.Errorf("Unexpected restored users: %v", users)
+	}
+	s := writeTestFiles(h.newStore, "waldo", t)
+	if files := listTestFiles(s, t); len(files) != 0 {
+		t.Errorf("Unexpected restored files of waldo: %v", files)
+	}
+}
+
+// Tests that restoreBackup handles existing files and accounts according to
+// each conflict mode.
+func Test_restoreBackup_Conflict(t *testing.T) {
+	tests := map[string]struct {
+		password, newer, older string
+		skipped                int64
+	}{
+		RestoreOverwrite: {"hash1", "a", "dir/b", 0},
+		RestoreSkip:      {"changed", "changed", "changed", 3},
+		RestoreKeepNewer: {"changed", "changed", "dir/b", 2},
+	}
+	for conflict, tt := range tests {
+		h := newTestBackupHandler(t)
+		s := writeTestFiles(h.newStore, "waldo", t)
+		if err := s.Write("dir/b", []byte("changed")); err != nil {
+			t.Fatalf("Failed to write: %+v", err)
+		}
+		backup := writeTestBackup(h, t)
+
+		// Modify a after the backup and make the backed up dir/b newer than
+		// the existing one
+		time.Sleep(time.Millisecond)
+		if err := s.Write("a", []byte("changed")); err != nil {
+			t.Fatalf("Failed to write: %+v", err)
+		}
+		if err := h.users.Set("waldo", "changed"); err != nil {
+			t.Fatalf("Failed to set password: %+v", err)
+		}
+		backup = replaceTestBackupFile(
+			backup, "storage/waldo/dir/b", "dir/b", time.Now().Add(time.Hour),
+			t)
+
+		resp, err := restoreBackup(
+			h, bytes.NewReader(backup), []string{"waldo"}, conflict)
+		if err != nil {
+			t.Fatalf("Failed to restore (%s): %+v", conflict, err)
+		}
+		if resp.GetSkipped() != tt.skipped {
+			t.Errorf("Unexpected response (%s): %v", conflict, resp)
+		}
+		if password, _ := h.users.Get("waldo"); password != tt.password {
+			t.Errorf("Unexpected password (%s): %q", conflict, password)
+		}
+		if data := readTestRestoredFile(h, "waldo", "a", t); data !=
+			tt.newer {
+			t.Errorf("Unexpected newer file (%s): %q", conflict, data)
+		}
+		if data := readTestRestoredFile(h, "waldo", "dir/b", t); data !=
+			tt.older {
+			t.Errorf("Unexpected older file (%s): %q", conflict, data)
+		}
+	}
+}
+
+// Error path: Tests that restoreBackup fails for an unknown conflict mode and
+// for archives that are not backups or contain invalid usernames.
+func Test_restoreBackup_Error(t *testing.T) {
+	tests := map[string]struct {
+		files    map[string]string
+		conflict string
+		err      error
+	}{
+		"conflict": {nil, "newest", InvalidRestoreErr},
+		"unexpected file": {
+			map[string]string{"other.txt": "a"}, "", InvalidRestoreErr},
+		"credentials": {map[string]string{
+			BackupCredentialsPath: "waldo\n"}, "", InvalidRestoreErr},
+		"no file": {
+			map[string]string{"storage/waldo": "a"}, "", InvalidRestoreErr},
+		"username": {
+			map[string]string{"storage/../a": "a"}, "", store.NonLocalFileErr},
+	}
+	for name, tt := range tests {
+		h := newHandler("", time.Hour, credentials.NewMemStore(nil), nil,
+			newTestGCStore(false, t))
+		var buf bytes.Buffer
+		tw := tar.NewWriter(&buf)
+		for file, data := range tt.files {
+			err := writeBackupFile(tw, file, []byte(data), time.Now())
+			if err != nil {
+				t.Fatalf("Failed to write %s: %+v", file, err)
+			}
+		}
+		if err := tw.Close(); err != nil {
+			t.Fatalf("Failed to close archive: %+v", err)
+		}
+
+		_, err := restoreBackup(h, &buf, nil, tt.conflict)
+		if !errors.Is(err, tt.err) {
+			t.Errorf("Unexpected error for %s: %+v", name, err)
+		}
+	}
+}
+
+// writeTestBackup returns a full backup of the handler.
+func writeTestBackup(h *handler, t *testing.T) []byte {
+	var buf bytes.Buffer
+	if _, err := writeBackup(h, &buf, time.Time{}); err != nil {
+		t.Fatalf("Failed to back up: %+v", err)
+	}
+	return buf.Bytes()
+}
+
+// replaceTestBackupFile returns the backup with the data and modification time
+// of the file replaced.
+func replaceTestBackupFile(backup []byte, name, data string,
+	modified time.Time, t *testing.T) []byte {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	tr := tar.NewReader(bytes.NewReader(backup))
+	for header, err := tr.Next(); err == nil; header, err = tr.Next() {
+		fileData := new(bytes.Buffer)
+		if _, err = fileData.ReadFrom(tr); err != nil {
+			t.Fatalf("Failed to read %s: %+v", header.Name, err)
+		}
+		fileModified := header.ModTime
+		if header.Name == name {
+			fileData = bytes.NewBufferString(data)
+			fileModified = modified
+		}
+		err = writeBackupFile(tw, header.Name, fileData.Bytes(), fileModified)
+		if err != nil {
+			t.Fatalf("Failed to write %s: %+v", header.Name, err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatalf("Failed to close archive: %+v", err)
+	}
+	return buf.Bytes()
+}
+
+// readTestRestoredFile returns the data of the file of the user.
+func readTestRestoredFile(
+	h *handler, username, file string, t *testing.T) string {
+	s, err := h.newStore(h.storageDir, username)
+	if err != nil {
+		t.Fatalf("Failed to create store of %q: %+v", username, err)
+	}
+	data, err := s.Read(file)
+	if err != nil {
+		t.Fatalf("Failed to read %s of %q: %+v", file, username, err)
+	}
+	return string(data)
+}
@@ -0,0 +1,181 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package server
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"gitlab.com/xx_network/primitives/utils"
+)
+
+// revocationFilePerm is the permissions used when writing the revocation list
+// file.
+const revocationFilePerm = os.FileMode(0600)
+
+// RevocationList contains revoked tokens and users whose tokens were revoked.
+// It is checked on every authenticated request. If it has a path, every change
+// is saved to the file so that revocations survive restarts.
+type RevocationList struct {
+	path string
+
+	// tokens maps the hex-encoded SHA-256 hash of each revoked token to the
+	// time it expires, after which the entry is no longer needed.
+	tokens map[string]time.Time
+
+	// users maps each username to the time their tokens were revoked. All
+	// tokens issued to the user at or before that time are revoked.
+	users map[string]time.Time
+
+	mux sync.RWMutex
+}
+
+// revocationListDisk is the JSON structure of the revocation list file.
+type revocationListDisk struct {
+	Tokens map[string]time.Time `json:"tokens"`
+	Users  map[string]time.Time `json:"users"`
+}
+
+// NewRevocationList loads the revocation list from the file at the path. If
+// the file does not exist, an empty list is created and the file is written on
+// the first change. If the path is empty, the list is only kept in memory.
+func NewRevocationList(path string) (*RevocationList, error) {
+	rl := &RevocationList{
+		tokens: make(map[string]time.Time),
+		users:  make(map[string]time.Time),
+	}
+	if path == "" {
+		return rl, nil
+	}
+
+	path, err := utils.ExpandPath(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to expand path %s", path)
+	}
+	rl.path = path
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return rl, nil
+	} else if err != nil {
+		return nil, errors.Wrapf(err, "unable to read file %s", path)
+	}
+
+	var disk revocationListDisk
+	if err = json.Unmarshal(data, &disk); err != nil {
+		return nil, errors.Wrapf(
+			err, "unable to parse revocation list %s", path)
+	}
+	if disk.Tokens != nil {
+		rl.tokens = disk.Tokens
+	}
+	if disk.Users != nil {
+		rl.users = disk.Users
+	}
+
+	return rl, nil
+}
+
+// RevokeToken revokes the token until it expires.
+func (rl *RevocationList) RevokeToken(token Token, expires time.Time) error {
+	rl.mux.Lock()
+	defer rl.mux.Unlock()
+	rl.tokens[hashToken(token)] = expires
+	return rl.save()
+}
+
+// RevokeUser revokes all tokens issued to the user at or before the given
+// time.
+func (rl *RevocationList) RevokeUser(username string, before time.Time) error {
+	rl.mux.Lock()
+	defer rl.mux.Unlock()
+	rl.users[username] = before
+	return rl.save()
+}
+
+// IsRevoked returns true if the token, which was issued to the user at the
+// given time, has been revoked.
+func (rl *RevocationList) IsRevoked(
+	token Token, username string, issued time.Time) bool {
+	rl.mux.RLock()
+	defer rl.mux.RUnlock()
+
+	if _, exists := rl.tokens[hashToken(token)]; exists {
+		return true
+	}
+	before, exists := rl.users[username]
+	return exists && !issued.After(before)
+}
+
+// Prune removes entries that are no longer needed because every token they
+// revoke has expired. Tokens are valid for at most tokenTTL.
+func (rl *RevocationList) Prune(now time.Time, tokenTTL time.Duration) error {
+	rl.mux.Lock()
+	defer rl.mux.Unlock()
+
+	var changed bool
+	for key, expires := range rl.tokens {
+		if now.After(expires) {
+			delete(rl.tokens, key)
+			changed = true
+		}
+	}
+	for username, before := range rl.users {
+		if now.After(before.Add(tokenTTL)) {
+			delete(rl.users, username)
+			changed = true
+		}
+	}
+
+	if !changed {
+		return nil
+	}
+	return rl.save()
+}
+
+// save writes the revocation list to the file, if it has one. The file is
+// written to a temporary file first and then renamed so that the file is
+// never left partially written. Must be called while the lock is held.
+func (rl *RevocationList) save() error {
+	if rl.path == "" {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(
+		revocationListDisk{rl.tokens, rl.users}, "", "\t")
+	if err != nil {
+		return errors.Wrap(err, "failed to encode revocation list")
+	}
+
+	if err = os.MkdirAll(filepath.Dir(rl.path), 0700); err != nil {
+		return errors.Wrapf(err, "failed to make directory for %s", rl.path)
+	}
+	tmpPath := rl.path + ".tmp"
+	if err = os.WriteFile(tmpPath, data, revocationFilePerm); err != nil {
+		return errors.Wrapf(err, "failed to write %s", tmpPath)
+	}
+	if err = os.Rename(tmpPath, rl.path); err != nil {
+		return errors.Wrapf(err, "failed to replace %s", rl.path)
+	}
+
+	return nil
+}
+
+// hashToken returns the key used to save the revoked token so that the file
+// does not contain token values.
+func hashToken(token Token) string {
+	h := sha256.Sum256(token.Marshal())
+	return hex.EncodeToString(h[:])
+}
@@ -0,0 +1,125 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package server
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// Tests that revocations saved by a RevocationList are loaded by a new
+// RevocationList with the same path.
+func TestNewRevocationList_Load(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "revoked.json")
+	rl, err := NewRevocationList(path)
+	if err != nil {
+		t.Fatalf("Failed to create RevocationList: %+v", err)
+	}
+
+	now := time.Now()
+	token := Token{1, 2, 3}
+	if err = rl.RevokeToken(token, now.Add(time.Hour)); err != nil {
+		t.Fatalf("Failed to revoke token: %+v", err)
+	}
+	if err = rl.RevokeUser("waldo", now); err != nil {
+		t.Fatalf("Failed to revoke user: %+v", err)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("Failed to stat revocation list file: %+v", err)
+	}
+	if info.Mode().Perm() != revocationFilePerm {
+		t.Errorf("Unexpected file permissions.\nexpected: %s\nreceived: %s",
+			revocationFilePerm, info.Mode().Perm())
+	}
+
+	loaded, err := NewRevocationList(path)
+	if err != nil {
+		t.Fatalf("Failed to load RevocationList: %+v", err)
+	}
+	if !loaded.IsRevoked(token, "carmen", now) {
+		t.Errorf("Revoked token not loaded.")
+	}
+	if !loaded.IsRevoked(Token{4, 5, 6}, "waldo", now.Add(-time.Minute)) {
+		t.Errorf("Revoked user not loaded.")
+	}
+}
+
+// Error path: Tests that NewRevocationList returns an error for a corrupt
+// file.
+func TestNewRevocationList_ParseError(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "revoked.json")
+	if err := os.WriteFile(path, []byte("{"), revocationFilePerm); err != nil {
+		t.Fatalf("Failed to write file: %+v", err)
+	}
+
+	if _, err := NewRevocationList(path); err == nil {
+		t.Errorf("Failed to get error for corrupt file.")
+	}
+}
+
+// Tests that RevocationList.IsRevoked only reports tokens issued to a revoked
+// user before they were revoked.
+func TestRevocationList_IsRevoked(t *testing.T) {
+	rl, _ := NewRevocationList("")
+	revokedAt := time.Now()
+	if err := rl.RevokeUser("waldo", revokedAt); err != nil {
+		t.Fatalf("Failed to revoke user: %+v", err)
+	}
+
+	tests := []struct {
+		username string
+		issued   time.Time
+		expected bool
+	}{
+		{"waldo", revokedAt.Add(-time.Minute), true},
+		{"waldo", revokedAt, true},
+		{"waldo", revokedAt.Add(time.Minute), false},
+		{"carmen", revokedAt.Add(-time.Minute), false},
+	}
+
+	for i, tt := range tests {
+		revoked := rl.IsRevoked(Token{1}, tt.username, tt.issued)
+		if revoked != tt.expected {
+			t.Errorf("Unexpected result for %q (%d)."+
+				"\nexpected: %t\nreceived: %t",
+				tt.username, i, tt.expected, revoked)
+		}
+	}
+}
+
+// Tests that RevocationList.Prune only removes entries for tokens that have
+// expired.
+func TestRevocationList_Prune(t *testing.T) {
+	rl, _ := NewRevocationList("")
+	now := time.Now()
+	_ = rl.RevokeToken(Token{1}, now.Add(-time.Second))
+	_ = rl.RevokeToken(Token{2}, now.Add(time.Hour))
+	_ = rl.RevokeUser("waldo", now.Add(-2*time.Hour))
+	_ = rl.RevokeUser("carmen", now)
+
+	if err := rl.Prune(now, time.Hour); err != nil {
+		t.Fatalf("Failed to prune: %+v", err)
+	}
+
+	if rl.IsRevoked(Token{1}, "", now) {
+		t.Errorf("Expired token not pruned.")
+	}
+	if !rl.IsRevoked(Token{2}, "", now) {
+		t.Errorf("Unexpired token pruned.")
+	}
+	if _, exists := rl.users["waldo"]; exists {
+		t.Errorf("User with only expired tokens not pruned.")
+	}
+	if _, exists := rl.users["carmen"]; !exists {
+		t.Errorf("User with unexpired tokens pruned.")
+	}
+}
@@ -0,0 +1,336 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package server
+
+import (
+	"os"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	jww "github.com/spf13/jwalterweatherman"
+
+	"gitlab.com/elixxir/remoteSyncServer/store"
+	"gitlab.com/xx_network/primitives/netTime"
+)
+
+// defaultScrubInterval is the default value of ScrubParams.Interval.
+const defaultScrubInterval = 24 * time.Hour
+
+var (
+	// NoReplicasErr is returned when a corrupted file cannot be repaired
+	// because the server has no replicas to fetch a healthy copy from.
+	NoReplicasErr = errors.New("no replicas to repair from")
+
+	// errScrubStopped is returned by scrubUser when the server stops.
+	errScrubStopped = errors.New("scrub stopped")
+)
+
+// ScrubParams are the parameters of the scrubbing of stored files.
+type ScrubParams struct {
+	// Interval is how often all stored files are verified while the server
+	// is running. Defaults to 24h.
+	Interval time.Duration `mapstructure:"interval"`
+
+	// BytesPerSecond limits the rate that stored data is read while
+	// scrubbing, so that it does not slow down clients. There is no limit if
+	// it is zero.
+	BytesPerSecond int64 `mapstructure:"bytesPerSecond"`
+}
+
+// ScrubStats are the totals of all scrubs since the server started.
+type ScrubStats struct {
+	// Runs is the number of scrubs that finished.
+	Runs int
+
+	// Files and Bytes are the number and stored size of the files verified.
+	Files int
+	Bytes int64
+
+	// Corrupted is the number of files whose data did not match their
+	// checksum, and Repaired is the number of them replaced by a healthy copy
+	// from a replica.
+	Corrupted int
+	Repaired  int
+
+	// Unchecked is the number of files without a checksum found by the last
+	// scrub, which were written before checksums were enabled.
+	Unchecked int
+
+	// LastRun is when the last scrub finished.
+	LastRun time.Time
+}
+
+// ScrubReport is the result of a scrub.
+type ScrubReport struct {
+	// Users is the number of users whose files were verified.
+	Users int
+
+	// Files and Bytes are the number and stored size of the files verified.
+	Files int
+	Bytes int64
+
+	// Unchecked is the number of files without a checksum.
+	Unchecked int
+
+	// Corrupted are the files whose data did not match their checksum.
+	Corrupted []ScrubFile
+
+	// Failed are the users whose files could not be listed or verified.
+	Failed []string
+}
+
+// ScrubFile is a corrupted file found by a scrub.
+type ScrubFile struct {
+	User string
+	Path string
+
+	// Repaired is true if the file was replaced by a healthy copy.
+	Repaired bool
+}
+
+// Scrubber stores a checksum with every file and verifies all stored files in
+// the background at its interval, so that data corrupted in storage is found
+// before it is needed. Corrupted files are logged and counted in the metrics
+// and, with replication, replaced by a healthy copy from another server.
+type Scrubber struct {
+	params ScrubParams
+
+	// newStore creates the stores that verify the checksums, directly over
+	// the storage backend. Set by Checksum.
+	newStore store.NewStore
+
+	stats ScrubStats
+	mux   sync.Mutex
+}
+
+// NewScrubber creates a new Scrubber from the parameters.
+func NewScrubber(params map[string]interface{}) (*Scrubber, error) {
+	p := ScrubParams{Interval: defaultScrubInterval}
+	if err := decodeParams(params, &p, "scrub"); err != nil {
+		return nil, err
+	}
+
+	if p.Interval <= 0 {
+		return nil, errors.Errorf(
+			"scrub interval %s must be positive", p.Interval)
+	} else if p.BytesPerSecond < 0 {
+		return nil, errors.Errorf(
+			"scrub bytesPerSecond %d cannot be negative", p.BytesPerSecond)
+	}
+	return &Scrubber{params: p}, nil
+}
+
+// Params returns the parameters of the scrubber.
+func (sc *Scrubber) Params() ScrubParams {
+	return sc.params
+}
+
+// Stats returns the totals of all scrubs since the server started.
+func (sc *Scrubber) Stats() ScrubStats {
+	sc.mux.Lock()
+	defer sc.mux.Unlock()
+	return sc.stats
+}
+
+// Checksum wraps the stores created by newStore, which must be those of the
+// storage backend, so that a checksum is stored with every file, and returns
+// the NewStore that the other layers of storage must be built on.
+func (sc *Scrubber) Checksum(newStore store.NewStore) store.NewStore {
+	sc.newStore = store.NewChecksumStore(newStore)
+	return sc.newStore
+}
+
+// run verifies the files of all users every interval until stop is closed.
+// With replication, corrupted files are repaired from the other servers.
+func (sc *Scrubber) run(h *handler, stop <-chan struct{}) {
+	ticker := time.NewTicker(sc.params.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			usernames, err := h.allUsers().List()
+			if err != nil {
+				jww.ERROR.Printf("Failed to list users to scrub: %+v", err)
+				continue
+			}
+			var fetch func(user, path string) ([]byte, error)
+			if h.replica != nil {
+				fetch = h.replica.fetch
+			}
+			start := netTime.Now()
+			report := sc.scrub(h, usernames, fetch, stop)
+			var repaired int
+			for _, f := range report.Corrupted {
+				if f.Repaired {
+					repaired++
+				}
+			}
+			jww.INFO.Printf("Scrubbed %d files (%d bytes) of %d users in %s: "+
+				"%d corrupted, %d repaired, %d without checksums; %d users "+
+				"failed.", report.Files, report.Bytes,
+				report.Users, netTime.Now().Sub(start).Round(time.Second),
+				len(report.Corrupted), repaired, report.Unchecked,
+				len(report.Failed))
+		}
+	}
+}
+
+// scrub verifies the checksums of the files of each of the users and adds the
+// totals to the stats, unless stop is closed before it finishes. Corrupted
+// files are counted in the stats as they are found and replaced by the data
+// returned by fetch, unless it is nil or fails. Users whose files cannot be
+// listed or verified are logged and skipped.
+func (sc *Scrubber) scrub(h *handler, usernames []string,
+	fetch func(user, path string) ([]byte, error),
+	stop <-chan struct{}) ScrubReport {
+	report := ScrubReport{Users: len(usernames)}
+	for _, username := range usernames {
+		err := sc.scrubUser(h, username, fetch, &report, stop)
+		if errors.Is(err, errScrubStopped) {
+			return report
+		} else if err != nil {
+			jww.WARN.Printf("Failed to scrub files of %q: %+v", username, err)
+			report.Failed = append(report.Failed, username)
+		}
+	}
+
+	sc.mux.Lock()
+	defer sc.mux.Unlock()
+	sc.stats.Runs++
+	sc.stats.Files += report.Files
+	sc.stats.Bytes += report.Bytes
+	sc.stats.Unchecked = report.Unchecked
+	sc.stats.LastRun = netTime.Now()
+	return report
+}
+
+// scrubUser verifies the checksums of the files of the user and adds them to
+// the report. A file that does not match its checksum is verified again while
+// no write of the user is applied, since it may have been written while it was
+// read, and is repaired if it is still corrupted.
+func (sc *Scrubber) scrubUser(h *handler, username string,
+	fetch func(user, path string) ([]byte, error), report *ScrubReport,
+	stop <-chan struct{}) error {
+	s, err := sc.newStore(h.storageDir, username)
+	if err != nil {
+		return err
+	}
+	cs, ok := s.(*store.ChecksumStore)
+	if !ok {
+		return errors.New("store does not verify checksums")
+	}
+	files, err := cs.ListFiles()
+	if err != nil {
+		return err
+	}
+
+	for _, file := range files {
+		size, checked, err := cs.Verify(file)
+		if errors.Is(err, store.CorruptedErr) {
+			size, checked, err = sc.verifyLocked(
+				h, cs, username, file, fetch, report)
+		}
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		} else if err != nil {
+			return errors.Wrapf(err, "failed to verify %s", file)
+		}
+		report.Files++
+		report.Bytes += size
+		if !checked {
+			report.Unchecked++
+		}
+		if !sc.throttle(size, stop) {
+			return errScrubStopped
+		}
+	}
+	return nil
+}
+
+// verifyLocked verifies the file again while holding the write lock of the
+// user and, if it is still corrupted, adds it to the report and replaces it
+// with the data returned by fetch. A corrupted file is not counted as an error
+// or in the verified bytes.
+func (sc *Scrubber) verifyLocked(h *handler, cs *store.ChecksumStore,
+	username, file string, fetch func(user, path string) ([]byte, error),
+	report *ScrubReport) (int64, bool, error) {
+	l := h.locks.get(username)
+	l.Lock()
+	defer l.Unlock()
+	size, checked, err := cs.Verify(file)
+	if !errors.Is(err, store.CorruptedErr) {
+		return size, checked, err
+	}
+	jww.ERROR.Printf("Scrub found corrupted file %s of %q: %v",
+		file, username, err)
+
+	corrupted := ScrubFile{User: username, Path: file}
+	if fetch == nil {
+		err = NoReplicasErr
+	} else {
+		var data []byte
+		if data, err = fetch(username, file); err == nil {
+			err = cs.Write(file, data)
+		}
+	}
+	if err != nil {
+		jww.ERROR.Printf("Failed to repair corrupted file %s of %q: %+v",
+			file, username, err)
+	} else {
+		corrupted.Repaired = true
+		jww.WARN.Printf("Repaired corrupted file %s of %q from a replica.",
+			file, username)
+	}
+	report.Corrupted = append(report.Corrupted, corrupted)
+	sc.mux.Lock()
+	sc.stats.Corrupted++
+	if corrupted.Repaired {
+		sc.stats.Repaired++
+	}
+	sc.mux.Unlock()
+	return 0, true, nil
+}
+
+// read returns the data of the file of the user, verified against its
+// checksum, for another server to repair its copy with.
+//
+// Returns [store.CorruptedErr] if the data does not match its checksum.
+func (sc *Scrubber) read(storageDir, username, path string) ([]byte, error) {
+	if err := store.CheckUsername(username); err != nil {
+		return nil, err
+	}
+	s, err := sc.newStore(storageDir, username)
+	if err != nil {
+		return nil, err
+	}
+	return s.Read(path)
+}
+
+// throttle waits long enough after reading size bytes to keep to the maximum
+// rate. Returns false if stop was closed while waiting.
+func (sc *Scrubber) throttle(size int64, stop <-chan struct{}) bool {
+	if sc.params.BytesPerSecond == 0 || size == 0 {
+		select {
+		case <-stop:
+			return false
+		default:
+			return true
+		}
+	}
+	delay := time.Duration(size) * time.Second /
+		time.Duration(sc.params.BytesPerSecond)
+	select {
+	case <-stop:
+		return false
+	case <-time.After(delay):
+		return true
+	}
+}
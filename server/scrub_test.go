@@ -0,0 +1,156 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package server
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"gitlab.com/elixxir/remoteSyncServer/credentials"
+	"gitlab.com/elixxir/remoteSyncServer/store"
+)
+
+// Tests that NewScrubber decodes the parameters and sets the default interval.
+func TestNewScrubber(t *testing.T) {
+	sc, err := NewScrubber(map[string]interface{}{"bytesPerSecond": "1024"})
+	if err != nil {
+		t.Fatalf("Failed to create scrubber: %+v", err)
+	}
+	expected := ScrubParams{Interval: defaultScrubInterval, BytesPerSecond: 1024}
+	if sc.Params() != expected {
+		t.Errorf("Unexpected parameters.\nexpected: %+v\nreceived: %+v",
+			expected, sc.Params())
+	}
+}
+
+// Error path: Tests that NewScrubber returns an error for unknown and invalid
+// parameters.
+func TestNewScrubber_Error(t *testing.T) {
+	for _, params := range []map[string]interface{}{
+		{"unknown": true},
+		{"interval": "0s"},
+		{"bytesPerSecond": -1},
+	} {
+		if _, err := NewScrubber(params); err == nil {
+			t.Errorf("Failed to get error for params %v.", params)
+		}
+	}
+}
+
+// Tests that Scrubber.scrub verifies all files, counts the files without a
+// checksum, and repairs a corrupted file with the fetched data.
+func TestScrubber_scrub(t *testing.T) {
+	sc, h, backend := newTestScrubber(nil, t)
+	var fetched []string
+	fetch := func(user, path string) ([]byte, error) {
+		fetched = append(fetched, user+"/"+path)
+		return []byte(path), nil
+	}
+
+	report := sc.scrub(h, []string{"waldo"}, fetch, nil)
+	expected := []ScrubFile{{User: "waldo", Path: "b", Repaired: true}}
+	if report.Files != 3 || report.Unchecked != 1 || len(report.Failed) != 0 ||
+		!reflect.DeepEqual(expected, report.Corrupted) {
+		t.Errorf("Unexpected report: %+v", report)
+	}
+	if !reflect.DeepEqual([]string{"waldo/b"}, fetched) {
+		t.Errorf("Unexpected files fetched: %v", fetched)
+	}
+	if data, err := backend.Read("b"); err != nil || string(data) != "b" {
+		t.Errorf("File not repaired: %q (%v)", data, err)
+	}
+
+	stats := sc.Stats()
+	if stats.Runs != 1 || stats.Files != 3 || stats.Corrupted != 1 ||
+		stats.Repaired != 1 || stats.Unchecked != 1 || stats.LastRun.IsZero() {
+		t.Errorf("Unexpected stats: %+v", stats)
+	}
+}
+
+// Tests that Scrubber.scrub reports a corrupted file that cannot be repaired
+// without replicas and leaves it corrupted.
+func TestScrubber_scrub_NoReplicas(t *testing.T) {
+	sc, h, backend := newTestScrubber(nil, t)
+
+	report := sc.scrub(h, []string{"waldo"}, nil, nil)
+	expected := []ScrubFile{{User: "waldo", Path: "b"}}
+	if !reflect.DeepEqual(expected, report.Corrupted) {
+		t.Errorf("Unexpected corrupted files: %+v", report.Corrupted)
+	}
+	if _, err := backend.Read("b"); !errors.Is(err, store.CorruptedErr) {
+		t.Errorf("Unexpected error reading corrupted file: %+v", err)
+	}
+	if stats := sc.Stats(); stats.Corrupted != 1 || stats.Repaired != 0 {
+		t.Errorf("Unexpected stats: %+v", stats)
+	}
+}
+
+// Tests that Scrubber.scrub returns without adding to the stats once stop is
+// closed, and that the rate of reads is limited.
+func TestScrubber_scrub_Stop(t *testing.T) {
+	sc, h, _ := newTestScrubber(
+		map[string]interface{}{"bytesPerSecond": 100}, t)
+	stop := make(chan struct{})
+	time.AfterFunc(50*time.Millisecond, func() { close(stop) })
+
+	start := time.Now()
+	report := sc.scrub(h, []string{"waldo"}, nil, stop)
+	if elapsed := time.Since(start); elapsed < 35*time.Millisecond {
+		t.Errorf("Scrub not limited to 100 bytes per second: %s", elapsed)
+	}
+	if report.Files != 1 {
+		t.Errorf("%d files verified before stopping.", report.Files)
+	}
+	if stats := sc.Stats(); stats.Runs != 0 || stats.Files != 0 {
+		t.Errorf("Stats of stopped scrub recorded: %+v", stats)
+	}
+}
+
+// Tests that Scrubber.read returns the verified data of a file and
+// store.CorruptedErr for a corrupted file.
+func TestScrubber_read(t *testing.T) {
+	sc, _, _ := newTestScrubber(nil, t)
+	if data, err := sc.read("", "waldo", "a"); err != nil || string(data) != "a" {
+		t.Errorf("Unexpected data: %q (%v)", data, err)
+	}
+	if _, err := sc.read("", "waldo", "b"); !errors.Is(err, store.CorruptedErr) {
+		t.Errorf("Unexpected error for corrupted file: %+v", err)
+	}
+	_, err := sc.read("", "../waldo", "a")
+	if !errors.Is(err, store.NonLocalFileErr) {
+		t.Errorf("Unexpected error for invalid user: %+v", err)
+	}
+}
+
+// newTestScrubber returns a Scrubber with the parameters over a memory backend
+// and a handler using it. The user waldo has the files a, the corrupted file
+// b, and the file c written without a checksum. Returns the checksummed store
+// of waldo.
+func newTestScrubber(params map[string]interface{},
+	t *testing.T) (*Scrubber, *handler, *store.ChecksumStore) {
+	sc, err := NewScrubber(params)
+	if err != nil {
+		t.Fatalf("Failed to create scrubber: %+v", err)
+	}
+	backend := newTestGCStore(false, t)
+	users := credentials.NewMemStore(map[string]string{"waldo": "hash"})
+	h := newHandler("", time.Hour, users, nil, sc.Checksum(backend))
+
+	s := writeTestFiles(h.newStore, "waldo", t, "a", "b")
+	raw := writeTestFiles(backend, "waldo", t, "c")
+	data, _ := raw.Read("b")
+	corrupted := append([]byte{}, data...)
+	corrupted[len(corrupted)-1] ^= 1
+	if err = raw.Write("b", corrupted); err != nil {
+		t.Fatalf("Failed to corrupt file: %+v", err)
+	}
+	return sc, h, s.(*store.ChecksumStore)
+}
@@ -8,48 +8,1087 @@
 package server
 
 import (
+	"context"
 	"crypto/tls"
+	"crypto/x509"
+	"net"
+	"net/http"
+	"sync"
 	"time"
 
+	"github.com/improbable-eng/grpc-web/go/grpcweb"
 	"github.com/pkg/errors"
+	jww "github.com/spf13/jwalterweatherman"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+	"google.golang.org/grpc"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	grpcreflect "google.golang.org/grpc/reflection"
 
-	"gitlab.com/elixxir/comms/remoteSync/server"
+	pb "gitlab.com/elixxir/comms/mixmessages"
+	"gitlab.com/elixxir/remoteSyncServer/credentials"
+	"gitlab.com/elixxir/remoteSyncServer/rpc"
 	"gitlab.com/elixxir/remoteSyncServer/store"
+	"gitlab.com/xx_network/comms/connect"
 	"gitlab.com/xx_network/primitives/id"
 )
 
+// sessionCleanupInterval is how often expired sessions are removed.
+const sessionCleanupInterval = 5 * time.Minute
+
+// rateLimiterCleanupInterval is how often unused rate limiters are removed.
+const rateLimiterCleanupInterval = time.Minute
+
+// autoBanCleanupInterval is how often the failure counts and bans that ended
+// are removed.
+const autoBanCleanupInterval = time.Minute
+
+// loginThrottleCleanupInterval is how often the failed logins of accounts that
+// are forgotten are removed.
+const loginThrottleCleanupInterval = time.Minute
+
+// uploadCleanupInterval is how often expired uploads are removed.
+const uploadCleanupInterval = time.Minute
+
 // Server contains the comms server and handler.
 type Server struct {
-	h       *handler
-	comms   *server.Comms
-	keyPair tls.Certificate
+	h     *handler
+	comms *connect.ProtoComms
+
+	// keyPairs are the configured certificates. The first is the default
+	// certificate and the only one served by comms.
+	keyPairs []tls.Certificate
+
+	// In mTLS, ACME, and insecure HTTP modes, with custom TLS settings, OCSP
+	// stapling, additional certificates, metrics, a maximum request size, gRPC
+	// settings, HTTP limits, web security, or a maximum number of
+	// connections, or with a socket from systemd or any listener other than a
+	// single one serving gRPC and gRPC-web, the server uses its own listeners
+	// instead of comms, which can neither require client certificates, change
+	// its certificate while running, configure TLS, select a certificate by
+	// SNI, serve without TLS, count or limit its connections, limit the size
+	// of messages or requests, time out slow clients, restrict origins or set
+	// security headers, tune its connections, serve on an existing socket or
+	// several addresses, nor choose the protocols served.
+	mtls         *MTLSAuthenticator
+	acme         *ACMEManager
+	tlsSettings  *TLSSettings
+	ocsp         *OCSPStapler
+	insecureHTTP bool
+	limiter      *RateLimiter
+	autoBan      *AutoBan
+	throttle     *LoginThrottle
+	limits       *Limits
+	grpc         *GRPCSettings
+	httpLimits   *HTTPLimits
+	webSecurity  *WebSecurity
+	certExpiry   *CertExpiryMonitor
+	gc           *GarbageCollector
+	cluster      *Cluster
+	replication  *Replication
+	journal      *Journal
+	scrubber     *Scrubber
+	metrics      *Metrics
+	health       *Health
+	tracing      *Tracing
+	audit        *AuditLog
+	reporter     *ErrorReporter
+	handoff      *Handoff
+	notifier     *SystemdNotifier
+	grpcServer   *grpc.Server
+
+	// adminListener serves the Admin service with adminServer if not nil.
+	adminListener *AdminListener
+	adminServer   *grpc.Server
+
+	// webdav serves WebDAV on the listeners that serve it if not nil.
+	webdav http.Handler
+
+	// links serves download links on the listeners that serve REST if not
+	// nil.
+	links http.Handler
+
+	// listeners are the configured listeners, each served on the matching
+	// entry of netListeners by the matching entry of httpServers.
+	listeners    []Listener
+	netListeners []net.Listener
+	httpServers  []*http.Server
+
+	// bound are the sockets listened on by Bind that are not served yet, by
+	// address.
+	bound map[string]net.Listener
+
+	// stop is closed on Stop to end the removal of expired sessions.
+	stop chan struct{}
 }
 
-// NewServer generates a new server with a remote sync comms server. Returns an
-// error if the key pair cannot be generated.
-func NewServer(storageDir string, tokenTTL time.Duration, userRecords [][]string,
-	id *id.ID, localServer string, certPem, keyPem []byte) (*Server, error) {
-	keyPair, err := tls.X509KeyPair(certPem, keyPem)
+// ServerOptions are the optional features of a Server. Each feature is
+// disabled if its field is nil, false, or empty.
+type ServerOptions struct {
+	// Hasher upgrades stored passwords to Argon2id hashes on PasswordLogin.
+	Hasher *credentials.Argon2Hasher
+
+	// KnownUsers records the users whose storage is opened, so that backups,
+	// cluster snapshots, and the scrubber include the users that are not in
+	// the credential store.
+	KnownUsers *KnownUsers
+
+	// OIDC lets users log in with its OpenID Connect provider.
+	OIDC *OIDCAuthenticator
+
+	// Revoked is the list that revoked tokens are saved to.
+	Revoked *RevocationList
+
+	// AdminKey enables the Admin service for clients with the key. The Admin
+	// service is also enabled with APIKeys.
+	AdminKey string
+
+	// AdminListener serves the Admin service only on its own address, with
+	// only its key, and not on the listeners.
+	AdminListener *AdminListener
+
+	// Policies let the Admin service set storage quotas of users, which writes
+	// cannot exceed, and ban users, who cannot log in.
+	Policies *UserPolicies
+
+	// APIKeys let clients log in with scoped API keys.
+	APIKeys *APIKeys
+
+	// MTLS requires clients to present a certificate that it accepts, and
+	// clients can only act as the user it names.
+	MTLS *MTLSAuthenticator
+
+	// Limiter rejects requests over its rates.
+	Limiter *RateLimiter
+
+	// Concurrency rejects connections and requests over its limits.
+	Concurrency *ConcurrencyLimiter
+
+	// IPFilter closes connections from the addresses it does not allow when
+	// they are accepted, and the Admin service can change its lists.
+	IPFilter *IPFilter
+
+	// AutoBan bans addresses with too many failed requests for a while, and
+	// the Admin service can list and lift the bans.
+	AutoBan *AutoBan
+
+	// LoginThrottle makes accounts with too many failed password logins wait
+	// between logins and may lock them for a while.
+	LoginThrottle *LoginThrottle
+
+	// Limits rejects files and requests over its sizes.
+	Limits *Limits
+
+	// GRPCSettings tune the keepalives, streams, flow control windows, and
+	// message sizes of the gRPC connections.
+	GRPCSettings *GRPCSettings
+
+	// HTTPLimits limit the size of request headers and bodies of the HTTP
+	// servers of the listeners and time out clients that send or read slowly.
+	HTTPLimits *HTTPLimits
+
+	// WebSecurity only allows cross-origin requests from browsers on its
+	// origins and sets its security headers on the responses.
+	WebSecurity *WebSecurity
+
+	// Maintenance rejects writes while it is enabled, and the Admin service
+	// can change it.
+	Maintenance *Maintenance
+
+	// ACME obtains the server certificate from its CA, in which case the
+	// certificate and key passed to NewServer are ignored.
+	ACME *ACMEManager
+
+	// TLSSettings restrict the TLS versions and cipher suites of both gRPC and
+	// HTTPS connections, unless a listener has its own.
+	TLSSettings *TLSSettings
+
+	// OCSPStapler staples OCSP responses to the certificate. It is required
+	// for must-staple certificates.
+	OCSPStapler *OCSPStapler
+
+	// InsecureHTTP serves the listeners without TLS, for use behind a reverse
+	// proxy that terminates TLS, in which case the certificate and key passed
+	// to NewServer are ignored.
+	InsecureHTTP bool
+
+	// Proxies are the trusted proxies whose forwarding headers give the client
+	// addresses used in place of the proxy address.
+	Proxies *TrustedProxies
+
+	// AdditionalCerts are served instead of the default certificate to
+	// clients that request one of their names with SNI.
+	AdditionalCerts []tls.Certificate
+
+	// CertExpiry raises alerts as the certificates approach expiry.
+	CertExpiry *CertExpiryMonitor
+
+	// GC removes stored files according to its policies at its interval.
+	GC *GarbageCollector
+
+	// Uploads let clients upload large files in resumable chunks.
+	Uploads *Uploads
+
+	// Delta lets clients update files by sending only the blocks that
+	// changed.
+	Delta *Delta
+
+	// Changes lets clients watch the writes and deletes of their files with
+	// the Changes service, also over gRPC-web over WebSockets.
+	Changes *ChangeFeed
+
+	// WebDAV serves the files of each user over WebDAV on the listeners that
+	// serve it, read-only unless it allows writing.
+	WebDAV *WebDAV
+
+	// Links lets users create signed, expiring links to download their files
+	// without credentials, which are served on the listeners that serve REST.
+	Links *Links
+
+	// Journal records writes, deletes, and transactions before they are
+	// applied, and the ones interrupted by a crash are applied again when the
+	// server starts.
+	Journal *Journal
+
+	// Scrubber verifies all stored files against their checksums at its
+	// interval and, with replication, repairs corrupted files from the other
+	// servers.
+	Scrubber *Scrubber
+
+	// Cluster replicates writes to the other nodes of the cluster by its
+	// leader, and writes to other nodes are rejected. It cannot be combined
+	// with Replication.
+	Cluster *Cluster
+
+	// Replication lets a primary replicate its writes to its standby and read
+	// replicas in the background, a standby apply them and reject writes until
+	// it is promoted, a read replica apply them and forward its writes to the
+	// primary, and regions replicate their writes to each other and keep the
+	// last write of each file.
+	Replication *Replication
+
+	// Migration lets users import their accounts from other servers and
+	// export them.
+	Migration *Migration
+
+	// Metrics records metrics of the RPCs, connections, and storage and serves
+	// them on their own address.
+	Metrics *Metrics
+
+	// Health serves liveness and readiness checks on their own address.
+	Health *Health
+
+	// Tracing exports spans of each RPC and its storage operations to its OTLP
+	// collector.
+	Tracing *Tracing
+
+	// Audit records every sync operation and login.
+	Audit *AuditLog
+
+	// AccessLog logs a line for each request.
+	AccessLog *AccessLog
+
+	// ErrorReporter is sent the RPCs that panic.
+	ErrorReporter *ErrorReporter
+
+	// Handoff serves on the sockets passed by the previous process, if any,
+	// and lets the server be upgraded with Upgrade. It cannot be combined with
+	// Journal.
+	Handoff *Handoff
+
+	// Notifier notifies systemd of the status of the server and pings its
+	// watchdog.
+	Notifier *SystemdNotifier
+
+	// Reload is called by the ReloadConfig RPC of the Admin service to reload
+	// the config.
+	Reload func() error
+
+	// SetLogLevel is called by the SetLogLevel RPC of the Admin service to
+	// change the log level.
+	SetLogLevel func(level uint)
+
+	// Reflection registers the gRPC server reflection service, so that tools
+	// such as grpcurl can call the RPCs without the proto files.
+	Reflection bool
+
+	// BuildInfo is reported by the Info service to clients without
+	// authentication, with the enabled optional features.
+	BuildInfo BuildInfo
+}
+
+// NewServer generates a new server with a remote sync comms server and the
+// optional features enabled in opts. Each user's storage is created in the
+// storage directory using newStore. New accounts are registered using the
+// registrar. The Admin service is only enabled if opts has an admin key or API
+// keys. The server serves the protocols of each of the listeners on its address
+// or socket, with its TLS settings, or those in opts if nil, and with the
+// certificate in certPem and keyPem unless opts has ACME or insecure HTTP. The
+// standard gRPC health service reports whether the readiness checks pass.
+// Tokens expire after tokenTTL, which must be at least one second. Returns an
+// error if the key pair cannot be generated or the options cannot be combined.
+func NewServer(storageDir string, newStore store.NewStore,
+	tokenTTL time.Duration, users credentials.Store, registrar *Registrar,
+	listeners []Listener, id *id.ID, certPem, keyPem []byte,
+	opts ServerOptions) (*Server, error) {
+	if tokenTTL < time.Second {
+		return nil, errors.Errorf(
+			"token TTL %s must be at least one second", tokenTTL)
+	}
+	err := CheckOptions(opts.MTLS, opts.ACME, opts.TLSSettings,
+		opts.OCSPStapler, opts.InsecureHTTP, opts.AdditionalCerts, listeners)
 	if err != nil {
-		return nil, errors.Errorf("failed to generate a public/private TLS "+
-			"key pair from the cert and key: %+v", err)
+		return nil, err
+	}
+	if len(listeners) == 0 {
+		return nil, errors.New("at least one listener is required")
+	}
+	if opts.Cluster != nil && opts.Replication != nil {
+		return nil, errors.New("clustering and replication cannot be combined")
+	} else if opts.Journal != nil && opts.Handoff != nil {
+		return nil, errors.New("the journal and listener handoff cannot be " +
+			"combined, since both processes would write to the journal")
+	}
+	if err = CheckWebDAV(opts.WebDAV, listeners); err != nil {
+		return nil, err
+	} else if err = CheckLinks(opts.Links, listeners); err != nil {
+		return nil, err
+	} else if err = CheckAdminListener(
+		opts.AdminListener, listeners); err != nil {
+		return nil, err
 	}
 
-	h, err := newHandler(storageDir, tokenTTL, userRecords, store.NewFileStore)
-	if err != nil {
-		return nil, errors.Errorf("failed to initialize new handler: %+v", err)
+	var keyPairs []tls.Certificate
+	if opts.ACME == nil && !opts.InsecureHTTP {
+		keyPair, err := parseKeyPair(certPem, keyPem)
+		if err != nil {
+			return nil, err
+		}
+		keyPairs = append([]tls.Certificate{keyPair}, opts.AdditionalCerts...)
+		for _, kp := range keyPairs {
+			if mustStaple(kp.Leaf) && opts.OCSPStapler == nil {
+				return nil, errors.Errorf("certificate for %s is must-staple, "+
+					"so OCSP stapling must be enabled", kp.Leaf.Subject)
+			}
+		}
+	}
+
+	if opts.KnownUsers != nil {
+		newStore = opts.KnownUsers.wrap(newStore)
+	}
+	h := newHandler(storageDir, tokenTTL, users, opts.Hasher, newStore)
+	h.known = opts.KnownUsers
+	h.oidc = opts.OIDC
+	h.revoked = opts.Revoked
+	h.apiKeys = opts.APIKeys
+	h.tracing = opts.Tracing
+	h.uploads = opts.Uploads
+	h.delta = opts.Delta
+	h.limits = opts.Limits
+	if opts.Journal != nil {
+		newStore = opts.Journal.wrap(newStore)
+		h.newStore = newStore
+		if opts.Metrics != nil {
+			opts.Metrics.addJournal(opts.Journal)
+		}
+	}
+	if opts.Scrubber != nil && opts.Metrics != nil {
+		opts.Metrics.addScrubber(opts.Scrubber)
+	}
+	if opts.AutoBan != nil {
+		opts.AutoBan.proxies = opts.Proxies
+		if opts.Metrics != nil {
+			opts.Metrics.addAutoBan(opts.AutoBan)
+		}
+	}
+	if opts.LoginThrottle != nil {
+		opts.LoginThrottle.proxies = opts.Proxies
+		opts.LoginThrottle.audit = opts.Audit
+		if opts.Metrics != nil {
+			opts.Metrics.addLoginThrottle(opts.LoginThrottle)
+		}
+	}
+	if opts.Changes != nil {
+		newStore = opts.Changes.wrap(newStore)
+		h.newStore = newStore
+		h.changes = opts.Changes
+	}
+	if opts.Cluster != nil {
+		h.newStore = opts.Cluster.wrap(newStore)
+		h.cluster = opts.Cluster
+	}
+	if opts.Replication != nil {
+		h.newStore = opts.Replication.wrap(newStore)
+		h.replica = opts.Replication
+	}
+	h.migration = opts.Migration
+	h.links = opts.Links
+	if opts.Policies != nil {
+		h.newStore = opts.Policies.wrap(h.newStore)
+		h.policies = opts.Policies
 	}
 
 	s := &Server{
-		h:       h,
-		comms:   server.StartRemoteSync(id, localServer, h, certPem, keyPem),
-		keyPair: keyPair,
+		h:            h,
+		keyPairs:     keyPairs,
+		mtls:         opts.MTLS,
+		acme:         opts.ACME,
+		tlsSettings:  opts.TLSSettings,
+		ocsp:         opts.OCSPStapler,
+		insecureHTTP: opts.InsecureHTTP,
+		limiter:      opts.Limiter,
+		autoBan:      opts.AutoBan,
+		throttle:     opts.LoginThrottle,
+		limits:       opts.Limits,
+		grpc:         opts.GRPCSettings,
+		httpLimits:   opts.HTTPLimits,
+		webSecurity:  opts.WebSecurity,
+		certExpiry:   opts.CertExpiry,
+		gc:           opts.GC,
+		cluster:      opts.Cluster,
+		replication:  opts.Replication,
+		journal:      opts.Journal,
+		scrubber:     opts.Scrubber,
+		metrics:      opts.Metrics,
+		health:       opts.Health,
+		tracing:      opts.Tracing,
+		audit:        opts.Audit,
+		reporter:     opts.ErrorReporter,
+		handoff:      opts.Handoff,
+		notifier:     opts.Notifier,
+		listeners:    listeners,
+		stop:         make(chan struct{}),
+
+		adminListener: opts.AdminListener,
+	}
+	if opts.WebDAV != nil {
+		s.webdav = &webdavHandler{h: h, wd: opts.WebDAV, limiter: opts.Limiter,
+			concurrency: opts.Concurrency, autoBan: opts.AutoBan,
+			throttle: opts.LoginThrottle, maintenance: opts.Maintenance,
+			audit: opts.Audit}
+	}
+	if opts.Links != nil {
+		s.links = &linkHandler{h: h, links: opts.Links, limiter: opts.Limiter,
+			concurrency: opts.Concurrency, autoBan: opts.AutoBan,
+			audit: opts.Audit}
+	}
+
+	// Requests are traced first and logged next. Panics are reported next so
+	// that they are tagged with the request ID. Requests are counted and
+	// metrics recorded next so that they include rejected requests. Forwarded
+	// client addresses are resolved next so that all other interceptors see
+	// them. Requests are access logged and sync operations and logins audited
+	// next so that rejected requests are recorded. Requests from banned
+	// addresses are rejected next, and failed requests counted toward bans,
+	// including those rejected by the interceptors that follow. Logins to
+	// accounts with too many failed logins are rejected next, before they are
+	// verified. Rate limits are checked next so that rejected requests do no
+	// work, followed by concurrency limits so that rate limited requests are
+	// not counted. Paths are sanitized next so that
+	// the interceptors that follow and the handler only see valid paths. Errors
+	// of the storage worker pool are converted last so that all interceptors
+	// see their status.
+	var interceptors []grpc.UnaryServerInterceptor
+	if opts.Tracing != nil {
+		interceptors = append(interceptors, opts.Tracing.interceptor())
+	}
+	stats := newRPCStats(time.Now())
+	interceptors = append(interceptors, logInterceptor(h))
+	if opts.ErrorReporter != nil {
+		interceptors = append(interceptors, opts.ErrorReporter.interceptor())
+	}
+	interceptors = append(interceptors, stats.interceptor())
+	if opts.Metrics != nil {
+		interceptors = append(interceptors, opts.Metrics.interceptor())
+	}
+	if opts.Proxies != nil {
+		interceptors = append(interceptors, opts.Proxies.interceptor())
+	}
+	if opts.AccessLog != nil {
+		interceptors = append(interceptors, opts.AccessLog.interceptor(h))
+	}
+	if opts.Audit != nil {
+		interceptors = append(interceptors, opts.Audit.interceptor(h))
+	}
+	if opts.AutoBan != nil {
+		interceptors = append(interceptors, opts.AutoBan.interceptor())
+	}
+	if opts.LoginThrottle != nil {
+		interceptors = append(interceptors, opts.LoginThrottle.interceptor())
+	}
+	if opts.Limiter != nil {
+		interceptors = append(interceptors, opts.Limiter.interceptor(h))
+	}
+	if opts.Concurrency != nil {
+		interceptors = append(interceptors, opts.Concurrency.interceptor(h))
+	}
+	interceptors = append(interceptors, pathInterceptor())
+	if opts.Maintenance != nil {
+		interceptors = append(interceptors, opts.Maintenance.interceptor())
+	}
+	if opts.Cluster != nil {
+		interceptors = append(interceptors, opts.Cluster.interceptor())
+	}
+	if opts.Replication != nil {
+		interceptors = append(interceptors, opts.Replication.interceptor())
+	}
+	if opts.MTLS != nil {
+		interceptors = append(interceptors, opts.MTLS.interceptor(h))
+	}
+	interceptors = append(interceptors, storageStatusInterceptor())
+
+	var grpcServer *grpc.Server
+	if len(listeners) > 1 || !listeners[0].isDefault() ||
+		opts.Metrics != nil || opts.MTLS != nil || opts.ACME != nil ||
+		opts.TLSSettings != nil || opts.OCSPStapler != nil ||
+		opts.InsecureHTTP || len(opts.AdditionalCerts) > 0 ||
+		opts.Handoff != nil ||
+		(opts.Limits != nil && opts.Limits.MaxRequestBytes > 0) ||
+		opts.GRPCSettings != nil || opts.Concurrency.limitsConnections() ||
+		opts.IPFilter != nil || opts.AutoBan != nil ||
+		opts.HTTPLimits != nil || opts.WebSecurity != nil {
+		// Serve directly so that the TLS handshake can verify client
+		// certificates, select the certificate by SNI, use the current ACME
+		// certificate and OCSP staple, and use the TLS settings, so that TLS
+		// can be disabled, connections counted, limited, filtered, or tuned,
+		// messages, requests, or slow clients limited, origins restricted,
+		// security headers set, responses compressed, or the given socket,
+		// several addresses, or other protocols served, or the sockets handed
+		// off, since comms always listens itself on one address, accepts
+		// messages of any size, and serves gRPC and gRPC-web
+		if s.netListeners, err = listen(listeners, s.listen); err != nil {
+			return nil, err
+		}
+		for i, nl := range s.netListeners {
+			s.netListeners[i] = opts.Concurrency.listener(
+				opts.GRPCSettings.listener(
+					opts.AutoBan.listener(opts.IPFilter.listener(nl))))
+		}
+		if opts.Handoff != nil {
+			for _, l := range listeners {
+				if l.Listener != nil {
+					opts.Handoff.add(l.Address, l.Listener)
+				}
+			}
+		}
+		// Responses are only compressed on listeners with compression, whose
+		// requests carry their algorithms
+		s.grpcServer = grpc.NewServer(append(
+			opts.GRPCSettings.serverOptions(opts.Limits),
+			grpc.UnaryInterceptor(compressionUnaryInterceptor()),
+			grpc.StreamInterceptor(compressionStreamInterceptor()))...)
+		grpcServer = s.grpcServer
+	} else {
+		// Start the comms listeners
+		s.comms, err = connect.StartCommServer(
+			id, listeners[0].Address, certPem, keyPem, nil)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to start comms server")
+		}
+		grpcServer = s.comms.GetServer()
+	}
+
+	// Register all services before serving
+	grpcServer.RegisterService(intercept(&pb.RemoteSync_ServiceDesc,
+		interceptors), &remoteSyncEndpoints{h: h})
+	grpcServer.RegisterService(intercept(&rpc.Session_ServiceDesc,
+		interceptors), &sessionEndpoints{h: h})
+	grpcServer.RegisterService(intercept(&rpc.History_ServiceDesc,
+		interceptors), &historyEndpoints{h: h})
+	grpcServer.RegisterService(intercept(&rpc.Directory_ServiceDesc,
+		interceptors), &directoryEndpoints{h: h})
+	grpcServer.RegisterService(intercept(&rpc.Transaction_ServiceDesc,
+		interceptors), &transactionEndpoints{h: h})
+	grpcServer.RegisterService(intercept(&rpc.Batch_ServiceDesc,
+		interceptors), &batchEndpoints{h: h})
+	grpcServer.RegisterService(intercept(&rpc.Conditional_ServiceDesc,
+		interceptors), &conditionalEndpoints{h: h})
+	grpcServer.RegisterService(intercept(&rpc.Links_ServiceDesc,
+		interceptors), &linksEndpoints{h: h})
+	grpcServer.RegisterService(intercept(&rpc.Download_ServiceDesc,
+		interceptors), &downloadEndpoints{h: h})
+	grpcServer.RegisterService(intercept(&rpc.Metadata_ServiceDesc,
+		interceptors), &metadataEndpoints{h: h})
+	grpcServer.RegisterService(intercept(&rpc.Upload_ServiceDesc,
+		interceptors), &uploadEndpoints{h: h})
+	grpcServer.RegisterService(intercept(&rpc.Delta_ServiceDesc,
+		interceptors), &deltaEndpoints{h: h})
+	grpcServer.RegisterService(intercept(&rpc.Changes_ServiceDesc,
+		interceptors), &changesEndpoints{h: h})
+	grpcServer.RegisterService(intercept(&rpc.Migration_ServiceDesc,
+		interceptors), &migrationEndpoints{h: h})
+	admin := &adminEndpoints{
+		h: h, key: opts.AdminKey, certs: s.leaves, reload: opts.Reload,
+		stats: stats, maintenance: opts.Maintenance, registrar: registrar,
+		replication: opts.Replication, apiKeys: opts.APIKeys,
+		policies: opts.Policies, ipFilter: opts.IPFilter,
+		autoBan: opts.AutoBan, setLogLevel: opts.SetLogLevel}
+	if opts.AdminListener != nil {
+		// The Admin service is only served on the admin listener, with only
+		// its key, so that it is never reachable from the public listeners
+		adminInterceptors := []grpc.UnaryServerInterceptor{logInterceptor(h)}
+		if opts.ErrorReporter != nil {
+			adminInterceptors = append(
+				adminInterceptors, opts.ErrorReporter.interceptor())
+		}
+		admin.key, admin.apiKeys = opts.AdminListener.params.Key, nil
+		s.adminServer = grpc.NewServer()
+		s.adminServer.RegisterService(
+			intercept(&rpc.Admin_ServiceDesc, adminInterceptors), admin)
+		healthpb.RegisterHealthServer(s.adminServer, &healthEndpoints{
+			status:   s.servingStatus,
+			services: s.adminServer.GetServiceInfo})
+	} else {
+		grpcServer.RegisterService(
+			intercept(&rpc.Admin_ServiceDesc, interceptors), admin)
+	}
+	if opts.Replication != nil {
+		grpcServer.RegisterService(intercept(&rpc.Replication_ServiceDesc,
+			interceptors), &replicationEndpoints{
+			h: h, r: opts.Replication, scrubber: opts.Scrubber})
+	}
+	grpcServer.RegisterService(intercept(&rpc.Registration_ServiceDesc,
+		interceptors), &registrationEndpoints{r: registrar})
+	grpcServer.RegisterService(intercept(&rpc.Info_ServiceDesc,
+		interceptors), &infoEndpoints{version: versionResponse(
+		opts.BuildInfo, registrar, opts.OIDC, opts.APIKeys, opts.MTLS,
+		opts.Uploads, opts.Delta, opts.Changes, opts.Migration,
+		opts.Links)})
+
+	// The standard services are not intercepted, so that health checks are
+	// not rate limited or logged, and tools can use them without a token
+	healthpb.RegisterHealthServer(grpcServer, &healthEndpoints{
+		status: s.servingStatus, services: grpcServer.GetServiceInfo})
+	if opts.Reflection {
+		grpcreflect.Register(grpcServer)
+	}
+	if s.comms != nil {
+		s.comms.ServeWithWeb()
 	}
 
 	return s, nil
 }
 
-// Start starts the comms HTTPS server.
+// CheckOptions returns an error if the TLS options passed to NewServer cannot
+// be combined.
+func CheckOptions(mtls *MTLSAuthenticator, acme *ACMEManager,
+	tlsSettings *TLSSettings, ocspStapler *OCSPStapler, insecureHTTP bool,
+	additionalCerts []tls.Certificate, listeners []Listener) error {
+	listenerTLSSettings := false
+	for _, l := range listeners {
+		listenerTLSSettings = listenerTLSSettings || l.TLSSettings != nil
+	}
+	if insecureHTTP && (mtls != nil || acme != nil || tlsSettings != nil ||
+		listenerTLSSettings || ocspStapler != nil) {
+		return errors.New("mTLS, ACME, TLS settings, and OCSP stapling " +
+			"cannot be used without TLS")
+	}
+	if len(additionalCerts) > 0 && (acme != nil || insecureHTTP) {
+		return errors.New("additional certificates cannot be used with " +
+			"ACME or without TLS")
+	}
+	return nil
+}
+
+// Start starts the comms HTTPS server, the periodic removal of expired sessions
+// and uploads, and the monitoring of certificate expiry. With a scrubber,
+// stored files are verified in the background. With a journal, the writes
+// interrupted by a crash are replayed first. In ACME mode, a certificate is
+// obtained first if none is cached. With OCSP stapling, an OCSP response is
+// obtained first. With metrics, the metrics endpoint is started first. With an
+// admin listener, the Admin service is served on it first. In a cluster, the
+// node joins the cluster first. With replication, a primary or region starts
+// replicating to its standby, read replicas, and other regions first, and a
+// read replica connects to the primary first. With health checks, they are
+// served, or replace the startup checks, once the server is serving. With
+// listener handoff, the previous process, if any, is told once the server is
+// serving. With systemd notification, systemd is told once the server is
+// serving, unless it was started by an upgrade, and the watchdog is pinged
+// until Stop is called. The server runs in the background until Stop is called.
 func (s *Server) Start() error {
-	return s.comms.ServeHttps(s.keyPair)
+	if s.journal != nil {
+		if err := s.journal.open(s.h.storageDir); err != nil {
+			return err
+		}
+	}
+	if s.cluster != nil {
+		if err := s.cluster.start(s.h.storageDir, s.h.allUsers()); err != nil {
+			return err
+		}
+	}
+	if s.replication != nil {
+		if err := s.replication.start(s.stop); err != nil {
+			return err
+		}
+	}
+	if s.acme != nil {
+		if err := s.acme.start(s.listen, s.stop); err != nil {
+			return err
+		}
+	}
+	if s.ocsp != nil {
+		if err := s.startOCSP(); err != nil {
+			return err
+		}
+	}
+	if s.metrics != nil {
+		if err := s.metrics.start(s.h, s.listen, s.stop); err != nil {
+			return err
+		}
+	}
+	if s.adminListener != nil {
+		err := s.adminListener.start(s.adminServer, s.listen, s.stop)
+		if err != nil {
+			return err
+		}
+	}
+
+	if s.grpcServer != nil {
+		if err := s.serve(); err != nil {
+			return err
+		}
+	} else if err := s.comms.ServeHttps(s.keyPairs[0]); err != nil {
+		return err
+	}
+	go s.h.cleanupSessions(sessionCleanupInterval, s.stop)
+	if s.certExpiry != nil {
+		go s.certExpiry.run(s.leaves, certExpiryCheckInterval, s.stop)
+	}
+	if s.gc != nil {
+		go s.gc.run(s.h, s.stop)
+	}
+	if s.scrubber != nil {
+		go s.scrubber.run(s.h, s.stop)
+	}
+	if s.limiter != nil {
+		go s.limiter.cleanup(rateLimiterCleanupInterval, s.stop)
+	}
+	if s.autoBan != nil {
+		go s.autoBan.cleanup(autoBanCleanupInterval, s.stop)
+	}
+	if s.throttle != nil {
+		go s.throttle.cleanup(loginThrottleCleanupInterval, s.stop)
+	}
+	if s.h.uploads != nil {
+		go s.h.uploads.cleanup(uploadCleanupInterval, s.stop)
+	}
+	if s.health != nil {
+		err := s.health.start(s.readinessChecks(), s.listen, s.stop)
+		if err != nil {
+			return err
+		}
+	}
+
+	// After an upgrade, systemd already considers the service ready and the
+	// previous process makes this one the main process of the service
+	upgraded := s.handoff != nil && s.handoff.Inherited()
+	if s.handoff != nil {
+		s.handoff.serving()
+	}
+	if s.notifier != nil {
+		if !upgraded {
+			s.notifier.ready()
+		}
+		go s.notifier.pingWatchdog(s.stop)
+	}
+	return nil
+}
+
+// listen returns the socket bound by Bind for the address, if any, or listens
+// on the TCP address or, with listener handoff, uses the socket passed by the
+// previous process for it.
+func (s *Server) listen(address string) (net.Listener, error) {
+	if l, ok := s.bound[address]; ok {
+		delete(s.bound, address)
+		return l, nil
+	}
+	if s.handoff != nil {
+		return s.handoff.listen(address)
+	}
+	return net.Listen("tcp", address)
+}
+
+// Bind listens on the addresses of the ACME HTTP-01, metrics, and health check
+// endpoints, which Start otherwise listens on, so that the process can drop
+// privileges after binding privileged ports and before serving. Health checks
+// already served by Health.ServeStartup are not bound again. The listeners
+// are bound by NewServer. Must be called before Start.
+func (s *Server) Bind() error {
+	var addresses []string
+	if s.acme != nil && s.acme.params.Challenge == ChallengeHTTP01 {
+		addresses = append(addresses, s.acme.params.HTTPAddress)
+	}
+	if s.metrics != nil {
+		addresses = append(addresses, s.metrics.params.Address)
+	}
+	if s.health != nil && !s.health.serving() {
+		addresses = append(addresses, s.health.params.Address)
+	}
+
+	s.bound = make(map[string]net.Listener, len(addresses))
+	for _, address := range addresses {
+		l, err := s.listen(address)
+		if err != nil {
+			for _, bound := range s.bound {
+				_ = bound.Close()
+			}
+			return errors.Wrapf(err, "failed to listen on %s", address)
+		}
+		s.bound[address] = l
+	}
+	return nil
+}
+
+// Upgrade starts a new process of the server binary that serves on the sockets
+// of the server, then stops accepting connections and waits up to
+// handoffDrainTimeout for the requests in progress to complete. With systemd
+// notification, the new process becomes the main process of the service. Stop
+// must be called afterwards. Returns an error, and continues serving, if
+// listener handoff is disabled or the new process does not start serving.
+func (s *Server) Upgrade() error {
+	if s.handoff == nil {
+		return errors.New("listener handoff is disabled")
+	}
+	pid, err := s.handoff.upgrade(handoffReadyTimeout)
+	if err != nil {
+		return err
+	}
+	if s.notifier != nil {
+		s.notifier.handOff(pid)
+	}
+
+	ctx, cancel := context.WithTimeout(
+		context.Background(), handoffDrainTimeout)
+	defer cancel()
+	var wg sync.WaitGroup
+	for _, httpServer := range s.httpServers {
+		wg.Add(1)
+		go func(httpServer *http.Server) {
+			defer wg.Done()
+			if err := httpServer.Shutdown(ctx); err != nil {
+				jww.WARN.Printf("Stopped waiting for requests in progress "+
+					"to complete: %+v", err)
+			}
+		}(httpServer)
+	}
+	wg.Wait()
+	return nil
+}
+
+// serve serves the protocols of each listener over HTTPS in the background,
+// with the listener's TLS settings or the server's if it has none. In insecure
+// HTTP mode, they are served over plain HTTP instead, with native gRPC using
+// HTTP/2 without TLS (h2c). Returns an error if HTTP/2 cannot be configured.
+func (s *Server) serve() error {
+	// The wrapped server handles gRPC-web requests, and gRPC-web over
+	// WebSockets for streaming RPCs with change notifications
+	webServer := grpcweb.WrapServer(s.grpcServer,
+		grpcweb.WithOriginFunc(s.webSecurity.allowOrigin),
+		grpcweb.WithWebsockets(s.h.changes != nil),
+		grpcweb.WithWebsocketOriginFunc(s.webSecurity.allowWebsocket))
+
+	s.httpServers = make([]*http.Server, len(s.listeners))
+	for i, l := range s.listeners {
+		tlsSettings := l.TLSSettings
+		if tlsSettings == nil {
+			tlsSettings = s.tlsSettings
+		}
+		httpServer, err := s.newHTTPServer(
+			l.handler(
+				s.grpcServer, webServer, s.webdav, s.links, s.limits,
+				s.autoBan, s.webSecurity),
+			tlsSettings)
+		if err != nil {
+			return errors.Wrapf(err, "failed to configure %s server",
+				l.description())
+		}
+		s.httpServers[i] = httpServer
+	}
+	for i, l := range s.listeners {
+		go s.serveHTTP(s.httpServers[i], s.netListeners[i], l.description())
+	}
+	return nil
+}
+
+// newHTTPServer returns an HTTP server for the handler that uses the TLS
+// settings or, in insecure HTTP mode, serves HTTP/2 without TLS. Its requests
+// are limited by the HTTP limits, its responses have the security headers, and
+// its HTTP/2 connections use the gRPC settings and are counted if metrics are
+// enabled.
+func (s *Server) newHTTPServer(handler http.Handler,
+	tlsSettings *TLSSettings) (*http.Server, error) {
+	handler = s.webSecurity.handler(s.httpLimits.handler(handler))
+	httpServer := &http.Server{Handler: handler}
+	s.httpLimits.apply(httpServer)
+	if s.insecureHTTP {
+		httpServer.Handler = h2c.NewHandler(handler, s.grpc.http2Server())
+	} else {
+		httpServer.TLSConfig = s.tlsConfig(tlsSettings)
+		if s.grpc != nil {
+			err := http2.ConfigureServer(httpServer, s.grpc.http2Server())
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	if s.metrics != nil {
+		httpServer.ConnState = s.metrics.connState
+	}
+	return httpServer, nil
+}
+
+// serveHTTP serves the HTTP server on the listener until it is closed. The
+// description of what is served is logged.
+func (s *Server) serveHTTP(
+	httpServer *http.Server, listener net.Listener, description string) {
+	var err error
+	if s.insecureHTTP {
+		jww.WARN.Printf("Starting %s server WITHOUT TLS on %s. It must only "+
+			"be reachable through a reverse proxy that terminates TLS.",
+			description, listener.Addr())
+		err = httpServer.Serve(listener)
+	} else {
+		jww.INFO.Printf("Starting %s server on %s.",
+			description, listener.Addr())
+		err = httpServer.ServeTLS(listener, "", "")
+	}
+	if err != nil && err != http.ErrServerClosed {
+		jww.ERROR.Printf("Failed to serve %s: %+v", description, err)
+	}
+	jww.INFO.Printf("Stopped %s server listener", description)
+}
+
+// startOCSP obtains an OCSP response for each current certificate and
+// refreshes them in the background until the server is stopped. Returns an
+// error if no response can be obtained for a must-staple certificate.
+func (s *Server) startOCSP() error {
+	var certs []*tls.Certificate
+	if s.acme != nil {
+		cert, err := s.acme.GetCertificate(nil)
+		if err != nil {
+			return err
+		}
+		certs = append(certs, cert)
+	} else {
+		for i := range s.keyPairs {
+			certs = append(certs, &s.keyPairs[i])
+		}
+	}
+
+	for _, cert := range certs {
+		if err := s.ocsp.add(cert); err != nil {
+			leaf, parseErr := x509.ParseCertificate(cert.Certificate[0])
+			if parseErr == nil && mustStaple(leaf) {
+				return errors.Wrap(err, "failed to get OCSP response for "+
+					"must-staple certificate")
+			}
+			jww.WARN.Printf("Serving without an OCSP staple until the next "+
+				"refresh: %+v", err)
+		}
+	}
+
+	go s.ocsp.refresh(ocspCheckInterval, s.stop)
+	return nil
+}
+
+// certificate returns the certificate to serve, which is the ACME certificate
+// in ACME mode and the configured certificate selected by SNI otherwise.
+func (s *Server) certificate(
+	hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	if s.acme != nil {
+		return s.acme.GetCertificate(hello)
+	}
+	return selectCertificate(s.keyPairs, hello), nil
+}
+
+// leaves returns the leaf certificates currently served by the server. It is
+// empty in insecure HTTP mode.
+func (s *Server) leaves() []*x509.Certificate {
+	if s.acme != nil {
+		cert, err := s.acme.GetCertificate(nil)
+		if err != nil {
+			return nil
+		}
+		return []*x509.Certificate{cert.Leaf}
+	}
+
+	leaves := make([]*x509.Certificate, len(s.keyPairs))
+	for i := range s.keyPairs {
+		leaves[i] = s.keyPairs[i].Leaf
+	}
+	return leaves
+}
+
+// getCertificate returns the certificate for the TLS handshake with its OCSP
+// response stapled, if enabled. It is used as tls.Config.GetCertificate.
+func (s *Server) getCertificate(
+	hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	cert, err := s.certificate(hello)
+	if err != nil || s.ocsp == nil {
+		return cert, err
+	}
+	return s.ocsp.staple(cert), nil
+}
+
+// tlsConfig returns the TLS config of a listener. It serves the certificate
+// for the requested server name or the ACME certificate and OCSP staple, if
+// enabled, requires client certificates in mTLS mode, and applies the TLS
+// settings, if not nil.
+func (s *Server) tlsConfig(tlsSettings *TLSSettings) *tls.Config {
+	conf := &tls.Config{MinVersion: defaultTLSMinVersion}
+	if tlsSettings != nil {
+		tlsSettings.apply(conf)
+	}
+	if s.acme != nil || s.ocsp != nil {
+		conf.GetCertificate = s.getCertificate
+	} else {
+		conf.Certificates = s.keyPairs
+	}
+	if s.mtls != nil {
+		s.mtls.configureTLS(conf)
+	}
+	return conf
+}
+
+// Stop shuts down the comms server and stops the removal of expired sessions.
+// In a cluster, the node leaves it. With replication, the server disconnects
+// from its peers. With tracing, the remaining spans are exported. The audit log
+// is closed. With error reporting, the pending events are sent. With systemd
+// notification, systemd is told that the server is stopping.
+func (s *Server) Stop() {
+	if s.notifier != nil {
+		s.notifier.stopping()
+	}
+	close(s.stop)
+	if s.grpcServer != nil {
+		for _, httpServer := range s.httpServers {
+			if httpServer != nil {
+				_ = httpServer.Close()
+			}
+		}
+		closeListeners(s.netListeners)
+		s.grpcServer.Stop()
+	} else {
+		s.comms.Shutdown()
+	}
+	if s.cluster != nil {
+		s.cluster.stop()
+	}
+	if s.replication != nil {
+		s.replication.stop()
+	}
+	if s.journal != nil {
+		s.journal.close()
+	}
+	if s.tracing != nil {
+		s.tracing.stop()
+	}
+	if s.audit != nil {
+		if err := s.audit.Close(); err != nil {
+			jww.WARN.Printf("Failed to close audit log: %+v", err)
+		}
+	}
+	if s.reporter != nil {
+		s.reporter.Flush()
+	}
 }
@@ -0,0 +1,89 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+
+	"github.com/pkg/errors"
+
+	"gitlab.com/xx_network/primitives/utils"
+)
+
+// CertificateFiles are the paths to a PEM-encoded certificate chain and its
+// private key.
+type CertificateFiles struct {
+	CertPath string `mapstructure:"certPath"`
+	KeyPath  string `mapstructure:"keyPath"`
+}
+
+// LoadCertificates decodes a list of CertificateFiles and loads their key
+// pairs. They are served in addition to the default certificate to clients
+// that request one of their names with SNI.
+func LoadCertificates(params interface{}) ([]tls.Certificate, error) {
+	var files []CertificateFiles
+	if err := decodeParams(params, &files, "certificate file"); err != nil {
+		return nil, err
+	}
+
+	keyPairs := make([]tls.Certificate, 0, len(files))
+	for _, f := range files {
+		if f.CertPath == "" || f.KeyPath == "" {
+			return nil, errors.New("certificate and key paths are required")
+		}
+		certPem, err := utils.ReadFile(f.CertPath)
+		if err != nil {
+			return nil, errors.Wrapf(err,
+				"failed to read certificate from path %s", f.CertPath)
+		}
+		keyPem, err := utils.ReadFile(f.KeyPath)
+		if err != nil {
+			return nil, errors.Wrapf(err,
+				"failed to read key from path %s", f.KeyPath)
+		}
+		keyPair, err := parseKeyPair(certPem, keyPem)
+		if err != nil {
+			return nil, errors.WithMessagef(err, "certificate %s", f.CertPath)
+		}
+		keyPairs = append(keyPairs, keyPair)
+	}
+
+	return keyPairs, nil
+}
+
+// parseKeyPair parses a PEM-encoded certificate chain and private key into a
+// key pair with its leaf certificate set.
+func parseKeyPair(certPem, keyPem []byte) (tls.Certificate, error) {
+	keyPair, err := tls.X509KeyPair(certPem, keyPem)
+	if err != nil {
+		return tls.Certificate{}, errors.Errorf("failed to generate a "+
+			"public/private TLS key pair from the cert and key: %+v", err)
+	}
+	keyPair.Leaf, err = x509.ParseCertificate(keyPair.Certificate[0])
+	if err != nil {
+		return tls.Certificate{}, errors.Wrap(err, "failed to parse certificate")
+	}
+	return keyPair, nil
+}
+
+// selectCertificate returns the first key pair that supports the client's TLS
+// handshake, which includes matching the server name it requested with SNI.
+// Falls back to the first key pair, which is the default certificate, for
+// clients that send no or an unknown server name.
+func selectCertificate(
+	keyPairs []tls.Certificate, hello *tls.ClientHelloInfo) *tls.Certificate {
+	if hello != nil && len(keyPairs) > 1 {
+		for i := range keyPairs {
+			if hello.SupportsCertificate(&keyPairs[i]) == nil {
+				return &keyPairs[i]
+			}
+		}
+	}
+	return &keyPairs[0]
+}
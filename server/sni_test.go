@@ -0,0 +1,122 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package server
+
+import (
+	"crypto/ecdsa"
+	"crypto/tls"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// Tests that LoadCertificates loads each key pair with its leaf certificate.
+func TestLoadCertificates(t *testing.T) {
+	dir := t.TempDir()
+	var params []interface{}
+	for _, domain := range []string{"eu.example.com", "us.example.com"} {
+		certPath, keyPath := writeTestCertificate(t, dir, domain)
+		params = append(params,
+			map[string]interface{}{"certPath": certPath, "keyPath": keyPath})
+	}
+
+	keyPairs, err := LoadCertificates(params)
+	if err != nil {
+		t.Fatalf("Failed to load certificates: %+v", err)
+	}
+	if len(keyPairs) != len(params) {
+		t.Fatalf("Unexpected number of key pairs.\nexpected: %d\nreceived: %d",
+			len(params), len(keyPairs))
+	}
+	if name := keyPairs[1].Leaf.Subject.CommonName; name != "us.example.com" {
+		t.Errorf("Unexpected leaf.\nexpected: %s\nreceived: %s",
+			"us.example.com", name)
+	}
+}
+
+// Error path: Tests that LoadCertificates returns an error for unknown
+// parameters and missing or invalid files.
+func TestLoadCertificates_Error(t *testing.T) {
+	dir := t.TempDir()
+	certPath, keyPath := writeTestCertificate(t, dir, "example.com")
+	for _, params := range []interface{}{
+		[]interface{}{map[string]interface{}{
+			"certPath": certPath, "keyPath": keyPath, "domain": "example.com"}},
+		[]interface{}{map[string]interface{}{"certPath": certPath}},
+		[]interface{}{map[string]interface{}{
+			"certPath": filepath.Join(dir, "missing.pem"), "keyPath": keyPath}},
+		[]interface{}{map[string]interface{}{
+			"certPath": keyPath, "keyPath": keyPath}},
+	} {
+		if _, err := LoadCertificates(params); err == nil {
+			t.Errorf("Failed to get error for params %v.", params)
+		}
+	}
+}
+
+// Tests that selectCertificate returns the key pair for the requested server
+// name and falls back to the default for missing and unknown names.
+func Test_selectCertificate(t *testing.T) {
+	notAfter := time.Now().Add(time.Hour)
+	keyPairs := []tls.Certificate{
+		*newTestCertificate(t, []string{"example.com"}, notAfter),
+		*newTestCertificate(t, []string{"eu.example.com"}, notAfter),
+		*newTestCertificate(t, []string{"*.us.example.com"}, notAfter),
+	}
+
+	tests := []struct {
+		serverName string
+		expected   int
+	}{
+		{"eu.example.com", 1},
+		{"sync.us.example.com", 2},
+		{"example.com", 0},
+		{"unknown.example.org", 0},
+		{"", 0},
+	}
+
+	for _, tt := range tests {
+		hello := &tls.ClientHelloInfo{
+			ServerName:        tt.serverName,
+			SupportedVersions: []uint16{tls.VersionTLS13},
+		}
+		if selectCertificate(keyPairs, hello) != &keyPairs[tt.expected] {
+			t.Errorf("Certificate %d not returned for %q.",
+				tt.expected, tt.serverName)
+		}
+	}
+
+	if selectCertificate(keyPairs, nil) != &keyPairs[0] {
+		t.Errorf("Default certificate not returned without a ClientHello.")
+	}
+}
+
+// writeTestCertificate writes a new self-signed certificate and key for the
+// domain to PEM files in the directory and returns their paths.
+func writeTestCertificate(
+	t testing.TB, dir, domain string) (certPath, keyPath string) {
+	cert := newTestCertificate(t, []string{domain}, time.Now().Add(time.Hour))
+	keyPem, err := encodeKey(cert.PrivateKey.(*ecdsa.PrivateKey))
+	if err != nil {
+		t.Fatalf("Failed to encode key: %+v", err)
+	}
+	certPem := pem.EncodeToMemory(
+		&pem.Block{Type: "CERTIFICATE", Bytes: cert.Certificate[0]})
+
+	certPath = filepath.Join(dir, domain+".crt")
+	keyPath = filepath.Join(dir, domain+".key")
+	if err = os.WriteFile(certPath, certPem, 0600); err != nil {
+		t.Fatalf("Failed to write certificate: %+v", err)
+	}
+	if err = os.WriteFile(keyPath, keyPem, 0600); err != nil {
+		t.Fatalf("Failed to write key: %+v", err)
+	}
+	return certPath, keyPath
+}
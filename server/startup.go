@@ -0,0 +1,147 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package server
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	jww "github.com/spf13/jwalterweatherman"
+)
+
+// Default parameters of the startup retries.
+const (
+	defaultStartupTimeout    = 5 * time.Minute
+	defaultStartupMinBackoff = time.Second
+	defaultStartupMaxBackoff = 30 * time.Second
+)
+
+// StartupParams are the parameters of the retries of the dependencies of the
+// server, such as the storage backend and credential database, while it
+// starts.
+type StartupParams struct {
+	// Timeout is the maximum time from the creation of the Startup until all
+	// dependencies are connected. Defaults to 5 minutes.
+	Timeout time.Duration `mapstructure:"timeout"`
+
+	// MinBackoff is the delay before the first retry of a dependency, which
+	// doubles after each attempt. Defaults to 1 second.
+	MinBackoff time.Duration `mapstructure:"minBackoff"`
+
+	// MaxBackoff is the maximum delay between retries. Defaults to 30 seconds.
+	MaxBackoff time.Duration `mapstructure:"maxBackoff"`
+}
+
+// Startup retries connecting to the dependencies of the server with
+// exponential backoff while it starts, so that the server waits for them
+// instead of exiting when it starts before them, such as in a Kubernetes pod.
+// The server is not ready until they are all connected.
+type Startup struct {
+	params   StartupParams
+	deadline time.Time
+
+	// waiting are the last errors of the dependencies that are not connected
+	// yet, by name.
+	waiting map[string]error
+	mux     sync.Mutex
+}
+
+// NewStartup creates a new Startup from the parameters. Its timeout starts
+// now.
+func NewStartup(params map[string]interface{}) (*Startup, error) {
+	p := StartupParams{
+		Timeout:    defaultStartupTimeout,
+		MinBackoff: defaultStartupMinBackoff,
+		MaxBackoff: defaultStartupMaxBackoff,
+	}
+	if err := decodeParams(params, &p, "startup"); err != nil {
+		return nil, err
+	}
+	if p.Timeout <= 0 {
+		return nil, errors.Errorf(
+			"startup timeout %s must be positive", p.Timeout)
+	} else if p.MinBackoff <= 0 {
+		return nil, errors.Errorf(
+			"startup minBackoff %s must be positive", p.MinBackoff)
+	} else if p.MaxBackoff < p.MinBackoff {
+		return nil, errors.Errorf("startup maxBackoff %s must be at least "+
+			"minBackoff %s", p.MaxBackoff, p.MinBackoff)
+	}
+
+	return &Startup{
+		params:   p,
+		deadline: time.Now().Add(p.Timeout),
+		waiting:  make(map[string]error),
+	}, nil
+}
+
+// Wait calls connect until it succeeds, waiting with exponential backoff
+// between attempts, and returns the last error if it does not succeed before
+// the timeout. The named dependency fails the readiness check while it is not
+// connected. If the Startup is nil, connect is called once.
+func (st *Startup) Wait(name string, connect func() error) error {
+	if st == nil {
+		return connect()
+	}
+
+	backoff := st.params.MinBackoff
+	for attempt := 1; ; attempt++ {
+		err := connect()
+		st.mux.Lock()
+		if err == nil {
+			delete(st.waiting, name)
+		} else {
+			st.waiting[name] = err
+		}
+		st.mux.Unlock()
+
+		if err == nil {
+			if attempt > 1 {
+				jww.INFO.Printf("Connected to %s after %d attempts.",
+					name, attempt)
+			}
+			return nil
+		}
+
+		remaining := time.Until(st.deadline)
+		if remaining <= 0 {
+			return errors.Wrapf(err, "%s not available within %s",
+				name, st.params.Timeout)
+		} else if backoff > remaining {
+			backoff = remaining
+		}
+		jww.WARN.Printf("Failed to connect to %s; retrying in %s: %v",
+			name, backoff, err)
+		time.Sleep(backoff)
+
+		if backoff *= 2; backoff > st.params.MaxBackoff {
+			backoff = st.params.MaxBackoff
+		}
+	}
+}
+
+// check is the readiness check while the server starts, which always fails
+// since the server is not serving yet. The error lists the dependencies that
+// are not connected yet and their last errors.
+func (st *Startup) check() error {
+	st.mux.Lock()
+	defer st.mux.Unlock()
+	if len(st.waiting) == 0 {
+		return errors.New("starting")
+	}
+
+	waiting := make([]string, 0, len(st.waiting))
+	for name, err := range st.waiting {
+		waiting = append(waiting, name+": "+err.Error())
+	}
+	sort.Strings(waiting)
+	return errors.Errorf("waiting for %s", strings.Join(waiting, "; "))
+}
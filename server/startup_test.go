@@ -0,0 +1,130 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package server
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// newTestStartup returns a Startup that retries quickly for the timeout.
+func newTestStartup(t *testing.T, timeout time.Duration) *Startup {
+	st, err := NewStartup(map[string]interface{}{"timeout": timeout,
+		"minBackoff": time.Millisecond, "maxBackoff": 4 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("Failed to create Startup: %+v", err)
+	}
+	return st
+}
+
+// Tests that NewStartup applies the defaults for parameters that are not set.
+func TestNewStartup(t *testing.T) {
+	tests := []struct {
+		params   map[string]interface{}
+		expected StartupParams
+	}{
+		{map[string]interface{}{}, StartupParams{defaultStartupTimeout,
+			defaultStartupMinBackoff, defaultStartupMaxBackoff}},
+		{map[string]interface{}{"timeout": "2m", "minBackoff": "500ms",
+			"maxBackoff": "10s"},
+			StartupParams{2 * time.Minute, 500 * time.Millisecond,
+				10 * time.Second}},
+	}
+	for i, tt := range tests {
+		st, err := NewStartup(tt.params)
+		if err != nil {
+			t.Errorf("Failed to create Startup %d: %+v", i, err)
+		} else if st.params != tt.expected {
+			t.Errorf("Unexpected parameters %d.\nexpected: %+v\nreceived: %+v",
+				i, tt.expected, st.params)
+		}
+	}
+}
+
+// Error path: Tests that NewStartup returns an error for invalid parameters.
+func TestNewStartup_Error(t *testing.T) {
+	tests := map[string]map[string]interface{}{
+		"zero timeout":        {"timeout": "0s"},
+		"zero minBackoff":     {"minBackoff": "0s"},
+		"maxBackoff too low":  {"minBackoff": "10s", "maxBackoff": "1s"},
+		"invalid duration":    {"timeout": "soon"},
+		"unknown key":         {"retries": 5},
+		"negative maxBackoff": {"maxBackoff": "-1s"},
+	}
+	for name, params := range tests {
+		if _, err := NewStartup(params); err == nil {
+			t.Errorf("Failed to get error for %s.", name)
+		}
+	}
+}
+
+// Tests that Startup.Wait retries until the dependency connects and that the
+// readiness check reports it while it is not connected.
+func TestStartup_Wait(t *testing.T) {
+	st := newTestStartup(t, time.Minute)
+
+	var attempts int
+	err := st.Wait("storage", func() error {
+		if attempts++; attempts < 3 {
+			if checkErr := st.check(); attempts > 1 && (checkErr == nil ||
+				!strings.Contains(checkErr.Error(), "storage: unreachable")) {
+				t.Errorf("Readiness check does not report the dependency: %v",
+					checkErr)
+			}
+			return errors.New("unreachable")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Failed to wait for dependency: %+v", err)
+	} else if attempts != 3 {
+		t.Errorf("Unexpected number of attempts.\nexpected: %d\nreceived: %d",
+			3, attempts)
+	}
+
+	// The server is still not ready until it is serving
+	if err = st.check(); err == nil || err.Error() != "starting" {
+		t.Errorf("Unexpected readiness error.\nexpected: %q\nreceived: %v",
+			"starting", err)
+	}
+}
+
+// Tests that Startup.Wait calls the function once if the Startup is nil.
+func TestStartup_Wait_Nil(t *testing.T) {
+	var st *Startup
+	var attempts int
+	err := st.Wait("storage", func() error {
+		attempts++
+		return errors.New("unreachable")
+	})
+	if err == nil || attempts != 1 {
+		t.Errorf("Expected one failed attempt; received %d attempts: %v",
+			attempts, err)
+	}
+}
+
+// Error path: Tests that Startup.Wait returns the last error once the timeout
+// passes.
+func TestStartup_Wait_TimeoutError(t *testing.T) {
+	st := newTestStartup(t, 20*time.Millisecond)
+
+	start := time.Now()
+	err := st.Wait("credentials", func() error {
+		return errors.New("connection refused")
+	})
+	if err == nil || !strings.Contains(err.Error(), "connection refused") {
+		t.Errorf("Unexpected error.\nexpected: %q\nreceived: %v",
+			"connection refused", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Waited %s after a timeout of 20ms.", elapsed)
+	}
+}
@@ -0,0 +1,153 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package server
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	jww "github.com/spf13/jwalterweatherman"
+	"google.golang.org/grpc"
+
+	"gitlab.com/elixxir/remoteSyncServer/store"
+)
+
+// statsWindow is the number of seconds over which the rates of RPCs and errors
+// are averaged.
+const statsWindow = 60
+
+// rpcStats counts the RPCs handled by the server and those that failed, in
+// total and in each of the last statsWindow seconds, for the GetStats RPC of
+// the Admin service.
+type rpcStats struct {
+	started time.Time
+	rpcs    uint64
+	errors  uint64
+
+	// buckets contains the counts of each second, indexed by the Unix time in
+	// seconds modulo statsWindow.
+	buckets [statsWindow]statsBucket
+
+	mux sync.Mutex
+}
+
+// statsBucket contains the counts of RPCs in a single second.
+type statsBucket struct {
+	second int64
+	rpcs   uint64
+	errors uint64
+}
+
+// newRPCStats returns empty statistics of a server started at the time.
+func newRPCStats(started time.Time) *rpcStats {
+	return &rpcStats{started: started}
+}
+
+// interceptor returns an interceptor that counts each RPC and whether it
+// failed.
+func (rs *rpcStats) interceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{},
+		_ *grpc.UnaryServerInfo, next grpc.UnaryHandler) (interface{}, error) {
+		resp, err := next(ctx, req)
+		rs.record(time.Now(), err != nil)
+		return resp, err
+	}
+}
+
+// record counts an RPC completed at the time.
+func (rs *rpcStats) record(now time.Time, failed bool) {
+	rs.mux.Lock()
+	defer rs.mux.Unlock()
+
+	second := now.Unix()
+	b := &rs.buckets[second%statsWindow]
+	if b.second != second {
+		*b = statsBucket{second: second}
+	}
+	rs.rpcs++
+	b.rpcs++
+	if failed {
+		rs.errors++
+		b.errors++
+	}
+}
+
+// totals returns the number of RPCs and of failed RPCs since the server
+// started.
+func (rs *rpcStats) totals() (rpcs, errors uint64) {
+	rs.mux.Lock()
+	defer rs.mux.Unlock()
+	return rs.rpcs, rs.errors
+}
+
+// rates returns the average number of RPCs and of failed RPCs per second over
+// the last statsWindow seconds before the time, or since the server started if
+// it is more recent.
+func (rs *rpcStats) rates(now time.Time) (rpcRate, errorRate float64) {
+	rs.mux.Lock()
+	defer rs.mux.Unlock()
+
+	var rpcs, errors uint64
+	second := now.Unix()
+	for _, b := range rs.buckets {
+		if b.second > second-statsWindow && b.second <= second {
+			rpcs += b.rpcs
+			errors += b.errors
+		}
+	}
+
+	window := now.Sub(rs.started).Seconds()
+	if window > statsWindow {
+		window = statsWindow
+	} else if window < 1 {
+		window = 1
+	}
+	return float64(rpcs) / window, float64(errors) / window
+}
+
+// activeSessions returns the number of sessions that have not expired.
+func (h *handler) activeSessions() int {
+	h.mux.Lock()
+	defer h.mux.Unlock()
+
+	var active int
+	for _, s := range h.sessions {
+		if s.IsValid() {
+			active++
+		}
+	}
+	return active
+}
+
+// storageUsage returns the size of the files of each of the users whose store
+// implements store.Sizer. Users whose storage cannot be opened or measured are
+// logged and skipped.
+func (h *handler) storageUsage(usernames []string) map[string]int64 {
+	usage := make(map[string]int64, len(usernames))
+	for _, username := range usernames {
+		s, err := h.newStore(h.storageDir, username)
+		if err != nil {
+			jww.WARN.Printf("Failed to open storage of %q to measure it: %+v",
+				username, err)
+			continue
+		}
+		sizer, ok := s.(store.Sizer)
+		if !ok {
+			continue
+		}
+		size, err := sizer.Size()
+		if err != nil {
+			jww.WARN.Printf("Failed to measure storage of %q: %+v",
+				username, err)
+			continue
+		}
+		usage[username] = size
+	}
+	return usage
+}
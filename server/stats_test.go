@@ -0,0 +1,94 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package server
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"google.golang.org/grpc"
+
+	"gitlab.com/elixxir/remoteSyncServer/credentials"
+	"gitlab.com/elixxir/remoteSyncServer/store"
+)
+
+// Tests that rpcStats.rates averages the RPCs of the last statsWindow seconds
+// over the window, or over the uptime if it is shorter, and that totals
+// include all RPCs.
+func Test_rpcStats(t *testing.T) {
+	started := time.Unix(1_700_000_000, 0)
+	rs := newRPCStats(started)
+
+	// 10 RPCs, 2 of which failed, in the first 10 seconds
+	for i := 0; i < 10; i++ {
+		rs.record(started.Add(time.Duration(i)*time.Second), i%5 == 0)
+	}
+	rpcRate, errorRate := rs.rates(started.Add(10 * time.Second))
+	if rpcRate != 1 || errorRate != 0.2 {
+		t.Errorf("Unexpected rates after 10s.\nexpected: %g, %g"+
+			"\nreceived: %g, %g", 1.0, 0.2, rpcRate, errorRate)
+	}
+
+	// 30 more RPCs at 65s, reusing the bucket of the RPC at 5s
+	for i := 0; i < 30; i++ {
+		rs.record(started.Add(65*time.Second), false)
+	}
+	rpcRate, errorRate = rs.rates(started.Add(100 * time.Second))
+	if rpcRate != 0.5 || errorRate != 0 {
+		t.Errorf("Unexpected rates after 100s.\nexpected: %g, %g"+
+			"\nreceived: %g, %g", 0.5, 0.0, rpcRate, errorRate)
+	}
+
+	if rpcs, errs := rs.totals(); rpcs != 40 || errs != 2 {
+		t.Errorf("Unexpected totals.\nexpected: %d, %d\nreceived: %d, %d",
+			40, 2, rpcs, errs)
+	}
+}
+
+// Tests that the interceptor of rpcStats counts successful and failed RPCs.
+func Test_rpcStats_interceptor(t *testing.T) {
+	rs := newRPCStats(time.Now())
+	interceptor := rs.interceptor()
+	for _, err := range []error{nil, errors.New("failed"), nil} {
+		_, _ = interceptor(context.Background(), nil, &grpc.UnaryServerInfo{},
+			func(context.Context, interface{}) (interface{}, error) {
+				return nil, err
+			})
+	}
+
+	if rpcs, errs := rs.totals(); rpcs != 3 || errs != 1 {
+		t.Errorf("Unexpected totals.\nexpected: %d, %d\nreceived: %d, %d",
+			3, 1, rpcs, errs)
+	}
+}
+
+// Tests that handler.activeSessions only counts sessions that have not
+// expired.
+func Test_handler_activeSessions(t *testing.T) {
+	h := newHandler("", time.Hour, credentials.NewMemStore(
+		map[string]string{"waldo": "a", "fred": "b"}), nil, store.NewMemStore)
+	if _, err := h.addSession("waldo"); err != nil {
+		t.Fatalf("Failed to add session: %+v", err)
+	}
+	fred, err := h.addSession("fred")
+	if err != nil {
+		t.Fatalf("Failed to add session: %+v", err)
+	}
+	if active := h.activeSessions(); active != 2 {
+		t.Errorf("Unexpected active sessions.\nexpected: %d\nreceived: %d",
+			2, active)
+	}
+
+	fred.ExpiryTime = time.Now().Add(-time.Second)
+	if active := h.activeSessions(); active != 1 {
+		t.Errorf("Unexpected active sessions after expiry."+
+			"\nexpected: %d\nreceived: %d", 1, active)
+	}
+}
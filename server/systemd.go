@@ -0,0 +1,212 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package server
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	jww "github.com/spf13/jwalterweatherman"
+)
+
+// Environment variables of the systemd socket activation protocol. See
+// sd_listen_fds(3).
+const (
+	listenPIDEnv     = "LISTEN_PID"
+	listenFDsEnv     = "LISTEN_FDS"
+	listenFDNamesEnv = "LISTEN_FDNAMES"
+)
+
+// Environment variables of the systemd service notification protocol. See
+// sd_notify(3) and sd_watchdog_enabled(3).
+const (
+	notifySocketEnv = "NOTIFY_SOCKET"
+	watchdogUSecEnv = "WATCHDOG_USEC"
+	watchdogPIDEnv  = "WATCHDOG_PID"
+)
+
+// listenFDsStart is the first file descriptor passed by systemd.
+const listenFDsStart = 3
+
+// SystemdListener returns the listening socket passed to the process by
+// systemd socket activation, so that the server does not bind the port itself.
+// Returns nil if the process was not socket activated. Returns an error if more
+// than one socket was passed or it is not a listening socket. The environment
+// variables of the protocol are unset so that they are not inherited by child
+// processes.
+func SystemdListener() (net.Listener, error) {
+	listeners, err := systemdListeners(listenFDsStart)
+	if err != nil || len(listeners) == 0 {
+		return nil, err
+	}
+	if len(listeners) > 1 {
+		for _, l := range listeners {
+			_ = l.Close()
+		}
+		return nil, errors.Errorf("expected one socket from systemd, "+
+			"received %d", len(listeners))
+	}
+	return listeners[0], nil
+}
+
+// systemdListeners returns the listeners for the file descriptors passed by
+// systemd, which start at the given descriptor.
+func systemdListeners(start int) ([]net.Listener, error) {
+	defer func() {
+		_ = os.Unsetenv(listenPIDEnv)
+		_ = os.Unsetenv(listenFDsEnv)
+		_ = os.Unsetenv(listenFDNamesEnv)
+	}()
+
+	// The descriptors are only meant for this process if LISTEN_PID matches,
+	// since the variables may have been inherited from a parent
+	pid, err := strconv.Atoi(os.Getenv(listenPIDEnv))
+	if err != nil || pid != os.Getpid() {
+		return nil, nil
+	}
+	n, err := strconv.Atoi(os.Getenv(listenFDsEnv))
+	if err != nil || n < 0 {
+		return nil, errors.Errorf("invalid %s %q from systemd", listenFDsEnv,
+			os.Getenv(listenFDsEnv))
+	}
+
+	listeners := make([]net.Listener, 0, n)
+	for fd := start; fd < start+n; fd++ {
+		f := os.NewFile(uintptr(fd), "LISTEN_FD_"+strconv.Itoa(fd))
+
+		// FileListener duplicates the descriptor, so the original is closed
+		l, err := net.FileListener(f)
+		_ = f.Close()
+		if err != nil {
+			for _, l := range listeners {
+				_ = l.Close()
+			}
+			return nil, errors.Wrapf(err, "file descriptor %d from systemd "+
+				"is not a listening socket", fd)
+		}
+		listeners = append(listeners, l)
+	}
+
+	return listeners, nil
+}
+
+// SystemdNotifier notifies systemd of the status of the server, for services
+// with Type=notify, and pings the systemd watchdog, for services with
+// WatchdogSec.
+type SystemdNotifier struct {
+	// socket is the address of the notification socket.
+	socket string
+
+	// watchdog is the time after which systemd restarts the service if it was
+	// not pinged, or zero if the watchdog is disabled.
+	watchdog time.Duration
+
+	// handedOff is true once the server has handed off to a new process,
+	// which notifies systemd from then on.
+	handedOff bool
+	mux       sync.Mutex
+}
+
+// NewSystemdNotifier returns a SystemdNotifier for the notification socket
+// passed to the process by systemd. Returns nil if systemd did not pass one.
+// Returns an error if the watchdog timeout is invalid. The variables are kept
+// so that the process started by an upgrade can notify systemd, except for the
+// watchdog PID, which would disable its watchdog.
+func NewSystemdNotifier() (*SystemdNotifier, error) {
+	socket := os.Getenv(notifySocketEnv)
+	if socket == "" {
+		return nil, nil
+	}
+	sn := &SystemdNotifier{socket: socket}
+
+	// The watchdog is only meant for this process if WATCHDOG_PID matches, if
+	// set, since the variables may have been inherited from a parent
+	usec := os.Getenv(watchdogUSecEnv)
+	if pid := os.Getenv(watchdogPIDEnv); usec == "" ||
+		(pid != "" && pid != strconv.Itoa(os.Getpid())) {
+		return sn, nil
+	}
+	_ = os.Unsetenv(watchdogPIDEnv)
+	n, err := strconv.ParseUint(usec, 10, 63)
+	if err != nil || n == 0 {
+		return nil, errors.Errorf("invalid %s %q from systemd",
+			watchdogUSecEnv, usec)
+	}
+	sn.watchdog = time.Duration(n) * time.Microsecond
+	return sn, nil
+}
+
+// Watchdog returns the time after which systemd restarts the service if the
+// watchdog was not pinged, or zero if the watchdog is disabled.
+func (sn *SystemdNotifier) Watchdog() time.Duration {
+	return sn.watchdog
+}
+
+// ready tells systemd that the server is serving.
+func (sn *SystemdNotifier) ready() {
+	sn.send("READY=1")
+}
+
+// stopping tells systemd that the server is shutting down.
+func (sn *SystemdNotifier) stopping() {
+	sn.send("STOPPING=1")
+}
+
+// handOff tells systemd that the process with the PID replaces this one as the
+// main process of the service. Nothing is sent to systemd afterwards.
+func (sn *SystemdNotifier) handOff(pid int) {
+	sn.send(fmt.Sprintf("MAINPID=%d", pid))
+	sn.mux.Lock()
+	defer sn.mux.Unlock()
+	sn.handedOff = true
+}
+
+// pingWatchdog pings the systemd watchdog at half its timeout, as recommended
+// by sd_watchdog_enabled(3), until the stop channel is closed. Does nothing if
+// the watchdog is disabled.
+func (sn *SystemdNotifier) pingWatchdog(stop <-chan struct{}) {
+	if sn.watchdog == 0 {
+		return
+	}
+	ticker := time.NewTicker(sn.watchdog / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			sn.send("WATCHDOG=1")
+		}
+	}
+}
+
+// send sends the state to the notification socket. Failures are logged, since
+// systemd treats a service that does not notify it as failed. Does nothing
+// once the server has handed off to a new process.
+func (sn *SystemdNotifier) send(state string) {
+	sn.mux.Lock()
+	defer sn.mux.Unlock()
+	if sn.handedOff {
+		return
+	}
+
+	conn, err := net.DialUnix("unixgram", nil,
+		&net.UnixAddr{Name: sn.socket, Net: "unixgram"})
+	if err == nil {
+		_, err = conn.Write([]byte(state))
+		_ = conn.Close()
+	}
+	if err != nil {
+		jww.WARN.Printf("Failed to send %s to systemd: %+v", state, err)
+	}
+}
@@ -0,0 +1,232 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+//go:build !windows
+
+package server
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// Tests that systemdListeners returns a listener for the passed socket that
+// accepts connections on its address and unsets the environment variables.
+func Test_systemdListeners(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %+v", err)
+	}
+	defer l.Close()
+	f, err := l.(*net.TCPListener).File()
+	if err != nil {
+		t.Fatalf("Failed to get file: %+v", err)
+	}
+	defer f.Close()
+
+	t.Setenv(listenPIDEnv, strconv.Itoa(os.Getpid()))
+	t.Setenv(listenFDsEnv, "1")
+	t.Setenv(listenFDNamesEnv, "sync")
+	listeners, err := systemdListeners(dupFD(t, f))
+	if err != nil {
+		t.Fatalf("Failed to get listeners: %+v", err)
+	}
+	if len(listeners) != 1 {
+		t.Fatalf("Unexpected number of listeners.\nexpected: %d\nreceived: %d",
+			1, len(listeners))
+	}
+	defer listeners[0].Close()
+	if listeners[0].Addr().String() != l.Addr().String() {
+		t.Errorf("Unexpected address.\nexpected: %s\nreceived: %s",
+			l.Addr(), listeners[0].Addr())
+	}
+
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatalf("Failed to dial: %+v", err)
+	}
+	_ = conn.Close()
+
+	for _, env := range []string{listenPIDEnv, listenFDsEnv, listenFDNamesEnv} {
+		if _, set := os.LookupEnv(env); set {
+			t.Errorf("%s was not unset.", env)
+		}
+	}
+}
+
+// Tests that systemdListeners returns no listeners when the process was not
+// socket activated or the sockets are meant for another process.
+func Test_systemdListeners_NotActivated(t *testing.T) {
+	for _, pid := range []string{"", strconv.Itoa(os.Getpid() + 1)} {
+		t.Setenv(listenPIDEnv, pid)
+		t.Setenv(listenFDsEnv, "1")
+		listeners, err := systemdListeners(listenFDsStart)
+		if err != nil || len(listeners) != 0 {
+			t.Errorf("Unexpected listeners for PID %q: %v, %+v",
+				pid, listeners, err)
+		}
+	}
+}
+
+// Error path: Tests that systemdListeners returns an error when the file
+// descriptor is not a socket or the number of descriptors is invalid.
+func Test_systemdListeners_Error(t *testing.T) {
+	f, err := os.Create(filepath.Join(t.TempDir(), "file"))
+	if err != nil {
+		t.Fatalf("Failed to create file: %+v", err)
+	}
+	defer f.Close()
+
+	t.Setenv(listenPIDEnv, strconv.Itoa(os.Getpid()))
+	t.Setenv(listenFDsEnv, "1")
+	if _, err = systemdListeners(dupFD(t, f)); err == nil {
+		t.Errorf("Failed to get error for file that is not a socket.")
+	}
+
+	t.Setenv(listenPIDEnv, strconv.Itoa(os.Getpid()))
+	t.Setenv(listenFDsEnv, "many")
+	if _, err = systemdListeners(listenFDsStart); err == nil {
+		t.Errorf("Failed to get error for invalid %s.", listenFDsEnv)
+	}
+}
+
+// Tests that NewSystemdNotifier uses the notification socket and the watchdog
+// timeout passed by systemd, ignores a watchdog meant for another process,
+// and returns nil when systemd passed no socket.
+func TestNewSystemdNotifier(t *testing.T) {
+	pid := strconv.Itoa(os.Getpid())
+	tests := []struct {
+		socket, usec, pid string
+		expected          *SystemdNotifier
+	}{
+		{"", "", "", nil},
+		{"/run/notify", "", "", &SystemdNotifier{socket: "/run/notify"}},
+		{"@notify", "2000000", pid,
+			&SystemdNotifier{socket: "@notify", watchdog: 2 * time.Second}},
+		{"/run/notify", "500", "", &SystemdNotifier{
+			socket: "/run/notify", watchdog: 500 * time.Microsecond}},
+		{"/run/notify", "2000000", strconv.Itoa(os.Getpid() + 1),
+			&SystemdNotifier{socket: "/run/notify"}},
+	}
+	for i, tt := range tests {
+		t.Setenv(notifySocketEnv, tt.socket)
+		t.Setenv(watchdogUSecEnv, tt.usec)
+		t.Setenv(watchdogPIDEnv, tt.pid)
+		sn, err := NewSystemdNotifier()
+		if err != nil {
+			t.Errorf("Failed to create notifier %d: %+v", i, err)
+		} else if (sn == nil) != (tt.expected == nil) ||
+			(sn != nil && (sn.socket != tt.expected.socket ||
+				sn.watchdog != tt.expected.watchdog)) {
+			t.Errorf("Unexpected notifier %d.\nexpected: %+v\nreceived: %+v",
+				i, tt.expected, sn)
+		}
+		if _, set := os.LookupEnv(notifySocketEnv); !set && tt.socket != "" {
+			t.Errorf("%s was unset for notifier %d.", notifySocketEnv, i)
+		}
+		if _, set := os.LookupEnv(watchdogPIDEnv); set && tt.pid == pid {
+			t.Errorf("%s was not unset for notifier %d.", watchdogPIDEnv, i)
+		}
+	}
+}
+
+// Error path: Tests that NewSystemdNotifier returns an error for an invalid
+// watchdog timeout.
+func TestNewSystemdNotifier_Error(t *testing.T) {
+	for _, usec := range []string{"0", "-1", "2s"} {
+		t.Setenv(notifySocketEnv, "/run/notify")
+		t.Setenv(watchdogUSecEnv, usec)
+		t.Setenv(watchdogPIDEnv, "")
+		if _, err := NewSystemdNotifier(); err == nil {
+			t.Errorf("Failed to get error for %s %q.", watchdogUSecEnv, usec)
+		}
+	}
+}
+
+// newTestNotifySocket returns a SystemdNotifier that sends to a socket
+// listened on by the returned connection.
+func newTestNotifySocket(t *testing.T) (*SystemdNotifier, *net.UnixConn) {
+	socket := filepath.Join(t.TempDir(), "notify")
+	conn, err := net.ListenUnixgram(
+		"unixgram", &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		t.Fatalf("Failed to listen: %+v", err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+	return &SystemdNotifier{socket: socket}, conn
+}
+
+// checkNotification checks that the next notification received on the
+// connection is the state.
+func checkNotification(t *testing.T, conn *net.UnixConn, state string) {
+	t.Helper()
+	buf := make([]byte, 64)
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, err := conn.Read(buf)
+	if err != nil {
+		t.Fatalf("Failed to receive %q: %+v", state, err)
+	}
+	if string(buf[:n]) != state {
+		t.Errorf("Unexpected notification.\nexpected: %q\nreceived: %q",
+			state, buf[:n])
+	}
+}
+
+// Tests that SystemdNotifier sends the status of the server to the
+// notification socket and sends nothing after handing off.
+func TestSystemdNotifier(t *testing.T) {
+	sn, conn := newTestNotifySocket(t)
+
+	sn.ready()
+	checkNotification(t, conn, "READY=1")
+	sn.handOff(1234)
+	checkNotification(t, conn, "MAINPID=1234")
+
+	sn.stopping()
+	_ = conn.SetReadDeadline(time.Now().Add(50 * time.Millisecond))
+	if n, err := conn.Read(make([]byte, 64)); err == nil {
+		t.Errorf("Received notification after handing off: %d bytes", n)
+	}
+}
+
+// Tests that SystemdNotifier.pingWatchdog pings the watchdog until the stop
+// channel is closed.
+func TestSystemdNotifier_pingWatchdog(t *testing.T) {
+	sn, conn := newTestNotifySocket(t)
+	sn.watchdog = 20 * time.Millisecond
+
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		sn.pingWatchdog(stop)
+		close(done)
+	}()
+	checkNotification(t, conn, "WATCHDOG=1")
+	checkNotification(t, conn, "WATCHDOG=1")
+
+	close(stop)
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Error("Timed out waiting for pings to stop.")
+	}
+}
+
+// dupFD returns a duplicate of the file's descriptor, which systemdListeners
+// takes ownership of and closes like a descriptor passed by systemd.
+func dupFD(t testing.TB, f *os.File) int {
+	fd, err := syscall.Dup(int(f.Fd()))
+	if err != nil {
+		t.Fatalf("Failed to duplicate file descriptor: %+v", err)
+	}
+	return fd
+}
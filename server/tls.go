@@ -0,0 +1,120 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package server
+
+import (
+	"crypto/tls"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	jww "github.com/spf13/jwalterweatherman"
+)
+
+// defaultTLSMinVersion is the minimum TLS version accepted by the server's own
+// listener when none is configured.
+const defaultTLSMinVersion = tls.VersionTLS12
+
+// tlsVersions maps the supported configuration values to TLS versions.
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// TLSSettings restricts the TLS versions and cipher suites accepted by the
+// server.
+type TLSSettings struct {
+	// MinVersion is the minimum TLS version.
+	MinVersion uint16
+
+	// CipherSuites are the cipher suites allowed for TLS 1.0 to 1.2. TLS 1.3
+	// suites are not configurable. If empty, the Go defaults are used.
+	CipherSuites []uint16
+}
+
+// NewTLSSettings parses the minimum TLS version ("1.0", "1.1", "1.2", or
+// "1.3") and the names of the allowed cipher suites, as listed by
+// tls.CipherSuites. An empty version defaults to 1.2. Insecure cipher suites
+// are allowed but logged as a warning.
+func NewTLSSettings(
+	minVersion string, cipherSuites []string) (*TLSSettings, error) {
+	s := &TLSSettings{MinVersion: defaultTLSMinVersion}
+	if minVersion != "" {
+		version, exists := tlsVersions[minVersion]
+		if !exists {
+			return nil, errors.Errorf("unknown TLS version %q (available: "+
+				"%s)", minVersion, strings.Join(sortedKeys(tlsVersions), ", "))
+		}
+		s.MinVersion = version
+	}
+
+	secure := make(map[string]uint16)
+	for _, suite := range tls.CipherSuites() {
+		secure[suite.Name] = suite.ID
+	}
+	insecure := make(map[string]uint16)
+	for _, suite := range tls.InsecureCipherSuites() {
+		insecure[suite.Name] = suite.ID
+	}
+
+	for _, name := range cipherSuites {
+		if id, exists := secure[name]; exists {
+			s.CipherSuites = append(s.CipherSuites, id)
+		} else if id, exists = insecure[name]; exists {
+			jww.WARN.Printf("TLS cipher suite %s is insecure.", name)
+			s.CipherSuites = append(s.CipherSuites, id)
+		} else {
+			return nil, errors.Errorf("unknown TLS cipher suite %q "+
+				"(available: %s)", name, strings.Join(sortedKeys(secure), ", "))
+		}
+	}
+
+	if len(s.CipherSuites) > 0 {
+		if s.MinVersion == tls.VersionTLS13 {
+			jww.WARN.Printf("TLS cipher suites are ignored because the " +
+				"minimum TLS version is 1.3.")
+		} else if !hasHTTP2CipherSuite(s.CipherSuites) {
+			return nil, errors.Errorf("TLS cipher suites must include %s or "+
+				"%s, which are required by HTTP/2",
+				tls.CipherSuiteName(tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256),
+				tls.CipherSuiteName(tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256))
+		}
+	}
+
+	return s, nil
+}
+
+// apply sets the minimum version and cipher suites of the TLS config.
+func (s *TLSSettings) apply(conf *tls.Config) {
+	conf.MinVersion = s.MinVersion
+	conf.CipherSuites = s.CipherSuites
+}
+
+// hasHTTP2CipherSuite returns true if the cipher suites include one that HTTP/2
+// requires for TLS 1.2, without which gRPC connections cannot be served.
+func hasHTTP2CipherSuite(cipherSuites []uint16) bool {
+	for _, id := range cipherSuites {
+		if id == tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256 ||
+			id == tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256 {
+			return true
+		}
+	}
+	return false
+}
+
+// sortedKeys returns the keys of the map in sorted order.
+func sortedKeys(m map[string]uint16) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
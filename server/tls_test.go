@@ -0,0 +1,87 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package server
+
+import (
+	"crypto/tls"
+	"reflect"
+	"testing"
+)
+
+// Tests that NewTLSSettings parses the minimum version and cipher suites and
+// that apply sets them on the TLS config.
+func TestNewTLSSettings(t *testing.T) {
+	tests := []struct {
+		minVersion   string
+		cipherSuites []string
+		expected     TLSSettings
+	}{
+		{"", nil, TLSSettings{MinVersion: tls.VersionTLS12}},
+		{"1.3", nil, TLSSettings{MinVersion: tls.VersionTLS13}},
+		{"1.2", []string{
+			"TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256",
+			"TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305_SHA256",
+		}, TLSSettings{
+			MinVersion: tls.VersionTLS12,
+			CipherSuites: []uint16{
+				tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+				tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305_SHA256,
+			},
+		}},
+		{"1.0", []string{
+			"TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256",
+			"TLS_RSA_WITH_AES_128_CBC_SHA256",
+		}, TLSSettings{
+			MinVersion: tls.VersionTLS10,
+			CipherSuites: []uint16{
+				tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+				tls.TLS_RSA_WITH_AES_128_CBC_SHA256,
+			},
+		}},
+	}
+
+	for i, tt := range tests {
+		s, err := NewTLSSettings(tt.minVersion, tt.cipherSuites)
+		if err != nil {
+			t.Errorf("Failed to create TLSSettings (%d): %+v", i, err)
+			continue
+		}
+		if !reflect.DeepEqual(tt.expected, *s) {
+			t.Errorf("Unexpected TLSSettings (%d).\nexpected: %+v"+
+				"\nreceived: %+v", i, tt.expected, *s)
+		}
+
+		conf := &tls.Config{}
+		s.apply(conf)
+		if conf.MinVersion != s.MinVersion ||
+			!reflect.DeepEqual(conf.CipherSuites, s.CipherSuites) {
+			t.Errorf("TLS config not updated (%d): %+v", i, conf)
+		}
+	}
+}
+
+// Error path: Tests that NewTLSSettings returns an error for unknown versions
+// and cipher suites and for cipher suites that HTTP/2 cannot use.
+func TestNewTLSSettings_Error(t *testing.T) {
+	tests := []struct {
+		minVersion   string
+		cipherSuites []string
+	}{
+		{"1.4", nil},
+		{"TLS1.2", nil},
+		{"1.2", []string{"TLS_FAKE_WITH_NOTHING"}},
+		{"1.2", []string{"TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305_SHA256"}},
+	}
+
+	for i, tt := range tests {
+		if _, err := NewTLSSettings(tt.minVersion, tt.cipherSuites); err == nil {
+			t.Errorf("Failed to get error for %q and %v (%d).",
+				tt.minVersion, tt.cipherSuites, i)
+		}
+	}
+}
@@ -0,0 +1,203 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package server
+
+import (
+	"context"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	jww "github.com/spf13/jwalterweatherman"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+
+	"gitlab.com/elixxir/remoteSyncServer/store"
+)
+
+// OTLP protocols that traces can be exported with.
+const (
+	TracingProtocolGRPC = "grpc"
+	TracingProtocolHTTP = "http"
+)
+
+// Default tracing parameters.
+const (
+	defaultTracingProtocol    = TracingProtocolGRPC
+	defaultTracingServiceName = "remoteSyncServer"
+	defaultTracingSampleRatio = 1.0
+)
+
+// tracingShutdownTimeout is the maximum time taken to export the remaining
+// spans when the server stops.
+const tracingShutdownTimeout = 5 * time.Second
+
+// tracerName is the name of the tracer of the storage spans.
+const tracerName = "gitlab.com/elixxir/remoteSyncServer"
+
+// TracingParams are the parameters of the OpenTelemetry tracing of RPCs and
+// storage operations.
+type TracingParams struct {
+	// Endpoint is the host and port of the OTLP collector, such as
+	// "localhost:4317". Required.
+	Endpoint string `mapstructure:"endpoint"`
+
+	// Protocol is the OTLP protocol used to export spans: "grpc" or "http".
+	// Defaults to "grpc".
+	Protocol string `mapstructure:"protocol"`
+
+	// Insecure disables TLS to the collector.
+	Insecure bool `mapstructure:"insecure"`
+
+	// Headers are sent with every export, such as to authenticate with the
+	// collector.
+	Headers map[string]string `mapstructure:"headers"`
+
+	// ServiceName is the service.name of the spans. Defaults to
+	// "remoteSyncServer".
+	ServiceName string `mapstructure:"serviceName"`
+
+	// SampleRatio is the fraction of requests traced, from 0 to 1, unless the
+	// client's trace is sampled. Defaults to 1.
+	SampleRatio float64 `mapstructure:"sampleRatio"`
+}
+
+// Tracing records OpenTelemetry spans of each RPC and of the storage
+// operations done for it and exports them to an OTLP collector. The trace
+// context of requests is propagated from the W3C traceparent header, so that
+// the spans join the client's trace.
+type Tracing struct {
+	params     TracingParams
+	provider   *sdktrace.TracerProvider
+	propagator propagation.TextMapPropagator
+	tracer     trace.Tracer
+}
+
+// NewTracing creates a new Tracing from the parameters that exports spans
+// labelled with the server version. Spans are exported in the background.
+func NewTracing(
+	params map[string]interface{}, version string) (*Tracing, error) {
+	p := TracingParams{
+		Protocol:    defaultTracingProtocol,
+		ServiceName: defaultTracingServiceName,
+		SampleRatio: defaultTracingSampleRatio,
+	}
+	err := decodeParams(params, &p, "tracing")
+	if err != nil {
+		return nil, err
+	}
+	p.Protocol = strings.ToLower(p.Protocol)
+	if p.Endpoint == "" {
+		return nil, errors.New("tracing endpoint is required")
+	} else if _, _, err = net.SplitHostPort(p.Endpoint); err != nil {
+		return nil, errors.Wrapf(err, "invalid tracing endpoint %q", p.Endpoint)
+	} else if p.Protocol != TracingProtocolGRPC &&
+		p.Protocol != TracingProtocolHTTP {
+		return nil, errors.Errorf("unknown tracing protocol %q (available: "+
+			"%s, %s)", p.Protocol, TracingProtocolGRPC, TracingProtocolHTTP)
+	} else if p.SampleRatio < 0 || p.SampleRatio > 1 {
+		return nil, errors.Errorf(
+			"sample ratio %g must be between 0 and 1", p.SampleRatio)
+	}
+
+	exporter, err := newTraceExporter(p)
+	if err != nil {
+		return nil, err
+	}
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(
+		semconv.SchemaURL,
+		semconv.ServiceName(p.ServiceName),
+		semconv.ServiceVersion(version),
+	))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create tracing resource")
+	}
+
+	// Log export errors, such as an unavailable collector, instead of writing
+	// them to stderr
+	otel.SetErrorHandler(otel.ErrorHandlerFunc(func(err error) {
+		jww.WARN.Printf("Failed to export spans: %+v", err)
+	}))
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(
+			sdktrace.TraceIDRatioBased(p.SampleRatio))),
+	)
+	return &Tracing{
+		params:     p,
+		provider:   provider,
+		propagator: propagation.TraceContext{},
+		tracer:     provider.Tracer(tracerName),
+	}, nil
+}
+
+// newTraceExporter returns the OTLP exporter of the protocol. It connects to
+// the collector lazily, so that the server starts while it is unavailable.
+func newTraceExporter(p TracingParams) (*otlptrace.Exporter, error) {
+	var client otlptrace.Client
+	if p.Protocol == TracingProtocolHTTP {
+		opts := []otlptracehttp.Option{
+			otlptracehttp.WithEndpoint(p.Endpoint),
+			otlptracehttp.WithHeaders(p.Headers),
+		}
+		if p.Insecure {
+			opts = append(opts, otlptracehttp.WithInsecure())
+		}
+		client = otlptracehttp.NewClient(opts...)
+	} else {
+		opts := []otlptracegrpc.Option{
+			otlptracegrpc.WithEndpoint(p.Endpoint),
+			otlptracegrpc.WithHeaders(p.Headers),
+		}
+		if p.Insecure {
+			opts = append(opts, otlptracegrpc.WithInsecure())
+		}
+		client = otlptracegrpc.NewClient(opts...)
+	}
+
+	exporter, err := otlptrace.New(context.Background(), client)
+	if err != nil {
+		return nil, errors.Wrapf(
+			err, "failed to create OTLP exporter for %s", p.Endpoint)
+	}
+	return exporter, nil
+}
+
+// interceptor returns an interceptor that records a span for each RPC.
+func (t *Tracing) interceptor() grpc.UnaryServerInterceptor {
+	return otelgrpc.UnaryServerInterceptor(
+		otelgrpc.WithTracerProvider(t.provider),
+		otelgrpc.WithPropagators(t.propagator))
+}
+
+// traceStore returns the store traced as part of the RPC with the context.
+func (t *Tracing) traceStore(ctx context.Context, s store.Store) store.Store {
+	return store.NewTracedStore(ctx, s, t.tracer)
+}
+
+// stop exports the remaining spans and stops the exporter.
+func (t *Tracing) stop() {
+	ctx, cancel := context.WithTimeout(
+		context.Background(), tracingShutdownTimeout)
+	defer cancel()
+	if err := t.provider.Shutdown(ctx); err != nil {
+		jww.WARN.Printf("Failed to export remaining spans: %+v", err)
+	}
+}
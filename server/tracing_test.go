@@ -0,0 +1,144 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package server
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+
+	pb "gitlab.com/elixxir/comms/mixmessages"
+	"gitlab.com/elixxir/remoteSyncServer/credentials"
+	"gitlab.com/elixxir/remoteSyncServer/store"
+)
+
+// Tests that NewTracing applies the defaults to unset parameters for both
+// protocols.
+func TestNewTracing(t *testing.T) {
+	tr, err := NewTracing(
+		map[string]interface{}{"endpoint": "localhost:4317"}, "1.2.3")
+	if err != nil {
+		t.Fatalf("Failed to create Tracing: %+v", err)
+	}
+	defer tr.stop()
+	expected := TracingParams{
+		Endpoint:    "localhost:4317",
+		Protocol:    TracingProtocolGRPC,
+		ServiceName: defaultTracingServiceName,
+		SampleRatio: defaultTracingSampleRatio,
+	}
+	if !reflect.DeepEqual(expected, tr.params) {
+		t.Errorf("Unexpected parameters.\nexpected: %+v\nreceived: %+v",
+			expected, tr.params)
+	}
+
+	tr, err = NewTracing(map[string]interface{}{
+		"endpoint":    "collector:4318",
+		"protocol":    "HTTP",
+		"insecure":    true,
+		"headers":     map[string]interface{}{"authorization": "Bearer key"},
+		"serviceName": "sync",
+		"sampleRatio": "0.25",
+	}, "1.2.3")
+	if err != nil {
+		t.Fatalf("Failed to create Tracing: %+v", err)
+	}
+	defer tr.stop()
+	expected = TracingParams{
+		Endpoint:    "collector:4318",
+		Protocol:    TracingProtocolHTTP,
+		Insecure:    true,
+		Headers:     map[string]string{"authorization": "Bearer key"},
+		ServiceName: "sync",
+		SampleRatio: 0.25,
+	}
+	if !reflect.DeepEqual(expected, tr.params) {
+		t.Errorf("Unexpected parameters.\nexpected: %+v\nreceived: %+v",
+			expected, tr.params)
+	}
+}
+
+// Error path: Tests that NewTracing returns an error for invalid parameters.
+func TestNewTracing_Error(t *testing.T) {
+	tests := map[string]map[string]interface{}{
+		"no endpoint":      {},
+		"invalid endpoint": {"endpoint": "localhost"},
+		"unknown protocol": {"endpoint": ":4317", "protocol": "zipkin"},
+		"negative ratio":   {"endpoint": ":4317", "sampleRatio": -0.5},
+		"ratio above one":  {"endpoint": ":4317", "sampleRatio": 2},
+		"unknown key":      {"endpoint": ":4317", "url": "http://collector"},
+	}
+	for name, params := range tests {
+		if _, err := NewTracing(params, "1.2.3"); err == nil {
+			t.Errorf("Failed to get error for %s.", name)
+		}
+	}
+}
+
+// Tests that an RPC traced by Tracing.interceptor joins the trace of the
+// client's traceparent header and that the storage operations of the handler
+// are recorded as its children.
+func TestTracing_interceptor(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	tr := &Tracing{
+		provider:   provider,
+		propagator: propagation.TraceContext{},
+		tracer:     provider.Tracer(tracerName),
+	}
+	h := newHandler("", time.Hour, credentials.NewMemStore(
+		map[string]string{"waldo": "hunter2"}), nil, store.NewMemStore)
+	h.tracing = tr
+	session, err := h.addSession("waldo")
+	if err != nil {
+		t.Fatalf("Failed to add session: %+v", err)
+	}
+	token := Token(session.Value)
+
+	const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(
+		"traceparent", "00-"+traceID+"-00f067aa0ba902b7-01"))
+	info := &grpc.UnaryServerInfo{FullMethod: "/mixmessages.RemoteSync/Write"}
+	_, err = tr.interceptor()(ctx,
+		&pb.RsWriteRequest{Path: "file", Data: []byte("data"),
+			Token: token.Marshal()}, info,
+		func(ctx context.Context, req interface{}) (interface{}, error) {
+			return h.Write(ctx, req.(*pb.RsWriteRequest))
+		})
+	if err != nil {
+		t.Fatalf("Failed to write: %+v", err)
+	}
+
+	spans := recorder.Ended()
+	if len(spans) != 2 {
+		t.Fatalf("Unexpected number of spans.\nexpected: %d\nreceived: %d",
+			2, len(spans))
+	}
+	storeSpan, rpcSpan := spans[0], spans[1]
+	if rpcSpan.Name() != "mixmessages.RemoteSync/Write" {
+		t.Errorf("Unexpected RPC span name: %s", rpcSpan.Name())
+	}
+	if rpcSpan.SpanContext().TraceID().String() != traceID {
+		t.Errorf("RPC span did not join the client's trace."+
+			"\nexpected: %s\nreceived: %s",
+			traceID, rpcSpan.SpanContext().TraceID())
+	}
+	if storeSpan.Name() != "store.Write" {
+		t.Errorf("Unexpected storage span name: %s", storeSpan.Name())
+	}
+	if storeSpan.Parent().SpanID() != rpcSpan.SpanContext().SpanID() {
+		t.Errorf("Storage span is not a child of the RPC span.")
+	}
+}
@@ -0,0 +1,149 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package server
+
+import (
+	"os"
+	"sync"
+
+	"github.com/pkg/errors"
+	jww "github.com/spf13/jwalterweatherman"
+
+	"gitlab.com/elixxir/remoteSyncServer/store"
+)
+
+// maxTransactionOps is the largest number of operations in a transaction, so
+// that a transaction does not hold the writes of its user for long.
+const maxTransactionOps = 1000
+
+var (
+	// InvalidTransactionErr is returned for a transaction without operations
+	// or with more than the maximum number of operations.
+	InvalidTransactionErr = errors.New("invalid transaction")
+
+	// RollbackErr is returned when an operation of a transaction fails and
+	// the files changed by the operations before it cannot all be restored,
+	// leaving the transaction partly applied.
+	RollbackErr = errors.New("failed to roll back transaction")
+)
+
+// TransactionOp is an operation of a transaction: writing Data to the file at
+// Path, or deleting the file if Delete is true.
+type TransactionOp struct {
+	Path   string
+	Data   []byte
+	Delete bool
+}
+
+// applyTransaction applies the operations to the store in order. If an
+// operation fails, the files changed by the operations before it are restored
+// to their data from before the transaction, or deleted if they did not exist,
+// and the error of the operation is returned. Returns [RollbackErr] if they
+// cannot all be restored.
+//
+// The caller must hold the write lock of the user, so that no other write
+// changes the files while the transaction is applied.
+func applyTransaction(s store.Store, ops []TransactionOp) error {
+	if len(ops) == 0 || len(ops) > maxTransactionOps {
+		return errors.Wrapf(InvalidTransactionErr,
+			"%d operations must be 1 to %d", len(ops), maxTransactionOps)
+	}
+
+	// The data of each file is saved before it is first changed, so that it
+	// can be restored
+	type saved struct {
+		path   string
+		data   []byte
+		exists bool
+	}
+	var undo []saved
+	changed := make(map[string]bool, len(ops))
+
+	for i, op := range ops {
+		var err error
+		if !changed[op.Path] {
+			data, readErr := s.Read(op.Path)
+			if readErr != nil && !errors.Is(readErr, os.ErrNotExist) {
+				err = readErr
+			} else {
+				undo = append(undo, saved{op.Path, data, readErr == nil})
+				changed[op.Path] = true
+			}
+		}
+		if err == nil && op.Delete {
+			err = s.Delete(op.Path)
+		} else if err == nil {
+			err = s.Write(op.Path, op.Data)
+		}
+		if err == nil {
+			continue
+		}
+
+		// Restore the files in the reverse order they were changed
+		err = errors.WithMessagef(err, "operation %d on %q", i, op.Path)
+		var failed int
+		for j := len(undo) - 1; j >= 0; j-- {
+			var restoreErr error
+			if undo[j].exists {
+				restoreErr = s.Write(undo[j].path, undo[j].data)
+			} else if restoreErr = s.Delete(undo[j].path); errors.Is(
+				restoreErr, os.ErrNotExist) {
+				restoreErr = nil
+			}
+			if restoreErr != nil {
+				jww.ERROR.Printf("Failed to restore %q after failed "+
+					"transaction: %+v", undo[j].path, restoreErr)
+				failed++
+			}
+		}
+		if failed > 0 {
+			return errors.Wrapf(RollbackErr, "%d files not restored after %v",
+				failed, err)
+		}
+		return err
+	}
+
+	return nil
+}
+
+// applyOps applies the operations to the store: with its commit if it is a
+// committer, a single operation directly, or several as a transaction with
+// applyTransaction. Used to apply the writes of other servers.
+func applyOps(s store.Store, ops []TransactionOp) error {
+	if c, ok := s.(committer); ok {
+		return c.commit(ops)
+	} else if len(ops) != 1 {
+		return applyTransaction(s, ops)
+	} else if ops[0].Delete {
+		return s.Delete(ops[0].Path)
+	}
+	return s.Write(ops[0].Path, ops[0].Data)
+}
+
+// userLocks holds a lock for each user, so that transactions are applied
+// while no other write of their user is.
+type userLocks struct {
+	locks map[string]*sync.RWMutex
+	mux   sync.Mutex
+}
+
+// get returns the lock of the user. Writes hold it for reading and
+// transactions for writing.
+func (ul *userLocks) get(username string) *sync.RWMutex {
+	ul.mux.Lock()
+	defer ul.mux.Unlock()
+	if ul.locks == nil {
+		ul.locks = make(map[string]*sync.RWMutex)
+	}
+	l, exists := ul.locks[username]
+	if !exists {
+		l = &sync.RWMutex{}
+		ul.locks[username] = l
+	}
+	return l
+}
@@ -0,0 +1,139 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package server
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"testing"
+
+	"gitlab.com/elixxir/remoteSyncServer/store"
+)
+
+// newTransactionTestStore returns a store with the files.
+func newTransactionTestStore(
+	files map[string]string, t *testing.T) store.Store {
+	s, err := store.NewMemStore("", "waldo")
+	if err != nil {
+		t.Fatalf("Failed to create store: %+v", err)
+	}
+	for path, data := range files {
+		if err = s.Write(path, []byte(data)); err != nil {
+			t.Fatalf("Failed to write %s: %+v", path, err)
+		}
+	}
+	return s
+}
+
+// checkFiles checks that the files have the data, or do not exist if it is
+// nil.
+func checkFiles(s store.Store, files map[string][]byte, t *testing.T) {
+	for path, expected := range files {
+		data, err := s.Read(path)
+		if expected == nil {
+			if err == nil {
+				t.Errorf("File %s exists with data %q.", path, data)
+			}
+		} else if err != nil {
+			t.Errorf("Failed to read %s: %+v", path, err)
+		} else if !bytes.Equal(data, expected) {
+			t.Errorf("Unexpected data of %s.\nexpected: %q\nreceived: %q",
+				path, expected, data)
+		}
+	}
+}
+
+// Tests that applyTransaction applies all of the operations in order.
+func Test_applyTransaction(t *testing.T) {
+	s := newTransactionTestStore(
+		map[string]string{"a": "old a", "b": "old b"}, t)
+	err := applyTransaction(s, []TransactionOp{
+		{Path: "a", Data: []byte("new a")},
+		{Path: "b", Delete: true},
+		{Path: "c", Data: []byte("first c")},
+		{Path: "c", Data: []byte("new c")},
+	})
+	if err != nil {
+		t.Fatalf("Failed to apply transaction: %+v", err)
+	}
+
+	checkFiles(s, map[string][]byte{
+		"a": []byte("new a"), "b": nil, "c": []byte("new c")}, t)
+}
+
+// Error path: Tests that when an operation fails, applyTransaction returns its
+// error and restores the files changed by the operations before it.
+func Test_applyTransaction_RolledBack(t *testing.T) {
+	s := newTransactionTestStore(
+		map[string]string{"a": "old a", "b": "old b", "e": ""}, t)
+	err := applyTransaction(s, []TransactionOp{
+		{Path: "a", Data: []byte("new a")},
+		{Path: "b", Delete: true},
+		{Path: "c", Data: []byte("new c")},
+		{Path: "e", Data: []byte("new e")},
+		{Path: "a", Data: []byte("newer a")},
+		{Path: "missing", Delete: true},
+	})
+	if !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Unexpected error.\nexpected: %v\nreceived: %+v",
+			os.ErrNotExist, err)
+	}
+
+	checkFiles(s, map[string][]byte{"a": []byte("old a"),
+		"b": []byte("old b"), "c": nil, "e": {}}, t)
+}
+
+// Error path: Tests that applyTransaction returns RollbackErr when the files
+// changed before the failed operation cannot be restored.
+func Test_applyTransaction_RollbackError(t *testing.T) {
+	s := &failingStore{
+		Store: newTransactionTestStore(map[string]string{"a": "old a"}, t),
+		fail:  map[string]bool{"a": true, "b": true},
+	}
+	err := applyTransaction(s, []TransactionOp{
+		{Path: "a", Delete: true},
+		{Path: "b", Data: []byte("new b")},
+	})
+	if !errors.Is(err, RollbackErr) {
+		t.Errorf("Unexpected error.\nexpected: %v\nreceived: %+v",
+			RollbackErr, err)
+	}
+}
+
+// Error path: Tests that applyTransaction returns InvalidTransactionErr for
+// transactions without operations or with too many.
+func Test_applyTransaction_InvalidTransactionError(t *testing.T) {
+	s := newTransactionTestStore(nil, t)
+	for _, n := range []int{0, maxTransactionOps + 1} {
+		ops := make([]TransactionOp, n)
+		for i := range ops {
+			ops[i] = TransactionOp{Path: "a", Data: []byte("a")}
+		}
+		err := applyTransaction(s, ops)
+		if !errors.Is(err, InvalidTransactionErr) {
+			t.Errorf("Unexpected error for %d operations."+
+				"\nexpected: %v\nreceived: %+v", n, InvalidTransactionErr, err)
+		}
+	}
+	checkFiles(s, map[string][]byte{"a": nil}, t)
+}
+
+// failingStore is a store that fails to write the files at the paths in fail.
+type failingStore struct {
+	store.Store
+	fail map[string]bool
+}
+
+// Write fails for the files at the paths in fail.
+func (fs *failingStore) Write(path string, data []byte) error {
+	if fs.fail[path] {
+		return errors.New("write failed")
+	}
+	return fs.Store.Write(path, data)
+}
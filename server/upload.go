@@ -0,0 +1,392 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package server
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	jww "github.com/spf13/jwalterweatherman"
+)
+
+// Default values for UploadParams.
+const (
+	defaultUploadChunkSize  = 1 << 20
+	defaultUploadMaxSize    = 64 << 20
+	defaultUploadMaxPerUser = 4
+	defaultUploadMaxTotal   = 512 << 20
+	defaultUploadTTL        = time.Hour
+)
+
+// uploadIDLen is the number of random bytes in an upload ID.
+const uploadIDLen = 16
+
+var (
+	// UploadsDisabledErr is returned by the Upload service while resumable
+	// uploads are not enabled.
+	UploadsDisabledErr = errors.New("resumable uploads are not enabled")
+
+	// UnknownUploadErr is returned for an upload ID that does not exist, has
+	// expired, or belongs to another user.
+	UnknownUploadErr = errors.New("unknown or expired upload")
+
+	// UploadLimitErr is returned when starting an upload while the user has
+	// the maximum number of unfinished uploads or the unfinished uploads of
+	// all users would exceed their total size.
+	UploadLimitErr = errors.New("too many unfinished uploads")
+
+	// UploadSizeErr is returned when the size of an upload or a chunk exceeds
+	// its limit.
+	UploadSizeErr = errors.New("upload too large")
+
+	// UploadOffsetErr is returned when the offset of a chunk is not the number
+	// of bytes of the upload received so far.
+	UploadOffsetErr = errors.New("chunk offset does not match upload")
+
+	// UploadIncompleteErr is returned when finishing an upload before all of
+	// its data was received.
+	UploadIncompleteErr = errors.New("upload is incomplete")
+
+	// UploadHashErr is returned when the data of an upload does not match the
+	// SHA-256 hash it was started with.
+	UploadHashErr = errors.New("upload data does not match its hash")
+)
+
+// UploadParams are the parameters of resumable uploads.
+type UploadParams struct {
+	// ChunkSize is the maximum size of each chunk in bytes. Defaults to 1 MiB.
+	ChunkSize int64 `mapstructure:"chunkSize"`
+
+	// MaxSize is the maximum size of an uploaded file in bytes. Defaults to
+	// 64 MiB.
+	MaxSize int64 `mapstructure:"maxSize"`
+
+	// MaxPerUser is the maximum number of unfinished uploads of each user.
+	// Defaults to 4.
+	MaxPerUser int `mapstructure:"maxPerUser"`
+
+	// MaxTotal is the maximum total size in bytes of the unfinished uploads
+	// of all users, which are held in memory. Defaults to 512 MiB.
+	MaxTotal int64 `mapstructure:"maxTotal"`
+
+	// TTL is how long an upload is kept after it was started or last received
+	// a chunk. Defaults to 1h.
+	TTL time.Duration `mapstructure:"ttl"`
+}
+
+// UploadStatus describes an unfinished upload.
+type UploadStatus struct {
+	Path     string
+	Size     int64
+	Received int64
+	Expires  time.Time
+}
+
+// Uploads holds the unfinished resumable uploads of all users in memory, so
+// that a large file can be uploaded in chunks and the upload resumed after the
+// connection is lost. Uploads belong to a user rather than a session, so they
+// survive logging in again, and are removed once they expire.
+type Uploads struct {
+	params  UploadParams
+	uploads map[string]*upload
+
+	// total is the sum of the sizes of all uploads, which is reserved when
+	// they are started so that their data fits within MaxTotal.
+	total int64
+	mux   sync.Mutex
+}
+
+// upload is an unfinished upload of a file.
+type upload struct {
+	username string
+	path     string
+	size     int64
+	sha256   []byte
+	data     []byte
+	expires  time.Time
+}
+
+// NewUploads creates a new Uploads from the parameters. Returns an error if a
+// limit is not positive.
+func NewUploads(params map[string]interface{}) (*Uploads, error) {
+	p := UploadParams{
+		ChunkSize:  defaultUploadChunkSize,
+		MaxSize:    defaultUploadMaxSize,
+		MaxPerUser: defaultUploadMaxPerUser,
+		MaxTotal:   defaultUploadMaxTotal,
+		TTL:        defaultUploadTTL,
+	}
+	if err := decodeParams(params, &p, "upload"); err != nil {
+		return nil, err
+	}
+
+	if p.ChunkSize <= 0 {
+		return nil, errors.Errorf(
+			"upload chunkSize %d must be positive", p.ChunkSize)
+	} else if p.MaxSize <= 0 {
+		return nil, errors.Errorf(
+			"upload maxSize %d must be positive", p.MaxSize)
+	} else if p.MaxPerUser <= 0 {
+		return nil, errors.Errorf(
+			"upload maxPerUser %d must be positive", p.MaxPerUser)
+	} else if p.MaxTotal < p.MaxSize {
+		return nil, errors.Errorf("upload maxTotal %d must be at least "+
+			"maxSize %d", p.MaxTotal, p.MaxSize)
+	} else if p.TTL <= 0 {
+		return nil, errors.Errorf("upload ttl %s must be positive", p.TTL)
+	}
+
+	return &Uploads{params: p, uploads: make(map[string]*upload)}, nil
+}
+
+// Params returns the parameters of the uploads.
+func (u *Uploads) Params() UploadParams {
+	return u.params
+}
+
+// Start starts an upload by the user of a file of the size to the path and
+// returns its ID. If hash is not empty, it is the SHA-256 hash the data must
+// match when the upload is finished.
+//
+// Returns [UploadSizeErr] if the size exceeds the maximum and
+// [UploadLimitErr] if the user has the maximum number of unfinished uploads or
+// there is not enough of the total size left for the upload.
+func (u *Uploads) Start(
+	username, path string, size int64, hash []byte) (string, error) {
+	if size < 0 || size > u.params.MaxSize {
+		return "", errors.Wrapf(UploadSizeErr,
+			"size %d must be 0 to %d bytes", size, u.params.MaxSize)
+	} else if len(hash) != 0 && len(hash) != sha256.Size {
+		return "", errors.Errorf(
+			"SHA-256 hash must be %d bytes, not %d", sha256.Size, len(hash))
+	}
+
+	b := make([]byte, uploadIDLen)
+	if _, err := rand.Read(b); err != nil {
+		return "", errors.Wrap(err, "failed to generate upload ID")
+	}
+	id := base64.RawURLEncoding.EncodeToString(b)
+
+	u.mux.Lock()
+	defer u.mux.Unlock()
+
+	now := time.Now()
+	u.removeExpiredLocked(now)
+
+	var n int
+	for _, up := range u.uploads {
+		if up.username == username {
+			n++
+		}
+	}
+	if n >= u.params.MaxPerUser {
+		return "", errors.Wrapf(
+			UploadLimitErr, "user has %d unfinished uploads", n)
+	} else if u.total+size > u.params.MaxTotal {
+		return "", errors.Wrapf(UploadLimitErr, "unfinished uploads of all "+
+			"users have %d of %d bytes", u.total, u.params.MaxTotal)
+	}
+
+	u.total += size
+	u.uploads[id] = &upload{
+		username: username,
+		path:     path,
+		size:     size,
+		sha256:   hash,
+		expires:  now.Add(u.params.TTL),
+	}
+	jww.DEBUG.Printf("Started upload %s of %d bytes to %q by %q.",
+		id, size, path, username)
+
+	return id, nil
+}
+
+// Append adds the chunk of data at the offset to the user's upload with the ID
+// and extends its expiry. Returns the number of bytes received so far.
+//
+// Returns [UnknownUploadErr] if the user has no upload with the ID,
+// [UploadOffsetErr] if the offset is not the number of bytes received, and
+// [UploadSizeErr] if the chunk is larger than the chunk size or the rest of
+// the file.
+func (u *Uploads) Append(
+	username, id string, offset int64, data []byte) (int64, error) {
+	if int64(len(data)) > u.params.ChunkSize {
+		return 0, errors.Wrapf(UploadSizeErr, "chunk of %d bytes exceeds "+
+			"chunk size of %d", len(data), u.params.ChunkSize)
+	}
+
+	u.mux.Lock()
+	defer u.mux.Unlock()
+
+	up, err := u.get(username, id)
+	if err != nil {
+		return 0, err
+	}
+
+	received := int64(len(up.data))
+	if offset != received {
+		return received, errors.Wrapf(UploadOffsetErr,
+			"offset %d, received %d bytes", offset, received)
+	} else if received+int64(len(data)) > up.size {
+		return received, errors.Wrapf(UploadSizeErr, "chunk of %d bytes at "+
+			"offset %d exceeds size of %d", len(data), offset, up.size)
+	}
+
+	if need := received + int64(len(data)); need > int64(cap(up.data)) {
+		// Grow the buffer at most to the size of the upload, so that it never
+		// holds more than was reserved for it.
+		newCap := 2 * int64(cap(up.data))
+		if newCap < need {
+			newCap = need
+		} else if newCap > up.size {
+			newCap = up.size
+		}
+		up.data = append(make([]byte, 0, newCap), up.data...)
+	}
+	up.data = append(up.data, data...)
+	up.expires = time.Now().Add(u.params.TTL)
+
+	return int64(len(up.data)), nil
+}
+
+// Status returns the status of the user's upload with the ID. Returns
+// [UnknownUploadErr] if the user has no upload with the ID.
+func (u *Uploads) Status(username, id string) (UploadStatus, error) {
+	u.mux.Lock()
+	defer u.mux.Unlock()
+
+	up, err := u.get(username, id)
+	if err != nil {
+		return UploadStatus{}, err
+	}
+
+	return UploadStatus{
+		Path:     up.path,
+		Size:     up.size,
+		Received: int64(len(up.data)),
+		Expires:  up.expires,
+	}, nil
+}
+
+// complete returns the path and data of the user's upload with the ID once
+// all of its data was received. The upload is kept until it is removed, so
+// that finishing it can be retried if the file cannot be written.
+//
+// Returns [UnknownUploadErr] if the user has no upload with the ID,
+// [UploadIncompleteErr] if not all data was received, and [UploadHashErr] if
+// the data does not match the hash, in which case the upload is removed.
+func (u *Uploads) complete(username, id string) (string, []byte, error) {
+	u.mux.Lock()
+	defer u.mux.Unlock()
+
+	up, err := u.get(username, id)
+	if err != nil {
+		return "", nil, err
+	}
+
+	if int64(len(up.data)) < up.size {
+		return "", nil, errors.Wrapf(UploadIncompleteErr,
+			"received %d of %d bytes", len(up.data), up.size)
+	}
+	if len(up.sha256) != 0 {
+		hash := sha256.Sum256(up.data)
+		if !bytes.Equal(hash[:], up.sha256) {
+			u.delete(id)
+			return "", nil, errors.Wrapf(UploadHashErr, "SHA-256 hash %x, "+
+				"expected %x", hash, up.sha256)
+		}
+	}
+
+	return up.path, up.data, nil
+}
+
+// remove removes the upload with the ID once its file was written.
+func (u *Uploads) remove(id string) {
+	u.mux.Lock()
+	defer u.mux.Unlock()
+	u.delete(id)
+}
+
+// Cancel removes the user's upload with the ID. Returns [UnknownUploadErr] if
+// the user has no upload with the ID.
+func (u *Uploads) Cancel(username, id string) error {
+	u.mux.Lock()
+	defer u.mux.Unlock()
+
+	if _, err := u.get(username, id); err != nil {
+		return err
+	}
+	u.delete(id)
+
+	return nil
+}
+
+// get returns the user's upload with the ID. Returns [UnknownUploadErr] if the
+// upload does not exist, has expired, or belongs to another user. Must be
+// called while the lock is held.
+func (u *Uploads) get(username, id string) (*upload, error) {
+	up, exists := u.uploads[id]
+	if !exists || up.username != username || !time.Now().Before(up.expires) {
+		return nil, UnknownUploadErr
+	}
+	return up, nil
+}
+
+// delete removes the upload with the ID, if it exists, and releases its size.
+// Must be called while the lock is held.
+func (u *Uploads) delete(id string) {
+	if up, exists := u.uploads[id]; exists {
+		u.total -= up.size
+		delete(u.uploads, id)
+	}
+}
+
+// removeExpired removes all uploads that expired before now. Returns the
+// number of uploads removed.
+func (u *Uploads) removeExpired(now time.Time) int {
+	u.mux.Lock()
+	defer u.mux.Unlock()
+	return u.removeExpiredLocked(now)
+}
+
+// removeExpiredLocked removes all uploads that expired before now and returns
+// the number removed. Must be called while the lock is held.
+func (u *Uploads) removeExpiredLocked(now time.Time) int {
+	var removed int
+	for id, up := range u.uploads {
+		if !now.Before(up.expires) {
+			u.delete(id)
+			removed++
+		}
+	}
+
+	return removed
+}
+
+// cleanup removes expired uploads every interval until the stop channel is
+// closed.
+func (u *Uploads) cleanup(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case now := <-ticker.C:
+			if removed := u.removeExpired(now); removed > 0 {
+				jww.DEBUG.Printf("Removed %d expired uploads.", removed)
+			}
+		}
+	}
+}
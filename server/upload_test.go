@@ -0,0 +1,205 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package server
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+)
+
+// newTestUploads returns an Uploads with the parameters.
+func newTestUploads(params map[string]interface{}, t *testing.T) *Uploads {
+	u, err := NewUploads(params)
+	if err != nil {
+		t.Fatalf("Failed to create uploads: %+v", err)
+	}
+	return u
+}
+
+// Tests that the chunks appended with Uploads.Append are returned by
+// Uploads.complete once all of the data was received.
+func TestUploads_Append_complete(t *testing.T) {
+	u := newTestUploads(map[string]interface{}{"chunkSize": 3}, t)
+	data := []byte("abcdefgh")
+	id, err := u.Start("user", "file", int64(len(data)), nil)
+	if err != nil {
+		t.Fatalf("Failed to start upload: %+v", err)
+	}
+
+	for offset := 0; offset < len(data); offset += 3 {
+		end := offset + 3
+		if end > len(data) {
+			end = len(data)
+		}
+		received, err := u.Append("user", id, int64(offset), data[offset:end])
+		if err != nil {
+			t.Fatalf("Failed to append chunk at %d: %+v", offset, err)
+		} else if received != int64(end) {
+			t.Errorf("Unexpected bytes received.\nexpected: %d\nreceived: %d",
+				end, received)
+		}
+		if end < len(data) {
+			_, _, err = u.complete("user", id)
+			if !errors.Is(err, UploadIncompleteErr) {
+				t.Errorf("Unexpected error for incomplete upload."+
+					"\nexpected: %v\nreceived: %+v", UploadIncompleteErr, err)
+			}
+		}
+	}
+
+	path, completed, err := u.complete("user", id)
+	if err != nil {
+		t.Fatalf("Failed to complete upload: %+v", err)
+	} else if path != "file" || !bytes.Equal(completed, data) {
+		t.Errorf("Unexpected upload of %s: %q", path, completed)
+	} else if cap(completed) > len(data) {
+		t.Errorf("Upload buffer of %d bytes exceeds size %d.",
+			cap(completed), len(data))
+	}
+}
+
+// Error path: Tests that Uploads.Append rejects chunks at the wrong offset and
+// chunks that are too large.
+func TestUploads_Append_Error(t *testing.T) {
+	u := newTestUploads(map[string]interface{}{"chunkSize": 4}, t)
+	id, _ := u.Start("user", "file", 6, nil)
+	_, _ = u.Append("user", id, 0, []byte("abc"))
+
+	tests := []struct {
+		offset int64
+		data   string
+		err    error
+	}{
+		{0, "abc", UploadOffsetErr},
+		{5, "f", UploadOffsetErr},
+		{3, "defg", UploadSizeErr},
+		{3, "defgh", UploadSizeErr},
+	}
+	for _, tt := range tests {
+		received, err := u.Append("user", id, tt.offset, []byte(tt.data))
+		if !errors.Is(err, tt.err) {
+			t.Errorf("Unexpected error for %q at %d.\nexpected: %v"+
+				"\nreceived: %+v", tt.data, tt.offset, tt.err, err)
+		} else if tt.err == UploadOffsetErr && received != 3 {
+			t.Errorf("Unexpected bytes received.\nexpected: %d\nreceived: %d",
+				3, received)
+		}
+	}
+}
+
+// Error path: Tests that uploads cannot be used by another user or after they
+// expire, and that expired uploads are removed.
+func TestUploads_UnknownUploadErr(t *testing.T) {
+	u := newTestUploads(map[string]interface{}{"ttl": "1m"}, t)
+	id, _ := u.Start("user", "file", 1, nil)
+
+	if _, err := u.Status("other", id); !errors.Is(err, UnknownUploadErr) {
+		t.Errorf("Unexpected error for other user."+
+			"\nexpected: %v\nreceived: %+v", UnknownUploadErr, err)
+	}
+	if err := u.Cancel("other", id); !errors.Is(err, UnknownUploadErr) {
+		t.Errorf("Unexpected error cancelling for other user."+
+			"\nexpected: %v\nreceived: %+v", UnknownUploadErr, err)
+	}
+
+	if removed := u.removeExpired(time.Now()); removed != 0 {
+		t.Errorf("Removed %d uploads before they expired.", removed)
+	}
+	u.uploads[id].expires = time.Now()
+	if _, err := u.Status("user", id); !errors.Is(err, UnknownUploadErr) {
+		t.Errorf("Unexpected error for expired upload."+
+			"\nexpected: %v\nreceived: %+v", UnknownUploadErr, err)
+	}
+	if removed := u.removeExpired(time.Now()); removed != 1 {
+		t.Errorf("Unexpected number of uploads removed."+
+			"\nexpected: %d\nreceived: %d", 1, removed)
+	}
+}
+
+// Error path: Tests that Uploads.Start rejects files that are too large and
+// uploads over the user's limit.
+func TestUploads_Start_Error(t *testing.T) {
+	u := newTestUploads(
+		map[string]interface{}{"maxSize": 10, "maxPerUser": 2}, t)
+
+	if _, err := u.Start("user", "file", 11, nil); !errors.Is(
+		err, UploadSizeErr) {
+		t.Errorf("Unexpected error for large file."+
+			"\nexpected: %v\nreceived: %+v", UploadSizeErr, err)
+	}
+	if _, err := u.Start("user", "file", 1, []byte("short")); err == nil {
+		t.Errorf("Failed to get error for invalid hash.")
+	}
+
+	for i := 0; i < 2; i++ {
+		if _, err := u.Start("user", "file", 1, nil); err != nil {
+			t.Fatalf("Failed to start upload %d: %+v", i, err)
+		}
+	}
+	if _, err := u.Start("user", "file", 1, nil); !errors.Is(
+		err, UploadLimitErr) {
+		t.Errorf("Unexpected error over limit."+
+			"\nexpected: %v\nreceived: %+v", UploadLimitErr, err)
+	}
+	if _, err := u.Start("other", "file", 1, nil); err != nil {
+		t.Errorf("Failed to start upload of other user: %+v", err)
+	}
+}
+
+// Error path: Tests that Uploads.Start rejects an upload once the unfinished
+// uploads of all users would exceed maxTotal and accepts it again after an
+// upload is removed.
+func TestUploads_Start_MaxTotalError(t *testing.T) {
+	u := newTestUploads(map[string]interface{}{
+		"maxSize": 10, "maxTotal": 16, "ttl": "1h"}, t)
+
+	id, err := u.Start("user", "file", 10, nil)
+	if err != nil {
+		t.Fatalf("Failed to start upload: %+v", err)
+	}
+	if _, err = u.Start("other", "file", 7, nil); !errors.Is(
+		err, UploadLimitErr) {
+		t.Errorf("Unexpected error over maxTotal."+
+			"\nexpected: %v\nreceived: %+v", UploadLimitErr, err)
+	}
+	if _, err = u.Start("other", "file", 6, nil); err != nil {
+		t.Errorf("Failed to start upload within maxTotal: %+v", err)
+	}
+
+	if err = u.Cancel("user", id); err != nil {
+		t.Fatalf("Failed to cancel upload: %+v", err)
+	}
+	if _, err = u.Start("other", "file", 10, nil); err != nil {
+		t.Errorf("Failed to start upload after cancelling: %+v", err)
+	}
+
+	u.removeExpired(time.Now().Add(2 * time.Hour))
+	if u.total != 0 {
+		t.Errorf("Size of expired uploads not released: %d bytes.", u.total)
+	}
+}
+
+// Error path: Tests that NewUploads returns an error for invalid parameters.
+func TestNewUploads_Error(t *testing.T) {
+	tests := map[string]map[string]interface{}{
+		"zero chunkSize":   {"chunkSize": 0},
+		"negative maxSize": {"maxSize": -1},
+		"zero maxPerUser":  {"maxPerUser": 0},
+		"small maxTotal":   {"maxSize": 10, "maxTotal": 9},
+		"negative ttl":     {"ttl": "-1h"},
+		"unknown key":      {"maxChunks": 4},
+		"invalid ttl":      {"ttl": "soon"},
+	}
+	for name, params := range tests {
+		if _, err := NewUploads(params); err == nil {
+			t.Errorf("Failed to get error for %s.", name)
+		}
+	}
+}
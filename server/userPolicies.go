@@ -0,0 +1,338 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package server
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"gitlab.com/elixxir/remoteSyncServer/store"
+	"gitlab.com/xx_network/primitives/utils"
+)
+
+var (
+	// BannedErr is returned, with the PERMISSION_DENIED code, when logging in
+	// as a user who is banned.
+	BannedErr = errors.New("account is banned")
+
+	// QuotaExceededErr is returned, with the RESOURCE_EXHAUSTED code, when a
+	// write would make the total size of a user's files exceed their quota.
+	QuotaExceededErr = errors.New("storage quota exceeded")
+)
+
+// userBan records why and when a user was banned.
+type userBan struct {
+	Reason string    `json:"reason,omitempty"`
+	Time   time.Time `json:"time"`
+}
+
+// UserPolicies contains the storage quotas and bans set on users by the Admin
+// service. If it has a path, every change is saved to the file so that they
+// survive restarts.
+type UserPolicies struct {
+	path string
+
+	// quotas maps each username to the maximum total size of their files in
+	// bytes.
+	quotas map[string]int64
+
+	// bans maps each banned username to their ban.
+	bans map[string]userBan
+
+	mux sync.RWMutex
+}
+
+// userPoliciesDisk is the JSON structure of the user policies file.
+type userPoliciesDisk struct {
+	Quotas map[string]int64   `json:"quotas"`
+	Bans   map[string]userBan `json:"bans"`
+}
+
+// NewUserPolicies loads the user policies from the file at the path in the
+// same way as NewRevocationList. If the path is empty, the policies are only
+// kept in memory.
+func NewUserPolicies(path string) (*UserPolicies, error) {
+	up := &UserPolicies{
+		quotas: make(map[string]int64),
+		bans:   make(map[string]userBan),
+	}
+	if path == "" {
+		return up, nil
+	}
+
+	path, err := utils.ExpandPath(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to expand path %s", path)
+	}
+	up.path = path
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return up, nil
+	} else if err != nil {
+		return nil, errors.Wrapf(err, "unable to read file %s", path)
+	}
+
+	var disk userPoliciesDisk
+	if err = json.Unmarshal(data, &disk); err != nil {
+		return nil, errors.Wrapf(err, "unable to parse user policies %s", path)
+	}
+	if disk.Quotas != nil {
+		up.quotas = disk.Quotas
+	}
+	if disk.Bans != nil {
+		up.bans = disk.Bans
+	}
+
+	return up, nil
+}
+
+// Quota returns the maximum total size of the files of the user in bytes, or
+// zero if they have no quota.
+func (up *UserPolicies) Quota(username string) int64 {
+	up.mux.RLock()
+	defer up.mux.RUnlock()
+	return up.quotas[username]
+}
+
+// SetQuota sets the maximum total size of the files of the user in bytes and
+// returns their previous quota. A quota of zero removes it.
+func (up *UserPolicies) SetQuota(username string, quota int64) (int64, error) {
+	if quota < 0 {
+		return 0, errors.Errorf("quota %d must not be negative", quota)
+	}
+
+	up.mux.Lock()
+	defer up.mux.Unlock()
+	previous := up.quotas[username]
+	if quota == 0 {
+		delete(up.quotas, username)
+	} else {
+		up.quotas[username] = quota
+	}
+	return previous, up.save()
+}
+
+// Banned returns the reason the user was banned and true if they are banned.
+func (up *UserPolicies) Banned(username string) (string, bool) {
+	up.mux.RLock()
+	defer up.mux.RUnlock()
+	ban, banned := up.bans[username]
+	return ban.Reason, banned
+}
+
+// SetBanned bans the user for the reason or unbans them and returns true if
+// they were banned before.
+func (up *UserPolicies) SetBanned(
+	username string, banned bool, reason string) (bool, error) {
+	up.mux.Lock()
+	defer up.mux.Unlock()
+	_, wasBanned := up.bans[username]
+	if banned {
+		up.bans[username] = userBan{Reason: reason, Time: time.Now()}
+	} else {
+		delete(up.bans, username)
+	}
+	return wasBanned, up.save()
+}
+
+// Remove removes the quota and ban of the user, such as when they are deleted,
+// so that they do not apply to a new user with the same name.
+func (up *UserPolicies) Remove(username string) error {
+	up.mux.Lock()
+	defer up.mux.Unlock()
+	_, hasQuota := up.quotas[username]
+	_, banned := up.bans[username]
+	if !hasQuota && !banned {
+		return nil
+	}
+	delete(up.quotas, username)
+	delete(up.bans, username)
+	return up.save()
+}
+
+// checkLogin returns [BannedErr] with the reason if the user is banned.
+func (up *UserPolicies) checkLogin(username string) error {
+	if reason, banned := up.Banned(username); banned && reason != "" {
+		return errors.Wrap(BannedErr, reason)
+	} else if banned {
+		return BannedErr
+	}
+	return nil
+}
+
+// save writes the user policies to the file, if there is one, in the same way
+// as the revocation list. Must be called while the lock is held.
+func (up *UserPolicies) save() error {
+	if up.path == "" {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(
+		userPoliciesDisk{up.quotas, up.bans}, "", "\t")
+	if err != nil {
+		return errors.Wrap(err, "failed to encode user policies")
+	}
+
+	if err = os.MkdirAll(filepath.Dir(up.path), 0700); err != nil {
+		return errors.Wrapf(err, "failed to make directory for %s", up.path)
+	}
+	tmpPath := up.path + ".tmp"
+	if err = os.WriteFile(tmpPath, data, revocationFilePerm); err != nil {
+		return errors.Wrapf(err, "failed to write %s", tmpPath)
+	}
+	if err = os.Rename(tmpPath, up.path); err != nil {
+		return errors.Wrapf(err, "failed to replace %s", up.path)
+	}
+
+	return nil
+}
+
+// wrap returns a NewStore whose stores reject writes that would make the total
+// size of the files of their user exceed the user's quota.
+func (up *UserPolicies) wrap(newStore store.NewStore) store.NewStore {
+	return func(storageDir, baseDir string) (store.Store, error) {
+		s, err := newStore(storageDir, baseDir)
+		if err != nil {
+			return nil, err
+		}
+		qs := &quotaStore{Store: s, up: up, user: baseDir}
+		if versioner, ok := s.(store.Versioner); ok {
+			return &quotaVersionedStore{qs, versioner}, nil
+		}
+		return qs, nil
+	}
+}
+
+// quotaStore enforces the quota of its user on the writes to their Store.
+// Adheres to the Store interface.
+type quotaStore struct {
+	store.Store
+	up   *UserPolicies
+	user string
+}
+
+// Write writes the data to the file at the path. Returns [QuotaExceededErr] if
+// the write would exceed the quota of the user.
+func (qs *quotaStore) Write(path string, data []byte) error {
+	return qs.commit([]TransactionOp{{Path: path, Data: data}})
+}
+
+// Delete deletes the file at the path. Deletes are never limited by the quota.
+func (qs *quotaStore) Delete(path string) error {
+	return applyOps(qs.Store, []TransactionOp{{Path: path, Delete: true}})
+}
+
+// commit applies the operations of a transaction. Returns [QuotaExceededErr]
+// if the files of the user would exceed their quota once it is applied.
+func (qs *quotaStore) commit(ops []TransactionOp) error {
+	if err := qs.check(ops); err != nil {
+		return err
+	}
+	return applyOps(qs.Store, ops)
+}
+
+// check returns [QuotaExceededErr] if the total size of the files of the user
+// after applying the operations would exceed their quota and it grows. Stores
+// that do not implement Sizer are not limited.
+func (qs *quotaStore) check(ops []TransactionOp) error {
+	quota := qs.up.Quota(qs.user)
+	sizer, ok := qs.Store.(store.Sizer)
+	if quota == 0 || !ok {
+		return nil
+	}
+
+	// Each file is counted once, at the size of the last operation on it
+	final := make(map[string]int64, len(ops))
+	for _, op := range ops {
+		if op.Delete {
+			final[op.Path] = 0
+		} else {
+			final[op.Path] = int64(len(op.Data))
+		}
+	}
+	var growth int64
+	for path, size := range final {
+		if data, err := qs.Store.Read(path); err == nil {
+			size -= int64(len(data))
+		}
+		growth += size
+	}
+	if growth <= 0 {
+		return nil
+	}
+
+	size, err := sizer.Size()
+	if err != nil {
+		return errors.WithMessage(err, "failed to measure storage for quota")
+	}
+	if size+growth > quota {
+		return errors.Wrapf(QuotaExceededErr, "%d bytes exceeds %d bytes",
+			size+growth, quota)
+	}
+	return nil
+}
+
+// ListFiles returns the paths of all files in the underlying store. Returns an
+// error if the underlying store does not implement Lister.
+func (qs *quotaStore) ListFiles() ([]string, error) {
+	lister, ok := qs.Store.(store.Lister)
+	if !ok {
+		return nil, errors.New("underlying store cannot list its files")
+	}
+	return lister.ListFiles()
+}
+
+// Size returns the total size of the files in the underlying store. Returns an
+// error if the underlying store does not implement Sizer.
+func (qs *quotaStore) Size() (int64, error) {
+	sizer, ok := qs.Store.(store.Sizer)
+	if !ok {
+		return 0, errors.New("underlying store cannot report its size")
+	}
+	return sizer.Size()
+}
+
+// Ping returns an error if the underlying store cannot be reached. Stores that
+// do not implement Pinger are assumed to be reachable.
+func (qs *quotaStore) Ping() error {
+	if pinger, ok := qs.Store.(store.Pinger); ok {
+		return pinger.Ping()
+	}
+	return nil
+}
+
+// Open opens the file at the path in the underlying store for reading.
+func (qs *quotaStore) Open(path string) (io.ReadCloser, int64, error) {
+	return store.Open(qs.Store, path)
+}
+
+// Stat returns the metadata of the file at the path in the underlying store.
+func (qs *quotaStore) Stat(path string) (store.Metadata, error) {
+	return store.Stat(qs.Store, path)
+}
+
+// SetDevice records the device as the writer of the file at the path in the
+// underlying store.
+func (qs *quotaStore) SetDevice(
+	path string, sha256 []byte, device string) error {
+	return store.SetDevice(qs.Store, path, sha256, device)
+}
+
+// quotaVersionedStore is a quotaStore of a store that keeps previous versions
+// of files.
+type quotaVersionedStore struct {
+	*quotaStore
+	store.Versioner
+}
@@ -0,0 +1,167 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package server
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"gitlab.com/elixxir/remoteSyncServer/credentials"
+	"gitlab.com/elixxir/remoteSyncServer/store"
+)
+
+// Tests that quotaStore adheres to the committer interface.
+var _ committer = (*quotaStore)(nil)
+
+// Tests that quotas and bans saved by a UserPolicies are loaded by a new
+// UserPolicies with the same path.
+func TestNewUserPolicies_Load(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "userPolicies.json")
+	up, err := NewUserPolicies(path)
+	if err != nil {
+		t.Fatalf("Failed to create UserPolicies: %+v", err)
+	}
+
+	if _, err = up.SetQuota("waldo", 1024); err != nil {
+		t.Fatalf("Failed to set quota: %+v", err)
+	}
+	if _, err = up.SetBanned("carmen", true, "spam"); err != nil {
+		t.Fatalf("Failed to ban user: %+v", err)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("Failed to stat user policies file: %+v", err)
+	}
+	if info.Mode().Perm() != revocationFilePerm {
+		t.Errorf("Unexpected file permissions.\nexpected: %s\nreceived: %s",
+			revocationFilePerm, info.Mode().Perm())
+	}
+
+	loaded, err := NewUserPolicies(path)
+	if err != nil {
+		t.Fatalf("Failed to load UserPolicies: %+v", err)
+	}
+	if quota := loaded.Quota("waldo"); quota != 1024 {
+		t.Errorf("Unexpected loaded quota: %d", quota)
+	}
+	if reason, banned := loaded.Banned("carmen"); !banned || reason != "spam" {
+		t.Errorf("Ban not loaded: %t %q", banned, reason)
+	}
+}
+
+// Error path: Tests that NewUserPolicies returns an error for a corrupt file.
+func TestNewUserPolicies_ParseError(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "userPolicies.json")
+	if err := os.WriteFile(path, []byte("{"), revocationFilePerm); err != nil {
+		t.Fatalf("Failed to write file: %+v", err)
+	}
+
+	if _, err := NewUserPolicies(path); err == nil {
+		t.Errorf("Failed to get error for corrupt file.")
+	}
+}
+
+// Tests that UserPolicies.SetQuota and UserPolicies.SetBanned return the
+// previous state and that UserPolicies.Remove clears both.
+func TestUserPolicies_Set(t *testing.T) {
+	up, _ := NewUserPolicies("")
+
+	if previous, _ := up.SetQuota("waldo", 10); previous != 0 {
+		t.Errorf("Unexpected previous quota: %d", previous)
+	}
+	if previous, _ := up.SetQuota("waldo", 0); previous != 10 {
+		t.Errorf("Unexpected previous quota: %d", previous)
+	}
+	if quota := up.Quota("waldo"); quota != 0 {
+		t.Errorf("Quota not removed: %d", quota)
+	}
+	if _, err := up.SetQuota("waldo", -1); err == nil {
+		t.Errorf("Failed to get error for negative quota.")
+	}
+
+	if wasBanned, _ := up.SetBanned("waldo", true, ""); wasBanned {
+		t.Errorf("User reported as banned before ban.")
+	}
+	if err := up.checkLogin("waldo"); !errors.Is(err, BannedErr) {
+		t.Errorf("Unexpected error for banned user: %+v", err)
+	}
+	if wasBanned, _ := up.SetBanned("waldo", false, ""); !wasBanned {
+		t.Errorf("User not reported as banned before unban.")
+	}
+	if err := up.checkLogin("waldo"); err != nil {
+		t.Errorf("Unexpected error for unbanned user: %+v", err)
+	}
+
+	_, _ = up.SetQuota("carmen", 10)
+	_, _ = up.SetBanned("carmen", true, "spam")
+	if err := up.Remove("carmen"); err != nil {
+		t.Fatalf("Failed to remove user: %+v", err)
+	}
+	if _, banned := up.Banned("carmen"); banned || up.Quota("carmen") != 0 {
+		t.Errorf("Policies of removed user not cleared.")
+	}
+}
+
+// Tests that a quotaStore allows writes up to the quota of its user, including
+// overwrites and transactions that do not grow the files, and rejects writes
+// past it with QuotaExceededErr.
+func Test_quotaStore(t *testing.T) {
+	up, _ := NewUserPolicies("")
+	_, _ = up.SetQuota("waldo", 10)
+	s, err := up.wrap(store.NewMemStore)("", "waldo")
+	if err != nil {
+		t.Fatalf("Failed to create store: %+v", err)
+	}
+
+	if err = s.Write("a", []byte("123456")); err != nil {
+		t.Fatalf("Failed to write within quota: %+v", err)
+	}
+	if err = s.Write("b", []byte("12345")); !errors.Is(err, QuotaExceededErr) {
+		t.Errorf("Unexpected error for write over quota: %+v", err)
+	}
+	if err = s.Write("a", []byte("1234567890")); err != nil {
+		t.Errorf("Failed to overwrite within quota: %+v", err)
+	}
+	err = applyOps(s, []TransactionOp{
+		{Path: "a", Delete: true}, {Path: "b", Data: []byte("12345")}})
+	if err != nil {
+		t.Errorf("Failed to commit transaction within quota: %+v", err)
+	}
+
+	_, _ = up.SetQuota("waldo", 0)
+	if err = s.Write("c", []byte("1234567890")); err != nil {
+		t.Errorf("Failed to write after quota removed: %+v", err)
+	}
+}
+
+// Error path: Tests that a banned user cannot log in, and that an unbanned
+// user can.
+func Test_handler_addSession_BannedErr(t *testing.T) {
+	h := newHandler("", time.Hour, credentials.NewMemStore(nil), nil,
+		store.NewMemStore)
+	h.policies, _ = NewUserPolicies("")
+	_, _ = h.policies.SetBanned("waldo", true, "spam")
+
+	if _, err := h.addSession("waldo"); !errors.Is(err, BannedErr) {
+		t.Errorf("Unexpected error for banned user: %+v", err)
+	}
+	_, err := h.addAPIKeySession("waldo", Scopes{ScopeRead})
+	if !errors.Is(err, BannedErr) {
+		t.Errorf("Unexpected error for banned API key user: %+v", err)
+	}
+
+	_, _ = h.policies.SetBanned("waldo", false, "")
+	if _, err = h.addSession("waldo"); err != nil {
+		t.Errorf("Failed to log in after unban: %+v", err)
+	}
+}
@@ -18,6 +18,12 @@ import (
 // store.Store for a user that only exists for the given TTL.
 type userSession struct {
 	username string
+
+	// scopes limits the requests allowed by sessions logged in with an API
+	// key. It is nil for sessions logged in with the user's credentials, which
+	// allow all requests.
+	scopes Scopes
+
 	nonce.Nonce
 	store.Store
 }
@@ -0,0 +1,230 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package server
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Values of the X-Frame-Options header.
+const (
+	frameOptionsDeny       = "DENY"
+	frameOptionsSameOrigin = "SAMEORIGIN"
+)
+
+// anyOrigin allows cross-origin requests from any origin.
+const anyOrigin = "*"
+
+// The methods and headers that browsers may send in cross-origin REST and
+// download link requests, and how long browsers may cache preflight responses.
+const (
+	corsAllowedMethods = "GET, HEAD, POST, PUT, DELETE"
+	corsAllowedHeaders = "Authorization, Content-Type, Content-Encoding"
+	corsMaxAge         = 10 * time.Minute
+)
+
+// WebSecurityParams are the parameters of the cross-origin requests and
+// security headers of the listeners, for browser clients. They are set in the
+// "webSecurity" section of the config.
+type WebSecurityParams struct {
+	// AllowedOrigins is the list of origins of the browser apps that can make
+	// cross-origin requests, such as "https://app.example.com", or "*" for any
+	// origin. Defaults to any origin.
+	AllowedOrigins []string `mapstructure:"allowedOrigins"`
+
+	// HSTSMaxAge is how long browsers only connect to the server over HTTPS
+	// after a response with the Strict-Transport-Security header. Zero omits
+	// the header. Defaults to 0.
+	HSTSMaxAge time.Duration `mapstructure:"hstsMaxAge"`
+
+	// HSTSIncludeSubdomains extends the Strict-Transport-Security header to
+	// all subdomains of the server.
+	HSTSIncludeSubdomains bool `mapstructure:"hstsIncludeSubdomains"`
+
+	// NoSniff sets the X-Content-Type-Options header to nosniff, so that
+	// browsers do not guess the type of downloaded files. Defaults to true.
+	NoSniff bool `mapstructure:"noSniff"`
+
+	// FrameOptions is the X-Frame-Options header, "DENY" or "SAMEORIGIN", which
+	// stops other sites from framing responses. Empty omits the header.
+	// Defaults to "DENY".
+	FrameOptions string `mapstructure:"frameOptions"`
+}
+
+// WebSecurity restricts the origins that browsers can make cross-origin
+// requests from and sets security headers on the responses of the listeners.
+type WebSecurity struct {
+	params WebSecurityParams
+
+	// origins are the allowed origins in canonical form, or nil if any origin
+	// is allowed.
+	origins map[string]bool
+
+	// headers are the security headers set on every response.
+	headers http.Header
+}
+
+// NewWebSecurity creates a new WebSecurity from the parameters. Returns an
+// error for unknown parameters, invalid origins and frame options, a negative
+// HSTS max age, or subdomains included without HSTS.
+func NewWebSecurity(params map[string]interface{}) (*WebSecurity, error) {
+	p := WebSecurityParams{NoSniff: true, FrameOptions: frameOptionsDeny}
+	if err := decodeParams(params, &p, "web security"); err != nil {
+		return nil, err
+	}
+
+	if p.HSTSMaxAge < 0 {
+		return nil, errors.Errorf(
+			"HSTS max age %s cannot be negative", p.HSTSMaxAge)
+	} else if p.HSTSIncludeSubdomains && p.HSTSMaxAge == 0 {
+		return nil, errors.New("HSTS max age is required to include subdomains")
+	}
+	p.FrameOptions = strings.ToUpper(p.FrameOptions)
+	if p.FrameOptions != "" && p.FrameOptions != frameOptionsDeny &&
+		p.FrameOptions != frameOptionsSameOrigin {
+		return nil, errors.Errorf("frame options %q must be %q or %q",
+			p.FrameOptions, frameOptionsDeny, frameOptionsSameOrigin)
+	}
+
+	ws := &WebSecurity{params: p, headers: http.Header{}}
+	for _, origin := range p.AllowedOrigins {
+		if origin == anyOrigin {
+			ws.origins = nil
+			break
+		}
+		canonical, err := parseOrigin(origin)
+		if err != nil {
+			return nil, err
+		}
+		if ws.origins == nil {
+			ws.origins = make(map[string]bool)
+		}
+		ws.origins[canonical] = true
+	}
+
+	if p.HSTSMaxAge > 0 {
+		hsts := "max-age=" +
+			strconv.FormatInt(int64(p.HSTSMaxAge.Seconds()), 10)
+		if p.HSTSIncludeSubdomains {
+			hsts += "; includeSubDomains"
+		}
+		ws.headers.Set("Strict-Transport-Security", hsts)
+	}
+	if p.NoSniff {
+		ws.headers.Set("X-Content-Type-Options", "nosniff")
+	}
+	if p.FrameOptions != "" {
+		ws.headers.Set("X-Frame-Options", p.FrameOptions)
+	}
+
+	return ws, nil
+}
+
+// Params returns the parameters of the web security.
+func (ws *WebSecurity) Params() WebSecurityParams {
+	return ws.params
+}
+
+// allowOrigin returns true if browsers can make cross-origin requests from the
+// origin. Any origin is allowed if the WebSecurity is nil.
+func (ws *WebSecurity) allowOrigin(origin string) bool {
+	if ws == nil || ws.origins == nil {
+		return true
+	}
+	canonical, err := parseOrigin(origin)
+	return err == nil && ws.origins[canonical]
+}
+
+// allowWebsocket returns true if the gRPC-web WebSocket request is from the
+// same origin as the server or from an allowed origin. Any origin is allowed
+// if the WebSecurity is nil.
+func (ws *WebSecurity) allowWebsocket(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	if u, err := url.Parse(origin); err == nil &&
+		strings.EqualFold(u.Host, r.Host) {
+		return true
+	}
+	return ws.allowOrigin(origin)
+}
+
+// handler returns a handler that sets the security headers on the responses of
+// the next handler, other than those of native gRPC. The next handler is
+// returned unchanged if the WebSecurity is nil.
+func (ws *WebSecurity) handler(next http.Handler) http.Handler {
+	if ws == nil || len(ws.headers) == 0 {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !isNativeGRPC(r) {
+			for key := range ws.headers {
+				w.Header().Set(key, ws.headers.Get(key))
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// cors returns a handler that allows browsers to make cross-origin requests to
+// the next handler from the allowed origins and answers their preflight
+// requests. It is used for REST and download links, since the gRPC-web wrapper
+// handles its own. The next handler is returned unchanged if the WebSecurity
+// is nil.
+func (ws *WebSecurity) cors(next http.Handler) http.Handler {
+	if ws == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		if ws.origins != nil {
+			w.Header().Add("Vary", "Origin")
+		}
+		if origin == "" || !ws.allowOrigin(origin) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if ws.origins == nil {
+			origin = anyOrigin
+		}
+		w.Header().Set("Access-Control-Allow-Origin", origin)
+		if r.Method == http.MethodOptions &&
+			r.Header.Get("Access-Control-Request-Method") != "" {
+			w.Header().Set("Access-Control-Allow-Methods", corsAllowedMethods)
+			w.Header().Set("Access-Control-Allow-Headers", corsAllowedHeaders)
+			w.Header().Set("Access-Control-Max-Age",
+				strconv.Itoa(int(corsMaxAge.Seconds())))
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// parseOrigin returns the origin, a scheme and host with an optional port, in
+// lower case. Returns an error if it is not an HTTP or HTTPS origin.
+func parseOrigin(origin string) (string, error) {
+	u, err := url.Parse(strings.ToLower(strings.TrimSuffix(origin, "/")))
+	if err != nil {
+		return "", errors.Wrapf(err, "invalid origin %q", origin)
+	} else if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" ||
+		u.Path != "" || u.RawQuery != "" || u.Fragment != "" ||
+		u.User != nil {
+		return "", errors.Errorf("invalid origin %q: must be a scheme and "+
+			"host such as https://app.example.com", origin)
+	}
+	return u.Scheme + "://" + u.Host, nil
+}
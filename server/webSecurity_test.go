@@ -0,0 +1,165 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// Tests that NewWebSecurity decodes the parameters, defaults the others, and
+// builds the security headers from them.
+func TestNewWebSecurity(t *testing.T) {
+	ws := newTestFromParams(NewWebSecurity, map[string]interface{}{
+		"allowedOrigins": []string{"https://App.example.com/"},
+		"hstsMaxAge":     "24h", "hstsIncludeSubdomains": true,
+		"frameOptions": "sameorigin"}, t)
+	expected := WebSecurityParams{
+		AllowedOrigins:        []string{"https://App.example.com/"},
+		HSTSMaxAge:            24 * time.Hour,
+		HSTSIncludeSubdomains: true,
+		NoSniff:               true,
+		FrameOptions:          frameOptionsSameOrigin,
+	}
+	if !reflect.DeepEqual(ws.Params(), expected) {
+		t.Errorf("Unexpected parameters.\nexpected: %+v\nreceived: %+v",
+			expected, ws.Params())
+	}
+
+	expectedHeaders := http.Header{
+		"Strict-Transport-Security": {"max-age=86400; includeSubDomains"},
+		"X-Content-Type-Options":    {"nosniff"},
+		"X-Frame-Options":           {frameOptionsSameOrigin},
+	}
+	if !reflect.DeepEqual(ws.headers, expectedHeaders) {
+		t.Errorf("Unexpected headers.\nexpected: %v\nreceived: %v",
+			expectedHeaders, ws.headers)
+	}
+}
+
+// Tests that WebSecurity.allowOrigin and WebSecurity.allowWebsocket only allow
+// the configured origins, and the server's own for WebSockets, and allow any
+// origin when none are configured or the WebSecurity is nil.
+func TestWebSecurity_allowOrigin(t *testing.T) {
+	ws := newTestFromParams(NewWebSecurity, map[string]interface{}{
+		"allowedOrigins": []string{"https://app.example.com",
+			"http://localhost:8080"}}, t)
+	tests := []struct {
+		origin  string
+		allowed bool
+	}{
+		{"https://app.example.com", true},
+		{"HTTPS://APP.EXAMPLE.COM", true},
+		{"http://localhost:8080", true},
+		{"http://app.example.com", false},
+		{"https://evil.example.com", false},
+		{"null", false},
+	}
+	for _, tt := range tests {
+		if ws.allowOrigin(tt.origin) != tt.allowed {
+			t.Errorf("Unexpected result for %s.\nexpected: %t",
+				tt.origin, tt.allowed)
+		}
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "https://sync.example.com/", nil)
+	for origin, allowed := range map[string]bool{
+		"":                         true,
+		"https://sync.example.com": true,
+		"https://app.example.com":  true,
+		"https://evil.example.com": false,
+	} {
+		r.Header.Set("Origin", origin)
+		if ws.allowWebsocket(r) != allowed {
+			t.Errorf("Unexpected WebSocket result for %q.\nexpected: %t",
+				origin, allowed)
+		}
+	}
+
+	wildcard := newTestFromParams(NewWebSecurity,
+		map[string]interface{}{"allowedOrigins": []string{"*"}}, t)
+	for _, allowAll := range []*WebSecurity{nil, wildcard} {
+		if !allowAll.allowOrigin("https://evil.example.com") {
+			t.Errorf("Origin not allowed by %+v.", allowAll)
+		}
+	}
+}
+
+// Tests that the handler of WebSecurity sets the security headers on responses
+// other than those of native gRPC.
+func TestWebSecurity_handler(t *testing.T) {
+	ws := newTestFromParams(NewWebSecurity,
+		map[string]interface{}{"hstsMaxAge": "1h"}, t)
+	h := ws.handler(http.NotFoundHandler())
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	for key, value := range map[string]string{
+		"Strict-Transport-Security": "max-age=3600",
+		"X-Content-Type-Options":    "nosniff",
+		"X-Frame-Options":           frameOptionsDeny,
+	} {
+		if w.Header().Get(key) != value {
+			t.Errorf("Unexpected %s header.\nexpected: %q\nreceived: %q",
+				key, value, w.Header().Get(key))
+		}
+	}
+
+	r := httptest.NewRequest(http.MethodPost, "/", nil)
+	r.ProtoMajor = 2
+	r.Header.Set("Content-Type", grpcContentType)
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if w.Header().Get("X-Frame-Options") != "" {
+		t.Errorf("Security headers set on a native gRPC response.")
+	}
+}
+
+// Tests that the CORS handler of WebSecurity allows requests from allowed
+// origins, answers their preflight requests, and passes other requests on
+// without CORS headers.
+func TestWebSecurity_cors(t *testing.T) {
+	ws := newTestFromParams(NewWebSecurity, map[string]interface{}{
+		"allowedOrigins": []string{"https://app.example.com"}}, t)
+	var served int
+	h := ws.cors(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+		served++
+	}))
+
+	r := httptest.NewRequest(http.MethodOptions, "/v1/files/a", nil)
+	r.Header.Set("Origin", "https://app.example.com")
+	r.Header.Set("Access-Control-Request-Method", http.MethodPut)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if w.Code != http.StatusNoContent || served != 0 ||
+		w.Header().Get("Access-Control-Allow-Origin") !=
+			"https://app.example.com" ||
+		w.Header().Get("Access-Control-Allow-Methods") != corsAllowedMethods ||
+		w.Header().Get("Access-Control-Allow-Headers") != corsAllowedHeaders {
+		t.Errorf("Unexpected preflight response %d: %v", w.Code, w.Header())
+	}
+
+	r = httptest.NewRequest(http.MethodGet, "/v1/files/a", nil)
+	r.Header.Set("Origin", "https://app.example.com")
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if served != 1 || w.Header().Get("Access-Control-Allow-Origin") !=
+		"https://app.example.com" || w.Header().Get("Vary") != "Origin" {
+		t.Errorf("Unexpected response: %v", w.Header())
+	}
+
+	r.Header.Set("Origin", "https://evil.example.com")
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if served != 2 || w.Header().Get("Access-Control-Allow-Origin") != "" {
+		t.Errorf("Unexpected response for another origin: %v", w.Header())
+	}
+}
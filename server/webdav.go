@@ -0,0 +1,803 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	jww "github.com/spf13/jwalterweatherman"
+	"golang.org/x/net/webdav"
+
+	"gitlab.com/elixxir/remoteSyncServer/store"
+	"gitlab.com/xx_network/primitives/netTime"
+)
+
+const (
+	// webdavPathPrefix is the path prefix of the files served over WebDAV.
+	webdavPathPrefix = "/webdav"
+
+	// webdavRealm is the realm of the basic authentication challenge.
+	webdavRealm = "remoteSyncServer"
+)
+
+// webdavReadMethods are the methods allowed when WebDAV is read-only.
+var webdavReadMethods = []string{
+	http.MethodGet, http.MethodHead, http.MethodOptions, "PROPFIND"}
+
+// WebDAVParams are the parameters of the WebDAV protocol.
+type WebDAVParams struct {
+	// ReadWrite allows users to write, move, and delete their files over
+	// WebDAV. Defaults to false, which only allows reading them.
+	ReadWrite bool `mapstructure:"readWrite"`
+}
+
+// WebDAV serves the files of each user over WebDAV, so that they can inspect
+// or back up their synced data with standard tools. The locks taken by WebDAV
+// clients are kept separately for each user.
+type WebDAV struct {
+	params WebDAVParams
+	locks  map[string]webdav.LockSystem
+
+	// sessions are the users whose passwords were verified, by username, and
+	// key is the HMAC key of their passwords.
+	sessions map[string]webdavSession
+	key      []byte
+	mux      sync.Mutex
+}
+
+// webdavSession is a user whose password was verified, so that the requests
+// that follow with the same password are not verified again until it expires.
+type webdavSession struct {
+	// mac is the HMAC of the password, so that the password is not kept.
+	mac []byte
+
+	// stored is the stored password it was verified against, so that the
+	// password is verified again once it is changed.
+	stored  string
+	expires time.Time
+}
+
+// NewWebDAV creates a new WebDAV from the parameters. Returns an error for
+// unknown or invalid parameters.
+func NewWebDAV(params map[string]interface{}) (*WebDAV, error) {
+	var p WebDAVParams
+	if err := decodeParams(params, &p, "WebDAV"); err != nil {
+		return nil, err
+	}
+	key := make([]byte, sha256.Size)
+	if _, err := rand.Read(key); err != nil {
+		return nil, errors.Wrap(err, "failed to generate WebDAV session key")
+	}
+	return &WebDAV{params: p, locks: make(map[string]webdav.LockSystem),
+		sessions: make(map[string]webdavSession), key: key}, nil
+}
+
+// CheckWebDAV returns an error if a listener serves the WebDAV protocol while
+// WebDAV is not enabled, or if it is enabled but no listener serves it.
+func CheckWebDAV(webdav *WebDAV, listeners []Listener) error {
+	served := false
+	for _, l := range listeners {
+		served = served || l.Serves(ProtocolWebDAV)
+	}
+	if served && webdav == nil {
+		return errors.Errorf("listeners cannot serve the %s protocol unless "+
+			"WebDAV is enabled", ProtocolWebDAV)
+	} else if !served && webdav != nil {
+		return errors.Errorf("WebDAV is enabled, but no listener serves the "+
+			"%s protocol", ProtocolWebDAV)
+	}
+	return nil
+}
+
+// Params returns the parameters of WebDAV.
+func (wd *WebDAV) Params() WebDAVParams {
+	return wd.params
+}
+
+// lockSystem returns the lock system of the user.
+func (wd *WebDAV) lockSystem(username string) webdav.LockSystem {
+	wd.mux.Lock()
+	defer wd.mux.Unlock()
+	ls, exists := wd.locks[username]
+	if !exists {
+		ls = webdav.NewMemLS()
+		wd.locks[username] = ls
+	}
+	return ls
+}
+
+// authenticate verifies the password of the user with the handler. WebDAV
+// clients send the password with every request and verifying a hashed password
+// is slow by design, so a password that matches the one last verified for the
+// user, within the token TTL and while the stored password is unchanged, is
+// accepted without verifying it again.
+//
+// Returns [InvalidCredentialsErr] for an invalid username or password.
+func (wd *WebDAV) authenticate(h *handler, username, password string) error {
+	stored, err := h.users.Get(username)
+	if err != nil {
+		return h.verifyPassword(username, password)
+	}
+	mac := hmac.New(sha256.New, wd.key)
+	mac.Write([]byte(username + "\x00" + password))
+	sum := mac.Sum(nil)
+
+	now := time.Now()
+	wd.mux.Lock()
+	session, exists := wd.sessions[username]
+	wd.mux.Unlock()
+	if exists && now.Before(session.expires) && session.stored == stored &&
+		hmac.Equal(session.mac, sum) {
+		return nil
+	}
+
+	if err = h.verifyPassword(username, password); err != nil {
+		return err
+	}
+	// The password is read again, since verifying it may have rehashed it
+	if stored, err = h.users.Get(username); err == nil {
+		wd.mux.Lock()
+		wd.sessions[username] = webdavSession{
+			mac: sum, stored: stored, expires: now.Add(h.tokenTTL)}
+		wd.mux.Unlock()
+	}
+	return nil
+}
+
+// webdavHandler serves the files of the user authenticated with HTTP basic
+// authentication over WebDAV under webdavPathPrefix. Since the requests are not
+// RPCs, it applies the rate limits, bans, login throttling, maintenance mode,
+// and object size limit itself, and records the changes in the audit log.
+type webdavHandler struct {
+	h           *handler
+	wd          *WebDAV
+	limiter     *RateLimiter
+	concurrency *ConcurrencyLimiter
+	autoBan     *AutoBan
+	throttle    *LoginThrottle
+	maintenance *Maintenance
+	audit       *AuditLog
+}
+
+// ServeHTTP authenticates the user and serves the request with the user's
+// files. Writing methods are rejected with 405 unless WebDAV is read-write.
+func (wh *webdavHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if err := wh.autoBan.checkHTTP(r); err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	var ipLimiter, userLimiter *keyedLimiter
+	if wh.limiter != nil {
+		ipLimiter, userLimiter = wh.limiter.limiters()
+	}
+	if ipLimiter != nil && !ipLimiter.allow(remoteIP(r), time.Now()) {
+		http.Error(w, "rate limit exceeded", http.StatusTooManyRequests)
+		return
+	}
+
+	username, password, ok := r.BasicAuth()
+	if !ok {
+		writeWebDAVChallenge(w)
+		return
+	}
+	err := wh.throttle.checkHTTP(r, username)
+	if errors.Is(err, AccountLockedErr) {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusTooManyRequests)
+		return
+	}
+	err = wh.wd.authenticate(wh.h, username, password)
+	wh.throttle.recordHTTP(r, username, err)
+	if err != nil {
+		if !errors.Is(err, InvalidCredentialsErr) {
+			jww.ERROR.Printf("Failed to verify WebDAV password of %q: %+v",
+				username, err)
+			http.Error(w, http.StatusText(http.StatusInternalServerError),
+				http.StatusInternalServerError)
+			return
+		}
+		wh.autoBan.recordHTTP(r, err)
+		writeWebDAVChallenge(w)
+		return
+	}
+	if userLimiter != nil && !userLimiter.allow(username, time.Now()) {
+		http.Error(w, "rate limit exceeded", http.StatusTooManyRequests)
+		return
+	}
+	if err := wh.h.checkAccount(username); errors.Is(err, BannedErr) {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusGone)
+		return
+	}
+	if wh.concurrency != nil {
+		release, err := wh.concurrency.acquire(username)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusTooManyRequests)
+			return
+		}
+		defer release()
+	}
+
+	if !isWebDAVReadMethod(r.Method) {
+		if !wh.wd.params.ReadWrite {
+			w.Header().Set("Allow", strings.Join(webdavReadMethods, ", "))
+			http.Error(w, "WebDAV is read-only", http.StatusMethodNotAllowed)
+			return
+		} else if wh.maintenance != nil && wh.maintenance.Enabled() {
+			http.Error(w, MaintenanceErr.Error(),
+				http.StatusServiceUnavailable)
+			return
+		} else if err := wh.h.checkObject(r.ContentLength); err != nil {
+			http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+			return
+		}
+	}
+
+	s, err := wh.h.newStore(wh.h.storageDir, username)
+	if err != nil {
+		jww.ERROR.Printf(
+			"Failed to create store of %q for WebDAV: %+v", username, err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError),
+			http.StatusInternalServerError)
+		return
+	}
+	dav := &webdav.Handler{
+		Prefix: webdavPathPrefix,
+		FileSystem: &webdavFS{h: wh.h, s: s, username: username,
+			readWrite: wh.wd.params.ReadWrite, audit: wh.audit,
+			ctx: r.Context()},
+		LockSystem: wh.wd.lockSystem(username),
+		Logger: func(r *http.Request, err error) {
+			if err != nil {
+				jww.DEBUG.Printf("WebDAV %s %s of %q failed: %v",
+					r.Method, r.URL.Path, username, err)
+			}
+		},
+	}
+	dav.ServeHTTP(w, r)
+}
+
+// isWebDAVReadMethod returns true if the method only reads files.
+func isWebDAVReadMethod(method string) bool {
+	for _, m := range webdavReadMethods {
+		if m == method {
+			return true
+		}
+	}
+	return false
+}
+
+// writeWebDAVChallenge responds that the request must be authenticated with
+// the username and password of the user.
+func writeWebDAVChallenge(w http.ResponseWriter) {
+	w.Header().Set("WWW-Authenticate", `Basic realm="`+webdavRealm+`"`)
+	http.Error(w, http.StatusText(http.StatusUnauthorized),
+		http.StatusUnauthorized)
+}
+
+// remoteIP returns the IP address of the client that sent the request.
+func remoteIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// webdavFS is the WebDAV file system of the files of a user. Since the store
+// only holds files, directories exist while there are files in them; making a
+// directory succeeds, but it is not kept until a file is written in it. Adheres
+// to the webdav.FileSystem interface.
+type webdavFS struct {
+	h         *handler
+	s         store.Store
+	username  string
+	readWrite bool
+
+	// audit records the changes, as in the request with ctx, if it is not nil.
+	audit *AuditLog
+	ctx   context.Context
+
+	// listed are the files of the user listed during the request, or nil if
+	// they have not been listed since the last change.
+	listed []string
+}
+
+// Mkdir succeeds unless there already is a file or directory at the path.
+func (fs *webdavFS) Mkdir(_ context.Context, name string, _ os.FileMode) error {
+	p, err := webdavStorePath(name)
+	if err != nil {
+		return &os.PathError{Op: "mkdir", Path: name, Err: err}
+	}
+	if _, err = fs.stat(p); err == nil {
+		return &os.PathError{Op: "mkdir", Path: name, Err: os.ErrExist}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return webdavPathError("mkdir", name, err)
+	}
+	return nil
+}
+
+// OpenFile opens the file or directory at the path for reading, or the file
+// for writing if the flag has any of the writing flags. A file opened for
+// writing always starts empty and is written when it is closed.
+func (fs *webdavFS) OpenFile(_ context.Context, name string, flag int,
+	_ os.FileMode) (webdav.File, error) {
+	p, err := webdavStorePath(name)
+	if err != nil {
+		return nil, &os.PathError{Op: "open", Path: name, Err: err}
+	}
+
+	writing := os.O_WRONLY | os.O_RDWR | os.O_CREATE | os.O_TRUNC | os.O_APPEND
+	if flag&writing != 0 {
+		if !fs.readWrite {
+			return nil, &os.PathError{
+				Op: "open", Path: name, Err: os.ErrPermission}
+		}
+		info, err := fs.stat(p)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, webdavPathError("open", name, err)
+		} else if err == nil && info.dir {
+			return nil, &os.PathError{Op: "open", Path: name,
+				Err: errors.New("is a directory")}
+		}
+		return &webdavFile{fs: fs, path: p, written: &bytes.Buffer{}}, nil
+	}
+
+	info, err := fs.stat(p)
+	if err != nil {
+		return nil, webdavPathError("open", name, err)
+	}
+	f := &webdavFile{fs: fs, path: p, info: info}
+	if info.dir {
+		f.children, err = fs.children(p)
+	} else {
+		f.data, err = fs.open(p)
+	}
+	if err != nil {
+		return nil, webdavPathError("open", name, err)
+	}
+	return f, nil
+}
+
+// RemoveAll deletes the file or all files in the directory at the path. The
+// root directory cannot be removed.
+func (fs *webdavFS) RemoveAll(_ context.Context, name string) error {
+	p, err := webdavStorePath(name)
+	if err != nil {
+		return &os.PathError{Op: "remove", Path: name, Err: err}
+	} else if p == "" {
+		return &os.PathError{Op: "remove", Path: name, Err: os.ErrPermission}
+	}
+
+	tree, err := fs.tree(p)
+	if err != nil {
+		return err
+	}
+	var ops []TransactionOp
+	for _, file := range tree {
+		ops = append(ops, TransactionOp{Path: file, Delete: true})
+	}
+	if len(ops) == 0 {
+		return nil
+	}
+	return fs.commit(ops)
+}
+
+// Rename moves the file or all files in the directory at the old path to the
+// new path.
+func (fs *webdavFS) Rename(_ context.Context, oldName, newName string) error {
+	oldPath, err := webdavStorePath(oldName)
+	if err != nil {
+		return &os.LinkError{
+			Op: "rename", Old: oldName, New: newName, Err: err}
+	}
+	newPath, err := webdavStorePath(newName)
+	if err != nil {
+		return &os.LinkError{
+			Op: "rename", Old: oldName, New: newName, Err: err}
+	} else if oldPath == "" || newPath == "" ||
+		strings.HasPrefix(newPath+"/", oldPath+"/") {
+		return &os.LinkError{
+			Op: "rename", Old: oldName, New: newName, Err: os.ErrInvalid}
+	}
+
+	moved, err := fs.tree(oldPath)
+	if err != nil {
+		return err
+	} else if len(moved) == 0 {
+		return &os.LinkError{
+			Op: "rename", Old: oldName, New: newName, Err: os.ErrNotExist}
+	}
+	ops := make([]TransactionOp, 0, 2*len(moved))
+	for _, file := range moved {
+		data, err := fs.s.Read(file)
+		if err != nil {
+			return errors.Wrapf(err, "failed to read %s", file)
+		}
+		ops = append(ops, TransactionOp{
+			Path: newPath + strings.TrimPrefix(file, oldPath), Data: data},
+			TransactionOp{Path: file, Delete: true})
+	}
+	return fs.commit(ops)
+}
+
+// Stat returns the file info of the file or directory at the path.
+func (fs *webdavFS) Stat(_ context.Context, name string) (os.FileInfo, error) {
+	p, err := webdavStorePath(name)
+	if err != nil {
+		return nil, &os.PathError{Op: "stat", Path: name, Err: err}
+	}
+	info, err := fs.stat(p)
+	if err != nil {
+		return nil, webdavPathError("stat", name, err)
+	}
+	return info, nil
+}
+
+// files returns the sorted paths of all files of the user. They are listed at
+// most once for each request, until a change is committed.
+func (fs *webdavFS) files() ([]string, error) {
+	if fs.listed != nil {
+		return fs.listed, nil
+	}
+	lister, ok := fs.s.(store.Lister)
+	if !ok {
+		return nil, store.NotListableErr
+	}
+	files, err := lister.ListFiles()
+	if err != nil {
+		return nil, err
+	} else if files == nil {
+		files = []string{}
+	}
+	fs.listed = files
+	return files, nil
+}
+
+// stat returns the file info of the file or directory at the path. A file is
+// looked up on its own; the files of the user are only listed to find whether
+// a path that is not a file is a directory. Returns [os.ErrNotExist] if there
+// is neither.
+func (fs *webdavFS) stat(p string) (*webdavFileInfo, error) {
+	if p == "" {
+		return &webdavFileInfo{name: "/", dir: true}, nil
+	}
+	info, fileErr := fs.statFile(p)
+	if fileErr == nil {
+		return info, nil
+	}
+
+	files, err := fs.files()
+	if err != nil {
+		return nil, err
+	} else if isWebDAVDir(files, p) {
+		return &webdavFileInfo{name: path.Base(p), dir: true}, nil
+	} else if isWebDAVFile(files, p) {
+		return nil, fileErr
+	}
+	return nil, os.ErrNotExist
+}
+
+// statFile returns the file info of the file at the path. Returns an error if
+// there is no file at the path, such as for a directory.
+func (fs *webdavFS) statFile(p string) (*webdavFileInfo, error) {
+	// Opening the file gets its size without reading it from stores that
+	// stream files, such as the local filesystem
+	r, size, err := store.Open(fs.s, p)
+	if err != nil {
+		return nil, err
+	}
+	_ = r.Close()
+	modified, err := fs.s.GetLastModified(p)
+	if err != nil {
+		return nil, err
+	}
+	return &webdavFileInfo{
+		name: path.Base(p), size: size, modified: modified}, nil
+}
+
+// tree returns the file at the path or the files in the directory at the path.
+// It is empty if there is neither.
+func (fs *webdavFS) tree(p string) ([]string, error) {
+	if _, err := fs.statFile(p); err == nil {
+		return []string{p}, nil
+	}
+	files, err := fs.files()
+	if err != nil {
+		return nil, err
+	}
+	return webdavTree(files, p), nil
+}
+
+// open opens the file at the path for reading. Files of stores that can seek
+// in them, such as the local filesystem, are read as they are sent; others are
+// read into memory, since WebDAV clients can request any range of a file.
+func (fs *webdavFS) open(p string) (io.ReadSeekCloser, error) {
+	r, size, err := store.Open(fs.s, p)
+	if err != nil {
+		return nil, err
+	} else if rsc, ok := r.(io.ReadSeekCloser); ok {
+		return rsc, nil
+	}
+	defer func() { _ = r.Close() }()
+
+	data := make([]byte, size)
+	if _, err = io.ReadFull(r, data); err != nil {
+		return nil, errors.Wrapf(err, "failed to read %q", p)
+	}
+	return nopSeekCloser{bytes.NewReader(data)}, nil
+}
+
+// children returns the file info of the files and directories in the
+// directory at the path among the files, sorted by name.
+func (fs *webdavFS) children(p string) ([]os.FileInfo, error) {
+	files, err := fs.files()
+	if err != nil {
+		return nil, err
+	}
+	prefix := p + "/"
+	if p == "" {
+		prefix = ""
+	}
+	var children []os.FileInfo
+	seen := make(map[string]bool)
+	for _, file := range files {
+		if !strings.HasPrefix(file, prefix) {
+			continue
+		}
+		name, _, _ := strings.Cut(strings.TrimPrefix(file, prefix), "/")
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+		if isWebDAVDir(files, prefix+name) {
+			children = append(children, &webdavFileInfo{name: name, dir: true})
+			continue
+		}
+		info, err := fs.statFile(prefix + name)
+		if err != nil {
+			return nil, err
+		}
+		children = append(children, info)
+	}
+	sort.Slice(children, func(i, j int) bool {
+		return children[i].Name() < children[j].Name()
+	})
+	return children, nil
+}
+
+// write writes the data to the file at the path while no backup of the user is
+// running. Returns [ObjectTooLargeErr] if the data exceeds the maximum object
+// size.
+func (fs *webdavFS) write(p string, data []byte) error {
+	if err := fs.h.checkObject(int64(len(data))); err != nil {
+		return err
+	}
+	return fs.commit([]TransactionOp{{Path: p, Data: data}})
+}
+
+// commit applies the operations as a transaction while no backup of the user
+// is running and records each in the audit log. Like the Commit RPC, several
+// operations hold the lock of the user's writes for writing, so that no other
+// write is applied between them.
+func (fs *webdavFS) commit(ops []TransactionOp) error {
+	l := fs.h.locks.get(fs.username)
+	if len(ops) > 1 {
+		l.Lock()
+		defer l.Unlock()
+	} else {
+		l.RLock()
+		defer l.RUnlock()
+	}
+
+	err := applyOps(fs.s, ops)
+	fs.listed = nil
+	if fs.audit != nil {
+		for _, op := range ops {
+			fs.audit.record(fs.ctx, fs.username, AuditWrite, op.Path, err)
+		}
+	}
+	return err
+}
+
+// webdavStorePath returns the path in the store of the WebDAV path, which is
+// empty for the root directory. Returns [store.InvalidPathErr] if the path
+// cannot be sanitized.
+func webdavStorePath(name string) (string, error) {
+	return store.SanitizePath(strings.TrimPrefix(path.Clean("/"+name), "/"))
+}
+
+// isWebDAVFile returns true if the path is one of the sorted files.
+func isWebDAVFile(files []string, p string) bool {
+	i := sort.SearchStrings(files, p)
+	return i < len(files) && files[i] == p
+}
+
+// isWebDAVDir returns true if any of the sorted files is in the directory at
+// the path.
+func isWebDAVDir(files []string, p string) bool {
+	i := sort.SearchStrings(files, p+"/")
+	return i < len(files) && strings.HasPrefix(files[i], p+"/")
+}
+
+// webdavTree returns the file at the path or the files in the directory at the
+// path among the sorted files.
+func webdavTree(files []string, p string) []string {
+	if isWebDAVFile(files, p) {
+		return []string{p}
+	}
+	var tree []string
+	for i := sort.SearchStrings(files, p+"/"); i < len(files) &&
+		strings.HasPrefix(files[i], p+"/"); i++ {
+		tree = append(tree, files[i])
+	}
+	return tree
+}
+
+// webdavPathError returns the error as an [os.PathError] so that the WebDAV
+// handler recognises a file that does not exist, since [os.IsNotExist] does
+// not unwrap errors.
+func webdavPathError(op, name string, err error) error {
+	if errors.Is(err, os.ErrNotExist) {
+		err = os.ErrNotExist
+	}
+	return &os.PathError{Op: op, Path: name, Err: err}
+}
+
+// webdavFile is a file or directory of a webdavFS opened for reading, or a
+// file opened for writing. Adheres to the webdav.File interface.
+type webdavFile struct {
+	fs   *webdavFS
+	path string
+	info *webdavFileInfo
+
+	// data is the data of a file opened for reading, which is closed with the
+	// file.
+	data io.ReadSeekCloser
+
+	// children are the files and directories of a directory, of which the
+	// first next have been read by Readdir.
+	children []os.FileInfo
+	next     int
+
+	// written is the data written to a file opened for writing.
+	written *bytes.Buffer
+}
+
+// Close closes the data of a file opened for reading or writes the data
+// written to a file opened for writing to the store.
+func (f *webdavFile) Close() error {
+	if f.data != nil {
+		return f.data.Close()
+	} else if f.written == nil {
+		return nil
+	}
+	return f.fs.write(f.path, f.written.Bytes())
+}
+
+// Read reads the data of a file opened for reading.
+func (f *webdavFile) Read(p []byte) (int, error) {
+	if f.data == nil {
+		return 0, &os.PathError{Op: "read", Path: f.path, Err: os.ErrInvalid}
+	}
+	return f.data.Read(p)
+}
+
+// Seek sets the offset of the next Read of a file opened for reading.
+func (f *webdavFile) Seek(offset int64, whence int) (int64, error) {
+	if f.data == nil {
+		return 0, &os.PathError{Op: "seek", Path: f.path, Err: os.ErrInvalid}
+	}
+	return f.data.Seek(offset, whence)
+}
+
+// Readdir returns the next count files and directories of a directory, or all
+// remaining ones if count is not positive, as os.File.Readdir does.
+func (f *webdavFile) Readdir(count int) ([]os.FileInfo, error) {
+	if f.info == nil || !f.info.dir {
+		return nil, &os.PathError{
+			Op: "readdir", Path: f.path, Err: os.ErrInvalid}
+	}
+	remaining := f.children[f.next:]
+	if count <= 0 {
+		f.next = len(f.children)
+		return remaining, nil
+	} else if len(remaining) == 0 {
+		return nil, io.EOF
+	} else if count > len(remaining) {
+		count = len(remaining)
+	}
+	f.next += count
+	return remaining[:count], nil
+}
+
+// Stat returns the file info of the file or directory. A file opened for
+// writing has the size of the data written so far.
+func (f *webdavFile) Stat() (os.FileInfo, error) {
+	if f.written != nil {
+		return &webdavFileInfo{name: path.Base(f.path),
+			size: int64(f.written.Len()), modified: netTime.Now()}, nil
+	}
+	return f.info, nil
+}
+
+// Write writes to a file opened for writing.
+func (f *webdavFile) Write(p []byte) (int, error) {
+	if f.written == nil {
+		return 0, &os.PathError{Op: "write", Path: f.path, Err: os.ErrInvalid}
+	}
+	return f.written.Write(p)
+}
+
+// nopSeekCloser is an io.ReadSeeker with a Close method that does nothing.
+type nopSeekCloser struct {
+	io.ReadSeeker
+}
+
+// Close does nothing.
+func (nopSeekCloser) Close() error {
+	return nil
+}
+
+// webdavFileInfo is the file info of a file or directory of a webdavFS.
+// Adheres to the os.FileInfo and webdav.ContentTyper interfaces.
+type webdavFileInfo struct {
+	name     string
+	size     int64
+	modified time.Time
+	dir      bool
+}
+
+// Name returns the base name of the file or directory.
+func (fi *webdavFileInfo) Name() string { return fi.name }
+
+// Size returns the size of the file in bytes.
+func (fi *webdavFileInfo) Size() int64 { return fi.size }
+
+// Mode returns the permissions of the file or directory.
+func (fi *webdavFileInfo) Mode() os.FileMode {
+	if fi.dir {
+		return os.ModeDir | 0755
+	}
+	return 0644
+}
+
+// ModTime returns the last modification time of the file. It is zero for
+// directories.
+func (fi *webdavFileInfo) ModTime() time.Time { return fi.modified }
+
+// IsDir returns true for directories.
+func (fi *webdavFileInfo) IsDir() bool { return fi.dir }
+
+// Sys returns nil.
+func (fi *webdavFileInfo) Sys() interface{} { return nil }
+
+// ContentType returns restDataContentType, since the data of the files is
+// opaque to the server, so that the handler does not read the file to detect
+// it.
+func (fi *webdavFileInfo) ContentType(context.Context) (string, error) {
+	return restDataContentType, nil
+}
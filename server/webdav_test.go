@@ -0,0 +1,403 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package server
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/webdav"
+
+	"gitlab.com/elixxir/remoteSyncServer/credentials"
+	"gitlab.com/elixxir/remoteSyncServer/store"
+)
+
+// Tests that webdavFS adheres to the webdav.FileSystem interface.
+var _ webdav.FileSystem = (*webdavFS)(nil)
+
+// Tests that webdavFile adheres to the webdav.File interface.
+var _ webdav.File = (*webdavFile)(nil)
+
+// Tests that webdavFileInfo adheres to the webdav.ContentTyper interface.
+var _ webdav.ContentTyper = (*webdavFileInfo)(nil)
+
+// newWebDAVTestHandler returns a webdavHandler with the params for a handler
+// with the user waldo, whose files are kept in memory across requests.
+func newWebDAVTestHandler(
+	t *testing.T, params map[string]interface{}) *webdavHandler {
+	ms, err := store.NewMemStore("", "waldo")
+	if err != nil {
+		t.Fatalf("Failed to create store: %+v", err)
+	}
+	return newWebDAVTestHandlerStore(t, params,
+		func(string, string) (store.Store, error) { return ms, nil })
+}
+
+// newWebDAVTestHandlerStore returns a webdavHandler with the params for a
+// handler with the user waldo, whose stores are created by newStore.
+func newWebDAVTestHandlerStore(t testing.TB, params map[string]interface{},
+	newStore store.NewStore) *webdavHandler {
+	users := credentials.NewMemStore(map[string]string{"waldo": "hunter2"})
+	h := newHandler("", time.Hour, users, nil, newStore)
+	wd, err := NewWebDAV(params)
+	if err != nil {
+		t.Fatalf("Failed to create WebDAV: %+v", err)
+	}
+	return &webdavHandler{h: h, wd: wd}
+}
+
+// serveWebDAV serves the request as waldo with the handler and returns the
+// response.
+func serveWebDAV(wh *webdavHandler, method, path string, body io.Reader,
+	header map[string]string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, webdavPathPrefix+path, body)
+	r.SetBasicAuth("waldo", "hunter2")
+	for key, value := range header {
+		r.Header.Set(key, value)
+	}
+	w := httptest.NewRecorder()
+	wh.ServeHTTP(w, r)
+	return w
+}
+
+// Tests that NewWebDAV decodes the parameters.
+func TestNewWebDAV(t *testing.T) {
+	wd, err := NewWebDAV(map[string]interface{}{"readWrite": "true"})
+	if err != nil {
+		t.Fatalf("Failed to create WebDAV: %+v", err)
+	}
+	if expected := (WebDAVParams{ReadWrite: true}); wd.Params() != expected {
+		t.Errorf("Unexpected parameters.\nexpected: %+v\nreceived: %+v",
+			expected, wd.Params())
+	}
+}
+
+// Error path: Tests that NewWebDAV returns an error for unknown parameters.
+func TestNewWebDAV_Error(t *testing.T) {
+	if _, err := NewWebDAV(map[string]interface{}{"unknown": 1}); err == nil {
+		t.Errorf("Failed to get error for unknown parameter.")
+	}
+}
+
+// Error path: Tests that CheckWebDAV returns an error when listeners serve
+// WebDAV while it is not enabled, and when it is enabled but not served.
+func TestCheckWebDAV_Error(t *testing.T) {
+	wd, _ := NewWebDAV(nil)
+	dav := []Listener{{Protocols: []string{ProtocolWebDAV}}}
+	other := []Listener{{Protocols: DefaultProtocols}}
+
+	if err := CheckWebDAV(wd, dav); err != nil {
+		t.Errorf("Failed to check served WebDAV: %+v", err)
+	}
+	if err := CheckWebDAV(nil, other); err != nil {
+		t.Errorf("Failed to check disabled WebDAV: %+v", err)
+	}
+	if err := CheckWebDAV(nil, dav); err == nil {
+		t.Errorf("Failed to get error for WebDAV listener when disabled.")
+	}
+	if err := CheckWebDAV(wd, other); err == nil {
+		t.Errorf("Failed to get error for WebDAV without a listener.")
+	}
+}
+
+// Tests that a read-only webdavHandler lists and reads the files of the user
+// and rejects writes.
+func Test_webdavHandler_ReadOnly(t *testing.T) {
+	wh := newWebDAVTestHandler(t, nil)
+	s, _ := wh.h.newStore("", "waldo")
+	if err := s.Write("docs/notes/a.txt", []byte("file data")); err != nil {
+		t.Fatalf("Failed to write file: %+v", err)
+	}
+
+	w := serveWebDAV(wh, "PROPFIND", "/docs/", nil,
+		map[string]string{"Depth": "1"})
+	if w.Code != http.StatusMultiStatus ||
+		!strings.Contains(w.Body.String(), webdavPathPrefix+"/docs/notes/") {
+		t.Errorf("Unexpected listing: %d %s", w.Code, w.Body)
+	}
+
+	w = serveWebDAV(wh, http.MethodGet, "/docs/notes/a.txt", nil, nil)
+	if w.Code != http.StatusOK || w.Body.String() != "file data" {
+		t.Errorf("Unexpected file read: %d %q", w.Code, w.Body)
+	}
+
+	w = serveWebDAV(wh, http.MethodGet, "/docs/missing.txt", nil, nil)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Unexpected status reading missing file: %d", w.Code)
+	}
+
+	for _, method := range []string{http.MethodPut, http.MethodDelete,
+		"MKCOL", "MOVE", "COPY", "PROPPATCH", "LOCK"} {
+		w = serveWebDAV(wh, method, "/docs/notes/a.txt",
+			strings.NewReader("new data"), nil)
+		if w.Code != http.StatusMethodNotAllowed {
+			t.Errorf("Unexpected status for %s: %d", method, w.Code)
+		}
+	}
+	if data, _ := s.Read("docs/notes/a.txt"); string(data) != "file data" {
+		t.Errorf("File modified by read-only WebDAV: %q", data)
+	}
+}
+
+// Tests that a read-write webdavHandler writes, moves, and deletes the files of
+// the user.
+func Test_webdavHandler_ReadWrite(t *testing.T) {
+	wh := newWebDAVTestHandler(t, map[string]interface{}{"readWrite": true})
+	s, _ := wh.h.newStore("", "waldo")
+
+	for _, path := range []string{"/docs/a.txt", "/docs/sub/b.txt"} {
+		w := serveWebDAV(wh, http.MethodPut, path,
+			strings.NewReader("data of "+path), nil)
+		if w.Code != http.StatusCreated {
+			t.Fatalf("Failed to write %s: %d %s", path, w.Code, w.Body)
+		}
+	}
+	w := serveWebDAV(wh, "MKCOL", "/empty", nil, nil)
+	if w.Code != http.StatusCreated {
+		t.Errorf("Failed to make directory: %d %s", w.Code, w.Body)
+	}
+
+	w = serveWebDAV(wh, "MOVE", "/docs", nil,
+		map[string]string{"Destination": webdavPathPrefix + "/moved"})
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Failed to move directory: %d %s", w.Code, w.Body)
+	}
+	files, _ := s.(store.Lister).ListFiles()
+	expected := []string{"moved/a.txt", "moved/sub/b.txt"}
+	if !reflect.DeepEqual(expected, files) {
+		t.Errorf("Unexpected files after move.\nexpected: %v\nreceived: %v",
+			expected, files)
+	}
+	if data, _ := s.Read("moved/sub/b.txt"); string(data) !=
+		"data of /docs/sub/b.txt" {
+		t.Errorf("Unexpected data of moved file: %q", data)
+	}
+
+	w = serveWebDAV(wh, http.MethodDelete, "/moved/sub", nil, nil)
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("Failed to delete directory: %d %s", w.Code, w.Body)
+	}
+	files, _ = s.(store.Lister).ListFiles()
+	if !reflect.DeepEqual([]string{"moved/a.txt"}, files) {
+		t.Errorf("Unexpected files after delete: %v", files)
+	}
+}
+
+// Tests that a read-write webdavHandler records the files it writes and deletes
+// in the audit log.
+func Test_webdavHandler_Audit(t *testing.T) {
+	wh := newWebDAVTestHandler(t, map[string]interface{}{"readWrite": true})
+	path := filepath.Join(t.TempDir(), "audit.log")
+	al, err := NewAuditLog(map[string]interface{}{"path": path})
+	if err != nil {
+		t.Fatalf("Failed to create audit log: %+v", err)
+	}
+	wh.audit = al
+
+	w := serveWebDAV(wh, http.MethodPut, "/a.txt", strings.NewReader("a"), nil)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Failed to write: %d %s", w.Code, w.Body)
+	}
+	w = serveWebDAV(wh, http.MethodDelete, "/a.txt", nil, nil)
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("Failed to delete: %d %s", w.Code, w.Body)
+	}
+	_ = al.Close()
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("Failed to open audit log: %+v", err)
+	}
+	defer func() { _ = f.Close() }()
+	var entries []AuditEntry
+	err = readAuditLog(f, func(_ int, entry AuditEntry) error {
+		entries = append(entries, entry)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Failed to read audit log: %+v", err)
+	} else if len(entries) != 2 {
+		t.Fatalf("Unexpected number of entries: %+v", entries)
+	}
+	for _, entry := range entries {
+		if entry.User != "waldo" || entry.Operation != AuditWrite ||
+			entry.Path != "a.txt" || entry.Result != "OK" {
+			t.Errorf("Unexpected entry: %+v", entry)
+		}
+	}
+}
+
+// Tests that webdavFS.commit applies several operations while holding the lock
+// of the user's writes for writing, so that they wait for writes in progress.
+func Test_webdavFS_commit_Lock(t *testing.T) {
+	wh := newWebDAVTestHandler(t, map[string]interface{}{"readWrite": true})
+	s, _ := wh.h.newStore("", "waldo")
+	fs := &webdavFS{h: wh.h, s: s, username: "waldo", readWrite: true}
+
+	l := wh.h.locks.get("waldo")
+	l.RLock()
+	done := make(chan error)
+	go func() {
+		done <- fs.commit([]TransactionOp{
+			{Path: "a", Data: []byte("a")}, {Path: "b", Data: []byte("b")}})
+	}()
+	select {
+	case err := <-done:
+		t.Fatalf("Operations applied during a write: %+v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+	l.RUnlock()
+	if err := <-done; err != nil {
+		t.Errorf("Failed to commit: %+v", err)
+	}
+}
+
+// Tests that webdavFS.Stat and OpenFile find a file without listing the files
+// of the user, and that directories are found from the listing.
+func Test_webdavFS_Stat(t *testing.T) {
+	ms, _ := store.NewMemStore("", "waldo")
+	if err := ms.Write("dir/a.txt", []byte("data")); err != nil {
+		t.Fatalf("Failed to write: %+v", err)
+	}
+
+	// A store without ListFiles fails for anything that lists files
+	fs := &webdavFS{s: struct{ store.Store }{ms}, username: "waldo"}
+	info, err := fs.Stat(context.Background(), "/dir/a.txt")
+	if err != nil {
+		t.Fatalf("Failed to stat file: %+v", err)
+	} else if info.IsDir() || info.Size() != 4 || info.Name() != "a.txt" {
+		t.Errorf("Unexpected file info: %+v", info)
+	}
+	f, err := fs.OpenFile(context.Background(), "/dir/a.txt", os.O_RDONLY, 0)
+	if err != nil {
+		t.Fatalf("Failed to open file: %+v", err)
+	}
+	_ = f.Close()
+
+	fs = &webdavFS{s: ms, username: "waldo"}
+	if info, err = fs.Stat(context.Background(), "/dir"); err != nil {
+		t.Fatalf("Failed to stat directory: %+v", err)
+	} else if !info.IsDir() {
+		t.Errorf("Directory is not a directory: %+v", info)
+	}
+	_, err = fs.Stat(context.Background(), "/missing")
+	if !os.IsNotExist(err) {
+		t.Errorf("Unexpected error for missing file: %+v", err)
+	}
+}
+
+// Tests that WebDAV.authenticate accepts the password verified last without
+// verifying it again and verifies other and changed passwords.
+func TestWebDAV_authenticate(t *testing.T) {
+	wh := newWebDAVTestHandler(t, nil)
+
+	if err := wh.wd.authenticate(wh.h, "waldo", "hunter2"); err != nil {
+		t.Fatalf("Failed to authenticate: %+v", err)
+	}
+	if _, exists := wh.wd.sessions["waldo"]; !exists {
+		t.Errorf("Session of authenticated user not kept.")
+	}
+	if err := wh.wd.authenticate(wh.h, "waldo", "hunter2"); err != nil {
+		t.Errorf("Failed to authenticate again: %+v", err)
+	}
+	err := wh.wd.authenticate(wh.h, "waldo", "wrong")
+	if !errors.Is(err, InvalidCredentialsErr) {
+		t.Errorf("Unexpected error for wrong password."+
+			"\nexpected: %v\nreceived: %+v", InvalidCredentialsErr, err)
+	}
+
+	// A changed password is verified again
+	if err = wh.h.users.Set("waldo", "changed"); err != nil {
+		t.Fatalf("Failed to change password: %+v", err)
+	}
+	err = wh.wd.authenticate(wh.h, "waldo", "hunter2")
+	if !errors.Is(err, InvalidCredentialsErr) {
+		t.Errorf("Unexpected error for old password."+
+			"\nexpected: %v\nreceived: %+v", InvalidCredentialsErr, err)
+	}
+
+	// An expired session is verified again
+	if err = wh.wd.authenticate(wh.h, "waldo", "changed"); err != nil {
+		t.Fatalf("Failed to authenticate: %+v", err)
+	}
+	session := wh.wd.sessions["waldo"]
+	session.expires = time.Now()
+	wh.wd.sessions["waldo"] = session
+	if err = wh.h.users.Delete("waldo"); err != nil {
+		t.Fatalf("Failed to delete user: %+v", err)
+	}
+	err = wh.wd.authenticate(wh.h, "waldo", "changed")
+	if !errors.Is(err, InvalidCredentialsErr) {
+		t.Errorf("Unexpected error for deleted user."+
+			"\nexpected: %v\nreceived: %+v", InvalidCredentialsErr, err)
+	}
+}
+
+// Error path: Tests that webdavHandler challenges requests without the
+// credentials of the user and rejects files over the maximum object size.
+func Test_webdavHandler_Error(t *testing.T) {
+	wh := newWebDAVTestHandler(t, map[string]interface{}{"readWrite": true})
+
+	w := httptest.NewRecorder()
+	wh.ServeHTTP(w, httptest.NewRequest("PROPFIND", webdavPathPrefix, nil))
+	if w.Code != http.StatusUnauthorized ||
+		w.Header().Get("WWW-Authenticate") == "" {
+		t.Errorf("Unexpected response without credentials: %d %v",
+			w.Code, w.Header())
+	}
+
+	r := httptest.NewRequest("PROPFIND", webdavPathPrefix, nil)
+	r.SetBasicAuth("waldo", "wrong")
+	w = httptest.NewRecorder()
+	wh.ServeHTTP(w, r)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("Unexpected status for wrong password: %d", w.Code)
+	}
+
+	wh.h.limits = &Limits{MaxObjectBytes: 4}
+	w = serveWebDAV(wh, http.MethodPut, "/a.txt",
+		strings.NewReader("too large"), nil)
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Unexpected status for large file: %d %s", w.Code, w.Body)
+	}
+}
+
+// Benchmarks webdavHandler.ServeHTTP serving a large file of the local
+// filesystem by streaming it and by reading it into memory.
+func Benchmark_webdavHandler_Get(b *testing.B) {
+	for _, bs := range benchmarkStores {
+		b.Run(bs.name, func(b *testing.B) {
+			wh := newWebDAVTestHandlerStore(
+				b, nil, newBenchmarkStore(b, bs.streaming))
+			r := httptest.NewRequest(
+				http.MethodGet, webdavPathPrefix+"/large", nil)
+			r.SetBasicAuth("waldo", "hunter2")
+
+			b.ReportAllocs()
+			b.SetBytes(benchmarkFileSize)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				w := newDiscardResponseWriter()
+				wh.ServeHTTP(w, r)
+				if w.code != http.StatusOK {
+					b.Fatalf("Unexpected status.\nexpected: %d\nreceived: %d",
+						http.StatusOK, w.code)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,77 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package storage
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	// UnknownBackendErr is returned when no storage backend has been
+	// registered with the requested name.
+	UnknownBackendErr = errors.New("unknown storage backend")
+)
+
+// Backend initialises a storage backend from its backend-specific parameters
+// and returns the NewStore used to create the Store for each user.
+type Backend func(params map[string]interface{}) (NewStore, error)
+
+// registry contains all registered storage backends keyed on their name.
+var registry = struct {
+	backends map[string]Backend
+	mux      sync.RWMutex
+}{backends: make(map[string]Backend)}
+
+// RegisterBackend makes a storage backend available under the given name so
+// that it can be selected in the configuration. Panics if the backend is nil
+// or if a backend with the same name is already registered.
+func RegisterBackend(name string, backend Backend) {
+	registry.mux.Lock()
+	defer registry.mux.Unlock()
+
+	if backend == nil {
+		panic("cannot register nil storage backend " + name)
+	} else if _, exists := registry.backends[name]; exists {
+		panic("storage backend " + name + " already registered")
+	}
+
+	registry.backends[name] = backend
+}
+
+// GetBackend returns the storage backend registered with the given name.
+//
+// Returns [UnknownBackendErr] if no backend is registered with the name.
+func GetBackend(name string) (Backend, error) {
+	registry.mux.RLock()
+	defer registry.mux.RUnlock()
+
+	backend, exists := registry.backends[name]
+	if !exists {
+		return nil, errors.Wrapf(UnknownBackendErr, "%q", name)
+	}
+
+	return backend, nil
+}
+
+// Backends returns a sorted list of the names of all registered storage
+// backends.
+func Backends() []string {
+	registry.mux.RLock()
+	defer registry.mux.RUnlock()
+
+	names := make([]string, 0, len(registry.backends))
+	for name := range registry.backends {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
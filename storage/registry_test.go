@@ -0,0 +1,95 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package storage
+
+import (
+	"sort"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+// testBackend is a Backend whose stores are never created.
+func testBackend(map[string]interface{}) (NewStore, error) {
+	return func(string, string) (Store, error) { return nil, nil }, nil
+}
+
+// Tests that a backend registered with RegisterBackend can be retrieved with
+// GetBackend and is listed by Backends.
+func TestRegisterBackend(t *testing.T) {
+	names := []string{"TestRegisterBackend_B", "TestRegisterBackend_A"}
+	for _, name := range names {
+		RegisterBackend(name, testBackend)
+	}
+	defer func() {
+		registry.mux.Lock()
+		for _, name := range names {
+			delete(registry.backends, name)
+		}
+		registry.mux.Unlock()
+	}()
+
+	for _, name := range names {
+		backend, err := GetBackend(name)
+		if err != nil {
+			t.Errorf("Failed to get registered backend %q: %+v", name, err)
+		} else if newStore, err := backend(nil); err != nil || newStore == nil {
+			t.Errorf("Backend %q returned no NewStore: %+v", name, err)
+		}
+	}
+
+	list := Backends()
+	if !sort.StringsAreSorted(list) {
+		t.Errorf("Backend list is not sorted: %s", list)
+	}
+	for _, expected := range names {
+		i := sort.SearchStrings(list, expected)
+		if i == len(list) || list[i] != expected {
+			t.Errorf("Backend %q not in list: %s", expected, list)
+		}
+	}
+}
+
+// Error path: Tests that GetBackend returns UnknownBackendErr for a backend
+// that has not been registered.
+func TestGetBackend_UnknownBackendError(t *testing.T) {
+	_, err := GetBackend("unknown")
+	if !errors.Is(err, UnknownBackendErr) {
+		t.Errorf("Unexpected error for unknown backend."+
+			"\nexpected: %v\nreceived: %v", UnknownBackendErr, err)
+	}
+}
+
+// Error path: Tests that RegisterBackend panics when registering a backend
+// with a name that is already in use.
+func TestRegisterBackend_DuplicatePanic(t *testing.T) {
+	name := "TestRegisterBackend_DuplicatePanic"
+	RegisterBackend(name, testBackend)
+	defer func() {
+		registry.mux.Lock()
+		delete(registry.backends, name)
+		registry.mux.Unlock()
+		if r := recover(); r == nil {
+			t.Errorf("Failed to panic for duplicate backend.")
+		}
+	}()
+
+	RegisterBackend(name, testBackend)
+}
+
+// Error path: Tests that RegisterBackend panics when registering a nil
+// backend.
+func TestRegisterBackend_NilPanic(t *testing.T) {
+	defer func() {
+		if r := recover(); r == nil {
+			t.Errorf("Failed to panic for nil backend.")
+		}
+	}()
+
+	RegisterBackend("TestRegisterBackend_NilPanic", nil)
+}
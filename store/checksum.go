@@ -0,0 +1,136 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package store
+
+import (
+	"bytes"
+	"crypto/sha256"
+
+	"github.com/pkg/errors"
+)
+
+// checksumMagic is the prefix of all files written by a ChecksumStore. It is
+// followed by the SHA-256 hash of the data and the data. Files without this
+// prefix were stored before checksums were enabled and are read unchanged.
+var checksumMagic = []byte("RSSH\x01")
+
+// checksumHeaderLen is the length of the prefix of a file with a checksum.
+const checksumHeaderLen = 5 + sha256.Size
+
+var (
+	// CorruptedErr is returned when the stored data of a file does not match
+	// the checksum stored with it.
+	CorruptedErr = errors.New("stored data does not match its checksum")
+)
+
+// ChecksumStore stores a SHA-256 checksum with each file of an underlying
+// Store and verifies it whenever the file is read, so that data corrupted in
+// storage is detected instead of returned. Files written before checksums were
+// enabled are read unverified until they are written again.
+//
+// Sizes reported by the store include the checksums. Adheres to the Store
+// interface.
+type ChecksumStore struct {
+	Store
+}
+
+// NewChecksumStore returns a NewStore that wraps each Store created by newStore
+// in a ChecksumStore.
+func NewChecksumStore(newStore NewStore) NewStore {
+	return func(storageDir, baseDir string) (Store, error) {
+		s, err := newStore(storageDir, baseDir)
+		if err != nil {
+			return nil, err
+		}
+		return &ChecksumStore{Store: s}, nil
+	}
+}
+
+// Read reads the file at the path from the underlying store and verifies its
+// checksum.
+//
+// Returns [CorruptedErr] if the data does not match the checksum.
+func (cs *ChecksumStore) Read(path string) ([]byte, error) {
+	data, _, err := cs.read(path)
+	return data, err
+}
+
+// Write writes the data with its checksum to the file at the path in the
+// underlying store.
+func (cs *ChecksumStore) Write(path string, data []byte) error {
+	checksum := sha256.Sum256(data)
+	buf := make([]byte, 0, checksumHeaderLen+len(data))
+	buf = append(buf, checksumMagic...)
+	buf = append(buf, checksum[:]...)
+	return cs.Store.Write(path, append(buf, data...))
+}
+
+// Verify reads the file at the path and verifies its checksum. Returns the
+// size of the stored file and false if the file has no checksum.
+//
+// Returns [CorruptedErr] if the data does not match the checksum.
+func (cs *ChecksumStore) Verify(path string) (int64, bool, error) {
+	data, checked, err := cs.read(path)
+	if err != nil {
+		return 0, false, err
+	} else if checked {
+		return int64(checksumHeaderLen + len(data)), true, nil
+	}
+	return int64(len(data)), false, nil
+}
+
+// ListFiles returns the paths of all files in the underlying store. Returns an
+// error if the underlying store does not implement Lister.
+func (cs *ChecksumStore) ListFiles() ([]string, error) {
+	lister, ok := cs.Store.(Lister)
+	if !ok {
+		return nil, NotListableErr
+	}
+	return lister.ListFiles()
+}
+
+// Size returns the total size of the files in the underlying store. Returns an
+// error if the underlying store does not implement Sizer.
+func (cs *ChecksumStore) Size() (int64, error) {
+	sizer, ok := cs.Store.(Sizer)
+	if !ok {
+		return 0, errors.New("underlying store cannot report its size")
+	}
+	return sizer.Size()
+}
+
+// Ping returns an error if the underlying store cannot be reached. Stores that
+// do not implement Pinger are assumed to be reachable.
+func (cs *ChecksumStore) Ping() error {
+	if pinger, ok := cs.Store.(Pinger); ok {
+		return pinger.Ping()
+	}
+	return nil
+}
+
+// read returns the data of the file at the path without its checksum, and
+// whether it had a checksum that was verified.
+func (cs *ChecksumStore) read(path string) ([]byte, bool, error) {
+	data, err := cs.Store.Read(path)
+	if err != nil {
+		return nil, false, err
+	} else if !bytes.HasPrefix(data, checksumMagic) {
+		return data, false, nil
+	} else if len(data) < checksumHeaderLen {
+		return nil, false, errors.Wrapf(
+			CorruptedErr, "%s is truncated to %d bytes", path, len(data))
+	}
+
+	stored := data[len(checksumMagic):checksumHeaderLen]
+	data = data[checksumHeaderLen:]
+	if checksum := sha256.Sum256(data); !bytes.Equal(stored, checksum[:]) {
+		return nil, false, errors.Wrapf(
+			CorruptedErr, "%s: %x != %x", path, checksum, stored)
+	}
+	return data, true, nil
+}
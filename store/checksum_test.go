@@ -0,0 +1,100 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package store
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+// Tests that ChecksumStore adheres to the Store interface.
+var _ Store = (*ChecksumStore)(nil)
+
+// Tests that ChecksumStore adheres to the Lister interface.
+var _ Lister = (*ChecksumStore)(nil)
+
+// Tests that ChecksumStore adheres to the Sizer interface.
+var _ Sizer = (*ChecksumStore)(nil)
+
+// newTestChecksumStore returns a ChecksumStore that wraps the MemStore.
+func newTestChecksumStore(ms Store, t *testing.T) *ChecksumStore {
+	s, err := NewChecksumStore(
+		func(string, string) (Store, error) { return ms, nil })("", "user")
+	if err != nil {
+		t.Fatalf("Failed to create store: %+v", err)
+	}
+	return s.(*ChecksumStore)
+}
+
+// Tests that data written to a ChecksumStore is stored with its checksum, is
+// read back unchanged, and is verified.
+func TestChecksumStore_Write_Read(t *testing.T) {
+	ms, _ := NewMemStore("", "")
+	cs := newTestChecksumStore(ms, t)
+	data := []byte("transaction log entry")
+	if err := cs.Write("file", data); err != nil {
+		t.Fatalf("Failed to write: %+v", err)
+	}
+
+	stored, _ := ms.Read("file")
+	if !bytes.HasPrefix(stored, checksumMagic) ||
+		len(stored) != checksumHeaderLen+len(data) {
+		t.Errorf("File stored without checksum: %q", stored)
+	}
+	if read, err := cs.Read("file"); err != nil || !bytes.Equal(read, data) {
+		t.Errorf("Unexpected data.\nexpected: %q\nreceived: %q (%v)",
+			data, read, err)
+	}
+	size, checked, err := cs.Verify("file")
+	if err != nil || !checked || size != int64(len(stored)) {
+		t.Errorf("Unexpected verification: %d bytes, checked %t (%v)",
+			size, checked, err)
+	}
+}
+
+// Tests that files stored without a checksum are read unchanged and are not
+// verified.
+func TestChecksumStore_Read_Unchecked(t *testing.T) {
+	ms, _ := NewMemStore("", "")
+	cs := newTestChecksumStore(ms, t)
+	data := []byte("stored before checksums")
+	_ = ms.Write("file", data)
+
+	if read, err := cs.Read("file"); err != nil || !bytes.Equal(read, data) {
+		t.Errorf("Unexpected data.\nexpected: %q\nreceived: %q (%v)",
+			data, read, err)
+	}
+	size, checked, err := cs.Verify("file")
+	if err != nil || checked || size != int64(len(data)) {
+		t.Errorf("Unexpected verification: %d bytes, checked %t (%v)",
+			size, checked, err)
+	}
+}
+
+// Error path: Tests that ChecksumStore.Read and ChecksumStore.Verify return
+// CorruptedErr for data that changed or was truncated in storage.
+func TestChecksumStore_CorruptedError(t *testing.T) {
+	ms, _ := NewMemStore("", "")
+	cs := newTestChecksumStore(ms, t)
+	_ = cs.Write("changed", []byte("data"))
+	stored, _ := ms.Read("changed")
+	stored[len(stored)-1] ^= 1
+	_ = ms.Write("changed", stored)
+	_ = ms.Write("truncated", stored[:checksumHeaderLen-1])
+
+	for _, path := range []string{"changed", "truncated"} {
+		if _, err := cs.Read(path); !errors.Is(err, CorruptedErr) {
+			t.Errorf("Unexpected error reading %s: %+v", path, err)
+		}
+		if _, _, err := cs.Verify(path); !errors.Is(err, CorruptedErr) {
+			t.Errorf("Unexpected error verifying %s: %+v", path, err)
+		}
+	}
+}
@@ -0,0 +1,258 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package store
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/pkg/errors"
+	jww "github.com/spf13/jwalterweatherman"
+)
+
+// Names of the compression algorithms.
+const (
+	ZstdCompression = "zstd"
+	GzipCompression = "gzip"
+)
+
+// Default values for CompressionParams.
+const (
+	defaultCompressionAlgorithm = ZstdCompression
+	defaultCompressionMinSize   = 512
+)
+
+// IDs of the compression algorithms stored after compressedMagic. Data stored
+// uncompressed that starts with compressedMagic is prefixed with
+// noCompression so that it is not mistaken for compressed data.
+const (
+	noCompression byte = iota
+	zstdCompression
+	gzipCompression
+)
+
+// compressedMagic is the prefix of all compressed data. It is followed by the
+// ID of the algorithm and the compressed data. Data without this prefix was
+// stored uncompressed and is read unchanged.
+var compressedMagic = []byte("RSSC\x01")
+
+// CompressionParams contains the parameters of the compression of stored
+// files. They are set in the "compression" section of the config.
+type CompressionParams struct {
+	// Algorithm is the algorithm new data is compressed with, either "zstd"
+	// or "gzip". Defaults to zstd. Files compressed with either algorithm can
+	// always be read.
+	Algorithm string `mapstructure:"algorithm"`
+
+	// Level is the compression level of the algorithm, from 1 to 22 for zstd
+	// and from 1 to 9 for gzip. The default level of the algorithm is used if
+	// it is zero.
+	Level int `mapstructure:"level"`
+
+	// MinSize is the size, in bytes, below which files are stored
+	// uncompressed. Defaults to 512.
+	MinSize int `mapstructure:"minSize"`
+}
+
+// CompressedStore compresses the files of an underlying Store. The algorithm
+// is stored with each file, so that files remain readable after the algorithm
+// changes. Files smaller than the minimum size, or that do not get smaller
+// when compressed, are stored uncompressed.
+//
+// Sizes reported by the store are the compressed sizes. Adheres to the Store
+// interface.
+type CompressedStore struct {
+	Store
+	params  CompressionParams
+	encoder *zstd.Encoder
+	decoder *zstd.Decoder
+}
+
+// NewCompressedStore returns a NewStore that wraps each Store created by
+// newStore in a CompressedStore with the parameters.
+func NewCompressedStore(
+	params map[string]interface{}, newStore NewStore) (NewStore, error) {
+	p := CompressionParams{
+		Algorithm: defaultCompressionAlgorithm,
+		MinSize:   defaultCompressionMinSize,
+	}
+	if err := decodeParams(params, &p); err != nil {
+		return nil, err
+	} else if p.MinSize < 0 {
+		return nil, errors.Errorf(
+			"minimum compressed size %d cannot be negative", p.MinSize)
+	}
+
+	// The zstd encoder and decoder are safe for concurrent use with
+	// EncodeAll and DecodeAll, so they are shared by all stores
+	level := zstd.SpeedDefault
+	switch p.Algorithm {
+	case ZstdCompression:
+		if p.Level < 0 || p.Level > 22 {
+			return nil, errors.Errorf(
+				"zstd compression level %d must be 1 to 22", p.Level)
+		} else if p.Level > 0 {
+			level = zstd.EncoderLevelFromZstd(p.Level)
+		}
+	case GzipCompression:
+		if p.Level < 0 || p.Level > gzip.BestCompression {
+			return nil, errors.Errorf(
+				"gzip compression level %d must be 1 to 9", p.Level)
+		}
+	default:
+		return nil, errors.Errorf("unknown compression algorithm %q "+
+			"(available: %s, %s)", p.Algorithm, ZstdCompression,
+			GzipCompression)
+	}
+	encoder, err := zstd.NewWriter(nil, zstd.WithEncoderLevel(level))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create zstd encoder")
+	}
+	decoder, err := zstd.NewReader(nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create zstd decoder")
+	}
+
+	jww.INFO.Printf("Compressing stored files of at least %d bytes with %s.",
+		p.MinSize, p.Algorithm)
+
+	return func(storageDir, baseDir string) (Store, error) {
+		s, err := newStore(storageDir, baseDir)
+		if err != nil {
+			return nil, err
+		}
+		return &CompressedStore{
+			Store: s, params: p, encoder: encoder, decoder: decoder,
+		}, nil
+	}, nil
+}
+
+// Read reads the file at the path from the underlying store and decompresses
+// it. Files that are not compressed are returned unchanged.
+func (cs *CompressedStore) Read(path string) ([]byte, error) {
+	data, err := cs.Store.Read(path)
+	if err != nil {
+		return nil, err
+	}
+	return cs.decompress(path, data)
+}
+
+// Write compresses the data and writes it to the file at the path in the
+// underlying store.
+func (cs *CompressedStore) Write(path string, data []byte) error {
+	compressed, err := cs.compress(data)
+	if err != nil {
+		return errors.Wrapf(err, "failed to compress %s", path)
+	}
+	return cs.Store.Write(path, compressed)
+}
+
+// ListFiles returns the paths of all files in the underlying store. Returns an
+// error if the underlying store does not implement Lister.
+func (cs *CompressedStore) ListFiles() ([]string, error) {
+	lister, ok := cs.Store.(Lister)
+	if !ok {
+		return nil, errors.New("underlying store cannot list its files")
+	}
+	return lister.ListFiles()
+}
+
+// Size returns the total size of the compressed files in the underlying store.
+// Returns an error if the underlying store does not implement Sizer.
+func (cs *CompressedStore) Size() (int64, error) {
+	sizer, ok := cs.Store.(Sizer)
+	if !ok {
+		return 0, errors.New("underlying store cannot report its size")
+	}
+	return sizer.Size()
+}
+
+// Ping returns an error if the underlying store cannot be reached. Stores that
+// do not implement Pinger are assumed to be reachable.
+func (cs *CompressedStore) Ping() error {
+	if pinger, ok := cs.Store.(Pinger); ok {
+		return pinger.Ping()
+	}
+	return nil
+}
+
+// compress returns the data compressed with the algorithm, or unchanged if it
+// is smaller than the minimum size or does not get smaller.
+func (cs *CompressedStore) compress(data []byte) ([]byte, error) {
+	if len(data) >= cs.params.MinSize {
+		buf := bytes.NewBuffer(make([]byte, 0, len(data)))
+		buf.Write(compressedMagic)
+		switch cs.params.Algorithm {
+		case ZstdCompression:
+			buf.WriteByte(zstdCompression)
+			buf.Write(cs.encoder.EncodeAll(data, nil))
+		case GzipCompression:
+			buf.WriteByte(gzipCompression)
+			level := cs.params.Level
+			if level == 0 {
+				level = gzip.DefaultCompression
+			}
+			w, err := gzip.NewWriterLevel(buf, level)
+			if err != nil {
+				return nil, err
+			}
+			if _, err = w.Write(data); err != nil {
+				return nil, err
+			} else if err = w.Close(); err != nil {
+				return nil, err
+			}
+		}
+		if buf.Len() < len(data) {
+			return buf.Bytes(), nil
+		}
+	}
+
+	if bytes.HasPrefix(data, compressedMagic) {
+		prefixed := make([]byte, 0, len(compressedMagic)+1+len(data))
+		prefixed = append(prefixed, compressedMagic...)
+		prefixed = append(prefixed, noCompression)
+		return append(prefixed, data...), nil
+	}
+	return data, nil
+}
+
+// decompress returns the data of the file at the path decompressed with the
+// algorithm it was compressed with. Data that is not compressed is returned
+// unchanged.
+func (cs *CompressedStore) decompress(
+	path string, data []byte) ([]byte, error) {
+	if !bytes.HasPrefix(data, compressedMagic) ||
+		len(data) < len(compressedMagic)+1 {
+		return data, nil
+	}
+
+	algorithm := data[len(compressedMagic)]
+	data = data[len(compressedMagic)+1:]
+	var decompressed []byte
+	var err error
+	switch algorithm {
+	case noCompression:
+		return data, nil
+	case zstdCompression:
+		decompressed, err = cs.decoder.DecodeAll(data, nil)
+	case gzipCompression:
+		var r *gzip.Reader
+		if r, err = gzip.NewReader(bytes.NewReader(data)); err == nil {
+			decompressed, err = io.ReadAll(r)
+		}
+	default:
+		return nil, errors.Errorf(
+			"%s is compressed with unknown algorithm %d", path, algorithm)
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to decompress %s", path)
+	}
+	return decompressed, nil
+}
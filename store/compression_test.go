@@ -0,0 +1,118 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package store
+
+import (
+	"bytes"
+	"crypto/rand"
+	"testing"
+)
+
+// Tests that CompressedStore adheres to the Store interface.
+var _ Store = (*CompressedStore)(nil)
+
+// Tests that CompressedStore adheres to the Lister interface.
+var _ Lister = (*CompressedStore)(nil)
+
+// Tests that CompressedStore adheres to the Sizer interface.
+var _ Sizer = (*CompressedStore)(nil)
+
+// newTestCompressedStore returns a CompressedStore with the parameters that
+// wraps the MemStore.
+func newTestCompressedStore(params map[string]interface{}, ms Store,
+	t *testing.T) *CompressedStore {
+	newStore, err := NewCompressedStore(params,
+		func(string, string) (Store, error) { return ms, nil })
+	if err != nil {
+		t.Fatalf("Failed to create compressed store: %+v", err)
+	}
+	s, err := newStore("", "user")
+	if err != nil {
+		t.Fatalf("Failed to create store: %+v", err)
+	}
+	return s.(*CompressedStore)
+}
+
+// Tests that data written to a CompressedStore with each algorithm is
+// compressed in the underlying store and read back unchanged, including after
+// the algorithm changes.
+func TestCompressedStore_Write_Read(t *testing.T) {
+	ms, _ := NewMemStore("", "")
+	data := bytes.Repeat([]byte("transaction log entry\n"), 100)
+	for _, algorithm := range []string{ZstdCompression, GzipCompression} {
+		cs := newTestCompressedStore(
+			map[string]interface{}{"algorithm": algorithm}, ms, t)
+		if err := cs.Write(algorithm, data); err != nil {
+			t.Fatalf("Failed to write %s file: %+v", algorithm, err)
+		}
+		stored, _ := ms.Read(algorithm)
+		if !bytes.HasPrefix(stored, compressedMagic) ||
+			len(stored) >= len(data)/4 {
+			t.Errorf("%s file not compressed: %d bytes", algorithm,
+				len(stored))
+		}
+	}
+
+	cs := newTestCompressedStore(nil, ms, t)
+	for _, algorithm := range []string{ZstdCompression, GzipCompression} {
+		if read, err := cs.Read(algorithm); err != nil {
+			t.Errorf("Failed to read %s file: %+v", algorithm, err)
+		} else if !bytes.Equal(read, data) {
+			t.Errorf("Unexpected data of %s file.\nexpected: %q\nreceived: %q",
+				algorithm, data, read)
+		}
+	}
+}
+
+// Tests that files that are smaller than the minimum size or incompressible
+// are stored uncompressed, and that uncompressed data starting with the magic
+// prefix is read back unchanged.
+func TestCompressedStore_Write_Uncompressed(t *testing.T) {
+	ms, _ := NewMemStore("", "")
+	cs := newTestCompressedStore(map[string]interface{}{"minSize": 64}, ms, t)
+	random := make([]byte, 1024)
+	_, _ = rand.Read(random)
+	files := map[string][]byte{
+		"small":  bytes.Repeat([]byte("a"), 63),
+		"random": random,
+		"magic":  append(append([]byte{}, compressedMagic...), 2, 3),
+	}
+
+	for path, data := range files {
+		if err := cs.Write(path, data); err != nil {
+			t.Fatalf("Failed to write %s: %+v", path, err)
+		}
+		stored, _ := ms.Read(path)
+		if path != "magic" && !bytes.Equal(stored, data) {
+			t.Errorf("%s stored compressed: %q", path, stored)
+		}
+		if read, err := cs.Read(path); err != nil {
+			t.Errorf("Failed to read %s: %+v", path, err)
+		} else if !bytes.Equal(read, data) {
+			t.Errorf("Unexpected data of %s.\nexpected: %q\nreceived: %q",
+				path, data, read)
+		}
+	}
+}
+
+// Error path: Tests that NewCompressedStore returns an error for invalid
+// parameters.
+func TestNewCompressedStore_Error(t *testing.T) {
+	tests := map[string]map[string]interface{}{
+		"unknown algorithm": {"algorithm": "lz4"},
+		"zstd level":        {"algorithm": "zstd", "level": 23},
+		"gzip level":        {"algorithm": "gzip", "level": 10},
+		"negative minSize":  {"minSize": -1},
+		"unknown key":       {"compression": "zstd"},
+	}
+	for name, params := range tests {
+		if _, err := NewCompressedStore(params, NewMemStore); err == nil {
+			t.Errorf("Failed to get error for %s.", name)
+		}
+	}
+}
@@ -0,0 +1,116 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package store
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Encrypted config values are the base64 nonce and AES-GCM ciphertext of the
+// value between EncryptedValuePrefix and encryptedValueSuffix, such as
+// "ENC[q2x...]".
+const (
+	EncryptedValuePrefix = "ENC["
+	encryptedValueSuffix = "]"
+)
+
+// configAdditionalData is authenticated with every encrypted config value, so
+// that stored files and config values cannot be swapped.
+var configAdditionalData = []byte("remoteSyncServer config value")
+
+// ConfigCipher encrypts and decrypts config values with a master key.
+type ConfigCipher struct {
+	aead cipher.AEAD
+}
+
+// NewConfigCipher creates a new ConfigCipher with the 32-byte key, which is
+// either raw or encoded in hex or base64.
+func NewConfigCipher(key []byte) (*ConfigCipher, error) {
+	key = decodeEncryptionKey(key)
+	if len(key) != encryptionKeyLen {
+		return nil, errors.Errorf("config key is %d bytes; expected %d",
+			len(key), encryptionKeyLen)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create cipher")
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create AES-GCM")
+	}
+	return &ConfigCipher{aead: aead}, nil
+}
+
+// Encrypt returns the value encrypted for the config, such as "ENC[q2x...]".
+func (cc *ConfigCipher) Encrypt(value string) (string, error) {
+	nonce := make([]byte, cc.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", errors.Wrap(err, "failed to generate nonce")
+	}
+	sealed := cc.aead.Seal(nonce, nonce, []byte(value), configAdditionalData)
+	return EncryptedValuePrefix + base64.StdEncoding.EncodeToString(sealed) +
+		encryptedValueSuffix, nil
+}
+
+// Decrypt returns the value of the encrypted config value. Returns an error
+// if it is not an encrypted value or was encrypted with another key.
+func (cc *ConfigCipher) Decrypt(encrypted string) (string, error) {
+	if !isEncryptedValue(encrypted) {
+		return "", errors.New("value is not of the form ENC[...]")
+	}
+	sealed, err := base64.StdEncoding.DecodeString(strings.TrimSuffix(
+		strings.TrimPrefix(encrypted, EncryptedValuePrefix),
+		encryptedValueSuffix))
+	if err != nil {
+		return "", errors.Wrap(err, "invalid encrypted value")
+	} else if len(sealed) < cc.aead.NonceSize() {
+		return "", errors.New("encrypted value is truncated")
+	}
+	value, err := cc.aead.Open(nil, sealed[:cc.aead.NonceSize()],
+		sealed[cc.aead.NonceSize():], configAdditionalData)
+	if err != nil {
+		return "", errors.New(
+			"failed to decrypt value: wrong config key or corrupted value")
+	}
+	return string(value), nil
+}
+
+// Resolve returns the encrypted values of the config, at any depth of its
+// sections and lists, decrypted. Only the sections that contain encrypted
+// values are returned, with only the options that do, and lists are returned
+// whole. Returns an error if the config has encrypted values and the
+// ConfigCipher is nil.
+func (cc *ConfigCipher) Resolve(
+	config map[string]interface{}) (map[string]interface{}, error) {
+	return replaceConfig(config, cc.replace)
+}
+
+// replace returns the decrypted value and true if the value is encrypted.
+func (cc *ConfigCipher) replace(value string) (string, bool, error) {
+	if !isEncryptedValue(value) {
+		return value, false, nil
+	} else if cc == nil {
+		return "", true, errors.New(
+			"value is encrypted but no config key is set")
+	}
+	decrypted, err := cc.Decrypt(value)
+	return decrypted, true, err
+}
+
+// isEncryptedValue returns true if the config value is of the form ENC[...].
+func isEncryptedValue(value string) bool {
+	return strings.HasPrefix(value, EncryptedValuePrefix) &&
+		strings.HasSuffix(value, encryptedValueSuffix)
+}
@@ -0,0 +1,120 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package store
+
+import (
+	"bytes"
+	"encoding/base64"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// newTestConfigCipher returns a ConfigCipher with a key of repeated bytes.
+func newTestConfigCipher(t *testing.T, b byte) *ConfigCipher {
+	cc, err := NewConfigCipher(bytes.Repeat([]byte{b}, encryptionKeyLen))
+	if err != nil {
+		t.Fatalf("Failed to create config cipher: %+v", err)
+	}
+	return cc
+}
+
+// Tests that NewConfigCipher accepts raw, hex, and base64 keys and that values
+// encrypted with ConfigCipher.Encrypt are decrypted by ConfigCipher.Decrypt
+// with the same key.
+func TestConfigCipher_EncryptDecrypt(t *testing.T) {
+	key := bytes.Repeat([]byte{7}, encryptionKeyLen)
+	encrypted, err := newTestConfigCipher(t, 7).Encrypt("postgres://sync:pw@db")
+	if err != nil {
+		t.Fatalf("Failed to encrypt value: %+v", err)
+	} else if !isEncryptedValue(encrypted) ||
+		strings.Contains(encrypted, "postgres") {
+		t.Errorf("Unexpected encrypted value: %s", encrypted)
+	}
+
+	for _, encodedKey := range []string{string(key),
+		"0707070707070707070707070707070707070707070707070707070707070707\n",
+		base64.StdEncoding.EncodeToString(key)} {
+		cc, err := NewConfigCipher([]byte(encodedKey))
+		if err != nil {
+			t.Fatalf("Failed to create config cipher: %+v", err)
+		}
+		value, err := cc.Decrypt(encrypted)
+		if err != nil {
+			t.Errorf("Failed to decrypt value: %+v", err)
+		} else if value != "postgres://sync:pw@db" {
+			t.Errorf("Unexpected decrypted value: %q", value)
+		}
+	}
+}
+
+// Error path: Tests that NewConfigCipher returns an error for keys of the
+// wrong length and that ConfigCipher.Decrypt returns an error for values that
+// are not encrypted, are corrupted, or were encrypted with another key.
+func TestConfigCipher_Error(t *testing.T) {
+	if _, err := NewConfigCipher([]byte("short")); err == nil {
+		t.Errorf("No error for a short key.")
+	}
+
+	cc := newTestConfigCipher(t, 1)
+	encrypted, err := cc.Encrypt("value")
+	if err != nil {
+		t.Fatalf("Failed to encrypt value: %+v", err)
+	}
+	corrupted := []byte(encrypted)
+	corrupted[len(EncryptedValuePrefix)+2] ^= 1
+	for _, value := range []string{"value", "ENC[not base64]", "ENC[AAAA]",
+		string(corrupted)} {
+		if _, err = cc.Decrypt(value); err == nil {
+			t.Errorf("No error for %q.", value)
+		}
+	}
+	if _, err = newTestConfigCipher(t, 2).Decrypt(encrypted); err == nil {
+		t.Errorf("No error for a value encrypted with another key.")
+	}
+}
+
+// Tests that ConfigCipher.Resolve returns only the encrypted options of the
+// config, decrypted, and that a nil ConfigCipher returns an error only if the
+// config has encrypted values.
+func TestConfigCipher_Resolve(t *testing.T) {
+	cc := newTestConfigCipher(t, 3)
+	dsn, _ := cc.Encrypt("postgres://sync:pw@db")
+	apiKey, _ := cc.Encrypt("hunter2")
+	config := map[string]interface{}{
+		"port": 22841,
+		"storagebackend": map[string]interface{}{
+			"type": "postgres", "params": map[string]interface{}{"dsn": dsn}},
+		"apikeys": []interface{}{"plain", apiKey},
+	}
+
+	resolved, err := cc.Resolve(config)
+	if err != nil {
+		t.Fatalf("Failed to decrypt config: %+v", err)
+	}
+	expected := map[string]interface{}{
+		"storagebackend": map[string]interface{}{
+			"params": map[string]interface{}{"dsn": "postgres://sync:pw@db"}},
+		"apikeys": []interface{}{"plain", "hunter2"},
+	}
+	if !reflect.DeepEqual(resolved, expected) {
+		t.Errorf("Unexpected decrypted config.\nexpected: %+v\nreceived: %+v",
+			expected, resolved)
+	}
+
+	var noCipher *ConfigCipher
+	if resolved, err = noCipher.Resolve(
+		map[string]interface{}{"port": 22841}); err != nil ||
+		len(resolved) != 0 {
+		t.Errorf("Unexpected result without encrypted values: %v, %v",
+			resolved, err)
+	}
+	if _, err = noCipher.Resolve(config); err == nil {
+		t.Errorf("No error for encrypted values without a config key.")
+	}
+}
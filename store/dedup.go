@@ -0,0 +1,461 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package store
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	jww "github.com/spf13/jwalterweatherman"
+)
+
+// defaultDedupMinSize is the default value of DedupParams.MinSize.
+const defaultDedupMinSize = 1024
+
+// dedupDir is the directory in each user's base path that holds the
+// deduplicated data. It is hidden from and cannot be accessed by clients.
+const dedupDir = ".dedup"
+
+// Types of the data stored at the path of a file after dedupMagic. Data smaller
+// than the minimum size is stored inline, and larger data is stored in the
+// deduplication directory and referenced by its hash.
+const (
+	dedupInline byte = iota
+	dedupReference
+)
+
+// dedupMagic is the prefix of all files written by a DedupStore. It is followed
+// by the type of the file and either the data or the SHA-256 hash of the data.
+// Files without this prefix were stored before deduplication was enabled and
+// are read unchanged.
+var dedupMagic = []byte("RSSD\x01")
+
+// DedupParams contains the parameters of the deduplication of stored files.
+// They are set in the "dedup" section of the config.
+type DedupParams struct {
+	// MinSize is the size, in bytes, below which files are stored in place
+	// instead of being deduplicated. Defaults to 1024.
+	MinSize int `mapstructure:"minSize"`
+}
+
+// DedupStats describes the space saved by deduplication in a store.
+type DedupStats struct {
+	// Files is the number of files, including previous versions.
+	Files int
+
+	// Blobs is the number of distinct deduplicated files stored.
+	Blobs int
+
+	// LogicalSize is the total size of the data of all files and StoredSize
+	// is the size of the data stored after deduplication, both in bytes and
+	// before compression.
+	LogicalSize int64
+	StoredSize  int64
+}
+
+// Add adds the stats to s.
+func (s *DedupStats) Add(stats DedupStats) {
+	s.Files += stats.Files
+	s.Blobs += stats.Blobs
+	s.LogicalSize += stats.LogicalSize
+	s.StoredSize += stats.StoredSize
+}
+
+// dedupRefs is the reference count of deduplicated data, stored as JSON next to
+// the data.
+type dedupRefs struct {
+	Refs int   `json:"refs"`
+	Size int64 `json:"size"`
+}
+
+// DedupStore stores each distinct file of an underlying Store only once. The
+// data of a file is stored in the deduplication directory of the base path,
+// named after its SHA-256 hash, and the file holds the hash. Data is reference
+// counted and deleted when no file references it. Files smaller than the
+// minimum size are stored in place.
+//
+// If a write is interrupted, the data may be left with too many references
+// and is never deleted, but no data is lost. Adheres to the Store interface.
+type DedupStore struct {
+	Store
+	params DedupParams
+
+	// mux is shared by all stores of the user so that concurrent sessions do
+	// not lose each other's references.
+	mux *sync.Mutex
+}
+
+// NewDedupStore returns a NewStore that wraps each Store created by newStore
+// in a DedupStore with the parameters.
+func NewDedupStore(
+	params map[string]interface{}, newStore NewStore) (NewStore, error) {
+	p := DedupParams{MinSize: defaultDedupMinSize}
+	if err := decodeParams(params, &p); err != nil {
+		return nil, err
+	} else if p.MinSize < 0 {
+		return nil, errors.Errorf(
+			"minimum deduplicated size %d cannot be negative", p.MinSize)
+	}
+
+	jww.INFO.Printf("Deduplicating stored files of at least %d bytes.",
+		p.MinSize)
+
+	userLocks := make(map[string]*sync.Mutex)
+	var mux sync.Mutex
+	return func(storageDir, baseDir string) (Store, error) {
+		s, err := newStore(storageDir, baseDir)
+		if err != nil {
+			return nil, err
+		}
+
+		mux.Lock()
+		defer mux.Unlock()
+		userLock, exists := userLocks[baseDir]
+		if !exists {
+			userLock = &sync.Mutex{}
+			userLocks[baseDir] = userLock
+		}
+		return &DedupStore{Store: s, params: p, mux: userLock}, nil
+	}, nil
+}
+
+// Read reads the file at the path from the underlying store, and its data from
+// the deduplication directory if it is deduplicated.
+//
+// Returns [ReservedPathErr] if the path is in the deduplication directory.
+func (ds *DedupStore) Read(path string) ([]byte, error) {
+	if isDedupPath(path) {
+		return nil, ReservedPathErr
+	}
+	data, err := ds.Store.Read(path)
+	if err != nil {
+		return nil, err
+	}
+
+	inline, hash := decodeDedup(data)
+	if hash == "" {
+		return inline, nil
+	}
+	data, err = ds.Store.Read(dedupPath(hash))
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read data of %s", path)
+	}
+	return data, nil
+}
+
+// Write stores the data in the deduplication directory, unless the same data is
+// already stored or it is smaller than the minimum size, and writes its hash to
+// the file at the path in the underlying store.
+//
+// Returns [ReservedPathErr] if the path is in the deduplication directory.
+func (ds *DedupStore) Write(path string, data []byte) error {
+	if isDedupPath(path) {
+		return ReservedPathErr
+	}
+
+	ds.mux.Lock()
+	defer ds.mux.Unlock()
+	oldHash, err := ds.reference(path)
+	if err != nil {
+		return err
+	}
+
+	if len(data) < ds.params.MinSize {
+		encoded := data
+		if bytes.HasPrefix(data, dedupMagic) {
+			encoded = encodeDedup(dedupInline, data)
+		}
+		if err = ds.Store.Write(path, encoded); err != nil {
+			return err
+		}
+	} else {
+		sum := sha256.Sum256(data)
+		hash := hex.EncodeToString(sum[:])
+		encoded := encodeDedup(dedupReference, sum[:])
+		if hash == oldHash {
+			// Rewritten so that the modification time is updated
+			return ds.Store.Write(path, encoded)
+		}
+		if err = ds.addRef(hash, data); err != nil {
+			return err
+		}
+		if err = ds.Store.Write(path, encoded); err != nil {
+			_ = ds.removeRef(hash)
+			return err
+		}
+	}
+
+	if oldHash != "" {
+		return ds.removeRef(oldHash)
+	}
+	return nil
+}
+
+// GetLastModified returns the last modification time of the file at the path
+// from the underlying store.
+//
+// Returns [ReservedPathErr] if the path is in the deduplication directory.
+func (ds *DedupStore) GetLastModified(path string) (time.Time, error) {
+	if isDedupPath(path) {
+		return time.Time{}, ReservedPathErr
+	}
+	return ds.Store.GetLastModified(path)
+}
+
+// ReadDir reads the directory at the path from the underlying store. The
+// deduplication directory is not listed.
+//
+// Returns [ReservedPathErr] if the path is in the deduplication directory.
+func (ds *DedupStore) ReadDir(path string) ([]string, error) {
+	if isDedupPath(path) {
+		return nil, ReservedPathErr
+	}
+	entries, err := ds.Store.ReadDir(path)
+	if err != nil || cleanPath(path) != "." {
+		return entries, err
+	}
+
+	filtered := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		if entry != dedupDir {
+			filtered = append(filtered, entry)
+		}
+	}
+	return filtered, nil
+}
+
+// Delete deletes the file at the path from the underlying store and its data
+// if no other file references it.
+//
+// Returns [os.ErrNotExist] if the file does not exist and [ReservedPathErr] if
+// the path is in the deduplication directory.
+func (ds *DedupStore) Delete(path string) error {
+	if isDedupPath(path) {
+		return ReservedPathErr
+	}
+
+	ds.mux.Lock()
+	defer ds.mux.Unlock()
+	hash, err := ds.reference(path)
+	if err != nil {
+		return err
+	}
+	if err = ds.Store.Delete(path); err != nil {
+		return err
+	}
+	if hash != "" {
+		return ds.removeRef(hash)
+	}
+	return nil
+}
+
+// ListFiles returns the paths of all files in the underlying store, except for
+// the deduplicated data. Returns an error if the underlying store does not
+// implement Lister.
+func (ds *DedupStore) ListFiles() ([]string, error) {
+	lister, ok := ds.Store.(Lister)
+	if !ok {
+		return nil, errors.New("underlying store cannot list its files")
+	}
+	files, err := lister.ListFiles()
+	if err != nil {
+		return nil, err
+	}
+
+	filtered := make([]string, 0, len(files))
+	for _, path := range files {
+		if !isDedupPath(path) {
+			filtered = append(filtered, path)
+		}
+	}
+	return filtered, nil
+}
+
+// Size returns the total size of the files in the underlying store, including
+// the deduplicated data. Returns an error if the underlying store does not
+// implement Sizer.
+func (ds *DedupStore) Size() (int64, error) {
+	sizer, ok := ds.Store.(Sizer)
+	if !ok {
+		return 0, errors.New("underlying store cannot report its size")
+	}
+	return sizer.Size()
+}
+
+// Ping returns an error if the underlying store cannot be reached. Stores that
+// do not implement Pinger are assumed to be reachable.
+func (ds *DedupStore) Ping() error {
+	if pinger, ok := ds.Store.(Pinger); ok {
+		return pinger.Ping()
+	}
+	return nil
+}
+
+// Stats returns the space saved by deduplication in the store.
+func (ds *DedupStore) Stats() (DedupStats, error) {
+	files, err := ds.ListFiles()
+	if err != nil {
+		return DedupStats{}, err
+	}
+
+	stats := DedupStats{Files: len(files)}
+	blobs := make(map[string]int64)
+	for _, path := range files {
+		data, err := ds.Store.Read(path)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		} else if err != nil {
+			return DedupStats{}, err
+		}
+
+		inline, hash := decodeDedup(data)
+		if hash == "" {
+			stats.LogicalSize += int64(len(inline))
+			stats.StoredSize += int64(len(inline))
+			continue
+		}
+		size, exists := blobs[hash]
+		if !exists {
+			refs, err := ds.loadRefs(hash)
+			if err != nil {
+				return DedupStats{}, err
+			}
+			size = refs.Size
+			blobs[hash] = size
+			stats.StoredSize += size
+		}
+		stats.LogicalSize += size
+	}
+	stats.Blobs = len(blobs)
+
+	return stats, nil
+}
+
+// reference returns the hash of the data the file at the path references, or
+// an empty string if it does not exist or is not deduplicated.
+func (ds *DedupStore) reference(path string) (string, error) {
+	data, err := ds.Store.Read(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return "", nil
+	} else if err != nil {
+		return "", errors.Wrapf(err, "failed to read %s", path)
+	}
+	_, hash := decodeDedup(data)
+	return hash, nil
+}
+
+// addRef adds a reference to the data with the hash, storing the data if it is
+// not already stored.
+func (ds *DedupStore) addRef(hash string, data []byte) error {
+	refs, err := ds.loadRefs(hash)
+	if errors.Is(err, os.ErrNotExist) {
+		if err = ds.Store.Write(dedupPath(hash), data); err != nil {
+			return errors.Wrap(err, "failed to store deduplicated data")
+		}
+		refs = dedupRefs{Size: int64(len(data))}
+	} else if err != nil {
+		return err
+	}
+	refs.Refs++
+	return ds.storeRefs(hash, refs)
+}
+
+// removeRef removes a reference to the data with the hash and deletes the data
+// if it has no references left.
+func (ds *DedupStore) removeRef(hash string) error {
+	refs, err := ds.loadRefs(hash)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	if refs.Refs--; refs.Refs > 0 {
+		return ds.storeRefs(hash, refs)
+	}
+	err = ds.Store.Delete(dedupPath(hash))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return errors.Wrap(err, "failed to delete deduplicated data")
+	}
+	err = ds.Store.Delete(dedupRefsPath(hash))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return errors.Wrap(err, "failed to delete references")
+	}
+	return nil
+}
+
+// loadRefs reads the references of the data with the hash. Returns a wrapped
+// os.ErrNotExist if the data is not stored.
+func (ds *DedupStore) loadRefs(hash string) (dedupRefs, error) {
+	var refs dedupRefs
+	data, err := ds.Store.Read(dedupRefsPath(hash))
+	if err != nil {
+		return refs, errors.Wrapf(err, "failed to read references of %s", hash)
+	} else if err = json.Unmarshal(data, &refs); err != nil {
+		return refs, errors.Wrapf(
+			err, "failed to decode references of %s", hash)
+	}
+	return refs, nil
+}
+
+// storeRefs writes the references of the data with the hash.
+func (ds *DedupStore) storeRefs(hash string, refs dedupRefs) error {
+	data, err := json.Marshal(refs)
+	if err != nil {
+		return err
+	}
+	if err = ds.Store.Write(dedupRefsPath(hash), data); err != nil {
+		return errors.Wrapf(err, "failed to write references of %s", hash)
+	}
+	return nil
+}
+
+// encodeDedup returns the contents of a file written by a DedupStore.
+func encodeDedup(fileType byte, data []byte) []byte {
+	encoded := make([]byte, 0, len(dedupMagic)+1+len(data))
+	encoded = append(encoded, dedupMagic...)
+	encoded = append(encoded, fileType)
+	return append(encoded, data...)
+}
+
+// decodeDedup returns the data stored in place in the contents of a file or,
+// if the file references deduplicated data, its hex-encoded hash.
+func decodeDedup(data []byte) ([]byte, string) {
+	if !bytes.HasPrefix(data, dedupMagic) || len(data) < len(dedupMagic)+1 {
+		return data, ""
+	}
+	payload := data[len(dedupMagic)+1:]
+	if data[len(dedupMagic)] == dedupReference && len(payload) == sha256.Size {
+		return nil, hex.EncodeToString(payload)
+	}
+	return payload, ""
+}
+
+// dedupPath returns the path of the deduplicated data with the hash.
+func dedupPath(hash string) string {
+	return dedupDir + "/" + hash
+}
+
+// dedupRefsPath returns the path of the references of the deduplicated data
+// with the hash.
+func dedupRefsPath(hash string) string {
+	return dedupPath(hash) + ".refs"
+}
+
+// isDedupPath returns true if the path is in the deduplication directory.
+func isDedupPath(path string) bool {
+	path = cleanPath(path)
+	return path == dedupDir || strings.HasPrefix(path, dedupDir+"/")
+}
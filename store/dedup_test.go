@@ -0,0 +1,173 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package store
+
+import (
+	"bytes"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+// Tests that DedupStore adheres to the Store interface.
+var _ Store = (*DedupStore)(nil)
+
+// Tests that DedupStore adheres to the Lister interface.
+var _ Lister = (*DedupStore)(nil)
+
+// Tests that DedupStore adheres to the Sizer interface.
+var _ Sizer = (*DedupStore)(nil)
+
+// newTestDedupStore returns a DedupStore of a MemStore with a minimum size of
+// 16 bytes.
+func newTestDedupStore(t *testing.T) *DedupStore {
+	newStore, err := NewDedupStore(
+		map[string]interface{}{"minSize": 16}, NewMemStore)
+	if err != nil {
+		t.Fatalf("Failed to create dedup store: %+v", err)
+	}
+	s, err := newStore("", "user")
+	if err != nil {
+		t.Fatalf("Failed to create store: %+v", err)
+	}
+	return s.(*DedupStore)
+}
+
+// Tests that identical files are stored once and that the data is deleted
+// once no file references it.
+func TestDedupStore_Write_Delete(t *testing.T) {
+	ds := newTestDedupStore(t)
+	data := bytes.Repeat([]byte("state"), 10)
+	for _, path := range []string{"a", "b", "dir/c", "a"} {
+		if err := ds.Write(path, data); err != nil {
+			t.Fatalf("Failed to write %s: %+v", path, err)
+		}
+	}
+	for _, path := range []string{"a", "b", "dir/c"} {
+		if read, err := ds.Read(path); err != nil {
+			t.Errorf("Failed to read %s: %+v", path, err)
+		} else if !bytes.Equal(read, data) {
+			t.Errorf("Unexpected data of %s.\nexpected: %q\nreceived: %q",
+				path, data, read)
+		}
+	}
+
+	stats, err := ds.Stats()
+	if err != nil {
+		t.Fatalf("Failed to get stats: %+v", err)
+	}
+	expected := DedupStats{Files: 3, Blobs: 1,
+		LogicalSize: 3 * int64(len(data)), StoredSize: int64(len(data))}
+	if stats != expected {
+		t.Errorf("Unexpected stats.\nexpected: %+v\nreceived: %+v",
+			expected, stats)
+	}
+
+	// Overwriting and deleting the files removes the references
+	_ = ds.Write("a", []byte("small"))
+	_ = ds.Delete("b")
+	files, _ := ds.Store.(Lister).ListFiles()
+	if len(files) != 4 {
+		t.Errorf("Unexpected stored files: %q", files)
+	}
+	_ = ds.Delete("dir/c")
+	files, _ = ds.Store.(Lister).ListFiles()
+	if expected := []string{"a"}; !reflect.DeepEqual(files, expected) {
+		t.Errorf("Unexpected stored files.\nexpected: %q\nreceived: %q",
+			expected, files)
+	}
+}
+
+// Tests that files smaller than the minimum size and files stored before
+// deduplication was enabled are read unchanged.
+func TestDedupStore_Read_Inline(t *testing.T) {
+	ds := newTestDedupStore(t)
+	files := map[string][]byte{
+		"small": []byte("small"),
+		"magic": append(append([]byte{}, dedupMagic...), dedupReference),
+	}
+	for path, data := range files {
+		if err := ds.Write(path, data); err != nil {
+			t.Fatalf("Failed to write %s: %+v", path, err)
+		}
+	}
+	files["old"] = bytes.Repeat([]byte("old"), 10)
+	_ = ds.Store.Write("old", files["old"])
+
+	for path, data := range files {
+		if read, err := ds.Read(path); err != nil {
+			t.Errorf("Failed to read %s: %+v", path, err)
+		} else if !bytes.Equal(read, data) {
+			t.Errorf("Unexpected data of %s.\nexpected: %q\nreceived: %q",
+				path, data, read)
+		}
+	}
+}
+
+// Tests that the deduplication directory is hidden from DedupStore.ReadDir and
+// DedupStore.ListFiles.
+func TestDedupStore_ReadDir_ListFiles(t *testing.T) {
+	ds := newTestDedupStore(t)
+	_ = ds.Write("dir/file", bytes.Repeat([]byte("a"), 32))
+
+	if dirs, err := ds.ReadDir(""); err != nil {
+		t.Fatalf("Failed to read directory: %+v", err)
+	} else if expected := []string{"dir"}; !reflect.DeepEqual(dirs, expected) {
+		t.Errorf("Unexpected directories.\nexpected: %q\nreceived: %q",
+			expected, dirs)
+	}
+	if files, err := ds.ListFiles(); err != nil {
+		t.Fatalf("Failed to list files: %+v", err)
+	} else if expected := []string{"dir/file"}; !reflect.DeepEqual(
+		files, expected) {
+		t.Errorf("Unexpected files.\nexpected: %q\nreceived: %q",
+			expected, files)
+	}
+}
+
+// Error path: Tests that the deduplication directory cannot be accessed.
+func TestDedupStore_ReservedPathErr(t *testing.T) {
+	ds := newTestDedupStore(t)
+	for _, path := range []string{".dedup", "/.dedup/x", "./.dedup/x"} {
+		if _, err := ds.Read(path); !errors.Is(err, ReservedPathErr) {
+			t.Errorf("Unexpected error reading %q: %v", path, err)
+		}
+		if err := ds.Write(path, nil); !errors.Is(err, ReservedPathErr) {
+			t.Errorf("Unexpected error writing %q: %v", path, err)
+		}
+		if err := ds.Delete(path); !errors.Is(err, ReservedPathErr) {
+			t.Errorf("Unexpected error deleting %q: %v", path, err)
+		}
+	}
+}
+
+// Error path: Tests that DedupStore.Delete returns os.ErrNotExist for a file
+// that does not exist.
+func TestDedupStore_Delete_ErrNotExist(t *testing.T) {
+	ds := newTestDedupStore(t)
+	if err := ds.Delete("file"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Unexpected error.\nexpected: %v\nreceived: %v",
+			os.ErrNotExist, err)
+	}
+}
+
+// Error path: Tests that NewDedupStore returns an error for invalid
+// parameters.
+func TestNewDedupStore_Error(t *testing.T) {
+	tests := map[string]map[string]interface{}{
+		"negative minSize": {"minSize": -1},
+		"unknown key":      {"hash": "sha1"},
+	}
+	for name, params := range tests {
+		if _, err := NewDedupStore(params, NewMemStore); err == nil {
+			t.Errorf("Failed to get error for %s.", name)
+		}
+	}
+}
@@ -0,0 +1,173 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package store
+
+import (
+	"os"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Durability levels of the file backend, which set when written files reach
+// the disk.
+const (
+	// DurabilityAsync leaves flushing written files to the operating system,
+	// so writes acknowledged shortly before a crash or power loss can be lost.
+	DurabilityAsync = "async"
+
+	// DurabilityFsync syncs each written file to disk before the write
+	// returns.
+	DurabilityFsync = "fsync"
+
+	// DurabilityGroup syncs the files of concurrent writes together, with each
+	// write waiting up to a maximum delay for others to join it before they
+	// are all synced and return.
+	DurabilityGroup = "group"
+)
+
+// syncer syncs written files and the directories whose entries changed to
+// disk.
+type syncer interface {
+	// sync returns once the file, if it is not nil, and the directories are
+	// synced to disk.
+	sync(f *os.File, dirs []string) error
+}
+
+// newSyncer returns the syncer of the durability level, or nil for
+// DurabilityAsync, for which files are not synced.
+func newSyncer(durability string, maxDelay time.Duration) (syncer, error) {
+	switch durability {
+	case DurabilityAsync:
+		return nil, nil
+	case DurabilityFsync:
+		return fsyncer{}, nil
+	case DurabilityGroup:
+		if maxDelay <= 0 {
+			return nil, errors.Errorf(
+				"maximum delay %s must be positive", maxDelay)
+		}
+		return &groupCommitter{maxDelay: maxDelay}, nil
+	default:
+		return nil, errors.Errorf("unknown durability %q (available: %s, "+
+			"%s, %s)", durability, DurabilityAsync, DurabilityFsync,
+			DurabilityGroup)
+	}
+}
+
+// fsyncer syncs each file as soon as it is written.
+type fsyncer struct{}
+
+// sync syncs the file and the directories.
+func (fsyncer) sync(f *os.File, dirs []string) error {
+	if f != nil {
+		if err := f.Sync(); err != nil {
+			return errors.Wrapf(err, "failed to sync %s", f.Name())
+		}
+	}
+	for _, dir := range dirs {
+		if err := syncDir(dir); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// groupCommitter syncs the files of concurrent writes in batches. The first
+// write of a batch starts a timer of maxDelay, and the files and directories
+// of all writes that join the batch until it fires are synced together, so
+// that a disk that can only sync a few times per second, such as a spinning
+// disk, flushes many writes with each sync.
+type groupCommitter struct {
+	maxDelay time.Duration
+
+	// batch is the batch that writes join, or nil if there is none.
+	batch *commitBatch
+	mux   sync.Mutex
+}
+
+// commitBatch is a batch of writes that are synced together.
+type commitBatch struct {
+	writes []*commitWrite
+	done   chan struct{}
+}
+
+// commitWrite is the file and directories of a write in a commitBatch and the
+// error syncing them.
+type commitWrite struct {
+	f    *os.File
+	dirs []string
+	err  error
+}
+
+// sync adds the file and directories to the current batch, starting one if
+// there is none, and returns once the batch is synced.
+func (gc *groupCommitter) sync(f *os.File, dirs []string) error {
+	w := &commitWrite{f: f, dirs: dirs}
+
+	gc.mux.Lock()
+	b := gc.batch
+	if b == nil {
+		b = &commitBatch{done: make(chan struct{})}
+		gc.batch = b
+		time.AfterFunc(gc.maxDelay, func() { gc.commit(b) })
+	}
+	b.writes = append(b.writes, w)
+	gc.mux.Unlock()
+
+	<-b.done
+	return w.err
+}
+
+// commit syncs the files of the batch and then each directory once. Writes
+// that join later start a new batch, which is synced while this one is.
+func (gc *groupCommitter) commit(b *commitBatch) {
+	gc.mux.Lock()
+	gc.batch = nil
+	gc.mux.Unlock()
+	defer close(b.done)
+
+	dirErrs := make(map[string]error)
+	for _, w := range b.writes {
+		if w.f != nil {
+			if err := w.f.Sync(); err != nil {
+				w.err = errors.Wrapf(err, "failed to sync %s", w.f.Name())
+			}
+		}
+		for _, dir := range w.dirs {
+			dirErrs[dir] = nil
+		}
+	}
+	for dir := range dirErrs {
+		dirErrs[dir] = syncDir(dir)
+	}
+	for _, w := range b.writes {
+		for _, dir := range w.dirs {
+			if w.err == nil {
+				w.err = dirErrs[dir]
+			}
+		}
+	}
+}
+
+// syncDir syncs the entries of the directory to disk, so that files created in
+// or removed from it survive a crash. Directories cannot be synced on Windows,
+// where NTFS journals their entries itself.
+func syncDir(dir string) error {
+	if runtime.GOOS == "windows" {
+		return nil
+	}
+	d, err := os.Open(dir)
+	if err != nil {
+		return errors.Wrapf(err, "failed to open directory %s", dir)
+	}
+	defer func() { _ = d.Close() }()
+	return errors.Wrapf(d.Sync(), "failed to sync directory %s", dir)
+}
@@ -0,0 +1,154 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package store
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Tests that the stores of the file backend write, read, and delete files in
+// new directories with every durability level.
+func Test_newFileBackend(t *testing.T) {
+	for _, durability := range []string{
+		DurabilityAsync, DurabilityFsync, DurabilityGroup} {
+		newStore, err := newFileBackend(map[string]interface{}{
+			"durability": durability, "maxDelay": "1ms"})
+		if err != nil {
+			t.Fatalf("Failed to create %s backend: %+v", durability, err)
+		}
+		s, err := newStore(t.TempDir(), "waldo")
+		if err != nil {
+			t.Fatalf("Failed to create %s store: %+v", durability, err)
+		}
+
+		if err = s.Write("dir/sub/file", []byte(durability)); err != nil {
+			t.Errorf("Failed to write with %s: %+v", durability, err)
+		} else if err = s.Write("dir/sub/file", []byte("new")); err != nil {
+			t.Errorf("Failed to overwrite with %s: %+v", durability, err)
+		}
+		if data, err := s.Read("dir/sub/file"); err != nil ||
+			string(data) != "new" {
+			t.Errorf("Failed to read with %s: %q, %+v", durability, data, err)
+		}
+		if err = s.Delete("dir/sub/file"); err != nil {
+			t.Errorf("Failed to delete with %s: %+v", durability, err)
+		}
+		if _, err = s.Read("dir/sub/file"); !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("Unexpected error reading deleted file with %s."+
+				"\nexpected: %v\nreceived: %v", durability, os.ErrNotExist, err)
+		}
+	}
+}
+
+// Error path: Tests that newFileBackend returns an error for unknown
+// parameters and durability levels and a group commit without a delay.
+func Test_newFileBackend_Error(t *testing.T) {
+	tests := []map[string]interface{}{
+		{"durablity": DurabilityFsync},
+		{"durability": "sometimes"},
+		{"durability": DurabilityGroup, "maxDelay": "0s"},
+	}
+	for _, params := range tests {
+		if _, err := newFileBackend(params); err == nil {
+			t.Errorf("No error for parameters %+v.", params)
+		}
+	}
+}
+
+// Tests that groupCommitter.sync syncs the files of concurrent writes in one
+// batch and returns once it is synced.
+func Test_groupCommitter_sync(t *testing.T) {
+	gc := &groupCommitter{maxDelay: 50 * time.Millisecond}
+	dir := t.TempDir()
+
+	const writes = 5
+	var wg sync.WaitGroup
+	errs := make([]error, writes)
+	started := time.Now()
+	for i := 0; i < writes; i++ {
+		f, err := os.Create(filepath.Join(dir, strconv.Itoa(i)))
+		if err != nil {
+			t.Fatalf("Failed to create file: %+v", err)
+		}
+		defer func() { _ = f.Close() }()
+
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = gc.sync(f, []string{dir})
+		}(i)
+	}
+
+	// All writes join the first batch before its delay ends
+	for {
+		gc.mux.Lock()
+		var joined int
+		if gc.batch != nil {
+			joined = len(gc.batch.writes)
+		}
+		gc.mux.Unlock()
+		if joined == writes {
+			break
+		} else if time.Since(started) > gc.maxDelay {
+			t.Fatalf("Only %d of %d writes joined the batch.", joined, writes)
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	wg.Wait()
+	if elapsed := time.Since(started); elapsed < gc.maxDelay {
+		t.Errorf("Writes returned after %s, before the delay of %s.",
+			elapsed, gc.maxDelay)
+	}
+	for i, err := range errs {
+		if err != nil {
+			t.Errorf("Failed to sync write %d: %+v", i, err)
+		}
+	}
+	if gc.batch != nil {
+		t.Errorf("Batch was not removed once committed.")
+	}
+}
+
+// Error path: Tests that groupCommitter.sync returns the error of syncing the
+// file of its own write only.
+func Test_groupCommitter_sync_Error(t *testing.T) {
+	gc := &groupCommitter{maxDelay: 20 * time.Millisecond}
+	dir := t.TempDir()
+	open, err := os.Create(filepath.Join(dir, "open"))
+	if err != nil {
+		t.Fatalf("Failed to create file: %+v", err)
+	}
+	defer func() { _ = open.Close() }()
+	closed, err := os.Create(filepath.Join(dir, "closed"))
+	if err != nil {
+		t.Fatalf("Failed to create file: %+v", err)
+	}
+	_ = closed.Close()
+
+	var openErr, closedErr error
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() { defer wg.Done(); openErr = gc.sync(open, nil) }()
+	go func() { defer wg.Done(); closedErr = gc.sync(closed, nil) }()
+	wg.Wait()
+
+	if openErr != nil {
+		t.Errorf("Failed to sync open file: %+v", openErr)
+	}
+	if closedErr == nil {
+		t.Errorf("No error syncing closed file.")
+	}
+}
@@ -0,0 +1,366 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package store
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+
+	"github.com/pkg/errors"
+	jww "github.com/spf13/jwalterweatherman"
+	"golang.org/x/crypto/argon2"
+
+	"gitlab.com/xx_network/primitives/utils"
+)
+
+// encryptionKeyLen is the length, in bytes, of an AES-256 key.
+const encryptionKeyLen = 32
+
+// Argon2id parameters used to derive keys from passphrases. They follow the
+// second recommended option of RFC 9106 and must never change, since the
+// derived keys would change with them.
+const (
+	passphraseTime    = 3
+	passphraseMemory  = 64 * 1024
+	passphraseThreads = 4
+)
+
+// encryptedMagic is the prefix of all encrypted data. It is followed by the
+// length of the key ID, the key ID, the nonce, and the AES-GCM ciphertext.
+// Data without this prefix was stored before encryption was enabled. It is
+// rejected unless EncryptionParams.RequireEncrypted is disabled.
+var encryptedMagic = []byte("RSSE\x01")
+
+var (
+	// UnknownKeyErr is returned when reading data encrypted with a key that
+	// is not configured.
+	UnknownKeyErr = errors.New("data is encrypted with an unknown key")
+
+	// UnencryptedErr is returned when reading data that is not encrypted
+	// while encryption is required.
+	UnencryptedErr = errors.New("data is not encrypted")
+)
+
+// EncryptionParams contains the parameters of the encryption of stored files.
+// They are set in the "encryption" section of the config.
+type EncryptionParams struct {
+	// Keys are the keys files can be encrypted with. Keys that are no longer
+	// active must be kept until all files encrypted with them are
+	// re-encrypted.
+	Keys []EncryptionKeyParams `mapstructure:"keys"`
+
+	// ActiveKey is the ID of the key new data is encrypted with. Defaults to
+	// the first key.
+	ActiveKey string `mapstructure:"activeKey"`
+
+	// RequireEncrypted rejects files that are not encrypted, so that data
+	// placed in the storage backend without a key cannot be served. Disable
+	// it only until the files stored before encryption was enabled are
+	// re-encrypted. Defaults to true.
+	RequireEncrypted bool `mapstructure:"requireEncrypted"`
+}
+
+// EncryptionKeyParams describes an AES-256 key and where it is loaded from.
+// Exactly one of Path, Key, Passphrase, or KMS must be set.
+type EncryptionKeyParams struct {
+	// ID identifies the key. It is stored with each file so that the file can
+	// be decrypted after the active key changes. At most 255 bytes.
+	ID string `mapstructure:"id"`
+
+	// Path is the path of a file containing the 32-byte key, either raw or
+	// encoded in hex or base64.
+	Path string `mapstructure:"path"`
+
+	// Key is the 32-byte key encoded in hex or base64, such as from a secret
+	// referenced in the config.
+	Key string `mapstructure:"key"`
+
+	// Passphrase is the passphrase the key is derived from with Argon2id and
+	// the Salt, which is required with it.
+	Passphrase string `mapstructure:"passphrase"`
+	Salt       string `mapstructure:"salt"`
+
+	// KMS contains the encrypted key and the parameters used to decrypt it
+	// with AWS KMS.
+	KMS *KMSParams `mapstructure:"kms"`
+}
+
+// EncryptedStore encrypts the files of an underlying Store with AES-256-GCM.
+// The ID of the key is stored with each file, so that the active key can be
+// changed while files encrypted with the previous keys remain readable. The
+// base directory and path of each file are authenticated with it, so that
+// encrypted files cannot be swapped between paths or users.
+//
+// Encrypted files are 34 bytes plus the length of the key ID larger than the
+// data, which counts towards the size of the store. Adheres to the Store
+// interface.
+type EncryptedStore struct {
+	Store
+	baseDir          string
+	keys             map[string]cipher.AEAD
+	activeKey        string
+	requireEncrypted bool
+}
+
+// NewEncryptedStore loads the keys in the parameters and returns a NewStore
+// that wraps each Store created by newStore in an EncryptedStore.
+func NewEncryptedStore(
+	params map[string]interface{}, newStore NewStore) (NewStore, error) {
+	p := EncryptionParams{RequireEncrypted: true}
+	if err := decodeParams(params, &p); err != nil {
+		return nil, err
+	} else if len(p.Keys) == 0 {
+		return nil, errors.New("no encryption keys specified")
+	}
+	if p.ActiveKey == "" {
+		p.ActiveKey = p.Keys[0].ID
+	}
+
+	keys := make(map[string]cipher.AEAD, len(p.Keys))
+	for i, kp := range p.Keys {
+		if kp.ID == "" || len(kp.ID) > 255 {
+			return nil, errors.Errorf(
+				"ID of encryption key %d must be 1 to 255 bytes", i)
+		} else if _, exists := keys[kp.ID]; exists {
+			return nil, errors.Errorf("duplicate encryption key %q", kp.ID)
+		}
+		key, err := loadEncryptionKey(kp)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid encryption key %q", kp.ID)
+		}
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, err
+		}
+		if keys[kp.ID], err = cipher.NewGCM(block); err != nil {
+			return nil, err
+		}
+	}
+	if _, exists := keys[p.ActiveKey]; !exists {
+		return nil, errors.Errorf(
+			"active encryption key %q is not specified", p.ActiveKey)
+	}
+
+	jww.INFO.Printf("Encrypting stored files with key %q (%d keys loaded).",
+		p.ActiveKey, len(keys))
+	if !p.RequireEncrypted {
+		jww.WARN.Print("Unencrypted stored files are served unchanged; " +
+			"enable requireEncrypted once all files are re-encrypted.")
+	}
+
+	return func(storageDir, baseDir string) (Store, error) {
+		s, err := newStore(storageDir, baseDir)
+		if err != nil {
+			return nil, err
+		}
+		return &EncryptedStore{
+			Store: s, baseDir: baseDir, keys: keys, activeKey: p.ActiveKey,
+			requireEncrypted: p.RequireEncrypted,
+		}, nil
+	}, nil
+}
+
+// Read reads the file at the path from the underlying store and decrypts it.
+// Files that are not encrypted are returned unchanged if encryption is not
+// required.
+//
+// Returns [UnknownKeyErr] if the file is encrypted with a key that is not
+// configured and [UnencryptedErr] if it is not encrypted and encryption is
+// required.
+func (es *EncryptedStore) Read(path string) ([]byte, error) {
+	data, err := es.Store.Read(path)
+	if err != nil {
+		return nil, err
+	}
+	return es.decrypt(path, data)
+}
+
+// Write encrypts the data with the active key and writes it to the file at the
+// path in the underlying store.
+func (es *EncryptedStore) Write(path string, data []byte) error {
+	encrypted, err := es.encrypt(path, data)
+	if err != nil {
+		return err
+	}
+	return es.Store.Write(path, encrypted)
+}
+
+// ListFiles returns the paths of all files in the underlying store. Returns an
+// error if the underlying store does not implement Lister.
+func (es *EncryptedStore) ListFiles() ([]string, error) {
+	lister, ok := es.Store.(Lister)
+	if !ok {
+		return nil, errors.New("underlying store cannot list its files")
+	}
+	return lister.ListFiles()
+}
+
+// Size returns the total size of the encrypted files in the underlying store.
+// Returns an error if the underlying store does not implement Sizer.
+func (es *EncryptedStore) Size() (int64, error) {
+	sizer, ok := es.Store.(Sizer)
+	if !ok {
+		return 0, errors.New("underlying store cannot report its size")
+	}
+	return sizer.Size()
+}
+
+// Ping returns an error if the underlying store cannot be reached. Stores that
+// do not implement Pinger are assumed to be reachable.
+func (es *EncryptedStore) Ping() error {
+	if pinger, ok := es.Store.(Pinger); ok {
+		return pinger.Ping()
+	}
+	return nil
+}
+
+// Reencrypt encrypts the file at the path with the active key if it is not
+// encrypted or is encrypted with another key. Returns true if the file was
+// rewritten. Files that are not encrypted are only encrypted if encryption is
+// not required; otherwise, [UnencryptedErr] is returned.
+func (es *EncryptedStore) Reencrypt(path string) (bool, error) {
+	data, err := es.Store.Read(path)
+	if err != nil {
+		return false, err
+	}
+	if keyID, ok := encryptionKeyID(data); ok && keyID == es.activeKey {
+		return false, nil
+	}
+	if data, err = es.decrypt(path, data); err != nil {
+		return false, err
+	}
+	return true, es.Write(path, data)
+}
+
+// encrypt encrypts the data of the file at the path with the active key.
+func (es *EncryptedStore) encrypt(path string, data []byte) ([]byte, error) {
+	aead := es.keys[es.activeKey]
+	header := make([]byte, 0, len(encryptedMagic)+1+len(es.activeKey)+
+		aead.NonceSize())
+	header = append(header, encryptedMagic...)
+	header = append(header, byte(len(es.activeKey)))
+	header = append(header, es.activeKey...)
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, errors.Wrap(err, "failed to generate nonce")
+	}
+	header = append(header, nonce...)
+	return aead.Seal(header, nonce, data, es.additionalData(path)), nil
+}
+
+// decrypt decrypts the data of the file at the path with the key it was
+// encrypted with. Data that is not encrypted is returned unchanged if
+// encryption is not required.
+func (es *EncryptedStore) decrypt(path string, data []byte) ([]byte, error) {
+	keyID, ok := encryptionKeyID(data)
+	if !ok {
+		if es.requireEncrypted {
+			return nil, errors.Wrap(UnencryptedErr, path)
+		}
+		return data, nil
+	}
+	aead, exists := es.keys[keyID]
+	if !exists {
+		return nil, errors.Wrapf(UnknownKeyErr, "%s: key %q", path, keyID)
+	}
+
+	data = data[len(encryptedMagic)+1+len(keyID):]
+	if len(data) < aead.NonceSize() {
+		return nil, errors.Errorf("encrypted data of %s is truncated", path)
+	}
+	plaintext, err := aead.Open(nil, data[:aead.NonceSize()],
+		data[aead.NonceSize():], es.additionalData(path))
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to decrypt %s", path)
+	}
+	return plaintext, nil
+}
+
+// additionalData returns the data authenticated with the file at the path.
+func (es *EncryptedStore) additionalData(path string) []byte {
+	return []byte(es.baseDir + "\x00" + cleanPath(path))
+}
+
+// encryptionKeyID returns the ID of the key the data is encrypted with, or
+// false if the data is not encrypted.
+func encryptionKeyID(data []byte) (string, bool) {
+	if !bytes.HasPrefix(data, encryptedMagic) ||
+		len(data) < len(encryptedMagic)+1 {
+		return "", false
+	}
+	n := int(data[len(encryptedMagic)])
+	start := len(encryptedMagic) + 1
+	if len(data) < start+n {
+		return "", false
+	}
+	return string(data[start : start+n]), true
+}
+
+// loadEncryptionKey returns the 32-byte key described by the parameters.
+func loadEncryptionKey(p EncryptionKeyParams) ([]byte, error) {
+	var sources int
+	for _, set := range []bool{
+		p.Path != "", p.Key != "", p.Passphrase != "", p.KMS != nil} {
+		if set {
+			sources++
+		}
+	}
+	if sources != 1 {
+		return nil, errors.New("exactly one of path, key, passphrase, or " +
+			"kms must be specified")
+	}
+
+	var key []byte
+	var err error
+	switch {
+	case p.Path != "":
+		if key, err = utils.ReadFile(p.Path); err != nil {
+			return nil, errors.Wrapf(err, "failed to read key file %s", p.Path)
+		}
+		key = decodeEncryptionKey(key)
+	case p.Key != "":
+		key = decodeEncryptionKey([]byte(p.Key))
+	case p.Passphrase != "":
+		if p.Salt == "" {
+			return nil, errors.New("salt is required with passphrase")
+		}
+		key = argon2.IDKey([]byte(p.Passphrase), []byte(p.Salt),
+			passphraseTime, passphraseMemory, passphraseThreads,
+			encryptionKeyLen)
+	default:
+		if key, err = kmsDecrypt(*p.KMS); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(key) != encryptionKeyLen {
+		return nil, errors.Errorf("key is %d bytes; expected %d",
+			len(key), encryptionKeyLen)
+	}
+	return key, nil
+}
+
+// decodeEncryptionKey returns the key in the contents of a key file, which is
+// either the raw key or the key encoded in hex or base64 with optional
+// surrounding whitespace.
+func decodeEncryptionKey(data []byte) []byte {
+	if len(data) == encryptionKeyLen {
+		return data
+	}
+	trimmed := string(bytes.TrimSpace(data))
+	if key, err := hex.DecodeString(trimmed); err == nil {
+		return key
+	} else if key, err = base64.StdEncoding.DecodeString(trimmed); err == nil {
+		return key
+	}
+	return data
+}
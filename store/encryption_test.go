@@ -0,0 +1,264 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package store
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+// Tests that EncryptedStore adheres to the Store interface.
+var _ Store = (*EncryptedStore)(nil)
+
+// Tests that EncryptedStore adheres to the Lister interface.
+var _ Lister = (*EncryptedStore)(nil)
+
+// Tests that EncryptedStore adheres to the Sizer interface.
+var _ Sizer = (*EncryptedStore)(nil)
+
+// newTestEncryptionParams returns encryption parameters with a passphrase key
+// for each ID, with the first active.
+func newTestEncryptionParams(ids ...string) map[string]interface{} {
+	keys := make([]interface{}, len(ids))
+	for i, id := range ids {
+		keys[i] = map[string]interface{}{
+			"id": id, "passphrase": "hunter2 " + id, "salt": "salt",
+		}
+	}
+	return map[string]interface{}{"keys": keys}
+}
+
+// newTestEncryptedStore returns an EncryptedStore of the user with the
+// parameters, wrapping the MemStore of the user in stores.
+func newTestEncryptedStore(params map[string]interface{},
+	stores map[string]Store, username string, t *testing.T) *EncryptedStore {
+	newStore, err := NewEncryptedStore(params,
+		func(storageDir, baseDir string) (Store, error) {
+			if _, exists := stores[baseDir]; !exists {
+				stores[baseDir], _ = NewMemStore(storageDir, baseDir)
+			}
+			return stores[baseDir], nil
+		})
+	if err != nil {
+		t.Fatalf("Failed to create encrypted store: %+v", err)
+	}
+	s, err := newStore("", username)
+	if err != nil {
+		t.Fatalf("Failed to create store: %+v", err)
+	}
+	return s.(*EncryptedStore)
+}
+
+// Tests that data written to an EncryptedStore is encrypted in the underlying
+// store and read back unchanged.
+func TestEncryptedStore_Write_Read(t *testing.T) {
+	stores := make(map[string]Store)
+	es := newTestEncryptedStore(
+		newTestEncryptionParams("a"), stores, "user", t)
+	data := []byte("Haven state")
+	if err := es.Write("dir/file", data); err != nil {
+		t.Fatalf("Failed to write file: %+v", err)
+	}
+
+	stored, err := stores["user"].Read("dir/file")
+	if err != nil {
+		t.Fatalf("Failed to read stored file: %+v", err)
+	} else if bytes.Contains(stored, data) {
+		t.Errorf("Data is stored unencrypted: %q", stored)
+	} else if keyID, _ := encryptionKeyID(stored); keyID != "a" {
+		t.Errorf("Unexpected key ID.\nexpected: %q\nreceived: %q", "a", keyID)
+	}
+
+	read, err := es.Read("dir/file")
+	if err != nil {
+		t.Fatalf("Failed to read file: %+v", err)
+	} else if !bytes.Equal(read, data) {
+		t.Errorf("Unexpected data.\nexpected: %q\nreceived: %q", data, read)
+	}
+}
+
+// Tests that files stored before encryption was enabled are read unchanged
+// when encryption is not required and that EncryptedStore.Reencrypt encrypts
+// them and files encrypted with other keys with the active key.
+func TestEncryptedStore_Reencrypt(t *testing.T) {
+	stores := make(map[string]Store)
+	old := newTestEncryptedStore(
+		newTestEncryptionParams("a"), stores, "user", t)
+	_ = old.Write("old", []byte("old data"))
+	_ = stores["user"].Write("plain", []byte("plain data"))
+
+	params := newTestEncryptionParams("a", "b")
+	params["activeKey"] = "b"
+	params["requireEncrypted"] = false
+	es := newTestEncryptedStore(params, stores, "user", t)
+	_ = es.Write("new", []byte("new data"))
+
+	expected := map[string]string{
+		"old": "old data", "plain": "plain data", "new": "new data"}
+	for path, data := range expected {
+		if read, err := es.Read(path); err != nil {
+			t.Errorf("Failed to read %s: %+v", path, err)
+		} else if string(read) != data {
+			t.Errorf("Unexpected data of %s.\nexpected: %q\nreceived: %q",
+				path, data, read)
+		}
+	}
+
+	for path, rewrite := range map[string]bool{
+		"old": true, "plain": true, "new": false} {
+		if ok, err := es.Reencrypt(path); err != nil {
+			t.Errorf("Failed to re-encrypt %s: %+v", path, err)
+		} else if ok != rewrite {
+			t.Errorf("%s re-encrypted %t; expected %t.", path, ok, rewrite)
+		}
+		stored, _ := stores["user"].Read(path)
+		if keyID, _ := encryptionKeyID(stored); keyID != "b" {
+			t.Errorf("Unexpected key ID of %s.\nexpected: %q\nreceived: %q",
+				path, "b", keyID)
+		}
+		if read, _ := es.Read(path); string(read) != expected[path] {
+			t.Errorf("Unexpected data of %s.\nexpected: %q\nreceived: %q",
+				path, expected[path], read)
+		}
+	}
+}
+
+// Tests that loadEncryptionKey loads a key file that is raw or encoded in hex.
+func TestLoadEncryptionKey_Path(t *testing.T) {
+	key := bytes.Repeat([]byte{0xAB}, encryptionKeyLen)
+	dir := t.TempDir()
+	files := map[string][]byte{
+		"raw": key, "hex": []byte(hex.EncodeToString(key) + "\n")}
+	for name, data := range files {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, data, 0600); err != nil {
+			t.Fatalf("Failed to write key file: %+v", err)
+		}
+		loaded, err := loadEncryptionKey(EncryptionKeyParams{Path: path})
+		if err != nil {
+			t.Errorf("Failed to load %s key: %+v", name, err)
+		} else if !bytes.Equal(loaded, key) {
+			t.Errorf("Unexpected %s key.\nexpected: %x\nreceived: %x",
+				name, key, loaded)
+		}
+	}
+}
+
+// Tests that loadEncryptionKey decodes a key set in the config in hex or
+// base64.
+func TestLoadEncryptionKey_Key(t *testing.T) {
+	key := bytes.Repeat([]byte{0xCD}, encryptionKeyLen)
+	for _, encoded := range []string{
+		hex.EncodeToString(key), base64.StdEncoding.EncodeToString(key)} {
+		loaded, err := loadEncryptionKey(EncryptionKeyParams{Key: encoded})
+		if err != nil {
+			t.Errorf("Failed to load key %s: %+v", encoded, err)
+		} else if !bytes.Equal(loaded, key) {
+			t.Errorf("Unexpected key.\nexpected: %x\nreceived: %x",
+				key, loaded)
+		}
+	}
+
+	_, err := loadEncryptionKey(EncryptionKeyParams{Key: "short"})
+	if err == nil {
+		t.Errorf("No error for a key of the wrong length.")
+	}
+}
+
+// Error path: Tests that EncryptedStore.Read returns UnknownKeyErr for a file
+// encrypted with a key that is not configured.
+func TestEncryptedStore_Read_UnknownKeyErr(t *testing.T) {
+	stores := make(map[string]Store)
+	old := newTestEncryptedStore(
+		newTestEncryptionParams("a"), stores, "user", t)
+	_ = old.Write("file", []byte("data"))
+
+	es := newTestEncryptedStore(newTestEncryptionParams("b"), stores, "user", t)
+	if _, err := es.Read("file"); !errors.Is(err, UnknownKeyErr) {
+		t.Errorf("Unexpected error.\nexpected: %v\nreceived: %v",
+			UnknownKeyErr, err)
+	}
+}
+
+// Error path: Tests that EncryptedStore.Read and EncryptedStore.Reencrypt
+// return UnencryptedErr for a plaintext file placed in the underlying store,
+// since encryption is required by default.
+func TestEncryptedStore_Read_UnencryptedErr(t *testing.T) {
+	stores := make(map[string]Store)
+	es := newTestEncryptedStore(newTestEncryptionParams("a"), stores, "user", t)
+	_ = es.Write("file", []byte("data"))
+	_ = stores["user"].Write("file", []byte("injected"))
+
+	if data, err := es.Read("file"); !errors.Is(err, UnencryptedErr) {
+		t.Errorf("Unexpected error for plaintext file."+
+			"\nexpected: %v\nreceived: %v\ndata: %q", UnencryptedErr, err, data)
+	}
+	if _, err := es.Reencrypt("file"); !errors.Is(err, UnencryptedErr) {
+		t.Errorf("Unexpected error re-encrypting plaintext file."+
+			"\nexpected: %v\nreceived: %v", UnencryptedErr, err)
+	}
+	if stored, _ := stores["user"].Read("file"); string(stored) != "injected" {
+		t.Errorf("Plaintext file was rewritten: %q", stored)
+	}
+}
+
+// Error path: Tests that EncryptedStore.Read fails for an encrypted file moved
+// to another path or user.
+func TestEncryptedStore_Read_Moved(t *testing.T) {
+	stores := make(map[string]Store)
+	params := newTestEncryptionParams("a")
+	es := newTestEncryptedStore(params, stores, "user", t)
+	other := newTestEncryptedStore(params, stores, "other", t)
+	_ = es.Write("file", []byte("data"))
+	stored, _ := stores["user"].Read("file")
+	_ = stores["user"].Write("moved", stored)
+	_ = stores["other"].Write("file", stored)
+
+	if _, err := es.Read("moved"); err == nil {
+		t.Error("Read file moved to another path.")
+	}
+	if _, err := other.Read("file"); err == nil {
+		t.Error("Read file moved to another user.")
+	}
+}
+
+// Error path: Tests that NewEncryptedStore returns an error for invalid
+// parameters.
+func TestNewEncryptedStore_Error(t *testing.T) {
+	withActive := newTestEncryptionParams("a")
+	withActive["activeKey"] = "b"
+	withKey := func(key map[string]interface{}) map[string]interface{} {
+		return map[string]interface{}{"keys": []interface{}{key}}
+	}
+	tests := map[string]map[string]interface{}{
+		"no keys":        {},
+		"unknown active": withActive,
+		"duplicate key":  newTestEncryptionParams("a", "a"),
+		"no ID":          newTestEncryptionParams(""),
+		"no source":      withKey(map[string]interface{}{"id": "a"}),
+		"no salt": withKey(
+			map[string]interface{}{"id": "a", "passphrase": "p"}),
+		"two sources": withKey(map[string]interface{}{
+			"id": "a", "passphrase": "p", "salt": "s", "path": "key"}),
+		"missing key file": withKey(
+			map[string]interface{}{"id": "a", "path": "/nonexistent/key"}),
+		"unknown key": withKey(
+			map[string]interface{}{"id": "a", "file": "key"}),
+	}
+	for name, params := range tests {
+		if _, err := NewEncryptedStore(params, NewMemStore); err == nil {
+			t.Errorf("Failed to get error for %s.", name)
+		}
+	}
+}
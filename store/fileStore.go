@@ -8,12 +8,15 @@
 package store
 
 import (
+	"io"
 	ioFS "io/fs"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 	"sync"
 	"time"
+	"unicode"
 
 	"github.com/pkg/errors"
 	jww "github.com/spf13/jwalterweatherman"
@@ -21,12 +24,32 @@ import (
 	"gitlab.com/xx_network/primitives/utils"
 )
 
+// defaultGroupCommitDelay is the default maximum time that a write waits for
+// others to be synced with it with DurabilityGroup.
+const defaultGroupCommitDelay = 10 * time.Millisecond
+
+// FileParams contains the parameters of the file storage backend. They are set
+// in the "file" section of the config.
+type FileParams struct {
+	// Durability is when written files are synced to disk: DurabilityAsync,
+	// DurabilityFsync, or DurabilityGroup. Defaults to DurabilityAsync.
+	Durability string `mapstructure:"durability"`
+
+	// MaxDelay is the maximum time that a write waits for others to be synced
+	// with it with DurabilityGroup. Defaults to 10ms.
+	MaxDelay time.Duration `mapstructure:"maxDelay"`
+}
+
 // FileStore manages the file storage in a base directory. Adheres to the Store
 // interface.
 type FileStore struct {
 	baseDir       string
 	lastWritePath string
 
+	// syncer syncs written files to disk, or is nil if they are left to the
+	// operating system.
+	syncer syncer
+
 	mux sync.Mutex
 }
 
@@ -35,11 +58,13 @@ type FileStore struct {
 const FilePerm = ioFS.FileMode(0700)
 
 // NewFileStore creates a new FileStore at the specified base directory. This
-// function creates a new directory in the filesystem.
+// function creates a new directory in the filesystem. The base directory must
+// be a single path element (such as a username) so that it is created directly
+// inside the storage directory.
 //
-// Returns [NonLocalFileErr] if the file is outside the storage directory.
+// Returns [NonLocalFileErr] if the base directory is not a valid path element.
 func NewFileStore(storageDir, baseDir string) (Store, error) {
-	baseDir, err := readyPath(storageDir, baseDir)
+	baseDir, err := userDir(storageDir, baseDir)
 	if err != nil {
 		return nil, err
 	}
@@ -54,6 +79,39 @@ func NewFileStore(storageDir, baseDir string) (Store, error) {
 	return fs, nil
 }
 
+// newFileBackend returns a NewStore that creates a FileStore for each user
+// that syncs written files with the durability in the parameters. All stores
+// share one group committer, so that writes of different users are synced
+// together.
+func newFileBackend(params map[string]interface{}) (NewStore, error) {
+	p := FileParams{
+		Durability: DurabilityAsync,
+		MaxDelay:   defaultGroupCommitDelay,
+	}
+	if err := decodeParams(params, &p); err != nil {
+		return nil, err
+	}
+	fileSyncer, err := newSyncer(p.Durability, p.MaxDelay)
+	if err != nil {
+		return nil, err
+	}
+	if p.Durability == DurabilityGroup {
+		jww.INFO.Printf("Syncing written files to disk in groups every %s.",
+			p.MaxDelay)
+	} else if p.Durability == DurabilityFsync {
+		jww.INFO.Printf("Syncing each written file to disk.")
+	}
+
+	return func(storageDir, baseDir string) (Store, error) {
+		s, err := NewFileStore(storageDir, baseDir)
+		if err != nil {
+			return nil, err
+		}
+		s.(*FileStore).syncer = fileSyncer
+		return s, nil
+	}, nil
+}
+
 // Read reads from the provided file path and returns the data in the file at
 // that path.
 //
@@ -67,6 +125,33 @@ func (fs *FileStore) Read(path string) ([]byte, error) {
 	return utils.ReadFile(path)
 }
 
+// Open opens the file at the path for reading and returns it with its size in
+// bytes.
+//
+// An error is returned if it fails to open the file or it is a directory.
+// Returns [NonLocalFileErr] if the file is outside the base path.
+func (fs *FileStore) Open(path string) (io.ReadCloser, int64, error) {
+	path, err := fs.readyPath(path)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, 0, err
+	}
+	info, err := f.Stat()
+	if err == nil && info.IsDir() {
+		err = errors.Errorf("%s is a directory", path)
+	}
+	if err != nil {
+		_ = f.Close()
+		return nil, 0, err
+	}
+
+	return f, info.Size(), nil
+}
+
 // Write writes the provided data to the file path.
 //
 // An error is returned if the write fails. Returns [NonLocalFileErr] if the
@@ -77,7 +162,11 @@ func (fs *FileStore) Write(path string, data []byte) error {
 		return errors.WithStack(err)
 	}
 
-	err = utils.WriteFile(path, data, FilePerm, FilePerm)
+	if fs.syncer == nil {
+		err = utils.WriteFile(path, data, FilePerm, FilePerm)
+	} else {
+		err = fs.writeSynced(path, data)
+	}
 	if err != nil {
 		return errors.WithStack(err)
 	}
@@ -142,6 +231,110 @@ func (fs *FileStore) ReadDir(path string) ([]string, error) {
 	return files, nil
 }
 
+// Delete deletes the file at the given path.
+//
+// Returns [os.ErrNotExist] if the file does not exist. Returns
+// [NonLocalFileErr] if the file is outside the base path.
+func (fs *FileStore) Delete(path string) error {
+	path, err := fs.readyPath(path)
+	if err != nil {
+		return err
+	}
+
+	if err = os.Remove(path); err != nil || fs.syncer == nil {
+		return err
+	}
+	return fs.syncer.sync(nil, []string{filepath.Dir(path)})
+}
+
+// writeSynced writes the data to the file at the path, creating any
+// directories that do not exist, and returns once the file and the entries of
+// any created file or directory are synced to disk.
+func (fs *FileStore) writeSynced(path string, data []byte) error {
+	// The parent of each file or directory that does not exist yet gains an
+	// entry, which must be synced for it to survive a crash
+	var dirs []string
+	for p := path; ; p = filepath.Dir(p) {
+		if _, err := os.Lstat(p); err == nil || filepath.Dir(p) == p {
+			break
+		}
+		dirs = append(dirs, filepath.Dir(p))
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), FilePerm); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, FilePerm)
+	if err != nil {
+		return err
+	}
+	if _, err = f.Write(data); err == nil {
+		err = fs.syncer.sync(f, dirs)
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// ListFiles returns the paths of all files in the base path, relative to it and
+// with forward slashes, sorted lexically.
+func (fs *FileStore) ListFiles() ([]string, error) {
+	files := make([]string, 0)
+	err := filepath.WalkDir(fs.baseDir,
+		func(path string, d ioFS.DirEntry, err error) error {
+			if err != nil || d.IsDir() {
+				return err
+			}
+			rel, err := filepath.Rel(fs.baseDir, path)
+			if err != nil {
+				return err
+			}
+			files = append(files, filepath.ToSlash(rel))
+			return nil
+		})
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to list files in %s", fs.baseDir)
+	}
+	sort.Strings(files)
+
+	return files, nil
+}
+
+// Size returns the total size of all files in the base path.
+func (fs *FileStore) Size() (int64, error) {
+	var size int64
+	err := filepath.WalkDir(fs.baseDir,
+		func(path string, d ioFS.DirEntry, err error) error {
+			if err != nil || d.IsDir() {
+				return err
+			}
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			size += info.Size()
+			return nil
+		})
+	if err != nil {
+		return 0, errors.Wrapf(err, "failed to size files in %s", fs.baseDir)
+	}
+
+	return size, nil
+}
+
+// Ping returns an error if the base directory cannot be accessed, such as when
+// the volume holding the storage directory is not mounted.
+func (fs *FileStore) Ping() error {
+	info, err := os.Stat(fs.baseDir)
+	if err != nil {
+		return errors.Wrapf(err, "failed to access %s", fs.baseDir)
+	} else if !info.IsDir() {
+		return errors.Errorf("%s is not a directory", fs.baseDir)
+	}
+	return nil
+}
+
 // readyPath makes the path relative to the base directory and ensures it is
 // local. Returns NonLocalFileErr if the file is outside the base path.
 func (fs *FileStore) readyPath(path string) (string, error) {
@@ -168,9 +361,33 @@ func isLocalFile(baseDir, path string) bool {
 		jww.WARN.Printf("Failed to get relative path of %s to base %s: %+v",
 			path, baseDir, err)
 		return false
-	} else if strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+	} else if rel == ".." ||
+		strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
 		return false
 	}
 
 	return true
 }
+
+// userDir returns the path of the user's directory inside the storage
+// directory. Returns NonLocalFileErr if the username is not a valid path
+// element.
+func userDir(storageDir, username string) (string, error) {
+	if err := CheckUsername(username); err != nil {
+		return "", err
+	}
+	return filepath.Join(storageDir, username), nil
+}
+
+// CheckUsername ensures the username can be safely used as the name of the
+// user's directory. The username must be a single path element that is not
+// "." or ".." and does not contain any path separators or control characters.
+// Returns NonLocalFileErr otherwise.
+func CheckUsername(username string) error {
+	if username == "" || username == "." || username == ".." ||
+		strings.ContainsAny(username, `/\`) ||
+		strings.IndexFunc(username, unicode.IsControl) != -1 {
+		return errors.Wrapf(NonLocalFileErr, "invalid username %q", username)
+	}
+	return nil
+}
@@ -11,10 +11,12 @@ import (
 	"bytes"
 	"errors"
 	"gitlab.com/xx_network/primitives/utils"
+	"io"
 	"math/rand"
 	"os"
 	"path/filepath"
 	"reflect"
+	"strconv"
 	"testing"
 	"time"
 
@@ -24,6 +26,18 @@ import (
 // Tests that FileStore adheres to the Store interface.
 var _ Store = (*FileStore)(nil)
 
+// Tests that FileStore adheres to the Lister interface.
+var _ Lister = (*FileStore)(nil)
+
+// Tests that FileStore adheres to the Sizer interface.
+var _ Sizer = (*FileStore)(nil)
+
+// Tests that FileStore adheres to the Pinger interface.
+var _ Pinger = (*FileStore)(nil)
+
+// Tests that FileStore adheres to the Opener interface.
+var _ Opener = (*FileStore)(nil)
+
 // Unit test of NewFileStore.
 func TestNewFileStore(t *testing.T) {
 	testDir := "tmp"
@@ -130,6 +144,43 @@ func TestFileStore_Read_NonLocalPathError(t *testing.T) {
 	}
 }
 
+// Tests that FileStore.Open returns the data and size of a file, and returns an
+// error for a directory and a non-local file.
+func TestFileStore_Open(t *testing.T) {
+	testDir := "tmp"
+	defer removeTestFile(t, testDir)
+	fs, err := NewFileStore(testDir, "baseDir")
+	if err != nil {
+		t.Fatalf("Error creating new store: %+v", err)
+	}
+	contents := []byte("Lorem ipsum and such as it goes.")
+	if err = fs.Write("dir/file", contents); err != nil {
+		t.Fatalf("Failed to write file: %+v", err)
+	}
+
+	r, size, err := fs.(*FileStore).Open("dir/file")
+	if err != nil {
+		t.Fatalf("Failed to open file: %+v", err)
+	}
+	data, err := io.ReadAll(r)
+	_ = r.Close()
+	if err != nil {
+		t.Errorf("Failed to read opened file: %+v", err)
+	} else if !bytes.Equal(data, contents) || size != int64(len(contents)) {
+		t.Errorf("Unexpected file.\nexpected: %q (%d bytes)"+
+			"\nreceived: %q (%d bytes)", contents, len(contents), data, size)
+	}
+
+	if _, _, err = fs.(*FileStore).Open("dir"); err == nil {
+		t.Errorf("Failed to get error for directory.")
+	}
+	_, _, err = fs.(*FileStore).Open("../file")
+	if !errors.Is(err, NonLocalFileErr) {
+		t.Errorf("Unexpected error for non-local file."+
+			"\nexpected: %v\nreceived: %v", NonLocalFileErr, err)
+	}
+}
+
 // Tests that all the files written by FileStore.Write can be properly read by
 // FileStore.Read. Also checks that FileStore.lastWritePath is correctly updated
 // on each write.
@@ -166,6 +217,48 @@ func TestFileStore_Write_Read(t *testing.T) {
 	}
 }
 
+// Tests that FileStore.Write overwrites a file with shorter, longer, and empty
+// data.
+func TestFileStore_Write_Overwrite(t *testing.T) {
+	testDir := "tmp"
+	fs := newTestFileStore("baseDir", testDir, t)
+	defer removeTestFile(t, testDir)
+
+	for _, expected := range []string{"long file data", "short", "longer data",
+		""} {
+		if err := fs.Write("dir/file", []byte(expected)); err != nil {
+			t.Fatalf("Failed to write %q: %+v", expected, err)
+		}
+		data, err := fs.Read("dir/file")
+		if err != nil {
+			t.Fatalf("Failed to read %q: %+v", expected, err)
+		} else if string(data) != expected {
+			t.Errorf("Read unexpected data.\nexpected: %q\nreceived: %q",
+				expected, data)
+		}
+	}
+}
+
+// Benchmarks FileStore.Write overwriting a file with data of each size.
+func BenchmarkFileStore_Write(b *testing.B) {
+	for _, size := range []int{1 << 10, 64 << 10, 1 << 20} {
+		b.Run(strconv.Itoa(size), func(b *testing.B) {
+			testDir := b.TempDir()
+			fs := newTestFileStore("baseDir", testDir, b)
+			data := make([]byte, size)
+
+			b.ReportAllocs()
+			b.SetBytes(int64(size))
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if err := fs.Write("dir/file", data); err != nil {
+					b.Fatalf("Failed to write: %+v", err)
+				}
+			}
+		})
+	}
+}
+
 // Error path: Tests that FileStore.Write returns an error for an invalid path.
 func TestFileStore_Write_InvalidPathError(t *testing.T) {
 	testDir := "tmp"
@@ -307,6 +400,69 @@ func TestFileStore_ReadDir(t *testing.T) {
 	}
 }
 
+// Tests that FileStore.ListFiles returns the paths of all files written, but not
+// the directories.
+func TestFileStore_ListFiles(t *testing.T) {
+	testDir := "tmp"
+	fs := newTestFileStore("baseDir", testDir, t)
+	defer removeTestFile(t, testDir)
+
+	expected := []string{"dir1/a", "dir1/dirA/a", "dir1/dirB/dirB1/a",
+		"dir1/file", "dir2/dirC/a", "file"}
+	for i, path := range expected {
+		if err := fs.Write(path, []byte("data")); err != nil {
+			t.Errorf("Failed to write data for path %s (%d): %+v", path, i, err)
+		}
+	}
+
+	files, err := fs.ListFiles()
+	if err != nil {
+		t.Fatalf("Failed to list files: %+v", err)
+	}
+	if !reflect.DeepEqual(expected, files) {
+		t.Errorf("Unexpected files.\nexpected: %s\nreceived: %s",
+			expected, files)
+	}
+}
+
+// Tests that FileStore.Size returns the total size of all files written.
+func TestFileStore_Size(t *testing.T) {
+	testDir := "tmp"
+	fs := newTestFileStore("baseDir", testDir, t)
+	defer removeTestFile(t, testDir)
+
+	for path, data := range map[string]string{
+		"file": "data", "dir1/a": "hello", "dir1/dirA/a": "a"} {
+		if err := fs.Write(path, []byte(data)); err != nil {
+			t.Errorf("Failed to write data for path %s: %+v", path, err)
+		}
+	}
+
+	size, err := fs.Size()
+	if err != nil {
+		t.Fatalf("Failed to get size: %+v", err)
+	}
+	if size != 10 {
+		t.Errorf("Unexpected size.\nexpected: %d\nreceived: %d", 10, size)
+	}
+}
+
+// Tests that FileStore.Ping only succeeds while the base directory exists.
+func TestFileStore_Ping(t *testing.T) {
+	testDir := "tmp"
+	fs := newTestFileStore("baseDir", testDir, t)
+	defer removeTestFile(t, testDir)
+
+	if err := fs.Ping(); err != nil {
+		t.Errorf("Failed to ping: %+v", err)
+	}
+
+	removeTestFile(t, testDir)
+	if err := fs.Ping(); err == nil {
+		t.Errorf("Failed to get error for missing base directory.")
+	}
+}
+
 // Error path: Tests that FileStore.ReadDir returns NonLocalFileErr when the
 // path is not local to the base directory.
 func TestFileStore_ReadDir_NonLocalPathError(t *testing.T) {
@@ -331,6 +487,53 @@ func TestFileStore_ReadDir_InvalidPathError(t *testing.T) {
 	}
 }
 
+// Tests that FileStore.Delete removes a file written by FileStore.Write and
+// that a subsequent read fails.
+func TestFileStore_Delete(t *testing.T) {
+	testDir := "tmp"
+	fs := newTestFileStore("baseDir", testDir, t)
+	defer removeTestFile(t, testDir)
+
+	path := "dir/file.txt"
+	if err := fs.Write(path, []byte("data")); err != nil {
+		t.Fatalf("Failed to write data for path %s: %+v", path, err)
+	}
+
+	if err := fs.Delete(path); err != nil {
+		t.Errorf("Failed to delete %s: %+v", path, err)
+	}
+
+	if _, err := fs.Read(path); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Unexpected error reading deleted file."+
+			"\nexpected: %v\nreceived: %v", os.ErrNotExist, err)
+	}
+}
+
+// Error path: Tests that FileStore.Delete returns os.ErrNotExist when the file
+// does not exist.
+func TestFileStore_Delete_ErrNotExist(t *testing.T) {
+	testDir := "tmp"
+	fs := newTestFileStore("baseDir", testDir, t)
+	defer removeTestFile(t, testDir)
+
+	err := fs.Delete("file")
+	if !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Unexpected error for missing file."+
+			"\nexpected: %v\nreceived: %v", os.ErrNotExist, err)
+	}
+}
+
+// Error path: Tests that FileStore.Delete returns NonLocalFileErr when the path
+// is not local to the base directory.
+func TestFileStore_Delete_NonLocalPathError(t *testing.T) {
+	fs := &FileStore{baseDir: "baseDir"}
+	err := fs.Delete("../file")
+	if !errors.Is(err, NonLocalFileErr) {
+		t.Errorf("Unexpected error for non-local file."+
+			"\nexpected: %v\nreceived: %v", NonLocalFileErr, err)
+	}
+}
+
 func TestFileStore_readyPath(t *testing.T) {
 	fs := &FileStore{baseDir: "baseDir"}
 	tests := []struct {
@@ -388,6 +591,36 @@ func TestFileStore_isLocalFile(t *testing.T) {
 	}
 }
 
+// Tests that CheckUsername accepts usernames that are a single path element and
+// returns NonLocalFileErr for all others.
+func Test_checkUsername(t *testing.T) {
+	tests := map[string]bool{
+		"waldo":       true,
+		"carmen.sd":   true,
+		"..waldo":     true,
+		"user@xx.net": true,
+		"":            false,
+		".":           false,
+		"..":          false,
+		"dir/user":    false,
+		"user/../..":  false,
+		`dir\user`:    false,
+		"/root":       false,
+		"user\x00":    false,
+		"line\nbreak": false,
+	}
+
+	for username, valid := range tests {
+		err := CheckUsername(username)
+		if valid && err != nil {
+			t.Errorf("Failed to accept valid username %q: %+v", username, err)
+		} else if !valid && !errors.Is(err, NonLocalFileErr) {
+			t.Errorf("Unexpected error for invalid username %q."+
+				"\nexpected: %v\nreceived: %v", username, NonLocalFileErr, err)
+		}
+	}
+}
+
 // newTestFileStore creates a new FileStore for testing purposes.
 func newTestFileStore(baseDir, testDir string, t testing.TB) *FileStore {
 	fs, err := NewFileStore(testDir, baseDir)
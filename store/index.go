@@ -0,0 +1,480 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package store
+
+import (
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	jww "github.com/spf13/jwalterweatherman"
+)
+
+// defaultIndexWorkers is the default value of IndexParams.Workers.
+const defaultIndexWorkers = 4
+
+// States of a userIndex.
+const (
+	indexUnbuilt = iota
+	indexBuilding
+	indexBuilt
+)
+
+// IndexParams contains the parameters of the in-memory index of the files of
+// each user. They are set in the "index" section of the config.
+type IndexParams struct {
+	// Workers is the number of users whose files are scanned at once when the
+	// index is built on startup. Defaults to 4.
+	Workers int `mapstructure:"workers"`
+}
+
+// Index keeps the paths and modification times of the files of each user, the
+// directories that contain them, and the time of their last write in memory,
+// so that ReadDir, GetLastModified, GetLastWrite, and ListFiles are answered
+// without reaching the storage backend. The index of each user is built by
+// scanning their files, either for all users on startup with Build or in the
+// background on their first request, and is kept up to date by the writes and
+// deletes made through it. Until it is built, requests are answered by the
+// underlying store.
+//
+// Like MemoryCache, the index is not shared between processes, so changes made
+// to the storage backend by other processes are not seen.
+type Index struct {
+	params   IndexParams
+	newStore NewStore
+	users    map[string]*userIndex
+	mux      sync.Mutex
+}
+
+// IndexReport summarizes a build of the index.
+type IndexReport struct {
+	// Users is the number of users whose files were indexed.
+	Users int
+
+	// Files is the number of files indexed.
+	Files int
+
+	// Failed are the errors of the users whose files could not be indexed, by
+	// username.
+	Failed map[string]error
+}
+
+// NewIndex returns an empty Index of the stores created by newStore with the
+// parameters. Returns an error for unknown parameters or a worker count that
+// is not positive.
+func NewIndex(
+	params map[string]interface{}, newStore NewStore) (*Index, error) {
+	p := IndexParams{Workers: defaultIndexWorkers}
+	if err := decodeParams(params, &p); err != nil {
+		return nil, err
+	} else if p.Workers <= 0 {
+		return nil, errors.Errorf(
+			"index workers %d must be positive", p.Workers)
+	}
+
+	return &Index{
+		params:   p,
+		newStore: newStore,
+		users:    make(map[string]*userIndex),
+	}, nil
+}
+
+// Params returns the parameters of the index.
+func (idx *Index) Params() IndexParams {
+	return idx.params
+}
+
+// NewStore adheres to NewStore. It wraps the Store created by the underlying
+// NewStore in an IndexedStore that uses the index of the user of the base
+// directory.
+func (idx *Index) NewStore(storageDir, baseDir string) (Store, error) {
+	s, err := idx.newStore(storageDir, baseDir)
+	if err != nil {
+		return nil, err
+	}
+	return &IndexedStore{Store: s, idx: idx, user: idx.user(baseDir),
+		storageDir: storageDir, baseDir: baseDir}, nil
+}
+
+// Build indexes the files of each of the users in the storage directory, with
+// the number of workers of the parameters, and returns a report of the build.
+// Users that are already indexed are not scanned again.
+func (idx *Index) Build(storageDir string, usernames []string) IndexReport {
+	report := IndexReport{Failed: make(map[string]error)}
+	var mux sync.Mutex
+	work := make(chan string)
+	var wg sync.WaitGroup
+	for i := 0; i < idx.params.Workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for username := range work {
+				files, err := idx.build(storageDir, username)
+				mux.Lock()
+				if err != nil {
+					report.Failed[username] = err
+				} else {
+					report.Users++
+					report.Files += files
+				}
+				mux.Unlock()
+			}
+		}()
+	}
+	for _, username := range usernames {
+		work <- username
+	}
+	close(work)
+	wg.Wait()
+	return report
+}
+
+// user returns the index of the user, adding an unbuilt one if it has none.
+func (idx *Index) user(username string) *userIndex {
+	idx.mux.Lock()
+	defer idx.mux.Unlock()
+	ui, exists := idx.users[username]
+	if !exists {
+		ui = &userIndex{}
+		idx.users[username] = ui
+	}
+	return ui
+}
+
+// build scans the files of the user and returns how many were indexed. Does
+// nothing if the user is already indexed or being indexed.
+func (idx *Index) build(storageDir, username string) (int, error) {
+	ui := idx.user(username)
+	ui.mux.Lock()
+	if ui.state != indexUnbuilt {
+		n := len(ui.files)
+		ui.mux.Unlock()
+		return n, nil
+	}
+	ui.startBuild()
+	ui.mux.Unlock()
+	return idx.scan(ui, storageDir, username)
+}
+
+// scan indexes the files of the user, whose index must be building, and
+// returns how many were indexed. The writes and deletes made while scanning
+// are applied once it completes. If it fails, the index is left unbuilt.
+func (idx *Index) scan(
+	ui *userIndex, storageDir, username string) (int, error) {
+	s, err := idx.newStore(storageDir, username)
+	if err == nil {
+		var files map[string]time.Time
+		if files, err = scanFiles(s); err == nil {
+			ui.mux.Lock()
+			defer ui.mux.Unlock()
+			pending := ui.pending
+			ui.reset(indexBuilt)
+			for key, modified := range files {
+				ui.add(key, modified)
+			}
+			for key := range pending {
+				ui.refresh(s, key)
+			}
+			return len(ui.files), nil
+		}
+	}
+
+	ui.mux.Lock()
+	ui.reset(indexUnbuilt)
+	ui.mux.Unlock()
+	return 0, errors.Wrapf(err, "failed to index files of %q", username)
+}
+
+// scanFiles returns the modification time of each file of the store by its
+// key. Files deleted while they are listed are skipped.
+func scanFiles(s Store) (map[string]time.Time, error) {
+	lister, ok := s.(Lister)
+	if !ok {
+		return nil, errors.New("store cannot list its files")
+	}
+	paths, err := lister.ListFiles()
+	if err != nil {
+		return nil, err
+	}
+	files := make(map[string]time.Time, len(paths))
+	for _, p := range paths {
+		modified, err := s.GetLastModified(p)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		} else if err != nil {
+			return nil, errors.Wrapf(err, "failed to get modification time "+
+				"of %s", p)
+		}
+		files[p] = modified
+	}
+	return files, nil
+}
+
+// userIndex is the index of the files of one user.
+type userIndex struct {
+	state int
+
+	// files are the modification times of the files by key, and lastWrite
+	// the latest of them and of the writes since the index was built.
+	files     map[string]time.Time
+	lastWrite time.Time
+
+	// dirs are the number of files under each subdirectory of each directory
+	// with files, by the key of the directory and the name of the
+	// subdirectory. The base directory has the empty key.
+	dirs map[string]map[string]int
+
+	// pending are the keys of the files written or deleted while the index is
+	// being built, which are refreshed once it is.
+	pending map[string]struct{}
+
+	mux sync.Mutex
+}
+
+// startBuild marks the index as building, so that the files changed until it
+// is built are recorded. The caller must hold the lock.
+func (ui *userIndex) startBuild() {
+	ui.state, ui.pending = indexBuilding, make(map[string]struct{})
+}
+
+// reset empties the index and sets its state. The caller must hold the lock.
+func (ui *userIndex) reset(state int) {
+	ui.state = state
+	ui.files = make(map[string]time.Time)
+	ui.dirs = make(map[string]map[string]int)
+	ui.lastWrite = time.Time{}
+	ui.pending = nil
+}
+
+// add adds the file to the index, or updates its modification time. The
+// caller must hold the lock.
+func (ui *userIndex) add(key string, modified time.Time) {
+	if modified.After(ui.lastWrite) {
+		ui.lastWrite = modified
+	}
+	if _, exists := ui.files[key]; !exists {
+		ui.updateDirs(key, 1)
+	}
+	ui.files[key] = modified
+}
+
+// remove removes the file from the index. The caller must hold the lock.
+func (ui *userIndex) remove(key string) {
+	if _, exists := ui.files[key]; exists {
+		delete(ui.files, key)
+		ui.updateDirs(key, -1)
+	}
+}
+
+// updateDirs adds delta to the count of files under each directory containing
+// the file. Directories without files are removed. The caller must hold the
+// lock.
+func (ui *userIndex) updateDirs(key string, delta int) {
+	parts := strings.Split(key, "/")
+	for i := 0; i < len(parts)-1; i++ {
+		dir, name := strings.Join(parts[:i], "/"), parts[i]
+		subdirs, exists := ui.dirs[dir]
+		if !exists {
+			subdirs = make(map[string]int)
+			ui.dirs[dir] = subdirs
+		}
+		if subdirs[name] += delta; subdirs[name] <= 0 {
+			delete(subdirs, name)
+		}
+		if len(subdirs) == 0 {
+			delete(ui.dirs, dir)
+		}
+	}
+}
+
+// refresh updates the file in the index from its modification time in the
+// store, removing it if it does not exist. Returns false if the modification
+// time cannot be read. The caller must hold the lock.
+func (ui *userIndex) refresh(s Store, key string) bool {
+	modified, err := s.GetLastModified(key)
+	if errors.Is(err, os.ErrNotExist) {
+		ui.remove(key)
+	} else if err != nil {
+		return false
+	} else {
+		ui.add(key, modified)
+	}
+	return true
+}
+
+// IndexedStore answers ReadDir, GetLastModified, GetLastWrite, and ListFiles
+// from the index of its user, once it is built, and keeps the index up to date
+// with its writes and deletes. Directories left empty by deletes are not
+// listed, as in S3. Adheres to the Store interface.
+type IndexedStore struct {
+	Store
+	idx                 *Index
+	user                *userIndex
+	storageDir, baseDir string
+}
+
+// Write writes the data to the underlying store and updates the file in the
+// index.
+func (is *IndexedStore) Write(path string, data []byte) error {
+	err := is.Store.Write(path, data)
+	is.changed(path, err)
+	return err
+}
+
+// Delete deletes the file from the underlying store and removes it from the
+// index.
+func (is *IndexedStore) Delete(path string) error {
+	err := is.Store.Delete(path)
+	is.changed(path, err)
+	return err
+}
+
+// GetLastModified returns the modification time of the file in the index.
+// Files that are not in it are looked up in the underlying store.
+func (is *IndexedStore) GetLastModified(path string) (time.Time, error) {
+	if key, err := readyKey("", path); err == nil {
+		is.user.mux.Lock()
+		modified, exists := is.user.files[key]
+		built := is.built()
+		is.user.mux.Unlock()
+		if built && exists {
+			return modified, nil
+		}
+	}
+	return is.Store.GetLastModified(path)
+}
+
+// GetLastWrite returns the time of the latest write in the index. Users
+// without files are looked up in the underlying store.
+func (is *IndexedStore) GetLastWrite() (time.Time, error) {
+	is.user.mux.Lock()
+	lastWrite := is.user.lastWrite
+	built := is.built()
+	is.user.mux.Unlock()
+	if built && !lastWrite.IsZero() {
+		return lastWrite, nil
+	}
+	return is.Store.GetLastWrite()
+}
+
+// ReadDir returns the subdirectories of the directory in the index, sorted by
+// name. Directories without files are looked up in the underlying store.
+func (is *IndexedStore) ReadDir(path string) ([]string, error) {
+	if key, err := readyKey("", path); err == nil {
+		is.user.mux.Lock()
+		subdirs, exists := is.user.dirs[key]
+		built := is.built()
+		var names []string
+		if built && exists {
+			names = make([]string, 0, len(subdirs))
+			for name := range subdirs {
+				names = append(names, name)
+			}
+		}
+		is.user.mux.Unlock()
+		if names != nil {
+			sort.Strings(names)
+			return names, nil
+		}
+	}
+	return is.Store.ReadDir(path)
+}
+
+// ListFiles returns the paths of all files in the index, sorted lexically.
+// Until the index is built, the files are listed by the underlying store,
+// which returns an error if it does not implement Lister.
+func (is *IndexedStore) ListFiles() ([]string, error) {
+	is.user.mux.Lock()
+	if is.built() {
+		files := make([]string, 0, len(is.user.files))
+		for key := range is.user.files {
+			files = append(files, key)
+		}
+		is.user.mux.Unlock()
+		sort.Strings(files)
+		return files, nil
+	}
+	is.user.mux.Unlock()
+
+	lister, ok := is.Store.(Lister)
+	if !ok {
+		return nil, errors.New("underlying store cannot list its files")
+	}
+	return lister.ListFiles()
+}
+
+// Open opens the file in the underlying store.
+func (is *IndexedStore) Open(path string) (io.ReadCloser, int64, error) {
+	return Open(is.Store, path)
+}
+
+// Size returns the total size of the files in the underlying store. Returns an
+// error if the underlying store does not implement Sizer.
+func (is *IndexedStore) Size() (int64, error) {
+	sizer, ok := is.Store.(Sizer)
+	if !ok {
+		return 0, errors.New("underlying store cannot report its size")
+	}
+	return sizer.Size()
+}
+
+// Ping returns an error if the underlying store cannot be reached. Stores that
+// do not implement Pinger are assumed to be reachable.
+func (is *IndexedStore) Ping() error {
+	if pinger, ok := is.Store.(Pinger); ok {
+		return pinger.Ping()
+	}
+	return nil
+}
+
+// built returns true if the index of the user is built. Otherwise, it starts
+// building it in the background unless it is already being built. The caller
+// must hold the lock of the index of the user.
+func (is *IndexedStore) built() bool {
+	switch is.user.state {
+	case indexBuilt:
+		return true
+	case indexUnbuilt:
+		is.user.startBuild()
+		go func() {
+			_, err := is.idx.scan(is.user, is.storageDir, is.baseDir)
+			if err != nil {
+				jww.WARN.Printf("%+v", err)
+			}
+		}()
+	}
+	return false
+}
+
+// changed updates the file at the path in the index after it was written or
+// deleted with the error. It is refreshed from the underlying store, since a
+// failed change may have partially succeeded. If a successful change cannot be
+// refreshed, the index is dropped and built again.
+func (is *IndexedStore) changed(path string, err error) {
+	key, keyErr := readyKey("", path)
+	if keyErr != nil {
+		return
+	}
+
+	is.user.mux.Lock()
+	defer is.user.mux.Unlock()
+	switch is.user.state {
+	case indexBuilding:
+		is.user.pending[key] = struct{}{}
+	case indexBuilt:
+		if !is.user.refresh(is.Store, key) && err == nil {
+			jww.WARN.Printf("Failed to update the index of %q after "+
+				"changing %s; rebuilding it.", is.baseDir, key)
+			is.user.reset(indexUnbuilt)
+		}
+	}
+}
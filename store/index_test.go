@@ -0,0 +1,232 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package store
+
+import (
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Tests that IndexedStore adheres to the Store interface.
+var _ Store = (*IndexedStore)(nil)
+
+// Tests that IndexedStore adheres to the Lister interface.
+var _ Lister = (*IndexedStore)(nil)
+
+// Tests that IndexedStore adheres to the Opener interface.
+var _ Opener = (*IndexedStore)(nil)
+
+// Tests that Index.Build indexes the files of each user, that IndexedStore
+// answers from the index, and that writes and deletes through it update the
+// index.
+func TestIndex_Build(t *testing.T) {
+	idx, stores := newTestIndex(t, nil, "waldo", "fred")
+	ms := stores["waldo"]
+	for _, p := range []string{"a/1/file", "a/2/file", "b/file", "file"} {
+		_ = ms.Write(p, []byte(p))
+	}
+	_ = stores["fred"].Write("fred/file", []byte("fred"))
+	modified, _ := ms.GetLastModified("a/1/file")
+	lastWrite, _ := ms.GetLastModified("file")
+
+	report := idx.Build("", []string{"waldo", "fred"})
+	if report.Users != 2 || report.Files != 5 || len(report.Failed) != 0 {
+		t.Errorf("Unexpected report: %+v", report)
+	}
+
+	s, err := idx.NewStore("", "waldo")
+	if err != nil {
+		t.Fatalf("Failed to create store: %+v", err)
+	}
+
+	// Changes made directly to the underlying store are not seen
+	time.Sleep(time.Millisecond)
+	_ = ms.Write("a/1/file", []byte("new"))
+	_ = ms.Write("c/file", []byte("new"))
+	if lm, _ := s.GetLastModified("a/./1/file"); !lm.Equal(modified) {
+		t.Errorf("Last modified not read from index."+
+			"\nexpected: %s\nreceived: %s", modified, lm)
+	}
+	if lw, _ := s.GetLastWrite(); !lw.Equal(lastWrite) {
+		t.Errorf("Last write not read from index."+
+			"\nexpected: %s\nreceived: %s", lastWrite, lw)
+	}
+	checkReadDir(t, s, "", []string{"a", "b"})
+	checkReadDir(t, s, "a", []string{"1", "2"})
+	files, _ := s.(Lister).ListFiles()
+	expected := []string{"a/1/file", "a/2/file", "b/file", "file"}
+	if !reflect.DeepEqual(expected, files) {
+		t.Errorf("Unexpected files.\nexpected: %q\nreceived: %q",
+			expected, files)
+	}
+
+	// Writes and deletes through the store update the index
+	time.Sleep(time.Millisecond)
+	if err = s.Write("d/e/file", []byte("new")); err != nil {
+		t.Fatalf("Failed to write file: %+v", err)
+	}
+	lastWrite, _ = ms.GetLastModified("d/e/file")
+	if lw, _ := s.GetLastWrite(); !lw.Equal(lastWrite) {
+		t.Errorf("Last write not updated.\nexpected: %s\nreceived: %s",
+			lastWrite, lw)
+	}
+	if err = s.Delete("b/file"); err != nil {
+		t.Fatalf("Failed to delete file: %+v", err)
+	}
+	if err = s.Delete("a/2/file"); err != nil {
+		t.Fatalf("Failed to delete file: %+v", err)
+	}
+	checkReadDir(t, s, "", []string{"a", "d"})
+	checkReadDir(t, s, "a", []string{"1"})
+	checkReadDir(t, s, "d", []string{"e"})
+	if _, err = s.GetLastModified("b/file"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Unexpected error for deleted file."+
+			"\nexpected: %v\nreceived: %v", os.ErrNotExist, err)
+	}
+
+	// Each user has their own index
+	fred, _ := idx.NewStore("", "fred")
+	checkReadDir(t, fred, "", []string{"fred"})
+}
+
+// Tests that an IndexedStore of a user who is not indexed answers from the
+// underlying store and builds the index in the background.
+func TestIndexedStore_Lazy(t *testing.T) {
+	idx, stores := newTestIndex(t, nil, "waldo")
+	_ = stores["waldo"].Write("dir/file", []byte("data"))
+	s, _ := idx.NewStore("", "waldo")
+
+	checkReadDir(t, s, "", []string{"dir"})
+	for i := 0; !isBuilt(idx, "waldo"); i++ {
+		if i == 100 {
+			t.Fatalf("Index was not built.")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	_ = stores["waldo"].Write("other/file", []byte("data"))
+	checkReadDir(t, s, "", []string{"dir"})
+}
+
+// Tests that the files written and deleted while the index is being built are
+// updated once it is built.
+func TestIndex_Build_Pending(t *testing.T) {
+	listing, resume := make(chan struct{}), make(chan struct{})
+	ms, _ := NewMemStore("", "")
+	_ = ms.Write("deleted/file", []byte("data"))
+	idx, err := NewIndex(nil, func(string, string) (Store, error) {
+		return &blockingLister{ms, listing, resume}, nil
+	})
+	if err != nil {
+		t.Fatalf("Failed to create index: %+v", err)
+	}
+
+	done := make(chan IndexReport)
+	go func() { done <- idx.Build("", []string{"waldo"}) }()
+	<-listing
+	s, _ := idx.NewStore("", "waldo")
+	_ = s.Write("written/file", []byte("data"))
+	_ = s.Delete("deleted/file")
+	close(resume)
+	if report := <-done; report.Files != 1 {
+		t.Errorf("Unexpected report: %+v", report)
+	}
+
+	checkReadDir(t, s, "", []string{"written"})
+}
+
+// Error path: Tests that Index.Build reports the users whose files cannot be
+// listed and leaves their index unbuilt.
+func TestIndex_Build_Error(t *testing.T) {
+	ms, _ := NewMemStore("", "")
+	idx, err := NewIndex(nil, func(string, string) (Store, error) {
+		return struct{ Store }{ms}, nil
+	})
+	if err != nil {
+		t.Fatalf("Failed to create index: %+v", err)
+	}
+
+	report := idx.Build("", []string{"waldo"})
+	if report.Users != 0 || report.Failed["waldo"] == nil {
+		t.Errorf("Unexpected report: %+v", report)
+	}
+	if state := idx.user("waldo").state; state != indexUnbuilt {
+		t.Errorf("Unexpected state.\nexpected: %d\nreceived: %d",
+			indexUnbuilt, state)
+	}
+}
+
+// Error path: Tests that NewIndex returns an error for unknown parameters and
+// a worker count that is not positive.
+func TestNewIndex_Error(t *testing.T) {
+	tests := []map[string]interface{}{
+		{"worker": 4},
+		{"workers": 0},
+	}
+	for _, params := range tests {
+		if _, err := NewIndex(params, NewMemStore); err == nil {
+			t.Errorf("No error for parameters %+v.", params)
+		}
+	}
+}
+
+// blockingLister is a Store that signals listing when its files are listed
+// and waits for resume to list them.
+type blockingLister struct {
+	Store
+	listing, resume chan struct{}
+}
+
+// ListFiles signals that the files are being listed, waits, and lists them.
+func (bl *blockingLister) ListFiles() ([]string, error) {
+	bl.listing <- struct{}{}
+	<-bl.resume
+	return bl.Store.(Lister).ListFiles()
+}
+
+// newTestIndex creates an Index of a MemStore for each of the users and
+// returns it with the stores by username.
+func newTestIndex(t *testing.T, params map[string]interface{},
+	usernames ...string) (*Index, map[string]Store) {
+	stores := make(map[string]Store, len(usernames))
+	for _, username := range usernames {
+		stores[username], _ = NewMemStore("", username)
+	}
+	idx, err := NewIndex(params, func(_, baseDir string) (Store, error) {
+		return stores[baseDir], nil
+	})
+	if err != nil {
+		t.Fatalf("Failed to create index: %+v", err)
+	}
+	return idx, stores
+}
+
+// isBuilt returns true if the index of the user is built.
+func isBuilt(idx *Index, username string) bool {
+	ui := idx.user(username)
+	ui.mux.Lock()
+	defer ui.mux.Unlock()
+	return ui.state == indexBuilt
+}
+
+// checkReadDir checks that ReadDir of the directory returns the expected
+// entries.
+func checkReadDir(t *testing.T, s Store, dir string, expected []string) {
+	t.Helper()
+	entries, err := s.ReadDir(dir)
+	if err != nil {
+		t.Errorf("Failed to read %q: %+v", dir, err)
+	} else if !reflect.DeepEqual(expected, entries) {
+		t.Errorf("Unexpected entries of %q.\nexpected: %q\nreceived: %q",
+			dir, expected, entries)
+	}
+}
@@ -8,51 +8,136 @@
 package store
 
 import (
-	"time"
+	"bytes"
+	"io"
 
-	"github.com/pkg/errors"
+	"gitlab.com/elixxir/remoteSyncServer/storage"
 )
 
 var (
 	// NonLocalFileErr is returned when attempting to read or write to file or
-	// directory outside the base directory.
-	NonLocalFileErr = errors.New("file path not in local base directory")
+	// directory outside the base directory. It is [storage.NonLocalFileErr].
+	NonLocalFileErr = storage.NonLocalFileErr
+
+	// StorageFullErr is returned when a write would exceed the storage size
+	// limit of the backend. It is [storage.StorageFullErr].
+	StorageFullErr = storage.StorageFullErr
 )
 
-// NewStore generates a new Store for the given base directory that will be
-// created in the storage directory.
-//
-// Returns [NonLocalFileErr] if the file is outside the storage directory.
-type NewStore func(storageDir, baseDir string) (Store, error)
+// NewStore is [storage.NewStore], kept here so that backends in this package
+// can refer to it unqualified.
+type NewStore = storage.NewStore
 
-// Store copies the [collective.RemoteStore] interface.
-type Store interface {
-	// Read reads from the provided file path and returns the data in the file
-	// at that path.
-	//
-	// An error is returned if it fails to read the file. Returns
-	// [NonLocalFileErr] if the file is outside the base path.
-	Read(path string) ([]byte, error)
+// Store is [storage.Store], kept here so that backends in this package can
+// refer to it unqualified.
+type Store = storage.Store
 
-	// Write writes the provided data to the file path.
-	//
-	// An error is returned if the write fails. Returns [NonLocalFileErr] if the
-	// file is outside the base path.
-	Write(path string, data []byte) error
+// Lister is implemented by stores that can list all files of their user, such
+// as to migrate them to another backend.
+type Lister interface {
+	// ListFiles returns the paths of all files in the base path, relative to
+	// it and with forward slashes, sorted lexically.
+	ListFiles() ([]string, error)
+}
 
-	// GetLastModified returns the last modification time for the file at the
-	// given file.
+// Sizer is implemented by stores that can report the total size of their
+// user's files, such as for storage usage metrics.
+type Sizer interface {
+	// Size returns the total size, in bytes, of all files in the base path.
+	Size() (int64, error)
+}
+
+// Pinger is implemented by stores that can check that their storage backend is
+// reachable, such as for readiness checks.
+type Pinger interface {
+	// Ping returns an error if the storage backend cannot be reached.
+	Ping() error
+}
+
+// Opener is implemented by stores that can read a file without loading all of
+// it into memory, such as to stream large files to clients.
+type Opener interface {
+	// Open opens the file at the path for reading and returns it with its size
+	// in bytes. The caller must close it.
 	//
 	// Returns [NonLocalFileErr] if the file is outside the base path.
-	GetLastModified(path string) (time.Time, error)
+	Open(path string) (io.ReadCloser, int64, error)
+}
+
+// Open opens the file at the path in the store for reading and returns it with
+// its size in bytes. Stores that do not implement Opener, such as those that
+// transform or verify the data of files, are read into memory, and the
+// returned reader can seek in the data.
+func Open(s Store, path string) (io.ReadCloser, int64, error) {
+	if opener, ok := s.(Opener); ok {
+		return opener.Open(path)
+	}
+	data, err := s.Read(path)
+	if err != nil {
+		return nil, 0, err
+	}
+	return bytesFile{bytes.NewReader(data)}, int64(len(data)), nil
+}
+
+// bytesFile is the data of a file read into memory. Closing it does nothing.
+type bytesFile struct {
+	*bytes.Reader
+}
 
-	// GetLastWrite returns the time of the most recent successful Write
-	// operation that was performed.
-	GetLastWrite() (time.Time, error)
+// Close does nothing.
+func (bytesFile) Close() error {
+	return nil
+}
 
-	// ReadDir reads the named directory, returning all its directory entries
-	// sorted by filename.
+// MetadataTracker is implemented by stores that record the metadata of files.
+type MetadataTracker interface {
+	// Stat returns the metadata of the file at the path.
 	//
-	// Returns [NonLocalFileErr] if the file is outside the base path.
-	ReadDir(path string) ([]string, error)
+	// Returns [os.ErrNotExist] if the file does not exist.
+	Stat(path string) (Metadata, error)
+
+	// SetDevice records the device as the writer of the file at the path if
+	// the SHA-256 hash of its data matches.
+	SetDevice(path string, sha256 []byte, device string) error
+}
+
+// Stat returns the metadata of the file at the path in the store. Stores that
+// do not implement MetadataTracker are described from the data of the file,
+// without its creation time or device.
+func Stat(s Store, path string) (Metadata, error) {
+	if tracker, ok := s.(MetadataTracker); ok {
+		return tracker.Stat(path)
+	}
+	return describe(s, path)
+}
+
+// SetDevice records the device as the writer of the file at the path in the
+// store if the SHA-256 hash of its data matches. Does nothing if the store does
+// not implement MetadataTracker.
+func SetDevice(s Store, path string, sha256 []byte, device string) error {
+	if tracker, ok := s.(MetadataTracker); ok {
+		return tracker.SetDevice(path, sha256, device)
+	}
+	return nil
+}
+
+// Versioner is implemented by stores that keep previous versions of files, so
+// that a file that was overwritten or deleted can be recovered.
+type Versioner interface {
+	// ListVersions returns the previous versions of the file at the path,
+	// oldest first.
+	ListVersions(path string) ([]Version, error)
+
+	// ReadVersion returns the data of the previous version of the file at the
+	// path with the ID.
+	//
+	// Returns [os.ErrNotExist] if the file has no version with the ID.
+	ReadVersion(path string, id uint64) ([]byte, error)
+
+	// VersionedFiles returns the paths of all files that have previous
+	// versions, including files that were deleted, sorted lexically.
+	VersionedFiles() ([]string, error)
+
+	// PurgeVersions removes all previous versions of the file at the path.
+	PurgeVersions(path string) error
 }
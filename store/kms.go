@@ -0,0 +1,202 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package store
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/minio/minio-go/v7/pkg/credentials"
+	"github.com/pkg/errors"
+
+	"gitlab.com/xx_network/primitives/netTime"
+)
+
+// kmsDecryptTarget is the AWS KMS API operation that decrypts a data key.
+const kmsDecryptTarget = "TrentService.Decrypt"
+
+// defaultKMSTimeout is the default maximum duration of a KMS request, the same
+// as that of requests to the secrets provider, so that a KMS endpoint that
+// does not respond cannot block startup.
+const defaultKMSTimeout = defaultSecretsTimeout
+
+// KMSParams contains the parameters used to decrypt an encryption key with AWS
+// KMS (or a compatible service). The key is stored encrypted in the config, as
+// output by "aws kms generate-data-key", and is decrypted once at startup.
+type KMSParams struct {
+	// CiphertextBlob is the base64-encoded encrypted key.
+	CiphertextBlob string `mapstructure:"ciphertextBlob"`
+
+	// KeyID is the ID or ARN of the KMS key that encrypted the key. It is
+	// optional for symmetric KMS keys.
+	KeyID string `mapstructure:"keyID"`
+
+	// Region is the region of the KMS key.
+	Region string `mapstructure:"region"`
+
+	// Endpoint is the URL or host of the KMS API. Defaults to the AWS
+	// endpoint of the region.
+	Endpoint string `mapstructure:"endpoint"`
+
+	// AccessKeyID and SecretAccessKey are the static credentials used to
+	// access KMS. If they are not set, credentials are read from the standard
+	// AWS environment variables and, on AWS, from IAM.
+	AccessKeyID     string `mapstructure:"accessKeyID"`
+	SecretAccessKey string `mapstructure:"secretAccessKey"`
+	SessionToken    string `mapstructure:"sessionToken"`
+
+	// Timeout is the maximum duration of the request. Defaults to 10s.
+	Timeout time.Duration `mapstructure:"timeout"`
+}
+
+// kmsDecrypt decrypts the key in the parameters with the KMS Decrypt API and
+// returns the plaintext key.
+func kmsDecrypt(p KMSParams) ([]byte, error) {
+	if p.CiphertextBlob == "" {
+		return nil, errors.New("no KMS ciphertextBlob specified")
+	} else if p.Region == "" {
+		return nil, errors.New("no KMS region specified")
+	} else if p.Timeout < 0 {
+		return nil, errors.Errorf("KMS timeout %s cannot be negative", p.Timeout)
+	} else if p.Timeout == 0 {
+		p.Timeout = defaultKMSTimeout
+	}
+	blob, err := base64.StdEncoding.DecodeString(p.CiphertextBlob)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid KMS ciphertextBlob")
+	}
+
+	endpoint := p.Endpoint
+	if endpoint == "" {
+		endpoint = "kms." + p.Region + ".amazonaws.com"
+	}
+	if !strings.Contains(endpoint, "://") {
+		endpoint = "https://" + endpoint
+	}
+
+	creds := credentials.NewChainCredentials([]credentials.Provider{
+		&credentials.EnvAWS{}, &credentials.IAM{}})
+	if p.AccessKeyID != "" {
+		creds = credentials.NewStaticV4(
+			p.AccessKeyID, p.SecretAccessKey, p.SessionToken)
+	}
+	value, err := creds.Get()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get KMS credentials")
+	}
+
+	body, err := json.Marshal(struct {
+		CiphertextBlob []byte `json:"CiphertextBlob"`
+		KeyId          string `json:"KeyId,omitempty"`
+	}{blob, p.KeyID})
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := newContext(p.Timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(
+		ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid KMS endpoint %s", endpoint)
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", kmsDecryptTarget)
+	signV4(req, body, value, p.Region, "kms", netTime.Now())
+
+	resp, err := secretsClient.Do(req)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to send KMS request")
+	}
+	defer func() { _ = resp.Body.Close() }()
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read KMS response")
+	}
+
+	var decrypted struct {
+		Plaintext []byte `json:"Plaintext"`
+		Type      string `json:"__type"`
+		Message   string `json:"message"`
+	}
+	if err = json.Unmarshal(respBody, &decrypted); err != nil {
+		return nil, errors.Wrapf(err, "failed to decode KMS response (%s)",
+			resp.Status)
+	} else if resp.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("KMS decrypt failed (%s): %s: %s",
+			resp.Status, decrypted.Type, decrypted.Message)
+	}
+	return decrypted.Plaintext, nil
+}
+
+// signV4 signs the request for the AWS service with Signature Version 4. All
+// headers set on the request are signed.
+func signV4(req *http.Request, body []byte, creds credentials.Value, region,
+	service string, now time.Time) {
+	amzDate := now.UTC().Format("20060102T150405Z")
+	date := amzDate[:8]
+	req.Header.Set("X-Amz-Date", amzDate)
+	if creds.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", creds.SessionToken)
+	}
+
+	names := []string{"host"}
+	for name := range req.Header {
+		names = append(names, strings.ToLower(name))
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		value := req.Header.Get(name)
+		if name == "host" {
+			value = req.URL.Host
+		}
+		canonicalHeaders.WriteString(
+			name + ":" + strings.TrimSpace(value) + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	uri := req.URL.EscapedPath()
+	if uri == "" {
+		uri = "/"
+	}
+	bodyHash := sha256.Sum256(body)
+	canonicalRequest := strings.Join([]string{req.Method, uri,
+		req.URL.RawQuery, canonicalHeaders.String(), signedHeaders,
+		hex.EncodeToString(bodyHash[:])}, "\n")
+
+	scope := date + "/" + region + "/" + service + "/aws4_request"
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" +
+		hex.EncodeToString(requestHash[:])
+
+	key := []byte("AWS4" + creds.SecretAccessKey)
+	for _, part := range []string{date, region, service, "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+
+		creds.AccessKeyID+"/"+scope+", SignedHeaders="+signedHeaders+
+		", Signature="+signature)
+}
+
+// hmacSHA256 returns the HMAC-SHA256 of the data with the key.
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
@@ -0,0 +1,119 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package store
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// Tests that signV4 produces the signature of the example request in the AWS
+// Signature Version 4 documentation.
+func TestSignV4(t *testing.T) {
+	req, _ := http.NewRequest(http.MethodGet,
+		"https://iam.amazonaws.com/?Action=ListUsers&Version=2010-05-08", nil)
+	req.Header.Set("Content-Type",
+		"application/x-www-form-urlencoded; charset=utf-8")
+	creds := credentials.Value{
+		AccessKeyID:     "AKIDEXAMPLE",
+		SecretAccessKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY",
+	}
+	signV4(req, nil, creds, "us-east-1", "iam",
+		time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC))
+
+	expected := "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/" +
+		"iam/aws4_request, SignedHeaders=content-type;host;x-amz-date, " +
+		"Signature=5d672d79c15b13162d9279b0855cfba6789a8edb4c82c400e06b5924a" +
+		"6f2b5d7"
+	if received := req.Header.Get("Authorization"); received != expected {
+		t.Errorf("Unexpected Authorization header."+
+			"\nexpected: %s\nreceived: %s", expected, received)
+	}
+}
+
+// Tests that kmsDecrypt sends the encrypted key to the KMS Decrypt API and
+// returns the plaintext key.
+func TestKmsDecrypt(t *testing.T) {
+	key := bytes.Repeat([]byte{1}, encryptionKeyLen)
+	blob := []byte("encrypted key")
+	ts := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			var req struct{ CiphertextBlob []byte }
+			_ = json.NewDecoder(r.Body).Decode(&req)
+			if r.Header.Get("X-Amz-Target") != kmsDecryptTarget ||
+				!strings.HasPrefix(r.Header.Get("Authorization"),
+					"AWS4-HMAC-SHA256 Credential=id/") ||
+				!bytes.Equal(req.CiphertextBlob, blob) {
+				w.WriteHeader(http.StatusBadRequest)
+				_, _ = w.Write(
+					[]byte(`{"__type": "InvalidCiphertextException"}`))
+				return
+			}
+			_ = json.NewEncoder(w).Encode(map[string][]byte{"Plaintext": key})
+		}))
+	defer ts.Close()
+
+	p := KMSParams{
+		CiphertextBlob:  base64.StdEncoding.EncodeToString(blob),
+		Region:          "us-east-1",
+		Endpoint:        ts.URL,
+		AccessKeyID:     "id",
+		SecretAccessKey: "secret",
+	}
+	decrypted, err := kmsDecrypt(p)
+	if err != nil {
+		t.Fatalf("Failed to decrypt key: %+v", err)
+	} else if !bytes.Equal(decrypted, key) {
+		t.Errorf("Unexpected key.\nexpected: %x\nreceived: %x", key, decrypted)
+	}
+
+	// Error path: the KMS error is returned
+	p.CiphertextBlob = base64.StdEncoding.EncodeToString([]byte("other"))
+	if _, err = kmsDecrypt(p); err == nil ||
+		!strings.Contains(err.Error(), "InvalidCiphertextException") {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
+
+// Error path: Tests that kmsDecrypt gives up on a KMS endpoint that does not
+// respond once the timeout passes and rejects a negative timeout.
+func TestKmsDecrypt_Timeout(t *testing.T) {
+	done := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(
+		func(http.ResponseWriter, *http.Request) { <-done }))
+	defer ts.Close()
+	defer close(done)
+
+	p := KMSParams{
+		CiphertextBlob:  base64.StdEncoding.EncodeToString([]byte("key")),
+		Region:          "us-east-1",
+		Endpoint:        ts.URL,
+		AccessKeyID:     "id",
+		SecretAccessKey: "secret",
+		Timeout:         50 * time.Millisecond,
+	}
+	start := time.Now()
+	if _, err := kmsDecrypt(p); err == nil {
+		t.Errorf("No error for a KMS endpoint that does not respond.")
+	} else if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Request took %s with a timeout of %s.", elapsed, p.Timeout)
+	}
+
+	p.Timeout = -time.Second
+	if _, err := kmsDecrypt(p); err == nil {
+		t.Errorf("No error for a negative timeout.")
+	}
+}
@@ -8,21 +8,37 @@
 package store
 
 import (
-	"gitlab.com/xx_network/primitives/netTime"
 	"os"
 	"path/filepath"
 	"sort"
 	"strings"
 	"sync"
 	"time"
+
+	"github.com/pkg/errors"
+	jww "github.com/spf13/jwalterweatherman"
+
+	"gitlab.com/xx_network/primitives/netTime"
 )
 
+// MemoryParams contains the parameters of the memory storage backend. They are
+// set in the "memory" section of the config.
+type MemoryParams struct {
+	// MaxSize is the maximum total number of bytes of file data stored for all
+	// users. If it is zero, there is no limit.
+	MaxSize int64 `mapstructure:"maxSize"`
+}
+
 // MemStore manages the storage in a base directory. It saves everything in
 // memory instead of to the file system. Adheres to the Store interface.
 type MemStore struct {
 	lastWritePath string
 	store         map[string]memFile
 
+	// quota limits the total size of the files. If it is nil, there is no
+	// limit.
+	quota *memQuota
+
 	mux sync.Mutex
 }
 
@@ -55,10 +71,19 @@ func (ms *MemStore) Read(path string) ([]byte, error) {
 	return f.data, nil
 }
 
-// Write writes the provided data to the file path. Does not return any errors.
+// Write writes the provided data to the file path.
+//
+// Returns [StorageFullErr] if the write would exceed the size limit of the
+// backend.
 func (ms *MemStore) Write(path string, data []byte) error {
 	ms.mux.Lock()
 	defer ms.mux.Unlock()
+	if ms.quota != nil {
+		err := ms.quota.reserve(int64(len(data) - len(ms.store[path].data)))
+		if err != nil {
+			return err
+		}
+	}
 	ms.store[path] = memFile{data, netTime.Now()}
 	ms.lastWritePath = path
 	return nil
@@ -124,3 +149,97 @@ func (ms *MemStore) ReadDir(path string) ([]string, error) {
 
 	return dirList, nil
 }
+
+// Delete deletes the file at the given path.
+//
+// Returns [os.ErrNotExist] if the file does not exist.
+func (ms *MemStore) Delete(path string) error {
+	ms.mux.Lock()
+	defer ms.mux.Unlock()
+	f, exists := ms.store[path]
+	if !exists {
+		return os.ErrNotExist
+	}
+	if ms.quota != nil {
+		_ = ms.quota.reserve(-int64(len(f.data)))
+	}
+	delete(ms.store, path)
+	return nil
+}
+
+// ListFiles returns the paths of all files in the store sorted lexically.
+func (ms *MemStore) ListFiles() ([]string, error) {
+	ms.mux.Lock()
+	defer ms.mux.Unlock()
+
+	files := make([]string, 0, len(ms.store))
+	for path := range ms.store {
+		files = append(files, path)
+	}
+	sort.Strings(files)
+
+	return files, nil
+}
+
+// Size returns the total size of all files in the store.
+func (ms *MemStore) Size() (int64, error) {
+	ms.mux.Lock()
+	defer ms.mux.Unlock()
+
+	var size int64
+	for _, f := range ms.store {
+		size += int64(len(f.data))
+	}
+
+	return size, nil
+}
+
+// newMemBackend returns a NewStore that keeps a MemStore for each user for the
+// lifetime of the process, so that a user's files persist between sessions.
+// All stores share the size limit set in the parameters.
+func newMemBackend(params map[string]interface{}) (NewStore, error) {
+	var p MemoryParams
+	if err := decodeParams(params, &p); err != nil {
+		return nil, err
+	} else if p.MaxSize < 0 {
+		return nil, errors.Errorf("invalid maximum size %d", p.MaxSize)
+	}
+
+	var quota *memQuota
+	if p.MaxSize > 0 {
+		quota = &memQuota{max: p.MaxSize}
+		jww.INFO.Printf("Memory storage limited to %d bytes.", p.MaxSize)
+	}
+
+	stores := make(map[string]*MemStore)
+	var mux sync.Mutex
+	return func(_, baseDir string) (Store, error) {
+		mux.Lock()
+		defer mux.Unlock()
+		ms, exists := stores[baseDir]
+		if !exists {
+			ms = &MemStore{store: make(map[string]memFile), quota: quota}
+			stores[baseDir] = ms
+		}
+		return ms, nil
+	}, nil
+}
+
+// memQuota tracks the total size of the files in a group of MemStore.
+type memQuota struct {
+	max, used int64
+	mux       sync.Mutex
+}
+
+// reserve adds the change in size to the used size. Returns StorageFullErr if
+// the used size would exceed the maximum. Reductions in size always succeed.
+func (q *memQuota) reserve(delta int64) error {
+	q.mux.Lock()
+	defer q.mux.Unlock()
+	if delta > 0 && q.used+delta > q.max {
+		return errors.Wrapf(StorageFullErr,
+			"%d of %d bytes used; cannot store %d more", q.used, q.max, delta)
+	}
+	q.used += delta
+	return nil
+}
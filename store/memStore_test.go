@@ -24,6 +24,12 @@ import (
 // Tests that MemStore adheres to the Store interface.
 var _ Store = (*MemStore)(nil)
 
+// Tests that MemStore adheres to the Lister interface.
+var _ Lister = (*MemStore)(nil)
+
+// Tests that MemStore adheres to the Sizer interface.
+var _ Sizer = (*MemStore)(nil)
+
 // Unit test of NewMemStore.
 func TestNewMemStore(t *testing.T) {
 	expected := &MemStore{store: make(map[string]memFile)}
@@ -177,3 +183,157 @@ func TestMemStore_ReadDir(t *testing.T) {
 		}
 	}
 }
+
+// Tests that MemStore.ListFiles returns the paths of all files written.
+func TestMemStore_ListFiles(t *testing.T) {
+	ms, _ := NewMemStore("", "")
+	expected := []string{"dir1/a", "dir1/dirA/a", "file"}
+	for _, path := range []string{"file", "dir1/dirA/a", "dir1/a"} {
+		if err := ms.Write(path, []byte("data")); err != nil {
+			t.Errorf("Failed to write data for path %s: %+v", path, err)
+		}
+	}
+
+	files, err := ms.(*MemStore).ListFiles()
+	if err != nil {
+		t.Fatalf("Failed to list files: %+v", err)
+	}
+	if !reflect.DeepEqual(expected, files) {
+		t.Errorf("Unexpected files.\nexpected: %s\nreceived: %s",
+			expected, files)
+	}
+}
+
+// Tests that MemStore.Size returns the total size of all files written and that
+// overwritten files are only counted once.
+func TestMemStore_Size(t *testing.T) {
+	ms, _ := NewMemStore("", "")
+	for path, data := range map[string]string{
+		"file": "data", "dir1/a": "hello", "dir1/dirA/a": "a"} {
+		if err := ms.Write(path, []byte(data)); err != nil {
+			t.Errorf("Failed to write data for path %s: %+v", path, err)
+		}
+	}
+	if err := ms.Write("file", []byte("dat")); err != nil {
+		t.Errorf("Failed to overwrite file: %+v", err)
+	}
+
+	size, err := ms.(*MemStore).Size()
+	if err != nil {
+		t.Fatalf("Failed to get size: %+v", err)
+	}
+	if size != 9 {
+		t.Errorf("Unexpected size.\nexpected: %d\nreceived: %d", 9, size)
+	}
+}
+
+// Tests that MemStore.Delete removes a file written by MemStore.Write and that
+// a subsequent read fails.
+func TestMemStore_Delete(t *testing.T) {
+	ms, _ := NewMemStore("", "")
+
+	path := "dir/file.txt"
+	if err := ms.Write(path, []byte("data")); err != nil {
+		t.Fatalf("Failed to write data for path %s: %+v", path, err)
+	}
+
+	if err := ms.Delete(path); err != nil {
+		t.Errorf("Failed to delete %s: %+v", path, err)
+	}
+
+	if _, err := ms.Read(path); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Unexpected error reading deleted file."+
+			"\nexpected: %v\nreceived: %v", os.ErrNotExist, err)
+	}
+}
+
+// Error path: Tests that MemStore.Delete returns os.ErrNotExist if the file
+// does not exist.
+func TestMemStore_Delete_ErrNotExist(t *testing.T) {
+	ms, _ := NewMemStore("", "")
+	err := ms.Delete("no file")
+	if !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Unexpected error for missing file."+
+			"\nexpected: %v\nreceived: %v", os.ErrNotExist, err)
+	}
+}
+
+// Tests that the NewStore returned by newMemBackend returns the same MemStore
+// for the same user, so that files persist between sessions, and separate
+// stores for different users.
+func Test_newMemBackend(t *testing.T) {
+	newStore, err := newMemBackend(nil)
+	if err != nil {
+		t.Fatalf("Failed to create memory backend: %+v", err)
+	}
+
+	s1, _ := newStore("", "waldo")
+	if err = s1.Write("file", []byte("data")); err != nil {
+		t.Fatalf("Failed to write file: %+v", err)
+	}
+
+	s2, _ := newStore("", "waldo")
+	if data, err2 := s2.Read("file"); err2 != nil {
+		t.Errorf("Failed to read file in new session: %+v", err2)
+	} else if !bytes.Equal([]byte("data"), data) {
+		t.Errorf("Unexpected data.\nexpected: %q\nreceived: %q", "data", data)
+	}
+
+	s3, _ := newStore("", "carmen")
+	if _, err = s3.Read("file"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Unexpected error reading other user's file."+
+			"\nexpected: %v\nreceived: %v", os.ErrNotExist, err)
+	}
+}
+
+// Tests that the size limit of newMemBackend is shared between all users, that
+// overwriting and deleting files frees space, and that MemStore.Write returns
+// StorageFullErr when the limit is exceeded.
+func Test_newMemBackend_MaxSize(t *testing.T) {
+	newStore, err := newMemBackend(map[string]interface{}{"maxSize": "10"})
+	if err != nil {
+		t.Fatalf("Failed to create memory backend: %+v", err)
+	}
+	s1, _ := newStore("", "waldo")
+	s2, _ := newStore("", "carmen")
+
+	if err = s1.Write("a", make([]byte, 6)); err != nil {
+		t.Fatalf("Failed to write file within limit: %+v", err)
+	}
+	if err = s2.Write("b", make([]byte, 5)); !errors.Is(err, StorageFullErr) {
+		t.Errorf("Unexpected error for write over limit."+
+			"\nexpected: %v\nreceived: %v", StorageFullErr, err)
+	}
+	if _, err = s2.Read("b"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Rejected write was saved: %v", err)
+	}
+
+	// Overwriting a file only counts the change in size
+	if err = s1.Write("a", make([]byte, 2)); err != nil {
+		t.Fatalf("Failed to overwrite file: %+v", err)
+	}
+	if err = s2.Write("b", make([]byte, 8)); err != nil {
+		t.Fatalf("Failed to write file after overwrite: %+v", err)
+	}
+
+	// Deleting a file frees its space
+	if err = s1.Delete("a"); err != nil {
+		t.Fatalf("Failed to delete file: %+v", err)
+	}
+	if err = s1.Write("c", make([]byte, 2)); err != nil {
+		t.Errorf("Failed to write file after delete: %+v", err)
+	}
+}
+
+// Error path: Tests that newMemBackend returns an error for a negative size
+// limit or an unknown parameter.
+func Test_newMemBackend_InvalidParamsError(t *testing.T) {
+	for i, params := range []map[string]interface{}{
+		{"maxSize": -1},
+		{"maxsize": 1, "limit": 5},
+	} {
+		if _, err := newMemBackend(params); err == nil {
+			t.Errorf("Failed to get error for invalid params (%d): %v", i, params)
+		}
+	}
+}
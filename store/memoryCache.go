@@ -0,0 +1,369 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package store
+
+import (
+	"bytes"
+	"container/list"
+	"hash/fnv"
+	"io"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	jww "github.com/spf13/jwalterweatherman"
+)
+
+// Default values for MemoryCacheParams.
+const (
+	defaultMemoryCacheMaxBytes     = 64 * 1024 * 1024
+	defaultMemoryCacheMaxValueSize = 64 * 1024
+	defaultMemoryCacheTTL          = 5 * time.Minute
+)
+
+// memoryCacheEntryOverhead is the approximate number of bytes used by an entry
+// in addition to its key and data, which is counted towards the maximum size.
+const memoryCacheEntryOverhead = 128
+
+// memoryCacheSlots is the number of slots that keys are hashed into to detect
+// values that were invalidated while they were loaded.
+const memoryCacheSlots = 256
+
+// MemoryCacheParams contains the parameters of the in-process cache. They are
+// set in the "memoryCache" section of the config.
+type MemoryCacheParams struct {
+	// MaxBytes is the memory budget of the cache, in bytes, shared by all
+	// users. The least recently used entries are evicted to stay under it.
+	// Defaults to 64 MiB.
+	MaxBytes int64 `mapstructure:"maxBytes"`
+
+	// MaxValueSize is the maximum size, in bytes, of a file for its contents to
+	// be cached. If it is zero, only modification times are cached. Defaults
+	// to 64 KiB.
+	MaxValueSize int `mapstructure:"maxValueSize"`
+
+	// TTL is the amount of time an entry is kept in the cache, which bounds
+	// how long changes made to the storage backend by other processes go
+	// unseen. Defaults to 5m.
+	TTL time.Duration `mapstructure:"ttl"`
+}
+
+// MemoryCache caches the last-modified and last-write times and the contents
+// of small files of an underlying Store in memory, in a least recently used
+// cache shared by all users, so that bursts of reads, such as of all clients
+// syncing after an outage, do not each reach the storage backend. Entries are
+// invalidated on every write and delete.
+//
+// Unlike RedisCache, the cache is not shared between processes. Adheres to the
+// Store interface.
+type MemoryCache struct {
+	Store
+	cache    *lruCache
+	username string
+}
+
+// NewMemoryCache returns a NewStore that wraps each Store created by newStore
+// in a MemoryCache with the parameters. All stores share one cache.
+func NewMemoryCache(
+	params map[string]interface{}, newStore NewStore) (NewStore, error) {
+	p := MemoryCacheParams{
+		MaxBytes:     defaultMemoryCacheMaxBytes,
+		MaxValueSize: defaultMemoryCacheMaxValueSize,
+		TTL:          defaultMemoryCacheTTL,
+	}
+	if err := decodeParams(params, &p); err != nil {
+		return nil, err
+	} else if p.MaxBytes <= 0 {
+		return nil, errors.Errorf(
+			"maximum cache size %d must be positive", p.MaxBytes)
+	} else if p.MaxValueSize < 0 || int64(p.MaxValueSize) > p.MaxBytes {
+		return nil, errors.Errorf("maximum value size %d must be between 0 "+
+			"and the maximum cache size %d", p.MaxValueSize, p.MaxBytes)
+	} else if p.TTL <= 0 {
+		return nil, errors.Errorf("TTL %s must be positive", p.TTL)
+	}
+
+	jww.INFO.Printf("Caching metadata and files of up to %d bytes in "+
+		"memory, up to %d bytes.", p.MaxValueSize, p.MaxBytes)
+
+	cache := newLRUCache(p)
+	return func(storageDir, baseDir string) (Store, error) {
+		s, err := newStore(storageDir, baseDir)
+		if err != nil {
+			return nil, err
+		}
+		return &MemoryCache{Store: s, cache: cache, username: baseDir}, nil
+	}, nil
+}
+
+// Read returns the cached contents of the file or reads it from the underlying
+// store, caching it if it is small enough.
+func (mc *MemoryCache) Read(path string) ([]byte, error) {
+	key, err := mc.fileKey("data", path)
+	if err != nil || mc.cache.params.MaxValueSize == 0 {
+		return mc.Store.Read(path)
+	}
+
+	if value, exists := mc.cache.get(key); exists {
+		return append([]byte(nil), value.data...), nil
+	}
+	generation := mc.cache.generation(key)
+	data, err := mc.Store.Read(path)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) <= mc.cache.params.MaxValueSize {
+		mc.cache.add(key,
+			cacheValue{data: append([]byte(nil), data...)}, generation)
+	}
+	return data, nil
+}
+
+// Write writes the data to the underlying store and invalidates the cached
+// contents and modification times, so that they are next read from the
+// underlying store.
+func (mc *MemoryCache) Write(path string, data []byte) error {
+	err := mc.Store.Write(path, data)
+	mc.invalidate(path)
+	return err
+}
+
+// GetLastModified returns the cached last modification time of the file or
+// gets it from the underlying store on a cache miss.
+func (mc *MemoryCache) GetLastModified(path string) (time.Time, error) {
+	key, err := mc.fileKey("modified", path)
+	if err != nil {
+		return mc.Store.GetLastModified(path)
+	}
+	return mc.getTime(key, func() (time.Time, error) {
+		return mc.Store.GetLastModified(path)
+	})
+}
+
+// GetLastWrite returns the cached time of the last write or gets it from the
+// underlying store on a cache miss.
+func (mc *MemoryCache) GetLastWrite() (time.Time, error) {
+	return mc.getTime(mc.key("lastWrite"), mc.Store.GetLastWrite)
+}
+
+// Delete deletes the file from the underlying store and removes it from the
+// cache.
+func (mc *MemoryCache) Delete(path string) error {
+	err := mc.Store.Delete(path)
+	mc.invalidate(path)
+	return err
+}
+
+// Open returns the cached contents of the file or opens it in the underlying
+// store. Opened files are not cached, since they may be large.
+func (mc *MemoryCache) Open(path string) (io.ReadCloser, int64, error) {
+	if key, err := mc.fileKey("data", path); err == nil {
+		if value, exists := mc.cache.get(key); exists {
+			return bytesFile{bytes.NewReader(value.data)},
+				int64(len(value.data)), nil
+		}
+	}
+	return Open(mc.Store, path)
+}
+
+// ListFiles returns the paths of all files in the underlying store. Returns an
+// error if the underlying store does not implement Lister.
+func (mc *MemoryCache) ListFiles() ([]string, error) {
+	lister, ok := mc.Store.(Lister)
+	if !ok {
+		return nil, errors.New("underlying store cannot list its files")
+	}
+	return lister.ListFiles()
+}
+
+// Size returns the total size of the files in the underlying store, which is
+// not cached. Returns an error if the underlying store does not implement
+// Sizer.
+func (mc *MemoryCache) Size() (int64, error) {
+	sizer, ok := mc.Store.(Sizer)
+	if !ok {
+		return 0, errors.New("underlying store cannot report its size")
+	}
+	return sizer.Size()
+}
+
+// Ping returns an error if the underlying store cannot be reached. Stores that
+// do not implement Pinger are assumed to be reachable.
+func (mc *MemoryCache) Ping() error {
+	if pinger, ok := mc.Store.(Pinger); ok {
+		return pinger.Ping()
+	}
+	return nil
+}
+
+// getTime returns the time cached in the key. On a cache miss, the time is
+// loaded with get and cached.
+func (mc *MemoryCache) getTime(
+	key string, get func() (time.Time, error)) (time.Time, error) {
+	if value, exists := mc.cache.get(key); exists {
+		return value.time, nil
+	}
+	generation := mc.cache.generation(key)
+	t, err := get()
+	if err != nil {
+		return time.Time{}, err
+	}
+	mc.cache.add(key, cacheValue{time: t}, generation)
+	return t, nil
+}
+
+// invalidate removes the cached contents and modification time of the file at
+// the path and the time of the last write. It is called after the file is
+// changed, even if the change failed, since it may have partially succeeded.
+func (mc *MemoryCache) invalidate(path string) {
+	keys := []string{mc.key("lastWrite")}
+	if dataKey, err := mc.fileKey("data", path); err == nil {
+		modifiedKey, _ := mc.fileKey("modified", path)
+		keys = append(keys, dataKey, modifiedKey)
+	}
+	mc.cache.remove(keys...)
+}
+
+// key returns the cache key for a value of the user. The username is quoted so
+// that it cannot be confused with the rest of the key.
+func (mc *MemoryCache) key(name string) string {
+	return name + ":" + strconv.Quote(mc.username)
+}
+
+// fileKey returns the cache key for a value of the file at the path. Returns
+// NonLocalFileErr if the path is outside the base path.
+func (mc *MemoryCache) fileKey(name, path string) (string, error) {
+	path, err := readyKey("", path)
+	if err != nil {
+		return "", err
+	}
+	return mc.key(name) + ":" + path, nil
+}
+
+// cacheValue is a value in an lruCache, either the contents of a file or a
+// time.
+type cacheValue struct {
+	data []byte
+	time time.Time
+}
+
+// cacheEntry is an element of the list of an lruCache.
+type cacheEntry struct {
+	key     string
+	value   cacheValue
+	size    int64
+	expires time.Time
+}
+
+// lruCache is a cache of values under a maximum total size that evicts the
+// least recently used values first.
+//
+// A value that is loaded while its key is removed may be stale, so it is only
+// added if the generation of the slot of its key is unchanged since before it
+// was loaded. The generation of a slot increases whenever a key in it is
+// removed.
+type lruCache struct {
+	params      MemoryCacheParams
+	entries     map[string]*list.Element
+	order       *list.List
+	size        int64
+	generations [memoryCacheSlots]uint64
+	mux         sync.Mutex
+}
+
+// newLRUCache returns an empty lruCache with the parameters.
+func newLRUCache(p MemoryCacheParams) *lruCache {
+	return &lruCache{
+		params:  p,
+		entries: make(map[string]*list.Element),
+		order:   list.New(),
+	}
+}
+
+// get returns the value of the key if it is cached and has not expired, and
+// marks it as the most recently used.
+func (lc *lruCache) get(key string) (cacheValue, bool) {
+	lc.mux.Lock()
+	defer lc.mux.Unlock()
+
+	element, exists := lc.entries[key]
+	if !exists {
+		return cacheValue{}, false
+	}
+	entry := element.Value.(*cacheEntry)
+	if time.Now().After(entry.expires) {
+		lc.removeElement(element)
+		return cacheValue{}, false
+	}
+	lc.order.MoveToFront(element)
+	return entry.value, true
+}
+
+// generation returns the generation of the slot of the key, to be passed to
+// add once its value is loaded.
+func (lc *lruCache) generation(key string) uint64 {
+	lc.mux.Lock()
+	defer lc.mux.Unlock()
+	return lc.generations[slot(key)]
+}
+
+// add caches the value of the key, evicting the least recently used values
+// until the cache is under its maximum size. The value is not added if a key
+// of its slot was removed since the generation was returned.
+func (lc *lruCache) add(key string, value cacheValue, generation uint64) {
+	lc.mux.Lock()
+	defer lc.mux.Unlock()
+
+	if lc.generations[slot(key)] != generation {
+		return
+	}
+	if element, exists := lc.entries[key]; exists {
+		lc.removeElement(element)
+	}
+	entry := &cacheEntry{
+		key:     key,
+		value:   value,
+		size:    int64(len(key)+len(value.data)) + memoryCacheEntryOverhead,
+		expires: time.Now().Add(lc.params.TTL),
+	}
+	lc.entries[key] = lc.order.PushFront(entry)
+	lc.size += entry.size
+	for lc.size > lc.params.MaxBytes {
+		lc.removeElement(lc.order.Back())
+	}
+}
+
+// remove removes the keys from the cache and increases the generations of
+// their slots.
+func (lc *lruCache) remove(keys ...string) {
+	lc.mux.Lock()
+	defer lc.mux.Unlock()
+
+	for _, key := range keys {
+		lc.generations[slot(key)]++
+		if element, exists := lc.entries[key]; exists {
+			lc.removeElement(element)
+		}
+	}
+}
+
+// removeElement removes the element from the cache. The caller must hold the
+// lock.
+func (lc *lruCache) removeElement(element *list.Element) {
+	entry := lc.order.Remove(element).(*cacheEntry)
+	delete(lc.entries, entry.key)
+	lc.size -= entry.size
+}
+
+// slot returns the slot of the key in the generations of an lruCache.
+func slot(key string) int {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(key))
+	return int(h.Sum32() % memoryCacheSlots)
+}
@@ -0,0 +1,236 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package store
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Tests that MemoryCache adheres to the Store interface.
+var _ Store = (*MemoryCache)(nil)
+
+// Tests that MemoryCache adheres to the Lister interface.
+var _ Lister = (*MemoryCache)(nil)
+
+// Tests that MemoryCache adheres to the Opener interface.
+var _ Opener = (*MemoryCache)(nil)
+
+// Tests that MemoryCache.GetLastModified and MemoryCache.GetLastWrite are
+// served from the cache after the first call and are invalidated by
+// MemoryCache.Write.
+func TestMemoryCache_GetLastModified_GetLastWrite(t *testing.T) {
+	mc, ms := newTestMemoryCache(nil, t)
+
+	if err := mc.Write("dir/file", []byte("data")); err != nil {
+		t.Fatalf("Failed to write file: %+v", err)
+	}
+	expected, _ := ms.GetLastModified("dir/file")
+
+	if lm, err := mc.GetLastModified("dir/file"); err != nil {
+		t.Fatalf("Failed to get last modified: %+v", err)
+	} else if !lm.Equal(expected) {
+		t.Errorf("Unexpected last modified.\nexpected: %s\nreceived: %s",
+			expected, lm)
+	}
+	if lw, err := mc.GetLastWrite(); err != nil {
+		t.Fatalf("Failed to get last write: %+v", err)
+	} else if !lw.Equal(expected) {
+		t.Errorf("Unexpected last write.\nexpected: %s\nreceived: %s",
+			expected, lw)
+	}
+
+	// Modify the underlying store directly; the cached values should be
+	// returned
+	time.Sleep(time.Millisecond)
+	_ = ms.Write("dir/file", []byte("new"))
+	if lm, _ := mc.GetLastModified("dir/./file"); !lm.Equal(expected) {
+		t.Errorf("Last modified not read from cache."+
+			"\nexpected: %s\nreceived: %s", expected, lm)
+	}
+	if lw, _ := mc.GetLastWrite(); !lw.Equal(expected) {
+		t.Errorf("Last write not read from cache."+
+			"\nexpected: %s\nreceived: %s", expected, lw)
+	}
+
+	// Writing through the cache invalidates the times
+	time.Sleep(time.Millisecond)
+	if err := mc.Write("dir/file", []byte("newer")); err != nil {
+		t.Fatalf("Failed to write file: %+v", err)
+	}
+	expected, _ = ms.GetLastModified("dir/file")
+	if lm, _ := mc.GetLastModified("dir/file"); !lm.Equal(expected) {
+		t.Errorf("Last modified not invalidated."+
+			"\nexpected: %s\nreceived: %s", expected, lm)
+	}
+	if lw, _ := mc.GetLastWrite(); !lw.Equal(expected) {
+		t.Errorf("Last write not invalidated."+
+			"\nexpected: %s\nreceived: %s", expected, lw)
+	}
+}
+
+// Tests that MemoryCache.Read caches the contents of small files but not of
+// large files, that MemoryCache.Open serves cached files, and that
+// MemoryCache.Write and MemoryCache.Delete invalidate them.
+func TestMemoryCache_Read_Open_Delete(t *testing.T) {
+	mc, ms := newTestMemoryCache(map[string]interface{}{"maxValueSize": 4}, t)
+	_ = ms.Write("small", []byte("abc"))
+	_ = ms.Write("large", []byte("abcdefgh"))
+	_, _ = mc.Read("small")
+	_, _ = mc.Read("large")
+
+	// Change the underlying files; only the small file is cached
+	_ = ms.Write("small", []byte("xyz"))
+	_ = ms.Write("large", []byte("stuvwxyz"))
+	if data, _ := mc.Read("small"); !bytes.Equal([]byte("abc"), data) {
+		t.Errorf("Small file not read from cache: %q", data)
+	}
+	if data, _ := mc.Read("large"); !bytes.Equal([]byte("stuvwxyz"), data) {
+		t.Errorf("Large file read from cache: %q", data)
+	}
+	r, size, err := mc.(Opener).Open("small")
+	if err != nil {
+		t.Fatalf("Failed to open file: %+v", err)
+	}
+	if data, _ := io.ReadAll(r); size != 3 ||
+		!bytes.Equal([]byte("abc"), data) {
+		t.Errorf("Small file not opened from cache: %d bytes %q", size, data)
+	}
+
+	// Changing the returned data does not change the cached data
+	data, _ := mc.Read("small")
+	data[0] = 'x'
+	if data, _ = mc.Read("small"); !bytes.Equal([]byte("abc"), data) {
+		t.Errorf("Cached data was modified: %q", data)
+	}
+
+	if err = mc.Write("small", []byte("def")); err != nil {
+		t.Fatalf("Failed to write file: %+v", err)
+	}
+	if data, _ = mc.Read("small"); !bytes.Equal([]byte("def"), data) {
+		t.Errorf("Written file read from cache: %q", data)
+	}
+	if err = mc.Delete("small"); err != nil {
+		t.Fatalf("Failed to delete file: %+v", err)
+	}
+	if _, err = mc.Read("small"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Unexpected error reading deleted file."+
+			"\nexpected: %v\nreceived: %v", os.ErrNotExist, err)
+	}
+}
+
+// Tests that the cache evicts the least recently used entries to stay under
+// its maximum size and that entries expire after the TTL.
+func TestMemoryCache_Eviction(t *testing.T) {
+	// Each entry takes its data, key, and the overhead, so only two fit
+	entrySize := int64(len("data:\"waldo\":a")+8) + memoryCacheEntryOverhead
+	mc, ms := newTestMemoryCache(map[string]interface{}{
+		"maxBytes": 2 * entrySize, "maxValueSize": 8, "ttl": "50ms"}, t)
+	for _, path := range []string{"a", "b", "c"} {
+		_ = ms.Write(path, []byte("12345678"))
+	}
+
+	_, _ = mc.Read("a")
+	_, _ = mc.Read("b")
+	_, _ = mc.Read("a")
+	_, _ = mc.Read("c")
+	for _, path := range []string{"a", "b", "c"} {
+		_ = ms.Write(path, []byte("changed!"))
+	}
+
+	// b is read last, since reading it evicts another entry
+	expected := [][2]string{
+		{"a", "12345678"}, {"c", "12345678"}, {"b", "changed!"}}
+	for _, tt := range expected {
+		if read, _ := mc.Read(tt[0]); string(read) != tt[1] {
+			t.Errorf("Unexpected data of %s.\nexpected: %q\nreceived: %q",
+				tt[0], tt[1], read)
+		}
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	if read, _ := mc.Read("a"); string(read) != "changed!" {
+		t.Errorf("Expired entry was read: %q", read)
+	}
+}
+
+// Tests that the stores of different users do not share entries.
+func TestMemoryCache_Users(t *testing.T) {
+	newStore, err := NewMemoryCache(nil, NewMemStore)
+	if err != nil {
+		t.Fatalf("Failed to create memory cache: %+v", err)
+	}
+	waldo, _ := newStore("", "waldo")
+	fred, _ := newStore("", "fred")
+	_ = waldo.Write("file", []byte("waldo"))
+	_ = fred.Write("file", []byte("fred"))
+
+	for _, user := range []Store{waldo, fred, waldo, fred} {
+		expected := user.(*MemoryCache).username
+		if data, _ := user.Read("file"); string(data) != expected {
+			t.Errorf("Unexpected data.\nexpected: %q\nreceived: %q",
+				expected, data)
+		}
+	}
+}
+
+// Tests that lruCache.add does not add a value loaded before a key of its
+// slot was removed.
+func Test_lruCache_add_Removed(t *testing.T) {
+	lc := newLRUCache(MemoryCacheParams{MaxBytes: 1024, TTL: time.Minute})
+	generation := lc.generation("key")
+	lc.remove("key")
+	lc.add("key", cacheValue{data: []byte("stale")}, generation)
+	if _, exists := lc.get("key"); exists {
+		t.Errorf("Value loaded before the key was removed was added.")
+	}
+
+	lc.add("key", cacheValue{data: []byte("new")}, lc.generation("key"))
+	if value, exists := lc.get("key"); !exists || string(value.data) != "new" {
+		t.Errorf("Value was not added: %q", value.data)
+	}
+}
+
+// Error path: Tests that NewMemoryCache returns an error for unknown
+// parameters and invalid sizes and TTLs.
+func TestNewMemoryCache_Error(t *testing.T) {
+	tests := []map[string]interface{}{
+		{"tll": "1h"},
+		{"maxBytes": 0},
+		{"maxValueSize": -1},
+		{"maxBytes": 10, "maxValueSize": 11},
+		{"ttl": "0s"},
+	}
+	for _, params := range tests {
+		if _, err := NewMemoryCache(params, NewMemStore); err == nil {
+			t.Errorf("No error for parameters %+v.", params)
+		}
+	}
+}
+
+// newTestMemoryCache creates a MemoryCache in front of a MemStore and returns
+// both.
+func newTestMemoryCache(
+	params map[string]interface{}, t testing.TB) (Store, Store) {
+	ms, _ := NewMemStore("", "")
+	newStore, err := NewMemoryCache(params,
+		func(string, string) (Store, error) { return ms, nil })
+	if err != nil {
+		t.Fatalf("Failed to create memory cache: %+v", err)
+	}
+	mc, err := newStore("", "waldo")
+	if err != nil {
+		t.Fatalf("Failed to create store: %+v", err)
+	}
+	return mc, ms
+}
@@ -0,0 +1,367 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package store
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"gitlab.com/xx_network/primitives/netTime"
+)
+
+// metadataDir is the directory in each user's base path that holds the
+// metadata of their files. It is hidden from and cannot be accessed by
+// clients.
+const metadataDir = ".metadata"
+
+// Metadata describes a file.
+type Metadata struct {
+	// Size is the size of the file in bytes.
+	Size int64 `json:"size"`
+
+	// SHA256 is the SHA-256 hash of the data of the file.
+	SHA256 []byte `json:"sha256"`
+
+	// Created is when the file was first written since it last did not exist,
+	// and Modified is when it was last written. Created is zero if it is not
+	// known.
+	Created  time.Time `json:"created"`
+	Modified time.Time `json:"modified"`
+
+	// Device is the ID of the device that last wrote the file, if the client
+	// gave one.
+	Device string `json:"device,omitempty"`
+}
+
+// metadataFile is the metadata of a file, stored as JSON in the metadata
+// directory.
+type metadataFile struct {
+	Path string `json:"path"`
+	Metadata
+}
+
+// MetadataStore records the metadata of the files of an underlying Store, so
+// that clients can tell when a file was created, whether its data changed, and
+// which of their devices wrote it, without reading it. The metadata of each
+// file is stored in the metadata directory of the base path in a file named
+// after the SHA-256 hash of its path. Files written before the metadata was
+// recorded, or by other means, are described from their data instead, without
+// their creation time or device.
+//
+// The metadata counts towards the size of the store. Adheres to the Store
+// interface.
+type MetadataStore struct {
+	Store
+
+	// mux is shared by all stores of the user so that concurrent sessions do
+	// not lose each other's metadata.
+	mux *sync.Mutex
+}
+
+// NewMetadataStore returns a NewStore that wraps each Store created by newStore
+// in a MetadataStore.
+func NewMetadataStore(newStore NewStore) NewStore {
+	userLocks := make(map[string]*sync.Mutex)
+	var mux sync.Mutex
+	return func(storageDir, baseDir string) (Store, error) {
+		s, err := newStore(storageDir, baseDir)
+		if err != nil {
+			return nil, err
+		}
+
+		mux.Lock()
+		defer mux.Unlock()
+		userLock, exists := userLocks[baseDir]
+		if !exists {
+			userLock = &sync.Mutex{}
+			userLocks[baseDir] = userLock
+		}
+		return &MetadataStore{Store: s, mux: userLock}, nil
+	}
+}
+
+// Read reads the file at the path from the underlying store.
+//
+// Returns [ReservedPathErr] if the path is in the metadata directory.
+func (ms *MetadataStore) Read(path string) ([]byte, error) {
+	if isMetadataPath(path) {
+		return nil, ReservedPathErr
+	}
+	return ms.Store.Read(path)
+}
+
+// Open opens the file at the path in the underlying store for reading.
+//
+// Returns [ReservedPathErr] if the path is in the metadata directory.
+func (ms *MetadataStore) Open(path string) (io.ReadCloser, int64, error) {
+	if isMetadataPath(path) {
+		return nil, 0, ReservedPathErr
+	}
+	return Open(ms.Store, path)
+}
+
+// Write writes the data to the file at the path in the underlying store and
+// records its metadata. The creation time is kept if the file exists. Previous
+// versions of files are written without metadata.
+//
+// Returns [ReservedPathErr] if the path is in the metadata directory.
+func (ms *MetadataStore) Write(path string, data []byte) error {
+	if isMetadataPath(path) {
+		return ReservedPathErr
+	} else if isVersionPath(path) {
+		return ms.Store.Write(path, data)
+	}
+
+	ms.mux.Lock()
+	defer ms.mux.Unlock()
+	if err := ms.Store.Write(path, data); err != nil {
+		return err
+	}
+
+	modified, err := ms.Store.GetLastModified(path)
+	if err != nil {
+		modified = netTime.Now()
+	}
+	created := modified
+	if old, err := ms.load(path); err == nil && !old.Created.IsZero() {
+		created = old.Created
+	}
+	hash := sha256.Sum256(data)
+	return ms.save(path, Metadata{
+		Size:     int64(len(data)),
+		SHA256:   hash[:],
+		Created:  created,
+		Modified: modified,
+	})
+}
+
+// GetLastModified returns the last modification time of the file at the path
+// in the underlying store.
+//
+// Returns [ReservedPathErr] if the path is in the metadata directory.
+func (ms *MetadataStore) GetLastModified(path string) (time.Time, error) {
+	if isMetadataPath(path) {
+		return time.Time{}, ReservedPathErr
+	}
+	return ms.Store.GetLastModified(path)
+}
+
+// ReadDir reads the directory at the path from the underlying store. The
+// metadata directory is not listed.
+//
+// Returns [ReservedPathErr] if the path is in the metadata directory.
+func (ms *MetadataStore) ReadDir(path string) ([]string, error) {
+	if isMetadataPath(path) {
+		return nil, ReservedPathErr
+	}
+	entries, err := ms.Store.ReadDir(path)
+	if err != nil || cleanPath(path) != "." {
+		return entries, err
+	}
+
+	filtered := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		if entry != metadataDir {
+			filtered = append(filtered, entry)
+		}
+	}
+	return filtered, nil
+}
+
+// Delete deletes the file at the path in the underlying store and its
+// metadata.
+//
+// Returns [os.ErrNotExist] if the file does not exist and [ReservedPathErr] if
+// the path is in the metadata directory.
+func (ms *MetadataStore) Delete(path string) error {
+	if isMetadataPath(path) {
+		return ReservedPathErr
+	} else if isVersionPath(path) {
+		return ms.Store.Delete(path)
+	}
+
+	ms.mux.Lock()
+	defer ms.mux.Unlock()
+	if err := ms.Store.Delete(path); err != nil {
+		return err
+	}
+	err := ms.Store.Delete(metadataPath(path))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return errors.Wrapf(err, "failed to remove metadata of %s", path)
+	}
+	return nil
+}
+
+// ListFiles returns the paths of all files in the underlying store, except for
+// the metadata. Returns an error if the underlying store does not implement
+// Lister.
+func (ms *MetadataStore) ListFiles() ([]string, error) {
+	lister, ok := ms.Store.(Lister)
+	if !ok {
+		return nil, errors.New("underlying store cannot list its files")
+	}
+	files, err := lister.ListFiles()
+	if err != nil {
+		return nil, err
+	}
+
+	filtered := make([]string, 0, len(files))
+	for _, path := range files {
+		if !isMetadataPath(path) {
+			filtered = append(filtered, path)
+		}
+	}
+	return filtered, nil
+}
+
+// Size returns the total size of the files in the underlying store, including
+// the metadata. Returns an error if the underlying store does not implement
+// Sizer.
+func (ms *MetadataStore) Size() (int64, error) {
+	sizer, ok := ms.Store.(Sizer)
+	if !ok {
+		return 0, errors.New("underlying store cannot report its size")
+	}
+	return sizer.Size()
+}
+
+// Ping returns an error if the underlying store cannot be reached. Stores that
+// do not implement Pinger are assumed to be reachable.
+func (ms *MetadataStore) Ping() error {
+	if pinger, ok := ms.Store.(Pinger); ok {
+		return pinger.Ping()
+	}
+	return nil
+}
+
+// Stat returns the metadata of the file at the path. If none was recorded for
+// its current data, it is described from its data, keeping the recorded
+// creation time, if any.
+//
+// Returns [os.ErrNotExist] if the file does not exist and [ReservedPathErr] if
+// the path is in the metadata directory.
+func (ms *MetadataStore) Stat(path string) (Metadata, error) {
+	if isMetadataPath(path) {
+		return Metadata{}, ReservedPathErr
+	}
+
+	ms.mux.Lock()
+	defer ms.mux.Unlock()
+	modified, err := ms.Store.GetLastModified(path)
+	if err != nil {
+		return Metadata{}, err
+	}
+	md, err := ms.load(path)
+	if err == nil && md.Modified.Equal(modified) {
+		return md, nil
+	}
+
+	// The file was written without this store, such as before the metadata
+	// was recorded
+	described, err := describe(ms.Store, path)
+	if err != nil {
+		return Metadata{}, err
+	}
+	described.Created = md.Created
+	return described, nil
+}
+
+// SetDevice records the device as the writer of the file at the path if the
+// SHA-256 hash of its data matches, so that a later write by another device
+// is not attributed to this one.
+//
+// Returns [ReservedPathErr] if the path is in the metadata directory.
+func (ms *MetadataStore) SetDevice(
+	path string, sha256 []byte, device string) error {
+	if isMetadataPath(path) {
+		return ReservedPathErr
+	}
+
+	ms.mux.Lock()
+	defer ms.mux.Unlock()
+	md, err := ms.load(path)
+	if errors.Is(err, os.ErrNotExist) || !bytes.Equal(md.SHA256, sha256) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	md.Device = device
+	return ms.save(path, md)
+}
+
+// load returns the recorded metadata of the file at the path. Returns
+// [os.ErrNotExist] if there is none. Must be called while the lock is held.
+func (ms *MetadataStore) load(path string) (Metadata, error) {
+	data, err := ms.Store.Read(metadataPath(path))
+	if errors.Is(err, os.ErrNotExist) {
+		return Metadata{}, err
+	} else if err != nil {
+		return Metadata{}, errors.Wrapf(
+			err, "failed to read metadata of %s", path)
+	}
+
+	var f metadataFile
+	if err = json.Unmarshal(data, &f); err != nil {
+		return Metadata{}, errors.Wrapf(
+			err, "failed to decode metadata of %s", path)
+	}
+	return f.Metadata, nil
+}
+
+// save records the metadata of the file at the path. Must be called while the
+// lock is held.
+func (ms *MetadataStore) save(path string, md Metadata) error {
+	data, err := json.Marshal(metadataFile{Path: cleanPath(path), Metadata: md})
+	if err != nil {
+		return errors.Wrapf(err, "failed to encode metadata of %s", path)
+	}
+	if err = ms.Store.Write(metadataPath(path), data); err != nil {
+		return errors.Wrapf(err, "failed to write metadata of %s", path)
+	}
+	return nil
+}
+
+// describe returns the metadata of the file at the path in the store from its
+// data and modification time, without its creation time or device.
+func describe(s Store, path string) (Metadata, error) {
+	data, err := s.Read(path)
+	if err != nil {
+		return Metadata{}, err
+	}
+	modified, err := s.GetLastModified(path)
+	if err != nil {
+		return Metadata{}, err
+	}
+	hash := sha256.Sum256(data)
+	return Metadata{
+		Size:     int64(len(data)),
+		SHA256:   hash[:],
+		Modified: modified,
+	}, nil
+}
+
+// metadataPath returns the path of the metadata of the file at the path.
+func metadataPath(path string) string {
+	hash := sha256.Sum256([]byte(cleanPath(path)))
+	return metadataDir + "/" + hex.EncodeToString(hash[:])
+}
+
+// isMetadataPath returns true if the path is in the metadata directory.
+func isMetadataPath(path string) bool {
+	path = cleanPath(path)
+	return path == metadataDir || strings.HasPrefix(path, metadataDir+"/")
+}
@@ -0,0 +1,199 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package store
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+// Tests that MetadataStore adheres to the Store interface.
+var _ Store = (*MetadataStore)(nil)
+
+// Tests that MetadataStore adheres to the Lister interface.
+var _ Lister = (*MetadataStore)(nil)
+
+// Tests that MetadataStore adheres to the MetadataTracker interface.
+var _ MetadataTracker = (*MetadataStore)(nil)
+
+// newTestMetadataStore returns a MetadataStore of a MemStore.
+func newTestMetadataStore(t *testing.T) *MetadataStore {
+	s, err := NewMetadataStore(NewMemStore)("", "user")
+	if err != nil {
+		t.Fatalf("Failed to create store: %+v", err)
+	}
+	return s.(*MetadataStore)
+}
+
+// Tests that MetadataStore.Stat returns the size and hash of the last data
+// written, keeps the creation time when the file is overwritten, and resets it
+// once the file is deleted.
+func TestMetadataStore_Stat(t *testing.T) {
+	ms := newTestMetadataStore(t)
+	_ = ms.Write("dir/file", []byte("first"))
+	first, err := ms.Stat("dir/file")
+	if err != nil {
+		t.Fatalf("Failed to stat file: %+v", err)
+	}
+
+	data := []byte("second")
+	_ = ms.Write("dir/file", data)
+	md, err := ms.Stat("dir/file")
+	if err != nil {
+		t.Fatalf("Failed to stat overwritten file: %+v", err)
+	}
+	hash := sha256.Sum256(data)
+	modified, _ := ms.GetLastModified("dir/file")
+	if md.Size != int64(len(data)) || !bytes.Equal(md.SHA256, hash[:]) ||
+		!md.Created.Equal(first.Created) || !md.Modified.Equal(modified) {
+		t.Errorf("Unexpected metadata.\nexpected: size %d, hash %x, "+
+			"created %s, modified %s\nreceived: %+v", len(data), hash,
+			first.Created, modified, md)
+	}
+
+	_ = ms.Delete("dir/file")
+	if _, err = ms.Stat("dir/file"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Unexpected error for deleted file: %v", err)
+	}
+	_ = ms.Write("dir/file", data)
+	if md, _ = ms.Stat("dir/file"); !md.Created.Equal(md.Modified) {
+		t.Errorf("Creation time %s of rewritten file is not its "+
+			"modification time %s.", md.Created, md.Modified)
+	}
+}
+
+// Tests that MetadataStore.SetDevice records the device only if the hash
+// matches the data of the file and that it is cleared when the file is written
+// again.
+func TestMetadataStore_SetDevice(t *testing.T) {
+	ms := newTestMetadataStore(t)
+	data := []byte("data")
+	hash := sha256.Sum256(data)
+	_ = ms.Write("file", data)
+
+	other := sha256.Sum256([]byte("other"))
+	if err := ms.SetDevice("file", other[:], "phone"); err != nil {
+		t.Fatalf("Failed to set device: %+v", err)
+	}
+	if md, _ := ms.Stat("file"); md.Device != "" {
+		t.Errorf("Device set for a different hash: %q", md.Device)
+	}
+
+	if err := ms.SetDevice("file", hash[:], "laptop"); err != nil {
+		t.Fatalf("Failed to set device: %+v", err)
+	}
+	if md, _ := ms.Stat("file"); md.Device != "laptop" {
+		t.Errorf("Unexpected device.\nexpected: %q\nreceived: %q",
+			"laptop", md.Device)
+	}
+
+	_ = ms.Write("file", data)
+	if md, _ := ms.Stat("file"); md.Device != "" {
+		t.Errorf("Device not cleared by write: %q", md.Device)
+	}
+}
+
+// Tests that MetadataStore.Stat describes a file written to the underlying
+// store from its data, keeping the recorded creation time but not the device.
+func TestMetadataStore_Stat_Untracked(t *testing.T) {
+	ms := newTestMetadataStore(t)
+	_ = ms.Write("file", []byte("tracked"))
+	hash := sha256.Sum256([]byte("tracked"))
+	_ = ms.SetDevice("file", hash[:], "laptop")
+	tracked, _ := ms.Stat("file")
+
+	data := []byte("untracked")
+	_ = ms.Store.Write("file", data)
+	md, err := ms.Stat("file")
+	if err != nil {
+		t.Fatalf("Failed to stat file: %+v", err)
+	}
+	hash = sha256.Sum256(data)
+	if md.Size != int64(len(data)) || !bytes.Equal(md.SHA256, hash[:]) ||
+		!md.Created.Equal(tracked.Created) || md.Device != "" {
+		t.Errorf("Unexpected metadata of untracked write: %+v", md)
+	}
+
+	_ = ms.Store.Write("new", data)
+	if md, err = ms.Stat("new"); err != nil {
+		t.Fatalf("Failed to stat untracked file: %+v", err)
+	} else if !md.Created.IsZero() || md.Size != int64(len(data)) {
+		t.Errorf("Unexpected metadata of untracked file: %+v", md)
+	}
+}
+
+// Tests that the metadata directory is hidden from MetadataStore.ReadDir and
+// MetadataStore.ListFiles.
+func TestMetadataStore_ReadDir_ListFiles(t *testing.T) {
+	ms := newTestMetadataStore(t)
+	_ = ms.Write("dir/file", []byte("data"))
+
+	if dirs, err := ms.ReadDir(""); err != nil {
+		t.Fatalf("Failed to read directory: %+v", err)
+	} else if expected := []string{"dir"}; !reflect.DeepEqual(dirs, expected) {
+		t.Errorf("Unexpected directories.\nexpected: %q\nreceived: %q",
+			expected, dirs)
+	}
+	if files, err := ms.ListFiles(); err != nil {
+		t.Fatalf("Failed to list files: %+v", err)
+	} else if expected := []string{"dir/file"}; !reflect.DeepEqual(
+		files, expected) {
+		t.Errorf("Unexpected files.\nexpected: %q\nreceived: %q",
+			expected, files)
+	}
+}
+
+// Tests that Stat describes a file of a store that does not track metadata
+// from its data.
+func TestStat(t *testing.T) {
+	s, _ := NewMemStore("", "")
+	data := []byte("data")
+	_ = s.Write("file", data)
+
+	md, err := Stat(s, "file")
+	if err != nil {
+		t.Fatalf("Failed to stat file: %+v", err)
+	}
+	hash := sha256.Sum256(data)
+	modified, _ := s.GetLastModified("file")
+	expected := Metadata{
+		Size: int64(len(data)), SHA256: hash[:], Modified: modified}
+	if !reflect.DeepEqual(md, expected) {
+		t.Errorf("Unexpected metadata.\nexpected: %+v\nreceived: %+v",
+			expected, md)
+	}
+	if err = SetDevice(s, "file", hash[:], "laptop"); err != nil {
+		t.Errorf("Failed to set device on untracked store: %+v", err)
+	}
+}
+
+// Error path: Tests that the metadata directory cannot be accessed.
+func TestMetadataStore_ReservedPathErr(t *testing.T) {
+	ms := newTestMetadataStore(t)
+	_ = ms.Write("file", []byte("data"))
+	for _, path := range []string{".metadata", "/.metadata/x", metadataPath(
+		"file")} {
+		if _, err := ms.Read(path); !errors.Is(err, ReservedPathErr) {
+			t.Errorf("Unexpected error reading %q: %v", path, err)
+		}
+		if err := ms.Write(path, nil); !errors.Is(err, ReservedPathErr) {
+			t.Errorf("Unexpected error writing %q: %v", path, err)
+		}
+		if err := ms.Delete(path); !errors.Is(err, ReservedPathErr) {
+			t.Errorf("Unexpected error deleting %q: %v", path, err)
+		}
+		if _, err := ms.Stat(path); !errors.Is(err, ReservedPathErr) {
+			t.Errorf("Unexpected error statting %q: %v", path, err)
+		}
+	}
+}
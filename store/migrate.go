@@ -0,0 +1,187 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package store
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"io"
+	"os"
+
+	"github.com/pkg/errors"
+
+	"gitlab.com/xx_network/primitives/utils"
+)
+
+// migrationProgressPerm is the permissions of the migration progress file.
+const migrationProgressPerm = 0600
+
+var (
+	// ChecksumMismatchErr is returned when a migrated file read back from the
+	// destination does not match the source.
+	ChecksumMismatchErr = errors.New("checksum mismatch")
+
+	// NotListableErr is returned when the files of a store cannot be listed
+	// because it does not implement [Lister].
+	NotListableErr = errors.New("store cannot list its files")
+)
+
+// MigrationStats counts the files handled by MigrateFiles.
+type MigrationStats struct {
+	// Copied is the number of files copied and verified.
+	Copied int
+
+	// Skipped is the number of files already recorded in the progress.
+	Skipped int
+
+	// Bytes is the total size of the copied files.
+	Bytes int64
+}
+
+// MigrateFiles copies every file of the user from src to dst. Each copy is read
+// back from dst and its SHA-256 checksum compared to that of the source. If
+// progress is not nil, files it records as migrated are skipped and each
+// verified copy is recorded, so that an interrupted migration can be resumed.
+// Modification times are not preserved.
+//
+// Returns [NotListableErr] if src does not implement [Lister] and
+// [ChecksumMismatchErr] if a copy does not match its source.
+func MigrateFiles(username string, src, dst Store,
+	progress *MigrationProgress) (MigrationStats, error) {
+	var stats MigrationStats
+	lister, ok := src.(Lister)
+	if !ok {
+		return stats, NotListableErr
+	}
+	files, err := lister.ListFiles()
+	if err != nil {
+		return stats, err
+	}
+
+	for _, path := range files {
+		if progress != nil && progress.Done(username, path) {
+			stats.Skipped++
+			continue
+		}
+
+		data, err := src.Read(path)
+		if err != nil {
+			return stats, errors.Wrapf(err, "failed to read %s", path)
+		}
+		checksum := sha256.Sum256(data)
+		if err = dst.Write(path, data); err != nil {
+			return stats, errors.Wrapf(err, "failed to write %s", path)
+		}
+		copied, err := dst.Read(path)
+		if err != nil {
+			return stats, errors.Wrapf(err, "failed to read back %s", path)
+		}
+		if copiedChecksum := sha256.Sum256(copied); !bytes.Equal(
+			checksum[:], copiedChecksum[:]) {
+			return stats, errors.Wrapf(ChecksumMismatchErr, "%s: %x != %x",
+				path, copiedChecksum, checksum)
+		}
+
+		if progress != nil {
+			err = progress.record(username, path, checksum[:])
+			if err != nil {
+				return stats, err
+			}
+		}
+		stats.Copied++
+		stats.Bytes += int64(len(data))
+	}
+
+	return stats, nil
+}
+
+// MigrationProgress records the files that have been migrated in a CSV file of
+// "<username>,<path>,<sha256>" lines, so that an interrupted migration can be
+// resumed. Each line is synced to disk before the next file is copied.
+type MigrationProgress struct {
+	file *os.File
+	w    *csv.Writer
+	done map[migratedFile]struct{}
+}
+
+// migratedFile identifies a file of a user in the MigrationProgress.
+type migratedFile struct {
+	username, path string
+}
+
+// OpenMigrationProgress opens the progress file at the path, creating it if it
+// does not exist, and loads the files already migrated.
+func OpenMigrationProgress(path string) (*MigrationProgress, error) {
+	path, err := utils.ExpandPath(path)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(
+		path, os.O_RDWR|os.O_CREATE|os.O_APPEND, migrationProgressPerm)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to open progress file %s", path)
+	}
+
+	mp := &MigrationProgress{
+		file: f,
+		w:    csv.NewWriter(f),
+		done: make(map[migratedFile]struct{}),
+	}
+	r := csv.NewReader(f)
+	r.FieldsPerRecord = 3
+	for {
+		record, err := r.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			_ = f.Close()
+			return nil, errors.Wrapf(
+				err, "failed to read progress file %s", path)
+		}
+		mp.done[migratedFile{record[0], record[1]}] = struct{}{}
+	}
+
+	return mp, nil
+}
+
+// Done returns true if the file of the user has been migrated.
+func (mp *MigrationProgress) Done(username, path string) bool {
+	_, done := mp.done[migratedFile{username, path}]
+	return done
+}
+
+// Len returns the number of files that have been migrated.
+func (mp *MigrationProgress) Len() int {
+	return len(mp.done)
+}
+
+// record saves the file of the user with its checksum as migrated.
+func (mp *MigrationProgress) record(
+	username, path string, checksum []byte) error {
+	err := mp.w.Write([]string{username, path, hex.EncodeToString(checksum)})
+	if err != nil {
+		return errors.Wrap(err, "failed to record progress")
+	}
+	mp.w.Flush()
+	if err = mp.w.Error(); err != nil {
+		return errors.Wrap(err, "failed to record progress")
+	}
+	if err = mp.file.Sync(); err != nil {
+		return errors.Wrap(err, "failed to record progress")
+	}
+
+	mp.done[migratedFile{username, path}] = struct{}{}
+	return nil
+}
+
+// Close closes the progress file.
+func (mp *MigrationProgress) Close() error {
+	return mp.file.Close()
+}
@@ -0,0 +1,150 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package store
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+// Tests that MigrateFiles copies every file to the destination and records
+// them in the progress, and that a resumed migration skips the recorded files.
+func TestMigrateFiles(t *testing.T) {
+	src, _ := NewMemStore("", "")
+	dst, _ := NewFileStore(t.TempDir(), "waldo")
+	testFiles := map[string][]byte{
+		"hello.txt":       []byte("hello"),
+		"dir1/a.txt":      []byte("a"),
+		"dir1/dirA/b.txt": []byte("bb"),
+	}
+	for path, data := range testFiles {
+		if err := src.Write(path, data); err != nil {
+			t.Fatalf("Failed to write %s: %+v", path, err)
+		}
+	}
+
+	progressPath := filepath.Join(t.TempDir(), "progress.csv")
+	progress, err := OpenMigrationProgress(progressPath)
+	if err != nil {
+		t.Fatalf("Failed to open progress: %+v", err)
+	}
+	stats, err := MigrateFiles("waldo", src, dst, progress)
+	if err != nil {
+		t.Fatalf("Failed to migrate files: %+v", err)
+	}
+	expected := MigrationStats{Copied: 3, Bytes: 8}
+	if stats != expected {
+		t.Errorf("Unexpected stats.\nexpected: %+v\nreceived: %+v",
+			expected, stats)
+	}
+	for path, expected := range testFiles {
+		if data, err2 := dst.Read(path); err2 != nil {
+			t.Errorf("Failed to read %s: %+v", path, err2)
+		} else if !bytes.Equal(expected, data) {
+			t.Errorf("Unexpected data for path %s."+
+				"\nexpected: %q\nreceived: %q", path, expected, data)
+		}
+	}
+	if err = progress.Close(); err != nil {
+		t.Errorf("Failed to close progress: %+v", err)
+	}
+
+	// Resume with a new file, which is the only one copied
+	if err = src.Write("dir2/c.txt", []byte("c")); err != nil {
+		t.Fatalf("Failed to write file: %+v", err)
+	}
+	progress, err = OpenMigrationProgress(progressPath)
+	if err != nil {
+		t.Fatalf("Failed to reopen progress: %+v", err)
+	}
+	defer progress.Close()
+	if progress.Len() != len(testFiles) {
+		t.Errorf("Unexpected number of migrated files in progress."+
+			"\nexpected: %d\nreceived: %d", len(testFiles), progress.Len())
+	}
+	stats, err = MigrateFiles("waldo", src, dst, progress)
+	if err != nil {
+		t.Fatalf("Failed to resume migration: %+v", err)
+	}
+	expected = MigrationStats{Copied: 1, Skipped: 3, Bytes: 1}
+	if stats != expected {
+		t.Errorf("Unexpected stats after resuming."+
+			"\nexpected: %+v\nreceived: %+v", expected, stats)
+	}
+
+	// The files of other users are not skipped
+	if progress.Done("fred", "hello.txt") {
+		t.Errorf("File of another user recorded as migrated.")
+	}
+}
+
+// Error path: Tests that MigrateFiles returns ChecksumMismatchErr when the
+// destination does not store the data that was written, and that the file is
+// not recorded as migrated.
+func TestMigrateFiles_ChecksumMismatchError(t *testing.T) {
+	src, _ := NewMemStore("", "")
+	if err := src.Write("hello.txt", []byte("hello")); err != nil {
+		t.Fatalf("Failed to write file: %+v", err)
+	}
+	progress, err := OpenMigrationProgress(
+		filepath.Join(t.TempDir(), "progress.csv"))
+	if err != nil {
+		t.Fatalf("Failed to open progress: %+v", err)
+	}
+	defer progress.Close()
+
+	_, err = MigrateFiles("waldo", src, corruptStore{src}, progress)
+	if !errors.Is(err, ChecksumMismatchErr) {
+		t.Errorf("Unexpected error.\nexpected: %v\nreceived: %+v",
+			ChecksumMismatchErr, err)
+	}
+	if progress.Done("waldo", "hello.txt") {
+		t.Errorf("Corrupted file recorded as migrated.")
+	}
+}
+
+// Error path: Tests that MigrateFiles returns NotListableErr when the source
+// cannot list its files.
+func TestMigrateFiles_NotListableError(t *testing.T) {
+	src, _ := NewMemStore("", "")
+	dst, _ := NewMemStore("", "")
+	_, err := MigrateFiles("waldo", corruptStore{src}, dst, nil)
+	if !errors.Is(err, NotListableErr) {
+		t.Errorf("Unexpected error.\nexpected: %v\nreceived: %+v",
+			NotListableErr, err)
+	}
+}
+
+// Error path: Tests that OpenMigrationProgress returns an error for a progress
+// file that is not valid CSV with three fields.
+func TestOpenMigrationProgress_InvalidFileError(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "progress.csv")
+	err := os.WriteFile(path, []byte("waldo,hello.txt\n"), 0600)
+	if err != nil {
+		t.Fatalf("Failed to write progress file: %+v", err)
+	}
+	if _, err = OpenMigrationProgress(path); err == nil {
+		t.Errorf("Failed to get error for invalid progress file.")
+	}
+}
+
+// corruptStore is a Store that reads back different data than was written. It
+// does not implement Lister.
+type corruptStore struct {
+	Store
+}
+
+// Read returns the data in the file with an extra byte.
+func (cs corruptStore) Read(path string) ([]byte, error) {
+	data, err := cs.Store.Read(path)
+	return append(data, 0), err
+}
@@ -0,0 +1,35 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package store
+
+import (
+	"github.com/mitchellh/mapstructure"
+	"github.com/pkg/errors"
+)
+
+// decodeParams decodes the backend-specific parameters from the config into
+// the struct pointed to by out. Values are weakly typed so that parameters set
+// from strings (such as environment variables) are converted to the field
+// type. Returns an error if the params contain a key with no matching field.
+func decodeParams(params map[string]interface{}, out interface{}) error {
+	decoder, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{
+		DecodeHook:       mapstructure.StringToTimeDurationHookFunc(),
+		ErrorUnused:      true,
+		WeaklyTypedInput: true,
+		Result:           out,
+	})
+	if err != nil {
+		return errors.Wrap(err, "failed to create parameter decoder")
+	}
+
+	if err = decoder.Decode(params); err != nil {
+		return errors.Wrap(err, "failed to decode backend parameters")
+	}
+
+	return nil
+}
@@ -0,0 +1,52 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package store
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+// Tests that decodeParams decodes weakly typed values with keys in any case.
+func Test_decodeParams(t *testing.T) {
+	type testParams struct {
+		Name    string        `mapstructure:"name"`
+		Size    uint64        `mapstructure:"maxSize"`
+		Enabled bool          `mapstructure:"enabled"`
+		Timeout time.Duration `mapstructure:"timeout"`
+	}
+	expected := testParams{"name", 512, true, 3 * time.Second}
+
+	var p testParams
+	err := decodeParams(map[string]interface{}{
+		"name":    "name",
+		"maxsize": "512",
+		"Enabled": "true",
+		"timeout": "3s",
+	}, &p)
+	if err != nil {
+		t.Fatalf("Failed to decode params: %+v", err)
+	}
+
+	if !reflect.DeepEqual(expected, p) {
+		t.Errorf("Unexpected params.\nexpected: %+v\nreceived: %+v", expected, p)
+	}
+}
+
+// Error path: Tests that decodeParams returns an error for a key that does not
+// match any field.
+func Test_decodeParams_UnknownKeyError(t *testing.T) {
+	var p struct {
+		Name string `mapstructure:"name"`
+	}
+	err := decodeParams(map[string]interface{}{"nmae": "name"}, &p)
+	if err == nil {
+		t.Errorf("Failed to get error for unknown key.")
+	}
+}
@@ -0,0 +1,77 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package store
+
+import (
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// MaxPathLen is the maximum length, in bytes, of a path given by a client.
+	// It is the maximum length of an S3 object key, so that a path valid with
+	// one backend is valid with all of them.
+	MaxPathLen = 1024
+
+	// MaxPathElementLen is the maximum length, in bytes, of each element of a
+	// path given by a client, which is the maximum length of a file name on
+	// most filesystems.
+	MaxPathElementLen = 255
+)
+
+// InvalidPathErr is returned by SanitizePath for paths that could escape the
+// user's storage or that no backend can store.
+var InvalidPathErr = errors.New("invalid path")
+
+// SanitizePath validates and normalizes a path given by a client, so that it
+// can be passed to any backend. Backslashes are converted to forward slashes,
+// and empty and "." elements and trailing slashes are removed. The root, such
+// as "" or ".", is returned as an empty path.
+//
+// Returns [InvalidPathErr] if the path contains a NUL byte or a ".." element,
+// is absolute, or is too long or has an element that is too long.
+func SanitizePath(p string) (string, error) {
+	if len(p) > MaxPathLen {
+		return "", errors.Wrapf(InvalidPathErr,
+			"path of %d bytes exceeds %d bytes", len(p), MaxPathLen)
+	} else if strings.IndexByte(p, 0) != -1 {
+		return "", errors.Wrapf(InvalidPathErr, "%q contains a NUL byte", p)
+	}
+
+	// Clients on Windows may send either separator
+	p = strings.ReplaceAll(p, `\`, "/")
+	if strings.HasPrefix(p, "/") || hasDriveLetter(p) ||
+		filepath.VolumeName(p) != "" {
+		return "", errors.Wrapf(InvalidPathErr, "%q is absolute", p)
+	}
+	for _, element := range strings.Split(p, "/") {
+		if element == ".." {
+			return "", errors.Wrapf(
+				InvalidPathErr, "%q contains a \"..\" element", p)
+		} else if len(element) > MaxPathElementLen {
+			return "", errors.Wrapf(InvalidPathErr,
+				"%q has an element of %d bytes, which exceeds %d bytes", p,
+				len(element), MaxPathElementLen)
+		}
+	}
+
+	if p = path.Clean(p); p == "." {
+		return "", nil
+	}
+	return p, nil
+}
+
+// hasDriveLetter returns true if the path starts with a Windows drive letter,
+// such as "C:", which makes it absolute on Windows.
+func hasDriveLetter(p string) bool {
+	return len(p) >= 2 && p[1] == ':' &&
+		('a' <= p[0] && p[0] <= 'z' || 'A' <= p[0] && p[0] <= 'Z')
+}
@@ -0,0 +1,121 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package store
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+// Tests that SanitizePath normalizes separators, empty and "." elements, and
+// trailing slashes.
+func TestSanitizePath(t *testing.T) {
+	tests := map[string]string{
+		"":                       "",
+		".":                      "",
+		"./":                     "",
+		"file":                   "file",
+		"dir/file":               "dir/file",
+		`dir\sub\file`:           "dir/sub/file",
+		"dir//./sub/":            "dir/sub",
+		"./dir/file":             "dir/file",
+		"dir/..file":             "dir/..file",
+		"dir/file..":             "dir/file..",
+		"...":                    "...",
+		".versions/file":         ".versions/file",
+		"dir:a/b:c":              "dir:a/b:c",
+		strings.Repeat("a", 255): strings.Repeat("a", 255),
+	}
+	for p, expected := range tests {
+		sanitized, err := SanitizePath(p)
+		if err != nil {
+			t.Errorf("Failed to sanitize %q: %+v", p, err)
+		} else if sanitized != expected {
+			t.Errorf("Unexpected path for %q.\nexpected: %q\nreceived: %q",
+				p, expected, sanitized)
+		}
+	}
+}
+
+// Error path: Tests that SanitizePath returns InvalidPathErr for paths with
+// ".." elements or NUL bytes, absolute paths, and paths or elements that are
+// too long.
+func TestSanitizePath_Error(t *testing.T) {
+	tests := []string{
+		"..",
+		"../file",
+		"dir/../../file",
+		`dir\..\..\file`,
+		"dir/..",
+		"file\x00.txt",
+		"/etc/passwd",
+		`\etc\passwd`,
+		`\\server\share\file`,
+		"C:/Windows",
+		`c:\Windows`,
+		"C:file",
+		strings.Repeat("a", 256),
+		strings.Repeat("a/", MaxPathLen/2+1),
+	}
+	for _, p := range tests {
+		if _, err := SanitizePath(p); !errors.Is(err, InvalidPathErr) {
+			t.Errorf("Unexpected error for %q.\nexpected: %v\nreceived: %+v",
+				p, InvalidPathErr, err)
+		}
+	}
+}
+
+// Fuzzes SanitizePath to check that the paths it accepts are normalized, stay
+// inside the base directory when joined to it, and are unchanged when
+// sanitized again.
+func FuzzSanitizePath(f *testing.F) {
+	for _, p := range []string{"", ".", "dir/file", `dir\file`, "dir//./f/",
+		"../file", "dir/../..", "/abs", "C:/abs", "a\x00b", "...", "a/.../b"} {
+		f.Add(p)
+	}
+	f.Fuzz(func(t *testing.T, p string) {
+		sanitized, err := SanitizePath(p)
+		if err != nil {
+			if !errors.Is(err, InvalidPathErr) {
+				t.Fatalf("Unexpected error for %q: %+v", p, err)
+			}
+			return
+		}
+
+		if len(sanitized) > MaxPathLen ||
+			strings.ContainsAny(sanitized, "\x00\\") ||
+			strings.HasPrefix(sanitized, "/") ||
+			strings.HasSuffix(sanitized, "/") {
+			t.Errorf("Invalid path %q sanitized to %q.", p, sanitized)
+		}
+		if sanitized != "" {
+			for _, element := range strings.Split(sanitized, "/") {
+				if element == "" || element == "." || element == ".." ||
+					len(element) > MaxPathElementLen {
+					t.Errorf("Path %q sanitized to %q with element %q.",
+						p, sanitized, element)
+				}
+			}
+		}
+
+		base := filepath.Join("storage", "waldo")
+		if !isLocalFile(base, filepath.Join(base, sanitized)) {
+			t.Errorf("Path %q sanitized to %q is outside the base directory.",
+				p, sanitized)
+		}
+
+		if again, err := SanitizePath(sanitized); err != nil ||
+			again != sanitized {
+			t.Errorf("Path %q sanitized to %q and then to %q: %v",
+				p, sanitized, again, err)
+		}
+	})
+}
@@ -0,0 +1,322 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package store
+
+import (
+	"io"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Default values for PoolParams.
+const (
+	defaultPoolWorkers   = 64
+	defaultPoolQueueSize = 1024
+	defaultPoolTimeout   = 30 * time.Second
+)
+
+// States of a poolTask.
+const (
+	taskQueued int32 = iota
+	taskRunning
+	taskAbandoned
+	taskDone
+)
+
+var (
+	// PoolFullErr is returned for a storage operation submitted while the
+	// queue of the worker pool is full.
+	PoolFullErr = errors.New("storage queue is full")
+
+	// OperationTimeoutErr is returned for a storage operation that did not
+	// complete within the timeout of the worker pool. An operation that
+	// started before the timeout may still complete.
+	OperationTimeoutErr = errors.New("storage operation timed out")
+)
+
+// PoolParams contains the parameters of the worker pool that storage
+// operations run on. They are set in the "storagePool" section of the config.
+type PoolParams struct {
+	// Workers is the number of storage operations that run at once. Defaults
+	// to 64.
+	Workers int `mapstructure:"workers"`
+
+	// QueueSize is the number of operations that wait for a worker before
+	// further operations are rejected with PoolFullErr. Defaults to 1024.
+	QueueSize int `mapstructure:"queueSize"`
+
+	// Timeout is how long an operation can wait for a worker and run before
+	// it fails with OperationTimeoutErr. Operations still waiting are not run.
+	// Defaults to 30s.
+	Timeout time.Duration `mapstructure:"timeout"`
+}
+
+// PooledStore runs the operations of an underlying Store on a worker pool
+// shared by all stores, so that a slow backend ties up at most the workers of
+// the pool instead of a goroutine for every request. Files opened with Open
+// are read by the caller once opened. Adheres to the Store interface.
+type PooledStore struct {
+	Store
+	pool *workerPool
+}
+
+// NewPooledStore returns a NewStore that wraps each Store created by newStore
+// in a PooledStore with the parameters. The workers run for the lifetime of
+// the process.
+func NewPooledStore(
+	params map[string]interface{}, newStore NewStore) (NewStore, error) {
+	p := PoolParams{
+		Workers:   defaultPoolWorkers,
+		QueueSize: defaultPoolQueueSize,
+		Timeout:   defaultPoolTimeout,
+	}
+	if err := decodeParams(params, &p); err != nil {
+		return nil, err
+	} else if p.Workers <= 0 {
+		return nil, errors.Errorf("workers %d must be positive", p.Workers)
+	} else if p.QueueSize < 0 {
+		return nil, errors.Errorf(
+			"queue size %d cannot be negative", p.QueueSize)
+	} else if p.Timeout <= 0 {
+		return nil, errors.Errorf("timeout %s must be positive", p.Timeout)
+	}
+
+	pool := newWorkerPool(p)
+	return func(storageDir, baseDir string) (Store, error) {
+		s, err := newStore(storageDir, baseDir)
+		if err != nil {
+			return nil, err
+		}
+		return &PooledStore{Store: s, pool: pool}, nil
+	}, nil
+}
+
+// Read reads the file at the path on the pool.
+func (ps *PooledStore) Read(path string) ([]byte, error) {
+	var data []byte
+	var err error
+	if poolErr := ps.pool.run(func() {
+		data, err = ps.Store.Read(path)
+	}, nil); poolErr != nil {
+		return nil, errors.WithMessagef(poolErr, "failed to read %s", path)
+	}
+	return data, err
+}
+
+// Write writes the data to the file at the path on the pool.
+func (ps *PooledStore) Write(path string, data []byte) error {
+	var err error
+	if poolErr := ps.pool.run(func() {
+		err = ps.Store.Write(path, data)
+	}, nil); poolErr != nil {
+		return errors.WithMessagef(poolErr, "failed to write %s", path)
+	}
+	return err
+}
+
+// GetLastModified returns the last modification time of the file at the path
+// on the pool.
+func (ps *PooledStore) GetLastModified(path string) (time.Time, error) {
+	var lastModified time.Time
+	var err error
+	if poolErr := ps.pool.run(func() {
+		lastModified, err = ps.Store.GetLastModified(path)
+	}, nil); poolErr != nil {
+		return time.Time{}, errors.WithMessagef(
+			poolErr, "failed to get last modified of %s", path)
+	}
+	return lastModified, err
+}
+
+// GetLastWrite returns the time of the most recent write on the pool.
+func (ps *PooledStore) GetLastWrite() (time.Time, error) {
+	var lastWrite time.Time
+	var err error
+	if poolErr := ps.pool.run(func() {
+		lastWrite, err = ps.Store.GetLastWrite()
+	}, nil); poolErr != nil {
+		return time.Time{}, errors.WithMessage(
+			poolErr, "failed to get last write")
+	}
+	return lastWrite, err
+}
+
+// ReadDir reads the directory at the path on the pool.
+func (ps *PooledStore) ReadDir(path string) ([]string, error) {
+	var entries []string
+	var err error
+	if poolErr := ps.pool.run(func() {
+		entries, err = ps.Store.ReadDir(path)
+	}, nil); poolErr != nil {
+		return nil, errors.WithMessagef(
+			poolErr, "failed to read directory %s", path)
+	}
+	return entries, err
+}
+
+// Delete deletes the file at the path on the pool.
+func (ps *PooledStore) Delete(path string) error {
+	var err error
+	if poolErr := ps.pool.run(func() {
+		err = ps.Store.Delete(path)
+	}, nil); poolErr != nil {
+		return errors.WithMessagef(poolErr, "failed to delete %s", path)
+	}
+	return err
+}
+
+// Open opens the file at the path on the pool. The file is read by the caller.
+// If the operation times out after the file is opened, it is closed.
+func (ps *PooledStore) Open(path string) (io.ReadCloser, int64, error) {
+	var r io.ReadCloser
+	var size int64
+	var err error
+	if poolErr := ps.pool.run(func() {
+		r, size, err = Open(ps.Store, path)
+	}, func() {
+		if err == nil {
+			_ = r.Close()
+		}
+	}); poolErr != nil {
+		return nil, 0, errors.WithMessagef(poolErr, "failed to open %s", path)
+	}
+	return r, size, err
+}
+
+// ListFiles returns the paths of all files in the underlying store on the
+// pool. Returns an error if the underlying store does not implement Lister.
+func (ps *PooledStore) ListFiles() ([]string, error) {
+	lister, ok := ps.Store.(Lister)
+	if !ok {
+		return nil, errors.New("underlying store cannot list its files")
+	}
+	var files []string
+	var err error
+	if poolErr := ps.pool.run(func() {
+		files, err = lister.ListFiles()
+	}, nil); poolErr != nil {
+		return nil, errors.WithMessage(poolErr, "failed to list files")
+	}
+	return files, err
+}
+
+// Size returns the total size of the files in the underlying store on the
+// pool. Returns an error if the underlying store does not implement Sizer.
+func (ps *PooledStore) Size() (int64, error) {
+	sizer, ok := ps.Store.(Sizer)
+	if !ok {
+		return 0, errors.New("underlying store cannot report its size")
+	}
+	var size int64
+	var err error
+	if poolErr := ps.pool.run(func() {
+		size, err = sizer.Size()
+	}, nil); poolErr != nil {
+		return 0, errors.WithMessage(poolErr, "failed to measure size")
+	}
+	return size, err
+}
+
+// Ping returns an error if the underlying store cannot be reached. Stores that
+// do not implement Pinger are assumed to be reachable. The ping runs on the
+// pool, so it also fails while the pool is saturated.
+func (ps *PooledStore) Ping() error {
+	pinger, ok := ps.Store.(Pinger)
+	if !ok {
+		return nil
+	}
+	var err error
+	if poolErr := ps.pool.run(func() {
+		err = pinger.Ping()
+	}, nil); poolErr != nil {
+		return errors.WithMessage(poolErr, "failed to ping storage")
+	}
+	return err
+}
+
+// workerPool runs operations on a fixed number of goroutines, with a bounded
+// queue of operations waiting for them.
+type workerPool struct {
+	timeout time.Duration
+	queue   chan *poolTask
+}
+
+// poolTask is an operation submitted to a workerPool. Its state is one of
+// taskQueued, taskRunning, taskAbandoned, and taskDone.
+type poolTask struct {
+	op      func()
+	cleanup func()
+	done    chan struct{}
+	state   int32
+}
+
+// newWorkerPool starts the workers of a workerPool with the parameters.
+func newWorkerPool(p PoolParams) *workerPool {
+	wp := &workerPool{
+		timeout: p.Timeout,
+		queue:   make(chan *poolTask, p.QueueSize),
+	}
+	for i := 0; i < p.Workers; i++ {
+		go wp.work()
+	}
+	return wp
+}
+
+// work runs the operations of the queue that were not abandoned while they
+// waited. Operations abandoned while they ran are cleaned up once complete.
+func (wp *workerPool) work() {
+	for task := range wp.queue {
+		if !atomic.CompareAndSwapInt32(&task.state, taskQueued, taskRunning) {
+			continue
+		}
+		task.op()
+		if !atomic.CompareAndSwapInt32(&task.state, taskRunning, taskDone) &&
+			task.cleanup != nil {
+			task.cleanup()
+		}
+		close(task.done)
+	}
+}
+
+// run runs the operation on a worker and waits for it to complete. Returns
+// [PoolFullErr] if all workers are busy and the queue is full, and
+// [OperationTimeoutErr] if it does not complete within the timeout. The
+// results set by the operation must only be used if it returns nil. If the
+// operation completes after the timeout, the cleanup, if not nil, is called
+// once it does.
+func (wp *workerPool) run(op, cleanup func()) error {
+	task := &poolTask{op: op, cleanup: cleanup, done: make(chan struct{})}
+	select {
+	case wp.queue <- task:
+	default:
+		return errors.Wrapf(
+			PoolFullErr, "%d operations waiting", cap(wp.queue))
+	}
+
+	timer := time.NewTimer(wp.timeout)
+	defer timer.Stop()
+	select {
+	case <-task.done:
+		return nil
+	case <-timer.C:
+	}
+
+	if atomic.CompareAndSwapInt32(&task.state, taskQueued, taskAbandoned) {
+		return errors.Wrapf(OperationTimeoutErr,
+			"waited %s for a worker", wp.timeout)
+	} else if atomic.CompareAndSwapInt32(
+		&task.state, taskRunning, taskAbandoned) {
+		return errors.Wrapf(OperationTimeoutErr,
+			"no result after %s; it may still complete", wp.timeout)
+	}
+
+	// The operation completed as it timed out
+	return nil
+}
@@ -0,0 +1,174 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package store
+
+import (
+	"bytes"
+	"io"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Tests that PooledStore adheres to the Store interface.
+var _ Store = (*PooledStore)(nil)
+
+// Tests that PooledStore adheres to the Lister interface.
+var _ Lister = (*PooledStore)(nil)
+
+// Tests that PooledStore adheres to the Opener interface.
+var _ Opener = (*PooledStore)(nil)
+
+// blockingStore is a MemStore whose writes wait until release is closed and
+// count the writes that ran.
+type blockingStore struct {
+	*MemStore
+	release chan struct{}
+	writes  int32
+}
+
+// Write waits until the store is released and writes the file.
+func (bs *blockingStore) Write(path string, data []byte) error {
+	<-bs.release
+	atomic.AddInt32(&bs.writes, 1)
+	return bs.MemStore.Write(path, data)
+}
+
+// newTestPooledStore returns a PooledStore with the parameters over a
+// blockingStore of a MemStore.
+func newTestPooledStore(t *testing.T,
+	params map[string]interface{}) (*PooledStore, *blockingStore) {
+	ms, _ := NewMemStore("", "")
+	bs := &blockingStore{
+		MemStore: ms.(*MemStore), release: make(chan struct{})}
+	newStore, err := NewPooledStore(params,
+		func(string, string) (Store, error) { return bs, nil })
+	if err != nil {
+		t.Fatalf("Failed to create pool: %+v", err)
+	}
+	s, err := newStore("", "user")
+	if err != nil {
+		t.Fatalf("Failed to create store: %+v", err)
+	}
+	return s.(*PooledStore), bs
+}
+
+// Tests that the operations of a PooledStore reach the underlying store.
+func TestPooledStore(t *testing.T) {
+	ps, bs := newTestPooledStore(t, nil)
+	close(bs.release)
+	data := []byte("data")
+	if err := ps.Write("dir/file", data); err != nil {
+		t.Fatalf("Failed to write: %+v", err)
+	}
+
+	if read, err := ps.Read("dir/file"); err != nil {
+		t.Errorf("Failed to read: %+v", err)
+	} else if !bytes.Equal(read, data) {
+		t.Errorf("Unexpected data.\nexpected: %q\nreceived: %q", data, read)
+	}
+	r, size, err := ps.Open("dir/file")
+	if err != nil {
+		t.Fatalf("Failed to open: %+v", err)
+	}
+	if read, _ := io.ReadAll(r); size != 4 || !bytes.Equal(read, data) {
+		t.Errorf("Unexpected opened file: %d bytes %q", size, read)
+	}
+	_ = r.Close()
+	if entries, err := ps.ReadDir(""); err != nil || len(entries) != 1 {
+		t.Errorf("Unexpected entries %q: %+v", entries, err)
+	}
+	if files, err := ps.ListFiles(); err != nil || len(files) != 1 {
+		t.Errorf("Unexpected files %q: %+v", files, err)
+	}
+	if _, err = ps.GetLastModified("dir/file"); err != nil {
+		t.Errorf("Failed to get last modified: %+v", err)
+	}
+	if err = ps.Delete("dir/file"); err != nil {
+		t.Errorf("Failed to delete: %+v", err)
+	}
+	if _, err = ps.Read("dir/file"); err == nil {
+		t.Errorf("Read deleted file.")
+	}
+}
+
+// Error path: Tests that NewPooledStore returns an error for unknown
+// parameters and invalid sizes and timeouts.
+func TestNewPooledStore_Error(t *testing.T) {
+	tests := []map[string]interface{}{
+		{"unknown": 1},
+		{"workers": 0},
+		{"queueSize": -1},
+		{"timeout": "0s"},
+	}
+	for _, params := range tests {
+		if _, err := NewPooledStore(params, NewMemStore); err == nil {
+			t.Errorf("No error for parameters %+v.", params)
+		}
+	}
+}
+
+// Error path: Tests that an operation submitted while the only worker is busy
+// and the queue is full fails with PoolFullErr.
+func TestPooledStore_PoolFullErr(t *testing.T) {
+	ps, bs := newTestPooledStore(t, map[string]interface{}{
+		"workers": 1, "queueSize": 1, "timeout": "1m"})
+	defer close(bs.release)
+
+	go func() { _ = ps.Write("running", nil) }()
+	go func() { _ = ps.Write("queued", nil) }()
+	deadline := time.Now().Add(5 * time.Second)
+	for len(ps.pool.queue) < 1 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+
+	if _, err := ps.Read("file"); !errors.Is(err, PoolFullErr) {
+		t.Errorf("Unexpected error.\nexpected: %v\nreceived: %+v",
+			PoolFullErr, err)
+	}
+}
+
+// Error path: Tests that operations that do not complete within the timeout
+// fail with OperationTimeoutErr, and that an operation that timed out while
+// waiting for a worker is never run.
+func TestPooledStore_OperationTimeoutErr(t *testing.T) {
+	ps, bs := newTestPooledStore(t, map[string]interface{}{
+		"workers": 1, "queueSize": 1, "timeout": "50ms"})
+
+	running := make(chan error)
+	go func() { running <- ps.Write("running", nil) }()
+	time.Sleep(10 * time.Millisecond)
+	err := ps.Write("queued", nil)
+	if !errors.Is(err, OperationTimeoutErr) {
+		t.Errorf("Unexpected error of queued write.\nexpected: %v"+
+			"\nreceived: %+v", OperationTimeoutErr, err)
+	}
+	if err = <-running; !errors.Is(err, OperationTimeoutErr) {
+		t.Errorf("Unexpected error of running write.\nexpected: %v"+
+			"\nreceived: %+v", OperationTimeoutErr, err)
+	}
+
+	// Wait for the worker to skip the abandoned write in the queue
+	close(bs.release)
+	deadline := time.Now().Add(5 * time.Second)
+	for len(ps.pool.queue) > 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if err = ps.Write("after", nil); err != nil {
+		t.Fatalf("Failed to write after release: %+v", err)
+	}
+	if writes := atomic.LoadInt32(&bs.writes); writes != 2 {
+		t.Errorf("Unexpected number of writes run.\nexpected: %d"+
+			"\nreceived: %d", 2, writes)
+	}
+	if _, err = ps.Read("queued"); err == nil {
+		t.Errorf("Write that timed out while queued was run.")
+	}
+}
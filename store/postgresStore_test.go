@@ -0,0 +1,25 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package store
+
+import (
+	"testing"
+)
+
+// Error path: Tests that OpenPostgres returns an error when no DSN is
+// specified or when an unknown parameter is set.
+func TestOpenPostgres_InvalidParamsError(t *testing.T) {
+	for i, params := range []map[string]interface{}{
+		{},
+		{"dsn": "postgres://localhost/db", "maxOpenConn": 5},
+	} {
+		if _, err := OpenPostgres(params); err == nil {
+			t.Errorf("Failed to get error for invalid params (%d): %v", i, params)
+		}
+	}
+}
@@ -0,0 +1,295 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package store
+
+import (
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/redis/go-redis/v9"
+	jww "github.com/spf13/jwalterweatherman"
+)
+
+// Default values for RedisParams.
+const (
+	defaultRedisTTL          = time.Hour
+	defaultRedisMaxValueSize = 4 * 1024
+	defaultRedisTimeout      = 250 * time.Millisecond
+)
+
+// redisKeyPrefix is prepended to all keys written to Redis.
+const redisKeyPrefix = "remoteSync:"
+
+// RedisParams contains the parameters of the Redis cache. They are set in the
+// "redis" section of the config.
+type RedisParams struct {
+	// Password and DB select the Redis database to use.
+	Password string `mapstructure:"password"`
+	DB       int    `mapstructure:"db"`
+
+	// TTL is the amount of time an entry is kept in the cache.
+	TTL time.Duration `mapstructure:"ttl"`
+
+	// MaxValueSize is the maximum size, in bytes, of a file for its contents to
+	// be cached. If it is zero, only metadata is cached.
+	MaxValueSize int `mapstructure:"maxValueSize"`
+
+	// Timeout is the maximum duration of a single Redis operation. It should be
+	// short so that the server falls back to the storage backend quickly when
+	// Redis is unavailable.
+	Timeout time.Duration `mapstructure:"timeout"`
+}
+
+// RedisCache caches the last-modified and last-write times and the contents
+// of small files of an underlying Store in Redis, so that frequent polling
+// does not reach a slow storage backend. Entries are invalidated or replaced
+// on every write and delete.
+//
+// If Redis is unavailable, all operations fall through to the underlying store.
+// Adheres to the Store interface.
+type RedisCache struct {
+	Store
+	client       *redis.Client
+	username     string
+	ttl          time.Duration
+	maxValueSize int
+	timeout      time.Duration
+	health       *redisHealth
+}
+
+// redisHealth tracks whether Redis is reachable so that a failure is only
+// logged once instead of on every operation.
+type redisHealth struct {
+	down atomic.Bool
+}
+
+// NewRedisCache connects to the Redis server at the address and returns a
+// NewStore that wraps each Store created by newStore in a RedisCache.
+//
+// If Redis cannot be reached on startup, a warning is printed and the server
+// continues without the cache until Redis becomes available.
+func NewRedisCache(addr string, params map[string]interface{},
+	newStore NewStore) (NewStore, error) {
+	p := RedisParams{
+		TTL:          defaultRedisTTL,
+		MaxValueSize: defaultRedisMaxValueSize,
+		Timeout:      defaultRedisTimeout,
+	}
+	if err := decodeParams(params, &p); err != nil {
+		return nil, err
+	}
+
+	client := redis.NewClient(&redis.Options{
+		Addr:         addr,
+		Password:     p.Password,
+		DB:           p.DB,
+		DialTimeout:  p.Timeout,
+		ReadTimeout:  p.Timeout,
+		WriteTimeout: p.Timeout,
+	})
+
+	health := &redisHealth{}
+	ctx, cancel := newContext(p.Timeout)
+	defer cancel()
+	if err := client.Ping(ctx).Err(); err != nil {
+		health.down.Store(true)
+		jww.WARN.Printf("Failed to connect to Redis at %s; metadata will be "+
+			"read from the storage backend until it is available: %+v",
+			addr, err)
+	} else {
+		jww.INFO.Printf("Caching metadata in Redis at %s.", addr)
+	}
+
+	return func(storageDir, baseDir string) (Store, error) {
+		s, err := newStore(storageDir, baseDir)
+		if err != nil {
+			return nil, err
+		}
+		return &RedisCache{
+			Store:        s,
+			client:       client,
+			username:     baseDir,
+			ttl:          p.TTL,
+			maxValueSize: p.MaxValueSize,
+			timeout:      p.Timeout,
+			health:       health,
+		}, nil
+	}, nil
+}
+
+// Read returns the cached contents of the file if it is small enough to be
+// cached. Otherwise, it is read from the underlying store.
+func (rc *RedisCache) Read(path string) ([]byte, error) {
+	key, err := rc.fileKey("data", path)
+	if err != nil || rc.maxValueSize == 0 {
+		return rc.Store.Read(path)
+	}
+
+	ctx, cancel := newContext(rc.timeout)
+	defer cancel()
+	data, err := rc.client.Get(ctx, key).Bytes()
+	if err == nil {
+		return data, nil
+	}
+	rc.logError("read", err)
+
+	data, err = rc.Store.Read(path)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) <= rc.maxValueSize {
+		rc.set(key, data)
+	}
+
+	return data, nil
+}
+
+// Write writes the data to the underlying store and updates the cache. The
+// contents of small files are cached; the modification times are invalidated
+// so that they are next read from the underlying store.
+func (rc *RedisCache) Write(path string, data []byte) error {
+	if err := rc.Store.Write(path, data); err != nil {
+		return err
+	}
+
+	dataKey, err := rc.fileKey("data", path)
+	if err != nil {
+		return nil
+	}
+	modifiedKey, _ := rc.fileKey("modified", path)
+
+	if rc.maxValueSize > 0 && len(data) <= rc.maxValueSize {
+		rc.set(dataKey, data)
+		rc.del(modifiedKey, rc.key("lastWrite"))
+	} else {
+		rc.del(dataKey, modifiedKey, rc.key("lastWrite"))
+	}
+
+	return nil
+}
+
+// GetLastModified returns the cached last modification time of the file or
+// gets it from the underlying store on a cache miss.
+func (rc *RedisCache) GetLastModified(path string) (time.Time, error) {
+	key, err := rc.fileKey("modified", path)
+	if err != nil {
+		return rc.Store.GetLastModified(path)
+	}
+	return rc.getTime(key, func() (time.Time, error) {
+		return rc.Store.GetLastModified(path)
+	})
+}
+
+// GetLastWrite returns the cached time of the last write or gets it from the
+// underlying store on a cache miss.
+func (rc *RedisCache) GetLastWrite() (time.Time, error) {
+	return rc.getTime(rc.key("lastWrite"), rc.Store.GetLastWrite)
+}
+
+// Delete deletes the file from the underlying store and removes it from the
+// cache.
+func (rc *RedisCache) Delete(path string) error {
+	if err := rc.Store.Delete(path); err != nil {
+		return err
+	}
+
+	if dataKey, err := rc.fileKey("data", path); err == nil {
+		modifiedKey, _ := rc.fileKey("modified", path)
+		rc.del(dataKey, modifiedKey, rc.key("lastWrite"))
+	}
+
+	return nil
+}
+
+// Size returns the total size of the files in the underlying store, which is
+// not cached. Returns an error if the underlying store does not implement
+// Sizer.
+func (rc *RedisCache) Size() (int64, error) {
+	sizer, ok := rc.Store.(Sizer)
+	if !ok {
+		return 0, errors.New("underlying store cannot report its size")
+	}
+	return sizer.Size()
+}
+
+// Ping returns an error if the underlying store cannot be reached. Redis itself
+// is not checked, since the cache falls back to the store while it is
+// unavailable. Stores that do not implement Pinger are assumed to be reachable.
+func (rc *RedisCache) Ping() error {
+	if pinger, ok := rc.Store.(Pinger); ok {
+		return pinger.Ping()
+	}
+	return nil
+}
+
+// getTime returns the time stored in the key. On a cache miss, the time is
+// loaded with get and cached.
+func (rc *RedisCache) getTime(
+	key string, get func() (time.Time, error)) (time.Time, error) {
+	ctx, cancel := newContext(rc.timeout)
+	defer cancel()
+	nano, err := rc.client.Get(ctx, key).Int64()
+	if err == nil {
+		return time.Unix(0, nano), nil
+	}
+	rc.logError("read", err)
+
+	t, err := get()
+	if err != nil {
+		return time.Time{}, err
+	}
+	rc.set(key, strconv.FormatInt(t.UnixNano(), 10))
+
+	return t, nil
+}
+
+// set saves the value to the key. Errors are logged and otherwise ignored.
+func (rc *RedisCache) set(key string, value interface{}) {
+	ctx, cancel := newContext(rc.timeout)
+	defer cancel()
+	rc.logError("write", rc.client.Set(ctx, key, value, rc.ttl).Err())
+}
+
+// del deletes the keys. Errors are logged and otherwise ignored.
+func (rc *RedisCache) del(keys ...string) {
+	ctx, cancel := newContext(rc.timeout)
+	defer cancel()
+	rc.logError("delete", rc.client.Del(ctx, keys...).Err())
+}
+
+// logError prints a warning the first time an operation fails after Redis
+// becomes unavailable and a message when it becomes available again. Cache
+// misses are not errors.
+func (rc *RedisCache) logError(op string, err error) {
+	if err == nil || errors.Is(err, redis.Nil) {
+		if rc.health.down.CompareAndSwap(true, false) {
+			jww.INFO.Printf("Redis cache is available again.")
+		}
+	} else if rc.health.down.CompareAndSwap(false, true) {
+		jww.WARN.Printf("Failed to %s Redis cache; falling back to the "+
+			"storage backend until it is available: %+v", op, err)
+	}
+}
+
+// key returns the Redis key for a value of the user. The username is quoted so
+// that it cannot be confused with the rest of the key.
+func (rc *RedisCache) key(name string) string {
+	return redisKeyPrefix + name + ":" + strconv.Quote(rc.username)
+}
+
+// fileKey returns the Redis key for a value of the file at the path. Returns
+// NonLocalFileErr if the path is outside the base path.
+func (rc *RedisCache) fileKey(name, path string) (string, error) {
+	path, err := readyKey("", path)
+	if err != nil {
+		return "", err
+	}
+	return rc.key(name) + ":" + path, nil
+}
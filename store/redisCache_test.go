@@ -0,0 +1,180 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package store
+
+import (
+	"bytes"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/pkg/errors"
+)
+
+// Tests that RedisCache adheres to the Store interface.
+var _ Store = (*RedisCache)(nil)
+
+// Tests that RedisCache adheres to the Sizer interface.
+var _ Sizer = (*RedisCache)(nil)
+
+// Tests that RedisCache adheres to the Pinger interface.
+var _ Pinger = (*RedisCache)(nil)
+
+// Tests that RedisCache.GetLastModified and RedisCache.GetLastWrite are served
+// from the cache after the first call and are invalidated by
+// RedisCache.Write.
+func TestRedisCache_GetLastModified_GetLastWrite(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rc, ms := newTestRedisCache(mr.Addr(), nil, t)
+
+	if err := rc.Write("dir/file", []byte("data")); err != nil {
+		t.Fatalf("Failed to write file: %+v", err)
+	}
+	expected, _ := ms.GetLastModified("dir/file")
+
+	if lm, err := rc.GetLastModified("dir/file"); err != nil {
+		t.Fatalf("Failed to get last modified: %+v", err)
+	} else if !lm.Equal(expected) {
+		t.Errorf("Unexpected last modified.\nexpected: %s\nreceived: %s",
+			expected, lm)
+	}
+	if lw, err := rc.GetLastWrite(); err != nil {
+		t.Fatalf("Failed to get last write: %+v", err)
+	} else if !lw.Equal(expected) {
+		t.Errorf("Unexpected last write.\nexpected: %s\nreceived: %s",
+			expected, lw)
+	}
+
+	// Modify the underlying store directly; the cached values should be
+	// returned
+	time.Sleep(time.Millisecond)
+	_ = ms.Write("dir/file", []byte("new"))
+	if lm, _ := rc.GetLastModified("dir/./file"); !lm.Equal(expected) {
+		t.Errorf("Last modified not read from cache."+
+			"\nexpected: %s\nreceived: %s", expected, lm)
+	}
+	if lw, _ := rc.GetLastWrite(); !lw.Equal(expected) {
+		t.Errorf("Last write not read from cache."+
+			"\nexpected: %s\nreceived: %s", expected, lw)
+	}
+
+	// Writing through the cache invalidates the times
+	time.Sleep(time.Millisecond)
+	if err := rc.Write("dir/file", []byte("newer")); err != nil {
+		t.Fatalf("Failed to write file: %+v", err)
+	}
+	expected, _ = ms.GetLastModified("dir/file")
+	if lm, _ := rc.GetLastModified("dir/file"); !lm.Equal(expected) {
+		t.Errorf("Last modified not invalidated."+
+			"\nexpected: %s\nreceived: %s", expected, lm)
+	}
+	if lw, _ := rc.GetLastWrite(); !lw.Equal(expected) {
+		t.Errorf("Last write not invalidated."+
+			"\nexpected: %s\nreceived: %s", expected, lw)
+	}
+}
+
+// Tests that RedisCache.Read returns the cached contents of small files and
+// reads large files from the underlying store, and that RedisCache.Delete
+// removes files from the cache.
+func TestRedisCache_Read_Delete(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rc, ms := newTestRedisCache(
+		mr.Addr(), map[string]interface{}{"maxValueSize": 4}, t)
+
+	if err := rc.Write("small", []byte("abc")); err != nil {
+		t.Fatalf("Failed to write file: %+v", err)
+	}
+	if err := rc.Write("large", []byte("abcdefgh")); err != nil {
+		t.Fatalf("Failed to write file: %+v", err)
+	}
+
+	// Change the underlying files; only the small file is cached
+	_ = ms.Write("small", []byte("xyz"))
+	_ = ms.Write("large", []byte("stuvwxyz"))
+	if data, _ := rc.Read("small"); !bytes.Equal([]byte("abc"), data) {
+		t.Errorf("Small file not read from cache: %q", data)
+	}
+	if data, _ := rc.Read("large"); !bytes.Equal([]byte("stuvwxyz"), data) {
+		t.Errorf("Large file read from cache: %q", data)
+	}
+
+	if err := rc.Delete("small"); err != nil {
+		t.Fatalf("Failed to delete file: %+v", err)
+	}
+	if _, err := rc.Read("small"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Unexpected error reading deleted file."+
+			"\nexpected: %v\nreceived: %v", os.ErrNotExist, err)
+	}
+}
+
+// Tests that RedisCache falls back to the underlying store when Redis is
+// unavailable and uses the cache again once it recovers.
+func TestRedisCache_RedisUnavailable(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rc, _ := newTestRedisCache(mr.Addr(), nil, t)
+	mr.Close()
+
+	if err := rc.Write("file", []byte("data")); err != nil {
+		t.Fatalf("Failed to write file with Redis down: %+v", err)
+	}
+	if data, err := rc.Read("file"); err != nil {
+		t.Errorf("Failed to read file with Redis down: %+v", err)
+	} else if !bytes.Equal([]byte("data"), data) {
+		t.Errorf("Unexpected data.\nexpected: %q\nreceived: %q", "data", data)
+	}
+	if _, err := rc.GetLastWrite(); err != nil {
+		t.Errorf("Failed to get last write with Redis down: %+v", err)
+	}
+	if !rc.(*RedisCache).health.down.Load() {
+		t.Errorf("Redis not marked as down.")
+	}
+
+	if err := mr.Restart(); err != nil {
+		t.Fatalf("Failed to restart Redis: %+v", err)
+	}
+
+	// The client waits before redialing after repeated failures
+	for start := time.Now(); rc.(*RedisCache).health.down.Load(); {
+		if time.Since(start) > 5*time.Second {
+			t.Fatalf("Redis still marked as down after restart.")
+		}
+		if _, err := rc.GetLastWrite(); err != nil {
+			t.Fatalf("Failed to get last write after Redis restart: %+v", err)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+// Error path: Tests that NewRedisCache returns an error for unknown
+// parameters.
+func TestNewRedisCache_InvalidParamsError(t *testing.T) {
+	_, err := NewRedisCache(
+		"localhost:0", map[string]interface{}{"tll": "1h"}, NewMemStore)
+	if err == nil {
+		t.Errorf("Failed to get error for invalid params.")
+	}
+}
+
+// newTestRedisCache creates a RedisCache in front of a MemStore and returns
+// both.
+func newTestRedisCache(addr string, params map[string]interface{},
+	t testing.TB) (Store, Store) {
+	ms, _ := NewMemStore("", "")
+	newStore, err := NewRedisCache(addr, params,
+		func(string, string) (Store, error) { return ms, nil })
+	if err != nil {
+		t.Fatalf("Failed to create Redis cache: %+v", err)
+	}
+	rc, err := newStore("", "waldo")
+	if err != nil {
+		t.Fatalf("Failed to create store: %+v", err)
+	}
+	return rc, ms
+}
@@ -0,0 +1,23 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package store
+
+import (
+	"gitlab.com/elixxir/remoteSyncServer/storage"
+)
+
+// Names of the built-in storage backends.
+const (
+	FileBackend   = "file"
+	MemoryBackend = "memory"
+)
+
+func init() {
+	storage.RegisterBackend(FileBackend, newFileBackend)
+	storage.RegisterBackend(MemoryBackend, newMemBackend)
+}
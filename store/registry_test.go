@@ -0,0 +1,33 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package store
+
+import (
+	"testing"
+
+	"gitlab.com/elixxir/remoteSyncServer/storage"
+)
+
+// Tests that the built-in backends are registered with the storage package and
+// that their backend creates a working Store.
+func TestBuiltInBackends(t *testing.T) {
+	for _, name := range []string{FileBackend, MemoryBackend} {
+		backend, err := storage.GetBackend(name)
+		if err != nil {
+			t.Errorf("Failed to get backend %q: %+v", name, err)
+			continue
+		}
+
+		newStore, err := backend(nil)
+		if err != nil {
+			t.Errorf("Failed to initialise backend %q: %+v", name, err)
+		} else if newStore == nil {
+			t.Errorf("Backend %q returned nil NewStore.", name)
+		}
+	}
+}
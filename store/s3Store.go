@@ -0,0 +1,414 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package store
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+	"github.com/pkg/errors"
+	jww "github.com/spf13/jwalterweatherman"
+
+	"gitlab.com/elixxir/remoteSyncServer/storage"
+)
+
+// S3Backend is the name of the S3 storage backend.
+const S3Backend = "s3"
+
+// Default values for S3Params.
+const (
+	defaultS3Endpoint   = "s3.amazonaws.com"
+	defaultS3MaxRetries = 10
+	defaultS3PartSize   = 16 * 1024 * 1024
+)
+
+func init() {
+	storage.RegisterBackend(S3Backend, newS3Backend)
+}
+
+// S3Params contains the parameters used to connect to an S3-compatible object
+// store (such as AWS S3 or MinIO). They are set in the "s3" section of the
+// config.
+type S3Params struct {
+	// Bucket is the name of the bucket that all objects are stored in. It
+	// must already exist.
+	Bucket string `mapstructure:"bucket"`
+
+	// Region is the region the bucket is located in.
+	Region string `mapstructure:"region"`
+
+	// Endpoint is the host (and optional port) of the object store. Defaults
+	// to AWS S3.
+	Endpoint string `mapstructure:"endpoint"`
+
+	// Prefix is prepended to the key of every object so that the bucket can
+	// be shared with other services.
+	Prefix string `mapstructure:"prefix"`
+
+	// AccessKeyID and SecretAccessKey are the static credentials used to
+	// access the bucket. If they are not set, credentials are read from the
+	// standard AWS/MinIO environment variables and, on AWS, from IAM.
+	AccessKeyID     string `mapstructure:"accessKeyID"`
+	SecretAccessKey string `mapstructure:"secretAccessKey"`
+	SessionToken    string `mapstructure:"sessionToken"`
+
+	// Insecure connects to the endpoint over HTTP instead of HTTPS.
+	Insecure bool `mapstructure:"insecure"`
+
+	// MaxRetries is the number of times a failed request is retried.
+	MaxRetries int `mapstructure:"maxRetries"`
+
+	// PartSize is the size, in bytes, of each part of a multipart upload.
+	// Objects larger than this are uploaded in multiple parts.
+	PartSize uint64 `mapstructure:"partSize"`
+
+	// Timeout is the maximum duration of a single store operation. No timeout
+	// is used if it is zero.
+	Timeout time.Duration `mapstructure:"timeout"`
+}
+
+// S3Store manages the storage for a single user in an S3 bucket. All of a
+// user's objects are saved under a common key prefix. Adheres to the Store
+// interface.
+type S3Store struct {
+	client   *minio.Client
+	bucket   string
+	baseKey  string
+	partSize uint64
+	timeout  time.Duration
+
+	lastWritePath string
+	mux           sync.Mutex
+}
+
+// newS3Backend connects to the object store described by the parameters and
+// returns a NewStore that creates an S3Store for each user.
+func newS3Backend(params map[string]interface{}) (NewStore, error) {
+	p := S3Params{
+		Endpoint:   defaultS3Endpoint,
+		MaxRetries: defaultS3MaxRetries,
+		PartSize:   defaultS3PartSize,
+	}
+	if err := decodeParams(params, &p); err != nil {
+		return nil, err
+	}
+	if p.Bucket == "" {
+		return nil, errors.New("no S3 bucket specified")
+	}
+
+	creds := credentials.NewChainCredentials([]credentials.Provider{
+		&credentials.EnvAWS{}, &credentials.EnvMinio{}, &credentials.IAM{}})
+	if p.AccessKeyID != "" {
+		creds = credentials.NewStaticV4(
+			p.AccessKeyID, p.SecretAccessKey, p.SessionToken)
+	}
+
+	// The retry count is global to the client library
+	minio.MaxRetry = p.MaxRetries
+
+	client, err := minio.New(p.Endpoint, &minio.Options{
+		Creds:  creds,
+		Secure: !p.Insecure,
+		Region: p.Region,
+	})
+	if err != nil {
+		return nil, errors.Wrapf(
+			err, "failed to create S3 client for %s", p.Endpoint)
+	}
+
+	ctx, cancel := newContext(p.Timeout)
+	defer cancel()
+	exists, err := client.BucketExists(ctx, p.Bucket)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to access bucket %s", p.Bucket)
+	} else if !exists {
+		return nil, errors.Errorf("bucket %s does not exist", p.Bucket)
+	}
+
+	jww.INFO.Printf("Connected to S3 bucket %s at %s.", p.Bucket, p.Endpoint)
+
+	return func(_, baseDir string) (Store, error) {
+		return newS3Store(client, p, baseDir)
+	}, nil
+}
+
+// newS3Store creates a new S3Store for the base directory. The storage
+// directory is not used; all keys are relative to the configured prefix.
+//
+// Returns [NonLocalFileErr] if the base directory is not a valid path element.
+func newS3Store(
+	client *minio.Client, p S3Params, baseDir string) (*S3Store, error) {
+	if err := CheckUsername(baseDir); err != nil {
+		return nil, err
+	}
+	prefix := strings.Trim(path.Clean("/"+p.Prefix), "/")
+	baseKey, err := readyKey(prefix, baseDir)
+	if err != nil {
+		return nil, err
+	}
+
+	return &S3Store{
+		client:   client,
+		bucket:   p.Bucket,
+		baseKey:  baseKey,
+		partSize: p.PartSize,
+		timeout:  p.Timeout,
+	}, nil
+}
+
+// Read reads from the provided file path and returns the data in the file at
+// that path.
+//
+// An error is returned if it fails to read the file. Returns [os.ErrNotExist]
+// if the file does not exist and [NonLocalFileErr] if the file is outside the
+// base path.
+func (s *S3Store) Read(path string) ([]byte, error) {
+	key, err := s.readyKey(path)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := newContext(s.timeout)
+	defer cancel()
+	obj, err := s.client.GetObject(ctx, s.bucket, key, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, s3Error(err)
+	}
+	defer func() { _ = obj.Close() }()
+
+	data, err := io.ReadAll(obj)
+	if err != nil {
+		return nil, s3Error(err)
+	}
+
+	return data, nil
+}
+
+// Write writes the provided data to the file path. Objects larger than the
+// part size are uploaded using a multipart upload.
+//
+// An error is returned if the write fails. Returns [NonLocalFileErr] if the
+// file is outside the base path.
+func (s *S3Store) Write(path string, data []byte) error {
+	key, err := s.readyKey(path)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := newContext(s.timeout)
+	defer cancel()
+	_, err = s.client.PutObject(ctx, s.bucket, key, bytes.NewReader(data),
+		int64(len(data)), minio.PutObjectOptions{
+			ContentType: "application/octet-stream",
+			PartSize:    s.partSize,
+		})
+	if err != nil {
+		return errors.Wrapf(s3Error(err), "failed to put object %s", key)
+	}
+
+	s.mux.Lock()
+	s.lastWritePath = key
+	s.mux.Unlock()
+	return nil
+}
+
+// GetLastModified returns the last modification time for the file at the given
+// file.
+//
+// Returns [os.ErrNotExist] if the file does not exist and [NonLocalFileErr] if
+// the file is outside the base path.
+func (s *S3Store) GetLastModified(path string) (time.Time, error) {
+	key, err := s.readyKey(path)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return s.getLastModified(key)
+}
+
+func (s *S3Store) getLastModified(key string) (time.Time, error) {
+	ctx, cancel := newContext(s.timeout)
+	defer cancel()
+	info, err := s.client.StatObject(
+		ctx, s.bucket, key, minio.StatObjectOptions{})
+	if err != nil {
+		return time.Time{}, s3Error(err)
+	}
+
+	return info.LastModified, nil
+}
+
+// GetLastWrite returns the time of the most recent successful Write operation
+// that was performed.
+func (s *S3Store) GetLastWrite() (time.Time, error) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	if s.lastWritePath == "" {
+		return time.Time{}, os.ErrNotExist
+	}
+	return s.getLastModified(s.lastWritePath)
+}
+
+// ReadDir reads the named directory, returning all its directory entries
+// sorted by filename.
+//
+// Returns [NonLocalFileErr] if the file is outside the base path.
+func (s *S3Store) ReadDir(path string) ([]string, error) {
+	key, err := s.readyKey(path)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := newContext(s.timeout)
+	defer cancel()
+
+	// Listing non-recursively returns each common prefix (directory) as an
+	// object with a trailing slash
+	prefix := key + "/"
+	dirs := make([]string, 0)
+	for obj := range s.client.ListObjects(ctx, s.bucket,
+		minio.ListObjectsOptions{Prefix: prefix}) {
+		if obj.Err != nil {
+			return nil, s3Error(obj.Err)
+		}
+		if strings.HasSuffix(obj.Key, "/") {
+			dirs = append(dirs,
+				strings.TrimSuffix(strings.TrimPrefix(obj.Key, prefix), "/"))
+		}
+	}
+
+	return dirs, nil
+}
+
+// Delete deletes the file at the given path.
+//
+// Returns [os.ErrNotExist] if the file does not exist. Returns
+// [NonLocalFileErr] if the file is outside the base path.
+func (s *S3Store) Delete(path string) error {
+	key, err := s.readyKey(path)
+	if err != nil {
+		return err
+	}
+
+	// Removing an object that does not exist is not an error in S3, so check
+	// for its existence first
+	if _, err = s.getLastModified(key); err != nil {
+		return err
+	}
+
+	ctx, cancel := newContext(s.timeout)
+	defer cancel()
+	err = s.client.RemoveObject(ctx, s.bucket, key, minio.RemoveObjectOptions{})
+	if err != nil {
+		return errors.Wrapf(s3Error(err), "failed to remove object %s", key)
+	}
+
+	return nil
+}
+
+// ListFiles returns the paths of all objects under the base key, relative to
+// it, sorted lexically.
+func (s *S3Store) ListFiles() ([]string, error) {
+	ctx, cancel := newContext(s.timeout)
+	defer cancel()
+
+	prefix := s.baseKey + "/"
+	files := make([]string, 0)
+	for obj := range s.client.ListObjects(ctx, s.bucket,
+		minio.ListObjectsOptions{Prefix: prefix, Recursive: true}) {
+		if obj.Err != nil {
+			return nil, s3Error(obj.Err)
+		}
+		if !strings.HasSuffix(obj.Key, "/") {
+			files = append(files, strings.TrimPrefix(obj.Key, prefix))
+		}
+	}
+	sort.Strings(files)
+
+	return files, nil
+}
+
+// Size returns the total size of all objects under the base key.
+func (s *S3Store) Size() (int64, error) {
+	ctx, cancel := newContext(s.timeout)
+	defer cancel()
+
+	var size int64
+	for obj := range s.client.ListObjects(ctx, s.bucket, minio.ListObjectsOptions{
+		Prefix: s.baseKey + "/", Recursive: true}) {
+		if obj.Err != nil {
+			return 0, s3Error(obj.Err)
+		}
+		size += obj.Size
+	}
+
+	return size, nil
+}
+
+// Ping returns an error if the bucket cannot be reached.
+func (s *S3Store) Ping() error {
+	ctx, cancel := newContext(s.timeout)
+	defer cancel()
+
+	exists, err := s.client.BucketExists(ctx, s.bucket)
+	if err != nil {
+		return errors.Wrapf(err, "failed to access bucket %s", s.bucket)
+	} else if !exists {
+		return errors.Errorf("bucket %s does not exist", s.bucket)
+	}
+	return nil
+}
+
+// readyKey makes the path relative to the base key and ensures it is local.
+// Returns NonLocalFileErr if the file is outside the base key.
+func (s *S3Store) readyKey(p string) (string, error) {
+	return readyKey(s.baseKey, p)
+}
+
+// readyKey joins the path to the base key and ensures the resulting key is
+// within the base key. Object keys always use forward slashes.
+func readyKey(baseKey, p string) (string, error) {
+	key := path.Join(baseKey, p)
+	if key == ".." || strings.HasPrefix(key, "../") {
+		return "", NonLocalFileErr
+	} else if baseKey != "" && key != baseKey &&
+		!strings.HasPrefix(key, baseKey+"/") {
+		return "", NonLocalFileErr
+	}
+	if key == "." {
+		return "", nil
+	}
+	return strings.TrimPrefix(key, "/"), nil
+}
+
+// s3Error converts S3 errors for missing objects into [os.ErrNotExist].
+func s3Error(err error) error {
+	switch minio.ToErrorResponse(err).Code {
+	case "NoSuchKey", "NotFound":
+		return os.ErrNotExist
+	default:
+		return err
+	}
+}
+
+// newContext returns a context that expires after the timeout. If the timeout
+// is zero, the context never expires.
+func newContext(timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout == 0 {
+		return context.WithCancel(context.Background())
+	}
+	return context.WithTimeout(context.Background(), timeout)
+}
@@ -0,0 +1,122 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package store
+
+import (
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/pkg/errors"
+)
+
+// Tests that S3Store adheres to the Store interface.
+var _ Store = (*S3Store)(nil)
+
+// Tests that S3Store adheres to the Lister interface.
+var _ Lister = (*S3Store)(nil)
+
+// Tests that S3Store adheres to the Sizer interface.
+var _ Sizer = (*S3Store)(nil)
+
+// Tests that S3Store adheres to the Pinger interface.
+var _ Pinger = (*S3Store)(nil)
+
+// Tests that newS3Store sets the base key to the user's directory inside the
+// prefix.
+func Test_newS3Store(t *testing.T) {
+	tests := []struct{ prefix, baseDir, expected string }{
+		{"", "user", "user"},
+		{"sync", "user", "sync/user"},
+		{"/sync/", "user", "sync/user"},
+	}
+
+	for i, tt := range tests {
+		s, err := newS3Store(nil, S3Params{Prefix: tt.prefix}, tt.baseDir)
+		if err != nil {
+			t.Errorf("Failed to create S3Store (%d): %+v", i, err)
+		} else if s.baseKey != tt.expected {
+			t.Errorf("Unexpected base key (%d).\nexpected: %s\nreceived: %s",
+				i, tt.expected, s.baseKey)
+		}
+	}
+}
+
+// Error path: Tests that newS3Store returns NonLocalFileErr when the base
+// directory is outside the prefix.
+func Test_newS3Store_NonLocalPathError(t *testing.T) {
+	for _, baseDir := range []string{"..", "../user", "user/../.."} {
+		_, err := newS3Store(nil, S3Params{Prefix: "sync"}, baseDir)
+		if !errors.Is(err, NonLocalFileErr) {
+			t.Errorf("Unexpected error for non-local base directory %q."+
+				"\nexpected: %v\nreceived: %v", baseDir, NonLocalFileErr, err)
+		}
+	}
+}
+
+// Error path: Tests that newS3Backend returns an error when no bucket is
+// specified or when an unknown parameter is set.
+func Test_newS3Backend_InvalidParamsError(t *testing.T) {
+	for i, params := range []map[string]interface{}{
+		{},
+		{"bucket": "bucket", "bukcet": "bucket"},
+	} {
+		if _, err := newS3Backend(params); err == nil {
+			t.Errorf("Failed to get error for invalid params (%d): %v", i, params)
+		}
+	}
+}
+
+// Tests that readyKey joins the path to the base key and returns
+// NonLocalFileErr for keys outside the base key.
+func Test_readyKey(t *testing.T) {
+	tests := []struct {
+		base, path, expected string
+		err                  error
+	}{
+		{"user", "dir/file", "user/dir/file", nil},
+		{"user", "/dir/file", "user/dir/file", nil},
+		{"user", "", "user", nil},
+		{"user", "dir/../file", "user/file", nil},
+		{"user", "../file", "", NonLocalFileErr},
+		{"user", "..", "", NonLocalFileErr},
+		{"", "..", "", NonLocalFileErr},
+		{"", "../user", "", NonLocalFileErr},
+	}
+
+	for i, tt := range tests {
+		key, err := readyKey(tt.base, tt.path)
+		if tt.err == nil {
+			if err != nil {
+				t.Errorf("Failed to ready key %s (%d): %+v", tt.path, i, err)
+			} else if key != tt.expected {
+				t.Errorf("Unexpected key for %s (%d)."+
+					"\nexpected: %s\nreceived: %s", tt.path, i, tt.expected, key)
+			}
+		} else if !errors.Is(err, tt.err) {
+			t.Errorf("Unexpected error for %s (%d).\nexpected: %v\nreceived: %v",
+				tt.path, i, tt.err, err)
+		}
+	}
+}
+
+// Tests that s3Error converts missing object errors to os.ErrNotExist and
+// returns all other errors unchanged.
+func Test_s3Error(t *testing.T) {
+	notFound := minio.ErrorResponse{Code: "NoSuchKey"}
+	if err := s3Error(notFound); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Unexpected error for missing object."+
+			"\nexpected: %v\nreceived: %v", os.ErrNotExist, err)
+	}
+
+	other := minio.ErrorResponse{Code: "AccessDenied"}
+	if err := s3Error(other); !reflect.DeepEqual(other, err) {
+		t.Errorf("Unexpected error.\nexpected: %v\nreceived: %v", other, err)
+	}
+}
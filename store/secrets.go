@@ -0,0 +1,541 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package store
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/minio/minio-go/v7/pkg/credentials"
+	"github.com/mitchellh/mapstructure"
+	"github.com/pkg/errors"
+
+	"gitlab.com/xx_network/primitives/netTime"
+	"gitlab.com/xx_network/primitives/utils"
+)
+
+// SecretPrefix starts the config values that reference a secret, in the form
+// "secret:<path>#<field>", which are replaced by the secret when the config is
+// read.
+const SecretPrefix = "secret:"
+
+// Secrets providers.
+const (
+	SecretsVault             = "vault"
+	SecretsAWSSecretsManager = "awsSecretsManager"
+	SecretsAWSKMS            = "awsKMS"
+)
+
+// Vault authentication methods.
+const (
+	VaultAuthToken      = "token"
+	VaultAuthAppRole    = "approle"
+	VaultAuthKubernetes = "kubernetes"
+)
+
+// Defaults of the secrets parameters.
+const (
+	defaultVaultMount     = "secret"
+	defaultVaultField     = "value"
+	defaultSecretsTimeout = 10 * time.Second
+)
+
+// secretsClient is the HTTP client of the requests to the secrets provider and
+// to AWS KMS. It has its own transport rather than sharing
+// [http.DefaultClient], which has no timeouts of its own and can be changed by
+// any package. Each request is also bounded by the timeout of its context.
+var secretsClient = &http.Client{
+	Transport: http.DefaultTransport.(*http.Transport).Clone(),
+}
+
+// defaultJWTPath is the path of the Kubernetes service account token.
+const defaultJWTPath = "/var/run/secrets/kubernetes.io/serviceaccount/token"
+
+// secretsManagerGetTarget is the AWS Secrets Manager API operation that reads
+// a secret.
+const secretsManagerGetTarget = "secretsmanager.GetSecretValue"
+
+// SecretsParams contains the parameters of the provider that secrets
+// referenced in the config are fetched from. They are set in the "secrets"
+// section of the config.
+type SecretsParams struct {
+	// Provider is "vault" for the KV version 2 secrets engine of HashiCorp
+	// Vault, "awsSecretsManager" for AWS Secrets Manager, or "awsKMS" for
+	// values encrypted with AWS KMS, whose references contain the base64
+	// ciphertext instead of a path.
+	Provider string `mapstructure:"provider"`
+
+	// Address is the URL of the Vault server, such as
+	// "https://vault.example.com:8200". Namespace is its optional Enterprise
+	// namespace, and Mount is the path of the KV engine, "secret" by default.
+	Address   string `mapstructure:"address"`
+	Namespace string `mapstructure:"namespace"`
+	Mount     string `mapstructure:"mount"`
+
+	// AuthMethod is how the server authenticates to Vault: "token" (the
+	// default) with Token or the VAULT_TOKEN environment variable, "approle"
+	// with RoleID and SecretID, or "kubernetes" with Role and the service
+	// account token at JWTPath. AuthMount is the path of the auth method,
+	// which defaults to its name.
+	AuthMethod string `mapstructure:"authMethod"`
+	AuthMount  string `mapstructure:"authMount"`
+	Token      string `mapstructure:"token"`
+	RoleID     string `mapstructure:"roleID"`
+	SecretID   string `mapstructure:"secretID"`
+	Role       string `mapstructure:"role"`
+	JWTPath    string `mapstructure:"jwtPath"`
+
+	// Region is the AWS region of the secrets or KMS key, and Endpoint the URL
+	// or host of the API, which defaults to the AWS endpoint of the region.
+	// KeyID is the optional ID or ARN of the KMS key.
+	Region   string `mapstructure:"region"`
+	Endpoint string `mapstructure:"endpoint"`
+	KeyID    string `mapstructure:"keyID"`
+
+	// AccessKeyID and SecretAccessKey are the static credentials used to
+	// access AWS. If they are not set, credentials are read from the standard
+	// AWS environment variables and, on AWS, from IAM.
+	AccessKeyID     string `mapstructure:"accessKeyID"`
+	SecretAccessKey string `mapstructure:"secretAccessKey"`
+	SessionToken    string `mapstructure:"sessionToken"`
+
+	// Timeout is the maximum duration of each request. Defaults to 10s.
+	Timeout time.Duration `mapstructure:"timeout"`
+}
+
+// Secrets fetches the secrets referenced in the config from a provider. Each
+// secret is fetched once.
+type Secrets struct {
+	params SecretsParams
+
+	// token is the Vault token, obtained on the first fetch.
+	token string
+
+	// fetched are the secrets already fetched, by path.
+	fetched map[string]map[string]string
+}
+
+// NewSecrets creates new Secrets from the parameters. Returns an error for
+// unknown parameters or providers or missing required parameters. Nothing is
+// fetched until a secret is.
+func NewSecrets(params map[string]interface{}) (*Secrets, error) {
+	p := SecretsParams{Timeout: defaultSecretsTimeout}
+	decoder, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{
+		DecodeHook:       mapstructure.StringToTimeDurationHookFunc(),
+		ErrorUnused:      true,
+		WeaklyTypedInput: true,
+		Result:           &p,
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create parameter decoder")
+	}
+	if err = decoder.Decode(params); err != nil {
+		return nil, errors.Wrap(err, "failed to decode secrets parameters")
+	}
+
+	switch p.Provider {
+	case SecretsVault:
+		if p.Address == "" {
+			return nil, errors.New("no Vault address specified")
+		}
+		if p.Mount == "" {
+			p.Mount = defaultVaultMount
+		}
+		if p.AuthMethod == "" {
+			p.AuthMethod = VaultAuthToken
+		}
+		switch p.AuthMethod {
+		case VaultAuthToken:
+		case VaultAuthAppRole:
+			if p.RoleID == "" || p.SecretID == "" {
+				return nil, errors.New(
+					"roleID and secretID are required with approle")
+			}
+		case VaultAuthKubernetes:
+			if p.Role == "" {
+				return nil, errors.New("role is required with kubernetes")
+			}
+			if p.JWTPath == "" {
+				p.JWTPath = defaultJWTPath
+			}
+		default:
+			return nil, errors.Errorf("unknown Vault auth method %q; "+
+				"expected %q, %q, or %q", p.AuthMethod, VaultAuthToken,
+				VaultAuthAppRole, VaultAuthKubernetes)
+		}
+		if p.AuthMount == "" {
+			p.AuthMount = p.AuthMethod
+		}
+	case SecretsAWSSecretsManager, SecretsAWSKMS:
+		if p.Region == "" {
+			return nil, errors.New("no AWS region specified")
+		}
+	default:
+		return nil, errors.Errorf("unknown secrets provider %q; expected "+
+			"%q, %q, or %q", p.Provider, SecretsVault,
+			SecretsAWSSecretsManager, SecretsAWSKMS)
+	}
+	if p.Timeout < 0 {
+		return nil, errors.Errorf("timeout %s cannot be negative", p.Timeout)
+	}
+
+	return &Secrets{
+		params: p, fetched: make(map[string]map[string]string)}, nil
+}
+
+// Params returns the parameters of the secrets.
+func (s *Secrets) Params() SecretsParams {
+	return s.params
+}
+
+// Get returns the secret at the reference, which is a path followed by an
+// optional "#" and field. Vault secrets default to the field "value", and
+// AWS Secrets Manager secrets without a field are returned whole. With AWS
+// KMS, the reference is the base64 ciphertext, which is decrypted.
+func (s *Secrets) Get(ref string) (string, error) {
+	path, field, _ := strings.Cut(ref, "#")
+	if path == "" {
+		return "", errors.Errorf("no path in secret reference %q", ref)
+	}
+
+	if s.params.Provider == SecretsAWSKMS {
+		plaintext, err := kmsDecrypt(KMSParams{
+			CiphertextBlob:  path,
+			KeyID:           s.params.KeyID,
+			Region:          s.params.Region,
+			Endpoint:        s.params.Endpoint,
+			AccessKeyID:     s.params.AccessKeyID,
+			SecretAccessKey: s.params.SecretAccessKey,
+			SessionToken:    s.params.SessionToken,
+			Timeout:         s.params.Timeout,
+		})
+		return string(plaintext), err
+	}
+
+	fields, fetched := s.fetched[path]
+	if !fetched {
+		var err error
+		if s.params.Provider == SecretsVault {
+			fields, err = s.vaultRead(path)
+		} else {
+			fields, err = s.secretsManagerRead(path)
+		}
+		if err != nil {
+			return "", errors.WithMessagef(err, "failed to fetch secret %s",
+				path)
+		}
+		s.fetched[path] = fields
+	}
+
+	if field == "" && s.params.Provider == SecretsVault {
+		field = defaultVaultField
+	}
+	value, exists := fields[field]
+	if !exists {
+		return "", errors.Errorf("secret %s has no field %q", path, field)
+	}
+	return value, nil
+}
+
+// Resolve returns the values of the config that reference secrets, at any
+// depth of its sections and lists, with the secrets in their place. Only the
+// sections that contain references are returned, with only the options that
+// do, and lists are returned whole.
+func (s *Secrets) Resolve(
+	config map[string]interface{}) (map[string]interface{}, error) {
+	return replaceConfig(config, s.replace)
+}
+
+// replace returns the secret referenced by the value and true if it is a
+// reference.
+func (s *Secrets) replace(value string) (string, bool, error) {
+	if !strings.HasPrefix(value, SecretPrefix) {
+		return value, false, nil
+	}
+	secret, err := s.Get(strings.TrimPrefix(value, SecretPrefix))
+	return secret, true, err
+}
+
+// replaceFunc returns the replacement of a string value of the config and true
+// if it is replaced.
+type replaceFunc func(value string) (string, bool, error)
+
+// replaceConfig returns the values of the config, at any depth of its sections
+// and lists, whose strings are replaced by the function. Only the sections
+// that contain replaced strings are returned, with only the options that do,
+// and lists are returned whole.
+func replaceConfig(config map[string]interface{},
+	replace replaceFunc) (map[string]interface{}, error) {
+	replaced := make(map[string]interface{})
+	for key, value := range config {
+		var newValue interface{}
+		var changed bool
+		var err error
+		if section, ok := value.(map[string]interface{}); ok {
+			newValue, err = replaceConfig(section, replace)
+			changed = err == nil && len(newValue.(map[string]interface{})) > 0
+		} else {
+			newValue, changed, err = replaceWhole(value, replace)
+		}
+		if err != nil {
+			return nil, errors.WithMessagef(err, "invalid %s", key)
+		} else if changed {
+			replaced[key] = newValue
+		}
+	}
+	return replaced, nil
+}
+
+// replaceWhole returns a copy of the value with its strings replaced by the
+// function and true if any are replaced. Sections are returned whole.
+func replaceWhole(
+	value interface{}, replace replaceFunc) (interface{}, bool, error) {
+	switch v := value.(type) {
+	case string:
+		return replace(v)
+	case map[string]interface{}:
+		replaced := make(map[string]interface{}, len(v))
+		var anyChanged bool
+		for key, element := range v {
+			newElement, changed, err := replaceWhole(element, replace)
+			if err != nil {
+				return nil, false, errors.WithMessagef(err, "invalid %s", key)
+			}
+			replaced[key] = newElement
+			anyChanged = anyChanged || changed
+		}
+		return replaced, anyChanged, nil
+	case []interface{}:
+		replaced := make([]interface{}, len(v))
+		var anyChanged bool
+		for i, element := range v {
+			newElement, changed, err := replaceWhole(element, replace)
+			if err != nil {
+				return nil, false, err
+			}
+			replaced[i] = newElement
+			anyChanged = anyChanged || changed
+		}
+		return replaced, anyChanged, nil
+	default:
+		return value, false, nil
+	}
+}
+
+// vaultRead returns the fields of the secret at the path of the KV version 2
+// engine, logging in first if there is no token yet.
+func (s *Secrets) vaultRead(path string) (map[string]string, error) {
+	if s.token == "" {
+		token, err := s.vaultLogin()
+		if err != nil {
+			return nil, err
+		}
+		s.token = token
+	}
+
+	var resp struct {
+		Data struct {
+			Data map[string]interface{} `json:"data"`
+		} `json:"data"`
+	}
+	err := s.vaultRequest(http.MethodGet, "/v1/"+s.params.Mount+"/data/"+
+		strings.TrimPrefix(path, "/"), nil, &resp)
+	if err != nil {
+		return nil, err
+	}
+	return stringFields(resp.Data.Data), nil
+}
+
+// vaultLogin returns a Vault token from the auth method.
+func (s *Secrets) vaultLogin() (string, error) {
+	var body interface{}
+	switch s.params.AuthMethod {
+	case VaultAuthToken:
+		token := s.params.Token
+		if token == "" {
+			token = os.Getenv("VAULT_TOKEN")
+		}
+		if token == "" {
+			return "", errors.New("no Vault token specified")
+		}
+		return token, nil
+	case VaultAuthAppRole:
+		body = map[string]string{
+			"role_id": s.params.RoleID, "secret_id": s.params.SecretID}
+	case VaultAuthKubernetes:
+		jwt, err := utils.ReadFile(s.params.JWTPath)
+		if err != nil {
+			return "", errors.Wrapf(err,
+				"failed to read service account token %s", s.params.JWTPath)
+		}
+		body = map[string]string{
+			"role": s.params.Role, "jwt": string(bytes.TrimSpace(jwt))}
+	}
+
+	var resp struct {
+		Auth struct {
+			ClientToken string `json:"client_token"`
+		} `json:"auth"`
+	}
+	err := s.vaultRequest(http.MethodPost,
+		"/v1/auth/"+s.params.AuthMount+"/login", body, &resp)
+	if err != nil {
+		return "", errors.WithMessage(err, "failed to log in to Vault")
+	} else if resp.Auth.ClientToken == "" {
+		return "", errors.New("failed to log in to Vault: no token returned")
+	}
+	return resp.Auth.ClientToken, nil
+}
+
+// vaultRequest sends the request with the JSON body, if not nil, to the Vault
+// API and decodes the JSON response into out.
+func (s *Secrets) vaultRequest(
+	method, path string, body, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+	ctx, cancel := newContext(s.params.Timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, method,
+		strings.TrimSuffix(s.params.Address, "/")+path, reader)
+	if err != nil {
+		return errors.Wrapf(err, "invalid Vault address %s", s.params.Address)
+	}
+	if s.token != "" {
+		req.Header.Set("X-Vault-Token", s.token)
+	}
+	if s.params.Namespace != "" {
+		req.Header.Set("X-Vault-Namespace", s.params.Namespace)
+	}
+
+	resp, err := secretsClient.Do(req)
+	if err != nil {
+		return errors.Wrap(err, "failed to send Vault request")
+	}
+	defer func() { _ = resp.Body.Close() }()
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return errors.Wrap(err, "failed to read Vault response")
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		var vaultErr struct {
+			Errors []string `json:"errors"`
+		}
+		_ = json.Unmarshal(respBody, &vaultErr)
+		return errors.Errorf("Vault request failed (%s): %s",
+			resp.Status, strings.Join(vaultErr.Errors, "; "))
+	}
+	if err = json.Unmarshal(respBody, out); err != nil {
+		return errors.Wrap(err, "failed to decode Vault response")
+	}
+	return nil
+}
+
+// secretsManagerRead returns the secret with the ID from AWS Secrets Manager.
+// The whole secret is returned with no field name and, if it is a JSON object,
+// its fields are returned too.
+func (s *Secrets) secretsManagerRead(id string) (map[string]string, error) {
+	endpoint := s.params.Endpoint
+	if endpoint == "" {
+		endpoint = "secretsmanager." + s.params.Region + ".amazonaws.com"
+	}
+	if !strings.Contains(endpoint, "://") {
+		endpoint = "https://" + endpoint
+	}
+
+	creds := credentials.NewChainCredentials([]credentials.Provider{
+		&credentials.EnvAWS{}, &credentials.IAM{}})
+	if s.params.AccessKeyID != "" {
+		creds = credentials.NewStaticV4(s.params.AccessKeyID,
+			s.params.SecretAccessKey, s.params.SessionToken)
+	}
+	value, err := creds.Get()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get AWS credentials")
+	}
+
+	body, err := json.Marshal(struct {
+		SecretId string `json:"SecretId"`
+	}{id})
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := newContext(s.params.Timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(
+		ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return nil, errors.Wrapf(
+			err, "invalid Secrets Manager endpoint %s", endpoint)
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", secretsManagerGetTarget)
+	signV4(req, body, value, s.params.Region, "secretsmanager", netTime.Now())
+
+	resp, err := secretsClient.Do(req)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to send Secrets Manager request")
+	}
+	defer func() { _ = resp.Body.Close() }()
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read Secrets Manager response")
+	}
+
+	var secret struct {
+		SecretString string `json:"SecretString"`
+		SecretBinary []byte `json:"SecretBinary"`
+		Type         string `json:"__type"`
+		Message      string `json:"message"`
+	}
+	if err = json.Unmarshal(respBody, &secret); err != nil {
+		return nil, errors.Wrapf(err,
+			"failed to decode Secrets Manager response (%s)", resp.Status)
+	} else if resp.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("Secrets Manager request failed (%s): "+
+			"%s: %s", resp.Status, secret.Type, secret.Message)
+	}
+
+	whole := secret.SecretString
+	if secret.SecretBinary != nil {
+		whole = string(secret.SecretBinary)
+	}
+	fields := map[string]string{"": whole}
+	var object map[string]interface{}
+	if json.Unmarshal([]byte(whole), &object) == nil {
+		for key, value := range stringFields(object) {
+			fields[key] = value
+		}
+	}
+	return fields, nil
+}
+
+// stringFields returns the fields of a JSON object as strings. Fields that are
+// not strings are returned in JSON.
+func stringFields(object map[string]interface{}) map[string]string {
+	fields := make(map[string]string, len(object))
+	for key, value := range object {
+		if str, ok := value.(string); ok {
+			fields[key] = str
+		} else if data, err := json.Marshal(value); err == nil {
+			fields[key] = string(data)
+		}
+	}
+	return fields
+}
@@ -0,0 +1,268 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package store
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestVault returns a Vault server that logs in AppRole "role" with secret
+// "secret" and serves the secrets to its token, and a pointer to the number of
+// secrets read.
+func newTestVault(t *testing.T,
+	secrets map[string]map[string]interface{}) (*httptest.Server, *int) {
+	var reads int
+	ts := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/v1/auth/approle/login" {
+				var login map[string]string
+				_ = json.NewDecoder(r.Body).Decode(&login)
+				if login["role_id"] != "role" ||
+					login["secret_id"] != "secret" {
+					w.WriteHeader(http.StatusBadRequest)
+					_, _ = w.Write([]byte(`{"errors":["invalid role"]}`))
+					return
+				}
+				_, _ = w.Write(
+					[]byte(`{"auth":{"client_token":"vault-token"}}`))
+				return
+			}
+
+			data, exists := secrets[strings.TrimPrefix(
+				r.URL.Path, "/v1/secret/data/")]
+			if r.Header.Get("X-Vault-Token") != "vault-token" {
+				w.WriteHeader(http.StatusForbidden)
+				_, _ = w.Write([]byte(`{"errors":["permission denied"]}`))
+				return
+			} else if !exists {
+				w.WriteHeader(http.StatusNotFound)
+				_, _ = w.Write([]byte(`{"errors":[]}`))
+				return
+			}
+			reads++
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{
+				"data": map[string]interface{}{"data": data}})
+		}))
+	t.Cleanup(ts.Close)
+	return ts, &reads
+}
+
+// newTestSecrets returns Secrets with the parameters.
+func newTestSecrets(t *testing.T, params map[string]interface{}) *Secrets {
+	s, err := NewSecrets(params)
+	if err != nil {
+		t.Fatalf("Failed to create secrets: %+v", err)
+	}
+	return s
+}
+
+// Tests that NewSecrets decodes the parameters and defaults the mount, auth
+// mount, and timeout.
+func TestNewSecrets(t *testing.T) {
+	s := newTestSecrets(t, map[string]interface{}{
+		"provider": SecretsVault, "address": "https://vault:8200",
+		"authMethod": VaultAuthAppRole, "roleID": "role", "secretID": "id"})
+	expected := SecretsParams{
+		Provider:   SecretsVault,
+		Address:    "https://vault:8200",
+		Mount:      defaultVaultMount,
+		AuthMethod: VaultAuthAppRole,
+		AuthMount:  VaultAuthAppRole,
+		RoleID:     "role",
+		SecretID:   "id",
+		Timeout:    defaultSecretsTimeout,
+	}
+	if s.Params() != expected {
+		t.Errorf("Unexpected parameters.\nexpected: %+v\nreceived: %+v",
+			expected, s.Params())
+	}
+}
+
+// Error path: Tests that NewSecrets returns an error for unknown parameters,
+// providers, and auth methods and for missing required parameters.
+func TestNewSecrets_Error(t *testing.T) {
+	tests := []map[string]interface{}{
+		{"provider": SecretsVault, "address": "https://vault", "unknown": 1},
+		{"provider": "gcp"},
+		{"provider": SecretsVault},
+		{"provider": SecretsVault, "address": "https://vault",
+			"authMethod": "ldap"},
+		{"provider": SecretsVault, "address": "https://vault",
+			"authMethod": VaultAuthAppRole, "roleID": "role"},
+		{"provider": SecretsVault, "address": "https://vault",
+			"authMethod": VaultAuthKubernetes},
+		{"provider": SecretsAWSSecretsManager},
+		{"provider": SecretsAWSKMS, "region": "us-east-1", "timeout": "-1s"},
+	}
+	for _, params := range tests {
+		if _, err := NewSecrets(params); err == nil {
+			t.Errorf("No error for parameters %+v.", params)
+		}
+	}
+}
+
+// Tests that Secrets.Get logs in to Vault with AppRole and returns the fields
+// of its secrets, fetching each secret once.
+func TestSecrets_Get_Vault(t *testing.T) {
+	ts, reads := newTestVault(t, map[string]map[string]interface{}{
+		"sync/tls": {"key": "PEM", "value": "default", "port": 5432}})
+	s := newTestSecrets(t, map[string]interface{}{
+		"provider": SecretsVault, "address": ts.URL,
+		"authMethod": VaultAuthAppRole, "roleID": "role", "secretID": "secret",
+		"timeout": time.Second})
+
+	for ref, expected := range map[string]string{
+		"sync/tls#key":   "PEM",
+		"sync/tls":       "default",
+		"/sync/tls#port": "5432",
+	} {
+		value, err := s.Get(ref)
+		if err != nil {
+			t.Errorf("Failed to get %s: %+v", ref, err)
+		} else if value != expected {
+			t.Errorf("Unexpected value of %s.\nexpected: %q\nreceived: %q",
+				ref, expected, value)
+		}
+	}
+	if *reads != 2 {
+		t.Errorf("Secrets read %d times; expected once for each path.", *reads)
+	}
+
+	for _, ref := range []string{"sync/tls#missing", "sync/none", "#key"} {
+		if _, err := s.Get(ref); err == nil {
+			t.Errorf("No error for %s.", ref)
+		}
+	}
+}
+
+// Error path: Tests that Secrets.Get returns an error when Vault rejects the
+// login.
+func TestSecrets_Get_VaultLoginError(t *testing.T) {
+	ts, _ := newTestVault(t, nil)
+	s := newTestSecrets(t, map[string]interface{}{
+		"provider": SecretsVault, "address": ts.URL,
+		"authMethod": VaultAuthAppRole, "roleID": "role", "secretID": "wrong"})
+	if _, err := s.Get("sync/tls#key"); err == nil ||
+		!strings.Contains(err.Error(), "invalid role") {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
+
+// Tests that Secrets.Get returns AWS Secrets Manager secrets whole and the
+// fields of those that are JSON objects.
+func TestSecrets_Get_SecretsManager(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			var req struct{ SecretId string }
+			_ = json.NewDecoder(r.Body).Decode(&req)
+			if r.Header.Get("X-Amz-Target") != secretsManagerGetTarget ||
+				!strings.HasPrefix(r.Header.Get("Authorization"),
+					"AWS4-HMAC-SHA256 Credential=id/") {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			secrets := map[string]string{
+				"db":    `{"username":"sync","password":"hunter2"}`,
+				"plain": "just a string",
+			}
+			if _, exists := secrets[req.SecretId]; !exists {
+				w.WriteHeader(http.StatusBadRequest)
+				_, _ = w.Write([]byte(`{"__type":"ResourceNotFoundException"}`))
+				return
+			}
+			_ = json.NewEncoder(w).Encode(
+				map[string]string{"SecretString": secrets[req.SecretId]})
+		}))
+	defer ts.Close()
+	s := newTestSecrets(t, map[string]interface{}{
+		"provider": SecretsAWSSecretsManager, "region": "us-east-1",
+		"endpoint": ts.URL, "accessKeyID": "id", "secretAccessKey": "key"})
+
+	for ref, expected := range map[string]string{
+		"db#password": "hunter2",
+		"db":          `{"username":"sync","password":"hunter2"}`,
+		"plain":       "just a string",
+	} {
+		value, err := s.Get(ref)
+		if err != nil {
+			t.Errorf("Failed to get %s: %+v", ref, err)
+		} else if value != expected {
+			t.Errorf("Unexpected value of %s.\nexpected: %q\nreceived: %q",
+				ref, expected, value)
+		}
+	}
+	if _, err := s.Get("missing"); err == nil ||
+		!strings.Contains(err.Error(), "ResourceNotFoundException") {
+		t.Errorf("Unexpected error for a missing secret: %v", err)
+	}
+}
+
+// Tests that Secrets.Resolve returns only the options of the config that
+// reference secrets, at any depth, with lists returned whole, and leaves the
+// config unchanged.
+func TestSecrets_Resolve(t *testing.T) {
+	ts, _ := newTestVault(t, map[string]map[string]interface{}{
+		"sync/db":  {"dsn": "postgres://sync:hunter2@db/sync"},
+		"sync/key": {"value": "0123"}})
+	s := newTestSecrets(t, map[string]interface{}{
+		"provider": SecretsVault, "address": ts.URL, "token": "vault-token"})
+
+	config := map[string]interface{}{
+		"port": 22841,
+		"storagebackend": map[string]interface{}{
+			"type":   "postgres",
+			"params": map[string]interface{}{"dsn": "secret:sync/db#dsn"},
+		},
+		"encryption": map[string]interface{}{
+			"activekey": "a",
+			"keys": []interface{}{
+				map[string]interface{}{"id": "a", "key": "secret:sync/key"},
+				map[string]interface{}{"id": "b", "path": "b.key"},
+			},
+		},
+		"oidc": map[string]interface{}{"issuer": "https://id.example.com"},
+	}
+	resolved, err := s.Resolve(config)
+	if err != nil {
+		t.Fatalf("Failed to resolve secrets: %+v", err)
+	}
+
+	expected := map[string]interface{}{
+		"storagebackend": map[string]interface{}{
+			"params": map[string]interface{}{
+				"dsn": "postgres://sync:hunter2@db/sync"},
+		},
+		"encryption": map[string]interface{}{
+			"keys": []interface{}{
+				map[string]interface{}{"id": "a", "key": "0123"},
+				map[string]interface{}{"id": "b", "path": "b.key"},
+			},
+		},
+	}
+	if !reflect.DeepEqual(resolved, expected) {
+		t.Errorf("Unexpected resolved config.\nexpected: %+v\nreceived: %+v",
+			expected, resolved)
+	}
+	encryption := config["encryption"].(map[string]interface{})
+	keys := encryption["keys"].([]interface{})
+	key := keys[0].(map[string]interface{})["key"]
+	if key != "secret:sync/key" {
+		t.Errorf("Config changed by resolving its secrets: %v", key)
+	}
+
+	_, err = s.Resolve(map[string]interface{}{"token": "secret:sync/none"})
+	if err == nil {
+		t.Errorf("No error for a missing secret.")
+	}
+}
@@ -0,0 +1,529 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package store
+
+import (
+	"io"
+	"net"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/pkg/sftp"
+	jww "github.com/spf13/jwalterweatherman"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+
+	"gitlab.com/elixxir/remoteSyncServer/storage"
+	"gitlab.com/xx_network/primitives/utils"
+)
+
+// SFTPBackend is the name of the SFTP storage backend.
+const SFTPBackend = "sftp"
+
+// Default values for SFTPParams.
+const (
+	defaultSFTPPoolSize = 4
+	defaultSFTPTimeout  = 10 * time.Second
+)
+
+func init() {
+	storage.RegisterBackend(SFTPBackend, newSFTPBackend)
+}
+
+// SFTPParams contains the parameters used to connect to a remote storage host
+// over SFTP. They are set in the "sftp" section of the config.
+type SFTPParams struct {
+	// Address is the host and port of the SSH server (for example,
+	// "storage.example.com:22").
+	Address string `mapstructure:"address"`
+
+	// Username is the SSH user to log in as.
+	Username string `mapstructure:"username"`
+
+	// KeyPath is the path to the PEM-encoded private key used to authenticate.
+	// KeyPassphrase is used to decrypt the key if it is encrypted.
+	KeyPath       string `mapstructure:"keyPath"`
+	KeyPassphrase string `mapstructure:"keyPassphrase"`
+
+	// KnownHostsPath is the path to a known_hosts file used to verify the host
+	// key of the server. It is required unless InsecureIgnoreHostKey is set.
+	KnownHostsPath string `mapstructure:"knownHostsPath"`
+
+	// InsecureIgnoreHostKey disables verification of the host key. It should
+	// only be used for testing.
+	InsecureIgnoreHostKey bool `mapstructure:"insecureIgnoreHostKey"`
+
+	// Root is the directory on the remote host that contains the directories
+	// of all users.
+	Root string `mapstructure:"root"`
+
+	// PoolSize is the maximum number of open connections to the server.
+	PoolSize int `mapstructure:"poolSize"`
+
+	// Timeout is the maximum amount of time to wait when connecting to the
+	// server.
+	Timeout time.Duration `mapstructure:"timeout"`
+}
+
+// SFTPStore manages the storage for a single user in a directory on a remote
+// host accessed over SFTP. Adheres to the Store interface.
+type SFTPStore struct {
+	pool    *sftpPool
+	baseDir string
+
+	lastWritePath string
+	mux           sync.Mutex
+}
+
+// newSFTPBackend creates a connection pool to the SFTP server described by the
+// parameters and returns a NewStore that creates an SFTPStore for each user.
+func newSFTPBackend(params map[string]interface{}) (NewStore, error) {
+	p := SFTPParams{PoolSize: defaultSFTPPoolSize, Timeout: defaultSFTPTimeout}
+	if err := decodeParams(params, &p); err != nil {
+		return nil, err
+	}
+	if p.Address == "" {
+		return nil, errors.New("no SFTP address specified")
+	} else if p.Root == "" {
+		return nil, errors.New("no SFTP root directory specified")
+	} else if p.PoolSize < 1 {
+		return nil, errors.Errorf("invalid SFTP pool size %d", p.PoolSize)
+	}
+
+	config, err := newSSHClientConfig(p)
+	if err != nil {
+		return nil, err
+	}
+
+	pool := newSFTPPool(p.PoolSize, func() (*sftpConn, error) {
+		return dialSFTP(p.Address, config)
+	})
+
+	// Connect once on startup so that configuration errors are found early
+	root := path.Clean(p.Root)
+	err = pool.do(func(c *sftp.Client) error { return c.MkdirAll(root) })
+	if err != nil {
+		return nil, errors.Wrapf(
+			err, "failed to access SFTP root %s on %s", root, p.Address)
+	}
+
+	jww.INFO.Printf("Connected to SFTP server %s.", p.Address)
+
+	return func(_, baseDir string) (Store, error) {
+		return newSFTPStore(pool, root, baseDir)
+	}, nil
+}
+
+// newSFTPStore creates a new SFTPStore for the base directory inside the
+// remote root directory.
+//
+// Returns [NonLocalFileErr] if the base directory is not a valid path element.
+func newSFTPStore(pool *sftpPool, root, baseDir string) (*SFTPStore, error) {
+	if err := CheckUsername(baseDir); err != nil {
+		return nil, err
+	}
+	return &SFTPStore{pool: pool, baseDir: path.Join(root, baseDir)}, nil
+}
+
+// Read reads from the provided file path and returns the data in the file at
+// that path.
+//
+// An error is returned if it fails to read the file. Returns [os.ErrNotExist]
+// if the file does not exist and [NonLocalFileErr] if the file is outside the
+// base path.
+func (s *SFTPStore) Read(path string) ([]byte, error) {
+	path, err := s.readyPath(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var data []byte
+	err = s.pool.do(func(c *sftp.Client) error {
+		f, err := c.Open(path)
+		if err != nil {
+			return err
+		}
+		defer func() { _ = f.Close() }()
+		data, err = io.ReadAll(f)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return data, nil
+}
+
+// Write writes the provided data to the file path. Any missing parent
+// directories are created.
+//
+// An error is returned if the write fails. Returns [NonLocalFileErr] if the
+// file is outside the base path.
+func (s *SFTPStore) Write(filePath string, data []byte) error {
+	filePath, err := s.readyPath(filePath)
+	if err != nil {
+		return err
+	}
+
+	err = s.pool.do(func(c *sftp.Client) error {
+		if err := c.MkdirAll(path.Dir(filePath)); err != nil {
+			return err
+		}
+		f, err := c.OpenFile(filePath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC)
+		if err != nil {
+			return err
+		}
+		if _, err = f.Write(data); err != nil {
+			_ = f.Close()
+			return err
+		}
+		return f.Close()
+	})
+	if err != nil {
+		return errors.Wrapf(err, "failed to write %s", filePath)
+	}
+
+	s.mux.Lock()
+	s.lastWritePath = filePath
+	s.mux.Unlock()
+	return nil
+}
+
+// GetLastModified returns the last modification time for the file at the given
+// file. SFTP only reports modification times to the second.
+//
+// Returns [os.ErrNotExist] if the file does not exist and [NonLocalFileErr] if
+// the file is outside the base path.
+func (s *SFTPStore) GetLastModified(path string) (time.Time, error) {
+	path, err := s.readyPath(path)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return s.getLastModified(path)
+}
+
+func (s *SFTPStore) getLastModified(path string) (time.Time, error) {
+	var modified time.Time
+	err := s.pool.do(func(c *sftp.Client) error {
+		info, err := c.Stat(path)
+		if err != nil {
+			return err
+		}
+		modified = info.ModTime()
+		return nil
+	})
+	return modified, err
+}
+
+// GetLastWrite returns the time of the most recent successful Write operation
+// that was performed.
+func (s *SFTPStore) GetLastWrite() (time.Time, error) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	if s.lastWritePath == "" {
+		return time.Time{}, os.ErrNotExist
+	}
+	return s.getLastModified(s.lastWritePath)
+}
+
+// ReadDir reads the named directory, returning all its directory entries
+// sorted by filename.
+//
+// Returns [NonLocalFileErr] if the file is outside the base path.
+func (s *SFTPStore) ReadDir(path string) ([]string, error) {
+	path, err := s.readyPath(path)
+	if err != nil {
+		return nil, err
+	}
+
+	dirs := make([]string, 0)
+	err = s.pool.do(func(c *sftp.Client) error {
+		entries, err := c.ReadDir(path)
+		if err != nil {
+			return err
+		}
+		dirs = dirs[:0]
+		for _, entry := range entries {
+			if entry.IsDir() {
+				dirs = append(dirs, entry.Name())
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(dirs)
+
+	return dirs, nil
+}
+
+// Delete deletes the file at the given path.
+//
+// Returns [os.ErrNotExist] if the file does not exist. Returns
+// [NonLocalFileErr] if the file is outside the base path.
+func (s *SFTPStore) Delete(path string) error {
+	path, err := s.readyPath(path)
+	if err != nil {
+		return err
+	}
+
+	return s.pool.do(func(c *sftp.Client) error {
+		if _, err := c.Stat(path); err != nil {
+			return err
+		}
+		return c.Remove(path)
+	})
+}
+
+// ListFiles returns the paths of all files in the base directory, relative to
+// it, sorted lexically.
+func (s *SFTPStore) ListFiles() ([]string, error) {
+	files := make([]string, 0)
+	err := s.pool.do(func(c *sftp.Client) error {
+		files = files[:0]
+		walker := c.Walk(s.baseDir)
+		for walker.Step() {
+			if err := walker.Err(); errors.Is(err, os.ErrNotExist) &&
+				walker.Path() == s.baseDir {
+				return nil
+			} else if err != nil {
+				return err
+			}
+			if !walker.Stat().IsDir() {
+				files = append(files,
+					strings.TrimPrefix(walker.Path(), s.baseDir+"/"))
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to list files in %s", s.baseDir)
+	}
+	sort.Strings(files)
+
+	return files, nil
+}
+
+// Size returns the total size of all files in the base directory.
+func (s *SFTPStore) Size() (int64, error) {
+	var size int64
+	err := s.pool.do(func(c *sftp.Client) error {
+		size = 0
+		walker := c.Walk(s.baseDir)
+		for walker.Step() {
+			if err := walker.Err(); errors.Is(err, os.ErrNotExist) &&
+				walker.Path() == s.baseDir {
+				return nil
+			} else if err != nil {
+				return err
+			}
+			if !walker.Stat().IsDir() {
+				size += walker.Stat().Size()
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, errors.Wrapf(err, "failed to size files in %s", s.baseDir)
+	}
+
+	return size, nil
+}
+
+// Ping returns an error if the root directory on the SFTP server cannot be
+// reached. The base directory itself is only created on the first write.
+func (s *SFTPStore) Ping() error {
+	root := path.Dir(s.baseDir)
+	err := s.pool.do(func(c *sftp.Client) error {
+		_, err := c.Stat(root)
+		return err
+	})
+	if err != nil {
+		return errors.Wrapf(err, "failed to access %s", root)
+	}
+	return nil
+}
+
+// readyPath makes the path relative to the base directory and ensures it is
+// local. Returns NonLocalFileErr if the file is outside the base path.
+func (s *SFTPStore) readyPath(p string) (string, error) {
+	key, err := readyKey("", p)
+	if err != nil {
+		return "", err
+	}
+	return path.Join(s.baseDir, key), nil
+}
+
+// newSSHClientConfig returns the SSH client config for the parameters. The
+// private key is used for authentication and the host key is verified against
+// the known hosts file.
+func newSSHClientConfig(p SFTPParams) (*ssh.ClientConfig, error) {
+	if p.KeyPath == "" {
+		return nil, errors.New("no SFTP private key specified")
+	}
+	keyPEM, err := utils.ReadFile(p.KeyPath)
+	if err != nil {
+		return nil, errors.Wrapf(
+			err, "failed to read SFTP private key %s", p.KeyPath)
+	}
+	var signer ssh.Signer
+	if p.KeyPassphrase != "" {
+		signer, err = ssh.ParsePrivateKeyWithPassphrase(
+			keyPEM, []byte(p.KeyPassphrase))
+	} else {
+		signer, err = ssh.ParsePrivateKey(keyPEM)
+	}
+	if err != nil {
+		return nil, errors.Wrapf(
+			err, "failed to parse SFTP private key %s", p.KeyPath)
+	}
+
+	var hostKeyCallback ssh.HostKeyCallback
+	if p.InsecureIgnoreHostKey {
+		jww.WARN.Printf("SFTP host key verification is disabled.")
+		hostKeyCallback = ssh.InsecureIgnoreHostKey()
+	} else if p.KnownHostsPath == "" {
+		return nil, errors.New("no SFTP known hosts file specified")
+	} else {
+		knownHostsPath, err := utils.ExpandPath(p.KnownHostsPath)
+		if err != nil {
+			return nil, errors.Wrapf(
+				err, "unable to expand path %s", p.KnownHostsPath)
+		}
+		hostKeyCallback, err = knownhosts.New(knownHostsPath)
+		if err != nil {
+			return nil, errors.Wrapf(
+				err, "failed to read known hosts %s", knownHostsPath)
+		}
+	}
+
+	return &ssh.ClientConfig{
+		User:            p.Username,
+		Auth:            []ssh.AuthMethod{ssh.PublicKeys(signer)},
+		HostKeyCallback: hostKeyCallback,
+		Timeout:         p.Timeout,
+	}, nil
+}
+
+// dialSFTP opens a new SSH connection to the address and starts an SFTP
+// session on it.
+func dialSFTP(address string, config *ssh.ClientConfig) (*sftpConn, error) {
+	sshClient, err := ssh.Dial("tcp", address, config)
+	if err != nil {
+		return nil, err
+	}
+	client, err := sftp.NewClient(sshClient)
+	if err != nil {
+		_ = sshClient.Close()
+		return nil, err
+	}
+	return newSFTPConn(client, sshClient), nil
+}
+
+// sftpConn is a single SFTP session in an sftpPool.
+type sftpConn struct {
+	client *sftp.Client
+
+	// transport is the underlying connection, closed with the session.
+	transport io.Closer
+
+	// lost is closed when the session has shut down.
+	lost chan struct{}
+}
+
+// newSFTPConn wraps the client and monitors it for a lost connection.
+func newSFTPConn(client *sftp.Client, transport io.Closer) *sftpConn {
+	c := &sftpConn{client: client, transport: transport,
+		lost: make(chan struct{})}
+	go func() {
+		_ = client.Wait()
+		close(c.lost)
+	}()
+	return c
+}
+
+// isLost returns true if the session has shut down.
+func (c *sftpConn) isLost() bool {
+	select {
+	case <-c.lost:
+		return true
+	default:
+		return false
+	}
+}
+
+// close closes the session and its transport.
+func (c *sftpConn) close() {
+	_ = c.client.Close()
+	if c.transport != nil {
+		_ = c.transport.Close()
+	}
+}
+
+// isConnectionLost returns true if the error was caused by the connection to
+// the SFTP server closing.
+func isConnectionLost(err error) bool {
+	return errors.Is(err, sftp.ErrSSHFxConnectionLost) ||
+		errors.Is(err, io.EOF) || errors.Is(err, io.ErrClosedPipe) ||
+		errors.Is(err, net.ErrClosed)
+}
+
+// sftpPool is a fixed-size pool of SFTP sessions. Sessions are opened when
+// first needed and reopened when their connection is lost.
+type sftpPool struct {
+	dial func() (*sftpConn, error)
+
+	// slots contains one entry for each session in the pool. An entry is nil
+	// if its session has not been opened.
+	slots chan *sftpConn
+}
+
+// newSFTPPool creates a new pool with up to size sessions opened with dial.
+func newSFTPPool(size int, dial func() (*sftpConn, error)) *sftpPool {
+	p := &sftpPool{dial: dial, slots: make(chan *sftpConn, size)}
+	for i := 0; i < size; i++ {
+		p.slots <- nil
+	}
+	return p
+}
+
+// do runs fn with a session from the pool, blocking until one is available. If
+// the connection is lost while running fn, the session is reopened and fn is
+// retried once.
+func (p *sftpPool) do(fn func(c *sftp.Client) error) error {
+	c := <-p.slots
+	defer func() { p.slots <- c }()
+
+	for retried := false; ; retried = true {
+		if c == nil || c.isLost() {
+			if c != nil {
+				c.close()
+			}
+			var err error
+			if c, err = p.dial(); err != nil {
+				c = nil
+				return errors.Wrap(err, "failed to connect to SFTP server")
+			}
+		}
+
+		err := fn(c.client)
+		if retried || !isConnectionLost(err) {
+			return err
+		}
+
+		jww.WARN.Printf("SFTP connection lost; reconnecting.")
+		c.close()
+		c = nil
+	}
+}
@@ -0,0 +1,233 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package store
+
+import (
+	"bytes"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/pkg/sftp"
+)
+
+// Tests that SFTPStore adheres to the Store interface.
+var _ Store = (*SFTPStore)(nil)
+
+// Tests that SFTPStore adheres to the Lister interface.
+var _ Lister = (*SFTPStore)(nil)
+
+// Tests that SFTPStore adheres to the Sizer interface.
+var _ Sizer = (*SFTPStore)(nil)
+
+// Tests that SFTPStore adheres to the Pinger interface.
+var _ Pinger = (*SFTPStore)(nil)
+
+// Tests that all the files written by SFTPStore.Write can be read by
+// SFTPStore.Read, listed by SFTPStore.ReadDir and SFTPStore.ListFiles, counted
+// by SFTPStore.Size, and deleted by SFTPStore.Delete, and that they are stored in the user's directory
+// in the root.
+func TestSFTPStore(t *testing.T) {
+	root := t.TempDir()
+	pool, _ := newTestSFTPPool(t, 2)
+	s, err := newSFTPStore(pool, filepath.ToSlash(root), "waldo")
+	if err != nil {
+		t.Fatalf("Failed to create SFTPStore: %+v", err)
+	}
+
+	testFiles := map[string][]byte{
+		"hello.txt":            []byte("hello"),
+		"dir1/a.txt":           []byte("a"),
+		"dir1/dirA/b.txt":      []byte("b"),
+		"dir2/dirC/dirD/e.txt": []byte("e"),
+	}
+
+	start := time.Now().Truncate(time.Second)
+	for path, data := range testFiles {
+		if err = s.Write(path, data); err != nil {
+			t.Errorf("Failed to write %s: %+v", path, err)
+		}
+	}
+
+	for path, expected := range testFiles {
+		if data, err2 := s.Read(path); err2 != nil {
+			t.Errorf("Failed to read %s: %+v", path, err2)
+		} else if !bytes.Equal(expected, data) {
+			t.Errorf("Read unexpected data for path %s."+
+				"\nexpected: %q\nreceived: %q", path, expected, data)
+		}
+
+		onDisk, err2 := os.ReadFile(filepath.Join(root, "waldo", path))
+		if err2 != nil || !bytes.Equal(expected, onDisk) {
+			t.Errorf("File %s not in user directory: %v", path, err2)
+		}
+
+		if modified, err2 := s.GetLastModified(path); err2 != nil {
+			t.Errorf("Failed to get last modified for %s: %+v", path, err2)
+		} else if modified.Before(start) {
+			t.Errorf("Last modified for %s too early: %s", path, modified)
+		}
+	}
+
+	if _, err = s.GetLastWrite(); err != nil {
+		t.Errorf("Failed to get last write: %+v", err)
+	}
+
+	dirTests := map[string][]string{
+		"":          {"dir1", "dir2"},
+		"dir1":      {"dirA"},
+		"dir2/dirC": {"dirD"},
+	}
+	for path, expected := range dirTests {
+		if dirs, err2 := s.ReadDir(path); err2 != nil {
+			t.Errorf("Failed to read directory %s: %+v", path, err2)
+		} else if !reflect.DeepEqual(expected, dirs) {
+			t.Errorf("Unexpected directories for %q."+
+				"\nexpected: %s\nreceived: %s", path, expected, dirs)
+		}
+	}
+
+	expectedFiles := []string{
+		"dir1/a.txt", "dir1/dirA/b.txt", "dir2/dirC/dirD/e.txt", "hello.txt"}
+	if files, err2 := s.ListFiles(); err2 != nil {
+		t.Errorf("Failed to list files: %+v", err2)
+	} else if !reflect.DeepEqual(expectedFiles, files) {
+		t.Errorf("Unexpected files.\nexpected: %s\nreceived: %s",
+			expectedFiles, files)
+	}
+	if size, err2 := s.Size(); err2 != nil {
+		t.Errorf("Failed to get size: %+v", err2)
+	} else if size != 8 {
+		t.Errorf("Unexpected size.\nexpected: %d\nreceived: %d", 8, size)
+	}
+	if err = s.Ping(); err != nil {
+		t.Errorf("Failed to ping SFTP server: %+v", err)
+	}
+
+	if err = s.Delete("hello.txt"); err != nil {
+		t.Errorf("Failed to delete file: %+v", err)
+	}
+	if _, err = s.Read("hello.txt"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Unexpected error reading deleted file."+
+			"\nexpected: %v\nreceived: %v", os.ErrNotExist, err)
+	}
+	if err = s.Delete("hello.txt"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Unexpected error deleting missing file."+
+			"\nexpected: %v\nreceived: %v", os.ErrNotExist, err)
+	}
+}
+
+// Error path: Tests that SFTPStore returns NonLocalFileErr for paths outside
+// the user's directory and newSFTPStore returns it for invalid usernames.
+func TestSFTPStore_NonLocalFileError(t *testing.T) {
+	pool, _ := newTestSFTPPool(t, 1)
+	if _, err := newSFTPStore(pool, "/", "../waldo"); !errors.Is(err, NonLocalFileErr) {
+		t.Errorf("Unexpected error for invalid username."+
+			"\nexpected: %v\nreceived: %v", NonLocalFileErr, err)
+	}
+
+	s, _ := newSFTPStore(pool, t.TempDir(), "waldo")
+	if _, err := s.Read("../carmen/file"); !errors.Is(err, NonLocalFileErr) {
+		t.Errorf("Unexpected error for Read.\nexpected: %v\nreceived: %v",
+			NonLocalFileErr, err)
+	}
+	if err := s.Write("../carmen/file", nil); !errors.Is(err, NonLocalFileErr) {
+		t.Errorf("Unexpected error for Write.\nexpected: %v\nreceived: %v",
+			NonLocalFileErr, err)
+	}
+}
+
+// Tests that sftpPool reopens a session when its connection is lost.
+func Test_sftpPool_Reconnect(t *testing.T) {
+	pool, servers := newTestSFTPPool(t, 1)
+	stat := func(c *sftp.Client) error {
+		_, err := c.Stat("/")
+		return err
+	}
+
+	if err := pool.do(stat); err != nil {
+		t.Fatalf("Failed to run operation: %+v", err)
+	}
+
+	// Drop the connection from the server side
+	_ = servers.get(0).Close()
+
+	if err := pool.do(stat); err != nil {
+		t.Errorf("Failed to run operation after connection lost: %+v", err)
+	}
+	if n := servers.len(); n != 2 {
+		t.Errorf("Unexpected number of connections.\nexpected: %d\nreceived: %d",
+			2, n)
+	}
+}
+
+// Error path: Tests that newSFTPBackend returns an error for missing or
+// invalid parameters.
+func Test_newSFTPBackend_InvalidParamsError(t *testing.T) {
+	for i, params := range []map[string]interface{}{
+		{},
+		{"address": "localhost:22"},
+		{"address": "localhost:22", "root": "/srv", "poolSize": 0},
+		{"address": "localhost:22", "root": "/srv", "host": "localhost"},
+		{"address": "localhost:22", "root": "/srv", "keyPath": "no-such-key"},
+	} {
+		if _, err := newSFTPBackend(params); err == nil {
+			t.Errorf("Failed to get error for invalid params (%d): %v", i, params)
+		}
+	}
+}
+
+// testSFTPServers records the server side of each connection opened by a test
+// pool.
+type testSFTPServers struct {
+	conns []net.Conn
+	mux   sync.Mutex
+}
+
+func (s *testSFTPServers) get(i int) net.Conn {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	return s.conns[i]
+}
+
+func (s *testSFTPServers) len() int {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	return len(s.conns)
+}
+
+// newTestSFTPPool creates an sftpPool where each session is connected over an
+// in-process pipe to an SFTP server serving the local file system.
+func newTestSFTPPool(t testing.TB, size int) (*sftpPool, *testSFTPServers) {
+	servers := &testSFTPServers{}
+	pool := newSFTPPool(size, func() (*sftpConn, error) {
+		clientConn, serverConn := net.Pipe()
+		server, err := sftp.NewServer(serverConn)
+		if err != nil {
+			return nil, err
+		}
+		go func() { _ = server.Serve() }()
+
+		servers.mux.Lock()
+		servers.conns = append(servers.conns, serverConn)
+		servers.mux.Unlock()
+		t.Cleanup(func() { _ = serverConn.Close() })
+
+		client, err := sftp.NewClientPipe(clientConn, clientConn)
+		if err != nil {
+			return nil, err
+		}
+		return newSFTPConn(client, clientConn), nil
+	})
+	return pool, servers
+}
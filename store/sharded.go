@@ -0,0 +1,338 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package store
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"os"
+	"sort"
+	"strconv"
+
+	"github.com/pkg/errors"
+	jww "github.com/spf13/jwalterweatherman"
+
+	"gitlab.com/elixxir/remoteSyncServer/storage"
+	"gitlab.com/xx_network/primitives/utils"
+)
+
+// ShardedBackend is the name of the storage backend that shards users across
+// other backends.
+const ShardedBackend = "sharded"
+
+// defaultShardVirtualNodes is the default value of
+// ShardedParams.VirtualNodes.
+const defaultShardVirtualNodes = 128
+
+func init() {
+	storage.RegisterBackend(ShardedBackend, newShardedBackend)
+}
+
+// ShardedParams contains the parameters of the sharded backend. They are set
+// in the "sharded" section of the config.
+type ShardedParams struct {
+	// Shards are the storage backends that users are sharded across.
+	Shards []ShardParams `mapstructure:"shards"`
+
+	// VirtualNodes is the number of points on the hash ring of each shard
+	// per unit of weight. More points spread users more evenly. Defaults to
+	// 128.
+	VirtualNodes int `mapstructure:"virtualNodes"`
+}
+
+// ShardParams describes a shard of the sharded backend.
+type ShardParams struct {
+	// Name identifies the shard on the hash ring. Users are placed by the
+	// names of the shards, so renaming a shard moves users to other shards.
+	Name string `mapstructure:"name"`
+
+	// Backend is the name of the storage backend of the shard, which cannot
+	// be the sharded backend.
+	Backend string `mapstructure:"backend"`
+
+	// Params are the backend-specific parameters of the shard.
+	Params map[string]interface{} `mapstructure:"params"`
+
+	// StorageDir is the storage directory of the shard, such as the mount
+	// point of a disk for the "file" backend. Defaults to the storage
+	// directory of the server.
+	StorageDir string `mapstructure:"storageDir"`
+
+	// Weight is the share of users placed on the shard relative to the other
+	// shards. Defaults to 1.
+	Weight int `mapstructure:"weight"`
+}
+
+// Shards places each user on one of several storage backends with consistent
+// hashing of their username, so that adding or removing a shard only moves
+// the users of the shards next to it on the hash ring.
+type Shards struct {
+	shards []*Shard
+	ring   []ringPoint
+}
+
+// Shard is a storage backend of Shards.
+type Shard struct {
+	params   ShardParams
+	newStore NewStore
+}
+
+// ringPoint is a point of a shard on the hash ring.
+type ringPoint struct {
+	hash  uint64
+	shard *Shard
+}
+
+// newShardedBackend opens the shards described by the parameters and returns
+// a NewStore that creates the Store of each user on their shard.
+func newShardedBackend(params map[string]interface{}) (NewStore, error) {
+	s, err := OpenShards(params)
+	if err != nil {
+		return nil, err
+	}
+	return s.NewStore, nil
+}
+
+// OpenShards initialises the storage backend of each shard described by the
+// parameters and builds the hash ring.
+func OpenShards(params map[string]interface{}) (*Shards, error) {
+	p := ShardedParams{VirtualNodes: defaultShardVirtualNodes}
+	if err := decodeParams(params, &p); err != nil {
+		return nil, err
+	} else if len(p.Shards) == 0 {
+		return nil, errors.New("no shards specified")
+	} else if p.VirtualNodes < 1 {
+		return nil, errors.Errorf(
+			"invalid number of virtual nodes %d", p.VirtualNodes)
+	}
+
+	s := &Shards{shards: make([]*Shard, 0, len(p.Shards))}
+	names := make(map[string]bool, len(p.Shards))
+	for i, sp := range p.Shards {
+		if sp.Name == "" {
+			return nil, errors.Errorf("shard %d has no name", i)
+		} else if names[sp.Name] {
+			return nil, errors.Errorf("duplicate shard %q", sp.Name)
+		} else if sp.Backend == ShardedBackend {
+			return nil, errors.Errorf(
+				"shard %q cannot use the %q backend", sp.Name, sp.Backend)
+		} else if sp.Weight < 0 {
+			return nil, errors.Errorf(
+				"invalid weight %d of shard %q", sp.Weight, sp.Name)
+		}
+		names[sp.Name] = true
+		if sp.Weight == 0 {
+			sp.Weight = 1
+		}
+		var err error
+		if sp.StorageDir != "" {
+			sp.StorageDir, err = utils.ExpandPath(sp.StorageDir)
+			if err != nil {
+				return nil, errors.Wrapf(
+					err, "invalid storage directory of shard %q", sp.Name)
+			}
+		}
+
+		backend, err := storage.GetBackend(sp.Backend)
+		if err != nil {
+			return nil, errors.WithMessagef(err, "shard %q", sp.Name)
+		}
+		newStore, err := backend(sp.Params)
+		if err != nil {
+			return nil, errors.WithMessagef(
+				err, "failed to initialise shard %q", sp.Name)
+		}
+		shard := &Shard{params: sp, newStore: newStore}
+		s.shards = append(s.shards, shard)
+
+		for j := 0; j < sp.Weight*p.VirtualNodes; j++ {
+			s.ring = append(s.ring, ringPoint{
+				hash: shardHash(sp.Name + "#" + strconv.Itoa(j)), shard: shard})
+		}
+	}
+	sort.Slice(s.ring, func(i, j int) bool {
+		return s.ring[i].hash < s.ring[j].hash
+	})
+
+	jww.INFO.Printf("Sharding users across %d storage backends.",
+		len(s.shards))
+	return s, nil
+}
+
+// Shards returns the shards in the order they are configured.
+func (s *Shards) Shards() []*Shard {
+	return s.shards
+}
+
+// Locate returns the shard that the user is placed on: the shard of the first
+// point on the hash ring at or after the hash of the username.
+func (s *Shards) Locate(username string) *Shard {
+	hash := shardHash(username)
+	i := sort.Search(len(s.ring), func(i int) bool {
+		return s.ring[i].hash >= hash
+	})
+	if i == len(s.ring) {
+		i = 0
+	}
+	return s.ring[i].shard
+}
+
+// NewStore creates the Store of the user on the shard they are placed on.
+// Adheres to the NewStore type.
+func (s *Shards) NewStore(storageDir, baseDir string) (Store, error) {
+	if err := CheckUsername(baseDir); err != nil {
+		return nil, err
+	}
+	return s.Locate(baseDir).Store(storageDir, baseDir)
+}
+
+// Misplaced returns the shards, other than the one the user is placed on, that
+// hold files of the user, such as after a shard was added.
+func (s *Shards) Misplaced(storageDir, username string) ([]*Shard, error) {
+	target := s.Locate(username)
+	var misplaced []*Shard
+	for _, shard := range s.shards {
+		if shard == target {
+			continue
+		}
+		files, err := shard.listFiles(storageDir, username)
+		if err != nil {
+			return nil, err
+		} else if len(files) > 0 {
+			misplaced = append(misplaced, shard)
+		}
+	}
+	return misplaced, nil
+}
+
+// Rebalance moves the files of the user from the other shards to the shard
+// they are placed on. Each file is read back from its new shard and its
+// SHA-256 checksum compared to the original before the original is deleted.
+// Files that already exist on the new shard are kept and their original
+// deleted, so an interrupted rebalance is resumed by rerunning it. The files
+// are moved as stored, including previous versions and deduplicated data.
+//
+// Returns [NotListableErr] if a shard cannot list its files and
+// [ChecksumMismatchErr] if a copy does not match its original.
+func (s *Shards) Rebalance(
+	storageDir, username string) (MigrationStats, error) {
+	var stats MigrationStats
+	misplaced, err := s.Misplaced(storageDir, username)
+	if err != nil || len(misplaced) == 0 {
+		return stats, err
+	}
+	target := s.Locate(username)
+	dst, err := target.Store(storageDir, username)
+	if err != nil {
+		return stats, err
+	}
+
+	for _, shard := range misplaced {
+		src, err := shard.Store(storageDir, username)
+		if err != nil {
+			return stats, err
+		}
+		files, err := shard.listFiles(storageDir, username)
+		if err != nil {
+			return stats, err
+		}
+		for _, path := range files {
+			moved, n, err := moveFile(src, dst, path)
+			if err != nil {
+				return stats, errors.WithMessagef(err, "shard %q to %q",
+					shard.Name(), target.Name())
+			} else if moved {
+				stats.Copied++
+				stats.Bytes += n
+			} else {
+				stats.Skipped++
+			}
+		}
+	}
+	return stats, nil
+}
+
+// moveFile copies the file at the path from src to dst, verifies the copy, and
+// deletes it from src. Returns false if the file already exists in dst, in
+// which case it is only deleted from src.
+func moveFile(src, dst Store, path string) (bool, int64, error) {
+	_, err := dst.GetLastModified(path)
+	exists := err == nil
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return false, 0, errors.Wrapf(err, "failed to check %s", path)
+	}
+
+	var n int64
+	if !exists {
+		data, err := src.Read(path)
+		if err != nil {
+			return false, 0, errors.Wrapf(err, "failed to read %s", path)
+		}
+		checksum := sha256.Sum256(data)
+		if err = dst.Write(path, data); err != nil {
+			return false, 0, errors.Wrapf(err, "failed to write %s", path)
+		}
+		copied, err := dst.Read(path)
+		if err != nil {
+			return false, 0, errors.Wrapf(err, "failed to read back %s", path)
+		}
+		if copiedChecksum := sha256.Sum256(copied); !bytes.Equal(
+			checksum[:], copiedChecksum[:]) {
+			return false, 0, errors.Wrapf(ChecksumMismatchErr, "%s: %x != %x",
+				path, copiedChecksum, checksum)
+		}
+		n = int64(len(data))
+	}
+
+	if err = src.Delete(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return false, 0, errors.Wrapf(err, "failed to delete %s", path)
+	}
+	return !exists, n, nil
+}
+
+// Name returns the name of the shard.
+func (sh *Shard) Name() string {
+	return sh.params.Name
+}
+
+// Backend returns the name of the storage backend of the shard.
+func (sh *Shard) Backend() string {
+	return sh.params.Backend
+}
+
+// Store creates the Store of the user on the shard. The storage directory of
+// the shard is used instead of storageDir if it is set.
+func (sh *Shard) Store(storageDir, username string) (Store, error) {
+	if sh.params.StorageDir != "" {
+		storageDir = sh.params.StorageDir
+	}
+	return sh.newStore(storageDir, username)
+}
+
+// listFiles returns the paths of all files of the user on the shard.
+//
+// Returns [NotListableErr] if the store of the shard does not implement
+// [Lister].
+func (sh *Shard) listFiles(storageDir, username string) ([]string, error) {
+	st, err := sh.Store(storageDir, username)
+	if err != nil {
+		return nil, err
+	}
+	lister, ok := st.(Lister)
+	if !ok {
+		return nil, errors.WithMessagef(NotListableErr, "shard %q", sh.Name())
+	}
+	return lister.ListFiles()
+}
+
+// shardHash returns the position of the key on the hash ring.
+func shardHash(key string) uint64 {
+	sum := sha256.Sum256([]byte(key))
+	return binary.BigEndian.Uint64(sum[:8])
+}
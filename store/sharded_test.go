@@ -0,0 +1,177 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package store
+
+import (
+	"os"
+	"reflect"
+	"strconv"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+// Tests that OpenShards opens each shard and places users on every shard in
+// proportion to their weight.
+func TestOpenShards(t *testing.T) {
+	s := newTestShards(t, "a", "b", "c")
+	if len(s.Shards()) != 3 {
+		t.Fatalf("Unexpected number of shards: %d", len(s.Shards()))
+	}
+
+	counts := make(map[string]int)
+	for i := 0; i < 3000; i++ {
+		counts[s.Locate("user"+strconv.Itoa(i)).Name()]++
+	}
+	for _, name := range []string{"a", "b", "c"} {
+		if counts[name] < 700 || counts[name] > 1300 {
+			t.Errorf("Unbalanced shard %q with %d of 3000 users: %v",
+				name, counts[name], counts)
+		}
+	}
+}
+
+// Error path: Tests that OpenShards returns an error for invalid parameters.
+func TestOpenShards_Error(t *testing.T) {
+	shard := map[string]interface{}{"name": "a", "backend": MemoryBackend}
+	for _, params := range []map[string]interface{}{
+		{},
+		{"shards": []interface{}{shard}, "virtualNodes": 0},
+		{"shards": []interface{}{shard, shard}},
+		{"shards": []interface{}{map[string]interface{}{
+			"backend": MemoryBackend}}},
+		{"shards": []interface{}{map[string]interface{}{
+			"name": "a", "backend": ShardedBackend}}},
+		{"shards": []interface{}{map[string]interface{}{
+			"name": "a", "backend": "unknown"}}},
+		{"shards": []interface{}{map[string]interface{}{
+			"name": "a", "backend": MemoryBackend, "weight": -1}}},
+		{"shards": []interface{}{map[string]interface{}{
+			"name": "a", "backend": MemoryBackend,
+			"params": map[string]interface{}{"unknown": 1}}}},
+	} {
+		if _, err := OpenShards(params); err == nil {
+			t.Errorf("Failed to get error for params %v.", params)
+		}
+	}
+}
+
+// Tests that adding a shard only moves users to the new shard.
+func TestShards_Locate_AddShard(t *testing.T) {
+	before := newTestShards(t, "a", "b")
+	after := newTestShards(t, "a", "b", "c")
+
+	var moved int
+	for i := 0; i < 1000; i++ {
+		username := "user" + strconv.Itoa(i)
+		from, to := before.Locate(username), after.Locate(username)
+		if from.Name() != to.Name() {
+			moved++
+			if to.Name() != "c" {
+				t.Errorf("User %q moved from %q to %q instead of the new "+
+					"shard.", username, from.Name(), to.Name())
+			}
+		}
+	}
+	if moved == 0 || moved > 500 {
+		t.Errorf("%d of 1000 users moved.", moved)
+	}
+}
+
+// Tests that Shards.NewStore returns the store of the user on their shard.
+func TestShards_NewStore(t *testing.T) {
+	s := newTestShards(t, "a", "b")
+	st, err := s.NewStore("", "waldo")
+	if err != nil {
+		t.Fatalf("Failed to create store: %+v", err)
+	}
+	if err = st.Write("file", []byte("data")); err != nil {
+		t.Fatalf("Failed to write: %+v", err)
+	}
+
+	for _, shard := range s.Shards() {
+		files, err := shard.listFiles("", "waldo")
+		if err != nil {
+			t.Fatalf("Failed to list files of shard %q: %+v",
+				shard.Name(), err)
+		}
+		if shard == s.Locate("waldo") && len(files) != 1 {
+			t.Errorf("File not written to shard %q: %v", shard.Name(), files)
+		} else if shard != s.Locate("waldo") && len(files) != 0 {
+			t.Errorf("File written to shard %q: %v", shard.Name(), files)
+		}
+	}
+
+	if _, err = s.NewStore("", "../waldo"); !errors.Is(err, NonLocalFileErr) {
+		t.Errorf("Unexpected error for invalid username: %+v", err)
+	}
+}
+
+// Tests that Shards.Rebalance moves the files of the user to their shard and
+// keeps the files already there.
+func TestShards_Rebalance(t *testing.T) {
+	s := newTestShards(t, "a", "b")
+	target := s.Locate("waldo")
+	other := s.Shards()[0]
+	if other == target {
+		other = s.Shards()[1]
+	}
+	src, _ := other.Store("", "waldo")
+	dst, _ := target.Store("", "waldo")
+	files := map[string]string{"a": "old", "b": "bb", "c/d": "d"}
+	for path, data := range files {
+		if err := src.Write(path, []byte(data)); err != nil {
+			t.Fatalf("Failed to write %s: %+v", path, err)
+		}
+	}
+	if err := dst.Write("a", []byte("new")); err != nil {
+		t.Fatalf("Failed to write: %+v", err)
+	}
+
+	misplaced, err := s.Misplaced("", "waldo")
+	if err != nil || !reflect.DeepEqual([]*Shard{other}, misplaced) {
+		t.Errorf("Unexpected misplaced shards: %v (%v)", misplaced, err)
+	}
+	stats, err := s.Rebalance("", "waldo")
+	if err != nil {
+		t.Fatalf("Failed to rebalance: %+v", err)
+	}
+	expected := MigrationStats{Copied: 2, Skipped: 1, Bytes: 3}
+	if stats != expected {
+		t.Errorf("Unexpected stats.\nexpected: %+v\nreceived: %+v",
+			expected, stats)
+	}
+
+	files["a"] = "new"
+	for path, data := range files {
+		if read, err := dst.Read(path); err != nil || string(read) != data {
+			t.Errorf("Unexpected data of %s: %q (%v)", path, read, err)
+		}
+		if _, err = src.Read(path); !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("File %s not deleted from the old shard: %v", path, err)
+		}
+	}
+	if misplaced, err = s.Misplaced("", "waldo"); err != nil ||
+		len(misplaced) != 0 {
+		t.Errorf("Shards still misplaced: %v (%v)", misplaced, err)
+	}
+}
+
+// newTestShards returns Shards with a memory backend for each name.
+func newTestShards(t *testing.T, names ...string) *Shards {
+	shards := make([]interface{}, len(names))
+	for i, name := range names {
+		shards[i] = map[string]interface{}{
+			"name": name, "backend": MemoryBackend}
+	}
+	s, err := OpenShards(map[string]interface{}{"shards": shards})
+	if err != nil {
+		t.Fatalf("Failed to open shards: %+v", err)
+	}
+	return s
+}
@@ -0,0 +1,331 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package store
+
+import (
+	"database/sql"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	jww "github.com/spf13/jwalterweatherman"
+
+	"gitlab.com/xx_network/primitives/netTime"
+)
+
+// sqlMigrations are the schema changes applied, in order, to a new SQL
+// database. Once released, a migration must never be modified; new changes are
+// appended to the end of the list. The blob type is substituted for the
+// database-specific binary type.
+var sqlMigrations = []string{
+	`CREATE TABLE files (
+		username TEXT NOT NULL,
+		path     TEXT NOT NULL,
+		data     {{blob}} NOT NULL,
+		modified BIGINT NOT NULL,
+		PRIMARY KEY (username, path)
+	)`,
+	`CREATE INDEX files_modified ON files (username, modified)`,
+	`CREATE TABLE file_imports (
+		username TEXT PRIMARY KEY
+	)`,
+}
+
+// SQLStore manages the storage for a single user in the files table of a SQL
+// database. Each file is saved as a row keyed on the username and path. The
+// queries are compatible with both PostgreSQL and SQLite. Adheres to the Store
+// interface.
+type SQLStore struct {
+	db       *sql.DB
+	username string
+}
+
+// newSQLStore creates a new SQLStore for the user. The storage directory is
+// not used.
+//
+// Returns [NonLocalFileErr] if the username is not a valid path element.
+func newSQLStore(db *sql.DB, _, username string) (Store, error) {
+	if err := CheckUsername(username); err != nil {
+		return nil, err
+	}
+	return &SQLStore{db: db, username: username}, nil
+}
+
+// Read reads from the provided file path and returns the data in the file at
+// that path.
+//
+// An error is returned if it fails to read the file. Returns [os.ErrNotExist]
+// if the file does not exist and [NonLocalFileErr] if the file is outside the
+// base path.
+func (s *SQLStore) Read(path string) ([]byte, error) {
+	path, err := readyKey("", path)
+	if err != nil {
+		return nil, err
+	}
+
+	var data []byte
+	err = s.db.QueryRow(
+		`SELECT data FROM files WHERE username = $1 AND path = $2`,
+		s.username, path).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, os.ErrNotExist
+	} else if err != nil {
+		return nil, errors.Wrapf(err, "failed to read %s", path)
+	}
+
+	return data, nil
+}
+
+// Write writes the provided data to the file path.
+//
+// An error is returned if the write fails. Returns [NonLocalFileErr] if the
+// file is outside the base path.
+func (s *SQLStore) Write(path string, data []byte) error {
+	path, err := readyKey("", path)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.db.Exec(`INSERT INTO files (username, path, data, modified)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (username, path) DO UPDATE
+		SET data = excluded.data, modified = excluded.modified`,
+		s.username, path, data, netTime.Now().UnixNano())
+	if err != nil {
+		return errors.Wrapf(err, "failed to write %s", path)
+	}
+
+	return nil
+}
+
+// GetLastModified returns the last modification time for the file at the given
+// file.
+//
+// Returns [os.ErrNotExist] if the file does not exist and [NonLocalFileErr] if
+// the file is outside the base path.
+func (s *SQLStore) GetLastModified(path string) (time.Time, error) {
+	path, err := readyKey("", path)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	var modified int64
+	err = s.db.QueryRow(
+		`SELECT modified FROM files WHERE username = $1 AND path = $2`,
+		s.username, path).Scan(&modified)
+	if errors.Is(err, sql.ErrNoRows) {
+		return time.Time{}, os.ErrNotExist
+	} else if err != nil {
+		return time.Time{}, errors.Wrapf(
+			err, "failed to get last modified for %s", path)
+	}
+
+	return time.Unix(0, modified), nil
+}
+
+// GetLastWrite returns the time of the most recent successful Write operation
+// that was performed.
+//
+// Returns [os.ErrNotExist] if the user has not written any files.
+func (s *SQLStore) GetLastWrite() (time.Time, error) {
+	var modified sql.NullInt64
+	err := s.db.QueryRow(
+		`SELECT MAX(modified) FROM files WHERE username = $1`, s.username).
+		Scan(&modified)
+	if err != nil {
+		return time.Time{}, errors.Wrap(err, "failed to get last write")
+	} else if !modified.Valid {
+		return time.Time{}, os.ErrNotExist
+	}
+
+	return time.Unix(0, modified.Int64), nil
+}
+
+// ReadDir reads the named directory, returning all its directory entries
+// sorted by filename.
+//
+// Returns [NonLocalFileErr] if the file is outside the base path.
+func (s *SQLStore) ReadDir(path string) ([]string, error) {
+	path, err := readyKey("", path)
+	if err != nil {
+		return nil, err
+	}
+
+	prefix := ""
+	if path != "" {
+		prefix = path + "/"
+	}
+
+	rows, err := s.db.Query(`SELECT path FROM files
+		WHERE username = $1 AND path LIKE $2 ESCAPE '\'`,
+		s.username, escapeLike(prefix)+"%")
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read directory %s", path)
+	}
+	defer func() { _ = rows.Close() }()
+
+	var paths []string
+	for rows.Next() {
+		var p string
+		if err = rows.Scan(&p); err != nil {
+			return nil, errors.Wrapf(err, "failed to read directory %s", path)
+		}
+		paths = append(paths, p)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, errors.Wrapf(err, "failed to read directory %s", path)
+	}
+
+	return subdirectories(prefix, paths), nil
+}
+
+// Delete deletes the file at the given path.
+//
+// Returns [os.ErrNotExist] if the file does not exist. Returns
+// [NonLocalFileErr] if the file is outside the base path.
+func (s *SQLStore) Delete(path string) error {
+	path, err := readyKey("", path)
+	if err != nil {
+		return err
+	}
+
+	result, err := s.db.Exec(
+		`DELETE FROM files WHERE username = $1 AND path = $2`,
+		s.username, path)
+	if err != nil {
+		return errors.Wrapf(err, "failed to delete %s", path)
+	}
+
+	if n, err := result.RowsAffected(); err != nil {
+		return errors.Wrapf(err, "failed to delete %s", path)
+	} else if n == 0 {
+		return os.ErrNotExist
+	}
+
+	return nil
+}
+
+// ListFiles returns the paths of all files of the user sorted lexically.
+func (s *SQLStore) ListFiles() ([]string, error) {
+	rows, err := s.db.Query(
+		`SELECT path FROM files WHERE username = $1`, s.username)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list files")
+	}
+	defer func() { _ = rows.Close() }()
+
+	files := make([]string, 0)
+	for rows.Next() {
+		var p string
+		if err = rows.Scan(&p); err != nil {
+			return nil, errors.Wrap(err, "failed to list files")
+		}
+		files = append(files, p)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "failed to list files")
+	}
+	sort.Strings(files)
+
+	return files, nil
+}
+
+// Size returns the total size of all files of the user.
+func (s *SQLStore) Size() (int64, error) {
+	var size int64
+	err := s.db.QueryRow(`SELECT COALESCE(SUM(LENGTH(data)), 0) FROM files `+
+		`WHERE username = $1`, s.username).Scan(&size)
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to size files")
+	}
+
+	return size, nil
+}
+
+// Ping returns an error if the database cannot be reached.
+func (s *SQLStore) Ping() error {
+	if err := s.db.Ping(); err != nil {
+		return errors.Wrap(err, "failed to reach database")
+	}
+	return nil
+}
+
+// subdirectories returns the sorted, de-duplicated names of the directories
+// directly inside the prefix that contain at least one of the file paths.
+func subdirectories(prefix string, paths []string) []string {
+	dirMap := make(map[string]struct{})
+	for _, p := range paths {
+		rel := strings.TrimPrefix(p, prefix)
+		if i := strings.IndexByte(rel, '/'); i > 0 {
+			dirMap[rel[:i]] = struct{}{}
+		}
+	}
+
+	dirs := make([]string, 0, len(dirMap))
+	for dir := range dirMap {
+		dirs = append(dirs, dir)
+	}
+	sort.Strings(dirs)
+
+	return dirs
+}
+
+// escapeLike escapes the special characters of a LIKE pattern so that the
+// string is matched literally.
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+// migrateSQL applies all migrations in sqlMigrations that have not yet been
+// applied to the database. The version of each applied migration is recorded
+// in the schema_migrations table. Each migration is run in its own
+// transaction.
+func migrateSQL(db *sql.DB, blobType string) error {
+	_, err := db.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (
+		version INTEGER PRIMARY KEY
+	)`)
+	if err != nil {
+		return errors.Wrap(err, "failed to create migrations table")
+	}
+
+	var version int
+	err = db.QueryRow(`SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).
+		Scan(&version)
+	if err != nil {
+		return errors.Wrap(err, "failed to get schema version")
+	}
+
+	for ; version < len(sqlMigrations); version++ {
+		migration := strings.ReplaceAll(
+			sqlMigrations[version], "{{blob}}", blobType)
+
+		tx, err := db.Begin()
+		if err != nil {
+			return errors.Wrap(err, "failed to start migration transaction")
+		}
+		if _, err = tx.Exec(migration); err != nil {
+			_ = tx.Rollback()
+			return errors.Wrapf(err, "failed to apply migration %d", version+1)
+		}
+		_, err = tx.Exec(
+			`INSERT INTO schema_migrations (version) VALUES ($1)`, version+1)
+		if err != nil {
+			_ = tx.Rollback()
+			return errors.Wrapf(err, "failed to record migration %d", version+1)
+		}
+		if err = tx.Commit(); err != nil {
+			return errors.Wrapf(err, "failed to commit migration %d", version+1)
+		}
+
+		jww.INFO.Printf("Applied database migration %d.", version+1)
+	}
+
+	return nil
+}
@@ -0,0 +1,74 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package store
+
+import (
+	"reflect"
+	"testing"
+)
+
+// Tests that SQLStore adheres to the Store interface.
+var _ Store = (*SQLStore)(nil)
+
+// Tests that SQLStore adheres to the Lister interface.
+var _ Lister = (*SQLStore)(nil)
+
+// Tests that SQLStore adheres to the Sizer interface.
+var _ Sizer = (*SQLStore)(nil)
+
+// Tests that SQLStore adheres to the Pinger interface.
+var _ Pinger = (*SQLStore)(nil)
+
+// Tests that subdirectories returns only the directories directly inside the
+// prefix, sorted and without duplicates.
+func Test_subdirectories(t *testing.T) {
+	paths := []string{"file", "dir1/a", "dir1/file", "dir1/dirA/a",
+		"dir1/dirB/dirB1/a", "dir1/dirB/dirB2/a", "dir1/dirC/file",
+		"dir2/dirC/a", "dirD/a"}
+	tests := []struct {
+		prefix string
+		dirs   []string
+	}{
+		{"", []string{"dir1", "dir2", "dirD"}},
+		{"dir1/", []string{"dirA", "dirB", "dirC"}},
+		{"dir1/dirB/", []string{"dirB1", "dirB2"}},
+		{"dir1/dirB/dirB2/", []string{}},
+	}
+
+	for i, tt := range tests {
+		var matching []string
+		for _, p := range paths {
+			if len(p) >= len(tt.prefix) && p[:len(tt.prefix)] == tt.prefix {
+				matching = append(matching, p)
+			}
+		}
+
+		dirs := subdirectories(tt.prefix, matching)
+		if !reflect.DeepEqual(tt.dirs, dirs) {
+			t.Errorf("Unexpected directory list for %s (%d)."+
+				"\nexpected: %s\nreceived: %s", tt.prefix, i, tt.dirs, dirs)
+		}
+	}
+}
+
+// Tests that escapeLike escapes all LIKE pattern characters.
+func Test_escapeLike(t *testing.T) {
+	tests := map[string]string{
+		"dir/file":   "dir/file",
+		"100%":       `100\%`,
+		"some_file":  `some\_file`,
+		`back\slash`: `back\\slash`,
+	}
+
+	for s, expected := range tests {
+		if escaped := escapeLike(s); escaped != expected {
+			t.Errorf("Unexpected escaped string for %q."+
+				"\nexpected: %s\nreceived: %s", s, expected, escaped)
+		}
+	}
+}
@@ -0,0 +1,195 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package store
+
+import (
+	"database/sql"
+	ioFS "io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+	jww "github.com/spf13/jwalterweatherman"
+	// Registers the "sqlite" database/sql driver
+	_ "modernc.org/sqlite"
+
+	"gitlab.com/elixxir/remoteSyncServer/storage"
+	"gitlab.com/xx_network/primitives/utils"
+)
+
+// SQLiteBackend is the name of the SQLite storage backend.
+const SQLiteBackend = "sqlite"
+
+// defaultSQLiteBusyTimeout is the default value of SQLiteParams.BusyTimeout.
+const defaultSQLiteBusyTimeout = 5 * time.Second
+
+func init() {
+	storage.RegisterBackend(SQLiteBackend,
+		func(params map[string]interface{}) (NewStore, error) {
+			db, err := OpenSQLite(params)
+			if err != nil {
+				return nil, err
+			}
+			return func(storageDir, baseDir string) (Store, error) {
+				return newSQLiteStore(db, storageDir, baseDir)
+			}, nil
+		})
+}
+
+// SQLiteParams contains the parameters used to open a SQLite database. They
+// are set in the "sqlite" section of the config.
+type SQLiteParams struct {
+	// Path is the path to the database file. It is created if it does not
+	// exist.
+	Path string `mapstructure:"path"`
+
+	// BusyTimeout is the amount of time a connection waits for a lock held by
+	// another connection before failing.
+	BusyTimeout time.Duration `mapstructure:"busyTimeout"`
+}
+
+// OpenSQLite opens the SQLite database file described by the parameters in WAL
+// mode and applies any outstanding schema migrations.
+func OpenSQLite(params map[string]interface{}) (*sql.DB, error) {
+	p := SQLiteParams{BusyTimeout: defaultSQLiteBusyTimeout}
+	if err := decodeParams(params, &p); err != nil {
+		return nil, err
+	}
+	if p.Path == "" {
+		return nil, errors.New("no SQLite database path specified")
+	}
+
+	path, err := utils.ExpandPath(p.Path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to expand path %s", p.Path)
+	}
+	if err = os.MkdirAll(filepath.Dir(path), FilePerm); err != nil {
+		return nil, errors.Wrapf(err, "failed to make directory for %s", path)
+	}
+
+	// The pragmas are applied to every connection opened by the pool
+	query := url.Values{"_pragma": {
+		"journal_mode(WAL)",
+		"synchronous(NORMAL)",
+		"busy_timeout(" + strconv.FormatInt(p.BusyTimeout.Milliseconds(), 10) + ")",
+	}}
+	db, err := sql.Open("sqlite", "file:"+path+"?"+query.Encode())
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to open SQLite database %s", path)
+	}
+
+	if err = migrateSQL(db, "BLOB"); err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+
+	jww.INFO.Printf("Opened SQLite database %s.", path)
+
+	return db, nil
+}
+
+// newSQLiteStore creates a new SQLStore for the user. If the user has
+// previously synced files to the file backend in the storage directory, they
+// are imported into the database the first time the user's store is created.
+func newSQLiteStore(db *sql.DB, storageDir, username string) (Store, error) {
+	s, err := newSQLStore(db, storageDir, username)
+	if err != nil {
+		return nil, err
+	}
+
+	if storageDir != "" {
+		if err = importFileStore(db, storageDir, username); err != nil {
+			return nil, err
+		}
+	}
+
+	return s, nil
+}
+
+// importFileStore copies all files in the user's directory of a file backend
+// in the storage directory into the database, keeping their modification
+// times. The import is only done once per user; this is recorded in the
+// file_imports table so that files deleted after the import do not reappear.
+// The original files are left untouched.
+func importFileStore(db *sql.DB, storageDir, username string) error {
+	var imported int
+	err := db.QueryRow(`SELECT COUNT(*) FROM file_imports WHERE username = $1`,
+		username).Scan(&imported)
+	if err != nil {
+		return errors.Wrapf(err, "failed to check import for %q", username)
+	} else if imported > 0 {
+		return nil
+	}
+
+	storageDir, err = utils.ExpandPath(storageDir)
+	if err != nil {
+		return errors.Wrapf(err, "unable to expand path %s", storageDir)
+	}
+	dir, err := userDir(storageDir, username)
+	if err != nil {
+		return err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return errors.Wrap(err, "failed to start import transaction")
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	var n int
+	err = filepath.WalkDir(dir,
+		func(path string, d ioFS.DirEntry, err error) error {
+			if errors.Is(err, ioFS.ErrNotExist) && path == dir {
+				return filepath.SkipDir
+			} else if err != nil || d.IsDir() {
+				return err
+			}
+
+			data, err := os.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			rel, err := filepath.Rel(dir, path)
+			if err != nil {
+				return err
+			}
+
+			_, err = tx.Exec(`INSERT INTO files (username, path, data, modified)
+				VALUES ($1, $2, $3, $4) ON CONFLICT (username, path) DO NOTHING`,
+				username, filepath.ToSlash(rel), data,
+				info.ModTime().UnixNano())
+			n++
+			return err
+		})
+	if err != nil {
+		return errors.Wrapf(err, "failed to import files from %s", dir)
+	}
+
+	_, err = tx.Exec(
+		`INSERT INTO file_imports (username) VALUES ($1)`, username)
+	if err != nil {
+		return errors.Wrapf(err, "failed to record import for %q", username)
+	}
+	if err = tx.Commit(); err != nil {
+		return errors.Wrapf(err, "failed to commit import for %q", username)
+	}
+
+	if n > 0 {
+		jww.INFO.Printf("Imported %d files for user %q from %s.",
+			n, username, dir)
+	}
+
+	return nil
+}
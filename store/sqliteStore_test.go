@@ -0,0 +1,292 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package store
+
+import (
+	"bytes"
+	"database/sql"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Tests that OpenSQLite creates the database in WAL mode and applies all
+// migrations.
+func TestOpenSQLite(t *testing.T) {
+	db := newTestSQLite(t)
+
+	var mode string
+	if err := db.QueryRow(`PRAGMA journal_mode`).Scan(&mode); err != nil {
+		t.Fatalf("Failed to get journal mode: %+v", err)
+	} else if mode != "wal" {
+		t.Errorf("Unexpected journal mode.\nexpected: %s\nreceived: %s",
+			"wal", mode)
+	}
+
+	var version int
+	err := db.QueryRow(`SELECT MAX(version) FROM schema_migrations`).
+		Scan(&version)
+	if err != nil {
+		t.Fatalf("Failed to get schema version: %+v", err)
+	} else if version != len(sqlMigrations) {
+		t.Errorf("Unexpected schema version.\nexpected: %d\nreceived: %d",
+			len(sqlMigrations), version)
+	}
+
+	// Migrating again should be a no-op
+	if err = migrateSQL(db, "BLOB"); err != nil {
+		t.Errorf("Failed to migrate already migrated database: %+v", err)
+	}
+}
+
+// Error path: Tests that OpenSQLite returns an error when no path is specified
+// or when an unknown parameter is set.
+func TestOpenSQLite_InvalidParamsError(t *testing.T) {
+	for i, params := range []map[string]interface{}{
+		{},
+		{"path": filepath.Join(t.TempDir(), "db"), "busy": "5s"},
+	} {
+		if _, err := OpenSQLite(params); err == nil {
+			t.Errorf("Failed to get error for invalid params (%d): %v", i, params)
+		}
+	}
+}
+
+// Tests that all the files written by SQLStore.Write can be read by
+// SQLStore.Read, listed by SQLStore.ReadDir and SQLStore.ListFiles, counted by
+// SQLStore.Size, and deleted by SQLStore.Delete, and that the modification
+// times are correct.
+func TestSQLStore(t *testing.T) {
+	s, err := newSQLStore(newTestSQLite(t), "", "waldo")
+	if err != nil {
+		t.Fatalf("Failed to create SQLStore: %+v", err)
+	}
+
+	if _, err = s.GetLastWrite(); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Unexpected error for last write with no files."+
+			"\nexpected: %v\nreceived: %v", os.ErrNotExist, err)
+	}
+
+	testFiles := map[string][]byte{
+		"hello.txt":             []byte("hello"),
+		"dir1/a.txt":            []byte("a"),
+		"dir1/dirA/b.txt":       []byte("b"),
+		"dir1/dir_B/c.txt":      []byte("c"),
+		"dir1%/d.txt":           []byte("d"),
+		"dir2/dirC/dirD/e.txt":  []byte("e"),
+		"/dir2/./dirE/../f.txt": []byte("f"),
+	}
+
+	start := time.Now()
+	for path, data := range testFiles {
+		if err = s.Write(path, data); err != nil {
+			t.Errorf("Failed to write %s: %+v", path, err)
+		}
+	}
+
+	for path, expected := range testFiles {
+		if data, err2 := s.Read(path); err2 != nil {
+			t.Errorf("Failed to read %s: %+v", path, err2)
+		} else if !bytes.Equal(expected, data) {
+			t.Errorf("Read unexpected data for path %s."+
+				"\nexpected: %q\nreceived: %q", path, expected, data)
+		}
+
+		if modified, err2 := s.GetLastModified(path); err2 != nil {
+			t.Errorf("Failed to get last modified for %s: %+v", path, err2)
+		} else if modified.Before(start.Add(-time.Second)) {
+			t.Errorf("Last modified for %s too early: %s", path, modified)
+		}
+	}
+
+	if lastWrite, err2 := s.GetLastWrite(); err2 != nil {
+		t.Errorf("Failed to get last write: %+v", err2)
+	} else if lastWrite.Before(start.Add(-time.Second)) {
+		t.Errorf("Last write too early: %s", lastWrite)
+	}
+
+	dirTests := map[string][]string{
+		"":          {"dir1", "dir1%", "dir2"},
+		"dir1":      {"dirA", "dir_B"},
+		"dir2/":     {"dirC"},
+		"dir2/dirC": {"dirD"},
+		"dir3":      {},
+	}
+	for path, expected := range dirTests {
+		if dirs, err2 := s.ReadDir(path); err2 != nil {
+			t.Errorf("Failed to read directory %s: %+v", path, err2)
+		} else if !reflect.DeepEqual(expected, dirs) {
+			t.Errorf("Unexpected directories for %q."+
+				"\nexpected: %s\nreceived: %s", path, expected, dirs)
+		}
+	}
+
+	expectedFiles := []string{"dir1%/d.txt", "dir1/a.txt", "dir1/dirA/b.txt",
+		"dir1/dir_B/c.txt", "dir2/dirC/dirD/e.txt", "dir2/f.txt", "hello.txt"}
+	if files, err2 := s.(Lister).ListFiles(); err2 != nil {
+		t.Errorf("Failed to list files: %+v", err2)
+	} else if !reflect.DeepEqual(expectedFiles, files) {
+		t.Errorf("Unexpected files.\nexpected: %s\nreceived: %s",
+			expectedFiles, files)
+	}
+	if size, err2 := s.(Sizer).Size(); err2 != nil {
+		t.Errorf("Failed to get size: %+v", err2)
+	} else if size != 11 {
+		t.Errorf("Unexpected size.\nexpected: %d\nreceived: %d", 11, size)
+	}
+	if err = s.(Pinger).Ping(); err != nil {
+		t.Errorf("Failed to ping database: %+v", err)
+	}
+
+	if err = s.Delete("hello.txt"); err != nil {
+		t.Errorf("Failed to delete file: %+v", err)
+	}
+	if _, err = s.Read("hello.txt"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Unexpected error reading deleted file."+
+			"\nexpected: %v\nreceived: %v", os.ErrNotExist, err)
+	}
+}
+
+// Tests that a SQLStore only sees the files of its own user.
+func TestSQLStore_SeparateUsers(t *testing.T) {
+	db := newTestSQLite(t)
+	s1, _ := newSQLStore(db, "", "waldo")
+	s2, _ := newSQLStore(db, "", "carmen")
+
+	if err := s1.Write("dir/file", []byte("data")); err != nil {
+		t.Fatalf("Failed to write file: %+v", err)
+	}
+
+	if _, err := s2.Read("dir/file"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Unexpected error reading other user's file."+
+			"\nexpected: %v\nreceived: %v", os.ErrNotExist, err)
+	}
+	if dirs, err := s2.ReadDir(""); err != nil || len(dirs) != 0 {
+		t.Errorf("Read other user's directories %s: %+v", dirs, err)
+	}
+	if err := s2.Delete("dir/file"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Unexpected error deleting other user's file."+
+			"\nexpected: %v\nreceived: %v", os.ErrNotExist, err)
+	}
+}
+
+// Error path: Tests that all SQLStore methods that take a path return
+// NonLocalFileErr for paths outside the user's directory.
+func TestSQLStore_NonLocalFileError(t *testing.T) {
+	s, _ := newSQLStore(newTestSQLite(t), "", "waldo")
+	path := "../carmen/file"
+
+	if _, err := s.Read(path); !errors.Is(err, NonLocalFileErr) {
+		t.Errorf("Unexpected error for Read.\nexpected: %v\nreceived: %v",
+			NonLocalFileErr, err)
+	}
+	if err := s.Write(path, nil); !errors.Is(err, NonLocalFileErr) {
+		t.Errorf("Unexpected error for Write.\nexpected: %v\nreceived: %v",
+			NonLocalFileErr, err)
+	}
+	if _, err := s.GetLastModified(path); !errors.Is(err, NonLocalFileErr) {
+		t.Errorf("Unexpected error for GetLastModified."+
+			"\nexpected: %v\nreceived: %v", NonLocalFileErr, err)
+	}
+	if _, err := s.ReadDir(path); !errors.Is(err, NonLocalFileErr) {
+		t.Errorf("Unexpected error for ReadDir.\nexpected: %v\nreceived: %v",
+			NonLocalFileErr, err)
+	}
+	if err := s.Delete(path); !errors.Is(err, NonLocalFileErr) {
+		t.Errorf("Unexpected error for Delete.\nexpected: %v\nreceived: %v",
+			NonLocalFileErr, err)
+	}
+}
+
+// Tests that newSQLiteStore imports the files of a user from the file backend
+// once, keeping their modification times, and that files deleted after the
+// import are not imported again.
+func Test_newSQLiteStore_Import(t *testing.T) {
+	db := newTestSQLite(t)
+	storageDir := t.TempDir()
+
+	fs, err := NewFileStore(storageDir, "waldo")
+	if err != nil {
+		t.Fatalf("Failed to create FileStore: %+v", err)
+	}
+	testFiles := map[string][]byte{
+		"hello.txt":  []byte("hello"),
+		"dir1/a.txt": []byte("a"),
+	}
+	modified := time.Date(2022, 2, 3, 4, 5, 6, 0, time.UTC)
+	for path, data := range testFiles {
+		if err = fs.Write(path, data); err != nil {
+			t.Fatalf("Failed to write %s: %+v", path, err)
+		}
+		err = os.Chtimes(
+			filepath.Join(storageDir, "waldo", path), modified, modified)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	s, err := newSQLiteStore(db, storageDir, "waldo")
+	if err != nil {
+		t.Fatalf("Failed to create store: %+v", err)
+	}
+	for path, expected := range testFiles {
+		if data, err2 := s.Read(path); err2 != nil {
+			t.Errorf("Failed to read imported %s: %+v", path, err2)
+		} else if !bytes.Equal(expected, data) {
+			t.Errorf("Read unexpected data for path %s."+
+				"\nexpected: %q\nreceived: %q", path, expected, data)
+		}
+
+		if lm, err2 := s.GetLastModified(path); err2 != nil {
+			t.Errorf("Failed to get last modified for %s: %+v", path, err2)
+		} else if !lm.Equal(modified) {
+			t.Errorf("Unexpected last modified for %s."+
+				"\nexpected: %s\nreceived: %s", path, modified, lm)
+		}
+	}
+
+	// Files deleted after the import should not reappear
+	if err = s.Delete("hello.txt"); err != nil {
+		t.Fatalf("Failed to delete file: %+v", err)
+	}
+	s, err = newSQLiteStore(db, storageDir, "waldo")
+	if err != nil {
+		t.Fatalf("Failed to create store: %+v", err)
+	}
+	if _, err = s.Read("hello.txt"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Deleted file was imported again: %v", err)
+	}
+}
+
+// Tests that newSQLiteStore succeeds for a user that has no directory in the
+// storage directory.
+func Test_newSQLiteStore_NoUserDirectory(t *testing.T) {
+	s, err := newSQLiteStore(newTestSQLite(t), t.TempDir(), "waldo")
+	if err != nil {
+		t.Fatalf("Failed to create store: %+v", err)
+	}
+	if dirs, err := s.ReadDir(""); err != nil || len(dirs) != 0 {
+		t.Errorf("Unexpected directories %s: %+v", dirs, err)
+	}
+}
+
+// newTestSQLite opens a new SQLite database in a temporary directory that is
+// closed at the end of the test.
+func newTestSQLite(t testing.TB) *sql.DB {
+	db, err := OpenSQLite(map[string]interface{}{
+		"path": filepath.Join(t.TempDir(), "test.db")})
+	if err != nil {
+		t.Fatalf("Failed to open SQLite database: %+v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+	return db
+}
@@ -0,0 +1,146 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package store
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Attributes of the spans recorded by TracedStore.
+const (
+	tracePathKey    = attribute.Key("store.path")
+	traceBytesKey   = attribute.Key("store.bytes")
+	traceBackendKey = attribute.Key("store.backend")
+	traceEntriesKey = attribute.Key("store.entries")
+)
+
+// TracedStore records an OpenTelemetry span for each operation on the
+// underlying Store. The spans are children of the span of the request the
+// store is used for, so that a trace shows the time spent in storage I/O.
+// Adheres to the Store interface.
+type TracedStore struct {
+	Store
+	ctx     context.Context
+	tracer  trace.Tracer
+	backend string
+}
+
+// NewTracedStore returns the Store traced as part of the request with the
+// context, using the tracer.
+func NewTracedStore(
+	ctx context.Context, s Store, tracer trace.Tracer) *TracedStore {
+	backend := strings.TrimPrefix(fmt.Sprintf("%T", s), "*")
+	return &TracedStore{Store: s, ctx: ctx, tracer: tracer, backend: backend}
+}
+
+// Read reads the file at the path in a span.
+func (ts *TracedStore) Read(path string) ([]byte, error) {
+	span := ts.start("Read", tracePathKey.String(path))
+	data, err := ts.Store.Read(path)
+	span.SetAttributes(traceBytesKey.Int(len(data)))
+	endSpan(span, err)
+	return data, err
+}
+
+// Write writes the data to the file at the path in a span.
+func (ts *TracedStore) Write(path string, data []byte) error {
+	span := ts.start("Write",
+		tracePathKey.String(path), traceBytesKey.Int(len(data)))
+	err := ts.Store.Write(path, data)
+	endSpan(span, err)
+	return err
+}
+
+// GetLastModified returns the last modification time of the file at the path
+// in a span.
+func (ts *TracedStore) GetLastModified(path string) (time.Time, error) {
+	span := ts.start("GetLastModified", tracePathKey.String(path))
+	lastModified, err := ts.Store.GetLastModified(path)
+	endSpan(span, err)
+	return lastModified, err
+}
+
+// GetLastWrite returns the time of the most recent write in a span.
+func (ts *TracedStore) GetLastWrite() (time.Time, error) {
+	span := ts.start("GetLastWrite")
+	lastWrite, err := ts.Store.GetLastWrite()
+	endSpan(span, err)
+	return lastWrite, err
+}
+
+// ReadDir reads the directory at the path in a span.
+func (ts *TracedStore) ReadDir(path string) ([]string, error) {
+	span := ts.start("ReadDir", tracePathKey.String(path))
+	entries, err := ts.Store.ReadDir(path)
+	span.SetAttributes(traceEntriesKey.Int(len(entries)))
+	endSpan(span, err)
+	return entries, err
+}
+
+// Open opens the file at the path in a span, which ends once it is opened.
+func (ts *TracedStore) Open(path string) (io.ReadCloser, int64, error) {
+	span := ts.start("Open", tracePathKey.String(path))
+	r, size, err := Open(ts.Store, path)
+	span.SetAttributes(traceBytesKey.Int64(size))
+	endSpan(span, err)
+	return r, size, err
+}
+
+// Stat returns the metadata of the file at the path in a span.
+func (ts *TracedStore) Stat(path string) (Metadata, error) {
+	span := ts.start("Stat", tracePathKey.String(path))
+	md, err := Stat(ts.Store, path)
+	endSpan(span, err)
+	return md, err
+}
+
+// SetDevice records the device as the writer of the file at the path in a
+// span.
+func (ts *TracedStore) SetDevice(
+	path string, sha256 []byte, device string) error {
+	span := ts.start("SetDevice", tracePathKey.String(path))
+	err := SetDevice(ts.Store, path, sha256, device)
+	endSpan(span, err)
+	return err
+}
+
+// Delete deletes the file at the path in a span.
+func (ts *TracedStore) Delete(path string) error {
+	span := ts.start("Delete", tracePathKey.String(path))
+	err := ts.Store.Delete(path)
+	endSpan(span, err)
+	return err
+}
+
+// start starts the span of the operation as a child of the span of the
+// context.
+func (ts *TracedStore) start(
+	operation string, attributes ...attribute.KeyValue) trace.Span {
+	_, span := ts.tracer.Start(ts.ctx, "store."+operation,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(append(attributes,
+			traceBackendKey.String(ts.backend))...))
+	return span
+}
+
+// endSpan records the error, if any, on the span and ends it.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
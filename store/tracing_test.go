@@ -0,0 +1,95 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package store
+
+import (
+	"context"
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// Tests that TracedStore adheres to the Store interface.
+var _ Store = (*TracedStore)(nil)
+
+// Tests that TracedStore adheres to the Opener interface.
+var _ Opener = (*TracedStore)(nil)
+
+// Tests that TracedStore records a span for each operation as a child of the
+// span of its context, with the path, size, and backend as attributes and the
+// error as the status.
+func TestTracedStore(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	tracer := sdktrace.NewTracerProvider(
+		sdktrace.WithSpanProcessor(recorder)).Tracer("test")
+	ctx, parent := tracer.Start(context.Background(), "rpc")
+	ms, _ := NewMemStore("", "")
+	ts := NewTracedStore(ctx, ms, tracer)
+
+	if err := ts.Write("dir/file", []byte("hello")); err != nil {
+		t.Fatalf("Failed to write: %+v", err)
+	}
+	if _, err := ts.Read("dir/file"); err != nil {
+		t.Fatalf("Failed to read: %+v", err)
+	}
+	if _, err := ts.Read("missing"); err == nil {
+		t.Fatalf("Failed to get error for missing file.")
+	}
+	if _, err := ts.ReadDir(""); err != nil {
+		t.Fatalf("Failed to read directory: %+v", err)
+	}
+	parent.End()
+
+	expected := []struct {
+		name  string
+		code  codes.Code
+		attrs []attribute.KeyValue
+	}{
+		{"store.Write", codes.Unset, []attribute.KeyValue{
+			tracePathKey.String("dir/file"), traceBytesKey.Int(5)}},
+		{"store.Read", codes.Unset, []attribute.KeyValue{
+			tracePathKey.String("dir/file"), traceBytesKey.Int(5)}},
+		{"store.Read", codes.Error, []attribute.KeyValue{
+			tracePathKey.String("missing"), traceBytesKey.Int(0)}},
+		{"store.ReadDir", codes.Unset, []attribute.KeyValue{
+			tracePathKey.String(""), traceEntriesKey.Int(1)}},
+	}
+	backend := traceBackendKey.String("store.MemStore")
+	spans := recorder.Ended()
+	if len(spans) != len(expected)+1 {
+		t.Fatalf("Unexpected number of spans.\nexpected: %d\nreceived: %d",
+			len(expected)+1, len(spans))
+	}
+	for i, exp := range expected {
+		span := spans[i]
+		if span.Name() != exp.name {
+			t.Errorf("Unexpected name of span %d.\nexpected: %s\nreceived: %s",
+				i, exp.name, span.Name())
+		}
+		if span.Parent().SpanID() != parent.SpanContext().SpanID() {
+			t.Errorf("Span %d is not a child of the context's span.", i)
+		}
+		if span.Status().Code != exp.code {
+			t.Errorf("Unexpected status of span %d."+
+				"\nexpected: %s\nreceived: %s", i, exp.code, span.Status().Code)
+		}
+		attrs := make(map[attribute.Key]attribute.Value)
+		for _, kv := range span.Attributes() {
+			attrs[kv.Key] = kv.Value
+		}
+		for _, kv := range append(exp.attrs, backend) {
+			if attrs[kv.Key] != kv.Value {
+				t.Errorf("Unexpected %s of span %d.\nexpected: %s\nreceived: %s",
+					kv.Key, i, kv.Value.Emit(), attrs[kv.Key].Emit())
+			}
+		}
+	}
+}
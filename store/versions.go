@@ -0,0 +1,552 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package store
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	jww "github.com/spf13/jwalterweatherman"
+
+	"gitlab.com/xx_network/primitives/netTime"
+)
+
+// defaultMaxVersions is the default value of VersioningParams.MaxVersions.
+const defaultMaxVersions = 10
+
+// versionsDir is the directory in each user's base path that holds the
+// previous versions of their files. It is hidden from and cannot be accessed by
+// clients.
+const versionsDir = ".versions"
+
+// versionIndexName is the name of the file in the directory of the versions
+// of a file that lists them.
+const versionIndexName = "index"
+
+var (
+	// ReservedPathErr is returned when attempting to access the directory
+	// that holds the previous versions of files, deduplicated data, or the
+	// metadata of files.
+	ReservedPathErr = errors.New("path is reserved by the server")
+)
+
+// VersioningParams contains the parameters of file versioning. They are set in
+// the "versioning" section of the config.
+type VersioningParams struct {
+	// MaxVersions is the maximum number of previous versions kept of each
+	// file. Defaults to 10.
+	MaxVersions int `mapstructure:"maxVersions"`
+
+	// MaxAge is the maximum time a previous version is kept after it was
+	// replaced. If it is zero, versions are only limited by MaxVersions.
+	MaxAge time.Duration `mapstructure:"maxAge"`
+}
+
+// Version describes a previous version of a file.
+type Version struct {
+	// ID identifies the version among the versions of the file. IDs increase
+	// with each version.
+	ID uint64 `json:"id"`
+
+	// Modified is when the version was written and Replaced is when it was
+	// overwritten or deleted.
+	Modified time.Time `json:"modified"`
+	Replaced time.Time `json:"replaced"`
+
+	// Size is the size of the version in bytes.
+	Size int64 `json:"size"`
+
+	// Deleted is true if the version was replaced by deleting the file.
+	Deleted bool `json:"deleted,omitempty"`
+}
+
+// versionIndex is the list of the versions of a file, stored as JSON in the
+// directory of its versions.
+type versionIndex struct {
+	Path     string    `json:"path"`
+	Versions []Version `json:"versions"`
+}
+
+// VersionedStore keeps previous versions of the files of an underlying Store,
+// so that a file that was overwritten or deleted by mistake can be recovered.
+// Before a file is overwritten with different data or deleted, its data is
+// copied into the versions directory of the base path, where the versions of
+// each file are in a directory named after the SHA-256 hash of its path. The
+// oldest versions are removed once there are more than the maximum number or
+// they are older than the maximum age.
+//
+// The versions count towards the size of the store. Adheres to the Store
+// interface.
+type VersionedStore struct {
+	Store
+	params VersioningParams
+
+	// mux is shared by all stores of the user so that concurrent sessions do
+	// not lose each other's versions.
+	mux *sync.Mutex
+}
+
+// NewVersionedStore returns a NewStore that wraps each Store created by
+// newStore in a VersionedStore with the parameters.
+func NewVersionedStore(
+	params map[string]interface{}, newStore NewStore) (NewStore, error) {
+	p := VersioningParams{MaxVersions: defaultMaxVersions}
+	if err := decodeParams(params, &p); err != nil {
+		return nil, err
+	} else if p.MaxVersions < 1 {
+		return nil, errors.Errorf(
+			"maximum number of versions %d must be positive", p.MaxVersions)
+	} else if p.MaxAge < 0 {
+		return nil, errors.Errorf(
+			"maximum version age %s cannot be negative", p.MaxAge)
+	}
+
+	if p.MaxAge > 0 {
+		jww.INFO.Printf("Keeping up to %d previous versions of each file for "+
+			"%s.", p.MaxVersions, p.MaxAge)
+	} else {
+		jww.INFO.Printf("Keeping up to %d previous versions of each file.",
+			p.MaxVersions)
+	}
+
+	userLocks := make(map[string]*sync.Mutex)
+	var mux sync.Mutex
+	return func(storageDir, baseDir string) (Store, error) {
+		s, err := newStore(storageDir, baseDir)
+		if err != nil {
+			return nil, err
+		}
+
+		mux.Lock()
+		defer mux.Unlock()
+		userLock, exists := userLocks[baseDir]
+		if !exists {
+			userLock = &sync.Mutex{}
+			userLocks[baseDir] = userLock
+		}
+		return &VersionedStore{Store: s, params: p, mux: userLock}, nil
+	}, nil
+}
+
+// Read reads the file at the path from the underlying store.
+//
+// Returns [ReservedPathErr] if the path is in the versions directory.
+func (vs *VersionedStore) Read(path string) ([]byte, error) {
+	if isVersionPath(path) {
+		return nil, ReservedPathErr
+	}
+	return vs.Store.Read(path)
+}
+
+// Open opens the file at the path in the underlying store for reading.
+//
+// Returns [ReservedPathErr] if the path is in the versions directory.
+func (vs *VersionedStore) Open(path string) (io.ReadCloser, int64, error) {
+	if isVersionPath(path) {
+		return nil, 0, ReservedPathErr
+	}
+	return Open(vs.Store, path)
+}
+
+// Stat returns the metadata of the file at the path in the underlying store.
+//
+// Returns [ReservedPathErr] if the path is in the versions directory.
+func (vs *VersionedStore) Stat(path string) (Metadata, error) {
+	if isVersionPath(path) {
+		return Metadata{}, ReservedPathErr
+	}
+	return Stat(vs.Store, path)
+}
+
+// SetDevice records the device as the writer of the file at the path in the
+// underlying store.
+//
+// Returns [ReservedPathErr] if the path is in the versions directory.
+func (vs *VersionedStore) SetDevice(
+	path string, sha256 []byte, device string) error {
+	if isVersionPath(path) {
+		return ReservedPathErr
+	}
+	return SetDevice(vs.Store, path, sha256, device)
+}
+
+// Write saves the current data of the file at the path as a previous version,
+// unless it is the same as the new data, and then writes the new data to the
+// underlying store.
+//
+// Returns [ReservedPathErr] if the path is in the versions directory.
+func (vs *VersionedStore) Write(path string, data []byte) error {
+	if isVersionPath(path) {
+		return ReservedPathErr
+	}
+
+	vs.mux.Lock()
+	defer vs.mux.Unlock()
+	if err := vs.save(path, data, false); err != nil {
+		return err
+	}
+
+	// The file is written last so that it is the most recent write
+	return vs.Store.Write(path, data)
+}
+
+// GetLastModified returns the last modification time of the file at the path
+// from the underlying store.
+//
+// Returns [ReservedPathErr] if the path is in the versions directory.
+func (vs *VersionedStore) GetLastModified(path string) (time.Time, error) {
+	if isVersionPath(path) {
+		return time.Time{}, ReservedPathErr
+	}
+	return vs.Store.GetLastModified(path)
+}
+
+// ReadDir reads the directory at the path from the underlying store. The
+// versions directory is not listed.
+//
+// Returns [ReservedPathErr] if the path is in the versions directory.
+func (vs *VersionedStore) ReadDir(path string) ([]string, error) {
+	if isVersionPath(path) {
+		return nil, ReservedPathErr
+	}
+	entries, err := vs.Store.ReadDir(path)
+	if err != nil || cleanPath(path) != "." {
+		return entries, err
+	}
+
+	filtered := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		if entry != versionsDir {
+			filtered = append(filtered, entry)
+		}
+	}
+	return filtered, nil
+}
+
+// Delete saves the current data of the file at the path as a previous version
+// and then deletes it from the underlying store.
+//
+// Returns [os.ErrNotExist] if the file does not exist and [ReservedPathErr] if
+// the path is in the versions directory.
+func (vs *VersionedStore) Delete(path string) error {
+	if isVersionPath(path) {
+		return ReservedPathErr
+	}
+
+	vs.mux.Lock()
+	defer vs.mux.Unlock()
+	if err := vs.save(path, nil, true); err != nil {
+		return err
+	}
+	return vs.Store.Delete(path)
+}
+
+// ListFiles returns the paths of all files in the underlying store, except for
+// the previous versions. Returns an error if the underlying store does not
+// implement Lister.
+func (vs *VersionedStore) ListFiles() ([]string, error) {
+	lister, ok := vs.Store.(Lister)
+	if !ok {
+		return nil, errors.New("underlying store cannot list its files")
+	}
+	files, err := lister.ListFiles()
+	if err != nil {
+		return nil, err
+	}
+
+	filtered := make([]string, 0, len(files))
+	for _, path := range files {
+		if !isVersionPath(path) {
+			filtered = append(filtered, path)
+		}
+	}
+	return filtered, nil
+}
+
+// Size returns the total size of the files in the underlying store, including
+// the previous versions. Returns an error if the underlying store does not
+// implement Sizer.
+func (vs *VersionedStore) Size() (int64, error) {
+	sizer, ok := vs.Store.(Sizer)
+	if !ok {
+		return 0, errors.New("underlying store cannot report its size")
+	}
+	return sizer.Size()
+}
+
+// Ping returns an error if the underlying store cannot be reached. Stores that
+// do not implement Pinger are assumed to be reachable.
+func (vs *VersionedStore) Ping() error {
+	if pinger, ok := vs.Store.(Pinger); ok {
+		return pinger.Ping()
+	}
+	return nil
+}
+
+// ListVersions returns the previous versions of the file at the path, oldest
+// first. Versions older than the maximum age are removed first. Returns an
+// empty list if the file has no previous versions.
+//
+// Returns [ReservedPathErr] if the path is in the versions directory.
+func (vs *VersionedStore) ListVersions(path string) ([]Version, error) {
+	if isVersionPath(path) {
+		return nil, ReservedPathErr
+	}
+
+	vs.mux.Lock()
+	defer vs.mux.Unlock()
+	index, err := vs.loadIndex(path)
+	if err != nil {
+		return nil, err
+	}
+	if vs.prune(index, netTime.Now()) {
+		if err = vs.storeIndex(index); err != nil {
+			return nil, err
+		}
+	}
+
+	return append([]Version{}, index.Versions...), nil
+}
+
+// ReadVersion returns the data of the previous version of the file at the path
+// with the ID.
+//
+// Returns [os.ErrNotExist] if the file has no version with the ID and
+// [ReservedPathErr] if the path is in the versions directory.
+func (vs *VersionedStore) ReadVersion(path string, id uint64) ([]byte, error) {
+	if isVersionPath(path) {
+		return nil, ReservedPathErr
+	}
+
+	vs.mux.Lock()
+	defer vs.mux.Unlock()
+	index, err := vs.loadIndex(path)
+	if err != nil {
+		return nil, err
+	}
+	for _, v := range index.Versions {
+		if v.ID == id {
+			return vs.Store.Read(versionPath(path, id))
+		}
+	}
+
+	return nil, errors.Wrapf(os.ErrNotExist, "version %d of %s", id, path)
+}
+
+// VersionedFiles returns the paths of all files that have previous versions,
+// including files that were deleted, sorted lexically. Returns
+// [NotListableErr] if the underlying store does not implement Lister.
+func (vs *VersionedStore) VersionedFiles() ([]string, error) {
+	lister, ok := vs.Store.(Lister)
+	if !ok {
+		return nil, NotListableErr
+	}
+	files, err := lister.ListFiles()
+	if err != nil {
+		return nil, err
+	}
+
+	vs.mux.Lock()
+	defer vs.mux.Unlock()
+	paths := make([]string, 0)
+	for _, file := range files {
+		if !isVersionPath(file) ||
+			!strings.HasSuffix(file, "/"+versionIndexName) {
+			continue
+		}
+		data, err := vs.Store.Read(file)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		} else if err != nil {
+			return nil, errors.Wrapf(err, "failed to read %s", file)
+		}
+		var index versionIndex
+		if err = json.Unmarshal(data, &index); err != nil {
+			return nil, errors.Wrapf(err, "failed to decode %s", file)
+		}
+		paths = append(paths, index.Path)
+	}
+	sort.Strings(paths)
+
+	return paths, nil
+}
+
+// PurgeVersions removes all previous versions of the file at the path.
+//
+// Returns [ReservedPathErr] if the path is in the versions directory.
+func (vs *VersionedStore) PurgeVersions(path string) error {
+	if isVersionPath(path) {
+		return ReservedPathErr
+	}
+
+	vs.mux.Lock()
+	defer vs.mux.Unlock()
+	index, err := vs.loadIndex(path)
+	if err != nil {
+		return err
+	}
+	for _, v := range index.Versions {
+		err = vs.Store.Delete(versionPath(index.Path, v.ID))
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return errors.Wrapf(
+				err, "failed to remove version %d of %s", v.ID, path)
+		}
+	}
+	index.Versions = nil
+
+	return vs.storeIndex(index)
+}
+
+// save copies the current data of the file at the path into a new version,
+// unless the file does not exist or its data is the same as newData when it is
+// written, and removes the versions that exceed the limits. Must be called
+// while the lock is held.
+func (vs *VersionedStore) save(
+	path string, newData []byte, deleted bool) error {
+	data, err := vs.Store.Read(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return errors.Wrapf(err, "failed to read current version of %s", path)
+	} else if !deleted && bytes.Equal(data, newData) {
+		return nil
+	}
+	modified, err := vs.Store.GetLastModified(path)
+	if err != nil {
+		return errors.Wrapf(err, "failed to get modification time of %s", path)
+	}
+	index, err := vs.loadIndex(path)
+	if err != nil {
+		return err
+	}
+
+	// IDs are the time the version was replaced, made unique if the clock
+	// has not advanced since the last version
+	now := netTime.Now()
+	id := uint64(now.UnixNano())
+	if n := len(index.Versions); n > 0 && id <= index.Versions[n-1].ID {
+		id = index.Versions[n-1].ID + 1
+	}
+	err = vs.Store.Write(versionPath(path, id), data)
+	if err != nil {
+		return errors.Wrapf(err, "failed to save version of %s", path)
+	}
+	index.Versions = append(index.Versions, Version{
+		ID:       id,
+		Modified: modified,
+		Replaced: now,
+		Size:     int64(len(data)),
+		Deleted:  deleted,
+	})
+	vs.prune(index, now)
+
+	return vs.storeIndex(index)
+}
+
+// prune removes the oldest versions in the index, and their data, that exceed
+// the maximum number of versions or are older than the maximum age. Returns
+// true if any were removed. Must be called while the lock is held.
+func (vs *VersionedStore) prune(index *versionIndex, now time.Time) bool {
+	var expired int
+	for expired < len(index.Versions) &&
+		(len(index.Versions)-expired > vs.params.MaxVersions ||
+			(vs.params.MaxAge > 0 &&
+				now.Sub(index.Versions[expired].Replaced) > vs.params.MaxAge)) {
+		expired++
+	}
+
+	for _, v := range index.Versions[:expired] {
+		err := vs.Store.Delete(versionPath(index.Path, v.ID))
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			jww.WARN.Printf("Failed to remove version %d of %s: %+v",
+				v.ID, index.Path, err)
+		}
+	}
+	index.Versions = index.Versions[expired:]
+
+	return expired > 0
+}
+
+// loadIndex returns the index of the versions of the file at the path. Returns
+// an empty index if the file has no versions. Must be called while the lock is
+// held.
+func (vs *VersionedStore) loadIndex(path string) (*versionIndex, error) {
+	data, err := vs.Store.Read(versionPath(path, 0))
+	if errors.Is(err, os.ErrNotExist) {
+		return &versionIndex{Path: cleanPath(path)}, nil
+	} else if err != nil {
+		return nil, errors.Wrapf(err, "failed to read versions of %s", path)
+	}
+
+	var index versionIndex
+	if err = json.Unmarshal(data, &index); err != nil {
+		return nil, errors.Wrapf(err, "failed to decode versions of %s", path)
+	}
+	return &index, nil
+}
+
+// storeIndex writes the index of the versions of a file, or deletes it if
+// there are no versions left. Must be called while the lock is held.
+func (vs *VersionedStore) storeIndex(index *versionIndex) error {
+	indexPath := versionPath(index.Path, 0)
+	if len(index.Versions) == 0 {
+		err := vs.Store.Delete(indexPath)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return errors.Wrapf(
+				err, "failed to remove versions of %s", index.Path)
+		}
+		return nil
+	}
+
+	data, err := json.Marshal(index)
+	if err != nil {
+		return errors.Wrapf(err, "failed to encode versions of %s", index.Path)
+	}
+	if err = vs.Store.Write(indexPath, data); err != nil {
+		return errors.Wrapf(err, "failed to write versions of %s", index.Path)
+	}
+	return nil
+}
+
+// versionPath returns the path of the version of the file with the ID, or of
+// the index of its versions if the ID is zero.
+func versionPath(path string, id uint64) string {
+	hash := sha256.Sum256([]byte(cleanPath(path)))
+	name := versionIndexName
+	if id != 0 {
+		name = strconv.FormatUint(id, 10)
+	}
+	return versionsDir + "/" + hex.EncodeToString(hash[:]) + "/" + name
+}
+
+// isVersionPath returns true if the path is in the versions directory.
+func isVersionPath(path string) bool {
+	path = cleanPath(path)
+	return path == versionsDir || strings.HasPrefix(path, versionsDir+"/")
+}
+
+// cleanPath returns the path relative to the base path with forward slashes, so
+// that different forms of the same path match.
+func cleanPath(path string) string {
+	path = filepath.ToSlash(filepath.Clean(path))
+	if path = strings.TrimLeft(path, "/"); path == "" {
+		return "."
+	}
+	return path
+}
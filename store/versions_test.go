@@ -0,0 +1,268 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package store
+
+import (
+	"bytes"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Tests that VersionedStore adheres to the Store interface.
+var _ Store = (*VersionedStore)(nil)
+
+// Tests that VersionedStore adheres to the Versioner interface.
+var _ Versioner = (*VersionedStore)(nil)
+
+// Tests that VersionedStore adheres to the Lister interface.
+var _ Lister = (*VersionedStore)(nil)
+
+// Tests that VersionedStore adheres to the Sizer interface.
+var _ Sizer = (*VersionedStore)(nil)
+
+// newTestVersionedStore returns a VersionedStore of a MemStore with the
+// parameters.
+func newTestVersionedStore(
+	params map[string]interface{}, t *testing.T) *VersionedStore {
+	newStore, err := NewVersionedStore(params, NewMemStore)
+	if err != nil {
+		t.Fatalf("Failed to create versioned store: %+v", err)
+	}
+	s, err := newStore("", "user")
+	if err != nil {
+		t.Fatalf("Failed to create store: %+v", err)
+	}
+	return s.(*VersionedStore)
+}
+
+// Tests that VersionedStore.Write and VersionedStore.Delete save the replaced
+// data as versions that can be listed and read.
+func TestVersionedStore_ListVersions_ReadVersion(t *testing.T) {
+	vs := newTestVersionedStore(nil, t)
+
+	written := [][]byte{[]byte("one"), []byte("two"), []byte("three")}
+	for _, data := range written {
+		if err := vs.Write("dir/file", data); err != nil {
+			t.Fatalf("Failed to write %q: %+v", data, err)
+		}
+	}
+	if err := vs.Delete("dir/file"); err != nil {
+		t.Fatalf("Failed to delete file: %+v", err)
+	}
+
+	versions, err := vs.ListVersions("dir/./file")
+	if err != nil {
+		t.Fatalf("Failed to list versions: %+v", err)
+	} else if len(versions) != len(written) {
+		t.Fatalf("Unexpected number of versions.\nexpected: %d\nreceived: %d",
+			len(written), len(versions))
+	}
+	for i, v := range versions {
+		data, err := vs.ReadVersion("dir/file", v.ID)
+		if err != nil {
+			t.Errorf("Failed to read version %d: %+v", i, err)
+		} else if !bytes.Equal(data, written[i]) {
+			t.Errorf("Unexpected data of version %d."+
+				"\nexpected: %q\nreceived: %q", i, written[i], data)
+		}
+		if v.Size != int64(len(written[i])) {
+			t.Errorf("Unexpected size of version %d."+
+				"\nexpected: %d\nreceived: %d", i, len(written[i]), v.Size)
+		}
+		if deleted := i == len(written)-1; v.Deleted != deleted {
+			t.Errorf("Version %d deleted %t; expected %t.",
+				i, v.Deleted, deleted)
+		}
+		if i > 0 && v.ID <= versions[i-1].ID {
+			t.Errorf("ID of version %d %d not greater than previous ID %d.",
+				i, v.ID, versions[i-1].ID)
+		}
+	}
+}
+
+// Tests that VersionedStore.Write does not save a version when the data does
+// not change.
+func TestVersionedStore_Write_Unchanged(t *testing.T) {
+	vs := newTestVersionedStore(nil, t)
+	for i := 0; i < 3; i++ {
+		if err := vs.Write("file", []byte("data")); err != nil {
+			t.Fatalf("Failed to write file %d: %+v", i, err)
+		}
+	}
+
+	if versions, err := vs.ListVersions("file"); err != nil {
+		t.Fatalf("Failed to list versions: %+v", err)
+	} else if len(versions) != 0 {
+		t.Errorf("Unexpected versions of unchanged file: %+v", versions)
+	}
+}
+
+// Tests that only the newest versions up to the maximum are kept.
+func TestVersionedStore_MaxVersions(t *testing.T) {
+	vs := newTestVersionedStore(map[string]interface{}{"maxVersions": 2}, t)
+	for _, data := range []string{"a", "b", "c", "d"} {
+		if err := vs.Write("file", []byte(data)); err != nil {
+			t.Fatalf("Failed to write %q: %+v", data, err)
+		}
+	}
+
+	versions, err := vs.ListVersions("file")
+	if err != nil {
+		t.Fatalf("Failed to list versions: %+v", err)
+	}
+	var kept []string
+	for _, v := range versions {
+		data, err := vs.ReadVersion("file", v.ID)
+		if err != nil {
+			t.Fatalf("Failed to read version %d: %+v", v.ID, err)
+		}
+		kept = append(kept, string(data))
+	}
+	if expected := []string{"b", "c"}; !reflect.DeepEqual(kept, expected) {
+		t.Errorf("Unexpected versions.\nexpected: %q\nreceived: %q",
+			expected, kept)
+	}
+
+	// The data of removed versions is deleted
+	files, _ := vs.Store.(Lister).ListFiles()
+	if expected := 1 + 1 + 2; len(files) != expected {
+		t.Errorf("Unexpected number of stored files.\nexpected: %d\n"+
+			"received: %d: %q", expected, len(files), files)
+	}
+}
+
+// Tests that versions older than the maximum age are removed when the versions
+// are listed.
+func TestVersionedStore_MaxAge(t *testing.T) {
+	vs := newTestVersionedStore(
+		map[string]interface{}{"maxAge": "20ms"}, t)
+	_ = vs.Write("file", []byte("a"))
+	_ = vs.Write("file", []byte("b"))
+
+	if versions, _ := vs.ListVersions("file"); len(versions) != 1 {
+		t.Fatalf("Expected 1 version; received %d.", len(versions))
+	}
+	time.Sleep(30 * time.Millisecond)
+	if versions, _ := vs.ListVersions("file"); len(versions) != 0 {
+		t.Errorf("Expired versions not removed: %+v", versions)
+	}
+
+	// The index of the versions is removed with the last version
+	if files, _ := vs.Store.(Lister).ListFiles(); len(files) != 1 {
+		t.Errorf("Unexpected stored files: %q", files)
+	}
+}
+
+// Tests that the versions directory is hidden from VersionedStore.ReadDir and
+// VersionedStore.ListFiles.
+func TestVersionedStore_ReadDir_ListFiles(t *testing.T) {
+	vs := newTestVersionedStore(nil, t)
+	_ = vs.Write("dir/file", []byte("a"))
+	_ = vs.Write("dir/file", []byte("b"))
+
+	if dirs, err := vs.ReadDir(""); err != nil {
+		t.Fatalf("Failed to read directory: %+v", err)
+	} else if expected := []string{"dir"}; !reflect.DeepEqual(dirs, expected) {
+		t.Errorf("Unexpected directories.\nexpected: %q\nreceived: %q",
+			expected, dirs)
+	}
+	if files, err := vs.ListFiles(); err != nil {
+		t.Fatalf("Failed to list files: %+v", err)
+	} else if expected := []string{"dir/file"}; !reflect.DeepEqual(
+		files, expected) {
+		t.Errorf("Unexpected files.\nexpected: %q\nreceived: %q",
+			expected, files)
+	}
+}
+
+// Tests that VersionedStore.VersionedFiles lists the files with versions,
+// including deleted files, and that VersionedStore.PurgeVersions removes them.
+func TestVersionedStore_VersionedFiles_PurgeVersions(t *testing.T) {
+	vs := newTestVersionedStore(nil, t)
+	_ = vs.Write("a/file", []byte("1"))
+	_ = vs.Write("a/file", []byte("2"))
+	_ = vs.Write("b", []byte("1"))
+	_ = vs.Delete("b")
+	_ = vs.Write("c", []byte("1"))
+
+	paths, err := vs.VersionedFiles()
+	if err != nil {
+		t.Fatalf("Failed to list versioned files: %+v", err)
+	} else if expected := []string{"a/file", "b"}; !reflect.DeepEqual(
+		paths, expected) {
+		t.Errorf("Unexpected versioned files.\nexpected: %q\nreceived: %q",
+			expected, paths)
+	}
+
+	if err = vs.PurgeVersions("b"); err != nil {
+		t.Fatalf("Failed to purge versions: %+v", err)
+	}
+	if versions, _ := vs.ListVersions("b"); len(versions) != 0 {
+		t.Errorf("Versions not purged: %+v", versions)
+	}
+	files, _ := vs.Store.(Lister).ListFiles()
+	if expected := 2 + 1 + 1; len(files) != expected {
+		t.Errorf("Unexpected number of stored files.\nexpected: %d\n"+
+			"received: %d: %q", expected, len(files), files)
+	}
+}
+
+// Error path: Tests that the versions directory cannot be accessed.
+func TestVersionedStore_ReservedPathErr(t *testing.T) {
+	vs := newTestVersionedStore(nil, t)
+	_ = vs.Write("file", []byte("a"))
+	_ = vs.Write("file", []byte("b"))
+
+	paths := []string{".versions", "/.versions/x", "./.versions/x"}
+	for _, path := range paths {
+		if _, err := vs.Read(path); !errors.Is(err, ReservedPathErr) {
+			t.Errorf("Unexpected error reading %q: %v", path, err)
+		}
+		if err := vs.Write(path, nil); !errors.Is(err, ReservedPathErr) {
+			t.Errorf("Unexpected error writing %q: %v", path, err)
+		}
+		if err := vs.Delete(path); !errors.Is(err, ReservedPathErr) {
+			t.Errorf("Unexpected error deleting %q: %v", path, err)
+		}
+		if _, err := vs.ReadDir(path); !errors.Is(err, ReservedPathErr) {
+			t.Errorf("Unexpected error listing %q: %v", path, err)
+		}
+	}
+}
+
+// Error path: Tests that VersionedStore.ReadVersion returns os.ErrNotExist for
+// an unknown version.
+func TestVersionedStore_ReadVersion_ErrNotExist(t *testing.T) {
+	vs := newTestVersionedStore(nil, t)
+	_ = vs.Write("file", []byte("a"))
+	_ = vs.Write("file", []byte("b"))
+
+	if _, err := vs.ReadVersion("file", 1); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Unexpected error.\nexpected: %v\nreceived: %v",
+			os.ErrNotExist, err)
+	}
+}
+
+// Error path: Tests that NewVersionedStore returns an error for invalid
+// parameters.
+func TestNewVersionedStore_Error(t *testing.T) {
+	tests := map[string]map[string]interface{}{
+		"zero maxVersions": {"maxVersions": 0},
+		"negative maxAge":  {"maxAge": "-1h"},
+		"unknown key":      {"versions": 5},
+	}
+	for name, params := range tests {
+		if _, err := NewVersionedStore(params, NewMemStore); err == nil {
+			t.Errorf("Failed to get error for %s.", name)
+		}
+	}
+}